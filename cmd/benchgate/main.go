@@ -0,0 +1,75 @@
+// benchgate 把 go test -bench 的输出与保存的基线比较，有指标变差超过阈值时以状态码 1 退出。
+// 性能回归套件是 SSH 链建立、上传吞吐、不同 RTT 下的 Portal 流吞吐和终端回显延迟，其余是组件的微基准：
+//
+//	BENCH='^Benchmark(ChainConnect|Upload|StreamThroughput|EchoLatency)$'
+//	go test -run '^$' -bench "$BENCH" -count 5 ./... | go run ./cmd/benchgate
+//	go test -run '^$' -bench "$BENCH" -count 5 ./... | go run ./cmd/benchgate -update   # 重新记录基线
+//
+// 基线与机器相关，更换 CI 机器后应重新记录
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/luobobo896/HSSH/internal/benchgate"
+)
+
+func main() {
+	baselinePath := flag.String("baseline", "cmd/benchgate/baseline.txt", "baseline file written by -update")
+	threshold := flag.Float64("threshold", 0.2, "allowed slowdown per metric (0.2 = 20%)")
+	update := flag.Bool("update", false, "save the input as the new baseline instead of comparing")
+	flag.Parse()
+
+	// 原样转发输入，流水线中仍能看到 go test 的输出
+	current, err := benchgate.Parse(io.TeeReader(os.Stdin, os.Stdout))
+	if err != nil {
+		fail(err)
+	}
+	if len(current) == 0 {
+		fail(fmt.Errorf("no benchmark results on stdin"))
+	}
+
+	if *update {
+		file, err := os.Create(*baselinePath)
+		if err != nil {
+			fail(err)
+		}
+		if err := benchgate.Write(file, current); err != nil {
+			fail(err)
+		}
+		if err := file.Close(); err != nil {
+			fail(err)
+		}
+		fmt.Printf("benchgate: saved %d benchmarks to %s\n", len(current), *baselinePath)
+		return
+	}
+
+	file, err := os.Open(*baselinePath)
+	if err != nil {
+		fail(fmt.Errorf("%w (record one with -update)", err))
+	}
+	baseline, err := benchgate.Parse(file)
+	file.Close()
+	if err != nil {
+		fail(err)
+	}
+
+	regressions := benchgate.Compare(baseline, current, *threshold)
+	if len(regressions) == 0 {
+		fmt.Printf("benchgate: %d benchmarks within %.0f%% of %s\n", len(current), *threshold*100, *baselinePath)
+		return
+	}
+	fmt.Printf("benchgate: %d regressions over %.0f%%:\n", len(regressions), *threshold*100)
+	for _, regression := range regressions {
+		fmt.Println("  " + regression.String())
+	}
+	os.Exit(1)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "benchgate:", err)
+	os.Exit(2)
+}
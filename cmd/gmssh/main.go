@@ -1,20 +1,84 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/luobobo896/HSSH/internal/api"
 	"github.com/luobobo896/HSSH/internal/cli"
+	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/internal/i18n"
+	"github.com/luobobo896/HSSH/internal/logging"
+	"github.com/luobobo896/HSSH/internal/netem"
+	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/internal/tracing"
+	"github.com/luobobo896/HSSH/internal/transfer"
 	"github.com/luobobo896/HSSH/pkg/types"
 )
 
+// shutdownTracing 刷新并关闭追踪导出器，未启用时为空操作
+var shutdownTracing tracing.ShutdownFunc = func(context.Context) error { return nil }
+
+// flushTracing 导出尚未发送的 span
+func flushTracing() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdownTracing(ctx)
+}
+
+// exit 先刷新追踪数据再退出（os.Exit 不会执行 defer）
+func exit(code int) {
+	flushTracing()
+	os.Exit(code)
+}
+
+// fail 输出命令错误并以对应失败类型的退出码退出
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_ERROR", err))
+	exit(cli.ExitCode(err))
+}
+
+// timeoutGrace 超过 --timeout 后留给命令自行取消并输出结果的时间，之后强制退出
+const timeoutGrace = 5 * time.Second
+
+// longRunning 持续运行直到被中断的命令，--timeout 只限制其建立连接，不会强制退出
+var longRunning = map[string]bool{"proxy": true, "web": true, "portal": true, "agent": true}
+
 func main() {
+	os.Args = parseLangFlag(os.Args)
+	args, batch, err := parseBatchFlags(os.Args)
+	if err != nil {
+		printError("CLI_INVALID_GLOBAL_FLAG", err)
+		exit(cli.ExitUsage)
+	}
+	args, flagOverrides, err := parseConfigFlags(args)
+	if err != nil {
+		printError("CLI_INVALID_GLOBAL_FLAG", err)
+		exit(cli.ExitUsage)
+	}
+	// 命令行参数优先于环境变量，两者都优先于 config.yaml
+	overrides := flagOverrides.Or(config.EnvOverrides())
+	config.SetOverrides(overrides)
+	if err := logging.SetLevel(overrides.LogLevel); err != nil {
+		printError("CLI_INVALID_GLOBAL_FLAG", err)
+		exit(cli.ExitUsage)
+	}
+	if err := netem.Set(overrides.Netem); err != nil {
+		printError("CLI_INVALID_GLOBAL_FLAG", err)
+		exit(cli.ExitUsage)
+	}
+	os.Args = args
 	if len(os.Args) < 2 {
 		printUsage()
-		os.Exit(1)
+		exit(cli.ExitUsage)
 	}
 
 	command := os.Args[1]
@@ -22,22 +86,109 @@ func main() {
 	// 创建 CLI 实例
 	c, err := cli.NewCLI()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		fail(err)
+	}
+	c.SetBatchOptions(batch)
+	// web、portal 和 agent 是长期运行的服务，不在终端上等待私钥口令；web 通过 POST /api/servers/{id}/unlock 提供
+	switch command {
+	case "web", "portal", "agent":
+	default:
+		c.EnableKeyPassphrasePrompt()
+		c.EnableKeyboardInteractivePrompt()
+	}
+	if overrides.LogLevel == "" {
+		if err := logging.SetLevel(c.Config().LogLevel); err != nil {
+			fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_WARNING_LOG_LEVEL", err))
+		}
+	}
+	if overrides.Netem == "" {
+		if err := netem.Set(c.Config().DebugNetem); err != nil {
+			fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_WARNING_NETEM", err))
+		}
+	}
+	if batch.Timeout > 0 && !longRunning[command] {
+		time.AfterFunc(batch.Timeout+timeoutGrace, func() {
+			fail(fmt.Errorf("command did not finish within %s: %w", batch.Timeout, context.DeadlineExceeded))
+		})
+	}
+
+	// OpenTelemetry 追踪（配置 tracing.endpoint 或 OTEL_EXPORTER_OTLP_ENDPOINT 时启用）
+	shutdown, err := tracing.Setup(context.Background(), "gmssh-"+command, c.Config().Tracing)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_WARNING_TRACING", err))
+	} else {
+		shutdownTracing = shutdown
 	}
+	defer flushTracing()
 
 	switch command {
 	case "upload":
 		uploadCmd := flag.NewFlagSet("upload", flag.ExitOnError)
 		source := uploadCmd.String("source", "", "Source file path")
-		target := uploadCmd.String("target", "", "Target host:path")
+		target := uploadCmd.String("target", "", "Target host:path, or s3://bucket/key@host, oss://bucket/key@host, https://presigned-url@host")
 		via := uploadCmd.String("via", "", "Comma-separated list of intermediate hops")
+		delta := uploadCmd.Bool("delta", false, "Send only the changed blocks of a file that already exists on the remote")
+		mode := uploadCmd.String("mode", transfer.ModeTunnel, "tunnel, relay (gateways forward hop to hop), stage (store on the last gateway, then push over its LAN) or compare (measure tunnel and relay)")
+		confirm := uploadCmd.String("confirm", "", "Target server name, confirming an upload its environment policy guards (e.g. prod)")
+		retries := uploadCmd.Int("retries", 0, "Reconnect and resume this many times after a connection or transfer failure")
+		retryDelay := uploadCmd.Duration("retry-delay", cli.DefaultRetryDelay, "Wait between retries")
 		uploadCmd.Parse(os.Args[2:])
 
 		if *source == "" || *target == "" {
-			fmt.Fprintln(os.Stderr, "Error: source and target are required")
+			printError("CLI_UPLOAD_ARGS_REQUIRED")
 			uploadCmd.Usage()
-			os.Exit(1)
+			exit(cli.ExitUsage)
+		}
+
+		var viaList []string
+		if *via != "" {
+			viaList = strings.Split(*via, ",")
+		}
+
+		if err := c.UploadCommand(*source, *target, viaList, cli.UploadOptions{
+			Delta: *delta, Mode: *mode, Confirm: *confirm, Retries: *retries, RetryDelay: *retryDelay,
+		}); err != nil {
+			fail(err)
+		}
+
+	case "download":
+		downloadCmd := flag.NewFlagSet("download", flag.ExitOnError)
+		source := downloadCmd.String("source", "", "Source host:path")
+		target := downloadCmd.String("target", "", "Local target path")
+		via := downloadCmd.String("via", "", "Comma-separated list of intermediate hops")
+		streams := downloadCmd.Int("streams", transfer.DefaultDownloadStreams, "Parallel tar streams for directories")
+		verify := downloadCmd.Bool("verify", false, "Compare sha256 of every file with the remote after download")
+		manifest := downloadCmd.String("manifest", "", "Write a JSON integrity manifest for directory downloads")
+		downloadCmd.Parse(os.Args[2:])
+
+		if *source == "" || *target == "" {
+			printError("CLI_DOWNLOAD_ARGS_REQUIRED")
+			downloadCmd.Usage()
+			exit(cli.ExitUsage)
+		}
+
+		var viaList []string
+		if *via != "" {
+			viaList = strings.Split(*via, ",")
+		}
+
+		opts := cli.DownloadOptions{Streams: *streams, Verify: *verify, Manifest: *manifest}
+		if err := c.DownloadCommand(*source, *target, viaList, opts); err != nil {
+			fail(err)
+		}
+
+	case "fetch-dir":
+		fetchCmd := flag.NewFlagSet("fetch-dir", flag.ExitOnError)
+		source := fetchCmd.String("source", "", "Remote directory host:path")
+		target := fetchCmd.String("target", "", "Local archive path or directory (default ./<dir>.tar.gz)")
+		via := fetchCmd.String("via", "", "Comma-separated list of intermediate hops")
+		remoteTmp := fetchCmd.String("remote-tmp", "", "Remote directory for the temporary archive (default $TMPDIR or /tmp)")
+		fetchCmd.Parse(os.Args[2:])
+
+		if *source == "" {
+			printError("CLI_FETCH_DIR_ARGS_REQUIRED")
+			fetchCmd.Usage()
+			exit(cli.ExitUsage)
 		}
 
 		var viaList []string
@@ -45,23 +196,38 @@ func main() {
 			viaList = strings.Split(*via, ",")
 		}
 
-		if err := c.UploadCommand(*source, *target, viaList); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		if err := c.FetchDirCommand(*source, *target, viaList, cli.FetchDirOptions{RemoteTemp: *remoteTmp}); err != nil {
+			fail(err)
 		}
 
 	case "proxy":
 		proxyCmd := flag.NewFlagSet("proxy", flag.ExitOnError)
-		local := proxyCmd.String("local", ":0", "Local listen address")
-		remoteHost := proxyCmd.String("remote-host", "", "Remote target host")
+		local := proxyCmd.String("local", ":0", "Local listen address, port range (e.g. 127.0.0.1:9000-9010) or unix socket path")
+		var remotes multiFlag
+		proxyCmd.Var(&remotes, "remote", "Remote target host:port, host:port-port or unix socket path (repeatable)")
+		targetsFile := proxyCmd.String("targets", "", "File with one remote target per line")
+		remoteHost := proxyCmd.String("remote-host", "", "Remote target host or unix socket path")
 		remotePort := proxyCmd.Int("remote-port", 0, "Remote target port")
 		via := proxyCmd.String("via", "", "Comma-separated list of intermediate hops")
+		allowLAN := proxyCmd.Bool("allow-lan", false, "Allow listening on addresses reachable from other machines (asks for confirmation)")
 		proxyCmd.Parse(os.Args[2:])
 
-		if *remoteHost == "" || *remotePort == 0 {
-			fmt.Fprintln(os.Stderr, "Error: remote-host and remote-port are required")
+		if *remoteHost != "" || *remotePort != 0 {
+			switch {
+			case proxy.IsUnixSocket(*remoteHost):
+				remotes = append(remotes, *remoteHost)
+			case *remoteHost == "" || *remotePort == 0:
+				printError("CLI_PROXY_ARGS_REQUIRED")
+				proxyCmd.Usage()
+				exit(cli.ExitUsage)
+			default:
+				remotes = append(remotes, net.JoinHostPort(*remoteHost, strconv.Itoa(*remotePort)))
+			}
+		}
+		if len(remotes) == 0 && *targetsFile == "" {
+			printError("CLI_PROXY_ARGS_REQUIRED")
 			proxyCmd.Usage()
-			os.Exit(1)
+			exit(cli.ExitUsage)
 		}
 
 		var viaList []string
@@ -69,21 +235,72 @@ func main() {
 			viaList = strings.Split(*via, ",")
 		}
 
-		if err := c.ProxyCommand(*local, *remoteHost, *remotePort, viaList); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		if err := c.ProxyCommand(*local, remotes, *targetsFile, viaList, *allowLAN); err != nil {
+			fail(err)
 		}
 
 	case "probe":
 		probeCmd := flag.NewFlagSet("probe", flag.ExitOnError)
 		target := probeCmd.String("target", "", "Target host to probe")
-		via := probeCmd.String("via", "", "Comma-separated list of intermediate hops")
+		var viaChains multiFlag
+		probeCmd.Var(&viaChains, "via", "Comma-separated hop chain to compare (repeatable)")
+		count := probeCmd.Int("count", 3, "Probes per path")
+		port := probeCmd.Int("port", 0, "TCP port to connect to through the chain's last hop instead of probing SSH latency")
+		asJSON := probeCmd.Bool("json", false, "Print results as JSON")
+		watch := probeCmd.Bool("watch", false, "Re-probe every --interval and refresh the table until Ctrl+C")
+		interval := probeCmd.Duration("interval", cli.DefaultWatchInterval, "Refresh interval for --watch")
 		probeCmd.Parse(os.Args[2:])
 
 		if *target == "" {
-			fmt.Fprintln(os.Stderr, "Error: target is required")
+			printError("ERR_TARGET_REQUIRED")
 			probeCmd.Usage()
-			os.Exit(1)
+			exit(cli.ExitUsage)
+		}
+
+		var chains [][]string
+		for _, via := range viaChains {
+			if via != "" {
+				chains = append(chains, strings.Split(via, ","))
+			}
+		}
+
+		if *watch {
+			if err := c.ProbeWatchCommand(*target, chains, *count, *interval); err != nil {
+				fail(err)
+			}
+			break
+		}
+
+		if *port != 0 {
+			if len(chains) > 1 {
+				fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_ERROR", "--port accepts a single --via chain"))
+				exit(cli.ExitUsage)
+			}
+			var via []string
+			if len(chains) == 1 {
+				via = chains[0]
+			}
+			if err := c.TCPingCommand(*target, *port, via, *count, *asJSON || batch.Quiet); err != nil {
+				fail(err)
+			}
+			break
+		}
+
+		if err := c.ProbeCommand(*target, chains, *count, *asJSON || batch.Quiet); err != nil {
+			fail(err)
+		}
+
+	case "trace":
+		traceCmd := flag.NewFlagSet("trace", flag.ExitOnError)
+		target := traceCmd.String("target", "", "Target server to trace")
+		via := traceCmd.String("via", "", "Comma-separated list of intermediate hops")
+		asJSON := traceCmd.Bool("json", false, "Print the report as JSON")
+		traceCmd.Parse(os.Args[2:])
+
+		if *target == "" {
+			printError("ERR_TARGET_REQUIRED")
+			traceCmd.Usage()
+			exit(cli.ExitUsage)
 		}
 
 		var viaList []string
@@ -91,200 +308,755 @@ func main() {
 			viaList = strings.Split(*via, ",")
 		}
 
-		if err := c.ProbeCommand(*target, viaList); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		if err := c.TraceCommand(*target, viaList, *asJSON || batch.Quiet); err != nil {
+			fail(err)
 		}
 
 	case "status":
-		if err := c.StatusCommand(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		statusCmd := flag.NewFlagSet("status", flag.ExitOnError)
+		showUsage := statusCmd.Bool("usage", false, "Show per-server sessions, uploads, traffic and tunnel hours")
+		days := statusCmd.Int("days", 30, "Days of usage to sum (with --usage)")
+		asJSON := statusCmd.Bool("json", false, "Print usage as JSON (with --usage)")
+		watch := statusCmd.Bool("watch", false, "Refresh a dashboard of servers, tunnels and sessions until Ctrl+C")
+		interval := statusCmd.Duration("interval", cli.DefaultWatchInterval, "Refresh interval for --watch")
+		statusCmd.Parse(os.Args[2:])
+
+		if *watch {
+			if err := c.StatusWatchCommand(*interval); err != nil {
+				fail(err)
+			}
+		} else if *showUsage {
+			if err := c.UsageCommand(*days, *asJSON || batch.Quiet); err != nil {
+				fail(err)
+			}
+		} else if err := c.StatusCommand(); err != nil {
+			fail(err)
+		}
+
+	case "search":
+		searchCmd := flag.NewFlagSet("search", flag.ExitOnError)
+		kinds := searchCmd.String("type", "", "Comma-separated result types: server, mapping, transfer, audit")
+		days := searchCmd.Int("days", 0, "Only transfers and audit entries from the last n days")
+		limit := searchCmd.Int("limit", 50, "Maximum number of results")
+		asJSON := searchCmd.Bool("json", false, "Print results as JSON")
+		// 搜索词写在选项之前或之后均可
+		args := os.Args[2:]
+		var words []string
+		for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			words, args = append(words, args[0]), args[1:]
+		}
+		searchCmd.Parse(args)
+		words = append(words, searchCmd.Args()...)
+		if len(words) == 0 {
+			printError("CLI_SEARCH_QUERY_REQUIRED")
+			exit(cli.ExitUsage)
+		}
+
+		if err := c.SearchCommand(strings.Join(words, " "), *kinds, *days, *limit, *asJSON || batch.Quiet); err != nil {
+			fail(err)
+		}
+
+	case "export":
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "-") {
+			printError("CLI_EXPORT_KIND_REQUIRED")
+			exit(cli.ExitUsage)
+		}
+		exportCmd := flag.NewFlagSet("export", flag.ExitOnError)
+		from := exportCmd.String("from", "", "Start date (YYYY-MM-DD) or RFC 3339 time")
+		to := exportCmd.String("to", "", "End date (inclusive) or RFC 3339 time")
+		out := exportCmd.String("out", "", "Output file (default: standard output)")
+		format := exportCmd.String("format", "csv", "Output format (csv)")
+		exportCmd.Parse(os.Args[3:])
+		if *format != "csv" {
+			fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_ERROR", fmt.Errorf("unsupported format %q, only csv is available", *format)))
+			exit(cli.ExitUsage)
+		}
+
+		if err := c.ExportCommand(os.Args[2], *from, *to, *out); err != nil {
+			fail(err)
+		}
+
+	case "hostkey":
+		if len(os.Args) < 4 || (os.Args[2] != "accept" && os.Args[2] != "forget") {
+			printError("CLI_HOSTKEY_USAGE")
+			exit(cli.ExitUsage)
+		}
+		switch os.Args[2] {
+		case "accept":
+			acceptCmd := flag.NewFlagSet("hostkey accept", flag.ExitOnError)
+			fingerprint := acceptCmd.String("fingerprint", "", "Expected SHA256 fingerprint of the server's host key")
+			yes := acceptCmd.Bool("yes", false, "Trust every offered host key without asking")
+			acceptCmd.Parse(os.Args[4:])
+			if err := c.HostKeyAcceptCommand(os.Args[3], *fingerprint, *yes); err != nil {
+				fail(err)
+			}
+		case "forget":
+			if err := c.HostKeyForgetCommand(os.Args[3]); err != nil {
+				fail(err)
+			}
+		}
+
+	case "panic":
+		panicCmd := flag.NewFlagSet("panic", flag.ExitOnError)
+		addr := panicCmd.String("addr", "", "Address of the running web UI (default: web.bind on this machine)")
+		token := panicCmd.String("token", "", "Admin token (default: GMSSH_AUTH_TOKEN or the first admin in config)")
+		asJSON := panicCmd.Bool("json", false, "Print the result as JSON")
+		panicCmd.Parse(os.Args[2:])
+
+		if err := c.PanicCommand(*addr, *token, *asJSON || batch.Quiet); err != nil {
+			fail(err)
+		}
+
+	case "apply":
+		applyCmd := flag.NewFlagSet("apply", flag.ExitOnError)
+		file := applyCmd.String("f", "", "State file (YAML) with servers, mappings and proxies")
+		applyCmd.StringVar(file, "file", "", "Same as -f")
+		prune := applyCmd.Bool("prune", false, "Delete entries created by apply that are no longer in the file")
+		dryRun := applyCmd.Bool("dry-run", false, "Print the plan without changing anything")
+		addr := applyCmd.String("addr", "", "Address of the running web UI for proxies (default: web.bind on this machine)")
+		token := applyCmd.String("token", "", "Admin token (default: GMSSH_AUTH_TOKEN or the first admin in config)")
+		asJSON := applyCmd.Bool("json", false, "Print the plan and result as JSON")
+		applyCmd.Parse(os.Args[2:])
+
+		if *file == "" {
+			printError("CLI_APPLY_FILE_REQUIRED")
+			applyCmd.Usage()
+			exit(cli.ExitUsage)
+		}
+		opts := cli.ApplyOptions{File: *file, Prune: *prune, DryRun: *dryRun, Addr: *addr, Token: *token, JSON: *asJSON}
+		if err := c.ApplyCommand(opts); err != nil {
+			fail(err)
+		}
+
+	case "init":
+		initCmd := flag.NewFlagSet("init", flag.ExitOnError)
+		sshConfig := initCmd.String("ssh-config", "", "OpenSSH config to import (default ~/.ssh/config)")
+		noImport := initCmd.Bool("no-import", false, "Do not offer to import the OpenSSH config")
+		noCheck := initCmd.Bool("no-check", false, "Do not test connections while adding servers")
+		initCmd.Parse(os.Args[2:])
+
+		opts := cli.InitOptions{SSHConfig: *sshConfig, NoImport: *noImport, NoCheck: *noCheck}
+		if err := c.InitCommand(opts); err != nil {
+			fail(err)
+		}
+
+	case "connect":
+		connectCmd := flag.NewFlagSet("connect", flag.ExitOnError)
+		via := connectCmd.String("via", "", "Comma-separated list of intermediate hops (default: the server's gateways)")
+
+		// 服务器名称写在选项之前或之后均可，"-" 为最近使用的服务器
+		args := os.Args[2:]
+		target := ""
+		if len(args) > 0 && (args[0] == "-" || !strings.HasPrefix(args[0], "-")) {
+			target, args = args[0], args[1:]
+		}
+		connectCmd.Parse(args)
+		if target == "" && connectCmd.NArg() > 0 {
+			target = connectCmd.Arg(0)
+		}
+
+		var viaList []string
+		if *via != "" {
+			viaList = strings.Split(*via, ",")
+		}
+		if err := c.ConnectCommand(target, viaList); err != nil {
+			fail(err)
 		}
 
 	case "server":
 		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "Error: server subcommand required (add, list, delete)")
-			os.Exit(1)
+			printError("CLI_SERVER_SUBCOMMAND")
+			exit(cli.ExitUsage)
 		}
 
 		subCommand := os.Args[2]
 		switch subCommand {
 		case "list":
-			if err := c.ServerListCommand(); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
+			listCmd := flag.NewFlagSet("server list", flag.ExitOnError)
+			query := listCmd.String("q", "", "Only list servers whose name, host, tags, environment or notes match")
+			listCmd.Parse(os.Args[3:])
+
+			if err := c.ServerListCommand(*query); err != nil {
+				fail(err)
+			}
+
+		case "show":
+			if len(os.Args) < 4 || strings.HasPrefix(os.Args[3], "-") {
+				printError("CLI_HOP_NAME_OR_ID_REQUIRED")
+				exit(cli.ExitUsage)
+			}
+			if err := c.ServerShowCommand(os.Args[3]); err != nil {
+				fail(err)
+			}
+
+		case "notes":
+			if len(os.Args) < 4 || strings.HasPrefix(os.Args[3], "-") {
+				printError("CLI_HOP_NAME_OR_ID_REQUIRED")
+				exit(cli.ExitUsage)
+			}
+			notesCmd := flag.NewFlagSet("server notes", flag.ExitOnError)
+			description := notesCmd.String("description", "", "Free-form description")
+			owner := notesCmd.String("owner", "", "Owning person or team")
+			contact := notesCmd.String("contact", "", "How to reach the owner (mail, phone, chat)")
+			runbook := notesCmd.String("runbook", "", "Runbook URL (http or https)")
+			location := notesCmd.String("location", "", "Rack, room or VM host/cluster")
+			var fields multiFlag
+			notesCmd.Var(&fields, "field", "Custom field key=value; an empty value removes it (repeatable)")
+			clear := notesCmd.Bool("clear", false, "Remove all notes before applying the other flags")
+			notesCmd.Parse(os.Args[4:])
+
+			update := cli.NotesUpdate{Clear: *clear}
+			if flagPassed(notesCmd, "description") {
+				update.Description = description
+			}
+			if flagPassed(notesCmd, "owner") {
+				update.Owner = owner
+			}
+			if flagPassed(notesCmd, "contact") {
+				update.Contact = contact
+			}
+			if flagPassed(notesCmd, "runbook") {
+				update.Runbook = runbook
+			}
+			if flagPassed(notesCmd, "location") {
+				update.Location = location
+			}
+			for _, field := range fields {
+				key, value, ok := strings.Cut(field, "=")
+				if !ok || key == "" {
+					fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_ERROR", fmt.Errorf("--field must be key=value, got %q", field)))
+					exit(cli.ExitUsage)
+				}
+				if update.Fields == nil {
+					update.Fields = make(map[string]string)
+				}
+				update.Fields[key] = value
+			}
+			if err := c.ServerNotesCommand(os.Args[3], update); err != nil {
+				fail(err)
 			}
 
 		case "add":
 			addCmd := flag.NewFlagSet("server add", flag.ExitOnError)
 			name := addCmd.String("name", "", "Server name")
 			host := addCmd.String("host", "", "Server host")
-			port := addCmd.Int("port", 22, "Server port")
+			port := addCmd.Int("port", 0, "Server port (default server_defaults.port or 22)")
 			user := addCmd.String("user", "", "Username")
-			authType := addCmd.String("auth", "key", "Auth type: key or password")
+			authType := addCmd.String("auth", "key", "Auth type: key, password or agent (keys in SSH_AUTH_SOCK)")
 			keyPath := addCmd.String("key-path", "", "SSH key path (for key auth)")
 			password := addCmd.String("password", "", "Password (for password auth)")
-			addCmd.Parse(os.Args[3:])
+			tags := addCmd.String("tags", "", "Comma-separated tags (e.g. prod,db)")
+			environment := addCmd.String("environment", "", "Environment label (e.g. prod, staging, dev)")
+			clientVersion := addCmd.String("client-version", "", "SSH version string to send (e.g. OpenSSH_8.9p1) for gateways that filter client banners")
+			legacyCrypto := addCmd.Bool("legacy-crypto", false, "Allow deprecated algorithms (sha1 key exchange, CBC, hmac-sha1) for old network devices")
+			agentForwarding := addCmd.Bool("agent-forwarding", false, "Forward the local ssh-agent to terminals on this server (also needs agent_forwarding.enabled in config)")
+			hostKeyPolicy := addCmd.String("host-key-policy", "", "Host key checking: tofu (default), strict or off")
+			keyPassphraseEnv := addCmd.String("key-passphrase-env", "", "Environment variable holding the passphrase of an encrypted key (default: ask when connecting)")
+			via := addCmd.String("via", "", "Gateway server the new server is reached through")
+
+			// 可以用 user@host:port 连接串代替 --user/--host/--port，写在选项之前或之后均可
+			args := os.Args[3:]
+			address := ""
+			if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+				address, args = args[0], args[1:]
+			}
+			addCmd.Parse(args)
+			if address == "" {
+				address = addCmd.Arg(0)
+			}
 
-			if *name == "" || *host == "" || *user == "" {
-				fmt.Fprintln(os.Stderr, "Error: name, host, and user are required")
+			if *host == "" && address == "" {
+				printError("ERR_HOP_FIELDS_REQUIRED")
 				addCmd.Usage()
-				os.Exit(1)
+				exit(cli.ExitUsage)
 			}
 
-			var auth types.AuthMethod
-			switch *authType {
-			case "key":
-				auth = types.AuthKey
-				if *keyPath == "" {
-					*keyPath = "~/.ssh/id_rsa"
-				}
-			case "password":
-				auth = types.AuthPassword
-			default:
-				fmt.Fprintf(os.Stderr, "Error: invalid auth type '%s'\n", *authType)
-				os.Exit(1)
+			auth, err := types.ParseAuthMethod(*authType)
+			if err != nil {
+				printError("ERR_INVALID_AUTH_TYPE", *authType)
+				exit(cli.ExitUsage)
+			}
+
+			var tagList []string
+			if *tags != "" {
+				tagList = strings.Split(*tags, ",")
 			}
 
 			hop := &types.Hop{
-				Name:     *name,
-				Host:     *host,
-				Port:     *port,
-				User:     *user,
-				AuthType: auth,
-				KeyPath:  *keyPath,
-				Password: *password,
+				Name:                 *name,
+				Host:                 *host,
+				Port:                 *port,
+				User:                 *user,
+				AuthType:             auth,
+				KeyPath:              *keyPath,
+				Password:             *password,
+				Tags:                 tagList,
+				Environment:          *environment,
+				LegacyCrypto:         *legacyCrypto,
+				AllowAgentForwarding: *agentForwarding,
+				HostKeyPolicy:        *hostKeyPolicy,
+			}
+			if *keyPassphraseEnv != "" {
+				hop.KeyPassphrase = "env:" + *keyPassphraseEnv
+			}
+			if err := types.ValidateHostKeySettings(hop.HostKeyPolicy, ""); err != nil {
+				fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_ERROR", err))
+				exit(cli.ExitUsage)
+			}
+			if hop.ClientVersion, err = types.NormalizeClientVersion(*clientVersion); err != nil {
+				fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_ERROR", err))
+				exit(cli.ExitUsage)
 			}
 
-			if err := c.ServerAddCommand(hop); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
+			if err := c.ServerAddCommand(hop, address, *via); err != nil {
+				fail(err)
 			}
 
 		case "delete":
 			if len(os.Args) < 4 {
-				fmt.Fprintln(os.Stderr, "Error: server name required")
-				os.Exit(1)
+				printError("CLI_HOP_NAME_REQUIRED")
+				exit(cli.ExitUsage)
 			}
 			name := os.Args[3]
-			if err := c.ServerDeleteCommand(name); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
+			deleteCmd := flag.NewFlagSet("server delete", flag.ExitOnError)
+			confirm := deleteCmd.String("confirm", "", "Server name, confirming a delete its environment policy guards (e.g. prod)")
+			deleteCmd.Parse(os.Args[4:])
+			if err := c.ServerDeleteCommand(name, *confirm); err != nil {
+				fail(err)
+			}
+
+		case "trash":
+			if err := c.ServerTrashCommand(); err != nil {
+				fail(err)
+			}
+
+		case "check":
+			checkCmd := flag.NewFlagSet("server check", flag.ExitOnError)
+			all := checkCmd.Bool("all", false, "Check every configured server")
+			parallel := checkCmd.Int("parallel", 8, "Servers checked at once")
+			asJSON := checkCmd.Bool("json", false, "Print results as JSON")
+			checkCmd.Parse(os.Args[3:])
+
+			if !*all && checkCmd.NArg() == 0 {
+				printError("CLI_CHECK_TARGET_REQUIRED")
+				exit(cli.ExitUsage)
+			}
+			if err := c.ServerCheckCommand(checkCmd.Args(), *all, *parallel, *asJSON || batch.Quiet); err != nil {
+				fail(err)
+			}
+
+		case "clone":
+			if len(os.Args) < 4 || strings.HasPrefix(os.Args[3], "-") {
+				printError("CLI_HOP_NAME_OR_ID_REQUIRED")
+				exit(cli.ExitUsage)
+			}
+			cloneCmd := flag.NewFlagSet("server clone", flag.ExitOnError)
+			name := cloneCmd.String("name", "", "Name of the copy")
+			host := cloneCmd.String("host", "", "Host of the copy (default: same as the source)")
+			port := cloneCmd.Int("port", 0, "Port of the copy (default: same as the source)")
+			user := cloneCmd.String("user", "", "Username of the copy (default: same as the source)")
+			cloneCmd.Parse(os.Args[4:])
+
+			if *name == "" {
+				printError("ERR_CLONE_NAME_REQUIRED")
+				cloneCmd.Usage()
+				exit(cli.ExitUsage)
+			}
+			if err := c.ServerCloneCommand(os.Args[3], *name, *host, *port, *user); err != nil {
+				fail(err)
+			}
+
+		case "restore":
+			if len(os.Args) < 4 {
+				printError("CLI_HOP_NAME_OR_ID_REQUIRED")
+				exit(cli.ExitUsage)
+			}
+			if err := c.ServerRestoreCommand(os.Args[3]); err != nil {
+				fail(err)
+			}
+
+		case "favorite":
+			if len(os.Args) < 4 || strings.HasPrefix(os.Args[3], "-") {
+				printError("CLI_HOP_NAME_OR_ID_REQUIRED")
+				exit(cli.ExitUsage)
+			}
+			favoriteCmd := flag.NewFlagSet("server favorite", flag.ExitOnError)
+			off := favoriteCmd.Bool("off", false, "Remove the favorite mark")
+			favoriteCmd.Parse(os.Args[4:])
+
+			if err := c.ServerFavoriteCommand(os.Args[3], !*off); err != nil {
+				fail(err)
+			}
+
+		default:
+			fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_UNKNOWN_SUBCOMMAND", "server", subCommand))
+			exit(cli.ExitUsage)
+		}
+
+	case "key":
+		if len(os.Args) < 3 {
+			printError("CLI_KEY_SUBCOMMAND")
+			exit(cli.ExitUsage)
+		}
+
+		subCommand := os.Args[2]
+		switch subCommand {
+		case "generate":
+			genCmd := flag.NewFlagSet("key generate", flag.ExitOnError)
+			keyType := genCmd.String("type", "ed25519", "Key type: ed25519, rsa or ecdsa")
+			bits := genCmd.Int("bits", 0, "Key size for rsa (default 4096) or ecdsa (default 256)")
+			comment := genCmd.String("comment", "", "Key comment")
+			out := genCmd.String("out", "", "Private key path (default ~/.ssh/hssh_<type>)")
+			force := genCmd.Bool("force", false, "Overwrite existing key files")
+			genCmd.Parse(os.Args[3:])
+
+			if err := c.KeyGenerateCommand(*keyType, *bits, *comment, *out, *force); err != nil {
+				fail(err)
+			}
+
+		case "deploy":
+			deployCmd := flag.NewFlagSet("key deploy", flag.ExitOnError)
+			server := deployCmd.String("server", "", "Server name")
+			keyPath := deployCmd.String("key", "", "Private key path (default ~/.ssh/hssh_ed25519)")
+			switchAuth := deployCmd.Bool("switch", false, "Switch the server to key auth after a successful key login")
+			deployCmd.Parse(os.Args[3:])
+
+			if *server == "" {
+				printError("CLI_KEY_SERVER_REQUIRED")
+				exit(cli.ExitUsage)
+			}
+			if err := c.KeyDeployCommand(*server, *keyPath, *switchAuth); err != nil {
+				fail(err)
+			}
+
+		case "rotate":
+			rotateCmd := flag.NewFlagSet("key rotate", flag.ExitOnError)
+			all := rotateCmd.Bool("all", false, "Rotate every configured server")
+			keyType := rotateCmd.String("type", "ed25519", "New key type: ed25519, rsa or ecdsa")
+			out := rotateCmd.String("out", "", "New private key path (default ~/.ssh/hssh_<type>_<time>)")
+			parallel := rotateCmd.Int("parallel", 8, "Servers rotated at once")
+			asJSON := rotateCmd.Bool("json", false, "Print results as JSON")
+			rotateCmd.Parse(os.Args[3:])
+
+			if !*all && rotateCmd.NArg() == 0 {
+				printError("CLI_CHECK_TARGET_REQUIRED")
+				exit(cli.ExitUsage)
+			}
+			if err := c.KeyRotateCommand(rotateCmd.Args(), *all, *keyType, *out, *parallel, *asJSON || batch.Quiet); err != nil {
+				fail(err)
+			}
+
+		default:
+			fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_UNKNOWN_SUBCOMMAND", "key", subCommand))
+			exit(cli.ExitUsage)
+		}
+
+	case "config":
+		if len(os.Args) < 3 {
+			printError("CLI_CONFIG_SUBCOMMAND")
+			exit(cli.ExitUsage)
+		}
+
+		subCommand := os.Args[2]
+		switch subCommand {
+		case "migrate-to-sqlite":
+			if err := c.ConfigMigrateToSQLiteCommand(); err != nil {
+				fail(err)
+			}
+
+		case "sync":
+			syncCmd := flag.NewFlagSet("config sync", flag.ExitOnError)
+			source := syncCmd.String("source", "", "Git repository or HTTPS URL (default: sync.source from config)")
+			syncCmd.Parse(os.Args[3:])
+
+			if err := c.ConfigSyncCommand(*source); err != nil {
+				fail(err)
+			}
+
+		case "refs":
+			if err := c.ConfigRefsCommand(false); err != nil {
+				fail(err)
+			}
+
+		case "fix-refs":
+			if err := c.ConfigRefsCommand(true); err != nil {
+				fail(err)
+			}
+
+		case "import-ssh":
+			importCmd := flag.NewFlagSet("config import-ssh", flag.ExitOnError)
+			file := importCmd.String("file", "", "OpenSSH config file (default ~/.ssh/config)")
+			hosts := importCmd.String("host", "", "Comma-separated aliases to import, with their gateways (default: all)")
+			dryRun := importCmd.Bool("dry-run", false, "Show what would be imported without saving")
+			asJSON := importCmd.Bool("json", false, "Print the result as JSON")
+			importCmd.Parse(os.Args[3:])
+
+			var names []string
+			for _, name := range strings.Split(*hosts, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+			if err := c.ConfigImportSSHCommand(*file, names, *dryRun, *asJSON || batch.Quiet); err != nil {
+				fail(err)
 			}
 
 		default:
-			fmt.Fprintf(os.Stderr, "Unknown server subcommand: %s\n", subCommand)
-			os.Exit(1)
+			fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_UNKNOWN_SUBCOMMAND", "config", subCommand))
+			exit(cli.ExitUsage)
+		}
+
+	case "backup":
+		if len(os.Args) < 3 {
+			printError("CLI_BACKUP_SUBCOMMAND")
+			exit(cli.ExitUsage)
+		}
+
+		subCommand := os.Args[2]
+		switch subCommand {
+		case "create":
+			createCmd := flag.NewFlagSet("backup create", flag.ExitOnError)
+			out := createCmd.String("out", "", "Backup file (.tar.gz)")
+			passphraseFile := createCmd.String("passphrase-file", "", "Encrypt with the passphrase in this file (default: GMSSH_BACKUP_PASSPHRASE)")
+			asJSON := createCmd.Bool("json", false, "Print the manifest as JSON")
+			createCmd.Parse(os.Args[3:])
+
+			if *out == "" {
+				printError("CLI_BACKUP_FILE_REQUIRED", "--out")
+				exit(cli.ExitUsage)
+			}
+			if err := c.BackupCreateCommand(*out, *passphraseFile, *asJSON || batch.Quiet); err != nil {
+				fail(err)
+			}
+
+		case "restore":
+			restoreCmd := flag.NewFlagSet("backup restore", flag.ExitOnError)
+			in := restoreCmd.String("in", "", "Backup file")
+			passphraseFile := restoreCmd.String("passphrase-file", "", "Passphrase of an encrypted backup (default: GMSSH_BACKUP_PASSPHRASE)")
+			force := restoreCmd.Bool("force", false, "Replace an existing configuration (previous files are kept as .bak)")
+			dryRun := restoreCmd.Bool("dry-run", false, "Only verify the backup")
+			asJSON := restoreCmd.Bool("json", false, "Print the result as JSON")
+			restoreCmd.Parse(os.Args[3:])
+
+			if *in == "" {
+				printError("CLI_BACKUP_FILE_REQUIRED", "--in")
+				exit(cli.ExitUsage)
+			}
+			if err := c.BackupRestoreCommand(*in, *passphraseFile, *force, *dryRun, *asJSON || batch.Quiet); err != nil {
+				fail(err)
+			}
+
+		default:
+			fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_UNKNOWN_SUBCOMMAND", "backup", subCommand))
+			exit(cli.ExitUsage)
 		}
 
 	case "web":
 		webCmd := flag.NewFlagSet("web", flag.ExitOnError)
 		local := webCmd.Bool("local", false, "Run in local mode (localhost only)")
 		bind := webCmd.String("bind", "0.0.0.0:18081", "Bind address")
+		statusOnly := webCmd.Bool("status-only", false, "Serve a read-only status page (health, latency, tunnels) without auth")
+		noBrowser := webCmd.Bool("no-browser", false, "Do not open a browser in local mode (headless)")
+		idleExit := webCmd.Int("idle-exit", 0, "Exit after this many minutes with no sessions, transfers, forwarders or requests (0 = never)")
 		webCmd.Parse(os.Args[2:])
 
+		// --bind > GMSSH_WEB_BIND > web.bind > 默认值
 		addr := *bind
+		if !flagPassed(webCmd, "bind") {
+			if setting := config.Effective(c.Config()).WebBind; setting != "" {
+				addr = setting
+			}
+		}
 		if *local {
 			addr = "127.0.0.1:8080"
 		}
 
 		server, err := api.NewServer()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			fail(err)
+		}
+		if *idleExit > 0 {
+			server.SetIdleExit(time.Duration(*idleExit) * time.Minute)
+		}
+
+		// SIGTERM（docker stop、Kubernetes 删除 Pod）和 Ctrl-C 触发优雅关闭
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// 本地模式下开始监听后打开浏览器；容器、CI 和 --no-browser 时不打开
+		if *local && !*noBrowser && !batch.Batch {
+			server.OnReady(func() {
+				if err := cli.OpenBrowser("http://" + addr); err != nil {
+					fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_BROWSER_FAILED", err))
+				}
+			})
 		}
 
-		fmt.Printf("Starting web UI at http://%s\n", addr)
-		if err := server.Start(addr); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		if *statusOnly {
+			fmt.Println(i18n.Sprintf("CLI_STATUS_STARTING", addr))
+			err = server.StartStatusOnly(ctx, addr)
+		} else {
+			fmt.Println(i18n.Sprintf("CLI_WEB_STARTING", addr))
+			err = server.Start(ctx, addr)
+		}
+		if err != nil {
+			fail(err)
 		}
 
 	case "portal":
-		portalCmd := &cli.PortalCommand{}
+		portalCmd := &cli.PortalCommand{Batch: batch.Batch || batch.Quiet}
 		f := flag.NewFlagSet("portal", flag.ExitOnError)
 		portalCmd.SetFlags(f)
 		f.Parse(os.Args[2:])
 
 		exitCode := portalCmd.Run(f.Args())
-		os.Exit(exitCode)
+		exit(exitCode)
+
+	case "agent":
+		agentCmd := &cli.AgentCommand{}
+		f := flag.NewFlagSet("agent", flag.ExitOnError)
+		agentCmd.SetFlags(f)
+		f.Parse(os.Args[2:])
+
+		exitCode := agentCmd.Run(f.Args())
+		exit(exitCode)
 
 	case "help", "--help", "-h":
 		printUsage()
 
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
+		fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_UNKNOWN_COMMAND", command))
 		printUsage()
-		os.Exit(1)
+		exit(cli.ExitUsage)
 	}
 }
 
 func printUsage() {
-	fmt.Println("HSSH - High-performance SSH bastion tool")
-	fmt.Println()
-	fmt.Println("Usage:")
-	fmt.Println("  hssh <command> [options]")
-	fmt.Println()
-	fmt.Println("Commands:")
-	fmt.Println("  upload    Upload file to remote server")
-	fmt.Println("            --source <path>       Source file path")
-	fmt.Println("            --target <host:path>  Target host and path")
-	fmt.Println("            --via <hops>          Comma-separated intermediate hops (optional)")
-	fmt.Println()
-	fmt.Println("  proxy     Create port forward to internal server")
-	fmt.Println("            --local <addr>        Local listen address (default :0)")
-	fmt.Println("            --remote-host <host>  Remote target host")
-	fmt.Println("            --remote-port <port>  Remote target port")
-	fmt.Println("            --via <hops>          Comma-separated intermediate hops")
-	fmt.Println()
-	fmt.Println("  probe     Probe network latency")
-	fmt.Println("            --target <host>       Target host to probe")
-	fmt.Println("            --via <hops>          Compare with alternative path")
-	fmt.Println()
-	fmt.Println("  status    Show configuration status")
-	fmt.Println()
-	fmt.Println("  server    Manage server configurations")
-	fmt.Println("    list                        List all servers")
-	fmt.Println("    add                         Add a server")
-	fmt.Println("      --name <name>             Server name")
-	fmt.Println("      --host <host>             Server host")
-	fmt.Println("      --port <port>             Server port (default 22)")
-	fmt.Println("      --user <user>             Username")
-	fmt.Println("      --auth <type>             Auth type: key or password")
-	fmt.Println("      --key-path <path>         SSH key path (for key auth)")
-	fmt.Println("      --password <pass>         Password (for password auth)")
-	fmt.Println("    delete <name>               Delete a server")
-	fmt.Println()
-	fmt.Println("  web       Start web UI")
-	fmt.Println("            --local               Run in local mode")
-	fmt.Println("            --bind <addr>         Bind address (default 0.0.0.0:8080)")
-	fmt.Println()
-	fmt.Println("  portal    High-performance port forwarding/tunneling")
-	fmt.Println("            --server              Run in server mode")
-	fmt.Println("            --client              Run in client mode")
-	fmt.Println("            --listen <addr>       Server listen address (default :18888)")
-	fmt.Println("            --token <token>       Auth token")
-	fmt.Println("            --local <addr>        Local listen address (client)")
-	fmt.Println("            --remote <host:port>  Remote target (client)")
-	fmt.Println("            --server-addr <addr>  Portal server address (client)")
-	fmt.Println()
-	fmt.Println("Examples:")
-	fmt.Println("  # Upload file directly")
-	fmt.Println("  hssh upload --source ./file.txt --target gateway:/data/")
-	fmt.Println()
-	fmt.Println("  # Upload via bastion")
-	fmt.Println("  hssh upload --source ./file.txt --target internal:/data/ --via bastion-hk,gateway")
-	fmt.Println()
-	fmt.Println("  # Port forward to internal database")
-	fmt.Println("  hssh proxy --local :3306 --remote-host internal-db --remote-port 3306 --via gateway")
-	fmt.Println()
-	fmt.Println("  # Add a server")
-	fmt.Println("  hssh server add --name gateway --host gw.example.com --user admin --auth key --key-path ~/.ssh/id_rsa")
-	fmt.Println()
-	fmt.Println("  # Start portal server")
-	fmt.Println("  hssh portal --server --listen :18888 --token my-token")
-	fmt.Println()
-	fmt.Println("  # Start portal client")
-	fmt.Println("  hssh portal --client --local :8080 --remote 192.168.1.10:80 --server-addr portal.example.com:18888")
+	fmt.Println(i18n.Sprintf("CLI_USAGE"))
+}
+
+// printError 以当前语言输出 "Error: <消息>"
+func printError(code string, args ...interface{}) {
+	fmt.Fprintln(os.Stderr, i18n.Sprintf("CLI_ERROR", i18n.Sprintf(code, args...)))
+}
+
+// parseLangFlag 取出全局 --lang 参数并设置输出语言，未指定或无法识别时按环境变量检测
+func parseLangFlag(args []string) []string {
+	lang := i18n.Detect()
+	rest := []string{args[0]}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--lang" || arg == "-lang":
+			if i+1 < len(args) {
+				i++
+				if parsed := i18n.Parse(args[i]); parsed != "" {
+					lang = parsed
+				}
+			}
+		case strings.HasPrefix(arg, "--lang=") || strings.HasPrefix(arg, "-lang="):
+			_, value, _ := strings.Cut(arg, "=")
+			if parsed := i18n.Parse(value); parsed != "" {
+				lang = parsed
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	i18n.SetDefault(lang)
+	return rest
+}
+
+// parseBatchFlags 取出全局的 --timeout、--batch 和 --quiet 参数，可以出现在命令前后
+func parseBatchFlags(args []string) ([]string, cli.BatchOptions, error) {
+	var opts cli.BatchOptions
+	rest := []string{args[0]}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") {
+			rest = append(rest, arg)
+			continue
+		}
+		switch name {
+		case "timeout":
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, opts, fmt.Errorf("--timeout needs a duration")
+				}
+				i++
+				value = args[i]
+			}
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return nil, opts, fmt.Errorf("invalid --timeout %q", value)
+			}
+			opts.Timeout = timeout
+		case "batch", "quiet":
+			on := true
+			if hasValue {
+				parsed, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, opts, fmt.Errorf("invalid --%s %q", name, value)
+				}
+				on = parsed
+			}
+			if name == "batch" {
+				opts.Batch = on
+			} else {
+				opts.Quiet = on
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, opts, nil
+}
+
+// parseConfigFlags 取出覆盖配置的全局参数 --config-dir、--log-level、--temp-dir 和 --netem，可以出现在命令前后
+func parseConfigFlags(args []string) ([]string, config.Overrides, error) {
+	var o config.Overrides
+	targets := map[string]*string{"config-dir": &o.ConfigDir, "log-level": &o.LogLevel, "temp-dir": &o.TempDir, "netem": &o.Netem}
+	rest := []string{args[0]}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		target, ok := targets[name]
+		if !strings.HasPrefix(arg, "-") || !ok {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, o, fmt.Errorf("--%s needs a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		*target = value
+	}
+	return rest, o, nil
+}
+
+// flagPassed 命令行中是否显式给出了参数 name
+func flagPassed(f *flag.FlagSet, name string) bool {
+	passed := false
+	f.Visit(func(fl *flag.Flag) {
+		if fl.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
+
+// multiFlag 可重复的字符串参数，如多次出现的 --via
+type multiFlag []string
+
+func (f *multiFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *multiFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
 }
@@ -0,0 +1,398 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/portal/protocol"
+	"github.com/luobobo896/HSSH/internal/transfer"
+	"github.com/xtaci/smux"
+)
+
+const (
+	// DefaultMetricsInterval 默认指标上报间隔
+	DefaultMetricsInterval = 15 * time.Second
+	// DefaultRetryInterval 默认重连间隔
+	DefaultRetryInterval = 5 * time.Second
+
+	handshakeTimeout = 10 * time.Second
+	dialTimeout      = 10 * time.Second
+)
+
+// Config agent 配置
+type Config struct {
+	Name      string
+	HubAddr   string
+	Token     string
+	TLSConfig *tls.Config
+
+	// FetchDir fetch 任务的落盘根目录，为空时不接受 fetch 任务
+	FetchDir string
+	// AllowedRemotes dial 任务允许的目标网段（CIDR），为空不限制
+	AllowedRemotes []string
+
+	MetricsInterval time.Duration
+	RetryInterval   time.Duration
+}
+
+// Agent 运行在网关上的 agent
+type Agent struct {
+	config    Config
+	hostname  string
+	startedAt time.Time
+	client    *http.Client
+
+	activeTasks  atomic.Int64
+	totalTasks   atomic.Int64
+	failedTasks  atomic.Int64
+	bytesRelayed atomic.Int64
+	bytesFetched atomic.Int64
+}
+
+// New 创建 agent
+func New(config Config) (*Agent, error) {
+	if config.HubAddr == "" {
+		return nil, fmt.Errorf("hub address is required")
+	}
+	if config.Token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+	if config.TLSConfig == nil {
+		return nil, fmt.Errorf("TLS config is required")
+	}
+
+	hostname, _ := os.Hostname()
+	if config.Name == "" {
+		config.Name = hostname
+	}
+	if config.MetricsInterval <= 0 {
+		config.MetricsInterval = DefaultMetricsInterval
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = DefaultRetryInterval
+	}
+	if config.FetchDir != "" {
+		if err := os.MkdirAll(config.FetchDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create fetch dir: %w", err)
+		}
+	}
+
+	return &Agent{
+		config:    config,
+		hostname:  hostname,
+		startedAt: time.Now(),
+		client:    &http.Client{},
+	}, nil
+}
+
+// Run 连接控制面并处理任务，断线后自动重连，直到 ctx 取消
+func (a *Agent) Run(ctx context.Context) error {
+	for {
+		err := a.runOnce(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("[Agent] Disconnected from hub %s: %v, retrying in %v", a.config.HubAddr, err, a.config.RetryInterval)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(a.config.RetryInterval):
+		}
+	}
+}
+
+// runOnce 建立一次连接并服务到断开
+func (a *Agent) runOnce(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", a.config.HubAddr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to hub: %w", err)
+	}
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	mux, err := protocol.NewClientMux(conn, a.config.TLSConfig, nil)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to create mux: %w", err)
+	}
+	defer mux.Close()
+
+	ctrl, err := mux.OpenStream()
+	if err != nil {
+		return fmt.Errorf("failed to open control stream: %w", err)
+	}
+
+	hello := Hello{
+		Token:        a.config.Token,
+		Name:         a.config.Name,
+		Hostname:     a.hostname,
+		Version:      ProtocolVersion,
+		Capabilities: a.capabilities(),
+	}
+	if err := protocol.WriteMessage(ctrl, hello); err != nil {
+		return fmt.Errorf("failed to send hello: %w", err)
+	}
+	var ack HelloAck
+	if err := protocol.ReadMessage(ctrl, &ack); err != nil {
+		return fmt.Errorf("failed to read hello ack: %w", err)
+	}
+	if !ack.OK {
+		return fmt.Errorf("registration rejected: %s", ack.Error)
+	}
+	conn.SetDeadline(time.Time{})
+
+	log.Printf("[Agent] Registered with hub %s as %q", a.config.HubAddr, a.config.Name)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			mux.Close()
+		case <-done:
+		}
+	}()
+	go a.reportLoop(ctrl, mux, done)
+
+	for {
+		stream, err := mux.AcceptStream()
+		if err != nil {
+			return err
+		}
+		go a.handleStream(ctx, stream)
+	}
+}
+
+// capabilities 当前 agent 支持的任务类型
+func (a *Agent) capabilities() []Op {
+	ops := []Op{OpDial}
+	if a.config.FetchDir != "" {
+		ops = append(ops, OpFetch)
+	}
+	return ops
+}
+
+// reportLoop 定期在控制流上上报指标，写失败时断开连接触发重连
+func (a *Agent) reportLoop(ctrl *smux.Stream, mux *protocol.ClientMux, done <-chan struct{}) {
+	ticker := time.NewTicker(a.config.MetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := protocol.WriteMessage(ctrl, a.Metrics()); err != nil {
+			log.Printf("[Agent] Failed to report metrics: %v", err)
+			mux.Close()
+			return
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Metrics 当前指标快照
+func (a *Agent) Metrics() Metrics {
+	return Metrics{
+		UptimeSeconds: int64(time.Since(a.startedAt).Seconds()),
+		ActiveTasks:   a.activeTasks.Load(),
+		TotalTasks:    a.totalTasks.Load(),
+		FailedTasks:   a.failedTasks.Load(),
+		BytesRelayed:  a.bytesRelayed.Load(),
+		BytesFetched:  a.bytesFetched.Load(),
+		Goroutines:    runtime.NumGoroutine(),
+		ReportedAt:    time.Now(),
+	}
+}
+
+// handleStream 处理控制面下发的单个任务
+func (a *Agent) handleStream(ctx context.Context, stream *smux.Stream) {
+	defer stream.Close()
+
+	a.activeTasks.Add(1)
+	a.totalTasks.Add(1)
+	defer a.activeTasks.Add(-1)
+
+	stream.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	var task Task
+	if err := protocol.ReadMessage(stream, &task); err != nil {
+		a.failedTasks.Add(1)
+		log.Printf("[Agent] Failed to read task: %v", err)
+		return
+	}
+	stream.SetReadDeadline(time.Time{})
+
+	var err error
+	switch task.Op {
+	case OpDial:
+		err = a.handleDial(stream, task)
+	case OpFetch:
+		err = a.handleFetch(ctx, stream, task)
+	default:
+		err = fmt.Errorf("unsupported op: %s", task.Op)
+		protocol.WriteMessage(stream, TaskResult{Error: err.Error()})
+	}
+	if err != nil {
+		a.failedTasks.Add(1)
+		log.Printf("[Agent] Task %s failed: %v", task.Op, err)
+	}
+}
+
+// handleDial 在内网侧建立连接并与流双向转发
+func (a *Agent) handleDial(stream *smux.Stream, task Task) error {
+	if !remoteAllowed(a.config.AllowedRemotes, task.Host) {
+		err := fmt.Errorf("remote %s not allowed", task.Host)
+		protocol.WriteMessage(stream, TaskResult{Error: err.Error()})
+		return err
+	}
+
+	addr := net.JoinHostPort(task.Host, strconv.Itoa(task.Port))
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		err = fmt.Errorf("failed to connect to %s: %w", addr, err)
+		protocol.WriteMessage(stream, TaskResult{Error: err.Error()})
+		return err
+	}
+	defer conn.Close()
+
+	if err := protocol.WriteMessage(stream, TaskResult{OK: true}); err != nil {
+		return err
+	}
+
+	a.bytesRelayed.Add(pipe(stream, conn))
+	return nil
+}
+
+// handleFetch 从内网 URL 下载文件到 fetch 目录
+func (a *Agent) handleFetch(ctx context.Context, stream *smux.Stream, task Task) error {
+	start := time.Now()
+	path, size, err := a.fetch(ctx, task.URL, task.Dest)
+	if err != nil {
+		protocol.WriteMessage(stream, TaskResult{Error: err.Error()})
+		return err
+	}
+
+	a.bytesFetched.Add(size)
+	log.Printf("[Agent] Fetched %s -> %s (%d bytes)", task.URL, path, size)
+	return protocol.WriteMessage(stream, TaskResult{
+		OK:         true,
+		Path:       path,
+		Bytes:      size,
+		DurationMs: time.Since(start).Milliseconds(),
+	})
+}
+
+// fetch 下载到临时文件，完成后再重命名，避免留下半截文件
+func (a *Agent) fetch(ctx context.Context, url, dest string) (string, int64, error) {
+	if a.config.FetchDir == "" {
+		return "", 0, fmt.Errorf("fetch is disabled on this agent")
+	}
+	path, err := transfer.SafeJoin(a.config.FetchDir, dest)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create dir: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid url: %w", err)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".fetch-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to save %s: %w", dest, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, fmt.Errorf("failed to save %s: %w", dest, err)
+	}
+	return path, size, nil
+}
+
+// remoteAllowed 检查目标是否在允许的网段内，主机名需解析后全部命中
+func remoteAllowed(cidrs []string, host string) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		resolved, err := net.LookupIP(host)
+		if err != nil || len(resolved) == 0 {
+			return false
+		}
+		ips = resolved
+	}
+
+	for _, ip := range ips {
+		if !ipInCIDRs(ip, cidrs) {
+			return false
+		}
+	}
+	return true
+}
+
+func ipInCIDRs(ip net.IP, cidrs []string) bool {
+	for _, cidr := range cidrs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// pipe 双向转发，任一方向结束后关闭两端，返回转发的总字节数
+func pipe(a, b io.ReadWriteCloser) int64 {
+	var total atomic.Int64
+	done := make(chan struct{}, 2)
+
+	copyHalf := func(dst io.WriteCloser, src io.Reader) {
+		n, _ := io.Copy(dst, src)
+		total.Add(n)
+		done <- struct{}{}
+	}
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+
+	<-done
+	a.Close()
+	b.Close()
+	<-done
+	return total.Load()
+}
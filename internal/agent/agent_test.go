@@ -0,0 +1,244 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/portal/protocol"
+)
+
+// startTestHub 启动监听随机端口的控制面
+func startTestHub(t *testing.T) (*Hub, string) {
+	t.Helper()
+
+	serverTLS, err := protocol.GenerateSelfSignedTLS()
+	if err != nil {
+		t.Fatalf("failed to generate TLS: %v", err)
+	}
+
+	hub := NewHub([]string{"secret"}, serverTLS)
+	if err := hub.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go hub.Serve()
+	t.Cleanup(func() { hub.Close() })
+
+	return hub, protocol.CertFingerprint(serverTLS)
+}
+
+// startTestAgent 启动连接到控制面的 agent
+func startTestAgent(t *testing.T, hub *Hub, fingerprint string, config Config) *Agent {
+	t.Helper()
+
+	config.HubAddr = hub.Addr().String()
+	config.TLSConfig = protocol.PinnedClientTLS(fingerprint)
+	if config.Name == "" {
+		config.Name = "gw-1"
+	}
+	if config.Token == "" {
+		config.Token = "secret"
+	}
+	config.MetricsInterval = 50 * time.Millisecond
+
+	a, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go a.Run(ctx)
+	t.Cleanup(cancel)
+	return a
+}
+
+// waitForAgent 等待 agent 注册完成并上报过指标
+func waitForAgent(t *testing.T, hub *Hub, name string) AgentInfo {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if info, ok := hub.Get(name); ok && info.Metrics != nil {
+			return info
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("agent %s did not register", name)
+	return AgentInfo{}
+}
+
+func TestAgentRegisterAndMetrics(t *testing.T) {
+	hub, fingerprint := startTestHub(t)
+	startTestAgent(t, hub, fingerprint, Config{})
+
+	info := waitForAgent(t, hub, "gw-1")
+	if info.Version != ProtocolVersion {
+		t.Errorf("expected version %d, got %d", ProtocolVersion, info.Version)
+	}
+	if len(info.Capabilities) != 1 || info.Capabilities[0] != OpDial {
+		t.Errorf("expected only dial capability without fetch dir, got %v", info.Capabilities)
+	}
+	if list := hub.List(); len(list) != 1 || list[0].Name != "gw-1" {
+		t.Errorf("unexpected agent list: %+v", list)
+	}
+}
+
+func TestAgentRejectsBadToken(t *testing.T) {
+	hub, fingerprint := startTestHub(t)
+	startTestAgent(t, hub, fingerprint, Config{Token: "wrong"})
+
+	time.Sleep(200 * time.Millisecond)
+	if list := hub.List(); len(list) != 0 {
+		t.Fatalf("agent with bad token should not register, got %+v", list)
+	}
+}
+
+func TestAgentRejectsWrongFingerprint(t *testing.T) {
+	hub, _ := startTestHub(t)
+	startTestAgent(t, hub, fmt.Sprintf("%064d", 0), Config{})
+
+	time.Sleep(200 * time.Millisecond)
+	if list := hub.List(); len(list) != 0 {
+		t.Fatalf("agent should refuse hub with mismatched fingerprint, got %+v", list)
+	}
+}
+
+func TestHubDialAndForward(t *testing.T) {
+	// 内网侧的 echo 服务
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	echoPort := echo.Addr().(*net.TCPAddr).Port
+
+	hub, fingerprint := startTestHub(t)
+	startTestAgent(t, hub, fingerprint, Config{})
+	waitForAgent(t, hub, "gw-1")
+
+	fwd, err := hub.StartForward("gw-1", "127.0.0.1:0", "127.0.0.1", echoPort)
+	if err != nil {
+		t.Fatalf("StartForward failed: %v", err)
+	}
+	defer hub.StopForward(fwd.ID)
+
+	conn, err := net.Dial("tcp", fwd.LocalAddr)
+	if err != nil {
+		t.Fatalf("failed to dial forward: %v", err)
+	}
+	defer conn.Close()
+
+	msg := []byte("hello through agent")
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	buf := make([]byte, len(msg))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(buf) != string(msg) {
+		t.Errorf("expected %q, got %q", msg, buf)
+	}
+}
+
+func TestHubDialNotAllowed(t *testing.T) {
+	hub, fingerprint := startTestHub(t)
+	startTestAgent(t, hub, fingerprint, Config{AllowedRemotes: []string{"10.0.0.0/8"}})
+	waitForAgent(t, hub, "gw-1")
+
+	if _, err := hub.Dial("gw-1", "127.0.0.1", 22); err == nil {
+		t.Fatal("expected dial outside allowed remotes to fail")
+	}
+	if _, err := hub.Dial("missing", "10.0.0.1", 22); err == nil {
+		t.Fatal("expected dial via unknown agent to fail")
+	}
+}
+
+func TestHubFetch(t *testing.T) {
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pkg.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("package-bytes"))
+	}))
+	defer files.Close()
+
+	fetchDir := t.TempDir()
+	hub, fingerprint := startTestHub(t)
+	startTestAgent(t, hub, fingerprint, Config{FetchDir: fetchDir})
+	waitForAgent(t, hub, "gw-1")
+
+	tests := []struct {
+		name    string
+		url     string
+		dest    string
+		wantErr bool
+	}{
+		{"ok", files.URL + "/pkg.tar.gz", "releases/pkg.tar.gz", false},
+		{"not found", files.URL + "/missing", "missing", true},
+		{"path traversal", files.URL + "/pkg.tar.gz", "../escape", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := hub.Fetch(context.Background(), "gw-1", tt.url, tt.dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if result.Bytes != int64(len("package-bytes")) {
+				t.Errorf("expected %d bytes, got %d", len("package-bytes"), result.Bytes)
+			}
+			data, err := os.ReadFile(filepath.Join(fetchDir, tt.dest))
+			if err != nil || string(data) != "package-bytes" {
+				t.Errorf("fetched file mismatch: %q, %v", data, err)
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(fetchDir), "escape")); err == nil {
+		t.Error("path traversal wrote outside fetch dir")
+	}
+}
+
+func TestRemoteAllowed(t *testing.T) {
+	tests := []struct {
+		cidrs []string
+		host  string
+		want  bool
+	}{
+		{nil, "1.2.3.4", true},
+		{[]string{"10.0.0.0/8"}, "10.1.2.3", true},
+		{[]string{"10.0.0.0/8"}, "192.168.1.1", false},
+		{[]string{"10.0.0.0/8", "192.168.0.0/16"}, "192.168.1.1", true},
+	}
+
+	for _, tt := range tests {
+		if got := remoteAllowed(tt.cidrs, tt.host); got != tt.want {
+			t.Errorf("remoteAllowed(%v, %s) = %v, want %v", tt.cidrs, tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Forward 经由 agent 的端口转发：控制面本地监听，连接由 agent 在内网侧建立
+type Forward struct {
+	id         string
+	agent      string
+	localAddr  string
+	remoteHost string
+	remotePort int
+	createdAt  time.Time
+
+	hub      *Hub
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	activeConns atomic.Int32
+	totalConns  atomic.Int64
+	bytes       atomic.Int64
+}
+
+// ForwardInfo 转发信息
+type ForwardInfo struct {
+	ID          string    `json:"id"`
+	Agent       string    `json:"agent"`
+	LocalAddr   string    `json:"local_addr"`
+	RemoteHost  string    `json:"remote_host"`
+	RemotePort  int       `json:"remote_port"`
+	CreatedAt   time.Time `json:"created_at"`
+	ActiveConns int32     `json:"active_conns"`
+	TotalConns  int64     `json:"total_conns"`
+	Bytes       int64     `json:"bytes"`
+}
+
+// StartForward 在控制面本地监听，并将连接经 agent 转发到内网目标
+func (h *Hub) StartForward(agentName, localAddr, remoteHost string, remotePort int) (*ForwardInfo, error) {
+	if _, ok := h.Get(agentName); !ok {
+		return nil, fmt.Errorf("agent %s %w", agentName, ErrNotConnected)
+	}
+
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", localAddr, err)
+	}
+
+	f := &Forward{
+		id:         uuid.New().String(),
+		agent:      agentName,
+		localAddr:  listener.Addr().String(),
+		remoteHost: remoteHost,
+		remotePort: remotePort,
+		createdAt:  time.Now(),
+		hub:        h,
+		listener:   listener,
+	}
+
+	h.forwardsMu.Lock()
+	h.forwards[f.id] = f
+	h.forwardsMu.Unlock()
+
+	f.wg.Add(1)
+	go f.acceptLoop()
+
+	log.Printf("[Agent Hub] Forward %s: %s -> %s -> %s:%d", f.id, f.localAddr, agentName, remoteHost, remotePort)
+	info := f.info()
+	return &info, nil
+}
+
+// StopForward 停止转发
+func (h *Hub) StopForward(id string) error {
+	h.forwardsMu.Lock()
+	f, ok := h.forwards[id]
+	delete(h.forwards, id)
+	h.forwardsMu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("forward %s %w", id, ErrForwardNotFound)
+	}
+	f.stop()
+	return nil
+}
+
+// Forwards 列出经由 agent 的转发
+func (h *Hub) Forwards() []ForwardInfo {
+	h.forwardsMu.RLock()
+	result := make([]ForwardInfo, 0, len(h.forwards))
+	for _, f := range h.forwards {
+		result = append(result, f.info())
+	}
+	h.forwardsMu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+func (f *Forward) info() ForwardInfo {
+	return ForwardInfo{
+		ID:          f.id,
+		Agent:       f.agent,
+		LocalAddr:   f.localAddr,
+		RemoteHost:  f.remoteHost,
+		RemotePort:  f.remotePort,
+		CreatedAt:   f.createdAt,
+		ActiveConns: f.activeConns.Load(),
+		TotalConns:  f.totalConns.Load(),
+		Bytes:       f.bytes.Load(),
+	}
+}
+
+func (f *Forward) acceptLoop() {
+	defer f.wg.Done()
+
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		f.activeConns.Add(1)
+		f.totalConns.Add(1)
+		go func() {
+			defer f.activeConns.Add(-1)
+			f.handleConn(conn)
+		}()
+	}
+}
+
+func (f *Forward) handleConn(local net.Conn) {
+	remote, err := f.hub.Dial(f.agent, f.remoteHost, f.remotePort)
+	if err != nil {
+		log.Printf("[Agent Hub] Forward %s: %v", f.id, err)
+		local.Close()
+		return
+	}
+	f.bytes.Add(pipe(local, remote))
+}
+
+// stop 关闭监听，已建立的连接自然结束
+func (f *Forward) stop() {
+	f.listener.Close()
+	f.wg.Wait()
+	log.Printf("[Agent Hub] Forward %s stopped", f.id)
+}
@@ -0,0 +1,366 @@
+package agent
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/portal/protocol"
+	"github.com/xtaci/smux"
+)
+
+// 控制面操作的错误，调用方用 errors.Is 判断
+var (
+	ErrNotConnected    = errors.New("not connected")
+	ErrForwardNotFound = errors.New("not found")
+)
+
+// AgentInfo 已注册 agent 的信息
+type AgentInfo struct {
+	Name         string    `json:"name"`
+	Hostname     string    `json:"hostname"`
+	Version      int       `json:"version"`
+	Capabilities []Op      `json:"capabilities"`
+	RemoteAddr   string    `json:"remote_addr"`
+	ConnectedAt  time.Time `json:"connected_at"`
+	LastSeen     time.Time `json:"last_seen"`
+	Metrics      *Metrics  `json:"metrics,omitempty"`
+}
+
+// agentConn 单个 agent 的连接
+type agentConn struct {
+	info AgentInfo
+	mux  *protocol.ServerMux
+	mu   sync.RWMutex
+}
+
+// snapshot 返回信息副本
+func (c *agentConn) snapshot() AgentInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	info := c.info
+	if c.info.Metrics != nil {
+		m := *c.info.Metrics
+		info.Metrics = &m
+	}
+	return info
+}
+
+// Hub 控制面：接受 agent 注册，向 agent 下发任务
+type Hub struct {
+	tokens    []string
+	tlsConfig *tls.Config
+	listener  net.Listener
+
+	agents map[string]*agentConn // name -> conn
+	mu     sync.RWMutex
+
+	forwards   map[string]*Forward // id -> forward
+	forwardsMu sync.RWMutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewHub 创建控制面
+func NewHub(tokens []string, tlsConfig *tls.Config) *Hub {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Hub{
+		tokens:    tokens,
+		tlsConfig: tlsConfig,
+		agents:    make(map[string]*agentConn),
+		forwards:  make(map[string]*Forward),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Listen 开始监听 agent 接入
+func (h *Hub) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	h.listener = listener
+	log.Printf("[Agent Hub] Listening on %s", listener.Addr())
+	return nil
+}
+
+// Addr 返回监听地址
+func (h *Hub) Addr() net.Addr {
+	if h.listener == nil {
+		return nil
+	}
+	return h.listener.Addr()
+}
+
+// Serve 接受 agent 连接
+func (h *Hub) Serve() error {
+	if h.listener == nil {
+		return fmt.Errorf("hub not listening")
+	}
+
+	for {
+		conn, err := h.listener.Accept()
+		if err != nil {
+			select {
+			case <-h.ctx.Done():
+				return nil
+			default:
+				log.Printf("[Agent Hub] Accept error: %v", err)
+				continue
+			}
+		}
+
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			h.handleConnection(conn)
+		}()
+	}
+}
+
+// validToken 校验 agent 令牌
+func (h *Hub) validToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, t := range h.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// handleConnection 完成注册握手，然后持续接收指标直到断开
+func (h *Hub) handleConnection(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	mux, err := protocol.NewServerMux(conn, h.tlsConfig, nil)
+	if err != nil {
+		log.Printf("[Agent Hub] Failed to create mux from %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	defer mux.Close()
+
+	ctrl, err := mux.AcceptStream()
+	if err != nil {
+		log.Printf("[Agent Hub] Failed to accept control stream from %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+
+	var hello Hello
+	if err := protocol.ReadMessage(ctrl, &hello); err != nil {
+		log.Printf("[Agent Hub] Failed to read hello from %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	if !h.validToken(hello.Token) {
+		log.Printf("[Agent Hub] Rejected agent %q from %s: invalid token", hello.Name, conn.RemoteAddr())
+		protocol.WriteMessage(ctrl, HelloAck{Error: "invalid token"})
+		return
+	}
+	if hello.Name == "" {
+		protocol.WriteMessage(ctrl, HelloAck{Error: "agent name is required"})
+		return
+	}
+	if err := protocol.WriteMessage(ctrl, HelloAck{OK: true}); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	now := time.Now()
+	ac := &agentConn{
+		info: AgentInfo{
+			Name:         hello.Name,
+			Hostname:     hello.Hostname,
+			Version:      hello.Version,
+			Capabilities: hello.Capabilities,
+			RemoteAddr:   conn.RemoteAddr().String(),
+			ConnectedAt:  now,
+			LastSeen:     now,
+		},
+		mux: mux,
+	}
+	h.register(ac)
+	defer h.unregister(ac)
+
+	log.Printf("[Agent Hub] Agent %q registered from %s", hello.Name, conn.RemoteAddr())
+
+	// 关闭 hub 时断开所有 agent
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-h.ctx.Done():
+			mux.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		var metrics Metrics
+		if err := protocol.ReadMessage(ctrl, &metrics); err != nil {
+			if !mux.IsClosed() {
+				log.Printf("[Agent Hub] Agent %q disconnected: %v", hello.Name, err)
+			}
+			return
+		}
+		ac.mu.Lock()
+		ac.info.LastSeen = time.Now()
+		ac.info.Metrics = &metrics
+		ac.mu.Unlock()
+	}
+}
+
+// register 登记 agent，同名的旧连接（通常是断线重连前的残留）会被替换
+func (h *Hub) register(ac *agentConn) {
+	h.mu.Lock()
+	old := h.agents[ac.info.Name]
+	h.agents[ac.info.Name] = ac
+	h.mu.Unlock()
+
+	if old != nil {
+		log.Printf("[Agent Hub] Replacing stale connection for agent %q", ac.info.Name)
+		old.mux.Close()
+	}
+}
+
+// unregister 移除 agent（仅当仍是当前连接时）
+func (h *Hub) unregister(ac *agentConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.agents[ac.info.Name] == ac {
+		delete(h.agents, ac.info.Name)
+	}
+}
+
+// List 列出已注册的 agent
+func (h *Hub) List() []AgentInfo {
+	h.mu.RLock()
+	result := make([]AgentInfo, 0, len(h.agents))
+	for _, ac := range h.agents {
+		result = append(result, ac.snapshot())
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Get 获取指定 agent 信息
+func (h *Hub) Get(name string) (AgentInfo, bool) {
+	h.mu.RLock()
+	ac, ok := h.agents[name]
+	h.mu.RUnlock()
+	if !ok {
+		return AgentInfo{}, false
+	}
+	return ac.snapshot(), true
+}
+
+// openTask 向 agent 打开一条任务流并发送任务
+func (h *Hub) openTask(name string, task Task) (*smux.Stream, error) {
+	h.mu.RLock()
+	ac, ok := h.agents[name]
+	h.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("agent %s %w", name, ErrNotConnected)
+	}
+
+	stream, err := ac.mux.OpenStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream to agent %s: %w", name, err)
+	}
+	if err := protocol.WriteMessage(stream, task); err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("failed to send task to agent %s: %w", name, err)
+	}
+	return stream, nil
+}
+
+// Dial 通过 agent 在内网侧建立 TCP 连接，返回的连接即为 agent 上的隧道
+func (h *Hub) Dial(name, host string, port int) (net.Conn, error) {
+	stream, err := h.openTask(name, Task{Op: OpDial, Host: host, Port: port})
+	if err != nil {
+		return nil, err
+	}
+
+	stream.SetReadDeadline(time.Now().Add(dialTimeout + handshakeTimeout))
+	var result TaskResult
+	if err := protocol.ReadMessage(stream, &result); err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("failed to read dial result: %w", err)
+	}
+	stream.SetReadDeadline(time.Time{})
+
+	if !result.OK {
+		stream.Close()
+		return nil, fmt.Errorf("agent %s: %s", name, result.Error)
+	}
+	return stream, nil
+}
+
+// Fetch 让 agent 从内网 URL 下载文件到其 fetch 目录下的 dest
+func (h *Hub) Fetch(ctx context.Context, name, url, dest string) (*TaskResult, error) {
+	stream, err := h.openTask(name, Task{Op: OpFetch, URL: url, Dest: dest})
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	// ctx 取消时关闭流，agent 侧的下载会随之中止
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stream.Close()
+		case <-done:
+		}
+	}()
+
+	var result TaskResult
+	if err := protocol.ReadMessage(stream, &result); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to read fetch result: %w", err)
+	}
+	if !result.OK {
+		return &result, fmt.Errorf("agent %s: %s", name, result.Error)
+	}
+	return &result, nil
+}
+
+// Close 关闭控制面，断开所有 agent 和转发
+func (h *Hub) Close() error {
+	h.cancel()
+
+	if h.listener != nil {
+		h.listener.Close()
+	}
+
+	h.forwardsMu.Lock()
+	forwards := make([]*Forward, 0, len(h.forwards))
+	for _, f := range h.forwards {
+		forwards = append(forwards, f)
+	}
+	h.forwards = make(map[string]*Forward)
+	h.forwardsMu.Unlock()
+	for _, f := range forwards {
+		f.stop()
+	}
+
+	h.wg.Wait()
+	log.Printf("[Agent Hub] Stopped")
+	return nil
+}
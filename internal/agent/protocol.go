@@ -0,0 +1,67 @@
+// Package agent 实现 agent/relay 模式
+//
+// 网关上的 gmssh 以 agent 身份通过 portal 协议（TLS + smux）向控制面注册，
+// 控制面通过反向打开的流下发任务（在内网侧建立连接、从内网地址拉取文件），
+// agent 则在注册时建立的控制流上定期上报指标。
+// 这样内网可达的数据不必先回到控制面再经 SSH 链送回网关，避免双跳流量。
+package agent
+
+import "time"
+
+// ProtocolVersion agent 协议版本
+const ProtocolVersion = 1
+
+// Op 任务类型
+type Op string
+
+const (
+	// OpDial 在 agent 侧建立 TCP 连接，成功后流上为原始数据
+	OpDial Op = "dial"
+	// OpFetch agent 从内网 URL 下载文件到本地目录
+	OpFetch Op = "fetch"
+)
+
+// Hello agent 注册消息（控制流上的第一条消息）
+type Hello struct {
+	Token        string `json:"token"`
+	Name         string `json:"name"`
+	Hostname     string `json:"hostname"`
+	Version      int    `json:"version"`
+	Capabilities []Op   `json:"capabilities"`
+}
+
+// HelloAck 注册结果
+type HelloAck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Metrics agent 上报的指标
+type Metrics struct {
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	ActiveTasks   int64     `json:"active_tasks"`
+	TotalTasks    int64     `json:"total_tasks"`
+	FailedTasks   int64     `json:"failed_tasks"`
+	BytesRelayed  int64     `json:"bytes_relayed"`
+	BytesFetched  int64     `json:"bytes_fetched"`
+	Goroutines    int       `json:"goroutines"`
+	ReportedAt    time.Time `json:"reported_at"`
+}
+
+// Task 控制面下发的任务（每个任务一条流）
+type Task struct {
+	Op   Op     `json:"op"`
+	Host string `json:"host,omitempty"`
+	Port int    `json:"port,omitempty"`
+	URL  string `json:"url,omitempty"`
+	Dest string `json:"dest,omitempty"` // 相对于 agent fetch 目录的路径
+}
+
+// TaskResult 任务结果
+type TaskResult struct {
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Bytes      int64  `json:"bytes,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+}
@@ -0,0 +1,114 @@
+// Package alert 监控设置了延迟阈值的路由偏好：连续多次超过阈值时发出告警（日志和 webhook），
+// 可选地把经过该路由的运行中转发切换到更快的备选路径；并可定时检查所有服务器，记录状态变化，网关宕机时告警
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 告警事件类型
+const (
+	EventLatencyExceeded  = "latency_exceeded"
+	EventLatencyRecovered = "latency_recovered"
+)
+
+// Event 一次告警或恢复
+type Event struct {
+	Type        string    `json:"type"`
+	Route       string    `json:"route"`               // 显示名称，如 "bastion -> db via gateway"；网关事件为网关名称
+	ServerID    string    `json:"server_id,omitempty"` // 仅网关事件
+	FromID      string    `json:"from_id"`
+	ToID        string    `json:"to_id"`
+	ViaID       string    `json:"via_id,omitempty"`
+	Path        []string  `json:"path"` // 被监控路径的服务器名称
+	LatencyMs   int64     `json:"latency_ms"`
+	ThresholdMs int       `json:"threshold_ms"`
+	Consecutive int       `json:"consecutive"` // 连续超过阈值的探测次数
+	Error       string    `json:"error,omitempty"`
+	Time        time.Time `json:"time"`
+
+	// 备选路径的探测结果，仅 latency_exceeded 且路由有备选路径时存在
+	Alternative          []string `json:"alternative,omitempty"`
+	AlternativeLatencyMs int64    `json:"alternative_latency_ms,omitempty"`
+	// Switched 自动切换到备选路径的 Portal 映射 ID
+	Switched []string `json:"switched_mappings,omitempty"`
+}
+
+// String 返回用于日志的单行描述
+func (e *Event) String() string {
+	switch e.Type {
+	case EventGatewayDown, EventGatewayRecovered:
+		return gatewayEventString(e)
+	case EventLatencyRecovered:
+		return fmt.Sprintf("route %s recovered: %dms (threshold %dms)", e.Route, e.LatencyMs, e.ThresholdMs)
+	}
+	msg := fmt.Sprintf("route %s over threshold for %d probes: %dms > %dms", e.Route, e.Consecutive, e.LatencyMs, e.ThresholdMs)
+	if e.Error != "" {
+		msg = fmt.Sprintf("route %s unreachable for %d probes: %s", e.Route, e.Consecutive, e.Error)
+	}
+	if len(e.Switched) > 0 {
+		msg += fmt.Sprintf("; switched %d mappings to the alternative path (%dms)", len(e.Switched), e.AlternativeLatencyMs)
+	}
+	return msg
+}
+
+// Notifier 告警发送方式
+type Notifier interface {
+	Notify(ctx context.Context, event *Event) error
+}
+
+// logNotifier 只写日志
+type logNotifier struct{}
+
+func (logNotifier) Notify(_ context.Context, event *Event) error {
+	log.Printf("[Alert] %s", event)
+	return nil
+}
+
+// webhookTimeout 单次 webhook 请求超时
+const webhookTimeout = 10 * time.Second
+
+// webhookNotifier 写日志并把事件以 JSON POST 到 webhook
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, event *Event) error {
+	logNotifier{}.Notify(ctx, event)
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// NewNotifier 返回告警发送方式：配置了 webhook 时同时写日志和调用 webhook，否则只写日志
+func NewNotifier(webhook string) Notifier {
+	if webhook == "" {
+		return logNotifier{}
+	}
+	return &webhookNotifier{url: webhook, client: &http.Client{}}
+}
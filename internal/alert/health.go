@@ -0,0 +1,146 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/profiler"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// 网关状态事件类型
+const (
+	EventGatewayDown      = "gateway_down"
+	EventGatewayRecovered = "gateway_recovered"
+)
+
+// Checker 并发检查服务器的连通性和认证（profiler.NetworkProfiler 实现）
+type Checker interface {
+	CheckHops(ctx context.Context, targets []*types.Hop, chainOf func(*types.Hop) []*types.Hop, parallel int, timeout time.Duration) []profiler.CheckResult
+}
+
+// HealthMonitor 按 alerts.health_interval 定时检查所有服务器，记录状态变化，
+// 作为网关（被其他服务器的 gateway_id 或路由的 via 引用）的服务器状态变化时通过路由监控的 Notifier 告警
+type HealthMonitor struct {
+	config  *types.Config
+	checker Checker
+	alerts  *Monitor // 事件与路由告警共用一个列表和 Notifier
+	uptime  *UptimeTracker
+	// save 保存本轮检查结果到各服务器的 last_check，可为 nil
+	save func(map[string]types.HealthCheck) error
+}
+
+// NewHealthMonitor 创建定时检查，cfg 为运行中的配置（每轮检查时读取最新的服务器列表）
+func NewHealthMonitor(cfg *types.Config, checker Checker, alerts *Monitor, save func(map[string]types.HealthCheck) error) *HealthMonitor {
+	return &HealthMonitor{
+		config:  cfg,
+		checker: checker,
+		alerts:  alerts,
+		uptime:  NewUptimeTracker(),
+		save:    save,
+	}
+}
+
+// Uptime 返回状态记录
+func (h *HealthMonitor) Uptime() *UptimeTracker {
+	return h.uptime
+}
+
+// Run 按间隔持续检查，直到 ctx 取消；间隔不大于 0 时不运行
+func (h *HealthMonitor) Run(ctx context.Context) {
+	interval := h.config.Alerts.HealthInterval
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check 检查所有服务器一次
+func (h *HealthMonitor) Check(ctx context.Context) {
+	targets := append([]*types.Hop(nil), h.config.Hops...)
+	results := h.checker.CheckHops(ctx, targets, h.config.GatewayChain, 0, 0)
+	gateways := gatewayIDs(h.config)
+
+	checks := make(map[string]types.HealthCheck, len(results))
+	keep := make(map[string]bool, len(results))
+	for _, result := range results {
+		checks[result.ID] = result.HealthCheck
+		keep[result.ID] = true
+
+		seen := h.uptime.seen(result.ID)
+		change := h.uptime.Record(result.ID, result.HealthCheck)
+		if change == nil || !gateways[result.ID] {
+			continue
+		}
+		// 第一次检查就正常的网关不算恢复
+		if change.Status == StatusUp && !seen {
+			continue
+		}
+		h.alerts.emit(ctx, gatewayEvent(result, change))
+	}
+	h.uptime.Forget(keep)
+
+	if h.save != nil {
+		if err := h.save(checks); err != nil {
+			log.Printf("[Health] Failed to save check results: %v", err)
+		}
+	}
+}
+
+// gatewayEvent 根据网关的状态变化创建事件
+func gatewayEvent(result profiler.CheckResult, change *StatusChange) *Event {
+	event := &Event{
+		Type:      EventGatewayRecovered,
+		Route:     result.Name,
+		ServerID:  result.ID,
+		Path:      []string{result.Name},
+		LatencyMs: result.LatencyMs,
+		Time:      change.Time,
+	}
+	if change.Status == StatusDown {
+		event.Type = EventGatewayDown
+		event.Error = result.Error
+		if result.FailedHop != "" {
+			event.Path = []string{result.FailedHop}
+		}
+	}
+	return event
+}
+
+// gatewayIDs 返回作为网关的服务器：被其他服务器的 gateway_id 或路由偏好的 via 引用
+func gatewayIDs(cfg *types.Config) map[string]bool {
+	ids := make(map[string]bool)
+	for _, hop := range cfg.Hops {
+		if hop.GatewayID != "" {
+			ids[hop.GatewayID] = true
+		}
+	}
+	for _, route := range cfg.Routes {
+		if route.ViaID != "" {
+			ids[route.ViaID] = true
+		}
+	}
+	return ids
+}
+
+// gatewayEventString gateway_down/gateway_recovered 事件的单行描述
+func gatewayEventString(e *Event) string {
+	if e.Type == EventGatewayRecovered {
+		return fmt.Sprintf("gateway %s is back up (%dms)", e.Route, e.LatencyMs)
+	}
+	return fmt.Sprintf("gateway %s is down: %s", e.Route, e.Error)
+}
@@ -0,0 +1,137 @@
+package alert
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/profiler"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// fakeChecker 按服务器名称返回预设结果，未设置的服务器视为正常
+type fakeChecker struct {
+	now  time.Time
+	down map[string]string // 服务器名称 -> 错误
+}
+
+func (c *fakeChecker) CheckHops(_ context.Context, targets []*types.Hop, _ func(*types.Hop) []*types.Hop, _ int, _ time.Duration) []profiler.CheckResult {
+	results := make([]profiler.CheckResult, 0, len(targets))
+	for _, hop := range targets {
+		check := types.HealthCheck{CheckedAt: c.now, OK: true, LatencyMs: 10}
+		if msg, ok := c.down[hop.Name]; ok {
+			check = types.HealthCheck{CheckedAt: c.now, Stage: "connect", FailedHop: hop.Name, Error: msg}
+		}
+		results = append(results, profiler.CheckResult{ID: hop.ID, Name: hop.Name, HealthCheck: check})
+	}
+	return results
+}
+
+func TestUptimeTracker(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	tracker := NewUptimeTracker()
+	if report := tracker.Report("hop-1", start); report.Status != StatusUnknown || len(report.Changes) != 0 {
+		t.Fatalf("untracked report = %+v", report)
+	}
+
+	checks := []struct {
+		minute  int
+		ok      bool
+		changed bool
+	}{
+		{0, true, true}, // 第一次检查也是一次变化
+		{10, true, false},
+		{20, false, true},
+		{30, false, false},
+		{40, true, true},
+	}
+	for _, c := range checks {
+		check := types.HealthCheck{CheckedAt: at(c.minute), OK: c.ok}
+		if !c.ok {
+			check.Stage, check.Error = "connect", "refused"
+		}
+		if change := tracker.Record("hop-1", check); (change != nil) != c.changed {
+			t.Errorf("minute %d: change = %+v, want changed %v", c.minute, change, c.changed)
+		}
+	}
+
+	report := tracker.Report("hop-1", at(100))
+	if report.Status != StatusUp || !report.Since.Equal(at(40)) || !report.TrackedSince.Equal(start) {
+		t.Errorf("status = %s since %v tracked since %v", report.Status, report.Since, report.TrackedSince)
+	}
+	if report.Checks != 5 || report.Failures != 2 || !report.LastCheck.Equal(at(40)) {
+		t.Errorf("checks = %d, failures = %d, last check = %v", report.Checks, report.Failures, report.LastCheck)
+	}
+	// 100 分钟中 down 20 分钟
+	if report.UptimePercent != 80 {
+		t.Errorf("uptime = %v, want 80", report.UptimePercent)
+	}
+	var statuses []string
+	for _, change := range report.Changes {
+		statuses = append(statuses, change.Status)
+	}
+	if !reflect.DeepEqual(statuses, []string{StatusUp, StatusDown, StatusUp}) {
+		t.Errorf("changes = %v", statuses)
+	}
+	if report.Changes[1].Stage != "connect" || report.Changes[1].Error != "refused" {
+		t.Errorf("down change = %+v", report.Changes[1])
+	}
+
+	tracker.Forget(map[string]bool{"hop-2": true})
+	if report := tracker.Report("hop-1", at(100)); report.Status != StatusUnknown {
+		t.Errorf("forgotten status = %s", report.Status)
+	}
+}
+
+func TestHealthMonitorGatewayEvents(t *testing.T) {
+	cfg := alertTestConfig()
+	notifier := &recordingNotifier{}
+	checker := &fakeChecker{now: time.Now(), down: map[string]string{}}
+	var saved map[string]types.HealthCheck
+	health := NewHealthMonitor(cfg, checker, NewMonitor(cfg, &fakeProber{}, notifier), func(checks map[string]types.HealthCheck) error {
+		saved = checks
+		return nil
+	})
+
+	steps := []struct {
+		name   string
+		down   map[string]string
+		events []string
+	}{
+		{"first check up", nil, nil},
+		{"gateway and non-gateway down", map[string]string{"gateway": "refused", "bastion": "timeout"}, []string{EventGatewayDown}},
+		{"still down", map[string]string{"gateway": "refused"}, nil},
+		{"recovered", nil, []string{EventGatewayRecovered}},
+	}
+	for _, step := range steps {
+		notifier.events = nil
+		checker.down = step.down
+		checker.now = checker.now.Add(time.Minute)
+		health.Check(context.Background())
+
+		var got []string
+		for _, event := range notifier.events {
+			got = append(got, event.Type)
+			if event.ServerID != "hop-2" || event.Route != "gateway" {
+				t.Errorf("%s: event = %+v", step.name, event)
+			}
+		}
+		if !reflect.DeepEqual(got, step.events) {
+			t.Errorf("%s: events = %v, want %v", step.name, got, step.events)
+		}
+		if len(saved) != len(cfg.Hops) {
+			t.Errorf("%s: saved %d checks", step.name, len(saved))
+		}
+	}
+
+	report := health.Uptime().Report("hop-2", checker.now)
+	if report.Status != StatusUp || len(report.Changes) != 3 {
+		t.Errorf("gateway report = %+v", report)
+	}
+	if got := len(health.alerts.Events()); got != 2 {
+		t.Errorf("recorded %d events, want 2", got)
+	}
+}
@@ -0,0 +1,317 @@
+package alert
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const (
+	// DefaultConsecutive 默认触发告警的连续超阈值次数
+	DefaultConsecutive = 3
+	// DefaultInterval 默认探测间隔
+	DefaultInterval = time.Minute
+	// probeTimeout 单条路径探测超时
+	probeTimeout = 30 * time.Second
+	// maxEvents 保留的最近事件数
+	maxEvents = 100
+)
+
+// Prober 探测一条跳板链的延迟，忽略缓存（profiler.NetworkProfiler 实现）
+type Prober interface {
+	Refresh(ctx context.Context, hops []*types.Hop) (*types.LatencyReport, error)
+}
+
+// Switcher 把经过 from 路径的运行中转发切换到 to 路径，返回切换的映射 ID
+type Switcher interface {
+	SwitchPath(ctx context.Context, from, to []*types.Hop) []string
+}
+
+// RouteState 一条被监控路由的当前状态
+type RouteState struct {
+	Route         string    `json:"route"`
+	FromID        string    `json:"from_id"`
+	ToID          string    `json:"to_id"`
+	ViaID         string    `json:"via_id,omitempty"`
+	ThresholdMs   int       `json:"threshold_ms"`
+	LastLatencyMs int64     `json:"last_latency_ms"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastProbe     time.Time `json:"last_probe"`
+	Consecutive   int       `json:"consecutive"` // 当前连续超阈值次数
+	Alerting      bool      `json:"alerting"`    // 已告警且尚未恢复
+}
+
+// Monitor 路由延迟监控
+type Monitor struct {
+	alerts   types.AlertConfig
+	config   *types.Config
+	prober   Prober
+	notifier Notifier
+	switcher Switcher // 未设置时不自动切换
+
+	mu     sync.Mutex
+	states map[string]*RouteState // 路由键 -> 状态
+	events []Event
+}
+
+// NewMonitor 创建监控，cfg 为运行中的配置（每轮检查时读取最新的路由）
+func NewMonitor(cfg *types.Config, prober Prober, notifier Notifier) *Monitor {
+	return &Monitor{
+		alerts:   cfg.Alerts,
+		config:   cfg,
+		prober:   prober,
+		notifier: notifier,
+		states:   make(map[string]*RouteState),
+	}
+}
+
+// SetSwitcher 设置自动切换的执行方，仅在 alerts.auto_switch 开启时使用
+func (m *Monitor) SetSwitcher(switcher Switcher) {
+	m.switcher = switcher
+}
+
+// Run 按间隔持续检查，直到 ctx 取消
+func (m *Monitor) Run(ctx context.Context) {
+	interval := m.alerts.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check 探测每条设置了阈值的路由一次，更新状态并在需要时发出事件
+func (m *Monitor) Check(ctx context.Context) {
+	seen := make(map[string]bool)
+	for _, route := range m.config.Routes {
+		if route.Threshold <= 0 {
+			continue
+		}
+		preferred, alternative := RoutePaths(m.config, route)
+		if preferred == nil {
+			continue
+		}
+		key := routeKey(route)
+		seen[key] = true
+		m.checkRoute(ctx, key, route, preferred, alternative)
+	}
+
+	// 删除的路由不再显示
+	m.mu.Lock()
+	for key := range m.states {
+		if !seen[key] {
+			delete(m.states, key)
+		}
+	}
+	m.mu.Unlock()
+}
+
+// checkRoute 探测一条路由并更新状态
+func (m *Monitor) checkRoute(ctx context.Context, key string, route *types.RoutePreference, preferred, alternative []*types.Hop) {
+	latency, errMsg := m.probe(ctx, preferred)
+	breached := errMsg != "" || latency > time.Duration(route.Threshold)*time.Millisecond
+
+	m.mu.Lock()
+	state, ok := m.states[key]
+	if !ok {
+		state = &RouteState{}
+		m.states[key] = state
+	}
+	state.Route = routeLabel(m.config, route)
+	state.FromID, state.ToID, state.ViaID = route.FromID, route.ToID, route.ViaID
+	state.ThresholdMs = route.Threshold
+	state.LastLatencyMs = latency.Milliseconds()
+	state.LastError = errMsg
+	state.LastProbe = time.Now()
+
+	var event *Event
+	switch {
+	case breached:
+		state.Consecutive++
+		if !state.Alerting && state.Consecutive >= m.consecutive() {
+			state.Alerting = true
+			event = m.newEvent(EventLatencyExceeded, state, preferred)
+		}
+	case state.Alerting:
+		state.Consecutive = 0
+		state.Alerting = false
+		event = m.newEvent(EventLatencyRecovered, state, preferred)
+	default:
+		state.Consecutive = 0
+	}
+	m.mu.Unlock()
+
+	if event == nil {
+		return
+	}
+	if event.Type == EventLatencyExceeded && alternative != nil {
+		m.tryAlternative(ctx, event, preferred, alternative, latency, errMsg != "")
+	}
+	m.emit(ctx, event)
+}
+
+// tryAlternative 探测备选路径，备选路径更快且开启了自动切换时切换运行中的转发
+func (m *Monitor) tryAlternative(ctx context.Context, event *Event, preferred, alternative []*types.Hop, latency time.Duration, failed bool) {
+	altLatency, altErr := m.probe(ctx, alternative)
+	if altErr != "" {
+		return
+	}
+	event.Alternative = hopNames(alternative)
+	event.AlternativeLatencyMs = altLatency.Milliseconds()
+
+	if !m.alerts.AutoSwitch || m.switcher == nil || (!failed && altLatency >= latency) {
+		return
+	}
+	event.Switched = m.switcher.SwitchPath(ctx, preferred, alternative)
+}
+
+// probe 探测一次，返回延迟或失败原因
+func (m *Monitor) probe(ctx context.Context, hops []*types.Hop) (time.Duration, string) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	report, err := m.prober.Refresh(ctx, hops)
+	if err != nil {
+		return 0, err.Error()
+	}
+	if !report.Success {
+		return report.Latency, report.Error
+	}
+	return report.Latency, ""
+}
+
+// emit 记录事件并发送
+func (m *Monitor) emit(ctx context.Context, event *Event) {
+	m.mu.Lock()
+	m.events = append(m.events, *event)
+	if len(m.events) > maxEvents {
+		m.events = m.events[len(m.events)-maxEvents:]
+	}
+	m.mu.Unlock()
+
+	if err := m.notifier.Notify(ctx, event); err != nil {
+		log.Printf("[Alert] Failed to send alert for %s: %v", event.Route, err)
+	}
+}
+
+// newEvent 根据路由状态创建事件
+func (m *Monitor) newEvent(eventType string, state *RouteState, path []*types.Hop) *Event {
+	return &Event{
+		Type:        eventType,
+		Route:       state.Route,
+		FromID:      state.FromID,
+		ToID:        state.ToID,
+		ViaID:       state.ViaID,
+		Path:        hopNames(path),
+		LatencyMs:   state.LastLatencyMs,
+		ThresholdMs: state.ThresholdMs,
+		Consecutive: state.Consecutive,
+		Error:       state.LastError,
+		Time:        state.LastProbe,
+	}
+}
+
+// consecutive 触发告警所需的连续次数
+func (m *Monitor) consecutive() int {
+	if m.alerts.Consecutive > 0 {
+		return m.alerts.Consecutive
+	}
+	return DefaultConsecutive
+}
+
+// States 返回被监控路由的状态
+func (m *Monitor) States() []RouteState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	states := make([]RouteState, 0, len(m.states))
+	for _, route := range m.config.Routes {
+		if state, ok := m.states[routeKey(route)]; ok {
+			states = append(states, *state)
+		}
+	}
+	return states
+}
+
+// Events 返回最近的事件，按时间从旧到新
+func (m *Monitor) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Event(nil), m.events...)
+}
+
+// RoutePaths 返回路由被监控的路径和备选路径：
+// 经 via 的路由监控 from 的网关链 -> via -> to，备选为 from 的网关链 -> to；
+// 没有 via 的路由监控 from 的网关链 -> to，没有备选。起点或终点不存在时返回 nil
+func RoutePaths(cfg *types.Config, route *types.RoutePreference) (preferred, alternative []*types.Hop) {
+	from := cfg.GetHopByID(route.FromID)
+	to := cfg.GetHopByID(route.ToID)
+	if from == nil || to == nil {
+		return nil, nil
+	}
+
+	direct := appendUnique(cfg.GatewayChain(from), to)
+	if route.ViaID == "" {
+		return direct, nil
+	}
+	via := cfg.GetHopByID(route.ViaID)
+	if via == nil {
+		return direct, nil
+	}
+	return appendUnique(appendUnique(cfg.GatewayChain(from), via), to), direct
+}
+
+// appendUnique 追加不在链中的服务器
+func appendUnique(chain []*types.Hop, hop *types.Hop) []*types.Hop {
+	for _, h := range chain {
+		if h.ID == hop.ID {
+			return chain
+		}
+	}
+	return append(chain, hop)
+}
+
+// routeKey 路由的唯一键
+func routeKey(route *types.RoutePreference) string {
+	return route.FromID + "|" + route.ToID + "|" + route.ViaID
+}
+
+// routeLabel 路由的显示名称
+func routeLabel(cfg *types.Config, route *types.RoutePreference) string {
+	label := hopName(cfg, route.FromID) + " -> " + hopName(cfg, route.ToID)
+	if route.ViaID != "" {
+		label += " via " + hopName(cfg, route.ViaID)
+	}
+	return label
+}
+
+// hopName 返回服务器名称，不存在时返回 ID
+func hopName(cfg *types.Config, id string) string {
+	if hop := cfg.GetHopByID(id); hop != nil {
+		return hop.Name
+	}
+	return id
+}
+
+// hopNames 返回跳板链的服务器名称
+func hopNames(hops []*types.Hop) []string {
+	names := make([]string, len(hops))
+	for i, hop := range hops {
+		names[i] = hop.Name
+	}
+	return names
+}
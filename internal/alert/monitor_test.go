@@ -0,0 +1,177 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// fakeProber 按路径中的服务器名称返回预设延迟
+type fakeProber struct {
+	mu        sync.Mutex
+	latencies map[string]time.Duration
+}
+
+func (p *fakeProber) set(path string, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.latencies[path] = latency
+}
+
+func (p *fakeProber) Refresh(_ context.Context, hops []*types.Hop) (*types.LatencyReport, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := strings.Join(hopNames(hops), ",")
+	latency, ok := p.latencies[key]
+	if !ok {
+		return &types.LatencyReport{Error: "unreachable"}, nil
+	}
+	return &types.LatencyReport{Latency: latency, Success: true}, nil
+}
+
+type recordingNotifier struct {
+	events []*Event
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, event *Event) error {
+	n.events = append(n.events, event)
+	return nil
+}
+
+type recordingSwitcher struct {
+	from, to []string
+}
+
+func (s *recordingSwitcher) SwitchPath(_ context.Context, from, to []*types.Hop) []string {
+	s.from, s.to = hopNames(from), hopNames(to)
+	return []string{"mapping-1"}
+}
+
+func alertTestConfig() *types.Config {
+	return &types.Config{
+		Hops: []*types.Hop{
+			{ID: "hop-1", Name: "bastion"},
+			{ID: "hop-2", Name: "gateway"},
+			{ID: "hop-3", Name: "db", GatewayID: "hop-2"},
+		},
+		Routes: []*types.RoutePreference{
+			{FromID: "hop-1", ToID: "hop-3", ViaID: "hop-2", Threshold: 50},
+			{FromID: "hop-1", ToID: "hop-2"}, // 未设置阈值，不监控
+		},
+		Alerts: types.AlertConfig{Consecutive: 2, AutoSwitch: true},
+	}
+}
+
+func TestRoutePaths(t *testing.T) {
+	cfg := alertTestConfig()
+
+	preferred, alternative := RoutePaths(cfg, cfg.Routes[0])
+	if got := hopNames(preferred); !reflect.DeepEqual(got, []string{"bastion", "gateway", "db"}) {
+		t.Errorf("preferred = %v", got)
+	}
+	if got := hopNames(alternative); !reflect.DeepEqual(got, []string{"bastion", "db"}) {
+		t.Errorf("alternative = %v", got)
+	}
+
+	preferred, alternative = RoutePaths(cfg, &types.RoutePreference{FromID: "hop-1", ToID: "gone"})
+	if preferred != nil || alternative != nil {
+		t.Errorf("expected no paths for dangling route")
+	}
+}
+
+func TestMonitorAlertsAfterConsecutiveBreaches(t *testing.T) {
+	cfg := alertTestConfig()
+	prober := &fakeProber{latencies: map[string]time.Duration{
+		"bastion,gateway,db": 80 * time.Millisecond,
+		"bastion,db":         20 * time.Millisecond,
+	}}
+	notifier := &recordingNotifier{}
+	switcher := &recordingSwitcher{}
+	monitor := NewMonitor(cfg, prober, notifier)
+	monitor.SetSwitcher(switcher)
+	ctx := context.Background()
+
+	monitor.Check(ctx)
+	if len(notifier.events) != 0 {
+		t.Fatalf("alerted after one breach: %+v", notifier.events)
+	}
+	if states := monitor.States(); len(states) != 1 || states[0].Consecutive != 1 || states[0].Alerting {
+		t.Fatalf("unexpected states: %+v", states)
+	}
+
+	monitor.Check(ctx)
+	if len(notifier.events) != 1 {
+		t.Fatalf("expected one alert, got %d", len(notifier.events))
+	}
+	event := notifier.events[0]
+	if event.Type != EventLatencyExceeded || event.LatencyMs != 80 || event.ThresholdMs != 50 || event.Consecutive != 2 {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if event.AlternativeLatencyMs != 20 || !reflect.DeepEqual(event.Switched, []string{"mapping-1"}) {
+		t.Errorf("alternative not used: %+v", event)
+	}
+	if !reflect.DeepEqual(switcher.to, []string{"bastion", "db"}) {
+		t.Errorf("switched to %v", switcher.to)
+	}
+
+	// 持续超阈值不重复告警
+	monitor.Check(ctx)
+	if len(notifier.events) != 1 {
+		t.Fatalf("alert repeated while still breaching")
+	}
+
+	prober.set("bastion,gateway,db", 30*time.Millisecond)
+	monitor.Check(ctx)
+	if len(notifier.events) != 2 || notifier.events[1].Type != EventLatencyRecovered {
+		t.Fatalf("expected recovery event, got %+v", notifier.events)
+	}
+	if got := monitor.Events(); len(got) != 2 {
+		t.Errorf("expected 2 recorded events, got %d", len(got))
+	}
+}
+
+func TestMonitorSkipsSlowerAlternative(t *testing.T) {
+	cfg := alertTestConfig()
+	cfg.Alerts.Consecutive = 1
+	prober := &fakeProber{latencies: map[string]time.Duration{
+		"bastion,gateway,db": 80 * time.Millisecond,
+		"bastion,db":         120 * time.Millisecond,
+	}}
+	notifier := &recordingNotifier{}
+	switcher := &recordingSwitcher{}
+	monitor := NewMonitor(cfg, prober, notifier)
+	monitor.SetSwitcher(switcher)
+
+	monitor.Check(context.Background())
+	if len(notifier.events) != 1 || len(notifier.events[0].Switched) != 0 || switcher.to != nil {
+		t.Errorf("switched to a slower path: %+v", notifier.events)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		received <- event
+	}))
+	defer srv.Close()
+
+	notifier := NewNotifier(srv.URL)
+	if err := notifier.Notify(context.Background(), &Event{Type: EventLatencyExceeded, Route: "a -> b", LatencyMs: 90}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if event := <-received; event.Route != "a -> b" || event.LatencyMs != 90 {
+		t.Errorf("unexpected payload: %+v", event)
+	}
+}
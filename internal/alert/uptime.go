@@ -0,0 +1,154 @@
+package alert
+
+import (
+	"sync"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// 服务器状态
+const (
+	StatusUp      = "up"
+	StatusDown    = "down"
+	StatusUnknown = "unknown"
+)
+
+// maxStatusChanges 每个服务器保留的最近状态变化数
+const maxStatusChanges = 200
+
+// StatusChange 服务器状态的一次变化
+type StatusChange struct {
+	Time   time.Time `json:"time"`
+	Status string    `json:"status"`          // up 或 down
+	Stage  string    `json:"stage,omitempty"` // 变为 down 时失败的环节
+	Error  string    `json:"error,omitempty"`
+}
+
+// UptimeReport 一个服务器的可用性历史
+type UptimeReport struct {
+	ID            string         `json:"id"`
+	Status        string         `json:"status"`         // up、down 或 unknown（还没有检查过）
+	Since         time.Time      `json:"since,omitzero"` // 当前状态开始的时间
+	TrackedSince  time.Time      `json:"tracked_since,omitzero"`
+	UptimePercent float64        `json:"uptime_percent"` // TrackedSince 以来处于 up 的时间比例
+	Checks        int            `json:"checks"`
+	Failures      int            `json:"failures"`
+	LastCheck     time.Time      `json:"last_check,omitzero"`
+	Changes       []StatusChange `json:"changes"` // 按时间从旧到新
+}
+
+// uptimeHistory 一个服务器的检查记录
+type uptimeHistory struct {
+	first     time.Time // 最早一条保留的状态开始的时间
+	lastCheck time.Time
+	checks    int
+	failures  int
+	changes   []StatusChange
+}
+
+// UptimeTracker 记录每个服务器的状态变化（只在内存中保留，重启后从头开始）
+type UptimeTracker struct {
+	mu      sync.Mutex
+	servers map[string]*uptimeHistory // 服务器 ID -> 记录
+}
+
+// NewUptimeTracker 创建状态记录
+func NewUptimeTracker() *UptimeTracker {
+	return &UptimeTracker{servers: make(map[string]*uptimeHistory)}
+}
+
+// Record 记录一次检查，状态与上次不同时追加一条变化并返回它，否则返回 nil
+func (t *UptimeTracker) Record(id string, check types.HealthCheck) *StatusChange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.servers[id]
+	if !ok {
+		h = &uptimeHistory{first: check.CheckedAt}
+		t.servers[id] = h
+	}
+	h.checks++
+	h.lastCheck = check.CheckedAt
+
+	status := StatusUp
+	if !check.OK {
+		status = StatusDown
+		h.failures++
+	}
+	if n := len(h.changes); n > 0 && h.changes[n-1].Status == status {
+		return nil
+	}
+
+	change := StatusChange{Time: check.CheckedAt, Status: status}
+	if !check.OK {
+		change.Stage, change.Error = check.Stage, check.Error
+	}
+	h.changes = append(h.changes, change)
+	if len(h.changes) > maxStatusChanges {
+		h.changes = h.changes[len(h.changes)-maxStatusChanges:]
+		h.first = h.changes[0].Time
+	}
+	return &change
+}
+
+// Report 返回服务器截至 now 的可用性历史
+func (t *UptimeTracker) Report(id string, now time.Time) UptimeReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := UptimeReport{ID: id, Status: StatusUnknown, Changes: []StatusChange{}}
+	h, ok := t.servers[id]
+	if !ok || len(h.changes) == 0 {
+		return report
+	}
+
+	last := h.changes[len(h.changes)-1]
+	report.Status = last.Status
+	report.Since = last.Time
+	report.TrackedSince = h.first
+	report.Checks = h.checks
+	report.Failures = h.failures
+	report.LastCheck = h.lastCheck
+	report.Changes = append(report.Changes, h.changes...)
+
+	// 每个状态持续到下一次变化，最后一个持续到 now
+	var up, total time.Duration
+	for i, change := range h.changes {
+		end := now
+		if i+1 < len(h.changes) {
+			end = h.changes[i+1].Time
+		}
+		d := end.Sub(change.Time)
+		total += d
+		if change.Status == StatusUp {
+			up += d
+		}
+	}
+	switch {
+	case total > 0:
+		report.UptimePercent = float64(up) / float64(total) * 100
+	case last.Status == StatusUp:
+		report.UptimePercent = 100
+	}
+	return report
+}
+
+// seen 是否已有服务器的检查记录
+func (t *UptimeTracker) seen(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.servers[id]
+	return ok
+}
+
+// Forget 删除已不在配置中的服务器的记录
+func (t *UptimeTracker) Forget(keep map[string]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := range t.servers {
+		if !keep[id] {
+			delete(t.servers, id)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/agent"
+	"github.com/luobobo896/HSSH/internal/portal/protocol"
+)
+
+const (
+	// agentFetchTimeout 单次 fetch 任务的最长等待时间
+	agentFetchTimeout = 30 * time.Minute
+	// agentHubCertFile 未配置 tls_cert 时自签名证书在配置目录中的文件名
+	agentHubCertFile = "agent-hub.crt"
+	// agentHubKeyFile 自签名证书私钥的文件名
+	agentHubKeyFile = "agent-hub.key"
+	// agentHubCertValidity 自签名证书的有效期；agent 只校验指纹
+	agentHubCertValidity = 10 * 365 * 24 * time.Hour
+)
+
+// AgentFetchRequest 让 agent 拉取内网文件的请求
+type AgentFetchRequest struct {
+	URL  string `json:"url"`
+	Dest string `json:"dest"` // 相对于 agent fetch 目录
+}
+
+// AgentForwardRequest 经由 agent 的端口转发请求
+type AgentForwardRequest struct {
+	LocalAddr  string `json:"local_addr"` // "auto" 自动分配端口
+	RemoteHost string `json:"remote_host"`
+	RemotePort int    `json:"remote_port"`
+	AllowLAN   bool   `json:"allow_lan,omitempty"` // 确认监听本机以外可访问的地址，还需配置 ports.allow_lan
+}
+
+// startAgentHub 按配置启动 agent 控制面
+func (s *Server) startAgentHub() error {
+	cfg := s.config.Agents
+
+	var tlsConfig *tls.Config
+	if cfg.TLSCert != "" && cfg.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return fmt.Errorf("failed to load agent hub TLS certs: %w", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	} else {
+		// 自签名证书保存在配置目录，重启后指纹不变，agent 的 --fingerprint 继续有效
+		var err error
+		tlsConfig, err = protocol.LoadOrCreateSelfSignedTLS(
+			filepath.Join(s.config.ConfigDir, agentHubCertFile),
+			filepath.Join(s.config.ConfigDir, agentHubKeyFile),
+			agentHubCertValidity)
+		if err != nil {
+			return fmt.Errorf("failed to prepare agent hub TLS certs: %w", err)
+		}
+		log.Printf("[Agent Hub] Using self-signed TLS certificate, fingerprint: %s", protocol.CertFingerprint(tlsConfig))
+	}
+
+	hub := agent.NewHub(cfg.Tokens, tlsConfig)
+	if err := hub.Listen(cfg.ListenAddr); err != nil {
+		return err
+	}
+	go hub.Serve()
+
+	s.agents = hub
+	return nil
+}
+
+// handleAgents 列出已注册的 agent
+func (s *Server) handleAgents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.agents == nil {
+		localizedError(w, r, http.StatusServiceUnavailable, "ERR_AGENT_HUB_DISABLED")
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.agents.List())
+}
+
+// handleAgentDetail 处理 /api/agents/{name}[/fetch|/forwards[/{id}]]
+func (s *Server) handleAgentDetail(w http.ResponseWriter, r *http.Request) {
+	if s.agents == nil {
+		localizedError(w, r, http.StatusServiceUnavailable, "ERR_AGENT_HUB_DISABLED")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/agents/"), "/")
+	name := parts[0]
+	if name == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_AGENT_NAME_REQUIRED")
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		info, ok := s.agents.Get(name)
+		if !ok {
+			localizedError(w, r, http.StatusNotFound, "ERR_AGENT_NOT_CONNECTED")
+			return
+		}
+		jsonResponse(w, http.StatusOK, info)
+	case len(parts) == 2 && parts[1] == "fetch":
+		s.handleAgentFetch(w, r, name)
+	case len(parts) == 2 && parts[1] == "forwards":
+		s.handleAgentForwards(w, r, name)
+	case len(parts) == 3 && parts[1] == "forwards":
+		s.handleAgentForwardDetail(w, r, parts[2])
+	default:
+		localizedError(w, r, http.StatusNotFound, "ERR_NOT_FOUND")
+	}
+}
+
+// handleAgentFetch 让 agent 在内网侧直接下载文件，避免经控制面双跳
+func (s *Server) handleAgentFetch(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req AgentFetchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	if req.URL == "" || req.Dest == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_FETCH_ARGS_REQUIRED")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), agentFetchTimeout)
+	defer cancel()
+
+	result, err := s.agents.Fetch(ctx, name, req.URL, req.Dest)
+	if err != nil {
+		failure(w, r, http.StatusBadGateway, "ERR_FETCH_FAILED", err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, result)
+}
+
+// handleAgentForwards 列出 (GET) 或创建 (POST) 经由 agent 的转发
+func (s *Server) handleAgentForwards(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case http.MethodGet:
+		user := currentUser(r)
+		forwards := make([]agent.ForwardInfo, 0)
+		for _, f := range s.agents.Forwards() {
+			if f.Agent == name && s.owners.canAccess(user, ownerKindAgentForward, f.ID) {
+				forwards = append(forwards, f)
+			}
+		}
+		jsonResponse(w, http.StatusOK, forwards)
+
+	case http.MethodPost:
+		var req AgentForwardRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+			return
+		}
+		if req.LocalAddr == "" || req.RemoteHost == "" || req.RemotePort == 0 {
+			localizedError(w, r, http.StatusBadRequest, "ERR_FORWARD_FIELDS_REQUIRED")
+			return
+		}
+
+		// 与代理和 Portal 映射一样按监听策略检查并登记本地地址；开始监听后由 portUses 列出，停止后随之释放
+		localAddr, release, err := s.claimLocalAddr(req.LocalAddr, req.AllowLAN, portKindAgentForward, fmt.Sprintf("agent-forward-%d", time.Now().UnixNano()), name)
+		if err != nil {
+			portClaimFailure(w, r, err)
+			return
+		}
+		defer release()
+
+		info, err := s.agents.StartForward(name, localAddr, req.RemoteHost, req.RemotePort)
+		if err != nil {
+			failure(w, r, http.StatusInternalServerError, "ERR_FORWARDER_START", err)
+			return
+		}
+		s.owners.set(ownerKindAgentForward, info.ID, currentUser(r))
+		jsonResponse(w, http.StatusCreated, info)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAgentForwardDetail 停止经由 agent 的转发
+func (s *Server) handleAgentForwardDetail(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.owners.canAccess(currentUser(r), ownerKindAgentForward, id) {
+		localizedError(w, r, http.StatusNotFound, "ERR_FORWARD_NOT_FOUND")
+		return
+	}
+
+	if err := s.agents.StopForward(id); err != nil {
+		failure(w, r, http.StatusNotFound, "ERR_FORWARD_NOT_FOUND", err)
+		return
+	}
+	s.owners.remove(ownerKindAgentForward, id)
+	jsonResponse(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/alert"
+	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// AlertsResponse 路由延迟监控状态和最近的告警
+type AlertsResponse struct {
+	Routes []alert.RouteState `json:"routes"`
+	Events []alert.Event      `json:"events"`
+}
+
+// startRouteAlerts 启动路由延迟监控和定时健康检查，没有设置阈值的路由时每轮检查不做任何事，
+// 未设置 alerts.health_interval 时不做定时检查
+func (s *Server) startRouteAlerts(ctx context.Context) {
+	s.alerts = alert.NewMonitor(s.config, s.profiler, alert.NewNotifier(s.config.Alerts.Webhook))
+	s.alerts.SetSwitcher(s)
+	go s.alerts.Run(ctx)
+
+	s.health = alert.NewHealthMonitor(s.config, s.profiler, s.alerts, s.manager.RecordHealthChecks)
+	go s.health.Run(ctx)
+}
+
+// handleAlerts 返回被监控路由的状态和最近的告警事件
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := AlertsResponse{Routes: []alert.RouteState{}, Events: []alert.Event{}}
+	if s.alerts != nil {
+		resp.Routes = s.alerts.States()
+		resp.Events = s.alerts.Events()
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+// handleUptime 返回定时检查记录的服务器状态变化 (GET /api/servers/{id}/uptime)
+// 未开启定时检查时状态为 unknown
+func (s *Server) handleUptime(w http.ResponseWriter, r *http.Request, hop *types.Hop) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.health == nil {
+		jsonResponse(w, http.StatusOK, alert.NewUptimeTracker().Report(hop.ID, time.Now()))
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.health.Uptime().Report(hop.ID, time.Now()))
+}
+
+// SwitchPath 把链路经过 from 路径的运行中 Portal 映射切换到 to 路径
+// 只替换运行中的转发器，配置中的 Via 不变，映射重启后恢复原路径
+func (s *Server) SwitchPath(ctx context.Context, from, to []*types.Hop) []string {
+	s.portalMu.RLock()
+	running := make(map[string]*proxy.PortForwarder, len(s.portalForwarders))
+	for id, fwd := range s.portalForwarders {
+		running[id] = fwd
+	}
+	s.portalMu.RUnlock()
+
+	var switched []string
+	for id, old := range running {
+		var mapping *types.PortMapping
+		for i := range s.config.Portal.Client.Mappings {
+			if s.config.Portal.Client.Mappings[i].ID == id {
+				mapping = &s.config.Portal.Client.Mappings[i]
+				break
+			}
+		}
+		if mapping == nil {
+			continue
+		}
+		hops, err := s.buildHopChainForMapping(mapping)
+		if err != nil {
+			continue
+		}
+
+		// 目标在配置中时参与匹配，路由的终点通常就是映射的目标
+		target := s.mappingTargetHop(mapping)
+		path := hops
+		if target != nil {
+			path = append(append([]*types.Hop(nil), hops...), target)
+		}
+		newPath, ok := replacePath(path, from, to)
+		if !ok {
+			continue
+		}
+		if target != nil && len(newPath) > 0 && newPath[len(newPath)-1].ID == target.ID {
+			newPath = newPath[:len(newPath)-1]
+		}
+
+		if err := s.restartMappingOn(ctx, id, mapping, old, newPath, switchoverPath); err != nil {
+			log.Printf("[Alert] Failed to switch mapping %s: %v", id, err)
+			continue
+		}
+		switched = append(switched, id)
+	}
+	return switched
+}
+
+// replacePath 把 path 中与 from 相同的连续一段替换为 to，没有这一段时返回 false
+func replacePath(path, from, to []*types.Hop) ([]*types.Hop, bool) {
+	if len(from) == 0 || len(from) > len(path) {
+		return nil, false
+	}
+	for i := 0; i+len(from) <= len(path); i++ {
+		match := true
+		for j, hop := range from {
+			if path[i+j].ID != hop.ID {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		replaced := append([]*types.Hop(nil), path[:i]...)
+		replaced = append(replaced, to...)
+		return append(replaced, path[i+len(from):]...), true
+	}
+	return nil, false
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/alert"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestReplacePath(t *testing.T) {
+	a, b, c, d := &types.Hop{ID: "a"}, &types.Hop{ID: "b"}, &types.Hop{ID: "c"}, &types.Hop{ID: "d"}
+
+	tests := []struct {
+		name     string
+		path     []*types.Hop
+		from, to []*types.Hop
+		want     []string
+		ok       bool
+	}{
+		{"whole path", []*types.Hop{a, b, c}, []*types.Hop{a, b, c}, []*types.Hop{a, c}, []string{"a", "c"}, true},
+		{"middle segment", []*types.Hop{d, a, b, c}, []*types.Hop{a, b, c}, []*types.Hop{a, c}, []string{"d", "a", "c"}, true},
+		{"not contiguous", []*types.Hop{a, d, b, c}, []*types.Hop{a, b, c}, []*types.Hop{a, c}, nil, false},
+		{"longer than path", []*types.Hop{a}, []*types.Hop{a, b}, []*types.Hop{b}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := replacePath(tt.path, tt.from, tt.to)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			var ids []string
+			for _, hop := range got {
+				ids = append(ids, hop.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("path = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlertsWithoutMonitor(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/alerts", nil)
+	req.Header.Set("Authorization", "Bearer bob-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp AlertsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if resp.Routes == nil || resp.Events == nil || len(resp.Routes) != 0 {
+		t.Errorf("unexpected response: %s", rec.Body.String())
+	}
+}
+
+func TestUptimeWithoutMonitor(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"unknown status", http.MethodGet, "/api/servers/hop-1/uptime", http.StatusOK},
+		{"wrong method", http.MethodPost, "/api/servers/hop-1/uptime", http.StatusMethodNotAllowed},
+		{"unknown server", http.MethodGet, "/api/servers/missing/uptime", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer bob-token")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var report alert.UptimeReport
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if report.ID != "hop-1" || report.Status != alert.StatusUnknown || report.Changes == nil {
+				t.Errorf("unexpected response: %s", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/i18n"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// approvalRetention 已决定的审批请求在列表中保留的时间
+const approvalRetention = time.Hour
+
+// 审批请求的状态
+const (
+	approvalPending  = "pending"
+	approvalApproved = "approved"
+	approvalDenied   = "denied"
+	approvalExpired  = "expired"
+	approvalCanceled = "canceled" // 发起的操作在审批前结束（上传被取消、终端页面关闭）
+)
+
+// 需要审批的操作
+const (
+	approvalKindTerminal = "terminal"
+	approvalKindUpload   = "upload"
+)
+
+// Approval 一个审批请求。只保存在内存中，gmssh web 重启时等待中的操作随之结束
+type Approval struct {
+	ID          string    `json:"id"`
+	Kind        string    `json:"kind"`             // terminal、upload
+	Server      string    `json:"server"`           // 需要审批的服务器
+	Target      string    `json:"target,omitempty"` // 上传的目标路径
+	TaskID      string    `json:"task_id,omitempty"`
+	RequestedBy string    `json:"requested_by"`
+	RequestID   string    `json:"request_id,omitempty"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	DecidedBy   string    `json:"decided_by,omitempty"`
+	DecidedAt   time.Time `json:"decided_at,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+
+	done chan struct{} // 决定后关闭
+}
+
+// ApprovalDecision 批准或拒绝的请求体
+type ApprovalDecision struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// distinctWebUsers 返回 web.users 中不同用户名的数量
+func distinctWebUsers(users []*types.WebUser) int {
+	names := make(map[string]bool, len(users))
+	for _, u := range users {
+		if u != nil && u.Name != "" {
+			names[u.Name] = true
+		}
+	}
+	return len(names)
+}
+
+// approvalHop 审批开启时返回链中目标服务器（最后一跳）需要审批的配置，否则返回 nil
+func (s *Server) approvalHop(hops []*types.Hop) *types.Hop {
+	if len(hops) == 0 {
+		return nil
+	}
+	if target := hops[len(hops)-1]; s.config.Approval.Requires(target) {
+		return target
+	}
+	return nil
+}
+
+// requestApproval 创建待审批请求并写入审计日志
+func (s *Server) requestApproval(approval *Approval) *Approval {
+	now := time.Now()
+	approval.ID = uuid.New().String()
+	approval.Status = approvalPending
+	approval.CreatedAt = now
+	approval.ExpiresAt = now.Add(s.config.Approval.PendingTTL())
+	approval.done = make(chan struct{})
+
+	s.approvalsMu.Lock()
+	s.pruneApprovals(now)
+	s.approvals[approval.ID] = approval
+	s.approvalsMu.Unlock()
+
+	log.Printf("[Approval] %s requested %s on %s (approval %s)", approval.RequestedBy, approval.Kind, approval.Server, approval.ID)
+	s.recordAudit(audit.Event{
+		RequestID: approval.RequestID,
+		User:      approval.RequestedBy,
+		Action:    "approval.requested",
+		Target:    approval.ID,
+	})
+	return approval
+}
+
+// awaitApproval 等待审批结果，返回最终状态；ctx 结束时请求被取消，到期时过期
+func (s *Server) awaitApproval(ctx context.Context, approval *Approval) string {
+	timer := time.NewTimer(time.Until(approval.ExpiresAt))
+	defer timer.Stop()
+	select {
+	case <-approval.done:
+	case <-timer.C:
+		s.decideApproval(approval, approvalExpired, "", "")
+	case <-ctx.Done():
+		s.decideApproval(approval, approvalCanceled, approval.RequestedBy, "")
+	}
+	return s.approvalSnapshot(approval).Status
+}
+
+// approvalSnapshot 返回审批请求的副本，可在锁外读取
+func (s *Server) approvalSnapshot(approval *Approval) Approval {
+	s.approvalsMu.Lock()
+	defer s.approvalsMu.Unlock()
+	return *approval
+}
+
+// decideApproval 把待审批请求改为 status；请求已被决定时返回 false
+func (s *Server) decideApproval(approval *Approval, status, user, reason string) bool {
+	s.approvalsMu.Lock()
+	if approval.Status != approvalPending {
+		s.approvalsMu.Unlock()
+		return false
+	}
+	approval.Status = status
+	approval.DecidedBy = user
+	approval.DecidedAt = time.Now()
+	approval.Reason = reason
+	close(approval.done)
+	s.approvalsMu.Unlock()
+
+	log.Printf("[Approval] Approval %s for %s on %s: %s %s", approval.ID, approval.Kind, approval.Server, status, user)
+	s.recordAudit(audit.Event{
+		RequestID: approval.RequestID,
+		User:      user,
+		Action:    "approval." + status,
+		Target:    approval.ID,
+		Error:     reason,
+	})
+	return true
+}
+
+// pruneApprovals 移除决定超过 approvalRetention 的请求，调用方持有 approvalsMu
+func (s *Server) pruneApprovals(now time.Time) {
+	for id, approval := range s.approvals {
+		if approval.Status != approvalPending && now.Sub(approval.DecidedAt) > approvalRetention {
+			delete(s.approvals, id)
+		}
+	}
+}
+
+// approvalFailure 未获批准时的错误代码和说明
+func approvalFailure(lang i18n.Lang, approval *Approval, status string) (string, string) {
+	switch status {
+	case approvalDenied:
+		return "ERR_APPROVAL_DENIED", i18n.T(lang, "ERR_APPROVAL_DENIED", approval.Server, approval.DecidedBy, reasonNote(approval.Reason))
+	case approvalExpired:
+		return "ERR_APPROVAL_EXPIRED", i18n.T(lang, "ERR_APPROVAL_EXPIRED", approval.Server, approval.ExpiresAt.Format(time.RFC3339))
+	default:
+		return "ERR_APPROVAL_CANCELED", i18n.T(lang, "ERR_APPROVAL_CANCELED", approval.Server)
+	}
+}
+
+// reasonNote 附在错误消息后的原因
+func reasonNote(reason string) string {
+	if reason == "" {
+		return ""
+	}
+	return ": " + reason
+}
+
+// handleApprovals GET 列出审批请求，待审批的在前 (/api/approvals)
+func (s *Server) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	s.approvalsMu.Lock()
+	s.pruneApprovals(time.Now())
+	list := make([]Approval, 0, len(s.approvals))
+	for _, approval := range s.approvals {
+		list = append(list, *approval)
+	}
+	s.approvalsMu.Unlock()
+
+	slices.SortFunc(list, func(a, b Approval) int {
+		if (a.Status == approvalPending) != (b.Status == approvalPending) {
+			if a.Status == approvalPending {
+				return -1
+			}
+			return 1
+		}
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	jsonResponse(w, http.StatusOK, list)
+}
+
+// handleApprovalDetail GET 查看，POST .../approve 批准，POST .../deny 拒绝 (/api/approvals/{id})。
+// 发起人不能批准自己的请求，但可以拒绝（撤回）
+func (s *Server) handleApprovalDetail(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/approvals/"), "/")
+
+	s.approvalsMu.Lock()
+	approval := s.approvals[id]
+	s.approvalsMu.Unlock()
+	if approval == nil {
+		localizedError(w, r, http.StatusNotFound, "ERR_APPROVAL_NOT_FOUND")
+		return
+	}
+
+	var status string
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		jsonResponse(w, http.StatusOK, s.approvalSnapshot(approval))
+		return
+	case action == "approve" && r.Method == http.MethodPost:
+		status = approvalApproved
+	case action == "deny" && r.Method == http.MethodPost:
+		status = approvalDenied
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ApprovalDecision
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	user := currentUser(r)
+	if status == approvalApproved && user.Name == approval.RequestedBy {
+		localizedError(w, r, http.StatusForbidden, "ERR_APPROVAL_SELF")
+		return
+	}
+	if !s.decideApproval(approval, status, user.Name, req.Reason) {
+		localizedError(w, r, http.StatusConflict, "ERR_APPROVAL_DECIDED", s.approvalSnapshot(approval).Status)
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.approvalSnapshot(approval))
+}
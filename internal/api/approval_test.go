@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/internal/transfer"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestApprovalWorkflow(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	server.config.Approval = types.ApprovalConfig{Enabled: true}
+	if err := server.manager.AddHop(&types.Hop{ID: "hop-2", Name: "db-1", Host: "10.0.0.5", Port: 22, User: "root", Tags: []string{"production"}}); err != nil {
+		t.Fatal(err)
+	}
+	do := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if hop := server.approvalHop([]*types.Hop{server.config.GetHopByName("web-1")}); hop != nil {
+		t.Errorf("untagged server requires approval")
+	}
+	target := server.approvalHop([]*types.Hop{server.config.GetHopByName("web-1"), server.config.GetHopByName("db-1")})
+	if target == nil || target.Name != "db-1" {
+		t.Fatalf("approvalHop = %v", target)
+	}
+
+	approval := server.requestApproval(&Approval{Kind: approvalKindTerminal, Server: target.Name, RequestedBy: "bob"})
+	result := make(chan string, 1)
+	go func() { result <- server.awaitApproval(context.Background(), approval) }()
+
+	if rec := do(http.MethodPost, "/api/approvals/"+approval.ID+"/approve", "bob-token", ""); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "ERR_APPROVAL_SELF") {
+		t.Errorf("self approve: expected 403, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var list []Approval
+	json.Unmarshal(do(http.MethodGet, "/api/approvals", "carol-token", "").Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Status != approvalPending || list[0].Server != "db-1" {
+		t.Fatalf("pending list = %+v", list)
+	}
+
+	if rec := do(http.MethodPost, "/api/approvals/"+approval.ID+"/approve", "carol-token", `{"reason": "INC-42"}`); rec.Code != http.StatusOK {
+		t.Fatalf("approve: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	select {
+	case status := <-result:
+		if status != approvalApproved {
+			t.Errorf("await = %s", status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("approval did not release the waiting operation")
+	}
+	if rec := do(http.MethodPost, "/api/approvals/"+approval.ID+"/deny", "alice-token", ""); rec.Code != http.StatusConflict {
+		t.Errorf("decide twice: expected 409, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/approvals/nope", "alice-token", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown approval: expected 404, got %d", rec.Code)
+	}
+
+	// 被拒绝的上传在连接前失败
+	taskID := "upload-approval"
+	server.uploads[taskID] = &types.TransferProgress{TaskID: taskID, Status: "pending"}
+	server.owners.set(ownerKindUpload, taskID, server.lookupUser("bob-token"))
+	done := make(chan struct{})
+	go func() {
+		server.executeUpload(taskID, t.TempDir(), "hop-2", "/tmp/x", nil, transfer.ModeTunnel, false, false, true)
+		close(done)
+	}()
+	var pending *Approval
+	for deadline := time.Now().Add(5 * time.Second); pending == nil && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		server.mu.RLock()
+		id := server.uploads[taskID].ApprovalID
+		server.mu.RUnlock()
+		server.approvalsMu.Lock()
+		pending = server.approvals[id]
+		server.approvalsMu.Unlock()
+	}
+	if pending == nil {
+		t.Fatal("upload did not request approval")
+	}
+	if rec := do(http.MethodPost, "/api/approvals/"+pending.ID+"/deny", "alice-token", `{"reason": "change freeze"}`); rec.Code != http.StatusOK {
+		t.Fatalf("deny: expected 200, got %d", rec.Code)
+	}
+	<-done
+	if progress := server.uploads[taskID]; progress.Status != "failed" || progress.ErrorCode != "ERR_APPROVAL_DENIED" || !strings.Contains(progress.Error, "change freeze") {
+		t.Errorf("denied upload = %+v", progress)
+	}
+
+	// 无人处理的请求到期后拒绝
+	server.config.Approval.TTL = 50 * time.Millisecond
+	expiring := server.requestApproval(&Approval{Kind: approvalKindTerminal, Server: "db-1", RequestedBy: "bob"})
+	if status := server.awaitApproval(context.Background(), expiring); status != approvalExpired {
+		t.Errorf("await = %s, want expired", status)
+	}
+}
+
+func TestApprovalRequiresTwoUsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		web     string
+		token   string
+		wantErr bool
+	}{
+		{"no auth", "", "", true},
+		{"auth token only", "", "env-token", true},
+		{"one user", "  users:\n    - {name: alice, token: a, role: admin}\n", "", true},
+		{"one user and auth token", "  users:\n    - {name: alice, token: a, role: admin}\n", "env-token", true},
+		{"same name twice", "  users:\n    - {name: alice, token: a, role: admin}\n    - {name: alice, token: b, role: user}\n", "", true},
+		{"two users", "  users:\n    - {name: alice, token: a, role: admin}\n    - {name: bob, token: b, role: user}\n", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			configDir := filepath.Join(home, ".gmssh")
+			os.MkdirAll(configDir, 0700)
+			data := "version: 2\nhops: []\napproval:\n  enabled: true\nweb:\n" + tt.web
+			if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(data), 0600); err != nil {
+				t.Fatal(err)
+			}
+			config.SetOverrides(config.Overrides{AuthToken: tt.token})
+			t.Cleanup(func() { config.SetOverrides(config.Overrides{}) })
+
+			server, err := NewServer()
+			if tt.wantErr && err == nil {
+				t.Fatal("server started with approval but fewer than two web users")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			if server != nil {
+				server.Close()
+			}
+		})
+	}
+}
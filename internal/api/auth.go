@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const (
+	// authCookieName 登录后下发的会话 Cookie
+	authCookieName = "gmssh_token"
+)
+
+// localUser 未配置用户时使用的本地管理员（单用户模式）
+var localUser = &types.WebUser{Name: "local", Role: types.WebRoleAdmin}
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// authEnabled 是否启用了多用户认证
+func (s *Server) authEnabled() bool {
+	return len(s.config.Web.Users) > 0 || s.tokenUser != nil
+}
+
+// lookupUser 根据令牌查找用户
+func (s *Server) lookupUser(token string) *types.WebUser {
+	if token == "" {
+		return nil
+	}
+	if s.tokenUser != nil && subtle.ConstantTimeCompare([]byte(s.tokenUser.Token), []byte(token)) == 1 {
+		return s.tokenUser
+	}
+	for _, u := range s.config.Web.Users {
+		if u.Token != "" && subtle.ConstantTimeCompare([]byte(u.Token), []byte(token)) == 1 {
+			return u
+		}
+	}
+	return nil
+}
+
+// requestToken 从请求中提取令牌
+// 优先级：Authorization Bearer > X-Auth-Token > Cookie > ?token=（WebSocket 无法设置请求头）
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if token := r.Header.Get("X-Auth-Token"); token != "" {
+		return token
+	}
+	if c, err := r.Cookie(authCookieName); err == nil && c.Value != "" {
+		return c.Value
+	}
+	return r.URL.Query().Get("token")
+}
+
+// authMiddleware 认证中间件：解析当前用户并写入请求上下文
+// 静态资源与登录接口无需认证
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authEnabled() {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, localUser)))
+			return
+		}
+
+		if !protectedPath(r.URL.Path) || r.URL.Path == "/api/auth/login" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user := s.lookupUser(requestToken(r))
+		if user == nil {
+			localizedError(w, r, http.StatusUnauthorized, "ERR_AUTH_REQUIRED")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	})
+}
+
+// protectedPath 需要认证的路径：API 与调试端点
+func protectedPath(path string) bool {
+	return strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/debug/")
+}
+
+// currentUser 获取当前请求的用户
+// 直接调用 handler（未经过中间件）时视为本地管理员
+func currentUser(r *http.Request) *types.WebUser {
+	if u, ok := r.Context().Value(userContextKey).(*types.WebUser); ok && u != nil {
+		return u
+	}
+	return localUser
+}
+
+// requireAdmin 检查当前用户是否为管理员，不是则返回 403
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !currentUser(r).IsAdmin() {
+		localizedError(w, r, http.StatusForbidden, "ERR_ADMIN_REQUIRED")
+		return false
+	}
+	return true
+}
+
+// LoginRequest 登录请求
+type LoginRequest struct {
+	Token string `json:"token"`
+}
+
+// handleLogin 校验令牌并下发会话 Cookie
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+
+	user := s.lookupUser(req.Token)
+	if !s.authEnabled() {
+		user = localUser
+	}
+	if user == nil {
+		localizedError(w, r, http.StatusUnauthorized, "ERR_INVALID_TOKEN")
+		return
+	}
+
+	if s.authEnabled() {
+		http.SetCookie(w, &http.Cookie{
+			Name:     authCookieName,
+			Value:    req.Token,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+			Secure:   r.TLS != nil,
+		})
+		if err := setCSRFCookie(w, r); err != nil {
+			localizedError(w, r, http.StatusInternalServerError, "ERR_CSRF_TOKEN_FAILED")
+			return
+		}
+	}
+	jsonResponse(w, http.StatusOK, user)
+}
+
+// handleLogout 清除会话 Cookie
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     authCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:   csrfCookieName,
+		Value:  "",
+		Path:   "/",
+		MaxAge: -1,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleWhoAmI 返回当前用户
+func (s *Server) handleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"user":         currentUser(r),
+		"auth_enabled": s.authEnabled(),
+	})
+}
+
+// 运行时对象类型（用于归属登记）
+const (
+	ownerKindProxy   = "proxy"
+	ownerKindUpload  = "upload"
+	ownerKindSession = "session"
+
+	ownerKindAgentForward  = "agent_forward"
+	ownerKindChunkedUpload = "chunked_upload"
+	ownerKindFetch         = "fetch"
+)
+
+// ownerRegistry 记录运行时对象（转发、上传任务、终端会话）的归属用户
+// 服务器清单等配置数据是共享的，不经过此处
+type ownerRegistry struct {
+	owners map[string]string // kind:id -> user name
+	mu     sync.RWMutex
+}
+
+func newOwnerRegistry() *ownerRegistry {
+	return &ownerRegistry{owners: make(map[string]string)}
+}
+
+func ownerKey(kind, id string) string {
+	return kind + ":" + id
+}
+
+// set 登记归属
+func (o *ownerRegistry) set(kind, id string, user *types.WebUser) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.owners[ownerKey(kind, id)] = user.Name
+}
+
+// owner 查询归属用户名
+func (o *ownerRegistry) owner(kind, id string) string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.owners[ownerKey(kind, id)]
+}
+
+// remove 删除归属登记
+func (o *ownerRegistry) remove(kind, id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.owners, ownerKey(kind, id))
+}
+
+// canAccess 管理员可访问所有对象，普通用户只能访问自己的
+func (o *ownerRegistry) canAccess(user *types.WebUser, kind, id string) bool {
+	if user.IsAdmin() {
+		return true
+	}
+	return o.owner(kind, id) == user.Name
+}
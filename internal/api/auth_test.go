@@ -0,0 +1,324 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// newAuthTestServer 创建启用多用户认证的测试服务器
+func newAuthTestServer(t *testing.T) (*Server, http.Handler) {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	configDir := filepath.Join(tempDir, ".gmssh")
+	os.MkdirAll(configDir, 0700)
+	t.Setenv("HOME", tempDir)
+
+	server, err := NewServer()
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	server.config.Web.Users = []*types.WebUser{
+		{Name: "alice", Token: "alice-token", Role: types.WebRoleAdmin},
+		{Name: "bob", Token: "bob-token", Role: types.WebRoleUser},
+		{Name: "carol", Token: "carol-token", Role: types.WebRoleUser},
+	}
+	if err := server.manager.AddHop(&types.Hop{ID: "hop-1", Name: "web-1", Host: "10.0.0.1", Port: 22, User: "root"}); err != nil {
+		t.Fatalf("failed to add hop: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	return server, server.authMiddleware(mux)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{"no token", http.MethodGet, "/api/servers", "", "", http.StatusUnauthorized},
+		{"bad token", http.MethodGet, "/api/servers", "nope", "", http.StatusUnauthorized},
+		{"user can list servers", http.MethodGet, "/api/servers", "bob-token", "", http.StatusOK},
+		{"user cannot add server", http.MethodPost, "/api/servers", "bob-token", `{"name":"x","host":"h","user":"u"}`, http.StatusForbidden},
+		{"user cannot delete server", http.MethodDelete, "/api/servers/hop-1", "bob-token", "", http.StatusForbidden},
+		{"admin can update server", http.MethodPut, "/api/servers/hop-1", "alice-token", `{"name":"web-1","host":"10.0.0.2","port":22,"user":"root","auth_type":"key"}`, http.StatusOK},
+		{"login skips auth", http.MethodPost, "/api/auth/login", "", `{"token":"bob-token"}`, http.StatusOK},
+		{"login rejects bad token", http.MethodPost, "/api/auth/login", "", `{"token":"nope"}`, http.StatusUnauthorized},
+		{"whoami", http.MethodGet, "/api/auth/me", "carol-token", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s %s: expected %d, got %d: %s", tt.method, tt.path, tt.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestSessionIsolation(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+
+	closed := false
+	bobSession := server.registerTerminal(server.lookupUser("bob-token"), "web-1", nil, func() { closed = true })
+	server.registerTerminal(server.lookupUser("carol-token"), "web-2", nil, func() {})
+
+	list := func(token string) string {
+		req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	if body := list("bob-token"); !strings.Contains(body, "web-1") || strings.Contains(body, "web-2") {
+		t.Errorf("bob should only see own session, got %s", body)
+	}
+	if body := list("alice-token"); !strings.Contains(body, "web-1") || !strings.Contains(body, "web-2") {
+		t.Errorf("admin should see all sessions, got %s", body)
+	}
+
+	// 其他用户无法关闭
+	req := httptest.NewRequest(http.MethodDelete, "/api/sessions/"+bobSession, nil)
+	req.Header.Set("Authorization", "Bearer carol-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound || closed {
+		t.Fatalf("carol closing bob's session: expected 404, got %d (closed=%v)", rec.Code, closed)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/sessions/"+bobSession, nil)
+	req.Header.Set("Authorization", "Bearer bob-token")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !closed {
+		t.Fatalf("bob closing own session: expected 200, got %d (closed=%v)", rec.Code, closed)
+	}
+}
+
+func TestSessionChains(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+
+	bob := server.lookupUser("bob-token")
+	ids := []string{
+		server.registerTerminal(bob, "db-1", nil, func() {}),
+		server.registerTerminal(bob, "db-1", nil, func() {}),
+		server.registerTerminal(bob, "db-1", nil, func() {}),
+		server.registerTerminal(bob, "web-1", nil, func() {}),
+	}
+	server.registerTerminal(server.lookupUser("carol-token"), "db-1", nil, func() {})
+
+	// 前三个标签共用连接 1
+	for i, id := range ids {
+		entry := server.terminals[id]
+		entry.info.Connection = 1
+		entry.info.Chain = []string{"gateway", "db-1"}
+		if i == 3 {
+			entry.info.Connection = 2
+			entry.info.Chain = []string{"web-1"}
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions/chains", nil)
+	req.Header.Set("Authorization", "Bearer bob-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var groups []SessionGroup
+	if err := json.Unmarshal(rec.Body.Bytes(), &groups); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %+v", groups)
+	}
+	byConn := map[uint64]SessionGroup{}
+	for _, g := range groups {
+		byConn[g.Connection] = g
+	}
+	if g := byConn[1]; len(g.Sessions) != 3 || strings.Join(g.Chain, ">") != "gateway>db-1" {
+		t.Errorf("unexpected group for connection 1: %+v", g)
+	}
+	if g := byConn[2]; len(g.Sessions) != 1 {
+		t.Errorf("unexpected group for connection 2: %+v", g)
+	}
+}
+
+func TestIdleSessions(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+
+	var bobNotes, carolNotes []string
+	bobIdle := server.registerTerminal(server.lookupUser("bob-token"), "web-1", nil, func() {})
+	server.trackTerminal(bobIdle, "192.0.2.10:51000", func(m string) { bobNotes = append(bobNotes, m) })
+	bobActive := server.registerTerminal(server.lookupUser("bob-token"), "web-2", nil, func() {})
+	carolIdle := server.registerTerminal(server.lookupUser("carol-token"), "db-1", nil, func() {})
+	server.trackTerminal(carolIdle, "192.0.2.11:51000", func(m string) { carolNotes = append(carolNotes, m) })
+
+	// bob 的第一个会话 40 分钟没有输入但一直有输出，carol 的会话空闲 2 小时
+	server.terminals[bobIdle].lastInput.Store(time.Now().Add(-40 * time.Minute).UnixNano())
+	server.terminals[bobIdle].recordOutput(10)
+	server.terminals[carolIdle].lastInput.Store(time.Now().Add(-2 * time.Hour).UnixNano())
+	server.terminals[bobActive].recordInput(3)
+
+	do := func(token, method, target, body string) (int, IdleSessions) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var result IdleSessions
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return rec.Code, result
+	}
+
+	code, result := do("bob-token", http.MethodGet, "/api/sessions/idle", "")
+	if code != http.StatusOK || result.Threshold != 1800 || len(result.Sessions) != 1 || result.Sessions[0].ID != bobIdle {
+		t.Fatalf("bob idle sessions: %d %+v", code, result)
+	}
+	info := result.Sessions[0]
+	if info.IdleSeconds < 40*60 || time.Since(info.LastOutputAt) > time.Minute {
+		t.Errorf("idle session info = %+v", info)
+	}
+
+	// 管理员可见全部，空闲最久的在前；提醒写入对应终端
+	code, result = do("alice-token", http.MethodPost, "/api/sessions/idle", `{"threshold": "1h"}`)
+	if code != http.StatusOK || len(result.Sessions) != 1 || result.Sessions[0].ID != carolIdle || result.Warned != 1 {
+		t.Fatalf("admin warn: %d %+v", code, result)
+	}
+	if len(carolNotes) != 1 || !strings.Contains(carolNotes[0], "idle for 2h0m0s") || len(bobNotes) != 0 {
+		t.Errorf("notes: carol %q, bob %q", carolNotes, bobNotes)
+	}
+	code, result = do("alice-token", http.MethodPost, "/api/sessions/idle?threshold=10m", `{"message": "Please log out"}`)
+	if len(result.Sessions) != 2 || result.Sessions[0].ID != carolIdle || result.Warned != 2 || !strings.Contains(bobNotes[0], "Please log out") {
+		t.Errorf("warn all idle: %d %+v, bob notes %q", code, result, bobNotes)
+	}
+
+	if code, _ := do("bob-token", http.MethodGet, "/api/sessions/idle?threshold=-5m", ""); code != http.StatusBadRequest {
+		t.Errorf("invalid threshold: expected 400, got %d", code)
+	}
+
+	// 会话列表同样带最后输入、输出时间
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.Header.Set("Authorization", "Bearer bob-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), `"last_input_at"`) || !strings.Contains(rec.Body.String(), `"idle_seconds"`) {
+		t.Errorf("session list without activity: %s", rec.Body.String())
+	}
+}
+
+func TestAuthDisabledIsLocalAdmin(t *testing.T) {
+	server, _ := newAuthTestServer(t)
+	server.config.Web.Users = nil
+
+	var got *types.WebUser
+	handler := server.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = currentUser(r)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/servers", nil))
+
+	if got == nil || !got.IsAdmin() {
+		t.Fatalf("expected local admin when auth disabled, got %+v", got)
+	}
+}
+
+func TestAuthTokenOverride(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	config.SetOverrides(config.Overrides{AuthToken: "env-token"})
+	t.Cleanup(func() { config.SetOverrides(config.Overrides{}) })
+
+	server, err := NewServer()
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	handler := server.authMiddleware(mux)
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "nope", http.StatusUnauthorized},
+		{"override token", "env-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/servers", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// 令牌只在内存中，不写入配置
+	if err := server.manager.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.config.Web.Users) != 0 {
+		t.Errorf("override token saved as user: %+v", server.config.Web.Users)
+	}
+}
+
+func TestServersHideCredentials(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	hop := server.config.GetHopByName("web-1")
+	hop.AuthType = types.AuthPassword
+	hop.Password = "hunter2"
+	hop.KeyPassphrase = "open-sesame"
+
+	for _, path := range []string{"/api/servers", "/api/servers?q=web", "/api/servers/" + hop.ID} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer bob-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d: %s", path, rec.Code, rec.Body.String())
+		}
+		body := rec.Body.String()
+		if strings.Contains(body, "hunter2") || strings.Contains(body, "open-sesame") ||
+			strings.Contains(body, `"password"`) || strings.Contains(body, `"key_passphrase"`) {
+			t.Errorf("GET %s leaked credentials: %s", path, body)
+		}
+		if !strings.Contains(body, `"has_password":true`) || !strings.Contains(body, `"has_passphrase":true`) {
+			t.Errorf("GET %s missing credential flags: %s", path, body)
+		}
+	}
+
+	// 响应是副本，配置中的凭据保持不变
+	if hop.Password != "hunter2" || hop.KeyPassphrase != "open-sesame" {
+		t.Error("redaction modified the stored hop")
+	}
+}
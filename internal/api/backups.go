@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/remotefile"
+	"github.com/luobobo896/HSSH/pkg/types"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// BackupList 远端文件被上传覆盖前保留的旧版本
+type BackupList struct {
+	Server  string              `json:"server"`
+	Path    string              `json:"path"`
+	Keep    int                 `json:"keep"` // upload.backups 中该文件的保留数，0 表示未开启备份
+	Backups []remotefile.Backup `json:"backups"`
+}
+
+// RestoreBackupRequest 用备份替换远端文件，当前内容先按同样的规则备份
+type RestoreBackupRequest struct {
+	Server string `json:"server"` // 服务器 ID 或名称
+	Path   string `json:"path"`
+	Backup string `json:"backup"` // GET /api/backups 返回的备份路径
+}
+
+// handleBackups 列出远端文件的备份，从新到旧 (GET /api/backups?server=...&path=...)
+func (s *Server) handleBackups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	path := q.Get("path")
+	hop, hops := s.remoteFileHops(w, r, q.Get("server"), path)
+	if hop == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), editTimeout)
+	defer cancel()
+	out, err := s.runOnChain(ctx, hops, remotefile.ListBackupsCommand(path))
+	if err != nil {
+		failure(w, r, http.StatusBadGateway, "ERR_BACKUP_LIST_FAILED", err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, BackupList{
+		Server:  hop.Name,
+		Path:    path,
+		Keep:    s.config.Upload.BackupKeep(hop, path),
+		Backups: remotefile.ParseBackups(path, out),
+	})
+}
+
+// handleRestoreBackup 用备份替换远端文件 (POST /api/backups/restore)：备份先复制到同目录的临时文件，
+// 当前文件按 upload.backups 备份后再 rename 替换，恢复之后仍可撤销
+func (s *Server) handleRestoreBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req RestoreBackupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	hop, hops := s.remoteFileHops(w, r, req.Server, req.Path)
+	if hop == nil {
+		return
+	}
+	if _, ok := remotefile.BackupTime(req.Path, req.Backup); !ok {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "backup", req.Backup)
+		return
+	}
+	if !s.checkMaintenance(w, r, hop.ID) || !s.confirmEnvironment(w, r, hop, types.OpUpload) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), editTimeout)
+	defer cancel()
+	backup := remotefile.BackupName(req.Path, time.Now())
+	cmd := remotefile.RestoreCommand(req.Path, req.Backup, backup, s.config.Upload.BackupKeep(hop, req.Path))
+	if _, err := s.runOnChain(ctx, hops, cmd); err != nil {
+		var exit *gossh.ExitError
+		if errors.As(err, &exit) && errors.Is(remotefile.Failed(exit.ExitStatus(), err), remotefile.ErrNotFound) {
+			localizedError(w, r, http.StatusNotFound, "ERR_BACKUP_NOT_FOUND", req.Backup)
+			return
+		}
+		failure(w, r, http.StatusBadGateway, "ERR_BACKUP_RESTORE_FAILED", err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"path": req.Path, "restored_from": req.Backup})
+}
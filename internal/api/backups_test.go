@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBackupsValidation(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer bob-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name, method, target, body string
+		wantStatus                 int
+		wantCode                   string
+	}{
+		{"list without path", http.MethodGet, "/api/backups?server=web-1", "", http.StatusBadRequest, "ERR_PATH_REQUIRED"},
+		{"list unknown server", http.MethodGet, "/api/backups?server=nope&path=/etc/hosts", "", http.StatusNotFound, "ERR_HOP_NOT_FOUND"},
+		{"list without a connection", http.MethodGet, "/api/backups?server=web-1&path=/etc/hosts", "", http.StatusBadGateway, "ERR_CHAIN_CONFIG"},
+		{"list wrong method", http.MethodPost, "/api/backups?server=web-1&path=/etc/hosts", "", http.StatusMethodNotAllowed, ""},
+		{"restore bad body", http.MethodPost, "/api/backups/restore", "{", http.StatusBadRequest, "ERR_INVALID_BODY"},
+		{"restore without server", http.MethodPost, "/api/backups/restore", `{"path": "/etc/hosts"}`, http.StatusBadRequest, "ERR_HOP_ID_REQUIRED"},
+		{"restore relative path", http.MethodPost, "/api/backups/restore", `{"server": "web-1", "path": "hosts"}`, http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"restore another file", http.MethodPost, "/api/backups/restore", `{"server": "web-1", "path": "/etc/hosts", "backup": "/etc/shadow.bak-20261017T080000.000Z"}`, http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"restore without a connection", http.MethodPost, "/api/backups/restore", `{"server": "hop-1", "path": "/etc/hosts", "backup": "/etc/hosts.bak-20261017T080000.000Z"}`, http.StatusBadGateway, "ERR_CHAIN_CONFIG"},
+		{"restore wrong method", http.MethodGet, "/api/backups/restore", "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.method, tt.target, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantCode != "" && !strings.Contains(rec.Body.String(), tt.wantCode) {
+				t.Errorf("body = %s, want %s", rec.Body.String(), tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const (
+	// warmTimeout 预热（并行建立多条链）的最长时间
+	warmTimeout = time.Minute
+	// defaultWarmCount 未指定数量时预热的链数
+	defaultWarmCount = 1
+)
+
+// WarmChainsRequest 预热请求
+type WarmChainsRequest struct {
+	Target string   `json:"target"`          // 服务器 ID 或名称
+	Via    []string `json:"via,omitempty"`   // 服务器 ID 列表，为空时使用与终端相同的网关链
+	Count  int      `json:"count,omitempty"` // 预热的链数，默认 1，受连接池上限约束
+}
+
+// WarmChainsResponse 预热结果
+type WarmChainsResponse struct {
+	Key       string               `json:"key"`
+	Requested int                  `json:"requested"`
+	Warmed    int                  `json:"warmed"` // 本次新建并放入连接池的链数
+	Pool      terminal.PoolKeyStat `json:"pool"`   // 预热后该目标在连接池中的连接数
+}
+
+// handleChains 返回终端连接池的状态，包括每个目标的预热连接数
+func (s *Server) handleChains(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.chainPool.Snapshot())
+}
+
+// handleWarmChains 为即将打开的终端预先建立 SSH 链并放入连接池，打开终端时直接取用
+func (s *Server) handleWarmChains(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req WarmChainsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	if req.Target == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_TARGET_REQUIRED")
+		return
+	}
+
+	target := s.config.GetHopByID(req.Target)
+	if target == nil {
+		target = s.config.GetHopByName(req.Target)
+	}
+	if target == nil {
+		localizedError(w, r, http.StatusNotFound, "ERR_HOP_NOT_FOUND")
+		return
+	}
+
+	hops, unknown := s.probeVia(req.Via)
+	if unknown != "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_UNKNOWN_HOP", unknown)
+		return
+	}
+	if len(hops) == 0 {
+		hops = s.buildHopChain(target.Name)
+	} else {
+		hops = append(hops, target)
+	}
+
+	count := req.Count
+	if count <= 0 {
+		count = defaultWarmCount
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), warmTimeout)
+	defer cancel()
+
+	warmed, err := s.chainPool.Warm(ctx, hops, count)
+	if err != nil {
+		failure(w, r, http.StatusBadGateway, "ERR_CHAIN_CONNECT", err)
+		return
+	}
+
+	key := terminal.HopKey(hops)
+	resp := WarmChainsResponse{Key: key, Requested: count, Warmed: warmed, Pool: terminal.PoolKeyStat{Key: key}}
+	for _, stat := range s.chainPool.Snapshot().Keys {
+		if stat.Key == key {
+			resp.Pool = stat
+		}
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+// openPooledSession 从连接池取一个 hops 链上的会话；ctx 结束时不再等待，链建立后直接归还
+func (s *Server) openPooledSession(ctx context.Context, hops []*types.Hop) (*terminal.PooledSession, error) {
+	type result struct {
+		session *terminal.PooledSession
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		session, err := s.chainPool.NewSession(hops)
+		done <- result{session, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.session, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-done; res.session != nil {
+				res.session.Close()
+			}
+		}()
+		return nil, fmt.Errorf("open session: %w", ctx.Err())
+	}
+}
+
+// runOnChain 经 hops 链执行 cmd 并返回标准输出，建立链和执行共用 ctx 的期限。
+// 命令以非零状态退出时返回的错误包装 *ssh.ExitError，并附带远端的错误输出
+func (s *Server) runOnChain(ctx context.Context, hops []*types.Hop, cmd string) ([]byte, error) {
+	return s.runOnChainInput(ctx, hops, cmd, nil)
+}
+
+// runOnChainInput 与 runOnChain 相同，stdin 非 nil 时作为远端命令的标准输入
+func (s *Server) runOnChainInput(ctx context.Context, hops []*types.Hop, cmd string, stdin io.Reader) ([]byte, error) {
+	pooled, err := s.openPooledSession(ctx, hops)
+	if err != nil {
+		return nil, err
+	}
+	// 超时返回后关闭会话，结束仍在运行的远端命令
+	defer pooled.Close()
+
+	var stderr bytes.Buffer
+	session := pooled.GetSession()
+	session.Stderr = &stderr
+	session.Stdin = stdin
+
+	type result struct {
+		out []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := session.Output(cmd)
+		done <- result{out, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return res.out, fmt.Errorf("%w: %s", res.err, msg)
+			}
+		}
+		return res.out, res.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("run on %s: %w", hops[len(hops)-1].Name, ctx.Err())
+	}
+}
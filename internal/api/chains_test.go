@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/terminal"
+)
+
+func TestWarmChainsValidation(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+		code   string
+	}{
+		{"wrong method", http.MethodGet, "", http.StatusMethodNotAllowed, ""},
+		{"invalid body", http.MethodPost, "{", http.StatusBadRequest, "ERR_INVALID_BODY"},
+		{"missing target", http.MethodPost, `{}`, http.StatusBadRequest, "ERR_TARGET_REQUIRED"},
+		{"unknown target", http.MethodPost, `{"target": "missing-hop"}`, http.StatusNotFound, "ERR_HOP_NOT_FOUND"},
+		{"unknown via", http.MethodPost, `{"target": "hop-1", "via": ["missing-hop"]}`, http.StatusBadRequest, "ERR_UNKNOWN_HOP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/chains/warm", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer bob-token")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.code == "" {
+				return
+			}
+			var resp map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if resp["code"] != tt.code {
+				t.Errorf("code = %q, want %q", resp["code"], tt.code)
+			}
+		})
+	}
+}
+
+func TestChainPoolStats(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chains", nil)
+	req.Header.Set("Authorization", "Bearer bob-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var snap terminal.PoolSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if snap.Total != 0 || snap.Warm != 0 || snap.Keys == nil {
+		t.Errorf("unexpected snapshot for an empty pool: %+v", snap)
+	}
+}
@@ -0,0 +1,457 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/transfer"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const (
+	// uploadOffsetHeader 分块上传的当前偏移量（请求中为本块的起始位置，响应中为已接收的字节数）
+	uploadOffsetHeader = "Upload-Offset"
+	// uploadLengthHeader 分块上传的文件总大小
+	uploadLengthHeader = "Upload-Length"
+
+	// defaultChunkSize 建议浏览器使用的分块大小
+	defaultChunkSize = 8 << 20
+	// maxChunkSize 单个 PATCH 请求体的上限
+	maxChunkSize = 64 << 20
+)
+
+// InitUploadRequest 创建分块上传 (POST /api/upload/init)
+type InitUploadRequest struct {
+	FileName   string `json:"file_name"`
+	Size       int64  `json:"size"`
+	TargetHost string `json:"target_host"`
+	TargetPath string `json:"target_path"`
+	Via        string `json:"via,omitempty"`      // 逗号分隔，同 POST /api/upload
+	Adaptive   *bool  `json:"adaptive,omitempty"` // 为空时按 upload.adaptive，目标已学到传输参数时也启用
+	Learned    *bool  `json:"learned,omitempty"`  // false 时不沿用目标 playbook 中学到的跳板链和传输参数
+	Mode       string `json:"mode,omitempty"`     // tunnel（默认）、relay、stage 或 compare，同 POST /api/upload
+}
+
+// ChunkedUploadInfo 分块上传的状态，客户端据 offset 从断点继续
+type ChunkedUploadInfo struct {
+	ID        string    `json:"upload_id"`
+	FileName  string    `json:"file_name"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	ChunkSize int64     `json:"chunk_size"` // 建议的分块大小
+	ExpiresAt time.Time `json:"expires_at"` // 此后仍未完成的上传被丢弃
+}
+
+// chunkedUpload 进行中的分块上传，文件写入暂存目录，完成后交给与 POST /api/upload 相同的传输流程
+type chunkedUpload struct {
+	id         string
+	dir        string // 暂存目录
+	fileName   string
+	size       int64
+	targetHost string
+	targetPath string
+	via        []string
+	requestID  string // 创建请求的 ID，完成后的传输日志沿用
+	adaptive   bool   // 使用自适应参数上传
+	learned    bool   // 沿用目标 playbook
+	mode       string // 上传模式，见 transfer.ParseUploadMode
+
+	mu      sync.Mutex
+	offset  int64
+	updated time.Time
+	writing bool // 正在接收一个分块，同一时间只接受一个 PATCH
+	done    bool // 已完成或已取消
+}
+
+// info 返回状态快照，调用方持有 u.mu
+func (u *chunkedUpload) info(ttl time.Duration) ChunkedUploadInfo {
+	return ChunkedUploadInfo{
+		ID:        u.id,
+		FileName:  u.fileName,
+		Size:      u.size,
+		Offset:    u.offset,
+		ChunkSize: defaultChunkSize,
+		ExpiresAt: u.updated.Add(ttl),
+	}
+}
+
+// chunkedUploads 进行中的分块上传
+type chunkedUploads struct {
+	uploads map[string]*chunkedUpload
+	mu      sync.Mutex
+}
+
+func newChunkedUploads() *chunkedUploads {
+	return &chunkedUploads{uploads: make(map[string]*chunkedUpload)}
+}
+
+func (c *chunkedUploads) get(id string) *chunkedUpload {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.uploads[id]
+}
+
+func (c *chunkedUploads) add(u *chunkedUpload) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.uploads[u.id] = u
+}
+
+func (c *chunkedUploads) remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.uploads, id)
+}
+
+// expired 取出超过 ttl 没有收到数据的上传
+func (c *chunkedUploads) expired(ttl time.Duration) []*chunkedUpload {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cutoff := time.Now().Add(-ttl)
+	var stale []*chunkedUpload
+	for id, u := range c.uploads {
+		u.mu.Lock()
+		if u.updated.Before(cutoff) {
+			u.done = true
+			stale = append(stale, u)
+			delete(c.uploads, id)
+		}
+		u.mu.Unlock()
+	}
+	return stale
+}
+
+// chunkedUploadTTL 分块上传的最长空闲时间，与暂存目录的保留时间一致
+func (s *Server) chunkedUploadTTL() time.Duration {
+	if s.config.Upload.MaxAge > 0 {
+		return s.config.Upload.MaxAge
+	}
+	return transfer.DefaultStagingMaxAge
+}
+
+// expireChunkedUploads 丢弃长时间没有收到数据的分块上传并删除暂存文件
+func (s *Server) expireChunkedUploads() {
+	for _, u := range s.chunked.expired(s.chunkedUploadTTL()) {
+		log.Printf("[UPLOAD] Discarding idle chunked upload %s (%s, %d/%d bytes)", u.id, u.fileName, u.offset, u.size)
+		s.owners.remove(ownerKindChunkedUpload, u.id)
+		s.staging.Remove(u.dir)
+	}
+}
+
+// handleChunkedUpload 分发分块上传请求：
+// POST /api/upload/init 创建；HEAD、GET 查询偏移量；PATCH 追加分块；DELETE 取消；
+// POST /api/upload/{id}/complete 完成并开始传输到目标主机
+func (s *Server) handleChunkedUpload(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/upload/")
+	if path == "init" {
+		s.handleInitUpload(w, r)
+		return
+	}
+
+	id, action, _ := strings.Cut(path, "/")
+	upload := s.chunked.get(id)
+	if upload == nil || !s.owners.canAccess(currentUser(r), ownerKindChunkedUpload, id) {
+		localizedError(w, r, http.StatusNotFound, "ERR_UPLOAD_NOT_FOUND")
+		return
+	}
+
+	switch action {
+	case "":
+		switch r.Method {
+		case http.MethodHead, http.MethodGet:
+			s.writeChunkedUpload(w, upload, http.StatusOK)
+		case http.MethodPatch:
+			s.handleUploadChunk(w, r, upload)
+		case http.MethodDelete:
+			s.handleCancelUpload(w, r, upload)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case "complete":
+		s.handleCompleteUpload(w, r, upload)
+	default:
+		localizedError(w, r, http.StatusNotFound, "ERR_UPLOAD_NOT_FOUND")
+	}
+}
+
+// writeChunkedUpload 返回上传状态，HEAD 请求只有 Upload-Offset、Upload-Length 头
+func (s *Server) writeChunkedUpload(w http.ResponseWriter, upload *chunkedUpload, status int) {
+	upload.mu.Lock()
+	info := upload.info(s.chunkedUploadTTL())
+	upload.mu.Unlock()
+
+	w.Header().Set(uploadOffsetHeader, strconv.FormatInt(info.Offset, 10))
+	w.Header().Set(uploadLengthHeader, strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	jsonResponse(w, status, info)
+}
+
+// handleInitUpload 创建分块上传 (POST /api/upload/init)
+func (s *Server) handleInitUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req InitUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	if req.TargetPath == "" || req.TargetHost == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_UPLOAD_TARGET_REQUIRED")
+		return
+	}
+	if _, err := objectTarget(req.TargetPath, false); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_OBJECT_TARGET", err)
+		return
+	}
+	mode, err := uploadMode(req.Mode, req.TargetPath, false)
+	if err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_UPLOAD_MODE", err)
+		return
+	}
+	if req.Size < 0 {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "size", req.Size)
+		return
+	}
+	if !s.checkMaintenance(w, r, append(strings.Split(req.Via, ","), req.TargetHost)...) {
+		return
+	}
+	// 上传到对象存储不会覆盖服务器上的文件
+	if !transfer.IsObjectURL(req.TargetPath) && !s.confirmEnvironment(w, r, s.configuredHop(req.TargetHost), types.OpUpload) {
+		return
+	}
+
+	dir, err := s.staging.Create()
+	if err != nil {
+		localizedError(w, r, http.StatusInternalServerError, "ERR_STAGING", err)
+		return
+	}
+	// 只接受单个文件，目录部分被忽略
+	filePath, err := transfer.SafeJoin(dir, filepath.Base(filepath.FromSlash(req.FileName)))
+	if err != nil {
+		s.staging.Remove(dir)
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "file_name", err)
+		return
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		s.staging.Remove(dir)
+		localizedError(w, r, http.StatusInternalServerError, "ERR_STAGING", err)
+		return
+	}
+	f.Close()
+
+	id, err := newUploadID()
+	if err != nil {
+		s.staging.Remove(dir)
+		localizedError(w, r, http.StatusInternalServerError, "ERR_STAGING", err)
+		return
+	}
+	upload := &chunkedUpload{
+		id:         id,
+		dir:        dir,
+		fileName:   filepath.Base(filePath),
+		size:       req.Size,
+		targetHost: req.TargetHost,
+		targetPath: req.TargetPath,
+		requestID:  requestID(r),
+		learned:    req.Learned == nil || *req.Learned,
+		mode:       mode,
+		updated:    time.Now(),
+	}
+	upload.adaptive = s.adaptiveUpload("", req.TargetHost, upload.learned)
+	if req.Adaptive != nil {
+		upload.adaptive = *req.Adaptive
+	}
+	if req.Via != "" {
+		upload.via = strings.Split(req.Via, ",")
+	}
+	s.chunked.add(upload)
+	s.owners.set(ownerKindChunkedUpload, id, currentUser(r))
+	s.touchRecent(currentUser(r), types.RecentUpload, req.TargetHost, req.TargetPath, upload.via)
+
+	w.Header().Set("Location", "/api/upload/"+id)
+	s.writeChunkedUpload(w, upload, http.StatusCreated)
+}
+
+// handleUploadChunk 在 Upload-Offset 处追加请求体 (PATCH /api/upload/{id})。
+// 偏移量必须等于已接收的字节数；请求中断时已写入的部分保留，客户端查询偏移量后继续
+func (s *Server) handleUploadChunk(w http.ResponseWriter, r *http.Request, upload *chunkedUpload) {
+	offset, err := strconv.ParseInt(r.Header.Get(uploadOffsetHeader), 10, 64)
+	if err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", uploadOffsetHeader, r.Header.Get(uploadOffsetHeader))
+		return
+	}
+
+	// 只在检查和更新状态时持锁，接收数据期间 HEAD 仍能返回已确认的偏移量
+	upload.mu.Lock()
+	switch {
+	case upload.done:
+		upload.mu.Unlock()
+		localizedError(w, r, http.StatusNotFound, "ERR_UPLOAD_NOT_FOUND")
+		return
+	case upload.writing:
+		upload.mu.Unlock()
+		localizedError(w, r, http.StatusLocked, "ERR_UPLOAD_BUSY")
+		return
+	case offset != upload.offset:
+		current := upload.offset
+		upload.mu.Unlock()
+		w.Header().Set(uploadOffsetHeader, strconv.FormatInt(current, 10))
+		localizedError(w, r, http.StatusConflict, "ERR_UPLOAD_OFFSET_MISMATCH", offset, current)
+		return
+	}
+	upload.writing = true
+	upload.mu.Unlock()
+
+	n, err := upload.write(offset, http.MaxBytesReader(w, r.Body, maxChunkSize))
+
+	upload.mu.Lock()
+	upload.offset += n
+	upload.updated = time.Now()
+	upload.writing = false
+	current := upload.offset
+	upload.mu.Unlock()
+
+	w.Header().Set(uploadOffsetHeader, strconv.FormatInt(current, 10))
+	switch {
+	case err == errChunkTooLarge:
+		localizedError(w, r, http.StatusRequestEntityTooLarge, "ERR_UPLOAD_TOO_LARGE", upload.size)
+	case err != nil:
+		failure(w, r, http.StatusBadRequest, "ERR_UPLOAD_CHUNK", err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// errChunkTooLarge 分块超出了创建时声明的文件大小
+var errChunkTooLarge = errors.New("chunk exceeds the declared upload size")
+
+// write 把 body 写到暂存文件的 offset 处，返回写入的字节数；出错时已写入的部分同样计入。
+// 超出声明大小的数据被截掉并返回 errChunkTooLarge
+func (u *chunkedUpload) write(offset int64, body io.Reader) (int64, error) {
+	f, err := os.OpenFile(filepath.Join(u.dir, u.fileName), os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// 多读一个字节以发现超出声明大小的数据
+	remaining := u.size - offset
+	n, err := io.Copy(f, io.LimitReader(body, remaining+1))
+	if n > remaining {
+		if err := f.Truncate(u.size); err != nil {
+			return 0, err
+		}
+		return remaining, errChunkTooLarge
+	}
+	return n, err
+}
+
+// handleCancelUpload 取消分块上传并删除已接收的数据 (DELETE /api/upload/{id})
+func (s *Server) handleCancelUpload(w http.ResponseWriter, r *http.Request, upload *chunkedUpload) {
+	upload.mu.Lock()
+	upload.done = true
+	upload.mu.Unlock()
+
+	s.chunked.remove(upload.id)
+	s.owners.remove(ownerKindChunkedUpload, upload.id)
+	s.staging.Remove(upload.dir)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCompleteUpload 全部数据到达后创建上传任务，经 SSH 链传输到目标主机
+// (POST /api/upload/{id}/complete)，之后与 POST /api/upload 一样用 task_id 查询进度
+func (s *Server) handleCompleteUpload(w http.ResponseWriter, r *http.Request, upload *chunkedUpload) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	upload.mu.Lock()
+	if upload.done {
+		upload.mu.Unlock()
+		localizedError(w, r, http.StatusNotFound, "ERR_UPLOAD_NOT_FOUND")
+		return
+	}
+	if upload.writing || upload.offset != upload.size {
+		offset := upload.offset
+		upload.mu.Unlock()
+		w.Header().Set(uploadOffsetHeader, strconv.FormatInt(offset, 10))
+		localizedError(w, r, http.StatusConflict, "ERR_UPLOAD_INCOMPLETE", offset, upload.size)
+		return
+	}
+	upload.mu.Unlock()
+
+	// diff=1 时覆盖已有文件前先返回 diff，数据留在暂存区，确认后带 force=1 再次完成
+	if !transfer.IsObjectURL(upload.targetPath) && wantsOverwriteDiff(r) &&
+		s.confirmUploadOverwrite(w, r, upload.dir, upload.targetHost, upload.targetPath, upload.via) {
+		return
+	}
+	// 被插件拒绝时数据同样留在暂存区，获批后可再次完成
+	taskID := fmt.Sprintf("upload-%d", time.Now().UnixNano())
+	if rejection := s.checkEvent(r, s.uploadEvent(taskID, upload.targetHost, upload.targetPath, upload.via)); rejection != nil {
+		pluginRejected(w, r, rejection)
+		return
+	}
+
+	upload.mu.Lock()
+	if upload.done {
+		upload.mu.Unlock()
+		localizedError(w, r, http.StatusNotFound, "ERR_UPLOAD_NOT_FOUND")
+		return
+	}
+	upload.done = true
+	upload.mu.Unlock()
+
+	s.chunked.remove(upload.id)
+	owner := currentUser(r)
+	if name := s.owners.owner(ownerKindChunkedUpload, upload.id); name != "" {
+		owner = &types.WebUser{Name: name}
+	}
+	s.owners.remove(ownerKindChunkedUpload, upload.id)
+
+	progress := &types.TransferProgress{
+		TaskID:     taskID,
+		FileName:   upload.fileName,
+		TotalBytes: upload.size,
+		Status:     "pending",
+		Timestamp:  time.Now(),
+		RequestID:  upload.requestID,
+	}
+	s.mu.Lock()
+	s.uploads[taskID] = progress
+	s.mu.Unlock()
+	s.owners.set(ownerKindUpload, taskID, owner)
+
+	go s.executeUpload(taskID, upload.dir, upload.targetHost, upload.targetPath, upload.via, upload.mode, false, upload.adaptive, upload.learned)
+
+	jsonResponse(w, http.StatusOK, map[string]string{"task_id": taskID})
+}
+
+// newUploadID 生成不可猜测的上传 ID
+func newUploadID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChunkedUpload(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+
+	do := func(method, path, token, offset, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if offset != "" {
+			req.Header.Set(uploadOffsetHeader, offset)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 目标不在配置中且没有可用的认证方式，完成后的传输很快失败
+	rec := do(http.MethodPost, "/api/upload/init", "bob-token", "", `{"file_name": "../dir/data.bin", "size": 10, "target_host": "127.0.0.1", "target_path": "/tmp"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("init: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var info ChunkedUploadInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.FileName != "data.bin" || info.Size != 10 || info.Offset != 0 {
+		t.Fatalf("init: %+v", info)
+	}
+	path := "/api/upload/" + info.ID
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		offset string
+		body   string
+		status int
+		after  string // 响应的 Upload-Offset
+		code   string
+	}{
+		{"init wrong method", http.MethodGet, "/api/upload/init", "bob-token", "", "", http.StatusMethodNotAllowed, "", ""},
+		{"init without target", http.MethodPost, "/api/upload/init", "bob-token", "", `{"file_name": "a", "size": 1}`, http.StatusBadRequest, "", "ERR_UPLOAD_TARGET_REQUIRED"},
+		{"init negative size", http.MethodPost, "/api/upload/init", "bob-token", "", `{"file_name": "a", "size": -1, "target_host": "h", "target_path": "/tmp"}`, http.StatusBadRequest, "", "ERR_INVALID_PARAM"},
+		{"init bad object target", http.MethodPost, "/api/upload/init", "bob-token", "", `{"file_name": "a", "size": 1, "target_host": "h", "target_path": "s3:///key"}`, http.StatusBadRequest, "", "ERR_INVALID_OBJECT_TARGET"},
+		{"init unknown mode", http.MethodPost, "/api/upload/init", "bob-token", "", `{"file_name": "a", "size": 1, "target_host": "h", "target_path": "/tmp", "mode": "pipeline"}`, http.StatusBadRequest, "", "ERR_INVALID_UPLOAD_MODE"},
+		{"init relay to object storage", http.MethodPost, "/api/upload/init", "bob-token", "", `{"file_name": "a", "size": 1, "target_host": "h", "target_path": "s3://bucket/key", "mode": "relay"}`, http.StatusBadRequest, "", "ERR_INVALID_UPLOAD_MODE"},
+		{"unknown upload", http.MethodHead, "/api/upload/missing", "bob-token", "", "", http.StatusNotFound, "", ""},
+		{"other user", http.MethodGet, path, "carol-token", "", "", http.StatusNotFound, "", "ERR_UPLOAD_NOT_FOUND"},
+		{"first chunk", http.MethodPatch, path, "bob-token", "0", "hello", http.StatusNoContent, "5", ""},
+		{"missing offset", http.MethodPatch, path, "bob-token", "", "x", http.StatusBadRequest, "", "ERR_INVALID_PARAM"},
+		{"stale offset", http.MethodPatch, path, "bob-token", "0", "hello", http.StatusConflict, "5", "ERR_UPLOAD_OFFSET_MISMATCH"},
+		{"head", http.MethodHead, path, "bob-token", "", "", http.StatusOK, "5", ""},
+		{"admin can see", http.MethodGet, path, "alice-token", "", "", http.StatusOK, "5", ""},
+		{"complete too early", http.MethodPost, path + "/complete", "bob-token", "", "", http.StatusConflict, "5", "ERR_UPLOAD_INCOMPLETE"},
+		{"too large", http.MethodPatch, path, "bob-token", "5", "world!!", http.StatusRequestEntityTooLarge, "10", "ERR_UPLOAD_TOO_LARGE"},
+		{"complete wrong method", http.MethodGet, path + "/complete", "bob-token", "", "", http.StatusMethodNotAllowed, "", ""},
+		// 读取远端文件失败时不开始传输，上传仍可再次完成
+		{"diff without a connection", http.MethodPost, path + "/complete?diff=1", "bob-token", "", "", http.StatusBadGateway, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.method, tt.path, tt.token, tt.offset, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if got := rec.Header().Get(uploadOffsetHeader); tt.after != "" && got != tt.after {
+				t.Errorf("Upload-Offset = %q, want %q", got, tt.after)
+			}
+			if tt.code == "" {
+				return
+			}
+			var resp map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if resp["code"] != tt.code {
+				t.Errorf("code = %q, want %q", resp["code"], tt.code)
+			}
+		})
+	}
+
+	upload := server.chunked.get(info.ID)
+	data, err := os.ReadFile(filepath.Join(upload.dir, upload.fileName))
+	if err != nil || string(data) != "helloworld" {
+		t.Fatalf("staged file = %q, err = %v", data, err)
+	}
+
+	rec = do(http.MethodPost, path+"/complete", "bob-token", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("complete: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec := do(http.MethodHead, path, "bob-token", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("upload still present after complete: %d", rec.Code)
+	}
+
+	// 完成后与普通上传一样按 task_id 查询，归属仍是创建者
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		rec := do(http.MethodGet, "/api/uploads/"+resp["task_id"], "bob-token", "", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("task: expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if strings.Contains(rec.Body.String(), `"failed"`) || strings.Contains(rec.Body.String(), `"completed"`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("upload task did not finish: %s", rec.Body.String())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestExpireChunkedUploads(t *testing.T) {
+	server, _ := newAuthTestServer(t)
+	dir, err := server.staging.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.chunked.add(&chunkedUpload{id: "old", dir: dir, updated: time.Now().Add(-2 * server.chunkedUploadTTL())})
+	server.chunked.add(&chunkedUpload{id: "new", updated: time.Now()})
+
+	server.expireChunkedUploads()
+	if server.chunked.get("old") != nil || server.chunked.get("new") == nil {
+		t.Error("expected only the idle upload to expire")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("staging dir left behind: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// CloneServerRequest 复制服务器的请求，未填写的字段沿用原服务器
+type CloneServerRequest struct {
+	Name string `json:"name"`
+	Host string `json:"host,omitempty"`
+	Port int    `json:"port,omitempty"`
+	User string `json:"user,omitempty"`
+}
+
+// handleCloneServer 以新名称和地址复制服务器的认证、网关、标签和终端设置 (POST /api/servers/{id}/clone)
+func (s *Server) handleCloneServer(w http.ResponseWriter, r *http.Request, hop *types.Hop) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	var req CloneServerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	if req.Name == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_CLONE_NAME_REQUIRED")
+		return
+	}
+	if req.Port < 0 || req.Port > 65535 {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PORT")
+		return
+	}
+
+	clone := hop.Clone(req.Name, req.Host)
+	if req.Port != 0 {
+		clone.Port = req.Port
+	}
+	if req.User != "" {
+		clone.User = req.User
+	}
+	if err := s.manager.AddHop(clone); err != nil {
+		failure(w, r, http.StatusConflict, "ERR_ALREADY_EXISTS", err)
+		return
+	}
+	jsonResponse(w, http.StatusCreated, serverResponse(clone))
+}
+
+// handleServerDefaults GET 查看、PUT（仅管理员）设置添加服务器时的默认用户、端口和密钥路径
+// (/api/servers/defaults)
+func (s *Server) handleServerDefaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		jsonResponse(w, http.StatusOK, s.config.ServerDefaults)
+	case http.MethodPut:
+		if !requireAdmin(w, r) {
+			return
+		}
+		var defaults types.HopDefaults
+		if err := json.NewDecoder(r.Body).Decode(&defaults); err != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+			return
+		}
+		if defaults.Port < 0 || defaults.Port > 65535 {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PORT")
+			return
+		}
+		s.config.ServerDefaults = defaults
+		if err := s.manager.Save(); err != nil {
+			failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
+			return
+		}
+		jsonResponse(w, http.StatusOK, defaults)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestCloneServer(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	source := server.config.GetHopByID("hop-1")
+	source.Tags = []string{"web"}
+	source.TerminalPreset = "ops"
+	source.LastCheck = &types.HealthCheck{OK: true}
+
+	do := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/servers/hop-1/clone", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("bob-token", `{"name": "web-2"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("user clone: expected 403, got %d", rec.Code)
+	}
+	if rec := do("alice-token", `{"host": "10.0.0.2"}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "ERR_CLONE_NAME_REQUIRED") {
+		t.Errorf("clone without name: expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := do("alice-token", `{"name": "web-2", "host": "10.0.0.2"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("clone: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var clone types.Hop
+	json.Unmarshal(rec.Body.Bytes(), &clone)
+	if clone.ID == "" || clone.ID == source.ID || clone.Host != "10.0.0.2" || clone.User != source.User || clone.TerminalPreset != "ops" || clone.LastCheck != nil {
+		t.Errorf("unexpected clone: %+v", clone)
+	}
+	saved := server.config.GetHopByName("web-2")
+	saved.Tags[0] = "changed"
+	if source.Tags[0] != "web" {
+		t.Error("clone shares tags with the source")
+	}
+}
+
+func TestServerDefaults(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	do := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPut, "/api/servers/defaults", "bob-token", `{"user": "ops"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("user update: expected 403, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/api/servers/defaults", "alice-token", `{"port": 70000}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid port: expected 400, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/api/servers/defaults", "alice-token", `{"user": "ops", "port": 2222, "key_path": "~/.ssh/fleet"}`); rec.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := do(http.MethodPost, "/api/servers", "alice-token", `{"name": "app-1", "host": "10.0.0.5", "auth_type": "key"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("add with defaults: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	hop := server.config.GetHopByName("app-1")
+	if hop.User != "ops" || hop.Port != 2222 || hop.KeyPath != "~/.ssh/fleet" {
+		t.Errorf("defaults not applied: %+v", hop)
+	}
+
+	// 请求中填写的值优先
+	do(http.MethodPost, "/api/servers", "alice-token", `{"name": "app-2", "host": "10.0.0.6", "user": "root", "port": 22, "auth_type": "password", "password": "x"}`)
+	if hop := server.config.GetHopByName("app-2"); hop == nil || hop.User != "root" || hop.Port != 22 || hop.KeyPath != "" {
+		t.Errorf("explicit values overridden: %+v", hop)
+	}
+}
+
+func TestAddServerWithAddress(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	add := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/servers", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer alice-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := add(`{"address": "deploy@app.internal.example.com:2222", "auth_type": "key", "gateway_id": "hop-1"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var hop types.Hop
+	json.Unmarshal(rec.Body.Bytes(), &hop)
+	if hop.Name != "app" || hop.User != "deploy" || hop.Host != "app.internal.example.com" || hop.Port != 2222 || hop.ServerType != types.ServerInternal {
+		t.Errorf("unexpected server: %+v", hop)
+	}
+
+	// 同名时追加序号，单独填写的字段优先
+	json.Unmarshal(add(`{"address": "deploy@app.other.example.com", "user": "root", "auth_type": "key"}`).Body.Bytes(), &hop)
+	if hop.Name != "app-2" || hop.User != "root" || hop.Port != 22 {
+		t.Errorf("unexpected second server: %+v", hop)
+	}
+
+	if rec := add(`{"address": "root@host:99999", "auth_type": "key"}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "ERR_INVALID_ADDRESS") {
+		t.Errorf("invalid address: expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if n := len(server.config.Hops); n != 3 {
+		t.Errorf("%d servers, want 3", n)
+	}
+}
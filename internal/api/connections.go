@@ -0,0 +1,162 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// 连接类型
+const (
+	connKindProxy    = "proxy"
+	connKindPortal   = "portal"
+	connKindTerminal = "terminal"
+)
+
+// ConnectionInfo 一个活动连接：代理转发的连接、Portal 映射转发的连接或 Web 终端会话
+type ConnectionInfo struct {
+	ID          string    `json:"id"` // proxy:<代理ID>:<编号>、portal:<映射ID>:<编号> 或 terminal:<会话ID>
+	Kind        string    `json:"kind"`
+	Parent      string    `json:"parent"` // 所属的代理 ID、映射 ID 或会话 ID
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	BytesIn     int64     `json:"bytes_in"`  // 从客户端发往目标的字节数
+	BytesOut    int64     `json:"bytes_out"` // 从目标发回客户端的字节数
+	StartedAt   time.Time `json:"started_at"`
+	AgeSeconds  int64     `json:"age_seconds"`
+	Owner       string    `json:"owner,omitempty"`
+}
+
+// handleConnections 列出当前用户可见的活动连接（管理员可见全部），按开始时间排序
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	conns := s.visibleConnections(currentUser(r))
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].StartedAt.Before(conns[j].StartedAt)
+	})
+	jsonResponse(w, http.StatusOK, conns)
+}
+
+// visibleConnections 收集 user 可见的连接。代理和终端按归属过滤；
+// Portal 映射由管理员维护，其连接只对管理员可见
+func (s *Server) visibleConnections(user *types.WebUser) []ConnectionInfo {
+	now := time.Now()
+	conns := make([]ConnectionInfo, 0)
+	addForwarder := func(kind, parent, owner string, fwd *proxy.PortForwarder) {
+		for _, c := range fwd.Connections() {
+			conns = append(conns, ConnectionInfo{
+				ID:          kind + ":" + parent + ":" + strconv.FormatUint(c.ID, 10),
+				Kind:        kind,
+				Parent:      parent,
+				Source:      c.Source,
+				Destination: c.Destination,
+				BytesIn:     c.BytesIn,
+				BytesOut:    c.BytesOut,
+				StartedAt:   c.StartedAt,
+				AgeSeconds:  int64(now.Sub(c.StartedAt).Seconds()),
+				Owner:       owner,
+			})
+		}
+	}
+
+	for id, fwd := range s.proxies.List() {
+		if s.owners.canAccess(user, ownerKindProxy, id) {
+			addForwarder(connKindProxy, id, s.owners.owner(ownerKindProxy, id), fwd)
+		}
+	}
+
+	if user.IsAdmin() {
+		s.portalMu.RLock()
+		for id, fwd := range s.portalForwarders {
+			addForwarder(connKindPortal, id, "", fwd)
+		}
+		s.portalMu.RUnlock()
+	}
+
+	s.terminalsMu.RLock()
+	for id, entry := range s.terminals {
+		if !s.owners.canAccess(user, ownerKindSession, id) {
+			continue
+		}
+		conns = append(conns, ConnectionInfo{
+			ID:          connKindTerminal + ":" + id,
+			Kind:        connKindTerminal,
+			Parent:      id,
+			Source:      entry.source,
+			Destination: entry.info.Server,
+			BytesIn:     entry.bytesIn.Load(),
+			BytesOut:    entry.bytesOut.Load(),
+			StartedAt:   entry.info.StartedAt,
+			AgeSeconds:  int64(now.Sub(entry.info.StartedAt).Seconds()),
+			Owner:       entry.info.Owner,
+		})
+	}
+	s.terminalsMu.RUnlock()
+
+	return conns
+}
+
+// handleConnectionDetail 断开指定连接 (DELETE /api/connections/{id})，
+// 只断开这一条连接，所属的代理或映射继续运行；终端连接即关闭该会话
+func (s *Server) handleConnectionDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/connections/")
+	if !s.closeConnection(currentUser(r), id) {
+		// 其他用户的连接视为不存在
+		localizedError(w, r, http.StatusNotFound, "ERR_CONNECTION_NOT_FOUND", id)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"status": "closed"})
+}
+
+// closeConnection 断开 user 可见的一条连接，连接不存在或无权访问时返回 false
+func (s *Server) closeConnection(user *types.WebUser, id string) bool {
+	kind, rest, _ := strings.Cut(id, ":")
+	if kind == connKindTerminal {
+		s.terminalsMu.RLock()
+		entry, exists := s.terminals[rest]
+		s.terminalsMu.RUnlock()
+		if !exists || !s.owners.canAccess(user, ownerKindSession, rest) {
+			return false
+		}
+		entry.close()
+		return true
+	}
+
+	// 代理和映射 ID 本身可能含冒号，编号取最后一段
+	sep := strings.LastIndexByte(rest, ':')
+	if sep < 0 {
+		return false
+	}
+	parent := rest[:sep]
+	num, err := strconv.ParseUint(rest[sep+1:], 10, 64)
+	if err != nil {
+		return false
+	}
+
+	var fwd *proxy.PortForwarder
+	switch kind {
+	case connKindProxy:
+		if s.owners.canAccess(user, ownerKindProxy, parent) {
+			fwd = s.proxies.Get(parent)
+		}
+	case connKindPortal:
+		if user.IsAdmin() {
+			s.portalMu.RLock()
+			fwd = s.portalForwarders[parent]
+			s.portalMu.RUnlock()
+		}
+	}
+	return fwd != nil && fwd.CloseConnection(num)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConnectionsListAndClose(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+
+	closed := false
+	bobSession := server.registerTerminal(server.lookupUser("bob-token"), "web-1", nil, func() { closed = true })
+	entry := server.trackTerminal(bobSession, "192.0.2.10:51000", nil)
+	entry.bytesIn.Add(12)
+	entry.bytesOut.Add(3400)
+	server.registerTerminal(server.lookupUser("carol-token"), "web-2", nil, func() {})
+
+	do := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	list := func(token string) []ConnectionInfo {
+		rec := do(http.MethodGet, "/api/connections", token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET: expected 200, got %d", rec.Code)
+		}
+		var conns []ConnectionInfo
+		if err := json.Unmarshal(rec.Body.Bytes(), &conns); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		return conns
+	}
+
+	conns := list("bob-token")
+	if len(conns) != 1 {
+		t.Fatalf("bob should only see own connection, got %+v", conns)
+	}
+	c := conns[0]
+	if c.ID != "terminal:"+bobSession || c.Kind != "terminal" || c.Source != "192.0.2.10:51000" ||
+		c.Destination != "web-1" || c.BytesIn != 12 || c.BytesOut != 3400 || c.Owner != "bob" {
+		t.Errorf("unexpected connection: %+v", c)
+	}
+	if n := len(list("alice-token")); n != 2 {
+		t.Errorf("admin should see all connections, got %d", n)
+	}
+
+	// 其他用户的连接视为不存在
+	if rec := do(http.MethodDelete, "/api/connections/terminal:"+bobSession, "carol-token"); rec.Code != http.StatusNotFound || closed {
+		t.Fatalf("carol closing bob's connection: expected 404, got %d (closed=%v)", rec.Code, closed)
+	}
+	for _, id := range []string{"proxy:p1:1", "portal:m1:x", "bogus"} {
+		if rec := do(http.MethodDelete, "/api/connections/"+id, "alice-token"); rec.Code != http.StatusNotFound {
+			t.Errorf("DELETE %s: expected 404, got %d", id, rec.Code)
+		}
+	}
+	if rec := do(http.MethodDelete, "/api/connections/terminal:"+bobSession, "bob-token"); rec.Code != http.StatusOK || !closed {
+		t.Fatalf("bob closing own connection: expected 200, got %d (closed=%v)", rec.Code, closed)
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// csrfCookieName 登录时随会话 Cookie 一起下发，前端可读取（非 HttpOnly）
+	csrfCookieName = "gmssh_csrf"
+	// csrfHeaderName 使用 Cookie 认证的修改请求必须在此请求头中回传 CSRF 令牌
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// safeMethod 不修改状态的请求方法
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// originAllowed 检查请求来源是否可信
+// 没有 Origin 头的请求（CLI、curl 等非浏览器客户端）不受限制；同源请求总是允许
+func (s *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false // 包括 "null"（沙箱 iframe、file://）
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	if len(s.config.Web.AllowedOrigins) == 0 {
+		return isLoopbackHost(u.Hostname())
+	}
+	for _, allowed := range s.config.Web.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLoopbackHost 判断主机名是否指向本机
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// corsMiddleware CORS 中间件：只对可信来源返回跨域响应头，拒绝来自其他来源的修改请求
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		allowed := s.originAllowed(r)
+		if origin := r.Header.Get("Origin"); origin != "" && allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Auth-Token, "+csrfHeaderName+", "+requestIDHeader+", "+uploadOffsetHeader+", "+confirmServerHeader)
+			w.Header().Set("Access-Control-Expose-Headers", requestIDHeader+", "+uploadOffsetHeader+", "+uploadLengthHeader+", Location")
+		}
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if !allowed && !safeMethod(r.Method) {
+			localizedError(w, r, http.StatusForbidden, "ERR_ORIGIN_NOT_ALLOWED")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cookieAuthenticated 请求是否仅依靠会话 Cookie 认证（浏览器会自动附带，因此需要 CSRF 防护）
+func cookieAuthenticated(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") || r.Header.Get("X-Auth-Token") != "" {
+		return false
+	}
+	c, err := r.Cookie(authCookieName)
+	return err == nil && c.Value != ""
+}
+
+// csrfMiddleware 校验 Cookie 认证的修改请求携带的 CSRF 令牌（双重提交 Cookie）
+func (s *Server) csrfMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authEnabled() || safeMethod(r.Method) || !cookieAuthenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		c, err := r.Cookie(csrfCookieName)
+		header := r.Header.Get(csrfHeaderName)
+		if err != nil || c.Value == "" || subtle.ConstantTimeCompare([]byte(c.Value), []byte(header)) != 1 {
+			localizedError(w, r, http.StatusForbidden, "ERR_CSRF_INVALID")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setCSRFCookie 下发新的 CSRF 令牌
+func setCSRFCookie(w http.ResponseWriter, r *http.Request) error {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    hex.EncodeToString(buf),
+		Path:     "/",
+		SameSite: http.SameSiteStrictMode,
+		Secure:   r.TLS != nil,
+	})
+	return nil
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOriginChecks(t *testing.T) {
+	server, _ := newAuthTestServer(t)
+	handler := server.corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name       string
+		allowed    []string
+		method     string
+		origin     string
+		wantStatus int
+		wantCORS   bool
+	}{
+		{"no origin (cli)", nil, http.MethodPost, "", http.StatusNoContent, false},
+		{"same origin", nil, http.MethodPost, "http://example.com", http.StatusNoContent, true},
+		{"loopback by default", nil, http.MethodPost, "http://localhost:18080", http.StatusNoContent, true},
+		{"foreign post", nil, http.MethodPost, "https://evil.test", http.StatusForbidden, false},
+		{"foreign get", nil, http.MethodGet, "https://evil.test", http.StatusNoContent, false},
+		{"null origin", nil, http.MethodDelete, "null", http.StatusForbidden, false},
+		{"configured origin", []string{"https://ops.example.org/"}, http.MethodPut, "https://ops.example.org", http.StatusNoContent, true},
+		{"loopback not implied when configured", []string{"https://ops.example.org"}, http.MethodPost, "http://127.0.0.1:3000", http.StatusForbidden, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.config.Web.AllowedOrigins = tt.allowed
+			req := httptest.NewRequest(tt.method, "http://example.com/api/servers", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin") != ""; got != tt.wantCORS {
+				t.Errorf("CORS headers present = %v, want %v", got, tt.wantCORS)
+			}
+			if rec.Header().Get("Access-Control-Allow-Origin") == "*" {
+				t.Error("wildcard origin must not be returned")
+			}
+		})
+	}
+}
+
+func TestCSRFForCookieSessions(t *testing.T) {
+	server, _ := newAuthTestServer(t)
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	handler := server.corsMiddleware(server.authMiddleware(server.csrfMiddleware(mux)))
+
+	// 登录获取会话 Cookie 和 CSRF Cookie
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"token":"alice-token"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var session, csrf *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		switch c.Name {
+		case authCookieName:
+			session = c
+		case csrfCookieName:
+			csrf = c
+		}
+	}
+	if session == nil || csrf == nil || csrf.Value == "" || csrf.HttpOnly {
+		t.Fatalf("expected session and readable CSRF cookies, got %v", rec.Result().Cookies())
+	}
+
+	tests := []struct {
+		name       string
+		useCookie  bool
+		bearer     string
+		csrfHeader string
+		wantStatus int
+	}{
+		{"cookie without csrf header", true, "", "", http.StatusForbidden},
+		{"cookie with wrong csrf header", true, "", "wrong", http.StatusForbidden},
+		{"cookie with csrf header", true, "", csrf.Value, http.StatusBadRequest},
+		{"bearer token needs no csrf", false, "alice-token", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 空请求体：通过校验后由 handler 返回 400
+			req := httptest.NewRequest(http.MethodPost, "/api/servers", strings.NewReader("{}"))
+			if tt.useCookie {
+				req.AddCookie(session)
+				req.AddCookie(csrf)
+			}
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			if tt.csrfHeader != "" {
+				req.Header.Set(csrfHeaderName, tt.csrfHeader)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/ssh"
+)
+
+// RuntimeDiagnostics 运行时诊断信息，用于在不重启的情况下排查卡住的连接和泄漏的 goroutine
+type RuntimeDiagnostics struct {
+	StartedAt      time.Time        `json:"started_at"`
+	UptimeSeconds  float64          `json:"uptime_seconds"`
+	Goroutines     int              `json:"goroutines"`
+	HeapAllocBytes uint64           `json:"heap_alloc_bytes"`
+	SysBytes       uint64           `json:"sys_bytes"`
+	NumGC          uint32           `json:"num_gc"`
+	Items          []DiagnosticItem `json:"items"` // 按存活时间从长到短
+}
+
+// DiagnosticItem 一个存活的运行时对象
+type DiagnosticItem struct {
+	Kind       string    `json:"kind"` // chain | session | proxy | portal | upload
+	ID         string    `json:"id,omitempty"`
+	Detail     string    `json:"detail"`
+	StartedAt  time.Time `json:"started_at"`
+	AgeSeconds float64   `json:"age_seconds"`
+}
+
+// registerDebugRoutes 注册 pprof 和运行时诊断端点，均仅限管理员
+func (s *Server) registerDebugRoutes(mux *http.ServeMux) {
+	mux.Handle("/debug/pprof/", adminOnly(http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", adminOnly(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", adminOnly(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", adminOnly(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", adminOnly(http.HandlerFunc(pprof.Trace)))
+
+	mux.HandleFunc("/api/debug/runtime", s.handleDebugRuntime)
+}
+
+// adminOnly 包装仅管理员可访问的处理器
+func adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireAdmin(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleDebugRuntime 返回 goroutine、内存和存活的链路/会话/转发/上传（带存活时间）
+func (s *Server) handleDebugRuntime(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.runtimeDiagnostics())
+}
+
+// runtimeDiagnostics 采集诊断信息
+func (s *Server) runtimeDiagnostics() *RuntimeDiagnostics {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	now := time.Now()
+	diag := &RuntimeDiagnostics{
+		StartedAt:      s.startedAt,
+		UptimeSeconds:  now.Sub(s.startedAt).Seconds(),
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: mem.HeapAlloc,
+		SysBytes:       mem.Sys,
+		NumGC:          mem.NumGC,
+		Items:          make([]DiagnosticItem, 0),
+	}
+	add := func(kind, id, detail string, startedAt time.Time) {
+		diag.Items = append(diag.Items, DiagnosticItem{
+			Kind:       kind,
+			ID:         id,
+			Detail:     detail,
+			StartedAt:  startedAt,
+			AgeSeconds: now.Sub(startedAt).Seconds(),
+		})
+	}
+
+	for _, chain := range ssh.ActiveChains() {
+		add("chain", "", strings.Join(chain.Hops, " -> "), chain.ConnectedAt)
+	}
+
+	s.terminalsMu.RLock()
+	for id, entry := range s.terminals {
+		add("session", id, entry.info.Server+" ("+entry.info.Owner+")", entry.info.StartedAt)
+	}
+	s.terminalsMu.RUnlock()
+
+	for id, fwd := range s.proxies.List() {
+		info := fwd.GetInfo(id)
+		add("proxy", id, proxyDetail(info.LocalAddr, info.RemoteHost, info.RemotePort, info.ConnectionCount), info.StartedAt)
+	}
+
+	s.portalMu.RLock()
+	for id, fwd := range s.portalForwarders {
+		info := fwd.GetInfo(id)
+		add("portal", id, proxyDetail(info.LocalAddr, info.RemoteHost, info.RemotePort, info.ConnectionCount), info.StartedAt)
+	}
+	s.portalMu.RUnlock()
+
+	s.mu.RLock()
+	for id, progress := range s.uploads {
+		if progress.Status == "pending" || progress.Status == "running" {
+			add("upload", id, progress.FileName+" ("+progress.Status+")", progress.Timestamp)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(diag.Items, func(i, j int) bool { return diag.Items[i].StartedAt.Before(diag.Items[j].StartedAt) })
+	return diag
+}
+
+// proxyDetail 转发器的简要描述
+func proxyDetail(localAddr, remoteHost string, remotePort, connections int) string {
+	return fmt.Sprintf("%s -> %s:%d, %d conn(s)", localAddr, remoteHost, remotePort, connections)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugEndpoints(t *testing.T) {
+	server, disabled := newAuthTestServer(t)
+
+	server.config.Web.DebugEndpoints = true
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	enabled := server.authMiddleware(mux)
+
+	tests := []struct {
+		name       string
+		handler    http.Handler
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{"disabled by default", disabled, "/api/debug/runtime", "alice-token", http.StatusNotFound},
+		{"pprof disabled by default", disabled, "/debug/pprof/", "alice-token", http.StatusNotFound},
+		{"requires auth", enabled, "/debug/pprof/", "", http.StatusUnauthorized},
+		{"user cannot read runtime", enabled, "/api/debug/runtime", "bob-token", http.StatusForbidden},
+		{"user cannot read pprof", enabled, "/debug/pprof/goroutine", "bob-token", http.StatusForbidden},
+		{"admin reads pprof index", enabled, "/debug/pprof/", "alice-token", http.StatusOK},
+		{"admin reads runtime", enabled, "/api/debug/runtime", "alice-token", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDebugRuntimeResponse(t *testing.T) {
+	server, _ := newAuthTestServer(t)
+	server.config.Web.DebugEndpoints = true
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/debug/runtime", nil)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	rec := httptest.NewRecorder()
+	server.authMiddleware(mux).ServeHTTP(rec, req)
+
+	var diag RuntimeDiagnostics
+	if err := json.NewDecoder(rec.Body).Decode(&diag); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if diag.Goroutines <= 0 || diag.UptimeSeconds < 0 {
+		t.Errorf("unexpected diagnostics: %+v", diag)
+	}
+	if diag.Items == nil {
+		t.Error("items should be an empty list, not null")
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/profiler"
+)
+
+const (
+	// traceTimeout 整条链路追踪的最长时间
+	traceTimeout = 2 * time.Minute
+	// tcpingTimeout 端口检查（含建立跳板链）的最长时间
+	tcpingTimeout = time.Minute
+)
+
+// TraceRequest 路由追踪请求
+type TraceRequest struct {
+	Target string   `json:"target"`
+	Via    []string `json:"via,omitempty"` // 服务器 ID 列表，为空时使用目标的网关链
+}
+
+// handleTrace 沿跳板链逐段追踪路由，与 gmssh trace 相同
+func (s *Server) handleTrace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TraceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	if req.Target == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_TARGET_REQUIRED")
+		return
+	}
+
+	targetHop := s.probeTarget(req.Target)
+	hops, unknown := s.probeVia(req.Via)
+	if unknown != "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_UNKNOWN_HOP", unknown)
+		return
+	}
+	if len(hops) == 0 {
+		hops = s.config.GatewayChain(targetHop)
+	} else {
+		hops = append(hops, targetHop)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), traceTimeout)
+	defer cancel()
+
+	jsonResponse(w, http.StatusOK, profiler.Trace(ctx, hops))
+}
+
+// TCPingRequest 端口检查请求
+type TCPingRequest struct {
+	Target string   `json:"target"` // 服务器 ID、名称或任意主机地址
+	Port   int      `json:"port"`
+	Via    []string `json:"via,omitempty"`   // 服务器 ID 列表，为空且目标在配置中时使用目标的网关链
+	Count  int      `json:"count,omitempty"` // 连接次数，默认 3
+}
+
+// handleTCPing 经跳板链最后一跳连接 target:port，与 gmssh probe --port 相同
+func (s *Server) handleTCPing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TCPingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	if req.Target == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_TARGET_REQUIRED")
+		return
+	}
+	if req.Port <= 0 || req.Port > 65535 {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PORT")
+		return
+	}
+
+	targetHop := s.probeTarget(req.Target)
+	hops, unknown := s.probeVia(req.Via)
+	if unknown != "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_UNKNOWN_HOP", unknown)
+		return
+	}
+	if len(req.Via) == 0 && targetHop.ID != "" {
+		chain := s.config.GatewayChain(targetHop)
+		hops = chain[:len(chain)-1]
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), tcpingTimeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(targetHop.Host, strconv.Itoa(req.Port))
+	jsonResponse(w, http.StatusOK, profiler.TCPing(ctx, hops, addr, req.Count))
+}
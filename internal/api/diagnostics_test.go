@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTraceValidation(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+		code   string
+	}{
+		{"wrong method", http.MethodGet, "", http.StatusMethodNotAllowed, ""},
+		{"invalid body", http.MethodPost, "{", http.StatusBadRequest, "ERR_INVALID_BODY"},
+		{"missing target", http.MethodPost, `{}`, http.StatusBadRequest, "ERR_TARGET_REQUIRED"},
+		{"unknown via", http.MethodPost, `{"target": "hop-1", "via": ["missing-hop"]}`, http.StatusBadRequest, "ERR_UNKNOWN_HOP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/diagnostics/trace", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer alice-token")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.code == "" {
+				return
+			}
+			var resp map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if resp["code"] != tt.code {
+				t.Errorf("code = %q, want %q", resp["code"], tt.code)
+			}
+		})
+	}
+}
+
+func TestTCPingValidation(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"missing target", `{"port": 3306}`, http.StatusBadRequest, "ERR_TARGET_REQUIRED"},
+		{"missing port", `{"target": "hop-1"}`, http.StatusBadRequest, "ERR_INVALID_PORT"},
+		{"port out of range", `{"target": "hop-1", "port": 70000}`, http.StatusBadRequest, "ERR_INVALID_PORT"},
+		{"unknown via", `{"target": "hop-1", "port": 3306, "via": ["missing-hop"]}`, http.StatusBadRequest, "ERR_UNKNOWN_HOP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/diagnostics/tcping", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer alice-token")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			var resp map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if resp["code"] != tt.code {
+				t.Errorf("code = %q, want %q", resp["code"], tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/luobobo896/HSSH/internal/resolver"
+)
+
+// DNSCacheResponse 解析缓存的内容
+type DNSCacheResponse struct {
+	Stats   resolver.Stats   `json:"stats"`
+	Entries []resolver.Entry `json:"entries"`
+}
+
+// handleDNSCache GET 列出代理、Portal 映射和 SSH 链共用的解析缓存，DELETE 清除（?host= 只清除该主机，仅管理员）
+func (s *Server) handleDNSCache(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		entries := resolver.Default.Entries()
+		if entries == nil {
+			entries = []resolver.Entry{}
+		}
+		jsonResponse(w, http.StatusOK, DNSCacheResponse{Stats: resolver.Default.Stats(), Entries: entries})
+
+	case http.MethodDelete:
+		if !requireAdmin(w, r) {
+			return
+		}
+		host := r.URL.Query().Get("host")
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"flushed": resolver.Default.Flush(host),
+		})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/resolver"
+)
+
+func TestDNSCacheListAndFlush(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+	resolver.Default.Flush("")
+	t.Cleanup(func() { resolver.Default.Flush("") })
+	// 成功或失败都会缓存一条记录
+	resolver.Default.Lookup(context.Background(), "", "localhost", resolver.Mode{Kind: resolver.KindSystem}, nil)
+
+	do := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/api/dns/cache", "bob-token")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET: expected 200, got %d", rec.Code)
+	}
+	var resp DNSCacheResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(resp.Entries) != 1 || resp.Entries[0].Host != "localhost" || resp.Entries[0].Resolver != "system" {
+		t.Errorf("unexpected entries: %+v", resp.Entries)
+	}
+
+	if rec := do(http.MethodDelete, "/api/dns/cache", "bob-token"); rec.Code != http.StatusForbidden {
+		t.Errorf("user flush: expected 403, got %d", rec.Code)
+	}
+	rec = do(http.MethodDelete, "/api/dns/cache?host=localhost", "alice-token")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin flush: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var flushed struct{ Flushed int }
+	json.Unmarshal(rec.Body.Bytes(), &flushed)
+	if flushed.Flushed != 1 || len(resolver.Default.Entries()) != 0 {
+		t.Errorf("flushed = %d, entries left: %v", flushed.Flushed, resolver.Default.Entries())
+	}
+}
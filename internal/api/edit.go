@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/remotefile"
+	"github.com/luobobo896/HSSH/pkg/types"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// editTimeout 读取或写回文件（含建立跳板链）的最长时间
+const editTimeout = 30 * time.Second
+
+// EditFile 在线编辑的远程文件
+type EditFile struct {
+	Server   string `json:"server"`
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	Checksum string `json:"checksum"` // 内容的 sha256，写回时原样提交
+	Size     int    `json:"size"`
+}
+
+// EditSaveRequest 写回请求
+type EditSaveRequest struct {
+	Content  string `json:"content"`
+	Checksum string `json:"checksum"` // 读取时返回的 checksum，为空表示新建文件
+}
+
+// handleEdit 网页内编辑远程文本文件 (/api/edit?server=...&path=...)：
+// GET 返回内容和 sha256；PUT 先写入同目录的临时文件，只有远端文件的 sha256 仍与提交的 checksum 相同时才 rename 替换，
+// 否则返回 409 ERR_EDIT_CONFLICT，客户端需重新读取
+func (s *Server) handleEdit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	path := q.Get("path")
+	hop, hops := s.remoteFileHops(w, r, q.Get("server"), path)
+	if hop == nil {
+		return
+	}
+
+	var req EditSaveRequest
+	if r.Method == http.MethodPut {
+		if !s.checkMaintenance(w, r, hop.ID) || !s.confirmEnvironment(w, r, hop, types.OpUpload) {
+			return
+		}
+		// JSON 转义后的内容可能比原文长数倍
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8*remotefile.MaxEditSize)).Decode(&req); err != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+			return
+		}
+		if len(req.Content) > remotefile.MaxEditSize {
+			localizedError(w, r, http.StatusRequestEntityTooLarge, "ERR_EDIT_TOO_LARGE", remotefile.MaxEditSize)
+			return
+		}
+		if remotefile.CheckText([]byte(req.Content)) != nil {
+			localizedError(w, r, http.StatusUnsupportedMediaType, "ERR_EDIT_BINARY")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), editTimeout)
+	defer cancel()
+
+	if r.Method == http.MethodPut {
+		// diff=1 时先返回远端现有内容到提交内容的 diff，确认后带 force=1 再次保存
+		if wantsOverwriteDiff(r) && s.confirmOverwrite(ctx, w, r, hops, path, []byte(req.Content), false) {
+			return
+		}
+		if _, err := s.runOnChainInput(ctx, hops, remotefile.WriteCommand(path, req.Checksum), strings.NewReader(req.Content)); err != nil {
+			editFailed(w, r, err)
+			return
+		}
+		jsonResponse(w, http.StatusOK, EditFile{
+			Server:   hop.Name,
+			Path:     path,
+			Content:  req.Content,
+			Checksum: remotefile.Checksum([]byte(req.Content)),
+			Size:     len(req.Content),
+		})
+		return
+	}
+
+	out, err := s.runOnChain(ctx, hops, remotefile.ReadCommand(path, remotefile.MaxEditSize))
+	if err != nil {
+		editFailed(w, r, err)
+		return
+	}
+	if len(out) > remotefile.MaxEditSize {
+		// 检查大小之后文件又变大了
+		localizedError(w, r, http.StatusRequestEntityTooLarge, "ERR_EDIT_TOO_LARGE", remotefile.MaxEditSize)
+		return
+	}
+	if remotefile.CheckText(out) != nil {
+		localizedError(w, r, http.StatusUnsupportedMediaType, "ERR_EDIT_BINARY")
+		return
+	}
+	jsonResponse(w, http.StatusOK, EditFile{
+		Server:   hop.Name,
+		Path:     path,
+		Content:  string(out),
+		Checksum: remotefile.Checksum(out),
+		Size:     len(out),
+	})
+}
+
+// remoteFileHops 解析 server（ID 或名称）和远端绝对路径 path，返回服务器和连接它的 hop 链；
+// 参数无效时写入错误响应并返回 nil
+func (s *Server) remoteFileHops(w http.ResponseWriter, r *http.Request, server, path string) (*types.Hop, []*types.Hop) {
+	if server == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_HOP_ID_REQUIRED")
+		return nil, nil
+	}
+	hop := s.config.GetHopByID(server)
+	if hop == nil {
+		hop = s.config.GetHopByName(server)
+	}
+	if hop == nil {
+		localizedError(w, r, http.StatusNotFound, "ERR_HOP_NOT_FOUND")
+		return nil, nil
+	}
+	if path == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_PATH_REQUIRED")
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "path", path)
+		return nil, nil
+	}
+	hops := s.buildHopChain(hop.Name)
+	if len(hops) == 0 {
+		localizedError(w, r, http.StatusInternalServerError, "ERR_BUILD_CHAIN", hop.Name)
+		return nil, nil
+	}
+	return hop, hops
+}
+
+// editFailed 按远端脚本的退出码写入错误响应
+func editFailed(w http.ResponseWriter, r *http.Request, err error) {
+	var exit *gossh.ExitError
+	if errors.As(err, &exit) {
+		err = remotefile.Failed(exit.ExitStatus(), err)
+	}
+	switch {
+	case errors.Is(err, remotefile.ErrNotFound):
+		localizedError(w, r, http.StatusNotFound, "ERR_EDIT_NOT_FOUND")
+	case errors.Is(err, remotefile.ErrNotRegular):
+		localizedError(w, r, http.StatusBadRequest, "ERR_EDIT_NOT_REGULAR")
+	case errors.Is(err, remotefile.ErrTooLarge):
+		localizedError(w, r, http.StatusRequestEntityTooLarge, "ERR_EDIT_TOO_LARGE", remotefile.MaxEditSize)
+	case errors.Is(err, remotefile.ErrConflict):
+		localizedError(w, r, http.StatusConflict, "ERR_EDIT_CONFLICT")
+	default:
+		failure(w, r, http.StatusBadGateway, "ERR_EDIT_FAILED", err)
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEditValidation(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer bob-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name, method, target, body string
+		wantStatus                 int
+		wantCode                   string
+	}{
+		{"missing server", http.MethodGet, "/api/edit?path=/etc/hosts", "", http.StatusBadRequest, "ERR_HOP_ID_REQUIRED"},
+		{"unknown server", http.MethodGet, "/api/edit?server=nope&path=/etc/hosts", "", http.StatusNotFound, "ERR_HOP_NOT_FOUND"},
+		{"missing path", http.MethodGet, "/api/edit?server=hop-1", "", http.StatusBadRequest, "ERR_PATH_REQUIRED"},
+		{"relative path", http.MethodGet, "/api/edit?server=web-1&path=etc/hosts", "", http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"bad body", http.MethodPut, "/api/edit?server=web-1&path=/etc/hosts", "{", http.StatusBadRequest, "ERR_INVALID_BODY"},
+		{"binary content", http.MethodPut, "/api/edit?server=web-1&path=/etc/hosts", `{"content": "a\u0000b", "checksum": ""}`, http.StatusUnsupportedMediaType, "ERR_EDIT_BINARY"},
+		{"too large", http.MethodPut, "/api/edit?server=web-1&path=/etc/hosts", `{"content": "` + strings.Repeat("x", 1<<20+1) + `"}`, http.StatusRequestEntityTooLarge, "ERR_EDIT_TOO_LARGE"},
+		{"diff without a connection", http.MethodPut, "/api/edit?server=web-1&path=/etc/hosts&diff=1", `{"content": "x"}`, http.StatusBadGateway, "ERR_CHAIN_CONFIG"},
+		{"wrong method", http.MethodPost, "/api/edit?server=web-1&path=/etc/hosts", "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.method, tt.target, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantCode != "" && !strings.Contains(rec.Body.String(), tt.wantCode) {
+				t.Errorf("body = %s, want %s", rec.Body.String(), tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// confirmServerHeader 环境策略要求确认的操作须在该请求头中填写目标服务器的名称
+const confirmServerHeader = "X-Confirm-Server"
+
+// configuredHop 按 ID、名称或地址查找配置中的服务器，没有时返回 nil
+func (s *Server) configuredHop(name string) *types.Hop {
+	if hop := s.config.GetHopByID(name); hop != nil {
+		return hop
+	}
+	if hop := s.config.GetHopByName(name); hop != nil {
+		return hop
+	}
+	for _, h := range s.config.Hops {
+		if h.Host == name {
+			return h
+		}
+	}
+	return nil
+}
+
+// confirmEnvironment hop 的环境策略要求确认 op，而请求头中的服务器名称不符时写入 428 ERR_CONFIRM_REQUIRED 并返回 false
+func (s *Server) confirmEnvironment(w http.ResponseWriter, r *http.Request, hop *types.Hop, op string) bool {
+	if !s.config.ConfirmRequired(hop, op) || r.Header.Get(confirmServerHeader) == hop.Name {
+		return true
+	}
+	localizedError(w, r, http.StatusPreconditionRequired, "ERR_CONFIRM_REQUIRED", op, hop.Name, hop.Environment)
+	return false
+}
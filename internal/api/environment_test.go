@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestEnvironmentConfirmation(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	for _, hop := range []*types.Hop{
+		{ID: "hop-prod", Name: "db-prod", Host: "10.0.0.5", Port: 22, User: "root", Environment: "prod"},
+		{ID: "hop-stg", Name: "db-stg", Host: "10.0.0.6", Port: 22, User: "root", Environment: "staging"},
+	} {
+		if err := server.manager.AddHop(hop); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	do := func(method, target, confirm, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer alice-token")
+		if confirm != "" {
+			req.Header.Set(confirmServerHeader, confirm)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	initUpload := func(host, confirm string) *httptest.ResponseRecorder {
+		return do(http.MethodPost, "/api/upload/init", confirm, `{"file_name": "a.bin", "size": 1, "target_host": "`+host+`", "target_path": "/tmp"}`)
+	}
+
+	// prod 默认需要确认，按名称、ID 或地址指定目标都一样
+	for _, host := range []string{"db-prod", "hop-prod", "10.0.0.5"} {
+		rec := initUpload(host, "")
+		if rec.Code != http.StatusPreconditionRequired || !strings.Contains(rec.Body.String(), "ERR_CONFIRM_REQUIRED") {
+			t.Errorf("upload to %s without confirmation: expected 428, got %d: %s", host, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := initUpload("db-prod", "db-stg"); rec.Code != http.StatusPreconditionRequired {
+		t.Errorf("upload confirmed with another server's name: expected 428, got %d", rec.Code)
+	}
+	if rec := initUpload("db-prod", "db-prod"); rec.Code != http.StatusCreated {
+		t.Errorf("confirmed upload: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := initUpload("db-stg", ""); rec.Code != http.StatusCreated {
+		t.Errorf("staging upload: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// 按标签配置的策略：staging 的删除需要确认
+	server.config.Environments = map[string]types.EnvironmentPolicy{"staging": {Confirm: []string{types.OpDelete}}}
+	if rec := do(http.MethodDelete, "/api/servers/hop-stg", "", ""); rec.Code != http.StatusPreconditionRequired {
+		t.Errorf("delete staging server: expected 428, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/servers/hop-stg", "db-stg", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("confirmed delete: expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	// 未配置的 prod 仍使用默认策略
+	if rec := do(http.MethodPost, "/api/servers/hop-prod/processes/1234/kill", "", `{"confirm": "Mon Jan 1"}`); rec.Code != http.StatusPreconditionRequired {
+		t.Errorf("kill on prod: expected 428, got %d", rec.Code)
+	}
+}
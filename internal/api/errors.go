@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/luobobo896/HSSH/internal/agent"
+	"github.com/luobobo896/HSSH/internal/backup"
+	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/internal/hostinfo"
+	"github.com/luobobo896/HSSH/internal/i18n"
+	"github.com/luobobo896/HSSH/internal/keys"
+	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/transfer"
+)
+
+// 错误响应统一为 {"error": <说明>, "code": <代码>}，说明随 Accept-Language 变化，代码不变。
+// 代码格式为 ERR_<对象>_<原因>；与链路中某一跳有关的错误在代码后附加 ":<服务器名>"，
+// 如 ERR_CHAIN_AUTH_FAILED:bastion，脚本应按冒号前的部分判断。各端点可能返回的代码见 docs/api-errors.md
+
+// ErrInternal 无法归类的服务端错误
+const ErrInternal = "ERR_INTERNAL"
+
+// chainFailureCodes SSH 链某一跳失败的原因对应的错误代码
+var chainFailureCodes = map[string]string{
+	ssh.FailureConfig:        "ERR_CHAIN_CONFIG",
+	ssh.FailureKeyPassphrase: "ERR_CHAIN_KEY_PASSPHRASE",
+	ssh.FailureDial:          "ERR_CHAIN_DIAL_FAILED",
+	ssh.FailureHostKey:       "ERR_CHAIN_HOST_KEY",
+	ssh.FailureAuth:          "ERR_CHAIN_AUTH_FAILED",
+	ssh.FailureHandshake:     "ERR_CHAIN_HANDSHAKE_FAILED",
+}
+
+// errorCode 返回 err 对应的错误代码；无法识别时返回 fallback
+func errorCode(err error, fallback string) string {
+	var hopErr *ssh.HopError
+	var dependents *config.DependentsError
+	switch {
+	case errors.As(err, &hopErr):
+		return chainFailureCodes[hopErr.Kind] + ":" + hopErr.Hop
+	case errors.As(err, &dependents):
+		return "ERR_HOP_HAS_DEPENDENTS"
+	case errors.Is(err, config.ErrNotInTrash):
+		return "ERR_TRASH_NOT_FOUND"
+	case errors.Is(err, config.ErrNotFound):
+		return "ERR_NOT_FOUND"
+	case errors.Is(err, config.ErrExists):
+		return "ERR_ALREADY_EXISTS"
+	case errors.Is(err, agent.ErrNotConnected):
+		return "ERR_AGENT_NOT_CONNECTED"
+	case errors.Is(err, agent.ErrForwardNotFound):
+		return "ERR_FORWARD_NOT_FOUND"
+	case errors.Is(err, proxy.ErrNotFound):
+		return "ERR_PROXY_NOT_FOUND"
+	case errors.Is(err, hostinfo.ErrProcessChanged):
+		return "ERR_PROCESS_CHANGED"
+	case errors.Is(err, keys.ErrUnsupportedType):
+		return "ERR_UNSUPPORTED_KEY_TYPE"
+	case errors.Is(err, keys.ErrKeyExists):
+		return "ERR_KEY_EXISTS"
+	case errors.Is(err, transfer.ErrStageQuota):
+		return "ERR_STAGE_QUOTA"
+	case errors.Is(err, transfer.ErrNotWritable):
+		return "ERR_TARGET_NOT_WRITABLE"
+	case errors.Is(err, backup.ErrPassphrase), errors.Is(err, backup.ErrPassphraseRequired):
+		return "ERR_STATE_PASSPHRASE"
+	case errors.Is(err, backup.ErrConfigExists):
+		return "ERR_STATE_CONFIG_EXISTS"
+	case errors.Is(err, config.ErrFrozen):
+		return "ERR_CONFIG_FROZEN"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "ERR_TIMEOUT"
+	}
+	return fallback
+}
+
+// errorStatus 已识别错误代码对应的 HTTP 状态码，未列出的沿用调用方给出的状态码
+var errorStatus = map[string]int{
+	"ERR_HOP_HAS_DEPENDENTS":   http.StatusConflict,
+	"ERR_TRASH_NOT_FOUND":      http.StatusNotFound,
+	"ERR_NOT_FOUND":            http.StatusNotFound,
+	"ERR_ALREADY_EXISTS":       http.StatusConflict,
+	"ERR_AGENT_NOT_CONNECTED":  http.StatusNotFound,
+	"ERR_FORWARD_NOT_FOUND":    http.StatusNotFound,
+	"ERR_PROXY_NOT_FOUND":      http.StatusNotFound,
+	"ERR_PROCESS_CHANGED":      http.StatusConflict,
+	"ERR_UNSUPPORTED_KEY_TYPE": http.StatusBadRequest,
+	"ERR_KEY_EXISTS":           http.StatusConflict,
+	"ERR_TIMEOUT":              http.StatusGatewayTimeout,
+	"ERR_STATE_PASSPHRASE":     http.StatusBadRequest,
+	"ERR_STATE_CONFIG_EXISTS":  http.StatusConflict,
+	"ERR_CONFIG_FROZEN":        http.StatusConflict,
+}
+
+// failureMessage 按语言给出 err 的说明：链路错误说明是哪一跳，其他错误用 code 的消息模板并附上原始错误
+func failureMessage(lang i18n.Lang, code string, err error) string {
+	var hopErr *ssh.HopError
+	var dependents *config.DependentsError
+	switch {
+	case errors.As(err, &hopErr):
+		return i18n.T(lang, code, hopErr.Hop, hopErr.Err)
+	case errors.As(err, &dependents):
+		return i18n.T(lang, code, dependents.Hop, strings.Join(dependents.Dependents, ", "))
+	}
+	return i18n.T(lang, code, err)
+}
+
+// failure 发送由 err 引起的错误：可识别的错误使用专门的代码和状态码，
+// 否则使用 fallback 代码（其消息模板以 err 为参数）和 status
+func failure(w http.ResponseWriter, r *http.Request, status int, fallback string, err error) {
+	code := errorCode(err, fallback)
+	base, _, _ := strings.Cut(code, ":")
+	if mapped, ok := errorStatus[base]; ok {
+		status = mapped
+	}
+	lang := requestLang(r)
+	w.Header().Set("Content-Language", string(lang))
+	errorResponse(w, status, code, failureMessage(lang, base, err))
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/agent"
+	"github.com/luobobo896/HSSH/internal/backup"
+	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/internal/hostinfo"
+	"github.com/luobobo896/HSSH/internal/keys"
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/transfer"
+)
+
+func TestErrorCode(t *testing.T) {
+	authErr := &ssh.HopError{Index: 1, Hop: "bastion", Kind: ssh.FailureAuth, Err: errors.New("unable to authenticate")}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"chain failure carries hop", fmt.Errorf("connect: %w", authErr), "ERR_CHAIN_AUTH_FAILED:bastion"},
+		{"dial failure", &ssh.HopError{Hop: "gw", Kind: ssh.FailureDial, Err: errors.New("refused")}, "ERR_CHAIN_DIAL_FAILED:gw"},
+		{"dependents", &config.DependentsError{Hop: "gw", Dependents: []string{"server db"}}, "ERR_HOP_HAS_DEPENDENTS"},
+		{"not in trash", fmt.Errorf("hop x: %w", config.ErrNotInTrash), "ERR_TRASH_NOT_FOUND"},
+		{"config not found", fmt.Errorf("hop x %w", config.ErrNotFound), "ERR_NOT_FOUND"},
+		{"config exists", fmt.Errorf("hop x %w", config.ErrExists), "ERR_ALREADY_EXISTS"},
+		{"agent offline", fmt.Errorf("agent dc1 %w", agent.ErrNotConnected), "ERR_AGENT_NOT_CONNECTED"},
+		{"process changed", hostinfo.ErrProcessChanged, "ERR_PROCESS_CHANGED"},
+		{"key type", fmt.Errorf("%w: dsa", keys.ErrUnsupportedType), "ERR_UNSUPPORTED_KEY_TYPE"},
+		{"key exists", fmt.Errorf("/tmp/k: %w", keys.ErrKeyExists), "ERR_KEY_EXISTS"},
+		{"stage quota", fmt.Errorf("upload: %w: 10 bytes over", transfer.ErrStageQuota), "ERR_STAGE_QUOTA"},
+		{"backup passphrase", fmt.Errorf("truncated backup: %w", backup.ErrPassphrase), "ERR_STATE_PASSPHRASE"},
+		{"restore over config", backup.ErrConfigExists, "ERR_STATE_CONFIG_EXISTS"},
+		{"config frozen", fmt.Errorf("save: %w", config.ErrFrozen), "ERR_CONFIG_FROZEN"},
+		{"timeout", fmt.Errorf("fetch: %w", context.DeadlineExceeded), "ERR_TIMEOUT"},
+		{"unknown", errors.New("boom"), "ERR_FALLBACK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorCode(tt.err, "ERR_FALLBACK"); got != tt.want {
+				t.Errorf("errorCode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailureResponse(t *testing.T) {
+	err := &ssh.HopError{Hop: "bastion", Kind: ssh.FailureAuth, Err: errors.New("no supported methods remain")}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/proxy", nil)
+	req.Header.Set("Accept-Language", "zh-CN")
+	rec := httptest.NewRecorder()
+	failure(rec, req, http.StatusBadGateway, "ERR_CHAIN_CONNECT", err)
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", rec.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if body["code"] != "ERR_CHAIN_AUTH_FAILED:bastion" {
+		t.Errorf("code = %q", body["code"])
+	}
+	if want := "bastion 认证失败：no supported methods remain"; body["error"] != want {
+		t.Errorf("error = %q, want %q", body["error"], want)
+	}
+}
+
+func TestUnknownProxyDeleteIsNotFound(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/proxy/proxy-missing", nil)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if body["code"] != "ERR_PROXY_NOT_FOUND" {
+		t.Errorf("code = %q, want ERR_PROXY_NOT_FOUND", body["code"])
+	}
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/luobobo896/HSSH/internal/events"
+)
+
+// checkEvent 在可拒绝的操作开始前发布事件，补全请求 ID 和用户；被插件拒绝时返回 *events.Rejection
+func (s *Server) checkEvent(r *http.Request, event *events.Event) *events.Rejection {
+	event.RequestID = requestID(r)
+	event.User = currentUser(r).Name
+	if err := s.events.Check(r.Context(), event); err != nil {
+		return err.(*events.Rejection)
+	}
+	return nil
+}
+
+// pluginRejected 返回 403 ERR_PLUGIN_REJECTED
+func pluginRejected(w http.ResponseWriter, r *http.Request, rejection *events.Rejection) {
+	localizedError(w, r, http.StatusForbidden, "ERR_PLUGIN_REJECTED", rejection.Plugin, rejection.Reason)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/export"
+	"github.com/luobobo896/HSSH/internal/profiler"
+	"github.com/luobobo896/HSSH/internal/usage"
+)
+
+// handleExport 把延迟历史、传输记录或每天的使用量导出为 CSV 附件
+// (GET /api/export/{latency|transfers|usage}?from=2026-09-01&to=2026-09-30&format=csv)。
+// from/to 为 RFC 3339 时间或本地日期（to 包含当天）；非管理员只能导出自己的传输记录
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	kind := strings.TrimPrefix(r.URL.Path, "/api/export/")
+	if !slices.Contains(export.Kinds, kind) {
+		localizedError(w, r, http.StatusNotFound, "ERR_NOT_FOUND")
+		return
+	}
+	query := r.URL.Query()
+	if format := query.Get("format"); format != "" && format != "csv" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "format", format)
+		return
+	}
+	rng, err := export.ParseRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "range", err)
+		return
+	}
+
+	// 先写入缓冲区，出错时还能返回 JSON 错误
+	var buf bytes.Buffer
+	switch kind {
+	case export.KindLatency:
+		err = export.Latency(&buf, s.latencySamples(), rng)
+	case export.KindTransfers:
+		user := ""
+		if u := currentUser(r); !u.IsAdmin() {
+			user = u.Name
+		}
+		err = export.Transfers(&buf, filepath.Join(s.config.ConfigDir, audit.FileName), rng, user)
+	case export.KindUsage:
+		store := s.usage
+		if store != nil {
+			s.sampleTunnels(time.Now())
+		} else {
+			store, err = usage.Open(filepath.Join(s.config.ConfigDir, usage.FileName))
+		}
+		if err == nil {
+			err = export.Usage(&buf, s.config, store, rng)
+		}
+	}
+	if err != nil {
+		failure(w, r, http.StatusInternalServerError, ErrInternal, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+export.FileName(kind, rng)+`"`)
+	w.Write(buf.Bytes())
+}
+
+// latencySamples 内存中各服务器（经其网关链）的延迟样本
+func (s *Server) latencySamples() []export.LatencySample {
+	var samples []export.LatencySample
+	for _, hop := range s.config.Hops {
+		for _, sample := range s.profiler.History(profiler.PathOf(s.config.GatewayChain(hop))) {
+			samples = append(samples, export.LatencySample{
+				Server:    hop.Name,
+				Time:      sample.Timestamp,
+				LatencyMs: durationMs(sample.Latency),
+				Success:   sample.Success,
+			})
+		}
+	}
+	return samples
+}
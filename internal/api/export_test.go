@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+)
+
+func TestExportEndpoint(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	server.recordAudit(audit.Event{User: "bob", Action: "upload.completed", Target: "task-1", Detail: "a.txt -> web-1:/srv"})
+	server.recordAudit(audit.Event{User: "carol", Action: "upload.completed", Target: "task-2", Detail: "b.txt -> web-1:/srv"})
+
+	get := func(token, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("alice-token", "/api/export/transfers?from=2000-01-01")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("admin export: got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if disposition := rec.Header().Get("Content-Disposition"); !strings.Contains(disposition, "gmssh-transfers-2000-01-01.csv") {
+		t.Errorf("disposition: %s", disposition)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "a.txt") || !strings.Contains(body, "b.txt") {
+		t.Errorf("admin export: %s", body)
+	}
+	// 非管理员只能导出自己的传输记录
+	if body := get("bob-token", "/api/export/transfers").Body.String(); !strings.Contains(body, "a.txt") || strings.Contains(body, "b.txt") {
+		t.Errorf("user export: %s", body)
+	}
+	for _, target := range []string{"/api/export/usage", "/api/export/latency"} {
+		if rec := get("alice-token", target); rec.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d: %s", target, rec.Code, rec.Body.String())
+		}
+	}
+
+	if rec := get("alice-token", "/api/export/sessions"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown kind: expected 404, got %d", rec.Code)
+	}
+	for _, target := range []string{"/api/export/usage?format=parquet", "/api/export/usage?from=yesterday"} {
+		if rec := get("alice-token", target); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rec.Code)
+		}
+	}
+}
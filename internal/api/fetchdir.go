@@ -0,0 +1,273 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/events"
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/transfer"
+	"github.com/luobobo896/HSSH/internal/usage"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// FetchDirRequest 打包下载远程目录的请求，与 gmssh fetch-dir 相同
+type FetchDirRequest struct {
+	Server     string   `json:"server"` // 服务器 ID 或名称
+	Path       string   `json:"path"`
+	Via        []string `json:"via,omitempty"`        // 服务器 ID 列表，为空时使用服务器的网关链
+	RemoteTemp string   `json:"remote_tmp,omitempty"` // 远端压缩包的存放目录，默认 $TMPDIR 或 /tmp
+}
+
+// fetchTask 打包下载任务；完成后压缩包留在暂存目录中，由浏览器经 /archive 下载
+type fetchTask struct {
+	progress *types.TransferProgress
+	dir      string // 暂存目录
+	archive  string // 完成后的压缩包路径
+}
+
+// handleFetchDir 在远端打包压缩目录并下载到暂存区，返回任务 ID (POST /api/fetch-dir)
+func (s *Server) handleFetchDir(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req FetchDirRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	if req.Server == "" || req.Path == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_FETCH_DIR_REQUIRED")
+		return
+	}
+	hop := s.config.GetHopByID(req.Server)
+	if hop == nil {
+		hop = s.config.GetHopByName(req.Server)
+	}
+	if hop == nil {
+		localizedError(w, r, http.StatusNotFound, "ERR_HOP_NOT_FOUND")
+		return
+	}
+	hops, unknown := s.probeVia(req.Via)
+	if unknown != "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_UNKNOWN_HOP", unknown)
+		return
+	}
+	if len(hops) == 0 {
+		hops = s.config.GatewayChain(hop)
+	} else {
+		hops = append(hops, hop)
+	}
+	ids := make([]string, len(hops))
+	for i, h := range hops {
+		ids[i] = h.ID
+	}
+	if !s.checkMaintenance(w, r, ids...) {
+		return
+	}
+	taskID := fmt.Sprintf("fetch-%d", time.Now().UnixNano())
+	event := &events.Event{
+		Type:   events.TaskCreated,
+		Server: hop.Name,
+		Target: taskID,
+		Data:   map[string]interface{}{"kind": "fetch_dir", "path": req.Path, "via": req.Via},
+	}
+	if rejection := s.checkEvent(r, event); rejection != nil {
+		pluginRejected(w, r, rejection)
+		return
+	}
+
+	dir, err := s.staging.Create()
+	if err != nil {
+		localizedError(w, r, http.StatusInternalServerError, "ERR_STAGING", err)
+		return
+	}
+	task := &fetchTask{
+		progress: &types.TransferProgress{
+			TaskID:    taskID,
+			FileName:  transfer.ArchiveName(req.Path),
+			Status:    "pending",
+			Timestamp: time.Now(),
+			RequestID: requestID(r),
+		},
+		dir: dir,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.fetches[taskID] = task
+	s.uploadCancels[taskID] = cancel
+	s.mu.Unlock()
+	s.owners.set(ownerKindFetch, taskID, currentUser(r))
+
+	go s.executeFetch(ctx, cancel, task, hops, req)
+
+	jsonResponse(w, http.StatusOK, map[string]string{"task_id": taskID})
+}
+
+// executeFetch 连接链并执行打包下载，结束时写入任务的最终状态
+func (s *Server) executeFetch(ctx context.Context, cancel context.CancelFunc, task *fetchTask, hops []*types.Hop, req FetchDirRequest) {
+	progress := task.progress
+	defer func() {
+		cancel()
+		s.mu.Lock()
+		delete(s.uploadCancels, progress.TaskID)
+		s.mu.Unlock()
+	}()
+	logger := requestLogger(progress.RequestID)
+	target := hops[len(hops)-1].Name + ":" + req.Path
+
+	s.mu.Lock()
+	progress.Status = "running"
+	s.mu.Unlock()
+
+	fail := func(code string, err error) {
+		logger.Printf("[FETCH] %s failed: %v", target, err)
+		s.mu.Lock()
+		progress.Status = "failed"
+		progress.Error = err.Error()
+		progress.ErrorCode = errorCode(err, code)
+		s.mu.Unlock()
+		s.staging.Remove(task.dir)
+		s.auditFetch(task, target)
+	}
+
+	chain := ssh.NewChain(hops)
+	chain.SetLogger(logger)
+	if err := chain.ConnectContext(ctx); err != nil {
+		fail("ERR_CHAIN_CONNECT", fmt.Errorf("SSH connection failed: %w", err))
+		return
+	}
+	defer chain.Disconnect()
+
+	scp := transfer.NewSCPTransfer(chain)
+	scp.SetLogger(logger)
+	scp.SetSpeedWindow(s.config.Upload.SpeedWindow)
+
+	// 进度写入任务，结束前等待最后一条进度，避免覆盖最终状态
+	progressPub := transfer.NewProgressPublisher()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for p := range progressPub.Updates() {
+			s.mu.Lock()
+			progress.TotalBytes = p.TotalBytes
+			progress.SentBytes = p.SentBytes
+			progress.Speed = p.Speed
+			progress.InstantSpeed = p.InstantSpeed
+			progress.AverageSpeed = p.AverageSpeed
+			progress.ETA = p.ETA
+			s.mu.Unlock()
+		}
+	}()
+
+	archive := filepath.Join(task.dir, progress.FileName)
+	logger.Printf("[FETCH] Fetching %s as %s", target, archive)
+	result, err := scp.FetchDir(ctx, req.Path, archive, transfer.FetchOptions{RemoteTemp: req.RemoteTemp}, progressPub.Chan())
+	progressPub.Close()
+	<-done
+	if err != nil {
+		fail("ERR_FETCH_DIR_FAILED", err)
+		return
+	}
+
+	s.mu.Lock()
+	progress.TotalBytes = result.Bytes
+	progress.SentBytes = result.Bytes
+	progress.Status = "completed"
+	task.archive = archive
+	s.mu.Unlock()
+	// 没有取走的压缩包按 upload.max_age 由暂存区清理
+	s.staging.Release(task.dir)
+	s.auditFetch(task, target)
+	s.recordUsage(hops, usage.Counters{Transfers: 1, Bytes: result.Bytes})
+}
+
+// auditFetch 记录打包下载任务的最终结果，并发布 task.completed
+func (s *Server) auditFetch(task *fetchTask, target string) {
+	s.mu.RLock()
+	event := audit.Event{
+		RequestID: task.progress.RequestID,
+		User:      s.owners.owner(ownerKindFetch, task.progress.TaskID),
+		Action:    "fetch_dir." + task.progress.Status,
+		Target:    target,
+		Error:     task.progress.Error,
+	}
+	completed := taskCompletedEvent("fetch_dir", task.progress)
+	s.mu.RUnlock()
+	s.recordAudit(event)
+	completed.User = event.User
+	s.events.Publish(completed)
+}
+
+// handleFetchDirDetail GET 返回任务进度，GET .../archive 下载完成的压缩包，
+// DELETE 取消任务并删除压缩包 (/api/fetch-dir/{id})
+func (s *Server) handleFetchDirDetail(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/fetch-dir/")
+	taskID, sub, _ := strings.Cut(rest, "/")
+
+	s.mu.RLock()
+	task := s.fetches[taskID]
+	s.mu.RUnlock()
+	if task == nil || !s.owners.canAccess(currentUser(r), ownerKindFetch, taskID) {
+		localizedError(w, r, http.StatusNotFound, "ERR_TASK_NOT_FOUND")
+		return
+	}
+
+	switch {
+	case sub == "" && r.Method == http.MethodGet:
+		s.mu.RLock()
+		snapshot := task.progress.Clone()
+		s.mu.RUnlock()
+		jsonResponse(w, http.StatusOK, snapshot)
+
+	case sub == "archive" && r.Method == http.MethodGet:
+		s.mu.RLock()
+		archive, status := task.archive, task.progress.Status
+		s.mu.RUnlock()
+		if archive == "" {
+			localizedError(w, r, http.StatusConflict, "ERR_FETCH_NOT_READY", status)
+			return
+		}
+		f, err := os.Open(archive)
+		if err != nil {
+			// 已被暂存区清理
+			localizedError(w, r, http.StatusNotFound, "ERR_TASK_NOT_FOUND")
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			failure(w, r, http.StatusInternalServerError, ErrInternal, err)
+			return
+		}
+		name := filepath.Base(archive)
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		http.ServeContent(w, r, name, info.ModTime(), f)
+
+	case sub == "" && r.Method == http.MethodDelete:
+		s.mu.Lock()
+		if cancel := s.uploadCancels[taskID]; cancel != nil {
+			cancel()
+		}
+		delete(s.fetches, taskID)
+		s.mu.Unlock()
+		s.staging.Remove(task.dir)
+		s.owners.remove(ownerKindFetch, taskID)
+		jsonResponse(w, http.StatusNoContent, nil)
+
+	case sub == "" || sub == "archive":
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+	default:
+		localizedError(w, r, http.StatusNotFound, "ERR_NOT_FOUND")
+	}
+}
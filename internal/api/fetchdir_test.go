@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestFetchDir(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 已完成的任务：压缩包在暂存目录中
+	dir, err := server.staging.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "logs.tar.gz")
+	if err := os.WriteFile(archive, []byte("archive data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server.fetches["fetch-done"] = &fetchTask{
+		progress: &types.TransferProgress{TaskID: "fetch-done", FileName: "logs.tar.gz", TotalBytes: 12, SentBytes: 12, Status: "completed"},
+		dir:      dir,
+		archive:  archive,
+	}
+	server.fetches["fetch-running"] = &fetchTask{
+		progress: &types.TransferProgress{TaskID: "fetch-running", FileName: "app.tar.gz", Status: "running"},
+	}
+	server.owners.set(ownerKindFetch, "fetch-done", &types.WebUser{Name: "bob"})
+	server.owners.set(ownerKindFetch, "fetch-running", &types.WebUser{Name: "bob"})
+
+	tests := []struct {
+		name, method, path, token, body string
+		wantStatus                      int
+		wantCode                        string
+	}{
+		{"missing path", http.MethodPost, "/api/fetch-dir", "bob-token", `{"server": "web-1"}`, http.StatusBadRequest, "ERR_FETCH_DIR_REQUIRED"},
+		{"unknown server", http.MethodPost, "/api/fetch-dir", "bob-token", `{"server": "nope", "path": "/var/log"}`, http.StatusNotFound, "ERR_HOP_NOT_FOUND"},
+		{"unknown via", http.MethodPost, "/api/fetch-dir", "bob-token", `{"server": "hop-1", "path": "/var/log", "via": ["nope"]}`, http.StatusBadRequest, "ERR_UNKNOWN_HOP"},
+		{"wrong method", http.MethodGet, "/api/fetch-dir", "bob-token", "", http.StatusMethodNotAllowed, ""},
+		{"owner reads task", http.MethodGet, "/api/fetch-dir/fetch-done", "bob-token", "", http.StatusOK, ""},
+		{"other user sees nothing", http.MethodGet, "/api/fetch-dir/fetch-done", "carol-token", "", http.StatusNotFound, "ERR_TASK_NOT_FOUND"},
+		{"archive not ready", http.MethodGet, "/api/fetch-dir/fetch-running/archive", "bob-token", "", http.StatusConflict, "ERR_FETCH_NOT_READY"},
+		{"owner downloads archive", http.MethodGet, "/api/fetch-dir/fetch-done/archive", "bob-token", "", http.StatusOK, ""},
+		{"archive is read only", http.MethodPost, "/api/fetch-dir/fetch-done/archive", "bob-token", "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.method, tt.path, tt.token, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantCode != "" && !strings.Contains(rec.Body.String(), tt.wantCode) {
+				t.Errorf("body = %s, want %s", rec.Body.String(), tt.wantCode)
+			}
+		})
+	}
+
+	rec := do(http.MethodGet, "/api/fetch-dir/fetch-done/archive", "bob-token", "")
+	if rec.Body.String() != "archive data" || !strings.Contains(rec.Header().Get("Content-Disposition"), `filename="logs.tar.gz"`) {
+		t.Errorf("archive response: %q, Content-Disposition %q", rec.Body.String(), rec.Header().Get("Content-Disposition"))
+	}
+
+	if rec := do(http.MethodDelete, "/api/fetch-dir/fetch-done", "bob-token", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("staging dir not removed: %v", err)
+	}
+	if rec := do(http.MethodGet, "/api/fetch-dir/fetch-done", "bob-token", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("deleted task status = %d", rec.Code)
+	}
+}
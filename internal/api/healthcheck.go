@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/luobobo896/HSSH/internal/profiler"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// maxCheckParallel parallel 参数上限
+const maxCheckParallel = 32
+
+// HealthCheckRequest 批量健康检查请求，请求体可以为空
+type HealthCheckRequest struct {
+	IDs      []string `json:"ids,omitempty"`      // 要检查的服务器 ID，为空时检查全部
+	Parallel int      `json:"parallel,omitempty"` // 同时检查的服务器数，默认 8，最多 32
+}
+
+// HealthCheckResponse 批量健康检查结果，results 与请求的 ids（或配置中的服务器）顺序一致
+type HealthCheckResponse struct {
+	OK      int                    `json:"ok"`
+	Failed  int                    `json:"failed"`
+	Results []profiler.CheckResult `json:"results"`
+}
+
+// handleHealthCheck 经各服务器的网关链并发检查服务器的连通性和认证，结果写入各服务器的 last_check
+// (POST /api/servers/healthcheck)
+func (s *Server) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req HealthCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	if req.Parallel < 0 || req.Parallel > maxCheckParallel {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "parallel", req.Parallel)
+		return
+	}
+
+	targets := s.config.Hops
+	if len(req.IDs) > 0 {
+		targets = make([]*types.Hop, 0, len(req.IDs))
+		for _, id := range req.IDs {
+			hop := s.config.GetHopByID(id)
+			if hop == nil {
+				localizedError(w, r, http.StatusBadRequest, "ERR_UNKNOWN_HOP", id)
+				return
+			}
+			targets = append(targets, hop)
+		}
+	}
+
+	results := s.profiler.CheckHops(r.Context(), targets, s.config.GatewayChain, req.Parallel, 0)
+
+	resp := HealthCheckResponse{Results: results}
+	checks := make(map[string]types.HealthCheck, len(results))
+	for _, result := range results {
+		checks[result.ID] = result.HealthCheck
+		if result.OK {
+			resp.OK++
+		} else {
+			resp.Failed++
+		}
+	}
+	// 保存失败不影响本次结果
+	if err := s.manager.RecordHealthChecks(checks); err != nil {
+		log.Printf("[HEALTH] failed to save check results: %v", err)
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
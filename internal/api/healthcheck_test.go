@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealthCheckValidation(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+		code   string
+	}{
+		{"wrong method", http.MethodGet, "", http.StatusMethodNotAllowed, ""},
+		{"invalid body", http.MethodPost, "{", http.StatusBadRequest, "ERR_INVALID_BODY"},
+		{"negative parallel", http.MethodPost, `{"parallel": -1}`, http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"parallel too high", http.MethodPost, `{"parallel": 33}`, http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"unknown id", http.MethodPost, `{"ids": ["hop-1", "missing-hop"]}`, http.StatusBadRequest, "ERR_UNKNOWN_HOP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/servers/healthcheck", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer bob-token")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.code == "" {
+				return
+			}
+			var resp map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if resp["code"] != tt.code {
+				t.Errorf("code = %q, want %q", resp["code"], tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/ssh"
+)
+
+// HostKeyDecision 确认或拒绝待确认的主机密钥
+type HostKeyDecision struct {
+	// Address 待确认密钥的地址（GET /api/hostkeys 返回的 address，也可以写 host:port）
+	Address string `json:"address"`
+	// Fingerprint 确认时必填，须与待确认密钥的 SHA256 指纹一致
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// handleHostKeys 列出被拒绝、等待确认的主机密钥：strict 策略下的新主机和密钥发生变化的主机 (GET /api/hostkeys)
+func (s *Server) handleHostKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"pending": ssh.PendingHostKeys()})
+}
+
+// handleHostKeyDecision 确认 (POST /api/hostkeys/accept) 或拒绝 (POST /api/hostkeys/reject) 待确认的主机密钥，仅管理员。
+// 确认后密钥写入 known_hosts 并替换该主机原有的记录；拒绝只丢弃待确认记录，之后的连接仍会被拒绝
+func (s *Server) handleHostKeyDecision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	action := strings.TrimPrefix(r.URL.Path, "/api/hostkeys/")
+	if action != "accept" && action != "reject" {
+		localizedError(w, r, http.StatusNotFound, "ERR_NOT_FOUND")
+		return
+	}
+	var req HostKeyDecision
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	if req.Address == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "address", req.Address)
+		return
+	}
+	if action == "accept" && req.Fingerprint == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "fingerprint", req.Fingerprint)
+		return
+	}
+
+	var pending *ssh.PendingHostKey
+	var err error
+	if action == "accept" {
+		pending, err = ssh.AcceptHostKey(req.Address, req.Fingerprint)
+	} else {
+		pending, err = ssh.RejectHostKey(req.Address)
+	}
+	switch {
+	case errors.Is(err, ssh.ErrHostKeyNotPending):
+		localizedError(w, r, http.StatusNotFound, "ERR_HOST_KEY_NOT_PENDING", req.Address)
+		return
+	case errors.Is(err, ssh.ErrHostKeyFingerprintDiff):
+		localizedError(w, r, http.StatusConflict, "ERR_HOST_KEY_FINGERPRINT", req.Fingerprint)
+		return
+	case err != nil:
+		failure(w, r, http.StatusInternalServerError, ErrInternal, err)
+		return
+	}
+
+	s.recordAudit(audit.Event{
+		RequestID: requestID(r),
+		User:      currentUser(r).Name,
+		Action:    "hostkey." + action + "ed",
+		Target:    pending.Address,
+		Detail:    pending.KeyType + " " + pending.Fingerprint,
+	})
+	jsonResponse(w, http.StatusOK, pending)
+}
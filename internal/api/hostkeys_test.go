@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/sshtest"
+	"github.com/luobobo896/HSSH/pkg/types"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestHostKeyAcceptFlow(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	ssh.SetKnownHostsPath(filepath.Join(t.TempDir(), "known_hosts"))
+	t.Cleanup(func() { ssh.SetKnownHostsPath("") })
+
+	do := func(token, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// strict 策略下的新主机被拒绝并进入待确认列表
+	sshd := sshtest.NewServer(t, sshtest.Options{})
+	hop := sshd.Hop("strict-1")
+	hop.HostKey = ""
+	hop.HostKeyPolicy = types.HostKeyStrict
+	if err := ssh.NewChain([]*types.Hop{hop}).Connect(); err == nil {
+		t.Fatal("expected strict host key check to reject an unknown host")
+	}
+
+	rec := do("bob-token", http.MethodGet, "/api/hostkeys", "")
+	var list struct {
+		Pending []ssh.PendingHostKey `json:"pending"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Pending) != 1 {
+		t.Fatalf("pending host keys: %d %s", rec.Code, rec.Body.String())
+	}
+	pending := list.Pending[0]
+	fingerprint := gossh.FingerprintSHA256(sshd.HostKey())
+	if pending.Fingerprint != fingerprint || pending.Hop != "strict-1" || pending.Changed {
+		t.Fatalf("pending = %+v", pending)
+	}
+
+	body := `{"address": "` + pending.Address + `", "fingerprint": "` + fingerprint + `"}`
+	if rec := do("bob-token", http.MethodPost, "/api/hostkeys/accept", body); rec.Code != http.StatusForbidden {
+		t.Errorf("non-admin accept: expected 403, got %d", rec.Code)
+	}
+	if rec := do("alice-token", http.MethodPost, "/api/hostkeys/accept", `{"address": "`+pending.Address+`", "fingerprint": "SHA256:x"}`); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "ERR_HOST_KEY_FINGERPRINT") {
+		t.Errorf("wrong fingerprint: expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := do("alice-token", http.MethodPost, "/api/hostkeys/accept", body); rec.Code != http.StatusOK {
+		t.Fatalf("accept: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	chain := ssh.NewChain([]*types.Hop{hop})
+	if err := chain.Connect(); err != nil {
+		t.Fatalf("connect after accept: %v", err)
+	}
+	chain.Disconnect()
+	if rec := do("alice-token", http.MethodPost, "/api/hostkeys/reject", `{"address": "`+pending.Address+`"}`); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "ERR_HOST_KEY_NOT_PENDING") {
+		t.Errorf("reject without pending key: expected 404, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	data, err := os.ReadFile(filepath.Join(server.config.ConfigDir, audit.FileName))
+	if err != nil || !strings.Contains(string(data), `"action":"hostkey.accepted"`) || !strings.Contains(string(data), fingerprint) {
+		t.Errorf("expected hostkey.accepted audit event, got %s (%v)", data, err)
+	}
+}
+
+func TestServerHostKeySettings(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/servers/hop-1", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer alice-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := put(`{"host_key_policy": "sometimes"}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "ERR_INVALID_HOST_KEY") {
+		t.Errorf("unknown policy: expected 400 ERR_INVALID_HOST_KEY, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := put(`{"host_key": "ssh-ed25519 not-base64"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid host key: expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := put(`{"host_key_policy": "strict"}`)
+	var hop types.Hop
+	if err := json.Unmarshal(rec.Body.Bytes(), &hop); err != nil || rec.Code != http.StatusOK || hop.HostKeyPolicy != types.HostKeyStrict {
+		t.Fatalf("set policy: %d %s", rec.Code, rec.Body.String())
+	}
+	// 未提供的字段保留原值
+	rec = put(`{"name": "hop-1-renamed"}`)
+	if err := json.Unmarshal(rec.Body.Bytes(), &hop); err != nil || hop.HostKeyPolicy != types.HostKeyStrict {
+		t.Errorf("policy should be kept on update: %s", rec.Body.String())
+	}
+}
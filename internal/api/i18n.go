@@ -0,0 +1,22 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/luobobo896/HSSH/internal/i18n"
+)
+
+// requestLang 请求的语言：Accept-Language 中第一个支持的语言，否则为服务端默认语言
+func requestLang(r *http.Request) i18n.Lang {
+	if lang := i18n.FromAcceptLanguage(r.Header.Get("Accept-Language")); lang != "" {
+		return lang
+	}
+	return i18n.Default()
+}
+
+// localizedError 按请求语言发送错误响应，code 是不随语言变化的消息代码，供脚本判断
+func localizedError(w http.ResponseWriter, r *http.Request, status int, code string, args ...interface{}) {
+	lang := requestLang(r)
+	w.Header().Set("Content-Language", string(lang))
+	errorResponse(w, status, code, i18n.T(lang, code, args...))
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocalizedErrors(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		wantError      string
+	}{
+		{"default english", "", "Server not found"},
+		{"chinese", "zh-CN,zh;q=0.9", "服务器不存在"},
+		{"unsupported falls back", "fr-FR", "Server not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/servers/missing", nil)
+			req.Header.Set("Authorization", "Bearer alice-token")
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusNotFound {
+				t.Fatalf("expected 404, got %d", rec.Code)
+			}
+			var body map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if body["code"] != "ERR_HOP_NOT_FOUND" {
+				t.Errorf("code = %q, want ERR_HOP_NOT_FOUND", body["code"])
+			}
+			if body["error"] != tt.wantError {
+				t.Errorf("error = %q, want %q", body["error"], tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// idleCheckInterval 检查是否空闲的间隔，空闲退出时间更短时按退出时间检查
+const idleCheckInterval = 30 * time.Second
+
+// Activity 进行中的会话、传输和转发数量
+type Activity struct {
+	Sessions       int
+	Uploads        int
+	ChunkedUploads int
+	Proxies        int
+	PortalMappings int
+	AgentForwards  int
+}
+
+// Busy 是否有任何进行中的会话、传输或转发
+func (a Activity) Busy() bool {
+	return a.Sessions+a.Uploads+a.ChunkedUploads+a.Proxies+a.PortalMappings+a.AgentForwards > 0
+}
+
+// SetIdleExit 设置空闲退出时间：没有终端会话、传输和转发，且超过 d 没有 API 请求时 Start 正常返回。
+// 用于本地模式下避免遗留进程，须在 Start 前调用，0 表示不退出
+func (s *Server) SetIdleExit(d time.Duration) {
+	s.idleExit = d
+}
+
+// activity 统计当前进行中的会话、传输和转发
+func (s *Server) activity() Activity {
+	var a Activity
+
+	s.terminalsMu.RLock()
+	a.Sessions = len(s.terminals)
+	s.terminalsMu.RUnlock()
+
+	s.mu.RLock()
+	a.Uploads = len(s.uploadCancels)
+	s.mu.RUnlock()
+
+	s.chunked.mu.Lock()
+	a.ChunkedUploads = len(s.chunked.uploads)
+	s.chunked.mu.Unlock()
+
+	a.Proxies = len(s.proxies.List())
+
+	s.portalMu.RLock()
+	a.PortalMappings = len(s.portalForwarders)
+	s.portalMu.RUnlock()
+
+	if s.agents != nil {
+		a.AgentForwards = len(s.agents.Forwards())
+	}
+	return a
+}
+
+// touch 记录一次活动，重新开始计算空闲时间
+func (s *Server) touch() {
+	s.lastActive.Store(time.Now().UnixNano())
+}
+
+// idleSince 返回 now 时已空闲的时间，有进行中的会话、传输或转发时为 0 并记为活动
+func (s *Server) idleSince(now time.Time) time.Duration {
+	if s.activity().Busy() {
+		s.touch()
+		return 0
+	}
+	return now.Sub(time.Unix(0, s.lastActive.Load()))
+}
+
+// activityMiddleware 每个 API 请求记为一次活动，探针请求除外
+func (s *Server) activityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" && r.URL.Path != "/readyz" {
+			s.touch()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// idleExitLoop 空闲超过 s.idleExit 后调用 stop 触发优雅关闭
+func (s *Server) idleExitLoop(ctx context.Context, stop context.CancelFunc) {
+	ticker := time.NewTicker(min(idleCheckInterval, s.idleExit))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if idle := s.idleSince(time.Now()); idle >= s.idleExit {
+			log.Printf("No sessions, transfers or forwarders for %s, shutting down", idle.Round(time.Second))
+			stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIdleSince(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	handler = server.activityMiddleware(handler)
+	server.SetIdleExit(time.Minute)
+	server.touch()
+
+	later := time.Now().Add(2 * time.Minute)
+	if idle := server.idleSince(later); idle < time.Minute {
+		t.Fatalf("idle = %s, want at least 1m", idle)
+	}
+
+	// 有终端会话时不算空闲，会话结束后从那一刻重新计时
+	id := server.registerTerminal(server.lookupUser("bob-token"), "web-1", nil, func() {})
+	if a := server.activity(); a.Sessions != 1 || !a.Busy() {
+		t.Fatalf("activity = %+v, want one session", a)
+	}
+	if idle := server.idleSince(later); idle != 0 {
+		t.Errorf("idle with a session = %s, want 0", idle)
+	}
+	server.unregisterTerminal(id)
+	if idle := server.idleSince(time.Now()); idle > time.Second {
+		t.Errorf("idle right after the session ended = %s", idle)
+	}
+
+	// 探针请求不算活动
+	server.lastActive.Store(time.Now().Add(-time.Hour).UnixNano())
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if idle := server.idleSince(time.Now()); idle < time.Hour {
+		t.Errorf("probe reset the idle timer: idle = %s", idle)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/servers", nil)
+	req.Header.Set("Authorization", "Bearer bob-token")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if idle := server.idleSince(time.Now()); idle > time.Second {
+		t.Errorf("API request did not reset the idle timer: idle = %s", idle)
+	}
+}
+
+func TestIdleExitLoop(t *testing.T) {
+	server, _ := newAuthTestServer(t)
+	server.SetIdleExit(10 * time.Millisecond)
+	server.lastActive.Store(time.Now().Add(-time.Hour).UnixNano())
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		server.idleExitLoop(ctx, stop)
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle server did not stop")
+	}
+	<-done
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// ImportSSHRequest 导入 OpenSSH 配置的请求
+type ImportSSHRequest struct {
+	Content string   `json:"content,omitempty"` // 配置内容（如浏览器上传的文件），为空时读取运行 gmssh 的用户的 ~/.ssh/config
+	Hosts   []string `json:"hosts,omitempty"`   // 只导入这些别名及它们的网关，为空时导入全部
+	DryRun  bool     `json:"dry_run,omitempty"`
+}
+
+// handleImportSSH GET 预览 ~/.ssh/config 中可导入的主机，POST 导入 (/api/config/import-ssh，仅管理员)
+func (s *Server) handleImportSSH(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var req ImportSSHRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.DryRun = true
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var hops []*types.Hop
+	var path string
+	var err error
+	if req.Content != "" {
+		hops, err = config.ParseSSHConfig(strings.NewReader(req.Content))
+	} else {
+		hops, path, err = config.ReadSSHConfigFile("")
+	}
+	if err == nil {
+		hops, err = config.SelectSSHHosts(hops, req.Hosts)
+	}
+	if err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_SSH_CONFIG", err)
+		return
+	}
+
+	result, err := s.manager.ImportSSHHosts(hops, req.DryRun)
+	if err != nil {
+		failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
+		return
+	}
+	result.Path = path
+	if !req.DryRun {
+		log.Printf("[Config] Imported %d servers from ssh config (%d skipped)", len(result.Imported), len(result.Skipped))
+		s.recordAudit(audit.Event{
+			RequestID: requestID(r),
+			User:      currentUser(r).Name,
+			Action:    "config.import_ssh",
+			Target:    fmt.Sprintf("found=%d imported=%d skipped=%d", result.Found, len(result.Imported), len(result.Skipped)),
+		})
+	}
+	jsonResponse(w, http.StatusOK, result)
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/keys"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// GenerateKeyRequest 生成密钥请求，密钥写入运行 Web 服务的机器
+type GenerateKeyRequest struct {
+	Type      string `json:"type,omitempty"` // ed25519（默认）、rsa 或 ecdsa
+	Bits      int    `json:"bits,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	Path      string `json:"path,omitempty"` // 私钥路径，默认 ~/.ssh/hssh_<type>
+	Overwrite bool   `json:"overwrite,omitempty"`
+}
+
+// GenerateKeyResponse 生成的密钥
+type GenerateKeyResponse struct {
+	Path        string `json:"path"`
+	Type        string `json:"type"`
+	PublicKey   string `json:"public_key"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// DeployKeyRequest 部署公钥请求
+type DeployKeyRequest struct {
+	KeyPath    string `json:"key_path,omitempty"`    // 私钥路径，默认 ~/.ssh/hssh_ed25519，公钥取 <key_path>.pub
+	SwitchAuth bool   `json:"switch_auth,omitempty"` // 用密钥登录验证成功后把服务器改为密钥认证
+}
+
+// DeployKeyResponse 部署结果
+type DeployKeyResponse struct {
+	Fingerprint string     `json:"fingerprint"`
+	Switched    bool       `json:"switched"`
+	Server      *types.Hop `json:"server"`
+}
+
+// RotateKeysRequest 密钥轮换请求
+type RotateKeysRequest struct {
+	IDs      []string `json:"ids,omitempty"` // 要轮换的服务器 ID
+	All      bool     `json:"all,omitempty"` // 轮换全部服务器，与 ids 二选一
+	Type     string   `json:"type,omitempty"`
+	Bits     int      `json:"bits,omitempty"`
+	Path     string   `json:"path,omitempty"`     // 新私钥路径，默认 ~/.ssh/hssh_<type>_<时间>
+	Parallel int      `json:"parallel,omitempty"` // 同时轮换的服务器数，默认 8，最多 32
+}
+
+// RotateKeysResponse 密钥轮换结果，results 与请求的 ids（或配置中的服务器）顺序一致
+type RotateKeysResponse struct {
+	Key     GenerateKeyResponse `json:"key"`
+	OK      int                 `json:"ok"`
+	Failed  int                 `json:"failed"`
+	Results []keys.RotateResult `json:"results"`
+}
+
+// handleGenerateKey 生成 SSH 密钥对 (POST /api/keys/generate)
+func (s *Server) handleGenerateKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req GenerateKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	if req.Path == "" {
+		req.Path = keys.DefaultPath(req.Type)
+	}
+
+	kp, err := keys.Generate(req.Type, req.Bits, req.Comment)
+	if err != nil {
+		failure(w, r, http.StatusInternalServerError, "ERR_KEY_GENERATE", err)
+		return
+	}
+	if err := kp.Write(req.Path, req.Overwrite); err != nil {
+		failure(w, r, http.StatusInternalServerError, "ERR_KEY_GENERATE", err)
+		return
+	}
+	jsonResponse(w, http.StatusCreated, GenerateKeyResponse{
+		Path:        req.Path,
+		Type:        kp.Type,
+		PublicKey:   kp.PublicKey,
+		Fingerprint: kp.Fingerprint,
+	})
+}
+
+// handleDeployKey 以服务器现有的认证方式经网关链登录，把公钥追加到 authorized_keys，
+// 可选地验证密钥登录后改为密钥认证 (POST /api/servers/{id}/deploy-key)
+func (s *Server) handleDeployKey(w http.ResponseWriter, r *http.Request, hop *types.Hop) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req DeployKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	if req.KeyPath == "" {
+		req.KeyPath = keys.DefaultPath("")
+	}
+	line, fingerprint, err := keys.PublicKey(req.KeyPath)
+	if err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_KEY_READ", err)
+		return
+	}
+
+	hops := s.buildHopChain(hop.Name)
+	if len(hops) == 0 {
+		localizedError(w, r, http.StatusInternalServerError, "ERR_BUILD_CHAIN", hop.Name)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), hostInfoTimeout)
+	defer cancel()
+
+	if _, err := s.runOnChain(ctx, hops, keys.DeployCommand(line)); err != nil {
+		failure(w, r, http.StatusBadGateway, "ERR_KEY_DEPLOY", err)
+		return
+	}
+	resp := DeployKeyResponse{Fingerprint: fingerprint, Server: hop}
+	if !req.SwitchAuth {
+		jsonResponse(w, http.StatusOK, resp)
+		return
+	}
+
+	if err := keys.Verify(ctx, hops, req.KeyPath); err != nil {
+		localizedError(w, r, http.StatusBadGateway, "ERR_KEY_VERIFY", hop.Name, err)
+		return
+	}
+	updated := keys.WithKeyAuth(hop, req.KeyPath)
+	if err := s.manager.UpdateHop(hop.ID, updated); err != nil {
+		failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
+		return
+	}
+	resp.Switched, resp.Server = true, updated
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+// handleRotateKeys 生成新密钥并把选中的服务器轮换到新密钥：部署并验证新公钥，一次性保存配置，再删除旧公钥
+// (POST /api/keys/rotate)
+func (s *Server) handleRotateKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req RotateKeysRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	if req.Parallel < 0 || req.Parallel > maxCheckParallel {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "parallel", req.Parallel)
+		return
+	}
+	if !req.All && len(req.IDs) == 0 {
+		localizedError(w, r, http.StatusBadRequest, "ERR_ROTATE_TARGET_REQUIRED")
+		return
+	}
+	targets := s.config.Hops
+	if !req.All {
+		targets = make([]*types.Hop, 0, len(req.IDs))
+		for _, id := range req.IDs {
+			hop := s.config.GetHopByID(id)
+			if hop == nil {
+				localizedError(w, r, http.StatusBadRequest, "ERR_UNKNOWN_HOP", id)
+				return
+			}
+			targets = append(targets, hop)
+		}
+	}
+
+	if req.Path == "" {
+		req.Path = keys.DefaultPath(req.Type) + "_" + time.Now().Format("20060102-150405")
+	}
+	kp, err := keys.Generate(req.Type, req.Bits, "hssh-rotate")
+	if err != nil {
+		failure(w, r, http.StatusInternalServerError, "ERR_KEY_GENERATE", err)
+		return
+	}
+	if err := kp.Write(req.Path, false); err != nil {
+		failure(w, r, http.StatusInternalServerError, "ERR_KEY_GENERATE", err)
+		return
+	}
+
+	results, err := keys.NewRotator(req.Parallel).Rotate(r.Context(), targets, s.config.GatewayChain, req.Path, func(ids []string) error {
+		return s.manager.SetKeyAuth(ids, req.Path)
+	})
+	if err != nil {
+		failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
+		return
+	}
+
+	resp := RotateKeysResponse{
+		Key:     GenerateKeyResponse{Path: req.Path, Type: kp.Type, PublicKey: kp.PublicKey, Fingerprint: kp.Fingerprint},
+		Results: results,
+	}
+	for _, result := range results {
+		if result.OK {
+			resp.OK++
+		} else {
+			resp.Failed++
+		}
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestKeysValidation(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+	keyPath := filepath.Join(t.TempDir(), "hssh_ed25519")
+	body := `{"path": ` + strconv.Quote(keyPath) + `, "comment": "web"}`
+	missing := `{"key_path": ` + strconv.Quote(filepath.Join(t.TempDir(), "missing")) + `}`
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+		code   string
+	}{
+		{"generate wrong method", http.MethodGet, "/api/keys/generate", "alice-token", "", http.StatusMethodNotAllowed, ""},
+		{"generate requires admin", http.MethodPost, "/api/keys/generate", "bob-token", body, http.StatusForbidden, "ERR_ADMIN_REQUIRED"},
+		{"unsupported type", http.MethodPost, "/api/keys/generate", "alice-token", `{"type": "dsa"}`, http.StatusBadRequest, "ERR_UNSUPPORTED_KEY_TYPE"},
+		{"generate", http.MethodPost, "/api/keys/generate", "alice-token", body, http.StatusCreated, ""},
+		{"generate existing", http.MethodPost, "/api/keys/generate", "alice-token", body, http.StatusConflict, "ERR_KEY_EXISTS"},
+		{"rotate wrong method", http.MethodGet, "/api/keys/rotate", "alice-token", "", http.StatusMethodNotAllowed, ""},
+		{"rotate requires admin", http.MethodPost, "/api/keys/rotate", "bob-token", `{"all": true}`, http.StatusForbidden, "ERR_ADMIN_REQUIRED"},
+		{"rotate without targets", http.MethodPost, "/api/keys/rotate", "alice-token", `{}`, http.StatusBadRequest, "ERR_ROTATE_TARGET_REQUIRED"},
+		{"rotate unknown server", http.MethodPost, "/api/keys/rotate", "alice-token", `{"ids": ["missing"]}`, http.StatusBadRequest, "ERR_UNKNOWN_HOP"},
+		{"rotate parallel too high", http.MethodPost, "/api/keys/rotate", "alice-token", `{"all": true, "parallel": 99}`, http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"deploy wrong method", http.MethodGet, "/api/servers/hop-1/deploy-key", "alice-token", "", http.StatusMethodNotAllowed, ""},
+		{"deploy requires admin", http.MethodPost, "/api/servers/hop-1/deploy-key", "bob-token", `{}`, http.StatusForbidden, "ERR_ADMIN_REQUIRED"},
+		{"deploy invalid body", http.MethodPost, "/api/servers/hop-1/deploy-key", "alice-token", "{", http.StatusBadRequest, "ERR_INVALID_BODY"},
+		{"deploy missing key", http.MethodPost, "/api/servers/hop-1/deploy-key", "alice-token", missing, http.StatusBadRequest, "ERR_KEY_READ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.code == "" {
+				return
+			}
+			var resp map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if resp["code"] != tt.code {
+				t.Errorf("code = %q, want %q", resp["code"], tt.code)
+			}
+		})
+	}
+
+	pub, err := os.ReadFile(keyPath + ".pub")
+	if err != nil || !strings.HasPrefix(string(pub), "ssh-ed25519 ") || !strings.HasSuffix(string(pub), " web\n") {
+		t.Errorf("public key file = %q, err = %v", pub, err)
+	}
+}
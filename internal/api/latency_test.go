@@ -0,0 +1,30 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLatencyCompareRejectsUnknownHop(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+
+	body := `{"target": "hop-1", "candidates": [["missing-hop"]]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/metrics/latency", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer alice-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if resp["code"] != "ERR_UNKNOWN_HOP" {
+		t.Errorf("code = %q, want ERR_UNKNOWN_HOP", resp["code"])
+	}
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net/http"
+
+	internalSSH "github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// handleLoginMetrics 返回本进程内所有服务器的登录各阶段耗时 (GET /api/metrics/login)
+func (s *Server) handleLoginMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	jsonResponse(w, http.StatusOK, internalSSH.AllLoginTimings())
+}
+
+// handleServerLogin 返回服务器的登录各阶段耗时：TCP、密钥交换、认证、打开通道和启动 shell
+// (GET /api/servers/{id}/login)
+func (s *Server) handleServerLogin(w http.ResponseWriter, r *http.Request, hop *types.Hop) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	jsonResponse(w, http.StatusOK, internalSSH.LoginTimings(hop))
+}
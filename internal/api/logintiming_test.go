@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	internalSSH "github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestLoginTimings(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+	internalSSH.RecordLoginPhase(&types.Hop{ID: "hop-1", Name: "web-1"}, internalSSH.PhaseAuth, 40*time.Millisecond)
+	internalSSH.RecordLoginPhase(&types.Hop{ID: "hop-1", Name: "web-1"}, internalSSH.PhaseAuth, 20*time.Millisecond)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"server", http.MethodGet, "/api/servers/hop-1/login", http.StatusOK},
+		{"server wrong method", http.MethodPost, "/api/servers/hop-1/login", http.StatusMethodNotAllowed},
+		{"unknown server", http.MethodGet, "/api/servers/missing/login", http.StatusNotFound},
+		{"all", http.MethodGet, "/api/metrics/login", http.StatusOK},
+		{"all wrong method", http.MethodDelete, "/api/metrics/login", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer bob-token")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/servers/hop-1/login", nil)
+	req.Header.Set("Authorization", "Bearer bob-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var stats internalSSH.LoginStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	auth := stats.Phases[internalSSH.PhaseAuth]
+	if stats.Logins != 2 || auth.Count != 2 || auth.LastMs != 20 || auth.AvgMs != 30 || auth.MaxMs != 40 {
+		t.Errorf("unexpected stats: %s", rec.Body.String())
+	}
+	if _, ok := stats.Phases[internalSSH.PhaseShell]; ok {
+		t.Errorf("unrecorded phase in response: %s", rec.Body.String())
+	}
+}
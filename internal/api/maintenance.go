@@ -0,0 +1,302 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/i18n"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// maintenanceCheckInterval 检查维护窗口开始（关闭已有会话）和结束（移除窗口）的间隔
+const maintenanceCheckInterval = 30 * time.Second
+
+// MaintenanceRequest 创建维护窗口的请求
+type MaintenanceRequest struct {
+	Servers  []string  `json:"servers,omitempty"`  // 服务器 ID 或名称
+	Tags     []string  `json:"tags,omitempty"`     // 带有任一标签的服务器
+	Start    time.Time `json:"start,omitempty"`    // 为空时立即开始
+	End      time.Time `json:"end,omitempty"`      // 与 duration 二选一
+	Duration string    `json:"duration,omitempty"` // 如 "2h"，从 start 起算
+	Message  string    `json:"message,omitempty"`
+	Drain    bool      `json:"drain,omitempty"` // 窗口开始时关闭已有终端会话
+}
+
+// MaintenanceInfo 维护窗口及其当前状态
+type MaintenanceInfo struct {
+	*types.MaintenanceWindow
+	Active bool `json:"active"`
+}
+
+// handleMaintenance GET 列出维护窗口，POST 创建（仅管理员）
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		now := time.Now()
+		s.maintenanceMu.RLock()
+		list := make([]MaintenanceInfo, 0, len(s.config.Maintenance))
+		for _, window := range s.config.Maintenance {
+			list = append(list, MaintenanceInfo{MaintenanceWindow: window, Active: window.ActiveAt(now)})
+		}
+		s.maintenanceMu.RUnlock()
+		jsonResponse(w, http.StatusOK, list)
+
+	case http.MethodPost:
+		if !requireAdmin(w, r) {
+			return
+		}
+		var req MaintenanceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+			return
+		}
+		window, err := s.newMaintenanceWindow(req)
+		if err != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_MAINTENANCE", err)
+			return
+		}
+		window.CreatedBy = currentUser(r).Name
+
+		s.maintenanceMu.Lock()
+		s.config.Maintenance = append(s.config.Maintenance, window)
+		err = s.manager.Save()
+		s.maintenanceMu.Unlock()
+		if err != nil {
+			failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
+			return
+		}
+		log.Printf("[Maintenance] Window %s created by %s: servers=%v tags=%v %s - %s",
+			window.ID, window.CreatedBy, window.Servers, window.Tags, window.Start.Format(time.RFC3339), window.End.Format(time.RFC3339))
+
+		// 已经开始的窗口立即关闭已有会话
+		s.drainMaintenance(time.Now())
+		jsonResponse(w, http.StatusCreated, MaintenanceInfo{MaintenanceWindow: window, Active: window.ActiveAt(time.Now())})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// newMaintenanceWindow 校验请求并创建维护窗口
+func (s *Server) newMaintenanceWindow(req MaintenanceRequest) (*types.MaintenanceWindow, error) {
+	if len(req.Servers) == 0 && len(req.Tags) == 0 {
+		return nil, fmt.Errorf("servers or tags required")
+	}
+	for _, name := range req.Servers {
+		if s.config.GetHopByID(name) == nil && s.config.GetHopByName(name) == nil {
+			return nil, fmt.Errorf("unknown server %q", name)
+		}
+	}
+
+	start := req.Start
+	if start.IsZero() {
+		start = time.Now()
+	}
+	end := req.End
+	if req.Duration != "" {
+		if !end.IsZero() {
+			return nil, fmt.Errorf("set either end or duration")
+		}
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration %q", req.Duration)
+		}
+		end = start.Add(d)
+	}
+	if end.IsZero() {
+		return nil, fmt.Errorf("end or duration required")
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("end must be after start")
+	}
+	if !end.After(time.Now()) {
+		return nil, fmt.Errorf("window already ended")
+	}
+
+	return &types.MaintenanceWindow{
+		ID:      uuid.New().String(),
+		Servers: req.Servers,
+		Tags:    req.Tags,
+		Start:   start,
+		End:     end,
+		Message: req.Message,
+		Drain:   req.Drain,
+	}, nil
+}
+
+// handleMaintenanceDetail GET 查看、DELETE 提前结束维护窗口 (/api/maintenance/{id})
+func (s *Server) handleMaintenanceDetail(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/maintenance/")
+
+	s.maintenanceMu.RLock()
+	i := slices.IndexFunc(s.config.Maintenance, func(window *types.MaintenanceWindow) bool { return window.ID == id })
+	var window *types.MaintenanceWindow
+	if i >= 0 {
+		window = s.config.Maintenance[i]
+	}
+	s.maintenanceMu.RUnlock()
+	if window == nil {
+		localizedError(w, r, http.StatusNotFound, "ERR_MAINTENANCE_NOT_FOUND")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		jsonResponse(w, http.StatusOK, MaintenanceInfo{MaintenanceWindow: window, Active: window.ActiveAt(time.Now())})
+	case http.MethodDelete:
+		if !requireAdmin(w, r) {
+			return
+		}
+		s.maintenanceMu.Lock()
+		s.config.Maintenance = slices.DeleteFunc(s.config.Maintenance, func(m *types.MaintenanceWindow) bool { return m.ID == id })
+		err := s.manager.Save()
+		s.maintenanceMu.Unlock()
+		if err != nil {
+			failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]string{"status": "deleted"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// activeMaintenance 返回此刻覆盖 hops 中任一服务器的维护窗口和被覆盖的服务器
+func (s *Server) activeMaintenance(hops []*types.Hop) (*types.MaintenanceWindow, *types.Hop) {
+	s.maintenanceMu.RLock()
+	defer s.maintenanceMu.RUnlock()
+	return s.config.MaintenanceFor(hops, time.Now())
+}
+
+// maintenanceMessage 维护窗口拒绝新会话时给用户的说明
+func maintenanceMessage(lang i18n.Lang, window *types.MaintenanceWindow, hop *types.Hop) string {
+	return i18n.T(lang, "ERR_MAINTENANCE", hop.Name, window.End.Format(time.RFC3339), maintenanceNote(window))
+}
+
+// maintenanceNote 附在错误消息后的窗口说明
+func maintenanceNote(window *types.MaintenanceWindow) string {
+	if window.Message == "" {
+		return ""
+	}
+	return ": " + window.Message
+}
+
+// checkMaintenance 目标或经过的服务器处于维护窗口时写入 423 响应并返回 false。
+// names 为服务器 ID、名称或地址，按上传的规则展开网关链
+func (s *Server) checkMaintenance(w http.ResponseWriter, r *http.Request, names ...string) bool {
+	var hops []*types.Hop
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		hop := s.config.GetHopByID(name)
+		if hop == nil {
+			hop = s.config.GetHopByName(name)
+		}
+		if hop == nil {
+			for _, h := range s.config.Hops {
+				if h.Host == name {
+					hop = h
+					break
+				}
+			}
+		}
+		if hop != nil {
+			hops = append(hops, s.config.GatewayChain(hop)...)
+		}
+	}
+	window, hop := s.activeMaintenance(hops)
+	if window == nil {
+		return true
+	}
+	localizedError(w, r, http.StatusLocked, "ERR_MAINTENANCE", hop.Name, window.End.Format(time.RFC3339), maintenanceNote(window))
+	return false
+}
+
+// maintenanceLoop 定期关闭已开始的 drain 窗口覆盖的终端会话，并移除已结束的窗口
+func (s *Server) maintenanceLoop(ctx context.Context) {
+	ticker := time.NewTicker(maintenanceCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		s.drainMaintenance(now)
+		s.pruneMaintenance(now)
+	}
+}
+
+// drainMaintenance 关闭 now 时生效且设置了 drain 的窗口覆盖的终端会话，返回关闭的数量
+func (s *Server) drainMaintenance(now time.Time) int {
+	s.maintenanceMu.RLock()
+	var draining []*types.MaintenanceWindow
+	for _, window := range s.config.Maintenance {
+		if window.Drain && window.ActiveAt(now) {
+			draining = append(draining, window)
+		}
+	}
+	s.maintenanceMu.RUnlock()
+	if len(draining) == 0 {
+		return 0
+	}
+
+	var closers []func()
+	s.terminalsMu.RLock()
+	for id, entry := range s.terminals {
+		names := entry.info.Chain
+		if len(names) == 0 {
+			names = []string{entry.info.Server}
+		}
+		for _, window := range draining {
+			if s.coversAny(window, names) {
+				log.Printf("[Maintenance] Closing session %s on %s for window %s", id, entry.info.Server, window.ID)
+				closers = append(closers, entry.close)
+				s.recordAudit(audit.Event{User: entry.info.Owner, Action: "maintenance.drain", Target: id})
+				break
+			}
+		}
+	}
+	s.terminalsMu.RUnlock()
+
+	for _, close := range closers {
+		close()
+	}
+	return len(closers)
+}
+
+// coversAny 窗口是否覆盖名称列表中的任一服务器
+func (s *Server) coversAny(window *types.MaintenanceWindow, names []string) bool {
+	for _, name := range names {
+		if hop := s.config.GetHopByName(name); hop != nil && window.Covers(hop) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneMaintenance 移除 now 之前已结束的窗口
+func (s *Server) pruneMaintenance(now time.Time) {
+	s.maintenanceMu.Lock()
+	defer s.maintenanceMu.Unlock()
+	n := len(s.config.Maintenance)
+	s.config.Maintenance = slices.DeleteFunc(s.config.Maintenance, func(window *types.MaintenanceWindow) bool {
+		return !now.Before(window.End)
+	})
+	if len(s.config.Maintenance) == n {
+		return
+	}
+	if err := s.manager.Save(); err != nil {
+		log.Printf("[Maintenance] Error saving config after removing ended windows: %v", err)
+	}
+}
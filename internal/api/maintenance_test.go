@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	if err := server.manager.AddHop(&types.Hop{ID: "hop-2", Name: "db-1", Host: "10.0.0.5", Port: 22, User: "root", Tags: []string{"prod", "db"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	initUpload := func(host string) *httptest.ResponseRecorder {
+		return do(http.MethodPost, "/api/upload/init", "bob-token", `{"file_name": "a.bin", "size": 1, "target_host": "`+host+`", "target_path": "/tmp"}`)
+	}
+
+	if rec := do(http.MethodPost, "/api/maintenance", "bob-token", `{"tags": ["db"], "duration": "1h"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("user create: expected 403, got %d", rec.Code)
+	}
+	for _, body := range []string{
+		`{"duration": "1h"}`,
+		`{"servers": ["nope"], "duration": "1h"}`,
+		`{"tags": ["db"]}`,
+		`{"tags": ["db"], "duration": "-1h"}`,
+	} {
+		if rec := do(http.MethodPost, "/api/maintenance", "alice-token", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("create %s: expected 400, got %d", body, rec.Code)
+		}
+	}
+
+	// drain 窗口立即关闭已有会话
+	closed := false
+	server.registerTerminal(server.lookupUser("bob-token"), "db-1", nil, func() { closed = true })
+	server.registerTerminal(server.lookupUser("bob-token"), "web-1", nil, func() { t.Error("web-1 session should stay open") })
+
+	rec := do(http.MethodPost, "/api/maintenance", "alice-token", `{"tags": ["db"], "duration": "1h", "message": "disk swap", "drain": true}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created MaintenanceInfo
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if !created.Active || created.CreatedBy != "alice" || !closed {
+		t.Errorf("unexpected window %+v (drained=%v)", created.MaintenanceWindow, closed)
+	}
+
+	rec = initUpload("db-1")
+	if rec.Code != http.StatusLocked || !strings.Contains(rec.Body.String(), "ERR_MAINTENANCE") || !strings.Contains(rec.Body.String(), "disk swap") {
+		t.Errorf("upload to db-1: expected 423 with the message, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := initUpload("web-1"); rec.Code != http.StatusCreated {
+		t.Errorf("upload to web-1: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// 未开始的窗口不拦截
+	start := time.Now().Add(time.Hour).Format(time.RFC3339)
+	if rec := do(http.MethodPost, "/api/maintenance", "alice-token", `{"servers": ["web-1"], "start": "`+start+`", "duration": "1h"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("create future window: expected 201, got %d", rec.Code)
+	}
+	if rec := initUpload("web-1"); rec.Code != http.StatusCreated {
+		t.Errorf("upload before the window starts: expected 201, got %d", rec.Code)
+	}
+
+	var list []MaintenanceInfo
+	json.Unmarshal(do(http.MethodGet, "/api/maintenance", "bob-token", "").Body.Bytes(), &list)
+	if len(list) != 2 || !list[0].Active || list[1].Active {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+
+	if rec := do(http.MethodDelete, "/api/maintenance/"+created.ID, "bob-token", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("user delete: expected 403, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/maintenance/"+created.ID, "alice-token", ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/maintenance/"+created.ID, "alice-token", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("deleted window: expected 404, got %d", rec.Code)
+	}
+	if rec := initUpload("db-1"); rec.Code != http.StatusCreated {
+		t.Errorf("upload after the window is removed: expected 201, got %d", rec.Code)
+	}
+
+	server.pruneMaintenance(time.Now().Add(3 * time.Hour))
+	if n := len(server.config.Maintenance); n != 0 {
+		t.Errorf("%d ended windows left after prune", n)
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestServerNotesSearch(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	for _, hop := range []*types.Hop{
+		{ID: "hop-db", Name: "db-1", Host: "10.0.0.5", Port: 22, User: "root", Notes: &types.HopNotes{Owner: "DBA team", Location: "rack B3"}},
+		{ID: "hop-web", Name: "web-1", Host: "10.0.0.6", Port: 22, User: "root", Tags: []string{"frontend"}},
+	} {
+		if err := server.manager.AddHop(hop); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer alice-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	search := func(q string) []string {
+		rec := do(http.MethodGet, "/api/servers?q="+q, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("search %q: expected 200, got %d: %s", q, rec.Code, rec.Body.String())
+		}
+		var hops []*types.Hop
+		if err := json.Unmarshal(rec.Body.Bytes(), &hops); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, hop := range hops {
+			names = append(names, hop.Name)
+		}
+		return names
+	}
+
+	if names := search("dba+b3"); len(names) != 1 || names[0] != "db-1" {
+		t.Errorf("search by notes: got %v", names)
+	}
+	if names := search("FRONTEND"); len(names) != 1 || names[0] != "web-1" {
+		t.Errorf("search by tag: got %v", names)
+	}
+	if names := search("nothing"); len(names) != 0 {
+		t.Errorf("search without match: got %v", names)
+	}
+
+	// 运维手册必须是 http(s) 链接
+	if rec := do(http.MethodPut, "/api/servers/hop-web", `{"notes": {"runbook": "file:///etc/passwd"}}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "ERR_INVALID_NOTES") {
+		t.Errorf("invalid runbook: expected 400 ERR_INVALID_NOTES, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPut, "/api/servers/hop-web", `{"notes": {"runbook": "https://wiki.example.com/web", "owner": "web team"}}`); rec.Code != http.StatusOK {
+		t.Fatalf("set notes: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if names := search("wiki.example.com"); len(names) != 1 || names[0] != "web-1" {
+		t.Errorf("search by runbook: got %v", names)
+	}
+
+	// 不带 notes 的更新保留原值，{} 清空
+	if rec := do(http.MethodPut, "/api/servers/hop-web", `{"port": 2222}`); rec.Code != http.StatusOK {
+		t.Fatalf("update port: expected 200, got %d", rec.Code)
+	}
+	if hop := server.config.GetHopByID("hop-web"); hop.Notes == nil || hop.Notes.Owner != "web team" {
+		t.Errorf("notes lost on unrelated update: %+v", hop.Notes)
+	}
+	if rec := do(http.MethodPut, "/api/servers/hop-web", `{"notes": {}}`); rec.Code != http.StatusOK {
+		t.Fatalf("clear notes: expected 200, got %d", rec.Code)
+	}
+	if hop := server.config.GetHopByID("hop-web"); hop.Notes != nil {
+		t.Errorf("notes not cleared: %+v", hop.Notes)
+	}
+}
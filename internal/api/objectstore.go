@@ -0,0 +1,38 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/luobobo896/HSSH/internal/transfer"
+)
+
+// objectTarget target_path 为 s3://、oss:// 或预签名 URL 时解析为对象存储目标，
+// 由 target_host 上的工具上传；其他路径返回 nil
+func objectTarget(targetPath string, isDir bool) (*transfer.ObjectTarget, error) {
+	if !transfer.IsObjectURL(targetPath) {
+		return nil, nil
+	}
+	if isDir {
+		return nil, errors.New("directories cannot be uploaded to object storage")
+	}
+	target, err := transfer.ParseObjectURL(targetPath)
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// stagedFile 单文件上传的暂存目录中唯一的文件
+func stagedFile(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) != 1 || entries[0].IsDir() {
+		return "", fmt.Errorf("expected a single staged file, found %d entries", len(entries))
+	}
+	return filepath.Join(dir, entries[0].Name()), nil
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/luobobo896/HSSH/internal/i18n"
+	"github.com/luobobo896/HSSH/internal/remotefile"
+	"github.com/luobobo896/HSSH/pkg/types"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// overwriteConfirmResponse 覆盖远端已有文件前的确认响应：diff 为远端现有内容到新内容的 unified diff，
+// 客户端确认后带 force=1 重新提交
+type overwriteConfirmResponse struct {
+	Error    string `json:"error"`
+	Code     string `json:"code"`
+	Path     string `json:"path"`
+	Checksum string `json:"checksum,omitempty"` // 远端现有内容的 sha256
+	Diff     string `json:"diff,omitempty"`
+	Binary   bool   `json:"binary,omitempty"`    // 有一方不是文本，无法给出 diff
+	TooLarge bool   `json:"too_large,omitempty"` // 有一方超过 remotefile.MaxEditSize，无法给出 diff
+}
+
+// wantsOverwriteDiff 请求带 diff=1 且没有 force=1 时，覆盖已有文件前先返回 diff 供确认
+func wantsOverwriteDiff(r *http.Request) bool {
+	q := r.URL.Query()
+	diff, _ := strconv.ParseBool(q.Get("diff"))
+	force, _ := strconv.ParseBool(q.Get("force"))
+	return diff && !force
+}
+
+// confirmOverwrite 读取远端 path 与 content 比较，远端文件存在且内容不同时写入 409 ERR_OVERWRITE_CONFIRM。
+// 已写入响应（包括读取失败）时返回 true；文件不存在、不是普通文件或内容相同时返回 false，由调用方继续写入
+func (s *Server) confirmOverwrite(ctx context.Context, w http.ResponseWriter, r *http.Request, hops []*types.Hop, path string, content []byte, tooLarge bool) bool {
+	out, err := s.runOnChain(ctx, hops, remotefile.ReadCommand(path, remotefile.MaxEditSize))
+	var exit *gossh.ExitError
+	if errors.As(err, &exit) {
+		err = remotefile.Failed(exit.ExitStatus(), err)
+	}
+	resp := overwriteConfirmResponse{Code: "ERR_OVERWRITE_CONFIRM", Path: path, TooLarge: tooLarge}
+	switch {
+	case errors.Is(err, remotefile.ErrNotFound), errors.Is(err, remotefile.ErrNotRegular):
+		return false
+	case errors.Is(err, remotefile.ErrTooLarge):
+		resp.TooLarge = true
+	case err != nil:
+		failure(w, r, http.StatusBadGateway, "ERR_OVERWRITE_DIFF_FAILED", err)
+		return true
+	case !tooLarge && string(out) == string(content):
+		return false
+	case tooLarge:
+		resp.Checksum = remotefile.Checksum(out)
+	case remotefile.CheckText(out) != nil || remotefile.CheckText(content) != nil:
+		resp.Checksum = remotefile.Checksum(out)
+		resp.Binary = true
+	default:
+		resp.Checksum = remotefile.Checksum(out)
+		resp.Diff = remotefile.Unified("a"+path, "b"+path, out, content)
+	}
+	lang := requestLang(r)
+	w.Header().Set("Content-Language", string(lang))
+	resp.Error = i18n.T(lang, "ERR_OVERWRITE_CONFIRM", path)
+	jsonResponse(w, http.StatusConflict, resp)
+	return true
+}
+
+// confirmUploadOverwrite 单文件上传的覆盖确认：暂存目录中唯一的文件将写到 targetPath/<文件名>
+func (s *Server) confirmUploadOverwrite(w http.ResponseWriter, r *http.Request, stagedDir, targetHost, targetPath string, via []string) bool {
+	file, err := stagedFile(stagedDir)
+	if err != nil {
+		failure(w, r, http.StatusInternalServerError, ErrInternal, err)
+		return true
+	}
+	hops := s.uploadHops(requestLogger(requestID(r)), targetHost, via)
+	if hops == nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_GATEWAY_REQUIRED", targetHost)
+		return true
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		failure(w, r, http.StatusInternalServerError, ErrInternal, err)
+		return true
+	}
+	var content []byte
+	tooLarge := info.Size() > remotefile.MaxEditSize
+	if !tooLarge {
+		if content, err = os.ReadFile(file); err != nil {
+			failure(w, r, http.StatusInternalServerError, ErrInternal, err)
+			return true
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), editTimeout)
+	defer cancel()
+	return s.confirmOverwrite(ctx, w, r, hops, filepath.Join(targetPath, info.Name()), content, tooLarge)
+}
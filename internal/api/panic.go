@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+)
+
+// PanicResult 紧急停止的结果，各项为停止的数量
+type PanicResult struct {
+	Proxies        int `json:"proxies"`
+	PortalMappings int `json:"portal_mappings"`
+	AgentForwards  int `json:"agent_forwards"`
+	Sessions       int `json:"sessions"`
+	Uploads        int `json:"uploads"`
+	Chains         int `json:"chains"`
+}
+
+// handlePanic 紧急停止 (POST /api/panic，仅管理员)：停止所有代理、Portal 映射和 agent 转发，
+// 关闭所有终端会话，取消进行中的上传，断开连接池中的所有链，并写入审计日志。
+// 服务本身继续运行，之后可以重新建立隧道
+func (s *Server) handlePanic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	result := s.panicStop()
+	log.Printf("[PANIC] Emergency stop by %s: %+v", currentUser(r).Name, result)
+	s.recordAudit(audit.Event{
+		RequestID: requestID(r),
+		User:      currentUser(r).Name,
+		Action:    "panic",
+		Target: fmt.Sprintf("proxies=%d portal_mappings=%d agent_forwards=%d sessions=%d uploads=%d chains=%d",
+			result.Proxies, result.PortalMappings, result.AgentForwards, result.Sessions, result.Uploads, result.Chains),
+	})
+	jsonResponse(w, http.StatusOK, result)
+}
+
+// panicStop 停止所有隧道和传输，返回各项停止的数量
+func (s *Server) panicStop() PanicResult {
+	var result PanicResult
+
+	// 被取消的上传以失败结束，结果由 auditUpload 另行记录
+	s.mu.Lock()
+	for _, cancel := range s.uploadCancels {
+		cancel()
+		result.Uploads++
+	}
+	s.mu.Unlock()
+
+	s.terminalsMu.RLock()
+	closers := make([]func(), 0, len(s.terminals))
+	for _, entry := range s.terminals {
+		if entry.close != nil {
+			closers = append(closers, entry.close)
+		}
+	}
+	s.terminalsMu.RUnlock()
+	for _, close := range closers {
+		close()
+	}
+	result.Sessions = len(closers)
+
+	for id := range s.proxies.List() {
+		if err := s.proxies.Remove(id); err == nil {
+			s.owners.remove(ownerKindProxy, id)
+			result.Proxies++
+		}
+	}
+
+	// 映射标记为停用，重启后也不会自动恢复
+	s.portalMu.Lock()
+	for id, fwd := range s.portalForwarders {
+		fwd.Stop()
+		delete(s.portalForwarders, id)
+		result.PortalMappings++
+	}
+	s.stopDrainingMappings()
+	s.portalMu.Unlock()
+	disabled := false
+	for i := range s.config.Portal.Client.Mappings {
+		if s.config.Portal.Client.Mappings[i].Enabled {
+			s.config.Portal.Client.Mappings[i].Enabled = false
+			disabled = true
+		}
+	}
+	if disabled {
+		if err := s.manager.Save(); err != nil {
+			log.Printf("[PANIC] Error saving config after disabling portal mappings: %v", err)
+		}
+	}
+
+	if s.agents != nil {
+		for _, f := range s.agents.Forwards() {
+			if err := s.agents.StopForward(f.ID); err == nil {
+				s.owners.remove(ownerKindAgentForward, f.ID)
+				result.AgentForwards++
+			}
+		}
+	}
+
+	result.Chains = s.chainPool.DisconnectAll()
+	return result
+}
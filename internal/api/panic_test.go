@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestPanicStopsEverything(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+
+	closed := 0
+	server.registerTerminal(server.lookupUser("bob-token"), "web-1", nil, func() { closed++ })
+	server.registerTerminal(server.lookupUser("carol-token"), "web-2", nil, func() { closed++ })
+	canceled := false
+	server.mu.Lock()
+	server.uploadCancels["upload-1"] = func() { canceled = true }
+	server.mu.Unlock()
+	server.config.Portal.Client.Mappings = append(server.config.Portal.Client.Mappings,
+		types.PortMapping{ID: "m1", Name: "db", LocalAddr: "127.0.0.1:15432", RemoteHost: "db", RemotePort: 5432, Enabled: true})
+
+	do := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/panic", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("bob-token"); rec.Code != http.StatusForbidden || closed != 0 {
+		t.Fatalf("user panic: expected 403, got %d (closed=%d)", rec.Code, closed)
+	}
+
+	rec := do("alice-token")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin panic: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result PanicResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if result.Sessions != 2 || result.Uploads != 1 || closed != 2 || !canceled {
+		t.Errorf("unexpected result %+v (closed=%d, canceled=%v)", result, closed, canceled)
+	}
+	if server.config.Portal.Client.Mappings[0].Enabled {
+		t.Error("portal mappings should be disabled")
+	}
+
+	data, err := os.ReadFile(filepath.Join(server.config.ConfigDir, audit.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"action":"panic"`) || !strings.Contains(string(data), `"user":"alice"`) {
+		t.Errorf("audit log should record the panic, got %s", data)
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/luobobo896/HSSH/internal/profiler"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// learnedParam 解析请求的 learned 参数：为空或无法解析时为 true（沿用 playbook）
+func learnedParam(value string) bool {
+	learned, err := strconv.ParseBool(value)
+	return err != nil || learned
+}
+
+// playbookFor 返回 hop 的 playbook 副本，未配置的目标或没有学到参数时返回 nil
+func (s *Server) playbookFor(hop *types.Hop) *types.Playbook {
+	if hop == nil || hop.ID == "" {
+		return nil
+	}
+	s.playbookMu.Lock()
+	defer s.playbookMu.Unlock()
+	return s.config.PlaybookFor(hop)
+}
+
+// updatePlaybook 在锁内修改 config.Playbooks 并保存配置，保存失败只记录日志
+func (s *Server) updatePlaybook(update func()) {
+	s.playbookMu.Lock()
+	defer s.playbookMu.Unlock()
+	update()
+	if err := s.manager.Save(); err != nil {
+		log.Printf("[Playbook] Failed to save playbooks: %v", err)
+	}
+}
+
+// learnedVia 返回 hop 学到的跳板链（服务器 ID）；直连最快、没有记录或链中的服务器已删除时返回 nil
+func (s *Server) learnedVia(hop *types.Hop) []string {
+	playbook := s.playbookFor(hop)
+	if playbook == nil || len(playbook.Via) == 0 {
+		return nil
+	}
+	if _, unknown := s.probeVia(playbook.Via); unknown != "" {
+		return nil
+	}
+	return playbook.Via
+}
+
+// learnRoute 把多路径对比中最快的可达路径记入目标 playbook
+func (s *Server) learnRoute(target *types.Hop, results []*profiler.CandidateResult, vias map[string][]string) {
+	if target.ID == "" || len(results) == 0 || !results[0].Reachable() {
+		return
+	}
+	best := results[0]
+	via, ok := vias[best.Label]
+	if !ok {
+		return
+	}
+	log.Printf("[Playbook] Learned route to %s: %s (%v)", target.Name, best.Label, best.Latency)
+	s.updatePlaybook(func() { s.config.LearnVia(target, via, best.Latency) })
+}
+
+// handlePlaybooks GET 列出各目标学到的跳板链和传输参数，DELETE 清除全部（仅管理员，
+// ?reset=via|tuning 只清除该项）
+func (s *Server) handlePlaybooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.playbookMu.Lock()
+		list := s.config.PlaybookList()
+		s.playbookMu.Unlock()
+		jsonResponse(w, http.StatusOK, list)
+
+	case http.MethodDelete:
+		if !requireAdmin(w, r) {
+			return
+		}
+		field, ok := playbookField(w, r)
+		if !ok {
+			return
+		}
+		s.playbookMu.Lock()
+		for _, playbook := range s.config.PlaybookList() {
+			s.config.ResetPlaybook(playbook.ServerID, field)
+		}
+		if field == "" {
+			// 同时清除已删除服务器遗留的记录
+			s.config.Playbooks = nil
+		}
+		err := s.manager.Save()
+		s.playbookMu.Unlock()
+		if err != nil {
+			failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]string{"status": "reset"})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePlaybookDetail GET 返回单个目标（ID 或名称）的 playbook，DELETE 清除（仅管理员，
+// ?reset=via|tuning 只清除该项）(/api/playbooks/{server})
+func (s *Server) handlePlaybookDetail(w http.ResponseWriter, r *http.Request) {
+	server := strings.TrimPrefix(r.URL.Path, "/api/playbooks/")
+	hop := s.config.GetHopByID(server)
+	if hop == nil {
+		hop = s.config.GetHopByName(server)
+	}
+	if hop == nil {
+		localizedError(w, r, http.StatusNotFound, "ERR_HOP_NOT_FOUND")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		playbook := s.playbookFor(hop)
+		if playbook == nil {
+			localizedError(w, r, http.StatusNotFound, "ERR_PLAYBOOK_NOT_FOUND", hop.Name)
+			return
+		}
+		jsonResponse(w, http.StatusOK, playbook)
+
+	case http.MethodDelete:
+		if !requireAdmin(w, r) {
+			return
+		}
+		field, ok := playbookField(w, r)
+		if !ok {
+			return
+		}
+		s.playbookMu.Lock()
+		found := s.config.ResetPlaybook(hop.ID, field)
+		var err error
+		if found {
+			err = s.manager.Save()
+		}
+		s.playbookMu.Unlock()
+		if !found {
+			localizedError(w, r, http.StatusNotFound, "ERR_PLAYBOOK_NOT_FOUND", hop.Name)
+			return
+		}
+		if err != nil {
+			failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]string{"status": "reset"})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// playbookField 解析 ?reset=，为空表示全部清除
+func playbookField(w http.ResponseWriter, r *http.Request) (string, bool) {
+	field := r.URL.Query().Get("reset")
+	if field != "" && field != types.PlaybookVia && field != types.PlaybookTuning {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PLAYBOOK_FIELD", field)
+		return "", false
+	}
+	return field, true
+}
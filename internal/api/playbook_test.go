@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/profiler"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestPlaybooks(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	if err := server.manager.AddHop(&types.Hop{ID: "hop-2", Name: "jump", Host: "10.0.0.2", Port: 22, User: "root"}); err != nil {
+		t.Fatal(err)
+	}
+	do := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	web := server.config.GetHopByID("hop-1")
+
+	if rec := do(http.MethodGet, "/api/playbooks/web-1", "bob-token"); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "ERR_PLAYBOOK_NOT_FOUND") {
+		t.Errorf("empty playbook: expected 404, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// 多路径对比中最快的可达路径被记住，之后的上传默认沿用
+	server.learnRoute(web, []*profiler.CandidateResult{
+		{Label: "via jump", Received: 3, Latency: 20 * time.Millisecond},
+		{Label: "direct", Received: 0},
+	}, map[string][]string{"direct": nil, "via jump": {"hop-2"}})
+	if via := server.learnedVia(web); len(via) != 1 || via[0] != "hop-2" {
+		t.Errorf("learnedVia = %v", via)
+	}
+	if server.adaptiveUpload("", "web-1", true) {
+		t.Error("adaptive without learned tuning")
+	}
+	server.rememberTuning(web, &types.TransferTuning{Streams: 4, BufferSize: 1 << 20, Compress: true})
+	if !server.adaptiveUpload("", "web-1", true) || server.adaptiveUpload("", "web-1", false) || server.adaptiveUpload("false", "hop-1", true) {
+		t.Error("learned tuning should enable adaptive uploads unless overridden")
+	}
+	if tuning := server.learnedTuning(web); tuning == nil || tuning.Streams != 4 || !tuning.Compress {
+		t.Errorf("learnedTuning = %+v", tuning)
+	}
+
+	var list []types.Playbook
+	json.Unmarshal(do(http.MethodGet, "/api/playbooks", "bob-token").Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Server != "web-1" || list[0].Via[0] != "hop-2" || list[0].Tuning == nil {
+		t.Fatalf("playbooks = %+v", list)
+	}
+
+	if rec := do(http.MethodDelete, "/api/playbooks/web-1?reset=via", "bob-token"); rec.Code != http.StatusForbidden {
+		t.Errorf("user reset: expected 403, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/playbooks/web-1?reset=route", "alice-token"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "ERR_INVALID_PLAYBOOK_FIELD") {
+		t.Errorf("bad field: expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodDelete, "/api/playbooks/hop-1?reset=via", "alice-token"); rec.Code != http.StatusOK {
+		t.Fatalf("reset via: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if via := server.learnedVia(web); via != nil {
+		t.Errorf("via still learned: %v", via)
+	}
+	if server.learnedTuning(web) == nil {
+		t.Error("resetting via also cleared the tuning")
+	}
+
+	// 直连最快时不再经过跳板
+	server.learnRoute(web, []*profiler.CandidateResult{{Label: "direct", Received: 1}}, map[string][]string{"direct": nil})
+	if via := server.learnedVia(web); via != nil {
+		t.Errorf("direct route learned as %v", via)
+	}
+
+	if rec := do(http.MethodDelete, "/api/playbooks", "alice-token"); rec.Code != http.StatusOK {
+		t.Fatalf("reset all: expected 200, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/playbooks/web-1", "alice-token"); rec.Code != http.StatusNotFound {
+		t.Errorf("after reset: expected 404, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/playbooks/nope", "alice-token"); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "ERR_HOP_NOT_FOUND") {
+		t.Errorf("unknown server: expected 404, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -1,13 +1,17 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
 	"strings"
 
+	"github.com/luobobo896/HSSH/internal/events"
 	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/internal/resolver"
 	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/terminal"
 	"github.com/luobobo896/HSSH/pkg/types"
 	"github.com/google/uuid"
 )
@@ -21,6 +25,8 @@ type CreatePortalMappingRequest struct {
 	Via          []string `json:"via"`
 	Protocol     string   `json:"protocol"`
 	PortalServer string   `json:"portal_server,omitempty"`
+	Resolver     string   `json:"resolver,omitempty"`  // remote（默认）、system 或 dns:<server>
+	AllowLAN     bool     `json:"allow_lan,omitempty"` // 确认监听本机以外可访问的地址，还需配置 ports.allow_lan
 }
 
 // PortalMappingStatus 端口映射状态
@@ -35,6 +41,10 @@ type PortalMappingStatus struct {
 	Active           bool   `json:"active"`
 	ConnectionCount  int    `json:"connection_count"`
 	BytesTransferred int64  `json:"bytes_transferred"`
+	Exposed          bool   `json:"exposed,omitempty"` // 本地地址能从本机以外访问
+	Resolver         string `json:"resolver,omitempty"`
+	// Switchover 运行中映射最近一次切换到新链路的情况
+	Switchover *MappingSwitchover `json:"switchover,omitempty"`
 }
 
 // PortalStatusResponse Portal 状态响应
@@ -72,6 +82,8 @@ func (s *Server) handlePortalStatus(w http.ResponseWriter, r *http.Request) {
 			Protocol:   string(m.Protocol),
 			Enabled:    m.Enabled,
 			Active:     m.Enabled, // TODO: Check actual runtime status
+			Exposed:    proxy.ExposesLAN(m.LocalAddr),
+			Resolver:   m.Resolver,
 		})
 	}
 
@@ -98,6 +110,7 @@ func (s *Server) handleListPortalMappings(w http.ResponseWriter, r *http.Request
 		// 检查实际运行状态
 		s.portalMu.RLock()
 		forwarder, isActive := s.portalForwarders[m.ID]
+		switchover := s.mappingSwitchover(m.ID)
 		s.portalMu.RUnlock()
 
 		status := PortalMappingStatus{
@@ -109,6 +122,9 @@ func (s *Server) handleListPortalMappings(w http.ResponseWriter, r *http.Request
 			Protocol:   string(m.Protocol),
 			Enabled:    m.Enabled,
 			Active:     isActive,
+			Exposed:    proxy.ExposesLAN(m.LocalAddr),
+			Resolver:   m.Resolver,
+			Switchover: switchover,
 		}
 
 		if isActive {
@@ -123,23 +139,30 @@ func (s *Server) handleListPortalMappings(w http.ResponseWriter, r *http.Request
 
 // handleCreatePortalMapping 创建新的端口映射
 func (s *Server) handleCreatePortalMapping(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
 	var req CreatePortalMappingRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		errorResponse(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
 		return
 	}
 
 	// Validation
 	if req.Name == "" {
-		errorResponse(w, http.StatusBadRequest, "name is required")
+		localizedError(w, r, http.StatusBadRequest, "ERR_NAME_REQUIRED")
 		return
 	}
 	if req.LocalAddr == "" {
-		errorResponse(w, http.StatusBadRequest, "local_addr is required")
+		localizedError(w, r, http.StatusBadRequest, "ERR_LOCAL_ADDR_REQUIRED")
+		return
+	}
+	if proxy.CheckTarget(req.RemoteHost, req.RemotePort) != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_REMOTE_REQUIRED")
 		return
 	}
-	if req.RemoteHost == "" || req.RemotePort == 0 {
-		errorResponse(w, http.StatusBadRequest, "remote_host and remote_port are required")
+	if _, err := resolver.ParseMode(req.Resolver); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_RESOLVER", err)
 		return
 	}
 
@@ -149,16 +172,25 @@ func (s *Server) handleCreatePortalMapping(w http.ResponseWriter, r *http.Reques
 		protocol = types.PortalProtocol(req.Protocol)
 	}
 
+	id := uuid.New().String()
+	localAddr, release, err := s.claimLocalAddr(req.LocalAddr, req.AllowLAN, portKindMapping, id, req.Name)
+	if err != nil {
+		portClaimFailure(w, r, err)
+		return
+	}
+	defer release()
+
 	mapping := types.PortMapping{
-		ID:           uuid.New().String(),
+		ID:           id,
 		Name:         req.Name,
-		LocalAddr:    req.LocalAddr,
+		LocalAddr:    storedLocalAddr(req.LocalAddr, localAddr),
 		RemoteHost:   req.RemoteHost,
 		RemotePort:   req.RemotePort,
 		Via:          req.Via,
 		Protocol:     protocol,
 		Enabled:      true,
 		PortalServer: req.PortalServer,
+		Resolver:     req.Resolver,
 	}
 
 	// Add to config
@@ -166,7 +198,7 @@ func (s *Server) handleCreatePortalMapping(w http.ResponseWriter, r *http.Reques
 
 	// Save config
 	if err := s.manager.Save(); err != nil {
-		errorResponse(w, http.StatusInternalServerError, "Failed to save config: "+err.Error())
+		localizedError(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
 		return
 	}
 
@@ -180,6 +212,8 @@ func (s *Server) handleCreatePortalMapping(w http.ResponseWriter, r *http.Reques
 		Protocol:   string(mapping.Protocol),
 		Enabled:    mapping.Enabled,
 		Active:     false,
+		Exposed:    proxy.ExposesLAN(mapping.LocalAddr),
+		Resolver:   mapping.Resolver,
 	}
 
 	jsonResponse(w, http.StatusCreated, status)
@@ -225,6 +259,7 @@ func (s *Server) handleGetPortalMapping(w http.ResponseWriter, r *http.Request,
 			// 检查实际运行状态
 			s.portalMu.RLock()
 			forwarder, isActive := s.portalForwarders[m.ID]
+			switchover := s.mappingSwitchover(m.ID)
 			s.portalMu.RUnlock()
 
 			status := PortalMappingStatus{
@@ -236,6 +271,9 @@ func (s *Server) handleGetPortalMapping(w http.ResponseWriter, r *http.Request,
 				Protocol:   string(m.Protocol),
 				Enabled:    m.Enabled,
 				Active:     isActive,
+				Exposed:    proxy.ExposesLAN(m.LocalAddr),
+				Resolver:   m.Resolver,
+				Switchover: switchover,
 			}
 
 			if isActive {
@@ -246,14 +284,22 @@ func (s *Server) handleGetPortalMapping(w http.ResponseWriter, r *http.Request,
 			return
 		}
 	}
-	errorResponse(w, http.StatusNotFound, "Mapping not found")
+	localizedError(w, r, http.StatusNotFound, "ERR_MAPPING_NOT_FOUND")
 }
 
 // handleUpdatePortalMapping 更新端口映射
 func (s *Server) handleUpdatePortalMapping(w http.ResponseWriter, r *http.Request, id string) {
+	if !requireAdmin(w, r) {
+		return
+	}
 	var req CreatePortalMappingRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		errorResponse(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+
+	if _, err := resolver.ParseMode(req.Resolver); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_RESOLVER", err)
 		return
 	}
 
@@ -265,7 +311,13 @@ func (s *Server) handleUpdatePortalMapping(w http.ResponseWriter, r *http.Reques
 				s.config.Portal.Client.Mappings[i].Name = req.Name
 			}
 			if req.LocalAddr != "" {
-				s.config.Portal.Client.Mappings[i].LocalAddr = req.LocalAddr
+				localAddr, release, err := s.claimLocalAddr(req.LocalAddr, req.AllowLAN, portKindMapping, id, m.Name)
+				if err != nil {
+					portClaimFailure(w, r, err)
+					return
+				}
+				defer release()
+				s.config.Portal.Client.Mappings[i].LocalAddr = storedLocalAddr(req.LocalAddr, localAddr)
 			}
 			if req.RemoteHost != "" {
 				s.config.Portal.Client.Mappings[i].RemoteHost = req.RemoteHost
@@ -282,13 +334,28 @@ func (s *Server) handleUpdatePortalMapping(w http.ResponseWriter, r *http.Reques
 			if req.PortalServer != "" {
 				s.config.Portal.Client.Mappings[i].PortalServer = req.PortalServer
 			}
+			if req.Resolver != "" {
+				s.config.Portal.Client.Mappings[i].Resolver = req.Resolver
+			}
 
 			// Save config
 			if err := s.manager.Save(); err != nil {
-				errorResponse(w, http.StatusInternalServerError, "Failed to save config: "+err.Error())
+				localizedError(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
 				return
 			}
 
+			// 运行中的映射换了目标或链路时切换到新参数，旧转发器上的连接排空后关闭
+			s.portalMu.RLock()
+			old, running := s.portalForwarders[id]
+			s.portalMu.RUnlock()
+			if running && mappingRouteChanged(m, s.config.Portal.Client.Mappings[i]) {
+				s.switchMapping(r.Context(), id, &s.config.Portal.Client.Mappings[i], old)
+			}
+			s.portalMu.RLock()
+			_, active := s.portalForwarders[id]
+			switchover := s.mappingSwitchover(id)
+			s.portalMu.RUnlock()
+
 			// Return updated mapping
 			status := PortalMappingStatus{
 				ID:         s.config.Portal.Client.Mappings[i].ID,
@@ -298,23 +365,31 @@ func (s *Server) handleUpdatePortalMapping(w http.ResponseWriter, r *http.Reques
 				RemotePort: s.config.Portal.Client.Mappings[i].RemotePort,
 				Protocol:   string(s.config.Portal.Client.Mappings[i].Protocol),
 				Enabled:    s.config.Portal.Client.Mappings[i].Enabled,
-				Active:     s.config.Portal.Client.Mappings[i].Enabled,
+				Active:     active,
+				Exposed:    proxy.ExposesLAN(s.config.Portal.Client.Mappings[i].LocalAddr),
+				Resolver:   s.config.Portal.Client.Mappings[i].Resolver,
+				Switchover: switchover,
 			}
 			jsonResponse(w, http.StatusOK, status)
 			return
 		}
 	}
-	errorResponse(w, http.StatusNotFound, "Mapping not found")
+	localizedError(w, r, http.StatusNotFound, "ERR_MAPPING_NOT_FOUND")
 }
 
 // handleDeletePortalMapping 删除端口映射
 func (s *Server) handleDeletePortalMapping(w http.ResponseWriter, r *http.Request, id string) {
+	if !requireAdmin(w, r) {
+		return
+	}
 	// 先停止运行中的转发
 	s.portalMu.Lock()
 	if forwarder, exists := s.portalForwarders[id]; exists {
 		forwarder.Stop()
 		delete(s.portalForwarders, id)
 	}
+	s.stopDrainingMapping(id)
+	delete(s.portalSwitches, id)
 	s.portalMu.Unlock()
 
 	for i, m := range s.config.Portal.Client.Mappings {
@@ -327,7 +402,7 @@ func (s *Server) handleDeletePortalMapping(w http.ResponseWriter, r *http.Reques
 
 			// Save config
 			if err := s.manager.Save(); err != nil {
-				errorResponse(w, http.StatusInternalServerError, "Failed to save config: "+err.Error())
+				localizedError(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
 				return
 			}
 
@@ -335,7 +410,7 @@ func (s *Server) handleDeletePortalMapping(w http.ResponseWriter, r *http.Reques
 			return
 		}
 	}
-	errorResponse(w, http.StatusNotFound, "Mapping not found")
+	localizedError(w, r, http.StatusNotFound, "ERR_MAPPING_NOT_FOUND")
 }
 
 // buildHopChainForMapping 构建映射的 SSH 链
@@ -351,9 +426,6 @@ func (s *Server) buildHopChainForMapping(mapping *types.PortMapping) ([]*types.H
 		}
 
 		hop := s.config.GetHopByID(hopID)
-		if hop == nil {
-			hop = s.config.GetHopByName(hopID)
-		}
 		if hop == nil {
 			log.Printf("[Portal] Warning: hop '%s' not found", hopID)
 			return
@@ -377,20 +449,7 @@ func (s *Server) buildHopChainForMapping(mapping *types.PortMapping) ([]*types.H
 	}
 
 	// 查找目标主机配置
-	targetHop := s.config.GetHopByID(mapping.RemoteHost)
-	if targetHop == nil {
-		targetHop = s.config.GetHopByName(mapping.RemoteHost)
-	}
-	if targetHop == nil {
-		// 尝试通过 host 匹配
-		for _, h := range s.config.Hops {
-			if h.Host == mapping.RemoteHost {
-				targetHop = h
-				break
-			}
-		}
-	}
-
+	targetHop := s.mappingTargetHop(mapping)
 	if targetHop != nil {
 		// 如果目标是内网服务器，添加其网关
 		if targetHop.ServerType == types.ServerInternal && targetHop.GatewayID != "" {
@@ -402,6 +461,37 @@ func (s *Server) buildHopChainForMapping(mapping *types.PortMapping) ([]*types.H
 	return hops, nil
 }
 
+// mappingBindAddr 按监听策略返回映射实际监听的地址；已保存的映射视为创建时已确认
+func (s *Server) mappingBindAddr(mapping *types.PortMapping) (string, error) {
+	return proxy.CheckBind(mapping.LocalAddr, s.config.Ports.AllowLAN, true)
+}
+
+// mappingTargetHop 返回映射目标对应的服务器配置（按 ID、名称、地址匹配），不在配置中时返回 nil
+func (s *Server) mappingTargetHop(mapping *types.PortMapping) *types.Hop {
+	if hop := s.config.GetHopByID(mapping.RemoteHost); hop != nil {
+		return hop
+	}
+	if hop := s.config.GetHopByName(mapping.RemoteHost); hop != nil {
+		return hop
+	}
+	// 尝试通过 host 匹配
+	for _, h := range s.config.Hops {
+		if h.Host == mapping.RemoteHost {
+			return h
+		}
+	}
+	return nil
+}
+
+// mappingResolver 映射的解析方式，保存的值无效时（手工编辑配置）按默认的 remote 处理
+func mappingResolver(mapping *types.PortMapping) resolver.Mode {
+	mode, err := resolver.ParseMode(mapping.Resolver)
+	if err != nil {
+		log.Printf("[Portal] Mapping %s: %v, resolving on the remote side", mapping.ID, err)
+	}
+	return mode
+}
+
 // handleStartPortalMapping 启动端口转发（使用 SSH 隧道）
 func (s *Server) handleStartPortalMapping(w http.ResponseWriter, r *http.Request, id string) {
 	// 1. 从 config 中找到对应 mapping
@@ -414,7 +504,7 @@ func (s *Server) handleStartPortalMapping(w http.ResponseWriter, r *http.Request
 	}
 
 	if mapping == nil {
-		errorResponse(w, http.StatusNotFound, "Mapping not found")
+		localizedError(w, r, http.StatusNotFound, "ERR_MAPPING_NOT_FOUND")
 		return
 	}
 
@@ -424,33 +514,25 @@ func (s *Server) handleStartPortalMapping(w http.ResponseWriter, r *http.Request
 	s.portalMu.RUnlock()
 
 	if exists {
-		errorResponse(w, http.StatusConflict, "Mapping is already running")
+		localizedError(w, r, http.StatusConflict, "ERR_MAPPING_RUNNING")
 		return
 	}
 
 	// 2. 构建 SSH 链
 	hops, err := s.buildHopChainForMapping(mapping)
 	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, "Failed to build hop chain: "+err.Error())
+		failure(w, r, http.StatusInternalServerError, "ERR_BUILD_CHAIN", err)
 		return
 	}
 
-	// 如果没有配置 hops，创建一个默认的（使用 Via 的第一个）
 	if len(hops) == 0 {
-		// 尝试从 Via 获取第一个服务器
-		if len(mapping.Via) > 0 {
-			hop := s.config.GetHopByID(mapping.Via[0])
-			if hop == nil {
-				hop = s.config.GetHopByName(mapping.Via[0])
-			}
-			if hop != nil {
-				hops = append(hops, hop)
-			}
-		}
+		localizedError(w, r, http.StatusBadRequest, "ERR_NO_HOPS")
+		return
 	}
 
-	if len(hops) == 0 {
-		errorResponse(w, http.StatusBadRequest, "No valid SSH hops configured. Please configure Via hops.")
+	localAddr, err := s.mappingBindAddr(mapping)
+	if err != nil {
+		localizedError(w, r, http.StatusForbidden, "ERR_LAN_BIND_DISABLED", err)
 		return
 	}
 
@@ -459,15 +541,19 @@ func (s *Server) handleStartPortalMapping(w http.ResponseWriter, r *http.Request
 	// 3. 建立 SSH 连接链
 	chain := ssh.NewChain(hops)
 	if err := chain.Connect(); err != nil {
-		errorResponse(w, http.StatusInternalServerError, "Failed to connect SSH chain: "+err.Error())
+		failure(w, r, http.StatusBadGateway, "ERR_CHAIN_CONNECT", err)
 		return
 	}
+	// 中间某一跳断开时按退避策略重连，转发器保持监听
+	chain.Supervise(context.Background(), ssh.DefaultReconnectPolicy())
 
 	// 4. 创建端口转发器
-	forwarder := proxy.NewPortForwarder(chain, mapping.LocalAddr, mapping.RemoteHost, mapping.RemotePort)
+	forwarder := proxy.NewPortForwarder(chain, localAddr, mapping.RemoteHost, mapping.RemotePort)
+	forwarder.SetResolver(mappingResolver(mapping), terminal.HopKey(hops))
+	forwarder.OnStop(chain.Disconnect)
 	if err := forwarder.Start(); err != nil {
-		chain.Disconnect()
-		errorResponse(w, http.StatusInternalServerError, "Failed to start port forwarder: "+err.Error())
+		forwarder.Stop()
+		localizedError(w, r, http.StatusInternalServerError, "ERR_FORWARDER_START", err)
 		return
 	}
 
@@ -481,6 +567,23 @@ func (s *Server) handleStartPortalMapping(w http.ResponseWriter, r *http.Request
 	s.manager.Save()
 
 	log.Printf("[Portal] Mapping %s started successfully on %s", mapping.ID, forwarder.GetLocalAddr())
+	target := mapping.RemoteHost
+	if hop := s.mappingTargetHop(mapping); hop != nil {
+		target = hop.Name
+	}
+	s.events.Publish(&events.Event{
+		Type:      events.MappingStarted,
+		RequestID: requestID(r),
+		User:      currentUser(r).Name,
+		Server:    target,
+		Target:    mapping.ID,
+		Data: map[string]interface{}{
+			"name":        mapping.Name,
+			"local_addr":  forwarder.GetLocalAddr(),
+			"remote_host": mapping.RemoteHost,
+			"remote_port": mapping.RemotePort,
+		},
+	})
 
 	jsonResponse(w, http.StatusOK, map[string]interface{}{
 		"success":     true,
@@ -499,6 +602,7 @@ func (s *Server) handleStopPortalMapping(w http.ResponseWriter, r *http.Request,
 	if exists {
 		delete(s.portalForwarders, id)
 	}
+	s.stopDrainingMapping(id)
 	s.portalMu.Unlock()
 
 	// 2. 如果 forwarder 存在，停止它
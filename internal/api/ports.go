@@ -0,0 +1,320 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/luobobo896/HSSH/internal/proxy"
+)
+
+const (
+	// defaultAutoPortMin/defaultAutoPortMax 未配置 ports 时自动分配的端口范围
+	defaultAutoPortMin = 20000
+	defaultAutoPortMax = 29999
+	// autoLocalAddr 请求自动分配端口的 local_addr
+	autoLocalAddr = "auto"
+	// autoBindHost 自动分配的地址只监听本机
+	autoBindHost = "127.0.0.1"
+)
+
+// 端口占用方
+const (
+	portKindProxy   = "proxy"
+	portKindMapping = "mapping"
+	portKindProfile = "profile"
+	// portKindAgentForward 经由 agent 的转发
+	portKindAgentForward = "agent_forward"
+)
+
+// PortUse 一个被占用或已登记的本地地址
+type PortUse struct {
+	Addr   string `json:"addr"`
+	Port   int    `json:"port"`
+	Kind   string `json:"kind"` // proxy、mapping、profile 或 agent_forward
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Active bool   `json:"active"` // 正在监听
+}
+
+// PortsResponse 端口登记表
+type PortsResponse struct {
+	AutoMin int       `json:"auto_min"`
+	AutoMax int       `json:"auto_max"`
+	Uses    []PortUse `json:"uses"`
+}
+
+// PortConflictError 请求的本地地址与已有的占用冲突
+type PortConflictError struct {
+	Addr string
+	Use  PortUse
+}
+
+func (e *PortConflictError) Error() string {
+	return fmt.Sprintf("%s conflicts with %s %s (%s)", e.Addr, e.Use.Kind, e.Use.label(), e.Use.Addr)
+}
+
+// PortRangeExhaustedError 自动分配范围内没有空闲端口
+type PortRangeExhaustedError struct {
+	Min, Max int
+}
+
+func (e *PortRangeExhaustedError) Error() string {
+	return fmt.Sprintf("no free port in %d-%d", e.Min, e.Max)
+}
+
+// portRegistry 已分配但还没有开始监听或保存的地址，避免并发请求分到同一个端口
+type portRegistry struct {
+	mu      sync.Mutex
+	pending map[string]PortUse // kind/id -> 占用
+}
+
+// label 占用方的显示名称
+func (u PortUse) label() string {
+	if u.Name != "" {
+		return u.Name
+	}
+	return u.ID
+}
+
+// portUses 汇总运行中的代理、Portal 映射（运行中或已保存）、经由 agent 的转发、预设的本地端口和正在分配的地址
+func (s *Server) portUses() []PortUse {
+	var uses []PortUse
+	add := func(addr, kind, id, name string, active bool) {
+		// unix socket 按路径登记，端口为 0
+		if path, ok := proxy.UnixSocketPath(addr); ok {
+			uses = append(uses, PortUse{Addr: path, Kind: kind, ID: id, Name: name, Active: active})
+			return
+		}
+		addr = proxy.NormalizeBindAddr(addr)
+		_, port, err := splitLocalAddr(addr)
+		if err != nil || port == 0 {
+			return
+		}
+		uses = append(uses, PortUse{Addr: addr, Port: port, Kind: kind, ID: id, Name: name, Active: active})
+	}
+
+	for id, fwd := range s.proxies.List() {
+		add(fwd.GetLocalAddr(), portKindProxy, id, "", fwd.IsActive())
+	}
+
+	s.portalMu.RLock()
+	for _, m := range s.config.Portal.Client.Mappings {
+		if fwd, ok := s.portalForwarders[m.ID]; ok {
+			add(fwd.GetLocalAddr(), portKindMapping, m.ID, m.Name, fwd.IsActive())
+			continue
+		}
+		add(m.LocalAddr, portKindMapping, m.ID, m.Name, false)
+	}
+	s.portalMu.RUnlock()
+
+	if s.agents != nil {
+		for _, f := range s.agents.Forwards() {
+			add(f.LocalAddr, portKindAgentForward, f.ID, f.Agent, true)
+		}
+	}
+
+	for _, p := range s.config.Profiles {
+		if p.LocalPort > 0 {
+			add(":"+strconv.Itoa(p.LocalPort), portKindProfile, p.ID, p.Name, false)
+		}
+	}
+
+	for _, use := range s.ports.pending {
+		uses = append(uses, use)
+	}
+
+	sort.Slice(uses, func(i, j int) bool {
+		if uses[i].Port != uses[j].Port {
+			return uses[i].Port < uses[j].Port
+		}
+		return uses[i].Kind+uses[i].ID < uses[j].Kind+uses[j].ID
+	})
+	return uses
+}
+
+// claimLocalAddr 为 kind/id 校验或分配本地地址，返回实际使用的地址和释放登记的函数：
+// "auto" 从配置的范围中分配一个未被占用、本机也能监听的端口；其余地址先按监听策略检查（confirmLAN 为请求中的 allow_lan），
+// 端口为 0 时由系统分配，不做冲突检查，unix socket 路径只检查同一路径，与已有占用冲突时返回 *PortConflictError。调用方在开始监听或保存配置后调用 release
+func (s *Server) claimLocalAddr(requested string, confirmLAN bool, kind, id, name string) (addr string, release func(), err error) {
+	if requested != autoLocalAddr {
+		requested, err = proxy.CheckBind(requested, s.config.Ports.AllowLAN, confirmLAN)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	s.ports.mu.Lock()
+	defer s.ports.mu.Unlock()
+
+	uses := s.portUses()
+	// 更新时不与自己冲突
+	var others []PortUse
+	for _, use := range uses {
+		if use.Kind != kind || use.ID != id {
+			others = append(others, use)
+		}
+	}
+
+	if requested == autoLocalAddr {
+		addr, err = s.allocatePort(others)
+	} else {
+		addr, err = checkLocalAddr(requested, others)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	use := PortUse{Addr: addr, Kind: kind, ID: id, Name: name}
+	if path, ok := proxy.UnixSocketPath(addr); ok {
+		use.Addr = path
+	} else if _, use.Port, _ = splitLocalAddr(addr); use.Port == 0 {
+		return addr, func() {}, nil
+	}
+
+	key := kind + "/" + id
+	if s.ports.pending == nil {
+		s.ports.pending = make(map[string]PortUse)
+	}
+	s.ports.pending[key] = use
+	return addr, func() {
+		s.ports.mu.Lock()
+		delete(s.ports.pending, key)
+		s.ports.mu.Unlock()
+	}, nil
+}
+
+// storedLocalAddr 保存到配置的地址：自动分配时为分配到的地址，否则保留填写的地址，监听时再按策略补全
+func storedLocalAddr(requested, claimed string) string {
+	if requested == autoLocalAddr {
+		return claimed
+	}
+	return requested
+}
+
+// allocatePort 在自动分配范围内找一个空闲端口
+func (s *Server) allocatePort(uses []PortUse) (string, error) {
+	min, max := s.autoPortRange()
+	for port := min; port <= max; port++ {
+		addr := net.JoinHostPort(autoBindHost, strconv.Itoa(port))
+		if _, err := checkLocalAddr(addr, uses); err != nil {
+			continue
+		}
+		// 其他进程占用的端口
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			continue
+		}
+		ln.Close()
+		return addr, nil
+	}
+	return "", &PortRangeExhaustedError{Min: min, Max: max}
+}
+
+// autoPortRange 返回配置的自动分配范围
+func (s *Server) autoPortRange() (int, int) {
+	min, max := s.config.Ports.AutoMin, s.config.Ports.AutoMax
+	if min <= 0 || max <= 0 || min > max || max > 65535 {
+		return defaultAutoPortMin, defaultAutoPortMax
+	}
+	return min, max
+}
+
+// checkLocalAddr 检查 addr 是否合法且不与 uses 冲突，unix socket 路径与同一路径冲突
+func checkLocalAddr(addr string, uses []PortUse) (string, error) {
+	if path, ok := proxy.UnixSocketPath(addr); ok {
+		for _, use := range uses {
+			if use.Addr == path {
+				return "", &PortConflictError{Addr: addr, Use: use}
+			}
+		}
+		return addr, nil
+	}
+	host, port, err := splitLocalAddr(addr)
+	if err != nil {
+		return "", err
+	}
+	if port == 0 {
+		return addr, nil
+	}
+	for _, use := range uses {
+		useHost, usePort, err := splitLocalAddr(use.Addr)
+		if err != nil || usePort != port {
+			continue
+		}
+		if hostsOverlap(host, useHost) {
+			return "", &PortConflictError{Addr: addr, Use: use}
+		}
+	}
+	return addr, nil
+}
+
+// splitLocalAddr 解析 host:port 形式的监听地址
+func splitLocalAddr(addr string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid local address %q: %w", addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in local address %q", addr)
+	}
+	return host, port, nil
+}
+
+// hostsOverlap 两个监听地址的主机部分是否会争用同一端口：任意一方监听所有地址或两者相同
+func hostsOverlap(a, b string) bool {
+	a, b = normalizeBindHost(a), normalizeBindHost(b)
+	return a == "" || b == "" || a == b
+}
+
+// normalizeBindHost 所有地址统一为空，localhost 统一为 127.0.0.1
+func normalizeBindHost(host string) string {
+	switch host {
+	case "", "0.0.0.0", "::":
+		return ""
+	case "localhost":
+		return "127.0.0.1"
+	}
+	return host
+}
+
+// handlePorts 返回自动分配范围和已占用的本地端口
+func (s *Server) handlePorts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.ports.mu.Lock()
+	uses := s.portUses()
+	s.ports.mu.Unlock()
+	if uses == nil {
+		uses = []PortUse{}
+	}
+
+	min, max := s.autoPortRange()
+	jsonResponse(w, http.StatusOK, PortsResponse{AutoMin: min, AutoMax: max, Uses: uses})
+}
+
+// portClaimFailure 返回 claimLocalAddr 错误对应的响应
+func portClaimFailure(w http.ResponseWriter, r *http.Request, err error) {
+	var conflict *PortConflictError
+	var exhausted *PortRangeExhaustedError
+	switch {
+	case errors.Is(err, proxy.ErrLANBindDisabled):
+		localizedError(w, r, http.StatusForbidden, "ERR_LAN_BIND_DISABLED", err)
+	case errors.Is(err, proxy.ErrLANBindUnconfirmed):
+		localizedError(w, r, http.StatusBadRequest, "ERR_LAN_BIND_UNCONFIRMED", err)
+	case errors.As(err, &conflict):
+		localizedError(w, r, http.StatusConflict, "ERR_PORT_IN_USE", conflict.Addr, conflict.Use.Kind, conflict.Use.label())
+	case errors.As(err, &exhausted):
+		localizedError(w, r, http.StatusServiceUnavailable, "ERR_PORT_RANGE_EXHAUSTED", exhausted.Min, exhausted.Max)
+	default:
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_LOCAL_ADDR", err)
+	}
+}
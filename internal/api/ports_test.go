@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/agent"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestCheckLocalAddr(t *testing.T) {
+	uses := []PortUse{
+		{Addr: "0.0.0.0:8080", Port: 8080, Kind: portKindMapping, ID: "m1"},
+		{Addr: "127.0.0.1:9000", Port: 9000, Kind: portKindProxy, ID: "p1"},
+	}
+
+	tests := []struct {
+		addr     string
+		conflict bool
+		invalid  bool
+	}{
+		{"127.0.0.1:8080", true, false},  // 已有监听所有地址
+		{"0.0.0.0:9000", true, false},    // 新的监听所有地址
+		{"localhost:9000", true, false},  // localhost 等同 127.0.0.1
+		{"10.0.0.5:9000", false, false},  // 不同地址
+		{":8081", false, false},          // 不同端口
+		{":0", false, false},             // 系统分配
+		{"8080", false, true},            // 缺少冒号
+		{"127.0.0.1:99999", false, true}, // 端口超出范围
+	}
+
+	for _, tt := range tests {
+		_, err := checkLocalAddr(tt.addr, uses)
+		var conflict *PortConflictError
+		switch {
+		case tt.conflict && !errors.As(err, &conflict):
+			t.Errorf("%s: expected conflict, got %v", tt.addr, err)
+		case tt.invalid && (err == nil || errors.As(err, &conflict)):
+			t.Errorf("%s: expected invalid address error, got %v", tt.addr, err)
+		case !tt.conflict && !tt.invalid && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.addr, err)
+		}
+	}
+}
+
+func TestPortalMappingPortAllocation(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	freePort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	server.config.Ports.AutoMin = freePort
+	server.config.Ports.AutoMax = freePort
+
+	post := func(localAddr string) *httptest.ResponseRecorder {
+		body := `{"name": "db", "local_addr": "` + localAddr + `", "remote_host": "10.0.0.9", "remote_port": 5432}`
+		req := httptest.NewRequest(http.MethodPost, "/api/portal/mappings", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer alice-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	code := func(rec *httptest.ResponseRecorder) string {
+		var resp map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		s, _ := resp["code"].(string)
+		return s
+	}
+
+	// 自动分配到范围内唯一的端口
+	rec := post("auto")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("auto: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created PortalMappingStatus
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if _, port, _ := splitLocalAddr(created.LocalAddr); port != freePort {
+		t.Fatalf("auto: local_addr = %q, want port %d", created.LocalAddr, freePort)
+	}
+
+	// 范围已用完
+	if rec := post("auto"); rec.Code != http.StatusServiceUnavailable || code(rec) != "ERR_PORT_RANGE_EXHAUSTED" {
+		t.Errorf("exhausted: got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 显式请求已分配的端口
+	if rec := post(created.LocalAddr); rec.Code != http.StatusConflict || code(rec) != "ERR_PORT_IN_USE" {
+		t.Errorf("conflict: got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 更新映射自身的地址不算冲突
+	req := httptest.NewRequest(http.MethodPut, "/api/portal/mappings/"+created.ID,
+		strings.NewReader(`{"local_addr": "`+created.LocalAddr+`"}`))
+	req.Header.Set("Authorization", "Bearer alice-token")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("update: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/ports", nil)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var ports PortsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &ports); err != nil {
+		t.Fatalf("invalid ports response: %v", err)
+	}
+	if len(ports.Uses) != 1 || ports.Uses[0].ID != created.ID || ports.Uses[0].Kind != portKindMapping {
+		t.Errorf("uses = %+v, want the created mapping", ports.Uses)
+	}
+}
+
+func TestPortalMappingBindPolicy(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+
+	post := func(body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodPost, "/api/portal/mappings", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer alice-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var resp map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+	const target = `"remote_host": "10.0.0.9", "remote_port": 5432`
+
+	// 没有主机的地址只监听本机
+	status, resp := post(`{"name": "db", "local_addr": ":15432", ` + target + `}`)
+	if status != http.StatusCreated || resp["local_addr"] != ":15432" || resp["exposed"] != nil {
+		t.Fatalf("default bind: got %d %v", status, resp)
+	}
+
+	lan := `{"name": "lan", "local_addr": "0.0.0.0:15433", ` + target
+	if status, resp := post(lan + `, "allow_lan": true}`); status != http.StatusForbidden || resp["code"] != "ERR_LAN_BIND_DISABLED" {
+		t.Errorf("policy disabled: got %d %v", status, resp)
+	}
+
+	server.config.Ports.AllowLAN = true
+	if status, resp := post(lan + `}`); status != http.StatusBadRequest || resp["code"] != "ERR_LAN_BIND_UNCONFIRMED" {
+		t.Errorf("unconfirmed: got %d %v", status, resp)
+	}
+	if status, resp := post(lan + `, "allow_lan": true}`); status != http.StatusCreated || resp["exposed"] != true {
+		t.Errorf("confirmed: got %d %v", status, resp)
+	}
+}
+
+func TestAgentForwardClaimsLocalAddr(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	server.agents = agent.NewHub(nil, nil)
+	server.config.Portal.Client.Mappings = []types.PortMapping{
+		{ID: "m-1", Name: "db", LocalAddr: "127.0.0.1:15432", RemoteHost: "10.0.0.9", RemotePort: 5432},
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/agents/dc1/forwards", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer alice-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	code := func(rec *httptest.ResponseRecorder) string {
+		var resp map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		s, _ := resp["code"].(string)
+		return s
+	}
+
+	// ports.allow_lan 未开启时不能经 agent 把内网服务暴露到所有地址
+	rec := post(`{"local_addr": "0.0.0.0:15433", "remote_host": "10.0.0.9", "remote_port": 22, "allow_lan": true}`)
+	if rec.Code != http.StatusForbidden || code(rec) != "ERR_LAN_BIND_DISABLED" {
+		t.Errorf("lan bind: got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 与已保存的 Portal 映射冲突
+	rec = post(`{"local_addr": "127.0.0.1:15432", "remote_host": "10.0.0.9", "remote_port": 22}`)
+	if rec.Code != http.StatusConflict || code(rec) != "ERR_PORT_IN_USE" {
+		t.Errorf("conflict: got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 地址通过检查后才轮到 agent 是否在线
+	rec = post(`{"local_addr": "127.0.0.1:15433", "remote_host": "10.0.0.9", "remote_port": 22}`)
+	if code(rec) != "ERR_AGENT_NOT_CONNECTED" {
+		t.Errorf("free addr: got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/hostinfo"
+	"github.com/luobobo896/HSSH/pkg/types"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// hostInfoTimeout 列出进程/端口或结束进程（含建立跳板链）的最长时间
+const hostInfoTimeout = 30 * time.Second
+
+// KillProcessRequest 结束进程请求
+type KillProcessRequest struct {
+	Signal  string `json:"signal,omitempty"` // TERM（默认）、KILL、HUP、INT、QUIT、USR1、USR2
+	Confirm string `json:"confirm"`          // 进程列表中该进程的 started，PID 已被复用时拒绝
+}
+
+// KillProcessResponse 结束进程结果
+type KillProcessResponse struct {
+	PID    int    `json:"pid"`
+	Signal string `json:"signal"`
+}
+
+// handleProcesses 处理 /api/servers/{id}/processes 及 /api/servers/{id}/processes/{pid}/kill
+func (s *Server) handleProcesses(w http.ResponseWriter, r *http.Request, hop *types.Hop, rest string) {
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		out, ok := s.hostInfo(w, r, hop, hostinfo.ListProcessesCommand(), "ERR_LIST_PROCESSES")
+		if ok {
+			jsonResponse(w, http.StatusOK, hostinfo.ParseProcesses(string(out)))
+		}
+		return
+	}
+
+	pidStr, action, _ := strings.Cut(rest, "/")
+	if action != "kill" {
+		localizedError(w, r, http.StatusNotFound, "ERR_NOT_FOUND")
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil || pid <= 1 {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "pid", pidStr)
+		return
+	}
+	var req KillProcessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	if req.Confirm == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_KILL_UNCONFIRMED")
+		return
+	}
+	if !s.confirmEnvironment(w, r, hop, types.OpExec) {
+		return
+	}
+	cmd, err := hostinfo.KillCommand(pid, req.Confirm, req.Signal)
+	if err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "signal", req.Signal)
+		return
+	}
+
+	hops := s.buildHopChain(hop.Name)
+	if len(hops) == 0 {
+		localizedError(w, r, http.StatusInternalServerError, "ERR_BUILD_CHAIN", hop.Name)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), hostInfoTimeout)
+	defer cancel()
+
+	if _, err := s.runOnChain(ctx, hops, cmd); err != nil {
+		var exit *gossh.ExitError
+		if errors.As(err, &exit) {
+			err = hostinfo.KillFailed(exit.ExitStatus(), err)
+		}
+		failure(w, r, http.StatusBadGateway, "ERR_KILL_FAILED", err)
+		return
+	}
+	signal := strings.TrimPrefix(strings.ToUpper(req.Signal), "SIG")
+	if signal == "" {
+		signal = "TERM"
+	}
+	jsonResponse(w, http.StatusOK, KillProcessResponse{PID: pid, Signal: signal})
+}
+
+// handleListeners 列出服务器上监听的 TCP/UDP 端口 (GET /api/servers/{id}/ports)
+func (s *Server) handleListeners(w http.ResponseWriter, r *http.Request, hop *types.Hop) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	out, ok := s.hostInfo(w, r, hop, hostinfo.ListPortsCommand(), "ERR_LIST_PORTS")
+	if ok {
+		jsonResponse(w, http.StatusOK, hostinfo.ParseListeners(string(out)))
+	}
+}
+
+// hostInfo 经与终端相同的跳板链在 hop 上执行只读命令，失败时以 code 写入错误响应并返回 false
+func (s *Server) hostInfo(w http.ResponseWriter, r *http.Request, hop *types.Hop, cmd, code string) ([]byte, bool) {
+	hops := s.buildHopChain(hop.Name)
+	if len(hops) == 0 {
+		localizedError(w, r, http.StatusInternalServerError, "ERR_BUILD_CHAIN", hop.Name)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), hostInfoTimeout)
+	defer cancel()
+
+	out, err := s.runOnChain(ctx, hops, cmd)
+	if err != nil {
+		failure(w, r, http.StatusBadGateway, code, err)
+		return nil, false
+	}
+	return out, true
+}
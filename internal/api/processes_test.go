@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProcessesValidation(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+		code   string
+	}{
+		{"list wrong method", http.MethodPost, "/api/servers/hop-1/processes", "bob-token", "", http.StatusMethodNotAllowed, ""},
+		{"ports wrong method", http.MethodDelete, "/api/servers/hop-1/ports", "bob-token", "", http.StatusMethodNotAllowed, ""},
+		{"unknown server", http.MethodGet, "/api/servers/missing-hop/processes", "bob-token", "", http.StatusNotFound, "ERR_HOP_NOT_FOUND"},
+		{"unknown action", http.MethodPost, "/api/servers/hop-1/processes/812/stop", "alice-token", "", http.StatusNotFound, "ERR_NOT_FOUND"},
+		{"kill wrong method", http.MethodGet, "/api/servers/hop-1/processes/812/kill", "alice-token", "", http.StatusMethodNotAllowed, ""},
+		{"kill requires admin", http.MethodPost, "/api/servers/hop-1/processes/812/kill", "bob-token", `{"confirm": "x"}`, http.StatusForbidden, "ERR_ADMIN_REQUIRED"},
+		{"invalid pid", http.MethodPost, "/api/servers/hop-1/processes/abc/kill", "alice-token", `{"confirm": "x"}`, http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"init pid", http.MethodPost, "/api/servers/hop-1/processes/1/kill", "alice-token", `{"confirm": "x"}`, http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"invalid body", http.MethodPost, "/api/servers/hop-1/processes/812/kill", "alice-token", "{", http.StatusBadRequest, "ERR_INVALID_BODY"},
+		{"unconfirmed", http.MethodPost, "/api/servers/hop-1/processes/812/kill", "alice-token", `{"signal": "TERM"}`, http.StatusBadRequest, "ERR_KILL_UNCONFIRMED"},
+		{"unknown signal", http.MethodPost, "/api/servers/hop-1/processes/812/kill", "alice-token", `{"signal": "STOP", "confirm": "x"}`, http.StatusBadRequest, "ERR_INVALID_PARAM"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.code == "" {
+				return
+			}
+			var resp map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if resp["code"] != tt.code {
+				t.Errorf("code = %q, want %q", resp["code"], tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/transfer"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// RecentList 当前用户最近使用的目标和收藏的服务器，界面据此一键重连
+type RecentList struct {
+	Recent    []types.RecentTarget `json:"recent"`
+	Favorites []*types.Hop         `json:"favorites"`
+}
+
+// touchRecent 记录 user 对服务器（ID 或名称）的一次使用并保存配置，服务器不存在时忽略
+func (s *Server) touchRecent(user *types.WebUser, kind, server, path string, via []string) {
+	hop := s.config.GetHopByID(server)
+	if hop == nil {
+		hop = s.config.GetHopByName(server)
+	}
+	if hop == nil {
+		return
+	}
+	if transfer.IsObjectURL(path) {
+		// 预签名 URL 的签名不写入配置
+		path = transfer.ObjectTarget{URL: path}.Redacted()
+	}
+
+	s.recentMu.Lock()
+	defer s.recentMu.Unlock()
+	s.config.TouchRecent(&types.RecentTarget{
+		User:     user.Name,
+		Kind:     kind,
+		ServerID: hop.ID,
+		Server:   hop.Name,
+		Path:     path,
+		Via:      via,
+		UsedAt:   time.Now(),
+	})
+	if err := s.manager.Save(); err != nil {
+		log.Printf("[Recent] Failed to save recent targets: %v", err)
+	}
+}
+
+// handleRecent GET 返回当前用户最近使用的目标（?kind=terminal|upload 过滤）和收藏的服务器，
+// DELETE 清空当前用户的记录
+func (s *Server) handleRecent(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	switch r.Method {
+	case http.MethodGet:
+		kind := r.URL.Query().Get("kind")
+		if kind != "" && kind != types.RecentTerminal && kind != types.RecentUpload {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_RECENT_KIND", kind)
+			return
+		}
+		s.recentMu.Lock()
+		list := RecentList{Recent: s.config.RecentFor(user.Name, kind), Favorites: s.config.Favorites()}
+		s.recentMu.Unlock()
+		if list.Favorites == nil {
+			list.Favorites = []*types.Hop{}
+		}
+		jsonResponse(w, http.StatusOK, list)
+
+	case http.MethodDelete:
+		s.recentMu.Lock()
+		s.config.ClearRecent(user.Name)
+		err := s.manager.Save()
+		s.recentMu.Unlock()
+		if err != nil {
+			failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]string{"status": "cleared"})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleFavorite PUT 收藏、DELETE 取消收藏服务器（仅管理员，收藏对所有用户可见）
+// (/api/servers/{id}/favorite)
+func (s *Server) handleFavorite(w http.ResponseWriter, r *http.Request, hop *types.Hop) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	hop.Favorite = r.Method == http.MethodPut
+	if err := s.manager.Save(); err != nil {
+		failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, serverResponse(hop))
+}
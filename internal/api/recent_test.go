@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestRecent(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	do := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	list := func(target, token string) RecentList {
+		t.Helper()
+		rec := do(http.MethodGet, target, token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d: %s", target, rec.Code, rec.Body.String())
+		}
+		var l RecentList
+		json.Unmarshal(rec.Body.Bytes(), &l)
+		return l
+	}
+
+	bob := server.lookupUser("bob-token")
+	server.touchRecent(bob, types.RecentTerminal, "web-1", "", nil)
+	server.touchRecent(bob, types.RecentUpload, "hop-1", "/srv/app", []string{"bastion"})
+	server.touchRecent(bob, types.RecentUpload, "missing", "/tmp", nil)
+	// 再次使用同一目标只移到最前，不重复
+	server.touchRecent(bob, types.RecentTerminal, "hop-1", "", nil)
+
+	l := list("/api/recent", "bob-token")
+	if len(l.Recent) != 2 || l.Recent[0].Kind != types.RecentTerminal || l.Recent[1].Path != "/srv/app" {
+		t.Fatalf("unexpected recent list: %+v", l.Recent)
+	}
+	if l := list("/api/recent?kind=upload", "bob-token"); len(l.Recent) != 1 || l.Recent[0].Via[0] != "bastion" {
+		t.Errorf("kind filter: %+v", l.Recent)
+	}
+	if l := list("/api/recent", "carol-token"); len(l.Recent) != 0 {
+		t.Errorf("carol sees bob's targets: %+v", l.Recent)
+	}
+	if rec := do(http.MethodGet, "/api/recent?kind=proxy", "bob-token"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "ERR_INVALID_RECENT_KIND") {
+		t.Errorf("invalid kind: expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// 改名后列出当前名称
+	server.config.GetHopByID("hop-1").Name = "web-1a"
+	if l := list("/api/recent", "bob-token"); l.Recent[0].Server != "web-1a" {
+		t.Errorf("server name not refreshed: %+v", l.Recent[0])
+	}
+
+	if rec := do(http.MethodPut, "/api/servers/hop-1/favorite", "bob-token"); rec.Code != http.StatusForbidden {
+		t.Errorf("user favorite: expected 403, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/api/servers/hop-1/favorite", "alice-token"); rec.Code != http.StatusOK {
+		t.Fatalf("favorite: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if l := list("/api/recent", "carol-token"); len(l.Favorites) != 1 || l.Favorites[0].ID != "hop-1" {
+		t.Errorf("favorites: %+v", l.Favorites)
+	}
+	if rec := do(http.MethodDelete, "/api/servers/hop-1/favorite", "alice-token"); rec.Code != http.StatusOK || server.config.GetHopByID("hop-1").Favorite {
+		t.Errorf("unfavorite: got %d, favorite=%v", rec.Code, server.config.GetHopByID("hop-1").Favorite)
+	}
+
+	if rec := do(http.MethodDelete, "/api/recent", "bob-token"); rec.Code != http.StatusOK {
+		t.Fatalf("clear: expected 200, got %d", rec.Code)
+	}
+	if l := list("/api/recent", "bob-token"); len(l.Recent) != 0 {
+		t.Errorf("recent not cleared: %+v", l.Recent)
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/luobobo896/HSSH/internal/config"
+)
+
+// ReferencesReport 引用检查结果
+type ReferencesReport struct {
+	Dangling []config.DanglingRef `json:"dangling"`        // 仍无法解析的引用
+	Fixed    []config.DanglingRef `json:"fixed,omitempty"` // 本次修复的引用（仅 POST）
+}
+
+// handleReferences GET 列出指向不存在服务器的引用，POST 一键修复（仅管理员）
+func (s *Server) handleReferences(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		jsonResponse(w, http.StatusOK, ReferencesReport{Dangling: s.manager.DanglingRefs()})
+
+	case http.MethodPost:
+		if !requireAdmin(w, r) {
+			return
+		}
+		fixed, err := s.manager.FixDanglingRefs()
+		if err != nil {
+			localizedError(w, r, http.StatusInternalServerError, "ERR_FIX_REFERENCES", err)
+			return
+		}
+		jsonResponse(w, http.StatusOK, ReferencesReport{Dangling: s.manager.DanglingRefs(), Fixed: fixed})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
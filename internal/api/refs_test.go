@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestReferencesReportAndFix(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	if err := server.manager.AddProfile(&types.Profile{ID: "profile-1", Name: "deploy", PathIDs: []string{"hop-1", "gone"}}); err != nil {
+		t.Fatalf("failed to add profile: %v", err)
+	}
+
+	do := func(method, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/references", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	decode := func(rec *httptest.ResponseRecorder) ReferencesReport {
+		t.Helper()
+		var report ReferencesReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		return report
+	}
+
+	rec := do(http.MethodGet, "bob-token")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET: expected 200, got %d", rec.Code)
+	}
+	if report := decode(rec); len(report.Dangling) != 1 || report.Dangling[0].Ref != "gone" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	if rec := do(http.MethodPost, "bob-token"); rec.Code != http.StatusForbidden {
+		t.Errorf("user fix: expected 403, got %d", rec.Code)
+	}
+
+	rec = do(http.MethodPost, "alice-token")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin fix: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if report := decode(rec); len(report.Fixed) != 1 || len(report.Dangling) != 0 {
+		t.Errorf("unexpected fix report: %+v", report)
+	}
+	if got := server.manager.Get().GetProfileByID("profile-1").PathIDs; len(got) != 1 || got[0] != "hop-1" {
+		t.Errorf("profile path = %v", got)
+	}
+}
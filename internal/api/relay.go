@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/luobobo896/HSSH/internal/lifecycle"
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/transfer"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// uploadMode 校验上传请求的 mode 参数；relay 和 compare 只支持上传单个文件到服务器路径
+func uploadMode(mode, targetPath string, isDir bool) (string, error) {
+	mode, err := transfer.ParseUploadMode(mode)
+	if err != nil {
+		return "", err
+	}
+	if mode != transfer.ModeTunnel && (isDir || transfer.IsObjectURL(targetPath)) {
+		return "", fmt.Errorf("%s mode uploads a single file to a server path", mode)
+	}
+	return mode, nil
+}
+
+// relayUpload 以 relay、stage 或 compare 模式上传暂存的单个文件，返回各模式的吞吐。
+// relay 时 scp 的链只连接了第一跳，stage 时连接到最后一个网关；compare 时 scp 的链是完整的隧道链，
+// 先以 tunnel 上传，再只连接第一跳以 relay 上传同一个文件，新连接由 task 关闭
+func (s *Server) relayUpload(ctx context.Context, logger *log.Logger, task *lifecycle.Owner, scp *transfer.SCPTransfer,
+	hops []*types.Hop, file, targetPath, mode string, progress chan<- *types.TransferProgress) ([]types.ModeThroughput, error) {
+	stat, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	targetHop := hops[len(hops)-1]
+	var modes []types.ModeThroughput
+
+	if mode == transfer.ModeStage {
+		logger.Printf("[UPLOAD] Starting staged transfer via %s: %s -> %s", hops[len(hops)-2].Name, file, targetPath)
+		stage := transfer.StageOptions{Dir: s.config.Upload.StageDir, Quota: s.config.Upload.StageQuota, MaxAge: s.config.Upload.MaxAge}
+		staged := transfer.MeasureMode(transfer.ModeStage, stat.Size(), func() error {
+			err = scp.UploadStaged(ctx, file, targetPath, hops[len(hops)-1:], stage, progress)
+			return err
+		})
+		return append(modes, staged), err
+	}
+
+	if mode == transfer.ModeCompare {
+		logger.Printf("[UPLOAD] Comparing modes, tunnel first: %s -> %s", file, targetPath)
+		tunnel := transfer.MeasureMode(transfer.ModeTunnel, stat.Size(), func() error {
+			return scp.UploadContext(ctx, file, targetPath, progress)
+		})
+		modes = append(modes, tunnel)
+		if tunnel.Error != "" {
+			return modes, fmt.Errorf("tunnel upload failed: %s", tunnel.Error)
+		}
+
+		chain := ssh.NewChain(hops[:1])
+		chain.SetLogger(logger)
+		if err := chain.ConnectContext(ctx); err != nil {
+			return modes, fmt.Errorf("SSH connection failed: %w", err)
+		}
+		task.OnClose(chain.Disconnect)
+		scp = transfer.NewSCPTransfer(chain)
+		scp.SetLogger(logger)
+		scp.SetSpeedWindow(s.config.Upload.SpeedWindow)
+		scp.SetBackups(func(remoteFile string) int { return s.config.Upload.BackupKeep(targetHop, remoteFile) })
+	}
+
+	logger.Printf("[UPLOAD] Starting relay transfer through %d hop(s): %s -> %s", len(hops), file, targetPath)
+	relay := transfer.MeasureMode(transfer.ModeRelay, stat.Size(), func() error {
+		return scp.UploadRelay(ctx, file, targetPath, hops[1:], progress)
+	})
+	modes = append(modes, relay)
+	if relay.Error != "" {
+		return modes, fmt.Errorf("relay upload failed: %s", relay.Error)
+	}
+	return modes, nil
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/ssh"
+)
+
+const (
+	// requestIDHeader 请求 ID 请求/响应头；客户端可自带以便关联两端日志
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength 接受的客户端请求 ID 最大长度
+	maxRequestIDLength = 64
+)
+
+const requestIDContextKey contextKey = "request_id"
+
+// newRequestID 生成随机请求 ID
+func newRequestID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// validRequestID 只接受可安全写入日志的短 ID
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDMiddleware 为每个请求分配 ID（或沿用合法的 X-Request-ID），写入上下文和响应头
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey, id)))
+	})
+}
+
+// requestID 获取当前请求的 ID；未经过中间件时为空
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// requestLogger 返回在每行日志前附带请求 ID 的 logger，用于贯穿后台任务
+func requestLogger(id string) *log.Logger {
+	if id == "" {
+		return log.Default()
+	}
+	return log.New(log.Writer(), fmt.Sprintf("[req %s] ", id), log.Flags()|log.Lmsgprefix)
+}
+
+// statusRecorder 记录响应状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// auditMiddleware 把所有修改请求记录到审计日志
+func (s *Server) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 分块上传的每个 PATCH 不单独记录，完成后的上传任务由 auditUpload 记录
+		if s.audit == nil || safeMethod(r.Method) || isUploadChunk(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		s.recordAudit(audit.Event{
+			RequestID: requestID(r),
+			User:      currentUser(r).Name,
+			Action:    r.Method + " " + r.URL.Path,
+			Status:    rec.status,
+		})
+	})
+}
+
+// isUploadChunk 判断是否为分块上传的数据请求
+func isUploadChunk(r *http.Request) bool {
+	return r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/api/upload/")
+}
+
+// recordAudit 写入审计事件，失败只记日志不影响请求
+func (s *Server) recordAudit(event audit.Event) {
+	if s.audit == nil {
+		return
+	}
+	if err := s.audit.Record(event); err != nil {
+		log.Printf("[AUDIT] %v", err)
+	}
+}
+
+// auditAgentForward 把远端对转发的 ssh-agent 的每次使用记在请求转发的用户名下，被拒绝时记录原因
+func (s *Server) auditAgentForward(use ssh.AgentForwardUse) {
+	event := audit.Event{User: use.User, Action: "ssh.agent_forward", Target: use.Hop.ID, Detail: use.Hop.Name}
+	if use.Err != nil {
+		event.Error = use.Err.Error()
+	}
+	s.recordAudit(event)
+}
+
+// auditLegacyCrypto 把到开启了 legacy_crypto 的服务器的连接写入审计日志，detail 为协商出的旧算法
+func (s *Server) auditLegacyCrypto(use ssh.LegacyCryptoUse) {
+	detail := "negotiated modern algorithms only"
+	if len(use.Negotiated) > 0 {
+		detail = "negotiated " + strings.Join(use.Negotiated, ", ")
+	}
+	s.recordAudit(audit.Event{Action: "ssh.legacy_crypto", Target: use.Hop.ID, Detail: detail})
+}
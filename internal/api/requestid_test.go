@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r)
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{"generated", "", false},
+		{"client supplied", "cli-1234.abc_DEF", true},
+		{"unsafe characters replaced", "evil\ninjected", false},
+		{"too long replaced", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/servers", nil)
+			if tt.incoming != "" {
+				req.Header.Set(requestIDHeader, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(requestIDHeader)
+			if got == "" || got != seen {
+				t.Fatalf("response id %q does not match handler id %q", got, seen)
+			}
+			if (got == tt.incoming) != tt.wantSame {
+				t.Errorf("id = %q, incoming %q, wantSame %v", got, tt.incoming, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestAuditRecordsMutations(t *testing.T) {
+	server, _ := newAuthTestServer(t)
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	handler := requestIDMiddleware(server.authMiddleware(server.auditMiddleware(mux)))
+
+	do := func(method, path, body string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer alice-token")
+		req.Header.Set(requestIDHeader, "req-"+strings.ToLower(method))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	do(http.MethodGet, "/api/servers", "")
+	do(http.MethodDelete, "/api/servers/hop-1", "")
+
+	file, err := os.Open(filepath.Join(server.config.ConfigDir, audit.FileName))
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	var events []audit.Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event audit.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("expected only the DELETE to be audited, got %+v", events)
+	}
+	want := audit.Event{RequestID: "req-delete", User: "alice", Action: "DELETE /api/servers/hop-1", Status: http.StatusNoContent}
+	got := events[0]
+	got.Time = want.Time
+	if got != want {
+		t.Errorf("event = %+v, want %+v", got, want)
+	}
+}
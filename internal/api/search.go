@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/search"
+)
+
+// handleSearch 在服务器、Portal 映射、传输记录和审计日志中搜索，结果按相关度排序并带各类型的匹配数
+// (GET /api/search?q=report.xlsx&type=transfer,audit&days=7&limit=50)。非管理员只能搜到自己的传输和审计记录
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "q", "empty query")
+		return
+	}
+	var opts search.Options
+	if v := query.Get("type"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			if !search.ValidType(t) {
+				localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "type", t)
+				return
+			}
+			opts.Types = append(opts.Types, t)
+		}
+	}
+	if v := query.Get("days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 1 {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "days", v)
+			return
+		}
+		opts.Since = time.Now().AddDate(0, 0, -days)
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > search.MaxLimit {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "limit", v)
+			return
+		}
+		opts.Limit = limit
+	}
+	if user := currentUser(r); !user.IsAdmin() {
+		opts.User = user.Name
+	}
+
+	src := search.Source{Config: s.config}
+	if s.audit != nil {
+		src.AuditPath = filepath.Join(s.config.ConfigDir, audit.FileName)
+	}
+	resp, err := search.Search(src, q, opts)
+	if err != nil {
+		failure(w, r, http.StatusInternalServerError, ErrInternal, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/search"
+)
+
+func TestSearchEndpoint(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	server.recordAudit(audit.Event{User: "bob", Action: "upload.completed", Target: "task-1", Detail: "report.xlsx -> web-1:/srv"})
+	server.recordAudit(audit.Event{User: "carol", Action: "upload.completed", Target: "task-2", Detail: "report.xlsx -> web-1:/tmp"})
+
+	get := func(token, target string) (*httptest.ResponseRecorder, search.Response) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var resp search.Response
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec, resp
+	}
+
+	if rec, resp := get("alice-token", "/api/search?q=report.xlsx&type=transfer"); rec.Code != http.StatusOK || resp.Total != 2 {
+		t.Errorf("admin search: got %d, %+v", rec.Code, resp)
+	}
+	// 非管理员只能搜到自己的传输记录，服务器对所有人可见
+	if rec, resp := get("bob-token", "/api/search?q=web-1"); rec.Code != http.StatusOK || resp.Facets[search.TypeTransfer] != 1 || resp.Facets[search.TypeServer] != 1 {
+		t.Errorf("user search: got %d, %+v", rec.Code, resp)
+	}
+
+	for _, target := range []string{"/api/search", "/api/search?q=x&type=host", "/api/search?q=x&days=0", "/api/search?q=x&limit=100000"} {
+		if rec, _ := get("alice-token", target); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rec.Code)
+		}
+	}
+}
@@ -3,8 +3,8 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"io/fs"
 	"log"
 	"net/http"
@@ -13,15 +13,29 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/luobobo896/HSSH"
+	"github.com/luobobo896/HSSH/internal/agent"
+	"github.com/luobobo896/HSSH/internal/alert"
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/events"
+	"github.com/luobobo896/HSSH/internal/i18n"
 	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/internal/probe"
 	"github.com/luobobo896/HSSH/internal/profiler"
+	"github.com/luobobo896/HSSH/internal/lifecycle"
 	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/internal/resolver"
 	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/teamsync"
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/internal/tracing"
 	"github.com/luobobo896/HSSH/internal/transfer"
+	"github.com/luobobo896/HSSH/internal/usage"
 	"github.com/luobobo896/HSSH/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Helper functions
@@ -87,9 +101,44 @@ type Server struct {
 	profiler      *profiler.NetworkProfiler
 	proxies       *proxy.ForwarderManager
 	uploads       map[string]*types.TransferProgress
+	uploadCancels map[string]context.CancelFunc // 进行中的上传和打包下载任务，紧急停止时取消
+	fetches       map[string]*fetchTask          // 打包下载任务，由 mu 保护
+	chunked       *chunkedUploads // 进行中的分块上传
 	mu            sync.RWMutex
 	portalForwarders map[string]*proxy.PortForwarder // mapping_id -> forwarder
+	portalDraining   map[string]*proxy.PortForwarder // 切换后等待已有连接结束的旧转发器，由 portalMu 保护
+	portalSwitches   map[string]*MappingSwitchover   // 映射最近一次切换，由 portalMu 保护
 	portalMu         sync.RWMutex
+	maintenanceMu    sync.RWMutex // 保护 config.Maintenance
+	approvals        map[string]*Approval // 审批请求，由 approvalsMu 保护
+	approvalsMu      sync.Mutex
+	tickets          map[string]*sessionTicket // 限时会话和转发（kind:id），由 ticketsMu 保护
+	ticketsMu        sync.Mutex
+	recentMu         sync.Mutex   // 保护 config.Recent
+	playbookMu       sync.Mutex   // 保护 config.Playbooks
+	staging          *transfer.Staging
+	owners           *ownerRegistry
+	terminals        map[string]*terminalEntry // session_id -> entry
+	terminalsMu      sync.RWMutex
+	agents           *agent.Hub // 未配置 agents.listen_addr 时为 nil
+	syncer           *teamsync.Syncer // 未配置 sync.source 时为 nil
+	monitor          *statusMonitor   // 仅只读状态页模式下非 nil
+	alerts           *alert.Monitor   // 仅 Web 服务模式下非 nil
+	health           *alert.HealthMonitor // 仅 Web 服务模式下非 nil
+	ports            portRegistry
+	chainPool        *terminal.Pool // 终端使用的 SSH 链连接池，可预热
+	audit            *audit.Logger
+	events           *events.Bus // plugins 订阅的事件总线
+	timings          *requestTimings // 各 API 端点的耗时统计
+	usage            *usage.Store                          // 各服务器的使用量，usage.json 无法读取时为 nil
+	usageMu          sync.Mutex                            // 保护 tunnelSamples
+	tunnelSamples    map[*proxy.PortForwarder]tunnelSample // 隧道上次计入使用量时的状态
+	tokenUser        *types.WebUser // GMSSH_AUTH_TOKEN 指定的管理员，只在内存中，不写入配置
+	probes           *probe.Probes  // /healthz、/readyz
+	onReady          func()         // 开始监听后调用，见 OnReady
+	idleExit         time.Duration  // 空闲退出时间，见 SetIdleExit
+	lastActive       atomic.Int64   // 最近一次活动的时间（UnixNano）
+	startedAt        time.Time
 }
 
 // NewServer 创建新的 API 服务器
@@ -104,49 +153,215 @@ func NewServer() (*Server, error) {
 		return nil, err
 	}
 
-	return &Server{
+	settings := config.Effective(cfg)
+	staging, err := transfer.NewStaging(settings.TempDir, cfg.Upload.MaxAge)
+	if err != nil {
+		return nil, err
+	}
+
+	auditLog, err := audit.Open(filepath.Join(cfg.ConfigDir, audit.FileName))
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用量文件损坏时只停用统计，不影响启动
+	usageStore, err := usage.Open(filepath.Join(cfg.ConfigDir, usage.FileName))
+	if err != nil {
+		log.Printf("Warning: usage statistics disabled: %v", err)
+	}
+
+	// 代理、Portal 映射和 SSH 链共用的解析缓存
+	resolver.Default.Configure(resolver.Options{TTL: cfg.DNS.TTL, NegativeTTL: cfg.DNS.NegativeTTL, MaxTTL: cfg.DNS.MaxTTL})
+
+	// 终端连接池的 keepalive 往返时间计入延迟历史
+	prof := profiler.NewNetworkProfiler(0)
+	poolConfig := terminal.DefaultPoolConfig()
+	poolConfig.OnKeepAlive = prof.Observe
+
+	var tokenUser *types.WebUser
+	if settings.AuthToken != "" {
+		tokenUser = &types.WebUser{Name: "admin", Token: settings.AuthToken, Role: types.WebRoleAdmin}
+	}
+
+	// 审批须由另一名操作员完成：只有 auth_token 时所有请求都以同一身份 admin 发出，
+	// 需要至少两个不同的 web.users 才有人能批准
+	if cfg.Approval.Enabled && distinctWebUsers(cfg.Web.Users) < 2 {
+		return nil, fmt.Errorf("approval requires at least two web.users: the requester cannot approve their own request")
+	}
+
+	// 插件无法加载时拒绝启动，避免审批插件因配置错误而不生效
+	bus := events.New()
+	if err := bus.LoadPlugins(cfg.Plugins); err != nil {
+		bus.Close()
+		return nil, err
+	}
+
+	probes := probe.New()
+	probes.AddCheck("config", func() error {
+		_, err := os.Stat(mgr.StoragePath())
+		return err
+	})
+	probes.AddCheck("staging", func() error {
+		_, err := os.Stat(staging.Dir())
+		return err
+	})
+
+	s := &Server{
 		config:           cfg,
 		manager:          mgr,
-		profiler:         profiler.NewNetworkProfiler(0),
+		profiler:         prof,
 		proxies:          proxy.NewForwarderManager(),
 		uploads:          make(map[string]*types.TransferProgress),
+		uploadCancels:    make(map[string]context.CancelFunc),
+		fetches:          make(map[string]*fetchTask),
+		chunked:          newChunkedUploads(),
 		portalForwarders: make(map[string]*proxy.PortForwarder),
-	}, nil
+		portalDraining:   make(map[string]*proxy.PortForwarder),
+		portalSwitches:   make(map[string]*MappingSwitchover),
+		approvals:        make(map[string]*Approval),
+		tickets:          make(map[string]*sessionTicket),
+		staging:          staging,
+		owners:           newOwnerRegistry(),
+		terminals:        make(map[string]*terminalEntry),
+		chainPool:        terminal.NewPool(poolConfig),
+		audit:            auditLog,
+		events:           bus,
+		timings:          newRequestTimings(),
+		usage:            usageStore,
+		tunnelSamples:    make(map[*proxy.PortForwarder]tunnelSample),
+		tokenUser:        tokenUser,
+		probes:           probes,
+		startedAt:        time.Now(),
+	}
+	ssh.OnLegacyCrypto(s.auditLegacyCrypto)
+	ssh.OnAgentForward(s.auditAgentForward)
+	return s, nil
 }
 
 // RegisterRoutes 注册路由
 func (s *Server) RegisterRoutes(mux *http.ServeMux) {
+	// 存活与就绪探针，不在 /api/ 下，无需认证
+	s.probes.Register(mux)
+
+	// 认证
+	mux.HandleFunc("/api/auth/login", s.handleLogin)
+	mux.HandleFunc("/api/auth/logout", s.handleLogout)
+	mux.HandleFunc("/api/auth/me", s.handleWhoAmI)
+
 	// 服务器管理
 	mux.HandleFunc("/api/servers", s.handleServers)
 	mux.HandleFunc("/api/servers/", s.handleServerDetail)
+	mux.HandleFunc("/api/servers/healthcheck", s.handleHealthCheck)
+	mux.HandleFunc("/api/servers/defaults", s.handleServerDefaults)
+	mux.HandleFunc("/api/usage", s.handleUsage)
+	mux.HandleFunc("/api/export/", s.handleExport)
+	mux.HandleFunc("/api/keys/generate", s.handleGenerateKey)
+	mux.HandleFunc("/api/keys/rotate", s.handleRotateKeys)
+	mux.HandleFunc("/api/trash", s.handleTrash)
+	mux.HandleFunc("/api/trash/", s.handleTrashDetail)
+	mux.HandleFunc("/api/state/backup", s.handleStateBackup)
+	mux.HandleFunc("/api/state/restore", s.handleStateRestore)
 
 	// 路由配置
 	mux.HandleFunc("/api/routes", s.handleRoutes)
+	mux.HandleFunc("/api/playbooks", s.handlePlaybooks)
+	mux.HandleFunc("/api/playbooks/", s.handlePlaybookDetail)
 
 	// 文件上传
 	mux.HandleFunc("/api/upload", s.handleUpload)
+	mux.HandleFunc("/api/upload/", s.handleChunkedUpload)
+	mux.HandleFunc("/api/uploads/staging", s.handleStaging)
+	mux.HandleFunc("/api/uploads/", s.handleUploadDetail)
+	mux.HandleFunc("/api/fetch-dir", s.handleFetchDir)
+	mux.HandleFunc("/api/fetch-dir/", s.handleFetchDirDetail)
+	mux.HandleFunc("/api/edit", s.handleEdit)
+	mux.HandleFunc("/api/backups", s.handleBackups)
+	mux.HandleFunc("/api/backups/restore", s.handleRestoreBackup)
 
 	// 端口转发
 	mux.HandleFunc("/api/proxy", s.handleProxies)
 	mux.HandleFunc("/api/proxy/", s.handleProxyDetail)
 
 	// 性能指标
+	mux.HandleFunc("/api/metrics", s.handleMetrics)
 	mux.HandleFunc("/api/metrics/latency", s.handleLatencyProbe)
+	mux.HandleFunc("/api/metrics/login", s.handleLoginMetrics)
+	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/api/alerts", s.handleAlerts)
+	mux.HandleFunc("/api/diagnostics/trace", s.handleTrace)
+	mux.HandleFunc("/api/diagnostics/tcping", s.handleTCPing)
+	mux.HandleFunc("/api/ports", s.handlePorts)
+	mux.HandleFunc("/api/dns/cache", s.handleDNSCache)
 
 	// WebSocket 进度推送
 	mux.HandleFunc("/api/ws/progress/", s.handleProgressWebSocket)
 
 	// WebSocket 终端
 	mux.HandleFunc("/api/terminal", s.handleTerminal)
+	mux.HandleFunc("/api/terminal/presets", s.handleTerminalPresets)
+	mux.HandleFunc("/api/chains", s.handleChains)
+	mux.HandleFunc("/api/chains/warm", s.handleWarmChains)
+	mux.HandleFunc("/api/sessions", s.handleSessions)
+	mux.HandleFunc("/api/sessions/", s.handleSessionDetail)
+	mux.HandleFunc("/api/sessions/chains", s.handleSessionChains)
+	mux.HandleFunc("/api/sessions/idle", s.handleIdleSessions)
+
+	// 维护窗口
+	mux.HandleFunc("/api/maintenance", s.handleMaintenance)
+	mux.HandleFunc("/api/maintenance/", s.handleMaintenanceDetail)
+	mux.HandleFunc("/api/approvals", s.handleApprovals)
+	mux.HandleFunc("/api/approvals/", s.handleApprovalDetail)
+
+	// 最近使用的终端和上传目标
+	mux.HandleFunc("/api/recent", s.handleRecent)
+
+	// 首次配置向导
+	mux.HandleFunc("/api/setup", s.handleSetup)
+	mux.HandleFunc("/api/setup/check", s.handleSetupCheck)
+
+	// 紧急停止所有隧道和传输
+	mux.HandleFunc("/api/panic", s.handlePanic)
+
+	// 活动连接（代理、Portal 映射转发的连接和终端会话）
+	mux.HandleFunc("/api/connections", s.handleConnections)
+	mux.HandleFunc("/api/connections/", s.handleConnectionDetail)
+
+	// 远端 agent
+	mux.HandleFunc("/api/agents", s.handleAgents)
+	mux.HandleFunc("/api/agents/", s.handleAgentDetail)
+
+	// 团队拓扑同步
+	mux.HandleFunc("/api/sync", s.handleSync)
+
+	// 引用完整性检查
+	mux.HandleFunc("/api/references", s.handleReferences)
+
+	// 从 ~/.ssh/config 导入服务器
+	mux.HandleFunc("/api/config/import-ssh", s.handleImportSSH)
+
+	// 全文搜索
+	mux.HandleFunc("/api/search", s.handleSearch)
+
+	// 主机密钥确认
+	mux.HandleFunc("/api/hostkeys", s.handleHostKeys)
+	mux.HandleFunc("/api/hostkeys/", s.handleHostKeyDecision)
 
 	// 目录浏览
 	mux.HandleFunc("/api/browse/", s.handleBrowse)
 
+	// 远端文件 tail（SSE）
+	mux.HandleFunc("/api/tail", s.handleTail)
+
 	// Portal 端口转发管理
 	mux.HandleFunc("/api/portal", s.handlePortal)
 	mux.HandleFunc("/api/portal/mappings", s.handlePortalMappings)
 	mux.HandleFunc("/api/portal/mappings/", s.handlePortalMappingDetail)
 
+	// 运行时诊断（需在配置中开启）
+	if s.config.Web.DebugEndpoints {
+		s.registerDebugRoutes(mux)
+	}
+
 	// 静态文件（前端）- 使用嵌入的文件系统
 	staticFS, err := fs.Sub(gmssh.WebDist, "web/dist")
 	if err != nil {
@@ -183,31 +398,54 @@ func (s *Server) staticFileHandler(content fs.FS) http.HandlerFunc {
 }
 
 // Start 启动服务器
-func (s *Server) Start(addr string) error {
+func (s *Server) Start(ctx context.Context, addr string) error {
 	mux := http.NewServeMux()
 	s.RegisterRoutes(mux)
 
-	// CORS 中间件
-	handler := corsMiddleware(mux)
+	// 空闲退出：取消 ctx 即按 SIGTERM 的流程优雅关闭
+	if s.idleExit > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithCancel(ctx)
+		defer stop()
+		s.touch()
+		log.Printf("Exiting after %s without sessions, transfers, forwarders or requests", s.idleExit)
+		go s.idleExitLoop(ctx, stop)
+	}
 
-	log.Printf("Starting API server on %s", addr)
-	return http.ListenAndServe(addr, handler)
-}
+	// 定期清理残留的上传暂存目录
+	go s.stagingCleanupLoop(ctx)
 
-// corsMiddleware CORS 中间件
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	// 维护窗口开始时关闭已有会话，结束后移除
+	go s.maintenanceLoop(ctx)
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+	// 定期统计隧道使用量并保存
+	go s.usageLoop(ctx)
+
+	// agent 控制面
+	if s.config.Agents.ListenAddr != "" {
+		if err := s.startAgentHub(); err != nil {
+			return err
 		}
+	}
 
-		next.ServeHTTP(w, r)
-	})
+	// 团队拓扑同步
+	if s.config.Sync.Source != "" {
+		if err := s.startTeamSync(ctx); err != nil {
+			return err
+		}
+	}
+
+	// 路由延迟告警
+	s.startRouteAlerts(ctx)
+
+	// 请求 ID + 耗时统计 + CORS/来源校验 + 认证 + CSRF + 审计中间件
+	handler := requestIDMiddleware(s.timingMiddleware(mux, s.corsMiddleware(s.authMiddleware(s.csrfMiddleware(s.auditMiddleware(mux))))))
+	if s.idleExit > 0 {
+		handler = s.activityMiddleware(handler)
+	}
+
+	log.Printf("Starting API server on %s", addr)
+	return s.serve(ctx, &http.Server{Addr: addr, Handler: handler})
 }
 
 // jsonResponse 发送 JSON 响应
@@ -219,9 +457,33 @@ func jsonResponse(w http.ResponseWriter, status int, data interface{}) {
 	}
 }
 
-// errorResponse 发送错误响应
-func errorResponse(w http.ResponseWriter, status int, message string) {
-	jsonResponse(w, status, map[string]string{"error": message})
+// errorResponse 发送错误响应，code 为稳定的错误代码（见 errors.go），message 为说明文字
+func errorResponse(w http.ResponseWriter, status int, code, message string) {
+	jsonResponse(w, status, map[string]string{"error": message, "code": code})
+}
+
+// ServerResponse 服务器 API 返回的服务器，不含登录密码和私钥口令，只用 has_password / has_passphrase 说明是否已设置
+type ServerResponse struct {
+	types.Hop
+	HasPassword   bool `json:"has_password"`
+	HasPassphrase bool `json:"has_passphrase"`
+}
+
+// serverResponse 去掉 hop 中的凭据
+func serverResponse(hop *types.Hop) ServerResponse {
+	resp := ServerResponse{Hop: *hop, HasPassword: hop.Password != "", HasPassphrase: hop.KeyPassphrase != ""}
+	resp.Password = ""
+	resp.KeyPassphrase = ""
+	return resp
+}
+
+// serverResponses 去掉每个 hop 中的凭据
+func serverResponses(hops []*types.Hop) []ServerResponse {
+	resp := make([]ServerResponse, 0, len(hops))
+	for _, hop := range hops {
+		resp = append(resp, serverResponse(hop))
+	}
+	return resp
 }
 
 // CreateServerRequest 创建服务器请求
@@ -234,36 +496,157 @@ type CreateServerRequest struct {
 	KeyPath    string `json:"key_path,omitempty"`
 	Password   string `json:"password,omitempty"`
 	ServerType string `json:"server_type"`          // "external" | "internal"
+	// KeyPassphrase 加密私钥的口令（可写 env:NAME），更新时为 null 表示保留，"" 表示清除；不保存时用 POST /api/servers/{id}/unlock 临时解锁
+	KeyPassphrase *string `json:"key_passphrase,omitempty"`
 	GatewayID  string `json:"gateway_id,omitempty"` // 内网服务器的网关ID
+	// 打开终端时默认使用的预设和服务器自己的终端设置
+	TerminalPreset string                 `json:"terminal_preset,omitempty"`
+	Terminal       *types.TerminalOptions `json:"terminal,omitempty"`
+	// Tags 更新时为 null 表示保留原标签，[] 表示清空
+	Tags []string `json:"tags,omitempty"`
+	// Environment 环境标签（prod、staging、dev 等），更新时为 null 表示保留，"" 表示清除
+	Environment *string `json:"environment,omitempty"`
+	// ClientVersion 发送的 SSH 版本串（可只写 OpenSSH_8.9p1 这样的软件版本），更新时为 null 表示保留，"" 表示恢复默认
+	ClientVersion *string `json:"client_version,omitempty"`
+	// LegacyCrypto 允许该服务器协商已弃用的算法，更新时为 null 表示保留
+	LegacyCrypto *bool `json:"legacy_crypto,omitempty"`
+	// AllowAgentForwarding 该服务器上的终端转发本机 ssh-agent（还需 agent_forwarding 策略允许），更新时为 null 表示保留
+	AllowAgentForwarding *bool `json:"allow_agent_forwarding,omitempty"`
+	// Notes 说明、负责人、运维手册链接等信息，更新时为 null 表示保留，{} 表示清空
+	Notes *types.HopNotes `json:"notes,omitempty"`
+	// HostKeyPolicy 主机密钥校验策略（tofu、strict、off），HostKey 固定的主机密钥；更新时为 null 表示保留，"" 表示恢复默认或取消固定
+	HostKeyPolicy *string `json:"host_key_policy,omitempty"`
+	HostKey       *string `json:"host_key,omitempty"`
+	// Address 添加时可用 user@host:port 连接串代替 user、host、port，未填写 name 时按主机生成
+	Address string `json:"address,omitempty"`
+}
+
+// checkTerminalSettings 校验请求中的终端预设和设置，不合法时写入错误响应并返回 false
+func (s *Server) checkTerminalSettings(w http.ResponseWriter, r *http.Request, req *CreateServerRequest) bool {
+	if req.TerminalPreset != "" && s.config.GetTerminalPreset(req.TerminalPreset) == nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_UNKNOWN_TERMINAL_PRESET", req.TerminalPreset)
+		return false
+	}
+	if err := req.Terminal.Validate(); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_TERMINAL", err)
+		return false
+	}
+	return true
+}
+
+// checkClientVersion 校验并补全请求中的 SSH 客户端版本串，不合法时写入错误响应并返回 false
+func checkClientVersion(w http.ResponseWriter, r *http.Request, req *CreateServerRequest) bool {
+	if req.ClientVersion == nil {
+		return true
+	}
+	version, err := types.NormalizeClientVersion(*req.ClientVersion)
+	if err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_CLIENT_VERSION", err)
+		return false
+	}
+	req.ClientVersion = &version
+	return true
+}
+
+// checkNotes 校验请求中的说明信息，不合法时写入错误响应并返回 false
+func checkNotes(w http.ResponseWriter, r *http.Request, req *CreateServerRequest) bool {
+	if err := req.Notes.Validate(); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_NOTES", err)
+		return false
+	}
+	return true
+}
+
+// checkHostKey 校验请求中的主机密钥策略和固定的主机密钥，更新时与 current 中未修改的设置一起校验；不合法时写入错误响应并返回 false
+func checkHostKey(w http.ResponseWriter, r *http.Request, req *CreateServerRequest, current *types.Hop) bool {
+	var policy, hostKey string
+	if current != nil {
+		policy, hostKey = current.HostKeyPolicy, current.HostKey
+	}
+	if req.HostKeyPolicy != nil {
+		policy = *req.HostKeyPolicy
+	}
+	if req.HostKey != nil {
+		hostKey = strings.TrimSpace(*req.HostKey)
+		req.HostKey = &hostKey
+	}
+	if err := types.ValidateHostKeySettings(policy, hostKey); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_HOST_KEY", err)
+		return false
+	}
+	return true
 }
 
 // handleServers 处理服务器列表
 func (s *Server) handleServers(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		jsonResponse(w, http.StatusOK, s.config.Hops)
+		// ?q= 按名称、地址、标签、环境和说明信息搜索
+		q := r.URL.Query().Get("q")
+		if q == "" {
+			jsonResponse(w, http.StatusOK, serverResponses(s.config.Hops))
+			return
+		}
+		matched := []*types.Hop{}
+		for _, hop := range s.config.Hops {
+			if hop.Matches(q) {
+				matched = append(matched, hop)
+			}
+		}
+		jsonResponse(w, http.StatusOK, serverResponses(matched))
 	case http.MethodPost:
+		if !requireAdmin(w, r) {
+			return
+		}
 		var req CreateServerRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			errorResponse(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
 			return
 		}
 
+		// 连接串只填充单独未填写的字段
+		if req.Address != "" {
+			cs, err := types.ParseConnString(req.Address)
+			if err != nil {
+				localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_ADDRESS", err)
+				return
+			}
+			if req.Host == "" {
+				req.Host = cs.Host
+			}
+			if req.User == "" {
+				req.User = cs.User
+			}
+			if req.Port == 0 {
+				req.Port = cs.Port
+			}
+			if req.Name == "" {
+				req.Name = s.config.UniqueHopName(cs.DefaultName())
+			}
+		}
+
+		// 未填写的用户、端口和密钥路径先取 server_defaults，再取下面的内置默认值
+		defaults := s.config.ServerDefaults
+		if req.User == "" {
+			req.User = defaults.User
+		}
+		if req.Port == 0 {
+			req.Port = defaults.Port
+		}
+		if req.KeyPath == "" && req.AuthType == "key" {
+			req.KeyPath = defaults.KeyPath
+		}
+
 		// 验证必填字段
 		if req.Name == "" || req.Host == "" || req.User == "" {
-			errorResponse(w, http.StatusBadRequest, "name, host, and user are required")
+			localizedError(w, r, http.StatusBadRequest, "ERR_HOP_FIELDS_REQUIRED")
 			return
 		}
 
 		// 转换 auth_type
-		var authMethod types.AuthMethod
-		switch req.AuthType {
-		case "key":
-			authMethod = types.AuthKey
-		case "password":
-			authMethod = types.AuthPassword
-		default:
-			errorResponse(w, http.StatusBadRequest, "auth_type must be 'key' or 'password'")
+		authMethod, err := types.ParseAuthMethod(req.AuthType)
+		if err != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_AUTH_TYPE", req.AuthType)
 			return
 		}
 
@@ -274,24 +657,33 @@ func (s *Server) handleServers(w http.ResponseWriter, r *http.Request) {
 			serverType = types.ServerExternal
 		case "internal", "1":
 			serverType = types.ServerInternal
+		case "":
+			// 未指定类型时，填写了网关即为内网服务器
+			if req.GatewayID != "" {
+				serverType = types.ServerInternal
+			}
 		default:
 			serverType = types.ServerExternal // 默认外网
 		}
 
 		// 内网服务器必须配置网关
 		if serverType == types.ServerInternal && req.GatewayID == "" {
-			errorResponse(w, http.StatusBadRequest, "internal server requires a gateway")
+			localizedError(w, r, http.StatusBadRequest, "ERR_GATEWAY_REQUIRED")
 			return
 		}
 
 		// 验证 gateway_id 存在且有效
 		if req.GatewayID != "" {
 			if gateway := s.config.GetHopByID(req.GatewayID); gateway == nil {
-				errorResponse(w, http.StatusBadRequest, "invalid gateway_id: gateway not found")
+				localizedError(w, r, http.StatusBadRequest, "ERR_GATEWAY_NOT_FOUND")
 				return
 			}
 		}
 
+		if !s.checkTerminalSettings(w, r, &req) || !checkClientVersion(w, r, &req) || !checkNotes(w, r, &req) || !checkHostKey(w, r, &req, nil) {
+			return
+		}
+
 		// 设置默认端口
 		if req.Port == 0 {
 			req.Port = 22
@@ -303,23 +695,50 @@ func (s *Server) handleServers(w http.ResponseWriter, r *http.Request) {
 		}
 
 		hop := &types.Hop{
-			Name:       req.Name,
-			Host:       req.Host,
-			Port:       req.Port,
-			User:       req.User,
-			AuthType:   authMethod,
-			KeyPath:    req.KeyPath,
-			Password:   req.Password,
-			ServerType: serverType,
-			GatewayID:  req.GatewayID,
+			Name:           req.Name,
+			Host:           req.Host,
+			Port:           req.Port,
+			User:           req.User,
+			AuthType:       authMethod,
+			KeyPath:        req.KeyPath,
+			Password:       req.Password,
+			ServerType:     serverType,
+			GatewayID:      req.GatewayID,
+			TerminalPreset: req.TerminalPreset,
+			Terminal:       req.Terminal,
+			Tags:           req.Tags,
+		}
+		if req.Environment != nil {
+			hop.Environment = *req.Environment
+		}
+		if req.ClientVersion != nil {
+			hop.ClientVersion = *req.ClientVersion
+		}
+		if req.LegacyCrypto != nil {
+			hop.LegacyCrypto = *req.LegacyCrypto
+		}
+		if req.AllowAgentForwarding != nil {
+			hop.AllowAgentForwarding = *req.AllowAgentForwarding
+		}
+		if !req.Notes.Empty() {
+			hop.Notes = req.Notes
+		}
+		if req.HostKeyPolicy != nil {
+			hop.HostKeyPolicy = *req.HostKeyPolicy
+		}
+		if req.HostKey != nil {
+			hop.HostKey = *req.HostKey
+		}
+		if req.KeyPassphrase != nil {
+			hop.KeyPassphrase = *req.KeyPassphrase
 		}
 
 		if err := s.manager.AddHop(hop); err != nil {
-			errorResponse(w, http.StatusConflict, err.Error())
+			failure(w, r, http.StatusConflict, "ERR_ALREADY_EXISTS", err)
 			return
 		}
 
-		jsonResponse(w, http.StatusCreated, hop)
+		jsonResponse(w, http.StatusCreated, serverResponse(hop))
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
@@ -345,7 +764,7 @@ func (s *Server) handleServerDetail(w http.ResponseWriter, r *http.Request) {
 	// 查找服务器
 	hop := s.config.GetHopByID(id)
 	if hop == nil {
-		errorResponse(w, http.StatusNotFound, "Server not found")
+		localizedError(w, r, http.StatusNotFound, "ERR_HOP_NOT_FOUND")
 		return
 	}
 
@@ -355,33 +774,88 @@ func (s *Server) handleServerDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 远端进程和监听端口 /api/servers/:id/processes[/:pid/kill]、/api/servers/:id/ports
+	if subPath == "processes" || strings.HasPrefix(subPath, "processes/") {
+		s.handleProcesses(w, r, hop, strings.TrimPrefix(strings.TrimPrefix(subPath, "processes"), "/"))
+		return
+	}
+	if subPath == "ports" {
+		s.handleListeners(w, r, hop)
+		return
+	}
+
+	// 远端 tmux/screen 会话 /api/servers/:id/sessions
+	if subPath == "sessions" {
+		s.handleRemoteSessions(w, r, hop)
+		return
+	}
+
+	// 部署公钥 /api/servers/:id/deploy-key
+	if subPath == "deploy-key" {
+		s.handleDeployKey(w, r, hop)
+		return
+	}
+
+	// 定时检查记录的状态变化 /api/servers/:id/uptime
+	if subPath == "uptime" {
+		s.handleUptime(w, r, hop)
+		return
+	}
+
+	// 登录各阶段耗时 /api/servers/:id/login
+	if subPath == "login" {
+		s.handleServerLogin(w, r, hop)
+		return
+	}
+
+	// 复制服务器 /api/servers/:id/clone
+	if subPath == "clone" {
+		s.handleCloneServer(w, r, hop)
+		return
+	}
+
+	// 使用量 /api/servers/:id/usage
+	if subPath == "usage" {
+		s.handleServerUsage(w, r, hop)
+		return
+	}
+
+	// 解锁加密私钥 /api/servers/:id/unlock
+	if subPath == "unlock" {
+		s.handleUnlockKey(w, r, hop)
+		return
+	}
+
+	// 收藏 /api/servers/:id/favorite
+	if subPath == "favorite" {
+		s.handleFavorite(w, r, hop)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
-		jsonResponse(w, http.StatusOK, hop)
+		jsonResponse(w, http.StatusOK, serverResponse(hop))
 	case http.MethodPut:
+		if !requireAdmin(w, r) {
+			return
+		}
 		var req CreateServerRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			log.Printf("[DEBUG] PUT /api/servers/%s - JSON decode error: %v", id, err)
-			errorResponse(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
 			return
 		}
 		log.Printf("[DEBUG] PUT /api/servers/%s - request: %+v", id, req)
 		log.Printf("[DEBUG] PUT /api/servers/%s - existing: server_type=%d, gateway_id=%s", id, hop.ServerType, hop.GatewayID)
 
 		// 转换 auth_type
-		var authMethod types.AuthMethod
+		authMethod := hop.AuthType
 		if req.AuthType != "" {
-			switch req.AuthType {
-			case "key":
-				authMethod = types.AuthKey
-			case "password":
-				authMethod = types.AuthPassword
-			default:
-				errorResponse(w, http.StatusBadRequest, "auth_type must be 'key' or 'password'")
+			var err error
+			if authMethod, err = types.ParseAuthMethod(req.AuthType); err != nil {
+				localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_AUTH_TYPE", req.AuthType)
 				return
 			}
-		} else {
-			authMethod = hop.AuthType
 		}
 
 		// 转换 server_type (支持数字和字符串两种格式)
@@ -403,7 +877,7 @@ func (s *Server) handleServerDetail(w http.ResponseWriter, r *http.Request) {
 		gatewayID := hop.GatewayID
 		if req.GatewayID != "" {
 			if gateway := s.config.GetHopByID(req.GatewayID); gateway == nil {
-				errorResponse(w, http.StatusBadRequest, "invalid gateway_id: gateway not found")
+				localizedError(w, r, http.StatusBadRequest, "ERR_GATEWAY_NOT_FOUND")
 				return
 			}
 			gatewayID = req.GatewayID
@@ -413,36 +887,93 @@ func (s *Server) handleServerDetail(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[DEBUG] PUT /api/servers/%s - serverType=%d, req.GatewayID=%s, existing.GatewayID=%s", id, serverType, req.GatewayID, hop.GatewayID)
 		if serverType == types.ServerInternal && gatewayID == "" {
 			log.Printf("[DEBUG] PUT /api/servers/%s - rejected: internal server requires gateway", id)
-			errorResponse(w, http.StatusBadRequest, "internal server requires a gateway")
+			localizedError(w, r, http.StatusBadRequest, "ERR_GATEWAY_REQUIRED")
 			return
 		}
 
+		if !s.checkTerminalSettings(w, r, &req) || !checkClientVersion(w, r, &req) || !checkNotes(w, r, &req) || !checkHostKey(w, r, &req, hop) {
+			return
+		}
+		terminalOpts := hop.Terminal
+		if req.Terminal != nil {
+			terminalOpts = req.Terminal
+		}
+		tags := hop.Tags
+		if req.Tags != nil {
+			tags = req.Tags
+		}
+		environment := hop.Environment
+		if req.Environment != nil {
+			environment = *req.Environment
+		}
+		clientVersion := hop.ClientVersion
+		if req.ClientVersion != nil {
+			clientVersion = *req.ClientVersion
+		}
+		legacyCrypto := hop.LegacyCrypto
+		if req.LegacyCrypto != nil {
+			legacyCrypto = *req.LegacyCrypto
+		}
+		agentForwarding := hop.AllowAgentForwarding
+		if req.AllowAgentForwarding != nil {
+			agentForwarding = *req.AllowAgentForwarding
+		}
+		hostKeyPolicy, hostKey := hop.HostKeyPolicy, hop.HostKey
+		if req.HostKeyPolicy != nil {
+			hostKeyPolicy = *req.HostKeyPolicy
+		}
+		if req.HostKey != nil {
+			hostKey = *req.HostKey
+		}
+		keyPassphrase := hop.KeyPassphrase
+		if req.KeyPassphrase != nil {
+			keyPassphrase = *req.KeyPassphrase
+		}
+		notes := hop.Notes
+		if req.Notes != nil {
+			notes = req.Notes
+			if notes.Empty() {
+				notes = nil
+			}
+		}
+
 		// 使用现有值或新值
 		updatedHop := &types.Hop{
-			ID:         hop.ID, // 保留原 ID
-			Name:       firstNonEmpty(req.Name, hop.Name),
-			Host:       firstNonEmpty(req.Host, hop.Host),
-			Port:       firstNonZero(req.Port, hop.Port),
-			User:       firstNonEmpty(req.User, hop.User),
-			AuthType:   authMethod,
-			KeyPath:    firstNonEmpty(req.KeyPath, hop.KeyPath),
-			Password:   firstNonEmpty(req.Password, hop.Password),
-			ServerType: serverType,
-			GatewayID:  gatewayID,
+			ID:             hop.ID, // 保留原 ID
+			Name:           firstNonEmpty(req.Name, hop.Name),
+			Host:           firstNonEmpty(req.Host, hop.Host),
+			Port:           firstNonZero(req.Port, hop.Port),
+			User:           firstNonEmpty(req.User, hop.User),
+			AuthType:       authMethod,
+			KeyPath:        firstNonEmpty(req.KeyPath, hop.KeyPath),
+			Password:       firstNonEmpty(req.Password, hop.Password),
+			KeyPassphrase:  keyPassphrase,
+			ServerType:     serverType,
+			GatewayID:      gatewayID,
+			TerminalPreset: firstNonEmpty(req.TerminalPreset, hop.TerminalPreset),
+			Terminal:       terminalOpts,
+			LastCheck:      hop.LastCheck,
+			Tags:           tags,
+			Environment:    environment,
+			ClientVersion:  clientVersion,
+			LegacyCrypto:   legacyCrypto,
+			AllowAgentForwarding: agentForwarding,
+			Notes:          notes,
+			HostKeyPolicy:  hostKeyPolicy,
+			HostKey:        hostKey,
 		}
 
 		if err := s.manager.UpdateHop(id, updatedHop); err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+			failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
 			return
 		}
 
-		jsonResponse(w, http.StatusOK, updatedHop)
+		jsonResponse(w, http.StatusOK, serverResponse(updatedHop))
 	case http.MethodDelete:
-		if err := s.manager.DeleteHop(id); err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+		if !requireAdmin(w, r) || !s.confirmEnvironment(w, r, hop, types.OpDelete) {
 			return
 		}
-		jsonResponse(w, http.StatusNoContent, nil)
+		s.deleteHop(w, r, id)
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
@@ -462,14 +993,17 @@ func (s *Server) handleRoutes(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		jsonResponse(w, http.StatusOK, s.config.Routes)
 	case http.MethodPost:
+		if !requireAdmin(w, r) {
+			return
+		}
 		var req CreateRouteRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			errorResponse(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
 			return
 		}
 
 		if req.From == "" || req.To == "" {
-			errorResponse(w, http.StatusBadRequest, "from and to are required")
+			localizedError(w, r, http.StatusBadRequest, "ERR_ROUTE_FIELDS_REQUIRED")
 			return
 		}
 
@@ -481,7 +1015,7 @@ func (s *Server) handleRoutes(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if err := s.manager.AddRoute(route); err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+			failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
 			return
 		}
 
@@ -498,147 +1032,381 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 解析 multipart form (100MB max memory)
-	if err := r.ParseMultipartForm(100 << 20); err != nil {
-		errorResponse(w, http.StatusBadRequest, "Failed to parse form: "+err.Error())
+	// 保存到暂存目录
+	tempDir, err := s.staging.Create()
+	if err != nil {
+		localizedError(w, r, http.StatusInternalServerError, "ERR_STAGING", err)
 		return
 	}
 
-	targetPath := r.FormValue("target_path")
-	targetHost := r.FormValue("target_host")
-	viaStr := r.FormValue("via")
-	isDir := r.FormValue("is_dir") == "true"
-
-	if targetPath == "" || targetHost == "" {
-		errorResponse(w, http.StatusBadRequest, "target_path and target_host are required")
+	// 流式写入暂存目录，避免 ParseMultipartForm 将大文件落到系统临时目录
+	form, err := stageMultipartUpload(r, tempDir)
+	if err != nil {
+		s.staging.Remove(tempDir)
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_FORM", err)
 		return
 	}
 
-	// 创建上传任务
-	taskID := fmt.Sprintf("upload-%d", time.Now().UnixNano())
+	targetPath := form.fields["target_path"]
+	targetHost := form.fields["target_host"]
+	viaStr := form.fields["via"]
+	isDir := form.fields["is_dir"] == "true"
+	mode := form.fields["mode"]
+	learned := learnedParam(form.fields["learned"])
+	adaptive := s.adaptiveUpload(form.fields["adaptive"], targetHost, learned)
 
-	// 保存到临时目录
-	tempDir, err := os.MkdirTemp("", "gmssh-upload-*")
-	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, "Failed to create temp dir: "+err.Error())
+	if targetPath == "" || targetHost == "" {
+		s.staging.Remove(tempDir)
+		localizedError(w, r, http.StatusBadRequest, "ERR_UPLOAD_TARGET_REQUIRED")
+		return
+	}
+	if _, err := objectTarget(targetPath, isDir); err != nil {
+		s.staging.Remove(tempDir)
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_OBJECT_TARGET", err)
+		return
+	}
+	if mode, err = uploadMode(mode, targetPath, isDir); err != nil {
+		s.staging.Remove(tempDir)
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_UPLOAD_MODE", err)
+		return
+	}
+	if !s.checkMaintenance(w, r, append(strings.Split(viaStr, ","), targetHost)...) {
+		s.staging.Remove(tempDir)
+		return
+	}
+	// 上传到对象存储不会覆盖服务器上的文件
+	if !transfer.IsObjectURL(targetPath) && !s.confirmEnvironment(w, r, s.configuredHop(targetHost), types.OpUpload) {
+		s.staging.Remove(tempDir)
 		return
 	}
 
-	var totalSize int64
 	var displayName string
-
 	if isDir {
 		// 文件夹上传：处理多个文件
-		files := r.MultipartForm.File["files"]
-		if len(files) == 0 {
-			errorResponse(w, http.StatusBadRequest, "No files in directory upload")
+		if len(form.files["files"]) == 0 {
+			s.staging.Remove(tempDir)
+			localizedError(w, r, http.StatusBadRequest, "ERR_NO_FILES")
 			return
 		}
 
-		log.Printf("[UPLOAD] Directory upload: %d files", len(files))
-		displayName = files[0].Filename
+		log.Printf("[UPLOAD] Directory upload: %d files", len(form.files["files"]))
+		displayName = form.files["files"][0]
 		// 从第一个文件名提取文件夹名
 		if idx := strings.Index(displayName, "/"); idx > 0 {
 			displayName = displayName[:idx]
 		}
-
-		for _, header := range files {
-			file, err := header.Open()
-			if err != nil {
-				log.Printf("[UPLOAD] Failed to open file %s: %v", header.Filename, err)
-				continue
-			}
-
-			// 创建目录结构
-			filePath := filepath.Join(tempDir, header.Filename)
-			dir := filepath.Dir(filePath)
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				log.Printf("[UPLOAD] Failed to create dir %s: %v", dir, err)
-				file.Close()
-				continue
-			}
-
-			f, err := os.Create(filePath)
-			if err != nil {
-				log.Printf("[UPLOAD] Failed to create file %s: %v", filePath, err)
-				file.Close()
-				continue
-			}
-
-			size, err := io.Copy(f, file)
-			file.Close()
-			f.Close()
-			
-			if err != nil {
-				log.Printf("[UPLOAD] Failed to save file %s: %v", header.Filename, err)
-				continue
-			}
-			totalSize += size
-		}
 	} else {
 		// 单文件上传
-		file, header, err := r.FormFile("file")
-		if err != nil {
-			errorResponse(w, http.StatusBadRequest, "Failed to get file: "+err.Error())
+		if len(form.files["file"]) == 0 {
+			s.staging.Remove(tempDir)
+			localizedError(w, r, http.StatusBadRequest, "ERR_NO_FILE")
 			return
 		}
-		defer file.Close()
+		displayName = form.files["file"][0]
+	}
 
-		displayName = header.Filename
-		tempFile := filepath.Join(tempDir, header.Filename)
-		f, err := os.Create(tempFile)
-		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, "Failed to create temp file: "+err.Error())
-			return
-		}
+	// 解析 via 链
+	var via []string
+	if viaStr != "" {
+		via = strings.Split(viaStr, ",")
+	}
 
-		size, err := io.Copy(f, file)
-		f.Close()
-		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, "Failed to save file: "+err.Error())
-			return
-		}
-		totalSize = size
+	// diff=1 时覆盖已有文件前先返回 diff；确认后需带 force=1 重新上传
+	if !isDir && !transfer.IsObjectURL(targetPath) && wantsOverwriteDiff(r) && s.confirmUploadOverwrite(w, r, tempDir, targetHost, targetPath, via) {
+		s.staging.Remove(tempDir)
+		return
+	}
+
+	// 创建上传任务
+	taskID := fmt.Sprintf("upload-%d", time.Now().UnixNano())
+	if rejection := s.checkEvent(r, s.uploadEvent(taskID, targetHost, targetPath, via)); rejection != nil {
+		s.staging.Remove(tempDir)
+		pluginRejected(w, r, rejection)
+		return
 	}
 
 	// 创建传输进度记录
 	progress := &types.TransferProgress{
 		TaskID:     taskID,
 		FileName:   displayName,
-		TotalBytes: totalSize,
+		TotalBytes: form.totalSize,
 		SentBytes:  0,
 		Status:     "pending",
 		Timestamp:  time.Now(),
+		RequestID:  requestID(r),
 	}
 
 	s.mu.Lock()
 	s.uploads[taskID] = progress
 	s.mu.Unlock()
+	s.owners.set(ownerKindUpload, taskID, currentUser(r))
 
-	// 解析 via 链
-	var via []string
-	if viaStr != "" {
-		via = strings.Split(viaStr, ",")
-	}
+	s.touchRecent(currentUser(r), types.RecentUpload, targetHost, targetPath, via)
 
 	// 异步执行上传
 	go func() {
-		s.executeUpload(taskID, tempDir, targetHost, targetPath, via, isDir)
+		s.executeUpload(taskID, tempDir, targetHost, targetPath, via, mode, isDir, adaptive, learned)
 	}()
 
 	jsonResponse(w, http.StatusOK, map[string]string{"task_id": taskID})
 }
 
-// executeUpload 执行实际上传
-func (s *Server) executeUpload(taskID, localPath, targetHost, targetPath string, via []string, isDir bool) {
-	log.Printf("[UPLOAD] Starting upload: taskID=%s, localPath=%s, targetHost=%s, targetPath=%s, via=%v, isDir=%v", 
-		taskID, localPath, targetHost, targetPath, via, isDir)
-	
+// executeUpload 执行实际上传；adaptive 时单文件按测量结果选择参数（见 transfer.UploadAdaptive）。
+// learned 时未指定 via 的上传沿用目标 playbook 中的跳板链，自适应上传沿用其中的传输参数。
+// mode 为 relay 或 compare 时单文件经各跳逐跳转发（见 transfer.UploadRelay），stage 时先暂存在最后一个网关
+// （见 transfer.UploadStaged）；链只有一跳时按 tunnel 上传
+func (s *Server) executeUpload(taskID, localPath, targetHost, targetPath string, via []string, mode string, isDir, adaptive, learned bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	s.mu.Lock()
 	progress := s.uploads[taskID]
 	progress.Status = "running"
+	s.uploadCancels[taskID] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.uploadCancels, taskID)
+		s.mu.Unlock()
+	}()
+
+	// 日志、SSH 链和传输都带上发起请求的 ID
+	logger := requestLogger(progress.RequestID)
+	ctx, span := tracing.Start(ctx, "upload",
+		attribute.String("request.id", progress.RequestID),
+		attribute.String("upload.task_id", taskID),
+		attribute.String("upload.target", targetHost),
+	)
+	defer func() {
+		var err error
+		s.mu.RLock()
+		if progress.Status == "failed" {
+			err = errors.New(progress.Error)
+		}
+		s.mu.RUnlock()
+		tracing.End(span, err)
+	}()
+	logger.Printf("[UPLOAD] Starting upload: taskID=%s, localPath=%s, targetHost=%s, targetPath=%s, via=%v, isDir=%v",
+		taskID, localPath, targetHost, transfer.ObjectTarget{URL: targetPath}.Redacted(), via, isDir)
+
+	if len(via) == 0 && learned {
+		if learnedVia := s.learnedVia(s.probeTarget(targetHost)); learnedVia != nil {
+			logger.Printf("[UPLOAD] Using learned via chain for %s: %v", targetHost, learnedVia)
+			via = learnedVia
+		}
+	}
+	hops := s.uploadHops(logger, targetHost, via)
+	if hops == nil {
+		logger.Printf("[UPLOAD] ERROR: Internal server %s has no gateway configured", targetHost)
+		s.mu.Lock()
+		progress.Status = "failed"
+		progress.Error = fmt.Sprintf("内网服务器 %s 未配置网关", targetHost)
+		progress.ErrorCode = "ERR_GATEWAY_REQUIRED"
+		s.mu.Unlock()
+		s.auditUpload(progress, targetHost, targetPath)
+		s.staging.Remove(localPath)
+		return
+	}
+
+	logger.Printf("[UPLOAD] Total hops in chain: %d", len(hops))
+	if mode != transfer.ModeTunnel && len(hops) < 2 {
+		logger.Printf("[UPLOAD] No gateway to relay through, using tunnel mode instead of %s", mode)
+		mode = transfer.ModeTunnel
+	}
+	s.mu.Lock()
+	progress.Mode = mode
 	s.mu.Unlock()
 
+	// 排队期间（如分块上传完成前）开始的维护窗口同样拒绝
+	if window, hop := s.activeMaintenance(hops); window != nil {
+		logger.Printf("[UPLOAD] ERROR: %s is under maintenance (window %s)", hop.Name, window.ID)
+		s.mu.Lock()
+		progress.Status = "failed"
+		progress.Error = maintenanceMessage(i18n.Default(), window, hop)
+		progress.ErrorCode = "ERR_MAINTENANCE"
+		s.mu.Unlock()
+		s.auditUpload(progress, targetHost, targetPath)
+		s.staging.Remove(localPath)
+		return
+	}
+
+	// 上传策略在审批和连接之前检查，被拒绝的文件不会打扰审批人
+	if !s.checkUploadPolicy(ctx, logger, progress, hops[len(hops)-1], localPath, targetPath, isDir) {
+		s.auditUpload(progress, targetHost, targetPath)
+		s.staging.Remove(localPath)
+		return
+	}
+
+	// 目标需要审批时在连接前等待，可通过取消任务撤回
+	if hop := s.approvalHop(hops); hop != nil {
+		approval := s.requestApproval(&Approval{
+			Kind:        approvalKindUpload,
+			Server:      hop.Name,
+			Target:      transfer.ObjectTarget{URL: targetPath}.Redacted(),
+			TaskID:      taskID,
+			RequestedBy: s.owners.owner(ownerKindUpload, taskID),
+			RequestID:   progress.RequestID,
+		})
+		s.mu.Lock()
+		progress.Status = "awaiting_approval"
+		progress.ApprovalID = approval.ID
+		s.mu.Unlock()
+		logger.Printf("[UPLOAD] Waiting for approval %s to upload to %s", approval.ID, hop.Name)
+		if status := s.awaitApproval(ctx, approval); status != approvalApproved {
+			logger.Printf("[UPLOAD] ERROR: Approval %s %s", approval.ID, status)
+			code, message := approvalFailure(i18n.Default(), approval, status)
+			s.mu.Lock()
+			progress.Status = "failed"
+			progress.Error = message
+			progress.ErrorCode = code
+			s.mu.Unlock()
+			s.auditUpload(progress, targetHost, targetPath)
+			s.staging.Remove(localPath)
+			return
+		}
+		s.mu.Lock()
+		progress.Status = "running"
+		s.mu.Unlock()
+	}
+
+	// 任务拥有进度 goroutine 和 SSH 链：写入最终状态前先拆除，保证迟到的进度不会覆盖结果
+	task := lifecycle.New(ctx)
+	defer task.Close()
+
+	// 进度发布者：写任务记录跟不上时合并为最新一条，传输不会因此阻塞
+	progressPub := transfer.NewProgressPublisher()
+	task.OnClose(func() error {
+		progressPub.Close()
+		return nil
+	})
+
+	// 启动进度更新 goroutine
+	task.Go(func(context.Context) {
+		for p := range progressPub.Updates() {
+			s.mu.Lock()
+			if existing, ok := s.uploads[taskID]; ok {
+				existing.SentBytes = p.SentBytes
+				existing.Speed = p.Speed
+				existing.InstantSpeed = p.InstantSpeed
+				existing.AverageSpeed = p.AverageSpeed
+				existing.ETA = p.ETA
+				if p.Phase != "" {
+					existing.Phase = p.Phase
+				}
+				existing.MergeFiles(p.Files)
+				if p.Status != "" {
+					existing.Status = p.Status
+				}
+			}
+			s.mu.Unlock()
+		}
+	})
+
+	// 构建 SSH 链并连接
+	// relay 模式只连接第一跳，之后的各跳由跳板上的 ssh 逐跳转发；stage 模式连接到最后一个网关
+	relayed := mode != transfer.ModeTunnel
+	chainHops := hops
+	switch mode {
+	case transfer.ModeRelay:
+		chainHops = hops[:1]
+	case transfer.ModeStage:
+		chainHops = hops[:len(hops)-1]
+	}
+	logger.Printf("[UPLOAD] Connecting SSH chain...")
+	chain := ssh.NewChain(chainHops)
+	chain.SetLogger(logger)
+	if err := chain.ConnectContext(ctx); err != nil {
+		logger.Printf("[UPLOAD] ERROR: SSH connection failed: %v", err)
+		task.Close()
+		s.mu.Lock()
+		progress.Status = "failed"
+		progress.Error = fmt.Sprintf("SSH connection failed: %v", err)
+		progress.ErrorCode = errorCode(err, "ERR_CHAIN_CONNECT")
+		s.mu.Unlock()
+		s.auditUpload(progress, targetHost, targetPath)
+		s.staging.Remove(localPath)
+		return
+	}
+	logger.Printf("[UPLOAD] SSH chain connected successfully")
+	task.OnClose(chain.Disconnect)
+
+	// 创建 SCP 传输器；web 中没有终端，upload.sudo 的 password: prompt 不可用
+	targetHop := hops[len(hops)-1]
+	sudo := transfer.SudoFor(&s.config.Upload.Sudo, targetHop, nil)
+	transfer := transfer.NewSCPTransfer(chain)
+	transfer.SetLogger(logger)
+	transfer.SetSpeedWindow(s.config.Upload.SpeedWindow)
+	transfer.SetBackups(func(remoteFile string) int { return s.config.Upload.BackupKeep(targetHop, remoteFile) })
+	transfer.SetSudo(sudo)
+
+	// 执行上传；对象存储目标由最后一跳上的工具上传暂存的单个文件
+	var err error
+	if object, _ := objectTarget(targetPath, isDir); object != nil {
+		logger.Printf("[UPLOAD] Starting object storage upload: %s -> %s", localPath, object.Redacted())
+		var file string
+		if file, err = stagedFile(localPath); err == nil {
+			err = transfer.UploadObject(ctx, file, *object, progressPub.Chan())
+		}
+	} else if relayed {
+		var file string
+		if file, err = stagedFile(localPath); err == nil {
+			var modes []types.ModeThroughput
+			modes, err = s.relayUpload(ctx, logger, task, transfer, hops, file, targetPath, mode, progressPub.Chan())
+			s.mu.Lock()
+			progress.Modes = modes
+			s.mu.Unlock()
+		}
+	} else if adaptive && !isDir {
+		var file string
+		if file, err = stagedFile(localPath); err == nil {
+			remoteFile := filepath.Join(targetPath, filepath.Base(file))
+			var tuning *types.TransferTuning
+			if learned {
+				tuning = s.learnedTuning(targetHop)
+			}
+			logger.Printf("[UPLOAD] Starting adaptive transfer: %s -> %s (learned tuning: %v)", file, remoteFile, tuning != nil)
+			tuning, err = transfer.UploadAdaptive(ctx, file, remoteFile, tuning, progressPub.Chan())
+			if tuning != nil {
+				s.mu.Lock()
+				progress.Tuning = tuning
+				s.mu.Unlock()
+				if err == nil {
+					s.rememberTuning(targetHop, tuning)
+				}
+			}
+		}
+	} else {
+		logger.Printf("[UPLOAD] Starting file transfer: %s -> %s", localPath, targetPath)
+		err = transfer.UploadContext(ctx, localPath, targetPath, progressPub.Chan())
+	}
+	task.Close()
+	if err != nil {
+		logger.Printf("[UPLOAD] ERROR: Upload failed: %v", err)
+		s.mu.Lock()
+		progress.Status = "failed"
+		progress.Error = fmt.Sprintf("Upload failed: %v", err)
+		progress.ErrorCode = errorCode(err, "ERR_UPLOAD_FAILED")
+		s.mu.Unlock()
+		s.auditUpload(progress, targetHost, targetPath)
+		s.staging.Remove(localPath)
+		return
+	}
+
+	logger.Printf("[UPLOAD] Upload completed successfully: %s -> %s", localPath, targetPath)
+	
+	s.mu.Lock()
+	progress.SentBytes = progress.TotalBytes
+	progress.Status = "completed"
+	s.mu.Unlock()
+	s.auditUpload(progress, targetHost, targetPath)
+	s.recordUsage(hops, usage.Counters{Transfers: 1, Bytes: progress.TotalBytes})
+
+	// 清理暂存目录
+	s.staging.Remove(localPath)
+}
+
+// uploadHops 构建上传到 targetHost 的 hop 链：via 节点及其网关、目标服务器的网关链、目标本身。
+// 未配置的目标按 root@targetHost:22 处理；内网服务器未配置网关时返回 nil
+func (s *Server) uploadHops(logger *log.Logger, targetHost string, via []string) []*types.Hop {
 	// 查找目标服务器配置（优先通过 ID，然后是 name 或 host）
 	var targetHop *types.Hop
 	configuredHop := s.config.GetHopByID(targetHost)
@@ -656,11 +1424,11 @@ func (s *Server) executeUpload(taskID, localPath, targetHost, targetPath string,
 	}
 
 	if configuredHop != nil {
-		log.Printf("[UPLOAD] Using configured hop for target: %s (id: %s, host: %s, type: %v, gateway_id: %s)",
+		logger.Printf("[UPLOAD] Using configured hop for target: %s (id: %s, host: %s, type: %v, gateway_id: %s)",
 			configuredHop.Name, configuredHop.ID, configuredHop.Host, configuredHop.ServerType, configuredHop.GatewayID)
 		targetHop = configuredHop
 	} else {
-		log.Printf("[UPLOAD] Using default root@ target (no config found for %s)", targetHost)
+		logger.Printf("[UPLOAD] Using default root@ target (no config found for %s)", targetHost)
 		targetHop = &types.Hop{
 			Name:       targetHost,
 			Host:       targetHost,
@@ -681,13 +1449,7 @@ func (s *Server) executeUpload(taskID, localPath, targetHost, targetPath string,
 	// 如果目标是内网服务器，确保其网关链被添加（避免重复）
 	if targetHop.ServerType == types.ServerInternal {
 		if targetHop.GatewayID == "" {
-			log.Printf("[UPLOAD] ERROR: Internal server %s has no gateway configured", targetHost)
-			s.mu.Lock()
-			progress.Status = "failed"
-			progress.Error = fmt.Sprintf("内网服务器 %s 未配置网关", targetHost)
-			s.mu.Unlock()
-			os.RemoveAll(filepath.Dir(localPath))
-			return
+			return nil
 		}
 		// 展开目标服务器的网关链并添加（避免重复）
 		gatewayChain := s.buildHopChainWithGateways([]string{targetHop.GatewayID})
@@ -699,78 +1461,67 @@ func (s *Server) executeUpload(taskID, localPath, targetHost, targetPath string,
 			if !existingHops[h.ID] {
 				hops = append(hops, h)
 				existingHops[h.ID] = true
-				log.Printf("[UPLOAD] Adding target gateway hop: %s (id: %s)", h.Name, h.ID)
+				logger.Printf("[UPLOAD] Adding target gateway hop: %s (id: %s)", h.Name, h.ID)
 			}
 		}
 	}
 
 	// 添加目标主机
-	hops = append(hops, targetHop)
-
-	log.Printf("[UPLOAD] Total hops in chain: %d", len(hops))
-
-	// 创建进度通道
-	progressChan := make(chan *types.TransferProgress, 100)
-	
-	// 启动进度更新 goroutine
-	go func() {
-		for p := range progressChan {
-			s.mu.Lock()
-			if existing, ok := s.uploads[taskID]; ok {
-				existing.SentBytes = p.SentBytes
-				existing.Speed = p.Speed
-				existing.ETA = p.ETA
-				if p.Status != "" {
-					existing.Status = p.Status
-				}
-			}
-			s.mu.Unlock()
-		}
-	}()
+	return append(hops, targetHop)
+}
 
-	// 构建 SSH 链并连接
-	log.Printf("[UPLOAD] Connecting SSH chain...")
-	chain := ssh.NewChain(hops)
-	if err := chain.Connect(); err != nil {
-		log.Printf("[UPLOAD] ERROR: SSH connection failed: %v", err)
-		s.mu.Lock()
-		progress.Status = "failed"
-		progress.Error = fmt.Sprintf("SSH connection failed: %v", err)
-		s.mu.Unlock()
-		close(progressChan)
-		os.RemoveAll(filepath.Dir(localPath))
-		return
+// auditUpload 记录上传任务的最终结果，并发布 task.completed；detail 为 "文件名 -> 服务器:路径"，供 /api/search 查找
+func (s *Server) auditUpload(progress *types.TransferProgress, targetHost, targetPath string) {
+	server := targetHost
+	if hop := s.config.GetHopByID(targetHost); hop != nil {
+		server = hop.Name
 	}
-	log.Printf("[UPLOAD] SSH chain connected successfully")
-	defer chain.Disconnect()
-
-	// 创建 SCP 传输器
-	transfer := transfer.NewSCPTransfer(chain)
-	
-	// 执行上传
-	log.Printf("[UPLOAD] Starting file transfer: %s -> %s", localPath, targetPath)
-	if err := transfer.Upload(localPath, targetPath, progressChan); err != nil {
-		log.Printf("[UPLOAD] ERROR: Upload failed: %v", err)
-		s.mu.Lock()
-		progress.Status = "failed"
-		progress.Error = fmt.Sprintf("Upload failed: %v", err)
-		s.mu.Unlock()
-		close(progressChan)
-		os.RemoveAll(filepath.Dir(localPath))
-		return
+	s.mu.RLock()
+	event := audit.Event{
+		RequestID: progress.RequestID,
+		User:      s.owners.owner(ownerKindUpload, progress.TaskID),
+		Action:    "upload." + progress.Status,
+		Target:    progress.TaskID,
+		Error:     progress.Error,
+		Detail:    fmt.Sprintf("%s -> %s:%s", progress.FileName, server, transfer.ObjectTarget{URL: targetPath}.Redacted()),
 	}
+	completed := taskCompletedEvent("upload", progress)
+	s.mu.RUnlock()
+	s.recordAudit(event)
+	completed.User = event.User
+	s.events.Publish(completed)
+}
 
-	close(progressChan)
-
-	log.Printf("[UPLOAD] Upload completed successfully: %s -> %s", localPath, targetPath)
-	
-	s.mu.Lock()
-	progress.SentBytes = progress.TotalBytes
-	progress.Status = "completed"
-	s.mu.Unlock()
+// uploadEvent 上传任务的 task.created 事件，按 ID 指定的目标换成服务器名称
+func (s *Server) uploadEvent(taskID, targetHost, targetPath string, via []string) *events.Event {
+	server := targetHost
+	if hop := s.config.GetHopByID(targetHost); hop != nil {
+		server = hop.Name
+	}
+	return &events.Event{
+		Type:   events.TaskCreated,
+		Server: server,
+		Target: taskID,
+		Data: map[string]interface{}{
+			"kind": "upload",
+			"path": transfer.ObjectTarget{URL: targetPath}.Redacted(),
+			"via":  via,
+		},
+	}
+}
 
-	// 清理临时文件
-	os.RemoveAll(filepath.Dir(localPath))
+// taskCompletedEvent 任务结束时的 task.completed 事件，调用方持有 s.mu
+func taskCompletedEvent(kind string, progress *types.TransferProgress) *events.Event {
+	data := map[string]interface{}{
+		"kind":   kind,
+		"status": progress.Status,
+		"bytes":  progress.SentBytes,
+	}
+	if progress.Error != "" {
+		data["error"] = progress.Error
+		data["error_code"] = progress.ErrorCode
+	}
+	return &events.Event{Type: events.TaskCompleted, RequestID: progress.RequestID, Target: progress.TaskID, Data: data}
 }
 
 // CreateProxyRequest 创建代理请求
@@ -779,6 +1530,10 @@ type CreateProxyRequest struct {
 	RemoteHost string   `json:"remote_host"`
 	RemotePort int      `json:"remote_port"`
 	Via        []string `json:"via,omitempty"`
+	AllowLAN   bool     `json:"allow_lan,omitempty"` // 确认监听本机以外可访问的地址，还需配置 ports.allow_lan
+	Resolver   string   `json:"resolver,omitempty"`  // remote_host 的解析方式：remote（默认）、system 或 dns:<server>
+	// MaxDuration 限时转发（如 "1h"），到期后自动停止
+	MaxDuration string `json:"max_duration,omitempty"`
 }
 
 // ProxyInfo 代理信息响应
@@ -789,26 +1544,63 @@ type ProxyInfo struct {
 	RemotePort        int    `json:"remote_port"`
 	Active            bool   `json:"active"`
 	ConnectionCount   int    `json:"connection_count"`
+	ChainConnected    bool   `json:"chain_connected"`
+	ChainHealthy      bool   `json:"chain_healthy"`
+	ExpiresAt         time.Time `json:"expires_at,omitzero"`
 }
 
 // handleProxies 处理代理列表
 func (s *Server) handleProxies(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		proxies := s.proxies.List()
+		user := currentUser(r)
+		proxies := make([]*proxy.ForwarderInfo, 0)
+		for id, fwd := range s.proxies.List() {
+			if s.owners.canAccess(user, ownerKindProxy, id) {
+				info := fwd.GetInfo(id)
+				info.ExpiresAt = s.ticketExpiry(ownerKindProxy, id)
+				proxies = append(proxies, info)
+			}
+		}
+		sort.Slice(proxies, func(i, j int) bool { return proxies[i].ID < proxies[j].ID })
 		jsonResponse(w, http.StatusOK, proxies)
 	case http.MethodPost:
 		var req CreateProxyRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			errorResponse(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
 			return
 		}
 
-		if req.RemoteHost == "" || req.RemotePort == 0 {
-			errorResponse(w, http.StatusBadRequest, "remote_host and remote_port are required")
+		if proxy.CheckTarget(req.RemoteHost, req.RemotePort) != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_REMOTE_REQUIRED")
+			return
+		}
+		// unix socket 在链路末端的服务器上，不能把它当作一跳
+		unixTarget := proxy.IsUnixSocket(req.RemoteHost)
+		if unixTarget && len(req.Via) == 0 {
+			localizedError(w, r, http.StatusBadRequest, "ERR_NO_HOPS")
+			return
+		}
+		resolveMode, err := resolver.ParseMode(req.Resolver)
+		if err != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_RESOLVER", err)
+			return
+		}
+		maxDuration, err := parseMaxDuration(req.MaxDuration)
+		if err != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_MAX_DURATION", req.MaxDuration)
 			return
 		}
 
+		// 先校验或分配本地端口，避免连上链路后才发现冲突
+		id := fmt.Sprintf("proxy-%d", time.Now().UnixNano())
+		localAddr, release, err := s.claimLocalAddr(req.LocalAddr, req.AllowLAN, portKindProxy, id, "")
+		if err != nil {
+			portClaimFailure(w, r, err)
+			return
+		}
+		defer release()
+
 		// 构建 SSH 链（via 参数现在是 ID 列表）
 		var hops []*types.Hop
 		for _, hopID := range req.Via {
@@ -818,53 +1610,58 @@ func (s *Server) handleProxies(w http.ResponseWriter, r *http.Request) {
 				hop = s.config.GetHopByName(hopID)
 			}
 			if hop == nil {
-				errorResponse(w, http.StatusBadRequest, fmt.Sprintf("Unknown hop: %s", hopID))
+				localizedError(w, r, http.StatusBadRequest, "ERR_UNKNOWN_HOP", hopID)
 				return
 			}
 			hops = append(hops, hop)
 		}
 
 		// 添加目标主机
-		targetHop := &types.Hop{
-			Host: req.RemoteHost,
-			Port: req.RemotePort,
+		if !unixTarget {
+			targetHop := &types.Hop{
+				Host: req.RemoteHost,
+				Port: req.RemotePort,
+			}
+			hops = append(hops, targetHop)
 		}
-		hops = append(hops, targetHop)
 
 		chain := ssh.NewChain(hops)
 		if err := chain.Connect(); err != nil {
-			errorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to connect: %v", err))
+			failure(w, r, http.StatusBadGateway, "ERR_CHAIN_CONNECT", err)
 			return
 		}
+		// 中间某一跳断开时按退避策略重连，转发器保持监听
+		chain.Supervise(context.Background(), ssh.DefaultReconnectPolicy())
 
-		// 创建端口转发器
-		localAddr := req.LocalAddr
-		if localAddr == "" || localAddr == ":0" {
-			localAddr = ":0" // 自动分配端口
-		}
-
+		// 交给管理器启动；转发器和链路此后归管理器所有，删除代理时一并断开
 		forwarder := proxy.NewPortForwarder(chain, localAddr, req.RemoteHost, req.RemotePort)
-		if err := forwarder.Start(); err != nil {
-			chain.Disconnect()
-			errorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to start forwarder: %v", err))
-			return
-		}
-
-		// 生成唯一ID并添加到管理器
-		id := fmt.Sprintf("proxy-%d", time.Now().UnixNano())
+		forwarder.SetResolver(resolveMode, terminal.HopKey(hops))
 		if err := s.proxies.Add(id, forwarder); err != nil {
-			forwarder.Stop()
-			chain.Disconnect()
-			errorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add proxy: %v", err))
+			failure(w, r, http.StatusInternalServerError, "ERR_FORWARDER_START", err)
 			return
 		}
+		s.owners.set(ownerKindProxy, id, currentUser(r))
+		var expiresAt time.Time
+		if maxDuration > 0 {
+			expiresAt = s.startTicket(ownerKindProxy, id, maxDuration, nil, func() {
+				// 紧急停止等已移除的转发不再报错
+				if err := s.proxies.Remove(id); err != nil && !errors.Is(err, proxy.ErrNotFound) {
+					log.Printf("[Ticket] Error stopping proxy %s: %v", id, err)
+				}
+				s.owners.remove(ownerKindProxy, id)
+			})
+		}
 
+		fwdInfo := forwarder.GetInfo(id)
 		info := ProxyInfo{
-			ID:         id,
-			LocalAddr:  forwarder.GetLocalAddr(),
-			RemoteHost: req.RemoteHost,
-			RemotePort: req.RemotePort,
-			Active:     true,
+			ID:             id,
+			LocalAddr:      fwdInfo.LocalAddr,
+			RemoteHost:     req.RemoteHost,
+			RemotePort:     req.RemotePort,
+			Active:         fwdInfo.Active,
+			ChainConnected: fwdInfo.ChainConnected,
+			ChainHealthy:   fwdInfo.ChainHealthy,
+			ExpiresAt:      expiresAt,
 		}
 
 		jsonResponse(w, http.StatusCreated, info)
@@ -877,19 +1674,29 @@ func (s *Server) handleProxies(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleProxyDetail(w http.ResponseWriter, r *http.Request) {
 	id := r.URL.Path[len("/api/proxy/"):]
 
+	// 其他用户的转发视为不存在
+	if !s.owners.canAccess(currentUser(r), ownerKindProxy, id) {
+		localizedError(w, r, http.StatusNotFound, "ERR_PROXY_NOT_FOUND")
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		fwd := s.proxies.Get(id)
 		if fwd == nil {
-			errorResponse(w, http.StatusNotFound, "Proxy not found")
+			localizedError(w, r, http.StatusNotFound, "ERR_PROXY_NOT_FOUND")
 			return
 		}
-		jsonResponse(w, http.StatusOK, fwd.GetInfo(id))
+		info := fwd.GetInfo(id)
+		info.ExpiresAt = s.ticketExpiry(ownerKindProxy, id)
+		jsonResponse(w, http.StatusOK, info)
 	case http.MethodDelete:
+		s.stopTicket(ownerKindProxy, id)
 		if err := s.proxies.Remove(id); err != nil {
-			errorResponse(w, http.StatusInternalServerError, err.Error())
+			failure(w, r, http.StatusInternalServerError, "ERR_PROXY_STOP", err)
 			return
 		}
+		s.owners.remove(ownerKindProxy, id)
 		jsonResponse(w, http.StatusNoContent, nil)
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -900,8 +1707,19 @@ func (s *Server) handleProxyDetail(w http.ResponseWriter, r *http.Request) {
 type LatencyProbeRequest struct {
 	Target string   `json:"target"`
 	Via    []string `json:"via,omitempty"`
+	// Candidates 要对比的多条跳板链（服务器 ID 列表），非空时同时探测直连和每条链，返回排序后的对比结果
+	Candidates [][]string `json:"candidates,omitempty"`
+	Count      int        `json:"count,omitempty"` // 对比时每条路径的探测次数
+}
+
+// LatencyCompareResponse 多路径对比结果，按延迟排序，第一项为推荐路径
+type LatencyCompareResponse struct {
+	Candidates []*profiler.CandidateResult `json:"candidates"`
 }
 
+// latencyCompareTimeout 多路径对比的总超时
+const latencyCompareTimeout = 60 * time.Second
+
 // handleLatencyProbe 处理延迟探测
 func (s *Server) handleLatencyProbe(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -911,51 +1729,26 @@ func (s *Server) handleLatencyProbe(w http.ResponseWriter, r *http.Request) {
 
 	var req LatencyProbeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		errorResponse(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
 		return
 	}
 
 	if req.Target == "" {
-		errorResponse(w, http.StatusBadRequest, "target is required")
+		localizedError(w, r, http.StatusBadRequest, "ERR_TARGET_REQUIRED")
 		return
 	}
+	targetHop := s.probeTarget(req.Target)
 
-	// 构建 hop 链（via 参数现在是 ID 列表）
-	var hops []*types.Hop
-	for _, hopID := range req.Via {
-		hop := s.config.GetHopByID(hopID)
-		if hop == nil {
-			// 兼容：尝试通过 name 查找
-			hop = s.config.GetHopByName(hopID)
-		}
-		if hop == nil {
-			errorResponse(w, http.StatusBadRequest, fmt.Sprintf("Unknown hop: %s", hopID))
-			return
-		}
-		hops = append(hops, hop)
+	if len(req.Candidates) > 0 {
+		s.compareLatency(w, r, targetHop, req.Candidates, req.Count)
+		return
 	}
 
-	// 添加目标主机（优先通过 ID 查找，然后是 name 或 host）
-	targetHop := s.config.GetHopByID(req.Target)
-	if targetHop == nil {
-		targetHop = s.config.GetHopByName(req.Target)
-	}
-	if targetHop == nil {
-		// 尝试通过主机地址匹配
-		for _, h := range s.config.Hops {
-			if h.Host == req.Target {
-				targetHop = h
-				break
-			}
-		}
-	}
-	if targetHop == nil {
-		// 目标不在配置中，创建一个临时 hop
-		targetHop = &types.Hop{
-			Name: req.Target,
-			Host: req.Target,
-			Port: 22,
-		}
+	// 构建 hop 链（via 参数现在是 ID 列表）
+	hops, unknown := s.probeVia(req.Via)
+	if unknown != "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_UNKNOWN_HOP", unknown)
+		return
 	}
 	hops = append(hops, targetHop)
 
@@ -963,23 +1756,113 @@ func (s *Server) handleLatencyProbe(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
+	var result map[string]interface{}
 	report, err := s.profiler.Probe(ctx, hops)
 	if err != nil {
-		jsonResponse(w, http.StatusOK, map[string]interface{}{
+		result = map[string]interface{}{
 			"latency_ms": 0,
 			"success":    false,
 			"error":      err.Error(),
 			"path":       buildPath(hops),
+		}
+	} else {
+		result = map[string]interface{}{
+			"latency_ms": report.Latency.Milliseconds(),
+			"success":    report.Success,
+			"error":      report.Error,
+			"path":       buildPath(hops),
+		}
+	}
+	s.events.Publish(&events.Event{
+		Type:      events.ProbeResult,
+		RequestID: requestID(r),
+		User:      currentUser(r).Name,
+		Server:    targetHop.Name,
+		Data:      result,
+	})
+
+	jsonResponse(w, http.StatusOK, result)
+}
+
+// compareLatency 并发探测直连和每条候选跳板链，与 gmssh probe 的多个 --via 相同；
+// 最快的可达路径记入目标的 playbook
+func (s *Server) compareLatency(w http.ResponseWriter, r *http.Request, targetHop *types.Hop, chains [][]string, count int) {
+	candidates := []profiler.Candidate{{Label: "direct", Hops: []*types.Hop{targetHop}}}
+	vias := map[string][]string{"direct": nil}
+	for _, via := range chains {
+		if len(via) == 0 {
+			continue
+		}
+		hops, unknown := s.probeVia(via)
+		if unknown != "" {
+			localizedError(w, r, http.StatusBadRequest, "ERR_UNKNOWN_HOP", unknown)
+			return
+		}
+		names := make([]string, len(hops))
+		ids := make([]string, len(hops))
+		for i, hop := range hops {
+			names[i] = hop.Name
+			ids[i] = hop.ID
+		}
+		label := "via " + strings.Join(names, " -> ")
+		candidates = append(candidates, profiler.Candidate{
+			Label: label,
+			Hops:  append(hops, targetHop),
 		})
-		return
+		vias[label] = ids
 	}
 
-	jsonResponse(w, http.StatusOK, map[string]interface{}{
-		"latency_ms": report.Latency.Milliseconds(),
-		"success":    report.Success,
-		"error":      report.Error,
-		"path":       buildPath(hops),
+	ctx, cancel := context.WithTimeout(r.Context(), latencyCompareTimeout)
+	defer cancel()
+
+	results := s.profiler.ProbeCandidates(ctx, candidates, count)
+	s.learnRoute(targetHop, results, vias)
+	s.events.Publish(&events.Event{
+		Type:      events.ProbeResult,
+		RequestID: requestID(r),
+		User:      currentUser(r).Name,
+		Server:    targetHop.Name,
+		Data:      map[string]interface{}{"candidates": results},
 	})
+	jsonResponse(w, http.StatusOK, LatencyCompareResponse{Candidates: results})
+}
+
+// probeVia 按 ID（兼容名称）解析跳板列表，返回无法识别的项
+func (s *Server) probeVia(via []string) ([]*types.Hop, string) {
+	var hops []*types.Hop
+	for _, hopID := range via {
+		hop := s.config.GetHopByID(hopID)
+		if hop == nil {
+			// 兼容：尝试通过 name 查找
+			hop = s.config.GetHopByName(hopID)
+		}
+		if hop == nil {
+			return nil, hopID
+		}
+		hops = append(hops, hop)
+	}
+	return hops, ""
+}
+
+// probeTarget 解析探测目标：优先通过 ID 查找，然后是 name 或 host，都不匹配时视为临时主机
+func (s *Server) probeTarget(target string) *types.Hop {
+	if hop := s.config.GetHopByID(target); hop != nil {
+		return hop
+	}
+	if hop := s.config.GetHopByName(target); hop != nil {
+		return hop
+	}
+	for _, h := range s.config.Hops {
+		if h.Host == target {
+			return h
+		}
+	}
+	// 目标不在配置中，创建一个临时 hop
+	return &types.Hop{
+		Name: target,
+		Host: target,
+		Port: 22,
+	}
 }
 
 // buildPath 构建路径信息（返回 ID 列表，前端通过 ID 查找名称）
@@ -1029,21 +1912,47 @@ func (s *Server) handleProgressWebSocket(w http.ResponseWriter, r *http.Request)
 	// 提取 task ID
 	path := r.URL.Path[len("/api/ws/progress/"):]
 	taskID := strings.TrimSpace(path)
+	if !s.originAllowed(r) {
+		localizedError(w, r, http.StatusForbidden, "ERR_ORIGIN_NOT_ALLOWED")
+		return
+	}
 	if taskID == "" {
-		errorResponse(w, http.StatusBadRequest, "task_id is required")
+		localizedError(w, r, http.StatusBadRequest, "ERR_TASK_ID_REQUIRED")
+		return
+	}
+
+	s.writeUploadProgress(w, r, taskID)
+}
+
+// handleUploadDetail 查询上传任务，目录上传包含逐文件进度（files）
+func (s *Server) handleUploadDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
+	taskID := strings.TrimPrefix(r.URL.Path, "/api/uploads/")
+	if taskID == "" || strings.Contains(taskID, "/") {
+		localizedError(w, r, http.StatusNotFound, "ERR_TASK_NOT_FOUND")
+		return
+	}
+	s.writeUploadProgress(w, r, taskID)
+}
 
+// writeUploadProgress 返回任务进度的快照（其他用户的任务视为不存在）
+func (s *Server) writeUploadProgress(w http.ResponseWriter, r *http.Request, taskID string) {
 	s.mu.RLock()
-	progress, exists := s.uploads[taskID]
+	var snapshot *types.TransferProgress
+	if progress, exists := s.uploads[taskID]; exists {
+		snapshot = progress.Clone()
+	}
 	s.mu.RUnlock()
 
-	if !exists {
-		errorResponse(w, http.StatusNotFound, "Task not found")
+	if snapshot == nil || !s.owners.canAccess(currentUser(r), ownerKindUpload, taskID) {
+		localizedError(w, r, http.StatusNotFound, "ERR_TASK_NOT_FOUND")
 		return
 	}
 
-	jsonResponse(w, http.StatusOK, progress)
+	jsonResponse(w, http.StatusOK, snapshot)
 }
 
 // BrowseResponse 目录浏览响应
@@ -1078,7 +1987,7 @@ func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path[len("/api/browse/"):]
 	parts := strings.SplitN(path, "/", 2)
 	if len(parts) == 0 || parts[0] == "" {
-		errorResponse(w, http.StatusBadRequest, "server id is required")
+		localizedError(w, r, http.StatusBadRequest, "ERR_HOP_ID_REQUIRED")
 		return
 	}
 
@@ -1110,7 +2019,7 @@ func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if server == nil {
-		errorResponse(w, http.StatusNotFound, "Server not found")
+		localizedError(w, r, http.StatusNotFound, "ERR_HOP_NOT_FOUND")
 		return
 	}
 
@@ -1120,12 +2029,12 @@ func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
 	// 如果目标是内网服务器，添加网关
 	if server.ServerType == types.ServerInternal {
 		if server.GatewayID == "" {
-			errorResponse(w, http.StatusBadRequest, "Internal server has no gateway configured")
+			localizedError(w, r, http.StatusBadRequest, "ERR_GATEWAY_REQUIRED")
 			return
 		}
 		gatewayHop := s.config.GetHopByID(server.GatewayID)
 		if gatewayHop == nil {
-			errorResponse(w, http.StatusBadRequest, "Gateway not found")
+			localizedError(w, r, http.StatusBadRequest, "ERR_GATEWAY_NOT_FOUND")
 			return
 		}
 		hops = append(hops, gatewayHop)
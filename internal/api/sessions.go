@@ -0,0 +1,311 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// TerminalSessionInfo Web 终端会话信息
+type TerminalSessionInfo struct {
+	ID         string    `json:"id"`
+	Server     string    `json:"server"`
+	Owner      string    `json:"owner"`
+	StartedAt  time.Time `json:"started_at"`
+	Connection uint64    `json:"connection,omitempty"` // 所在的池化连接编号，编号相同的会话共用一条链
+	Chain      []string  `json:"chain,omitempty"`      // 连接经过的服务器名称，最后一个为目标
+	ExpiresAt  time.Time `json:"expires_at,omitzero"`  // 限时会话的到期时间
+	// LastInputAt 最后一次键盘输入的时间，LastOutputAt 最后一次终端输出的时间，都没有时为开始时间
+	LastInputAt  time.Time `json:"last_input_at"`
+	LastOutputAt time.Time `json:"last_output_at"`
+	IdleSeconds  int64     `json:"idle_seconds"` // 距最后一次键盘输入的秒数，运行中的命令有输出不算活动
+}
+
+// SessionGroup 共用一条链的终端会话
+type SessionGroup struct {
+	Connection uint64                `json:"connection"`
+	Chain      []string              `json:"chain"`
+	Sessions   []TerminalSessionInfo `json:"sessions"`
+}
+
+// terminalEntry 已登记的终端会话
+type terminalEntry struct {
+	info     TerminalSessionInfo
+	close    func()
+	source   string       // 浏览器地址
+	bytesIn  atomic.Int64 // 键盘输入字节数
+	bytesOut atomic.Int64 // 终端输出字节数
+	// lastInput、lastOutput 最后一次输入和输出的时间（UnixNano）
+	lastInput  atomic.Int64
+	lastOutput atomic.Int64
+	notify     func(message string) // 在终端中显示一条提示，会话开始转发前为 nil
+}
+
+// recordInput 记录 n 字节键盘输入
+func (e *terminalEntry) recordInput(n int) {
+	e.bytesIn.Add(int64(n))
+	e.lastInput.Store(time.Now().UnixNano())
+}
+
+// recordOutput 记录 n 字节终端输出
+func (e *terminalEntry) recordOutput(n int) {
+	e.bytesOut.Add(int64(n))
+	e.lastOutput.Store(time.Now().UnixNano())
+}
+
+// snapshot 返回 now 时的会话信息，包括最后输入、输出时间和空闲时长
+func (e *terminalEntry) snapshot(now time.Time) TerminalSessionInfo {
+	info := e.info
+	info.LastInputAt = time.Unix(0, e.lastInput.Load())
+	info.LastOutputAt = time.Unix(0, e.lastOutput.Load())
+	info.IdleSeconds = int64(now.Sub(info.LastInputAt).Seconds())
+	return info
+}
+
+// registerTerminal 登记终端会话并记录归属，返回会话 ID
+// conn 为会话所在的池化连接，可以为 nil
+func (s *Server) registerTerminal(user *types.WebUser, serverName string, conn *terminal.PooledClient, closeFn func()) string {
+	id := uuid.New().String()
+
+	var connID uint64
+	var chain []string
+	if conn != nil {
+		connID = conn.ID()
+		for _, hop := range conn.Hops() {
+			chain = append(chain, hop.Name)
+		}
+	}
+
+	entry := &terminalEntry{
+		info: TerminalSessionInfo{
+			ID:         id,
+			Server:     serverName,
+			Owner:      user.Name,
+			StartedAt:  time.Now(),
+			Connection: connID,
+			Chain:      chain,
+		},
+		close: closeFn,
+	}
+	entry.lastInput.Store(entry.info.StartedAt.UnixNano())
+	entry.lastOutput.Store(entry.info.StartedAt.UnixNano())
+
+	s.terminalsMu.Lock()
+	s.terminals[id] = entry
+	s.terminalsMu.Unlock()
+
+	s.owners.set(ownerKindSession, id, user)
+	return id
+}
+
+// trackTerminal 记录会话的来源地址和在终端中显示提示的方式，返回用于统计流量和活动的登记项，会话不存在时返回 nil
+func (s *Server) trackTerminal(id, source string, notify func(message string)) *terminalEntry {
+	s.terminalsMu.Lock()
+	defer s.terminalsMu.Unlock()
+	entry := s.terminals[id]
+	if entry != nil {
+		entry.source = source
+		entry.notify = notify
+	}
+	return entry
+}
+
+// unregisterTerminal 移除终端会话登记
+func (s *Server) unregisterTerminal(id string) {
+	s.terminalsMu.Lock()
+	delete(s.terminals, id)
+	s.terminalsMu.Unlock()
+
+	s.owners.remove(ownerKindSession, id)
+}
+
+// handleSessions 列出当前用户的终端会话（管理员可见全部）
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.visibleSessions(currentUser(r)))
+}
+
+// handleSessionChains 按所在的链分组列出当前用户的终端会话，
+// 用于显示“gateway→db1 上 3 个标签（1 条连接）”
+func (s *Server) handleSessionChains(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	groups := make([]*SessionGroup, 0)
+	byConn := make(map[uint64]*SessionGroup)
+	for _, info := range s.visibleSessions(currentUser(r)) {
+		group, ok := byConn[info.Connection]
+		// 没有连接编号的会话各自成组
+		if !ok || info.Connection == 0 {
+			group = &SessionGroup{Connection: info.Connection, Chain: info.Chain}
+			byConn[info.Connection] = group
+			groups = append(groups, group)
+		}
+		group.Sessions = append(group.Sessions, info)
+	}
+	jsonResponse(w, http.StatusOK, groups)
+}
+
+// visibleSessions 返回 user 可见的终端会话，按开始时间排序
+func (s *Server) visibleSessions(user *types.WebUser) []TerminalSessionInfo {
+	sessions := make([]TerminalSessionInfo, 0)
+
+	now := time.Now()
+	s.terminalsMu.RLock()
+	for id, entry := range s.terminals {
+		if s.owners.canAccess(user, ownerKindSession, id) {
+			sessions = append(sessions, entry.snapshot(now))
+		}
+	}
+	s.terminalsMu.RUnlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt.Before(sessions[j].StartedAt)
+	})
+	return sessions
+}
+
+// handleSessionDetail 关闭指定终端会话 (DELETE /api/sessions/{id})
+func (s *Server) handleSessionDetail(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
+	if id == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_SESSION_ID_REQUIRED")
+		return
+	}
+
+	s.terminalsMu.RLock()
+	entry, exists := s.terminals[id]
+	s.terminalsMu.RUnlock()
+
+	// 其他用户的会话视为不存在
+	if !exists || !s.owners.canAccess(currentUser(r), ownerKindSession, id) {
+		localizedError(w, r, http.StatusNotFound, "ERR_SESSION_NOT_FOUND")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.terminalsMu.RLock()
+		info := entry.snapshot(time.Now())
+		s.terminalsMu.RUnlock()
+		jsonResponse(w, http.StatusOK, info)
+	case http.MethodDelete:
+		entry.close()
+		jsonResponse(w, http.StatusOK, map[string]string{"status": "closed"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// defaultIdleThreshold 未指定 threshold 时视为空闲的时长
+const defaultIdleThreshold = 30 * time.Minute
+
+// IdleWarnRequest 提醒空闲会话的请求
+type IdleWarnRequest struct {
+	Threshold string `json:"threshold,omitempty"` // 如 "30m"，默认 defaultIdleThreshold
+	Message   string `json:"message,omitempty"`   // 显示在终端中的提示，默认说明已空闲多久
+}
+
+// IdleSessions 空闲超过 Threshold 的终端会话
+type IdleSessions struct {
+	Threshold int64                 `json:"threshold_seconds"`
+	Sessions  []TerminalSessionInfo `json:"sessions"`
+	Warned    int                   `json:"warned,omitempty"` // POST 时已在终端中提示的会话数
+}
+
+// parseIdleThreshold 解析 threshold，为空时返回 defaultIdleThreshold
+func parseIdleThreshold(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultIdleThreshold, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid threshold %q", value)
+	}
+	return d, nil
+}
+
+// idleSessions 返回 user 可见、超过 threshold 没有键盘输入的会话，空闲最久的在前
+func (s *Server) idleSessions(user *types.WebUser, threshold time.Duration) []TerminalSessionInfo {
+	idle := make([]TerminalSessionInfo, 0)
+	for _, info := range s.visibleSessions(user) {
+		if time.Duration(info.IdleSeconds)*time.Second >= threshold {
+			idle = append(idle, info)
+		}
+	}
+	sort.SliceStable(idle, func(i, j int) bool {
+		return idle[i].IdleSeconds > idle[j].IdleSeconds
+	})
+	return idle
+}
+
+// handleIdleSessions 列出空闲的终端会话 (GET /api/sessions/idle?threshold=30m)，
+// POST 时还在这些会话的终端中显示提示，提醒用户退出（管理员随后可用 DELETE /api/sessions/{id} 关闭）
+func (s *Server) handleIdleSessions(w http.ResponseWriter, r *http.Request) {
+	threshold := r.URL.Query().Get("threshold")
+	var req IdleWarnRequest
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+			return
+		}
+		if req.Threshold != "" {
+			threshold = req.Threshold
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	d, err := parseIdleThreshold(threshold)
+	if err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_IDLE_THRESHOLD", threshold)
+		return
+	}
+
+	result := IdleSessions{Threshold: int64(d.Seconds()), Sessions: s.idleSessions(currentUser(r), d)}
+	if r.Method == http.MethodPost {
+		for _, info := range result.Sessions {
+			if s.warnIdleSession(info, req.Message) {
+				result.Warned++
+			}
+		}
+	}
+	jsonResponse(w, http.StatusOK, result)
+}
+
+// warnIdleSession 在会话的终端中显示空闲提示，会话已结束或尚未开始转发时返回 false
+func (s *Server) warnIdleSession(info TerminalSessionInfo, message string) bool {
+	s.terminalsMu.RLock()
+	entry := s.terminals[info.ID]
+	var notify func(string)
+	if entry != nil {
+		notify = entry.notify
+	}
+	s.terminalsMu.RUnlock()
+	if notify == nil {
+		return false
+	}
+	if message == "" {
+		idle := (time.Duration(info.IdleSeconds) * time.Second).Round(time.Minute)
+		message = fmt.Sprintf("This session has been idle for %v and may be closed by an administrator.", idle)
+	}
+	notify(fmt.Sprintf("\r\n\x1b[33m[gmssh] %s\x1b[0m\r\n", message))
+	return true
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// SetupStatus 首次配置状态，界面在 needed 为 true 时显示配置向导
+type SetupStatus struct {
+	Needed      bool   `json:"needed"` // 还没有服务器和 Web 用户
+	AuthEnabled bool   `json:"auth_enabled"`
+	SSHConfig   string `json:"ssh_config,omitempty"` // 可导入的 OpenSSH 配置路径，不存在时为空
+	// SSHHosts OpenSSH 配置中可导入的主机，网关以名称给出（gateway）
+	SSHHosts []*types.Hop `json:"ssh_hosts,omitempty"`
+}
+
+// SetupServer 向导中添加的一个服务器，gateway 为同一请求中排在前面的服务器或已有服务器的名称
+type SetupServer struct {
+	CreateServerRequest
+	Gateway string `json:"gateway,omitempty"`
+}
+
+// SetupRequest 向导提交的首次配置；/api/setup/check 使用同样的请求只测试不保存
+type SetupRequest struct {
+	ImportSSHConfig bool          `json:"import_ssh_config,omitempty"`
+	Servers         []SetupServer `json:"servers,omitempty"`
+	// Admin 管理员名称，非空时生成管理员令牌并启用认证
+	Admin string `json:"admin,omitempty"`
+}
+
+// SetupResult 首次配置的结果，token 只在这一次返回
+type SetupResult struct {
+	Servers  []*types.Hop `json:"servers"`
+	Imported int          `json:"imported"` // 从 OpenSSH 配置导入的服务器数
+	Admin    string       `json:"admin,omitempty"`
+	Token    string       `json:"token,omitempty"`
+}
+
+// handleSetup GET 返回首次配置状态和可导入的主机，POST 保存向导的结果（仅在尚未配置时允许）
+func (s *Server) handleSetup(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		status := SetupStatus{Needed: config.NeedsSetup(s.config), AuthEnabled: s.authEnabled()}
+		if hosts, path, err := readSSHConfig(); err == nil && path != "" {
+			status.SSHConfig = path
+			status.SSHHosts = hosts
+		} else if err != nil {
+			log.Printf("[Setup] Error reading %s: %v", path, err)
+		}
+		jsonResponse(w, http.StatusOK, status)
+
+	case http.MethodPost:
+		if !config.NeedsSetup(s.config) {
+			localizedError(w, r, http.StatusConflict, "ERR_SETUP_DONE")
+			return
+		}
+		var req SetupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+			return
+		}
+		hops, err := s.setupHops(req.Servers)
+		if err != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_SETUP", err)
+			return
+		}
+
+		// 向导中填写的服务器均已校验为新名称，总会加入；同名的导入主机跳过
+		wizard := len(hops)
+		if req.ImportSSHConfig {
+			imported, _, err := readSSHConfig()
+			if err != nil {
+				localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_SETUP", err)
+				return
+			}
+			hops = append(hops, imported...)
+		}
+		added, err := s.manager.ImportHops(hops)
+		if err != nil {
+			failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
+			return
+		}
+		result := SetupResult{Servers: added, Imported: len(added) - wizard}
+		if result.Servers == nil {
+			result.Servers = []*types.Hop{}
+		}
+
+		if req.Admin != "" {
+			user, err := config.NewAdminUser(req.Admin)
+			if err != nil {
+				failure(w, r, http.StatusInternalServerError, ErrInternal, err)
+				return
+			}
+			s.config.Web.Users = append(s.config.Web.Users, user)
+			if err := s.manager.Save(); err != nil {
+				failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
+				return
+			}
+			result.Admin, result.Token = user.Name, user.Token
+		}
+
+		log.Printf("[Setup] Initial setup: %d servers (%d imported), admin=%q", len(result.Servers), result.Imported, result.Admin)
+		s.recordAudit(audit.Event{
+			RequestID: requestID(r),
+			User:      currentUser(r).Name,
+			Action:    "setup",
+			Target:    fmt.Sprintf("servers=%d imported=%d admin=%s", len(result.Servers), result.Imported, result.Admin),
+		})
+		jsonResponse(w, http.StatusCreated, result)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSetupCheck 测试向导中填写的服务器能否经各自的网关连接并通过认证，不保存 (POST /api/setup/check)
+func (s *Server) handleSetupCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	var req SetupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	hops, err := s.setupHops(req.Servers)
+	if err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_SETUP", err)
+		return
+	}
+
+	// 网关可能也是尚未保存的服务器，按包含它们的临时配置解析链
+	draft := &types.Config{Hops: append(append([]*types.Hop{}, s.config.Hops...), hops...)}
+	results := s.profiler.CheckHops(r.Context(), hops, draft.GatewayChain, 0, 0)
+	jsonResponse(w, http.StatusOK, results)
+}
+
+// setupHops 校验向导中的服务器并分配 ID，网关名称解析为同一请求中排在前面的服务器或已有服务器
+func (s *Server) setupHops(servers []SetupServer) ([]*types.Hop, error) {
+	hops := make([]*types.Hop, 0, len(servers))
+	byName := make(map[string]*types.Hop, len(servers))
+	for i, server := range servers {
+		if server.Name == "" || server.Host == "" || server.User == "" {
+			return nil, fmt.Errorf("server %d: name, host and user are required", i+1)
+		}
+		if byName[server.Name] != nil || s.config.GetHopByName(server.Name) != nil {
+			return nil, fmt.Errorf("server %q is listed twice or already exists", server.Name)
+		}
+
+		hop := &types.Hop{
+			ID:             uuid.New().String(),
+			Name:           server.Name,
+			Host:           server.Host,
+			Port:           server.Port,
+			User:           server.User,
+			KeyPath:        server.KeyPath,
+			Password:       server.Password,
+			ServerType:     types.ServerExternal,
+			GatewayID:      server.GatewayID,
+			TerminalPreset: server.TerminalPreset,
+			Terminal:       server.Terminal,
+			Tags:           server.Tags,
+		}
+		switch server.AuthType {
+		case "key", "":
+			hop.AuthType = types.AuthKey
+			if hop.KeyPath == "" {
+				hop.KeyPath = "~/.ssh/id_rsa"
+			}
+		case "password":
+			hop.AuthType = types.AuthPassword
+		case "agent":
+			hop.AuthType = types.AuthAgent
+		default:
+			return nil, fmt.Errorf("server %q: invalid auth type %q", server.Name, server.AuthType)
+		}
+		if hop.Port == 0 {
+			hop.Port = 22
+		}
+
+		if server.Gateway != "" {
+			if gateway := byName[server.Gateway]; gateway != nil {
+				hop.GatewayID = gateway.ID
+			} else if gateway := s.config.GetHopByName(server.Gateway); gateway != nil {
+				hop.GatewayID = gateway.ID
+			} else {
+				return nil, fmt.Errorf("server %q: gateway %q must be listed before it or already exist", server.Name, server.Gateway)
+			}
+		} else if hop.GatewayID != "" && s.config.GetHopByID(hop.GatewayID) == nil {
+			return nil, fmt.Errorf("server %q: gateway %s not found", server.Name, hop.GatewayID)
+		}
+		if hop.GatewayID != "" {
+			hop.ServerType = types.ServerInternal
+		}
+
+		hops = append(hops, hop)
+		byName[hop.Name] = hop
+	}
+	return hops, nil
+}
+
+// readSSHConfig 读取当前用户的 OpenSSH 配置，文件不存在时返回空路径
+func readSSHConfig() ([]*types.Hop, string, error) {
+	path := config.DefaultSSHConfigPath()
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, path, err
+	}
+	defer f.Close()
+	hops, err := config.ParseSSHConfig(f)
+	return hops, path, err
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestSetup(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.MkdirAll(filepath.Join(home, ".ssh"), 0700)
+	os.WriteFile(filepath.Join(home, ".ssh", "config"), []byte("Host jump\n  HostName 203.0.113.9\n  User ops\nHost gw\n  User dup\n"), 0600)
+
+	server, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	handler := server.authMiddleware(mux)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var status SetupStatus
+	json.Unmarshal(do(http.MethodGet, "/api/setup", "").Body.Bytes(), &status)
+	if !status.Needed || status.AuthEnabled || len(status.SSHHosts) != 2 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	for _, body := range []string{
+		`{"servers": [{"name": "gw", "host": "1.2.3.4"}]}`,
+		`{"servers": [{"name": "db", "host": "10.0.0.2", "user": "root", "gateway": "gw"}, {"name": "gw", "host": "1.2.3.4", "user": "root"}]}`,
+		`{"servers": [{"name": "gw", "host": "1.2.3.4", "user": "root", "auth_type": "token"}]}`,
+	} {
+		if rec := do(http.MethodPost, "/api/setup/check", body); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "ERR_INVALID_SETUP") {
+			t.Errorf("check %s: expected 400 ERR_INVALID_SETUP, got %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+
+	body := `{"import_ssh_config": true, "admin": "ops", "servers": [
+		{"name": "gw", "host": "1.2.3.4", "user": "root"},
+		{"name": "db", "host": "10.0.0.2", "user": "root", "auth_type": "password", "password": "pw", "gateway": "gw"}]}`
+	rec := do(http.MethodPost, "/api/setup", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("setup: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result SetupResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	// ssh 配置中的 gw 与向导中的同名，跳过
+	if len(result.Servers) != 3 || result.Imported != 1 || result.Admin != "ops" || result.Token == "" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	gw, db := server.config.GetHopByName("gw"), server.config.GetHopByName("db")
+	if gw.User != "root" || db.GatewayID != gw.ID || db.ServerType != types.ServerInternal || db.KeyPath != "" {
+		t.Errorf("unexpected servers: gw=%+v db=%+v", gw, db)
+	}
+	if server.lookupUser(result.Token) == nil || !server.authEnabled() {
+		t.Error("generated token does not authenticate")
+	}
+
+	// 完成后认证生效，且不能再次提交
+	if rec := do(http.MethodGet, "/api/setup", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status without token: expected 401, got %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/setup", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer "+result.Token)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "ERR_SETUP_DONE") {
+		t.Errorf("second setup: expected 409 ERR_SETUP_DONE, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
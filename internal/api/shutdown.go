@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/ssh"
+)
+
+// shutdownTimeout 收到退出信号后等待进行中的请求完成的最长时间，
+// 应小于 Kubernetes 的 terminationGracePeriodSeconds（默认 30 秒）
+const shutdownTimeout = 15 * time.Second
+
+// serve 监听并提供 srv，监听成功后 /readyz 变为就绪。
+// ctx 取消时先让 /readyz 返回 503，再停止接受新连接、等待进行中的请求，最后释放会话和连接
+func (s *Server) serve(ctx context.Context, srv *http.Server) error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	s.probes.SetReady()
+	if s.onReady != nil {
+		go s.onReady()
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Serve(ln) }()
+
+	select {
+	case err := <-errCh:
+		s.Close()
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting up to %s for active requests", shutdownTimeout)
+	s.probes.SetDraining()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = srv.Shutdown(shutdownCtx)
+	s.Close()
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("Shutdown timed out, closing remaining connections")
+		return srv.Close()
+	}
+	return err
+}
+
+// OnReady 设置开始监听后调用的函数，如本地模式下打开浏览器，须在 Start 前调用
+func (s *Server) OnReady(fn func()) {
+	s.onReady = fn
+}
+
+// Close 关闭终端会话、端口转发、Agent 连接和 SSH 连接池，保存使用量并刷新审计日志
+func (s *Server) Close() {
+	// 停止转发器前最后统计一次隧道
+	s.sampleTunnels(time.Now())
+
+	s.terminalsMu.RLock()
+	closers := make([]func(), 0, len(s.terminals))
+	for _, entry := range s.terminals {
+		if entry.close != nil {
+			closers = append(closers, entry.close)
+		}
+	}
+	s.terminalsMu.RUnlock()
+	for _, close := range closers {
+		close()
+	}
+
+	s.portalMu.Lock()
+	for id, fwd := range s.portalForwarders {
+		fwd.Stop()
+		delete(s.portalForwarders, id)
+	}
+	s.stopDrainingMappings()
+	s.portalMu.Unlock()
+	s.proxies.StopAll()
+
+	if s.agents != nil {
+		s.agents.Close()
+	}
+	s.chainPool.Close()
+	s.flushUsage()
+	s.events.Close()
+	ssh.OnLegacyCrypto(nil)
+	ssh.OnAgentForward(nil)
+	if s.audit != nil {
+		s.audit.Close()
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/probe"
+)
+
+func TestProbesWithoutAuth(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+
+	tests := []struct {
+		name   string
+		ready  func()
+		path   string
+		status int
+	}{
+		{"healthz", nil, "/healthz", http.StatusOK},
+		{"readyz before listening", nil, "/readyz", http.StatusServiceUnavailable},
+		{"readyz", server.probes.SetReady, "/readyz", http.StatusOK},
+		{"readyz while draining", server.probes.SetDraining, "/readyz", http.StatusServiceUnavailable},
+		{"healthz while draining", nil, "/healthz", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.ready != nil {
+				tt.ready()
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestServeShutdown(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ready := make(chan struct{})
+	server.OnReady(func() { close(ready) })
+	done := make(chan error, 1)
+	go func() { done <- server.serve(ctx, &http.Server{Addr: "127.0.0.1:0", Handler: handler}) }()
+
+	select {
+	case <-ready:
+	case err := <-done:
+		t.Fatalf("serve: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not become ready")
+	}
+	if resp := server.probes.Ready(); resp.Status != probe.StatusReady {
+		t.Errorf("after listening: %+v", resp)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve returned %v after shutdown", err)
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatal("serve did not return after cancel")
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/transfer"
+)
+
+// maxFormFieldSize 普通表单字段的最大长度
+const maxFormFieldSize = 64 << 10
+
+// stagedForm 流式解析后的上传表单
+type stagedForm struct {
+	fields    map[string]string
+	files     map[string][]string // 表单字段名 -> 相对文件名列表
+	totalSize int64
+}
+
+// stageMultipartUpload 逐个读取 multipart 分段，文件直接写入暂存目录
+func stageMultipartUpload(r *http.Request, dir string) (*stagedForm, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	form := &stagedForm{
+		fields: make(map[string]string),
+		files:  make(map[string][]string),
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		fieldName := part.FormName()
+		fileName := rawFileName(part.Header.Get("Content-Disposition"))
+		if fileName == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize))
+			part.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read field %s: %w", fieldName, err)
+			}
+			form.fields[fieldName] = string(value)
+			continue
+		}
+
+		size, err := stageFilePart(part, dir, fileName)
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+		form.files[fieldName] = append(form.files[fieldName], filepath.ToSlash(fileName))
+		form.totalSize += size
+	}
+
+	return form, nil
+}
+
+// stageFilePart 将单个文件分段写入暂存目录（保留相对目录结构）
+func stageFilePart(src io.Reader, dir, name string) (int64, error) {
+	filePath, err := transfer.SafeJoin(dir, name)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create dir for %s: %w", name, err)
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file %s: %w", name, err)
+	}
+	defer f.Close()
+
+	size, err := io.Copy(f, src)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save file %s: %w", name, err)
+	}
+	return size, nil
+}
+
+// rawFileName 从 Content-Disposition 中提取原始文件名
+// multipart.Part.FileName 会做 filepath.Base，目录上传需要保留相对路径
+func rawFileName(disposition string) string {
+	_, params, err := mime.ParseMediaType(disposition)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimLeft(params["filename"], "/")
+}
+
+// handleStaging 查看暂存区占用 (GET) 或立即清理过期目录 (POST)
+func (s *Server) handleStaging(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		usage, err := s.staging.Usage()
+		if err != nil {
+			failure(w, r, http.StatusInternalServerError, "ERR_STAGING_SCAN", err)
+			return
+		}
+		jsonResponse(w, http.StatusOK, usage)
+	case http.MethodPost:
+		if !requireAdmin(w, r) {
+			return
+		}
+		removed, err := s.staging.Cleanup()
+		if err != nil {
+			failure(w, r, http.StatusInternalServerError, "ERR_STAGING_SCAN", err)
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]int{"removed": removed})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// stagingCleanupLoop 定期清理残留的暂存目录，直到 ctx 取消
+func (s *Server) stagingCleanupLoop(ctx context.Context) {
+	interval := s.config.Upload.CleanupInterval
+	if interval <= 0 {
+		interval = transfer.DefaultStagingCleanupInterval
+	}
+
+	// 启动时先清理一次上次进程遗留的目录
+	if _, err := s.staging.Cleanup(); err != nil {
+		log.Printf("[Staging] Cleanup failed: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.expireChunkedUploads()
+		if _, err := s.staging.Cleanup(); err != nil {
+			log.Printf("[Staging] Cleanup failed: %v", err)
+		}
+	}
+}
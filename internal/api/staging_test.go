@@ -0,0 +1,65 @@
+package api
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStageMultipartUploadKeepsRelativePaths(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	for _, name := range []string{"project/a.txt", "project/sub/b.txt"} {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="files"; filename="`+name+`"`)
+		part, _ := mw.CreatePart(h)
+		part.Write([]byte("content of " + name))
+	}
+	mw.WriteField("target_path", "/data/")
+	mw.WriteField("is_dir", "true")
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/api/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	dir := t.TempDir()
+	form, err := stageMultipartUpload(req, dir)
+	if err != nil {
+		t.Fatalf("stageMultipartUpload failed: %v", err)
+	}
+
+	if form.fields["target_path"] != "/data/" || form.fields["is_dir"] != "true" {
+		t.Errorf("unexpected fields: %v", form.fields)
+	}
+	if len(form.files["files"]) != 2 {
+		t.Fatalf("expected 2 files, got %v", form.files)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "project", "sub", "b.txt")); err != nil {
+		t.Errorf("nested file not staged: %v", err)
+	}
+	if form.totalSize == 0 {
+		t.Error("expected total size to be counted")
+	}
+}
+
+func TestStageMultipartUploadRejectsTraversal(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="file"; filename="../../evil.txt"`)
+	part, _ := mw.CreatePart(h)
+	part.Write([]byte("x"))
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/api/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	if _, err := stageMultipartUpload(req, t.TempDir()); err == nil {
+		t.Error("expected traversal file name to be rejected")
+	}
+}
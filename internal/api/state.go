@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/backup"
+)
+
+const (
+	// maxStateBackupSize 上传恢复的备份文件的大小上限
+	maxStateBackupSize = 1 << 30
+	// backupPassphraseHeader 恢复时加密备份的口令，放在请求头中以免出现在访问日志的 URL 里
+	backupPassphraseHeader = "X-Backup-Passphrase"
+)
+
+// StateBackupRequest 创建备份的请求
+type StateBackupRequest struct {
+	Passphrase string `json:"passphrase,omitempty"` // 为空时不加密
+}
+
+// StateRestoreResponse 恢复备份的结果；restart_required 时配置在重启 gmssh web 后生效，之前的配置修改会被拒绝
+type StateRestoreResponse struct {
+	*backup.Result
+	RestartRequired bool `json:"restart_required"`
+}
+
+// handleStateBackup 把配置目录和 known_hosts 打包下载 (POST /api/state/backup，仅管理员)
+func (s *Server) handleStateBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	var req StateBackupRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+			return
+		}
+	}
+
+	// 先写入暂存区，打包失败时还能返回错误
+	dir, err := s.staging.Create()
+	if err != nil {
+		localizedError(w, r, http.StatusInternalServerError, "ERR_STAGING", err)
+		return
+	}
+	defer s.staging.Remove(dir)
+	name := "gmssh-backup-" + time.Now().Format("20060102-150405") + ".tar.gz"
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		localizedError(w, r, http.StatusInternalServerError, "ERR_STAGING", err)
+		return
+	}
+	defer f.Close()
+	if _, err := backup.Create(f, backup.DefaultSources(s.config.ConfigDir), req.Passphrase); err != nil {
+		failure(w, r, http.StatusInternalServerError, "ERR_STATE_BACKUP_FAILED", err)
+		return
+	}
+	info, err := f.Stat()
+	if err != nil {
+		failure(w, r, http.StatusInternalServerError, ErrInternal, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// handleStateRestore 从请求体中的备份恢复配置目录并合并 known_hosts (POST /api/state/restore，仅管理员)。
+// ?force=true 替换已有配置，?dry_run=true 只校验；加密备份的口令放在 X-Backup-Passphrase 头中。
+// 备份先完整校验再写入；写入后本进程不再保存配置，需要重启
+func (s *Server) handleStateRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	query := r.URL.Query()
+	opts := backup.RestoreOptions{
+		Passphrase: r.Header.Get(backupPassphraseHeader),
+		Force:      query.Get("force") == "true" || backup.Unconfigured(s.config),
+		DryRun:     query.Get("dry_run") == "true",
+	}
+
+	// 已有服务器等配置时需要 force；在校验前拒绝，避免校验通过后才停止保存配置
+	if !opts.DryRun && !opts.Force {
+		failure(w, r, http.StatusConflict, "ERR_STATE_RESTORE_FAILED", backup.ErrConfigExists)
+		return
+	}
+
+	dir, err := s.staging.Create()
+	if err != nil {
+		localizedError(w, r, http.StatusInternalServerError, "ERR_STAGING", err)
+		return
+	}
+	defer s.staging.Remove(dir)
+	f, err := os.Create(filepath.Join(dir, "restore.tar.gz"))
+	if err != nil {
+		localizedError(w, r, http.StatusInternalServerError, "ERR_STAGING", err)
+		return
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, http.MaxBytesReader(w, r.Body, maxStateBackupSize)); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+
+	// 完整校验（口令、截断、条目名）后才停止保存并写入
+	check := opts
+	check.DryRun = true
+	f.Seek(0, io.SeekStart)
+	result, err := backup.Restore(f, backup.DefaultSources(s.config.ConfigDir), check)
+	if err == nil && !opts.DryRun {
+		s.manager.Freeze()
+		f.Seek(0, io.SeekStart)
+		result, err = backup.Restore(f, backup.DefaultSources(s.config.ConfigDir), opts)
+	}
+	if err != nil {
+		failure(w, r, http.StatusBadRequest, "ERR_STATE_RESTORE_FAILED", err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, StateRestoreResponse{Result: result, RestartRequired: !opts.DryRun})
+}
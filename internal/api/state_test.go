@@ -0,0 +1,65 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/config"
+)
+
+func TestStateBackupAndRestore(t *testing.T) {
+	server, _ := setupPortalTestServer(t)
+
+	body := strings.NewReader(`{"passphrase":"s3cret"}`)
+	rec := httptest.NewRecorder()
+	server.handleStateBackup(rec, httptest.NewRequest(http.MethodPost, "/api/state/backup", body))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Content-Disposition"), "gmssh-backup-") {
+		t.Fatalf("backup: %d %s", rec.Code, rec.Body.String())
+	}
+	archive := rec.Body.Bytes()
+
+	restore := func(query, passphrase string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/state/restore"+query, bytes.NewReader(archive))
+		if passphrase != "" {
+			req.Header.Set(backupPassphraseHeader, passphrase)
+		}
+		rec := httptest.NewRecorder()
+		server.handleStateRestore(rec, req)
+		return rec
+	}
+	code := func(rec *httptest.ResponseRecorder) string {
+		var resp struct{ Code string }
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp.Code
+	}
+
+	// 已有服务器：没有 force 时拒绝
+	if rec := restore("", "s3cret"); rec.Code != http.StatusConflict || code(rec) != "ERR_STATE_CONFIG_EXISTS" {
+		t.Errorf("restore without force: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := restore("?force=true", "wrong"); rec.Code != http.StatusBadRequest || code(rec) != "ERR_STATE_PASSPHRASE" {
+		t.Errorf("wrong passphrase: %d %s", rec.Code, rec.Body.String())
+	}
+	// 校验失败和 dry run 都不影响之后保存配置
+	if rec := restore("?dry_run=true", "s3cret"); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"restart_required":true`) {
+		t.Errorf("dry run: %d %s", rec.Code, rec.Body.String())
+	}
+	if err := server.manager.Save(); err != nil {
+		t.Fatalf("save after dry run: %v", err)
+	}
+
+	rec = restore("?force=true", "s3cret")
+	var resp StateRestoreResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK || !resp.RestartRequired || len(resp.Restored) == 0 {
+		t.Fatalf("restore: %d %s", rec.Code, rec.Body.String())
+	}
+	// 恢复后内存中的旧配置不能覆盖恢复的文件
+	if err := server.manager.Save(); !errors.Is(err, config.ErrFrozen) {
+		t.Errorf("save after restore = %v", err)
+	}
+}
@@ -0,0 +1,362 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/profiler"
+	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const (
+	// statusCheckInterval 只读状态页模式下的健康检查间隔
+	statusCheckInterval = time.Minute
+	// statusProbeTimeout 单台服务器探测超时
+	statusProbeTimeout = 30 * time.Second
+	// statusProbeConcurrency 同时探测的服务器数量
+	statusProbeConcurrency = 8
+	// statusRefreshSeconds 状态页自动刷新间隔
+	statusRefreshSeconds = 30
+)
+
+// 状态值
+const (
+	statusUp      = "up"
+	statusDown    = "down"
+	statusUnknown = "unknown"
+)
+
+// StatusResponse 只读状态汇总；只包含名称和状态，不暴露地址、用户名或错误详情
+type StatusResponse struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Summary     StatusSummary  `json:"summary"`
+	Servers     []ServerStatus `json:"servers"`
+	Tunnels     []TunnelStatus `json:"tunnels"`
+}
+
+// StatusSummary 汇总计数
+type StatusSummary struct {
+	Servers     int `json:"servers"`
+	ServersUp   int `json:"servers_up"`
+	ServersDown int `json:"servers_down"`
+	Tunnels     int `json:"tunnels"`
+	TunnelsUp   int `json:"tunnels_up"`
+}
+
+// ServerStatus 单台服务器的健康状态
+type ServerStatus struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Type      string         `json:"type"`
+	Status    string         `json:"status"` // up | down | unknown
+	LatencyMs float64        `json:"latency_ms,omitempty"`
+	LastCheck time.Time      `json:"last_check,omitempty"`
+	History   []LatencyPoint `json:"history"`
+	// LegacyCrypto 该服务器开启了 legacy_crypto，允许协商已弃用的算法
+	LegacyCrypto bool `json:"legacy_crypto,omitempty"`
+}
+
+// LatencyPoint 延迟曲线上的一个点
+type LatencyPoint struct {
+	Time      time.Time `json:"time"`
+	LatencyMs float64   `json:"latency_ms"`
+	Success   bool      `json:"success"`
+}
+
+// TunnelStatus 隧道（端口转发 / Portal 映射）状态
+type TunnelStatus struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"` // proxy | portal
+	Active  bool   `json:"active"`
+	Exposed bool   `json:"exposed,omitempty"` // 本地端口能从本机以外访问
+}
+
+// statusMonitor 只读状态页模式的后台健康检查状态
+type statusMonitor struct {
+	tunnels map[string]bool // portal mapping_id -> 本地端口是否在监听
+	mu      sync.RWMutex
+}
+
+// RegisterStatusRoutes 注册只读状态页路由（不含任何修改、终端或文件操作接口）
+func (s *Server) RegisterStatusRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/", s.handleStatusPage)
+	s.probes.Register(mux)
+}
+
+// StartStatusOnly 以只读状态页模式启动：仅提供汇总的健康、延迟曲线和隧道状态，
+// 不需要认证，适合挂在运维大屏上或分享给相关方。ctx 取消时优雅关闭
+func (s *Server) StartStatusOnly(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	s.RegisterStatusRoutes(mux)
+
+	s.monitor = &statusMonitor{tunnels: make(map[string]bool)}
+	go s.statusCheckLoop(ctx)
+
+	log.Printf("Starting read-only status page on %s", addr)
+	return s.serve(ctx, &http.Server{Addr: addr, Handler: requestIDMiddleware(s.corsMiddleware(mux))})
+}
+
+// statusCheckLoop 定期探测所有服务器和 Portal 映射
+func (s *Server) statusCheckLoop(ctx context.Context) {
+	ticker := time.NewTicker(statusCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.checkStatus(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkStatus 执行一轮健康检查
+func (s *Server) checkStatus(ctx context.Context) {
+	sem := make(chan struct{}, statusProbeConcurrency)
+	var wg sync.WaitGroup
+	for _, hop := range s.config.Hops {
+		chain := s.config.GatewayChain(hop)
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			probeCtx, cancel := context.WithTimeout(ctx, statusProbeTimeout)
+			defer cancel()
+			s.profiler.Refresh(probeCtx, chain)
+		}()
+	}
+	wg.Wait()
+
+	tunnels := make(map[string]bool)
+	for _, m := range s.config.Portal.Client.Mappings {
+		if m.Enabled {
+			tunnels[m.ID] = isListening(m.LocalAddr)
+		}
+	}
+	s.monitor.mu.Lock()
+	s.monitor.tunnels = tunnels
+	s.monitor.mu.Unlock()
+}
+
+// isListening 检查本地地址是否有进程在监听，unix socket 路径按 unix 连接
+func isListening(addr string) bool {
+	network := "tcp"
+	if path, ok := proxy.UnixSocketPath(addr); ok {
+		network, addr = "unix", path
+	}
+	conn, err := net.DialTimeout(network, addr, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// buildStatus 汇总当前状态
+func (s *Server) buildStatus() *StatusResponse {
+	resp := &StatusResponse{
+		GeneratedAt: time.Now(),
+		Servers:     make([]ServerStatus, 0, len(s.config.Hops)),
+		Tunnels:     make([]TunnelStatus, 0),
+	}
+
+	for _, hop := range s.config.Hops {
+		status := ServerStatus{
+			ID:     hop.ID,
+			Name:   hop.Name,
+			Type:   hop.ServerType.String(),
+			Status: statusUnknown,
+			// 状态页和 gmssh status --watch 据此提示
+			LegacyCrypto: hop.LegacyCrypto,
+		}
+		samples := s.profiler.History(profiler.PathOf(s.config.GatewayChain(hop)))
+		status.History = make([]LatencyPoint, 0, len(samples))
+		for _, sample := range samples {
+			status.History = append(status.History, LatencyPoint{
+				Time:      sample.Timestamp,
+				LatencyMs: durationMs(sample.Latency),
+				Success:   sample.Success,
+			})
+		}
+		if len(samples) > 0 {
+			last := samples[len(samples)-1]
+			status.LastCheck = last.Timestamp
+			if last.Success {
+				status.Status = statusUp
+				status.LatencyMs = durationMs(last.Latency)
+				resp.Summary.ServersUp++
+			} else {
+				status.Status = statusDown
+				resp.Summary.ServersDown++
+			}
+		} else if check := hop.LastCheck; check != nil {
+			// 本进程还没有探测过时使用最近一次健康检查（server check、定时检查）的结果
+			status.LastCheck = check.CheckedAt
+			if check.OK {
+				status.Status = statusUp
+				status.LatencyMs = float64(check.LatencyMs)
+				resp.Summary.ServersUp++
+			} else {
+				status.Status = statusDown
+				resp.Summary.ServersDown++
+			}
+		}
+		resp.Servers = append(resp.Servers, status)
+	}
+
+	for id, fwd := range s.proxies.List() {
+		resp.Tunnels = append(resp.Tunnels, TunnelStatus{Name: id, Kind: "proxy", Active: fwd.GetInfo(id).Active,
+			Exposed: proxy.ExposesLAN(fwd.GetLocalAddr())})
+	}
+	for i := range s.config.Portal.Client.Mappings {
+		m := &s.config.Portal.Client.Mappings[i]
+		resp.Tunnels = append(resp.Tunnels, TunnelStatus{Name: m.Name, Kind: "portal", Active: s.portalMappingActive(m),
+			Exposed: proxy.ExposesLAN(m.LocalAddr)})
+	}
+	sort.SliceStable(resp.Tunnels, func(i, j int) bool {
+		if resp.Tunnels[i].Kind != resp.Tunnels[j].Kind {
+			return resp.Tunnels[i].Kind < resp.Tunnels[j].Kind
+		}
+		return resp.Tunnels[i].Name < resp.Tunnels[j].Name
+	})
+
+	resp.Summary.Servers = len(resp.Servers)
+	resp.Summary.Tunnels = len(resp.Tunnels)
+	for _, t := range resp.Tunnels {
+		if t.Active {
+			resp.Summary.TunnelsUp++
+		}
+	}
+	return resp
+}
+
+// portalMappingActive 映射在本进程中运行，或由其他进程（gmssh portal client）在本地监听
+func (s *Server) portalMappingActive(m *types.PortMapping) bool {
+	if !m.Enabled {
+		return false
+	}
+	s.portalMu.RLock()
+	_, running := s.portalForwarders[m.ID]
+	s.portalMu.RUnlock()
+	if running || s.monitor == nil {
+		return running
+	}
+	s.monitor.mu.RLock()
+	defer s.monitor.mu.RUnlock()
+	return s.monitor.tunnels[m.ID]
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// handleStatus 返回只读状态汇总
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.buildStatus())
+}
+
+// handleStatusPage 渲染状态页，无需前端资源，可直接在大屏浏览器中打开
+func (s *Server) handleStatusPage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" && r.URL.Path != "/HSSH/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusPageTemplate.Execute(w, s.buildStatus()); err != nil {
+		log.Printf("Error rendering status page: %v", err)
+	}
+}
+
+// sparkline 把延迟曲线渲染为 SVG polyline 的坐标串
+func sparkline(points []LatencyPoint, width, height float64) string {
+	if len(points) < 2 {
+		return ""
+	}
+	max := 0.0
+	for _, p := range points {
+		if p.LatencyMs > max {
+			max = p.LatencyMs
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	coords := make([]string, len(points))
+	step := width / float64(len(points)-1)
+	for i, p := range points {
+		y := height
+		if p.Success {
+			y = height - p.LatencyMs/max*height
+		}
+		coords[i] = fmt.Sprintf("%.1f,%.1f", float64(i)*step, y)
+	}
+	return strings.Join(coords, " ")
+}
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"sparkline": func(points []LatencyPoint) string { return sparkline(points, 200, 30) },
+	"since": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return time.Since(t).Round(time.Second).String() + " ago"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="` + fmt.Sprint(statusRefreshSeconds) + `">
+<title>GMSSH Status</title>
+<style>
+body { font-family: -apple-system, sans-serif; background: #111; color: #ddd; margin: 2em; }
+h1 { font-weight: 400; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { text-align: left; padding: .4em .8em; border-bottom: 1px solid #333; }
+.up { color: #4caf50; } .down { color: #f44336; } .unknown { color: #888; }
+polyline { fill: none; stroke: #64b5f6; stroke-width: 1.5; }
+</style>
+</head>
+<body>
+<h1>Servers {{.Summary.ServersUp}}/{{.Summary.Servers}} up &middot; Tunnels {{.Summary.TunnelsUp}}/{{.Summary.Tunnels}} up</h1>
+<table>
+<tr><th>Server</th><th>Type</th><th>Status</th><th>Latency</th><th>History</th><th>Last check</th></tr>
+{{range .Servers}}<tr>
+<td>{{.Name}}</td><td>{{.Type}}</td><td class="{{.Status}}">{{.Status}}</td>
+<td>{{if .LatencyMs}}{{printf "%.0f" .LatencyMs}} ms{{else}}-{{end}}</td>
+<td><svg width="200" height="30"><polyline points="{{sparkline .History}}"/></svg></td>
+<td>{{since .LastCheck}}</td>
+</tr>{{end}}
+</table>
+<table>
+<tr><th>Tunnel</th><th>Kind</th><th>Status</th></tr>
+{{range .Tunnels}}<tr>
+<td>{{.Name}}{{if .Exposed}} <span class="down">(exposed to the network)</span>{{end}}</td><td>{{.Kind}}</td>{{if .Active}}<td class="up">up</td>{{else}}<td class="down">down</td>{{end}}
+</tr>{{end}}
+</table>
+<p class="unknown">Updated {{.GeneratedAt.Format "2006-01-02 15:04:05"}}</p>
+</body>
+</html>
+`))
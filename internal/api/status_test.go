@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// newStatusTestServer 创建只读状态页模式的测试服务器
+func newStatusTestServer(t *testing.T) (*Server, http.Handler) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	server, err := NewServer()
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	// 端口 1 上没有服务，探测会立即失败
+	if err := server.manager.AddHop(&types.Hop{ID: "hop-1", Name: "web-1", Host: "127.0.0.1", Port: 1, User: "secret-user", Password: "secret-pass"}); err != nil {
+		t.Fatalf("failed to add hop: %v", err)
+	}
+	server.monitor = &statusMonitor{tunnels: make(map[string]bool)}
+
+	mux := http.NewServeMux()
+	server.RegisterStatusRoutes(mux)
+	return server, mux
+}
+
+func TestStatusOnlyRoutes(t *testing.T) {
+	_, handler := newStatusTestServer(t)
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{http.MethodGet, "/api/status", http.StatusOK},
+		{http.MethodGet, "/", http.StatusOK},
+		{http.MethodPost, "/api/status", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/servers", http.StatusNotFound},
+		{http.MethodPost, "/api/servers", http.StatusNotFound},
+		{http.MethodGet, "/api/terminal", http.StatusNotFound},
+		{http.MethodPost, "/api/upload", http.StatusNotFound},
+		{http.MethodGet, "/api/browse/hop-1", http.StatusNotFound},
+		{http.MethodPost, "/api/proxy", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestStatusReportsHealthWithoutDetails(t *testing.T) {
+	server, handler := newStatusTestServer(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	server.config.Portal.Client.Mappings = []types.PortMapping{
+		{ID: "m-1", Name: "db", LocalAddr: listener.Addr().String(), RemoteHost: "internal-db", RemotePort: 5432, Enabled: true},
+		{ID: "m-2", Name: "cache", LocalAddr: "127.0.0.1:1", RemoteHost: "internal-cache", RemotePort: 6379, Enabled: true},
+	}
+
+	server.checkStatus(context.Background())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	body := rec.Body.String()
+
+	var resp StatusResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(resp.Servers) != 1 || resp.Servers[0].Status != statusDown || len(resp.Servers[0].History) != 1 {
+		t.Errorf("unexpected servers: %+v", resp.Servers)
+	}
+	if resp.Summary.Tunnels != 2 || resp.Summary.TunnelsUp != 1 {
+		t.Errorf("unexpected summary: %+v", resp.Summary)
+	}
+
+	for _, leaked := range []string{"127.0.0.1", "secret-user", "secret-pass", "internal-db", "refused"} {
+		if strings.Contains(body, leaked) {
+			t.Errorf("status response leaks %q", leaked)
+		}
+	}
+}
+
+func TestIsListeningUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "db.sock")
+	if isListening(socket) {
+		t.Fatal("socket reported listening before it exists")
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer listener.Close()
+
+	for _, addr := range []string{socket, "unix:" + socket} {
+		if !isListening(addr) {
+			t.Errorf("isListening(%q) = false", addr)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// 映射切换的原因
+const (
+	switchoverConfig = "config" // 运行中映射的目标、via 等被修改
+	switchoverPath   = "path"   // 告警时切换到备选路径
+)
+
+// MappingSwitchover 运行中映射最近一次切换：新转发器接管本地端口，旧转发器上的连接继续转发到结束或超时
+type MappingSwitchover struct {
+	At        time.Time `json:"at"`
+	Reason    string    `json:"reason"`            // config 或 path
+	Hops      int       `json:"hops"`              // 新链路的跳数
+	Draining  int       `json:"draining"`          // 仍在旧转发器上的连接
+	Deadline  time.Time `json:"deadline"`          // 此后旧连接被断开
+	Completed bool      `json:"completed"`         // 旧转发器已关闭
+	CutOff    int       `json:"cut_off,omitempty"` // 超时被断开的连接数
+	Error     string    `json:"error,omitempty"`   // 切换失败的原因，新链路未能连接时旧转发器保持原样
+}
+
+// mappingRouteChanged 映射的修改是否需要重建转发器（本地地址、目标、via 或解析方式变化）
+func mappingRouteChanged(before, after types.PortMapping) bool {
+	return before.LocalAddr != after.LocalAddr ||
+		before.RemoteHost != after.RemoteHost ||
+		before.RemotePort != after.RemotePort ||
+		before.Resolver != after.Resolver ||
+		!slices.Equal(before.Via, after.Via)
+}
+
+// switchMapping 按修改后的配置重建运行中的映射；失败时旧转发器保持原样（新转发器无法监听时除外），
+// 结果记录在映射的切换状态中
+func (s *Server) switchMapping(ctx context.Context, id string, mapping *types.PortMapping, old *proxy.PortForwarder) {
+	hops, err := s.buildHopChainForMapping(mapping)
+	if err == nil && len(hops) == 0 {
+		err = errors.New("mapping has no hops")
+	}
+	if err == nil {
+		err = s.restartMappingOn(ctx, id, mapping, old, hops, switchoverConfig)
+	}
+	if err != nil {
+		log.Printf("[Portal] Failed to switch mapping %s to its new configuration: %v", id, err)
+		s.portalMu.Lock()
+		s.portalSwitches[id] = &MappingSwitchover{At: time.Now(), Reason: switchoverConfig, Hops: len(hops), Completed: true, Error: err.Error()}
+		s.portalMu.Unlock()
+	}
+}
+
+// restartMappingOn 在新链路上重启映射：先连接新链路，再让新转发器接管本地端口，
+// 旧转发器停止接受新连接，已有连接由 drainMapping 等待结束
+func (s *Server) restartMappingOn(ctx context.Context, id string, mapping *types.PortMapping, old *proxy.PortForwarder, hops []*types.Hop, reason string) error {
+	localAddr, err := s.mappingBindAddr(mapping)
+	if err != nil {
+		return err
+	}
+	chain := ssh.NewChain(hops)
+	if err := chain.ConnectContext(ctx); err != nil {
+		return err
+	}
+	chain.Supervise(context.Background(), ssh.DefaultReconnectPolicy())
+
+	s.portalMu.Lock()
+	defer s.portalMu.Unlock()
+	if s.portalForwarders[id] != old {
+		// 期间映射被停止或重启
+		chain.Disconnect()
+		return nil
+	}
+
+	old.StopAccepting()
+	forwarder := proxy.NewPortForwarder(chain, localAddr, mapping.RemoteHost, mapping.RemotePort)
+	forwarder.SetResolver(mappingResolver(mapping), terminal.HopKey(hops))
+	forwarder.OnStop(chain.Disconnect)
+	if err := forwarder.Start(); err != nil {
+		forwarder.Stop()
+		old.Stop()
+		delete(s.portalForwarders, id)
+		return err
+	}
+	s.portalForwarders[id] = forwarder
+	s.drainMapping(id, old, reason, len(hops))
+	log.Printf("[Portal] Mapping %s switched to a %d-hop path (%s), draining %d connection(s)", id, len(hops), reason, old.GetConnectionCount())
+	return nil
+}
+
+// drainMapping 在后台等旧转发器的连接结束或超过 portal.client.connection.drain_timeout 后关闭它，
+// 并记录切换状态。调用方持有 portalMu；同一映射上一次切换尚未排空的转发器立即关闭
+func (s *Server) drainMapping(id string, old *proxy.PortForwarder, reason string, hops int) {
+	timeout := s.config.Portal.Client.Connection.DrainTimeout
+	if timeout <= 0 {
+		timeout = proxy.DefaultDrainTimeout
+	}
+	if prev := s.portalDraining[id]; prev != nil {
+		go prev.Stop()
+	}
+	now := time.Now()
+	sw := &MappingSwitchover{At: now, Reason: reason, Hops: hops, Draining: old.GetConnectionCount(), Deadline: now.Add(timeout)}
+	s.portalDraining[id] = old
+	s.portalSwitches[id] = sw
+
+	go func() {
+		cut := old.Drain(timeout)
+		s.portalMu.Lock()
+		if s.portalDraining[id] == old {
+			delete(s.portalDraining, id)
+		}
+		sw.Completed = true
+		sw.Draining = 0
+		sw.CutOff = cut
+		s.portalMu.Unlock()
+		if cut > 0 {
+			log.Printf("[Portal] Mapping %s: drain timed out, closed %d connection(s) on the old path", id, cut)
+		}
+	}()
+}
+
+// mappingSwitchover 返回映射最近一次切换的状态（排空中的连接数为当前值），调用方持有 portalMu 读锁
+func (s *Server) mappingSwitchover(id string) *MappingSwitchover {
+	sw, ok := s.portalSwitches[id]
+	if !ok {
+		return nil
+	}
+	snapshot := *sw
+	if old := s.portalDraining[id]; old != nil && !sw.Completed {
+		snapshot.Draining = old.GetConnectionCount()
+	}
+	return &snapshot
+}
+
+// stopDrainingMapping 立即关闭映射排空中的旧转发器，调用方持有 portalMu
+func (s *Server) stopDrainingMapping(id string) {
+	if fwd := s.portalDraining[id]; fwd != nil {
+		fwd.Stop()
+		delete(s.portalDraining, id)
+	}
+}
+
+// stopDrainingMappings 立即关闭所有排空中的旧转发器，调用方持有 portalMu
+func (s *Server) stopDrainingMappings() {
+	for id := range s.portalDraining {
+		s.stopDrainingMapping(id)
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestMappingRouteChanged(t *testing.T) {
+	base := types.PortMapping{Name: "web", LocalAddr: ":8080", RemoteHost: "10.0.0.5", RemotePort: 80, Via: []string{"gw"}}
+
+	renamed := base
+	renamed.Name = "web2"
+	renamed.Enabled = true
+	if mappingRouteChanged(base, renamed) {
+		t.Error("renaming a mapping needs no switchover")
+	}
+
+	for name, change := range map[string]func(*types.PortMapping){
+		"local":  func(m *types.PortMapping) { m.LocalAddr = ":9090" },
+		"host":   func(m *types.PortMapping) { m.RemoteHost = "10.0.0.6" },
+		"port":   func(m *types.PortMapping) { m.RemotePort = 443 },
+		"via":    func(m *types.PortMapping) { m.Via = []string{"gw", "gw2"} },
+		"direct": func(m *types.PortMapping) { m.Via = nil },
+	} {
+		after := base
+		change(&after)
+		if !mappingRouteChanged(base, after) {
+			t.Errorf("%s: change not detected", name)
+		}
+	}
+}
+
+func TestSwitchMappingWithoutHops(t *testing.T) {
+	server, _ := setupPortalTestServer(t)
+
+	// 新配置没有可用的跳：切换失败并记录原因，旧转发器不受影响
+	mapping := &types.PortMapping{ID: "test-mapping-1", LocalAddr: ":8080", RemoteHost: "a", RemotePort: 80, Via: []string{"missing"}}
+	server.switchMapping(context.Background(), "test-mapping-1", mapping, nil)
+
+	server.portalMu.RLock()
+	sw := server.mappingSwitchover("test-mapping-1")
+	server.portalMu.RUnlock()
+	if sw == nil || sw.Error == "" || !sw.Completed || sw.Reason != switchoverConfig {
+		t.Fatalf("switchover = %+v", sw)
+	}
+	if server.mappingSwitchover("other") != nil {
+		t.Error("switchover recorded for an unchanged mapping")
+	}
+}
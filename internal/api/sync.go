@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/teamsync"
+)
+
+// syncRequestTimeout 手动触发同步的最长等待时间
+const syncRequestTimeout = 3 * time.Minute
+
+// startTeamSync 按配置启动团队拓扑同步
+func (s *Server) startTeamSync(ctx context.Context) error {
+	syncer, err := teamsync.New(s.config.Sync, s.manager, filepath.Join(s.config.ConfigDir, "sync"))
+	if err != nil {
+		return err
+	}
+	s.syncer = syncer
+	go syncer.Run(ctx)
+	return nil
+}
+
+// handleSync 查看同步状态（GET）或立即同步（POST，仅管理员）
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if s.syncer == nil {
+			jsonResponse(w, http.StatusOK, map[string]interface{}{"enabled": false})
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"enabled": true,
+			"status":  s.syncer.Status(),
+		})
+
+	case http.MethodPost:
+		if !requireAdmin(w, r) {
+			return
+		}
+		if s.syncer == nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_SYNC_DISABLED")
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), syncRequestTimeout)
+		defer cancel()
+		report, err := s.syncer.Sync(ctx)
+		if err != nil {
+			localizedError(w, r, http.StatusBadGateway, "ERR_SYNC_FAILED", err)
+			return
+		}
+		jsonResponse(w, http.StatusOK, report)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	internalSSH "github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/pkg/types"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	// defaultTailLines 未指定 lines 时先输出的末尾行数
+	defaultTailLines = 100
+	// maxTailLines lines 参数上限
+	maxTailLines = 10000
+	// defaultTailRate 未指定 max_rate 时每秒最多推送的行数
+	defaultTailRate = 200
+	// maxTailRate max_rate 参数上限
+	maxTailRate = 5000
+	// maxTailLineSize 单行最大长度，更长的行按该长度拆成多行推送
+	maxTailLineSize = 64 * 1024
+	// tailConnectTimeout 建立跳板链的最长时间
+	tailConnectTimeout = 30 * time.Second
+	// tailHeartbeat 没有输出时发送 SSE 注释的间隔，防止代理断开空闲连接
+	tailHeartbeat = 15 * time.Second
+)
+
+// tailRequest 解析后的 tail 参数
+type tailRequest struct {
+	hop     *types.Hop
+	path    string
+	follow  bool
+	lines   int
+	rate    int
+	pattern *regexp.Regexp
+}
+
+// TailDropped 限速丢弃的行数（SSE 事件 dropped）
+type TailDropped struct {
+	Dropped int `json:"dropped"`
+}
+
+// TailEnd 远端 tail 退出（SSE 事件 end）
+type TailEnd struct {
+	Error string `json:"error,omitempty"`
+}
+
+// tailLimiter 按固定的一秒窗口限制推送的行数，超出的行丢弃并计数
+type tailLimiter struct {
+	rate    int
+	sent    int
+	dropped int
+}
+
+// allow 当前窗口还能推送一行时返回 true
+func (l *tailLimiter) allow() bool {
+	if l.sent >= l.rate {
+		l.dropped++
+		return false
+	}
+	l.sent++
+	return true
+}
+
+// reset 开始新的窗口，返回上一个窗口丢弃的行数
+func (l *tailLimiter) reset() int {
+	dropped := l.dropped
+	l.sent, l.dropped = 0, 0
+	return dropped
+}
+
+// tailCommand 返回在远端执行的 tail 命令；follow 时使用 -F，文件被轮转或重建后继续跟踪
+func tailCommand(path string, lines int, follow bool) string {
+	cmd := "exec tail -n " + strconv.Itoa(lines)
+	if follow {
+		cmd += " -F"
+	}
+	return cmd + " -- " + terminal.ShellQuote(path)
+}
+
+// parseTailRequest 解析并校验查询参数，失败时已写入错误响应
+func (s *Server) parseTailRequest(w http.ResponseWriter, r *http.Request) (tailRequest, bool) {
+	q := r.URL.Query()
+	req := tailRequest{lines: defaultTailLines, rate: defaultTailRate}
+
+	server := q.Get("server")
+	if server == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_HOP_ID_REQUIRED")
+		return req, false
+	}
+	req.hop = s.config.GetHopByID(server)
+	if req.hop == nil {
+		req.hop = s.config.GetHopByName(server)
+	}
+	if req.hop == nil {
+		localizedError(w, r, http.StatusNotFound, "ERR_HOP_NOT_FOUND")
+		return req, false
+	}
+
+	req.path = q.Get("path")
+	if req.path == "" {
+		localizedError(w, r, http.StatusBadRequest, "ERR_PATH_REQUIRED")
+		return req, false
+	}
+
+	if v := q.Get("follow"); v != "" {
+		follow, err := strconv.ParseBool(v)
+		if err != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "follow", v)
+			return req, false
+		}
+		req.follow = follow
+	}
+	if v := q.Get("lines"); v != "" {
+		lines, err := strconv.Atoi(v)
+		if err != nil || lines < 0 || lines > maxTailLines {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "lines", v)
+			return req, false
+		}
+		req.lines = lines
+	}
+	if v := q.Get("max_rate"); v != "" {
+		rate, err := strconv.Atoi(v)
+		if err != nil || rate <= 0 || rate > maxTailRate {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "max_rate", v)
+			return req, false
+		}
+		req.rate = rate
+	}
+	if v := q.Get("grep"); v != "" {
+		pattern, err := regexp.Compile(v)
+		if err != nil {
+			localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PATTERN", err)
+			return req, false
+		}
+		req.pattern = pattern
+	}
+	return req, true
+}
+
+// handleTail 在服务器上运行 tail 并以 SSE 推送输出 (GET /api/tail)：
+// 每行一个 message 事件，grep 为正则，只推送匹配的行；超过 max_rate 行/秒的部分丢弃并以 dropped 事件报告数量；
+// 远端退出时发送 end 事件。客户端断开时关闭远端会话
+func (s *Server) handleTail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, ok := s.parseTailRequest(w, r)
+	if !ok {
+		return
+	}
+
+	hops := s.buildHopChain(req.hop.Name)
+	if len(hops) == 0 {
+		localizedError(w, r, http.StatusInternalServerError, "ERR_BUILD_CHAIN", req.hop.Name)
+		return
+	}
+
+	connectCtx, cancel := context.WithTimeout(r.Context(), tailConnectTimeout)
+	pooled, err := s.openPooledSession(connectCtx, hops)
+	cancel()
+	if err != nil {
+		failure(w, r, http.StatusBadGateway, "ERR_CHAIN_CONNECT", err)
+		return
+	}
+	defer pooled.Close()
+
+	session := pooled.GetSession()
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		failure(w, r, http.StatusBadGateway, "ERR_TAIL", err)
+		return
+	}
+	// 分配 PTY：会话关闭时远端收到 SIGHUP，tail -F 随之退出而不是留在服务器上。
+	// PTY 下 tail 的错误输出（如文件不存在）与文件内容混在同一个流中。
+	// 只允许 exec 的服务器拒绝 PTY 时退回普通 exec，tail 在下次写入已关闭的通道时退出
+	if err := internalSSH.RequestPTY(req.hop, session, "dumb", 0, 0, gossh.TerminalModes{gossh.ECHO: 0, gossh.OPOST: 0}); err != nil {
+		if !internalSSH.IsCapabilityError(err) {
+			failure(w, r, http.StatusBadGateway, "ERR_TAIL", err)
+			return
+		}
+		log.Printf("[Tail] %v; continuing without PTY", err)
+	}
+	if err := session.Start(tailCommand(req.path, req.lines, req.follow)); err != nil {
+		failure(w, r, http.StatusBadGateway, "ERR_TAIL", err)
+		return
+	}
+
+	lines := make(chan string, 256)
+	exited := make(chan error, 1)
+	go func() {
+		if !readTailLines(stdout, lines, r.Context().Done()) {
+			return
+		}
+		// 输出读完后再等待退出，保证最后几行先于 end 事件发出
+		exited <- session.Wait()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	limiter := &tailLimiter{rate: req.rate}
+	window := time.NewTicker(time.Second)
+	defer window.Stop()
+	heartbeat := time.NewTicker(tailHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case line := <-lines:
+			if req.pattern != nil && !req.pattern.MatchString(line) || !limiter.allow() {
+				continue
+			}
+			writeSSE(w, "", line)
+		case <-window.C:
+			dropped := limiter.reset()
+			if dropped == 0 {
+				continue
+			}
+			writeSSEJSON(w, "dropped", TailDropped{Dropped: dropped})
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case err := <-exited:
+			// 读协程已退出，把还在通道里的行发完
+			for len(lines) > 0 {
+				line := <-lines
+				if (req.pattern == nil || req.pattern.MatchString(line)) && limiter.allow() {
+					writeSSE(w, "", line)
+				}
+			}
+			if dropped := limiter.reset(); dropped > 0 {
+				writeSSEJSON(w, "dropped", TailDropped{Dropped: dropped})
+			}
+			end := TailEnd{}
+			if err != nil {
+				end.Error = err.Error()
+			}
+			writeSSEJSON(w, "end", end)
+			rc.Flush()
+			return
+		case <-r.Context().Done():
+			// 客户端断开：deferred Close 关闭远端会话
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// readTailLines 逐行读取 r 发送到 lines，直到 EOF 或读取出错；
+// 超过 maxTailLineSize 的行按该长度拆成多行发送。done 关闭时返回 false
+func readTailLines(r io.Reader, lines chan<- string, done <-chan struct{}) bool {
+	reader := bufio.NewReaderSize(r, maxTailLineSize)
+	for {
+		line, _, err := reader.ReadLine()
+		if err != nil {
+			return true
+		}
+		select {
+		case lines <- strings.TrimRight(string(line), "\r"):
+		case <-done:
+			return false
+		}
+	}
+}
+
+// writeSSE 写入一个 SSE 事件，event 为空时为默认的 message 事件
+func writeSSE(w io.Writer, event, data string) {
+	if event != "" {
+		fmt.Fprintf(w, "event: %s\n", event)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+// writeSSEJSON 写入数据为 JSON 的 SSE 事件
+func writeSSEJSON(w io.Writer, event string, v any) {
+	data, _ := json.Marshal(v)
+	writeSSE(w, event, string(data))
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTailValidation(t *testing.T) {
+	_, handler := newAuthTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		status int
+		code   string
+	}{
+		{"wrong method", http.MethodPost, "server=hop-1&path=/var/log/syslog", http.StatusMethodNotAllowed, ""},
+		{"missing server", http.MethodGet, "path=/var/log/syslog", http.StatusBadRequest, "ERR_HOP_ID_REQUIRED"},
+		{"unknown server", http.MethodGet, "server=missing-hop&path=/var/log/syslog", http.StatusNotFound, "ERR_HOP_NOT_FOUND"},
+		{"missing path", http.MethodGet, "server=web-1", http.StatusBadRequest, "ERR_PATH_REQUIRED"},
+		{"invalid follow", http.MethodGet, "server=hop-1&path=/a&follow=maybe", http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"negative lines", http.MethodGet, "server=hop-1&path=/a&lines=-1", http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"too many lines", http.MethodGet, "server=hop-1&path=/a&lines=10001", http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"zero rate", http.MethodGet, "server=hop-1&path=/a&max_rate=0", http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"invalid pattern", http.MethodGet, "server=hop-1&path=/a&grep=%28", http.StatusBadRequest, "ERR_INVALID_PATTERN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/tail?"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer bob-token")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.code == "" {
+				return
+			}
+			var resp map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if resp["code"] != tt.code {
+				t.Errorf("code = %q, want %q", resp["code"], tt.code)
+			}
+		})
+	}
+}
+
+func TestTailCommand(t *testing.T) {
+	tests := []struct {
+		path   string
+		lines  int
+		follow bool
+		want   string
+	}{
+		{"/var/log/syslog", 100, false, "exec tail -n 100 -- '/var/log/syslog'"},
+		{"/var/log/app.log", 0, true, "exec tail -n 0 -F -- '/var/log/app.log'"},
+		{"/tmp/it's; rm -rf ~", 10, true, `exec tail -n 10 -F -- '/tmp/it'\''s; rm -rf ~'`},
+	}
+
+	for _, tt := range tests {
+		if got := tailCommand(tt.path, tt.lines, tt.follow); got != tt.want {
+			t.Errorf("tailCommand(%q, %d, %v) = %q, want %q", tt.path, tt.lines, tt.follow, got, tt.want)
+		}
+	}
+}
+
+func TestTailLimiter(t *testing.T) {
+	l := &tailLimiter{rate: 3}
+	var sent int
+	for i := 0; i < 10; i++ {
+		if l.allow() {
+			sent++
+		}
+	}
+	if sent != 3 {
+		t.Errorf("sent %d lines in one window, want 3", sent)
+	}
+	if dropped := l.reset(); dropped != 7 {
+		t.Errorf("dropped = %d, want 7", dropped)
+	}
+	if !l.allow() {
+		t.Error("new window should allow lines again")
+	}
+	if dropped := l.reset(); dropped != 0 {
+		t.Errorf("dropped = %d after a quiet window, want 0", dropped)
+	}
+}
+
+func TestReadTailLinesSplitsLongLines(t *testing.T) {
+	long := strings.Repeat("x", maxTailLineSize+1000)
+	input := "first\r\n" + long + "\nlast"
+
+	lines := make(chan string, 8)
+	if !readTailLines(strings.NewReader(input), lines, make(chan struct{})) {
+		t.Fatal("readTailLines reported cancellation")
+	}
+	close(lines)
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+
+	want := []string{"first", long[:maxTailLineSize], long[maxTailLineSize:], "last"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d has %d bytes, want %d", i, len(got[i]), len(want[i]))
+		}
+	}
+}
@@ -1,16 +1,35 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"sync"
+	"time"
 
+	"github.com/luobobo896/HSSH/internal/events"
+	"github.com/luobobo896/HSSH/internal/i18n"
+	"github.com/luobobo896/HSSH/internal/lifecycle"
 	internalSSH "github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/internal/usage"
 	"github.com/luobobo896/HSSH/pkg/types"
 	"github.com/gorilla/websocket"
-	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// defaultTerminalBufferSize 未配置 buffer_size 时读取终端输出的缓冲区大小
+	defaultTerminalBufferSize = 1024
+	// remoteSessionsTimeout 列出远端 tmux/screen 会话（含建立跳板链）的最长时间
+	remoteSessionsTimeout = 30 * time.Second
+	// terminalAuthTimeout 等待用户在 Web 终端中回答键盘交互认证（如 OTP）的最长时间
+	terminalAuthTimeout = 2 * time.Minute
+	// terminalLostGrace 会话结束后等待连接池报告链断开的时间
+	terminalLostGrace = time.Second
+	// terminalReconnectAttempts 链断开后为终端重连的最多次数
+	terminalReconnectAttempts = 5
 )
 
 // TerminalInput 终端输入消息
@@ -36,12 +55,13 @@ type TerminalSession struct {
 	mu         sync.Mutex
 }
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 允许所有来源，生产环境应该更严格
-	},
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
+// upgrader 只接受可信来源的 WebSocket 握手，防止跨站劫持终端
+func (s *Server) upgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{
+		CheckOrigin:     s.originAllowed,
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+	}
 }
 
 // handleTerminal 处理 WebSocket 终端连接
@@ -68,46 +88,118 @@ func (s *Server) handleTerminal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 终端设置：请求中的 preset（为空时使用服务器的默认预设），再应用服务器自己的设置
+	opts, err := s.config.ResolveTerminal(hop, r.URL.Query().Get("preset"))
+	if err != nil {
+		log.Printf("[TERMINAL] Error: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bufferSize := opts.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultTerminalBufferSize
+	}
+
+	// persist=tmux|screen 在远端会话中运行（session 为会话名，存在时连接，否则创建），关闭页面后会话保留
+	if persist := r.URL.Query().Get("persist"); persist != "" {
+		opts.Persist = persist
+	}
+	if err := opts.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	startCmd, err := terminal.StartCommand(opts, r.URL.Query().Get("session"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// max_duration 限时会话（如 1h）：到期前 5 分钟在终端中提示，到期后关闭
+	maxDuration, err := parseMaxDuration(r.URL.Query().Get("max_duration"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// 升级 HTTP 连接为 WebSocket
-	ws, err := upgrader.Upgrade(w, r, nil)
+	ws, err := s.upgrader().Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("[TERMINAL] Failed to upgrade WebSocket: %v", err)
 		return
 	}
 	defer ws.Close()
+	defer terminalWriteLocks.Delete(ws)
 
 	log.Printf("[TERMINAL] New terminal connection for server: %s (%s@%s:%d, type: %v)",
 		serverName, hop.User, hop.Host, hop.Port, hop.ServerType)
 
 	// 构建 hop 链
 	hops := s.buildHopChain(serverName)
+	// 探测学到的跳板链代替网关链，learned=false 时不沿用
+	if learnedParam(r.URL.Query().Get("learned")) {
+		if via := s.learnedVia(hop); via != nil {
+			viaHops, _ := s.probeVia(via)
+			hops = append(viaHops, hop)
+			log.Printf("[TERMINAL] Using learned via chain for %s: %v", serverName, getHopNames(hops))
+		}
+	}
 	if len(hops) == 0 {
 		s.sendTerminalError(ws, "Failed to build hop chain")
 		return
 	}
-
-	// 创建 SSH 链
-	chain := internalSSH.NewChain(hops)
-
-	// 连接 SSH 链
-	log.Printf("[TERMINAL] Connecting SSH chain with %d hop(s)...", len(hops))
-	if err := chain.Connect(); err != nil {
-		log.Printf("[TERMINAL] Failed to connect SSH chain: %v", err)
-		s.sendTerminalError(ws, fmt.Sprintf("SSH connection failed: %v", err))
+	if window, blocked := s.activeMaintenance(hops); window != nil {
+		log.Printf("[TERMINAL] Rejected: %s is under maintenance (window %s)", blocked.Name, window.ID)
+		s.sendTerminalError(ws, maintenanceMessage(requestLang(r), window, blocked))
+		return
+	}
+	event := &events.Event{
+		Type:   events.SessionOpened,
+		Server: hop.Name,
+		Target: hop.ID,
+		Data:   map[string]interface{}{"preset": r.URL.Query().Get("preset"), "persist": opts.Persist, "remote_addr": r.RemoteAddr},
+	}
+	if rejection := s.checkEvent(r, event); rejection != nil {
+		log.Printf("[TERMINAL] Rejected: %v", rejection)
+		s.sendTerminalError(ws, i18n.T(requestLang(r), "ERR_PLUGIN_REJECTED", rejection.Plugin, rejection.Reason))
 		return
 	}
-	defer chain.Disconnect()
+	if approvalHop := s.approvalHop(hops); approvalHop != nil {
+		approval := s.requestApproval(&Approval{
+			Kind:        approvalKindTerminal,
+			Server:      approvalHop.Name,
+			RequestedBy: currentUser(r).Name,
+			RequestID:   requestID(r),
+		})
+		// 客户端据此显示等待审批，批准后会话照常开始
+		if data, err := json.Marshal(s.approvalSnapshot(approval)); err == nil {
+			_ = s.sendTerminalMessage(ws, "approval", string(data))
+		}
+		if status := s.awaitApproval(r.Context(), approval); status != approvalApproved {
+			log.Printf("[TERMINAL] Rejected: approval %s %s", approval.ID, status)
+			_, message := approvalFailure(requestLang(r), approval, status)
+			s.sendTerminalError(ws, message)
+			return
+		}
+	}
 
-	log.Printf("[TERMINAL] SSH chain connected for %s", serverName)
+	// 会话拥有 SSH 链、会话和所有转发 goroutine，返回前统一拆除并等待它们退出
+	owner := lifecycle.New(r.Context())
+	defer owner.Close()
 
-	// 创建 SSH 会话
-	sshSession, err := chain.NewSession()
+	// 从连接池获取会话：同一目标已打开的终端所在的链上还能再开会话时共用它，
+	// 否则取预热的空闲链或新建；会话结束后链放回连接池
+	log.Printf("[TERMINAL] Acquiring SSH chain with %d hop(s)...", len(hops))
+	// 新建的链遇到键盘交互认证（跳板机的 OTP 等）时经 WebSocket 询问打开终端的用户
+	connectCtx := internalSSH.WithInteractivePrompt(context.WithoutCancel(r.Context()), s.terminalAuthPrompt(ws))
+	pooled, err := s.chainPool.NewSessionContext(connectCtx, hops)
 	if err != nil {
-		log.Printf("[TERMINAL] Failed to create SSH session: %v", err)
-		s.sendTerminalError(ws, fmt.Sprintf("Failed to create session: %v", err))
+		log.Printf("[TERMINAL] Failed to open SSH session: %v", err)
+		s.sendTerminalError(ws, fmt.Sprintf("SSH connection failed: %v", err))
 		return
 	}
-	defer sshSession.Close()
+	owner.OnClose(pooled.Close)
+	sshSession := pooled.GetSession()
+
+	log.Printf("[TERMINAL] SSH session opened for %s on connection %d", serverName, pooled.Client().ID())
 
 	// 必须先获取 Pipe，再启动 Shell
 	stdinPipe, err := sshSession.StdinPipe()
@@ -129,41 +221,86 @@ func (s *Server) handleTerminal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 请求伪终端
-	modes := ssh.TerminalModes{
-		ssh.ECHO:          1,     // 启用回显
-		ssh.TTY_OP_ISPEED: 14400, // 输入速度
-		ssh.TTY_OP_OSPEED: 14400, // 输出速度
+	// 策略允许时转发本机的 ssh-agent，远端使用它时写入审计日志；转发失败不影响终端
+	if s.config.AgentForwarding.Allows(hop) {
+		stop, err := pooled.Client().ForwardAgent(sshSession, currentUser(r).Name)
+		if err != nil {
+			log.Printf("[TERMINAL] Agent forwarding to %s unavailable: %v", serverName, err)
+			_ = s.sendTerminalMessage(ws, "output", fmt.Sprintf("\r\n\x1b[33m[gmssh] ssh-agent forwarding unavailable: %v\x1b[0m\r\n", err))
+		} else {
+			owner.OnClose(func() error {
+				stop()
+				return nil
+			})
+		}
 	}
 
+	// 请求伪终端
+	modes := terminal.PTYModes(opts.Modes)
+
 	// 获取终端大小（默认 80x24）
 	width := 80
 	height := 24
 
-	if err := sshSession.RequestPty("xterm-256color", height, width, modes); err != nil {
+	shellStart := time.Now()
+	// 只允许 exec 的受限服务器拒绝 PTY 或 shell，此时直接返回能力错误，不再重试
+	if err := internalSSH.RequestPTY(hop, sshSession, "xterm-256color", height, width, modes); err != nil {
 		log.Printf("[TERMINAL] Failed to request PTY: %v", err)
-		s.sendTerminalError(ws, fmt.Sprintf("Failed to request PTY: %v", err))
+		s.sendTerminalError(ws, terminalStartError("Failed to request PTY", err))
 		return
 	}
 
-	// 启动 shell（必须在获取 Pipe 之后）
-	if err := sshSession.Shell(); err != nil {
+	// 启动 shell（必须在获取 Pipe 之后），配置了 shell 或 persist 时执行对应命令代替登录 shell
+	if err := internalSSH.StartShell(hop, sshSession, startCmd); err != nil {
 		log.Printf("[TERMINAL] Failed to start shell: %v", err)
-		s.sendTerminalError(ws, fmt.Sprintf("Failed to start shell: %v", err))
+		s.sendTerminalError(ws, terminalStartError("Failed to start shell", err))
 		return
 	}
 
+	internalSSH.RecordLoginPhase(hop, internalSSH.PhaseShell, time.Since(shellStart))
 	log.Printf("[TERMINAL] Shell started for %s", serverName)
 
+	// 登记会话（按用户隔离），并告知客户端会话 ID
+	sessionID := s.registerTerminal(currentUser(r), serverName, pooled.Client(), func() { sshSession.Close() })
+	defer s.unregisterTerminal(sessionID)
+	traffic := s.trackTerminal(sessionID, r.RemoteAddr, func(message string) {
+		_ = s.sendTerminalMessage(ws, "output", message)
+	})
+	s.recordUsage(hops, usage.Counters{Sessions: 1})
+	defer func() {
+		if traffic != nil {
+			s.recordUsage(hops, usage.Counters{Bytes: traffic.bytesIn.Load() + traffic.bytesOut.Load()})
+		}
+	}()
+	s.touchRecent(currentUser(r), types.RecentTerminal, hop.ID, "", nil)
+	if maxDuration > 0 {
+		expiresAt := s.startTicket(ownerKindSession, sessionID, maxDuration,
+			func(remaining time.Duration) {
+				_ = s.sendTerminalMessage(ws, "output", fmt.Sprintf("\r\n\x1b[33m[gmssh] This session ends in %v (maximum duration %v).\x1b[0m\r\n", remaining, maxDuration))
+			},
+			func() {
+				_ = s.sendTerminalMessage(ws, "output", "\r\n\x1b[31m[gmssh] Maximum session duration reached, closing.\x1b[0m\r\n")
+				sshSession.Close()
+			})
+		defer s.stopTicket(ownerKindSession, sessionID)
+		s.terminalsMu.Lock()
+		if entry := s.terminals[sessionID]; entry != nil {
+			entry.info.ExpiresAt = expiresAt
+		}
+		s.terminalsMu.Unlock()
+	}
+
 	// 发送连接成功消息
 	s.sendTerminalMessage(ws, "status", "connected")
+	s.sendTerminalMessage(ws, "session", sessionID)
 
-	// 创建 done 通道和 context 用于协调关闭
+	// 创建 done 通道用于协调关闭
 	done := make(chan struct{})
 	wsClosed := make(chan struct{})
 
 	// 启动 goroutine 读取 WebSocket 消息并写入 SSH stdin
-	go func() {
+	// 阻塞中的 ReadMessage 在下方关闭 WebSocket 时返回
+	owner.Go(func(context.Context) {
 		defer close(wsClosed)
 		for {
 			_, message, err := ws.ReadMessage()
@@ -188,6 +325,7 @@ func (s *Server) handleTerminal(w http.ResponseWriter, r *http.Request) {
 					log.Printf("[TERMINAL] Failed to write to stdin: %v", err)
 					return
 				}
+				traffic.recordInput(len(input.Data))
 			case "resize":
 				// 处理终端大小调整
 				var resizeData struct {
@@ -199,11 +337,11 @@ func (s *Server) handleTerminal(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 		}
-	}()
+	})
 
-	// 启动 goroutine 读取 SSH stdout 并写入 WebSocket
-	go func() {
-		buf := make([]byte, 1024)
+	// 启动 goroutine 读取 SSH stdout 并写入 WebSocket（会话关闭时读取返回）
+	owner.Go(func(context.Context) {
+		buf := make([]byte, bufferSize)
 		for {
 			n, err := stdoutPipe.Read(buf)
 			if err != nil {
@@ -211,17 +349,18 @@ func (s *Server) handleTerminal(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			if n > 0 {
+				traffic.recordOutput(n)
 				if err := s.sendTerminalMessage(ws, "output", string(buf[:n])); err != nil {
 					log.Printf("[TERMINAL] Failed to send stdout: %v", err)
 					return
 				}
 			}
 		}
-	}()
+	})
 
 	// 启动 goroutine 读取 SSH stderr 并写入 WebSocket
-	go func() {
-		buf := make([]byte, 1024)
+	owner.Go(func(context.Context) {
+		buf := make([]byte, bufferSize)
 		for {
 			n, err := stderrPipe.Read(buf)
 			if err != nil {
@@ -229,83 +368,166 @@ func (s *Server) handleTerminal(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			if n > 0 {
+				traffic.recordOutput(n)
 				if err := s.sendTerminalMessage(ws, "output", string(buf[:n])); err != nil {
 					log.Printf("[TERMINAL] Failed to send stderr: %v", err)
 					return
 				}
 			}
 		}
-	}()
+	})
 
 	// 启动 goroutine 等待 SSH 会话结束
-	go func() {
+	owner.Go(func(context.Context) {
 		if err := sshSession.Wait(); err != nil {
 			log.Printf("[TERMINAL] Session ended with error: %v", err)
 		}
 		close(done)
-	}()
+	})
 
 	// 等待 WebSocket 关闭或 SSH 会话结束
 	select {
 	case <-wsClosed:
 		log.Printf("[TERMINAL] WebSocket closed, terminating SSH session for %s", serverName)
-		// WebSocket 关闭时，关闭 SSH 会话
-		sshSession.Close()
-		// 断开连接链
-		chain.Disconnect()
 	case <-done:
 		log.Printf("[TERMINAL] SSH session ended for %s", serverName)
+		// 会话因为链上某一跳断开而结束时重连链路，成功后客户端用同样的参数重新打开终端，
+		// persist 会话随之重新挂接；经用户二次验证（OTP 等）的链不能预热给别人，直接断开，由用户重新打开并验证
+		if s.chainLostUnder(pooled) && !pooled.Client().Prompted() {
+			pooled.Close()
+			if s.restoreTerminalChain(connectCtx, ws, wsClosed, hops) {
+				s.sendTerminalMessage(ws, "status", "reconnected")
+				break
+			}
+		}
+		// 尝试发送断开消息（WebSocket 还打开）
+		s.sendTerminalMessage(ws, "status", "disconnected")
 	}
 
-	// 尝试发送断开消息（如果 WebSocket 还打开）
-	s.sendTerminalMessage(ws, "status", "disconnected")
+	// 关闭 WebSocket 唤醒输入 goroutine，再拆除会话和链并等待所有 goroutine 退出
+	ws.Close()
+	owner.Close()
 	log.Printf("[TERMINAL] Terminal session cleanup completed for %s", serverName)
 }
 
-// buildHopChain 构建服务器连接的 hop 链（递归处理网关的跳板机）
-func (s *Server) buildHopChain(serverName string) []*types.Hop {
-	return s.buildHopChainRecursive(serverName, make(map[string]bool))
+// chainLostUnder 会话结束是否因为所在的链断开；链断开和会话结束由不同的 goroutine 发现，稍等片刻
+func (s *Server) chainLostUnder(pooled *terminal.PooledSession) bool {
+	select {
+	case <-pooled.Client().Lost():
+		return true
+	case <-time.After(terminalLostGrace):
+		return false
+	}
 }
 
-// buildHopChainRecursive 递归构建 hop 链，检测循环依赖
-func (s *Server) buildHopChainRecursive(serverName string, visited map[string]bool) []*types.Hop {
-	// 检测循环依赖
-	if visited[serverName] {
-		log.Printf("[TERMINAL] buildHopChain: Circular dependency detected for %s", serverName)
-		return nil
+// restoreTerminalChain 按默认重连策略在连接池中重新建立 hops 的链，期间向客户端发送 reconnecting 状态；
+// WebSocket 关闭或超过 terminalReconnectAttempts 次仍失败时返回 false
+func (s *Server) restoreTerminalChain(ctx context.Context, ws *websocket.Conn, wsClosed <-chan struct{}, hops []*types.Hop) bool {
+	policy := internalSSH.DefaultReconnectPolicy()
+	for attempt := 1; attempt <= terminalReconnectAttempts; attempt++ {
+		delay := policy.Delay(attempt)
+		_ = s.sendTerminalMessage(ws, "status", "reconnecting")
+		_ = s.sendTerminalMessage(ws, "output", fmt.Sprintf("\r\n\x1b[33m[gmssh] Connection lost, reconnecting in %v (attempt %d/%d)...\x1b[0m\r\n", delay.Round(time.Second), attempt, terminalReconnectAttempts))
+		timer := time.NewTimer(delay)
+		select {
+		case <-wsClosed:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+
+		// 新链放入空闲列表，重新打开的终端直接取用
+		if _, err := s.chainPool.Warm(ctx, hops, 1); err != nil {
+			log.Printf("[TERMINAL] Reconnect attempt %d failed: %v", attempt, err)
+			continue
+		}
+		log.Printf("[TERMINAL] SSH chain restored after %d attempt(s)", attempt)
+		return true
 	}
+	return false
+}
 
+// buildHopChain 构建服务器连接的 hop 链（递归处理网关的跳板机）
+// 只有入口按名称查找，网关一律按 GatewayID 解析，服务器改名不影响链路
+func (s *Server) buildHopChain(serverName string) []*types.Hop {
 	hop := s.config.GetHopByName(serverName)
 	if hop == nil {
 		log.Printf("[TERMINAL] buildHopChain: Server %q not found", serverName)
 		return nil
 	}
+	return s.buildHopChainRecursive(hop, make(map[string]bool))
+}
+
+// handleTerminalPresets 返回可在打开终端时选择的预设（配置中的预设和内置预设）
+func (s *Server) handleTerminalPresets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.config.AllTerminalPresets())
+}
+
+// handleRemoteSessions 列出服务器上的 tmux/screen 会话，可在打开终端时用 persist 和 session 重新连接
+// (GET /api/servers/{id}/sessions)
+func (s *Server) handleRemoteSessions(w http.ResponseWriter, r *http.Request, hop *types.Hop) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	hops := s.buildHopChain(hop.Name)
+	if len(hops) == 0 {
+		localizedError(w, r, http.StatusInternalServerError, "ERR_BUILD_CHAIN", hop.Name)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), remoteSessionsTimeout)
+	defer cancel()
+
+	out, err := s.runOnChain(ctx, hops, terminal.ListSessionsCommand())
+	if err != nil {
+		failure(w, r, http.StatusBadGateway, "ERR_LIST_SESSIONS", err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, terminal.ParseRemoteSessions(string(out)))
+}
+
+// buildHopChainRecursive 递归构建 hop 链，检测循环依赖
+func (s *Server) buildHopChainRecursive(hop *types.Hop, visited map[string]bool) []*types.Hop {
+	// 检测循环依赖
+	if visited[hop.ID] {
+		log.Printf("[TERMINAL] buildHopChain: Circular dependency detected for %s", hop.Name)
+		return nil
+	}
 
-	log.Printf("[TERMINAL] buildHopChain: Server=%s, Host=%s, Type=%v, Gateway=%q",
-		serverName, hop.Host, hop.ServerType, hop.Gateway)
+	log.Printf("[TERMINAL] buildHopChain: Server=%s, Host=%s, Type=%v, GatewayID=%q",
+		hop.Name, hop.Host, hop.ServerType, hop.GatewayID)
 
 	var hops []*types.Hop
 
 	// 如果配置了网关/跳板机，递归添加网关链
 	// 现在支持所有服务器类型配置跳板机，不限于内网服务器
-	if hop.Gateway != "" {
-		visited[serverName] = true
+	if hop.GatewayID != "" {
+		visited[hop.ID] = true
 		// 递归获取网关的完整链路（网关可能也有自己的跳板机）
-		gatewayHops := s.buildHopChainRecursive(hop.Gateway, visited)
+		var gatewayHops []*types.Hop
+		if gateway := s.config.GetHopByID(hop.GatewayID); gateway != nil {
+			gatewayHops = s.buildHopChainRecursive(gateway, visited)
+		}
 		if len(gatewayHops) > 0 {
-			log.Printf("[TERMINAL] Adding gateway chain for %s: %v", serverName, getHopNames(gatewayHops))
+			log.Printf("[TERMINAL] Adding gateway chain for %s: %v", hop.Name, getHopNames(gatewayHops))
 			hops = append(hops, gatewayHops...)
 		} else {
-			log.Printf("[TERMINAL] Warning: Gateway %s not found or has circular dependency for server %s", hop.Gateway, serverName)
+			log.Printf("[TERMINAL] Warning: Gateway %s not found or has circular dependency for server %s", hop.GatewayID, hop.Name)
 		}
 	} else {
-		log.Printf("[TERMINAL] No gateway configured for server %s", serverName)
+		log.Printf("[TERMINAL] No gateway configured for server %s", hop.Name)
 	}
 
 	// 添加目标服务器
 	hops = append(hops, hop)
 
-	log.Printf("[TERMINAL] buildHopChain result for %s: %d hop(s): %v", serverName, len(hops), getHopNames(hops))
+	log.Printf("[TERMINAL] buildHopChain result for %s: %d hop(s): %v", hop.Name, len(hops), getHopNames(hops))
 	return hops
 }
 
@@ -318,6 +540,10 @@ func getHopNames(hops []*types.Hop) []string {
 	return names
 }
 
+// terminalWriteLocks 每个终端 WebSocket 的写锁：stdout、stderr 和到期提示由不同 goroutine 写入，
+// 而 WebSocket 同一时刻只允许一个写入者
+var terminalWriteLocks sync.Map // *websocket.Conn -> *sync.Mutex
+
 // sendTerminalMessage 发送终端消息
 func (s *Server) sendTerminalMessage(ws *websocket.Conn, msgType, data string) error {
 	msg := TerminalOutput{
@@ -325,14 +551,60 @@ func (s *Server) sendTerminalMessage(ws *websocket.Conn, msgType, data string) e
 		Data: data,
 	}
 
-	if err := ws.WriteJSON(msg); err != nil {
+	lock, _ := terminalWriteLocks.LoadOrStore(ws, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	err := ws.WriteJSON(msg)
+	lock.(*sync.Mutex).Unlock()
+	if err != nil {
 		log.Printf("[TERMINAL] Failed to send message: %v", err)
 		return err
 	}
 	return nil
 }
 
+// terminalAuthPrompt 经 WebSocket 回答键盘交互认证：发送 auth_prompt（data 为 JSON 的 ssh.Challenge），
+// 等待客户端回复 auth_response（data 为按顺序的答案组成的 JSON 字符串数组）或 auth_cancel。
+// 此时 shell 尚未启动，WebSocket 没有其他读取者
+func (s *Server) terminalAuthPrompt(ws *websocket.Conn) internalSSH.InteractivePrompt {
+	return func(hop *types.Hop, challenge internalSSH.Challenge) ([]string, error) {
+		data, err := json.Marshal(challenge)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.sendTerminalMessage(ws, "auth_prompt", string(data)); err != nil {
+			return nil, err
+		}
+		ws.SetReadDeadline(time.Now().Add(terminalAuthTimeout))
+		defer ws.SetReadDeadline(time.Time{})
+		for {
+			var input TerminalInput
+			if err := ws.ReadJSON(&input); err != nil {
+				return nil, fmt.Errorf("no answer from the browser: %w", err)
+			}
+			switch input.Type {
+			case "auth_response":
+				var answers []string
+				if err := json.Unmarshal([]byte(input.Data), &answers); err != nil {
+					return nil, fmt.Errorf("invalid auth_response: %w", err)
+				}
+				return answers, nil
+			case "auth_cancel":
+				return nil, fmt.Errorf("cancelled by the user")
+			}
+			// 认证完成前的输入和窗口大小调整没有去处，忽略
+		}
+	}
+}
+
 // sendTerminalError 发送终端错误消息
 func (s *Server) sendTerminalError(ws *websocket.Conn, err string) {
 	_ = s.sendTerminalMessage(ws, "error", err)
 }
+
+// terminalStartError 终端启动失败的提示；服务器只允许 exec 时说明原因，而不是笼统的失败
+func terminalStartError(action string, err error) string {
+	if internalSSH.IsCapabilityError(err) {
+		return fmt.Sprintf("Interactive terminal unavailable: %v. Commands, probes and file transfers still work on this server.", err)
+	}
+	return fmt.Sprintf("%s: %v", action, err)
+}
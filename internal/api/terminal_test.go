@@ -2,12 +2,16 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	internalSSH "github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/sshtest"
 	"github.com/luobobo896/HSSH/pkg/types"
 	"github.com/gorilla/websocket"
 )
@@ -163,6 +167,34 @@ func TestHandleTerminal_MissingServerParam(t *testing.T) {
 	}
 }
 
+func TestHandleTerminal_RejectsForeignOrigin(t *testing.T) {
+	server, err := NewServer()
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	server.config.Hops = append(server.config.Hops, &types.Hop{
+		Name: "test-external",
+		Host: "localhost",
+		Port: 2222,
+		User: "test",
+	})
+
+	ts := httptest.NewServer(http.HandlerFunc(server.handleTerminal))
+	defer ts.Close()
+
+	wsURL := strings.Replace(ts.URL, "http://", "ws://", 1) + "?server=test-external"
+
+	// Cross-site handshake must be refused before any SSH connection is made
+	header := http.Header{"Origin": []string{"https://evil.test"}}
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err == nil {
+		t.Fatal("Expected cross-origin handshake to fail")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %v", resp)
+	}
+}
+
 func TestBuildHopChain_ExternalServer(t *testing.T) {
 	server := &Server{
 		config: &types.Config{
@@ -193,6 +225,7 @@ func TestBuildHopChain_InternalServer(t *testing.T) {
 		config: &types.Config{
 			Hops: []*types.Hop{
 				{
+					ID:         "hop-gw",
 					Name:       "gateway",
 					Host:       "gateway.example.com",
 					Port:       22,
@@ -200,12 +233,13 @@ func TestBuildHopChain_InternalServer(t *testing.T) {
 					ServerType: types.ServerExternal,
 				},
 				{
+					ID:         "hop-internal",
 					Name:       "internal-server",
 					Host:       "192.168.1.100",
 					Port:       22,
 					User:       "root",
 					ServerType: types.ServerInternal,
-					Gateway:    "gateway",
+					GatewayID:  "hop-gw",
 				},
 			},
 		},
@@ -274,3 +308,174 @@ func TestTerminalMessageTypes(t *testing.T) {
 		t.Errorf("Expected data 'ls -la\\n', got '%s'", decoded.Data)
 	}
 }
+
+func TestServerTerminalSettings(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"unknown preset", `{"name": "db-1", "host": "10.0.0.2", "user": "root", "auth_type": "key", "terminal_preset": "missing"}`, http.StatusBadRequest, "ERR_UNKNOWN_TERMINAL_PRESET"},
+		{"invalid erase", `{"name": "db-1", "host": "10.0.0.2", "user": "root", "auth_type": "key", "terminal": {"modes": {"erase": "x"}}}`, http.StatusBadRequest, "ERR_INVALID_TERMINAL"},
+		{"preset and shell", `{"name": "db-1", "host": "10.0.0.2", "user": "root", "auth_type": "key", "terminal_preset": "log-tailing", "terminal": {"shell": "tmux"}}`, http.StatusCreated, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/servers", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer alice-token")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.code == "" {
+				return
+			}
+			var resp map[string]string
+			json.Unmarshal(rec.Body.Bytes(), &resp)
+			if resp["code"] != tt.code {
+				t.Errorf("code = %q, want %q", resp["code"], tt.code)
+			}
+		})
+	}
+
+	hop := server.config.GetHopByName("db-1")
+	if hop == nil || hop.TerminalPreset != "log-tailing" || hop.Terminal == nil || hop.Terminal.Shell != "tmux" {
+		t.Fatalf("terminal settings not stored: %+v", hop)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/terminal/presets", nil)
+	req.Header.Set("Authorization", "Bearer bob-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var presets []types.TerminalPreset
+	if err := json.Unmarshal(rec.Body.Bytes(), &presets); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(presets) != len(types.BuiltinTerminalPresets()) {
+		t.Errorf("expected the built-in presets, got %+v", presets)
+	}
+}
+
+func TestTerminalStartError(t *testing.T) {
+	denied := &internalSSH.CapabilityError{Hop: "bastion", Capability: internalSSH.CapabilityPTY, Err: errors.New("ssh: pty-req failed")}
+
+	tests := []struct {
+		name   string
+		err    error
+		prefix string
+	}{
+		{"pty denied", denied, "Interactive terminal unavailable: bastion does not allow pty requests"},
+		{"wrapped", fmt.Errorf("failed to request PTY: %w", denied), "Interactive terminal unavailable: failed to request PTY"},
+		{"other error", errors.New("EOF"), "Failed to request PTY: EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := terminalStartError("Failed to request PTY", tt.err); !strings.HasPrefix(got, tt.prefix) {
+				t.Errorf("got %q, want prefix %q", got, tt.prefix)
+			}
+		})
+	}
+}
+
+func TestHandleTerminal_KeyboardInteractive(t *testing.T) {
+	server, _ := newAuthTestServer(t)
+	defer server.chainPool.Close()
+	sshd := sshtest.NewServer(t, sshtest.Options{OTP: "123456"})
+	server.config.Hops = append(server.config.Hops, sshd.Hop("mfa-1"))
+
+	ts := httptest.NewServer(http.HandlerFunc(server.handleTerminal))
+	defer ts.Close()
+	ws, _, err := websocket.DefaultDialer.Dial(strings.Replace(ts.URL, "http://", "ws://", 1)+"?server=mfa-1", nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	// 登录密码之后服务器要求验证码，经 WebSocket 转给浏览器回答
+	var msg TerminalOutput
+	if err := ws.ReadJSON(&msg); err != nil || msg.Type != "auth_prompt" {
+		t.Fatalf("expected auth_prompt, got %+v, %v", msg, err)
+	}
+	var challenge internalSSH.Challenge
+	if err := json.Unmarshal([]byte(msg.Data), &challenge); err != nil || challenge.Hop != "mfa-1" ||
+		len(challenge.Questions) != 1 || challenge.Questions[0].Prompt != sshtest.OTPPrompt {
+		t.Fatalf("challenge = %+v, %v", challenge, err)
+	}
+	// 回答前的输入被忽略
+	ws.WriteJSON(TerminalInput{Type: "input", Data: "ls\n"})
+	if err := ws.WriteJSON(TerminalInput{Type: "auth_response", Data: `["123456"]`}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatalf("waiting for connected status: %v", err)
+		}
+		if msg.Type == "error" {
+			t.Fatalf("terminal error: %s", msg.Data)
+		}
+		if msg.Type == "status" && msg.Data == "connected" {
+			break
+		}
+	}
+}
+
+func TestHandleTerminal_KeyboardInteractivePerUser(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	defer server.chainPool.Close()
+	sshd := sshtest.NewServer(t, sshtest.Options{OTP: "123456"})
+	server.config.Hops = append(server.config.Hops, sshd.Hop("mfa-1"))
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	open := func(token string) *websocket.Conn {
+		t.Helper()
+		ws, _, err := websocket.DefaultDialer.Dial(strings.Replace(ts.URL, "http://", "ws://", 1)+"/api/terminal?server=mfa-1&token="+token, nil)
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+		// 每个用户打开终端时都要自己回答验证码
+		var msg TerminalOutput
+		if err := ws.ReadJSON(&msg); err != nil || msg.Type != "auth_prompt" {
+			t.Fatalf("expected auth_prompt for %s, got %+v, %v", token, msg, err)
+		}
+		if err := ws.WriteJSON(TerminalInput{Type: "auth_response", Data: `["123456"]`}); err != nil {
+			t.Fatal(err)
+		}
+		for {
+			if err := ws.ReadJSON(&msg); err != nil {
+				t.Fatalf("waiting for connected status: %v", err)
+			}
+			if msg.Type == "error" {
+				t.Fatalf("terminal error: %s", msg.Data)
+			}
+			if msg.Type == "status" && msg.Data == "connected" {
+				return ws
+			}
+		}
+	}
+
+	// alice 的链正在使用时 bob 不能共用它
+	alice := open("alice-token")
+	bob := open("bob-token")
+	bob.Close()
+
+	// alice 关闭终端后链也不会留在空闲列表里给 bob 复用
+	alice.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for server.chainPool.Snapshot().Total > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("verified chains still pooled: %+v", server.chainPool.Snapshot())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	open("bob-token").Close()
+}
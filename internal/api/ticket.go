@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+)
+
+// ticketWarning 限时会话到期前提示的提前量
+const ticketWarning = 5 * time.Minute
+
+// sessionTicket 限时终端会话或转发的到期计时
+type sessionTicket struct {
+	expiresAt time.Time
+	timers    []*time.Timer
+}
+
+// parseMaxDuration 解析 max_duration（如 "1h"），为空时返回 0（不限时）
+func parseMaxDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid max_duration %q", value)
+	}
+	return d, nil
+}
+
+// startTicket 为 kind/id 开始计时：到期前 ticketWarning 调用 warn（时长不超过提前量时不提示），
+// 到期时记录日志和审计事件 <kind>.expired 并调用 expire。返回到期时间
+func (s *Server) startTicket(kind, id string, maxDuration time.Duration, warn func(remaining time.Duration), expire func()) time.Time {
+	key := kind + ":" + id
+	ticket := &sessionTicket{expiresAt: time.Now().Add(maxDuration)}
+	if warn != nil && maxDuration > ticketWarning {
+		ticket.timers = append(ticket.timers, time.AfterFunc(maxDuration-ticketWarning, func() { warn(ticketWarning) }))
+	}
+	ticket.timers = append(ticket.timers, time.AfterFunc(maxDuration, func() {
+		s.ticketsMu.Lock()
+		_, active := s.tickets[key]
+		delete(s.tickets, key)
+		s.ticketsMu.Unlock()
+		if !active {
+			return
+		}
+		user := s.owners.owner(kind, id)
+		log.Printf("[Ticket] %s %s of %s reached its maximum duration %v, terminating", kind, id, user, maxDuration)
+		s.recordAudit(audit.Event{User: user, Action: kind + ".expired", Target: id})
+		expire()
+	}))
+
+	s.ticketsMu.Lock()
+	s.tickets[key] = ticket
+	s.ticketsMu.Unlock()
+	return ticket.expiresAt
+}
+
+// stopTicket 会话或转发提前结束时停止计时
+func (s *Server) stopTicket(kind, id string) {
+	key := kind + ":" + id
+	s.ticketsMu.Lock()
+	ticket := s.tickets[key]
+	delete(s.tickets, key)
+	s.ticketsMu.Unlock()
+	if ticket == nil {
+		return
+	}
+	for _, timer := range ticket.timers {
+		timer.Stop()
+	}
+}
+
+// ticketExpiry 返回 kind/id 的到期时间，不限时为零值
+func (s *Server) ticketExpiry(kind, id string) time.Time {
+	s.ticketsMu.Lock()
+	defer s.ticketsMu.Unlock()
+	if ticket := s.tickets[kind+":"+id]; ticket != nil {
+		return ticket.expiresAt
+	}
+	return time.Time{}
+}
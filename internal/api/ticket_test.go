@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionTickets(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+
+	for value, want := range map[string]time.Duration{"": 0, "1h": time.Hour, "90s": 90 * time.Second} {
+		if got, err := parseMaxDuration(value); err != nil || got != want {
+			t.Errorf("parseMaxDuration(%q) = %v, %v", value, got, err)
+		}
+	}
+	for _, value := range []string{"1", "-1h", "0s", "soon"} {
+		if _, err := parseMaxDuration(value); err == nil {
+			t.Errorf("parseMaxDuration(%q) accepted", value)
+		}
+	}
+
+	expired := make(chan string, 2)
+	server.owners.set(ownerKindSession, "s-1", server.lookupUser("bob-token"))
+	expiresAt := server.startTicket(ownerKindSession, "s-1", 50*time.Millisecond, nil, func() { expired <- "s-1" })
+	if got := server.ticketExpiry(ownerKindSession, "s-1"); !got.Equal(expiresAt) || got.IsZero() {
+		t.Errorf("ticketExpiry = %v, want %v", got, expiresAt)
+	}
+	server.startTicket(ownerKindSession, "s-2", 50*time.Millisecond, nil, func() { expired <- "s-2" })
+	server.stopTicket(ownerKindSession, "s-2")
+
+	select {
+	case id := <-expired:
+		if id != "s-1" {
+			t.Errorf("expired %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ticket did not expire")
+	}
+	select {
+	case id := <-expired:
+		t.Errorf("stopped ticket %s expired", id)
+	case <-time.After(150 * time.Millisecond):
+	}
+	if got := server.ticketExpiry(ownerKindSession, "s-1"); !got.IsZero() {
+		t.Errorf("expired ticket still listed until %v", got)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/proxy", strings.NewReader(`{"remote_host": "10.0.0.1", "remote_port": 80, "max_duration": "forever"}`))
+	req.Header.Set("Authorization", "Bearer bob-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "ERR_INVALID_MAX_DURATION") {
+		t.Errorf("invalid max_duration: expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSlowRequest 未配置 web.slow_request 时的慢请求阈值
+	DefaultSlowRequest = time.Second
+	// timingSamples 每个端点保留最近多少次请求的耗时用于计算分位数
+	timingSamples = 1024
+	// maxTimingEndpoints 统计的端点数上限，超出后的新端点计入 otherEndpoint
+	maxTimingEndpoints = 256
+	// otherEndpoint 未注册的路径和超出上限的端点
+	otherEndpoint = "other"
+)
+
+// EndpointTiming 一个端点（方法 + 归一化路径）的请求统计，耗时单位毫秒，分位数基于最近 timingSamples 次请求
+type EndpointTiming struct {
+	Endpoint string         `json:"endpoint"`
+	Count    int64          `json:"count"`
+	Slow     int64          `json:"slow"`   // 超过慢请求阈值的次数
+	Status   map[string]int `json:"status"` // 按状态码类别（2xx、4xx...）计数
+	Bytes    int64          `json:"bytes"`  // 响应体总字节数
+	P50Ms    float64        `json:"p50_ms"`
+	P90Ms    float64        `json:"p90_ms"`
+	P99Ms    float64        `json:"p99_ms"`
+	MaxMs    float64        `json:"max_ms"`
+}
+
+// RequestMetrics GET /api/metrics 的响应
+type RequestMetrics struct {
+	SlowThresholdMs float64          `json:"slow_threshold_ms"` // 0 表示不记录慢请求
+	Since           time.Time        `json:"since"`
+	Endpoints       []EndpointTiming `json:"endpoints"` // 按 p99 从慢到快
+}
+
+// endpointRecord 一个端点的累计值，samples 为环形缓冲
+type endpointRecord struct {
+	count, slow, bytes int64
+	status             map[string]int
+	max                time.Duration
+	samples            []time.Duration
+	next               int
+}
+
+// requestTimings 进程内各 API 端点的耗时统计
+type requestTimings struct {
+	mu        sync.Mutex
+	since     time.Time
+	endpoints map[string]*endpointRecord
+}
+
+func newRequestTimings() *requestTimings {
+	return &requestTimings{since: time.Now(), endpoints: make(map[string]*endpointRecord)}
+}
+
+// record 计入一次请求
+func (t *requestTimings) record(endpoint string, status int, bytes int64, d time.Duration, slow bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rec, ok := t.endpoints[endpoint]
+	if !ok {
+		if len(t.endpoints) >= maxTimingEndpoints {
+			endpoint = otherEndpoint
+		}
+		if rec, ok = t.endpoints[endpoint]; !ok {
+			rec = &endpointRecord{status: make(map[string]int)}
+			t.endpoints[endpoint] = rec
+		}
+	}
+	rec.count++
+	rec.bytes += bytes
+	rec.status[statusClass(status)]++
+	rec.max = max(rec.max, d)
+	if slow {
+		rec.slow++
+	}
+	if len(rec.samples) < timingSamples {
+		rec.samples = append(rec.samples, d)
+	} else {
+		rec.samples[rec.next] = d
+		rec.next = (rec.next + 1) % timingSamples
+	}
+}
+
+// snapshot 返回各端点的统计，最慢的在前
+func (t *requestTimings) snapshot() []EndpointTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]EndpointTiming, 0, len(t.endpoints))
+	for endpoint, rec := range t.endpoints {
+		sorted := slices.Clone(rec.samples)
+		slices.Sort(sorted)
+		out = append(out, EndpointTiming{
+			Endpoint: endpoint,
+			Count:    rec.count,
+			Slow:     rec.slow,
+			Status:   maps.Clone(rec.status),
+			Bytes:    rec.bytes,
+			P50Ms:    ms(percentile(sorted, 50)),
+			P90Ms:    ms(percentile(sorted, 90)),
+			P99Ms:    ms(percentile(sorted, 99)),
+			MaxMs:    ms(rec.max),
+		})
+	}
+	slices.SortFunc(out, func(a, b EndpointTiming) int {
+		if a.P99Ms != b.P99Ms {
+			if a.P99Ms > b.P99Ms {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Endpoint, b.Endpoint)
+	})
+	return out
+}
+
+// percentile 返回已排序样本的第 p 百分位（最近秩法）
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i, 1)-1]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// statusClass 返回状态码的类别，如 404 -> 4xx
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "other"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// endpointName 返回请求在统计中的端点：方法加上注册的路由，以 / 结尾的路由后面的 ID 段替换为 {id}，
+// 之后的段为小写单词时保留（如 /api/servers/{id}/browse），否则同样替换
+func endpointName(mux *http.ServeMux, r *http.Request) string {
+	_, pattern := mux.Handler(r)
+	if pattern == "" || pattern == "/" {
+		return otherEndpoint
+	}
+	if !strings.HasSuffix(pattern, "/") || len(r.URL.Path) <= len(pattern) || !strings.HasPrefix(r.URL.Path, pattern) {
+		return r.Method + " " + pattern
+	}
+	segments := strings.Split(strings.Trim(r.URL.Path[len(pattern):], "/"), "/")
+	if remotePathRoutes[pattern] && len(segments) > 1 {
+		segments = []string{"{id}", "{path}"}
+	}
+	for i, seg := range segments {
+		if i == 0 || seg != "{path}" && !routeWord(seg) {
+			segments[i] = "{id}"
+		}
+	}
+	return r.Method + " " + pattern + strings.Join(segments, "/")
+}
+
+// remotePathRoutes ID 之后是远端文件路径的路由，路径整体记为 {path}
+var remotePathRoutes = map[string]bool{"/api/browse/": true}
+
+// routeWord 路径段是否为路由中的固定单词而不是 ID
+func routeWord(seg string) bool {
+	if seg == "" {
+		return false
+	}
+	for _, c := range seg {
+		if (c < 'a' || c > 'z') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// timingRecorder 记录响应状态码和字节数，并透传 Flush 和 Hijack（WebSocket 升级）
+type timingRecorder struct {
+	http.ResponseWriter
+	status   int
+	bytes    int64
+	hijacked bool
+}
+
+func (r *timingRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *timingRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *timingRecorder) Flush() {
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+func (r *timingRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		r.hijacked = true
+	}
+	return conn, rw, err
+}
+
+func (r *timingRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// slowThreshold 返回慢请求阈值，web.slow_request 为负数时不记录慢请求（返回 0）
+func (s *Server) slowThreshold() time.Duration {
+	switch threshold := s.config.Web.SlowRequest; {
+	case threshold < 0:
+		return 0
+	case threshold == 0:
+		return DefaultSlowRequest
+	default:
+		return threshold
+	}
+}
+
+// timingMiddleware 记录每个 API 请求的耗时、状态码和响应大小，超过阈值的请求带请求 ID 记录日志。
+// WebSocket 和 SSE 等长连接不计入
+func (s *Server) timingMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.timings == nil || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &timingRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		elapsed := time.Since(start)
+		if rec.hijacked || strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") {
+			return
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		endpoint := endpointName(mux, r)
+		threshold := s.slowThreshold()
+		slow := threshold > 0 && elapsed >= threshold
+		s.timings.record(endpoint, rec.status, rec.bytes, elapsed, slow)
+		if slow {
+			requestLogger(requestID(r)).Printf("[SLOW] %s %s: %d, %d bytes in %s (endpoint %s, threshold %s)",
+				r.Method, r.URL.Path, rec.status, rec.bytes, elapsed.Round(time.Millisecond), endpoint, threshold)
+		}
+	})
+}
+
+// handleMetrics 返回各 API 端点的请求数、状态码、响应大小和耗时分位数 (GET /api/metrics)
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	metrics := RequestMetrics{SlowThresholdMs: ms(s.slowThreshold()), Endpoints: []EndpointTiming{}}
+	if s.timings != nil {
+		metrics.Since = s.timings.since
+		metrics.Endpoints = s.timings.snapshot()
+	}
+	jsonResponse(w, http.StatusOK, metrics)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestEndpointName(t *testing.T) {
+	mux := http.NewServeMux()
+	for _, pattern := range []string{"/api/servers", "/api/servers/", "/api/servers/healthcheck", "/api/upload/", "/api/browse/"} {
+		mux.HandleFunc(pattern, func(http.ResponseWriter, *http.Request) {})
+	}
+	tests := map[string]string{
+		"GET /api/servers":                       "GET /api/servers",
+		"GET /api/servers/healthcheck":           "GET /api/servers/healthcheck",
+		"GET /api/servers/hop-1/browse":          "GET /api/servers/{id}/browse",
+		"GET /api/servers/web/processes/42/kill": "GET /api/servers/{id}/processes/{id}/kill",
+		"GET /api/browse/web/etc/nginx":          "GET /api/browse/{id}/{path}",
+		"GET /api/browse/web":                    "GET /api/browse/{id}",
+		"PATCH /api/upload/4f9a0c":               "PATCH /api/upload/{id}",
+		"GET /api/servers/":                      "GET /api/servers/",
+		"GET /api/unknown":                       otherEndpoint,
+	}
+	for request, want := range tests {
+		method, path, _ := strings.Cut(request, " ")
+		if got := endpointName(mux, httptest.NewRequest(method, path, nil)); got != want {
+			t.Errorf("endpointName(%s) = %q, want %q", request, got, want)
+		}
+	}
+}
+
+func TestTimingMiddleware(t *testing.T) {
+	s := &Server{config: &types.Config{Web: types.WebConfig{SlowRequest: 20 * time.Millisecond}}, timings: newRequestTimings()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/servers/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/browse") {
+			time.Sleep(30 * time.Millisecond)
+		}
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/api/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/api/metrics", s.handleMetrics)
+	handler := requestIDMiddleware(s.timingMiddleware(mux, mux))
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	for _, path := range []string{"/api/servers/a", "/api/servers/b", "/api/servers/a/browse", "/api/missing"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(requestIDHeader, "slow-1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// 只有超过阈值的请求带请求 ID 记录
+	if got := logs.String(); strings.Count(got, "[SLOW]") != 1 || !strings.Contains(got, "[req slow-1]") || !strings.Contains(got, "/api/servers/a/browse") {
+		t.Errorf("slow log = %q", got)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/metrics", nil))
+	var metrics RequestMetrics
+	if err := json.Unmarshal(rec.Body.Bytes(), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.SlowThresholdMs != 20 || len(metrics.Endpoints) != 3 {
+		t.Fatalf("metrics = %+v", metrics)
+	}
+	browse := metrics.Endpoints[0]
+	if browse.Endpoint != "GET /api/servers/{id}/browse" || browse.Slow != 1 || browse.P99Ms < 30 || browse.MaxMs != browse.P99Ms {
+		t.Errorf("slowest = %+v", browse)
+	}
+	for _, e := range metrics.Endpoints {
+		switch e.Endpoint {
+		case "GET /api/servers/{id}":
+			if e.Count != 2 || e.Bytes != 10 || e.Status["2xx"] != 2 || e.Slow != 0 {
+				t.Errorf("detail = %+v", e)
+			}
+		case "GET /api/missing":
+			if e.Status["4xx"] != 1 {
+				t.Errorf("missing = %+v", e)
+			}
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var samples []time.Duration
+	for i := 1; i <= 200; i++ {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[int]time.Duration{50: 100 * time.Millisecond, 90: 180 * time.Millisecond, 99: 198 * time.Millisecond, 100: 200 * time.Millisecond} {
+		if got := percentile(samples, p); got != want {
+			t.Errorf("p%d = %s, want %s", p, got, want)
+		}
+	}
+	if percentile(nil, 50) != 0 || percentile(samples[:1], 1) != time.Millisecond {
+		t.Error("percentile of short samples")
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/internal/i18n"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// TrashItem 回收站条目
+type TrashItem struct {
+	Hop       *types.Hop `json:"hop"`
+	DeletedAt time.Time  `json:"deleted_at"`
+	ExpiresAt time.Time  `json:"expires_at"` // 超过此时间自动永久删除
+}
+
+// deleteHopResponse 删除服务器失败时的响应，dependents 列出仍引用它的配置
+type deleteHopResponse struct {
+	Error      string   `json:"error"`
+	Code       string   `json:"code"`
+	Dependents []string `json:"dependents,omitempty"`
+}
+
+// deleteHop 把服务器移入回收站；仍被引用时返回 409 并列出引用方
+func (s *Server) deleteHop(w http.ResponseWriter, r *http.Request, id string) {
+	if err := s.manager.DeleteHop(id); err != nil {
+		var dependents *config.DependentsError
+		if errors.As(err, &dependents) {
+			lang := requestLang(r)
+			jsonResponse(w, http.StatusConflict, deleteHopResponse{
+				Error:      i18n.T(lang, "ERR_HOP_HAS_DEPENDENTS", dependents.Hop, strings.Join(dependents.Dependents, ", ")),
+				Code:       "ERR_HOP_HAS_DEPENDENTS",
+				Dependents: dependents.Dependents,
+			})
+			return
+		}
+		failure(w, r, http.StatusInternalServerError, ErrInternal, err)
+		return
+	}
+	jsonResponse(w, http.StatusNoContent, nil)
+}
+
+// handleTrash 列出回收站中的服务器
+func (s *Server) handleTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	retention := s.manager.TrashRetention()
+	items := make([]TrashItem, 0)
+	for _, trashed := range s.manager.Trash() {
+		hop := *trashed.Hop
+		hop.Password = ""
+		hop.KeyPassphrase = ""
+		items = append(items, TrashItem{
+			Hop:       &hop,
+			DeletedAt: trashed.DeletedAt,
+			ExpiresAt: trashed.DeletedAt.Add(retention),
+		})
+	}
+	jsonResponse(w, http.StatusOK, items)
+}
+
+// handleTrashDetail 恢复（POST /api/trash/{id}/restore）或永久删除（DELETE /api/trash/{id}）
+func (s *Server) handleTrashDetail(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/trash/")
+	id, action, _ := strings.Cut(path, "/")
+	if id == "" {
+		localizedError(w, r, http.StatusNotFound, "ERR_TRASH_NOT_FOUND")
+		return
+	}
+
+	switch {
+	case action == "restore" && r.Method == http.MethodPost:
+		if !requireAdmin(w, r) {
+			return
+		}
+		hop, err := s.manager.RestoreHop(id)
+		if err != nil {
+			// 不在回收站中为 404，同 ID 的服务器已存在为 409
+			failure(w, r, http.StatusInternalServerError, ErrInternal, err)
+			return
+		}
+		restored := *hop
+		restored.Password = ""
+		restored.KeyPassphrase = ""
+		jsonResponse(w, http.StatusOK, &restored)
+	case action == "" && r.Method == http.MethodDelete:
+		if !requireAdmin(w, r) {
+			return
+		}
+		if err := s.manager.PurgeHop(id); err != nil {
+			failure(w, r, http.StatusNotFound, "ERR_TRASH_NOT_FOUND", err)
+			return
+		}
+		jsonResponse(w, http.StatusNoContent, nil)
+	case action == "" || action == "restore":
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	default:
+		localizedError(w, r, http.StatusNotFound, "ERR_NOT_FOUND")
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestDeleteReferencedServerConflict(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	if err := server.manager.AddProfile(&types.Profile{ID: "profile-1", Name: "deploy", PathIDs: []string{"hop-1"}}); err != nil {
+		t.Fatalf("failed to add profile: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/servers/hop-1", nil)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var body deleteHopResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(body.Dependents) != 1 || body.Dependents[0] != "profile 'deploy'" {
+		t.Errorf("unexpected dependents: %q", body.Dependents)
+	}
+}
+
+func TestTrashRestoreAndPurge(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	if err := server.manager.AddHop(&types.Hop{ID: "hop-2", Name: "web-2", Host: "10.0.0.2", Port: 22, User: "root", Password: "pw"}); err != nil {
+		t.Fatalf("failed to add hop: %v", err)
+	}
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{"delete hop-1", http.MethodDelete, "/api/servers/hop-1", "alice-token", http.StatusNoContent},
+		{"delete hop-2", http.MethodDelete, "/api/servers/hop-2", "alice-token", http.StatusNoContent},
+		{"user can list trash", http.MethodGet, "/api/trash", "bob-token", http.StatusOK},
+		{"user cannot restore", http.MethodPost, "/api/trash/hop-1/restore", "bob-token", http.StatusForbidden},
+		{"user cannot purge", http.MethodDelete, "/api/trash/hop-1", "bob-token", http.StatusForbidden},
+		{"restore needs POST", http.MethodGet, "/api/trash/hop-1/restore", "alice-token", http.StatusMethodNotAllowed},
+		{"admin restores", http.MethodPost, "/api/trash/hop-1/restore", "alice-token", http.StatusOK},
+		{"restore twice", http.MethodPost, "/api/trash/hop-1/restore", "alice-token", http.StatusNotFound},
+		{"admin purges", http.MethodDelete, "/api/trash/hop-2", "alice-token", http.StatusNoContent},
+		{"purge twice", http.MethodDelete, "/api/trash/hop-2", "alice-token", http.StatusNotFound},
+	}
+	for _, step := range steps {
+		if rec := do(step.method, step.path, step.token); rec.Code != step.wantStatus {
+			t.Fatalf("%s: expected %d, got %d: %s", step.name, step.wantStatus, rec.Code, rec.Body.String())
+		}
+	}
+
+	if server.manager.Get().GetHopByID("hop-1") == nil {
+		t.Error("hop-1 was not restored")
+	}
+	if server.manager.Get().GetHopByID("hop-2") != nil {
+		t.Error("purged hop-2 came back")
+	}
+	var trash []TrashItem
+	if err := json.Unmarshal(do(http.MethodGet, "/api/trash", "alice-token").Body.Bytes(), &trash); err != nil {
+		t.Fatalf("invalid trash response: %v", err)
+	}
+	if len(trash) != 0 {
+		t.Errorf("expected empty trash, got %+v", trash)
+	}
+}
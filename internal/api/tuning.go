@@ -0,0 +1,35 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// adaptiveUpload 上传请求的 adaptive 字段（true/false）；为空或无法解析时按 upload.adaptive，
+// learned 且目标已学到传输参数时也启用
+func (s *Server) adaptiveUpload(field, targetHost string, learned bool) bool {
+	if adaptive, err := strconv.ParseBool(field); err == nil {
+		return adaptive
+	}
+	if s.config.Upload.Adaptive {
+		return true
+	}
+	return learned && s.learnedTuning(s.probeTarget(targetHost)) != nil
+}
+
+// learnedTuning 返回目标 playbook 中的传输参数，没有时返回 nil（重新测量）
+func (s *Server) learnedTuning(hop *types.Hop) *types.TransferTuning {
+	if playbook := s.playbookFor(hop); playbook != nil {
+		return playbook.Tuning
+	}
+	return nil
+}
+
+// rememberTuning 把测量得到的参数记入目标 playbook，供后续上传沿用；沿用的参数不再记录
+func (s *Server) rememberTuning(hop *types.Hop, tuning *types.TransferTuning) {
+	if tuning.Reused || hop.ID == "" {
+		return
+	}
+	s.updatePlaybook(func() { s.config.LearnTuning(hop, tuning) })
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// UnlockKeyRequest 提供服务器加密私钥的口令
+type UnlockKeyRequest struct {
+	Passphrase string `json:"passphrase"`
+	// Save 同时把口令保存到服务器配置（加密的本地凭据，仅管理员）；否则只保留在 gmssh web 进程内存中，重启后需要重新解锁
+	Save bool `json:"save,omitempty"`
+}
+
+// handleUnlockKey 解锁服务器使用的加密私钥 (POST /api/servers/{id}/unlock)。
+// 连接返回 ERR_CHAIN_KEY_PASSPHRASE:<hop> 时界面询问口令后调用；口令放在请求体中，不出现在 URL、日志和审计记录里。
+// 解锁后使用同一私钥文件的服务器都不再需要口令
+func (s *Server) handleUnlockKey(w http.ResponseWriter, r *http.Request, hop *types.Hop) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req UnlockKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_BODY", err)
+		return
+	}
+	if req.Save && !requireAdmin(w, r) {
+		return
+	}
+
+	err := ssh.UnlockKey(hop, req.Passphrase)
+	event := audit.Event{
+		RequestID: requestID(r),
+		User:      currentUser(r).Name,
+		Action:    "server.key_unlocked",
+		Target:    hop.Name,
+	}
+	if err != nil {
+		// 记录失败的尝试，便于发现猜测口令
+		event.Error = err.Error()
+		s.recordAudit(event)
+	}
+	switch {
+	case errors.Is(err, ssh.ErrKeyNotEncrypted):
+		localizedError(w, r, http.StatusConflict, "ERR_KEY_NOT_ENCRYPTED", hop.Name)
+		return
+	case errors.Is(err, ssh.ErrKeyPassphraseWrong), errors.Is(err, ssh.ErrKeyPassphraseRequired):
+		localizedError(w, r, http.StatusBadRequest, "ERR_KEY_PASSPHRASE_WRONG", hop.Name)
+		return
+	case err != nil:
+		localizedError(w, r, http.StatusBadRequest, "ERR_PRIVATE_KEY_READ", err)
+		return
+	}
+
+	if req.Save {
+		updated := *hop
+		updated.KeyPassphrase = req.Passphrase
+		if err := s.manager.UpdateHop(hop.ID, &updated); err != nil {
+			failure(w, r, http.StatusInternalServerError, "ERR_SAVE_CONFIG", err)
+			return
+		}
+		event.Detail = "saved"
+	}
+	s.recordAudit(event)
+	jsonResponse(w, http.StatusNoContent, nil)
+}
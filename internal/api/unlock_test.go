@@ -0,0 +1,96 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/pkg/types"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestUnlockKey(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	ssh.LockKeys()
+	t.Cleanup(ssh.LockKeys)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := gossh.MarshalPrivateKeyWithPassphrase(key, "", []byte("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.manager.AddHop(&types.Hop{ID: "hop-2", Name: "db-1", Host: "10.0.0.2", Port: 22, User: "root", AuthType: types.AuthKey, KeyPath: keyPath}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.manager.AddHop(&types.Hop{ID: "hop-3", Name: "pw-1", Host: "10.0.0.3", Port: 22, User: "root", AuthType: types.AuthPassword, Password: "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, token, target, body string
+		wantStatus                int
+		wantCode                  string
+	}{
+		{"wrong passphrase", "bob-token", "/api/servers/hop-2/unlock", `{"passphrase": "nope"}`, http.StatusBadRequest, "ERR_KEY_PASSPHRASE_WRONG"},
+		{"empty passphrase", "bob-token", "/api/servers/hop-2/unlock", `{}`, http.StatusBadRequest, "ERR_KEY_PASSPHRASE_WRONG"},
+		{"not encrypted", "bob-token", "/api/servers/hop-3/unlock", `{"passphrase": "x"}`, http.StatusConflict, "ERR_KEY_NOT_ENCRYPTED"},
+		{"save needs admin", "bob-token", "/api/servers/hop-2/unlock", `{"passphrase": "s3cret", "save": true}`, http.StatusForbidden, ""},
+		{"user unlocks", "bob-token", "/api/servers/hop-2/unlock", `{"passphrase": "s3cret"}`, http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.wantCode) {
+			t.Errorf("%s: got %d %s, want %d %s", tt.name, rec.Code, rec.Body.String(), tt.wantStatus, tt.wantCode)
+		}
+	}
+	if hop := server.config.GetHopByID("hop-2"); hop.KeyPassphrase != "" {
+		t.Errorf("unlock without save stored the passphrase")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/servers/hop-2/unlock", strings.NewReader(`{"passphrase": "s3cret", "save": true}`))
+	req.Header.Set("Authorization", "Bearer alice-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("admin save: got %d %s", rec.Code, rec.Body.String())
+	}
+	if hop := server.config.GetHopByID("hop-2"); hop.KeyPassphrase != "s3cret" {
+		t.Errorf("saved passphrase = %q", hop.KeyPassphrase)
+	}
+
+	// 审计记录尝试，但不包含口令
+	data, err := os.ReadFile(filepath.Join(server.config.ConfigDir, audit.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(data), `"action":"server.key_unlocked"`); got != 5 {
+		t.Errorf("audit has %d unlock events, want 5:\n%s", got, data)
+	}
+	if strings.Contains(string(data), "s3cret") || strings.Contains(string(data), "nope") {
+		t.Errorf("audit log contains a passphrase:\n%s", data)
+	}
+
+	// 连接时缺少口令的错误带上服务器名，界面据此询问口令
+	hopErr := &ssh.HopError{Hop: "db-1", Kind: ssh.FailureKeyPassphrase, Err: ssh.ErrKeyPassphraseRequired}
+	if code := errorCode(hopErr, ErrInternal); code != "ERR_CHAIN_KEY_PASSPHRASE:db-1" {
+		t.Errorf("error code = %q", code)
+	}
+}
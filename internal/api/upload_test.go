@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/transfer"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestExecuteUploadFailureLeavesNoGoroutines(t *testing.T) {
+	server, _ := newAuthTestServer(t)
+
+	// 一个立即关闭连接的端口，SSH 握手必然失败
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+	if err := server.manager.AddHop(&types.Hop{ID: "hop-dead", Name: "dead", Host: "127.0.0.1", Port: port, User: "root", Password: "x"}); err != nil {
+		t.Fatalf("failed to add hop: %v", err)
+	}
+
+	base := runtime.NumGoroutine()
+	server.uploads["upload-1"] = &types.TransferProgress{TaskID: "upload-1", Status: "pending", Timestamp: time.Now()}
+	server.executeUpload("upload-1", t.TempDir(), "hop-dead", "/tmp/x", nil, transfer.ModeTunnel, false, false, true)
+
+	if got := server.uploads["upload-1"].Status; got != "failed" {
+		t.Fatalf("status = %q, want failed", got)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			t.Fatalf("executeUpload leaked goroutines: have %d, want <= %d", runtime.NumGoroutine(), base)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUploadDetailIncludesFiles(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	server.uploads["upload-dir"] = &types.TransferProgress{
+		TaskID: "upload-dir",
+		Status: "running",
+		Files: []types.FileProgress{
+			{Name: "project/a.txt", Size: 3, SentBytes: 3, Status: "completed"},
+			{Name: "project/b.txt", Size: 5, Status: "pending"},
+		},
+	}
+	server.owners.set(ownerKindUpload, "upload-dir", &types.WebUser{Name: "bob"})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{"owner reads task", http.MethodGet, "/api/uploads/upload-dir", "bob-token", http.StatusOK},
+		{"admin reads task", http.MethodGet, "/api/uploads/upload-dir", "alice-token", http.StatusOK},
+		{"other user sees nothing", http.MethodGet, "/api/uploads/upload-dir", "carol-token", http.StatusNotFound},
+		{"unknown task", http.MethodGet, "/api/uploads/nope", "bob-token", http.StatusNotFound},
+		{"read only", http.MethodDelete, "/api/uploads/upload-dir", "bob-token", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var got types.TransferProgress
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Files) != 2 || got.Files[1].Name != "project/b.txt" || got.Files[0].Status != "completed" {
+				t.Errorf("unexpected files: %+v", got.Files)
+			}
+		})
+	}
+}
+
+func TestExecuteUploadPolicyViolation(t *testing.T) {
+	server, _ := newAuthTestServer(t)
+	server.config.Upload.Policy = types.UploadPolicy{DeniedExtensions: []string{".exe"}}
+	// 目标不可达：策略必须在连接之前拒绝
+	if err := server.manager.AddHop(&types.Hop{ID: "hop-prod", Name: "prod", Host: "127.0.0.1", Port: 1, User: "root", Password: "x"}); err != nil {
+		t.Fatalf("failed to add hop: %v", err)
+	}
+
+	staged := t.TempDir()
+	if err := os.WriteFile(filepath.Join(staged, "setup.EXE"), []byte("MZ"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server.uploads["upload-1"] = &types.TransferProgress{TaskID: "upload-1", RequestID: "req-policy", Status: "pending", Timestamp: time.Now()}
+	server.owners.set(ownerKindUpload, "upload-1", &types.WebUser{Name: "bob"})
+	server.executeUpload("upload-1", staged, "hop-prod", "/opt/app", nil, transfer.ModeTunnel, false, false, true)
+
+	progress := server.uploads["upload-1"]
+	if progress.Status != "failed" || progress.ErrorCode != "ERR_UPLOAD_POLICY" {
+		t.Fatalf("status = %q, error_code = %q (%s), want failed/ERR_UPLOAD_POLICY", progress.Status, progress.ErrorCode, progress.Error)
+	}
+	data, err := os.ReadFile(filepath.Join(server.config.ConfigDir, audit.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"action":"policy.violation"`, `"user":"bob"`, `"request_id":"req-policy"`, "prod:/opt/app"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("audit log missing %s:\n%s", want, data)
+		}
+	}
+}
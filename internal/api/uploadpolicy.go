@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/i18n"
+	"github.com/luobobo896/HSSH/internal/transfer"
+	"github.com/luobobo896/HSSH/internal/uploadpolicy"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// checkUploadPolicy 按 upload.policy 检查暂存在 localPath 的上传，单文件上传检查暂存的文件本身。
+// 违反策略时把任务记为失败（ERR_UPLOAD_POLICY）、写入 policy.violation 审计事件并返回 false
+func (s *Server) checkUploadPolicy(ctx context.Context, logger *log.Logger, progress *types.TransferProgress, targetHop *types.Hop, localPath, targetPath string, isDir bool) bool {
+	policy := &s.config.Upload.Policy
+	if !policy.Enabled() {
+		return true
+	}
+	checked := localPath
+	if !isDir {
+		if file, err := stagedFile(localPath); err == nil {
+			checked = file
+		}
+	}
+	err := uploadpolicy.Check(ctx, policy, targetHop, checked, targetPath)
+	if err == nil {
+		return true
+	}
+
+	var violation *uploadpolicy.Violation
+	s.mu.Lock()
+	progress.Status = "failed"
+	if errors.As(err, &violation) {
+		progress.Error = i18n.T(i18n.Default(), "ERR_UPLOAD_POLICY", violation.Rule, violation.File, violation.Detail)
+		progress.ErrorCode = "ERR_UPLOAD_POLICY"
+	} else {
+		progress.Error = fmt.Sprintf("Upload policy check failed: %v", err)
+		progress.ErrorCode = "ERR_UPLOAD_FAILED"
+	}
+	s.mu.Unlock()
+	logger.Printf("[UPLOAD] ERROR: %v", err)
+
+	if violation != nil {
+		s.mu.RLock()
+		event := audit.Event{
+			RequestID: progress.RequestID,
+			User:      s.owners.owner(ownerKindUpload, progress.TaskID),
+			Action:    uploadpolicy.AuditAction,
+			Target:    progress.TaskID,
+			Error:     violation.Detail,
+			Detail:    fmt.Sprintf("%s %s -> %s:%s", violation.Rule, violation.File, targetHop.Name, transfer.ObjectTarget{URL: targetPath}.Redacted()),
+		}
+		s.mu.RUnlock()
+		s.recordAudit(event)
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/internal/usage"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// usageSampleInterval 统计隧道时长和流量并写入 usage.json 的间隔
+const usageSampleInterval = time.Minute
+
+// defaultUsageDays 未指定 days 时统计的天数
+const defaultUsageDays = 30
+
+// tunnelSample 上次统计时转发器的时间和累计字节数
+type tunnelSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// recordUsage 把一次使用计入链上的每一跳，未启用使用量统计时忽略
+func (s *Server) recordUsage(hops []*types.Hop, delta usage.Counters) {
+	if s.usage == nil {
+		return
+	}
+	ids := make([]string, 0, len(hops))
+	for _, hop := range hops {
+		ids = append(ids, hop.ID)
+	}
+	s.usage.Add(ids, delta, time.Now())
+}
+
+// sampleTunnels 把每个运行中的代理和 Portal 映射自上次统计以来的运行时长和流量计入其链路
+func (s *Server) sampleTunnels(now time.Time) {
+	if s.usage == nil {
+		return
+	}
+	forwarders := make([]*proxy.PortForwarder, 0)
+	for _, fwd := range s.proxies.List() {
+		forwarders = append(forwarders, fwd)
+	}
+	s.portalMu.RLock()
+	for _, fwd := range s.portalForwarders {
+		forwarders = append(forwarders, fwd)
+	}
+	s.portalMu.RUnlock()
+
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	seen := make(map[*proxy.PortForwarder]bool, len(forwarders))
+	for _, fwd := range forwarders {
+		if !fwd.IsActive() {
+			continue
+		}
+		seen[fwd] = true
+		last, ok := s.tunnelSamples[fwd]
+		if !ok {
+			last = tunnelSample{at: fwd.GetInfo("").StartedAt}
+			if last.at.IsZero() {
+				last.at = now
+			}
+		}
+		seconds := max(int64(now.Sub(last.at)/time.Second), 0)
+		bytes := fwd.Bytes()
+		s.recordUsage(fwd.Hops(), usage.Counters{Bytes: bytes - last.bytes, TunnelSeconds: seconds})
+		// 不足一秒的部分留到下次统计
+		s.tunnelSamples[fwd] = tunnelSample{at: last.at.Add(time.Duration(seconds) * time.Second), bytes: bytes}
+	}
+	for fwd := range s.tunnelSamples {
+		if !seen[fwd] {
+			delete(s.tunnelSamples, fwd)
+		}
+	}
+}
+
+// flushUsage 写入 usage.json
+func (s *Server) flushUsage() {
+	if s.usage == nil {
+		return
+	}
+	if err := s.usage.Flush(time.Now()); err != nil {
+		log.Printf("[Usage] Failed to save usage: %v", err)
+	}
+}
+
+// usageLoop 定期统计隧道并保存使用量
+func (s *Server) usageLoop(ctx context.Context) {
+	ticker := time.NewTicker(usageSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.sampleTunnels(now)
+			s.flushUsage()
+		}
+	}
+}
+
+// usageSince 解析 ?days=（默认 30，最多 usage.RetentionDays），返回统计起点
+func usageSince(r *http.Request) (time.Time, bool) {
+	days := defaultUsageDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > usage.RetentionDays {
+			return time.Time{}, false
+		}
+		days = n
+	}
+	return time.Now().AddDate(0, 0, 1-days), true
+}
+
+// handleServerUsage 服务器最近 days 天按天的使用量，计入经过它的所有会话、上传和隧道
+// (GET /api/servers/{id}/usage?days=30)
+func (s *Server) handleServerUsage(w http.ResponseWriter, r *http.Request, hop *types.Hop) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	since, ok := usageSince(r)
+	if !ok {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "days", r.URL.Query().Get("days"))
+		return
+	}
+	if s.usage == nil {
+		jsonResponse(w, http.StatusOK, usage.Report{ServerID: hop.ID, Since: since, Days: []usage.Day{}})
+		return
+	}
+	s.sampleTunnels(time.Now())
+	jsonResponse(w, http.StatusOK, s.usage.Report(hop.ID, since))
+}
+
+// handleUsage 各服务器最近 days 天的总使用量，按流量从大到小排序 (GET /api/usage?days=30)
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	since, ok := usageSince(r)
+	if !ok {
+		localizedError(w, r, http.StatusBadRequest, "ERR_INVALID_PARAM", "days", r.URL.Query().Get("days"))
+		return
+	}
+	list := make([]usage.ServerUsage, 0)
+	if s.usage != nil {
+		s.sampleTunnels(time.Now())
+		list = usage.ByServer(s.config, s.usage.Totals(since))
+	}
+	jsonResponse(w, http.StatusOK, list)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/usage"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestServerUsage(t *testing.T) {
+	server, handler := newAuthTestServer(t)
+	gateway := &types.Hop{ID: "gw-1", Name: "gateway", Host: "10.0.0.254", Port: 22, User: "root"}
+	server.manager.AddHop(gateway)
+	web := server.config.GetHopByID("hop-1")
+
+	server.recordUsage([]*types.Hop{gateway, web}, usage.Counters{Sessions: 1, Bytes: 2048})
+	server.recordUsage([]*types.Hop{gateway}, usage.Counters{Transfers: 1, Bytes: 4096})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer bob-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/servers/gw-1/usage?days=7")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var report usage.Report
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	if len(report.Days) != 1 || report.Total.Sessions != 1 || report.Total.Transfers != 1 || report.Total.Bytes != 6144 {
+		t.Errorf("unexpected gateway report: %+v", report)
+	}
+	if rec := get("/api/servers/hop-1/usage?days=0"); rec.Code != http.StatusBadRequest {
+		t.Errorf("days=0: expected 400, got %d", rec.Code)
+	}
+
+	rec = get("/api/usage")
+	var list []usage.ServerUsage
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list) != 2 || list[0].Server != "gateway" || list[1].Server != "web-1" || list[1].Bytes != 2048 {
+		t.Errorf("unexpected usage list: %+v", list)
+	}
+}
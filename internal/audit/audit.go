@@ -0,0 +1,98 @@
+// Package audit 记录 Web API 的修改操作和后台任务结果，每行一个 JSON 事件，
+// 通过 request_id 与服务端日志、客户端日志关联
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileName 配置目录下的审计日志文件
+const FileName = "audit.log"
+
+// Event 审计事件
+type Event struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Action    string    `json:"action"`           // 如 "POST /api/servers"、"upload.completed"
+	Target    string    `json:"target,omitempty"` // 任务 ID、服务器 ID 等
+	Status    int       `json:"status,omitempty"` // HTTP 状态码
+	Error     string    `json:"error,omitempty"`
+	Detail    string    `json:"detail,omitempty"` // 补充说明，如协商出的旧算法
+}
+
+// Logger 追加写入审计日志
+type Logger struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+// Open 打开（必要时创建）审计日志
+func Open(path string) (*Logger, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Logger{file: file}, nil
+}
+
+// Record 写入一条事件，未设置时间时使用当前时间
+func (l *Logger) Record(event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	return nil
+}
+
+// Close 关闭审计日志
+func (l *Logger) Close() error {
+	return l.file.Close()
+}
+
+// maxLineSize 读取审计日志时单行的长度上限
+const maxLineSize = 1 << 20
+
+// Scan 按写入顺序读取 path 中的事件并对每个事件调用 fn，fn 返回 false 时停止。
+// 日志不存在时不调用 fn；无法解析的行（如写入中途退出留下的半行）被跳过
+func Scan(path string, fn func(Event) bool) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		var event Event
+		if json.Unmarshal(scanner.Bytes(), &event) != nil {
+			continue
+		}
+		if !fn(event) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return nil
+}
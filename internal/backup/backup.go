@@ -0,0 +1,431 @@
+// Package backup 把 HSSH 的全部本地状态打包为一个 tar.gz，用于迁移控制机和灾难恢复：
+// 配置目录中的所有文件（config.yaml 或 config.db 的一致快照、secrets.enc 和 secret.key、审计日志、使用量等）
+// 以及 ~/.ssh/known_hosts。sync/ 下的团队拓扑缓存和临时文件不打包，可以重新获取。
+// 提供口令时整个归档用 PBKDF2 派生的密钥分段 AES-256-GCM 加密，secret.key 因此不会以明文离开本机
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// EnvPassphrase 未指定 --passphrase-file 时从该环境变量读取备份口令
+const EnvPassphrase = "GMSSH_BACKUP_PASSPHRASE"
+
+const (
+	// manifestName 归档中的第一个条目
+	manifestName = "manifest.json"
+	// configPrefix 配置目录中的文件在归档中的前缀
+	configPrefix = "config/"
+	// knownHostsName known_hosts 在归档中的名称
+	knownHostsName = "known_hosts"
+	// formatVersion 归档格式版本
+	formatVersion = 1
+)
+
+// ErrConfigExists 目标配置目录已有配置，恢复需要 force
+var ErrConfigExists = errors.New("config directory already has a config, use force to replace it")
+
+// Sources 备份的来源和恢复的目标
+type Sources struct {
+	ConfigDir  string
+	KnownHosts string // 为空时不备份（恢复时忽略归档中的）known_hosts
+}
+
+// DefaultSources configDir 和当前用户的 ~/.ssh/known_hosts
+func DefaultSources(configDir string) Sources {
+	src := Sources{ConfigDir: configDir}
+	if home, err := os.UserHomeDir(); err == nil {
+		src.KnownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	return src
+}
+
+// File 归档中的一个文件
+type File struct {
+	Name string `json:"name"` // config/<相对路径> 或 known_hosts
+	Size int64  `json:"size"`
+}
+
+// Manifest 备份说明，位于归档开头
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Hostname  string    `json:"hostname"`
+	Encrypted bool      `json:"encrypted"`
+	Files     []File    `json:"files"`
+}
+
+// Result 恢复的结果
+type Result struct {
+	Manifest        *Manifest `json:"manifest"`
+	Restored        []string  `json:"restored"`          // 写入的文件
+	Replaced        []string  `json:"replaced"`          // 被替换前另存为 .bak 的文件
+	KnownHostsAdded int       `json:"known_hosts_added"` // 合并进 known_hosts 的新行
+	DryRun          bool      `json:"dry_run,omitempty"`
+}
+
+// RestoreOptions 恢复选项
+type RestoreOptions struct {
+	Passphrase string // 加密备份的口令
+	Force      bool   // 目标已有配置时替换，原文件另存为 .bak
+	DryRun     bool   // 只校验归档（包括口令和完整性），不写入
+}
+
+// Unconfigured 配置中还没有服务器、Portal 映射和 Web 用户，即新机器上首次运行时生成的默认配置，
+// 恢复到这样的配置目录不需要 force
+func Unconfigured(cfg *types.Config) bool {
+	return len(cfg.Hops) == 0 && len(cfg.Trash) == 0 && len(cfg.Portal.Client.Mappings) == 0 && len(cfg.Web.Users) == 0
+}
+
+// skipFile 配置目录中不打包的文件：团队拓扑缓存、临时文件、SQLite 辅助文件（快照已包含 WAL 中的数据）
+func skipFile(rel string, d fs.DirEntry) bool {
+	if d.IsDir() {
+		return rel == "sync" || strings.HasPrefix(d.Name(), ".restore-")
+	}
+	name := d.Name()
+	return !d.Type().IsRegular() || strings.HasSuffix(name, ".tmp") ||
+		name == config.SQLiteFileName+"-wal" || name == config.SQLiteFileName+"-shm"
+}
+
+// Create 把 src 中的状态写入 w；passphrase 非空时加密
+func Create(w io.Writer, src Sources, passphrase string) (*Manifest, error) {
+	hostname, _ := os.Hostname()
+	manifest := &Manifest{Version: formatVersion, CreatedAt: time.Now().UTC(), Hostname: hostname, Encrypted: passphrase != ""}
+	paths := make(map[string]string) // 归档名 -> 本地路径
+
+	// config.db 可能正被 web 服务写入，打包它的快照
+	tmpDir, err := os.MkdirTemp("", "gmssh-backup-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	err = filepath.WalkDir(src.ConfigDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src.ConfigDir, p)
+		if rel == "." {
+			return nil
+		}
+		if skipFile(rel, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if rel == config.SQLiteFileName {
+			snapshot := filepath.Join(tmpDir, config.SQLiteFileName)
+			if err := config.SnapshotSQLite(p, snapshot); err != nil {
+				return err
+			}
+			p = snapshot
+		}
+		paths[configPrefix+filepath.ToSlash(rel)] = p
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config directory: %w", err)
+	}
+	if src.KnownHosts != "" {
+		if _, err := os.Stat(src.KnownHosts); err == nil {
+			paths[knownHostsName] = src.KnownHosts
+		}
+	}
+	for name, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, File{Name: name, Size: info.Size()})
+	}
+	slices.SortFunc(manifest.Files, func(a, b File) int { return strings.Compare(a.Name, b.Name) })
+
+	out := w
+	var enc *encryptWriter
+	if passphrase != "" {
+		if enc, err = newEncryptWriter(w, passphrase); err != nil {
+			return nil, err
+		}
+		out = enc
+	}
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	data, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := writeEntry(tw, manifestName, int64(len(data)), strings.NewReader(string(data))); err != nil {
+		return nil, err
+	}
+	for _, file := range manifest.Files {
+		f, err := os.Open(paths[file.Name])
+		if err != nil {
+			return nil, err
+		}
+		err = writeEntry(tw, file.Name, file.Size, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to archive %s: %w", file.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+func writeEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	hdr := &tar.Header{Name: name, Mode: 0600, Size: size, ModTime: time.Now(), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	// 文件在打包期间变长时只取 stat 时的大小，变短时报错
+	_, err := io.CopyN(tw, r, size)
+	return err
+}
+
+// validName 归档条目名只能是 config/ 下的相对路径或 known_hosts
+func validName(name string) bool {
+	if name == knownHostsName {
+		return true
+	}
+	rel, ok := strings.CutPrefix(name, configPrefix)
+	return ok && rel != "" && path.Clean(rel) == rel && !strings.HasPrefix(rel, "../") && rel != ".." && !path.IsAbs(rel)
+}
+
+// Restore 从 r 恢复状态到 dst：先把整个归档解到配置目录下的临时目录并校验，
+// 全部成功后再替换配置目录中的文件；known_hosts 只追加尚未存在的行。
+// web 服务运行时恢复的配置在重启后生效
+func Restore(r io.Reader, dst Sources, opts RestoreOptions) (*Result, error) {
+	plain, encrypted, err := openArchive(r, opts.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(plain)
+	if err != nil {
+		if encrypted {
+			return nil, err
+		}
+		return nil, fmt.Errorf("not a gmssh backup: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != manifestName {
+		return nil, fmt.Errorf("not a gmssh backup: missing %s", manifestName)
+	}
+	manifest := &Manifest{}
+	if err := json.NewDecoder(io.LimitReader(tr, 1<<20)).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("invalid backup manifest: %w", err)
+	}
+	if manifest.Version > formatVersion {
+		return nil, fmt.Errorf("backup format %d is newer than this gmssh supports (%d)", manifest.Version, formatVersion)
+	}
+	manifest.Encrypted = encrypted
+	result := &Result{Manifest: manifest, DryRun: opts.DryRun}
+
+	if !opts.DryRun && !opts.Force && hasConfig(dst.ConfigDir) {
+		return nil, ErrConfigExists
+	}
+	staging := ""
+	if !opts.DryRun {
+		if err := os.MkdirAll(dst.ConfigDir, 0700); err != nil {
+			return nil, err
+		}
+		if staging, err = os.MkdirTemp(dst.ConfigDir, ".restore-"); err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(staging)
+	}
+
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("corrupted backup: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !validName(hdr.Name) {
+			return nil, fmt.Errorf("unexpected entry %q in backup", hdr.Name)
+		}
+		if staging == "" {
+			if _, err := io.Copy(io.Discard, tr); err != nil {
+				return nil, fmt.Errorf("corrupted backup: %w", err)
+			}
+		} else if err := extract(tr, filepath.Join(staging, filepath.FromSlash(hdr.Name))); err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+		}
+		names = append(names, hdr.Name)
+	}
+	// 读到加密流的最后一段，截断的备份在这里失败
+	if _, err := io.Copy(io.Discard, plain); err != nil {
+		return nil, fmt.Errorf("corrupted backup: %w", err)
+	}
+	if opts.DryRun {
+		result.Restored = names
+		return result, nil
+	}
+
+	if err := install(staging, dst, names, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// hasConfig 配置目录中是否已有配置文件或配置库
+func hasConfig(configDir string) bool {
+	for _, name := range []string{config.ConfigFileName, config.SQLiteFileName} {
+		if _, err := os.Stat(filepath.Join(configDir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func extract(r io.Reader, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// install 把临时目录中校验过的文件移到配置目录，被替换的文件另存为 .bak。
+// 备份只包含 config.yaml 和 config.db 之一时，另一个也另存，避免恢复后仍读到旧的配置
+func install(staging string, dst Sources, names []string, result *Result) error {
+	storage := false
+	for _, name := range names {
+		if name == configPrefix+config.ConfigFileName || name == configPrefix+config.SQLiteFileName {
+			storage = true
+		}
+	}
+	if storage {
+		for _, name := range []string{config.ConfigFileName, config.SQLiteFileName} {
+			if !slices.Contains(names, configPrefix+name) {
+				if err := setAside(filepath.Join(dst.ConfigDir, name), result); err != nil {
+					return err
+				}
+			}
+		}
+		for _, suffix := range []string{"-wal", "-shm"} {
+			os.Remove(filepath.Join(dst.ConfigDir, config.SQLiteFileName+suffix))
+		}
+	}
+
+	for _, name := range names {
+		src := filepath.Join(staging, filepath.FromSlash(name))
+		if name == knownHostsName {
+			if dst.KnownHosts == "" {
+				continue
+			}
+			added, err := mergeKnownHosts(src, dst.KnownHosts)
+			if err != nil {
+				return fmt.Errorf("failed to merge known_hosts: %w", err)
+			}
+			result.KnownHostsAdded = added
+			continue
+		}
+		target := filepath.Join(dst.ConfigDir, filepath.FromSlash(strings.TrimPrefix(name, configPrefix)))
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return err
+		}
+		if err := setAside(target, result); err != nil {
+			return err
+		}
+		if err := os.Rename(src, target); err != nil {
+			return err
+		}
+		result.Restored = append(result.Restored, target)
+	}
+	return nil
+}
+
+// setAside 把已存在的文件重命名为 .bak
+func setAside(p string, result *Result) error {
+	if _, err := os.Stat(p); err != nil {
+		return nil
+	}
+	if err := os.Rename(p, p+".bak"); err != nil {
+		return err
+	}
+	result.Replaced = append(result.Replaced, p)
+	return nil
+}
+
+// mergeKnownHosts 把 src 中 dst 尚未包含的行追加到 dst，返回追加的行数
+func mergeKnownHosts(src, dst string) (int, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return 0, err
+	}
+	existing, err := os.ReadFile(dst)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	have := make(map[string]bool)
+	for _, line := range strings.Split(string(existing), "\n") {
+		have[strings.TrimSpace(line)] = true
+	}
+	var add []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || have[line] {
+			continue
+		}
+		have[line] = true
+		add = append(add, line)
+	}
+	if len(add) == 0 {
+		return 0, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+	prefix := ""
+	if len(existing) > 0 && !strings.HasSuffix(string(existing), "\n") {
+		prefix = "\n"
+	}
+	if _, err := f.WriteString(prefix + strings.Join(add, "\n") + "\n"); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return len(add), f.Close()
+}
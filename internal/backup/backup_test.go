@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// newState 创建带 config.db、凭据密钥、审计日志、同步缓存和 known_hosts 的配置目录
+func newState(t *testing.T) Sources {
+	t.Helper()
+	dir := t.TempDir()
+	src := Sources{ConfigDir: filepath.Join(dir, ".gmssh"), KnownHosts: filepath.Join(dir, ".ssh", "known_hosts")}
+	os.MkdirAll(filepath.Join(src.ConfigDir, "sync"), 0700)
+	os.MkdirAll(filepath.Dir(src.KnownHosts), 0700)
+
+	storage, err := config.OpenSQLiteStorage(filepath.Join(src.ConfigDir, config.SQLiteFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &types.Config{Version: 2, Hops: []*types.Hop{{ID: "h1", Name: "web", Host: "10.0.0.1", Port: 22, User: "root", Password: "pw"}}}
+	if err := storage.Save(cfg); err != nil {
+		t.Fatal(err)
+	}
+	// 不关闭：模拟运行中的 web 服务，数据还在 WAL 中
+	t.Cleanup(func() { storage.Close() })
+
+	os.WriteFile(filepath.Join(src.ConfigDir, "audit.log"), []byte("{}\n"), 0600)
+	os.WriteFile(filepath.Join(src.ConfigDir, "sync", "config.yaml"), []byte("cache"), 0600)
+	os.WriteFile(filepath.Join(src.ConfigDir, "usage.json.tmp"), []byte("partial"), 0600)
+	os.WriteFile(src.KnownHosts, []byte("10.0.0.1 ssh-ed25519 AAAA1\n"), 0600)
+	return src
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	src := newState(t)
+
+	var archive bytes.Buffer
+	manifest, err := Create(&archive, src, "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var names []string
+	for _, f := range manifest.Files {
+		names = append(names, f.Name)
+	}
+	want := "config/audit.log,config/config.db,config/secret.key,known_hosts"
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("files = %s, want %s", got, want)
+	}
+
+	// 新机器上恢复：配置可以读出，known_hosts 只追加新行
+	dst := Sources{ConfigDir: filepath.Join(t.TempDir(), ".gmssh"), KnownHosts: filepath.Join(t.TempDir(), "known_hosts")}
+	os.WriteFile(dst.KnownHosts, []byte("other ssh-ed25519 BBBB"), 0600)
+	result, err := Restore(bytes.NewReader(archive.Bytes()), dst, RestoreOptions{})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if len(result.Restored) != 3 || result.KnownHostsAdded != 1 || len(result.Replaced) != 0 {
+		t.Errorf("result = %+v", result)
+	}
+	storage, err := config.OpenSQLiteStorage(filepath.Join(dst.ConfigDir, config.SQLiteFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := storage.Load()
+	storage.Close()
+	if err != nil || len(cfg.Hops) != 1 || cfg.Hops[0].Password != "pw" {
+		t.Errorf("restored config = %+v, %v", cfg, err)
+	}
+	if hosts, _ := os.ReadFile(dst.KnownHosts); string(hosts) != "other ssh-ed25519 BBBB\n10.0.0.1 ssh-ed25519 AAAA1\n" {
+		t.Errorf("known_hosts = %q", hosts)
+	}
+
+	// 已有配置时需要 force，被替换的文件另存为 .bak
+	if _, err := Restore(bytes.NewReader(archive.Bytes()), dst, RestoreOptions{}); !errors.Is(err, ErrConfigExists) {
+		t.Errorf("Restore over a config = %v", err)
+	}
+	os.WriteFile(filepath.Join(dst.ConfigDir, config.ConfigFileName), []byte("version: 2\n"), 0600)
+	result, err = Restore(bytes.NewReader(archive.Bytes()), dst, RestoreOptions{Force: true})
+	if err != nil {
+		t.Fatalf("Restore with force: %v", err)
+	}
+	if result.KnownHostsAdded != 0 || len(result.Replaced) != 4 {
+		t.Errorf("replaced = %v", result.Replaced)
+	}
+	if _, err := os.Stat(filepath.Join(dst.ConfigDir, config.ConfigFileName)); !os.IsNotExist(err) {
+		t.Error("config.yaml left next to the restored config.db")
+	}
+}
+
+func TestEncryptedBackup(t *testing.T) {
+	src := newState(t)
+	// 超过一段的内容
+	os.WriteFile(filepath.Join(src.ConfigDir, "usage.json"), bytes.Repeat([]byte("x"), 3*chunkSize+7), 0600)
+
+	var archive bytes.Buffer
+	if _, err := Create(&archive, src, "correct horse"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if bytes.Contains(archive.Bytes(), []byte("audit.log")) {
+		t.Error("encrypted backup leaks file names")
+	}
+
+	dst := Sources{ConfigDir: filepath.Join(t.TempDir(), ".gmssh")}
+	if _, err := Restore(bytes.NewReader(archive.Bytes()), dst, RestoreOptions{}); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("without passphrase = %v", err)
+	}
+	if _, err := Restore(bytes.NewReader(archive.Bytes()), dst, RestoreOptions{Passphrase: "wrong"}); !errors.Is(err, ErrPassphrase) {
+		t.Errorf("wrong passphrase = %v", err)
+	}
+	// 截断的备份不会写入任何文件
+	truncated := archive.Bytes()[:archive.Len()-20]
+	if _, err := Restore(bytes.NewReader(truncated), dst, RestoreOptions{Passphrase: "correct horse"}); err == nil {
+		t.Error("truncated backup restored")
+	}
+	if hasConfig(dst.ConfigDir) {
+		t.Error("failed restore wrote a config")
+	}
+
+	result, err := Restore(bytes.NewReader(archive.Bytes()), dst, RestoreOptions{Passphrase: "correct horse", DryRun: true})
+	if err != nil || !result.Manifest.Encrypted || len(result.Restored) != 5 || hasConfig(dst.ConfigDir) {
+		t.Fatalf("dry run = %+v, %v", result, err)
+	}
+	if _, err := Restore(bytes.NewReader(archive.Bytes()), dst, RestoreOptions{Passphrase: "correct horse"}); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if usage, _ := os.ReadFile(filepath.Join(dst.ConfigDir, "usage.json")); len(usage) != 3*chunkSize+7 {
+		t.Errorf("usage.json has %d bytes", len(usage))
+	}
+	if left, _ := filepath.Glob(filepath.Join(dst.ConfigDir, ".restore-*")); len(left) != 0 {
+		t.Errorf("staging left: %v", left)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"known_hosts":          true,
+		"config/config.db":     true,
+		"config/keys/id":       true,
+		"config/":              false,
+		"config/../etc/passwd": false,
+		"config/./x":           false,
+		"config//x":            false,
+		"/etc/passwd":          false,
+		"other/known_hosts":    false,
+		"config/..":            false,
+	} {
+		if got := validName(name); got != want {
+			t.Errorf("validName(%q) = %v", name, got)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// kdfIterations PBKDF2-SHA256 的迭代次数
+	kdfIterations = 600000
+	// saltSize 每个备份随机生成的盐
+	saltSize = 16
+	// chunkSize 每段明文的最大长度，每段单独用 AES-256-GCM 加密和认证
+	chunkSize = 64 << 10
+)
+
+// encryptedMagic 加密备份的文件头；未加密的备份以 gzip 头开始
+var encryptedMagic = []byte("GMSSH-BACKUP-1\n")
+
+// ErrPassphrase 口令错误或加密备份被篡改
+var ErrPassphrase = errors.New("wrong backup passphrase or corrupted backup")
+
+// ErrPassphraseRequired 备份已加密但没有提供口令
+var ErrPassphraseRequired = errors.New("backup is encrypted, a passphrase is required")
+
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, kdfIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce 第 n 段的 nonce，最后一段带标记，截断的备份因缺少最后一段而无法通过校验
+func chunkNonce(n uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	if last {
+		nonce[0] = 1
+	}
+	binary.BigEndian.PutUint64(nonce[4:], n)
+	return nonce
+}
+
+// encryptWriter 分段加密：文件头、盐，然后每段为 4 字节密文长度加密文
+type encryptWriter struct {
+	w    io.Writer
+	aead cipher.AEAD
+	buf  []byte
+	n    uint64
+}
+
+func newEncryptWriter(w io.Writer, passphrase string) (*encryptWriter, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append(append([]byte(nil), encryptedMagic...), salt...)); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), chunkSize-len(e.buf))
+		e.buf = append(e.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(e.buf) == chunkSize {
+			if err := e.flush(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close 写出最后一段（可能为空），不关闭底层 writer
+func (e *encryptWriter) Close() error {
+	return e.flush(true)
+}
+
+func (e *encryptWriter) flush(last bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.n, last), e.buf, nil)
+	e.n++
+	e.buf = e.buf[:0]
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(sealed)))
+	if _, err := e.w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// decryptReader 读取 encryptWriter 写出的分段密文，文件头已被读取
+type decryptReader struct {
+	r    io.Reader
+	aead cipher.AEAD
+	buf  []byte
+	n    uint64
+	done bool
+}
+
+func newDecryptReader(r io.Reader, passphrase string) (*decryptReader, error) {
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, fmt.Errorf("truncated backup header: %w", err)
+	}
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: r, aead: aead}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// next 读取并解密下一段；先按普通段解密，失败时再按最后一段解密
+func (d *decryptReader) next() error {
+	var size [4]byte
+	if _, err := io.ReadFull(d.r, size[:]); err != nil {
+		return fmt.Errorf("truncated backup: %w", ErrPassphrase)
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > chunkSize+uint32(d.aead.Overhead()) {
+		return ErrPassphrase
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return fmt.Errorf("truncated backup: %w", ErrPassphrase)
+	}
+	plain, err := d.aead.Open(nil, chunkNonce(d.n, false), sealed, nil)
+	if err != nil {
+		if plain, err = d.aead.Open(nil, chunkNonce(d.n, true), sealed, nil); err != nil {
+			return ErrPassphrase
+		}
+		d.done = true
+	}
+	d.n++
+	d.buf = plain
+	return nil
+}
+
+// openArchive 按文件头识别加密备份，返回解密后的 gzip 流
+func openArchive(r io.Reader, passphrase string) (io.Reader, bool, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(encryptedMagic))
+	if string(head) != string(encryptedMagic) {
+		return br, false, nil
+	}
+	br.Discard(len(encryptedMagic))
+	dr, err := newDecryptReader(br, passphrase)
+	return dr, true, err
+}
@@ -0,0 +1,138 @@
+// Package benchgate 比较 go test -bench 的结果与保存的基线，找出性能回退。
+// 同名基准测试多次运行（-count）时取各指标的中位数；名称去掉 -GOMAXPROCS 后缀，不同机器的结果可以互相比较。
+// ns/op 等 "/op" 指标越小越好，MB/s 越大越好，其余自定义指标不参与比较
+package benchgate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Results 各基准测试的指标（单位 → 中位数）
+type Results map[string]map[string]float64
+
+// Regression 超过阈值的回退
+type Regression struct {
+	Name     string
+	Unit     string
+	Baseline float64
+	Current  float64
+	// Change 相对基线的变化比例，正数表示变差
+	Change float64
+}
+
+func (r Regression) String() string {
+	return fmt.Sprintf("%s: %s %s -> %s (%+.1f%% worse)", r.Name, r.Unit,
+		strconv.FormatFloat(r.Baseline, 'g', 6, 64), strconv.FormatFloat(r.Current, 'g', 6, 64), r.Change*100)
+}
+
+// procsSuffix go test 在基准测试名称后附加的 -GOMAXPROCS
+var procsSuffix = regexp.MustCompile(`-\d+$`)
+
+// Parse 读取 go test -bench 的输出，忽略非结果行
+func Parse(r io.Reader) (Results, error) {
+	samples := map[string]map[string][]float64{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// BenchmarkName-8  <iterations>  <value> <unit>  [<value> <unit> ...]
+		if len(fields) < 4 || len(fields)%2 != 0 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+		name := procsSuffix.ReplaceAllString(fields[0], "")
+		for i := 2; i < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for %s", fields[i], name)
+			}
+			if samples[name] == nil {
+				samples[name] = map[string][]float64{}
+			}
+			samples[name][fields[i+1]] = append(samples[name][fields[i+1]], value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	results := Results{}
+	for name, units := range samples {
+		results[name] = map[string]float64{}
+		for unit, values := range units {
+			results[name][unit] = median(values)
+		}
+	}
+	return results, nil
+}
+
+// Compare 返回 current 相对 baseline 变差超过 threshold（如 0.2 表示 20%）的指标，按名称排序。
+// 只在一方出现的基准测试不比较
+func Compare(baseline, current Results, threshold float64) []Regression {
+	var regressions []Regression
+	for name, units := range current {
+		for unit, value := range units {
+			base, ok := baseline[name][unit]
+			if !ok || base == 0 {
+				continue
+			}
+			var change float64
+			switch {
+			case unit == "MB/s":
+				change = (base - value) / base
+			case strings.HasSuffix(unit, "/op"):
+				change = (value - base) / base
+			default:
+				continue
+			}
+			if change > threshold {
+				regressions = append(regressions, Regression{Name: name, Unit: unit, Baseline: base, Current: value, Change: change})
+			}
+		}
+	}
+	slices.SortFunc(regressions, func(a, b Regression) int {
+		return strings.Compare(a.Name+" "+a.Unit, b.Name+" "+b.Unit)
+	})
+	return regressions
+}
+
+// Write 按 go test -bench 的格式写出结果，供 Parse 读回作为新的基线
+func Write(w io.Writer, results Results) error {
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		units := make([]string, 0, len(results[name]))
+		for unit := range results[name] {
+			units = append(units, unit)
+		}
+		slices.Sort(units)
+		line := name + "\t1"
+		for _, unit := range units {
+			line += "\t" + strconv.FormatFloat(results[name][unit], 'f', -1, 64) + " " + unit
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
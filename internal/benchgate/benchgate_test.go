@@ -0,0 +1,69 @@
+package benchgate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const output = `goos: linux
+pkg: github.com/luobobo896/HSSH/internal/transfer
+BenchmarkUpload/scp-8         	      10	  70000000 ns/op	 120.00 MB/s
+BenchmarkUpload/scp-8         	      10	  90000000 ns/op	 100.00 MB/s
+BenchmarkUpload/scp-8         	      10	  80000000 ns/op	 110.00 MB/s
+BenchmarkChainConnect/direct-8	     500	   2400000 ns/op	   41000 B/op	     300 allocs/op
+PASS
+ok  	github.com/luobobo896/HSSH/internal/transfer	3.1s
+`
+
+func TestParse(t *testing.T) {
+	results, err := Parse(strings.NewReader(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %v", results)
+	}
+	if scp := results["BenchmarkUpload/scp"]; scp["ns/op"] != 80000000 || scp["MB/s"] != 110 {
+		t.Errorf("scp medians = %v", scp)
+	}
+	if direct := results["BenchmarkChainConnect/direct"]; direct["allocs/op"] != 300 {
+		t.Errorf("direct = %v", direct)
+	}
+
+	// Write 的输出可以读回
+	var buf bytes.Buffer
+	if err := Write(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Parse(&buf)
+	if err != nil || again["BenchmarkUpload/scp"]["MB/s"] != 110 {
+		t.Errorf("round trip = %v, %v", again, err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	baseline := Results{
+		"BenchmarkUpload/scp":          {"ns/op": 100, "MB/s": 100},
+		"BenchmarkChainConnect/direct": {"ns/op": 100, "conns": 1},
+		"BenchmarkRemoved":             {"ns/op": 100},
+	}
+	current := Results{
+		"BenchmarkUpload/scp":          {"ns/op": 110, "MB/s": 70},
+		"BenchmarkChainConnect/direct": {"ns/op": 150, "conns": 9},
+		"BenchmarkNew":                 {"ns/op": 1000},
+	}
+	regressions := Compare(baseline, current, 0.2)
+	if len(regressions) != 2 {
+		t.Fatalf("regressions = %v", regressions)
+	}
+	if r := regressions[0]; r.Name != "BenchmarkChainConnect/direct" || r.Unit != "ns/op" || r.Change != 0.5 {
+		t.Errorf("first = %+v", r)
+	}
+	if r := regressions[1]; r.Name != "BenchmarkUpload/scp" || r.Unit != "MB/s" || r.Change < 0.29 || r.Change > 0.31 {
+		t.Errorf("second = %+v", r)
+	}
+	if got := Compare(baseline, current, 0.6); len(got) != 0 {
+		t.Errorf("threshold 60%% = %v", got)
+	}
+}
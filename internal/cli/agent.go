@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/agent"
+	"github.com/luobobo896/HSSH/internal/portal/protocol"
+)
+
+// AgentCommand agent CLI command
+type AgentCommand struct {
+	hub             string
+	token           string
+	name            string
+	fetchDir        string
+	allow           string
+	fingerprint     string
+	insecure        bool
+	metricsInterval time.Duration
+}
+
+// Name returns command name
+func (c *AgentCommand) Name() string {
+	return "agent"
+}
+
+// Synopsis returns short description
+func (c *AgentCommand) Synopsis() string {
+	return "以 agent 身份向控制面注册，在内网侧代为执行传输和转发"
+}
+
+// Usage returns detailed usage
+func (c *AgentCommand) Usage() string {
+	return `Usage: hssh agent [options]
+
+Options:
+  --hub ADDR            控制面 agent 接入地址 (例如 control.example.com:18889)
+  --token TOKEN         认证令牌（需在控制面 agents.tokens 中配置）
+  --name NAME           agent 名称 (默认主机名)
+  --fetch-dir DIR       fetch 任务的落盘目录，为空则不接受 fetch 任务
+  --allow CIDRS         允许转发的目标网段，逗号分隔，为空不限制
+  --fingerprint SHA256  控制面证书指纹（控制面使用自签名证书时）
+  --insecure            跳过证书校验（仅用于测试）
+  --metrics-interval D  指标上报间隔 (默认 15s)
+
+Examples:
+  hssh agent --hub control.example.com:18889 --token my-token --fetch-dir /data/incoming --allow 10.0.0.0/8
+`
+}
+
+// SetFlags sets up command flags
+func (c *AgentCommand) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.hub, "hub", "", "Control plane agent address")
+	f.StringVar(&c.token, "token", "", "Auth token")
+	f.StringVar(&c.name, "name", "", "Agent name (default hostname)")
+	f.StringVar(&c.fetchDir, "fetch-dir", "", "Directory for fetch tasks")
+	f.StringVar(&c.allow, "allow", "", "Comma-separated CIDRs allowed as forward targets")
+	f.StringVar(&c.fingerprint, "fingerprint", "", "SHA-256 fingerprint of the control plane certificate")
+	f.BoolVar(&c.insecure, "insecure", false, "Skip certificate verification")
+	f.DurationVar(&c.metricsInterval, "metrics-interval", agent.DefaultMetricsInterval, "Metrics report interval")
+}
+
+// Run executes the command
+func (c *AgentCommand) Run(args []string) int {
+	if c.hub == "" || c.token == "" {
+		fmt.Fprintln(os.Stderr, "Error: --hub and --token are required")
+		fmt.Println(c.Usage())
+		return 1
+	}
+
+	tlsConfig, err := c.clientTLS()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var allowed []string
+	if c.allow != "" {
+		for _, cidr := range strings.Split(c.allow, ",") {
+			cidr = strings.TrimSpace(cidr)
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid CIDR '%s': %v\n", cidr, err)
+				return 1
+			}
+			allowed = append(allowed, cidr)
+		}
+	}
+
+	a, err := agent.New(agent.Config{
+		Name:            c.name,
+		HubAddr:         c.hub,
+		Token:           c.token,
+		TLSConfig:       tlsConfig,
+		FetchDir:        c.fetchDir,
+		AllowedRemotes:  allowed,
+		MetricsInterval: c.metricsInterval,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		log.Println("[Agent] Shutting down...")
+		cancel()
+	}()
+
+	log.Printf("[Agent] Connecting to hub %s", c.hub)
+	if err := a.Run(ctx); err != nil {
+		log.Printf("[Agent] Error: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// clientTLS 构建连接控制面的 TLS 配置
+func (c *AgentCommand) clientTLS() (*tls.Config, error) {
+	switch {
+	case c.fingerprint != "":
+		return protocol.PinnedClientTLS(c.fingerprint), nil
+	case c.insecure:
+		log.Println("[Agent] Warning: TLS certificate verification disabled")
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	default:
+		host, _, err := net.SplitHostPort(c.hub)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hub address '%s': %w", c.hub, err)
+		}
+		return &tls.Config{ServerName: host}, nil
+	}
+}
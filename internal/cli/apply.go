@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/config"
+)
+
+// webCallTimeout 单次调用 gmssh web 的超时，创建转发时包含建立跳板链的时间
+const webCallTimeout = 60 * time.Second
+
+// ApplyOptions gmssh apply 的参数
+type ApplyOptions struct {
+	File   string
+	Prune  bool // 删除状态文件中已不存在的、由 apply 创建的条目
+	DryRun bool // 只输出计划
+	Addr   string
+	Token  string
+	JSON   bool
+}
+
+// ApplyResult apply 的结果，--json 时输出
+type ApplyResult struct {
+	Changes []config.StateChange `json:"changes"`
+	Applied bool                 `json:"applied"`
+}
+
+// runningProxy GET /api/proxy 返回的转发
+type runningProxy struct {
+	ID         string `json:"id"`
+	LocalAddr  string `json:"local_addr"`
+	RemoteHost string `json:"remote_host"`
+	RemotePort int    `json:"remote_port"`
+}
+
+// proxyStep 执行计划中的一个转发变更：先删除 remove（非空时），再按 create 创建
+type proxyStep struct {
+	remove string
+	create *config.DesiredProxy
+}
+
+// ApplyCommand 按声明式状态文件调整服务器、Portal 映射和运行中的端口转发：输出计划，再幂等地执行。
+// 服务器和映射写入配置；转发由本机运行的 gmssh web 执行，只在文件中有 proxies 键时管理
+func (c *CLI) ApplyCommand(opts ApplyOptions) error {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	data, err := os.ReadFile(opts.File)
+	if err != nil {
+		return withExitCode(ExitUsage, fmt.Errorf("failed to read state file: %w", err))
+	}
+	state, err := config.ParseState(data)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	plan, err := config.PlanState(c.config, state, opts.Prune)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	result := ApplyResult{Changes: append([]config.StateChange{}, plan.Changes...)}
+
+	var steps []proxyStep
+	addr, token := c.webEndpoint(opts.Addr, opts.Token)
+	if state.Proxies != nil {
+		var running []runningProxy
+		if err := webCall(ctx, addr, token, http.MethodGet, "/api/proxy", nil, &running); err != nil {
+			return c.fail(ctx, ExitFailed, err)
+		}
+		var changes []config.StateChange
+		changes, steps = planProxies(state.Proxies, running, opts.Prune)
+		result.Changes = append(result.Changes, changes...)
+	}
+
+	asJSON := opts.JSON || c.batch.Quiet
+	if !asJSON {
+		printPlan(result.Changes)
+	}
+	if len(result.Changes) == 0 || opts.DryRun {
+		if asJSON {
+			return printJSON(result)
+		}
+		return nil
+	}
+
+	if err := c.manager.ApplyPlan(plan); err != nil {
+		return c.fail(ctx, ExitFailed, fmt.Errorf("failed to save config: %w", err))
+	}
+	for _, step := range steps {
+		if step.remove != "" {
+			if err := webCall(ctx, addr, token, http.MethodDelete, "/api/proxy/"+step.remove, nil, nil); err != nil {
+				return c.fail(ctx, ExitFailed, err)
+			}
+		}
+		if step.create != nil {
+			req := map[string]interface{}{
+				"local_addr":  step.create.LocalAddr,
+				"remote_host": step.create.RemoteHost,
+				"remote_port": step.create.RemotePort,
+				"via":         step.create.Via,
+			}
+			if err := webCall(ctx, addr, token, http.MethodPost, "/api/proxy", req, nil); err != nil {
+				return c.fail(ctx, ExitFailed, fmt.Errorf("proxy %s: %w", step.create.LocalAddr, err))
+			}
+		}
+	}
+	result.Applied = true
+
+	if asJSON {
+		return printJSON(result)
+	}
+	c.printf("Applied.\n")
+	if !plan.Empty() {
+		c.printf("Restart gmssh web to load the server and mapping changes.\n")
+	}
+	return nil
+}
+
+// planProxies 按本地地址对比期望和运行中的转发；目标不同的转发先删除再重建。
+// gmssh web 不返回转发经过的跳板，只改 via 不会被识别为变化
+func planProxies(desired []config.DesiredProxy, running []runningProxy, prune bool) ([]config.StateChange, []proxyStep) {
+	byAddr := make(map[string]runningProxy, len(running))
+	for _, p := range running {
+		byAddr[normalizeLocalAddr(p.LocalAddr)] = p
+	}
+
+	var changes []config.StateChange
+	var steps []proxyStep
+	declared := make(map[string]bool, len(desired))
+	for i := range desired {
+		want := &desired[i]
+		key := normalizeLocalAddr(want.LocalAddr)
+		declared[key] = true
+		current, ok := byAddr[key]
+		switch {
+		case !ok:
+			changes = append(changes, config.StateChange{Action: config.ActionCreate, Kind: "proxy", Name: want.LocalAddr})
+			steps = append(steps, proxyStep{create: want})
+		case current.RemoteHost != want.RemoteHost || current.RemotePort != want.RemotePort:
+			changes = append(changes, config.StateChange{Action: config.ActionUpdate, Kind: "proxy", Name: want.LocalAddr, Fields: []string{"remote"}})
+			steps = append(steps, proxyStep{remove: current.ID, create: want})
+		}
+	}
+	if prune {
+		for _, p := range running {
+			if !declared[normalizeLocalAddr(p.LocalAddr)] {
+				changes = append(changes, config.StateChange{Action: config.ActionDelete, Kind: "proxy", Name: p.LocalAddr})
+				steps = append(steps, proxyStep{remove: p.ID})
+			}
+		}
+	}
+	return changes, steps
+}
+
+// normalizeLocalAddr 把省略的 host 和 localhost 写成 127.0.0.1，与 gmssh web 报告的监听地址一致
+func normalizeLocalAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if host == "" || host == "localhost" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// printPlan 输出计划：+ 创建，~ 更新（括号内为变化的字段），- 删除
+func printPlan(changes []config.StateChange) {
+	if len(changes) == 0 {
+		fmt.Println("No changes. The configuration matches the state file.")
+		return
+	}
+	counts := map[string]int{}
+	for _, change := range changes {
+		counts[change.Action]++
+		switch change.Action {
+		case config.ActionCreate:
+			fmt.Printf("  + %s %s\n", change.Kind, change.Name)
+		case config.ActionUpdate:
+			fmt.Printf("  ~ %s %s (%s)\n", change.Kind, change.Name, strings.Join(change.Fields, ", "))
+		case config.ActionDelete:
+			fmt.Printf("  - %s %s\n", change.Kind, change.Name)
+		}
+	}
+	fmt.Printf("Plan: %d to create, %d to update, %d to delete\n",
+		counts[config.ActionCreate], counts[config.ActionUpdate], counts[config.ActionDelete])
+}
+
+// webCall 以 JSON 调用本机运行的 gmssh web；out 非 nil 时解码响应。
+// 非 2xx 响应转为 error，带上服务端返回的错误信息
+func webCall(ctx context.Context, addr, token, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://"+addr+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := (&http.Client{Timeout: webCallTimeout}).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach gmssh web at %s: %w", addr, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s %s: %s (%s)", method, path, apiErr.Error, resp.Status)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("invalid response from %s: %w", addr, err)
+		}
+	}
+	return nil
+}
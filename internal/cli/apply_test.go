@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/config"
+)
+
+func TestPlanProxies(t *testing.T) {
+	desired := []config.DesiredProxy{
+		{LocalAddr: ":3306", RemoteHost: "10.0.0.3", RemotePort: 3306},
+		{LocalAddr: "localhost:8080", RemoteHost: "10.0.0.4", RemotePort: 8080},
+		{LocalAddr: "127.0.0.1:9000", RemoteHost: "10.0.0.5", RemotePort: 9000},
+	}
+	running := []runningProxy{
+		{ID: "p1", LocalAddr: "127.0.0.1:3306", RemoteHost: "10.0.0.3", RemotePort: 3306},
+		{ID: "p2", LocalAddr: "127.0.0.1:8080", RemoteHost: "10.0.0.4", RemotePort: 80},
+		{ID: "p3", LocalAddr: "127.0.0.1:5432", RemoteHost: "10.0.0.6", RemotePort: 5432},
+	}
+
+	changes, steps := planProxies(desired, running, false)
+	want := []config.StateChange{
+		{Action: config.ActionUpdate, Kind: "proxy", Name: "localhost:8080", Fields: []string{"remote"}},
+		{Action: config.ActionCreate, Kind: "proxy", Name: "127.0.0.1:9000"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("changes = %+v", changes)
+	}
+	if len(steps) != 2 || steps[0].remove != "p2" || steps[0].create != &desired[1] || steps[1].remove != "" || steps[1].create != &desired[2] {
+		t.Errorf("steps = %+v", steps)
+	}
+
+	changes, steps = planProxies(desired, running, true)
+	if len(changes) != 3 || !reflect.DeepEqual(changes[2], config.StateChange{Action: config.ActionDelete, Kind: "proxy", Name: "127.0.0.1:5432"}) {
+		t.Fatalf("changes with prune = %+v", changes)
+	}
+	if last := steps[len(steps)-1]; last.remove != "p3" || last.create != nil {
+		t.Errorf("prune step = %+v", last)
+	}
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/luobobo896/HSSH/internal/backup"
+)
+
+// backupPassphrase 从 --passphrase-file 或 GMSSH_BACKUP_PASSPHRASE 读取备份口令，都没有时为空（不加密）
+func backupPassphrase(file string) (string, error) {
+	if file == "" {
+		return os.Getenv(backup.EnvPassphrase), nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase file: %w", err)
+	}
+	passphrase := strings.TrimRight(string(data), "\r\n")
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase file %s is empty", file)
+	}
+	return passphrase, nil
+}
+
+// BackupCreateCommand 把配置目录和 known_hosts 打包到 out；先写入 out.tmp，完成后改名
+func (c *CLI) BackupCreateCommand(out, passphraseFile string, asJSON bool) error {
+	passphrase, err := backupPassphrase(passphraseFile)
+	if err != nil {
+		return err
+	}
+	if passphrase == "" && !asJSON {
+		fmt.Fprintf(os.Stderr, "Warning: the backup is not encrypted and contains secret.key; use --passphrase-file or %s\n", backup.EnvPassphrase)
+	}
+
+	tmp := out + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	manifest, err := backup.Create(f, backup.DefaultSources(c.config.ConfigDir), passphrase)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if asJSON {
+		return json.NewEncoder(os.Stdout).Encode(manifest)
+	}
+	var size int64
+	for _, file := range manifest.Files {
+		size += file.Size
+	}
+	encrypted := ""
+	if manifest.Encrypted {
+		encrypted = ", encrypted"
+	}
+	fmt.Printf("Backed up %d file(s), %d bytes%s, to %s\n", len(manifest.Files), size, encrypted, out)
+	return nil
+}
+
+// BackupRestoreCommand 从 in 恢复配置目录并把 known_hosts 中的新行合并到本机
+func (c *CLI) BackupRestoreCommand(in, passphraseFile string, force, dryRun, asJSON bool) error {
+	passphrase, err := backupPassphrase(passphraseFile)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// 释放配置存储后再替换配置文件；首次运行生成的默认配置可以直接替换
+	c.manager.Close()
+	opts := backup.RestoreOptions{Passphrase: passphrase, Force: force || backup.Unconfigured(c.config), DryRun: dryRun}
+	result, err := backup.Restore(f, backup.DefaultSources(c.config.ConfigDir), opts)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return json.NewEncoder(os.Stdout).Encode(result)
+	}
+	m := result.Manifest
+	fmt.Printf("Backup of %s created %s (%d file(s))\n", m.Hostname, m.CreatedAt.Local().Format("2006-01-02 15:04:05"), len(m.Files))
+	if dryRun {
+		fmt.Println("Backup is intact; nothing was restored (--dry-run)")
+		return nil
+	}
+	for _, p := range result.Restored {
+		fmt.Printf("  restored %s\n", p)
+	}
+	for _, p := range result.Replaced {
+		fmt.Printf("  previous %s kept as %s.bak\n", p, filepath.Base(p))
+	}
+	if result.KnownHostsAdded > 0 {
+		fmt.Printf("  added %d known_hosts line(s)\n", result.KnownHostsAdded)
+	}
+	fmt.Println("Restart a running gmssh web to load the restored configuration")
+	return nil
+}
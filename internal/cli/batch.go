@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// 退出码，脚本和 CI 据此区分失败类型
+const (
+	ExitOK          = 0
+	ExitFailure     = 1  // 其他错误
+	ExitUsage       = 2  // 参数错误
+	ExitNotFound    = 3  // 配置中没有指定的服务器
+	ExitConnect     = 4  // 建立跳板链或认证失败，包括 server check 有服务器失败
+	ExitFailed      = 5  // 已连接但操作失败：传输出错、密钥轮换失败
+	ExitUnreachable = 6  // 探测的所有路径或追踪的目标都不可达
+	ExitTimeout     = 7  // 超过 --timeout
+	ExitInteractive = 8  // 需要确认，但处于 --batch 模式
+	ExitMaintenance = 9  // 目标或经过的服务器处于维护窗口
+	ExitPolicy      = 10 // 上传违反 upload.policy
+)
+
+// BatchOptions 非交互运行（CI、脚本）时的全局选项
+type BatchOptions struct {
+	Timeout time.Duration // 大于 0 时限制命令的运行时间
+	Batch   bool          // 从不等待输入，需要确认时直接失败
+	Quiet   bool          // 只在标准输出打印 JSON 结果，隐含 Batch
+}
+
+// codedError 带退出码的错误
+type codedError struct {
+	code int
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// withExitCode 为 err 指定退出码
+func withExitCode(code int, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+// ExitCode 返回 err 对应的退出码：nil 为 ExitOK，超时为 ExitTimeout，
+// 命令标明了失败类型时为对应的退出码，其他为 ExitFailure
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ExitTimeout
+	}
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	return ExitFailure
+}
+
+// SetBatchOptions 设置全局的批处理选项，须在执行命令前调用
+func (c *CLI) SetBatchOptions(opts BatchOptions) {
+	if opts.Quiet {
+		opts.Batch = true
+	}
+	c.batch = opts
+}
+
+// context 返回命令使用的 context，设置了 --timeout 时到期取消
+func (c *CLI) context() (context.Context, context.CancelFunc) {
+	if c.batch.Timeout > 0 {
+		return context.WithTimeout(context.Background(), c.batch.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// fail 以 code 标明命令失败的类型；ctx 已超时时改为 ExitTimeout
+func (c *CLI) fail(ctx context.Context, code int, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return withExitCode(ExitTimeout, fmt.Errorf("timed out after %s: %w", c.batch.Timeout, err))
+	}
+	return withExitCode(code, err)
+}
+
+// printf 输出进度和说明文字，--quiet 时不输出
+func (c *CLI) printf(format string, args ...interface{}) {
+	if !c.batch.Quiet {
+		fmt.Printf(format, args...)
+	}
+}
+
+// printJSON 以缩进的 JSON 输出到标准输出
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
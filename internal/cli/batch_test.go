@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExitCode(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	c := &CLI{batch: BatchOptions{Timeout: time.Nanosecond}}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, ExitOK},
+		{"plain error", errors.New("boom"), ExitFailure},
+		{"coded", withExitCode(ExitNotFound, errors.New("missing")), ExitNotFound},
+		{"wrapped coded", fmt.Errorf("upload: %w", withExitCode(ExitConnect, errors.New("refused"))), ExitConnect},
+		{"deadline", fmt.Errorf("dial: %w", context.DeadlineExceeded), ExitTimeout},
+		{"coded deadline", withExitCode(ExitConnect, context.DeadlineExceeded), ExitTimeout},
+		{"failed after timeout", c.fail(ctx, ExitFailed, errors.New("broken pipe")), ExitTimeout},
+		{"failed", c.fail(context.Background(), ExitFailed, errors.New("broken pipe")), ExitFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindAddrBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		addr        string
+		allowLAN    bool
+		interactive bool
+		want        string
+		code        int
+	}{
+		{"loopback", ":8080", false, false, "127.0.0.1:8080", ExitOK},
+		{"lan without flag", "0.0.0.0:8080", false, false, "", ExitFailure},
+		{"lan needs confirmation", "0.0.0.0:8080", true, false, "", ExitInteractive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bindAddr(tt.addr, tt.allowLAN, tt.interactive)
+			if got != tt.want || ExitCode(err) != tt.code {
+				t.Errorf("bindAddr = %q, %v (exit %d), want %q (exit %d)", got, err, ExitCode(err), tt.want, tt.code)
+			}
+		})
+	}
+}
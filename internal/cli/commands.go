@@ -1,17 +1,29 @@
 package cli
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/internal/keys"
 	"github.com/luobobo896/HSSH/internal/profiler"
 	"github.com/luobobo896/HSSH/internal/proxy"
 	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/teamsync"
 	"github.com/luobobo896/HSSH/internal/transfer"
+	"github.com/luobobo896/HSSH/internal/usage"
 	"github.com/luobobo896/HSSH/pkg/types"
 )
 
@@ -20,6 +32,7 @@ type CLI struct {
 	config  *types.Config
 	manager *config.Manager
 	profiler *profiler.NetworkProfiler
+	batch   BatchOptions
 }
 
 // NewCLI 创建新的 CLI 实例
@@ -41,12 +54,52 @@ func NewCLI() (*CLI, error) {
 	}, nil
 }
 
+// Config 返回已加载的配置
+func (c *CLI) Config() *types.Config {
+	return c.config
+}
+
+// UploadOptions 上传命令选项
+type UploadOptions struct {
+	Delta bool // 单个文件只发送与远端旧文件不同的部分
+	// Mode 上传模式：tunnel（默认）、relay、stage 或 compare，见 transfer.ModeRelay、transfer.ModeStage
+	Mode string
+	// Confirm 目标服务器的环境策略要求确认上传时，须为目标服务器的名称
+	Confirm string
+	// Retries 连接断开或传输失败后重新连接并续传的次数（tunnel 模式）
+	Retries int
+	// RetryDelay 两次重试之间的等待时间
+	RetryDelay time.Duration
+}
+
+// DefaultRetryDelay --retry-delay 的默认值
+const DefaultRetryDelay = 5 * time.Second
+
+// UploadResult --quiet 时上传命令输出的结果
+type UploadResult struct {
+	Source     string                 `json:"source"`
+	Target     string                 `json:"target"`
+	Bytes      int64                  `json:"bytes"`
+	Files      int                    `json:"files"`
+	DurationMs int64                  `json:"duration_ms"`
+	SpeedMBps  float64                `json:"speed_mbps"`
+	Delta      *transfer.DeltaResult  `json:"delta,omitempty"`
+	Mode       string                 `json:"mode,omitempty"`
+	Modes      []types.ModeThroughput `json:"modes,omitempty"` // --mode compare 时各模式的吞吐
+}
+
 // UploadCommand 上传命令
-func (c *CLI) UploadCommand(source, target string, via []string) error {
+func (c *CLI) UploadCommand(source, target string, via []string, opts UploadOptions) (err error) {
+	defer func(start time.Time) { c.notifyTask("upload "+source+" -> "+target, start, err) }(time.Now())
+
+	if transfer.IsObjectURL(target) {
+		return c.uploadObject(source, target, via)
+	}
+
 	// 解析目标路径
 	targetParts := strings.SplitN(target, ":", 2)
 	if len(targetParts) != 2 {
-		return fmt.Errorf("invalid target format, expected host:path")
+		return withExitCode(ExitUsage, fmt.Errorf("invalid target format, expected host:path"))
 	}
 	targetHost := targetParts[0]
 	targetPath := targetParts[1]
@@ -56,7 +109,7 @@ func (c *CLI) UploadCommand(source, target string, via []string) error {
 	for _, hopName := range via {
 		hop := c.config.GetHopByName(hopName)
 		if hop == nil {
-			return fmt.Errorf("hop '%s' not found in config", hopName)
+			return withExitCode(ExitNotFound, fmt.Errorf("hop '%s' not found in config", hopName))
 		}
 		hops = append(hops, hop)
 	}
@@ -64,238 +117,1564 @@ func (c *CLI) UploadCommand(source, target string, via []string) error {
 	// 添加目标主机
 	targetHop := c.config.GetHopByName(targetHost)
 	if targetHop == nil {
-		return fmt.Errorf("target host '%s' not found in config", targetHost)
+		return withExitCode(ExitNotFound, fmt.Errorf("target host '%s' not found in config", targetHost))
 	}
 	hops = append(hops, targetHop)
+	if err := c.checkMaintenance(hops); err != nil {
+		return err
+	}
+	if err := c.confirmEnvironment(targetHop, types.OpUpload, opts.Confirm); err != nil {
+		return err
+	}
+	if err := c.checkUploadPolicy(targetHop, source, targetPath); err != nil {
+		return err
+	}
+	mode, err := transfer.ParseUploadMode(opts.Mode)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	if mode != transfer.ModeTunnel {
+		if err := relayUsage(source, hops, opts); err != nil {
+			return withExitCode(ExitUsage, err)
+		}
+		return c.uploadRelay(source, target, targetPath, hops, via, mode)
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	// 任务日志：中断后以相同参数重新运行时跳过已完成的文件，未完成的续传；增量上传自行比较远端文件，不使用日志
+	var journal *transfer.Journal
+	if !opts.Delta && c.config.ConfigDir != "" {
+		abs, _ := filepath.Abs(source)
+		path := transfer.JournalPath(filepath.Join(c.config.ConfigDir, "tasks"), "upload", abs, target, strings.Join(via, ","))
+		if journal, err = transfer.OpenJournal(path, "upload "+abs+" -> "+target); err != nil {
+			return fmt.Errorf("failed to open task journal: %w", err)
+		}
+		if journal.Resuming() {
+			c.printf("Resuming an interrupted upload (journal %s)\n", path)
+		}
+	}
+
+	result := UploadResult{Source: source, Target: target}
+	completed := make(map[string]bool)
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		var code int
+		code, err = c.uploadAttempt(ctx, source, targetPath, hops, via, targetHop, journal, opts.Delta, &result, completed)
+		if err == nil {
+			break
+		}
+		if attempt >= opts.Retries || ctx.Err() != nil {
+			if journal != nil {
+				c.printf("Rerun the same command to resume the upload\n")
+			}
+			return c.fail(ctx, code, err)
+		}
+		delay := opts.RetryDelay
+		if delay <= 0 {
+			delay = DefaultRetryDelay
+		}
+		c.printf("\n%v; retrying in %s (%d/%d)\n", err, delay, attempt+1, opts.Retries)
+		select {
+		case <-ctx.Done():
+			return c.fail(ctx, code, err)
+		case <-time.After(delay):
+		}
+	}
+	if err := journal.Remove(); err != nil {
+		c.printf("Warning: failed to remove task journal: %v\n", err)
+	}
+	c.touchRecent(types.RecentUpload, targetHop, targetPath, via)
+
+	if c.batch.Quiet {
+		elapsed := time.Since(start)
+		result.DurationMs = elapsed.Milliseconds()
+		result.Files = max(len(completed), 1)
+		if elapsed > 0 {
+			result.SpeedMBps = float64(result.Bytes) / 1024 / 1024 / elapsed.Seconds()
+		}
+		return printJSON(result)
+	}
+	if d := result.Delta; d != nil {
+		if d.Delta {
+			fmt.Printf("Delta upload: sent %.2f of %.2f MB, reused %d block(s) of %d KB\n",
+				float64(d.Sent)/1024/1024, float64(d.Size)/1024/1024, d.Matched, d.BlockSize/1024)
+		} else {
+			fmt.Printf("Full copy instead of delta: %s\n", d.Reason)
+		}
+	}
+	fmt.Println("Upload completed successfully")
+	return nil
+}
 
+// uploadAttempt 建立连接链并上传一次（tunnel 模式），失败时返回对应的退出码
+func (c *CLI) uploadAttempt(ctx context.Context, source, targetPath string, hops []*types.Hop, via []string, targetHop *types.Hop,
+	journal *transfer.Journal, delta bool, result *UploadResult, completed map[string]bool) (int, error) {
 	// 建立连接链
 	chain := ssh.NewChain(hops)
-	fmt.Printf("Connecting via: %s -> %s\n", strings.Join(via, " -> "), targetHost)
-	if err := chain.Connect(); err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+	c.printf("Connecting via: %s -> %s\n", strings.Join(via, " -> "), targetHop.Name)
+	if err := chain.ConnectContext(ctx); err != nil {
+		return ExitConnect, fmt.Errorf("failed to connect: %w", err)
 	}
 	defer chain.Disconnect()
 
 	// 创建传输器
 	scp := transfer.NewSCPTransfer(chain)
+	scp.SetSpeedWindow(c.config.Upload.SpeedWindow)
+	scp.SetBackups(func(remoteFile string) int { return c.config.Upload.BackupKeep(targetHop, remoteFile) })
+	scp.SetSudo(transfer.SudoFor(&c.config.Upload.Sudo, targetHop, c.sudoPrompt()))
+	scp.SetJournal(journal)
 
 	// 进度通道
-	progress := make(chan *types.TransferProgress, 10)
+	progress := transfer.NewProgressPublisher()
+	done := make(chan struct{})
 	go func() {
-		for p := range progress {
+		defer close(done)
+		for p := range progress.Updates() {
+			// 目录上传：逐个打印已结束的文件，进度行显示整个目录
+			for _, f := range p.Files {
+				switch f.Status {
+				case "completed":
+					completed[f.Name] = true
+					c.printf("\r  ✓ %s (%.2f MB)\n", f.Name, float64(f.Size)/1024/1024)
+				case "failed":
+					c.printf("\r  ✗ %s: %s\n", f.Name, f.Error)
+				}
+			}
 			if p.Status == "completed" {
-				fmt.Printf("\r✓ %s uploaded (%.2f MB)\n", p.FileName, float64(p.TotalBytes)/1024/1024)
+				result.Bytes = p.TotalBytes
+				c.printf("\r✓ %s uploaded (%.2f MB)\n", p.FileName, float64(p.TotalBytes)/1024/1024)
 			} else if p.Status == "running" {
-				fmt.Printf("\r%s: %.1f%% (%.2f MB/s)", p.FileName, p.Percentage(), float64(p.Speed)/1024/1024)
+				// 行尾留空格覆盖上一行更长的输出
+				c.printf("\r%s: %.1f%% %.2f MB/s (now %.2f, avg %.2f) ETA %s   ", p.FileName, p.Percentage(),
+					float64(p.Speed)/1024/1024, float64(p.InstantSpeed)/1024/1024, float64(p.AverageSpeed)/1024/1024,
+					p.ETA.Round(time.Second))
 			}
 		}
 	}()
 
 	// 执行上传
-	fmt.Printf("Uploading %s to %s:%s\n", source, targetHost, targetPath)
-	if err := scp.Upload(source, targetPath, progress); err != nil {
-		return fmt.Errorf("upload failed: %w", err)
+	c.printf("Uploading %s to %s:%s\n", source, targetHop.Name, targetPath)
+	var err error
+	if delta {
+		result.Delta, err = scp.UploadDelta(ctx, source, targetPath, progress.Chan())
+	} else {
+		err = scp.UploadContext(ctx, source, targetPath, progress.Chan())
 	}
-
-	close(progress)
-	time.Sleep(100 * time.Millisecond) // 等待最后的进度输出
-
-	fmt.Println("Upload completed successfully")
-	return nil
+	progress.Close()
+	<-done // 等待最后的进度输出
+	if err != nil {
+		return ExitFailed, fmt.Errorf("upload failed: %w", err)
+	}
+	return 0, nil
 }
 
-// ProxyCommand 端口转发命令
-func (c *CLI) ProxyCommand(localAddr, remoteHost string, remotePort int, via []string) error {
-	// 构建路径
+// uploadObject 上传到对象存储：target 为 s3://bucket/key@server、oss://bucket/key@server 或预签名 URL@server，
+// 文件经链送到 server，由其上的 aws、ossutil 或 curl 上传
+func (c *CLI) uploadObject(source, target string, via []string) error {
+	object, err := transfer.ParseObjectTarget(target)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
 	var hops []*types.Hop
-	for _, hopName := range via {
+	for _, hopName := range append(append([]string{}, via...), object.Server) {
 		hop := c.config.GetHopByName(hopName)
 		if hop == nil {
-			return fmt.Errorf("hop '%s' not found in config", hopName)
+			return withExitCode(ExitNotFound, fmt.Errorf("hop '%s' not found in config", hopName))
 		}
 		hops = append(hops, hop)
 	}
+	targetHop := hops[len(hops)-1]
+	if err := c.checkMaintenance(hops); err != nil {
+		return err
+	}
+	if err := c.checkUploadPolicy(targetHop, source, target); err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
 
-	// 建立连接链
 	chain := ssh.NewChain(hops)
-	fmt.Printf("Connecting via: %s\n", strings.Join(via, " -> "))
-	if err := chain.Connect(); err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+	c.printf("Connecting via: %s -> %s\n", strings.Join(via, " -> "), object.Server)
+	if err := chain.ConnectContext(ctx); err != nil {
+		return c.fail(ctx, ExitConnect, fmt.Errorf("failed to connect: %w", err))
 	}
+	defer chain.Disconnect()
 
-	// 创建转发器
-	forwarder := proxy.NewPortForwarder(chain, localAddr, remoteHost, remotePort)
+	scp := transfer.NewSCPTransfer(chain)
+	scp.SetSpeedWindow(c.config.Upload.SpeedWindow)
 
-	fmt.Printf("Starting port forward: %s -> %s:%d\n", localAddr, remoteHost, remotePort)
-	fmt.Println("Press Ctrl+C to stop")
+	result := UploadResult{Source: source, Target: object.Redacted()}
+	progress := transfer.NewProgressPublisher()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for p := range progress.Updates() {
+			if p.Status == "completed" {
+				result.Bytes = p.TotalBytes
+				c.printf("\r✓ %s uploaded (%.2f MB)\n", p.FileName, float64(p.TotalBytes)/1024/1024)
+			} else if p.Status == "running" {
+				c.printf("\r%s: %.1f%% %.2f MB/s ETA %s   ", p.FileName, p.Percentage(),
+					float64(p.Speed)/1024/1024, p.ETA.Round(time.Second))
+			}
+		}
+	}()
 
-	if err := forwarder.Start(); err != nil {
-		chain.Disconnect()
-		return err
+	c.printf("Uploading %s to %s with %s on %s\n", source, object.Redacted(), object.Tool(), object.Server)
+	start := time.Now()
+	err = scp.UploadObject(ctx, source, object, progress.Chan())
+	progress.Close()
+	<-done
+	if err != nil {
+		return c.fail(ctx, ExitFailed, fmt.Errorf("upload failed: %w", err))
 	}
+	c.touchRecent(types.RecentUpload, targetHop, object.Redacted(), via)
 
-	// 等待中断信号
-	sigChan := make(chan os.Signal, 1)
-	// signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	if c.batch.Quiet {
+		elapsed := time.Since(start)
+		result.DurationMs = elapsed.Milliseconds()
+		result.Files = 1
+		if elapsed > 0 {
+			result.SpeedMBps = float64(result.Bytes) / 1024 / 1024 / elapsed.Seconds()
+		}
+		return printJSON(result)
+	}
+	fmt.Println("Upload completed successfully")
+	return nil
+}
 
-	fmt.Println("\nStopping port forward...")
-	forwarder.Stop()
-	chain.Disconnect()
+// DownloadOptions 下载命令选项
+type DownloadOptions struct {
+	Streams  int    // 目录下载并行的 tar 流数
+	Verify   bool   // 下载后比对远端 sha256
+	Manifest string // 目录下载时写入完整性清单的路径
+}
 
-	return nil
+// DownloadResult --quiet 时下载命令输出的结果
+type DownloadResult struct {
+	Source     string   `json:"source"`
+	Target     string   `json:"target"`
+	Bytes      int64    `json:"bytes"`
+	Files      int      `json:"files"`
+	Streams    int      `json:"streams,omitempty"`
+	Verified   bool     `json:"verified"`
+	Changed    []string `json:"changed,omitempty"`
+	DurationMs int64    `json:"duration_ms"`
+	SpeedMBps  float64  `json:"speed_mbps"`
 }
 
-// ProbeCommand 探测命令
-func (c *CLI) ProbeCommand(target string, via []string) error {
-	ctx := context.Background()
+// DownloadCommand 下载命令：source 为 host:path，目录按文件列表拆成多个 tar 流并行拉取
+func (c *CLI) DownloadCommand(source, target string, via []string, opts DownloadOptions) (err error) {
+	defer func(start time.Time) { c.notifyTask("download "+source+" -> "+target, start, err) }(time.Now())
 
-	// 构建直连路径
-	targetHop := c.config.GetHopByName(target)
-	if targetHop == nil {
-		return fmt.Errorf("target host '%s' not found in config", target)
+	sourceParts := strings.SplitN(source, ":", 2)
+	if len(sourceParts) != 2 {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid source format, expected host:path"))
 	}
-	directPath := []*types.Hop{targetHop}
+	sourceHost := sourceParts[0]
+	sourcePath := sourceParts[1]
 
-	// 构建经跳板路径
-	var viaPath []*types.Hop
+	// 构建路径
+	var hops []*types.Hop
 	for _, hopName := range via {
 		hop := c.config.GetHopByName(hopName)
 		if hop == nil {
-			return fmt.Errorf("hop '%s' not found in config", hopName)
+			return withExitCode(ExitNotFound, fmt.Errorf("hop '%s' not found in config", hopName))
 		}
-		viaPath = append(viaPath, hop)
+		hops = append(hops, hop)
+	}
+	sourceHop := c.config.GetHopByName(sourceHost)
+	if sourceHop == nil {
+		return withExitCode(ExitNotFound, fmt.Errorf("source host '%s' not found in config", sourceHost))
+	}
+	hops = append(hops, sourceHop)
+	if err := c.checkMaintenance(hops); err != nil {
+		return err
 	}
-	viaPath = append(viaPath, targetHop)
 
-	// 比较两条路径
-	fmt.Println("Probing network paths...")
-	fmt.Println()
+	ctx, cancel := c.context()
+	defer cancel()
 
-	// 探测直连
-	fmt.Printf("Direct: localhost -> %s\n", target)
-	directReport, err := c.profiler.Probe(ctx, directPath)
-	if err != nil {
-		fmt.Printf("  Error: %v\n", err)
-	} else if directReport.Success {
-		fmt.Printf("  Latency: %v\n", directReport.Latency)
-	} else {
-		fmt.Printf("  Failed: %s\n", directReport.Error)
+	chain := ssh.NewChain(hops)
+	c.printf("Connecting via: %s -> %s\n", strings.Join(via, " -> "), sourceHost)
+	if err := chain.ConnectContext(ctx); err != nil {
+		return c.fail(ctx, ExitConnect, fmt.Errorf("failed to connect: %w", err))
 	}
-	fmt.Println()
+	defer chain.Disconnect()
 
-	// 探测经跳板
-	viaStr := strings.Join(via, " -> ")
-	fmt.Printf("Via %s: localhost -> %s -> %s\n", viaStr, viaStr, target)
-	viaReport, err := c.profiler.Probe(ctx, viaPath)
+	scp := transfer.NewSCPTransfer(chain)
+	scp.SetSpeedWindow(c.config.Upload.SpeedWindow)
+	isDir, err := scp.RemoteIsDir(ctx, sourcePath)
 	if err != nil {
-		fmt.Printf("  Error: %v\n", err)
-	} else if viaReport.Success {
-		fmt.Printf("  Latency: %v\n", viaReport.Latency)
-	} else {
-		fmt.Printf("  Failed: %s\n", viaReport.Error)
+		return c.fail(ctx, ExitFailed, err)
 	}
-	fmt.Println()
 
-	// 推荐
-	if directReport.Success && viaReport.Success {
-		if directReport.Latency < viaReport.Latency {
-			diff := viaReport.Latency - directReport.Latency
-			fmt.Printf("Recommendation: Direct path is faster by %v\n", diff)
-		} else {
-			diff := directReport.Latency - viaReport.Latency
-			fmt.Printf("Recommendation: Via %s is faster by %v\n", viaStr, diff)
+	progress := transfer.NewProgressPublisher()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for p := range progress.Updates() {
+			if p.Status == "running" {
+				c.printf("\r%s: %.1f%% %.2f MB/s ETA %s   ", p.FileName, p.Percentage(),
+					float64(p.Speed)/1024/1024, p.ETA.Round(time.Second))
+			}
+		}
+	}()
+
+	result := DownloadResult{Source: source, Target: target, Files: 1}
+	start := time.Now()
+	if isDir {
+		c.printf("Downloading %s from %s in up to %d parallel streams\n", sourcePath, sourceHost, max(opts.Streams, 1))
+		var manifest *transfer.Manifest
+		manifest, err = scp.DownloadDirParallel(ctx, sourcePath, target, transfer.ParallelOptions{Streams: opts.Streams, Verify: opts.Verify}, progress.Chan())
+		if manifest != nil {
+			result.Bytes, result.Files, result.Streams = manifest.Bytes, len(manifest.Files), manifest.Streams
+			result.Verified, result.Changed = manifest.Verified, manifest.Changed
+			if opts.Manifest != "" && err == nil {
+				err = manifest.WriteFile(opts.Manifest)
+			}
 		}
-	} else if directReport.Success {
-		fmt.Println("Recommendation: Use direct path (via path failed)")
-	} else if viaReport.Success {
-		fmt.Printf("Recommendation: Use via %s (direct path failed)\n", viaStr)
 	} else {
-		fmt.Println("Both paths failed")
+		c.printf("Downloading %s from %s\n", sourcePath, sourceHost)
+		err = scp.DownloadContext(ctx, sourcePath, target, progress.Chan())
+		if info, statErr := os.Stat(target); statErr == nil {
+			result.Bytes = info.Size()
+		}
+	}
+	progress.Close()
+	<-done
+	if err != nil {
+		return c.fail(ctx, ExitFailed, fmt.Errorf("download failed: %w", err))
 	}
 
+	elapsed := time.Since(start)
+	result.DurationMs = elapsed.Milliseconds()
+	if elapsed > 0 {
+		result.SpeedMBps = float64(result.Bytes) / 1024 / 1024 / elapsed.Seconds()
+	}
+	if c.batch.Quiet {
+		return printJSON(result)
+	}
+	fmt.Printf("\r✓ %s downloaded: %d file(s), %.2f MB in %s (%.2f MB/s)\n", source, result.Files,
+		float64(result.Bytes)/1024/1024, elapsed.Round(time.Millisecond), result.SpeedMBps)
+	if len(result.Changed) > 0 {
+		fmt.Printf("  %d file(s) changed while downloading, first: %s\n", len(result.Changed), result.Changed[0])
+	}
+	if result.Verified {
+		fmt.Println("  checksums verified against the remote")
+	}
 	return nil
 }
 
-// StatusCommand 状态命令
-func (c *CLI) StatusCommand() error {
-	fmt.Println("=== HSSH Status ===")
-	fmt.Println()
+// FetchDirOptions fetch-dir 命令选项
+type FetchDirOptions struct {
+	RemoteTemp string // 远端存放压缩包的目录，为空时为 $TMPDIR 或 /tmp
+}
 
-	// 显示配置的服务器
-	fmt.Printf("Configured servers: %d\n", len(c.config.Hops))
-	for _, hop := range c.config.Hops {
-		fmt.Printf("  - %s (%s@%s:%d) [%s]\n", hop.Name, hop.User, hop.Host, hop.Port, hop.AuthType)
+// FetchDirCommand 在远端把目录打包压缩后整体下载：target 为空时保存为当前目录下的 <目录名>.tar.gz，
+// 为已存在的目录时保存到其中
+func (c *CLI) FetchDirCommand(source, target string, via []string, opts FetchDirOptions) (err error) {
+	defer func(start time.Time) { c.notifyTask("fetch-dir "+source, start, err) }(time.Now())
+
+	sourceParts := strings.SplitN(source, ":", 2)
+	if len(sourceParts) != 2 || sourceParts[1] == "" {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid source format, expected host:path"))
+	}
+	sourceHost := sourceParts[0]
+	sourcePath := sourceParts[1]
+	if target == "" {
+		target = transfer.ArchiveName(sourcePath)
+	} else if info, err := os.Stat(target); err == nil && info.IsDir() {
+		target = filepath.Join(target, transfer.ArchiveName(sourcePath))
 	}
-	fmt.Println()
 
-	// 显示路由配置
-	fmt.Printf("Route preferences: %d\n", len(c.config.Routes))
-	for _, route := range c.config.Routes {
-		via := "direct"
-		if route.Via != "" {
-			via = route.Via
+	var hops []*types.Hop
+	for _, hopName := range append(append([]string{}, via...), sourceHost) {
+		hop := c.config.GetHopByName(hopName)
+		if hop == nil {
+			return withExitCode(ExitNotFound, fmt.Errorf("hop '%s' not found in config", hopName))
 		}
-		fmt.Printf("  - %s -> %s via %s (threshold: %dms)\n", route.From, route.To, via, route.Threshold)
+		hops = append(hops, hop)
+	}
+	if err := c.checkMaintenance(hops); err != nil {
+		return err
 	}
-	fmt.Println()
 
-	// 显示预设配置
-	fmt.Printf("Profiles: %d\n", len(c.config.Profiles))
-	for _, profile := range c.config.Profiles {
-		fmt.Printf("  - %s: %s\n", profile.Name, strings.Join(profile.Path, " -> "))
+	ctx, cancel := c.context()
+	defer cancel()
+
+	chain := ssh.NewChain(hops)
+	c.printf("Connecting via: %s -> %s\n", strings.Join(via, " -> "), sourceHost)
+	if err := chain.ConnectContext(ctx); err != nil {
+		return c.fail(ctx, ExitConnect, fmt.Errorf("failed to connect: %w", err))
+	}
+	defer chain.Disconnect()
+
+	scp := transfer.NewSCPTransfer(chain)
+	scp.SetSpeedWindow(c.config.Upload.SpeedWindow)
+
+	progress := transfer.NewProgressPublisher()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for p := range progress.Updates() {
+			if p.Status == "running" && p.TotalBytes > 0 {
+				c.printf("\r%s: %.1f%% %.2f MB/s ETA %s   ", p.FileName, p.Percentage(),
+					float64(p.Speed)/1024/1024, p.ETA.Round(time.Second))
+			}
+		}
+	}()
+
+	c.printf("Archiving %s on %s\n", sourcePath, sourceHost)
+	start := time.Now()
+	result, err := scp.FetchDir(ctx, sourcePath, target, transfer.FetchOptions{RemoteTemp: opts.RemoteTemp}, progress.Chan())
+	progress.Close()
+	<-done
+	if err != nil {
+		return c.fail(ctx, ExitFailed, fmt.Errorf("fetch-dir failed: %w", err))
 	}
 
+	if c.batch.Quiet {
+		return printJSON(result)
+	}
+	fmt.Printf("\r✓ %s saved as %s: %.2f MB (directory uses %.2f MB) in %s\n", source, target,
+		float64(result.Bytes)/1024/1024, float64(result.DirBytes)/1024/1024, time.Since(start).Round(time.Millisecond))
 	return nil
 }
 
-// ServerAddCommand 添加服务器命令
-func (c *CLI) ServerAddCommand(hop *types.Hop) error {
-	if err := c.manager.AddHop(hop); err != nil {
+// ProxyCommand 端口转发命令：localAddr 可以是端口范围（如 127.0.0.1:9000-9010），按顺序与远端目标配对；
+// 远端目标来自 targets 和 targetsFile（每行一个）。所有转发共用一条 SSH 链，Ctrl+C 时一起停止
+func (c *CLI) ProxyCommand(localAddr string, targets []string, targetsFile string, via []string, allowLAN bool) error {
+	if targetsFile != "" {
+		specs, err := readProxyTargets(targetsFile)
+		if err != nil {
+			return withExitCode(ExitUsage, fmt.Errorf("failed to read targets file: %w", err))
+		}
+		targets = append(targets, specs...)
+	}
+	remotes, err := parseProxyTargets(targets)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	localAddr, err = bindAddr(localAddr, allowLAN, !c.batch.Batch)
+	if err != nil {
 		return err
 	}
-	fmt.Printf("Server '%s' added successfully\n", hop.Name)
+	pairs, err := proxyPairs(localAddr, remotes)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+
+	// 构建路径
+	var hops []*types.Hop
+	for _, hopName := range via {
+		hop := c.config.GetHopByName(hopName)
+		if hop == nil {
+			return withExitCode(ExitNotFound, fmt.Errorf("hop '%s' not found in config", hopName))
+		}
+		hops = append(hops, hop)
+	}
+
+	// 建立连接链，--timeout 只限制建立连接，不限制转发的时长
+	ctx, cancel := c.context()
+	defer cancel()
+	chain := ssh.NewChain(hops)
+	fmt.Printf("Connecting via: %s\n", strings.Join(via, " -> "))
+	if err := chain.ConnectContext(ctx); err != nil {
+		return c.fail(ctx, ExitConnect, fmt.Errorf("failed to connect: %w", err))
+	}
+
+	// 每个监听地址一个转发器，部分失败时其余照常转发
+	listeners := startProxyForwards(chain, pairs)
+	printProxyTable(os.Stdout, listeners)
+	var forwarders []*proxy.PortForwarder
+	for _, l := range listeners {
+		if l.forwarder != nil {
+			forwarders = append(forwarders, l.forwarder)
+		}
+	}
+	if len(forwarders) == 0 {
+		chain.Disconnect()
+		return fmt.Errorf("no port forward could be started")
+	}
+	fmt.Println("Press Ctrl+C to stop")
+
+	// 中间某一跳断开时按退避策略重连，转发在重连后继续
+	chain.Subscribe(printChainEvent)
+	chain.Supervise(context.Background(), ssh.DefaultReconnectPolicy())
+
+	// 等待中断信号
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	<-sigChan
+
+	fmt.Printf("\nStopping %d port forward(s)...\n", len(forwarders))
+	for _, forwarder := range forwarders {
+		forwarder.Stop()
+	}
+	chain.Disconnect()
+
 	return nil
 }
 
-// ServerListCommand 列出服务器命令
-func (c *CLI) ServerListCommand() error {
-	if len(c.config.Hops) == 0 {
-		fmt.Println("No servers configured")
-		return nil
+// printChainEvent 在终端上提示链路的断开和重连
+func printChainEvent(event ssh.ChainEvent) {
+	switch event.Kind {
+	case ssh.ChainLost:
+		fmt.Fprintf(os.Stderr, "Connection lost at %s: %v; reconnecting in %s\n", event.Hop, event.Err, event.Next.Round(time.Second))
+	case ssh.ChainRetry:
+		fmt.Fprintf(os.Stderr, "Reconnect attempt %d failed: %v; retrying in %s\n", event.Attempt, event.Err, event.Next.Round(time.Second))
+	case ssh.ChainRestored:
+		fmt.Fprintf(os.Stderr, "Reconnected after %d attempt(s), forwarding resumed\n", event.Attempt)
+	case ssh.ChainGaveUp:
+		fmt.Fprintf(os.Stderr, "Giving up after %d attempt(s): %v\n", event.Attempt, event.Err)
 	}
+}
 
-	fmt.Printf("%-15s %-20s %-10s %-15s %-10s\n", "NAME", "HOST", "PORT", "USER", "AUTH")
-	fmt.Println(strings.Repeat("-", 80))
-	for _, hop := range c.config.Hops {
-		fmt.Printf("%-15s %-20s %-10d %-15s %-10s\n", hop.Name, hop.Host, hop.Port, hop.User, hop.AuthType)
+// bindAddr 按监听策略检查本地监听地址：没有主机时只监听 127.0.0.1；
+// 本机以外可访问的地址需要 --allow-lan 并在终端上确认，interactive 为 false（--batch）时无法确认，直接失败
+func bindAddr(localAddr string, allowLAN, interactive bool) (string, error) {
+	addr := proxy.NormalizeBindAddr(localAddr)
+	if allowLAN && proxy.ExposesLAN(addr) && !interactive {
+		return "", withExitCode(ExitInteractive, fmt.Errorf("listening on %s needs confirmation, which is not possible in batch mode", addr))
 	}
-	return nil
+	confirmed := allowLAN && proxy.ExposesLAN(addr) && confirmLAN(addr)
+	addr, err := proxy.CheckBind(addr, allowLAN, confirmed)
+	if errors.Is(err, proxy.ErrLANBindDisabled) {
+		return "", fmt.Errorf("%w (pass --allow-lan to expose it)", err)
+	}
+	return addr, err
+}
+
+// confirmLAN 询问是否把转发暴露给其他机器，只有输入 y/yes 时返回 true
+func confirmLAN(addr string) bool {
+	fmt.Printf("%s will be reachable from other machines. Continue? [y/N] ", addr)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
 
-// ServerDeleteCommand 删除服务器命令
-func (c *CLI) ServerDeleteCommand(name string) error {
-	if err := c.manager.DeleteHop(name); err != nil {
+// ProbeCommand 并发探测直连和每条 --via 路径到 target 的延迟，按延迟排序输出对比表
+// viaChains 中每一项是一条跳板链（按顺序的服务器名称），count 为每条路径的探测次数；所有路径都不可达时返回错误
+func (c *CLI) ProbeCommand(target string, viaChains [][]string, count int, asJSON bool) error {
+	candidates, err := c.probeCandidates(target, viaChains)
+	if err != nil {
 		return err
 	}
-	fmt.Printf("Server '%s' deleted successfully\n", name)
+
+	if count <= 0 {
+		count = profiler.DefaultProbeCount
+	}
+	if !asJSON {
+		fmt.Printf("Probing %d paths to %s (%d probes each)...\n\n", len(candidates), target, count)
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	results := c.profiler.ProbeCandidates(ctx, candidates, count)
+
+	best := results[0]
+	if asJSON {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+		if !best.Reachable() {
+			return c.fail(ctx, ExitUnreachable, fmt.Errorf("all paths to %s failed", target))
+		}
+		return nil
+	}
+
+	printProbeTable(os.Stdout, results)
+	printDialAttempts(os.Stdout, results)
+	fmt.Println()
+	switch {
+	case !best.Reachable():
+		return c.fail(ctx, ExitUnreachable, fmt.Errorf("all paths to %s failed", target))
+	case len(results) > 1 && results[1].Reachable():
+		fmt.Printf("Recommendation: %s (faster than %s by %v)\n", best.Label, results[1].Label,
+			(results[1].Latency - best.Latency).Round(time.Millisecond))
+	default:
+		fmt.Printf("Recommendation: %s (only reachable path)\n", best.Label)
+	}
 	return nil
 }
 
-// ValidatePath 验证路径是否有效
-func (c *CLI) ValidatePath(hopNames []string) ([]*types.Hop, error) {
+// probeCandidates 直连和每条跳板链（服务器名称）到 target 的探测路径
+func (c *CLI) probeCandidates(target string, viaChains [][]string) ([]profiler.Candidate, error) {
+	targetHop := c.config.GetHopByName(target)
+	if targetHop == nil {
+		return nil, withExitCode(ExitNotFound, fmt.Errorf("target host '%s' not found in config", target))
+	}
+
+	candidates := []profiler.Candidate{{Label: "direct", Hops: []*types.Hop{targetHop}}}
+	for _, via := range viaChains {
+		var hops []*types.Hop
+		for _, hopName := range via {
+			hop := c.config.GetHopByName(hopName)
+			if hop == nil {
+				return nil, withExitCode(ExitNotFound, fmt.Errorf("hop '%s' not found in config", hopName))
+			}
+			hops = append(hops, hop)
+		}
+		candidates = append(candidates, profiler.Candidate{
+			Label: "via " + strings.Join(via, " -> "),
+			Hops:  append(hops, targetHop),
+		})
+	}
+	return candidates, nil
+}
+
+// printProbeTable 输出路径对比表，最优路径以 * 标记
+func printProbeTable(out io.Writer, results []*profiler.CandidateResult) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  PATH\tHOPS\tLATENCY\tMIN/MAX\tLOSS\tERROR")
+	for i, r := range results {
+		mark := " "
+		if i == 0 && r.Reachable() {
+			mark = "*"
+		}
+		latency, minMax := "-", "-"
+		if r.Reachable() {
+			latency = r.Latency.Round(time.Millisecond).String()
+			minMax = r.Min.Round(time.Millisecond).String() + "/" + r.Max.Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(tw, "%s %s\t%d\t%s\t%s\t%.0f%%\t%s\n", mark, r.Label, r.HopCount, latency, minMax, r.Loss*100, r.Error)
+	}
+	tw.Flush()
+}
+
+// printDialAttempts 第一跳解析出多个地址时，输出每个地址的连接耗时和最终使用的地址
+func printDialAttempts(out io.Writer, results []*profiler.CandidateResult) {
+	for _, r := range results {
+		if len(r.Dials) < 2 {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s first hop addresses:\n", r.Label)
+		for _, d := range r.Dials {
+			switch {
+			case d.Chosen:
+				fmt.Fprintf(out, "  * %s  %v\n", d.Addr, d.Latency.Round(time.Millisecond))
+			default:
+				fmt.Fprintf(out, "    %s  %v  %s\n", d.Addr, d.Latency.Round(time.Millisecond), d.Error)
+			}
+		}
+	}
+}
+
+// TCPingCommand 经跳板链最后一跳对 target:port 发起 TCP 连接，报告连接耗时和服务端 banner。
+// target 可以是配置中的服务器名称（未指定 via 时经它的网关链连接）或任意主机地址
+func (c *CLI) TCPingCommand(target string, port int, via []string, count int, asJSON bool) error {
+	if port <= 0 || port > 65535 {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid port %d", port))
+	}
+
+	host := target
 	var hops []*types.Hop
-	for _, name := range hopNames {
-		hop := c.config.GetHopByName(name)
+	for _, hopName := range via {
+		hop := c.config.GetHopByName(hopName)
 		if hop == nil {
-			return nil, fmt.Errorf("hop '%s' not found in config", name)
+			return withExitCode(ExitNotFound, fmt.Errorf("hop '%s' not found in config", hopName))
 		}
 		hops = append(hops, hop)
 	}
-	return hops, nil
+	if targetHop := c.config.GetHopByName(target); targetHop != nil {
+		host = targetHop.Host
+		if len(via) == 0 {
+			chain := c.config.GatewayChain(targetHop)
+			hops = chain[:len(chain)-1]
+		}
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	if !asJSON {
+		from := "localhost"
+		if len(hops) > 0 {
+			from = hops[len(hops)-1].Name
+		}
+		fmt.Printf("Connecting to %s from %s (%d attempts)...\n\n", addr, from, count)
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	result := profiler.TCPing(ctx, hops, addr, count)
+
+	if asJSON {
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	}
+	if !result.Reachable() {
+		return c.fail(ctx, ExitUnreachable, fmt.Errorf("%s is not reachable: %s", addr, result.Error))
+	}
+	if asJSON {
+		return nil
+	}
+	fmt.Printf("%s is reachable: %d/%d connected, avg %v (min %v, max %v)\n", addr, result.Received, result.Sent,
+		result.Latency.Round(time.Microsecond), result.Min.Round(time.Microsecond), result.Max.Round(time.Microsecond))
+	if result.Banner != "" {
+		fmt.Printf("Banner: %s\n", result.Banner)
+	}
+	return nil
 }
 
-// GetConfigDir 获取配置目录
+// TraceCommand 逐段追踪到 target 的路由：每一段在上一跳（第一段在本机）上运行 mtr/traceroute，
+// 再经上一跳 SSH 连接下一跳；未指定 via 时使用 target 的网关链
+func (c *CLI) TraceCommand(target string, via []string, asJSON bool) error {
+	targetHop := c.config.GetHopByName(target)
+	if targetHop == nil {
+		return withExitCode(ExitNotFound, fmt.Errorf("target host '%s' not found in config", target))
+	}
+
+	var hops []*types.Hop
+	for _, hopName := range via {
+		hop := c.config.GetHopByName(hopName)
+		if hop == nil {
+			return withExitCode(ExitNotFound, fmt.Errorf("hop '%s' not found in config", hopName))
+		}
+		hops = append(hops, hop)
+	}
+	if len(hops) == 0 {
+		hops = c.config.GatewayChain(targetHop)
+	} else {
+		hops = append(hops, targetHop)
+	}
+
+	if !asJSON {
+		fmt.Printf("Tracing %s through %d segments...\n\n", target, len(hops))
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	report := profiler.Trace(ctx, hops)
+
+	if asJSON {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+		if report.LastReachable != target {
+			return c.fail(ctx, ExitUnreachable, fmt.Errorf("%s was not reached", target))
+		}
+		return nil
+	}
+
+	for i, segment := range report.Segments {
+		fmt.Printf("[%d] %s -> %s (%s)", i+1, segment.From, segment.To, segment.ToHost)
+		if segment.Tool != "" {
+			fmt.Printf(" via %s", segment.Tool)
+		}
+		fmt.Println()
+		if segment.TraceError != "" {
+			fmt.Printf("    trace failed: %s\n", segment.TraceError)
+		}
+		for _, hop := range segment.Hops {
+			if hop.Host == "*" {
+				fmt.Printf("    %2d  *\n", hop.TTL)
+				continue
+			}
+			fmt.Printf("    %2d  %-16s %5.1fms  loss %.0f%%\n", hop.TTL, hop.Host, hop.AvgMs, hop.Loss*100)
+		}
+		if segment.Reached {
+			fmt.Println("    SSH: connected")
+		} else {
+			fmt.Printf("    SSH: failed: %s\n", segment.Error)
+		}
+		fmt.Println()
+	}
+
+	switch {
+	case report.LastReachable == "":
+		fmt.Println("No hop was reachable")
+	case report.LastReachable == target:
+		fmt.Printf("Reached %s\n", target)
+	default:
+		fmt.Printf("Last reachable hop: %s\n", report.LastReachable)
+	}
+	if report.LastReachable != target {
+		return c.fail(ctx, ExitUnreachable, fmt.Errorf("%s was not reached", target))
+	}
+	return nil
+}
+
+// StatusCommand 状态命令
+func (c *CLI) StatusCommand() error {
+	fmt.Println("=== HSSH Status ===")
+	fmt.Println()
+	fmt.Printf("Config storage: %s\n", c.manager.StoragePath())
+	fmt.Println()
+
+	// 显示配置的服务器
+	fmt.Printf("Configured servers: %d\n", len(c.config.Hops))
+	var legacy []string
+	for _, hop := range c.config.Hops {
+		fmt.Printf("  - %s (%s@%s:%d) [%s]", hop.Name, hop.User, hop.Host, hop.Port, hop.AuthType)
+		if hop.LegacyCrypto {
+			fmt.Print("  WARNING: legacy crypto enabled")
+			legacy = append(legacy, hop.Name)
+		}
+		fmt.Println()
+	}
+	if len(legacy) > 0 {
+		fmt.Printf("\nWARNING: deprecated SSH algorithms (sha1 key exchange, CBC ciphers, hmac-sha1, ssh-rsa) are allowed for: %s\n", strings.Join(legacy, ", "))
+		fmt.Println("Turn legacy_crypto off once those devices are upgraded.")
+	}
+	fmt.Println()
+
+	// 显示路由配置
+	fmt.Printf("Route preferences: %d\n", len(c.config.Routes))
+	for _, route := range c.config.Routes {
+		via := "direct"
+		if route.ViaID != "" {
+			via = c.hopName(route.ViaID)
+		}
+		fmt.Printf("  - %s -> %s via %s (threshold: %dms)\n", c.hopName(route.FromID), c.hopName(route.ToID), via, route.Threshold)
+	}
+	fmt.Println()
+
+	// 显示预设配置
+	fmt.Printf("Profiles: %d\n", len(c.config.Profiles))
+	for _, profile := range c.config.Profiles {
+		names := make([]string, len(profile.PathIDs))
+		for i, id := range profile.PathIDs {
+			names[i] = c.hopName(id)
+		}
+		fmt.Printf("  - %s: %s\n", profile.Name, strings.Join(names, " -> "))
+	}
+
+	// 显示 Portal 映射，提示暴露在本机以外的隧道
+	if mappings := c.config.Portal.Client.Mappings; len(mappings) > 0 {
+		fmt.Println()
+		fmt.Printf("Portal mappings: %d\n", len(mappings))
+		for _, m := range mappings {
+			fmt.Printf("  - %s: %s -> %s", m.Name, m.LocalAddr, proxy.TargetAddr(m.RemoteHost, m.RemotePort))
+			if proxy.ExposesLAN(m.LocalAddr) {
+				fmt.Print("  WARNING: exposed to the network")
+			}
+			fmt.Println()
+		}
+	}
+
+	if dangling := c.manager.DanglingRefs(); len(dangling) > 0 {
+		fmt.Println()
+		fmt.Printf("Dangling references: %d (fix with: hssh config fix-refs)\n", len(dangling))
+	}
+
+	return nil
+}
+
+// UsageCommand 显示各服务器最近 days 天的使用量（gmssh web 记录在 usage.json 中），按流量从大到小排序
+func (c *CLI) UsageCommand(days int, asJSON bool) error {
+	if days < 1 || days > usage.RetentionDays {
+		return withExitCode(ExitUsage, fmt.Errorf("--days must be between 1 and %d", usage.RetentionDays))
+	}
+	store, err := usage.Open(filepath.Join(c.config.ConfigDir, usage.FileName))
+	if err != nil {
+		return err
+	}
+	list := usage.ByServer(c.config, store.Totals(time.Now().AddDate(0, 0, 1-days)))
+	if asJSON {
+		return printJSON(list)
+	}
+
+	fmt.Printf("Usage in the last %d days (sessions, uploads and tunnels count for every hop they pass through):\n\n", days)
+	if len(list) == 0 {
+		fmt.Println("No usage recorded (usage is recorded by hssh web)")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tSESSIONS\tUPLOADS\tTRAFFIC\tTUNNEL HOURS")
+	for _, u := range list {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.2f MB\t%.1f\n", u.Server, u.Sessions, u.Transfers, float64(u.Bytes)/1024/1024, u.TunnelHours)
+	}
+	return w.Flush()
+}
+
+// hopName 按 ID 显示服务器名称，找不到时标记为缺失
+func (c *CLI) hopName(id string) string {
+	if hop := c.config.GetHopByID(id); hop != nil {
+		return hop.Name
+	}
+	return "<missing " + id + ">"
+}
+
+// ServerAddCommand 添加服务器命令。address 为 user@host:port 连接串，只填充未单独指定的字段，
+// 没有名称时按主机生成；via 为网关名称，指定后作为内网服务器。
+// 仍未填写的用户、端口和密钥路径先取 server_defaults，再取内置默认值
+func (c *CLI) ServerAddCommand(hop *types.Hop, address, via string) error {
+	if address != "" {
+		cs, err := types.ParseConnString(address)
+		if err != nil {
+			return withExitCode(ExitUsage, err)
+		}
+		if hop.Host == "" {
+			hop.Host = cs.Host
+		}
+		if hop.User == "" {
+			hop.User = cs.User
+		}
+		if hop.Port == 0 {
+			hop.Port = cs.Port
+		}
+	}
+	if hop.Name == "" {
+		hop.Name = c.config.UniqueHopName(types.ConnString{Host: hop.Host}.DefaultName())
+	}
+	if via != "" {
+		gateway := c.config.GetHopByName(via)
+		if gateway == nil {
+			gateway = c.config.GetHopByID(via)
+		}
+		if gateway == nil {
+			return withExitCode(ExitNotFound, fmt.Errorf("gateway '%s' not found in config", via))
+		}
+		hop.GatewayID = gateway.ID
+		hop.ServerType = types.ServerInternal
+	}
+
+	c.config.ServerDefaults.Apply(hop)
+	if hop.Port == 0 {
+		hop.Port = 22
+	}
+	if hop.AuthType == types.AuthKey && hop.KeyPath == "" {
+		hop.KeyPath = "~/.ssh/id_rsa"
+	}
+	if hop.User == "" {
+		return withExitCode(ExitUsage, fmt.Errorf("--user is required (or set server_defaults.user in the config)"))
+	}
+	if err := c.manager.AddHop(hop); err != nil {
+		return err
+	}
+	fmt.Printf("Server '%s' added successfully (%s@%s:%d)\n", hop.Name, hop.User, hop.Host, hop.Port)
+	return nil
+}
+
+// ServerCloneCommand 以新名称复制服务器（按名称或 ID 查找）的认证、网关、标签和终端设置，
+// host、port、user 为空时沿用原服务器
+func (c *CLI) ServerCloneCommand(source, name, host string, port int, user string) error {
+	hop := c.config.GetHopByName(source)
+	if hop == nil {
+		hop = c.config.GetHopByID(source)
+	}
+	if hop == nil {
+		return withExitCode(ExitNotFound, fmt.Errorf("server '%s' not found in config", source))
+	}
+	if c.config.GetHopByName(name) != nil {
+		return withExitCode(ExitUsage, fmt.Errorf("server '%s' already exists", name))
+	}
+
+	clone := hop.Clone(name, host)
+	if port != 0 {
+		clone.Port = port
+	}
+	if user != "" {
+		clone.User = user
+	}
+	if err := c.manager.AddHop(clone); err != nil {
+		return err
+	}
+	fmt.Printf("Server '%s' cloned from '%s' (%s@%s:%d)\n", clone.Name, hop.Name, clone.User, clone.Host, clone.Port)
+	return nil
+}
+
+// ServerListCommand 列出服务器命令；query 非空时只列出匹配的服务器（见 Hop.Matches）
+func (c *CLI) ServerListCommand(query string) error {
+	if len(c.config.Hops) == 0 {
+		fmt.Println("No servers configured")
+		return nil
+	}
+	hops := c.config.Hops
+	if query != "" {
+		hops = nil
+		for _, hop := range c.config.Hops {
+			if hop.Matches(query) {
+				hops = append(hops, hop)
+			}
+		}
+		if len(hops) == 0 {
+			fmt.Printf("No servers match '%s'\n", query)
+			return nil
+		}
+	}
+
+	fmt.Printf("%-15s %-20s %-10s %-15s %-10s %-8s %s\n", "NAME", "HOST", "PORT", "USER", "AUTH", "ENV", "LAST CHECK")
+	fmt.Println(strings.Repeat("-", 109))
+	for _, hop := range hops {
+		env := hop.Environment
+		if env == "" {
+			env = "-"
+		}
+		fmt.Printf("%-15s %-20s %-10d %-15s %-10s %-8s %s\n", hop.Name, hop.Host, hop.Port, hop.User, hop.AuthType, env, lastCheckSummary(hop.LastCheck))
+	}
+	return nil
+}
+
+// lastCheckSummary 最近一次健康检查的简要说明
+func lastCheckSummary(check *types.HealthCheck) string {
+	if check == nil {
+		return "-"
+	}
+	at := check.CheckedAt.Local().Format("01-02 15:04")
+	if check.OK {
+		return fmt.Sprintf("ok %dms (%s)", check.LatencyMs, at)
+	}
+	return fmt.Sprintf("failed: %s at %s (%s)", check.Stage, check.FailedHop, at)
+}
+
+// ServerCheckCommand 并发检查服务器（all 为 true 时检查全部）能否经网关链连接并通过认证，
+// 结果写入配置中各服务器的 last_check；有服务器检查失败时返回错误
+func (c *CLI) ServerCheckCommand(names []string, all bool, parallel int, asJSON bool) error {
+	targets := c.config.Hops
+	if !all {
+		targets = make([]*types.Hop, 0, len(names))
+		for _, name := range names {
+			hop := c.config.GetHopByName(name)
+			if hop == nil {
+				return withExitCode(ExitNotFound, fmt.Errorf("server '%s' not found in config", name))
+			}
+			targets = append(targets, hop)
+		}
+	}
+	if len(targets) == 0 {
+		if asJSON {
+			return printJSON([]profiler.CheckResult{})
+		}
+		fmt.Println("No servers configured")
+		return nil
+	}
+
+	if !asJSON {
+		fmt.Printf("Checking %d servers...\n\n", len(targets))
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	results := c.profiler.CheckHops(ctx, targets, c.config.GatewayChain, parallel, 0)
+
+	checks := make(map[string]types.HealthCheck, len(results))
+	failed := 0
+	for _, r := range results {
+		checks[r.ID] = r.HealthCheck
+		if !r.OK {
+			failed++
+		}
+	}
+	if err := c.manager.RecordHealthChecks(checks); err != nil {
+		return fmt.Errorf("save check results: %w", err)
+	}
+
+	if asJSON {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+	} else {
+		printCheckTable(os.Stdout, results)
+	}
+	if failed > 0 {
+		return c.fail(ctx, ExitConnect, fmt.Errorf("%d of %d servers failed the check", failed, len(results)))
+	}
+	return nil
+}
+
+// printCheckTable 输出健康检查结果表
+func printCheckTable(out io.Writer, results []profiler.CheckResult) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATUS\tLATENCY\tAUTH\tERROR")
+	for _, r := range results {
+		status := "ok"
+		errText := ""
+		if !r.OK {
+			status = "failed (" + r.Stage + ")"
+			errText = r.Error
+			if r.FailedHop != "" && r.FailedHop != r.Name {
+				errText = r.FailedHop + ": " + errText
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%dms\t%s\t%s\n", r.Name, status, r.LatencyMs, r.AuthMethod, errText)
+	}
+	tw.Flush()
+}
+
+// ServerDeleteCommand 删除服务器命令，服务器被移入回收站
+func (c *CLI) ServerDeleteCommand(name, confirm string) error {
+	if err := c.confirmEnvironment(c.config.GetHopByName(name), types.OpDelete, confirm); err != nil {
+		return err
+	}
+	if err := c.manager.DeleteHopByName(name); err != nil {
+		return err
+	}
+	fmt.Printf("Server '%s' moved to trash (kept for %d days)\n", name, int(c.manager.TrashRetention().Hours()/24))
+	fmt.Printf("Restore it with: hssh server restore %s\n", name)
+	return nil
+}
+
+// ServerTrashCommand 列出回收站中的服务器
+func (c *CLI) ServerTrashCommand() error {
+	items := c.manager.Trash()
+	if len(items) == 0 {
+		fmt.Println("Trash is empty")
+		return nil
+	}
+
+	retention := c.manager.TrashRetention()
+	fmt.Printf("%-15s %-20s %-20s %-20s\n", "NAME", "HOST", "DELETED", "EXPIRES")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, item := range items {
+		fmt.Printf("%-15s %-20s %-20s %-20s\n", item.Hop.Name, item.Hop.Host,
+			item.DeletedAt.Format("2006-01-02 15:04"), item.DeletedAt.Add(retention).Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+// ServerRestoreCommand 从回收站恢复服务器（按名称或 ID，同名时恢复最近删除的）
+func (c *CLI) ServerRestoreCommand(nameOrID string) error {
+	for _, item := range c.manager.Trash() {
+		if item.Hop.ID != nameOrID && item.Hop.Name != nameOrID {
+			continue
+		}
+		hop, err := c.manager.RestoreHop(item.Hop.ID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Server '%s' restored\n", hop.Name)
+		return nil
+	}
+	return fmt.Errorf("server '%s' not found in trash", nameOrID)
+}
+
+// keyDeployTimeout 部署公钥（含建立跳板链和验证）的最长时间
+const keyDeployTimeout = time.Minute
+
+// ServerFavoriteCommand 收藏或取消收藏服务器
+func (c *CLI) ServerFavoriteCommand(nameOrID string, favorite bool) error {
+	hop := c.config.GetHopByName(nameOrID)
+	if hop == nil {
+		hop = c.config.GetHopByID(nameOrID)
+	}
+	if hop == nil {
+		return withExitCode(ExitNotFound, fmt.Errorf("server '%s' not found", nameOrID))
+	}
+	hop.Favorite = favorite
+	if err := c.manager.Save(); err != nil {
+		return err
+	}
+	if favorite {
+		fmt.Printf("Server '%s' added to favorites\n", hop.Name)
+	} else {
+		fmt.Printf("Server '%s' removed from favorites\n", hop.Name)
+	}
+	return nil
+}
+
+// KeyGenerateCommand 生成密钥对并写入 out（为空时为 ~/.ssh/hssh_<type>）和 out.pub
+func (c *CLI) KeyGenerateCommand(keyType string, bits int, comment, out string, force bool) error {
+	if out == "" {
+		out = keys.DefaultPath(keyType)
+	}
+	kp, err := keys.Generate(keyType, bits, comment)
+	if err != nil {
+		return err
+	}
+	if err := kp.Write(out, force); err != nil {
+		return err
+	}
+	fmt.Printf("Private key: %s\n", out)
+	fmt.Printf("Public key:  %s.pub\n", out)
+	fmt.Printf("Fingerprint: %s\n\n", kp.Fingerprint)
+	fmt.Println(kp.PublicKey)
+	return nil
+}
+
+// KeyDeployCommand 经服务器的网关链，以服务器现有的认证方式登录并把 keyPath 的公钥追加到 authorized_keys；
+// switchAuth 为 true 时用该密钥重新登录验证，成功后把服务器改为密钥认证并删除保存的密码
+func (c *CLI) KeyDeployCommand(server, keyPath string, switchAuth bool) error {
+	hop := c.config.GetHopByName(server)
+	if hop == nil {
+		return withExitCode(ExitNotFound, fmt.Errorf("server '%s' not found in config", server))
+	}
+	if keyPath == "" {
+		keyPath = keys.DefaultPath("")
+	}
+	line, fingerprint, err := keys.PublicKey(keyPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	ctx, cancelDeploy := context.WithTimeout(ctx, keyDeployTimeout)
+	defer cancelDeploy()
+
+	hops := c.config.GatewayChain(hop)
+	if err := keys.Deploy(ctx, hops, line); err != nil {
+		return c.fail(ctx, ExitConnect, fmt.Errorf("deploy key to %s: %w", hop.Name, err))
+	}
+	fmt.Printf("Key %s deployed to %s\n", fingerprint, hop.Name)
+	if !switchAuth {
+		return nil
+	}
+
+	if err := keys.Verify(ctx, hops, keyPath); err != nil {
+		return c.fail(ctx, ExitConnect, fmt.Errorf("key login to %s failed, auth not changed: %w", hop.Name, err))
+	}
+	if err := c.manager.UpdateHop(hop.ID, keys.WithKeyAuth(hop, keyPath)); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	fmt.Printf("Server '%s' now uses key auth (%s)\n", hop.Name, keyPath)
+	return nil
+}
+
+// KeyRotateCommand 生成新密钥（out 为空时为 ~/.ssh/hssh_<type>_<时间>）并把服务器（all 为 true 时为全部）轮换到新密钥，
+// 输出每个服务器的结果；有服务器失败时返回错误
+func (c *CLI) KeyRotateCommand(names []string, all bool, keyType, out string, parallel int, asJSON bool) error {
+	targets := c.config.Hops
+	if !all {
+		targets = make([]*types.Hop, 0, len(names))
+		for _, name := range names {
+			hop := c.config.GetHopByName(name)
+			if hop == nil {
+				return withExitCode(ExitNotFound, fmt.Errorf("server '%s' not found in config", name))
+			}
+			targets = append(targets, hop)
+		}
+	}
+	if len(targets) == 0 {
+		if asJSON {
+			return printJSON([]keys.RotateResult{})
+		}
+		fmt.Println("No servers configured")
+		return nil
+	}
+
+	if out == "" {
+		out = keys.DefaultPath(keyType) + "_" + time.Now().Format("20060102-150405")
+	}
+	kp, err := keys.Generate(keyType, 0, "hssh-rotate")
+	if err != nil {
+		return err
+	}
+	if err := kp.Write(out, false); err != nil {
+		return err
+	}
+	if !asJSON {
+		fmt.Printf("New key %s (%s)\nRotating %d servers...\n\n", out, kp.Fingerprint, len(targets))
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	results, err := keys.NewRotator(parallel).Rotate(ctx, targets, c.config.GatewayChain, out, func(ids []string) error {
+		return c.manager.SetKeyAuth(ids, out)
+	})
+	if results != nil {
+		if asJSON {
+			if err := printJSON(results); err != nil {
+				return err
+			}
+		} else {
+			printRotateTable(os.Stdout, results)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return c.fail(ctx, ExitFailed, fmt.Errorf("%d of %d servers were not rotated", failed, len(results)))
+	}
+	return nil
+}
+
+// printRotateTable 输出密钥轮换结果表
+func printRotateTable(out io.Writer, results []keys.RotateResult) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATUS\tOLD KEY\tERROR")
+	for _, r := range results {
+		status := "rotated"
+		if !r.OK {
+			status = "failed (" + r.Stage + ")"
+		}
+		oldKey := "-"
+		switch {
+		case r.OldKeyRemoved:
+			oldKey = "removed"
+		case r.OK && r.Stage == keys.StageRemove:
+			oldKey = "kept"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Name, status, oldKey, r.Error)
+	}
+	tw.Flush()
+}
+
+// ConfigMigrateToSQLiteCommand 将 YAML 配置迁移到 SQLite 存储
+func (c *CLI) ConfigMigrateToSQLiteCommand() error {
+	if _, ok := c.manager.Storage().(*config.SQLiteStorage); ok {
+		return fmt.Errorf("already using SQLite storage: %s", c.manager.StoragePath())
+	}
+	// 释放 YAML 存储后再迁移
+	c.manager.Close()
+
+	dbPath, err := config.MigrateToSQLite(c.config.ConfigDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Configuration migrated to %s\n", dbPath)
+	fmt.Printf("The previous YAML file was kept as %s.bak\n", config.ConfigFileName)
+	return nil
+}
+
+// ConfigRefsCommand 列出无法解析的引用，fix 为 true 时修复它们
+func (c *CLI) ConfigRefsCommand(fix bool) error {
+	refs := c.manager.DanglingRefs()
+	if fix {
+		var err error
+		if refs, err = c.manager.FixDanglingRefs(); err != nil {
+			return err
+		}
+	}
+	if len(refs) == 0 {
+		fmt.Println("No dangling references")
+		return nil
+	}
+
+	fmt.Printf("%-15s %-25s %-12s %-38s %s\n", "KIND", "OWNER", "FIELD", "REF", "FIX")
+	fmt.Println(strings.Repeat("-", 110))
+	for _, ref := range refs {
+		fmt.Printf("%-15s %-25s %-12s %-38s %s\n", ref.Kind, ref.Owner, ref.Field, ref.Ref, ref.Fix)
+	}
+	if fix {
+		fmt.Printf("Fixed %d reference(s)\n", len(refs))
+	} else {
+		fmt.Println("Fix them with: hssh config fix-refs")
+	}
+	return nil
+}
+
+// ConfigImportSSHCommand 把 OpenSSH 配置中的主机导入为服务器，ProxyJump 转换为网关；
+// path 为空时读取 ~/.ssh/config，hosts 非空时只导入这些别名及它们的网关，名称已存在的跳过
+func (c *CLI) ConfigImportSSHCommand(path string, hosts []string, dryRun, asJSON bool) error {
+	hops, path, err := config.ReadSSHConfigFile(path)
+	if err != nil {
+		return err
+	}
+	if hops, err = config.SelectSSHHosts(hops, hosts); err != nil {
+		return err
+	}
+	result, err := c.manager.ImportSSHHosts(hops, dryRun)
+	if err != nil {
+		return err
+	}
+	result.Path = path
+	if asJSON {
+		return printJSON(result)
+	}
+
+	if len(result.Imported) > 0 {
+		fmt.Printf("%-20s %-35s %s\n", "NAME", "ADDRESS", "GATEWAY")
+		fmt.Println(strings.Repeat("-", 75))
+		for _, hop := range result.Imported {
+			gateway := hop.Gateway
+			if gw := c.config.GetHopByID(hop.GatewayID); gw != nil {
+				gateway = gw.Name
+			}
+			fmt.Printf("%-20s %-35s %s\n", hop.Name, fmt.Sprintf("%s@%s:%d", hop.User, hop.Host, hop.Port), gateway)
+		}
+	}
+	if len(result.Skipped) > 0 {
+		fmt.Printf("Already configured: %s\n", strings.Join(result.Skipped, ", "))
+	}
+	if dryRun {
+		fmt.Printf("Would import %d of %d hosts from %s\n", len(result.Imported), result.Found, path)
+	} else {
+		fmt.Printf("Imported %d of %d hosts from %s\n", len(result.Imported), result.Found, path)
+	}
+	return nil
+}
+
+// ConfigSyncCommand 立即从团队共享来源同步拓扑，source 为空时使用配置中的 sync.source
+func (c *CLI) ConfigSyncCommand(source string) error {
+	syncConfig := c.config.Sync
+	if source != "" {
+		syncConfig.Source = source
+	}
+	if syncConfig.Source == "" {
+		return fmt.Errorf("no sync source: set sync.source in config or pass --source")
+	}
+
+	syncer, err := teamsync.New(syncConfig, c.manager, filepath.Join(c.config.ConfigDir, "sync"))
+	if err != nil {
+		return err
+	}
+	report, err := syncer.Sync(context.Background())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Synced from %s (revision %s)\n", syncConfig.Source, syncer.Status().Revision)
+	for _, item := range report.Added {
+		fmt.Printf("  + %s\n", item)
+	}
+	for _, item := range report.Updated {
+		fmt.Printf("  ~ %s\n", item)
+	}
+	for _, item := range report.Removed {
+		fmt.Printf("  - %s\n", item)
+	}
+	if !report.Changed() {
+		fmt.Println("  (no changes)")
+	}
+	if len(report.Conflicts) > 0 {
+		fmt.Printf("Conflicts: %d\n", len(report.Conflicts))
+		for _, conflict := range report.Conflicts {
+			name := conflict.Name
+			if name == "" {
+				name = conflict.ID
+			}
+			fmt.Printf("  ! %s %s: %s\n", conflict.Kind, name, conflict.Reason)
+		}
+	}
+	return nil
+}
+
+// checkMaintenance 链上的服务器处于维护窗口时返回错误（与 gmssh web 使用同一份配置）
+func (c *CLI) checkMaintenance(hops []*types.Hop) error {
+	window, hop := c.config.MaintenanceFor(hops, time.Now())
+	if window == nil {
+		return nil
+	}
+	msg := fmt.Sprintf("%s is under maintenance until %s", hop.Name, window.End.Local().Format(time.RFC3339))
+	if window.Message != "" {
+		msg += ": " + window.Message
+	}
+	return withExitCode(ExitMaintenance, errors.New(msg))
+}
+
+// ValidatePath 验证路径是否有效
+func (c *CLI) ValidatePath(hopNames []string) ([]*types.Hop, error) {
+	var hops []*types.Hop
+	for _, name := range hopNames {
+		hop := c.config.GetHopByName(name)
+		if hop == nil {
+			return nil, fmt.Errorf("hop '%s' not found in config", name)
+		}
+		hops = append(hops, hop)
+	}
+	return hops, nil
+}
+
+// GetConfigDir 获取配置目录
 func (c *CLI) GetConfigDir() string {
 	return c.config.ConfigDir
 }
+
+// relayUsage 检查 relay / stage / compare 模式的前提：单个文件、至少经过一个跳板、不与 --delta 同用
+func relayUsage(source string, hops []*types.Hop, opts UploadOptions) error {
+	if opts.Delta {
+		return fmt.Errorf("--mode %s cannot be combined with --delta", opts.Mode)
+	}
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		return fmt.Errorf("--mode %s uploads single files", opts.Mode)
+	}
+	if len(hops) < 2 {
+		return fmt.Errorf("--mode %s needs at least one --via hop", opts.Mode)
+	}
+	return nil
+}
+
+// uploadRelay 以 relay 模式上传：只连接第一跳，由各网关上的 ssh 逐跳转发；
+// stage 模式连接到最后一个网关，先暂存在网关上再由网关推送到目标。
+// compare 时先以 tunnel 模式上传同一个文件，再以 relay 模式上传，输出两者的吞吐
+func (c *CLI) uploadRelay(source, target, targetPath string, hops []*types.Hop, via []string, mode string) error {
+	targetHop := hops[len(hops)-1]
+	info, err := os.Stat(source)
+	if err != nil {
+		return withExitCode(ExitNotFound, err)
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	result := UploadResult{Source: source, Target: target, Bytes: info.Size(), Files: 1, Mode: mode}
+	// upload 在 chain 上执行一次上传并报告进度
+	upload := func(mode string, chain *ssh.Chain, run func(*transfer.SCPTransfer, chan<- *types.TransferProgress) error) error {
+		c.printf("Connecting via: %s (%s mode)\n", strings.Join(via, " -> "), mode)
+		if err := chain.ConnectContext(ctx); err != nil {
+			return c.fail(ctx, ExitConnect, fmt.Errorf("failed to connect: %w", err))
+		}
+		defer chain.Disconnect()
+		scp := transfer.NewSCPTransfer(chain)
+		scp.SetSpeedWindow(c.config.Upload.SpeedWindow)
+		scp.SetBackups(func(remoteFile string) int { return c.config.Upload.BackupKeep(targetHop, remoteFile) })
+		scp.SetSudo(transfer.SudoFor(&c.config.Upload.Sudo, targetHop, c.sudoPrompt()))
+
+		progress := transfer.NewProgressPublisher()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for p := range progress.Updates() {
+				if p.Status == "running" {
+					phase := mode
+					if p.Phase != "" {
+						phase += ", " + p.Phase
+					}
+					c.printf("\r%s (%s): %.1f%% %.2f MB/s ETA %s   ", p.FileName, phase, p.Percentage(),
+						float64(p.Speed)/1024/1024, p.ETA.Round(time.Second))
+				}
+			}
+		}()
+		measured := transfer.MeasureMode(mode, info.Size(), func() error { return run(scp, progress.Chan()) })
+		progress.Close()
+		<-done
+		result.Modes = append(result.Modes, measured)
+		if measured.Error != "" {
+			return c.fail(ctx, ExitFailed, fmt.Errorf("%s upload failed: %s", mode, measured.Error))
+		}
+		c.printf("\r✓ %s uploaded in %s mode: %.2f MB/s\n", filepath.Base(source), mode, float64(measured.Throughput)/1024/1024)
+		return nil
+	}
+
+	compare := mode == transfer.ModeCompare
+	if mode == transfer.ModeStage {
+		stage := transfer.StageOptions{Dir: c.config.Upload.StageDir, Quota: c.config.Upload.StageQuota, MaxAge: c.config.Upload.MaxAge}
+		err = upload(transfer.ModeStage, ssh.NewChain(hops[:len(hops)-1]), func(scp *transfer.SCPTransfer, progress chan<- *types.TransferProgress) error {
+			return scp.UploadStaged(ctx, source, targetPath, hops[len(hops)-1:], stage, progress)
+		})
+	} else {
+		if compare {
+			err := upload(transfer.ModeTunnel, ssh.NewChain(hops), func(scp *transfer.SCPTransfer, progress chan<- *types.TransferProgress) error {
+				return scp.UploadContext(ctx, source, targetPath, progress)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		err = upload(transfer.ModeRelay, ssh.NewChain(hops[:1]), func(scp *transfer.SCPTransfer, progress chan<- *types.TransferProgress) error {
+			return scp.UploadRelay(ctx, source, targetPath, hops[1:], progress)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	c.touchRecent(types.RecentUpload, targetHop, targetPath, via)
+
+	if c.batch.Quiet {
+		last := result.Modes[len(result.Modes)-1]
+		result.DurationMs = last.DurationMs
+		result.SpeedMBps = float64(last.Throughput) / 1024 / 1024
+		return printJSON(result)
+	}
+	if compare {
+		tunnel, relay := result.Modes[0].Throughput, result.Modes[1].Throughput
+		fmt.Printf("tunnel: %.2f MB/s, relay: %.2f MB/s\n", float64(tunnel)/1024/1024, float64(relay)/1024/1024)
+		if tunnel > 0 {
+			faster := transfer.ModeTunnel
+			if relay > tunnel {
+				faster = transfer.ModeRelay
+			}
+			fmt.Printf("relay is %.2fx the tunnel throughput; use --mode %s for this route\n", float64(relay)/float64(tunnel), faster)
+		}
+	}
+	fmt.Println("Upload completed successfully")
+	return nil
+}
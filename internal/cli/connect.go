@@ -0,0 +1,220 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/pkg/types"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// cliUser 命令行记录最近使用目标时的用户，与 gmssh web 单用户模式的本地用户相同，两边共享记录
+const cliUser = "local"
+
+// ConnectCommand 打开到服务器的交互式终端。target 为 "-" 时连接最近打开过终端的服务器，
+// 为空时列出收藏和最近使用的服务器供选择；via 为空时经服务器配置的网关连接
+func (c *CLI) ConnectCommand(target string, via []string) error {
+	if c.batch.Batch {
+		return withExitCode(ExitInteractive, fmt.Errorf("gmssh connect is interactive and cannot run in batch mode"))
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return withExitCode(ExitInteractive, fmt.Errorf("gmssh connect requires a terminal"))
+	}
+
+	var hop *types.Hop
+	switch target {
+	case "":
+		var err error
+		if hop, err = c.pickTarget(); err != nil {
+			return err
+		}
+	case "-":
+		recent := c.config.RecentFor(cliUser, types.RecentTerminal)
+		if len(recent) == 0 {
+			return withExitCode(ExitNotFound, fmt.Errorf("no recently used server"))
+		}
+		hop = c.config.GetHopByID(recent[0].ServerID)
+	default:
+		if hop = c.config.GetHopByName(target); hop == nil {
+			hop = c.config.GetHopByID(target)
+		}
+		if hop == nil {
+			return withExitCode(ExitNotFound, fmt.Errorf("server '%s' not found in config", target))
+		}
+	}
+
+	hops := c.config.GatewayChain(hop)
+	if len(via) > 0 {
+		hops = nil
+		for _, name := range via {
+			gateway := c.config.GetHopByName(name)
+			if gateway == nil {
+				return withExitCode(ExitNotFound, fmt.Errorf("hop '%s' not found in config", name))
+			}
+			hops = append(hops, gateway)
+		}
+		hops = append(hops, hop)
+	}
+	if err := c.checkMaintenance(hops); err != nil {
+		return err
+	}
+	opts, err := c.config.ResolveTerminal(hop, "")
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	startCmd, err := terminal.StartCommand(opts, "")
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+
+	ctx, cancel := c.context()
+	chain := ssh.NewChain(hops)
+	fmt.Fprintf(os.Stderr, "Connecting to %s (%s@%s:%d)...\n", hop.Name, hop.User, hop.Host, hop.Port)
+	err = chain.ConnectContext(ctx)
+	cancel()
+	if err != nil {
+		return c.fail(ctx, ExitConnect, fmt.Errorf("failed to connect: %w", err))
+	}
+	defer chain.Disconnect()
+
+	session, err := chain.NewSession()
+	if err != nil {
+		return withExitCode(ExitConnect, fmt.Errorf("failed to open session: %w", err))
+	}
+	defer session.Close()
+	if c.config.AgentForwarding.Allows(hop) {
+		ssh.OnAgentForward(c.recordAgentForward)
+		defer ssh.OnAgentForward(nil)
+		if stop, err := chain.ForwardAgent(session, cliUser); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: ssh-agent forwarding unavailable: %v\n", err)
+		} else {
+			defer stop()
+		}
+	}
+
+	fd := int(os.Stdin.Fd())
+	cols, rows, err := term.GetSize(fd)
+	if err != nil {
+		cols, rows = 80, 24
+	}
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = "xterm-256color"
+	}
+	if err := chain.RequestPTY(session, termType, rows, cols, terminal.PTYModes(opts.Modes)); err != nil {
+		return fmt.Errorf("failed to request PTY: %w", err)
+	}
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+	if err := ssh.StartShell(hop, session, startCmd); err != nil {
+		return fmt.Errorf("failed to start shell: %w", err)
+	}
+	c.touchRecent(types.RecentTerminal, hop, "", via)
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	stop := watchResize(fd, session)
+	defer stop()
+
+	// 远端 shell 自己的退出状态不作为本命令的错误
+	var exitErr *gossh.ExitError
+	if err := session.Wait(); err != nil && !errors.As(err, &exitErr) {
+		return fmt.Errorf("session ended: %w", err)
+	}
+	return nil
+}
+
+// recordAgentForward 把远端对转发的 ssh-agent 的使用写入审计日志，失败时只输出警告
+func (c *CLI) recordAgentForward(use ssh.AgentForwardUse) {
+	if c.config.ConfigDir == "" {
+		return
+	}
+	event := audit.Event{User: cliUser, Action: "ssh.agent_forward", Target: use.Hop.ID, Detail: use.Hop.Name}
+	if use.Err != nil {
+		event.Error = use.Err.Error()
+	}
+	log, err := audit.Open(filepath.Join(c.config.ConfigDir, audit.FileName))
+	if err == nil {
+		err = log.Record(event)
+		log.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\r\nWarning: failed to record ssh-agent use in the audit log: %v\r\n", err)
+	}
+}
+
+// pickTarget 列出收藏和最近打开过终端的服务器，读取编号，直接回车选第一个
+func (c *CLI) pickTarget() (*types.Hop, error) {
+	var choices []*types.Hop
+	seen := make(map[string]bool)
+	add := func(hop *types.Hop) {
+		if hop != nil && !seen[hop.ID] {
+			seen[hop.ID] = true
+			choices = append(choices, hop)
+		}
+	}
+	for _, hop := range c.config.Favorites() {
+		add(hop)
+	}
+	for _, t := range c.config.RecentFor(cliUser, types.RecentTerminal) {
+		add(c.config.GetHopByID(t.ServerID))
+	}
+	if len(choices) == 0 {
+		return nil, withExitCode(ExitUsage, fmt.Errorf("no favorite or recently used servers; usage: gmssh connect <server>"))
+	}
+
+	for i, hop := range choices {
+		mark := " "
+		if hop.Favorite {
+			mark = "*"
+		}
+		fmt.Printf("%2d) %s %-20s %s@%s:%d\n", i+1, mark, hop.Name, hop.User, hop.Host, hop.Port)
+	}
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	for {
+		answer, err := p.ask("Server", "1")
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, withExitCode(ExitUsage, fmt.Errorf("no server selected"))
+			}
+			return nil, err
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(choices) {
+			return choices[n-1], nil
+		}
+		if hop := c.config.GetHopByName(answer); hop != nil {
+			return hop, nil
+		}
+		fmt.Printf("Invalid choice %q\n", answer)
+	}
+}
+
+// touchRecent 记录一次使用并保存配置，保存失败只提示
+func (c *CLI) touchRecent(kind string, hop *types.Hop, path string, via []string) {
+	c.config.TouchRecent(&types.RecentTarget{
+		User:     cliUser,
+		Kind:     kind,
+		ServerID: hop.ID,
+		Server:   hop.Name,
+		Path:     path,
+		Via:      via,
+		UsedAt:   time.Now(),
+	})
+	if err := c.manager.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save recent targets: %v\n", err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package cli
+
+import gossh "golang.org/x/crypto/ssh"
+
+// watchResize 非 Unix 平台没有 SIGWINCH，不同步终端大小
+func watchResize(fd int, session *gossh.Session) func() {
+	return func() {}
+}
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// confirmEnvironment 按 hop 的环境策略确认危险操作 op：confirm（--confirm）须为服务器名称，
+// 未指定时在终端上要求输入服务器名称；--batch 时无法输入，直接失败
+func (c *CLI) confirmEnvironment(hop *types.Hop, op, confirm string) error {
+	if !c.config.ConfirmRequired(hop, op) || confirm == hop.Name {
+		return nil
+	}
+	if confirm != "" {
+		return withExitCode(ExitUsage, fmt.Errorf("--confirm %q does not match server '%s'", confirm, hop.Name))
+	}
+	if c.batch.Batch {
+		return withExitCode(ExitInteractive, fmt.Errorf("%s on '%s' (%s) needs confirmation; pass --confirm %s", op, hop.Name, hop.Environment, hop.Name))
+	}
+	fmt.Printf("'%s' is a %s server. Type its name to confirm %s: ", hop.Name, hop.Environment, op)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(answer) != hop.Name {
+		return fmt.Errorf("confirmation did not match '%s'; %s aborted", hop.Name, op)
+	}
+	return nil
+}
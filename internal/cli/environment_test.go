@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestConfirmEnvironment(t *testing.T) {
+	prod := &types.Hop{Name: "db-prod", Environment: "prod"}
+	dev := &types.Hop{Name: "db-dev", Environment: "dev"}
+	c := &CLI{config: &types.Config{Hops: []*types.Hop{prod, dev}}, batch: BatchOptions{Batch: true}}
+
+	tests := []struct {
+		name    string
+		hop     *types.Hop
+		confirm string
+		code    int
+	}{
+		{"dev needs nothing", dev, "", ExitOK},
+		{"prod confirmed", prod, "db-prod", ExitOK},
+		{"prod wrong name", prod, "db-dev", ExitUsage},
+		{"prod in batch mode", prod, "", ExitInteractive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := ExitCode(c.confirmEnvironment(tt.hop, types.OpUpload, tt.confirm)); code != tt.code {
+				t.Errorf("exit code = %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
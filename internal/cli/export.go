@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/export"
+	"github.com/luobobo896/HSSH/internal/usage"
+)
+
+// ExportCommand 把 from 到 to 之间的延迟历史、传输记录或每天的使用量导出为 CSV，写入 out（为空或 "-" 时写到标准输出）。
+// 传输记录和使用量读取配置目录中的 audit.log 和 usage.json；延迟历史只在运行中的 gmssh web 内存中，从它的 /api/status 读取
+func (c *CLI) ExportCommand(kind, from, to, out string) error {
+	if !slices.Contains(export.Kinds, kind) {
+		return withExitCode(ExitUsage, fmt.Errorf("unknown export %q (one of %s)", kind, strings.Join(export.Kinds, ", ")))
+	}
+	rng, err := export.ParseRange(from, to)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+
+	var w io.Writer = os.Stdout
+	if out != "" && out != "-" {
+		file, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch kind {
+	case export.KindLatency:
+		var samples []export.LatencySample
+		if samples, err = c.webLatencySamples(); err != nil {
+			return fmt.Errorf("latency history is kept by a running gmssh web: %w", err)
+		}
+		err = export.Latency(w, samples, rng)
+	case export.KindTransfers:
+		err = export.Transfers(w, filepath.Join(c.config.ConfigDir, audit.FileName), rng, "")
+	case export.KindUsage:
+		var store *usage.Store
+		store, err = usage.Open(filepath.Join(c.config.ConfigDir, usage.FileName))
+		if err == nil {
+			err = export.Usage(w, c.config, store, rng)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if w != os.Stdout {
+		c.printf("Exported %s to %s\n", kind, out)
+	}
+	return nil
+}
+
+// webLatencySamples 从运行中的 gmssh web 读取各服务器的延迟样本
+func (c *CLI) webLatencySamples() ([]export.LatencySample, error) {
+	addr, token := c.webEndpoint("", "")
+	ctx, cancel := context.WithTimeout(context.Background(), webCallTimeout)
+	defer cancel()
+	var status struct {
+		Servers []struct {
+			Name    string `json:"name"`
+			History []struct {
+				Time      time.Time `json:"time"`
+				LatencyMs float64   `json:"latency_ms"`
+				Success   bool      `json:"success"`
+			} `json:"history"`
+		} `json:"servers"`
+	}
+	if err := webCall(ctx, addr, token, http.MethodGet, "/api/status", nil, &status); err != nil {
+		return nil, err
+	}
+	var samples []export.LatencySample
+	for _, server := range status.Servers {
+		for _, point := range server.History {
+			samples = append(samples, export.LatencySample{Server: server.Name, Time: point.Time, LatencyMs: point.LatencyMs, Success: point.Success})
+		}
+	}
+	return samples, nil
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/pkg/types"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// HostKeyAcceptCommand 连接 name 及其网关链，逐个确认尚未信任或已经变化的主机密钥并写入 known_hosts。
+// 确认期间按 strict 处理，新主机不会被自动记录；fingerprint（--fingerprint）用于核对目标服务器的密钥，
+// yes（--yes）直接接受，否则在终端上询问，--batch 时失败
+func (c *CLI) HostKeyAcceptCommand(name, fingerprint string, yes bool) error {
+	target := c.findHop(name)
+	if target == nil {
+		return withExitCode(ExitNotFound, fmt.Errorf("server '%s' not found in config", name))
+	}
+	var hops []*types.Hop
+	for _, hop := range c.config.GatewayChain(target) {
+		strict := *hop
+		if strict.EffectiveHostKeyPolicy() == types.HostKeyTOFU {
+			strict.HostKeyPolicy = types.HostKeyStrict
+		}
+		hops = append(hops, &strict)
+	}
+
+	// 每次连接最多发现一跳的问题，确认后重连，直到整条链通过
+	accepted := 0
+	for range len(hops) + 1 {
+		chain := ssh.NewChain(hops)
+		err := chain.Connect()
+		if err == nil {
+			chain.Disconnect()
+			if accepted == 0 {
+				c.printf("Host keys of %s and its gateways are already trusted\n", target.Name)
+			}
+			return nil
+		}
+		var hostErr *ssh.HostKeyError
+		if !errors.As(err, &hostErr) || hostErr.Pinned {
+			return err
+		}
+		if err := c.confirmHostKey(hostErr, target.Name, fingerprint, yes); err != nil {
+			return err
+		}
+		if err := ssh.TrustHostKey(hostErr.Address, hostErr.Key); err != nil {
+			return err
+		}
+		c.printf("Trusted %s %s for %s (%s)\n", hostErr.Key.Type(), gossh.FingerprintSHA256(hostErr.Key), hostErr.Hop, hostErr.Address)
+		accepted++
+	}
+	return fmt.Errorf("host keys of %s still not trusted after %d attempts", target.Name, len(hops)+1)
+}
+
+// confirmHostKey 显示密钥并确认是否信任
+func (c *CLI) confirmHostKey(hostErr *ssh.HostKeyError, target, fingerprint string, yes bool) error {
+	offered := gossh.FingerprintSHA256(hostErr.Key)
+	if hostErr.Changed() {
+		c.printf("WARNING: the host key of %s (%s) HAS CHANGED. This is expected after a reinstall, otherwise someone may be intercepting the connection.\n", hostErr.Hop, hostErr.Address)
+		for _, known := range hostErr.Known {
+			c.printf("  known:   %s %s\n", known.Type(), gossh.FingerprintSHA256(known))
+		}
+	} else {
+		c.printf("The host key of %s (%s) is not trusted yet.\n", hostErr.Hop, hostErr.Address)
+	}
+	c.printf("  offered: %s %s\n", hostErr.Key.Type(), offered)
+
+	if fingerprint != "" && hostErr.Hop == target {
+		if fingerprint != offered {
+			return withExitCode(ExitUsage, fmt.Errorf("--fingerprint %s does not match the key offered by %s (%s)", fingerprint, hostErr.Hop, offered))
+		}
+		return nil
+	}
+	if yes {
+		return nil
+	}
+	if c.batch.Batch {
+		return withExitCode(ExitInteractive, fmt.Errorf("host key of %s needs confirmation; pass --fingerprint %s or --yes", hostErr.Hop, offered))
+	}
+	fmt.Print("Trust this key? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		return fmt.Errorf("host key of %s not trusted", hostErr.Hop)
+	}
+	return nil
+}
+
+// HostKeyForgetCommand 从 known_hosts 删除服务器的全部记录，下次连接时重新按 host_key_policy 处理
+func (c *CLI) HostKeyForgetCommand(name string) error {
+	hop := c.findHop(name)
+	if hop == nil {
+		return withExitCode(ExitNotFound, fmt.Errorf("server '%s' not found in config", name))
+	}
+	removed, err := ssh.ForgetHostKey(hop.Address())
+	if err != nil {
+		return err
+	}
+	path, _ := ssh.KnownHostsPath()
+	c.printf("Removed %d entries for %s (%s) from %s\n", removed, hop.Name, hop.Address(), path)
+	return nil
+}
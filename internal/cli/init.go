@@ -0,0 +1,291 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// InitOptions gmssh init 的选项
+type InitOptions struct {
+	SSHConfig string // 导入的 OpenSSH 配置，为空时为 ~/.ssh/config
+	NoImport  bool   // 不询问导入 OpenSSH 配置
+	NoCheck   bool   // 添加服务器时不测试连接
+}
+
+// prompter 从终端逐行读取回答
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask 显示问题并读取一行，直接回车时返回 def
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", err
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+// required 反复询问直到得到非空回答
+func (p *prompter) required(question string) (string, error) {
+	for {
+		answer, err := p.ask(question, "")
+		if err != nil || answer != "" {
+			return answer, err
+		}
+	}
+}
+
+// confirm 询问是否继续，直接回车时返回 def
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer, err := p.ask(question+" ("+hint+")", "")
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "":
+		return def, nil
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// hop 询问一个服务器的连接信息，gateway 非空时作为其后面的内网服务器
+func (p *prompter) hop(gateway *types.Hop) (*types.Hop, error) {
+	hop := &types.Hop{ServerType: types.ServerExternal}
+	if gateway != nil {
+		hop.ServerType = types.ServerInternal
+		hop.GatewayID = gateway.ID
+	}
+
+	var err error
+	if hop.Name, err = p.required("  Name"); err != nil {
+		return nil, err
+	}
+	if hop.Host, err = p.required("  Host"); err != nil {
+		return nil, err
+	}
+	for {
+		port, err := p.ask("  Port", "22")
+		if err != nil {
+			return nil, err
+		}
+		if hop.Port, err = strconv.Atoi(port); err == nil && hop.Port > 0 && hop.Port < 65536 {
+			break
+		}
+		fmt.Fprintf(p.out, "  Invalid port %q\n", port)
+	}
+	defUser := ""
+	if gateway != nil {
+		defUser = gateway.User
+	}
+	if hop.User, err = p.ask("  User", defUser); err != nil {
+		return nil, err
+	}
+	for hop.User == "" {
+		if hop.User, err = p.required("  User"); err != nil {
+			return nil, err
+		}
+	}
+
+	auth, err := p.ask("  Auth (key/password/agent)", "key")
+	if err != nil {
+		return nil, err
+	}
+	switch auth {
+	case "password":
+		hop.AuthType = types.AuthPassword
+		hop.Password, err = p.required("  Password")
+	case "agent":
+		hop.AuthType = types.AuthAgent
+	default:
+		hop.AuthType = types.AuthKey
+		defKey := "~/.ssh/id_rsa"
+		if gateway != nil && gateway.AuthType == types.AuthKey {
+			defKey = gateway.KeyPath
+		}
+		hop.KeyPath, err = p.ask("  Key path", defKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hop, nil
+}
+
+// InitCommand 首次配置向导：可选导入 ~/.ssh/config，逐个添加网关和其后的内网服务器（添加时测试连接），
+// 还没有 Web 用户时生成管理员令牌，最后校验并保存配置。--batch 时无法交互，直接失败
+func (c *CLI) InitCommand(opts InitOptions) error {
+	if c.batch.Batch {
+		return withExitCode(ExitInteractive, fmt.Errorf("gmssh init is interactive and cannot run in batch mode"))
+	}
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+
+	fmt.Printf("Setting up %s\n\n", c.manager.StoragePath())
+	if !config.NeedsSetup(c.config) {
+		fmt.Printf("%d servers and %d web users are already configured.\n", len(c.config.Hops), len(c.config.Web.Users))
+		if ok, err := p.confirm("Add more servers anyway?", false); err != nil || !ok {
+			return err
+		}
+	}
+
+	if !opts.NoImport {
+		if err := c.initImport(p, opts.SSHConfig); err != nil {
+			return err
+		}
+	}
+
+	for {
+		more, err := p.confirm("\nAdd a gateway (a server reachable directly from this machine)?", len(c.config.Hops) == 0)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		gateway, err := c.initAddHop(p, nil, opts.NoCheck)
+		if err != nil {
+			return err
+		}
+		if gateway == nil {
+			continue
+		}
+		for {
+			more, err := p.confirm(fmt.Sprintf("\nAdd an internal server behind '%s'?", gateway.Name), false)
+			if err != nil {
+				return err
+			}
+			if !more {
+				break
+			}
+			if _, err := c.initAddHop(p, gateway, opts.NoCheck); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(c.config.Web.Users) == 0 {
+		if err := c.initAdmin(p); err != nil {
+			return err
+		}
+	}
+
+	if err := c.manager.Validate(); err != nil {
+		return fmt.Errorf("config is invalid: %w", err)
+	}
+	if err := c.manager.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("\nDone: %d servers configured in %s\n", len(c.config.Hops), c.manager.StoragePath())
+	fmt.Println("Next: hssh server check --all, or hssh web to open the web UI")
+	return nil
+}
+
+// initImport 询问是否导入 OpenSSH 配置中的主机，名称已存在的跳过
+func (c *CLI) initImport(p *prompter, path string) error {
+	if path == "" {
+		path = config.DefaultSSHConfigPath()
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	hops, err := config.ParseSSHConfig(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(hops) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Found %d hosts in %s:\n", len(hops), path)
+	for _, hop := range hops {
+		via := ""
+		if hop.Gateway != "" {
+			via = " via " + hop.Gateway
+		}
+		fmt.Printf("  %-15s %s@%s:%d%s\n", hop.Name, hop.User, hop.Host, hop.Port, via)
+	}
+	if ok, err := p.confirm("Import them?", true); err != nil || !ok {
+		return err
+	}
+	added, err := c.manager.ImportHops(hops)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d servers (%d already existed)\n", len(added), len(hops)-len(added))
+	return nil
+}
+
+// initAddHop 询问并测试一个服务器，测试失败时确认是否仍然保存；不保存时返回 nil
+func (c *CLI) initAddHop(p *prompter, gateway *types.Hop, noCheck bool) (*types.Hop, error) {
+	hop, err := p.hop(gateway)
+	if err != nil {
+		return nil, err
+	}
+	if !noCheck {
+		fmt.Printf("  Testing %s@%s:%d...\n", hop.User, hop.Host, hop.Port)
+		ctx, cancel := c.context()
+		result := c.profiler.CheckHops(ctx, []*types.Hop{hop}, c.config.GatewayChain, 1, 0)[0]
+		cancel()
+		if result.OK {
+			fmt.Printf("  OK (%dms)\n", result.LatencyMs)
+		} else {
+			fmt.Printf("  Failed (%s): %s\n", result.Stage, result.Error)
+			if ok, err := p.confirm("  Save it anyway?", false); err != nil || !ok {
+				return nil, err
+			}
+		}
+	}
+	if err := c.manager.AddHop(hop); err != nil {
+		return nil, err
+	}
+	fmt.Printf("  Server '%s' added\n", hop.Name)
+	return hop, nil
+}
+
+// initAdmin 生成 Web 管理员并显示其令牌
+func (c *CLI) initAdmin(p *prompter) error {
+	ok, err := p.confirm("\nGenerate a web admin token (enables login for the web UI)?", true)
+	if err != nil || !ok {
+		return err
+	}
+	name, err := p.ask("Admin name", "admin")
+	if err != nil {
+		return err
+	}
+	user, err := config.NewAdminUser(name)
+	if err != nil {
+		return err
+	}
+	c.config.Web.Users = append(c.config.Web.Users, user)
+	fmt.Printf("Web admin '%s' token: %s\n", user.Name, user.Token)
+	fmt.Println("Use it to log in to the web UI, or pass it as a Bearer token to the API.")
+	return nil
+}
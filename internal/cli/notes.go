@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// NotesUpdate server notes 的修改：nil 字段保持不变，空字符串表示清除
+type NotesUpdate struct {
+	Description *string
+	Owner       *string
+	Contact     *string
+	Runbook     *string
+	Location    *string
+	// Fields 自定义字段，值为空表示删除该字段
+	Fields map[string]string
+	// Clear 先清空全部说明信息，再应用其他修改
+	Clear bool
+}
+
+// apply 在 notes 的副本上应用修改，结果为空时返回 nil
+func (u NotesUpdate) apply(notes *types.HopNotes) *types.HopNotes {
+	next := &types.HopNotes{}
+	if notes != nil && !u.Clear {
+		*next = *notes
+		next.Fields = make(map[string]string, len(notes.Fields))
+		for key, value := range notes.Fields {
+			next.Fields[key] = value
+		}
+	}
+	set := func(dst *string, src *string) {
+		if src != nil {
+			*dst = strings.TrimSpace(*src)
+		}
+	}
+	set(&next.Description, u.Description)
+	set(&next.Owner, u.Owner)
+	set(&next.Contact, u.Contact)
+	set(&next.Runbook, u.Runbook)
+	set(&next.Location, u.Location)
+	for key, value := range u.Fields {
+		if value == "" {
+			delete(next.Fields, key)
+			continue
+		}
+		if next.Fields == nil {
+			next.Fields = make(map[string]string)
+		}
+		next.Fields[key] = value
+	}
+	if len(next.Fields) == 0 {
+		next.Fields = nil
+	}
+	if next.Empty() {
+		return nil
+	}
+	return next
+}
+
+// ServerNotesCommand 修改服务器的说明、负责人、联系方式、运维手册链接、位置和自定义字段
+func (c *CLI) ServerNotesCommand(nameOrID string, update NotesUpdate) error {
+	hop := c.findHop(nameOrID)
+	if hop == nil {
+		return withExitCode(ExitNotFound, fmt.Errorf("server '%s' not found", nameOrID))
+	}
+	notes := update.apply(hop.Notes)
+	if err := notes.Validate(); err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	hop.Notes = notes
+	if err := c.manager.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Notes of server '%s' updated\n", hop.Name)
+	return nil
+}
+
+// ServerShowCommand 显示服务器的详细信息和说明信息
+func (c *CLI) ServerShowCommand(nameOrID string) error {
+	hop := c.findHop(nameOrID)
+	if hop == nil {
+		return withExitCode(ExitNotFound, fmt.Errorf("server '%s' not found", nameOrID))
+	}
+	row := func(label, value string) {
+		if value != "" {
+			fmt.Printf("%-14s %s\n", label+":", value)
+		}
+	}
+	row("Name", hop.Name)
+	row("ID", hop.ID)
+	row("Address", fmt.Sprintf("%s@%s:%d", hop.User, hop.Host, hop.Port))
+	row("Auth", hop.AuthType.String())
+	if hop.ServerType == types.ServerInternal {
+		gateway := hop.GatewayID
+		if gw := c.config.GetHopByID(hop.GatewayID); gw != nil {
+			gateway = gw.Name
+		}
+		row("Gateway", gateway)
+	}
+	row("Environment", hop.Environment)
+	row("Tags", strings.Join(hop.Tags, ", "))
+	row("Last check", lastCheckSummary(hop.LastCheck))
+	if hop.LegacyCrypto {
+		row("Warning", "legacy crypto enabled")
+	}
+
+	notes := hop.Notes
+	if notes.Empty() {
+		return nil
+	}
+	fmt.Println()
+	row("Description", notes.Description)
+	row("Owner", notes.Owner)
+	row("Contact", notes.Contact)
+	row("Runbook", notes.Runbook)
+	row("Location", notes.Location)
+	keys := make([]string, 0, len(notes.Fields))
+	for key := range notes.Fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		row(key, notes.Fields[key])
+	}
+	return nil
+}
+
+// findHop 按名称或 ID 查找服务器
+func (c *CLI) findHop(nameOrID string) *types.Hop {
+	if hop := c.config.GetHopByName(nameOrID); hop != nil {
+		return hop
+	}
+	return c.config.GetHopByID(nameOrID)
+}
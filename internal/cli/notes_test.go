@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestNotesUpdateApply(t *testing.T) {
+	str := func(s string) *string { return &s }
+	old := &types.HopNotes{Owner: "ops", Location: "rack A1", Fields: map[string]string{"asset": "A-1", "vm": "esx-3"}}
+
+	got := NotesUpdate{Owner: str(" dba "), Location: str(""), Fields: map[string]string{"vm": "", "ticket": "OPS-7"}}.apply(old)
+	if got.Owner != "dba" || got.Location != "" || got.Fields["asset"] != "A-1" || got.Fields["ticket"] != "OPS-7" || len(got.Fields) != 2 {
+		t.Errorf("apply: got %+v", got)
+	}
+	if old.Owner != "ops" || old.Fields["vm"] != "esx-3" {
+		t.Errorf("apply modified the original notes: %+v", old)
+	}
+
+	if got := (NotesUpdate{Clear: true, Runbook: str("https://wiki/x")}).apply(old); got.Owner != "" || got.Runbook != "https://wiki/x" || got.Fields != nil {
+		t.Errorf("clear: got %+v", got)
+	}
+	if got := (NotesUpdate{Clear: true}).apply(old); got != nil {
+		t.Errorf("clearing everything should leave no notes, got %+v", got)
+	}
+}
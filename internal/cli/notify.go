@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultNotifyMinDuration 未配置 notify.min_duration 时，只通知运行超过该时长的任务
+	defaultNotifyMinDuration = time.Minute
+	// notifyTimeout 等待通知命令退出的时间上限；命令在进程退出前完成才能可靠地送达
+	notifyTimeout = 5 * time.Second
+)
+
+// desktopNotification 返回发送桌面通知的命令：macOS 用 osascript，Windows 用 PowerShell toast，其他系统用 notify-send
+func desktopNotification(ctx context.Context, goos, title, message string) *exec.Cmd {
+	switch goos {
+	case "darwin":
+		// 标题和内容作为参数传入，无需转义
+		return exec.CommandContext(ctx, "osascript",
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run",
+			title, message)
+	case "windows":
+		script := `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode(` + psQuote(title) + `)) > $null
+$text.Item(1).AppendChild($xml.CreateTextNode(` + psQuote(message) + `)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('gmssh').Show([Windows.UI.Notifications.ToastNotification]::new($xml))`
+		return exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	default:
+		return exec.CommandContext(ctx, "notify-send", "--app-name=gmssh", title, message)
+	}
+}
+
+// psQuote PowerShell 单引号字符串，内部的单引号写两次
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// notifyTask 配置了 notify.desktop 且任务运行超过 notify.min_duration 时发送完成或失败的桌面通知。
+// 通知失败（如没有图形会话）只输出警告，不影响命令的结果
+func (c *CLI) notifyTask(task string, start time.Time, err error) {
+	cfg := c.config.Notify
+	if !cfg.Desktop {
+		return
+	}
+	minDuration := cfg.MinDuration
+	if minDuration <= 0 {
+		minDuration = defaultNotifyMinDuration
+	}
+	elapsed := time.Since(start)
+	if elapsed < minDuration {
+		return
+	}
+
+	title := "gmssh: transfer finished"
+	message := fmt.Sprintf("%s (%s)", task, elapsed.Round(time.Second))
+	if err != nil {
+		title = "gmssh: transfer failed"
+		message = fmt.Sprintf("%s: %v", task, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	if err := desktopNotification(ctx, runtime.GOOS, title, message).Run(); err != nil && !c.batch.Quiet {
+		fmt.Fprintf(os.Stderr, "Warning: desktop notification failed: %v\n", err)
+	}
+}
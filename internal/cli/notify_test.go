@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDesktopNotification(t *testing.T) {
+	ctx := context.Background()
+	cmd := desktopNotification(ctx, "linux", "done", "upload a -> b")
+	if got := strings.Join(cmd.Args, " "); got != "notify-send --app-name=gmssh done upload a -> b" {
+		t.Errorf("linux args = %q", got)
+	}
+
+	// macOS 的标题和内容作为参数传入，不拼进脚本
+	cmd = desktopNotification(ctx, "darwin", `it's "done"`, "msg")
+	if n := len(cmd.Args); cmd.Args[n-2] != `it's "done"` || cmd.Args[n-1] != "msg" {
+		t.Errorf("darwin args = %q", cmd.Args)
+	}
+
+	cmd = desktopNotification(ctx, "windows", "done", "it's here")
+	if script := cmd.Args[len(cmd.Args)-1]; !strings.Contains(script, `CreateTextNode('it''s here')`) {
+		t.Errorf("windows script = %s", script)
+	}
+}
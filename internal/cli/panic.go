@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/config"
+)
+
+// defaultWebAddr gmssh web 的默认监听地址
+const defaultWebAddr = "0.0.0.0:18081"
+
+// panicTimeout 等待 Web 服务完成紧急停止的时间
+const panicTimeout = 30 * time.Second
+
+// PanicResult 紧急停止的结果，与 /api/panic 的响应一致
+type PanicResult struct {
+	Proxies        int `json:"proxies"`
+	PortalMappings int `json:"portal_mappings"`
+	AgentForwards  int `json:"agent_forwards"`
+	Sessions       int `json:"sessions"`
+	Uploads        int `json:"uploads"`
+	Chains         int `json:"chains"`
+}
+
+// PanicCommand 请求本机运行的 gmssh web 立即停止所有转发、Portal 映射、终端会话和传输并断开所有链。
+// addr、token 为空时的推断见 webEndpoint
+func (c *CLI) PanicCommand(addr, token string, asJSON bool) error {
+	addr, token = c.webEndpoint(addr, token)
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/api/panic", nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := (&http.Client{Timeout: panicTimeout}).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach gmssh web at %s: %w", addr, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("panic rejected (%s): %s", resp.Status, apiErr.Error)
+		}
+		return fmt.Errorf("panic rejected: %s", resp.Status)
+	}
+
+	var result PanicResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", addr, err)
+	}
+	if asJSON {
+		return json.NewEncoder(os.Stdout).Encode(result)
+	}
+	fmt.Printf("Emergency stop done on %s\n", addr)
+	fmt.Printf("  Proxies stopped:          %d\n", result.Proxies)
+	fmt.Printf("  Portal mappings disabled: %d\n", result.PortalMappings)
+	fmt.Printf("  Agent forwards stopped:   %d\n", result.AgentForwards)
+	fmt.Printf("  Terminal sessions closed: %d\n", result.Sessions)
+	fmt.Printf("  Uploads canceled:         %d\n", result.Uploads)
+	fmt.Printf("  Chains disconnected:      %d\n", result.Chains)
+	return nil
+}
+
+// webEndpoint 推断本机运行的 gmssh web 的地址和令牌：addr 为空时按 web.bind（再默认 defaultWebAddr），
+// token 为空时依次使用 GMSSH_AUTH_TOKEN 和配置中第一个管理员的令牌
+func (c *CLI) webEndpoint(addr, token string) (string, string) {
+	settings := config.Effective(c.config)
+	if addr == "" {
+		addr = settings.WebBind
+	}
+	if addr == "" {
+		addr = defaultWebAddr
+	}
+	if token == "" {
+		token = settings.AuthToken
+	}
+	if token == "" {
+		for _, user := range c.config.Web.Users {
+			if user.IsAdmin() {
+				token = user.Token
+				break
+			}
+		}
+	}
+	return dialableAddr(addr), token
+}
+
+// dialableAddr 把监听所有地址的 host（0.0.0.0、::、空）换成本机回环地址
+func dialableAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
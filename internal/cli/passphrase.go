@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/pkg/types"
+	"golang.org/x/term"
+)
+
+// EnableKeyPassphrasePrompt 连接使用加密私钥、又没有配置 key_passphrase 的服务器时在终端上询问口令（不回显），
+// 同一私钥在本次命令中只询问一次。--batch 模式或标准输入不是终端时不询问，连接直接失败
+func (c *CLI) EnableKeyPassphrasePrompt() {
+	if c.batch.Batch || !term.IsTerminal(int(os.Stdin.Fd())) {
+		ssh.SetPassphrasePrompt(nil)
+		return
+	}
+	ssh.SetPassphrasePrompt(promptKeyPassphrase)
+}
+
+// promptKeyPassphrase 从终端读取 hop 私钥的口令，提示写到标准错误，不影响 --quiet 的输出
+func promptKeyPassphrase(hop *types.Hop) (string, error) {
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key '%s' (%s): ", hop.KeyPath, hop.Name)
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return string(passphrase), err
+}
+
+// sudoPrompt upload.sudo 的 password: prompt 使用的询问函数，--batch 模式或标准输入不是终端时为 nil（上传失败并说明原因）
+func (c *CLI) sudoPrompt() func(hop *types.Hop) (string, error) {
+	if c.batch.Batch || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil
+	}
+	return func(hop *types.Hop) (string, error) {
+		fmt.Fprintf(os.Stderr, "\n[sudo] password for %s@%s: ", hop.User, hop.Name)
+		password, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+}
+
+// EnableKeyboardInteractivePrompt 服务器（如启用二次验证的跳板机）在键盘交互认证中提出密码以外的问题时在终端上询问。
+// --batch 模式或标准输入不是终端时不询问，密码认证的服务器仍用登录密码回答
+func (c *CLI) EnableKeyboardInteractivePrompt() {
+	if c.batch.Batch || !term.IsTerminal(int(os.Stdin.Fd())) {
+		ssh.SetInteractivePrompt(nil)
+		return
+	}
+	ssh.SetInteractivePrompt(promptKeyboardInteractive)
+}
+
+// promptKeyboardInteractive 逐个询问 challenge 中的问题，不回显的问题（验证码、密码）用 ReadPassword 读取
+func promptKeyboardInteractive(hop *types.Hop, challenge ssh.Challenge) ([]string, error) {
+	fmt.Fprintf(os.Stderr, "Authentication required for %s@%s\n", challenge.User, hop.Name)
+	if challenge.Instruction != "" {
+		fmt.Fprintln(os.Stderr, challenge.Instruction)
+	}
+	answers := make([]string, len(challenge.Questions))
+	for i, question := range challenge.Questions {
+		fmt.Fprint(os.Stderr, question.Prompt)
+		var answer []byte
+		var err error
+		if question.Echo {
+			answer, err = readLine(os.Stdin)
+		} else {
+			answer, err = term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Fprintln(os.Stderr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		answers[i] = string(answer)
+	}
+	return answers, nil
+}
+
+// readLine 逐字节读取一行（不含换行），不预读，之后的命令仍能读到剩余的标准输入
+func readLine(r io.Reader) ([]byte, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				return bytes.TrimSuffix(line, []byte("\r")), nil
+			}
+			line = append(line, buf[0])
+		}
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return line, nil
+			}
+			return nil, err
+		}
+	}
+}
@@ -2,18 +2,14 @@ package cli
 
 import (
 	"context"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/tls"
-	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/pem"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"math/big"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
@@ -21,10 +17,16 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/luobobo896/HSSH/internal/config"
 	"github.com/luobobo896/HSSH/internal/portal/client"
+	"github.com/luobobo896/HSSH/internal/portal/protocol"
 	"github.com/luobobo896/HSSH/internal/portal/server"
+	"github.com/luobobo896/HSSH/internal/probe"
+	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/internal/resolver"
 	"github.com/luobobo896/HSSH/pkg/portal"
 	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
 )
 
 // PortalCommand portal CLI command
@@ -40,11 +42,29 @@ type PortalCommand struct {
 	tlsCert string
 	tlsKey  string
 
+	// healthListen serves /healthz and /readyz for orchestrators
+	healthListen string
+
+	// Cluster flags
+	nodeID        string
+	peers         string
+	clusterSecret string
+	nextSecret    string
+
 	// Client flags
 	local      string
 	remote     string
 	serverAddr string
 	via        string
+	allowLAN   bool
+	resolver   string
+
+	// Stream limits: per mapping on the client, defaults on the server
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+
+	// Batch fails instead of asking for confirmation (global --batch)
+	Batch bool
 }
 
 // Name returns command name
@@ -64,26 +84,55 @@ func (c *PortalCommand) Usage() string {
 Options:
   --server          以服务端模式运行
   --client          以客户端模式运行
-  --config PATH     配置文件路径
+  --config PATH     配置文件路径（客户端：YAML，client.mappings 列出要运行的映射，SIGHUP 重新加载）
 
 Server Mode:
   --listen ADDR     监听地址 (默认 :18888)
-  --token TOKEN     认证令牌
+  --token TOKEN     认证令牌 (默认取 GMSSH_AUTH_TOKEN)
   --tls-cert PATH   TLS 证书路径
   --tls-key PATH    TLS 密钥路径
+  --health-listen ADDR  HTTP 健康检查地址，提供 /healthz、/readyz 和映射统计 /stats (例如 :18889)
+  --idle-timeout D  映射未设置时，流空闲超过该时间后关闭 (例如 10m，默认不限制)
+  --max-lifetime D  映射未设置时，流的最长存活时间 (例如 24h，默认不限制)
+
+HA Cluster (服务端):
+  --node-id ID          节点 ID (默认主机名)
+  --peers ADDRS         其他节点的 portal 地址，逗号分隔
+  --cluster-secret S    节点间同步的共享密钥
+  --cluster-secret-next S  轮换中的下一个密钥，与 --cluster-secret 同时有效
+  所有节点需使用相同的 --tls-cert/--tls-key，并置于同一 VIP/DNS 之后
+  不停机轮换密钥：依次在每个节点上 PUT --health-listen 的 /cluster/secrets
+  (Authorization: Bearer <当前密钥>)，先 {"next":"新"}，再 {"current":"新","next":"旧"}，
+  GET /cluster/secrets 显示各节点都已使用新密钥后 {"next":""}
+  集中管理映射：--health-listen 的 /mappings (Authorization: Bearer <令牌>)，
+  GET 列出该令牌的映射，PUT 添加/更新 (body 为带 local_addr 的 PortMapping)，DELETE ?id= 删除；
+  变更推送给该令牌所有已连接的客户端，并同步到其他节点
 
 Client Mode:
   --local ADDR      本地监听地址 (例如 :8080)
   --remote HOST:PORT 远程目标地址
+  --config PATH     从文件加载映射，可与 --local/--remote 同时使用或单独使用
+                    客户端始终运行服务端为该令牌推送的映射，它们和文件中的映射一样受 --allow-lan 限制
   --server-addr ADDR     Portal服务器地址 (例如 portal.example.com:18888)
   --via IDS         中转服务器 ID，逗号分隔
+  --allow-lan       允许监听本机以外可访问的地址（需确认），默认只监听 127.0.0.1
+  --resolver MODE   服务端解析远程主机的方式：system（默认）或 dns:<server>，结果按 TTL 缓存
+  --idle-timeout D  该映射的流空闲超过该时间后由服务端关闭
+  --max-lifetime D  该映射的流的最长存活时间
 
 Examples:
   # 服务端模式
   hssh portal --server --listen :18888 --token "my-token"
 
+  # 双节点 HA
+  hssh portal --server --token "my-token" --tls-cert cert.pem --tls-key key.pem \
+    --node-id a --peers 10.0.0.2:18888 --cluster-secret "s3cret"
+
   # 客户端模式 (单映射)
   hssh portal --client --local :8080 --remote 192.168.1.10:80 --server-addr portal.example.com:18888
+
+  # 客户端守护进程：文件中的映射 + 服务端推送的映射，kill -HUP 重新加载文件
+  hssh portal --client --config portal.yaml --server-addr portal.example.com:18888 --token "my-token"
 `
 }
 
@@ -98,12 +147,25 @@ func (c *PortalCommand) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.token, "token", "", "Auth token")
 	f.StringVar(&c.tlsCert, "tls-cert", "", "TLS certificate path")
 	f.StringVar(&c.tlsKey, "tls-key", "", "TLS key path")
+	f.StringVar(&c.healthListen, "health-listen", "", "HTTP address for /healthz and /readyz probes")
+
+	// Cluster flags
+	f.StringVar(&c.nodeID, "node-id", "", "Cluster node ID (default hostname)")
+	f.StringVar(&c.peers, "peers", "", "Comma-separated peer node addresses")
+	f.StringVar(&c.clusterSecret, "cluster-secret", "", "Shared secret for peer sync")
+	f.StringVar(&c.nextSecret, "cluster-secret-next", "", "Next shared secret, accepted alongside --cluster-secret during a rotation")
 
 	// Client flags
 	f.StringVar(&c.local, "local", "", "Local listen address")
 	f.StringVar(&c.remote, "remote", "", "Remote target (host:port)")
 	f.StringVar(&c.serverAddr, "server-addr", "", "Portal server address")
 	f.StringVar(&c.via, "via", "", "Comma-separated hop IDs")
+	f.BoolVar(&c.allowLAN, "allow-lan", false, "Allow listening on addresses reachable from other machines")
+	f.StringVar(&c.resolver, "resolver", "", "How the server resolves the remote host: system or dns:<server>")
+
+	// Stream limits
+	f.DurationVar(&c.idleTimeout, "idle-timeout", 0, "Close streams idle for this long (server: default for mappings)")
+	f.DurationVar(&c.maxLifetime, "max-lifetime", 0, "Close streams open for this long (server: default for mappings)")
 }
 
 // Run executes the command
@@ -129,26 +191,83 @@ func (c *PortalCommand) runServer() int {
 		return 1
 	}
 
+	// --token takes precedence over GMSSH_AUTH_TOKEN
+	token := c.token
+	if token == "" {
+		token = config.Effective(nil).AuthToken
+	}
+
 	// Create server config
 	serverConfig := &portal.ServerConfig{
 		Enabled:    true,
 		ListenAddr: c.listen,
 		AuthTokens: []portal.TokenConfig{
 			{
-				Token:          c.token,
+				Token:          token,
 				AllowedRemotes: []string{"0.0.0.0/0"}, // Allow all for now
 				MaxMappings:    10,
 			},
 		},
+		Cluster: portal.ClusterConfig{
+			NodeID:     c.nodeID,
+			Secret:     c.clusterSecret,
+			NextSecret: c.nextSecret,
+		},
+		StreamIdleTimeout: c.idleTimeout,
+		StreamMaxLifetime: c.maxLifetime,
+	}
+	for _, peer := range strings.Split(c.peers, ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			serverConfig.Cluster.Peers = append(serverConfig.Cluster.Peers, peer)
+		}
+	}
+	if serverConfig.Cluster.Enabled() && c.clusterSecret == "" {
+		log.Printf("[Portal] --cluster-secret is required with --peers")
+		return 1
+	}
+	if serverConfig.Cluster.Enabled() && (c.tlsCert == "" || c.tlsKey == "") {
+		log.Printf("[Portal] Cluster nodes must share a certificate: set --tls-cert and --tls-key")
+		return 1
 	}
 
-	// Create and start server
 	srv := server.NewServer(serverConfig, tlsConfig)
 
+	// Liveness and readiness probes, served before the tunnel listener so
+	// orchestrators see "starting" rather than connection refused
+	probes := probe.New()
+	if c.healthListen != "" {
+		mux := http.NewServeMux()
+		probes.Register(mux)
+		// Per-mapping stream counters, including streams closed by the limits
+		mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(srv.MappingStats())
+		})
+		// Which cluster secret each peer used; PUT rotates the secrets
+		mux.HandleFunc("/cluster/secrets", func(w http.ResponseWriter, r *http.Request) {
+			handleClusterSecrets(srv, w, r)
+		})
+		// Centrally managed mappings, pushed to the token's connected clients
+		mux.HandleFunc("/mappings", func(w http.ResponseWriter, r *http.Request) {
+			handleManagedMappings(srv, w, r)
+		})
+		healthLn, err := net.Listen("tcp", c.healthListen)
+		if err != nil {
+			log.Printf("[Portal] Failed to listen for health probes: %v", err)
+			return 1
+		}
+		healthSrv := &http.Server{Handler: mux}
+		defer healthSrv.Close()
+		go healthSrv.Serve(healthLn)
+		log.Printf("[Portal] Health probes on %s", c.healthListen)
+	}
+
+	// Listen for clients
 	if err := srv.Listen(c.listen); err != nil {
 		log.Printf("[Portal] Failed to listen: %v", err)
 		return 1
 	}
+	probes.SetReady()
 
 	// Setup signal handling
 	ctx, cancel := context.WithCancel(context.Background())
@@ -160,6 +279,7 @@ func (c *PortalCommand) runServer() int {
 	go func() {
 		<-sigCh
 		log.Println("[Portal] Shutting down...")
+		probes.SetDraining()
 		srv.Close()
 		cancel()
 	}()
@@ -190,8 +310,8 @@ func (c *PortalCommand) runServer() int {
 
 // runClient runs in client mode
 func (c *PortalCommand) runClient() int {
-	if c.local == "" || c.remote == "" {
-		fmt.Fprintln(os.Stderr, "Error: --local and --remote are required in client mode")
+	if c.config == "" && (c.local == "" || c.remote == "") {
+		fmt.Fprintln(os.Stderr, "Error: --local and --remote (or --config) are required in client mode")
 		return 1
 	}
 
@@ -200,24 +320,6 @@ func (c *PortalCommand) runClient() int {
 		return 1
 	}
 
-	// Parse remote address
-	remoteHost, remotePortStr, err := net.SplitHostPort(c.remote)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: invalid remote address format '%s': %v\n", c.remote, err)
-		return 1
-	}
-
-	remotePort, err := strconv.Atoi(remotePortStr)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: invalid remote port '%s': %v\n", remotePortStr, err)
-		return 1
-	}
-
-	// Create TLS config (insecure for now)
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true,
-	}
-
 	// Create client config
 	clientConfig := &portal.ClientConfig{
 		Connection: portal.ConnectionConfig{
@@ -226,18 +328,49 @@ func (c *PortalCommand) runClient() int {
 			KeepaliveInterval: 30 * time.Second,
 		},
 	}
+	if c.config != "" {
+		loaded, err := loadClientConfig(c.config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		clientConfig.Mappings = loaded.Mappings
+		if loaded.Connection.RetryInterval > 0 {
+			clientConfig.Connection.RetryInterval = loaded.Connection.RetryInterval
+		}
+		if loaded.Connection.MaxRetries > 0 {
+			clientConfig.Connection.MaxRetries = loaded.Connection.MaxRetries
+		}
+		if loaded.Connection.KeepaliveInterval > 0 {
+			clientConfig.Connection.KeepaliveInterval = loaded.Connection.KeepaliveInterval
+		}
+	}
 
-	// Parse via hops
-	var viaHops []string
-	if c.via != "" {
-		viaHops = strings.Split(c.via, ",")
-		for i := range viaHops {
-			viaHops[i] = strings.TrimSpace(viaHops[i])
+	var mapping *portal.PortMapping
+	if c.local != "" || c.remote != "" {
+		m, code := c.flagMapping()
+		if code != 0 {
+			return code
 		}
+		mapping = m
+	}
+
+	// Create TLS config (insecure for now)
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: true,
 	}
 
 	// Create client
 	cli := client.NewClient(clientConfig, tlsConfig, c.token, c.serverAddr)
+	// Mappings from the file and the server were not confirmed on this
+	// terminal; they may only expose LAN addresses with --allow-lan
+	cli.SetBindCheck(func(addr string) (string, error) {
+		addr, err := proxy.CheckBind(addr, c.allowLAN, c.allowLAN)
+		if errors.Is(err, proxy.ErrLANBindDisabled) {
+			return "", fmt.Errorf("%w (pass --allow-lan to expose it)", err)
+		}
+		return addr, err
+	})
 
 	// Connect to server
 	if err := cli.Connect(); err != nil {
@@ -246,33 +379,131 @@ func (c *PortalCommand) runClient() int {
 	}
 	defer cli.Close()
 
-	// Create mapping
-	mapping := portal.PortMapping{
+	if mapping != nil {
+		if err := cli.StartMapping(*mapping); err != nil {
+			log.Printf("[Portal] Failed to start mapping: %v", err)
+			return 1
+		}
+		log.Printf("[Portal] Client started: %s -> %s", mapping.LocalAddr, proxy.TargetAddr(mapping.RemoteHost, mapping.RemotePort))
+	}
+	if c.config != "" {
+		if err := cli.ReloadMappings(clientConfig.Mappings); err != nil {
+			log.Printf("[Portal] Some mappings from %s failed: %v", c.config, err)
+		}
+	}
+	// Mappings managed on the server follow their changes from now on
+	cli.SyncMappings()
+
+	// Wait for interrupt; SIGHUP reloads the mappings from --config
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	for sig := range sigCh {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if c.config == "" {
+			continue
+		}
+		loaded, err := loadClientConfig(c.config)
+		if err != nil {
+			log.Printf("[Portal] Reload failed, keeping current mappings: %v", err)
+			continue
+		}
+		if err := cli.ReloadMappings(loaded.Mappings); err != nil {
+			log.Printf("[Portal] Some mappings from %s failed: %v", c.config, err)
+		}
+		log.Printf("[Portal] Reloaded %d mappings from %s", len(loaded.Mappings), c.config)
+	}
+	log.Println("[Portal] Shutting down...")
+
+	return 0
+}
+
+// flagMapping builds the single mapping given by --local and --remote
+func (c *PortalCommand) flagMapping() (*portal.PortMapping, int) {
+	if c.local == "" || c.remote == "" {
+		fmt.Fprintln(os.Stderr, "Error: --local and --remote must be given together")
+		return nil, 1
+	}
+
+	localAddr, err := bindAddr(c.local, c.allowLAN, !c.Batch)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return nil, ExitCode(err)
+	}
+
+	// Parse remote address: host:port, or a unix socket path on the portal server
+	remoteHost, remotePort := c.remote, 0
+	if !proxy.IsUnixSocket(c.remote) {
+		host, remotePortStr, err := net.SplitHostPort(c.remote)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid remote address format '%s': %v\n", c.remote, err)
+			return nil, 1
+		}
+		remoteHost = host
+		remotePort, err = strconv.Atoi(remotePortStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid remote port '%s': %v\n", remotePortStr, err)
+			return nil, 1
+		}
+	}
+
+	if _, err := resolver.ParseMode(c.resolver); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return nil, 1
+	}
+
+	// Parse via hops
+	var viaHops []string
+	if c.via != "" {
+		viaHops = strings.Split(c.via, ",")
+		for i := range viaHops {
+			viaHops[i] = strings.TrimSpace(viaHops[i])
+		}
+	}
+
+	return &portal.PortMapping{
 		ID:         uuid.New().String(),
 		Name:       "cli-mapping",
-		LocalAddr:  c.local,
+		LocalAddr:  localAddr,
 		RemoteHost: remoteHost,
 		RemotePort: remotePort,
 		Via:        viaHops,
 		Protocol:   portal.ProtocolTCP,
 		Enabled:    true,
-	}
-
-	if err := cli.StartMapping(mapping); err != nil {
-		log.Printf("[Portal] Failed to start mapping: %v", err)
-		return 1
-	}
-
-	log.Printf("[Portal] Client started: %s -> %s:%d", c.local, remoteHost, remotePort)
+		Resolver:   c.resolver,
 
-	// Wait for interrupt
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-
-	<-sigCh
-	log.Println("[Portal] Shutting down...")
+		IdleTimeout: c.idleTimeout,
+		MaxLifetime: c.maxLifetime,
+	}, 0
+}
 
-	return 0
+// loadClientConfig reads the client section of a portal config file and
+// checks that every mapping can be told apart on reload
+func loadClientConfig(path string) (*portal.ClientConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var cfg portal.PortalConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	seen := make(map[string]bool, len(cfg.Client.Mappings))
+	for _, m := range cfg.Client.Mappings {
+		if m.ID == "" {
+			return nil, fmt.Errorf("%s: mapping %q needs an id", path, m.Name)
+		}
+		if seen[m.ID] {
+			return nil, fmt.Errorf("%s: duplicate mapping id %s", path, m.ID)
+		}
+		seen[m.ID] = true
+		if _, err := resolver.ParseMode(m.Resolver); err != nil {
+			return nil, fmt.Errorf("%s: mapping %s: %w", path, m.ID, err)
+		}
+	}
+	return &cfg.Client, nil
 }
 
 // loadServerTLS loads TLS configuration for server
@@ -280,7 +511,7 @@ func (c *PortalCommand) loadServerTLS() (*tls.Config, error) {
 	if c.tlsCert == "" || c.tlsKey == "" {
 		// Generate self-signed cert for development
 		log.Println("[Portal] Warning: Using auto-generated TLS certificate")
-		return generateSelfSignedTLS()
+		return protocol.GenerateSelfSignedTLS()
 	}
 
 	cert, err := tls.LoadX509KeyPair(c.tlsCert, c.tlsKey)
@@ -293,44 +524,64 @@ func (c *PortalCommand) loadServerTLS() (*tls.Config, error) {
 	}, nil
 }
 
-// generateSelfSignedTLS generates a self-signed certificate for testing
-func generateSelfSignedTLS() (*tls.Config, error) {
-	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate key: %w", err)
-	}
-
-	template := x509.Certificate{
-		SerialNumber: big.NewInt(1),
-		Subject: pkix.Name{
-			Organization: []string{"HSSH Portal"},
-		},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().Add(24 * time.Hour),
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
-		BasicConstraintsValid: true,
-		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
-	}
-
-	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create certificate: %w", err)
+// handleClusterSecrets serves GET (secret usage per peer) and PUT (a
+// server.SecretUpdate authorized with either active cluster secret)
+func handleClusterSecrets(srv *server.Server, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		secret := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !srv.ValidClusterSecret(secret) {
+			http.Error(w, "invalid cluster secret", http.StatusUnauthorized)
+			return
+		}
+		var update server.SecretUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := srv.SetClusterSecrets(update); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(srv.SecretStats())
+}
 
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
-	privBytes, err := x509.MarshalECPrivateKey(priv)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal private key: %w", err)
+// handleManagedMappings serves the mappings a token's clients run: GET lists
+// them, PUT adds or updates one (a portal.PortMapping with local_addr) and
+// DELETE ?id= removes one. The token in the Authorization header owns them.
+func handleManagedMappings(srv *server.Server, w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if _, ok := srv.Store().Token(token); !ok || token == "" {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
 	}
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privBytes})
-
-	cert, err := tls.X509KeyPair(certPEM, keyPEM)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load key pair: %w", err)
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var mapping portal.PortMapping
+		if err := json.NewDecoder(r.Body).Decode(&mapping); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := srv.PutManagedMapping(token, mapping); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		if err := srv.RemoveManagedMapping(token, r.URL.Query().Get("id")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
 	}
-
-	return &tls.Config{
-		Certificates: []tls.Certificate{cert},
-	}, nil
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(srv.ManagedMappings(token))
 }
@@ -0,0 +1,205 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/internal/ssh"
+)
+
+// maxProxyPairs 一条 proxy 命令最多启动的转发数
+const maxProxyPairs = 256
+
+// proxyPair 一个远端目标及其本地监听地址；localhost 在 127.0.0.1 和 ::1 上各监听一次
+type proxyPair struct {
+	locals     []string
+	remoteHost string
+	remotePort int
+}
+
+// parsePortSpec 解析端口或端口范围（9000、9000-9010），返回其中的端口
+func parsePortSpec(spec string, allowZero bool) ([]int, error) {
+	first, last, isRange := strings.Cut(spec, "-")
+	from, err := strconv.Atoi(first)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", spec)
+	}
+	to := from
+	if isRange {
+		if to, err = strconv.Atoi(last); err != nil {
+			return nil, fmt.Errorf("invalid port range %q", spec)
+		}
+	}
+	switch {
+	case from == 0 && allowZero && !isRange:
+		return []int{0}, nil
+	case from < 1 || to > 65535 || from > to:
+		return nil, fmt.Errorf("invalid port range %q", spec)
+	case to-from+1 > maxProxyPairs:
+		return nil, fmt.Errorf("port range %q has more than %d ports", spec, maxProxyPairs)
+	}
+	ports := make([]int, 0, to-from+1)
+	for p := from; p <= to; p++ {
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+// splitPortSpec 拆分 host:ports，host 可以为空或是 [IPv6]
+func splitPortSpec(addr string) (string, string, error) {
+	i := strings.LastIndex(addr, ":")
+	if i < 0 {
+		return "", "", fmt.Errorf("missing port in %q", addr)
+	}
+	host := addr[:i]
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	return host, addr[i+1:], nil
+}
+
+// localHosts 监听的主机：localhost 同时监听 127.0.0.1 和 ::1（双栈），其他原样
+func localHosts(host string) []string {
+	if host == "localhost" {
+		return []string{"127.0.0.1", "::1"}
+	}
+	return []string{host}
+}
+
+// parseProxyTargets 解析 host:port 或 host:port-port 形式的远端目标，端口范围展开为多个目标；
+// 绝对路径（或 unix: 前缀）是链路末端服务器上的 unix socket
+func parseProxyTargets(specs []string) ([]proxyPair, error) {
+	var targets []proxyPair
+	for _, spec := range specs {
+		if path, ok := proxy.UnixSocketPath(spec); ok {
+			targets = append(targets, proxyPair{remoteHost: path})
+			continue
+		}
+		host, ports, err := splitPortSpec(spec)
+		if err != nil || host == "" {
+			return nil, fmt.Errorf("invalid remote target %q, expected host:port", spec)
+		}
+		list, err := parsePortSpec(ports, false)
+		if err != nil {
+			return nil, fmt.Errorf("remote target %s: %w", spec, err)
+		}
+		for _, port := range list {
+			targets = append(targets, proxyPair{remoteHost: host, remotePort: port})
+		}
+	}
+	if len(targets) > maxProxyPairs {
+		return nil, fmt.Errorf("%d remote targets exceed the limit of %d", len(targets), maxProxyPairs)
+	}
+	return targets, nil
+}
+
+// readProxyTargets 读取目标文件：每行一个 host:port 或 host:port-port，忽略空行和 # 开头的注释
+func readProxyTargets(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var specs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			specs = append(specs, line)
+		}
+	}
+	return specs, scanner.Err()
+}
+
+// proxyPairs 按顺序把本地端口与远端目标配对：端口范围的长度须与目标数相同；
+// 本地端口为 0 时每个目标都监听一个随机端口；本地地址为 unix socket 路径时只能有一个目标
+func proxyPairs(local string, targets []proxyPair) ([]proxyPair, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no remote target")
+	}
+	if path, ok := proxy.UnixSocketPath(local); ok {
+		if len(targets) != 1 {
+			return nil, fmt.Errorf("unix socket %s can forward only one remote target, got %d", path, len(targets))
+		}
+		target := targets[0]
+		target.locals = []string{path}
+		return []proxyPair{target}, nil
+	}
+	host, portSpec, err := splitPortSpec(local)
+	if err != nil {
+		return nil, err
+	}
+	ports, err := parsePortSpec(portSpec, true)
+	if err != nil {
+		return nil, err
+	}
+	if ports[0] == 0 {
+		ports = make([]int, len(targets))
+	} else if len(ports) != len(targets) {
+		return nil, fmt.Errorf("%d local port(s) for %d remote target(s); the counts must match", len(ports), len(targets))
+	}
+
+	pairs := make([]proxyPair, len(targets))
+	for i, target := range targets {
+		for _, h := range localHosts(host) {
+			target.locals = append(target.locals, net.JoinHostPort(h, strconv.Itoa(ports[i])))
+		}
+		pairs[i] = target
+	}
+	return pairs, nil
+}
+
+// proxyListener 汇总表中的一行：一个本地监听地址的转发器及其启动结果
+type proxyListener struct {
+	local     string
+	remote    string
+	forwarder *proxy.PortForwarder
+	err       error
+}
+
+// startProxyForwards 经同一条链为每个本地监听地址启动转发器；随机端口的目标在两个地址族上使用同一个端口。
+// 单个地址启动失败（如端口被占用、本机未启用 IPv6）只记录在结果中
+func startProxyForwards(chain *ssh.Chain, pairs []proxyPair) []proxyListener {
+	var listeners []proxyListener
+	for _, pair := range pairs {
+		remote := proxy.TargetAddr(pair.remoteHost, pair.remotePort)
+		port := ""
+		for _, local := range pair.locals {
+			if host, p, _ := net.SplitHostPort(local); p == "0" && port != "" {
+				local = net.JoinHostPort(host, port)
+			}
+			l := proxyListener{local: local, remote: remote}
+			forwarder := proxy.NewPortForwarder(chain, local, pair.remoteHost, pair.remotePort)
+			if err := forwarder.Start(); err != nil {
+				l.err = err
+			} else {
+				l.forwarder = forwarder
+				l.local = forwarder.GetLocalAddr()
+				_, port, _ = net.SplitHostPort(l.local)
+			}
+			listeners = append(listeners, l)
+		}
+	}
+	return listeners
+}
+
+// printProxyTable 输出每个监听地址的转发及其状态
+func printProxyTable(out io.Writer, listeners []proxyListener) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LOCAL\tREMOTE\tSTATUS")
+	for _, l := range listeners {
+		status := "listening"
+		if l.err != nil {
+			status = l.err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", l.local, l.remote, status)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProxyPairs(t *testing.T) {
+	targets, err := parseProxyTargets([]string{"db:5432", "web:8080-8081"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pairs, err := proxyPairs("127.0.0.1:9000-9002", targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []proxyPair{
+		{locals: []string{"127.0.0.1:9000"}, remoteHost: "db", remotePort: 5432},
+		{locals: []string{"127.0.0.1:9001"}, remoteHost: "web", remotePort: 8080},
+		{locals: []string{"127.0.0.1:9002"}, remoteHost: "web", remotePort: 8081},
+	}
+	if !reflect.DeepEqual(pairs, want) {
+		t.Errorf("pairs = %+v", pairs)
+	}
+
+	// localhost 双栈监听，随机端口
+	pairs, err = proxyPairs("localhost:0", targets[:1])
+	if err != nil || !reflect.DeepEqual(pairs[0].locals, []string{"127.0.0.1:0", "[::1]:0"}) {
+		t.Errorf("localhost pairs = %+v, %v", pairs, err)
+	}
+
+	for _, local := range []string{"127.0.0.1:9000-9001", "127.0.0.1:9000", "127.0.0.1:9002-9000", "127.0.0.1:0-2", "9000", "/tmp/app.sock"} {
+		if _, err := proxyPairs(local, targets); err == nil {
+			t.Errorf("proxyPairs(%q) succeeded", local)
+		}
+	}
+
+	// unix socket 两端
+	socketTargets, err := parseProxyTargets([]string{"/var/run/postgresql/.s.PGSQL.5432"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs, err = proxyPairs("unix:/tmp/pg.sock", socketTargets)
+	want = []proxyPair{{locals: []string{"/tmp/pg.sock"}, remoteHost: "/var/run/postgresql/.s.PGSQL.5432"}}
+	if err != nil || !reflect.DeepEqual(pairs, want) {
+		t.Errorf("unix socket pairs = %+v, %v", pairs, err)
+	}
+}
+
+func TestParseProxyTargets(t *testing.T) {
+	for _, spec := range []string{"db", ":5432", "db:0", "db:x", "db:1-70000", "db:1-1000"} {
+		if _, err := parseProxyTargets([]string{spec}); err == nil {
+			t.Errorf("parseProxyTargets(%q) succeeded", spec)
+		}
+	}
+	targets, err := parseProxyTargets([]string{"[fd00::1]:22"})
+	if err != nil || targets[0].remoteHost != "fd00::1" || targets[0].remotePort != 22 {
+		t.Errorf("IPv6 target = %+v, %v", targets, err)
+	}
+}
+
+func TestReadProxyTargets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets")
+	os.WriteFile(path, []byte("# databases\ndb1:5432\n\n  db2:5432  \n"), 0600)
+	specs, err := readProxyTargets(path)
+	if err != nil || !reflect.DeepEqual(specs, []string{"db1:5432", "db2:5432"}) {
+		t.Errorf("specs = %q, %v", specs, err)
+	}
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/search"
+)
+
+// SearchCommand 在本机的服务器、Portal 映射、传输记录和审计日志（hssh web 写入配置目录的 audit.log）中搜索。
+// kinds 为逗号分隔的结果类型，days 大于 0 时只搜索最近 days 天的传输和审计记录
+func (c *CLI) SearchCommand(query, kinds string, days, limit int, asJSON bool) error {
+	var opts search.Options
+	if kinds != "" {
+		for _, t := range strings.Split(kinds, ",") {
+			if !search.ValidType(t) {
+				return withExitCode(ExitUsage, fmt.Errorf("unknown type %q (one of %s)", t, strings.Join(search.Types, ", ")))
+			}
+			opts.Types = append(opts.Types, t)
+		}
+	}
+	if days > 0 {
+		opts.Since = time.Now().AddDate(0, 0, -days)
+	}
+	opts.Limit = limit
+
+	src := search.Source{Config: c.config, AuditPath: filepath.Join(c.config.ConfigDir, audit.FileName)}
+	resp, err := search.Search(src, query, opts)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(resp)
+	}
+	if resp.Total == 0 {
+		fmt.Printf("No results for '%s'\n", query)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tTIME\tTITLE\tDETAIL")
+	for _, r := range resp.Results {
+		at := "-"
+		if !r.Time.IsZero() {
+			at = r.Time.Local().Format("2006-01-02 15:04")
+		}
+		detail := r.Detail
+		if r.User != "" {
+			detail = strings.TrimSpace(detail + " (" + r.User + ")")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Type, at, r.Title, detail)
+	}
+	tw.Flush()
+
+	facets := make([]string, 0, len(search.Types))
+	for _, t := range search.Types {
+		facets = append(facets, fmt.Sprintf("%s %d", t, resp.Facets[t]))
+	}
+	fmt.Printf("\n%d of %d results (%s)\n", len(resp.Results), resp.Total, strings.Join(facets, ", "))
+	return nil
+}
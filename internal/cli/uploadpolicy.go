@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/transfer"
+	"github.com/luobobo896/HSSH/internal/uploadpolicy"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// checkUploadPolicy 按 upload.policy 检查要上传到 hop 上 targetPath 的本地文件或目录 source（与 gmssh web 使用同一份配置）。
+// 违反策略时在配置目录的审计日志中记录 policy.violation，并以 ExitPolicy 退出
+func (c *CLI) checkUploadPolicy(hop *types.Hop, source, targetPath string) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	err := uploadpolicy.Check(ctx, &c.config.Upload.Policy, hop, source, targetPath)
+	var violation *uploadpolicy.Violation
+	if !errors.As(err, &violation) {
+		return err
+	}
+	c.recordPolicyViolation(violation, hop, targetPath)
+	return withExitCode(ExitPolicy, err)
+}
+
+// recordPolicyViolation 写入审计日志，失败时只输出警告
+func (c *CLI) recordPolicyViolation(violation *uploadpolicy.Violation, hop *types.Hop, targetPath string) {
+	if c.config.ConfigDir == "" {
+		return
+	}
+	log, err := audit.Open(filepath.Join(c.config.ConfigDir, audit.FileName))
+	if err == nil {
+		err = log.Record(audit.Event{
+			User:   cliUser,
+			Action: uploadpolicy.AuditAction,
+			Error:  violation.Detail,
+			Detail: fmt.Sprintf("%s %s -> %s:%s", violation.Rule, violation.File, hop.Name, transfer.ObjectTarget{URL: targetPath}.Redacted()),
+		})
+		log.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record the policy violation in the audit log: %v\n", err)
+	}
+}
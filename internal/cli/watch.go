@@ -0,0 +1,249 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/profiler"
+	"github.com/luobobo896/HSSH/internal/proxy"
+)
+
+const (
+	// DefaultWatchInterval --watch 的默认刷新间隔
+	DefaultWatchInterval = 10 * time.Second
+	// watchProbeTimeout 没有运行中的 gmssh web 时，本地探测一台服务器的时间上限
+	watchProbeTimeout = 30 * time.Second
+	// watchProbeConcurrency 本地同时探测的服务器数量
+	watchProbeConcurrency = 8
+	// clearScreen 光标移到左上角并清屏
+	clearScreen = "\033[H\033[2J"
+)
+
+// watchServer GET /api/status 中的一台服务器
+type watchServer struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"` // up | down | unknown
+	LatencyMs float64   `json:"latency_ms,omitempty"`
+	LastCheck time.Time `json:"last_check,omitempty"`
+	// LegacyCrypto 允许协商已弃用的算法
+	LegacyCrypto bool `json:"legacy_crypto,omitempty"`
+}
+
+// watchTunnel GET /api/status 中的一个转发或 Portal 映射
+type watchTunnel struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"` // proxy | portal
+	Active  bool   `json:"active"`
+	Exposed bool   `json:"exposed,omitempty"`
+}
+
+// statusDashboard status --watch 每次刷新显示的内容
+type statusDashboard struct {
+	Source   string // 数据来源：gmssh web 的地址或本地探测
+	Servers  []watchServer
+	Tunnels  []watchTunnel
+	Sessions int // 终端会话数，-1 表示未知（没有运行中的 gmssh web）
+}
+
+// watchLoop 每隔 interval 调用 render 并刷新整屏，直到 Ctrl+C；render 的输出先写入缓冲区，避免闪烁
+func watchLoop(interval time.Duration, render func(ctx context.Context, out io.Writer)) error {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var buf bytes.Buffer
+		render(ctx, &buf)
+		if ctx.Err() != nil {
+			return nil
+		}
+		fmt.Fprintf(&buf, "\nRefreshing every %s, Ctrl+C to quit\n", interval)
+		os.Stdout.WriteString(clearScreen + buf.String())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// StatusWatchCommand 持续刷新服务器延迟、转发和终端会话的简要面板。本机运行着 gmssh web 时
+// 读取它的 /api/status 和 /api/sessions（与 Web 界面相同的数据），否则每次刷新在本地探测所有服务器
+func (c *CLI) StatusWatchCommand(interval time.Duration) error {
+	addr, token := c.webEndpoint("", "")
+	return watchLoop(interval, func(ctx context.Context, out io.Writer) {
+		dashboard, err := webDashboard(ctx, addr, token)
+		if err != nil {
+			dashboard = c.localDashboard(ctx)
+		}
+		fmt.Fprintf(out, "gmssh status  %s  (%s)\n\n", time.Now().Format("2006-01-02 15:04:05"), dashboard.Source)
+		renderStatusDashboard(out, dashboard)
+	})
+}
+
+// webDashboard 从运行中的 gmssh web 读取状态
+func webDashboard(ctx context.Context, addr, token string) (*statusDashboard, error) {
+	var status struct {
+		Servers []watchServer `json:"servers"`
+		Tunnels []watchTunnel `json:"tunnels"`
+	}
+	if err := webCall(ctx, addr, token, http.MethodGet, "/api/status", nil, &status); err != nil {
+		return nil, err
+	}
+	dashboard := &statusDashboard{Source: "gmssh web at " + addr, Servers: status.Servers, Tunnels: status.Tunnels, Sessions: -1}
+	var sessions []json.RawMessage
+	if webCall(ctx, addr, token, http.MethodGet, "/api/sessions", nil, &sessions) == nil {
+		dashboard.Sessions = len(sessions)
+	}
+	return dashboard, nil
+}
+
+// localDashboard 没有运行中的 gmssh web 时，经各服务器的网关链探测延迟，并检查 Portal 映射的本地端口是否在监听
+func (c *CLI) localDashboard(ctx context.Context) *statusDashboard {
+	dashboard := &statusDashboard{Source: "local probes, gmssh web not running", Sessions: -1}
+	dashboard.Servers = make([]watchServer, len(c.config.Hops))
+	sem := make(chan struct{}, watchProbeConcurrency)
+	var wg sync.WaitGroup
+	for i, hop := range c.config.Hops {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			probeCtx, cancel := context.WithTimeout(ctx, watchProbeTimeout)
+			defer cancel()
+			server := watchServer{Name: hop.Name, Status: "down", LastCheck: time.Now(), LegacyCrypto: hop.LegacyCrypto}
+			if report, err := c.profiler.Refresh(probeCtx, c.config.GatewayChain(hop)); err == nil && report.Success {
+				server.Status = "up"
+				server.LatencyMs = float64(report.Latency.Microseconds()) / 1000
+			}
+			dashboard.Servers[i] = server
+		}()
+	}
+	wg.Wait()
+
+	for _, m := range c.config.Portal.Client.Mappings {
+		dashboard.Tunnels = append(dashboard.Tunnels, watchTunnel{Name: m.Name, Kind: "portal",
+			Active: m.Enabled && listening(m.LocalAddr), Exposed: proxy.ExposesLAN(m.LocalAddr)})
+	}
+	return dashboard
+}
+
+// listening 本地地址上是否有进程在监听
+func listening(addr string) bool {
+	conn, err := net.DialTimeout("tcp", dialableAddr(addr), time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// renderStatusDashboard 输出服务器、转发和会话三部分
+func renderStatusDashboard(out io.Writer, d *statusDashboard) {
+	up, down := 0, 0
+	for _, s := range d.Servers {
+		switch s.Status {
+		case "up":
+			up++
+		case "down":
+			down++
+		}
+	}
+	fmt.Fprintf(out, "SERVERS   %d up, %d down, %d unknown\n", up, down, len(d.Servers)-up-down)
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, s := range d.Servers {
+		latency, checked := "-", "-"
+		if s.Status == "up" {
+			latency = fmt.Sprintf("%.1fms", s.LatencyMs)
+		}
+		if !s.LastCheck.IsZero() {
+			checked = s.LastCheck.Local().Format("15:04:05")
+		}
+		warning := ""
+		if s.LegacyCrypto {
+			warning = "WARNING: legacy crypto"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", s.Name, s.Status, latency, checked, warning)
+	}
+	tw.Flush()
+
+	active := 0
+	for _, t := range d.Tunnels {
+		if t.Active {
+			active++
+		}
+	}
+	fmt.Fprintf(out, "\nTUNNELS   %d/%d active\n", active, len(d.Tunnels))
+	tw = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, t := range d.Tunnels {
+		state := "inactive"
+		if t.Active {
+			state = "active"
+		}
+		if t.Exposed {
+			state += " (LAN)"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", t.Name, t.Kind, state)
+	}
+	tw.Flush()
+
+	sessions := "-"
+	if d.Sessions >= 0 {
+		sessions = fmt.Sprint(d.Sessions)
+	}
+	fmt.Fprintf(out, "\nSESSIONS  %s\n", sessions)
+}
+
+// ProbeWatchCommand 每隔 interval 重新对比直连和各 --via 路径到 target 的延迟。
+// 本机运行着 gmssh web 时由它探测（结果同样用于它的路由学习），否则在本地探测
+func (c *CLI) ProbeWatchCommand(target string, viaChains [][]string, count int, interval time.Duration) error {
+	candidates, err := c.probeCandidates(target, viaChains)
+	if err != nil {
+		return err
+	}
+	addr, token := c.webEndpoint("", "")
+	req := struct {
+		Target     string     `json:"target"`
+		Candidates [][]string `json:"candidates"`
+		Count      int        `json:"count,omitempty"`
+	}{Target: target, Candidates: viaChains, Count: count}
+	if len(req.Candidates) == 0 {
+		// 没有 --via 时 API 只探测单条路径，用空链占位以得到对比结果
+		req.Candidates = [][]string{{}}
+	}
+
+	return watchLoop(interval, func(ctx context.Context, out io.Writer) {
+		source := "gmssh web at " + addr
+		var resp struct {
+			Candidates []*profiler.CandidateResult `json:"candidates"`
+		}
+		if err := webCall(ctx, addr, token, http.MethodPost, "/api/metrics/latency", req, &resp); err != nil || len(resp.Candidates) == 0 {
+			source = "local probes, gmssh web not running"
+			resp.Candidates = c.profiler.ProbeCandidates(ctx, candidates, count)
+		}
+		fmt.Fprintf(out, "gmssh probe %s  %s  (%s)\n\n", target, time.Now().Format("2006-01-02 15:04:05"), source)
+		printProbeTable(out, resp.Candidates)
+		if best := resp.Candidates[0]; best.Reachable() {
+			fmt.Fprintf(out, "\nBest path: %s (%v)\n", best.Label, best.Latency.Round(time.Millisecond))
+		} else {
+			fmt.Fprintf(out, "\nAll paths to %s failed\n", target)
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderStatusDashboard(t *testing.T) {
+	var out bytes.Buffer
+	renderStatusDashboard(&out, &statusDashboard{
+		Servers: []watchServer{
+			{Name: "gateway", Status: "up", LatencyMs: 12.34, LastCheck: time.Now()},
+			{Name: "internal", Status: "down", LegacyCrypto: true},
+			{Name: "new", Status: "unknown"},
+		},
+		Tunnels: []watchTunnel{
+			{Name: "db", Kind: "proxy", Active: true},
+			{Name: "web", Kind: "portal", Exposed: true},
+		},
+		Sessions: 2,
+	})
+	text := out.String()
+	for _, want := range []string{"1 up, 1 down, 1 unknown", "12.3ms", "1/2 active", "inactive (LAN)", "SESSIONS  2", "WARNING: legacy crypto"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("dashboard missing %q:\n%s", want, text)
+		}
+	}
+
+	// 没有 gmssh web 时会话数未知
+	out.Reset()
+	renderStatusDashboard(&out, &statusDashboard{Sessions: -1})
+	if !strings.Contains(out.String(), "SESSIONS  -") {
+		t.Errorf("unknown sessions:\n%s", out.String())
+	}
+}
@@ -0,0 +1,456 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/internal/resolver"
+	"github.com/luobobo896/HSSH/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// 状态变更的动作
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// DesiredState gmssh apply 读取的声明式状态文件，条目按名称（转发按本地地址）与现有配置对应
+type DesiredState struct {
+	Servers  []DesiredServer  `yaml:"servers"`
+	Mappings []DesiredMapping `yaml:"mappings"`
+	// Proxies 运行中的端口转发，由 gmssh web 执行；文件中没有 proxies 键时（nil）不管理转发
+	Proxies []DesiredProxy `yaml:"proxies"`
+}
+
+// DesiredServer 期望的服务器。密码不写在状态文件里，已有服务器的密码保持不变
+type DesiredServer struct {
+	Name    string   `yaml:"name"`
+	Host    string   `yaml:"host"`
+	Port    int      `yaml:"port,omitempty"` // 默认 server_defaults.port，再默认 22
+	User    string   `yaml:"user,omitempty"` // 默认 server_defaults.user
+	Auth    string   `yaml:"auth,omitempty"` // key（默认）、password 或 agent
+	KeyPath string   `yaml:"key_path,omitempty"`
+	Gateway string   `yaml:"gateway,omitempty"` // 网关服务器名称，非空即为内网服务器
+	Tags    []string `yaml:"tags,omitempty"`
+	// Environment 环境标签（prod、staging、dev 等），决定危险操作是否需要确认
+	Environment string `yaml:"environment,omitempty"`
+	// ClientVersion 发送的 SSH 版本串，为空时使用默认值
+	ClientVersion string `yaml:"client_version,omitempty"`
+	// LegacyCrypto 允许协商已弃用的算法，用于只支持旧算法的网络设备
+	LegacyCrypto bool `yaml:"legacy_crypto,omitempty"`
+	// AllowAgentForwarding 该服务器上的终端转发本机 ssh-agent，还需 agent_forwarding 策略允许
+	AllowAgentForwarding bool `yaml:"allow_agent_forwarding,omitempty"`
+	// Notes 说明、负责人、联系方式、运维手册链接和位置
+	Notes *types.HopNotes `yaml:"notes,omitempty"`
+	// HostKeyPolicy 主机密钥校验策略：tofu（默认）、strict 或 off；HostKey 固定的主机密钥
+	HostKeyPolicy string `yaml:"host_key_policy,omitempty"`
+	HostKey       string `yaml:"host_key,omitempty"`
+}
+
+// DesiredMapping 期望的 Portal 端口映射
+type DesiredMapping struct {
+	Name         string   `yaml:"name"`
+	LocalAddr    string   `yaml:"local_addr"`
+	RemoteHost   string   `yaml:"remote_host"`
+	RemotePort   int      `yaml:"remote_port"`
+	Via          []string `yaml:"via,omitempty"`      // 服务器名称
+	Protocol     string   `yaml:"protocol,omitempty"` // 默认 tcp
+	Enabled      *bool    `yaml:"enabled,omitempty"`  // 默认 true
+	PortalServer string   `yaml:"portal_server,omitempty"`
+	Resolver     string   `yaml:"resolver,omitempty"`
+}
+
+// DesiredProxy 期望的端口转发，按 LocalAddr 与运行中的转发对应
+type DesiredProxy struct {
+	LocalAddr  string   `yaml:"local_addr"`
+	RemoteHost string   `yaml:"remote_host"`
+	RemotePort int      `yaml:"remote_port"`
+	Via        []string `yaml:"via,omitempty"` // 服务器名称
+}
+
+// StateChange 计划中的一项变更
+type StateChange struct {
+	Action string   `json:"action"` // create / update / delete
+	Kind   string   `json:"kind"`   // server / mapping / proxy
+	Name   string   `json:"name"`
+	Fields []string `json:"fields,omitempty"` // update 时变化的字段
+}
+
+// StatePlan 把配置变为状态文件所描述的样子需要的变更，由 Manager.ApplyPlan 执行
+type StatePlan struct {
+	Changes []StateChange
+
+	hops     []*types.Hop              // 执行后的服务器列表，更新的服务器是副本
+	updated  map[*types.Hop]*types.Hop // 副本 -> 配置中的原服务器，执行时原地更新
+	removed  []*types.Hop
+	mappings []types.PortMapping
+}
+
+// ParseState 解析状态文件并检查名称唯一和必填字段；未知的键视为错误，避免拼写错误被静默忽略
+func ParseState(data []byte) (*DesiredState, error) {
+	var state DesiredState
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for _, s := range state.Servers {
+		switch {
+		case s.Name == "":
+			return nil, fmt.Errorf("server without a name")
+		case names[s.Name]:
+			return nil, fmt.Errorf("server '%s' is declared twice", s.Name)
+		case s.Host == "":
+			return nil, fmt.Errorf("server '%s' has no host", s.Name)
+		case s.Port < 0 || s.Port > 65535:
+			return nil, fmt.Errorf("server '%s' has invalid port %d", s.Name, s.Port)
+		case s.Auth != "" && s.Auth != "key" && s.Auth != "password" && s.Auth != "agent":
+			return nil, fmt.Errorf("server '%s' has invalid auth %q (use key, password or agent)", s.Name, s.Auth)
+		case s.Gateway == s.Name:
+			return nil, fmt.Errorf("server '%s' cannot be its own gateway", s.Name)
+		}
+		names[s.Name] = true
+	}
+
+	names = make(map[string]bool)
+	for _, m := range state.Mappings {
+		switch {
+		case m.Name == "":
+			return nil, fmt.Errorf("mapping without a name")
+		case names[m.Name]:
+			return nil, fmt.Errorf("mapping '%s' is declared twice", m.Name)
+		case m.LocalAddr == "":
+			return nil, fmt.Errorf("mapping '%s' has no local_addr", m.Name)
+		case proxy.CheckTarget(m.RemoteHost, m.RemotePort) != nil:
+			return nil, fmt.Errorf("mapping '%s' needs remote_host and remote_port, or a unix socket path", m.Name)
+		}
+		switch types.PortalProtocol(m.Protocol) {
+		case "", types.PortalProtocolTCP, types.PortalProtocolHTTP, types.PortalProtocolWebSocket:
+		default:
+			return nil, fmt.Errorf("mapping '%s' has invalid protocol %q", m.Name, m.Protocol)
+		}
+		if _, err := resolver.ParseMode(m.Resolver); err != nil {
+			return nil, fmt.Errorf("mapping '%s': %w", m.Name, err)
+		}
+		names[m.Name] = true
+	}
+
+	addrs := make(map[string]bool)
+	for _, p := range state.Proxies {
+		switch {
+		case p.LocalAddr == "":
+			return nil, fmt.Errorf("proxy without a local_addr")
+		case addrs[p.LocalAddr]:
+			return nil, fmt.Errorf("proxy '%s' is declared twice", p.LocalAddr)
+		case proxy.CheckTarget(p.RemoteHost, p.RemotePort) != nil:
+			return nil, fmt.Errorf("proxy '%s' needs remote_host and remote_port, or a unix socket path", p.LocalAddr)
+		}
+		addrs[p.LocalAddr] = true
+	}
+	return &state, nil
+}
+
+// PlanState 计算把 cfg 中的服务器和映射变为 state 所描述的样子需要的变更，不修改 cfg。
+// 同名的本地条目被接管（Origin 改为 apply），团队同步的条目不能由 apply 管理；
+// prune 时删除文件中已不存在的 apply 条目，仍被其他条目引用的服务器不能删除
+func PlanState(cfg *types.Config, state *DesiredState, prune bool) (*StatePlan, error) {
+	plan := &StatePlan{updated: make(map[*types.Hop]*types.Hop)}
+	if err := plan.planServers(cfg, state.Servers, prune); err != nil {
+		return nil, err
+	}
+	if err := plan.planMappings(cfg, state.Mappings, prune); err != nil {
+		return nil, err
+	}
+
+	// 删除的服务器不能仍被保留下来的条目引用
+	after := *cfg
+	after.Hops = plan.hops
+	after.Portal.Client.Mappings = plan.mappings
+	for _, hop := range plan.removed {
+		if dependents := HopDependents(&after, hop); len(dependents) > 0 {
+			return nil, &DependentsError{Hop: hop.Name, Dependents: dependents}
+		}
+	}
+	return plan, nil
+}
+
+// Empty 计划中是否没有任何变更
+func (p *StatePlan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// planServers 按名称对应服务器；新服务器先分配 ID，网关引用文件中的新服务器时也能解析
+func (p *StatePlan) planServers(cfg *types.Config, servers []DesiredServer, prune bool) error {
+	ids := make(map[string]string, len(cfg.Hops)+len(servers))
+	for _, hop := range cfg.Hops {
+		if _, ok := ids[hop.Name]; !ok {
+			ids[hop.Name] = hop.ID
+		}
+	}
+	byName := make(map[string]DesiredServer, len(servers))
+	created := make(map[string]*types.Hop)
+	for _, s := range servers {
+		byName[s.Name] = s
+		existing := cfg.GetHopByName(s.Name)
+		if existing == nil {
+			hop := &types.Hop{ID: uuid.New().String(), Name: s.Name}
+			ids[s.Name] = hop.ID
+			created[s.Name] = hop
+			continue
+		}
+		if existing.Origin == types.OriginTeam {
+			return fmt.Errorf("server '%s' is managed by team sync and cannot be applied", s.Name)
+		}
+	}
+
+	for _, hop := range cfg.Hops {
+		s, ok := byName[hop.Name]
+		if !ok || cfg.GetHopByName(hop.Name) != hop {
+			if prune && hop.Origin == types.OriginApply && !ok {
+				p.removed = append(p.removed, hop)
+				p.Changes = append(p.Changes, StateChange{Action: ActionDelete, Kind: "server", Name: hop.Name})
+				continue
+			}
+			p.hops = append(p.hops, hop)
+			continue
+		}
+		updated := *hop
+		if err := s.applyTo(&updated, cfg.ServerDefaults, ids); err != nil {
+			return err
+		}
+		fields := hopChanges(hop, &updated)
+		if len(fields) == 0 {
+			p.hops = append(p.hops, hop)
+			continue
+		}
+		p.hops = append(p.hops, &updated)
+		p.updated[&updated] = hop
+		p.Changes = append(p.Changes, StateChange{Action: ActionUpdate, Kind: "server", Name: hop.Name, Fields: fields})
+	}
+	for _, s := range servers {
+		hop, ok := created[s.Name]
+		if !ok {
+			continue
+		}
+		if err := s.applyTo(hop, cfg.ServerDefaults, ids); err != nil {
+			return err
+		}
+		p.hops = append(p.hops, hop)
+		p.Changes = append(p.Changes, StateChange{Action: ActionCreate, Kind: "server", Name: hop.Name})
+	}
+	return nil
+}
+
+// applyTo 把期望的字段写入 hop 并标记为 apply 管理；未在状态文件中描述的字段（密码、终端设置等）保持不变
+func (s DesiredServer) applyTo(hop *types.Hop, defaults types.HopDefaults, ids map[string]string) error {
+	hop.Host = s.Host
+	hop.Port = s.Port
+	hop.User = s.User
+	hop.KeyPath = s.KeyPath
+	hop.AuthType = types.AuthKey
+	if s.Auth != "" {
+		auth, err := types.ParseAuthMethod(s.Auth)
+		if err != nil {
+			return fmt.Errorf("server '%s': %w", s.Name, err)
+		}
+		hop.AuthType = auth
+	}
+	defaults.Apply(hop)
+	if hop.Port == 0 {
+		hop.Port = 22
+	}
+	if hop.User == "" {
+		return fmt.Errorf("server '%s' has no user and server_defaults.user is not set", s.Name)
+	}
+	hop.Tags = slices.Clone(s.Tags)
+	hop.Environment = s.Environment
+	version, err := types.NormalizeClientVersion(s.ClientVersion)
+	if err != nil {
+		return fmt.Errorf("server '%s': %w", s.Name, err)
+	}
+	hop.ClientVersion = version
+	hop.LegacyCrypto = s.LegacyCrypto
+	hop.AllowAgentForwarding = s.AllowAgentForwarding
+	if err := s.Notes.Validate(); err != nil {
+		return fmt.Errorf("server '%s': notes: %w", s.Name, err)
+	}
+	hop.Notes = nil
+	if !s.Notes.Empty() {
+		hop.Notes = s.Notes
+	}
+	if err := types.ValidateHostKeySettings(s.HostKeyPolicy, s.HostKey); err != nil {
+		return fmt.Errorf("server '%s': %w", s.Name, err)
+	}
+	hop.HostKeyPolicy = s.HostKeyPolicy
+	hop.HostKey = s.HostKey
+	hop.Origin = types.OriginApply
+	hop.Gateway = ""
+	hop.ServerType = types.ServerExternal
+	hop.GatewayID = ""
+	if s.Gateway != "" {
+		id, ok := ids[s.Gateway]
+		if !ok {
+			return fmt.Errorf("server '%s': gateway '%s' not found", s.Name, s.Gateway)
+		}
+		hop.ServerType = types.ServerInternal
+		hop.GatewayID = id
+	}
+	return nil
+}
+
+// hopChanges 列出 apply 管理的字段中发生变化的字段名
+func hopChanges(old, new *types.Hop) []string {
+	var fields []string
+	add := func(name string, changed bool) {
+		if changed {
+			fields = append(fields, name)
+		}
+	}
+	add("host", old.Host != new.Host)
+	add("port", old.Port != new.Port)
+	add("user", old.User != new.User)
+	add("auth", old.AuthType != new.AuthType)
+	add("key_path", old.KeyPath != new.KeyPath)
+	add("gateway", old.ServerType != new.ServerType || old.GatewayID != new.GatewayID || old.Gateway != new.Gateway)
+	add("tags", !slices.Equal(old.Tags, new.Tags))
+	add("environment", old.Environment != new.Environment)
+	add("client_version", old.ClientVersion != new.ClientVersion)
+	add("legacy_crypto", old.LegacyCrypto != new.LegacyCrypto)
+	add("allow_agent_forwarding", old.AllowAgentForwarding != new.AllowAgentForwarding)
+	add("notes", !old.Notes.Equal(new.Notes))
+	add("host_key_policy", old.HostKeyPolicy != new.HostKeyPolicy)
+	add("host_key", old.HostKey != new.HostKey)
+	add("origin", old.Origin != new.Origin)
+	return fields
+}
+
+// planMappings 按名称对应端口映射，via 中的服务器名称按执行后的服务器列表解析为 ID
+func (p *StatePlan) planMappings(cfg *types.Config, mappings []DesiredMapping, prune bool) error {
+	ids := make(map[string]string, len(p.hops))
+	for _, hop := range p.hops {
+		if _, ok := ids[hop.Name]; !ok {
+			ids[hop.Name] = hop.ID
+		}
+	}
+	byName := make(map[string]DesiredMapping, len(mappings))
+	for _, m := range mappings {
+		byName[m.Name] = m
+	}
+
+	seen := make(map[string]bool)
+	for _, mapping := range cfg.Portal.Client.Mappings {
+		m, ok := byName[mapping.Name]
+		if !ok || seen[mapping.Name] {
+			if prune && mapping.Origin == types.OriginApply && !ok {
+				p.Changes = append(p.Changes, StateChange{Action: ActionDelete, Kind: "mapping", Name: mapping.Name})
+				continue
+			}
+			p.mappings = append(p.mappings, mapping)
+			continue
+		}
+		seen[mapping.Name] = true
+		if mapping.Origin == types.OriginTeam {
+			return fmt.Errorf("mapping '%s' is managed by team sync and cannot be applied", m.Name)
+		}
+		updated := mapping
+		if err := m.applyTo(&updated, ids); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(mapping, updated) {
+			p.Changes = append(p.Changes, StateChange{Action: ActionUpdate, Kind: "mapping", Name: m.Name, Fields: mappingChanges(&mapping, &updated)})
+		}
+		p.mappings = append(p.mappings, updated)
+	}
+	for _, m := range mappings {
+		if seen[m.Name] {
+			continue
+		}
+		mapping := types.PortMapping{ID: uuid.New().String(), Name: m.Name}
+		if err := m.applyTo(&mapping, ids); err != nil {
+			return err
+		}
+		p.mappings = append(p.mappings, mapping)
+		p.Changes = append(p.Changes, StateChange{Action: ActionCreate, Kind: "mapping", Name: m.Name})
+	}
+	return nil
+}
+
+// applyTo 把期望的字段写入映射并标记为 apply 管理
+func (m DesiredMapping) applyTo(mapping *types.PortMapping, ids map[string]string) error {
+	via := make([]string, 0, len(m.Via))
+	for _, name := range m.Via {
+		id, ok := ids[name]
+		if !ok {
+			return fmt.Errorf("mapping '%s': server '%s' not found", m.Name, name)
+		}
+		via = append(via, id)
+	}
+	mapping.LocalAddr = m.LocalAddr
+	mapping.RemoteHost = m.RemoteHost
+	mapping.RemotePort = m.RemotePort
+	mapping.Via = via
+	mapping.Protocol = types.PortalProtocolTCP
+	if m.Protocol != "" {
+		mapping.Protocol = types.PortalProtocol(m.Protocol)
+	}
+	mapping.Enabled = m.Enabled == nil || *m.Enabled
+	mapping.PortalServer = m.PortalServer
+	mapping.Resolver = m.Resolver
+	mapping.Origin = types.OriginApply
+	return nil
+}
+
+// mappingChanges 列出端口映射中发生变化的字段名
+func mappingChanges(old, new *types.PortMapping) []string {
+	var fields []string
+	add := func(name string, changed bool) {
+		if changed {
+			fields = append(fields, name)
+		}
+	}
+	add("local_addr", old.LocalAddr != new.LocalAddr)
+	add("remote", old.RemoteHost != new.RemoteHost || old.RemotePort != new.RemotePort)
+	add("via", !slices.Equal(old.Via, new.Via))
+	add("protocol", old.Protocol != new.Protocol)
+	add("enabled", old.Enabled != new.Enabled)
+	add("portal_server", old.PortalServer != new.PortalServer)
+	add("resolver", old.Resolver != new.Resolver)
+	add("origin", old.Origin != new.Origin)
+	return fields
+}
+
+// ApplyPlan 执行 PlanState 计算的计划并保存：更新的服务器原地修改，保持其他模块持有的指针有效；
+// 删除的服务器移入回收站，可以用 gmssh server restore 恢复
+func (m *Manager) ApplyPlan(plan *StatePlan) error {
+	if plan.Empty() {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cfg := m.Get()
+	for i, hop := range plan.hops {
+		if original, ok := plan.updated[hop]; ok {
+			*original = *hop
+			plan.hops[i] = original
+		}
+	}
+	cfg.Hops = plan.hops
+	cfg.Portal.Client.Mappings = plan.mappings
+	now := time.Now()
+	for _, hop := range plan.removed {
+		cfg.Trash = append(cfg.Trash, &types.TrashedHop{Hop: hop, DeletedAt: now})
+	}
+	m.purgeExpiredTrash(now)
+	m.normalizeRefs()
+	return m.storage.Save(m.config)
+}
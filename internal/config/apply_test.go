@@ -0,0 +1,178 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const testState = `
+servers:
+  - name: bastion
+    host: 1.2.3.4
+    user: root
+    auth: password
+  - name: app
+    host: 10.0.0.5
+    gateway: bastion
+    tags: [prod]
+mappings:
+  - name: db
+    local_addr: ":3306"
+    remote_host: 10.0.0.3
+    remote_port: 3306
+    via: [bastion]
+  - name: api
+    local_addr: ":9000"
+    remote_host: 10.0.0.5
+    remote_port: 9000
+    via: [app]
+    enabled: false
+`
+
+func TestParseState(t *testing.T) {
+	state, err := ParseState([]byte(testState))
+	if err != nil {
+		t.Fatalf("ParseState: %v", err)
+	}
+	if len(state.Servers) != 2 || len(state.Mappings) != 2 || state.Proxies != nil {
+		t.Errorf("state = %+v", state)
+	}
+	if state, err := ParseState([]byte("proxies: []")); err != nil || state.Proxies == nil {
+		t.Errorf("an empty proxies list must be kept: %+v, %v", state, err)
+	}
+
+	for _, bad := range []string{
+		"jobs: []",
+		"servers: [{name: a, host: h}, {name: a, host: h}]",
+		"servers: [{name: a}]",
+		"servers: [{name: a, host: h, auth: token}]",
+		"servers: [{name: a, host: h, gateway: a}]",
+		"mappings: [{name: m, local_addr: ':1', remote_host: h}]",
+		"mappings: [{name: m, local_addr: ':1', remote_host: h, remote_port: 1, protocol: udp}]",
+		"mappings: [{name: m, local_addr: ':1', remote_host: h, remote_port: 1, resolver: bogus}]",
+		"proxies: [{local_addr: ':1', remote_host: h, remote_port: 1}, {local_addr: ':1', remote_host: h, remote_port: 2}]",
+	} {
+		if _, err := ParseState([]byte(bad)); err == nil {
+			t.Errorf("ParseState(%q) accepted an invalid state", bad)
+		}
+	}
+}
+
+func TestPlanAndApplyState(t *testing.T) {
+	mgr := newTrashTestManager(t)
+	cfg := mgr.Get()
+	cfg.ServerDefaults = types.HopDefaults{User: "deploy"}
+	bastion := cfg.Hops[0]
+
+	state, err := ParseState([]byte(testState))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := PlanState(cfg, state, false)
+	if err != nil {
+		t.Fatalf("PlanState: %v", err)
+	}
+	want := []StateChange{
+		{Action: ActionUpdate, Kind: "server", Name: "bastion", Fields: []string{"origin"}},
+		{Action: ActionCreate, Kind: "server", Name: "app"},
+		{Action: ActionUpdate, Kind: "mapping", Name: "db", Fields: []string{"origin"}},
+		{Action: ActionCreate, Kind: "mapping", Name: "api"},
+	}
+	if !reflect.DeepEqual(plan.Changes, want) {
+		t.Fatalf("changes = %+v, want %+v", plan.Changes, want)
+	}
+	if bastion.Origin != "" || len(cfg.Hops) != 2 {
+		t.Fatal("PlanState modified the config")
+	}
+
+	if err := mgr.ApplyPlan(plan); err != nil {
+		t.Fatalf("ApplyPlan: %v", err)
+	}
+	if cfg.Hops[0] != bastion || bastion.Origin != types.OriginApply || bastion.Password != "secret" {
+		t.Errorf("bastion must be adopted in place and keep its password: %+v", bastion)
+	}
+	app := cfg.GetHopByName("app")
+	if app == nil || app.User != "deploy" || app.Port != 22 || app.GatewayID != bastion.ID || app.ServerType != types.ServerInternal {
+		t.Fatalf("app = %+v", app)
+	}
+	api := cfg.Portal.Client.Mappings[2]
+	if api.Name != "api" || api.Enabled || !reflect.DeepEqual(api.Via, []string{app.ID}) || api.Protocol != types.PortalProtocolTCP {
+		t.Errorf("api mapping = %+v", api)
+	}
+
+	// 再次执行没有变化
+	if plan, err := PlanState(cfg, state, false); err != nil || !plan.Empty() {
+		t.Fatalf("second plan = %+v, %v", plan, err)
+	}
+
+	// 从文件中去掉 app 和 api：不带 prune 时保留，带 prune 时删除，服务器进入回收站
+	state.Servers = state.Servers[:1]
+	state.Mappings = state.Mappings[:1]
+	if plan, err := PlanState(cfg, state, false); err != nil || !plan.Empty() {
+		t.Fatalf("plan without prune = %+v, %v", plan, err)
+	}
+	plan, err = PlanState(cfg, state, true)
+	if err != nil {
+		t.Fatalf("PlanState with prune: %v", err)
+	}
+	want = []StateChange{
+		{Action: ActionDelete, Kind: "server", Name: "app"},
+		{Action: ActionDelete, Kind: "mapping", Name: "api"},
+	}
+	if !reflect.DeepEqual(plan.Changes, want) {
+		t.Fatalf("prune changes = %+v", plan.Changes)
+	}
+	if err := mgr.ApplyPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.GetHopByName("app") != nil || len(cfg.Portal.Client.Mappings) != 2 {
+		t.Errorf("pruned entries remain: %v", hopNames(cfg.Hops))
+	}
+	if len(mgr.Trash()) != 1 || mgr.Trash()[0].Hop.Name != "app" {
+		t.Errorf("pruned server not in trash: %+v", mgr.Trash())
+	}
+	// 未由 apply 管理的 internal 不会被删除
+	if cfg.GetHopByName("internal") == nil {
+		t.Error("prune removed a server not managed by apply")
+	}
+}
+
+func TestPlanStateRejects(t *testing.T) {
+	cfg := testConfig()
+	cfg.Hops = append(cfg.Hops, &types.Hop{ID: "team-1", Name: "shared", Host: "5.5.5.5", User: "ops", Origin: types.OriginTeam})
+	cfg.Hops[0].Origin = types.OriginApply
+
+	tests := []struct {
+		name, state string
+		prune       bool
+		want        string
+	}{
+		{"team server", "servers: [{name: shared, host: 5.5.5.6}]", false, "team sync"},
+		{"unknown gateway", "servers: [{name: x, host: h, user: u, gateway: nope}]", false, "gateway 'nope' not found"},
+		{"no user", "servers: [{name: x, host: h}]", false, "no user"},
+		{"unknown via", "mappings: [{name: m, local_addr: ':1', remote_host: h, remote_port: 1, via: [nope]}]", false, "server 'nope' not found"},
+		{"prune referenced", "servers: []", true, "still referenced"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := ParseState([]byte(tt.state))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = PlanState(cfg, state, tt.prune)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	state, _ := ParseState([]byte("servers: []"))
+	var dependents *DependentsError
+	if _, err := PlanState(cfg, state, true); !errors.As(err, &dependents) || dependents.Hop != "bastion" {
+		t.Errorf("prune of a referenced server: %v", err)
+	}
+}
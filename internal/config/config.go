@@ -1,14 +1,17 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/luobobo896/HSSH/pkg/types"
 	"github.com/google/uuid"
-	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -16,10 +19,19 @@ const (
 	ConfigFileName = "config.yaml"
 )
 
+// 配置条目查找和添加的错误，调用方用 errors.Is 判断
+var (
+	ErrNotFound = errors.New("not found")
+	ErrExists   = errors.New("already exists")
+	// ErrFrozen 配置目录已从备份恢复，本进程在重启前不再保存配置，见 Freeze
+	ErrFrozen = errors.New("configuration was restored from a backup, restart gmssh before changing it")
+)
+
 // Manager 配置管理器
 type Manager struct {
-	config     *types.Config
-	configPath string
+	config  *types.Config
+	storage Storage
+	mu      sync.Mutex // 串行化后台同步与保存
 }
 
 // NewManager 创建配置管理器
@@ -29,21 +41,62 @@ func NewManager() (*Manager, error) {
 		return nil, err
 	}
 
+	storage, err := openStorage(configDir)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Manager{
-		configPath: filepath.Join(configDir, ConfigFileName),
+		storage: storage,
 	}, nil
 }
 
-// GetConfigDir 获取配置目录
+// Storage 返回当前使用的配置存储
+func (m *Manager) Storage() Storage {
+	return m.storage
+}
+
+// StoragePath 返回当前使用的配置存储路径
+func (m *Manager) StoragePath() string {
+	return m.storage.Path()
+}
+
+// Freeze 停止保存配置，之后的保存都返回 ErrFrozen。
+// 运行中的 web 服务恢复备份后调用，避免内存中的旧配置覆盖刚恢复的文件
+func (m *Manager) Freeze() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.storage = frozenStorage{m.storage}
+}
+
+// frozenStorage 拒绝保存的存储，见 Freeze
+type frozenStorage struct {
+	Storage
+}
+
+func (frozenStorage) Save(*types.Config) error {
+	return ErrFrozen
+}
+
+// Close 释放配置存储
+func (m *Manager) Close() error {
+	return m.storage.Close()
+}
+
+// GetConfigDir 获取配置目录：--config-dir 或 GMSSH_CONFIG_DIR（见 SetOverrides），默认 ~/.gmssh
 func GetConfigDir() (string, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
+	configDir := overrides.ConfigDir
+	if configDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			// 容器中常没有 HOME，提示改用挂载的目录
+			return "", fmt.Errorf("failed to get home directory (set %s or --config-dir): %w", EnvConfigDir, err)
+		}
+		configDir = filepath.Join(homeDir, ConfigDirName)
 	}
 
-	configDir := filepath.Join(homeDir, ConfigDirName)
 	if err := os.MkdirAll(configDir, 0700); err != nil {
-		return "", fmt.Errorf("failed to create config directory: %w", err)
+		return "", fmt.Errorf("failed to create config directory %s (set %s or --config-dir to a writable path): %w", configDir, EnvConfigDir, err)
 	}
 
 	return configDir, nil
@@ -51,57 +104,67 @@ func GetConfigDir() (string, error) {
 
 // Load 加载配置
 func (m *Manager) Load() (*types.Config, error) {
-	data, err := os.ReadFile(m.configPath)
+	config, err := m.storage.Load()
 	if err != nil {
-		if os.IsNotExist(err) {
-			// 配置文件不存在，创建默认配置
-			m.config = m.defaultConfig()
-			if err := m.Save(); err != nil {
-				return nil, err
-			}
-			return m.config, nil
-		}
-		return nil, fmt.Errorf("failed to read config: %w", err)
+		return nil, err
 	}
-
-	var config types.Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+	if config == nil {
+		// 配置不存在，创建默认配置
+		m.config = m.defaultConfig()
+		if err := m.Save(); err != nil {
+			return nil, err
+		}
+		return m.config, nil
 	}
 
 	configDir, _ := GetConfigDir()
 	config.ConfigDir = configDir
 
 	// 执行配置迁移
-	if NeedsMigration(&config) {
+	if NeedsMigration(config) {
 		log.Printf("[Config] Configuration migration needed, current version: %d", config.Version)
-		if err := MigrateConfig(&config); err != nil {
+		if err := MigrateConfig(config); err != nil {
 			return nil, fmt.Errorf("failed to migrate config: %w", err)
 		}
 		// 迁移后保存
-		m.config = &config
+		m.config = config
 		if err := m.Save(); err != nil {
 			log.Printf("[Config] Warning: failed to save migrated config: %v", err)
 		}
 		log.Printf("[Config] Configuration migrated and saved, new version: %d", config.Version)
 	}
 
-	m.config = &config
-	return &config, nil
+	m.config = config
+	// 旧名称引用转换为 ID 后，清理过期的回收站条目
+	normalized := m.normalizeRefs()
+	if m.purgeExpiredTrash(time.Now()) || normalized {
+		if err := m.Save(); err != nil {
+			log.Printf("[Config] Warning: failed to save after purging trash: %v", err)
+		}
+	}
+	return config, nil
 }
 
 // Save 保存配置
 func (m *Manager) Save() error {
-	data, err := yaml.Marshal(m.config)
-	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
-	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.storage.Save(m.config)
+}
 
-	if err := os.WriteFile(m.configPath, data, 0600); err != nil {
-		return fmt.Errorf("failed to write config: %w", err)
-	}
+// ApplyShared 合并团队共享拓扑，有变化时保存
+func (m *Manager) ApplyShared(shared *types.Config) (*SyncReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	return nil
+	report := MergeShared(m.Get(), shared)
+	normalized := m.normalizeRefs()
+	if report.Changed() || normalized {
+		if err := m.storage.Save(m.config); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
 }
 
 // Get 获取当前配置
@@ -121,7 +184,7 @@ func (m *Manager) AddHop(hop *types.Hop) error {
 
 	// 检查 ID 是否已存在（理论上不会发生）
 	if existing := m.config.GetHopByID(hop.ID); existing != nil {
-		return fmt.Errorf("hop with id '%s' already exists", hop.ID)
+		return fmt.Errorf("hop with id '%s' %w", hop.ID, ErrExists)
 	}
 
 	// 检查名称是否已存在（只做提示性警告，允许重复名称）
@@ -130,20 +193,24 @@ func (m *Manager) AddHop(hop *types.Hop) error {
 	}
 
 	m.config.Hops = append(m.config.Hops, hop)
+	m.normalizeRefs()
 	return m.Save()
 }
 
 // UpdateHop 更新服务器节点（通过 ID）
+// 改名前先把按旧名称的引用转换为 ID，改名后这些引用仍然有效
 func (m *Manager) UpdateHop(id string, hop *types.Hop) error {
 	for i, h := range m.config.Hops {
 		if h.ID == id {
+			m.normalizeRefs()
 			// 保留原 ID
 			hop.ID = id
 			m.config.Hops[i] = hop
+			m.normalizeRefs()
 			return m.Save()
 		}
 	}
-	return fmt.Errorf("hop with id '%s' not found", id)
+	return fmt.Errorf("hop with id '%s' %w", id, ErrNotFound)
 }
 
 // UpdateHopByName 更新服务器节点（通过名称，兼容旧代码）
@@ -154,57 +221,77 @@ func (m *Manager) UpdateHopByName(name string, hop *types.Hop) error {
 			if hop.ID == "" {
 				hop.ID = h.ID
 			}
+			m.normalizeRefs()
 			m.config.Hops[i] = hop
+			m.normalizeRefs()
 			return m.Save()
 		}
 	}
-	return fmt.Errorf("hop with name '%s' not found", name)
+	return fmt.Errorf("hop with name '%s' %w", name, ErrNotFound)
 }
 
 // DeleteHop 删除服务器节点（通过 ID）
+// 服务器被移入回收站，可在保留期内通过 RestoreHop 恢复；仍被引用时返回 *DependentsError
 func (m *Manager) DeleteHop(id string) error {
-	// 检查是否有其他服务器引用此服务器作为网关
-	for _, h := range m.config.Hops {
-		if h.GatewayID == id {
-			return fmt.Errorf("cannot delete: server is used as gateway by '%s' (id: %s)", h.Name, h.ID)
-		}
-	}
-
 	for i, h := range m.config.Hops {
 		if h.ID == id {
-			m.config.Hops = append(m.config.Hops[:i], m.config.Hops[i+1:]...)
-			return m.Save()
+			return m.trashHop(i)
 		}
 	}
-	return fmt.Errorf("hop with id '%s' not found", id)
+	return fmt.Errorf("hop with id '%s' %w", id, ErrNotFound)
 }
 
 // DeleteHopByName 删除服务器节点（通过名称，兼容旧代码）
 func (m *Manager) DeleteHopByName(name string) error {
 	for i, h := range m.config.Hops {
 		if h.Name == name {
-			m.config.Hops = append(m.config.Hops[:i], m.config.Hops[i+1:]...)
-			return m.Save()
+			return m.trashHop(i)
 		}
 	}
-	return fmt.Errorf("hop with name '%s' not found", name)
+	return fmt.Errorf("hop with name '%s' %w", name, ErrNotFound)
+}
+
+// RecordHealthChecks 把健康检查结果写入对应服务器的 LastCheck 并保存，checks 以服务器 ID 为键，
+// 检查期间已删除的服务器忽略
+func (m *Manager) RecordHealthChecks(checks map[string]types.HealthCheck) error {
+	for _, hop := range m.config.Hops {
+		if check, ok := checks[hop.ID]; ok {
+			hop.LastCheck = &check
+		}
+	}
+	return m.Save()
+}
+
+// SetKeyAuth 把 ids 中的服务器一次性改为使用 keyPath 的密钥认证（删除保存的密码和私钥口令）并保存，
+// 不存在的服务器忽略
+func (m *Manager) SetKeyAuth(ids []string, keyPath string) error {
+	for _, id := range ids {
+		if hop := m.config.GetHopByID(id); hop != nil {
+			hop.AuthType = types.AuthKey
+			hop.KeyPath = keyPath
+			hop.Password = ""
+			hop.KeyPassphrase = ""
+		}
+	}
+	return m.Save()
 }
 
 // AddRoute 添加路由偏好
 func (m *Manager) AddRoute(route *types.RoutePreference) error {
 	m.config.Routes = append(m.config.Routes, route)
+	m.normalizeRefs()
 	return m.Save()
 }
 
-// DeleteRoute 删除路由偏好
-func (m *Manager) DeleteRoute(from, to string) error {
+// DeleteRoute 删除起点和终点 ID 对应的路由偏好
+func (m *Manager) DeleteRoute(fromID, toID string) error {
 	for i, r := range m.config.Routes {
-		if r.From == from && r.To == to {
+		if r.FromID == fromID && r.ToID == toID {
 			m.config.Routes = append(m.config.Routes[:i], m.config.Routes[i+1:]...)
 			return m.Save()
 		}
 	}
-	return fmt.Errorf("route from '%s' to '%s' not found", from, to)
+	return fmt.Errorf("route from '%s' to '%s' %w", fromID, toID, ErrNotFound)
 }
 
 // AddProfile 添加预设配置
@@ -215,10 +302,11 @@ func (m *Manager) AddProfile(profile *types.Profile) error {
 	}
 
 	if existing := m.config.GetProfileByID(profile.ID); existing != nil {
-		return fmt.Errorf("profile with id '%s' already exists", profile.ID)
+		return fmt.Errorf("profile with id '%s' %w", profile.ID, ErrExists)
 	}
 
 	m.config.Profiles = append(m.config.Profiles, profile)
+	m.normalizeRefs()
 	return m.Save()
 }
 
@@ -230,14 +318,14 @@ func (m *Manager) DeleteProfile(name string) error {
 			return m.Save()
 		}
 	}
-	return fmt.Errorf("profile with name '%s' not found", name)
+	return fmt.Errorf("profile with name '%s' %w", name, ErrNotFound)
 }
 
 // defaultConfig 默认配置
 func (m *Manager) defaultConfig() *types.Config {
 	configDir, _ := GetConfigDir()
 	return &types.Config{
-		Version:   types.ConfigVersion2, // 新配置默认为最新版本
+		Version:   types.ConfigVersion3, // 新配置默认为最新版本
 		Hops:      []*types.Hop{},
 		Routes:    []*types.RoutePreference{},
 		Profiles:  []*types.Profile{},
@@ -278,5 +366,18 @@ func (m *Manager) Validate() error {
 		}
 	}
 
+	// 验证上传备份规则
+	for _, rule := range m.config.Upload.Backups {
+		if !path.IsAbs(rule.Dir) || rule.Keep <= 0 {
+			return fmt.Errorf("upload backup rule for '%s' needs an absolute dir and keep > 0", rule.Dir)
+		}
+	}
+	if err := m.config.Upload.Policy.Validate(); err != nil {
+		return err
+	}
+	if err := m.config.Upload.Sudo.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
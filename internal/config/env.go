@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// 覆盖配置的环境变量，便于容器部署
+const (
+	EnvConfigDir = "GMSSH_CONFIG_DIR" // 配置目录（config.yaml、config.db、secrets.enc），默认 ~/.gmssh
+	EnvWebBind   = "GMSSH_WEB_BIND"   // gmssh web 的监听地址（web.bind）
+	EnvAuthToken = "GMSSH_AUTH_TOKEN" // gmssh web 的管理员令牌；portal 服务端的认证令牌
+	EnvLogLevel  = "GMSSH_LOG_LEVEL"  // 日志级别（log_level）：info、warn、error、off
+	EnvTempDir   = "GMSSH_TEMP_DIR"   // 上传暂存目录（upload.temp_dir）
+	EnvNetem     = "GMSSH_NETEM"      // 调试用的网络条件注入（debug_netem），如 delay=100ms,jitter=20ms,loss=1%
+)
+
+// Overrides 命令行全局参数或环境变量对配置的覆盖，只在本进程生效，不会写回配置文件
+type Overrides struct {
+	ConfigDir string
+	WebBind   string
+	AuthToken string
+	LogLevel  string
+	TempDir   string
+	Netem     string
+}
+
+// overrides 由 SetOverrides 设置，进程内全局生效
+var overrides Overrides
+
+// EnvOverrides 读取 GMSSH_* 环境变量
+func EnvOverrides() Overrides {
+	return Overrides{
+		ConfigDir: os.Getenv(EnvConfigDir),
+		WebBind:   os.Getenv(EnvWebBind),
+		AuthToken: os.Getenv(EnvAuthToken),
+		LogLevel:  os.Getenv(EnvLogLevel),
+		TempDir:   os.Getenv(EnvTempDir),
+		Netem:     os.Getenv(EnvNetem),
+	}
+}
+
+// Or 返回 o 的副本，其中未设置的字段取 fallback 的值
+func (o Overrides) Or(fallback Overrides) Overrides {
+	pick := func(value, fallback string) string {
+		if value != "" {
+			return value
+		}
+		return fallback
+	}
+	return Overrides{
+		ConfigDir: pick(o.ConfigDir, fallback.ConfigDir),
+		WebBind:   pick(o.WebBind, fallback.WebBind),
+		AuthToken: pick(o.AuthToken, fallback.AuthToken),
+		LogLevel:  pick(o.LogLevel, fallback.LogLevel),
+		TempDir:   pick(o.TempDir, fallback.TempDir),
+		Netem:     pick(o.Netem, fallback.Netem),
+	}
+}
+
+// SetOverrides 设置本进程的覆盖，须在创建 Manager 之前调用。
+// 优先级：命令行参数 > 环境变量（调用方用 flags.Or(EnvOverrides()) 合并）> config.yaml > 默认值
+func SetOverrides(o Overrides) {
+	overrides = o
+}
+
+// Effective 返回覆盖后生效的设置：overrides 中已设置的字段优先，否则取 cfg 中的值，都未设置时为空
+func Effective(cfg *types.Config) Overrides {
+	var fromConfig Overrides
+	if cfg != nil {
+		fromConfig = Overrides{
+			ConfigDir: cfg.ConfigDir,
+			WebBind:   cfg.Web.Bind,
+			LogLevel:  cfg.LogLevel,
+			TempDir:   cfg.Upload.TempDir,
+			Netem:     cfg.DebugNetem,
+		}
+	}
+	return overrides.Or(fromConfig)
+}
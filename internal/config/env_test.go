@@ -0,0 +1,65 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestEffective(t *testing.T) {
+	cfg := &types.Config{LogLevel: "warn", Web: types.WebConfig{Bind: "0.0.0.0:9000"}, Upload: types.UploadConfig{TempDir: "/data/tmp"}}
+
+	tests := []struct {
+		name  string
+		flags Overrides
+		env   map[string]string
+		want  Overrides
+	}{
+		{"config only", Overrides{}, nil, Overrides{WebBind: "0.0.0.0:9000", LogLevel: "warn", TempDir: "/data/tmp"}},
+		{
+			"env over config",
+			Overrides{},
+			map[string]string{EnvWebBind: ":8443", EnvLogLevel: "error", EnvAuthToken: "s3cret"},
+			Overrides{WebBind: ":8443", LogLevel: "error", AuthToken: "s3cret", TempDir: "/data/tmp"},
+		},
+		{
+			"flags over env",
+			Overrides{LogLevel: "off", TempDir: "/scratch"},
+			map[string]string{EnvLogLevel: "error", EnvTempDir: "/env/tmp"},
+			Overrides{WebBind: "0.0.0.0:9000", LogLevel: "off", TempDir: "/scratch"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{EnvConfigDir, EnvWebBind, EnvAuthToken, EnvLogLevel, EnvTempDir} {
+				t.Setenv(key, tt.env[key])
+			}
+			SetOverrides(tt.flags.Or(EnvOverrides()))
+			t.Cleanup(func() { SetOverrides(Overrides{}) })
+
+			if got := Effective(cfg); got != tt.want {
+				t.Errorf("Effective = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigDirOverride(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := filepath.Join(t.TempDir(), "mounted")
+	SetOverrides(Overrides{ConfigDir: dir})
+	t.Cleanup(func() { SetOverrides(Overrides{}) })
+
+	mgr, err := NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := mgr.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ConfigDir != dir || mgr.StoragePath() != filepath.Join(dir, ConfigFileName) {
+		t.Errorf("config dir = %q, storage = %q", cfg.ConfigDir, mgr.StoragePath())
+	}
+}
@@ -0,0 +1,303 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// 冲突类型
+const (
+	ConflictIDTaken         = "id_taken"         // 共享条目的 ID 已被本地条目占用，保留本地
+	ConflictNameTaken       = "name_taken"       // 共享服务器与本地服务器同名，两者都保留
+	ConflictStillReferenced = "still_referenced" // 上游已删除的条目仍被本地条目引用，暂不删除
+)
+
+// SyncConflict 合并共享拓扑时的冲突
+type SyncConflict struct {
+	Type   string `json:"type"`
+	Kind   string `json:"kind"` // hop / route / profile
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// SyncReport 合并共享拓扑的结果
+type SyncReport struct {
+	Added     []string       `json:"added"`
+	Updated   []string       `json:"updated"`
+	Removed   []string       `json:"removed"`
+	Conflicts []SyncConflict `json:"conflicts"`
+}
+
+// Changed 本地配置是否发生变化
+func (r *SyncReport) Changed() bool {
+	return len(r.Added) > 0 || len(r.Updated) > 0 || len(r.Removed) > 0
+}
+
+// ParseTopology 解析团队共享的拓扑文件，其中的凭据会被丢弃
+// 各成员依靠服务器 ID 对应本地凭据，因此只接受使用 ID 关联的版本（v2 及以上）
+func ParseTopology(data []byte) (*types.Config, error) {
+	var cfg types.Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse shared topology: %w", err)
+	}
+	if cfg.Version < types.ConfigVersion2 {
+		return nil, fmt.Errorf("shared topology must be config version %d or later, got %d", types.ConfigVersion2, cfg.Version)
+	}
+	for _, hop := range cfg.Hops {
+		if hop.ID == "" {
+			return nil, fmt.Errorf("shared topology hop '%s' has no id", hop.Name)
+		}
+	}
+	for _, profile := range cfg.Profiles {
+		if profile.ID == "" {
+			return nil, fmt.Errorf("shared topology profile '%s' has no id", profile.Name)
+		}
+	}
+
+	topology, _ := splitSecrets(&cfg)
+	return topology, nil
+}
+
+// MergeShared 将共享拓扑合并进本地配置（原地修改 local）
+// 本地添加的条目始终保留；团队条目（Origin 为 team）随上游新增、更新和删除，
+// 但保留本机的凭据
+func MergeShared(local, shared *types.Config) *SyncReport {
+	report := &SyncReport{
+		Added:     []string{},
+		Updated:   []string{},
+		Removed:   []string{},
+		Conflicts: []SyncConflict{},
+	}
+	mergeHops(local, shared, report)
+	mergeRoutes(local, shared, report)
+	mergeProfiles(local, shared, report)
+	return report
+}
+
+// mergeHops 合并服务器
+func mergeHops(local, shared *types.Config, report *SyncReport) {
+	sharedByID := make(map[string]*types.Hop, len(shared.Hops))
+	for _, hop := range shared.Hops {
+		sharedByID[hop.ID] = hop
+	}
+
+	merged := make([]*types.Hop, 0, len(local.Hops)+len(shared.Hops))
+	localByID := make(map[string]*types.Hop, len(local.Hops))
+	localNames := make(map[string]bool)
+
+	for _, hop := range local.Hops {
+		localByID[hop.ID] = hop
+		if hop.Origin != types.OriginTeam {
+			localNames[hop.Name] = true
+			merged = append(merged, hop)
+			continue
+		}
+
+		upstream, ok := sharedByID[hop.ID]
+		if !ok {
+			if ref := localReference(local, hop.ID); ref != "" {
+				report.Conflicts = append(report.Conflicts, SyncConflict{
+					Type: ConflictStillReferenced, Kind: "hop", ID: hop.ID, Name: hop.Name,
+					Reason: "removed upstream but still used by " + ref,
+				})
+				merged = append(merged, hop)
+				continue
+			}
+			report.Removed = append(report.Removed, "hop:"+hop.Name)
+			continue
+		}
+
+		updated := *upstream
+		updated.Origin = types.OriginTeam
+		updated.Password = hop.Password
+		updated.KeyPath = hop.KeyPath
+		updated.KeyPassphrase = hop.KeyPassphrase
+		if !reflect.DeepEqual(*hop, updated) {
+			// 原地更新，保持其他模块持有的指针有效
+			*hop = updated
+			report.Updated = append(report.Updated, "hop:"+hop.Name)
+		}
+		merged = append(merged, hop)
+	}
+
+	for _, upstream := range shared.Hops {
+		if existing, ok := localByID[upstream.ID]; ok {
+			if existing.Origin != types.OriginTeam {
+				report.Conflicts = append(report.Conflicts, SyncConflict{
+					Type: ConflictIDTaken, Kind: "hop", ID: upstream.ID, Name: upstream.Name,
+					Reason: fmt.Sprintf("id is used by local server '%s'", existing.Name),
+				})
+			}
+			continue
+		}
+		if localNames[upstream.Name] {
+			report.Conflicts = append(report.Conflicts, SyncConflict{
+				Type: ConflictNameTaken, Kind: "hop", ID: upstream.ID, Name: upstream.Name,
+				Reason: "a local server has the same name",
+			})
+		}
+		hop := *upstream
+		hop.Origin = types.OriginTeam
+		merged = append(merged, &hop)
+		report.Added = append(report.Added, "hop:"+hop.Name)
+	}
+
+	local.Hops = merged
+}
+
+// localReference 返回引用指定服务器的本地条目描述，无引用时返回空
+func localReference(cfg *types.Config, hopID string) string {
+	for _, hop := range cfg.Hops {
+		if hop.Origin != types.OriginTeam && hop.GatewayID == hopID {
+			return "server '" + hop.Name + "'"
+		}
+	}
+	for _, route := range cfg.Routes {
+		if route.Origin != types.OriginTeam && (route.FromID == hopID || route.ToID == hopID || route.ViaID == hopID) {
+			return "route " + route.FromID + " -> " + route.ToID
+		}
+	}
+	for _, profile := range cfg.Profiles {
+		if profile.Origin != types.OriginTeam {
+			for _, id := range profile.PathIDs {
+				if id == hopID {
+					return "profile '" + profile.Name + "'"
+				}
+			}
+		}
+	}
+	for _, mapping := range cfg.Portal.Client.Mappings {
+		for _, id := range mapping.Via {
+			if id == hopID {
+				return "portal mapping '" + mapping.Name + "'"
+			}
+		}
+	}
+	return ""
+}
+
+// routeKey 路由偏好以起点和终点唯一标识
+func routeKey(route *types.RoutePreference) string {
+	return route.FromID + " -> " + route.ToID
+}
+
+// mergeRoutes 合并路由偏好
+func mergeRoutes(local, shared *types.Config, report *SyncReport) {
+	sharedByKey := make(map[string]*types.RoutePreference, len(shared.Routes))
+	for _, route := range shared.Routes {
+		sharedByKey[routeKey(route)] = route
+	}
+
+	merged := make([]*types.RoutePreference, 0, len(local.Routes)+len(shared.Routes))
+	localByKey := make(map[string]*types.RoutePreference, len(local.Routes))
+
+	for _, route := range local.Routes {
+		key := routeKey(route)
+		localByKey[key] = route
+		if route.Origin != types.OriginTeam {
+			merged = append(merged, route)
+			continue
+		}
+
+		upstream, ok := sharedByKey[key]
+		if !ok {
+			report.Removed = append(report.Removed, "route:"+key)
+			continue
+		}
+		updated := *upstream
+		updated.Origin = types.OriginTeam
+		if !sameRoute(route, &updated) {
+			*route = updated
+			report.Updated = append(report.Updated, "route:"+key)
+		}
+		merged = append(merged, route)
+	}
+
+	for _, upstream := range shared.Routes {
+		key := routeKey(upstream)
+		if existing, ok := localByKey[key]; ok {
+			if existing.Origin != types.OriginTeam {
+				report.Conflicts = append(report.Conflicts, SyncConflict{
+					Type: ConflictIDTaken, Kind: "route", ID: key,
+					Reason: "a local route preference exists for the same servers",
+				})
+			}
+			continue
+		}
+		route := *upstream
+		route.Origin = types.OriginTeam
+		merged = append(merged, &route)
+		report.Added = append(report.Added, "route:"+key)
+	}
+
+	local.Routes = merged
+}
+
+// sameRoute 比较持久化字段（忽略运行时填充的显示名称）
+func sameRoute(a, b *types.RoutePreference) bool {
+	x, y := *a, *b
+	x.FromName, x.ToName, x.ViaName = "", "", ""
+	y.FromName, y.ToName, y.ViaName = "", "", ""
+	return reflect.DeepEqual(x, y)
+}
+
+// sameProfile 比较持久化字段（忽略运行时填充的路径名称）
+func sameProfile(a, b *types.Profile) bool {
+	x, y := *a, *b
+	x.PathNames, y.PathNames = nil, nil
+	return reflect.DeepEqual(x, y)
+}
+
+// mergeProfiles 合并预设
+func mergeProfiles(local, shared *types.Config, report *SyncReport) {
+	sharedByID := make(map[string]*types.Profile, len(shared.Profiles))
+	for _, profile := range shared.Profiles {
+		sharedByID[profile.ID] = profile
+	}
+
+	merged := make([]*types.Profile, 0, len(local.Profiles)+len(shared.Profiles))
+	localByID := make(map[string]*types.Profile, len(local.Profiles))
+
+	for _, profile := range local.Profiles {
+		localByID[profile.ID] = profile
+		if profile.Origin != types.OriginTeam {
+			merged = append(merged, profile)
+			continue
+		}
+
+		upstream, ok := sharedByID[profile.ID]
+		if !ok {
+			report.Removed = append(report.Removed, "profile:"+profile.Name)
+			continue
+		}
+		updated := *upstream
+		updated.Origin = types.OriginTeam
+		if !sameProfile(profile, &updated) {
+			*profile = updated
+			report.Updated = append(report.Updated, "profile:"+profile.Name)
+		}
+		merged = append(merged, profile)
+	}
+
+	for _, upstream := range shared.Profiles {
+		if existing, ok := localByID[upstream.ID]; ok {
+			if existing.Origin != types.OriginTeam {
+				report.Conflicts = append(report.Conflicts, SyncConflict{
+					Type: ConflictIDTaken, Kind: "profile", ID: upstream.ID, Name: upstream.Name,
+					Reason: fmt.Sprintf("id is used by local profile '%s'", existing.Name),
+				})
+			}
+			continue
+		}
+		profile := *upstream
+		profile.Origin = types.OriginTeam
+		merged = append(merged, &profile)
+		report.Added = append(report.Added, "profile:"+profile.Name)
+	}
+
+	local.Profiles = merged
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func hopNames(hops []*types.Hop) []string {
+	names := make([]string, len(hops))
+	for i, hop := range hops {
+		names[i] = hop.Name
+	}
+	return names
+}
+
+func TestMergeShared(t *testing.T) {
+	local := &types.Config{
+		Hops: []*types.Hop{
+			{ID: "mine", Name: "my-box", Host: "192.168.1.2", Password: "local-pass"},
+			{ID: "team-gw", Name: "gateway", Host: "1.1.1.1", Origin: types.OriginTeam, KeyPath: "~/.ssh/team"},
+			{ID: "team-old", Name: "retired", Host: "2.2.2.2", Origin: types.OriginTeam},
+			{ID: "team-used", Name: "db-gw", Host: "3.3.3.3", Origin: types.OriginTeam},
+			{ID: "clash", Name: "laptop-only", Host: "4.4.4.4"},
+			{ID: "local-db", Name: "db", Host: "10.0.0.9", GatewayID: "team-used"},
+		},
+		Profiles: []*types.Profile{
+			{ID: "p-team", Name: "deploy", PathIDs: []string{"team-gw"}, Origin: types.OriginTeam, PathNames: []string{"gateway"}},
+		},
+	}
+	shared := &types.Config{
+		Hops: []*types.Hop{
+			{ID: "team-gw", Name: "gateway", Host: "1.1.1.10"},
+			{ID: "team-new", Name: "bastion", Host: "5.5.5.5"},
+			{ID: "clash", Name: "conflicting", Host: "6.6.6.6"},
+			{ID: "team-dup", Name: "my-box", Host: "7.7.7.7"},
+		},
+		Routes: []*types.RoutePreference{
+			{FromID: "team-gw", ToID: "team-new", Threshold: 30},
+		},
+		Profiles: []*types.Profile{
+			{ID: "p-team", Name: "deploy", PathIDs: []string{"team-gw"}},
+		},
+	}
+
+	report := MergeShared(local, shared)
+
+	wantHops := []string{"my-box", "gateway", "db-gw", "laptop-only", "db", "bastion", "my-box"}
+	if got := hopNames(local.Hops); !reflect.DeepEqual(got, wantHops) {
+		t.Errorf("hops = %v, want %v", got, wantHops)
+	}
+	if !reflect.DeepEqual(report.Added, []string{"hop:bastion", "hop:my-box", "route:team-gw -> team-new"}) {
+		t.Errorf("unexpected added: %v", report.Added)
+	}
+	if !reflect.DeepEqual(report.Updated, []string{"hop:gateway"}) {
+		t.Errorf("unexpected updated (profile display names must not count): %v", report.Updated)
+	}
+	if !reflect.DeepEqual(report.Removed, []string{"hop:retired"}) {
+		t.Errorf("unexpected removed: %v", report.Removed)
+	}
+
+	gateway := local.GetHopByID("team-gw")
+	if gateway.Host != "1.1.1.10" || gateway.KeyPath != "~/.ssh/team" || gateway.Origin != types.OriginTeam {
+		t.Errorf("team hop not updated with local credentials kept: %+v", gateway)
+	}
+	if local.Hops[0].Password != "local-pass" || local.Hops[3].Host != "4.4.4.4" {
+		t.Error("local servers must not be touched")
+	}
+
+	conflicts := make(map[string]string)
+	for _, c := range report.Conflicts {
+		conflicts[c.ID] = c.Type
+	}
+	want := map[string]string{
+		"clash":     ConflictIDTaken,
+		"team-dup":  ConflictNameTaken,
+		"team-used": ConflictStillReferenced,
+	}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("conflicts = %v, want %v", conflicts, want)
+	}
+
+	// 再次合并同一份拓扑不应产生变化
+	if again := MergeShared(local, shared); again.Changed() {
+		t.Errorf("second merge should be a no-op, got %+v", again)
+	}
+}
+
+func TestParseTopology(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"v3", "version: 3\nhops:\n  - id: a\n    name: gw\n    password: leaked\n", false},
+		{"v1 names only", "version: 1\nhops:\n  - name: gw\n", true},
+		{"missing id", "version: 2\nhops:\n  - name: gw\n", true},
+		{"invalid yaml", "hops: [", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseTopology([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTopology() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Hops[0].Password != "" {
+				t.Error("credentials in a shared topology must be dropped")
+			}
+		})
+	}
+}
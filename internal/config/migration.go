@@ -9,6 +9,7 @@ import (
 
 // MigrateConfig 执行配置版本迁移
 // 版本 1 -> 版本 2：添加 ID 字段，将 name 关联改为 ID 关联
+// 版本 2 -> 版本 3：凭据从拓扑中分离，保存时写入加密的 secrets.enc
 func MigrateConfig(cfg *types.Config) error {
 	// 如果版本号为 0，说明是旧配置，设置为版本 1
 	if cfg.Version == 0 {
@@ -27,6 +28,13 @@ func MigrateConfig(cfg *types.Config) error {
 		log.Printf("[Config] Migration completed, now at version %d", cfg.Version)
 	}
 
+	// 版本 2 -> 版本 3 迁移
+	// 内存中的配置结构不变，拆分由存储层在保存时完成
+	if cfg.Version < types.ConfigVersion3 {
+		log.Printf("[Config] Migrating from version %d to version %d: credentials move to %s", cfg.Version, types.ConfigVersion3, SecretsFileName)
+		cfg.Version = types.ConfigVersion3
+	}
+
 	return nil
 }
 
@@ -118,5 +126,5 @@ func migrateV1ToV2(cfg *types.Config) error {
 
 // NeedsMigration 检查配置是否需要迁移
 func NeedsMigration(cfg *types.Config) bool {
-	return cfg.Version < types.ConfigVersion2
+	return cfg.Version < types.ConfigVersion3
 }
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// 运行时只按 ID 解析引用：服务器改名不会影响网关、路由偏好、预设和端口映射。
+// 旧配置中按名称保存的字段（gateway、from/to/via、path、映射 via 中的名称）
+// 在加载和改名前由 NormalizeRefs 转换为 ID；指向不存在服务器的引用由 DanglingRefs 报告
+
+// DanglingRef 一处无法解析的引用
+type DanglingRef struct {
+	Kind    string `json:"kind"`               // server | route | profile | portal_mapping
+	Owner   string `json:"owner"`              // 引用方名称
+	OwnerID string `json:"owner_id,omitempty"` // 引用方 ID（路由偏好没有 ID）
+	Field   string `json:"field"`              // 引用所在字段
+	Ref     string `json:"ref"`                // 无法解析的 ID 或名称
+	Fix     string `json:"fix"`                // 一键修复将执行的操作
+}
+
+// NormalizeRefs 把仍按名称保存的引用转换为 ID，并清除已转换的旧字段
+// 无法解析的名称保持不变，由 DanglingRefs 报告。返回每处改动的描述
+func NormalizeRefs(cfg *types.Config) []string {
+	nameToID := make(map[string]string, len(cfg.Hops))
+	for _, hop := range cfg.Hops {
+		if hop.ID != "" {
+			nameToID[hop.Name] = hop.ID
+		}
+	}
+
+	var changes []string
+	// resolve 把 *name 转换到 *id：id 已设置时只清除旧名称
+	resolve := func(what string, name, id *string) {
+		if *name == "" {
+			return
+		}
+		if *id == "" {
+			resolved, ok := nameToID[*name]
+			if !ok {
+				return
+			}
+			*id = resolved
+		}
+		changes = append(changes, fmt.Sprintf("%s: '%s' -> %s", what, *name, *id))
+		*name = ""
+	}
+
+	for _, hop := range cfg.Hops {
+		resolve("server '"+hop.Name+"' gateway", &hop.Gateway, &hop.GatewayID)
+	}
+	for _, route := range cfg.Routes {
+		resolve("route from", &route.From, &route.FromID)
+		resolve("route to", &route.To, &route.ToID)
+		resolve("route via", &route.Via, &route.ViaID)
+	}
+	for _, profile := range cfg.Profiles {
+		if len(profile.Path) == 0 {
+			continue
+		}
+		if len(profile.PathIDs) == 0 {
+			ids := make([]string, 0, len(profile.Path))
+			for _, name := range profile.Path {
+				id, ok := nameToID[name]
+				if !ok {
+					break
+				}
+				ids = append(ids, id)
+			}
+			if len(ids) != len(profile.Path) {
+				continue
+			}
+			profile.PathIDs = ids
+		}
+		changes = append(changes, fmt.Sprintf("profile '%s' path: %v -> %v", profile.Name, profile.Path, profile.PathIDs))
+		profile.Path = nil
+	}
+	for i := range cfg.Portal.Client.Mappings {
+		mapping := &cfg.Portal.Client.Mappings[i]
+		for j, ref := range mapping.Via {
+			if cfg.GetHopByID(ref) != nil {
+				continue
+			}
+			if id, ok := nameToID[ref]; ok {
+				mapping.Via[j] = id
+				changes = append(changes, fmt.Sprintf("portal mapping '%s' via: '%s' -> %s", mapping.Name, ref, id))
+			}
+		}
+	}
+	return changes
+}
+
+// DanglingRefs 列出指向不存在服务器的引用（包括无法解析的旧名称）
+func DanglingRefs(cfg *types.Config) []DanglingRef {
+	exists := func(id string) bool { return cfg.GetHopByID(id) != nil }
+
+	refs := make([]DanglingRef, 0)
+	for _, hop := range cfg.Hops {
+		if hop.GatewayID != "" && !exists(hop.GatewayID) {
+			refs = append(refs, DanglingRef{Kind: "server", Owner: hop.Name, OwnerID: hop.ID, Field: "gateway_id", Ref: hop.GatewayID, Fix: "clear gateway"})
+		} else if hop.GatewayID == "" && hop.Gateway != "" {
+			refs = append(refs, DanglingRef{Kind: "server", Owner: hop.Name, OwnerID: hop.ID, Field: "gateway", Ref: hop.Gateway, Fix: "clear gateway"})
+		}
+	}
+	for _, route := range cfg.Routes {
+		owner := firstNonEmpty(route.FromID, route.From) + " -> " + firstNonEmpty(route.ToID, route.To)
+		check := func(field, id, name, fix string) {
+			switch {
+			case id != "" && !exists(id):
+				refs = append(refs, DanglingRef{Kind: "route", Owner: owner, Field: field + "_id", Ref: id, Fix: fix})
+			case id == "" && name != "":
+				refs = append(refs, DanglingRef{Kind: "route", Owner: owner, Field: field, Ref: name, Fix: fix})
+			}
+		}
+		check("from", route.FromID, route.From, "delete route")
+		check("to", route.ToID, route.To, "delete route")
+		check("via", route.ViaID, route.Via, "clear via")
+	}
+	for _, profile := range cfg.Profiles {
+		for _, id := range profile.PathIDs {
+			if !exists(id) {
+				refs = append(refs, DanglingRef{Kind: "profile", Owner: profile.Name, OwnerID: profile.ID, Field: "path_ids", Ref: id, Fix: "remove from path"})
+			}
+		}
+		if len(profile.PathIDs) == 0 {
+			for _, name := range profile.Path {
+				if cfg.GetHopByName(name) == nil {
+					refs = append(refs, DanglingRef{Kind: "profile", Owner: profile.Name, OwnerID: profile.ID, Field: "path", Ref: name, Fix: "remove from path"})
+				}
+			}
+		}
+	}
+	for _, mapping := range cfg.Portal.Client.Mappings {
+		for _, id := range mapping.Via {
+			if !exists(id) {
+				refs = append(refs, DanglingRef{Kind: "portal_mapping", Owner: mapping.Name, OwnerID: mapping.ID, Field: "via", Ref: id, Fix: "remove from via"})
+			}
+		}
+	}
+	return refs
+}
+
+// FixDanglingRefs 先把旧名称转换为 ID，再移除仍无法解析的引用：
+// 清除网关和路由 via，删除起点或终点不存在的路由，从预设路径和映射 via 中移除该服务器。
+// 返回被修复的引用
+func FixDanglingRefs(cfg *types.Config) []DanglingRef {
+	NormalizeRefs(cfg)
+	fixed := DanglingRefs(cfg)
+	if len(fixed) == 0 {
+		return fixed
+	}
+	exists := func(id string) bool { return cfg.GetHopByID(id) != nil }
+
+	for _, hop := range cfg.Hops {
+		if (hop.GatewayID != "" && !exists(hop.GatewayID)) || (hop.GatewayID == "" && hop.Gateway != "") {
+			hop.GatewayID = ""
+			hop.Gateway = ""
+		}
+	}
+
+	routes := cfg.Routes[:0]
+	for _, route := range cfg.Routes {
+		danglingEnd := func(id, name string) bool {
+			return (id != "" && !exists(id)) || (id == "" && name != "")
+		}
+		if danglingEnd(route.FromID, route.From) || danglingEnd(route.ToID, route.To) {
+			continue
+		}
+		if danglingEnd(route.ViaID, route.Via) {
+			route.ViaID = ""
+			route.Via = ""
+		}
+		routes = append(routes, route)
+	}
+	for i := len(routes); i < len(cfg.Routes); i++ {
+		cfg.Routes[i] = nil
+	}
+	cfg.Routes = routes
+
+	for _, profile := range cfg.Profiles {
+		if len(profile.PathIDs) == 0 && len(profile.Path) > 0 {
+			// 能解析的名称转换为 ID，其余丢弃
+			for _, name := range profile.Path {
+				if hop := cfg.GetHopByName(name); hop != nil {
+					profile.PathIDs = append(profile.PathIDs, hop.ID)
+				}
+			}
+		}
+		profile.Path = nil
+		profile.PathIDs = keepExisting(cfg, profile.PathIDs)
+	}
+	for i := range cfg.Portal.Client.Mappings {
+		mapping := &cfg.Portal.Client.Mappings[i]
+		mapping.Via = keepExisting(cfg, mapping.Via)
+	}
+	return fixed
+}
+
+// keepExisting 过滤掉不存在的服务器 ID
+func keepExisting(cfg *types.Config, ids []string) []string {
+	kept := ids[:0]
+	for _, id := range ids {
+		if cfg.GetHopByID(id) != nil {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+// normalizeRefs 转换配置中的旧名称引用，返回是否有变化
+func (m *Manager) normalizeRefs() bool {
+	changes := NormalizeRefs(m.config)
+	for _, change := range changes {
+		log.Printf("[Config] Resolved reference by name: %s", change)
+	}
+	return len(changes) > 0
+}
+
+// DanglingRefs 列出当前配置中无法解析的引用
+func (m *Manager) DanglingRefs() []DanglingRef {
+	return DanglingRefs(m.Get())
+}
+
+// FixDanglingRefs 修复所有无法解析的引用并保存
+func (m *Manager) FixDanglingRefs() ([]DanglingRef, error) {
+	fixed := FixDanglingRefs(m.Get())
+	if len(fixed) == 0 {
+		return fixed, nil
+	}
+	return fixed, m.Save()
+}
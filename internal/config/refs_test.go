@@ -0,0 +1,164 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// legacyConfig 仍按名称保存引用的配置
+func legacyConfig() *types.Config {
+	return &types.Config{
+		Hops: []*types.Hop{
+			{ID: "hop-1", Name: "bastion"},
+			{ID: "hop-2", Name: "internal", Gateway: "bastion"},
+		},
+		Routes: []*types.RoutePreference{
+			{From: "bastion", To: "internal", Via: "bastion"},
+		},
+		Profiles: []*types.Profile{
+			{ID: "profile-1", Name: "deploy", Path: []string{"bastion", "internal"}},
+		},
+		Portal: types.PortalConfig{
+			Client: types.PortalClientConfig{
+				Mappings: []types.PortMapping{{ID: "m-1", Name: "db", Via: []string{"bastion", "hop-2"}}},
+			},
+		},
+	}
+}
+
+func TestNormalizeRefs(t *testing.T) {
+	cfg := legacyConfig()
+	if changes := NormalizeRefs(cfg); len(changes) != 6 {
+		t.Errorf("expected 6 changes, got %d: %q", len(changes), changes)
+	}
+
+	if hop := cfg.Hops[1]; hop.GatewayID != "hop-1" || hop.Gateway != "" {
+		t.Errorf("gateway not resolved: %+v", hop)
+	}
+	want := &types.RoutePreference{FromID: "hop-1", ToID: "hop-2", ViaID: "hop-1"}
+	if !reflect.DeepEqual(cfg.Routes[0], want) {
+		t.Errorf("route = %+v, want %+v", cfg.Routes[0], want)
+	}
+	if profile := cfg.Profiles[0]; !reflect.DeepEqual(profile.PathIDs, []string{"hop-1", "hop-2"}) || profile.Path != nil {
+		t.Errorf("profile path not resolved: %+v", profile)
+	}
+	if via := cfg.Portal.Client.Mappings[0].Via; !reflect.DeepEqual(via, []string{"hop-1", "hop-2"}) {
+		t.Errorf("mapping via = %v", via)
+	}
+
+	// 再次执行没有变化
+	if changes := NormalizeRefs(cfg); len(changes) != 0 {
+		t.Errorf("second pass changed %q", changes)
+	}
+	if refs := DanglingRefs(cfg); len(refs) != 0 {
+		t.Errorf("unexpected dangling refs: %+v", refs)
+	}
+}
+
+func TestRenameKeepsLegacyReferences(t *testing.T) {
+	mgr := newTrashTestManager(t)
+	mgr.config = legacyConfig()
+
+	renamed := *mgr.config.Hops[0]
+	renamed.Name = "jump"
+	if err := mgr.UpdateHop("hop-1", &renamed); err != nil {
+		t.Fatalf("UpdateHop failed: %v", err)
+	}
+
+	if refs := mgr.DanglingRefs(); len(refs) != 0 {
+		t.Fatalf("rename left dangling refs: %+v", refs)
+	}
+	if got := mgr.config.Hops[1].GatewayID; got != "hop-1" {
+		t.Errorf("gateway = %q after rename", got)
+	}
+}
+
+func TestAddNormalizesLegacyRefs(t *testing.T) {
+	mgr := newTrashTestManager(t)
+	mgr.config = legacyConfig()
+	mgr.config.Routes = nil
+	mgr.config.Profiles = nil
+
+	if err := mgr.AddRoute(&types.RoutePreference{From: "bastion", To: "internal"}); err != nil {
+		t.Fatalf("AddRoute failed: %v", err)
+	}
+	if err := mgr.AddProfile(&types.Profile{Name: "deploy", Path: []string{"bastion", "internal"}}); err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+
+	if route := mgr.config.Routes[0]; route.FromID != "hop-1" || route.ToID != "hop-2" || route.From != "" {
+		t.Errorf("route not normalized: %+v", route)
+	}
+	if got := mgr.config.Profiles[0].PathIDs; !reflect.DeepEqual(got, []string{"hop-1", "hop-2"}) {
+		t.Errorf("profile path = %v", got)
+	}
+	if err := mgr.DeleteRoute("hop-1", "hop-2"); err != nil {
+		t.Errorf("DeleteRoute failed: %v", err)
+	}
+}
+
+func TestFixDanglingRefs(t *testing.T) {
+	cfg := &types.Config{
+		Hops: []*types.Hop{
+			{ID: "hop-1", Name: "bastion"},
+			{ID: "hop-2", Name: "internal", GatewayID: "gone"},
+			{ID: "hop-3", Name: "legacy", Gateway: "unknown"},
+		},
+		Routes: []*types.RoutePreference{
+			{FromID: "hop-1", ToID: "gone"},
+			{FromID: "hop-1", ToID: "hop-2", ViaID: "gone"},
+		},
+		Profiles: []*types.Profile{
+			{ID: "profile-1", Name: "deploy", PathIDs: []string{"hop-1", "gone", "hop-2"}},
+			{ID: "profile-2", Name: "old", Path: []string{"bastion", "unknown"}},
+		},
+		Portal: types.PortalConfig{
+			Client: types.PortalClientConfig{
+				Mappings: []types.PortMapping{{ID: "m-1", Name: "db", Via: []string{"gone", "hop-1"}}},
+			},
+		},
+	}
+
+	dangling := DanglingRefs(cfg)
+	var fields []string
+	for _, ref := range dangling {
+		fields = append(fields, ref.Kind+"."+ref.Field+"="+ref.Ref)
+	}
+	wantFields := []string{
+		"server.gateway_id=gone",
+		"server.gateway=unknown",
+		"route.to_id=gone",
+		"route.via_id=gone",
+		"profile.path_ids=gone",
+		"profile.path=unknown",
+		"portal_mapping.via=gone",
+	}
+	if !reflect.DeepEqual(fields, wantFields) {
+		t.Errorf("dangling = %q, want %q", fields, wantFields)
+	}
+
+	if fixed := FixDanglingRefs(cfg); len(fixed) != len(wantFields) {
+		t.Errorf("fixed %d refs, want %d", len(fixed), len(wantFields))
+	}
+	if refs := DanglingRefs(cfg); len(refs) != 0 {
+		t.Fatalf("refs left after fix: %+v", refs)
+	}
+
+	if cfg.Hops[1].GatewayID != "" || cfg.Hops[2].Gateway != "" {
+		t.Error("dangling gateways not cleared")
+	}
+	if len(cfg.Routes) != 1 || cfg.Routes[0].ToID != "hop-2" || cfg.Routes[0].ViaID != "" {
+		t.Errorf("routes = %+v", cfg.Routes)
+	}
+	if got := cfg.Profiles[0].PathIDs; !reflect.DeepEqual(got, []string{"hop-1", "hop-2"}) {
+		t.Errorf("profile path = %v", got)
+	}
+	if got := cfg.Profiles[1].PathIDs; !reflect.DeepEqual(got, []string{"hop-1"}) || cfg.Profiles[1].Path != nil {
+		t.Errorf("legacy profile path = %v / %v", got, cfg.Profiles[1].Path)
+	}
+	if got := cfg.Portal.Client.Mappings[0].Via; !reflect.DeepEqual(got, []string{"hop-1"}) {
+		t.Errorf("mapping via = %v", got)
+	}
+}
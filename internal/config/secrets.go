@@ -0,0 +1,250 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// SecretsFileName 加密的本地凭据文件
+	SecretsFileName = "secrets.enc"
+	// SecretKeyFileName 凭据加密密钥，首次保存时自动生成
+	SecretKeyFileName = "secret.key"
+
+	// gitignoreContent 配置目录可直接作为 git 仓库共享拓扑，本地文件不应被提交
+	gitignoreContent = "# 本地凭据与运行时文件，不要提交\n" +
+		SecretsFileName + "\n" +
+		SecretKeyFileName + "\n" +
+		SQLiteFileName + "*\n" +
+		"*.bak\n" +
+		"*.tmp\n" +
+		"sync/\n" +
+		"audit.log\n" +
+		"agent-hub.*\n"
+)
+
+// secretsMagic 加密文件头，用于识别格式和版本
+var secretsMagic = []byte("GMSSH-SECRETS-1\n")
+
+// splitSecrets 把配置拆分为可共享的拓扑和本地凭据，不修改传入的配置
+func splitSecrets(cfg *types.Config) (*types.Config, *types.Secrets) {
+	topology := *cfg
+	secrets := &types.Secrets{}
+
+	stripHop := func(hop *types.Hop) *types.Hop {
+		h := *hop
+		if h.Password != "" || h.KeyPath != "" || h.KeyPassphrase != "" {
+			if secrets.Hops == nil {
+				secrets.Hops = make(map[string]types.HopSecret)
+			}
+			secrets.Hops[h.ID] = types.HopSecret{Password: h.Password, KeyPath: h.KeyPath, KeyPassphrase: h.KeyPassphrase}
+		}
+		h.Password = ""
+		h.KeyPath = ""
+		h.KeyPassphrase = ""
+		return &h
+	}
+
+	topology.Hops = make([]*types.Hop, len(cfg.Hops))
+	for i, hop := range cfg.Hops {
+		topology.Hops[i] = stripHop(hop)
+	}
+
+	// 回收站中的服务器同样不能把凭据写进拓扑，恢复时需要原样取回
+	if cfg.Trash != nil {
+		topology.Trash = make([]*types.TrashedHop, len(cfg.Trash))
+		for i, item := range cfg.Trash {
+			trashed := *item
+			trashed.Hop = stripHop(item.Hop)
+			topology.Trash[i] = &trashed
+		}
+	}
+
+	if cfg.Web.Users != nil {
+		topology.Web.Users = make([]*types.WebUser, len(cfg.Web.Users))
+		for i, user := range cfg.Web.Users {
+			u := *user
+			if u.Token != "" {
+				if secrets.WebUsers == nil {
+					secrets.WebUsers = make(map[string]string)
+				}
+				secrets.WebUsers[u.Name] = u.Token
+			}
+			u.Token = ""
+			topology.Web.Users[i] = &u
+		}
+	}
+
+	secrets.AgentTokens = cfg.Agents.Tokens
+	topology.Agents.Tokens = nil
+
+	if cfg.Portal.Server.AuthTokens != nil {
+		topology.Portal.Server.AuthTokens = make([]types.PortalTokenConfig, len(cfg.Portal.Server.AuthTokens))
+		secrets.PortalTokens = make([]string, len(cfg.Portal.Server.AuthTokens))
+		for i, token := range cfg.Portal.Server.AuthTokens {
+			secrets.PortalTokens[i] = token.Token
+			token.Token = ""
+			topology.Portal.Server.AuthTokens[i] = token
+		}
+	}
+
+	return &topology, secrets
+}
+
+// mergeSecrets 把本地凭据合并回拓扑；拓扑中已手工填写的值不会被清空
+func mergeSecrets(cfg *types.Config, secrets *types.Secrets) {
+	if secrets == nil {
+		return
+	}
+
+	hops := append([]*types.Hop(nil), cfg.Hops...)
+	for _, item := range cfg.Trash {
+		hops = append(hops, item.Hop)
+	}
+	for _, hop := range hops {
+		if secret, ok := secrets.Hops[hop.ID]; ok {
+			if secret.Password != "" {
+				hop.Password = secret.Password
+			}
+			if secret.KeyPath != "" {
+				hop.KeyPath = secret.KeyPath
+			}
+			if secret.KeyPassphrase != "" {
+				hop.KeyPassphrase = secret.KeyPassphrase
+			}
+		}
+	}
+
+	for _, user := range cfg.Web.Users {
+		if token, ok := secrets.WebUsers[user.Name]; ok {
+			user.Token = token
+		}
+	}
+
+	if len(secrets.AgentTokens) > 0 {
+		cfg.Agents.Tokens = secrets.AgentTokens
+	}
+
+	for i := range cfg.Portal.Server.AuthTokens {
+		if i < len(secrets.PortalTokens) && secrets.PortalTokens[i] != "" {
+			cfg.Portal.Server.AuthTokens[i].Token = secrets.PortalTokens[i]
+		}
+	}
+}
+
+// secretBox 用配置目录下的本地密钥加解密凭据（AES-256-GCM）
+// 密钥与密文放在同一台机器上，目的是避免凭据随拓扑文件被误提交或分享出去
+type secretBox struct {
+	keyPath string
+}
+
+// newSecretBox 创建使用 configDir 下密钥的 secretBox
+func newSecretBox(configDir string) *secretBox {
+	return &secretBox{keyPath: filepath.Join(configDir, SecretKeyFileName)}
+}
+
+// key 读取密钥，create 为 true 时在缺失时生成新密钥
+func (b *secretBox) key(create bool) ([]byte, error) {
+	key, err := os.ReadFile(b.keyPath)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("invalid secret key %s", b.keyPath)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) || !create {
+		return nil, fmt.Errorf("failed to read secret key: %w", err)
+	}
+
+	key = make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate secret key: %w", err)
+	}
+	if err := os.WriteFile(b.keyPath, key, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write secret key: %w", err)
+	}
+	return key, nil
+}
+
+// seal 加密凭据
+func (b *secretBox) seal(secrets *types.Secrets) ([]byte, error) {
+	plaintext, err := yaml.Marshal(secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal secrets: %w", err)
+	}
+
+	key, err := b.key(true)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := append([]byte{}, secretsMagic...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, secretsMagic), nil
+}
+
+// open 解密凭据
+func (b *secretBox) open(data []byte) (*types.Secrets, error) {
+	if !bytes.HasPrefix(data, secretsMagic) {
+		return nil, fmt.Errorf("unrecognized secrets format")
+	}
+	data = data[len(secretsMagic):]
+
+	key, err := b.key(false)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("secrets data too short")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], secretsMagic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secrets (wrong %s?): %w", SecretKeyFileName, err)
+	}
+
+	var secrets types.Secrets
+	if err := yaml.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets: %w", err)
+	}
+	return &secrets, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// ensureGitignore 在配置目录中写入 .gitignore（已存在时不覆盖）
+func ensureGitignore(configDir string) {
+	path := filepath.Join(configDir, ".gitignore")
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+	os.WriteFile(path, []byte(gitignoreContent), 0600)
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/google/uuid"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// NeedsSetup 配置中还没有服务器和 Web 用户，gmssh init 和 /api/setup 据此引导首次配置
+func NeedsSetup(cfg *types.Config) bool {
+	return len(cfg.Hops) == 0 && len(cfg.Web.Users) == 0
+}
+
+// ImportHops 把 hops 中名称尚未被占用的服务器加入配置并保存，返回加入的服务器。
+// 网关按名称引用（Gateway），保存前转换为 ID；引用的网关不存在时改为外网服务器
+func (m *Manager) ImportHops(hops []*types.Hop) ([]*types.Hop, error) {
+	var added []*types.Hop
+	for _, hop := range hops {
+		if m.config.GetHopByName(hop.Name) != nil {
+			continue
+		}
+		if hop.ID == "" {
+			hop.ID = uuid.New().String()
+		}
+		m.config.Hops = append(m.config.Hops, hop)
+		added = append(added, hop)
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	m.normalizeRefs()
+	for _, hop := range added {
+		if hop.Gateway != "" {
+			hop.Gateway = ""
+			hop.ServerType = types.ServerExternal
+		}
+	}
+	return added, m.Save()
+}
+
+// SSHImportResult 导入 OpenSSH 配置中主机的结果
+type SSHImportResult struct {
+	Path     string       `json:"path,omitempty"`
+	Found    int          `json:"found"`
+	Imported []*types.Hop `json:"imported"`          // dryRun 时为将要加入的服务器，网关仍按名称引用
+	Skipped  []string     `json:"skipped,omitempty"` // 名称已存在的主机
+	DryRun   bool         `json:"dry_run,omitempty"`
+}
+
+// ImportSSHHosts 导入 ParseSSHConfig 解析出的主机，规则同 ImportHops；dryRun 时只报告会加入和跳过的主机
+func (m *Manager) ImportSSHHosts(hops []*types.Hop, dryRun bool) (*SSHImportResult, error) {
+	result := &SSHImportResult{Found: len(hops), Imported: []*types.Hop{}, DryRun: dryRun}
+	var fresh []*types.Hop
+	for _, hop := range hops {
+		if m.config.GetHopByName(hop.Name) != nil {
+			result.Skipped = append(result.Skipped, hop.Name)
+			continue
+		}
+		fresh = append(fresh, hop)
+	}
+	if dryRun {
+		result.Imported = append(result.Imported, fresh...)
+		return result, nil
+	}
+	added, err := m.ImportHops(fresh)
+	if err != nil {
+		return nil, err
+	}
+	result.Imported = append(result.Imported, added...)
+	return result, nil
+}
+
+// NewAdminUser 生成带随机令牌的管理员用户
+func NewAdminUser(name string) (*types.WebUser, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	return &types.WebUser{Name: name, Token: hex.EncodeToString(buf), Role: types.WebRoleAdmin}, nil
+}
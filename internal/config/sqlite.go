@@ -0,0 +1,487 @@
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+	"gopkg.in/yaml.v3"
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteFileName SQLite 配置库文件名，存在时优先于 config.yaml
+const SQLiteFileName = "config.db"
+
+// sqliteSchema 服务器、路由、预设和映射各占一张表，按行存储；
+// 其余的全局设置作为一个 YAML 文档放在 settings 表中。
+// 行数据同样以 YAML 编码，保证与 config.yaml 字段（包括 JSON 中隐藏的密钥）一致。
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS settings (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS hops (
+	id       TEXT PRIMARY KEY,
+	position INTEGER NOT NULL,
+	data     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS routes (
+	position INTEGER PRIMARY KEY,
+	data     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS profiles (
+	id       TEXT PRIMARY KEY,
+	position INTEGER NOT NULL,
+	data     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS portal_mappings (
+	id       TEXT PRIMARY KEY,
+	position INTEGER NOT NULL,
+	data     TEXT NOT NULL
+);
+`
+
+const (
+	// settingsKey settings 表中保存全局设置的键
+	settingsKey = "config"
+	// secretsKey settings 表中保存加密凭据的键
+	secretsKey = "secrets"
+)
+
+// SQLiteStorage SQLite 配置存储
+// 每次保存在一个事务内完成，web 服务和 CLI 并发读写时不会看到写了一半的配置；
+// 保存只写入相对上次读写变化的行，各自修改不同记录时互不覆盖
+type SQLiteStorage struct {
+	db   *sql.DB
+	path string
+	box  *secretBox
+
+	mu   sync.Mutex
+	last *sqliteSnapshot // 上次 Load 或 Save 时的配置
+}
+
+// OpenSQLiteStorage 打开（必要时创建）SQLite 配置库
+func OpenSQLiteStorage(path string) (*SQLiteStorage, error) {
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config database: %w", err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize config database: %w", err)
+	}
+	// 配置中包含密码和令牌
+	os.Chmod(path, 0600)
+	return &SQLiteStorage{db: db, path: path, box: newSecretBox(filepath.Dir(path))}, nil
+}
+
+// Load 从数据库读取配置
+func (s *SQLiteStorage) Load() (*types.Config, error) {
+	var settings string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, settingsKey).Scan(&settings)
+	if err == sql.ErrNoRows {
+		s.remember(nil)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var config types.Config
+	if err := yaml.Unmarshal([]byte(settings), &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config settings: %w", err)
+	}
+
+	config.Hops = []*types.Hop{}
+	if err := s.loadRows("hops", func(data []byte) error {
+		var hop types.Hop
+		if err := yaml.Unmarshal(data, &hop); err != nil {
+			return err
+		}
+		config.Hops = append(config.Hops, &hop)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	config.Routes = []*types.RoutePreference{}
+	if err := s.loadRows("routes", func(data []byte) error {
+		var route types.RoutePreference
+		if err := yaml.Unmarshal(data, &route); err != nil {
+			return err
+		}
+		config.Routes = append(config.Routes, &route)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	config.Profiles = []*types.Profile{}
+	if err := s.loadRows("profiles", func(data []byte) error {
+		var profile types.Profile
+		if err := yaml.Unmarshal(data, &profile); err != nil {
+			return err
+		}
+		config.Profiles = append(config.Profiles, &profile)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	config.Portal.Client.Mappings = nil
+	if err := s.loadRows("portal_mappings", func(data []byte) error {
+		var mapping types.PortMapping
+		if err := yaml.Unmarshal(data, &mapping); err != nil {
+			return err
+		}
+		config.Portal.Client.Mappings = append(config.Portal.Client.Mappings, mapping)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var sealed []byte
+	err = s.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, secretsKey).Scan(&sealed)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to read secrets: %w", err)
+	}
+	if err == nil {
+		secrets, err := s.box.open(sealed)
+		if err != nil {
+			return nil, err
+		}
+		mergeSecrets(&config, secrets)
+	}
+
+	snap, err := newSQLiteSnapshot(&config)
+	if err != nil {
+		return nil, err
+	}
+	s.remember(snap)
+	return &config, nil
+}
+
+// remember 记录最近读到的配置，作为下次保存时比较的基准
+func (s *SQLiteStorage) remember(snap *sqliteSnapshot) {
+	s.mu.Lock()
+	s.last = snap
+	s.mu.Unlock()
+}
+
+// loadRows 按 position 顺序读取一张表的所有行
+func (s *SQLiteStorage) loadRows(table string, fn func(data []byte) error) error {
+	rows, err := s.db.Query(`SELECT data FROM ` + table + ` ORDER BY position, rowid`)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return fmt.Errorf("failed to read %s: %w", table, err)
+		}
+		if err := fn([]byte(data)); err != nil {
+			return fmt.Errorf("failed to parse %s row: %w", table, err)
+		}
+	}
+	return rows.Err()
+}
+
+// Save 在一个事务内写入配置，只改动与上次读写相比发生变化的行，
+// 其他进程同时修改的服务器、预设或凭据不会被整表覆盖
+func (s *SQLiteStorage) Save(cfg *types.Config) error {
+	next, err := newSQLiteSnapshot(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	base := s.last
+	if base == nil {
+		base = &sqliteSnapshot{rows: map[string]map[string]sqliteRow{}}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if next.settings != base.settings {
+		if _, err := tx.Exec(`INSERT INTO settings (key, value) VALUES (?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value`, settingsKey, next.settings); err != nil {
+			return fmt.Errorf("failed to write config settings: %w", err)
+		}
+	}
+	if err := s.saveSecrets(tx, base.secrets, next.secrets); err != nil {
+		return err
+	}
+
+	for _, table := range sqliteRowTables {
+		if err := saveRows(tx, table, base.rows[table], next.rows[table]); err != nil {
+			return err
+		}
+	}
+
+	// 路由没有 ID，有变化时整表重写
+	if !reflect.DeepEqual(base.routes, next.routes) {
+		if _, err := tx.Exec(`DELETE FROM routes`); err != nil {
+			return fmt.Errorf("failed to clear routes: %w", err)
+		}
+		for i, data := range next.routes {
+			if _, err := tx.Exec(`INSERT INTO routes (position, data) VALUES (?, ?)`, i, data); err != nil {
+				return fmt.Errorf("failed to write route: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit config: %w", err)
+	}
+	s.last = next
+	return nil
+}
+
+// saveRows 写入新增或变化的行，删除上次存在而本次已移除的行
+func saveRows(tx *sql.Tx, table string, base, next map[string]sqliteRow) error {
+	for id, row := range next {
+		if old, ok := base[id]; ok && old == row {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO `+table+` (id, position, data) VALUES (?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET position = excluded.position, data = excluded.data`,
+			id, row.position, row.data); err != nil {
+			return fmt.Errorf("failed to write %s %s: %w", table, id, err)
+		}
+	}
+	for id := range base {
+		if _, ok := next[id]; ok {
+			continue
+		}
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete %s %s: %w", table, id, err)
+		}
+	}
+	return nil
+}
+
+// saveSecrets 把本次相对上次的凭据变化合并到库中当前的凭据上再加密写回
+func (s *SQLiteStorage) saveSecrets(tx *sql.Tx, base, next *types.Secrets) error {
+	if base == nil {
+		base = &types.Secrets{}
+	}
+	if reflect.DeepEqual(base, next) {
+		return nil
+	}
+
+	current := &types.Secrets{}
+	var sealed []byte
+	err := tx.QueryRow(`SELECT value FROM settings WHERE key = ?`, secretsKey).Scan(&sealed)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read secrets: %w", err)
+	}
+	if err == nil {
+		if current, err = s.box.open(sealed); err != nil {
+			return err
+		}
+	}
+
+	current.Hops = mergeChanges(current.Hops, base.Hops, next.Hops)
+	current.WebUsers = mergeChanges(current.WebUsers, base.WebUsers, next.WebUsers)
+	if !reflect.DeepEqual(base.AgentTokens, next.AgentTokens) {
+		current.AgentTokens = next.AgentTokens
+	}
+	if !reflect.DeepEqual(base.PortalTokens, next.PortalTokens) {
+		current.PortalTokens = next.PortalTokens
+	}
+
+	sealed, err = s.box.seal(current)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`, secretsKey, sealed); err != nil {
+		return fmt.Errorf("failed to write secrets: %w", err)
+	}
+	return nil
+}
+
+// mergeChanges 把 base 到 next 之间新增、修改和删除的键应用到 current 上
+func mergeChanges[V comparable](current, base, next map[string]V) map[string]V {
+	merged := make(map[string]V, len(current)+len(next))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range next {
+		if old, ok := base[k]; !ok || old != v {
+			merged[k] = v
+		}
+	}
+	for k := range base {
+		if _, ok := next[k]; !ok {
+			delete(merged, k)
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// sqliteRowTables 按 ID 存储的表
+var sqliteRowTables = []string{"hops", "profiles", "portal_mappings"}
+
+// sqliteRow 一行记录编码后的内容
+type sqliteRow struct {
+	position int
+	data     string
+}
+
+// sqliteSnapshot 配置按表编码后的形式，保存时与上次读写的快照比较，只写入差异
+type sqliteSnapshot struct {
+	settings string
+	rows     map[string]map[string]sqliteRow // 表 -> ID -> 行
+	routes   []string
+	secrets  *types.Secrets
+}
+
+// newSQLiteSnapshot 把配置拆分为全局设置、各表行和凭据
+func newSQLiteSnapshot(cfg *types.Config) (*sqliteSnapshot, error) {
+	cfg, secrets := splitSecrets(cfg)
+
+	// 全局设置不包含按行存储的列表
+	settings := *cfg
+	settings.Hops = nil
+	settings.Routes = nil
+	settings.Profiles = nil
+	settings.Portal.Client.Mappings = nil
+	settingsData, err := yaml.Marshal(&settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	snap := &sqliteSnapshot{
+		settings: string(settingsData),
+		rows:     make(map[string]map[string]sqliteRow, len(sqliteRowTables)),
+		secrets:  secrets,
+	}
+	add := func(table, id string, position int, v interface{}) error {
+		rows := snap.rows[table]
+		if rows == nil {
+			rows = make(map[string]sqliteRow)
+			snap.rows[table] = rows
+		}
+		if _, ok := rows[id]; ok {
+			return fmt.Errorf("duplicate %s id %q", table, id)
+		}
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s %s: %w", table, id, err)
+		}
+		rows[id] = sqliteRow{position: position, data: string(data)}
+		return nil
+	}
+
+	for i, hop := range cfg.Hops {
+		if err := add("hops", hop.ID, i, hop); err != nil {
+			return nil, err
+		}
+	}
+	for i, profile := range cfg.Profiles {
+		if err := add("profiles", profile.ID, i, profile); err != nil {
+			return nil, err
+		}
+	}
+	for i, mapping := range cfg.Portal.Client.Mappings {
+		if err := add("portal_mappings", mapping.ID, i, mapping); err != nil {
+			return nil, err
+		}
+	}
+	for _, route := range cfg.Routes {
+		data, err := yaml.Marshal(route)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal route: %w", err)
+		}
+		snap.routes = append(snap.routes, string(data))
+	}
+	return snap, nil
+}
+
+// Path 返回数据库文件路径
+func (s *SQLiteStorage) Path() string {
+	return s.path
+}
+
+// Close 关闭数据库
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// MigrateToSQLite 将配置目录下的 config.yaml 导入新建的 config.db，
+// 导入成功后把 YAML 文件重命名为 config.yaml.bak，之后的读写都走 SQLite
+func MigrateToSQLite(configDir string) (string, error) {
+	yamlPath := filepath.Join(configDir, ConfigFileName)
+	dbPath := filepath.Join(configDir, SQLiteFileName)
+
+	if _, err := os.Stat(dbPath); err == nil {
+		return "", fmt.Errorf("%s already exists", dbPath)
+	}
+
+	config, err := NewYAMLStorage(yamlPath).Load()
+	if err != nil {
+		return "", err
+	}
+	if config == nil {
+		return "", fmt.Errorf("%s not found", yamlPath)
+	}
+	if NeedsMigration(config) {
+		if err := MigrateConfig(config); err != nil {
+			return "", fmt.Errorf("failed to migrate config: %w", err)
+		}
+	}
+
+	storage, err := OpenSQLiteStorage(dbPath)
+	if err != nil {
+		return "", err
+	}
+	if err := storage.Save(config); err != nil {
+		storage.Close()
+		removeSQLiteFiles(dbPath)
+		return "", err
+	}
+	storage.Close()
+
+	backupPath := yamlPath + ".bak"
+	if err := os.Rename(yamlPath, backupPath); err != nil {
+		removeSQLiteFiles(dbPath)
+		return "", fmt.Errorf("failed to back up %s: %w", yamlPath, err)
+	}
+	return dbPath, nil
+}
+
+// removeSQLiteFiles 删除数据库及其 WAL 辅助文件
+func removeSQLiteFiles(dbPath string) {
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		os.Remove(dbPath + suffix)
+	}
+}
+
+// SnapshotSQLite 把数据库（包括尚未检查点的 WAL）的一致快照写入 dst，web 服务运行中也可以调用
+func SnapshotSQLite(dbPath, dst string) error {
+	db, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return fmt.Errorf("failed to open config database: %w", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`VACUUM INTO ?`, dst); err != nil {
+		return fmt.Errorf("failed to snapshot config database: %w", err)
+	}
+	return nil
+}
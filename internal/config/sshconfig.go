@@ -0,0 +1,295 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// sshConfigBlock ~/.ssh/config 中的一个 Host 块
+type sshConfigBlock struct {
+	patterns []string
+	options  map[string]string // 小写的选项名 -> 块内第一次出现的值
+}
+
+// matches 别名是否匹配块的模式，! 开头的模式匹配时排除
+func (b *sshConfigBlock) matches(alias string) bool {
+	matched := false
+	for _, p := range b.patterns {
+		negate := strings.HasPrefix(p, "!")
+		if ok, _ := path.Match(strings.TrimPrefix(p, "!"), alias); ok {
+			if negate {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// DefaultSSHConfigPath 当前用户的 OpenSSH 客户端配置路径（~/.ssh/config）
+func DefaultSSHConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "config")
+}
+
+// ParseSSHConfig 把 OpenSSH 客户端配置中每个不含通配符的 Host 别名转换为服务器。
+// 与 ssh 一样按顺序取每个选项第一次匹配的值，因此 Host * 中的默认值也会生效；
+// 支持 HostName、User、Port、IdentityFile、ProxyJump 和 StrictHostKeyChecking，Match 块和 Include 忽略。没有 User 的别名跳过。
+// ProxyJump a,b 转换为网关链：服务器的网关为 b，b 没有自己的网关时以 a 为网关；
+// 不是别名的跳板（如 ops@10.0.0.1:2222）在能确定登录用户时作为新服务器加入，网关均按名称引用
+func ParseSSHConfig(r io.Reader) ([]*types.Hop, error) {
+	var blocks []*sshConfigBlock
+	var current *sshConfigBlock
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := splitSSHOption(line)
+		if !ok {
+			return nil, fmt.Errorf("ssh config line %d: missing value", lineNo)
+		}
+		switch key {
+		case "host":
+			current = &sshConfigBlock{patterns: strings.Fields(value), options: make(map[string]string)}
+			blocks = append(blocks, current)
+		case "match":
+			// 条件块无法静态求值，其中的选项不参与
+			current = &sshConfigBlock{options: make(map[string]string)}
+		default:
+			if current == nil {
+				// 第一个 Host 之前的选项对所有主机生效
+				current = &sshConfigBlock{patterns: []string{"*"}, options: make(map[string]string)}
+				blocks = append(blocks, current)
+			}
+			if _, exists := current.options[key]; !exists {
+				current.options[key] = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var hops []*types.Hop
+	byName := make(map[string]*types.Hop)
+	chains := make(map[*types.Hop][]sshJump)
+	seen := make(map[string]bool)
+	for _, block := range blocks {
+		for _, alias := range block.patterns {
+			if strings.ContainsAny(alias, "*?!") || seen[alias] {
+				continue
+			}
+			seen[alias] = true
+			if hop, chain := sshConfigHop(sshConfigOptions(blocks, alias), alias); hop != nil {
+				hops = append(hops, hop)
+				byName[alias] = hop
+				chains[hop] = chain
+			}
+		}
+	}
+
+	// 跳板机加入后也要解析它自己的 ProxyJump（如 Host *.corp 的默认跳板），hops 在循环中增长
+	for i := 0; i < len(hops); i++ {
+		hop := hops[i]
+		prev := ""
+		for _, jump := range chains[hop] {
+			gateway := byName[jump.host]
+			if gateway == nil && !seen[jump.host] {
+				seen[jump.host] = true
+				options := sshConfigOptions(blocks, jump.host)
+				if jump.user != "" {
+					options["user"] = jump.user
+				}
+				if jump.port != "" {
+					options["port"] = jump.port
+				}
+				var chain []sshJump
+				if gateway, chain = sshConfigHop(options, jump.host); gateway != nil {
+					hops = append(hops, gateway)
+					byName[jump.host] = gateway
+					chains[gateway] = chain
+				}
+			}
+			name := jump.host
+			if gateway != nil {
+				// 链中前一跳成为这一跳的网关，除非它已有网关或会形成环
+				if prev != "" && gateway.Gateway == "" && len(chains[gateway]) == 0 && !reachesVia(byName, prev, name) {
+					gateway.Gateway = prev
+					gateway.ServerType = types.ServerInternal
+				}
+				name = gateway.Name
+			}
+			prev = name
+		}
+		if prev != "" && prev != hop.Name {
+			hop.Gateway = prev
+			hop.ServerType = types.ServerInternal
+		}
+	}
+	return hops, nil
+}
+
+// sshJump ProxyJump 中的一跳 [user@]host[:port]
+type sshJump struct {
+	user, host, port string
+}
+
+// parseProxyJump 拆分逗号分隔的 ProxyJump，none 表示不使用跳板
+func parseProxyJump(value string) []sshJump {
+	if value == "" || strings.EqualFold(value, "none") {
+		return nil
+	}
+	var jumps []sshJump
+	for _, spec := range strings.Split(value, ",") {
+		spec = strings.TrimSpace(spec)
+		spec = strings.TrimPrefix(spec, "ssh://")
+		var jump sshJump
+		if user, host, found := strings.Cut(spec, "@"); found {
+			jump.user, spec = user, host
+		}
+		if host, port, err := net.SplitHostPort(spec); err == nil {
+			jump.host, jump.port = host, port
+		} else {
+			jump.host = spec
+		}
+		if jump.host != "" {
+			jumps = append(jumps, jump)
+		}
+	}
+	return jumps
+}
+
+// reachesVia 从 name 沿网关名称向上是否会到达 target
+func reachesVia(byName map[string]*types.Hop, name, target string) bool {
+	for steps := 0; name != "" && steps <= len(byName); steps++ {
+		if name == target {
+			return true
+		}
+		hop := byName[name]
+		if hop == nil {
+			return false
+		}
+		name = hop.Gateway
+	}
+	return false
+}
+
+// sshConfigOptions 按 ssh 的规则合并所有匹配 alias 的块：每个选项取第一次出现的值
+func sshConfigOptions(blocks []*sshConfigBlock, alias string) map[string]string {
+	options := make(map[string]string)
+	for _, block := range blocks {
+		if !block.matches(alias) {
+			continue
+		}
+		for key, value := range block.options {
+			if _, exists := options[key]; !exists {
+				options[key] = value
+			}
+		}
+	}
+	return options
+}
+
+// sshConfigHop 由合并后的选项生成服务器和它的 ProxyJump 链，没有 User 时返回 nil
+func sshConfigHop(options map[string]string, alias string) (*types.Hop, []sshJump) {
+	if options["user"] == "" {
+		return nil, nil
+	}
+
+	hop := &types.Hop{
+		Name:       alias,
+		Host:       alias,
+		Port:       22,
+		User:       options["user"],
+		AuthType:   types.AuthKey,
+		KeyPath:    "~/.ssh/id_rsa",
+		ServerType: types.ServerExternal,
+	}
+	if hostName := options["hostname"]; hostName != "" {
+		hop.Host = strings.ReplaceAll(hostName, "%h", alias)
+	}
+	if port, err := strconv.Atoi(options["port"]); err == nil && port > 0 {
+		hop.Port = port
+	}
+	if identity := options["identityfile"]; identity != "" {
+		hop.KeyPath = identity
+	}
+	switch strings.ToLower(options["stricthostkeychecking"]) {
+	case "yes", "ask":
+		hop.HostKeyPolicy = types.HostKeyStrict
+	case "no", "off":
+		hop.HostKeyPolicy = types.HostKeyOff
+	}
+	return hop, parseProxyJump(options["proxyjump"])
+}
+
+// splitSSHOption 拆分 "Key value"、"Key=value" 形式的一行，键转为小写，去掉值两端的引号
+func splitSSHOption(line string) (string, string, bool) {
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return "", "", false
+	}
+	key := strings.ToLower(line[:i])
+	value := strings.TrimLeft(line[i:], " \t")
+	value = strings.TrimPrefix(value, "=")
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	return key, value, value != ""
+}
+
+// ReadSSHConfigFile 读取并解析 OpenSSH 配置，path 为空时使用 ~/.ssh/config，返回实际读取的路径
+func ReadSSHConfigFile(path string) ([]*types.Hop, string, error) {
+	if path == "" {
+		path = DefaultSSHConfigPath()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, path, err
+	}
+	defer f.Close()
+	hops, err := ParseSSHConfig(f)
+	if err != nil {
+		return nil, path, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return hops, path, nil
+}
+
+// SelectSSHHosts 从解析结果中选出 names 指定的主机及它们网关链上的主机，names 为空时返回全部
+func SelectSSHHosts(hops []*types.Hop, names []string) ([]*types.Hop, error) {
+	if len(names) == 0 {
+		return hops, nil
+	}
+	byName := make(map[string]*types.Hop, len(hops))
+	for _, hop := range hops {
+		byName[hop.Name] = hop
+	}
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		if byName[name] == nil {
+			return nil, fmt.Errorf("host %q not found in ssh config", name)
+		}
+		for hop := byName[name]; hop != nil && !wanted[hop.Name]; hop = byName[hop.Gateway] {
+			wanted[hop.Name] = true
+		}
+	}
+	var selected []*types.Hop
+	for _, hop := range hops {
+		if wanted[hop.Name] {
+			selected = append(selected, hop)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const testSSHConfig = `
+# 个人配置
+Host bastion
+    HostName 203.0.113.10
+    User ops
+    Port 2222
+    StrictHostKeyChecking yes
+
+Host db web
+    ProxyJump ops@bastion:2222
+    IdentityFile ~/.ssh/id_ed25519
+
+Host web
+    HostName 10.0.0.8
+    User deploy
+
+Host *.corp !skip.corp
+    User corp
+
+Match host db
+    User ignored
+
+Host nouser
+
+Host *
+    User=root
+    IdentityFile "~/.ssh/id_rsa"
+`
+
+func TestParseSSHConfig(t *testing.T) {
+	hops, err := ParseSSHConfig(strings.NewReader(testSSHConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*types.Hop)
+	for _, hop := range hops {
+		byName[hop.Name] = hop
+	}
+	if len(hops) != 4 {
+		t.Fatalf("got %d hops, want 4 (wildcards skipped): %v", len(hops), byName)
+	}
+
+	tests := []struct {
+		name, host, user, key, gateway string
+		port                           int
+	}{
+		{"bastion", "203.0.113.10", "ops", "~/.ssh/id_rsa", "", 2222},
+		{"db", "db", "root", "~/.ssh/id_ed25519", "bastion", 22},
+		{"web", "10.0.0.8", "deploy", "~/.ssh/id_ed25519", "bastion", 22},
+		// Host * 中的 User 同样生效
+		{"nouser", "nouser", "root", "~/.ssh/id_rsa", "", 22},
+	}
+	for _, tt := range tests {
+		hop := byName[tt.name]
+		if hop == nil {
+			t.Errorf("%s missing", tt.name)
+			continue
+		}
+		if hop.Host != tt.host || hop.User != tt.user || hop.KeyPath != tt.key || hop.Gateway != tt.gateway || hop.Port != tt.port {
+			t.Errorf("%s = %+v, want %+v", tt.name, hop, tt)
+		}
+		if (hop.Gateway != "") != (hop.ServerType == types.ServerInternal) {
+			t.Errorf("%s: server type %v does not match gateway %q", tt.name, hop.ServerType, hop.Gateway)
+		}
+	}
+
+	if byName["bastion"].HostKeyPolicy != types.HostKeyStrict || byName["web"].HostKeyPolicy != "" {
+		t.Errorf("StrictHostKeyChecking: bastion %q, web %q", byName["bastion"].HostKeyPolicy, byName["web"].HostKeyPolicy)
+	}
+
+	if _, err := ParseSSHConfig(strings.NewReader("Host\n")); err == nil {
+		t.Error("expected an error for a Host line without patterns")
+	}
+}
+
+func TestImportHops(t *testing.T) {
+	mgr := newTrashTestManager(t)
+	hops, _ := ParseSSHConfig(strings.NewReader(`
+Host web
+    User deploy
+    ProxyJump jump
+Host jump
+    User ops
+Host bastion
+    User root
+Host lost
+    User root
+    ProxyJump nowhere
+`))
+
+	added, err := mgr.ImportHops(hops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bastion 已存在，跳过
+	if len(added) != 3 {
+		t.Fatalf("added %d hops, want 3", len(added))
+	}
+	web, jump, lost := mgr.config.GetHopByName("web"), mgr.config.GetHopByName("jump"), mgr.config.GetHopByName("lost")
+	if web.GatewayID != jump.ID || web.Gateway != "" || web.ServerType != types.ServerInternal {
+		t.Errorf("web gateway not resolved: %+v", web)
+	}
+	if lost.Gateway != "" || lost.GatewayID != "" || lost.ServerType != types.ServerExternal {
+		t.Errorf("unknown gateway should fall back to an external server: %+v", lost)
+	}
+	if err := mgr.Validate(); err != nil {
+		t.Errorf("config invalid after import: %v", err)
+	}
+}
+
+func TestParseSSHConfigProxyJumpChain(t *testing.T) {
+	hops, err := ParseSSHConfig(strings.NewReader(`
+Host app
+    User deploy
+    ProxyJump edge,ops@10.0.0.1:2200
+Host edge
+    HostName 198.51.100.7
+    User root
+Host other
+    User deploy
+    ProxyJump 10.0.0.1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*types.Hop)
+	for _, hop := range hops {
+		byName[hop.Name] = hop
+	}
+	// 不是别名的跳板作为新服务器加入，链中前一跳成为它的网关
+	inner := byName["10.0.0.1"]
+	if inner == nil || inner.User != "ops" || inner.Port != 2200 || inner.Gateway != "edge" {
+		t.Fatalf("inner jump host = %+v", inner)
+	}
+	if app := byName["app"]; app.Gateway != "10.0.0.1" || app.ServerType != types.ServerInternal {
+		t.Errorf("app = %+v, want gateway 10.0.0.1", app)
+	}
+	if byName["other"].Gateway != "10.0.0.1" || byName["edge"].Gateway != "" {
+		t.Errorf("other %q, edge %q", byName["other"].Gateway, byName["edge"].Gateway)
+	}
+
+	selected, err := SelectSSHHosts(hops, []string{"app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != 3 {
+		t.Errorf("selected %d hosts, want app and its two gateways", len(selected))
+	}
+	if _, err := SelectSSHHosts(hops, []string{"missing"}); err == nil {
+		t.Error("expected an error for an unknown alias")
+	}
+}
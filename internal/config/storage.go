@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Storage 配置持久化后端
+type Storage interface {
+	// Load 读取配置，配置尚不存在时返回 (nil, nil)
+	Load() (*types.Config, error)
+	// Save 原子地写入完整配置
+	Save(cfg *types.Config) error
+	// Path 存储文件路径
+	Path() string
+	// Close 释放底层资源
+	Close() error
+}
+
+// openStorage 选择配置目录下的存储后端：存在 config.db 时使用 SQLite，否则使用 YAML（默认）
+func openStorage(configDir string) (Storage, error) {
+	dbPath := filepath.Join(configDir, SQLiteFileName)
+	if _, err := os.Stat(dbPath); err == nil {
+		return OpenSQLiteStorage(dbPath)
+	}
+	return NewYAMLStorage(filepath.Join(configDir, ConfigFileName)), nil
+}
+
+// YAMLStorage YAML 文件存储：config.yaml 只保存拓扑，凭据加密保存在同目录的 secrets.enc
+type YAMLStorage struct {
+	path        string
+	secretsPath string
+	box         *secretBox
+}
+
+// NewYAMLStorage 创建 YAML 存储
+func NewYAMLStorage(path string) *YAMLStorage {
+	dir := filepath.Dir(path)
+	return &YAMLStorage{
+		path:        path,
+		secretsPath: filepath.Join(dir, SecretsFileName),
+		box:         newSecretBox(dir),
+	}
+}
+
+// Load 读取 YAML 拓扑并合并本地凭据
+func (s *YAMLStorage) Load() (*types.Config, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var config types.Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	sealed, err := os.ReadFile(s.secretsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read secrets: %w", err)
+	}
+	if err == nil {
+		secrets, err := s.box.open(sealed)
+		if err != nil {
+			return nil, err
+		}
+		mergeSecrets(&config, secrets)
+	}
+	return &config, nil
+}
+
+// Save 分别写入凭据和拓扑（先写凭据，避免中途失败后拓扑中的凭据已被剥离）
+func (s *YAMLStorage) Save(cfg *types.Config) error {
+	topology, secrets := splitSecrets(cfg)
+
+	sealed, err := s.box.seal(secrets)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.secretsPath, sealed); err != nil {
+		return fmt.Errorf("failed to write secrets: %w", err)
+	}
+
+	data, err := yaml.Marshal(topology)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	ensureGitignore(filepath.Dir(s.path))
+	return nil
+}
+
+// writeFileAtomic 先写临时文件再重命名，避免留下写了一半的文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Path 返回 YAML 文件路径
+func (s *YAMLStorage) Path() string {
+	return s.path
+}
+
+// Close YAML 存储无需释放资源
+func (s *YAMLStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,350 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// testConfig 构造覆盖各个表和全局设置的配置
+func testConfig() *types.Config {
+	return &types.Config{
+		Version: types.ConfigVersion3,
+		Hops: []*types.Hop{
+			{ID: "hop-1", Name: "bastion", Host: "1.2.3.4", Port: 22, User: "root", AuthType: types.AuthPassword, Password: "secret"},
+			{ID: "hop-2", Name: "internal", Host: "10.0.0.2", Port: 22, User: "admin", ServerType: types.ServerInternal, GatewayID: "hop-1"},
+		},
+		Routes: []*types.RoutePreference{
+			{FromID: "hop-1", ToID: "hop-2", Threshold: 50},
+		},
+		Profiles: []*types.Profile{
+			{ID: "profile-1", Name: "deploy", PathIDs: []string{"hop-1", "hop-2"}},
+		},
+		Portal: types.PortalConfig{
+			Client: types.PortalClientConfig{
+				Mappings: []types.PortMapping{
+					{ID: "m-2", Name: "db", LocalAddr: ":3306", RemoteHost: "10.0.0.3", RemotePort: 3306, Via: []string{"hop-1"}, Protocol: types.PortalProtocolTCP, Enabled: true},
+					{ID: "m-1", Name: "web", LocalAddr: ":8080", RemoteHost: "10.0.0.4", RemotePort: 80, Via: []string{"hop-1"}, Protocol: types.PortalProtocolTCP},
+				},
+			},
+		},
+		Web: types.WebConfig{
+			Users: []*types.WebUser{{Name: "alice", Token: "alice-token", Role: types.WebRoleAdmin}},
+		},
+	}
+}
+
+func TestSQLiteStorageRoundTrip(t *testing.T) {
+	storage, err := OpenSQLiteStorage(filepath.Join(t.TempDir(), SQLiteFileName))
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	defer storage.Close()
+
+	loaded, err := storage.Load()
+	if err != nil || loaded != nil {
+		t.Fatalf("expected empty storage, got %+v, %v", loaded, err)
+	}
+
+	want := testConfig()
+	if err := storage.Save(want); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// 再次保存删减后的配置，确认不会残留旧行
+	want.Hops = want.Hops[:1]
+	want.Routes = []*types.RoutePreference{}
+	if err := storage.Save(want); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	got, err := storage.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip mismatch:\n got  %+v\n want %+v", got, want)
+	}
+	if got.Hops[0].Password != "secret" || got.Web.Users[0].Token != "alice-token" {
+		t.Error("secrets were not persisted")
+	}
+}
+
+func TestSQLiteStorageRejectsDuplicateIDs(t *testing.T) {
+	storage, err := OpenSQLiteStorage(filepath.Join(t.TempDir(), SQLiteFileName))
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	defer storage.Close()
+
+	if err := storage.Save(testConfig()); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	bad := testConfig()
+	bad.Hops[1].ID = bad.Hops[0].ID
+	if err := storage.Save(bad); err == nil {
+		t.Fatal("expected duplicate hop IDs to be rejected")
+	}
+
+	// 失败的保存不应影响已有数据
+	got, err := storage.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(got.Hops) != 2 || got.Hops[1].ID != "hop-2" {
+		t.Errorf("failed save was not rolled back: %+v", got.Hops)
+	}
+}
+
+func TestSQLiteStorageConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SQLiteFileName)
+	first, err := OpenSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	defer first.Close()
+	if err := first.Save(testConfig()); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	second, err := OpenSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	defer second.Close()
+
+	// 两个句柄都基于同一份配置各自添加一台服务器
+	a, err := first.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	b, err := second.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	a.Hops = append(a.Hops, &types.Hop{ID: "hop-a", Name: "a", Host: "10.0.0.10", Port: 22, User: "root", AuthType: types.AuthPassword, Password: "pass-a"})
+	b.Hops = append(b.Hops, &types.Hop{ID: "hop-b", Name: "b", Host: "10.0.0.11", Port: 22, User: "root", AuthType: types.AuthPassword, Password: "pass-b"})
+	b.Hops[0].Name = "bastion-renamed"
+
+	if err := first.Save(a); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := second.Save(b); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	got, err := first.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	passwords := make(map[string]string)
+	for _, hop := range got.Hops {
+		passwords[hop.ID] = hop.Password
+	}
+	want := map[string]string{"hop-1": "secret", "hop-2": "", "hop-a": "pass-a", "hop-b": "pass-b"}
+	if !reflect.DeepEqual(passwords, want) {
+		t.Errorf("hops = %v, want %v", passwords, want)
+	}
+	if got.Hops[0].Name != "bastion-renamed" {
+		t.Errorf("hop-1 name = %q, want bastion-renamed", got.Hops[0].Name)
+	}
+
+	// 删除只影响本句柄读到过的记录
+	got.Hops = got.Hops[:1]
+	if err := first.Save(got); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if reloaded, err := second.Load(); err != nil || len(reloaded.Hops) != 1 {
+		t.Fatalf("expected removed hops to be deleted, got %+v, %v", reloaded, err)
+	}
+}
+
+func TestMigrateToSQLite(t *testing.T) {
+	configDir := t.TempDir()
+	want := testConfig()
+	if err := NewYAMLStorage(filepath.Join(configDir, ConfigFileName)).Save(want); err != nil {
+		t.Fatalf("failed to write yaml: %v", err)
+	}
+
+	dbPath, err := MigrateToSQLite(configDir)
+	if err != nil {
+		t.Fatalf("MigrateToSQLite failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(configDir, ConfigFileName)); !os.IsNotExist(err) {
+		t.Error("config.yaml should be moved aside after migration")
+	}
+	if _, err := os.Stat(filepath.Join(configDir, ConfigFileName+".bak")); err != nil {
+		t.Errorf("expected yaml backup: %v", err)
+	}
+
+	storage, err := openStorage(configDir)
+	if err != nil {
+		t.Fatalf("openStorage failed: %v", err)
+	}
+	defer storage.Close()
+	if storage.Path() != dbPath {
+		t.Fatalf("expected sqlite storage to be selected, got %s", storage.Path())
+	}
+
+	got, err := storage.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("migrated config mismatch:\n got  %+v\n want %+v", got, want)
+	}
+
+	if _, err := MigrateToSQLite(configDir); err == nil {
+		t.Error("expected second migration to fail")
+	}
+}
+
+func TestYAMLStorageSeparatesSecrets(t *testing.T) {
+	configDir := t.TempDir()
+	storage := NewYAMLStorage(filepath.Join(configDir, ConfigFileName))
+
+	cfg := testConfig()
+	cfg.Hops[1].KeyPassphrase = "key-passphrase"
+	cfg.Agents.Tokens = []string{"agent-token"}
+	cfg.Portal.Server.AuthTokens = []types.PortalTokenConfig{{Token: "portal-token", AllowedRemotes: []string{"10.0.0.0/8"}, MaxMappings: 5}}
+	if err := storage.Save(cfg); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	secretValues := []string{"secret", "key-passphrase", "alice-token", "agent-token", "portal-token"}
+	for _, name := range []string{ConfigFileName, SecretsFileName} {
+		data, err := os.ReadFile(filepath.Join(configDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		for _, secret := range secretValues {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s contains plaintext secret %q", name, secret)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(configDir, ".gitignore")); err != nil {
+		t.Errorf("expected .gitignore in config dir: %v", err)
+	}
+
+	got, err := storage.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, cfg) {
+		t.Errorf("round trip mismatch:\n got  %+v\n want %+v", got, cfg)
+	}
+
+	// 同事只拿到拓扑文件：能加载，但没有凭据
+	shared := t.TempDir()
+	data, _ := os.ReadFile(filepath.Join(configDir, ConfigFileName))
+	os.WriteFile(filepath.Join(shared, ConfigFileName), data, 0600)
+	topology, err := NewYAMLStorage(filepath.Join(shared, ConfigFileName)).Load()
+	if err != nil {
+		t.Fatalf("Load of shared topology failed: %v", err)
+	}
+	if len(topology.Hops) != 2 || topology.Hops[0].Password != "" || topology.Web.Users[0].Token != "" {
+		t.Errorf("unexpected shared topology: %+v", topology.Hops[0])
+	}
+
+	// 密钥丢失时无法解密
+	os.Remove(filepath.Join(configDir, SecretKeyFileName))
+	if _, err := storage.Load(); err == nil {
+		t.Error("expected Load to fail without the secret key")
+	}
+}
+
+func TestManagerMigratesV2Secrets(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	v2 := `version: 2
+hops:
+  - id: hop-1
+    name: bastion
+    host: 1.2.3.4
+    port: 22
+    user: root
+    auth: 1
+    password: hunter2
+`
+	configDir := filepath.Join(home, ConfigDirName)
+	os.MkdirAll(configDir, 0700)
+	if err := os.WriteFile(filepath.Join(configDir, ConfigFileName), []byte(v2), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	mgr, err := NewManager()
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	cfg, err := mgr.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Version != types.ConfigVersion3 {
+		t.Errorf("expected version %d, got %d", types.ConfigVersion3, cfg.Version)
+	}
+	if cfg.Hops[0].Password != "hunter2" {
+		t.Errorf("password lost in migration: %q", cfg.Hops[0].Password)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(configDir, ConfigFileName))
+	if strings.Contains(string(data), "hunter2") {
+		t.Error("config.yaml still contains the password after migration")
+	}
+}
+
+func TestRecordHealthChecks(t *testing.T) {
+	mgr := newTrashTestManager(t)
+
+	checkedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := mgr.RecordHealthChecks(map[string]types.HealthCheck{
+		"hop-1":   {CheckedAt: checkedAt, OK: true, LatencyMs: 42, AuthMethod: "password"},
+		"hop-2":   {CheckedAt: checkedAt, Stage: "auth", FailedHop: "internal", Error: "unable to authenticate"},
+		"deleted": {CheckedAt: checkedAt, OK: true},
+	})
+	if err != nil {
+		t.Fatalf("RecordHealthChecks failed: %v", err)
+	}
+
+	// 重新加载，确认结果已保存
+	cfg, err := mgr.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	first, second := cfg.GetHopByID("hop-1").LastCheck, cfg.GetHopByID("hop-2").LastCheck
+	if first == nil || !first.OK || first.LatencyMs != 42 || !first.CheckedAt.Equal(checkedAt) {
+		t.Errorf("hop-1 last check = %+v", first)
+	}
+	if second == nil || second.OK || second.Stage != "auth" {
+		t.Errorf("hop-2 last check = %+v", second)
+	}
+}
+
+func TestSetKeyAuth(t *testing.T) {
+	mgr := newTrashTestManager(t)
+
+	if err := mgr.SetKeyAuth([]string{"hop-1", "deleted"}, "~/.ssh/hssh_new"); err != nil {
+		t.Fatalf("SetKeyAuth failed: %v", err)
+	}
+
+	cfg, err := mgr.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	hop := cfg.GetHopByID("hop-1")
+	if hop.AuthType != types.AuthKey || hop.KeyPath != "~/.ssh/hssh_new" || hop.Password != "" {
+		t.Errorf("hop-1 auth = %v %q %q", hop.AuthType, hop.KeyPath, hop.Password)
+	}
+	if other := cfg.GetHopByID("hop-2"); other.KeyPath != "" {
+		t.Errorf("hop-2 should not change: %+v", other)
+	}
+}
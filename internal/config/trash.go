@@ -0,0 +1,154 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// DefaultTrashRetention 回收站默认保留时间
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// ErrNotInTrash 回收站中没有该服务器
+var ErrNotInTrash = errors.New("not found in trash")
+
+// DependentsError 服务器仍被其他配置引用，不能删除
+type DependentsError struct {
+	Hop        string
+	Dependents []string
+}
+
+func (e *DependentsError) Error() string {
+	return fmt.Sprintf("cannot delete '%s': still referenced by %s", e.Hop, strings.Join(e.Dependents, ", "))
+}
+
+// HopDependents 列出引用指定服务器的网关、路由偏好、预设和端口映射
+// 同时检查 ID 和旧版按名称引用的字段
+func HopDependents(cfg *types.Config, hop *types.Hop) []string {
+	refers := func(ref string) bool {
+		return ref != "" && (ref == hop.ID || ref == hop.Name)
+	}
+
+	var dependents []string
+	for _, h := range cfg.Hops {
+		if h.ID != hop.ID && (h.GatewayID == hop.ID || refers(h.Gateway)) {
+			dependents = append(dependents, "server '"+h.Name+"' (gateway)")
+		}
+	}
+	for _, route := range cfg.Routes {
+		if refers(route.FromID) || refers(route.ToID) || refers(route.ViaID) ||
+			refers(route.From) || refers(route.To) || refers(route.Via) {
+			dependents = append(dependents, "route "+firstNonEmpty(route.FromID, route.From)+" -> "+firstNonEmpty(route.ToID, route.To))
+		}
+	}
+	for _, profile := range cfg.Profiles {
+		for _, ref := range append(append([]string(nil), profile.PathIDs...), profile.Path...) {
+			if refers(ref) {
+				dependents = append(dependents, "profile '"+profile.Name+"'")
+				break
+			}
+		}
+	}
+	for _, mapping := range cfg.Portal.Client.Mappings {
+		for _, ref := range mapping.Via {
+			if refers(ref) {
+				dependents = append(dependents, "portal mapping '"+mapping.Name+"'")
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// TrashRetention 回收站保留时间（trash_retention_days，默认 30 天）
+func (m *Manager) TrashRetention() time.Duration {
+	if days := m.config.TrashRetentionDays; days > 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	return DefaultTrashRetention
+}
+
+// Trash 返回回收站中的服务器（最近删除的在前），已过期的会先被清除
+func (m *Manager) Trash() []*types.TrashedHop {
+	if m.purgeExpiredTrash(time.Now()) {
+		if err := m.Save(); err != nil {
+			log.Printf("[Config] Warning: failed to save after purging trash: %v", err)
+		}
+	}
+	items := make([]*types.TrashedHop, len(m.config.Trash))
+	for i, item := range m.config.Trash {
+		items[len(items)-1-i] = item
+	}
+	return items
+}
+
+// purgeExpiredTrash 清除超过保留时间的条目，返回是否有变化
+func (m *Manager) purgeExpiredTrash(now time.Time) bool {
+	cutoff := now.Add(-m.TrashRetention())
+	kept := m.config.Trash[:0]
+	for _, item := range m.config.Trash {
+		if item.DeletedAt.After(cutoff) {
+			kept = append(kept, item)
+		}
+	}
+	changed := len(kept) != len(m.config.Trash)
+	for i := len(kept); i < len(m.config.Trash); i++ {
+		m.config.Trash[i] = nil
+	}
+	m.config.Trash = kept
+	return changed
+}
+
+// trashHop 把服务器移入回收站
+func (m *Manager) trashHop(index int) error {
+	hop := m.config.Hops[index]
+	if dependents := HopDependents(m.config, hop); len(dependents) > 0 {
+		return &DependentsError{Hop: hop.Name, Dependents: dependents}
+	}
+
+	m.config.Hops = append(m.config.Hops[:index], m.config.Hops[index+1:]...)
+	m.config.Trash = append(m.config.Trash, &types.TrashedHop{Hop: hop, DeletedAt: time.Now()})
+	m.purgeExpiredTrash(time.Now())
+	return m.Save()
+}
+
+// RestoreHop 从回收站恢复服务器
+func (m *Manager) RestoreHop(id string) (*types.Hop, error) {
+	for i, item := range m.config.Trash {
+		if item.Hop.ID != id {
+			continue
+		}
+		if m.config.GetHopByID(id) != nil {
+			return nil, fmt.Errorf("hop with id '%s' %w", id, ErrExists)
+		}
+		m.config.Trash = append(m.config.Trash[:i], m.config.Trash[i+1:]...)
+		m.config.Hops = append(m.config.Hops, item.Hop)
+		return item.Hop, m.Save()
+	}
+	return nil, fmt.Errorf("hop with id '%s': %w", id, ErrNotInTrash)
+}
+
+// PurgeHop 从回收站永久删除服务器
+func (m *Manager) PurgeHop(id string) error {
+	for i, item := range m.config.Trash {
+		if item.Hop.ID == id {
+			m.config.Trash = append(m.config.Trash[:i], m.config.Trash[i+1:]...)
+			return m.Save()
+		}
+	}
+	return fmt.Errorf("hop with id '%s': %w", id, ErrNotInTrash)
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// newTrashTestManager 在临时 HOME 下创建使用 testConfig 的配置管理器
+func newTrashTestManager(t *testing.T) *Manager {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	mgr, err := NewManager()
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	t.Cleanup(func() { mgr.Close() })
+	if _, err := mgr.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	mgr.config = testConfig()
+	if err := mgr.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	return mgr
+}
+
+func TestHopDependents(t *testing.T) {
+	cfg := testConfig()
+	cfg.Routes = append(cfg.Routes, &types.RoutePreference{From: "local", To: "internal", Via: "bastion"})
+
+	got := HopDependents(cfg, cfg.Hops[0])
+	want := []string{
+		"server 'internal' (gateway)",
+		"route hop-1 -> hop-2",
+		"route local -> internal",
+		"profile 'deploy'",
+		"portal mapping 'db'",
+		"portal mapping 'web'",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("dependents = %q, want %q", got, want)
+	}
+
+	if got := HopDependents(&types.Config{Hops: cfg.Hops}, cfg.Hops[1]); len(got) != 0 {
+		t.Errorf("unreferenced hop has dependents: %q", got)
+	}
+}
+
+func TestDeleteHopBlockedByDependents(t *testing.T) {
+	mgr := newTrashTestManager(t)
+
+	err := mgr.DeleteHop("hop-1")
+	var dependents *DependentsError
+	if !errors.As(err, &dependents) {
+		t.Fatalf("expected DependentsError, got %v", err)
+	}
+	if len(dependents.Dependents) == 0 || !strings.Contains(err.Error(), "profile 'deploy'") {
+		t.Errorf("error does not list dependents: %v", err)
+	}
+	if mgr.config.GetHopByID("hop-1") == nil || len(mgr.config.Trash) != 0 {
+		t.Error("blocked delete must not modify the config")
+	}
+}
+
+func TestDeleteHopMovesToTrash(t *testing.T) {
+	mgr := newTrashTestManager(t)
+	mgr.config.Routes = nil
+	mgr.config.Profiles = nil
+
+	if err := mgr.DeleteHopByName("internal"); err != nil {
+		t.Fatalf("DeleteHopByName failed: %v", err)
+	}
+	if mgr.config.GetHopByID("hop-2") != nil {
+		t.Fatal("hop still listed after delete")
+	}
+	trash := mgr.Trash()
+	if len(trash) != 1 || trash[0].Hop.ID != "hop-2" {
+		t.Fatalf("unexpected trash: %+v", trash)
+	}
+
+	if _, err := mgr.RestoreHop("missing"); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("expected ErrNotInTrash, got %v", err)
+	}
+	hop, err := mgr.RestoreHop("hop-2")
+	if err != nil {
+		t.Fatalf("RestoreHop failed: %v", err)
+	}
+	if hop.GatewayID != "hop-1" || mgr.config.GetHopByID("hop-2") == nil || len(mgr.Trash()) != 0 {
+		t.Errorf("hop not restored: %+v", hop)
+	}
+}
+
+func TestTrashKeepsSecretsOutOfConfigFile(t *testing.T) {
+	mgr := newTrashTestManager(t)
+	mgr.config.Hops[1].GatewayID = ""
+	mgr.config.Routes = nil
+	mgr.config.Profiles = nil
+	mgr.config.Portal.Client.Mappings = nil
+
+	if err := mgr.DeleteHop("hop-1"); err != nil {
+		t.Fatalf("DeleteHop failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(os.Getenv("HOME"), ConfigDirName, ConfigFileName))
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Error("config.yaml contains the trashed hop's password")
+	}
+
+	// 重新加载后回收站中的密码仍可恢复
+	reloaded, err := NewManager()
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	defer reloaded.Close()
+	if _, err := reloaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	hop, err := reloaded.RestoreHop("hop-1")
+	if err != nil {
+		t.Fatalf("RestoreHop failed: %v", err)
+	}
+	if hop.Password != "secret" {
+		t.Errorf("password lost in trash: %q", hop.Password)
+	}
+}
+
+func TestTrashPurgesExpired(t *testing.T) {
+	mgr := newTrashTestManager(t)
+	mgr.config.TrashRetentionDays = 7
+	now := time.Now()
+	mgr.config.Trash = []*types.TrashedHop{
+		{Hop: &types.Hop{ID: "old", Name: "old"}, DeletedAt: now.Add(-8 * 24 * time.Hour)},
+		{Hop: &types.Hop{ID: "recent", Name: "recent"}, DeletedAt: now.Add(-time.Hour)},
+	}
+
+	trash := mgr.Trash()
+	if len(trash) != 1 || trash[0].Hop.ID != "recent" {
+		t.Fatalf("expected only the recent item, got %+v", trash)
+	}
+
+	if err := mgr.PurgeHop("recent"); err != nil {
+		t.Fatalf("PurgeHop failed: %v", err)
+	}
+	if err := mgr.PurgeHop("recent"); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("expected ErrNotInTrash, got %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+// Package events Web 服务内部的事件总线：任务创建和结束、终端会话打开、映射启动和探测结果在发生时发布，
+// 订阅者（进程内的处理函数或 plugins 中配置的插件）据此扩展行为，例如审批、计费和同步 CMDB。
+// 可拒绝的事件（task.created、session.opened）在操作开始前由 Check 发布，同步订阅者返回错误即拒绝；
+// 其他事件由 Publish 异步投递，不影响发布者
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	TaskCreated    = "task.created"    // 上传或打包下载任务即将开始，可拒绝
+	TaskCompleted  = "task.completed"  // 任务结束（成功、失败或取消）
+	SessionOpened  = "session.opened"  // 终端会话即将连接，可拒绝
+	MappingStarted = "mapping.started" // Portal 映射开始监听
+	ProbeResult    = "probe.result"    // 一次延迟探测的结果
+)
+
+// Types 全部事件类型
+var Types = []string{TaskCreated, TaskCompleted, SessionOpened, MappingStarted, ProbeResult}
+
+// defaultTimeout 订阅者处理单个事件的默认时间上限
+const defaultTimeout = 10 * time.Second
+
+// queueSize 每个异步订阅者可积压的事件数，队列满时丢弃新事件
+const queueSize = 256
+
+// Event 一个事件
+type Event struct {
+	Type      string                 `json:"type"`
+	Time      time.Time              `json:"time"`
+	RequestID string                 `json:"request_id,omitempty"`
+	User      string                 `json:"user,omitempty"`
+	Server    string                 `json:"server,omitempty"` // 目标服务器名称，未登记的目标为主机名
+	Target    string                 `json:"target,omitempty"` // 任务 ID、映射 ID、会话目标等
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// Handler 事件订阅者
+type Handler interface {
+	HandleEvent(ctx context.Context, event *Event) error
+}
+
+// HandlerFunc 把函数用作 Handler
+type HandlerFunc func(ctx context.Context, event *Event) error
+
+// HandleEvent 调用 f
+func (f HandlerFunc) HandleEvent(ctx context.Context, event *Event) error {
+	return f(ctx, event)
+}
+
+// Options 订阅选项
+type Options struct {
+	Name     string        // 用于日志和拒绝原因
+	Events   []string      // 订阅的事件类型，"task.*" 匹配一类，为空时订阅全部
+	Blocking bool          // 在 Check 中同步执行，返回错误即拒绝
+	Timeout  time.Duration // 默认 10 秒
+}
+
+// Rejection 同步订阅者拒绝了操作
+type Rejection struct {
+	Plugin string
+	Reason error
+}
+
+func (e *Rejection) Error() string {
+	return fmt.Sprintf("rejected by plugin '%s': %v", e.Plugin, e.Reason)
+}
+
+func (e *Rejection) Unwrap() error {
+	return e.Reason
+}
+
+// subscription 一个订阅者；异步投递经 queue 交给单独的 goroutine，同一订阅者按发布顺序收到事件
+type subscription struct {
+	opts    Options
+	handler Handler
+	queue   chan *Event
+}
+
+// Bus 事件总线，nil 的 *Bus 可以安全调用（不投递任何事件）
+type Bus struct {
+	mu     sync.RWMutex
+	subs   []*subscription
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// New 创建事件总线
+func New() *Bus {
+	return &Bus{}
+}
+
+// ValidPattern 检查订阅的事件类型：已知类型，或已知类型的前缀加 ".*"
+func ValidPattern(pattern string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, ".*"); ok {
+		return slices.ContainsFunc(Types, func(t string) bool { return strings.HasPrefix(t, prefix+".") })
+	}
+	return slices.Contains(Types, pattern)
+}
+
+// Subscribe 登记订阅者
+func (b *Bus) Subscribe(opts Options, handler Handler) error {
+	for _, pattern := range opts.Events {
+		if !ValidPattern(pattern) {
+			return fmt.Errorf("unknown event type %q (known: %s)", pattern, strings.Join(Types, ", "))
+		}
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	sub := &subscription{opts: opts, handler: handler, queue: make(chan *Event, queueSize)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return fmt.Errorf("event bus is closed")
+	}
+	b.subs = append(b.subs, sub)
+	b.wg.Add(1)
+	go b.deliver(sub)
+	return nil
+}
+
+// deliver 依次处理异步投递给 sub 的事件，直到 Close
+func (b *Bus) deliver(sub *subscription) {
+	defer b.wg.Done()
+	for event := range sub.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), sub.opts.Timeout)
+		if err := sub.handler.HandleEvent(ctx, event); err != nil {
+			log.Printf("[Events] Plugin %s failed on %s: %v", sub.opts.Name, event.Type, err)
+		}
+		cancel()
+	}
+}
+
+// matches 订阅者是否订阅了 eventType
+func (s *subscription) matches(eventType string) bool {
+	if len(s.opts.Events) == 0 {
+		return true
+	}
+	for _, pattern := range s.opts.Events {
+		if pattern == eventType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check 在可拒绝的操作开始前发布事件：同步订阅者依次执行，第一个返回错误（或超时）的拒绝操作，
+// 返回 *Rejection，此时事件不再投递给异步订阅者；全部通过后异步投递
+func (b *Bus) Check(ctx context.Context, event *Event) error {
+	if b == nil {
+		return nil
+	}
+	stamp(event)
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		if !sub.opts.Blocking || !sub.matches(event.Type) {
+			continue
+		}
+		hookCtx, cancel := context.WithTimeout(ctx, sub.opts.Timeout)
+		err := sub.handler.HandleEvent(hookCtx, event)
+		cancel()
+		if err != nil {
+			return &Rejection{Plugin: sub.opts.Name, Reason: err}
+		}
+	}
+	b.enqueue(event, false)
+	return nil
+}
+
+// Publish 异步投递事件，不等待订阅者处理，也不会被拒绝
+func (b *Bus) Publish(event *Event) {
+	if b == nil {
+		return
+	}
+	stamp(event)
+	b.enqueue(event, true)
+}
+
+// enqueue 把事件放入匹配的订阅者队列；withBlocking 为 false 时跳过已在 Check 中处理过的同步订阅者
+func (b *Bus) enqueue(event *Event, withBlocking bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	for _, sub := range b.subs {
+		if !sub.matches(event.Type) || (sub.opts.Blocking && !withBlocking) {
+			continue
+		}
+		select {
+		case sub.queue <- event:
+		default:
+			log.Printf("[Events] Plugin %s is falling behind, dropped %s", sub.opts.Name, event.Type)
+		}
+	}
+}
+
+// stamp 补全事件时间
+func stamp(event *Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+}
+
+// Close 停止接收事件，等待已排队的事件处理完
+func (b *Bus) Close() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	for _, sub := range b.subs {
+		close(sub.queue)
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+	return nil
+}
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestBusCheckAndPublish(t *testing.T) {
+	bus := New()
+	var mu sync.Mutex
+	var received []string
+	record := func(name string) Handler {
+		return HandlerFunc(func(_ context.Context, event *Event) error {
+			mu.Lock()
+			received = append(received, name+":"+event.Type)
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	if err := bus.Subscribe(Options{Name: "all"}, record("all")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Subscribe(Options{Name: "tasks", Events: []string{"task.*"}}, record("tasks")); err != nil {
+		t.Fatal(err)
+	}
+	approver := HandlerFunc(func(_ context.Context, event *Event) error {
+		if event.User != "alice" {
+			return errors.New("only alice may start tasks")
+		}
+		return nil
+	})
+	if err := bus.Subscribe(Options{Name: "approval", Events: []string{TaskCreated}, Blocking: true}, approver); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Subscribe(Options{Name: "typo", Events: []string{"task.create"}}, record("typo")); err == nil {
+		t.Error("Subscribe accepted an unknown event type")
+	}
+
+	var rejection *Rejection
+	if err := bus.Check(context.Background(), &Event{Type: TaskCreated, User: "bob"}); !errors.As(err, &rejection) || rejection.Plugin != "approval" {
+		t.Fatalf("Check = %v, want a rejection by approval", err)
+	}
+	if err := bus.Check(context.Background(), &Event{Type: TaskCreated, User: "alice"}); err != nil {
+		t.Fatalf("Check = %v", err)
+	}
+	// 非同步订阅的事件不经过审批插件
+	if err := bus.Check(context.Background(), &Event{Type: SessionOpened, User: "bob"}); err != nil {
+		t.Fatalf("Check(session) = %v", err)
+	}
+	bus.Publish(&Event{Type: ProbeResult})
+	bus.Close()
+	bus.Publish(&Event{Type: ProbeResult}) // 关闭后忽略
+
+	want := map[string]int{
+		"all:" + TaskCreated: 1, "tasks:" + TaskCreated: 1,
+		"all:" + SessionOpened: 1, "all:" + ProbeResult: 1,
+	}
+	got := map[string]int{}
+	for _, r := range received {
+		got[r]++
+	}
+	if len(got) != len(want) {
+		t.Fatalf("received = %v", received)
+	}
+	for k, n := range want {
+		if got[k] != n {
+			t.Errorf("received = %v, want %v", got, want)
+		}
+	}
+
+	var nilBus *Bus
+	if err := nilBus.Check(context.Background(), &Event{Type: TaskCreated}); err != nil {
+		t.Error(err)
+	}
+	nilBus.Publish(&Event{Type: TaskCompleted})
+}
+
+func TestExecPlugin(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "events.jsonl")
+	plugins := []*types.PluginConfig{
+		{Name: "log", Command: []string{"sh", "-c", "cat >> " + out + "; echo >> " + out}},
+		{Name: "gate", Events: []string{SessionOpened}, Blocking: true, Command: []string{"sh", "-c", `grep -q '"user":"alice"' || { echo "ticket required"; exit 1; }`}},
+		{Name: "slow", Events: []string{TaskCreated}, Blocking: true, Timeout: 100 * time.Millisecond, Command: []string{"sh", "-c", "sleep 5"}},
+	}
+	bus := New()
+	if err := bus.LoadPlugins(plugins); err != nil {
+		t.Fatal(err)
+	}
+
+	err := bus.Check(context.Background(), &Event{Type: SessionOpened, User: "bob", Server: "db-1"})
+	if err == nil || !strings.Contains(err.Error(), "ticket required") {
+		t.Errorf("Check(bob) = %v", err)
+	}
+	if err := bus.Check(context.Background(), &Event{Type: SessionOpened, User: "alice", Server: "db-1"}); err != nil {
+		t.Errorf("Check(alice) = %v", err)
+	}
+	start := time.Now()
+	if err := bus.Check(context.Background(), &Event{Type: TaskCreated}); err == nil || time.Since(start) > 3*time.Second {
+		t.Errorf("a hook that times out must reject quickly: %v after %v", err, time.Since(start))
+	}
+	bus.Close()
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("logged events = %q", data)
+	}
+	var event Event
+	if err := json.Unmarshal([]byte(lines[0]), &event); err != nil || event.User != "alice" || event.Server != "db-1" || event.Time.IsZero() {
+		t.Errorf("logged event = %+v, %v", event, err)
+	}
+
+	for _, bad := range [][]*types.PluginConfig{
+		{{Name: "x"}},
+		{{Name: "x", Command: []string{"true"}, Path: "x.so"}},
+		{{Command: []string{"true"}}},
+		{{Name: "x", Command: []string{"true"}}, {Name: "x", Command: []string{"true"}}},
+		{{Name: "x", Command: []string{"true"}, Events: []string{"jobs.*"}}},
+		{{Name: "x", Path: filepath.Join(dir, "missing.so")}},
+	} {
+		if err := New().LoadPlugins(bad); err == nil {
+			t.Errorf("LoadPlugins accepted %+v", bad[len(bad)-1])
+		}
+	}
+}
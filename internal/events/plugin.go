@@ -0,0 +1,119 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"plugin"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// hookWaitDelay 子进程钩子被终止后等待其输出关闭的时间
+const hookWaitDelay = time.Second
+
+// goPluginSymbol Go 插件必须导出的函数名
+const goPluginSymbol = "HandleEvent"
+
+// LoadPlugins 按配置加载插件并订阅到 b；插件无法加载或订阅了未知事件时返回错误，
+// 避免配置了审批插件却因拼写错误而不生效
+func (b *Bus) LoadPlugins(plugins []*types.PluginConfig) error {
+	names := make(map[string]bool)
+	for _, cfg := range plugins {
+		if cfg.Name == "" {
+			return fmt.Errorf("plugin without a name")
+		}
+		if names[cfg.Name] {
+			return fmt.Errorf("plugin '%s' is configured twice", cfg.Name)
+		}
+		names[cfg.Name] = true
+
+		handler, err := newPluginHandler(cfg)
+		if err != nil {
+			return fmt.Errorf("plugin '%s': %w", cfg.Name, err)
+		}
+		opts := Options{Name: cfg.Name, Events: cfg.Events, Blocking: cfg.Blocking, Timeout: cfg.Timeout}
+		if err := b.Subscribe(opts, handler); err != nil {
+			return fmt.Errorf("plugin '%s': %w", cfg.Name, err)
+		}
+	}
+	return nil
+}
+
+// newPluginHandler 按配置创建子进程钩子或打开 Go 插件
+func newPluginHandler(cfg *types.PluginConfig) (Handler, error) {
+	switch {
+	case len(cfg.Command) > 0 && cfg.Path != "":
+		return nil, errors.New("set either command or path, not both")
+	case len(cfg.Command) > 0:
+		return &execHandler{command: cfg.Command}, nil
+	case cfg.Path != "":
+		return openGoPlugin(cfg.Path)
+	default:
+		return nil, errors.New("command or path is required")
+	}
+}
+
+// execHandler 子进程钩子：每个事件启动一次 command，事件 JSON 写入 stdin
+type execHandler struct {
+	command []string
+}
+
+// HandleEvent 运行钩子；非 0 退出时以输出的第一行（没有输出时为退出状态）作为错误
+func (h *execHandler) HandleEvent(ctx context.Context, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, h.command[0], h.command[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	// 超时后钩子留下的子进程可能仍占着输出管道，不再等待它们
+	cmd.WaitDelay = hookWaitDelay
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("hook timed out: %w", ctx.Err())
+		}
+		if line, _, _ := strings.Cut(strings.TrimSpace(out.String()), "\n"); line != "" {
+			return errors.New(line)
+		}
+		return err
+	}
+	return nil
+}
+
+// goPluginHandler Go 插件导出的 HandleEvent，收到的是事件 JSON，不依赖本仓库的类型
+type goPluginHandler func(ctx context.Context, event []byte) error
+
+// HandleEvent 以 JSON 调用插件
+func (h goPluginHandler) HandleEvent(ctx context.Context, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return h(ctx, data)
+}
+
+// openGoPlugin 打开 Go 插件（go build -buildmode=plugin，需与 gmssh 使用相同的 Go 版本构建）
+func openGoPlugin(path string) (Handler, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(goPluginSymbol)
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := sym.(func(context.Context, []byte) error)
+	if !ok {
+		return nil, fmt.Errorf("%s must be func(context.Context, []byte) error, got %T", goPluginSymbol, sym)
+	}
+	return goPluginHandler(fn), nil
+}
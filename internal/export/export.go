@@ -0,0 +1,165 @@
+// Package export 把延迟历史、传输记录和使用量按时间范围导出为 CSV，用于容量规划和月度报表，
+// 不必反复调用 API 再自行拼接。传输记录来自审计日志中的 upload.* 和 fetch_dir.* 事件，使用量来自 usage.json，
+// 延迟历史只保存在运行中的 gmssh web 的内存里（每条路径最近 profiler.DefaultHistorySize 个样本）
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/usage"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// 导出的数据类型
+const (
+	KindLatency   = "latency"
+	KindTransfers = "transfers"
+	KindUsage     = "usage"
+)
+
+// Kinds 全部数据类型
+var Kinds = []string{KindLatency, KindTransfers, KindUsage}
+
+// dateLayout from/to 可以只写本地日期
+const dateLayout = "2006-01-02"
+
+// Range 时间范围 [From, To)，零值表示不限
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+// ParseRange 解析 from 和 to：RFC 3339 时间或本地日期 YYYY-MM-DD，日期形式的 to 包含当天；为空时不限
+func ParseRange(from, to string) (Range, error) {
+	var r Range
+	var err error
+	if from != "" {
+		if r.From, err = parseTime(from, false); err != nil {
+			return Range{}, fmt.Errorf("invalid from %q", from)
+		}
+	}
+	if to != "" {
+		if r.To, err = parseTime(to, true); err != nil {
+			return Range{}, fmt.Errorf("invalid to %q", to)
+		}
+	}
+	if !r.From.IsZero() && !r.To.IsZero() && !r.From.Before(r.To) {
+		return Range{}, fmt.Errorf("from must be before to")
+	}
+	return r, nil
+}
+
+func parseTime(value string, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation(dateLayout, value, time.Local); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Contains t 是否在范围内
+func (r Range) Contains(t time.Time) bool {
+	return (r.From.IsZero() || !t.Before(r.From)) && (r.To.IsZero() || t.Before(r.To))
+}
+
+// FileName 下载时建议的文件名，如 gmssh-usage-2026-09-01-2026-09-30.csv
+func FileName(kind string, r Range) string {
+	name := "gmssh-" + kind
+	if !r.From.IsZero() {
+		name += "-" + r.From.Local().Format(dateLayout)
+	}
+	if !r.To.IsZero() {
+		name += "-" + r.To.Add(-time.Nanosecond).Local().Format(dateLayout)
+	}
+	return name + ".csv"
+}
+
+// LatencySample 一台服务器（经其网关链）的一次延迟探测
+type LatencySample struct {
+	Server    string
+	Time      time.Time
+	LatencyMs float64
+	Success   bool
+}
+
+// Latency 写出范围内的延迟样本
+func Latency(w io.Writer, samples []LatencySample, r Range) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "server", "latency_ms", "success"})
+	for _, s := range samples {
+		if !r.Contains(s.Time) {
+			continue
+		}
+		cw.Write([]string{
+			s.Time.Format(time.RFC3339),
+			s.Server,
+			strconv.FormatFloat(s.LatencyMs, 'f', 2, 64),
+			strconv.FormatBool(s.Success),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Transfers 写出审计日志 auditPath 中范围内的上传和打包下载记录；user 非空时只导出该用户的记录
+func Transfers(w io.Writer, auditPath string, r Range, user string) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "user", "kind", "status", "task_id", "file", "destination", "error", "request_id"})
+	err := audit.Scan(auditPath, func(event audit.Event) bool {
+		kind, status, ok := strings.Cut(event.Action, ".")
+		if !ok || (kind != "upload" && kind != "fetch_dir") || !r.Contains(event.Time) || (user != "" && event.User != user) {
+			return true
+		}
+		var taskID, file, destination string
+		if kind == "upload" {
+			// detail 为 "文件名 -> 服务器:路径"，较早的记录没有 detail
+			taskID = event.Target
+			file, destination, _ = strings.Cut(event.Detail, " -> ")
+		} else {
+			// 打包下载的 target 为 "服务器:路径"，文件下载到本地
+			file = event.Target
+		}
+		cw.Write([]string{event.Time.Format(time.RFC3339), event.User, kind, status, taskID, file, destination, event.Error, event.RequestID})
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Usage 写出范围内每台服务器每天的使用量，服务器名称取自 cfg（已删除的服务器名称为空）
+func Usage(w io.Writer, cfg *types.Config, store *usage.Store, r Range) error {
+	var until time.Time
+	if !r.To.IsZero() {
+		until = r.To.Add(-time.Nanosecond)
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "server_id", "server", "sessions", "transfers", "bytes", "tunnel_seconds"})
+	for _, row := range store.Rows(r.From, until) {
+		name := ""
+		if hop := cfg.GetHopByID(row.ServerID); hop != nil {
+			name = hop.Name
+		}
+		cw.Write([]string{
+			row.Date,
+			row.ServerID,
+			name,
+			strconv.FormatInt(row.Sessions, 10),
+			strconv.FormatInt(row.Transfers, 10),
+			strconv.FormatInt(row.Bytes, 10),
+			strconv.FormatInt(row.TunnelSeconds, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,117 @@
+package export
+
+import (
+	"encoding/csv"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/internal/usage"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func readCSV(t *testing.T, data string) [][]string {
+	t.Helper()
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestParseRange(t *testing.T) {
+	r, err := ParseRange("2026-09-01", "2026-09-30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 日期形式的 to 包含当天
+	if !r.Contains(time.Date(2026, 9, 30, 23, 59, 0, 0, time.Local)) || r.Contains(time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("unexpected range %+v", r)
+	}
+	if name := FileName(KindUsage, r); name != "gmssh-usage-2026-09-01-2026-09-30.csv" {
+		t.Errorf("file name: %s", name)
+	}
+	if _, err := ParseRange("2026-09-30", "2026-09-01T00:00:00Z"); err == nil {
+		t.Error("from after to should fail")
+	}
+	if _, err := ParseRange("last week", ""); err == nil {
+		t.Error("invalid from should fail")
+	}
+	if r, err := ParseRange("", ""); err != nil || !r.Contains(time.Time{}) {
+		t.Errorf("empty range should contain everything: %+v, %v", r, err)
+	}
+}
+
+func TestTransfers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), audit.FileName)
+	logger, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2026, 9, 15, 10, 0, 0, 0, time.UTC)
+	for _, event := range []audit.Event{
+		{Time: day, User: "alice", Action: "upload.completed", Target: "task-1", Detail: "report.xlsx -> db:/srv/reports"},
+		{Time: day, User: "bob", Action: "fetch_dir.failed", Target: "db:/var/log", Error: "disk full"},
+		{Time: day, User: "alice", Action: "POST /api/servers", Status: 201},
+		{Time: day.AddDate(0, 1, 0), User: "alice", Action: "upload.completed", Target: "task-2"},
+	} {
+		logger.Record(event)
+	}
+	logger.Close()
+
+	var out strings.Builder
+	r, _ := ParseRange("2026-09-01", "2026-09-30")
+	if err := Transfers(&out, path, r, ""); err != nil {
+		t.Fatal(err)
+	}
+	records := readCSV(t, out.String())
+	if len(records) != 3 {
+		t.Fatalf("expected header and 2 transfers, got %v", records)
+	}
+	if got := records[1]; got[2] != "upload" || got[3] != "completed" || got[4] != "task-1" || got[5] != "report.xlsx" || got[6] != "db:/srv/reports" {
+		t.Errorf("upload row: %v", got)
+	}
+	if got := records[2]; got[2] != "fetch_dir" || got[5] != "db:/var/log" || got[7] != "disk full" {
+		t.Errorf("fetch row: %v", got)
+	}
+
+	out.Reset()
+	if err := Transfers(&out, path, Range{}, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if records := readCSV(t, out.String()); len(records) != 2 || records[1][1] != "bob" {
+		t.Errorf("user filter: %v", records)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	store, err := usage.Open(filepath.Join(t.TempDir(), usage.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Add([]string{"gw", "db"}, usage.Counters{Sessions: 1, Bytes: 100}, time.Date(2026, 9, 30, 12, 0, 0, 0, time.Local))
+	store.Add([]string{"gw"}, usage.Counters{Transfers: 1}, time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local))
+	cfg := &types.Config{Hops: []*types.Hop{{ID: "gw", Name: "gateway"}}}
+
+	var out strings.Builder
+	r, _ := ParseRange("2026-09-01", "2026-09-30")
+	if err := Usage(&out, cfg, store, r); err != nil {
+		t.Fatal(err)
+	}
+	records := readCSV(t, out.String())
+	want := [][]string{
+		{"date", "server_id", "server", "sessions", "transfers", "bytes", "tunnel_seconds"},
+		{"2026-09-30", "db", "", "1", "0", "100", "0"},
+		{"2026-09-30", "gw", "gateway", "1", "0", "100", "0"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %v", records)
+	}
+	for i := range want {
+		if strings.Join(records[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d: got %v, want %v", i, records[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package hostinfo
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Listener 远端监听的端口
+type Listener struct {
+	Proto   string `json:"proto"` // tcp、tcp6、udp 或 udp6
+	Addr    string `json:"addr"`  // 监听地址，* 表示所有地址
+	Port    int    `json:"port"`
+	PID     int    `json:"pid,omitempty"`     // 非 root 登录时只能看到自己的进程
+	Process string `json:"process,omitempty"` // 程序名
+}
+
+// ssUsersPattern ss -p 的进程字段，如 users:(("sshd",pid=812,fd=3))，只取第一个进程
+var ssUsersPattern = regexp.MustCompile(`users:\(\("([^"]*)",pid=(\d+)`)
+
+// ListPortsCommand 列出远端 TCP/UDP 监听端口的命令，优先使用 ss，没有时退回 netstat，输出由 ParseListeners 解析
+func ListPortsCommand() string {
+	return "LC_ALL=C ss -Htulnp 2>/dev/null || LC_ALL=C netstat -tulnp 2>/dev/null"
+}
+
+// ParseListeners 解析 ListPortsCommand 的输出（ss 或 netstat 格式），跳过表头和无法识别的行
+func ParseListeners(output string) []Listener {
+	listeners := []Listener{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "tcp") && !strings.HasPrefix(fields[0], "udp") {
+			continue
+		}
+
+		var l Listener
+		var local string
+		if _, err := strconv.Atoi(fields[1]); err == nil {
+			// netstat：Proto Recv-Q Send-Q Local Foreign [State] PID/Program
+			local = fields[3]
+			l.Proto = fields[0]
+			if pid, name, ok := strings.Cut(fields[len(fields)-1], "/"); ok {
+				l.PID, _ = strconv.Atoi(pid)
+				l.Process = name
+			}
+		} else {
+			// ss：Netid State Recv-Q Send-Q Local Peer [Process]，Netid 不区分 IPv4/IPv6
+			if len(fields) < 6 {
+				continue
+			}
+			local = fields[4]
+			l.Proto = fields[0]
+			if strings.HasPrefix(local, "[") {
+				l.Proto += "6"
+			}
+			if m := ssUsersPattern.FindStringSubmatch(line); m != nil {
+				l.Process = m[1]
+				l.PID, _ = strconv.Atoi(m[2])
+			}
+		}
+
+		addr, port, ok := splitListenAddr(local)
+		if !ok {
+			continue
+		}
+		l.Addr, l.Port = addr, port
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
+
+// splitListenAddr 拆分 ss/netstat 的本地地址，如 0.0.0.0:22、[::]:22、:::22、127.0.0.53%lo:53、*:68；
+// 所有地址统一为 *
+func splitListenAddr(local string) (string, int, bool) {
+	i := strings.LastIndex(local, ":")
+	if i < 0 {
+		return "", 0, false
+	}
+	port, err := strconv.Atoi(local[i+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	addr := strings.TrimSuffix(strings.TrimPrefix(local[:i], "["), "]")
+	if zone := strings.Index(addr, "%"); zone >= 0 {
+		addr = addr[:zone]
+	}
+	switch addr {
+	case "", "0.0.0.0", "::", "*":
+		addr = "*"
+	}
+	return addr, port, true
+}
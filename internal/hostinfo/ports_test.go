@@ -0,0 +1,49 @@
+package hostinfo
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseListeners 测试解析 ss 和 netstat 的监听端口
+func TestParseListeners(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []Listener
+	}{
+		{
+			name: "ss",
+			output: "udp   UNCONN 0      0      127.0.0.53%lo:53        0.0.0.0:*    users:((\"systemd-resolve\",pid=650,fd=13))\n" +
+				"tcp   LISTEN 0      128          0.0.0.0:22        0.0.0.0:*    users:((\"sshd\",pid=812,fd=3))\n" +
+				"tcp   LISTEN 0      128             [::]:22           [::]:*\n",
+			want: []Listener{
+				{Proto: "udp", Addr: "127.0.0.53", Port: 53, PID: 650, Process: "systemd-resolve"},
+				{Proto: "tcp", Addr: "*", Port: 22, PID: 812, Process: "sshd"},
+				{Proto: "tcp6", Addr: "*", Port: 22},
+			},
+		},
+		{
+			name: "netstat",
+			output: "Active Internet connections (only servers)\n" +
+				"Proto Recv-Q Send-Q Local Address           Foreign Address         State       PID/Program name\n" +
+				"tcp        0      0 127.0.0.1:5432          0.0.0.0:*               LISTEN      901/postgres\n" +
+				"tcp6       0      0 :::80                   :::*                    LISTEN      -\n" +
+				"udp        0      0 0.0.0.0:68              0.0.0.0:*                           512/dhclient\n",
+			want: []Listener{
+				{Proto: "tcp", Addr: "127.0.0.1", Port: 5432, PID: 901, Process: "postgres"},
+				{Proto: "tcp6", Addr: "*", Port: 80},
+				{Proto: "udp", Addr: "*", Port: 68, PID: 512, Process: "dhclient"},
+			},
+		},
+		{"empty", "", []Listener{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseListeners(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseListeners() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
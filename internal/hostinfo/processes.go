@@ -0,0 +1,113 @@
+// Package hostinfo 生成查看远端进程和监听端口的命令，并解析其输出
+package hostinfo
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/luobobo896/HSSH/internal/terminal"
+)
+
+// ErrProcessChanged 要结束的进程已退出，或 PID 已被其他进程复用
+var ErrProcessChanged = errors.New("process no longer matches the confirmed start time")
+
+// ErrUnknownSignal 不支持的信号
+var ErrUnknownSignal = errors.New("unknown signal")
+
+// processChangedStatus KillCommand 在进程启动时间与确认的不符时的退出码
+const processChangedStatus = 3
+
+// signals 允许通过 API 发送的信号
+var signals = map[string]bool{
+	"TERM": true, "KILL": true, "HUP": true, "INT": true, "QUIT": true, "USR1": true, "USR2": true,
+}
+
+// Process 远端进程
+type Process struct {
+	PID     int     `json:"pid"`
+	PPID    int     `json:"ppid"`
+	User    string  `json:"user"`
+	CPU     float64 `json:"cpu"`     // %CPU
+	Mem     float64 `json:"mem"`     // %MEM
+	RSS     int64   `json:"rss_kb"`  // 常驻内存，KB
+	Elapsed string  `json:"elapsed"` // 运行时间，ps 的 [[dd-]hh:]mm:ss 格式
+	Started string  `json:"started"` // 启动时间，如 "Mon Jan 2 15:04:05 2006"，结束进程时作为确认
+	Command string  `json:"command"` // 程序名
+	Args    string  `json:"args"`    // 完整命令行
+}
+
+// ListProcessesCommand 列出远端所有进程的命令，输出由 ParseProcesses 解析
+func ListProcessesCommand() string {
+	return "LC_ALL=C ps -eo pid=,ppid=,user=,pcpu=,pmem=,rss=,etime=,lstart=,args="
+}
+
+// ParseProcesses 解析 ListProcessesCommand 的输出，跳过无法识别的行
+func ParseProcesses(output string) []Process {
+	procs := []Process{}
+	for _, line := range strings.Split(output, "\n") {
+		// lstart 固定为 5 个字段（星期 月 日 时间 年），其后是命令行
+		fields := strings.Fields(line)
+		if len(fields) < 13 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		p := Process{
+			PID:     pid,
+			User:    fields[2],
+			Elapsed: fields[6],
+			Started: strings.Join(fields[7:12], " "),
+			Args:    strings.Join(fields[12:], " "),
+		}
+		p.PPID, _ = strconv.Atoi(fields[1])
+		p.CPU, _ = strconv.ParseFloat(fields[3], 64)
+		p.Mem, _ = strconv.ParseFloat(fields[4], 64)
+		p.RSS, _ = strconv.ParseInt(fields[5], 10, 64)
+		p.Command = commandName(fields[12])
+		procs = append(procs, p)
+	}
+	return procs
+}
+
+// commandName 取命令行第一个参数的文件名；内核线程形如 [kworker/0:1]，原样返回
+func commandName(arg0 string) string {
+	if strings.HasPrefix(arg0, "[") {
+		return arg0
+	}
+	return path.Base(arg0)
+}
+
+// KillCommand 返回向 pid 发送 signal（为空时为 TERM）的命令。
+// 只有进程的启动时间仍为 started（ParseProcesses 返回的格式）时才发送，避免列表刷新后 PID 被复用而结束了别的进程；
+// 不符时以 processChangedStatus 退出，由 KillFailed 识别
+func KillCommand(pid int, started, signal string) (string, error) {
+	if signal == "" {
+		signal = "TERM"
+	}
+	signal = strings.TrimPrefix(strings.ToUpper(signal), "SIG")
+	if !signals[signal] {
+		return "", fmt.Errorf("%w: %s", ErrUnknownSignal, signal)
+	}
+	if pid <= 1 {
+		return "", fmt.Errorf("refusing to signal pid %d", pid)
+	}
+	if started == "" {
+		return "", errors.New("start time confirmation is required")
+	}
+	// 不加引号的 $(...) 按空白拆分后再用 "$*" 拼接，与 ParseProcesses 合并空白的方式一致
+	return fmt.Sprintf(`set -- $(LC_ALL=C ps -o lstart= -p %d); [ "$*" = %s ] || exit %d; kill -s %s %d`,
+		pid, terminal.ShellQuote(started), processChangedStatus, signal, pid), nil
+}
+
+// KillFailed 返回 KillCommand 以 status 退出时的错误：进程已变化时为 ErrProcessChanged，否则为 err
+func KillFailed(status int, err error) error {
+	if status == processChangedStatus {
+		return ErrProcessChanged
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package hostinfo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestParseProcesses 测试解析 ps 输出
+func TestParseProcesses(t *testing.T) {
+	output := "    1     0 root      0.0  0.1 12345    10-02:03:04 Mon Jan  2 15:04:05 2006 /sbin/init splash\n" +
+		"  812     1 root      0.0  0.2  8000       01:02:03 Tue Feb 13 08:00:00 2024 sshd: /usr/sbin/sshd -D [listener]\n" +
+		"   42     2 root      0.0  0.0     0          05:00 Tue Feb 13 08:00:01 2024 [kworker/0:1-events]\n" +
+		"garbage line\n"
+
+	procs := ParseProcesses(output)
+	if len(procs) != 3 {
+		t.Fatalf("got %d processes, want 3: %+v", len(procs), procs)
+	}
+
+	init := procs[0]
+	if init.PID != 1 || init.PPID != 0 || init.User != "root" || init.RSS != 12345 || init.Mem != 0.1 {
+		t.Errorf("unexpected fields: %+v", init)
+	}
+	if init.Elapsed != "10-02:03:04" || init.Started != "Mon Jan 2 15:04:05 2006" {
+		t.Errorf("elapsed/started = %q/%q", init.Elapsed, init.Started)
+	}
+	if init.Command != "init" || init.Args != "/sbin/init splash" {
+		t.Errorf("command/args = %q/%q", init.Command, init.Args)
+	}
+	if procs[1].Command != "sshd:" || !strings.HasSuffix(procs[1].Args, "[listener]") {
+		t.Errorf("sshd: command/args = %q/%q", procs[1].Command, procs[1].Args)
+	}
+	if procs[2].Command != "[kworker/0:1-events]" {
+		t.Errorf("kernel thread command = %q", procs[2].Command)
+	}
+}
+
+// TestKillCommand 测试结束进程的命令和参数校验
+func TestKillCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		pid     int
+		started string
+		signal  string
+		want    string
+		wantErr bool
+	}{
+		{"default signal", 812, "Tue Feb 13 08:00:00 2024", "", "kill -s TERM 812", false},
+		{"sig prefix", 812, "Tue Feb 13 08:00:00 2024", "sigkill", "kill -s KILL 812", false},
+		{"confirmation quoted", 812, "it's", "HUP", `[ "$*" = 'it'\''s' ]`, false},
+		{"unknown signal", 812, "Tue Feb 13 08:00:00 2024", "STOP", "", true},
+		{"init", 1, "Mon Jan 2 15:04:05 2006", "TERM", "", true},
+		{"missing confirmation", 812, "", "TERM", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := KillCommand(tt.pid, tt.started, tt.signal)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("KillCommand() = %q, want error", cmd)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("KillCommand() error = %v", err)
+			}
+			if !strings.Contains(cmd, tt.want) {
+				t.Errorf("KillCommand() = %q, missing %q", cmd, tt.want)
+			}
+		})
+	}
+}
+
+// TestKillFailed 测试退出码到错误的转换
+func TestKillFailed(t *testing.T) {
+	denied := errors.New("kill: (812) - Operation not permitted")
+	if err := KillFailed(processChangedStatus, denied); !errors.Is(err, ErrProcessChanged) {
+		t.Errorf("KillFailed(%d) = %v, want ErrProcessChanged", processChangedStatus, err)
+	}
+	if err := KillFailed(1, denied); err != denied {
+		t.Errorf("KillFailed(1) = %v, want %v", err, denied)
+	}
+}
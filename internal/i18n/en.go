@@ -0,0 +1,554 @@
+package i18n
+
+// en 英文消息目录
+var en = map[string]string{
+	// CLI
+	"CLI_ERROR":                   "Error: %v",
+	"CLI_WARNING_TRACING":         "Warning: tracing disabled: %v",
+	"CLI_WARNING_LOG_LEVEL":       "Warning: log_level ignored: %v",
+	"CLI_WARNING_NETEM":           "Warning: debug_netem ignored: %v",
+	"CLI_UNKNOWN_COMMAND":         "Unknown command: %s",
+	"CLI_UNKNOWN_SUBCOMMAND":      "Unknown %s subcommand: %s",
+	"CLI_SERVER_SUBCOMMAND":       "server subcommand required (add, list, delete, trash, restore, check)",
+	"CLI_KEY_SUBCOMMAND":          "key subcommand required (generate, deploy, rotate)",
+	"CLI_KEY_SERVER_REQUIRED":     "--server required",
+	"CLI_CONFIG_SUBCOMMAND":       "config subcommand required (migrate-to-sqlite, sync, refs, fix-refs, import-ssh)",
+	"CLI_BACKUP_SUBCOMMAND":       "backup subcommand required (create, restore)",
+	"CLI_BACKUP_FILE_REQUIRED":    "%s <file> is required",
+	"CLI_UPLOAD_ARGS_REQUIRED":    "source and target are required",
+	"CLI_DOWNLOAD_ARGS_REQUIRED":  "source (host:path) and target are required",
+	"CLI_FETCH_DIR_ARGS_REQUIRED": "source (host:path) is required",
+	"CLI_PROXY_ARGS_REQUIRED":     "a remote target is required: --remote, --targets or --remote-host with --remote-port",
+	"CLI_APPLY_FILE_REQUIRED":     "-f <state file> is required",
+	"CLI_HOP_NAME_REQUIRED":       "server name required",
+	"CLI_HOP_NAME_OR_ID_REQUIRED": "server name or ID required",
+	"CLI_CHECK_TARGET_REQUIRED":   "server names or --all required",
+	"CLI_EXPORT_KIND_REQUIRED":    "export kind required: latency, transfers or usage",
+	"CLI_SEARCH_QUERY_REQUIRED":   "search words required",
+	"CLI_HOSTKEY_USAGE":           "usage: hostkey accept|forget <server>",
+	"CLI_INVALID_GLOBAL_FLAG":     "%v (see hssh help)",
+	"CLI_WEB_STARTING":            "Starting web UI at http://%s",
+	"CLI_STATUS_STARTING":         "Starting read-only status page at http://%s",
+	"CLI_BROWSER_FAILED":          "Could not open a browser (%v); use --no-browser to skip",
+	"CLI_USAGE":                   usageEn,
+
+	// 通用
+	"ERR_NOT_FOUND":       "Not found",
+	"ERR_INVALID_BODY":    "Invalid request body: %v",
+	"ERR_INVALID_FORM":    "Failed to parse form: %v",
+	"ERR_SAVE_CONFIG":     "Failed to save config: %v",
+	"ERR_CONFIG_FROZEN":   "The configuration was restored from a backup; restart gmssh before changing it",
+	"ERR_NAME_REQUIRED":   "name is required",
+	"ERR_TARGET_REQUIRED": "target is required",
+	"ERR_INVALID_PARAM":   "invalid %s: %v",
+	"ERR_PATH_REQUIRED":   "path is required",
+	"ERR_INVALID_PORT":    "port must be between 1 and 65535",
+	"ERR_INTERNAL":        "Internal error: %v",
+	"ERR_ALREADY_EXISTS":  "Already exists: %v",
+	"ERR_TIMEOUT":         "Timed out: %v",
+
+	// 认证
+	"ERR_AUTH_REQUIRED":      "authentication required",
+	"ERR_INVALID_TOKEN":      "invalid token",
+	"ERR_ADMIN_REQUIRED":     "admin role required",
+	"ERR_ORIGIN_NOT_ALLOWED": "origin not allowed",
+	"ERR_CSRF_INVALID":       "missing or invalid CSRF token",
+	"ERR_CSRF_TOKEN_FAILED":  "failed to create CSRF token",
+
+	// 服务器
+	"ERR_HOP_NOT_FOUND":           "Server not found",
+	"ERR_HOP_ID_REQUIRED":         "server id is required",
+	"ERR_HOP_FIELDS_REQUIRED":     "name, host, and user are required",
+	"ERR_CLONE_NAME_REQUIRED":     "name for the copy is required",
+	"ERR_INVALID_ADDRESS":         "invalid address: %v",
+	"ERR_INVALID_RECENT_KIND":     "invalid kind '%s': must be 'terminal' or 'upload'",
+	"ERR_INVALID_AUTH_TYPE":       "invalid auth type '%s': must be 'key', 'password' or 'agent'",
+	"ERR_GATEWAY_REQUIRED":        "internal server requires a gateway",
+	"ERR_GATEWAY_NOT_FOUND":       "gateway not found",
+	"ERR_UNKNOWN_TERMINAL_PRESET": "unknown terminal preset: %s",
+	"ERR_INVALID_TERMINAL":        "invalid terminal settings: %v",
+	"ERR_INVALID_CLIENT_VERSION":  "invalid SSH client version: %v",
+	"ERR_INVALID_NOTES":           "invalid server notes: %v",
+	"ERR_INVALID_HOST_KEY":        "invalid host key setting: %v",
+	"ERR_HOST_KEY_NOT_PENDING":    "no pending host key for %s",
+	"ERR_HOST_KEY_FINGERPRINT":    "fingerprint %s does not match the pending host key",
+	"ERR_UNKNOWN_HOP":             "Unknown hop: %s",
+	"ERR_HOP_HAS_DEPENDENTS":      "cannot delete '%s': still referenced by %s",
+	"ERR_TRASH_NOT_FOUND":         "Server not found in trash",
+	"ERR_FIX_REFERENCES":          "failed to fix references: %v",
+	"ERR_SSH_CONFIG":              "failed to read SSH config: %v",
+	"ERR_ROUTE_FIELDS_REQUIRED":   "from and to are required",
+
+	// 链路
+	"ERR_NO_HOPS":                "No valid SSH hops configured. Please configure Via hops.",
+	"ERR_LIST_SESSIONS":          "failed to list remote sessions: %v",
+	"ERR_INVALID_PATTERN":        "invalid grep pattern: %v",
+	"ERR_TAIL":                   "failed to start tail: %v",
+	"ERR_LIST_PROCESSES":         "failed to list processes: %v",
+	"ERR_LIST_PORTS":             "failed to list listening ports: %v",
+	"ERR_KILL_UNCONFIRMED":       "confirm must be the process start time from the process list",
+	"ERR_KILL_FAILED":            "failed to signal process: %v",
+	"ERR_PROCESS_CHANGED":        "process has exited or its pid was reused; refresh the process list",
+	"ERR_KEY_GENERATE":           "failed to generate key: %v",
+	"ERR_UNSUPPORTED_KEY_TYPE":   "unsupported key type or size: %v",
+	"ERR_KEY_EXISTS":             "key file already exists: %v",
+	"ERR_KEY_READ":               "cannot read public key: %v",
+	"ERR_KEY_DEPLOY":             "failed to deploy key: %v",
+	"ERR_KEY_VERIFY":             "key login to %s failed, auth not changed: %v",
+	"ERR_PRIVATE_KEY_READ":       "cannot read private key: %v",
+	"ERR_KEY_NOT_ENCRYPTED":      "%s does not use an encrypted private key",
+	"ERR_KEY_PASSPHRASE_WRONG":   "wrong passphrase for the private key of %s",
+	"ERR_ROTATE_TARGET_REQUIRED": "ids or all is required",
+	"ERR_BUILD_CHAIN":            "Failed to build hop chain: %v",
+	"ERR_CHAIN_CONNECT":          "Failed to connect SSH chain: %v",
+	"ERR_CHAIN_CONFIG":           "Invalid SSH settings for %s: %v",
+	"ERR_CHAIN_KEY_PASSPHRASE":   "The private key of %s needs a passphrase: %v",
+	"ERR_CHAIN_DIAL_FAILED":      "Cannot reach %s: %v",
+	"ERR_CHAIN_HOST_KEY":         "Host key verification failed for %s: %v",
+	"ERR_CHAIN_AUTH_FAILED":      "Authentication failed at %s: %v",
+	"ERR_CHAIN_HANDSHAKE_FAILED": "SSH handshake with %s failed: %v",
+
+	// 上传
+	"ERR_TASK_NOT_FOUND":         "Task not found",
+	"ERR_TASK_ID_REQUIRED":       "task_id is required",
+	"ERR_UPLOAD_TARGET_REQUIRED": "target_path and target_host are required",
+	"ERR_INVALID_OBJECT_TARGET":  "Invalid object storage target: %v",
+	"ERR_INVALID_UPLOAD_MODE":    "Invalid upload mode: %v",
+	"ERR_FETCH_DIR_REQUIRED":     "server and path are required",
+	"ERR_FETCH_DIR_FAILED":       "Fetching the directory failed: %v",
+	"ERR_FETCH_NOT_READY":        "The archive is not ready (task is %s)",
+	"ERR_EDIT_NOT_FOUND":         "The file does not exist",
+	"ERR_EDIT_NOT_REGULAR":       "The path is not a regular file",
+	"ERR_EDIT_TOO_LARGE":         "The file is larger than %d bytes and cannot be edited online",
+	"ERR_EDIT_BINARY":            "The file is not UTF-8 text",
+	"ERR_EDIT_CONFLICT":          "The file was changed since it was read; reload it and edit again",
+	"ERR_EDIT_FAILED":            "Editing the file failed: %v",
+	"ERR_OVERWRITE_CONFIRM":      "%s already exists; review the diff and resubmit with force=1 to overwrite it",
+	"ERR_OVERWRITE_DIFF_FAILED":  "Reading the remote file for the diff failed: %v",
+	"ERR_BACKUP_LIST_FAILED":     "Listing backups failed: %v",
+	"ERR_BACKUP_NOT_FOUND":       "Backup %s does not exist",
+	"ERR_BACKUP_RESTORE_FAILED":  "Restoring the backup failed: %v",
+	"ERR_NO_FILE":                "Failed to get file: no file in request",
+	"ERR_NO_FILES":               "No files in directory upload",
+	"ERR_STAGING":                "Failed to create temp dir: %v",
+	"ERR_STAGING_SCAN":           "Failed to inspect the staging area: %v",
+	"ERR_UPLOAD_FAILED":          "Upload failed: %v",
+	"ERR_UPLOAD_POLICY":          "Upload rejected by policy (%s): %s: %s",
+	"ERR_STAGE_QUOTA":            "Gateway staging quota exceeded: %v",
+	"ERR_TARGET_NOT_WRITABLE":    "Target is not writable by the login user: %v",
+	"ERR_UPLOAD_NOT_FOUND":       "Upload not found or expired",
+	"ERR_UPLOAD_OFFSET_MISMATCH": "Upload-Offset %d does not match the received size %d",
+	"ERR_UPLOAD_BUSY":            "Another chunk of this upload is still being received, retry shortly",
+	"ERR_UPLOAD_TOO_LARGE":       "Chunk exceeds the declared upload size of %d bytes",
+	"ERR_UPLOAD_INCOMPLETE":      "Upload incomplete: received %d of %d bytes",
+	"ERR_UPLOAD_CHUNK":           "Failed to receive chunk: %v",
+	"ERR_STATE_BACKUP_FAILED":    "Creating the backup failed: %v",
+	"ERR_STATE_RESTORE_FAILED":   "Restoring the backup failed: %v",
+	"ERR_STATE_PASSPHRASE":       "Backup passphrase missing or wrong: %v",
+	"ERR_STATE_CONFIG_EXISTS":    "This server already has a configuration; restore with force=true to replace it",
+
+	// 转发
+	"ERR_PROXY_NOT_FOUND":         "Proxy not found",
+	"ERR_FORWARD_FIELDS_REQUIRED": "local_addr, remote_host and remote_port are required",
+	"ERR_REMOTE_REQUIRED":         "remote_host and remote_port are required (remote_host may also be a unix socket path)",
+	"ERR_LOCAL_ADDR_REQUIRED":     "local_addr is required",
+	"ERR_FORWARDER_START":         "Failed to start forwarder: %v",
+	"ERR_MAPPING_NOT_FOUND":       "Mapping not found",
+	"ERR_MAPPING_RUNNING":         "Mapping is already running",
+	"ERR_PROXY_STOP":              "Failed to stop proxy: %v",
+	"ERR_INVALID_LOCAL_ADDR":      "Invalid local_addr: %v",
+	"ERR_PORT_IN_USE":             "%s is already used by %s %s",
+	"ERR_PORT_RANGE_EXHAUSTED":    "No free port in %d-%d",
+	"ERR_LAN_BIND_DISABLED":       "Listening on addresses reachable from other machines is disabled (ports.allow_lan): %v",
+	"ERR_LAN_BIND_UNCONFIRMED":    "Set allow_lan to confirm exposing this forward to other machines: %v",
+	"ERR_INVALID_RESOLVER":        "Invalid resolver: %v",
+	"ERR_INVALID_IDLE_THRESHOLD":  "Invalid threshold %q: use a positive duration such as 30m",
+	"ERR_INVALID_MAX_DURATION":    "Invalid max_duration %q: use a positive duration such as 1h",
+
+	// 终端会话
+	"ERR_SESSION_NOT_FOUND":   "Session not found",
+	"ERR_SESSION_ID_REQUIRED": "Session ID required",
+
+	// 活动连接
+	"ERR_CONNECTION_NOT_FOUND": "Connection not found: %v",
+
+	// 维护窗口
+	"ERR_MAINTENANCE":           "%v is under maintenance until %v%v",
+	"ERR_INVALID_MAINTENANCE":   "Invalid maintenance window: %v",
+	"ERR_MAINTENANCE_NOT_FOUND": "Maintenance window not found",
+
+	// 环境策略
+	"ERR_CONFIRM_REQUIRED": "%v on %v needs confirmation in the %v environment; send the server name in the X-Confirm-Server header",
+
+	// 审批
+	"ERR_APPROVAL_NOT_FOUND": "Approval request not found",
+	"ERR_APPROVAL_SELF":      "You cannot approve your own request; another operator must approve it",
+	"ERR_APPROVAL_DECIDED":   "Approval request is already %v",
+	"ERR_APPROVAL_DENIED":    "Access to %v was denied by %v%v",
+	"ERR_APPROVAL_EXPIRED":   "Access to %v was not approved before %v",
+	"ERR_APPROVAL_CANCELED":  "Approval request for %v was canceled",
+
+	// 插件
+	"ERR_PLUGIN_REJECTED": "Rejected by plugin '%v': %v",
+
+	// 路径学习
+	"ERR_PLAYBOOK_NOT_FOUND":     "Nothing has been learned for %v yet",
+	"ERR_INVALID_PLAYBOOK_FIELD": "Invalid reset '%v': must be 'via' or 'tuning'",
+
+	// 首次配置
+	"ERR_SETUP_DONE":    "Setup has already been completed",
+	"ERR_INVALID_SETUP": "Invalid setup: %v",
+
+	// agent 与同步
+	"ERR_AGENT_HUB_DISABLED":  "Agent hub not enabled",
+	"ERR_AGENT_NAME_REQUIRED": "Agent name required",
+	"ERR_AGENT_NOT_CONNECTED": "Agent not connected",
+	"ERR_FORWARD_NOT_FOUND":   "Forward not found",
+	"ERR_FETCH_ARGS_REQUIRED": "url and dest are required",
+	"ERR_SYNC_DISABLED":       "team sync is not configured (sync.source)",
+	"ERR_SYNC_FAILED":         "sync failed: %v",
+	"ERR_FETCH_FAILED":        "Fetch failed: %v",
+}
+
+const usageEn = `HSSH - High-performance SSH bastion tool
+
+Usage:
+  hssh [--lang en|zh-CN] [--timeout <d>] [--batch] [--quiet] [--config-dir <dir>] <command> [options]
+
+Commands:
+  init      First-run setup: add gateways and servers (tested as you go),
+            import ~/.ssh/config and generate a web admin token
+            --ssh-config <file>   OpenSSH config to import (default ~/.ssh/config)
+            --no-import           Do not offer to import the OpenSSH config
+            --no-check            Do not test connections while adding servers
+
+  connect   Open an interactive terminal on a server through its gateways
+            <name>                Server to connect to
+            -                     The server you last opened a terminal on
+            (none)                Pick from favorites and recently used servers
+            --via <hops>          Comma-separated intermediate hops (default: server's gateways)
+
+  upload    Upload file to remote server
+            --source <path>       Source file path
+            --target <host:path>  Target host and path, or s3://bucket/key@host, oss://bucket/key@host
+                                  or a presigned https:// URL@host to upload to object storage
+                                  with aws, ossutil or curl on that host
+            --via <hops>          Comma-separated intermediate hops (optional)
+            --delta               Send only changed blocks of a modified large file (rsync-like)
+            --mode <mode>         tunnel (default), relay (each gateway's ssh forwards to the next hop,
+                                  needs key login between hops), stage (upload to the last gateway's staging
+                                  directory, then the gateway pushes to the target over its LAN), or compare
+                                  (upload with tunnel and relay, print throughput)
+            --confirm <name>      Target server name; required for servers whose environment
+                                  policy guards uploads (prod by default), asked for otherwise
+            --retries <n>         Reconnect and resume up to n times after a failure (tunnel mode)
+            --retry-delay <dur>   Wait between retries (default 5s)
+                                  An interrupted upload resumes when rerun with the same arguments
+
+  download  Download a file or directory; directories are pulled as parallel tar streams
+            --source <host:path>  Remote file or directory
+            --target <path>       Local path
+            --via <hops>          Comma-separated intermediate hops (optional)
+            --streams <n>         Parallel streams for directories (default 4, max 16)
+            --verify              Compare sha256 with the remote after download
+            --manifest <file>     Write a JSON integrity manifest
+
+  fetch-dir Pack a remote directory into a temporary .tar.gz, download it and remove it
+            --source <host:path>  Remote directory
+            --target <path>       Local archive or directory (default ./<dir>.tar.gz)
+            --via <hops>          Comma-separated intermediate hops (optional)
+            --remote-tmp <dir>    Where the remote archive is written (default $TMPDIR or /tmp);
+                                  fails early if it has less free space than the directory uses
+
+  proxy     Create port forward to internal server
+            --local <addr>        Local listen address or port range such as 127.0.0.1:9000-9010
+                                  (default 127.0.0.1:0); localhost listens on 127.0.0.1 and ::1;
+                                  an absolute path listens on a unix socket
+            --remote <host:port>  Remote target, host:port-port for a range (repeatable);
+                                  paired in order with the local ports, or a random port each
+            --targets <file>      File with one remote target per line (# comments)
+            --remote-host <host>  Remote target host, or a unix socket path on the last hop
+            --remote-port <port>  Remote target port
+            --via <hops>          Comma-separated intermediate hops
+            --allow-lan           Allow a non-loopback address such as 0.0.0.0 (asks first)
+
+  probe     Probe network latency
+            --target <host>       Target host to probe
+            --via <hops>          Alternative hop chain to compare (repeatable)
+            --count <n>           Probes per path (default 3)
+            --port <port>         Check a TCP port from the chain's last hop instead
+            --json                Print the comparison as JSON
+            --watch               Re-probe and refresh the table until Ctrl+C
+            --interval <dur>      Refresh interval for --watch (default 10s)
+
+  trace     Trace the route segment by segment through the hop chain
+            --target <host>       Target server
+            --via <hops>          Comma-separated intermediate hops (default: target's gateways)
+            --json                Print the report as JSON
+
+  status    Show configuration status
+            --usage               Per-server sessions, uploads, traffic and tunnel hours,
+                                  busiest first (recorded by hssh web; gateways include
+                                  everything routed through them)
+            --days <n>            Days of usage to sum (default 30, max 90)
+            --json                Print usage as JSON
+            --watch               Live dashboard of server latency, tunnels and sessions;
+                                  read from a running hssh web, else probed locally
+            --interval <dur>      Refresh interval for --watch (default 10s)
+
+  export    Export history as CSV for capacity planning and monthly reports
+    latency                     Latency samples per server (kept in memory by a running hssh web)
+    transfers                   Uploads and directory fetches from the audit log
+    usage                       Sessions, transfers, bytes and tunnel time per server and day
+            --from <date>         Start date (YYYY-MM-DD) or RFC 3339 time
+            --to <date>           End date, inclusive (YYYY-MM-DD) or RFC 3339 time
+            --out <file>          Output file (default: standard output)
+
+  search    Search servers, portal mappings, transfer history and the audit log
+            <words...>            Every word must match (case-insensitive); best matches first
+            --type <a,b>          Only these types: server, mapping, transfer, audit
+            --days <n>            Only transfers and audit entries from the last n days
+            --limit <n>           Maximum number of results (default 50)
+            --json                Print results with per-type counts as JSON
+
+  hostkey   Manage SSH host keys in ~/.ssh/known_hosts
+    accept <name|id>            Connect and trust new or changed host keys of a server and
+                                its gateways, after showing their fingerprints
+      --fingerprint <SHA256:..> Expected fingerprint of the server's key (no prompt)
+      --yes                     Trust every offered key without asking
+    forget <name|id>            Remove a server's known_hosts entries
+
+  server    Manage server configurations
+    list                        List all servers
+      --q <text>                Only servers whose name, host, tags, environment or notes
+                                contain every word
+    show <name|id>              Show a server's details, notes, owner and runbook
+    notes <name|id>             Edit a server's notes (only the given flags change)
+      --description <text>      Free-form description
+      --owner <who>             Owning person or team
+      --contact <how>           How to reach the owner (mail, phone, chat)
+      --runbook <url>           Runbook link (http or https)
+      --location <where>        Rack, room or VM host/cluster
+      --field <key=value>       Custom field, e.g. asset=A-1024; empty value removes it (repeatable)
+      --clear                   Remove all notes first
+    add [user@host[:port]]      Add a server; the name defaults to the host's first label
+      --name <name>             Server name
+      --host <host>             Server host
+      --port <port>             Server port (default server_defaults.port or 22)
+      --user <user>             Username (default server_defaults.user)
+      --auth <type>             Auth type: key, password or agent (keys in SSH_AUTH_SOCK,
+                                including hardware-backed ones)
+      --key-path <path>         SSH key path (for key auth, default server_defaults.key_path)
+      --password <pass>         Password (for password auth)
+      --tags <a,b>              Tags, used to select servers for maintenance windows
+      --environment <env>       Environment label (prod, staging, dev); see environments in config
+      --client-version <ver>    SSH version string to send, e.g. OpenSSH_8.9p1 (for IPSes that
+                                drop unknown client banners)
+      --legacy-crypto           Allow deprecated algorithms (diffie-hellman sha1, CBC, hmac-sha1)
+                                for old switches and appliances; warned about in status
+      --agent-forwarding        Forward the local ssh-agent to terminals on this server, so
+                                commands there can log in onward with your keys. Also needs
+                                agent_forwarding.enabled in config; every use is audited
+      --host-key-policy <p>     Host key checking: tofu (record on first connect, default),
+                                strict (only keys accepted with hostkey accept) or off
+      --via <gateway>           Gateway the server is reached through (internal server)
+    clone <name|id>             Copy a server's auth, gateway, tags and terminal settings
+      --name <name>             Name of the copy
+      --host/--port/--user      Override the source's values
+    delete <name>               Move a server to the trash
+      --confirm <name>          Server name, when its environment policy guards deletes
+    trash                       List deleted servers
+    restore <name|id>           Restore a server from the trash
+    favorite <name>             Mark a server as a favorite (listed first by connect and the web UI)
+      --off                     Remove the mark
+    check [name...]             Test connectivity and auth; results show in server list
+      --all                     Check every server
+      --parallel <n>            Servers checked at once (default 8)
+      --json                    Print results as JSON
+
+  key       Manage SSH keys
+    generate                    Generate a key pair (prints the public key)
+      --type <type>             ed25519 (default), rsa or ecdsa
+      --bits <n>                Key size for rsa (default 4096) or ecdsa (default 256)
+      --comment <text>          Key comment
+      --out <path>              Private key path (default ~/.ssh/hssh_<type>)
+      --force                   Overwrite existing key files
+    deploy                      Append a public key to a server's authorized_keys
+      --server <name>           Server to deploy to (logs in with its current auth)
+      --key <path>              Private key path (default ~/.ssh/hssh_ed25519)
+      --switch                  Verify a key login, then switch the server to key auth
+    rotate [name...]            Move servers to a new key and remove the old public key
+      --all                     Rotate every server
+      --type <type>             New key type (default ed25519)
+      --out <path>              New private key path (default ~/.ssh/hssh_<type>_<time>)
+      --parallel <n>            Servers rotated at once (default 8)
+      --json                    Print results as JSON
+
+  config    Manage configuration storage
+    migrate-to-sqlite           Move ~/.gmssh/config.yaml into ~/.gmssh/config.db
+    sync                        Pull the team's shared topology now
+      --source <url>            Git repository or HTTPS URL (default: sync.source)
+    refs                        List references to servers that no longer exist
+    fix-refs                    Remove or repair dangling references
+    import-ssh                  Import hosts and ProxyJump chains from ~/.ssh/config
+      --file <path>             OpenSSH config file (default ~/.ssh/config)
+      --host <a,b>              Only these aliases and their gateways
+      --dry-run                 Show what would be imported without saving
+      --json                    Print the result as JSON
+
+  backup    Back up or restore all local state (config dir, secrets, audit log, known_hosts)
+    create                      Write a backup
+      --out <file>              Backup file (.tar.gz)
+      --passphrase-file <file>  Encrypt (AES-256-GCM); default GMSSH_BACKUP_PASSPHRASE, unencrypted if unset
+      --json                    Print the manifest as JSON
+    restore                     Restore a backup; known_hosts lines are merged
+      --in <file>               Backup file
+      --passphrase-file <file>  Passphrase of an encrypted backup (default GMSSH_BACKUP_PASSPHRASE)
+      --force                   Replace an existing config (previous files kept as .bak)
+      --dry-run                 Only verify the backup
+      --json                    Print the result as JSON
+
+  apply     Make servers, portal mappings and running proxies match a declarative state file
+            -f, --file <file>     State file (YAML: servers, mappings, proxies)
+            --prune               Delete entries created by apply that are no longer in the file
+            --dry-run             Print the plan only
+            --addr <host:port>    Web UI that runs the proxies (default: web.bind on this machine)
+            --token <token>       Admin token (default: GMSSH_AUTH_TOKEN or first admin in config)
+            --json                Print the plan and result as JSON
+
+  panic     Emergency stop: tell the running web UI to stop every forward, portal mapping,
+            terminal session and upload and disconnect all chains (recorded in the audit log)
+            --addr <host:port>    Web UI address (default: web.bind on this machine)
+            --token <token>       Admin token (default: GMSSH_AUTH_TOKEN or first admin in config)
+            --json                Print the result as JSON
+
+  web       Start web UI
+            --local               Run in local mode
+            --bind <addr>         Bind address (default 0.0.0.0:18081)
+            --status-only         Read-only status page, no auth (ops wall / sharing)
+            --no-browser          Do not open a browser with --local (headless)
+            --idle-exit <min>     Exit after <min> minutes with no sessions, transfers,
+                                  forwarders or requests (local helper use)
+            Serves /healthz and /readyz without auth; SIGTERM drains requests and exits
+
+  portal    High-performance port forwarding/tunneling
+            --server              Run in server mode
+            --client              Run in client mode
+            --listen <addr>       Server listen address (default :18888)
+            --token <token>       Auth token
+            --local <addr>        Local listen address (client)
+            --remote <host:port>  Remote target (client)
+            --server-addr <addr>  Portal server address (client)
+            --allow-lan           Allow a non-loopback --local address (client, asks first)
+            --health-listen <addr> Serve /healthz and /readyz over HTTP (server)
+
+  agent     Register with a control plane and relay transfers/forwards inside the DC
+            --hub <addr>          Control plane agent address
+            --token <token>       Auth token
+            --name <name>         Agent name (default hostname)
+            --fetch-dir <dir>     Directory for fetch tasks
+            --allow <cidrs>       Allowed forward targets
+            --fingerprint <hex>   Pin control plane certificate
+
+Language:
+  --lang, or GMSSH_LANG / LANG, selects en or zh-CN output
+
+Configuration overrides (containers):
+  Flag / environment variable                 config.yaml       Default
+  --config-dir <dir>  / GMSSH_CONFIG_DIR      -                 ~/.gmssh
+  --log-level <level> / GMSSH_LOG_LEVEL       log_level         info (also warn, error, off)
+  --temp-dir <dir>    / GMSSH_TEMP_DIR        upload.temp_dir   system temp dir
+  --netem <spec>      / GMSSH_NETEM           debug_netem       off (debug only, e.g. delay=100ms,jitter=20ms,loss=1%)
+  web --bind <addr>   / GMSSH_WEB_BIND        web.bind          0.0.0.0:18081
+  portal --token      / GMSSH_AUTH_TOKEN      -                 (web: adds an admin with this token)
+  A flag wins over the environment variable, which wins over config.yaml.
+  Overrides apply to this process only and are never saved.
+
+Scripting (CI):
+  --timeout <d>   Give up after a duration such as 30s or 5m (proxy: connecting only;
+                  not used by web, portal and agent)
+  --batch         Never ask for input; fail where a confirmation would be needed
+  --quiet         Print only JSON results on stdout (implies --batch); errors go to stderr
+
+Exit codes:
+  0  success                      5  transfer or key rotation failed
+  1  other error                  6  target unreachable (probe, trace)
+  2  invalid arguments            7  --timeout exceeded
+  3  server not in config         8  confirmation needed in batch mode
+  4  connect or auth failed, or a server check failed
+  9  server is in a maintenance window (upload, download, fetch-dir)
+  10 upload rejected by upload.policy (size, extension or scan command)
+
+Examples:
+  # Compare two bastion chains to the same server
+  hssh probe --target internal --via bastion-hk,gateway --via bastion-sg,gateway
+
+  # Check whether MySQL on internal-db is reachable from the gateway
+  hssh probe --target internal-db --port 3306 --via gateway
+
+  # Upload file directly
+  hssh upload --source ./file.txt --target gateway:/data/
+
+  # Upload via bastion
+  hssh upload --source ./file.txt --target internal:/data/ --via bastion-hk,gateway
+
+  # Re-upload a modified disk image, sending only the changed blocks
+  hssh upload --source ./vm.qcow2 --target internal:/images/ --via gateway --delta
+
+  # Compare tunnel and relay throughput over a 3-hop chain
+  hssh upload --source ./build.tgz --target internal:/data/ --via bastion-hk,gateway --mode compare
+
+  # Upload a backup to S3 from inside the private network, using the aws CLI on gateway
+  hssh upload --source ./db.dump --target s3://backups/db/@gateway
+
+  # Download a log directory in 8 parallel streams, verify checksums and keep a manifest
+  hssh download --source internal:/var/log/app --target ./logs --via gateway --streams 8 --verify --manifest logs.json
+
+  # Fetch a directory of many small files as a single compressed archive
+  hssh fetch-dir --source internal:/var/log/app --via gateway --remote-tmp /data/tmp
+
+  # Reconnect to the server you used last
+  hssh connect -
+
+  # Port forward to internal database
+  hssh proxy --local :3306 --remote-host internal-db --remote-port 3306 --via gateway
+
+  # Forward local ports 9000-9002 to three internal web servers
+  hssh proxy --local localhost:9000-9002 --remote web1:80 --remote web2:80 --remote web3:80 --via gateway
+
+  # Forward local port 5432 to the PostgreSQL socket on the database server
+  hssh proxy --local :5432 --remote /var/run/postgresql/.s.PGSQL.5432 --via gateway,db
+
+  # Add a server
+  hssh server add --name gateway --host gw.example.com --user admin --auth key --key-path ~/.ssh/id_rsa
+
+  # Check every server, 16 at a time (exits 4 if any fails)
+  hssh server check --all --parallel 16
+
+  # Where did report.xlsx go last week?
+  hssh search report.xlsx --type transfer --days 7
+
+  # Last month's per-server usage for the capacity report
+  hssh export usage --from 2026-09-01 --to 2026-09-30 --out usage-september.csv
+
+  # A reinstalled server presents a new host key; compare it with the console and trust it
+  hssh hostkey accept web-1 --fingerprint SHA256:...
+
+  # Put a new key on a password-auth server and switch it to key auth
+  hssh key generate
+  hssh key deploy --server gateway --switch
+
+  # Rotate every server to a fresh key (exits 5 if any server was not rotated)
+  hssh key rotate --all
+
+  # In CI: upload with a 10 minute limit, never prompt, print only a JSON result
+  hssh --timeout 10m --quiet upload --source ./build.tgz --target internal:/data/ --via gateway
+
+  # Start portal server
+  hssh portal --server --listen :18888 --token my-token
+
+  # Start portal client
+  hssh portal --client --local :8080 --remote 192.168.1.10:80 --server-addr portal.example.com:18888
+
+  # Run agent on a gateway
+  hssh agent --hub control.example.com:18889 --token my-token --fetch-dir /data/incoming`
@@ -0,0 +1,126 @@
+// Package i18n CLI 和 API 消息的本地化
+// 每条消息有一个稳定的代码（如 ERR_HOP_NOT_FOUND），各语言的消息目录把代码映射为文本；
+// 脚本应按代码判断，文本会随语言变化
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Lang 语言标签
+type Lang string
+
+const (
+	En   Lang = "en"
+	ZhCN Lang = "zh-CN"
+)
+
+// Supported 支持的语言
+var Supported = []Lang{En, ZhCN}
+
+// defaultLang 进程默认语言，CLI 由 --lang 或环境变量决定，Web 服务在请求未指定语言时使用
+var defaultLang atomic.Value
+
+func init() {
+	defaultLang.Store(En)
+}
+
+// SetDefault 设置进程默认语言，不支持的语言被忽略
+func SetDefault(lang Lang) {
+	if lang != "" {
+		defaultLang.Store(lang)
+	}
+}
+
+// Default 返回进程默认语言
+func Default() Lang {
+	return defaultLang.Load().(Lang)
+}
+
+// Parse 把语言标签或 locale（zh、zh_CN.UTF-8、en-US 等）归一为支持的语言，无法识别时返回空
+func Parse(tag string) Lang {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, ".@"); i >= 0 {
+		tag = tag[:i]
+	}
+	tag = strings.ReplaceAll(tag, "_", "-")
+	switch {
+	case tag == "zh" || strings.HasPrefix(tag, "zh-"):
+		return ZhCN
+	case tag == "en" || strings.HasPrefix(tag, "en-"):
+		return En
+	}
+	return ""
+}
+
+// Detect 从环境变量确定 CLI 语言：GMSSH_LANG、LC_ALL、LC_MESSAGES、LANG 依次优先，均无法识别时为英文
+func Detect() Lang {
+	for _, key := range []string{"GMSSH_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if lang := Parse(os.Getenv(key)); lang != "" {
+			return lang
+		}
+	}
+	return En
+}
+
+// FromAcceptLanguage 按 q 值从 Accept-Language 头中选出第一个支持的语言，没有时返回空
+func FromAcceptLanguage(header string) Lang {
+	type candidate struct {
+		lang Lang
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if lang := Parse(tag); lang != "" && q > 0 {
+			candidates = append(candidates, candidate{lang, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[0].lang
+}
+
+// T 返回 code 在 lang 下的文本，args 按 fmt 格式填入
+// 缺少翻译时回退到英文，仍没有时返回代码本身
+func T(lang Lang, code string, args ...interface{}) string {
+	format, ok := catalogs[lang][code]
+	if !ok {
+		format, ok = catalogs[En][code]
+	}
+	if !ok {
+		if len(args) > 0 {
+			return code + ": " + fmt.Sprint(args...)
+		}
+		return code
+	}
+	// 不带参数的消息忽略多余的参数
+	if len(args) == 0 || !strings.Contains(format, "%") {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Sprintf 以默认语言返回 code 的文本
+func Sprintf(code string, args ...interface{}) string {
+	return T(Default(), code, args...)
+}
+
+// catalogs 各语言的消息目录
+var catalogs = map[Lang]map[string]string{
+	En:   en,
+	ZhCN: zhCN,
+}
@@ -0,0 +1,98 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestCatalogsHaveSameCodes(t *testing.T) {
+	verbs := regexp.MustCompile(`%[vsdq]`)
+	for code, format := range en {
+		translated, ok := zhCN[code]
+		if !ok {
+			t.Errorf("zh-CN catalog is missing %s", code)
+			continue
+		}
+		if got, want := len(verbs.FindAllString(translated, -1)), len(verbs.FindAllString(format, -1)); got != want {
+			t.Errorf("%s: zh-CN has %d format verbs, en has %d", code, got, want)
+		}
+	}
+	for code := range zhCN {
+		if _, ok := en[code]; !ok {
+			t.Errorf("en catalog is missing %s", code)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want Lang
+	}{
+		{"zh", ZhCN},
+		{"zh-CN", ZhCN},
+		{"zh_CN.UTF-8", ZhCN},
+		{"ZH-tw", ZhCN},
+		{"en", En},
+		{"en_US.UTF-8", En},
+		{"C", ""},
+		{"fr-FR", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.tag); got != tt.want {
+			t.Errorf("Parse(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestFromAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   Lang
+	}{
+		{"zh-CN,zh;q=0.9,en;q=0.8", ZhCN},
+		{"fr-FR, en;q=0.5, zh;q=0.7", ZhCN},
+		{"en-US,en;q=0.9", En},
+		{"zh;q=0, en", En},
+		{"fr", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := FromAcceptLanguage(tt.header); got != tt.want {
+			t.Errorf("FromAcceptLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	for _, key := range []string{"GMSSH_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		t.Setenv(key, "")
+	}
+	if got := Detect(); got != En {
+		t.Errorf("Detect() with no locale = %q, want en", got)
+	}
+	t.Setenv("LANG", "zh_CN.UTF-8")
+	if got := Detect(); got != ZhCN {
+		t.Errorf("Detect() with LANG = %q, want zh-CN", got)
+	}
+	t.Setenv("GMSSH_LANG", "en")
+	if got := Detect(); got != En {
+		t.Errorf("GMSSH_LANG should override LANG, got %q", got)
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T(ZhCN, "ERR_UNKNOWN_HOP", "db"); got != "未知的服务器：db" {
+		t.Errorf("zh-CN: %q", got)
+	}
+	if got := T(En, "ERR_UNKNOWN_HOP", "db"); got != "Unknown hop: db" {
+		t.Errorf("en: %q", got)
+	}
+	if got := T("fr", "ERR_HOP_NOT_FOUND"); got != "Server not found" {
+		t.Errorf("unsupported language should fall back to en: %q", got)
+	}
+	if got := T(En, "ERR_DOES_NOT_EXIST"); got != "ERR_DOES_NOT_EXIST" {
+		t.Errorf("unknown code: %q", got)
+	}
+}
@@ -0,0 +1,544 @@
+package i18n
+
+// zhCN 简体中文消息目录
+var zhCN = map[string]string{
+	// CLI
+	"CLI_ERROR":                   "错误：%v",
+	"CLI_WARNING_TRACING":         "警告：追踪已禁用：%v",
+	"CLI_WARNING_LOG_LEVEL":       "警告：忽略 log_level：%v",
+	"CLI_WARNING_NETEM":           "警告：忽略 debug_netem：%v",
+	"CLI_UNKNOWN_COMMAND":         "未知命令：%s",
+	"CLI_UNKNOWN_SUBCOMMAND":      "未知的 %s 子命令：%s",
+	"CLI_SERVER_SUBCOMMAND":       "缺少 server 子命令（add、list、delete、trash、restore、check）",
+	"CLI_KEY_SUBCOMMAND":          "缺少 key 子命令（generate、deploy、rotate）",
+	"CLI_KEY_SERVER_REQUIRED":     "缺少 --server",
+	"CLI_CONFIG_SUBCOMMAND":       "缺少 config 子命令（migrate-to-sqlite、sync、refs、fix-refs、import-ssh）",
+	"CLI_BACKUP_SUBCOMMAND":       "缺少 backup 子命令（create、restore）",
+	"CLI_BACKUP_FILE_REQUIRED":    "缺少 %s <文件>",
+	"CLI_UPLOAD_ARGS_REQUIRED":    "必须指定 source 和 target",
+	"CLI_DOWNLOAD_ARGS_REQUIRED":  "必须指定 source（host:path）和 target",
+	"CLI_FETCH_DIR_ARGS_REQUIRED": "必须指定 source（host:path）",
+	"CLI_PROXY_ARGS_REQUIRED":     "必须指定远程目标：--remote、--targets 或 --remote-host 加 --remote-port",
+	"CLI_APPLY_FILE_REQUIRED":     "必须用 -f 指定状态文件",
+	"CLI_HOP_NAME_REQUIRED":       "缺少服务器名称",
+	"CLI_HOP_NAME_OR_ID_REQUIRED": "缺少服务器名称或 ID",
+	"CLI_CHECK_TARGET_REQUIRED":   "缺少服务器名称或 --all",
+	"CLI_EXPORT_KIND_REQUIRED":    "缺少导出类型：latency、transfers 或 usage",
+	"CLI_SEARCH_QUERY_REQUIRED":   "缺少搜索词",
+	"CLI_HOSTKEY_USAGE":           "用法：hostkey accept|forget <服务器>",
+	"CLI_INVALID_GLOBAL_FLAG":     "%v（参见 hssh help）",
+	"CLI_WEB_STARTING":            "Web 界面已启动：http://%s",
+	"CLI_STATUS_STARTING":         "只读状态页已启动：http://%s",
+	"CLI_BROWSER_FAILED":          "无法打开浏览器（%v），可使用 --no-browser 跳过",
+	"CLI_USAGE":                   usageZhCN,
+
+	// 通用
+	"ERR_NOT_FOUND":       "未找到",
+	"ERR_INVALID_BODY":    "请求体无效：%v",
+	"ERR_INVALID_FORM":    "表单解析失败：%v",
+	"ERR_SAVE_CONFIG":     "保存配置失败：%v",
+	"ERR_CONFIG_FROZEN":   "配置已从备份恢复，重启 gmssh 后才能修改",
+	"ERR_NAME_REQUIRED":   "缺少名称",
+	"ERR_TARGET_REQUIRED": "缺少目标",
+	"ERR_INVALID_PARAM":   "参数 %s 无效：%v",
+	"ERR_PATH_REQUIRED":   "缺少路径",
+	"ERR_INVALID_PORT":    "端口必须在 1-65535 之间",
+	"ERR_INTERNAL":        "内部错误：%v",
+	"ERR_ALREADY_EXISTS":  "已存在：%v",
+	"ERR_TIMEOUT":         "超时：%v",
+
+	// 认证
+	"ERR_AUTH_REQUIRED":      "需要登录",
+	"ERR_INVALID_TOKEN":      "令牌无效",
+	"ERR_ADMIN_REQUIRED":     "需要管理员权限",
+	"ERR_ORIGIN_NOT_ALLOWED": "不允许的来源",
+	"ERR_CSRF_INVALID":       "CSRF 令牌缺失或无效",
+	"ERR_CSRF_TOKEN_FAILED":  "生成 CSRF 令牌失败",
+
+	// 服务器
+	"ERR_HOP_NOT_FOUND":           "服务器不存在",
+	"ERR_HOP_ID_REQUIRED":         "缺少服务器 ID",
+	"ERR_HOP_FIELDS_REQUIRED":     "名称、主机和用户不能为空",
+	"ERR_CLONE_NAME_REQUIRED":     "副本的名称不能为空",
+	"ERR_INVALID_ADDRESS":         "连接串无效：%v",
+	"ERR_INVALID_RECENT_KIND":     "无效的种类 '%s'：只能是 'terminal' 或 'upload'",
+	"ERR_INVALID_AUTH_TYPE":       "认证方式 '%s' 无效：只能是 key、password 或 agent",
+	"ERR_GATEWAY_REQUIRED":        "内网服务器必须配置网关",
+	"ERR_GATEWAY_NOT_FOUND":       "网关不存在",
+	"ERR_UNKNOWN_TERMINAL_PRESET": "终端预设不存在：%s",
+	"ERR_INVALID_TERMINAL":        "终端设置无效：%v",
+	"ERR_INVALID_CLIENT_VERSION":  "SSH 客户端版本串无效：%v",
+	"ERR_INVALID_NOTES":           "服务器说明信息无效：%v",
+	"ERR_INVALID_HOST_KEY":        "主机密钥设置无效：%v",
+	"ERR_HOST_KEY_NOT_PENDING":    "%s 没有待确认的主机密钥",
+	"ERR_HOST_KEY_FINGERPRINT":    "指纹 %s 与待确认的主机密钥不一致",
+	"ERR_UNKNOWN_HOP":             "未知的服务器：%s",
+	"ERR_HOP_HAS_DEPENDENTS":      "无法删除 '%s'：仍被 %s 引用",
+	"ERR_TRASH_NOT_FOUND":         "回收站中没有该服务器",
+	"ERR_FIX_REFERENCES":          "修复引用失败：%v",
+	"ERR_SSH_CONFIG":              "读取 SSH 配置失败：%v",
+	"ERR_ROUTE_FIELDS_REQUIRED":   "必须指定起点和终点",
+
+	// 链路
+	"ERR_NO_HOPS":                "没有可用的 SSH 跳板，请配置 Via",
+	"ERR_LIST_SESSIONS":          "列出远端会话失败：%v",
+	"ERR_INVALID_PATTERN":        "过滤表达式无效：%v",
+	"ERR_TAIL":                   "启动 tail 失败：%v",
+	"ERR_LIST_PROCESSES":         "列出进程失败：%v",
+	"ERR_LIST_PORTS":             "列出监听端口失败：%v",
+	"ERR_KILL_UNCONFIRMED":       "confirm 必须为进程列表中该进程的启动时间",
+	"ERR_KILL_FAILED":            "向进程发送信号失败：%v",
+	"ERR_PROCESS_CHANGED":        "进程已退出或 PID 已被复用，请刷新进程列表",
+	"ERR_KEY_GENERATE":           "生成密钥失败：%v",
+	"ERR_UNSUPPORTED_KEY_TYPE":   "不支持的密钥类型或长度：%v",
+	"ERR_KEY_EXISTS":             "密钥文件已存在：%v",
+	"ERR_KEY_READ":               "无法读取公钥：%v",
+	"ERR_KEY_DEPLOY":             "部署密钥失败：%v",
+	"ERR_KEY_VERIFY":             "使用密钥登录 %s 失败，认证方式未修改：%v",
+	"ERR_PRIVATE_KEY_READ":       "无法读取私钥：%v",
+	"ERR_KEY_NOT_ENCRYPTED":      "%s 使用的不是加密的私钥",
+	"ERR_KEY_PASSPHRASE_WRONG":   "%s 的私钥口令错误",
+	"ERR_ROTATE_TARGET_REQUIRED": "必须指定 ids 或 all",
+	"ERR_BUILD_CHAIN":            "构建跳板链失败：%v",
+	"ERR_CHAIN_CONNECT":          "连接 SSH 链失败：%v",
+	"ERR_CHAIN_CONFIG":           "%s 的 SSH 配置无效：%v",
+	"ERR_CHAIN_KEY_PASSPHRASE":   "%s 的私钥需要口令：%v",
+	"ERR_CHAIN_DIAL_FAILED":      "无法连接 %s：%v",
+	"ERR_CHAIN_HOST_KEY":         "%s 的主机密钥校验失败：%v",
+	"ERR_CHAIN_AUTH_FAILED":      "%s 认证失败：%v",
+	"ERR_CHAIN_HANDSHAKE_FAILED": "与 %s 的 SSH 握手失败：%v",
+
+	// 上传
+	"ERR_TASK_NOT_FOUND":         "任务不存在",
+	"ERR_TASK_ID_REQUIRED":       "缺少 task_id",
+	"ERR_UPLOAD_TARGET_REQUIRED": "必须指定 target_path 和 target_host",
+	"ERR_INVALID_OBJECT_TARGET":  "无效的对象存储目标：%v",
+	"ERR_INVALID_UPLOAD_MODE":    "无效的上传模式：%v",
+	"ERR_FETCH_DIR_REQUIRED":     "必须指定 server 和 path",
+	"ERR_FETCH_DIR_FAILED":       "打包下载目录失败：%v",
+	"ERR_FETCH_NOT_READY":        "压缩包尚未就绪（任务状态为 %s）",
+	"ERR_EDIT_NOT_FOUND":         "文件不存在",
+	"ERR_EDIT_NOT_REGULAR":       "路径不是普通文件",
+	"ERR_EDIT_TOO_LARGE":         "文件超过 %d 字节，不能在线编辑",
+	"ERR_EDIT_BINARY":            "文件不是 UTF-8 文本",
+	"ERR_EDIT_CONFLICT":          "文件在读取后已被修改，请重新加载后再编辑",
+	"ERR_EDIT_FAILED":            "编辑文件失败：%v",
+	"ERR_OVERWRITE_CONFIRM":      "%s 已存在，请确认 diff 后带 force=1 重新提交以覆盖",
+	"ERR_OVERWRITE_DIFF_FAILED":  "读取远端文件以生成 diff 失败：%v",
+	"ERR_BACKUP_LIST_FAILED":     "列出备份失败：%v",
+	"ERR_BACKUP_NOT_FOUND":       "备份 %s 不存在",
+	"ERR_BACKUP_RESTORE_FAILED":  "恢复备份失败：%v",
+	"ERR_NO_FILE":                "获取文件失败：请求中没有文件",
+	"ERR_NO_FILES":               "目录上传中没有文件",
+	"ERR_STAGING":                "创建临时目录失败：%v",
+	"ERR_STAGING_SCAN":           "检查暂存区失败：%v",
+	"ERR_UPLOAD_FAILED":          "上传失败：%v",
+	"ERR_UPLOAD_POLICY":          "上传被策略拒绝（%s）：%s：%s",
+	"ERR_STAGE_QUOTA":            "网关暂存目录超过配额：%v",
+	"ERR_TARGET_NOT_WRITABLE":    "登录用户无法写入目标路径：%v",
+	"ERR_UPLOAD_NOT_FOUND":       "上传不存在或已过期",
+	"ERR_UPLOAD_OFFSET_MISMATCH": "Upload-Offset %d 与已接收的大小 %d 不一致",
+	"ERR_UPLOAD_BUSY":            "该上传的另一个分块仍在接收中，请稍后重试",
+	"ERR_UPLOAD_TOO_LARGE":       "分块超出了声明的上传大小 %d 字节",
+	"ERR_UPLOAD_INCOMPLETE":      "上传未完成：已接收 %d / %d 字节",
+	"ERR_UPLOAD_CHUNK":           "接收分块失败：%v",
+	"ERR_STATE_BACKUP_FAILED":    "创建备份失败：%v",
+	"ERR_STATE_RESTORE_FAILED":   "恢复备份失败：%v",
+	"ERR_STATE_PASSPHRASE":       "备份口令缺失或错误：%v",
+	"ERR_STATE_CONFIG_EXISTS":    "本机已有配置，替换需要 force=true",
+
+	// 转发
+	"ERR_PROXY_NOT_FOUND":         "转发不存在",
+	"ERR_FORWARD_FIELDS_REQUIRED": "必须指定 local_addr、remote_host 和 remote_port",
+	"ERR_REMOTE_REQUIRED":         "必须指定 remote_host 和 remote_port（remote_host 也可以是 unix socket 路径）",
+	"ERR_LOCAL_ADDR_REQUIRED":     "缺少 local_addr",
+	"ERR_FORWARDER_START":         "启动转发失败：%v",
+	"ERR_MAPPING_NOT_FOUND":       "映射不存在",
+	"ERR_MAPPING_RUNNING":         "映射已在运行",
+	"ERR_PROXY_STOP":              "停止转发失败：%v",
+	"ERR_INVALID_LOCAL_ADDR":      "local_addr 无效：%v",
+	"ERR_PORT_IN_USE":             "%s 已被 %s %s 占用",
+	"ERR_PORT_RANGE_EXHAUSTED":    "%d-%d 范围内没有空闲端口",
+	"ERR_LAN_BIND_DISABLED":       "未允许监听本机以外可访问的地址（ports.allow_lan）：%v",
+	"ERR_LAN_BIND_UNCONFIRMED":    "需要设置 allow_lan 确认把转发暴露给其他机器：%v",
+	"ERR_INVALID_RESOLVER":        "解析方式无效：%v",
+	"ERR_INVALID_IDLE_THRESHOLD":  "threshold 无效 %q：须为正的时长，如 30m",
+	"ERR_INVALID_MAX_DURATION":    "max_duration 无效 %q：须为正的时长，如 1h",
+
+	// 终端会话
+	"ERR_SESSION_NOT_FOUND":   "会话不存在",
+	"ERR_SESSION_ID_REQUIRED": "缺少会话 ID",
+
+	// 活动连接
+	"ERR_CONNECTION_NOT_FOUND": "连接不存在：%v",
+
+	// 维护窗口
+	"ERR_MAINTENANCE":           "%v 正在维护，直到 %v%v",
+	"ERR_INVALID_MAINTENANCE":   "维护窗口无效：%v",
+	"ERR_MAINTENANCE_NOT_FOUND": "维护窗口不存在",
+
+	// 环境策略
+	"ERR_CONFIRM_REQUIRED": "%v 操作需要确认：%v 属于 %v 环境，请在 X-Confirm-Server 请求头中填写服务器名称",
+
+	// 审批
+	"ERR_APPROVAL_NOT_FOUND": "审批请求不存在",
+	"ERR_APPROVAL_SELF":      "不能批准自己的请求，须由另一名操作员批准",
+	"ERR_APPROVAL_DECIDED":   "审批请求已是 %v 状态",
+	"ERR_APPROVAL_DENIED":    "访问 %v 的请求被 %v 拒绝%v",
+	"ERR_APPROVAL_EXPIRED":   "访问 %v 的请求在 %v 前未获批准",
+	"ERR_APPROVAL_CANCELED":  "访问 %v 的审批请求已取消",
+
+	// 插件
+	"ERR_PLUGIN_REJECTED": "被插件 '%v' 拒绝：%v",
+
+	// 路径学习
+	"ERR_PLAYBOOK_NOT_FOUND":     "尚未为 %v 学到任何参数",
+	"ERR_INVALID_PLAYBOOK_FIELD": "无效的 reset '%v'：只能是 'via' 或 'tuning'",
+
+	// 首次配置
+	"ERR_SETUP_DONE":    "已完成首次配置",
+	"ERR_INVALID_SETUP": "首次配置无效：%v",
+
+	// agent 与同步
+	"ERR_AGENT_HUB_DISABLED":  "未启用 agent 控制面",
+	"ERR_AGENT_NAME_REQUIRED": "缺少 agent 名称",
+	"ERR_AGENT_NOT_CONNECTED": "agent 未连接",
+	"ERR_FORWARD_NOT_FOUND":   "转发不存在",
+	"ERR_FETCH_ARGS_REQUIRED": "必须指定 url 和 dest",
+	"ERR_SYNC_DISABLED":       "未配置团队同步（sync.source）",
+	"ERR_SYNC_FAILED":         "同步失败：%v",
+	"ERR_FETCH_FAILED":        "拉取失败：%v",
+}
+
+const usageZhCN = `HSSH - 高性能 SSH 跳板工具
+
+用法：
+  hssh [--lang en|zh-CN] [--timeout <d>] [--batch] [--quiet] [--config-dir <dir>] <命令> [选项]
+
+命令：
+  init      首次配置向导：添加网关和服务器（添加时测试连接），
+            导入 ~/.ssh/config 并生成 Web 管理员令牌
+            --ssh-config <file>   要导入的 OpenSSH 配置（默认 ~/.ssh/config）
+            --no-import           不询问导入 OpenSSH 配置
+            --no-check            添加服务器时不测试连接
+
+  connect   经服务器的网关打开交互式终端
+            <name>                要连接的服务器
+            -                     最近一次打开过终端的服务器
+            （不填）              从收藏和最近使用的服务器中选择
+            --via <hops>          逗号分隔的中间跳（默认为服务器的网关）
+
+  upload    上传文件到远程服务器
+            --source <path>       源文件路径
+            --target <host:path>  目标主机和路径；s3://bucket/key@host、oss://bucket/key@host
+                                  或预签名 https:// URL@host 时由该主机上的 aws、ossutil 或 curl
+                                  上传到对象存储
+            --via <hops>          逗号分隔的中间跳板（可选）
+            --delta               修改过的大文件只发送变化的块（类似 rsync）
+            --mode <mode>         tunnel（默认）、relay（由各网关的 ssh 逐跳转发，需要各跳之间能用密钥登录）
+                                  、stage（先上传到最后一个网关的暂存目录，再由网关经内网推送到目标）
+                                  或 compare（以 tunnel 和 relay 各上传一次并输出吞吐）
+            --confirm <name>      目标服务器名称；环境策略要求确认上传的服务器（默认 prod）
+                                  未指定时在终端上要求输入
+            --retries <n>         失败后重新连接并续传，最多 n 次（tunnel 模式）
+            --retry-delay <dur>   两次重试之间的等待时间（默认 5s）
+                                  中断的上传以相同参数重新运行时续传
+
+  download  下载文件或目录，目录拆成多个 tar 流并行拉取
+            --source <host:path>  远程文件或目录
+            --target <path>       本地路径
+            --via <hops>          逗号分隔的中间跳板（可选）
+            --streams <n>         目录下载的并行流数（默认 4，最多 16）
+            --verify              下载后与远端比对 sha256
+            --manifest <file>     写入 JSON 完整性清单
+
+  fetch-dir 在远端把目录打包为临时 .tar.gz，下载后删除远端临时文件
+            --source <host:path>  远程目录
+            --target <path>       本地压缩包或目录（默认 ./<目录名>.tar.gz）
+            --via <hops>          逗号分隔的中间跳板（可选）
+            --remote-tmp <dir>    远端压缩包的存放目录（默认 $TMPDIR 或 /tmp）；
+                                  可用空间小于目录占用时直接失败
+
+  proxy     创建到内网服务器的端口转发
+            --local <addr>        本地监听地址或端口范围，如 127.0.0.1:9000-9010
+                                  （默认 127.0.0.1:0）；localhost 同时监听 127.0.0.1 和 ::1；
+                                  绝对路径表示监听 unix socket
+            --remote <host:port>  远程目标，host:port-port 表示端口范围（可重复）；
+                                  按顺序与本地端口配对，本地端口为 0 时各用一个随机端口
+            --targets <file>      远程目标列表文件，每行一个（# 开头为注释）
+            --remote-host <host>  远程目标主机，或最后一跳上的 unix socket 路径
+            --remote-port <port>  远程目标端口
+            --via <hops>          逗号分隔的中间跳板
+            --allow-lan           允许监听 0.0.0.0 等本机以外可访问的地址（需确认）
+
+  probe     探测网络延迟
+            --target <host>       要探测的目标主机
+            --via <hops>          要对比的另一条跳板链（可重复）
+            --count <n>           每条路径的探测次数（默认 3）
+            --port <port>         改为从跳板链最后一跳检查 TCP 端口
+            --json                以 JSON 输出对比结果
+            --watch               持续重新探测并刷新对比表，Ctrl+C 退出
+            --interval <dur>      --watch 的刷新间隔（默认 10s）
+
+  trace     沿跳板链逐段追踪路由
+            --target <host>       目标服务器
+            --via <hops>          逗号分隔的中间跳板（默认使用目标的网关链）
+            --json                以 JSON 输出结果
+
+  status    显示配置状态
+            --usage               各服务器的终端会话、上传、流量和隧道时长，按负载从高到低
+                                  （由 hssh web 记录；网关包含经过它的全部使用）
+            --days <n>            统计的天数（默认 30，最多 90）
+            --json                以 JSON 输出使用量
+            --watch               实时面板：服务器延迟、转发和终端会话；
+                                  本机运行着 hssh web 时读取它的数据，否则在本地探测
+            --interval <dur>      --watch 的刷新间隔（默认 10s）
+
+  export    把历史数据导出为 CSV，用于容量规划和月度报表
+    latency                     各服务器的延迟样本（保存在运行中的 hssh web 的内存中）
+    transfers                   审计日志中的上传和打包下载记录
+    usage                       各服务器每天的终端会话、传输、流量和隧道时长
+            --from <date>         开始日期（YYYY-MM-DD）或 RFC 3339 时间
+            --to <date>           结束日期（含当天，YYYY-MM-DD）或 RFC 3339 时间
+            --out <file>          输出文件（默认输出到标准输出）
+
+  search    搜索服务器、Portal 映射、传输记录和审计日志
+            <words...>            每个词都须匹配（不区分大小写），最相关的在前
+            --type <a,b>          只返回这些类型：server、mapping、transfer、audit
+            --days <n>            只搜索最近 n 天的传输和审计记录
+            --limit <n>           最多返回的结果数（默认 50）
+            --json                以 JSON 输出结果和各类型的匹配数
+
+  hostkey   管理 ~/.ssh/known_hosts 中的主机密钥
+    accept <name|id>            连接服务器及其网关，显示指纹后信任新的或已变化的主机密钥
+      --fingerprint <SHA256:..> 服务器密钥应有的指纹（不再询问）
+      --yes                     不询问，信任所有提供的密钥
+    forget <name|id>            删除服务器在 known_hosts 中的记录
+
+  server    管理服务器配置
+    list                        列出所有服务器
+      --q <text>                只列出名称、地址、标签、环境或说明信息包含每个词的服务器
+    show <name|id>              显示服务器的详细信息、说明、负责人和运维手册
+    notes <name|id>             修改服务器的说明信息（只修改给出的选项）
+      --description <text>      说明
+      --owner <who>             负责人或团队
+      --contact <how>           联系方式（邮箱、电话、IM）
+      --runbook <url>           运维手册链接（http 或 https）
+      --location <where>        机房、机柜或虚拟机所在的宿主/集群
+      --field <key=value>       自定义字段，如 asset=A-1024；值为空时删除（可重复）
+      --clear                   先清空全部说明信息
+    add [user@host[:port]]      添加服务器；未指定名称时取主机名的第一段
+      --name <name>             服务器名称
+      --host <host>             服务器地址
+      --port <port>             端口（默认 server_defaults.port 或 22）
+      --user <user>             用户名（默认 server_defaults.user）
+      --auth <type>             认证方式：key、password 或 agent（使用 SSH_AUTH_SOCK 中的密钥，含硬件密钥）
+      --key-path <path>         SSH 私钥路径（key 认证，默认 server_defaults.key_path）
+      --password <pass>         密码（password 认证）
+      --tags <a,b>              标签，维护窗口可按标签选择服务器
+      --environment <env>       环境标签（prod、staging、dev），见配置中的 environments
+      --client-version <ver>    发送的 SSH 版本串，如 OpenSSH_8.9p1（用于只放行特定客户端的 IPS）
+      --legacy-crypto           允许已弃用的算法（diffie-hellman sha1、CBC、hmac-sha1），用于老旧交换机
+                                等设备；status 中会给出警告
+      --agent-forwarding        在该服务器的终端中转发本机 ssh-agent，以便在服务器上继续用本机
+                                密钥登录其他机器；还需配置 agent_forwarding.enabled，每次使用都写入审计日志
+      --host-key-policy <p>     主机密钥校验：tofu（首次连接时记录，默认）、strict（只接受
+                                通过 hostkey accept 确认的密钥）或 off
+      --via <gateway>           经过的网关（作为内网服务器）
+    clone <name|id>             复制服务器的认证、网关、标签和终端设置
+      --name <name>             副本名称
+      --host/--port/--user      覆盖原服务器的值
+    delete <name>               把服务器移入回收站
+      --confirm <name>          服务器名称，环境策略要求确认删除时使用
+    trash                       列出已删除的服务器
+    restore <name|id>           从回收站恢复服务器
+    favorite <name>             收藏服务器（connect 和 Web 界面中排在前面）
+      --off                     取消收藏
+    check [name...]             检查连通性和认证，结果显示在 server list 中
+      --all                     检查全部服务器
+      --parallel <n>            同时检查的服务器数（默认 8）
+      --json                    以 JSON 输出结果
+
+  key       管理 SSH 密钥
+    generate                    生成密钥对（输出公钥）
+      --type <type>             ed25519（默认）、rsa 或 ecdsa
+      --bits <n>                rsa（默认 4096）或 ecdsa（默认 256）的密钥长度
+      --comment <text>          密钥注释
+      --out <path>              私钥路径（默认 ~/.ssh/hssh_<type>）
+      --force                   覆盖已有的密钥文件
+    deploy                      把公钥追加到服务器的 authorized_keys
+      --server <name>           目标服务器（使用其现有认证方式登录）
+      --key <path>              私钥路径（默认 ~/.ssh/hssh_ed25519）
+      --switch                  用密钥登录验证成功后，把服务器改为密钥认证
+    rotate [name...]            把服务器轮换到新密钥并删除旧公钥
+      --all                     轮换全部服务器
+      --type <type>             新密钥类型（默认 ed25519）
+      --out <path>              新私钥路径（默认 ~/.ssh/hssh_<type>_<时间>）
+      --parallel <n>            同时轮换的服务器数（默认 8）
+      --json                    以 JSON 输出结果
+
+  config    管理配置存储
+    migrate-to-sqlite           把 ~/.gmssh/config.yaml 迁移到 ~/.gmssh/config.db
+    sync                        立即拉取团队共享拓扑
+      --source <url>            Git 仓库或 HTTPS 地址（默认 sync.source）
+    refs                        列出指向不存在服务器的引用
+    fix-refs                    移除或修复这些引用
+    import-ssh                  从 ~/.ssh/config 导入主机和 ProxyJump 跳板链
+      --file <path>             OpenSSH 配置文件（默认 ~/.ssh/config）
+      --host <a,b>              只导入这些别名及它们的网关
+      --dry-run                 只显示将导入的主机，不保存
+      --json                    以 JSON 输出结果
+
+  backup    备份或恢复全部本地状态（配置目录、凭据、审计日志、known_hosts）
+    create                      创建备份
+      --out <file>              备份文件（.tar.gz）
+      --passphrase-file <file>  加密（AES-256-GCM）；默认 GMSSH_BACKUP_PASSPHRASE，都未设置时不加密
+      --json                    以 JSON 输出备份清单
+    restore                     恢复备份，known_hosts 只合并新行
+      --in <file>               备份文件
+      --passphrase-file <file>  加密备份的口令（默认 GMSSH_BACKUP_PASSPHRASE）
+      --force                   替换已有配置（原文件保留为 .bak）
+      --dry-run                 只校验备份
+      --json                    以 JSON 输出结果
+
+  apply     按声明式状态文件调整服务器、Portal 映射和运行中的端口转发
+            -f, --file <file>     状态文件（YAML：servers、mappings、proxies）
+            --prune               删除由 apply 创建、文件中已不存在的条目
+            --dry-run             只输出计划
+            --addr <host:port>    运行转发的 Web 服务地址（默认本机的 web.bind）
+            --token <token>       管理员令牌（默认 GMSSH_AUTH_TOKEN 或配置中第一个管理员）
+            --json                以 JSON 输出计划和结果
+
+  panic     紧急停止：让运行中的 Web 服务停止所有转发、Portal 映射、终端会话和上传，
+            并断开所有链（写入审计日志）
+            --addr <host:port>    Web 服务地址（默认本机的 web.bind）
+            --token <token>       管理员令牌（默认 GMSSH_AUTH_TOKEN 或配置中第一个管理员）
+            --json                以 JSON 输出结果
+
+  web       启动 Web 界面
+            --local               本地模式
+            --bind <addr>         监听地址（默认 0.0.0.0:18081）
+            --status-only         只读状态页，无需认证（运维大屏/分享）
+            --no-browser          --local 时不打开浏览器（无界面环境）
+            --idle-exit <分钟>    没有会话、传输、转发和请求超过指定分钟数后退出（本地辅助进程）
+            /healthz、/readyz 无需认证；收到 SIGTERM 时等待进行中的请求完成后退出
+
+  portal    高性能端口转发/隧道
+            --server              服务端模式
+            --client              客户端模式
+            --listen <addr>       服务端监听地址（默认 :18888）
+            --token <token>       认证令牌
+            --local <addr>        本地监听地址（客户端）
+            --remote <host:port>  远程目标（客户端）
+            --server-addr <addr>  Portal 服务端地址（客户端）
+            --allow-lan           允许 --local 使用本机以外可访问的地址（客户端，需确认）
+            --health-listen <addr> 以 HTTP 提供 /healthz、/readyz（服务端）
+
+  agent     向控制面注册，在机房内中继传输和转发
+            --hub <addr>          控制面 agent 地址
+            --token <token>       认证令牌
+            --name <name>         agent 名称（默认主机名）
+            --fetch-dir <dir>     拉取任务的目录
+            --allow <cidrs>       允许转发的目标
+            --fingerprint <hex>   固定控制面证书指纹
+
+语言：
+  --lang 或 GMSSH_LANG / LANG 选择 en 或 zh-CN 输出
+
+配置覆盖（容器部署）：
+  参数 / 环境变量                             config.yaml       默认值
+  --config-dir <dir>  / GMSSH_CONFIG_DIR      -                 ~/.gmssh
+  --log-level <level> / GMSSH_LOG_LEVEL       log_level         info（另有 warn、error、off）
+  --temp-dir <dir>    / GMSSH_TEMP_DIR        upload.temp_dir   系统临时目录
+  --netem <spec>      / GMSSH_NETEM           debug_netem       关闭（仅供调试，如 delay=100ms,jitter=20ms,loss=1%）
+  web --bind <addr>   / GMSSH_WEB_BIND        web.bind          0.0.0.0:18081
+  portal --token      / GMSSH_AUTH_TOKEN      -                 （web：以该令牌添加管理员）
+  参数优先于环境变量，环境变量优先于 config.yaml。覆盖只对本进程生效，不会写回配置
+
+脚本（CI）：
+  --timeout <d>   超过指定时长（如 30s、5m）后放弃（proxy 只限制建立连接，web、portal、agent 不使用）
+  --batch         从不等待输入，需要确认时直接失败
+  --quiet         标准输出只打印 JSON 结果（隐含 --batch），错误输出到标准错误
+
+退出码：
+  0  成功                         5  传输或密钥轮换失败
+  1  其他错误                     6  目标不可达（probe、trace）
+  2  参数错误                     7  超过 --timeout
+  3  配置中没有该服务器           8  批处理模式下需要确认
+  4  连接或认证失败，或有服务器检查失败
+  9  服务器处于维护窗口（upload、download、fetch-dir）
+  10 上传被 upload.policy 拒绝（大小、扩展名或扫描命令）
+
+示例：
+  # 对比到同一台服务器的两条跳板链
+  hssh probe --target internal --via bastion-hk,gateway --via bastion-sg,gateway
+
+  # 检查从网关能否连上 internal-db 的 MySQL
+  hssh probe --target internal-db --port 3306 --via gateway
+
+  # 直接上传文件
+  hssh upload --source ./file.txt --target gateway:/data/
+
+  # 经跳板机上传
+  hssh upload --source ./file.txt --target internal:/data/ --via bastion-hk,gateway
+
+  # 重新上传修改过的磁盘镜像，只发送变化的块
+  hssh upload --source ./vm.qcow2 --target internal:/images/ --via gateway --delta
+
+  # 比较三跳链路上 tunnel 与 relay 模式的吞吐
+  hssh upload --source ./build.tgz --target internal:/data/ --via bastion-hk,gateway --mode compare
+
+  # 在内网由 gateway 上的 aws CLI 把备份上传到 S3
+  hssh upload --source ./db.dump --target s3://backups/db/@gateway
+
+  # 以 8 个并行流下载日志目录，校验 sha256 并保存清单
+  hssh download --source internal:/var/log/app --target ./logs --via gateway --streams 8 --verify --manifest logs.json
+
+  # 把大量小文件的目录压缩成一个文件下载
+  hssh fetch-dir --source internal:/var/log/app --via gateway --remote-tmp /data/tmp
+
+  # 重新连接最近使用的服务器
+  hssh connect -
+
+  # 转发内网数据库端口
+  hssh proxy --local :3306 --remote-host internal-db --remote-port 3306 --via gateway
+
+  # 把本地 9000-9002 端口分别转发到三台内网 Web 服务器
+  hssh proxy --local localhost:9000-9002 --remote web1:80 --remote web2:80 --remote web3:80 --via gateway
+
+  # 把本地 5432 端口转发到数据库服务器上的 PostgreSQL socket
+  hssh proxy --local :5432 --remote /var/run/postgresql/.s.PGSQL.5432 --via gateway,db
+
+  # 添加服务器
+  hssh server add --name gateway --host gw.example.com --user admin --auth key --key-path ~/.ssh/id_rsa
+
+  # 每次 16 台检查全部服务器（有失败时退出码为 4）
+  hssh server check --all --parallel 16
+
+  # 上周 report.xlsx 传到哪里去了？
+  hssh search report.xlsx --type transfer --days 7
+
+  # 导出上个月各服务器的使用量，用于容量报告
+  hssh export usage --from 2026-09-01 --to 2026-09-30 --out usage-september.csv
+
+  # 重装后的服务器主机密钥变了，与控制台上的指纹核对后信任
+  hssh hostkey accept web-1 --fingerprint SHA256:...
+
+  # 给使用密码认证的服务器部署新密钥并改为密钥认证
+  hssh key generate
+  hssh key deploy --server gateway --switch
+
+  # 把全部服务器轮换到新密钥（有服务器未轮换时退出码为 5）
+  hssh key rotate --all
+
+  # 在 CI 中上传：最多 10 分钟，不等待输入，只输出 JSON 结果
+  hssh --timeout 10m --quiet upload --source ./build.tgz --target internal:/data/ --via gateway
+
+  # 启动 portal 服务端
+  hssh portal --server --listen :18888 --token my-token
+
+  # 启动 portal 客户端
+  hssh portal --client --local :8080 --remote 192.168.1.10:80 --server-addr portal.example.com:18888
+
+  # 在网关上运行 agent
+  hssh agent --hub control.example.com:18889 --token my-token --fetch-dir /data/incoming`
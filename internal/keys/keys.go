@@ -0,0 +1,254 @@
+// Package keys 生成 SSH 密钥对，经跳板链把公钥部署到服务器的 authorized_keys，并把一组服务器轮换到新密钥
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/pkg/types"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// 支持生成的密钥类型
+const (
+	TypeEd25519 = "ed25519"
+	TypeRSA     = "rsa"
+	TypeECDSA   = "ecdsa"
+)
+
+const (
+	// DefaultRSABits RSA 密钥默认长度
+	DefaultRSABits = 4096
+	// minRSABits RSA 密钥最小长度
+	minRSABits = 2048
+	// DefaultECDSABits ECDSA 密钥默认曲线长度
+	DefaultECDSABits = 256
+)
+
+var (
+	// ErrUnsupportedType 不支持的密钥类型或长度
+	ErrUnsupportedType = errors.New("unsupported key type")
+	// ErrKeyExists 目标路径已有密钥文件
+	ErrKeyExists = errors.New("key file already exists")
+)
+
+// KeyPair 生成的密钥对
+type KeyPair struct {
+	Type        string
+	PrivateKey  []byte // OpenSSH 格式的 PEM 私钥（未加密）
+	PublicKey   string // authorized_keys 格式的一行，含注释
+	Fingerprint string // SHA256:...
+}
+
+// DefaultPath 密钥的默认保存路径，不与 ssh-keygen 的 id_* 冲突
+func DefaultPath(keyType string) string {
+	if keyType == "" {
+		keyType = TypeEd25519
+	}
+	return "~/.ssh/hssh_" + keyType
+}
+
+// Generate 生成密钥对，keyType 为空时生成 ed25519；bits 只对 rsa（默认 4096，至少 2048）
+// 和 ecdsa（256、384 或 521，默认 256）有效
+func Generate(keyType string, bits int, comment string) (*KeyPair, error) {
+	var priv crypto.Signer
+	var err error
+	switch keyType {
+	case "", TypeEd25519:
+		keyType = TypeEd25519
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	case TypeRSA:
+		if bits == 0 {
+			bits = DefaultRSABits
+		}
+		if bits < minRSABits {
+			return nil, fmt.Errorf("%w: rsa key must be at least %d bits", ErrUnsupportedType, minRSABits)
+		}
+		priv, err = rsa.GenerateKey(rand.Reader, bits)
+	case TypeECDSA:
+		var curve elliptic.Curve
+		switch bits {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("%w: ecdsa key must be 256, 384 or 521 bits", ErrUnsupportedType)
+		}
+		priv, err = ecdsa.GenerateKey(curve, rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, keyType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("generate %s key: %w", keyType, err)
+	}
+
+	block, err := gossh.MarshalPrivateKey(priv, comment)
+	if err != nil {
+		return nil, fmt.Errorf("marshal private key: %w", err)
+	}
+	pub, err := gossh.NewPublicKey(priv.Public())
+	if err != nil {
+		return nil, fmt.Errorf("marshal public key: %w", err)
+	}
+
+	return &KeyPair{
+		Type:        keyType,
+		PrivateKey:  pem.EncodeToMemory(block),
+		PublicKey:   authorizedLine(pub, comment),
+		Fingerprint: gossh.FingerprintSHA256(pub),
+	}, nil
+}
+
+// Write 把私钥写入 path（0600），公钥写入 path.pub；目录不存在时以 0700 创建。
+// 任一文件已存在且 overwrite 为 false 时返回 ErrKeyExists
+func (kp *KeyPair) Write(path string, overwrite bool) error {
+	path = ExpandHome(path)
+	if !overwrite {
+		for _, p := range []string{path, path + ".pub"} {
+			if _, err := os.Stat(p); err == nil {
+				return fmt.Errorf("%s: %w", p, ErrKeyExists)
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create key directory: %w", err)
+	}
+	if err := os.WriteFile(path, kp.PrivateKey, 0o600); err != nil {
+		return fmt.Errorf("write private key: %w", err)
+	}
+	if err := os.WriteFile(path+".pub", []byte(kp.PublicKey+"\n"), 0o644); err != nil {
+		return fmt.Errorf("write public key: %w", err)
+	}
+	return nil
+}
+
+// PublicKey 返回私钥 path 对应的 authorized_keys 行和指纹：优先读取 path.pub，
+// 不存在时从私钥推导（私钥不能加密）
+func PublicKey(path string) (line, fingerprint string, err error) {
+	path = ExpandHome(path)
+	if data, err := os.ReadFile(path + ".pub"); err == nil {
+		pub, comment, _, _, err := gossh.ParseAuthorizedKey(data)
+		if err != nil {
+			return "", "", fmt.Errorf("parse %s.pub: %w", path, err)
+		}
+		return authorizedLine(pub, comment), gossh.FingerprintSHA256(pub), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("read private key: %w", err)
+	}
+	signer, err := gossh.ParsePrivateKey(data)
+	if err != nil {
+		return "", "", fmt.Errorf("parse private key: %w", err)
+	}
+	pub := signer.PublicKey()
+	return authorizedLine(pub, ""), gossh.FingerprintSHA256(pub), nil
+}
+
+// authorizedLine authorized_keys 格式的一行，不含换行
+func authorizedLine(pub gossh.PublicKey, comment string) string {
+	line := strings.TrimSpace(string(gossh.MarshalAuthorizedKey(pub)))
+	if comment != "" {
+		line += " " + comment
+	}
+	return line
+}
+
+// DeployCommand 把 authorizedKey 追加到远端 ~/.ssh/authorized_keys 的命令：
+// 目录和文件不存在时以 0700/0600 创建，同一公钥（按类型和内容，忽略注释）已存在时不重复追加，
+// 文件末尾没有换行时先补一个
+func DeployCommand(authorizedKey string) string {
+	const file = "~/.ssh/authorized_keys"
+	return "umask 077 && mkdir -p ~/.ssh && touch " + file +
+		" && { grep -qF " + terminal.ShellQuote(keyMatch(authorizedKey)) + " " + file +
+		" || { { [ ! -s " + file + " ] || [ -z \"$(tail -c 1 " + file + ")\" ] || echo >> " + file + "; }" +
+		" && printf '%s\\n' " + terminal.ShellQuote(authorizedKey) + " >> " + file + "; }; }"
+}
+
+// keyMatch authorized_keys 行中标识公钥的部分（类型和内容），用于忽略注释和选项匹配
+func keyMatch(authorizedKey string) string {
+	fields := strings.Fields(authorizedKey)
+	if len(fields) >= 2 {
+		return fields[0] + " " + fields[1]
+	}
+	return authorizedKey
+}
+
+// Deploy 经 hops（最后一个为目标，使用其现有的认证方式）把公钥追加到目标的 authorized_keys
+func Deploy(ctx context.Context, hops []*types.Hop, authorizedKey string) error {
+	return execute(ctx, hops, DeployCommand(authorizedKey))
+}
+
+// WithKeyAuth 返回 hop 改用 keyPath 做密钥认证的副本，不保留密码和原私钥的口令
+func WithKeyAuth(hop *types.Hop, keyPath string) *types.Hop {
+	updated := *hop
+	updated.AuthType = types.AuthKey
+	updated.KeyPath = keyPath
+	updated.Password = ""
+	updated.KeyPassphrase = ""
+	return &updated
+}
+
+// Verify 用 keyPath 重新连接 hops 的最后一个服务器，确认部署的公钥可以登录
+func Verify(ctx context.Context, hops []*types.Hop, keyPath string) error {
+	if len(hops) == 0 {
+		return errors.New("empty chain")
+	}
+	verify := append([]*types.Hop(nil), hops...)
+	verify[len(verify)-1] = WithKeyAuth(verify[len(verify)-1], keyPath)
+	return connect(ctx, verify)
+}
+
+// execute 建立 hops 的链并在最后一个服务器上执行 cmd，失败时附上 stderr
+func execute(ctx context.Context, hops []*types.Hop, cmd string) error {
+	chain := ssh.NewChain(hops)
+	if err := chain.ConnectContext(ctx); err != nil {
+		return err
+	}
+	defer chain.Disconnect()
+
+	if _, stderr, err := chain.Execute(cmd); err != nil {
+		if stderr = strings.TrimSpace(stderr); stderr != "" {
+			return fmt.Errorf("%w: %s", err, stderr)
+		}
+		return err
+	}
+	return nil
+}
+
+// connect 建立 hops 的链后立即断开，用于验证登录
+func connect(ctx context.Context, hops []*types.Hop) error {
+	chain := ssh.NewChain(hops)
+	if err := chain.ConnectContext(ctx); err != nil {
+		return err
+	}
+	return chain.Disconnect()
+}
+
+// ExpandHome 把开头的 ~ 展开为本机用户主目录
+func ExpandHome(path string) string {
+	if strings.HasPrefix(path, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
@@ -0,0 +1,122 @@
+package keys
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// TestGenerate 测试各类型密钥的生成和参数校验
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		keyType string
+		bits    int
+		wantPub string
+		wantErr bool
+	}{
+		{"", 0, "ssh-ed25519", false},
+		{TypeEd25519, 0, "ssh-ed25519", false},
+		{TypeRSA, 2048, "ssh-rsa", false},
+		{TypeRSA, 1024, "", true},
+		{TypeECDSA, 0, "ecdsa-sha2-nistp256", false},
+		{TypeECDSA, 384, "ecdsa-sha2-nistp384", false},
+		{TypeECDSA, 512, "", true},
+		{"dsa", 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.keyType+"/"+tt.wantPub, func(t *testing.T) {
+			kp, err := Generate(tt.keyType, tt.bits, "alice@laptop")
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsupportedType) {
+					t.Fatalf("err = %v, want ErrUnsupportedType", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+			if !strings.HasPrefix(kp.PublicKey, tt.wantPub+" ") || !strings.HasSuffix(kp.PublicKey, " alice@laptop") {
+				t.Errorf("public key = %q", kp.PublicKey)
+			}
+			signer, err := gossh.ParsePrivateKey(kp.PrivateKey)
+			if err != nil {
+				t.Fatalf("parse private key: %v", err)
+			}
+			if got := gossh.FingerprintSHA256(signer.PublicKey()); got != kp.Fingerprint {
+				t.Errorf("fingerprint = %s, private key has %s", kp.Fingerprint, got)
+			}
+		})
+	}
+}
+
+// TestWriteAndPublicKey 测试写入密钥文件、拒绝覆盖和读取公钥
+func TestWriteAndPublicKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ssh", "hssh_ed25519")
+	kp, err := Generate(TypeEd25519, 0, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kp.Write(path, false); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("private key mode = %v, err = %v", info.Mode().Perm(), err)
+	}
+	if err := kp.Write(path, false); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("second Write err = %v, want ErrKeyExists", err)
+	}
+
+	line, fingerprint, err := PublicKey(path)
+	if err != nil || line != kp.PublicKey || fingerprint != kp.Fingerprint {
+		t.Errorf("PublicKey = %q, %s, %v", line, fingerprint, err)
+	}
+
+	// 没有 .pub 时从私钥推导，不带注释
+	os.Remove(path + ".pub")
+	line, fingerprint, err = PublicKey(path)
+	if err != nil || !strings.HasPrefix(kp.PublicKey, line) || fingerprint != kp.Fingerprint {
+		t.Errorf("derived PublicKey = %q, %s, %v", line, fingerprint, err)
+	}
+}
+
+// TestDeployCommand 在本机 shell 中执行部署命令：创建文件、补换行、不重复追加
+func TestDeployCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	home := t.TempDir()
+	run := func(key string) {
+		t.Helper()
+		cmd := exec.Command("sh", "-c", DeployCommand(key))
+		cmd.Env = append(os.Environ(), "HOME="+home)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("deploy: %v: %s", err, out)
+		}
+	}
+	file := filepath.Join(home, ".ssh", "authorized_keys")
+
+	run("ssh-ed25519 AAAAfirst it's me")
+	if err := os.WriteFile(file, []byte("ssh-ed25519 AAAAfirst it's me\nssh-rsa AAAAother"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	run("ssh-ed25519 AAAAsecond")
+	run("ssh-ed25519 AAAAsecond renamed comment")
+	run("ssh-ed25519 AAAAfirst")
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ssh-ed25519 AAAAfirst it's me\nssh-rsa AAAAother\nssh-ed25519 AAAAsecond\n"
+	if string(data) != want {
+		t.Errorf("authorized_keys = %q, want %q", data, want)
+	}
+	if info, err := os.Stat(filepath.Join(home, ".ssh")); err != nil || info.Mode().Perm() != 0o700 {
+		t.Errorf(".ssh mode = %v, err = %v", info.Mode().Perm(), err)
+	}
+}
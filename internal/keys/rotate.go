@@ -0,0 +1,179 @@
+package keys
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const (
+	// DefaultRotateParallel 轮换时默认同时处理的服务器数
+	DefaultRotateParallel = 8
+	// DefaultRotateTimeout 单个服务器每个阶段（部署并验证、删除旧公钥）的默认超时
+	DefaultRotateTimeout = time.Minute
+)
+
+// 轮换失败的步骤
+const (
+	StageDeploy = "deploy" // 以旧认证方式登录并追加新公钥
+	StageVerify = "verify" // 用新密钥登录
+	StageSave   = "save"   // 保存配置
+	StageRemove = "remove" // 删除旧公钥（新密钥已生效）
+)
+
+// removeKeptMissingStatus 远端 authorized_keys 中没有新公钥时删除命令的退出码
+const removeKeptMissingStatus = 4
+
+// RotateResult 一个服务器的轮换结果
+type RotateResult struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// OK 新公钥已部署并验证，配置已改为使用新密钥
+	OK bool `json:"ok"`
+	// OldKeyRemoved 已从远端删除旧公钥；服务器原来使用密码认证或旧密钥与新密钥相同时为 false
+	OldKeyRemoved bool   `json:"old_key_removed"`
+	Stage         string `json:"stage,omitempty"` // 失败的步骤，OK 为 true 时只可能是 remove
+	Error         string `json:"error,omitempty"`
+}
+
+// Rotator 把一组服务器轮换到新密钥：先以现有认证方式部署新公钥并用新密钥验证登录，
+// 再一次性保存所有验证通过的服务器的配置，最后经新密钥登录删除旧公钥。
+// 保存配置之前旧公钥都不会被删除，任何一步失败都不会让服务器无法登录
+type Rotator struct {
+	Parallel int           // <= 0 时为 DefaultRotateParallel
+	Timeout  time.Duration // <= 0 时为 DefaultRotateTimeout
+
+	// 测试时替换为不连接网络的实现
+	execute func(ctx context.Context, hops []*types.Hop, cmd string) error
+	connect func(ctx context.Context, hops []*types.Hop) error
+}
+
+// NewRotator 创建经 SSH 链执行的轮换器
+func NewRotator(parallel int) *Rotator {
+	return &Rotator{Parallel: parallel, execute: execute, connect: connect}
+}
+
+// Rotate 把 targets 轮换到 keyPath 的密钥，chainOf 返回到服务器的跳板链（最后一个为目标）。
+// save 以验证通过的服务器 ID 保存配置（改为使用 keyPath），失败时不删除任何旧公钥并返回其错误。
+// 结果与 targets 顺序一致
+func (r *Rotator) Rotate(ctx context.Context, targets []*types.Hop, chainOf func(*types.Hop) []*types.Hop, keyPath string, save func(ids []string) error) ([]RotateResult, error) {
+	newKey, newFingerprint, err := PublicKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]RotateResult, len(targets))
+	oldKeys := make([]string, len(targets))
+	r.each(targets, func(i int, target *types.Hop) {
+		results[i] = RotateResult{ID: target.ID, Name: target.Name}
+		// 保存配置后 target 的认证方式会变，先记下旧公钥
+		if target.AuthType == types.AuthKey && target.KeyPath != "" {
+			if line, fingerprint, err := PublicKey(target.KeyPath); err == nil && fingerprint != newFingerprint {
+				oldKeys[i] = line
+			}
+		}
+
+		hops := chainOf(target)
+		stepCtx, cancel := context.WithTimeout(ctx, r.timeout())
+		defer cancel()
+		if err := r.execute(stepCtx, hops, DeployCommand(newKey)); err != nil {
+			results[i].Stage, results[i].Error = StageDeploy, err.Error()
+			return
+		}
+		if err := r.connect(stepCtx, withKeyAuthFor(hops, map[string]bool{target.ID: true}, keyPath)); err != nil {
+			results[i].Stage, results[i].Error = StageVerify, err.Error()
+		}
+	})
+
+	verified := make(map[string]bool)
+	var ids []string
+	for _, result := range results {
+		if result.Stage == "" {
+			verified[result.ID] = true
+			ids = append(ids, result.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return results, nil
+	}
+	if err := save(ids); err != nil {
+		for i := range results {
+			if verified[results[i].ID] {
+				results[i].Stage, results[i].Error = StageSave, err.Error()
+			}
+		}
+		return results, fmt.Errorf("save config: %w", err)
+	}
+	for i := range results {
+		results[i].OK = verified[results[i].ID]
+	}
+
+	// 经已轮换的网关登录时同样使用新密钥
+	r.each(targets, func(i int, target *types.Hop) {
+		if !results[i].OK || oldKeys[i] == "" {
+			return
+		}
+		hops := withKeyAuthFor(chainOf(target), verified, keyPath)
+		stepCtx, cancel := context.WithTimeout(ctx, r.timeout())
+		defer cancel()
+		if err := r.execute(stepCtx, hops, RemoveCommand(oldKeys[i], newKey)); err != nil {
+			results[i].Stage, results[i].Error = StageRemove, err.Error()
+			return
+		}
+		results[i].OldKeyRemoved = true
+	})
+	return results, nil
+}
+
+// each 最多同时 Parallel 个地对每个服务器执行 fn
+func (r *Rotator) each(targets []*types.Hop, fn func(i int, target *types.Hop)) {
+	parallel := r.Parallel
+	if parallel <= 0 {
+		parallel = DefaultRotateParallel
+	}
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			fn(i, target)
+		}()
+	}
+	wg.Wait()
+}
+
+func (r *Rotator) timeout() time.Duration {
+	if r.Timeout > 0 {
+		return r.Timeout
+	}
+	return DefaultRotateTimeout
+}
+
+// withKeyAuthFor 返回 hops 的副本，其中 ID 在 ids 中的服务器改用 keyPath 做密钥认证
+func withKeyAuthFor(hops []*types.Hop, ids map[string]bool, keyPath string) []*types.Hop {
+	out := make([]*types.Hop, len(hops))
+	for i, hop := range hops {
+		out[i] = hop
+		if ids[hop.ID] {
+			out[i] = WithKeyAuth(hop, keyPath)
+		}
+	}
+	return out
+}
+
+// RemoveCommand 从远端 ~/.ssh/authorized_keys 删除 oldKey（按类型和内容匹配，忽略注释和选项）的命令。
+// 文件中没有 keepKey 时不做修改并以状态 4 退出，避免删除后无法登录
+func RemoveCommand(oldKey, keepKey string) string {
+	const file = "~/.ssh/authorized_keys"
+	const tmp = file + ".hssh-rotate"
+	return fmt.Sprintf("[ -f %[1]s ] || exit 0; grep -qF %[3]s %[1]s || exit %[5]d; "+
+		"umask 077 && { grep -vF %[4]s %[1]s || true; } > %[2]s && cat %[2]s > %[1]s && rm -f %[2]s",
+		file, tmp, terminal.ShellQuote(keyMatch(keepKey)), terminal.ShellQuote(keyMatch(oldKey)), removeKeptMissingStatus)
+}
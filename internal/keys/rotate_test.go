@@ -0,0 +1,182 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// writeTestKey 在临时目录生成密钥并返回私钥路径和公钥
+func writeTestKey(t *testing.T, name string) (string, string) {
+	t.Helper()
+	kp, err := Generate(TypeEd25519, 0, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := kp.Write(path, false); err != nil {
+		t.Fatal(err)
+	}
+	return path, kp.PublicKey
+}
+
+// fakeRemote 记录执行的命令，按服务器名称模拟失败
+type fakeRemote struct {
+	mu         sync.Mutex
+	failDeploy map[string]bool
+	failVerify map[string]bool
+	removed    map[string]string // 目标名称 -> 删除旧公钥时链中网关的密钥路径
+}
+
+func (f *fakeRemote) execute(_ context.Context, hops []*types.Hop, cmd string) error {
+	target := hops[len(hops)-1]
+	if strings.HasPrefix(cmd, "umask") && f.failDeploy[target.Name] {
+		return errors.New("permission denied")
+	}
+	if strings.HasPrefix(cmd, "[ -f") {
+		f.mu.Lock()
+		f.removed[target.Name] = hops[0].KeyPath
+		f.mu.Unlock()
+	}
+	return nil
+}
+
+func (f *fakeRemote) connect(_ context.Context, hops []*types.Hop) error {
+	if f.failVerify[hops[len(hops)-1].Name] {
+		return errors.New("unable to authenticate")
+	}
+	return nil
+}
+
+func TestRotate(t *testing.T) {
+	oldPath, _ := writeTestKey(t, "old")
+	newPath, _ := writeTestKey(t, "new")
+
+	gateway := &types.Hop{ID: "gw", Name: "gateway", AuthType: types.AuthKey, KeyPath: oldPath}
+	targets := []*types.Hop{
+		gateway,
+		{ID: "db", Name: "db", AuthType: types.AuthKey, KeyPath: oldPath, GatewayID: "gw"},
+		{ID: "web", Name: "web", AuthType: types.AuthPassword, Password: "secret"},
+		{ID: "cache", Name: "cache", AuthType: types.AuthKey, KeyPath: oldPath},
+		{ID: "queue", Name: "queue", AuthType: types.AuthKey, KeyPath: oldPath},
+	}
+	chainOf := func(hop *types.Hop) []*types.Hop {
+		if hop.GatewayID == "gw" {
+			return []*types.Hop{gateway, hop}
+		}
+		return []*types.Hop{hop}
+	}
+
+	remote := &fakeRemote{
+		failDeploy: map[string]bool{"cache": true},
+		failVerify: map[string]bool{"queue": true},
+		removed:    map[string]string{},
+	}
+	rotator := NewRotator(2)
+	rotator.execute, rotator.connect = remote.execute, remote.connect
+
+	var saved []string
+	results, err := rotator.Rotate(context.Background(), targets, chainOf, newPath, func(ids []string) error {
+		saved = ids
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if !reflect.DeepEqual(saved, []string{"gw", "db", "web"}) {
+		t.Errorf("saved = %v", saved)
+	}
+
+	want := []struct {
+		ok      bool
+		removed bool
+		stage   string
+	}{
+		{true, true, ""},
+		{true, true, ""},
+		{true, false, ""}, // 原来使用密码，没有旧公钥
+		{false, false, StageDeploy},
+		{false, false, StageVerify},
+	}
+	for i, w := range want {
+		got := results[i]
+		if got.OK != w.ok || got.OldKeyRemoved != w.removed || got.Stage != w.stage {
+			t.Errorf("%s: result = %+v", targets[i].Name, got)
+		}
+	}
+	// 删除 db 的旧公钥时网关已轮换，应使用新密钥
+	if remote.removed["db"] != newPath {
+		t.Errorf("db removal went through gateway with key %q", remote.removed["db"])
+	}
+}
+
+func TestRotateSaveFailureKeepsOldKeys(t *testing.T) {
+	oldPath, _ := writeTestKey(t, "old")
+	newPath, _ := writeTestKey(t, "new")
+	targets := []*types.Hop{{ID: "db", Name: "db", AuthType: types.AuthKey, KeyPath: oldPath}}
+
+	remote := &fakeRemote{removed: map[string]string{}}
+	rotator := NewRotator(0)
+	rotator.execute, rotator.connect = remote.execute, remote.connect
+
+	results, err := rotator.Rotate(context.Background(), targets, func(hop *types.Hop) []*types.Hop { return []*types.Hop{hop} }, newPath, func([]string) error {
+		return errors.New("disk full")
+	})
+	if err == nil {
+		t.Fatal("expected save error")
+	}
+	if results[0].OK || results[0].Stage != StageSave || len(remote.removed) != 0 {
+		t.Errorf("result = %+v, removed = %v", results[0], remote.removed)
+	}
+}
+
+// TestRemoveCommand 在本机 shell 中执行删除命令
+func TestRemoveCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(home, ".ssh", "authorized_keys")
+	run := func(oldKey, keepKey string) error {
+		cmd := exec.Command("sh", "-c", RemoveCommand(oldKey, keepKey))
+		cmd.Env = append(os.Environ(), "HOME="+home)
+		return cmd.Run()
+	}
+
+	content := "ssh-ed25519 AAAAold laptop\nfrom=\"10.0.0.0/8\" ssh-ed25519 AAAAold again\nssh-rsa AAAAother\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// 新公钥不在文件中时拒绝删除
+	if err := run("ssh-ed25519 AAAAold", "ssh-ed25519 AAAAnew"); err == nil {
+		t.Error("expected failure without the new key")
+	}
+	if data, _ := os.ReadFile(file); string(data) != content {
+		t.Errorf("file changed: %q", data)
+	}
+
+	if err := os.WriteFile(file, []byte(content+"ssh-ed25519 AAAAnew hssh\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("ssh-ed25519 AAAAold laptop", "ssh-ed25519 AAAAnew"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	data, _ := os.ReadFile(file)
+	if want := "ssh-rsa AAAAother\nssh-ed25519 AAAAnew hssh\n"; string(data) != want {
+		t.Errorf("authorized_keys = %q, want %q", data, want)
+	}
+	if _, err := os.Stat(file + ".hssh-rotate"); !os.IsNotExist(err) {
+		t.Errorf("temp file left behind: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+// Package lifecycle 运行时资源的所有权模型：每个长生命周期对象（转发器、上传任务、终端会话）
+// 持有一个 Owner，把 SSH 链、会话、监听器和 goroutine 都登记到它上面，
+// Close() 时统一拆除，保证不会有连接或 goroutine 比它的所有者活得更久
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Owner 一组资源的所有者
+type Owner struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	closers []func() error
+	closed  bool
+	wg      sync.WaitGroup
+	once    sync.Once
+	err     error
+}
+
+// New 创建所有者，parent 取消时其 Context 也随之取消（但资源仍需 Close 才会释放）
+func New(parent context.Context) *Owner {
+	ctx, cancel := context.WithCancel(parent)
+	return &Owner{ctx: ctx, cancel: cancel}
+}
+
+// Context 所有者的 Context，Close 时取消
+func (o *Owner) Context() context.Context {
+	return o.ctx
+}
+
+// Done Close 开始（或父 Context 取消）后关闭的通道
+func (o *Owner) Done() <-chan struct{} {
+	return o.ctx.Done()
+}
+
+// Go 启动一个归属于该所有者的 goroutine，Close 会等待它退出
+// fn 应在 ctx 取消或其阻塞的资源被关闭后返回；Close 之后调用 Go 不会启动任何东西并返回 false
+func (o *Owner) Go(fn func(ctx context.Context)) bool {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return false
+	}
+	o.wg.Add(1)
+	o.mu.Unlock()
+
+	go func() {
+		defer o.wg.Done()
+		fn(o.ctx)
+	}()
+	return true
+}
+
+// OnClose 登记一个清理函数，Close 时按登记的相反顺序执行
+// 所有者已关闭时立即执行
+func (o *Owner) OnClose(fn func() error) {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		fn()
+		return
+	}
+	o.closers = append(o.closers, fn)
+	o.mu.Unlock()
+}
+
+// Add 登记一个 io.Closer
+func (o *Owner) Add(c io.Closer) {
+	o.OnClose(c.Close)
+}
+
+// Close 取消 Context，逆序执行清理函数（关闭链路、会话、监听器以唤醒阻塞的 goroutine），
+// 然后等待所有 goroutine 退出。可重复调用，返回第一次关闭时的错误
+func (o *Owner) Close() error {
+	o.once.Do(func() {
+		o.mu.Lock()
+		o.closed = true
+		closers := o.closers
+		o.closers = nil
+		o.mu.Unlock()
+
+		o.cancel()
+		var errs []error
+		for i := len(closers) - 1; i >= 0; i-- {
+			if err := closers[i](); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		o.wg.Wait()
+		o.err = errors.Join(errs...)
+	})
+	return o.err
+}
@@ -0,0 +1,97 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// waitForGoroutines 等待 goroutine 数量回落到 base 以下，超时则失败
+func waitForGoroutines(t *testing.T, base int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines leaked: have %d, want <= %d", runtime.NumGoroutine(), base)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCloseTearsDownInReverseOrderAndWaits(t *testing.T) {
+	base := runtime.NumGoroutine()
+	owner := New(context.Background())
+
+	var order []string
+	owner.OnClose(func() error { order = append(order, "chain"); return nil })
+	owner.OnClose(func() error { order = append(order, "session"); return nil })
+
+	// 阻塞在"资源"上的 goroutine，只有清理函数关闭资源后才退出
+	resource := make(chan struct{})
+	owner.OnClose(func() error { close(resource); return nil })
+	exited := make(chan struct{})
+	owner.Go(func(context.Context) {
+		<-resource
+		close(exited)
+	})
+	owner.Go(func(ctx context.Context) { <-ctx.Done() })
+
+	if err := owner.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	select {
+	case <-exited:
+	default:
+		t.Fatal("Close returned before owned goroutines exited")
+	}
+	if len(order) != 2 || order[0] != "session" || order[1] != "chain" {
+		t.Errorf("closers ran in order %v, want [session chain]", order)
+	}
+	waitForGoroutines(t, base)
+}
+
+func TestCloseIsIdempotentAndJoinsErrors(t *testing.T) {
+	owner := New(context.Background())
+	errA, errB := errors.New("a"), errors.New("b")
+	owner.OnClose(func() error { return errA })
+	owner.OnClose(func() error { return errB })
+
+	err := owner.Close()
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Fatalf("Close error = %v, want both closer errors", err)
+	}
+	if again := owner.Close(); again != err {
+		t.Errorf("second Close = %v, want %v", again, err)
+	}
+}
+
+func TestRegistrationAfterClose(t *testing.T) {
+	base := runtime.NumGoroutine()
+	owner := New(context.Background())
+	owner.Close()
+
+	if owner.Go(func(context.Context) { select {} }) {
+		t.Error("Go after Close should not start a goroutine")
+	}
+	ran := false
+	owner.OnClose(func() error { ran = true; return nil })
+	if !ran {
+		t.Error("OnClose after Close should run immediately")
+	}
+	waitForGoroutines(t, base)
+}
+
+func TestParentCancelStopsContext(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	owner := New(parent)
+	defer owner.Close()
+
+	cancel()
+	select {
+	case <-owner.Done():
+	case <-time.After(time.Second):
+		t.Fatal("owner context not cancelled with parent")
+	}
+}
@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// 日志级别。项目中的日志没有显式级别，按内容归类：
+// 含 error、fail、panic 的为错误，含 warn 的为警告，其他为信息
+const (
+	LevelInfo  = "info" // 默认，输出全部日志
+	LevelWarn  = "warn"
+	LevelError = "error"
+	LevelOff   = "off"
+)
+
+var levels = map[string]int{LevelInfo: 0, LevelWarn: 1, LevelError: 2, LevelOff: 3}
+
+// SetLevel 设置标准库 log 的输出级别，level 为空时为 LevelInfo
+func SetLevel(level string) error {
+	min, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	log.SetOutput(&filter{out: os.Stderr, min: min})
+	return nil
+}
+
+// parseLevel 返回级别的序号
+func parseLevel(level string) (int, error) {
+	if level == "" {
+		return levels[LevelInfo], nil
+	}
+	min, ok := levels[strings.ToLower(level)]
+	if !ok {
+		return 0, fmt.Errorf("unknown log level %q (info, warn, error, off)", level)
+	}
+	return min, nil
+}
+
+// filter 丢弃低于 min 级别的日志行，log 包每条日志只调用一次 Write
+type filter struct {
+	out io.Writer
+	min int
+}
+
+func (f *filter) Write(p []byte) (int, error) {
+	if classify(p) < f.min {
+		return len(p), nil
+	}
+	return f.out.Write(p)
+}
+
+// classify 按内容返回日志行的级别序号
+func classify(line []byte) int {
+	lower := bytes.ToLower(line)
+	switch {
+	case bytes.Contains(lower, []byte("error")), bytes.Contains(lower, []byte("fail")), bytes.Contains(lower, []byte("panic")):
+		return levels[LevelError]
+	case bytes.Contains(lower, []byte("warn")):
+		return levels[LevelWarn]
+	default:
+		return levels[LevelInfo]
+	}
+}
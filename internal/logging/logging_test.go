@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	lines := []string{
+		"[SSH] Building config for root@10.0.0.1\n",
+		"[Config] Warning: failed to save migrated config\n",
+		"[Sync] Warning: sync disabled\n",
+		"[Portal] Server error: closed\n",
+	}
+
+	tests := []struct {
+		level string
+		want  string
+	}{
+		{"", lines[0] + lines[1] + lines[2] + lines[3]},
+		{LevelInfo, lines[0] + lines[1] + lines[2] + lines[3]},
+		{"WARN", lines[1] + lines[2] + lines[3]},
+		{LevelError, lines[1] + lines[3]},
+		{LevelOff, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			min, err := parseLevel(tt.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			f := &filter{out: &out, min: min}
+			for _, line := range lines {
+				if n, err := f.Write([]byte(line)); n != len(line) || err != nil {
+					t.Fatalf("Write = %d, %v", n, err)
+				}
+			}
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+
+	if _, err := parseLevel("verbose"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
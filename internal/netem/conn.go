@@ -0,0 +1,261 @@
+package netem
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// minRTO 丢包后重传的最小超时，与 Linux 的 TCP_RTO_MIN 相同
+	minRTO = 200 * time.Millisecond
+	// queueSize 每个方向在途的数据块数，发送队列满时 Write 阻塞
+	queueSize = 256
+	// readChunkSize 从底层连接读取的块大小，每块单独计算延迟
+	readChunkSize = 32 * 1024
+	// closeGrace 关闭时等待在途数据送出的额外时间，超时后直接关闭
+	closeGrace = time.Second
+)
+
+// chunk 带送达时间的数据块，err 非空表示读取方向在该时刻结束
+type chunk struct {
+	data []byte
+	at   time.Time
+	err  error
+}
+
+// conn 注入延迟的连接：写入的数据块由发送 goroutine 按送达时间写到底层连接，
+// 读取 goroutine 读到的数据块到送达时间后才交给 Read。两个方向都保持顺序
+type conn struct {
+	net.Conn
+	cfg Config
+
+	writeMu  sync.Mutex
+	lastOut  time.Time // 由 writeMu 保护
+	out      chan chunk
+	writeErr atomic.Pointer[error]
+	closing  chan struct{}
+	sent     chan struct{} // 发送 goroutine 退出
+
+	readMu       sync.Mutex
+	in           chan chunk
+	head         *chunk // 已取出但未读完的数据块，由 readMu 保护
+	readDeadline atomic.Pointer[time.Time]
+
+	closeOnce sync.Once
+	done      chan struct{} // 底层连接已关闭
+}
+
+func newConn(inner net.Conn, cfg Config) *conn {
+	c := &conn{
+		Conn:    inner,
+		cfg:     cfg,
+		out:     make(chan chunk, queueSize),
+		closing: make(chan struct{}),
+		sent:    make(chan struct{}),
+		in:      make(chan chunk, queueSize),
+		done:    make(chan struct{}),
+	}
+	go c.sendLoop()
+	go c.receiveLoop()
+	return c
+}
+
+// delay 为一个数据块抽取延迟
+func (c *conn) delay() time.Duration {
+	d := c.cfg.Delay
+	if c.cfg.Jitter > 0 {
+		d += time.Duration(rand.Int64N(int64(2*c.cfg.Jitter)+1)) - c.cfg.Jitter
+	}
+	if c.cfg.Loss > 0 && rand.Float64()*100 < c.cfg.Loss {
+		d += minRTO + 2*c.cfg.Delay
+	}
+	return max(d, 0)
+}
+
+// schedule 计算送达时间，不早于同方向上一个数据块
+func (c *conn) schedule(last *time.Time) time.Time {
+	at := time.Now().Add(c.delay())
+	if at.Before(*last) {
+		at = *last
+	}
+	*last = at
+	return at
+}
+
+// Write 把数据排入发送队列后立即返回，如同写入内核发送缓冲区
+func (c *conn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.writeErr.Load(); err != nil {
+		return 0, *err
+	}
+	select {
+	case <-c.closing:
+		return 0, net.ErrClosed
+	default:
+	}
+	data := bytes.Clone(p)
+	select {
+	case c.out <- chunk{data: data, at: c.schedule(&c.lastOut)}:
+		return len(p), nil
+	case <-c.sent:
+		if err := c.writeErr.Load(); err != nil {
+			return 0, *err
+		}
+		return 0, net.ErrClosed
+	}
+}
+
+func (c *conn) sendLoop() {
+	defer close(c.sent)
+	for {
+		var next chunk
+		select {
+		case next = <-c.out:
+		case <-c.closing:
+			// 关闭前送出已排队的数据
+			select {
+			case next = <-c.out:
+			default:
+				return
+			}
+		}
+		if !waitUntil(next.at, c.done) {
+			return
+		}
+		if _, err := c.Conn.Write(next.data); err != nil {
+			c.writeErr.Store(&err)
+			return
+		}
+	}
+}
+
+func (c *conn) receiveLoop() {
+	var last time.Time
+	for {
+		buf := make([]byte, readChunkSize)
+		n, err := c.Conn.Read(buf)
+		if n == 0 && err == nil {
+			continue
+		}
+		next := chunk{data: buf[:n]}
+		if n > 0 {
+			next.at = c.schedule(&last)
+		} else {
+			next.at = last
+		}
+		next.err = err
+		select {
+		case c.in <- next:
+		case <-c.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read 返回已到送达时间的数据，遵守 SetReadDeadline
+func (c *conn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	var deadline <-chan time.Time
+	if d := c.readDeadline.Load(); d != nil && !d.IsZero() {
+		if !time.Now().Before(*d) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(time.Until(*d))
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	if c.head == nil {
+		select {
+		case next := <-c.in:
+			c.head = &next
+		case <-deadline:
+			return 0, os.ErrDeadlineExceeded
+		case <-c.done:
+			return 0, net.ErrClosed
+		}
+	}
+	if wait := time.Until(c.head.at); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-deadline:
+			timer.Stop()
+			return 0, os.ErrDeadlineExceeded
+		case <-c.done:
+			timer.Stop()
+			return 0, net.ErrClosed
+		}
+	}
+
+	n := copy(p, c.head.data)
+	c.head.data = c.head.data[n:]
+	if len(c.head.data) > 0 {
+		return n, nil
+	}
+	err := c.head.err
+	if err == nil {
+		c.head = nil
+	}
+	if n > 0 {
+		// 先交付数据，错误在下一次 Read 返回
+		return n, nil
+	}
+	return 0, err
+}
+
+// Close 等待在途数据送出（最多一个最大延迟再加 closeGrace）后关闭底层连接
+func (c *conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		timer := time.NewTimer(c.cfg.Delay + c.cfg.Jitter + minRTO + closeGrace)
+		select {
+		case <-c.sent:
+		case <-timer.C:
+		}
+		timer.Stop()
+		err = c.Conn.Close()
+		close(c.done)
+	})
+	return err
+}
+
+// SetDeadline 设置读取截止时间和底层连接的写入截止时间
+func (c *conn) SetDeadline(t time.Time) error {
+	c.readDeadline.Store(&t)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// SetReadDeadline 读取截止时间作用于延迟后的交付，不传给底层连接
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Store(&t)
+	return nil
+}
+
+// waitUntil 等到 at，done 先关闭时返回 false
+func waitUntil(at time.Time, done <-chan struct{}) bool {
+	wait := time.Until(at)
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
@@ -0,0 +1,104 @@
+// Package netem 为开发调试模拟差的网络：在 SSH 第一跳、Portal 客户端与服务端之间的多路复用连接
+// 以及 Portal 服务端转发的目标连接上注入延迟、抖动和丢包，无需真实的弱网即可验证自适应缓冲、
+// 重连和路径选择。通过 debug_netem / GMSSH_NETEM / --netem 开启，只在本进程生效
+package netem
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Config 注入的网络条件，零值表示不注入
+type Config struct {
+	// Delay 每个方向的单程延迟，往返增加 2×Delay
+	Delay time.Duration
+	// Jitter 每个数据块的延迟在 Delay±Jitter 内均匀分布（不会乱序）
+	Jitter time.Duration
+	// Loss 丢包百分比（0-100）。TCP 会重传，被"丢弃"的数据块额外延迟一个重传超时后送达
+	Loss float64
+}
+
+// Enabled 是否注入任何条件
+func (c Config) Enabled() bool {
+	return c.Delay > 0 || c.Jitter > 0 || c.Loss > 0
+}
+
+// String 返回与 Parse 格式相同的描述
+func (c Config) String() string {
+	return fmt.Sprintf("delay=%v,jitter=%v,loss=%s%%", c.Delay, c.Jitter, strconv.FormatFloat(c.Loss, 'f', -1, 64))
+}
+
+// Parse 解析 "delay=100ms,jitter=20ms,loss=1%"，各项均可省略，spec 为空时返回零值
+func Parse(spec string) (Config, error) {
+	var cfg Config
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return Config{}, fmt.Errorf("invalid netem setting %q: want key=value", item)
+		}
+		var err error
+		switch strings.TrimSpace(key) {
+		case "delay":
+			cfg.Delay, err = time.ParseDuration(strings.TrimSpace(value))
+		case "jitter":
+			cfg.Jitter, err = time.ParseDuration(strings.TrimSpace(value))
+		case "loss":
+			cfg.Loss, err = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+		default:
+			return Config{}, fmt.Errorf("unknown netem setting %q (delay, jitter, loss)", key)
+		}
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid netem %s %q: %w", key, value, err)
+		}
+	}
+	if cfg.Delay < 0 || cfg.Jitter < 0 || cfg.Loss < 0 || cfg.Loss > 100 {
+		return Config{}, fmt.Errorf("invalid netem settings %q: durations must not be negative and loss must be 0-100", spec)
+	}
+	return cfg, nil
+}
+
+// current 本进程注入的条件，由 Set 设置
+var current atomic.Pointer[Config]
+
+// Set 解析 spec 并设为本进程注入的条件，spec 为空时关闭
+func Set(spec string) error {
+	cfg, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+	current.Store(&cfg)
+	if cfg.Enabled() {
+		log.Printf("[Netem] Injecting %s into SSH, portal and forwarder connections (debug only)", cfg)
+	}
+	return nil
+}
+
+// Current 返回本进程注入的条件
+func Current() Config {
+	if cfg := current.Load(); cfg != nil {
+		return *cfg
+	}
+	return Config{}
+}
+
+// Wrap 按本进程的条件包装连接，未开启时原样返回
+func Wrap(conn net.Conn) net.Conn {
+	return WrapWith(conn, Current())
+}
+
+// WrapWith 按 cfg 包装连接，cfg 未开启时原样返回
+func WrapWith(conn net.Conn, cfg Config) net.Conn {
+	if !cfg.Enabled() {
+		return conn
+	}
+	return newConn(conn, cfg)
+}
@@ -0,0 +1,147 @@
+package netem
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Config
+		wantErr bool
+	}{
+		{"", Config{}, false},
+		{"delay=100ms", Config{Delay: 100 * time.Millisecond}, false},
+		{"delay=80ms, jitter=10ms, loss=1.5%", Config{Delay: 80 * time.Millisecond, Jitter: 10 * time.Millisecond, Loss: 1.5}, false},
+		{"loss=2", Config{Loss: 2}, false},
+		{"delay=fast", Config{}, true},
+		{"loss=120%", Config{}, true},
+		{"delay=-1s", Config{}, true},
+		{"bandwidth=1mbit", Config{}, true},
+		{"delay", Config{}, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.spec)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Parse(%q) = %+v, %v", tt.spec, got, err)
+		}
+	}
+	if cfg, _ := Parse("delay=80ms,jitter=10ms,loss=1.5%"); cfg.String() != "delay=80ms,jitter=10ms,loss=1.5%" {
+		t.Errorf("String = %q", cfg.String())
+	}
+}
+
+// echoPair 返回连到本机回显服务的 TCP 连接
+func echoPair(t *testing.T) net.Conn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestWrapDelaysBothDirections(t *testing.T) {
+	if conn := echoPair(t); WrapWith(conn, Config{}) != conn {
+		t.Error("zero config should not wrap")
+	}
+
+	conn := WrapWith(echoPair(t), Config{Delay: 40 * time.Millisecond})
+	defer conn.Close()
+	start := time.Now()
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo = %q, %v", buf, err)
+	}
+	if rtt := time.Since(start); rtt < 80*time.Millisecond {
+		t.Errorf("round trip took %v, want at least 80ms", rtt)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := conn.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read past deadline = %v", err)
+	}
+}
+
+func TestWrapKeepsOrderUnderJitterAndLoss(t *testing.T) {
+	conn := WrapWith(echoPair(t), Config{Delay: time.Millisecond, Jitter: time.Millisecond, Loss: 5})
+	defer conn.Close()
+
+	data := make([]byte, 512*1024)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range data {
+		data[i] = byte(rng.Uint32())
+	}
+	go func() {
+		for off := 0; off < len(data); off += 4096 {
+			if _, err := conn.Write(data[off : off+4096]); err != nil {
+				return
+			}
+		}
+	}()
+	got := make([]byte, len(data))
+	conn.SetReadDeadline(time.Now().Add(20 * time.Second))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("data reordered or corrupted")
+	}
+}
+
+func TestCloseFlushesPendingWrites(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+	raw, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := WrapWith(raw, Config{Delay: 30 * time.Millisecond})
+	conn.Write([]byte("last words"))
+	conn.Close()
+	if _, err := conn.Write([]byte("x")); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+	select {
+	case data := <-received:
+		if string(data) != "last words" {
+			t.Errorf("peer received %q", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer did not see the connection close")
+	}
+}
@@ -3,15 +3,23 @@ package client
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/luobobo896/HSSH/internal/netem"
 	"github.com/luobobo896/HSSH/internal/portal/protocol"
+	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/internal/tracing"
 	"github.com/luobobo896/HSSH/pkg/portal"
+	"github.com/xtaci/smux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Client portal client
@@ -22,8 +30,9 @@ type Client struct {
 	serverAddr string
 
 	// Connection
-	mux  *protocol.ClientMux
-	conn net.Conn
+	mux    *protocol.ClientMux
+	conn   net.Conn
+	connMu sync.Mutex // serializes (re)connects
 
 	// State
 	ctx     context.Context
@@ -34,6 +43,11 @@ type Client struct {
 	// Mappings
 	mappings map[string]*MappingState
 	wg       sync.WaitGroup
+
+	// Mappings from the config file and from the server (see sync.go)
+	syncMu    sync.Mutex
+	sources   map[string]string // mapping_id -> SourceConfig / SourceServer
+	bindCheck func(localAddr string) (string, error)
 }
 
 // MappingState tracks a single local port mapping
@@ -55,6 +69,7 @@ func NewClient(config *portal.ClientConfig, tlsConfig *tls.Config, token, server
 		token:      token,
 		serverAddr: serverAddr,
 		mappings:   make(map[string]*MappingState),
+		sources:    make(map[string]string),
 		ctx:        ctx,
 		cancel:     cancel,
 	}
@@ -62,10 +77,18 @@ func NewClient(config *portal.ClientConfig, tlsConfig *tls.Config, token, server
 
 // Connect establishes connection to portal server
 func (c *Client) Connect() error {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.dial()
+}
+
+// dial opens a new session; caller holds connMu
+func (c *Client) dial() error {
 	conn, err := net.Dial("tcp", c.serverAddr)
 	if err != nil {
 		return fmt.Errorf("failed to connect to server %s: %w", c.serverAddr, err)
 	}
+	conn = netem.Wrap(conn)
 
 	// Create smux client session over TLS
 	mux, err := protocol.NewClientMux(conn, c.tlsConfig, nil)
@@ -74,22 +97,78 @@ func (c *Client) Connect() error {
 		return fmt.Errorf("failed to create mux: %w", err)
 	}
 
+	c.mu.Lock()
 	c.conn = conn
 	c.mux = mux
+	c.mu.Unlock()
 	c.running.Store(true)
 
 	log.Printf("[Portal Client] Connected to server %s", c.serverAddr)
 	return nil
 }
 
+// session returns a live mux, reconnecting if the server went away. Behind a
+// VIP/DNS pair the new connection lands on whichever node survived; mappings
+// are replicated between nodes so they need no re-provisioning.
+func (c *Client) session() (*protocol.ClientMux, error) {
+	c.mu.RLock()
+	mux := c.mux
+	c.mu.RUnlock()
+	if mux != nil && !mux.IsClosed() {
+		return mux, nil
+	}
+
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	// Another connection may have reconnected while we waited
+	c.mu.RLock()
+	mux = c.mux
+	c.mu.RUnlock()
+	if mux != nil && !mux.IsClosed() {
+		return mux, nil
+	}
+
+	defaults := portal.DefaultConnectionConfig()
+	retry, maxRetries := defaults.RetryInterval, defaults.MaxRetries
+	if c.config != nil && c.config.Connection.RetryInterval > 0 {
+		retry = c.config.Connection.RetryInterval
+	}
+	if c.config != nil && c.config.Connection.MaxRetries > 0 {
+		maxRetries = c.config.Connection.MaxRetries
+	}
+
+	var err error
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		if c.ctx.Err() != nil {
+			return nil, c.ctx.Err()
+		}
+		if err = c.dial(); err == nil {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			return c.mux, nil
+		}
+		log.Printf("[Portal Client] Reconnect attempt %d/%d failed: %v", attempt, maxRetries, err)
+		if attempt < maxRetries {
+			select {
+			case <-c.ctx.Done():
+				return nil, c.ctx.Err()
+			case <-time.After(retry):
+			}
+		}
+	}
+	return nil, err
+}
+
 // StartMapping starts a single port mapping
 func (c *Client) StartMapping(mapping portal.PortMapping) error {
 	if !c.running.Load() {
 		return fmt.Errorf("client not connected")
 	}
 
-	// Start local listener
-	listener, err := net.Listen("tcp", mapping.LocalAddr)
+	// Start local listener; a unix socket path replaces a stale socket file
+	// and is removed again when the mapping stops
+	listener, err := proxy.Listen(mapping.LocalAddr)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", mapping.LocalAddr, err)
 	}
@@ -108,8 +187,8 @@ func (c *Client) StartMapping(mapping portal.PortMapping) error {
 	c.wg.Add(1)
 	go c.acceptLoop(state)
 
-	log.Printf("[Portal Client] Started mapping %s: %s -> %s:%d",
-		mapping.Name, mapping.LocalAddr, mapping.RemoteHost, mapping.RemotePort)
+	log.Printf("[Portal Client] Started mapping %s: %s -> %s",
+		mapping.Name, mapping.LocalAddr, proxy.TargetAddr(mapping.RemoteHost, mapping.RemotePort))
 	return nil
 }
 
@@ -124,9 +203,11 @@ func (c *Client) acceptLoop(state *MappingState) {
 			case <-c.ctx.Done():
 				return
 			default:
-				if state.Active.Load() {
-					log.Printf("[Portal Client] Accept error on %s: %v", state.Mapping.LocalAddr, err)
+				// StopMapping closed the listener
+				if !state.Active.Load() {
+					return
 				}
+				log.Printf("[Portal Client] Accept error on %s: %v", state.Mapping.LocalAddr, err)
 				continue
 			}
 		}
@@ -141,37 +222,114 @@ func (c *Client) acceptLoop(state *MappingState) {
 	}
 }
 
+// errRejected marks a stream the server refused, as opposed to a dead session
+var errRejected = errors.New("rejected by server")
+
+// openDataStream opens a stream for a mapping and performs the handshake
+func (c *Client) openDataStream(ctx context.Context, mux *protocol.ClientMux, state *MappingState) (*smux.Stream, error) {
+	stream, err := mux.OpenStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+
+	// Handshake: identify the mapping so the server can authorize and route it
+	header := protocol.StreamHeader{
+		Type:       protocol.StreamData,
+		Token:      c.token,
+		MappingID:  state.Mapping.ID,
+		RemoteHost: state.Mapping.RemoteHost,
+		RemotePort: state.Mapping.RemotePort,
+		Resolver:   state.Mapping.Resolver,
+
+		IdleTimeout: state.Mapping.IdleTimeout,
+		MaxLifetime: state.Mapping.MaxLifetime,
+
+		TraceParent: tracing.Inject(ctx),
+	}
+	if err := protocol.WriteMessage(stream, header); err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("failed to send stream header: %w", err)
+	}
+	var reply protocol.StreamReply
+	if err := protocol.ReadMessage(stream, &reply); err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("failed to read stream reply: %w", err)
+	}
+	if !reply.OK {
+		stream.Close()
+		return nil, fmt.Errorf("%w: %s", errRejected, reply.Error)
+	}
+	return stream, nil
+}
+
 // handleConnection handles a single local connection
 func (c *Client) handleConnection(localConn net.Conn, state *MappingState) {
 	defer localConn.Close()
 
-	// Open stream to server
-	stream, err := c.mux.OpenStream()
-	if err != nil {
-		log.Printf("[Portal Client] Failed to open stream: %v", err)
+	// One span per stream, from handshake to close
+	ctx, span := tracing.Start(context.Background(), "portal.stream",
+		attribute.String("portal.mapping_id", state.Mapping.ID),
+		attribute.String("portal.mapping", state.Mapping.Name),
+		attribute.String("portal.remote", proxy.TargetAddr(state.Mapping.RemoteHost, state.Mapping.RemotePort)),
+	)
+	var streamErr error
+	defer func() { tracing.End(span, streamErr) }()
+
+	// A session whose server just died may not be noticed as closed yet;
+	// drop it on a transport error and retry once on a fresh one
+	var stream *smux.Stream
+	for attempt := 0; attempt < 2; attempt++ {
+		mux, err := c.session()
+		if err != nil {
+			log.Printf("[Portal Client] No session to server: %v", err)
+			streamErr = err
+			return
+		}
+		stream, err = c.openDataStream(ctx, mux, state)
+		if err == nil {
+			break
+		}
+		log.Printf("[Portal Client] Mapping %s: %v", state.Mapping.Name, err)
+		span.AddEvent("stream open failed", trace.WithAttributes(attribute.String("error", err.Error())))
+		streamErr = err
+		if errors.Is(err, errRejected) {
+			return
+		}
+		mux.Close()
+	}
+	if stream == nil {
 		return
 	}
+	streamErr = nil
 	defer stream.Close()
 
-	// TODO: Send mapping ID to server (protocol handshake)
-	// For now, just forward raw data
-
 	// Bidirectional copy
+	var bytesIn, bytesOut atomic.Int64
 	errCh := make(chan error, 2)
 
 	go func() {
 		n, err := io.Copy(stream, localConn)
 		state.BytesIn.Add(n)
+		bytesIn.Add(n)
 		errCh <- err
 	}()
 
 	go func() {
 		n, err := io.Copy(localConn, stream)
 		state.BytesOut.Add(n)
+		bytesOut.Add(n)
 		errCh <- err
 	}()
 
+	// Close both ends so the other direction finishes and its bytes are counted
 	<-errCh
+	stream.Close()
+	localConn.Close()
+	<-errCh
+	span.SetAttributes(
+		attribute.Int64("portal.bytes_in", bytesIn.Load()),
+		attribute.Int64("portal.bytes_out", bytesOut.Load()),
+	)
 }
 
 // StopMapping stops a port mapping
@@ -209,15 +367,15 @@ func (c *Client) Close() error {
 	}
 	c.mu.Unlock()
 
-	// Close mux
+	// Close mux and connection
+	c.mu.Lock()
 	if c.mux != nil {
 		c.mux.Close()
 	}
-
-	// Close connection
 	if c.conn != nil {
 		c.conn.Close()
 	}
+	c.mu.Unlock()
 
 	c.wg.Wait()
 	log.Printf("[Portal Client] Disconnected")
@@ -226,6 +384,8 @@ func (c *Client) Close() error {
 
 // IsConnected returns true if connected to server
 func (c *Client) IsConnected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.running.Load() && c.mux != nil && !c.mux.IsClosed()
 }
 
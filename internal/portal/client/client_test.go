@@ -374,6 +374,67 @@ func TestGetMappingStatus(t *testing.T) {
 
 // Manager Tests
 
+func TestReloadMappings(t *testing.T) {
+	tlsConfig := generateTestTLSConfig(t)
+	serverAddr, _, cleanup := startTestServer(t, tlsConfig)
+	defer cleanup()
+
+	client := NewClient(&portal.ClientConfig{}, tlsConfig, "test-token", serverAddr)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	mapping := func(id string, port int, enabled bool) portal.PortMapping {
+		return portal.PortMapping{ID: id, Name: id, LocalAddr: ":0", RemoteHost: "remote.example.com", RemotePort: port, Enabled: enabled}
+	}
+	listener := func(id string) net.Listener {
+		client.mu.RLock()
+		defer client.mu.RUnlock()
+		if state, ok := client.mappings[id]; ok {
+			return state.Listener
+		}
+		return nil
+	}
+
+	// Addresses without a host are normalized by the bind check
+	client.SetBindCheck(func(addr string) (string, error) { return "127.0.0.1" + addr, nil })
+	if err := client.ReloadMappings([]portal.PortMapping{mapping("keep", 80, true), mapping("change", 81, true), mapping("drop", 82, true)}); err != nil {
+		t.Fatalf("Initial load failed: %v", err)
+	}
+	keep, change := listener("keep"), listener("change")
+	if keep == nil || change == nil || listener("drop") == nil {
+		t.Fatal("Expected all mappings to be running")
+	}
+	if got := client.MappingSource("keep"); got != SourceConfig {
+		t.Errorf("MappingSource = %q, want %q", got, SourceConfig)
+	}
+
+	err := client.ReloadMappings([]portal.PortMapping{mapping("keep", 80, true), mapping("change", 90, true), mapping("off", 83, false), {Name: "no-id"}})
+	if err == nil {
+		t.Error("Expected an error for the mapping without id")
+	}
+	if listener("keep") != keep {
+		t.Error("Unchanged mapping should keep its listener")
+	}
+	if l := listener("change"); l == nil || l == change {
+		t.Error("Changed mapping should be restarted")
+	}
+	if listener("drop") != nil || listener("off") != nil {
+		t.Error("Removed and disabled mappings should not run")
+	}
+	if client.MappingSource("drop") != "" {
+		t.Error("Removed mapping should be forgotten")
+	}
+	// A mapping the config owns cannot be taken over by the server
+	if err := client.applyEvent(protocol.MappingEvent{Op: protocol.MappingUpdate, Mapping: mapping("keep", 99, true)}); err == nil {
+		t.Error("Expected pushed update of a config mapping to fail")
+	}
+	if err := client.applyEvent(protocol.MappingEvent{Op: protocol.MappingRemove, Mapping: portal.PortMapping{ID: "keep"}}); err != nil || listener("keep") != keep {
+		t.Errorf("Pushed remove must not stop a config mapping: %v", err)
+	}
+}
+
 func TestNewManager(t *testing.T) {
 	manager := NewManager()
 	if manager == nil {
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/portal/protocol"
+	"github.com/luobobo896/HSSH/pkg/portal"
+)
+
+// Mapping sources: a client runs the mappings of its config file next to
+// the ones the server pushes, and reconciles each set on its own
+const (
+	SourceConfig = "config"
+	SourceServer = "server"
+)
+
+// SetBindCheck sets how the local address of a config or pushed mapping is
+// checked and normalized before it is started; nil starts it as given
+func (c *Client) SetBindCheck(check func(localAddr string) (string, error)) {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	c.bindCheck = check
+}
+
+// ReloadMappings replaces the mappings from the config file: new ones are
+// started, changed ones restarted, missing or disabled ones stopped, and
+// unchanged ones keep their connections
+func (c *Client) ReloadMappings(mappings []portal.PortMapping) error {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	return c.reconcileLocked(SourceConfig, mappings)
+}
+
+// reconcileLocked makes the running mappings of source match mappings;
+// caller holds syncMu
+func (c *Client) reconcileLocked(source string, mappings []portal.PortMapping) error {
+	wanted := make(map[string]bool, len(mappings))
+	var errs []error
+	for _, mapping := range mappings {
+		wanted[mapping.ID] = true
+		if err := c.applyLocked(source, mapping); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	var stale []string
+	for id, owner := range c.sources {
+		if owner == source && !wanted[id] {
+			stale = append(stale, id)
+		}
+	}
+	sort.Strings(stale)
+	for _, id := range stale {
+		c.removeLocked(id)
+	}
+	return errors.Join(errs...)
+}
+
+// applyLocked starts, restarts or stops one mapping of source; caller holds syncMu
+func (c *Client) applyLocked(source string, mapping portal.PortMapping) error {
+	if mapping.ID == "" {
+		return fmt.Errorf("mapping %q has no id", mapping.Name)
+	}
+	if owner, ok := c.sources[mapping.ID]; ok && owner != source {
+		return fmt.Errorf("mapping %s is already managed by the %s", mapping.ID, owner)
+	}
+	if c.bindCheck != nil && mapping.Enabled {
+		addr, err := c.bindCheck(mapping.LocalAddr)
+		if err != nil {
+			return fmt.Errorf("mapping %s: %w", mapping.ID, err)
+		}
+		mapping.LocalAddr = addr
+	}
+
+	c.mu.RLock()
+	state, running := c.mappings[mapping.ID]
+	c.mu.RUnlock()
+	if running && mapping.Enabled && reflect.DeepEqual(state.Mapping, mapping) {
+		c.sources[mapping.ID] = source
+		return nil
+	}
+	if running {
+		c.StopMapping(mapping.ID)
+	}
+	if !mapping.Enabled {
+		delete(c.sources, mapping.ID)
+		return nil
+	}
+	if err := c.StartMapping(mapping); err != nil {
+		delete(c.sources, mapping.ID)
+		return fmt.Errorf("mapping %s: %w", mapping.ID, err)
+	}
+	c.sources[mapping.ID] = source
+	return nil
+}
+
+// removeLocked stops a mapping owned by a source; caller holds syncMu
+func (c *Client) removeLocked(id string) {
+	delete(c.sources, id)
+	c.mu.RLock()
+	_, running := c.mappings[id]
+	c.mu.RUnlock()
+	if running {
+		c.StopMapping(id)
+	}
+}
+
+// SyncMappings keeps a control stream open to the server and runs the
+// mappings it pushes for this client's token, re-opening the stream (and
+// reconnecting) until the client is closed
+func (c *Client) SyncMappings() {
+	c.wg.Add(1)
+	go c.controlLoop()
+}
+
+// controlLoop re-opens the control stream whenever it ends
+func (c *Client) controlLoop() {
+	defer c.wg.Done()
+
+	retry := portal.DefaultConnectionConfig().RetryInterval
+	if c.config != nil && c.config.Connection.RetryInterval > 0 {
+		retry = c.config.Connection.RetryInterval
+	}
+	for {
+		err := c.runControl()
+		if c.ctx.Err() != nil {
+			return
+		}
+		// An older server or an unknown token: keep running local mappings only
+		if errors.Is(err, errRejected) {
+			log.Printf("[Portal Client] Server does not push mappings: %v", err)
+			return
+		}
+		log.Printf("[Portal Client] Control stream ended: %v", err)
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// runControl opens one control stream, applies the snapshot and then every
+// pushed event until the stream fails
+func (c *Client) runControl() error {
+	mux, err := c.session()
+	if err != nil {
+		return err
+	}
+	stream, err := mux.OpenStream()
+	if err != nil {
+		mux.Close()
+		return fmt.Errorf("failed to open control stream: %w", err)
+	}
+	defer stream.Close()
+	// Close wakes up the blocked read below
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			stream.Close()
+		case <-stop:
+		}
+	}()
+
+	if err := protocol.WriteMessage(stream, protocol.StreamHeader{Type: protocol.StreamControl, Token: c.token}); err != nil {
+		return fmt.Errorf("failed to send control header: %w", err)
+	}
+	var reply protocol.StreamReply
+	if err := protocol.ReadMessage(stream, &reply); err != nil {
+		return fmt.Errorf("failed to read control reply: %w", err)
+	}
+	if !reply.OK {
+		return fmt.Errorf("%w: %s", errRejected, reply.Error)
+	}
+
+	var snap protocol.MappingSnapshot
+	if err := protocol.ReadMessage(stream, &snap); err != nil {
+		return fmt.Errorf("failed to read mapping snapshot: %w", err)
+	}
+	c.syncMu.Lock()
+	err = c.reconcileLocked(SourceServer, snap.Mappings)
+	c.syncMu.Unlock()
+	if err != nil {
+		log.Printf("[Portal Client] Some pushed mappings failed: %v", err)
+	}
+	log.Printf("[Portal Client] Synced %d mappings from server", len(snap.Mappings))
+
+	for {
+		var event protocol.MappingEvent
+		if err := protocol.ReadMessage(stream, &event); err != nil {
+			return err
+		}
+		if err := c.applyEvent(event); err != nil {
+			log.Printf("[Portal Client] Pushed %s of mapping %s failed: %v", event.Op, event.Mapping.ID, err)
+		}
+	}
+}
+
+// applyEvent applies one pushed mapping change
+func (c *Client) applyEvent(event protocol.MappingEvent) error {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+
+	switch event.Op {
+	case protocol.MappingAdd, protocol.MappingUpdate:
+		return c.applyLocked(SourceServer, event.Mapping)
+	case protocol.MappingRemove:
+		if c.sources[event.Mapping.ID] == SourceServer {
+			c.removeLocked(event.Mapping.ID)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown op %q", event.Op)
+	}
+}
+
+// MappingSource returns which source a running mapping came from: SourceConfig,
+// SourceServer or "" for one started directly with StartMapping
+func (c *Client) MappingSource(id string) string {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	return c.sources[id]
+}
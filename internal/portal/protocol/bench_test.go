@@ -0,0 +1,105 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/netem"
+)
+
+// BenchmarkStreamThroughput measures one mux stream uploading to the server while
+// netem delays the client connection, so smux's window is exercised at each RTT
+func BenchmarkStreamThroughput(b *testing.B) {
+	for _, rtt := range []time.Duration{0, 20 * time.Millisecond, 100 * time.Millisecond} {
+		b.Run(fmt.Sprintf("rtt=%v", rtt), func(b *testing.B) {
+			benchmarkStreamThroughput(b, netem.Config{Delay: rtt / 2})
+		})
+	}
+}
+
+func benchmarkStreamThroughput(b *testing.B, cfg netem.Config) {
+	const chunkSize = 64 * 1024
+
+	serverConfig, clientConfig, err := getTestTLSConfig()
+	if err != nil {
+		b.Fatalf("Failed to generate test certificates: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("Failed to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	// The server reads the announced number of bytes, then acknowledges with one byte
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		mux, err := NewServerMux(conn, serverConfig, nil)
+		if err != nil {
+			conn.Close()
+			serverErr <- err
+			return
+		}
+		defer mux.Close()
+		stream, err := mux.AcceptStream()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer stream.Close()
+		var total int64
+		if err := binary.Read(stream, binary.BigEndian, &total); err != nil {
+			serverErr <- err
+			return
+		}
+		if _, err := io.CopyN(io.Discard, stream, total); err != nil {
+			serverErr <- err
+			return
+		}
+		_, err = stream.Write([]byte{1})
+		serverErr <- err
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		b.Fatalf("Failed to dial: %v", err)
+	}
+	clientMux, err := NewClientMux(netem.WrapWith(conn, cfg), clientConfig, nil)
+	if err != nil {
+		conn.Close()
+		b.Fatalf("NewClientMux failed: %v", err)
+	}
+	defer clientMux.Close()
+	stream, err := clientMux.OpenStream()
+	if err != nil {
+		b.Fatalf("OpenStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	chunk := make([]byte, chunkSize)
+	b.SetBytes(chunkSize)
+	b.ResetTimer()
+	if err := binary.Write(stream, binary.BigEndian, int64(b.N)*chunkSize); err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		if _, err := stream.Write(chunk); err != nil {
+			b.Fatalf("Write failed: %v", err)
+		}
+	}
+	if _, err := io.ReadFull(stream, make([]byte, 1)); err != nil {
+		b.Fatalf("Waiting for acknowledgement: %v", err)
+	}
+	b.StopTimer()
+	if err := <-serverErr; err != nil {
+		b.Fatalf("Server: %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package protocol
+
+import "github.com/luobobo896/HSSH/pkg/portal"
+
+// MappingOp is the kind of change carried by a MappingEvent
+type MappingOp string
+
+const (
+	MappingAdd    MappingOp = "add"
+	MappingUpdate MappingOp = "update"
+	MappingRemove MappingOp = "remove"
+)
+
+// MappingSnapshot is the first message on a control stream after the reply:
+// every centrally managed mapping of the client's token. Mappings the client
+// received earlier but that are missing here were removed while it was away.
+type MappingSnapshot struct {
+	Mappings []portal.PortMapping `json:"mappings"`
+}
+
+// MappingEvent is a single mapping change pushed on a control stream. Remove
+// events carry only the mapping ID.
+type MappingEvent struct {
+	Op      MappingOp          `json:"op"`
+	Mapping portal.PortMapping `json:"mapping"`
+}
@@ -0,0 +1,44 @@
+package protocol
+
+import "time"
+
+// StreamType identifies what a stream carries
+type StreamType string
+
+const (
+	// StreamData carries forwarded traffic for a port mapping
+	StreamData StreamType = "data"
+	// StreamSync exchanges replicated state between portal server nodes
+	StreamSync StreamType = "sync"
+	// StreamControl stays open while a client is connected and carries
+	// server-pushed mapping changes for the client's token
+	StreamControl StreamType = "control"
+)
+
+// StreamHeader is the first message on every client-opened stream
+type StreamHeader struct {
+	Type StreamType `json:"type"`
+
+	// Data and control streams
+	Token      string `json:"token,omitempty"`
+	MappingID  string `json:"mapping_id,omitempty"`
+	RemoteHost string `json:"remote_host,omitempty"`
+	RemotePort int    `json:"remote_port,omitempty"`
+	// How the server resolves RemoteHost: "" (system), "system" or "dns:<server>"
+	Resolver string `json:"resolver,omitempty"`
+	// Stream limits for the mapping; zero uses the server defaults
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty"`
+	MaxLifetime time.Duration `json:"max_lifetime,omitempty"`
+	// W3C traceparent of the client span, so both ends join one trace
+	TraceParent string `json:"traceparent,omitempty"`
+
+	// Sync streams
+	NodeID string `json:"node_id,omitempty"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// StreamReply is the server's answer to a stream header
+type StreamReply struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
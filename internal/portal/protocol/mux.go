@@ -117,6 +117,16 @@ func (c *ClientMux) OpenStream() (*smux.Stream, error) {
 	return c.session.OpenStream()
 }
 
+// OpenStream opens a new stream from the server side (server-initiated requests)
+func (s *ServerMux) OpenStream() (*smux.Stream, error) {
+	return s.session.OpenStream()
+}
+
+// AcceptStream accepts a stream opened by the server side
+func (c *ClientMux) AcceptStream() (*smux.Stream, error) {
+	return c.session.AcceptStream()
+}
+
 // Close closes the mux session
 func (s *ServerMux) Close() error {
 	return s.session.Close()
@@ -0,0 +1,134 @@
+package protocol
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// GenerateSelfSignedTLS generates a self-signed certificate for development use
+func GenerateSelfSignedTLS() (*tls.Config, error) {
+	certPEM, keyPEM, err := selfSignedPEM(24 * time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	return keyPairTLS(certPEM, keyPEM)
+}
+
+// LoadOrCreateSelfSignedTLS loads the certificate and key at certFile and keyFile,
+// creating a self-signed pair valid for validity (both files 0600) when either is missing.
+// The fingerprint therefore stays the same across restarts, so pinned clients keep working
+func LoadOrCreateSelfSignedTLS(certFile, keyFile string, validity time.Duration) (*tls.Config, error) {
+	certPEM, certErr := os.ReadFile(certFile)
+	keyPEM, keyErr := os.ReadFile(keyFile)
+	switch {
+	case certErr == nil && keyErr == nil:
+		return keyPairTLS(certPEM, keyPEM)
+	case certErr != nil && !os.IsNotExist(certErr):
+		return nil, fmt.Errorf("failed to read certificate: %w", certErr)
+	case keyErr != nil && !os.IsNotExist(keyErr):
+		return nil, fmt.Errorf("failed to read private key: %w", keyErr)
+	}
+
+	certPEM, keyPEM, err := selfSignedPEM(validity)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write certificate: %w", err)
+	}
+	return keyPairTLS(certPEM, keyPEM)
+}
+
+// selfSignedPEM creates a P-256 key and a self-signed certificate valid for validity
+func selfSignedPEM(validity time.Duration) (certPEM, keyPEM []byte, err error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"HSSH Portal"},
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(validity),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	privBytes, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privBytes})
+	return certPEM, keyPEM, nil
+}
+
+// keyPairTLS builds a server TLS config from a PEM certificate and key
+func keyPairTLS(certPEM, keyPEM []byte) (*tls.Config, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key pair: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}, nil
+}
+
+// CertFingerprint returns the SHA-256 fingerprint of the first certificate in the config
+func CertFingerprint(config *tls.Config) string {
+	if config == nil || len(config.Certificates) == 0 || len(config.Certificates[0].Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(config.Certificates[0].Certificate[0])
+	return hex.EncodeToString(sum[:])
+}
+
+// PinnedClientTLS returns a client TLS config that only accepts a server
+// certificate with the given SHA-256 fingerprint (useful for self-signed certs)
+func PinnedClientTLS(fingerprint string) *tls.Config {
+	want := strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+	return &tls.Config{
+		// Chain verification is replaced by the fingerprint check below
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("no server certificate")
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			if got := hex.EncodeToString(sum[:]); got != want {
+				return fmt.Errorf("server certificate fingerprint mismatch: got %s", got)
+			}
+			return nil
+		},
+	}
+}
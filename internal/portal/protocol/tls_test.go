@@ -0,0 +1,51 @@
+package protocol
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadOrCreateSelfSignedTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "hub.crt")
+	keyFile := filepath.Join(dir, "hub.key")
+
+	first, err := LoadOrCreateSelfSignedTLS(certFile, keyFile, 365*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{certFile, keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("%s has mode %o, want 600", filepath.Base(path), perm)
+		}
+	}
+	leaf := first.Certificates[0].Leaf
+	if leaf == nil || time.Until(leaf.NotAfter) < 364*24*time.Hour {
+		t.Errorf("certificate does not use the requested validity: %+v", leaf)
+	}
+
+	// A restart reuses the saved pair, so the fingerprint stays the same
+	second, err := LoadOrCreateSelfSignedTLS(certFile, keyFile, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if CertFingerprint(first) != CertFingerprint(second) {
+		t.Error("fingerprint changed on reload")
+	}
+
+	// A missing key regenerates both files
+	os.Remove(keyFile)
+	third, err := LoadOrCreateSelfSignedTLS(certFile, keyFile, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if CertFingerprint(third) == CertFingerprint(first) {
+		t.Error("certificate was not regenerated without its key")
+	}
+}
@@ -3,7 +3,10 @@ package server
 import (
 	"fmt"
 	"net"
+	"path"
+	"strings"
 
+	"github.com/luobobo896/HSSH/internal/proxy"
 	"github.com/luobobo896/HSSH/pkg/portal"
 )
 
@@ -32,6 +35,27 @@ func (a *Authenticator) ValidateToken(token string) (*portal.TokenConfig, error)
 
 // IsRemoteAllowed checks if a remote address is allowed for a token
 func (a *Authenticator) IsRemoteAllowed(tokenConfig *portal.TokenConfig, remoteHost string) bool {
+	return remoteAllowed(tokenConfig, remoteHost)
+}
+
+// remoteAllowed checks a remote host against a token's allowed CIDRs.
+// A unix socket path is only allowed by a matching "unix:<glob>" entry,
+// never by a CIDR or an empty list, so no token opens local sockets on this node by default
+func remoteAllowed(tokenConfig *portal.TokenConfig, remoteHost string) bool {
+	// Checked before the empty-list case: a token without restrictions still gets no sockets
+	if socket, ok := proxy.UnixSocketPath(remoteHost); ok {
+		for _, allowed := range tokenConfig.AllowedRemotes {
+			pattern, ok := strings.CutPrefix(allowed, "unix:")
+			if !ok {
+				continue
+			}
+			if matched, _ := path.Match(pattern, socket); matched {
+				return true
+			}
+		}
+		return false
+	}
+
 	if len(tokenConfig.AllowedRemotes) == 0 {
 		return true // No restrictions
 	}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/portal/protocol"
+	"github.com/xtaci/smux"
+)
+
+const (
+	// DefaultSyncInterval is the default anti-entropy interval between nodes
+	DefaultSyncInterval = 10 * time.Second
+
+	peerTimeout = 10 * time.Second
+)
+
+// peerTLSConfig returns the TLS config used to reach peer nodes. All nodes
+// behind the VIP serve the same certificate, so peers are pinned to our own.
+func (s *Server) peerTLSConfig() *tls.Config {
+	return protocol.PinnedClientTLS(protocol.CertFingerprint(s.tlsConfig))
+}
+
+// syncInterval returns the configured anti-entropy interval
+func (s *Server) syncInterval() time.Duration {
+	if s.config != nil && s.config.Cluster.SyncInterval > 0 {
+		return s.config.Cluster.SyncInterval
+	}
+	return DefaultSyncInterval
+}
+
+// startCluster starts background replication with peer nodes
+func (s *Server) startCluster() {
+	s.wg.Add(1)
+	go s.syncLoop()
+}
+
+// syncLoop first pulls peer state and re-asserts local config on top of it
+// (a restarted node's clock is behind its peers), then exchanges state
+// periodically and right after local writes
+func (s *Server) syncLoop() {
+	defer s.wg.Done()
+
+	s.syncAll()
+	s.loadConfigTokens()
+
+	ticker := time.NewTicker(s.syncInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.syncKick:
+		}
+		s.syncAll()
+	}
+}
+
+// kickSync requests an immediate sync without blocking
+func (s *Server) kickSync() {
+	select {
+	case s.syncKick <- struct{}{}:
+	default:
+	}
+}
+
+// syncAll exchanges state with every peer, logging only when a peer
+// goes down or comes back rather than on every failed round
+func (s *Server) syncAll() {
+	for _, peer := range s.config.Cluster.Peers {
+		err := s.syncWithPeer(peer)
+		if err != nil && !s.peerDown[peer] {
+			log.Printf("[Portal Server] Sync with peer %s failed: %v", peer, err)
+		} else if err == nil && s.peerDown[peer] {
+			log.Printf("[Portal Server] Peer %s is reachable again", peer)
+		}
+		s.peerDown[peer] = err != nil
+	}
+}
+
+// errSecretRejected is returned when a peer accepts none of our secrets
+var errSecretRejected = errors.New("peer rejected the cluster secret")
+
+// syncWithPeer sends our snapshot to a peer and merges the peer's snapshot.
+// During a secret rotation it retries with the next secret if the peer
+// rejects the current one.
+func (s *Server) syncWithPeer(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, peerTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(peerTimeout))
+
+	mux, err := protocol.NewClientMux(conn, s.peerTLSConfig(), nil)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer mux.Close()
+
+	for i, secret := range s.secrets.candidates() {
+		err = s.syncStream(mux, secret)
+		if errors.Is(err, errSecretRejected) {
+			continue
+		}
+		if err == nil {
+			slot := SecretCurrent
+			if i > 0 {
+				slot = SecretNext
+			}
+			s.secrets.recordOutgoing(addr, slot)
+		}
+		return err
+	}
+	return err
+}
+
+// syncStream runs one sync exchange authenticated with secret
+func (s *Server) syncStream(mux *protocol.ClientMux, secret string) error {
+	stream, err := mux.OpenStream()
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	header := protocol.StreamHeader{
+		Type:   protocol.StreamSync,
+		NodeID: s.config.Cluster.NodeID,
+		Secret: secret,
+	}
+	if err := protocol.WriteMessage(stream, header); err != nil {
+		return err
+	}
+	if err := protocol.WriteMessage(stream, s.store.Snapshot()); err != nil {
+		return err
+	}
+
+	var reply protocol.StreamReply
+	if err := protocol.ReadMessage(stream, &reply); err != nil {
+		return err
+	}
+	if reply.Error == errInvalidSecret {
+		return errSecretRejected
+	}
+	if !reply.OK {
+		return fmt.Errorf("peer rejected sync: %s", reply.Error)
+	}
+
+	var snap Snapshot
+	if err := protocol.ReadMessage(stream, &snap); err != nil {
+		return err
+	}
+	if n := s.store.Merge(snap); n > 0 {
+		log.Printf("[Portal Server] Merged %d entries from peer %s", n, snap.Node)
+	}
+	return nil
+}
+
+// SetClusterSecrets rotates the secrets accepted from and sent to peers
+func (s *Server) SetClusterSecrets(update SecretUpdate) error {
+	if err := s.secrets.update(update); err != nil {
+		return err
+	}
+	log.Printf("[Portal Server] Cluster secrets updated")
+	return nil
+}
+
+// ValidClusterSecret reports whether secret is one of the active cluster secrets
+func (s *Server) ValidClusterSecret(secret string) bool {
+	return s.secrets.match(secret) != ""
+}
+
+// SecretStats reports which secret each peer last authenticated with
+func (s *Server) SecretStats() SecretStats {
+	return s.secrets.stats()
+}
+
+// handleSyncStream answers a peer's sync request: merge theirs, return ours
+func (s *Server) handleSyncStream(stream *smux.Stream, header protocol.StreamHeader) {
+	slot := s.secrets.match(header.Secret)
+	if slot == "" {
+		protocol.WriteMessage(stream, protocol.StreamReply{Error: errInvalidSecret})
+		return
+	}
+	s.secrets.recordIncoming(header.NodeID, slot)
+
+	stream.SetReadDeadline(time.Now().Add(peerTimeout))
+	var snap Snapshot
+	if err := protocol.ReadMessage(stream, &snap); err != nil {
+		log.Printf("[Portal Server] Failed to read snapshot from peer %s: %v", header.NodeID, err)
+		return
+	}
+	if n := s.store.Merge(snap); n > 0 {
+		log.Printf("[Portal Server] Merged %d entries from peer %s", n, header.NodeID)
+	}
+
+	if err := protocol.WriteMessage(stream, protocol.StreamReply{OK: true}); err != nil {
+		return
+	}
+	protocol.WriteMessage(stream, s.store.Snapshot())
+}
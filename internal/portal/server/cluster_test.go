@@ -0,0 +1,313 @@
+package server
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/portal/client"
+	"github.com/luobobo896/HSSH/pkg/portal"
+)
+
+// testVIP simulates a VIP/DNS name that can be switched to another node
+type testVIP struct {
+	listener net.Listener
+	backend  atomic.Value // string
+}
+
+func newTestVIP(t *testing.T, backend string) *testVIP {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	v := &testVIP{listener: listener}
+	v.backend.Store(backend)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				upstream, err := net.Dial("tcp", v.backend.Load().(string))
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return v
+}
+
+// startEchoServer starts a TCP echo server and returns its port
+func startEchoServer(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// freeAddr returns a currently unused local address
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+// echoRoundTrip sends a message through addr and checks it comes back
+func echoRoundTrip(t *testing.T, addr, msg string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to dial %s: %v", addr, err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if string(buf) != msg {
+		t.Fatalf("Expected %q, got %q", msg, buf)
+	}
+}
+
+// waitFor polls cond until it holds or the timeout expires
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", what)
+}
+
+func TestClusterFailover(t *testing.T) {
+	tlsConfig, err := generateTestTLSConfig()
+	if err != nil {
+		t.Fatalf("Failed to generate TLS config: %v", err)
+	}
+	echoPort := startEchoServer(t)
+
+	// 令牌只配置在节点 A 上，节点 B 通过复制获得
+	cfgA := &portal.ServerConfig{
+		AuthTokens: []portal.TokenConfig{{Token: "tok", MaxMappings: 5}},
+		Cluster:    portal.ClusterConfig{NodeID: "a", Secret: "cluster-secret", SyncInterval: 50 * time.Millisecond},
+	}
+	cfgB := &portal.ServerConfig{
+		Cluster: portal.ClusterConfig{NodeID: "b", Secret: "cluster-secret", SyncInterval: 50 * time.Millisecond},
+	}
+
+	nodeA := NewServer(cfgA, tlsConfig)
+	nodeB := NewServer(cfgB, tlsConfig)
+	if err := nodeA.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	if err := nodeB.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addrA, addrB := nodeA.listener.Addr().String(), nodeB.listener.Addr().String()
+	cfgA.Cluster.Peers = []string{addrB}
+	cfgB.Cluster.Peers = []string{addrA}
+
+	go nodeA.Serve()
+	go nodeB.Serve()
+	defer nodeB.Close()
+
+	waitFor(t, "token to replicate to node b", func() bool {
+		_, ok := nodeB.Store().Token("tok")
+		return ok
+	})
+
+	vip := newTestVIP(t, addrA)
+
+	c := client.NewClient(&portal.ClientConfig{
+		Connection: portal.ConnectionConfig{RetryInterval: 50 * time.Millisecond, MaxRetries: 20},
+	}, &tls.Config{InsecureSkipVerify: true}, "tok", vip.listener.Addr().String())
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer c.Close()
+
+	localAddr := freeAddr(t)
+	mapping := portal.PortMapping{
+		ID:         "m1",
+		Name:       "echo",
+		LocalAddr:  localAddr,
+		RemoteHost: "127.0.0.1",
+		RemotePort: echoPort,
+		Protocol:   portal.ProtocolTCP,
+		Enabled:    true,
+	}
+	if err := c.StartMapping(mapping); err != nil {
+		t.Fatalf("Failed to start mapping: %v", err)
+	}
+
+	echoRoundTrip(t, localAddr, "via node a")
+
+	waitFor(t, "mapping to replicate to node b", func() bool {
+		_, ok := nodeB.Store().Mapping("m1")
+		return ok
+	})
+	before, _ := nodeB.Store().Mapping("m1")
+
+	// 节点 A 宕机，VIP 漂移到节点 B
+	nodeA.Close()
+	vip.backend.Store(addrB)
+
+	echoRoundTrip(t, localAddr, "via node b")
+
+	after, ok := nodeB.Store().Mapping("m1")
+	if !ok || after.Version != before.Version || after.Node != "a" {
+		t.Errorf("expected node b to serve the replicated mapping without re-registering it, before=%+v after=%+v", before, after)
+	}
+}
+
+func TestClusterRejectsWrongSecret(t *testing.T) {
+	tlsConfig, err := generateTestTLSConfig()
+	if err != nil {
+		t.Fatalf("Failed to generate TLS config: %v", err)
+	}
+
+	cfgA := &portal.ServerConfig{
+		AuthTokens: []portal.TokenConfig{{Token: "tok"}},
+		Cluster:    portal.ClusterConfig{NodeID: "a", Secret: "right"},
+	}
+	nodeA := NewServer(cfgA, tlsConfig)
+	if err := nodeA.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go nodeA.Serve()
+	defer nodeA.Close()
+
+	cfgB := &portal.ServerConfig{
+		Cluster: portal.ClusterConfig{NodeID: "b", Secret: "wrong", Peers: []string{nodeA.listener.Addr().String()}},
+	}
+	nodeB := NewServer(cfgB, tlsConfig)
+
+	if err := nodeB.syncWithPeer(cfgB.Cluster.Peers[0]); err == nil {
+		t.Fatal("Expected sync with wrong secret to fail")
+	}
+	if _, ok := nodeB.Store().Token("tok"); ok {
+		t.Error("Token must not replicate without a valid cluster secret")
+	}
+}
+
+func TestClusterSecretRotation(t *testing.T) {
+	tlsConfig, err := generateTestTLSConfig()
+	if err != nil {
+		t.Fatalf("Failed to generate TLS config: %v", err)
+	}
+
+	nodeA := NewServer(&portal.ServerConfig{Cluster: portal.ClusterConfig{NodeID: "a", Secret: "old"}}, tlsConfig)
+	if err := nodeA.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go nodeA.Serve()
+	defer nodeA.Close()
+	addrA := nodeA.listener.Addr().String()
+	nodeB := NewServer(&portal.ServerConfig{Cluster: portal.ClusterConfig{NodeID: "b", Secret: "old"}}, tlsConfig)
+
+	set := func(s *Server, update SecretUpdate) {
+		t.Helper()
+		if err := s.SetClusterSecrets(update); err != nil {
+			t.Fatalf("SetClusterSecrets: %v", err)
+		}
+	}
+	str := func(s string) *string { return &s }
+	// sync 让 b 与 a 同步一次，返回 a 看到的 b 和 b 对 a 使用的密钥
+	sync := func(step string) (incoming, outgoing string) {
+		t.Helper()
+		if err := nodeB.syncWithPeer(addrA); err != nil {
+			t.Fatalf("%s: sync failed: %v", step, err)
+		}
+		in, out := nodeA.SecretStats().Incoming, nodeB.SecretStats().Outgoing
+		if len(in) != 1 || in[0].Peer != "b" || len(out) != 1 || out[0].Peer != addrA {
+			t.Fatalf("%s: stats in=%+v out=%+v", step, in, out)
+		}
+		return in[0].Secret, out[0].Secret
+	}
+
+	if in, out := sync("before rotation"); in != SecretCurrent || out != SecretCurrent {
+		t.Errorf("before rotation: in=%s out=%s", in, out)
+	}
+
+	// 1. a 先接受新密钥，b 仍用旧密钥
+	set(nodeA, SecretUpdate{Next: str("new")})
+	if in, _ := sync("next staged"); in != SecretCurrent {
+		t.Errorf("next staged: a saw b use %s", in)
+	}
+
+	// 2. b 切换到新密钥，a 仍以 next 接受
+	set(nodeB, SecretUpdate{Current: str("new"), Next: str("old")})
+	if in, out := sync("b promoted"); in != SecretNext || out != SecretCurrent {
+		t.Errorf("b promoted: in=%s out=%s", in, out)
+	}
+
+	// 3. a 也切换后丢弃旧密钥，只持有旧密钥的节点被拒绝
+	set(nodeA, SecretUpdate{Current: str("new"), Next: str("old")})
+	set(nodeA, SecretUpdate{Next: str("")})
+	if in, _ := sync("old dropped"); in != SecretCurrent {
+		t.Errorf("old dropped: a saw b use %s", in)
+	}
+	if stats := nodeA.SecretStats(); stats.HasNext || stats.Incoming[0].Current != 3 || stats.Incoming[0].Next != 1 {
+		t.Errorf("a stats = %+v", stats)
+	}
+	stale := NewServer(&portal.ServerConfig{Cluster: portal.ClusterConfig{NodeID: "c", Secret: "old"}}, tlsConfig)
+	if err := stale.syncWithPeer(addrA); err == nil {
+		t.Error("sync with a dropped secret succeeded")
+	}
+
+	// 对端已丢弃我们的 current 时改用 next
+	ahead := NewServer(&portal.ServerConfig{Cluster: portal.ClusterConfig{NodeID: "d", Secret: "older", NextSecret: "new"}}, tlsConfig)
+	if err := ahead.syncWithPeer(addrA); err != nil {
+		t.Fatalf("fallback to next secret failed: %v", err)
+	}
+	if out := ahead.SecretStats().Outgoing; len(out) != 1 || out[0].Secret != SecretNext {
+		t.Errorf("fallback stats = %+v", out)
+	}
+
+	if err := nodeA.SetClusterSecrets(SecretUpdate{Current: str("")}); err == nil {
+		t.Error("empty current secret accepted")
+	}
+	if err := nodeA.SetClusterSecrets(SecretUpdate{Next: str("new")}); err == nil {
+		t.Error("next equal to current accepted")
+	}
+}
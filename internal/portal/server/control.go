@@ -0,0 +1,172 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/luobobo896/HSSH/internal/portal/protocol"
+	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/pkg/portal"
+	"github.com/xtaci/smux"
+)
+
+// controlBuffer is how many events may queue for a slow client before its
+// control stream is dropped; the client reconnects and gets a fresh snapshot
+const controlBuffer = 64
+
+// controlSub is one connected client's control stream
+type controlSub struct {
+	token  string
+	events chan protocol.MappingEvent
+	// overflow is closed when the client fell too far behind
+	overflow chan struct{}
+	dropped  bool
+}
+
+// managed reports whether a registry entry is a centrally managed mapping,
+// i.e. one a client can run on its own. Mappings registered implicitly by a
+// data stream carry no local address and are not pushed.
+func managed(rec *MappingRecord) bool {
+	return rec != nil && !rec.Deleted && rec.Mapping.LocalAddr != ""
+}
+
+// ManagedMappings lists the centrally managed mappings of a token
+func (s *Server) ManagedMappings(token string) []portal.PortMapping {
+	mappings := []portal.PortMapping{}
+	for _, rec := range s.store.Mappings() {
+		if rec.Token == token && managed(&rec) {
+			mappings = append(mappings, rec.Mapping)
+		}
+	}
+	return mappings
+}
+
+// PutManagedMapping registers or updates a mapping that clients of token
+// start on their side; connected clients receive it right away and peers
+// replicate it like any other registry write
+func (s *Server) PutManagedMapping(token string, mapping portal.PortMapping) error {
+	tokenConfig, ok := s.store.Token(token)
+	if !ok {
+		return fmt.Errorf("invalid token")
+	}
+	if mapping.ID == "" {
+		return fmt.Errorf("mapping id is required")
+	}
+	if mapping.LocalAddr == "" {
+		return fmt.Errorf("local_addr is required")
+	}
+	if err := proxy.CheckTarget(mapping.RemoteHost, mapping.RemotePort); err != nil {
+		return err
+	}
+	if !remoteAllowed(tokenConfig, mapping.RemoteHost) {
+		return fmt.Errorf("remote not allowed")
+	}
+	if mapping.Protocol == "" {
+		mapping.Protocol = portal.ProtocolTCP
+	}
+	return s.store.PutMapping(token, mapping)
+}
+
+// RemoveManagedMapping deletes a mapping owned by token
+func (s *Server) RemoveManagedMapping(token, id string) error {
+	rec, ok := s.store.Mapping(id)
+	if !ok {
+		return fmt.Errorf("mapping %s not found", id)
+	}
+	if rec.Token != token {
+		return fmt.Errorf("mapping %s belongs to another token", id)
+	}
+	s.store.RemoveMapping(id)
+	return nil
+}
+
+// mappingChanged turns a replaced registry entry into an event for the
+// control streams of the owning token
+func (s *Server) mappingChanged(prev *MappingRecord, cur MappingRecord) {
+	var event protocol.MappingEvent
+	switch was, is := managed(prev), managed(&cur); {
+	case !was && is:
+		event = protocol.MappingEvent{Op: protocol.MappingAdd, Mapping: cur.Mapping}
+	case was && !is:
+		event = protocol.MappingEvent{Op: protocol.MappingRemove, Mapping: portal.PortMapping{ID: cur.Mapping.ID}}
+	case was && is && !reflect.DeepEqual(prev.Mapping, cur.Mapping):
+		event = protocol.MappingEvent{Op: protocol.MappingUpdate, Mapping: cur.Mapping}
+	default:
+		return
+	}
+	s.publish(cur.Token, event)
+}
+
+// publish queues an event for every control stream of token
+func (s *Server) publish(token string, event protocol.MappingEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.controls {
+		if sub.token != token || sub.dropped {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.dropped = true
+			close(sub.overflow)
+		}
+	}
+}
+
+// handleControlStream sends the token's managed mappings, then pushes every
+// change until the client or the server goes away
+func (s *Server) handleControlStream(stream *smux.Stream, header protocol.StreamHeader) {
+	if _, ok := s.store.Token(header.Token); !ok {
+		protocol.WriteMessage(stream, protocol.StreamReply{Error: "invalid token"})
+		return
+	}
+
+	// Subscribe before taking the snapshot so no change falls in between;
+	// an event that repeats the snapshot is a no-op on the client
+	sub := &controlSub{
+		token:    header.Token,
+		events:   make(chan protocol.MappingEvent, controlBuffer),
+		overflow: make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.controls[sub] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.controls, sub)
+		s.mu.Unlock()
+	}()
+
+	if err := protocol.WriteMessage(stream, protocol.StreamReply{OK: true}); err != nil {
+		return
+	}
+	if err := protocol.WriteMessage(stream, protocol.MappingSnapshot{Mappings: s.ManagedMappings(header.Token)}); err != nil {
+		return
+	}
+
+	// The client never writes; a read returns once it closes the stream
+	gone := make(chan struct{})
+	go func() {
+		var buf [1]byte
+		stream.Read(buf[:])
+		close(gone)
+	}()
+
+	for {
+		select {
+		case event := <-sub.events:
+			if err := protocol.WriteMessage(stream, event); err != nil {
+				return
+			}
+		case <-sub.overflow:
+			log.Printf("[Portal Server] Control stream fell behind, dropping it")
+			return
+		case <-gone:
+			return
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
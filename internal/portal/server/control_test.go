@@ -0,0 +1,127 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/portal/client"
+	"github.com/luobobo896/HSSH/pkg/portal"
+)
+
+// runningMapping returns the client's running mapping with id
+func runningMapping(c *client.Client, id string) (portal.MappingStatus, bool) {
+	for _, status := range c.GetMappingStatus() {
+		if status.ID == id {
+			return status, true
+		}
+	}
+	return portal.MappingStatus{}, false
+}
+
+func TestManagedMappingPush(t *testing.T) {
+	tlsConfig, err := generateTestTLSConfig()
+	if err != nil {
+		t.Fatalf("Failed to generate TLS config: %v", err)
+	}
+	echoPort := startEchoServer(t)
+
+	srv := NewServer(&portal.ServerConfig{
+		AuthTokens: []portal.TokenConfig{{Token: "tok", MaxMappings: 5}, {Token: "other", MaxMappings: 5}},
+	}, tlsConfig)
+	if err := srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go srv.Serve()
+	defer srv.Close()
+
+	newSyncedClient := func(token string) *client.Client {
+		c := client.NewClient(&portal.ClientConfig{
+			Connection: portal.ConnectionConfig{RetryInterval: 50 * time.Millisecond, MaxRetries: 20},
+		}, &tls.Config{InsecureSkipVerify: true}, token, srv.listener.Addr().String())
+		if err := c.Connect(); err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		c.SyncMappings()
+		return c
+	}
+	c := newSyncedClient("tok")
+	defer c.Close()
+	other := newSyncedClient("other")
+	defer other.Close()
+
+	mapping := portal.PortMapping{
+		ID:         "m1",
+		Name:       "echo",
+		LocalAddr:  freeAddr(t),
+		RemoteHost: "127.0.0.1",
+		RemotePort: echoPort,
+		Enabled:    true,
+	}
+	if err := srv.PutManagedMapping("tok", mapping); err != nil {
+		t.Fatalf("PutManagedMapping: %v", err)
+	}
+	waitFor(t, "pushed mapping to start", func() bool {
+		_, ok := runningMapping(c, "m1")
+		return ok
+	})
+	echoRoundTrip(t, mapping.LocalAddr, "pushed")
+	if c.MappingSource("m1") != client.SourceServer {
+		t.Errorf("MappingSource = %q", c.MappingSource("m1"))
+	}
+
+	// Update moves the listener
+	oldAddr := mapping.LocalAddr
+	mapping.LocalAddr = freeAddr(t)
+	if err := srv.PutManagedMapping("tok", mapping); err != nil {
+		t.Fatalf("PutManagedMapping update: %v", err)
+	}
+	waitFor(t, "pushed update", func() bool {
+		status, ok := runningMapping(c, "m1")
+		return ok && status.LocalAddr == mapping.LocalAddr
+	})
+	echoRoundTrip(t, mapping.LocalAddr, "updated")
+	if conn, err := net.Dial("tcp", oldAddr); err == nil {
+		conn.Close()
+		t.Error("Old local address should be closed after the update")
+	}
+
+	// Mappings of another token are neither pushed nor removable
+	if _, ok := runningMapping(other, "m1"); ok {
+		t.Error("Mapping pushed to a client of another token")
+	}
+	if err := srv.RemoveManagedMapping("other", "m1"); err == nil {
+		t.Error("Expected removal by another token to fail")
+	}
+
+	if err := srv.RemoveManagedMapping("tok", "m1"); err != nil {
+		t.Fatalf("RemoveManagedMapping: %v", err)
+	}
+	waitFor(t, "pushed removal", func() bool {
+		_, ok := runningMapping(c, "m1")
+		return !ok
+	})
+
+	// A client that connects later gets the current mappings in the snapshot
+	c.Close()
+	mapping.ID = "m2"
+	if err := srv.PutManagedMapping("tok", mapping); err != nil {
+		t.Fatalf("PutManagedMapping: %v", err)
+	}
+	late := newSyncedClient("tok")
+	defer late.Close()
+	waitFor(t, "snapshot mapping", func() bool {
+		_, ok := runningMapping(late, "m2")
+		return ok
+	})
+	echoRoundTrip(t, mapping.LocalAddr, "snapshot")
+
+	// Mappings registered implicitly by data streams have no local side
+	if err := srv.PutManagedMapping("tok", portal.PortMapping{ID: "m3", RemoteHost: "127.0.0.1", RemotePort: echoPort}); err == nil {
+		t.Error("Expected a mapping without local_addr to be rejected")
+	}
+	if got := srv.ManagedMappings("tok"); len(got) != 1 || got[0].ID != "m2" {
+		t.Errorf("ManagedMappings = %+v", got)
+	}
+}
@@ -1,13 +1,22 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/luobobo896/HSSH/internal/netem"
+	"github.com/luobobo896/HSSH/internal/proxy"
+	"github.com/luobobo896/HSSH/internal/resolver"
+	"github.com/luobobo896/HSSH/internal/tracing"
+	"github.com/luobobo896/HSSH/pkg/portal"
 	"github.com/xtaci/smux"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Forwarder handles forwarding between smux streams and remote connections
@@ -26,48 +35,195 @@ func NewForwarder() *Forwarder {
 	}
 }
 
+// Reasons a stream limit closed a forwarded stream
+const (
+	ReapIdle     = "idle"     // no bytes in either direction for IdleTimeout
+	ReapLifetime = "lifetime" // open longer than MaxLifetime
+)
+
+// StreamLimits bounds how long a forwarded stream may hold its remote
+// connection. Zero disables a limit.
+type StreamLimits struct {
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+}
+
+// StreamResult describes how a forwarded stream ended
+type StreamResult struct {
+	BytesIn  int64  // client -> remote
+	BytesOut int64  // remote -> client
+	Reaped   string // ReapIdle or ReapLifetime when a limit closed the stream
+}
+
 // Forward forwards traffic between a smux stream and a remote connection
 func (f *Forwarder) Forward(stream *smux.Stream, remoteConn net.Conn) error {
+	_, err := f.forward(stream, remoteConn, StreamLimits{})
+	return err
+}
+
+// forward copies both directions until either side finishes or a limit in
+// limits closes the stream
+func (f *Forwarder) forward(stream io.ReadWriteCloser, remoteConn net.Conn, limits StreamLimits) (StreamResult, error) {
 	defer stream.Close()
 	defer remoteConn.Close()
 
-	errCh := make(chan error, 2)
-
-	// Stream -> Remote
-	go func() {
-		buf := f.bufferPool.Get().([]byte)
-		defer f.bufferPool.Put(buf)
+	var (
+		result     StreamResult
+		in, out    atomic.Int64
+		lastActive atomic.Int64 // unix nanoseconds of the last read in either direction
+		reaped     atomic.Pointer[string]
+	)
+	started := time.Now()
+	lastActive.Store(started.UnixNano())
 
-		_, err := io.CopyBuffer(remoteConn, stream, buf)
-		errCh <- err
-	}()
+	var closeOnce sync.Once
+	closeBoth := func() {
+		closeOnce.Do(func() {
+			stream.Close()
+			remoteConn.Close()
+		})
+	}
 
-	// Remote -> Stream
-	go func() {
+	errCh := make(chan error, 2)
+	copyDir := func(dst io.Writer, src io.Reader, n *atomic.Int64) {
 		buf := f.bufferPool.Get().([]byte)
 		defer f.bufferPool.Put(buf)
+		errCh <- copyActive(dst, src, buf, n, &lastActive)
+	}
+	go copyDir(remoteConn, stream, &in)  // Stream -> Remote
+	go copyDir(stream, remoteConn, &out) // Remote -> Stream
 
-		_, err := io.CopyBuffer(stream, remoteConn, buf)
-		errCh <- err
-	}()
+	done := make(chan struct{})
+	if limits.IdleTimeout > 0 || limits.MaxLifetime > 0 {
+		go func() {
+			if reason := watchLimits(limits, started, &lastActive, done); reason != "" {
+				reaped.Store(&reason)
+				closeBoth()
+			}
+		}()
+	}
 
-	// Wait for either direction to finish
+	// Wait for either direction to finish, then close both ends so the
+	// other copy unblocks instead of holding the stream open forever
 	err := <-errCh
+	closeBoth()
 	<-errCh // Drain the second error
+	close(done)
 
-	return err
+	result.BytesIn, result.BytesOut = in.Load(), out.Load()
+	if reason := reaped.Load(); reason != nil {
+		// The copy error only reports the close done by the reaper
+		result.Reaped = *reason
+		err = nil
+	}
+	return result, err
+}
+
+// copyActive is io.CopyBuffer that counts bytes and records when data last moved
+func copyActive(dst io.Writer, src io.Reader, buf []byte, n, lastActive *atomic.Int64) error {
+	for {
+		nr, rerr := src.Read(buf)
+		if nr > 0 {
+			lastActive.Store(time.Now().UnixNano())
+			nw, werr := dst.Write(buf[:nr])
+			n.Add(int64(nw))
+			if werr != nil {
+				return werr
+			}
+		}
+		if rerr == io.EOF {
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+}
+
+// watchLimits waits until a limit is exceeded and returns its reason, or
+// returns "" once done is closed
+func watchLimits(limits StreamLimits, started time.Time, lastActive *atomic.Int64, done <-chan struct{}) string {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-done:
+			return ""
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		var wait time.Duration = -1
+		if limits.MaxLifetime > 0 {
+			left := started.Add(limits.MaxLifetime).Sub(now)
+			if left <= 0 {
+				return ReapLifetime
+			}
+			wait = left
+		}
+		if limits.IdleTimeout > 0 {
+			left := time.Unix(0, lastActive.Load()).Add(limits.IdleTimeout).Sub(now)
+			if left <= 0 {
+				return ReapIdle
+			}
+			if wait < 0 || left < wait {
+				wait = left
+			}
+		}
+		timer.Reset(wait)
+	}
 }
 
 // DialAndForward connects to a remote address and forwards traffic
 func (f *Forwarder) DialAndForward(stream *smux.Stream, remoteHost string, remotePort int) error {
-	addr := net.JoinHostPort(remoteHost, fmt.Sprintf("%d", remotePort))
+	return f.DialAndForwardContext(context.Background(), stream, remoteHost, remotePort)
+}
+
+// DialAndForwardContext is DialAndForward with the dial recorded as a span of ctx
+func (f *Forwarder) DialAndForwardContext(ctx context.Context, stream *smux.Stream, remoteHost string, remotePort int) error {
+	_, err := f.dialAndForward(ctx, stream, remoteHost, remotePort, resolver.Mode{Kind: resolver.KindSystem}, StreamLimits{})
+	return err
+}
 
-	conn, err := net.Dial("tcp", addr)
+// DialAndForwardMapping dials the mapping's remote target using its resolver
+// and forwards the stream within limits.
+// This node is the far end of the tunnel, so "remote" means the local system
+// resolver here; "dns:<server>" queries that server directly. Either way the
+// result goes through the shared cache instead of resolving on every stream.
+func (f *Forwarder) DialAndForwardMapping(ctx context.Context, stream *smux.Stream, mapping portal.PortMapping, limits StreamLimits) (StreamResult, error) {
+	mode, err := resolver.ParseMode(mapping.Resolver)
+	if err != nil {
+		log.Printf("[Forwarder] Mapping %s: %v, using the system resolver", mapping.ID, err)
+	}
+	if mode.IsRemote() {
+		mode = resolver.Mode{Kind: resolver.KindSystem}
+	}
+	return f.dialAndForward(ctx, stream, mapping.RemoteHost, mapping.RemotePort, mode, limits)
+}
+
+func (f *Forwarder) dialAndForward(ctx context.Context, stream *smux.Stream, remoteHost string, remotePort int, mode resolver.Mode, limits StreamLimits) (StreamResult, error) {
+	addr := proxy.TargetAddr(remoteHost, remotePort)
+
+	_, span := tracing.Start(ctx, "portal.dial", attribute.String("server.address", addr))
+	dialer := &net.Dialer{}
+	dial := func(network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	// A unix socket target is a path on this node and needs no resolving
+	conn, unix, err := proxy.DialTarget(dial, remoteHost)
+	if !unix {
+		conn, err = resolver.Default.DialContext(ctx, "", remoteHost, remotePort, mode, dial)
+	}
+	tracing.End(span, err)
 	if err != nil {
 		log.Printf("[Forwarder] Failed to connect to %s: %v", addr, err)
-		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+		return StreamResult{}, fmt.Errorf("failed to connect to %s: %w", addr, err)
 	}
 
 	log.Printf("[Forwarder] Connected to %s", addr)
-	return f.Forward(stream, conn)
+	result, err := f.forward(stream, netem.Wrap(conn), limits)
+	if result.Reaped != "" {
+		log.Printf("[Forwarder] Closed stream to %s: %s limit reached", addr, result.Reaped)
+	}
+	return result, err
 }
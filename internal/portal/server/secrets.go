@@ -0,0 +1,148 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Secret slots reported in SecretUse
+const (
+	SecretCurrent = "current"
+	SecretNext    = "next"
+)
+
+// errInvalidSecret is the reply error for a sync with neither active secret
+const errInvalidSecret = "invalid cluster secret"
+
+// SecretUpdate changes the active cluster secrets; nil fields are kept.
+// A rotation without downtime runs on every node in three steps:
+// {next: new} so all nodes accept it, {current: new, next: old} so nodes
+// start sending it while lagging peers still get in, then {next: ""}.
+type SecretUpdate struct {
+	Current *string `json:"current,omitempty"`
+	Next    *string `json:"next,omitempty"`
+}
+
+// SecretUse records which secret a peer authenticated with
+type SecretUse struct {
+	Peer     string    `json:"peer"`   // node ID of an incoming peer, address of an outgoing one
+	Secret   string    `json:"secret"` // slot used last: current or next
+	LastUsed time.Time `json:"last_used"`
+	Current  int64     `json:"current"` // syncs authenticated with each slot
+	Next     int64     `json:"next"`
+}
+
+// SecretStats shows how far a rotation has progressed: once every peer
+// uses the new secret in both directions the old one can be dropped
+type SecretStats struct {
+	HasNext  bool        `json:"has_next"`
+	Incoming []SecretUse `json:"incoming"` // peers that synced with us
+	Outgoing []SecretUse `json:"outgoing"` // peers we synced with
+}
+
+// clusterSecrets holds the secrets accepted from peers. Both are active:
+// incoming syncs may use either, outgoing syncs send current and fall back
+// to next when a peer has already dropped current.
+type clusterSecrets struct {
+	mu       sync.Mutex
+	current  string
+	next     string
+	incoming map[string]*SecretUse
+	outgoing map[string]*SecretUse
+}
+
+func newClusterSecrets(current, next string) *clusterSecrets {
+	return &clusterSecrets{
+		current:  current,
+		next:     next,
+		incoming: make(map[string]*SecretUse),
+		outgoing: make(map[string]*SecretUse),
+	}
+}
+
+// update applies u; current may not become empty or equal to next
+func (c *clusterSecrets) update(u SecretUpdate) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current, next := c.current, c.next
+	if u.Current != nil {
+		current = *u.Current
+	}
+	if u.Next != nil {
+		next = *u.Next
+	}
+	if current == "" {
+		return errors.New("current cluster secret cannot be empty")
+	}
+	if next == current {
+		return errors.New("next cluster secret must differ from current")
+	}
+	c.current, c.next = current, next
+	return nil
+}
+
+// match returns the slot secret belongs to, or "" when neither is active
+func (c *clusterSecrets) match(secret string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.current != "" && subtle.ConstantTimeCompare([]byte(c.current), []byte(secret)) == 1:
+		return SecretCurrent
+	case c.next != "" && subtle.ConstantTimeCompare([]byte(c.next), []byte(secret)) == 1:
+		return SecretNext
+	}
+	return ""
+}
+
+// candidates returns the secrets to try for an outgoing sync, current first
+func (c *clusterSecrets) candidates() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.next == "" {
+		return []string{c.current}
+	}
+	return []string{c.current, c.next}
+}
+
+// recordIncoming and recordOutgoing count a successful authentication
+func (c *clusterSecrets) recordIncoming(peer, slot string) { c.record(c.incoming, peer, slot) }
+func (c *clusterSecrets) recordOutgoing(peer, slot string) { c.record(c.outgoing, peer, slot) }
+
+func (c *clusterSecrets) record(uses map[string]*SecretUse, peer, slot string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	use, ok := uses[peer]
+	if !ok {
+		use = &SecretUse{Peer: peer}
+		uses[peer] = use
+	}
+	use.Secret = slot
+	use.LastUsed = time.Now()
+	if slot == SecretNext {
+		use.Next++
+	} else {
+		use.Current++
+	}
+}
+
+func (c *clusterSecrets) stats() SecretStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return SecretStats{
+		HasNext:  c.next != "",
+		Incoming: sortedUses(c.incoming),
+		Outgoing: sortedUses(c.outgoing),
+	}
+}
+
+func sortedUses(uses map[string]*SecretUse) []SecretUse {
+	out := make([]SecretUse, 0, len(uses))
+	for _, use := range uses {
+		out = append(out, *use)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Peer < out[j].Peer })
+	return out
+}
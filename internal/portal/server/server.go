@@ -3,15 +3,22 @@ package server
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/luobobo896/HSSH/internal/netem"
 	"github.com/luobobo896/HSSH/internal/portal/protocol"
+	"github.com/luobobo896/HSSH/internal/tracing"
 	"github.com/luobobo896/HSSH/pkg/portal"
 	"github.com/xtaci/smux"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Server portal server
@@ -19,12 +26,20 @@ type Server struct {
 	config    *portal.ServerConfig
 	tlsConfig *tls.Config
 	listener  net.Listener
-	mux       *protocol.ServerMux
+	muxes     map[*protocol.ServerMux]struct{} // active client sessions
+	controls  map[*controlSub]struct{}         // open control streams
 
 	// Connection management
 	mappings map[string]*MappingState // mapping_id -> state
 	mu       sync.RWMutex
 
+	// Replicated tokens and mapping registry (shared with peer nodes)
+	store     *Store
+	secrets   *clusterSecrets
+	syncKick  chan struct{}
+	peerDown  map[string]bool // peers whose last sync failed (syncLoop only)
+	forwarder *Forwarder
+
 	// Lifecycle
 	ctx     context.Context
 	cancel  context.CancelFunc
@@ -34,22 +49,83 @@ type Server struct {
 
 // MappingState tracks a single port mapping
 type MappingState struct {
-	Mapping     portal.PortMapping
-	StreamCount atomic.Int32
-	BytesIn     atomic.Int64
-	BytesOut    atomic.Int64
+	Mapping        portal.PortMapping
+	StreamCount    atomic.Int32
+	BytesIn        atomic.Int64
+	BytesOut       atomic.Int64
+	IdleReaped     atomic.Int64 // streams closed by the idle timeout
+	LifetimeReaped atomic.Int64 // streams closed by the maximum lifetime
+}
+
+// MappingStats is a snapshot of a mapping's counters. It carries no remote
+// host so it can be served next to the health probes.
+type MappingStats struct {
+	ID             string        `json:"id"`
+	Streams        int32         `json:"streams"`
+	BytesIn        int64         `json:"bytes_in"`
+	BytesOut       int64         `json:"bytes_out"`
+	IdleTimeout    time.Duration `json:"idle_timeout,omitempty"`
+	MaxLifetime    time.Duration `json:"max_lifetime,omitempty"`
+	IdleReaped     int64         `json:"idle_reaped"`
+	LifetimeReaped int64         `json:"lifetime_reaped"`
 }
 
 // NewServer creates a new portal server
 func NewServer(config *portal.ServerConfig, tlsConfig *tls.Config) *Server {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Server{
+	s := &Server{
 		config:    config,
 		tlsConfig: tlsConfig,
 		mappings:  make(map[string]*MappingState),
+		muxes:     make(map[*protocol.ServerMux]struct{}),
+		controls:  make(map[*controlSub]struct{}),
+		syncKick:  make(chan struct{}, 1),
+		peerDown:  make(map[string]bool),
+		forwarder: NewForwarder(),
 		ctx:       ctx,
 		cancel:    cancel,
 	}
+
+	s.store = NewStore(s.nodeID())
+	s.secrets = newClusterSecrets("", "")
+	if config != nil {
+		s.secrets = newClusterSecrets(config.Cluster.Secret, config.Cluster.NextSecret)
+	}
+	s.loadConfigTokens()
+	s.store.onChange = s.kickSync
+	s.store.onMapping = s.mappingChanged
+	return s
+}
+
+// nodeID returns this node's cluster ID (defaults to hostname)
+func (s *Server) nodeID() string {
+	if s.config != nil && s.config.Cluster.NodeID != "" {
+		return s.config.Cluster.NodeID
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// clustered reports whether peer nodes are configured
+func (s *Server) clustered() bool {
+	return s.config != nil && s.config.Cluster.Enabled()
+}
+
+// loadConfigTokens writes tokens from local config into the store
+func (s *Server) loadConfigTokens() {
+	if s.config == nil {
+		return
+	}
+	for _, token := range s.config.AuthTokens {
+		if token.Token != "" {
+			s.store.PutToken(token)
+		}
+	}
+}
+
+// Store returns the replicated token/mapping registry
+func (s *Server) Store() *Store {
+	return s.store
 }
 
 // Listen starts listening for connections
@@ -77,6 +153,10 @@ func (s *Server) Serve() error {
 	s.running.Store(true)
 	defer s.running.Store(false)
 
+	if s.clustered() {
+		s.startCluster()
+	}
+
 	for {
 		conn, err := s.listener.Accept()
 		if err != nil {
@@ -90,7 +170,7 @@ func (s *Server) Serve() error {
 		}
 
 		s.wg.Add(1)
-		go s.handleConnection(conn)
+		go s.handleConnection(netem.Wrap(conn))
 	}
 }
 
@@ -106,8 +186,15 @@ func (s *Server) handleConnection(conn net.Conn) {
 		return
 	}
 
-	s.mux = mux
-	defer mux.Close()
+	s.mu.Lock()
+	s.muxes[mux] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.muxes, mux)
+		s.mu.Unlock()
+		mux.Close()
+	}()
 
 	log.Printf("[Portal Server] Client connected")
 
@@ -129,20 +216,167 @@ func (s *Server) handleConnection(conn net.Conn) {
 	}
 }
 
-// handleStream handles a single stream
+// handleStream reads the stream header and dispatches by stream type
 func (s *Server) handleStream(stream *smux.Stream) {
 	defer stream.Close()
-	// TODO: Read mapping ID from stream, validate, and forward
-	// For now, just close - full implementation in forwarder.go
+
+	stream.SetReadDeadline(time.Now().Add(peerTimeout))
+	var header protocol.StreamHeader
+	if err := protocol.ReadMessage(stream, &header); err != nil {
+		log.Printf("[Portal Server] Failed to read stream header: %v", err)
+		return
+	}
+	stream.SetReadDeadline(time.Time{})
+
+	switch header.Type {
+	case protocol.StreamData:
+		s.handleDataStream(stream, header)
+	case protocol.StreamSync:
+		s.handleSyncStream(stream, header)
+	case protocol.StreamControl:
+		s.handleControlStream(stream, header)
+	default:
+		protocol.WriteMessage(stream, protocol.StreamReply{Error: fmt.Sprintf("unknown stream type %q", header.Type)})
+	}
+}
+
+// handleDataStream authorizes a data stream against the replicated registry
+// and forwards it to the mapping's remote target. A mapping seen for the first
+// time is registered (and replicated), so after failover the surviving node
+// already knows it.
+func (s *Server) handleDataStream(stream *smux.Stream, header protocol.StreamHeader) {
+	// Continue the client's trace when it sent one
+	ctx, span := tracing.Start(tracing.Extract(context.Background(), header.TraceParent), "portal.stream.serve",
+		attribute.String("portal.mapping_id", header.MappingID),
+		attribute.String("portal.node_id", s.nodeID()),
+	)
+	var streamErr error
+	defer func() { tracing.End(span, streamErr) }()
+
+	reject := func(msg string) {
+		log.Printf("[Portal Server] Rejected stream for mapping %s: %s", header.MappingID, msg)
+		streamErr = errors.New(msg)
+		protocol.WriteMessage(stream, protocol.StreamReply{Error: msg})
+	}
+
+	tokenConfig, ok := s.store.Token(header.Token)
+	if !ok {
+		reject("invalid token")
+		return
+	}
+	if header.MappingID == "" {
+		reject("mapping id is required")
+		return
+	}
+
+	rec, ok := s.store.Mapping(header.MappingID)
+	if !ok {
+		if !remoteAllowed(tokenConfig, header.RemoteHost) {
+			reject("remote not allowed")
+			return
+		}
+		mapping := portal.PortMapping{
+			ID:         header.MappingID,
+			RemoteHost: header.RemoteHost,
+			RemotePort: header.RemotePort,
+			Resolver:   header.Resolver,
+			Protocol:   portal.ProtocolTCP,
+			Enabled:    true,
+
+			IdleTimeout: header.IdleTimeout,
+			MaxLifetime: header.MaxLifetime,
+		}
+		if err := s.store.PutMapping(header.Token, mapping); err != nil {
+			reject(err.Error())
+			return
+		}
+		rec = MappingRecord{Mapping: mapping, Token: header.Token}
+	} else if rec.Token != header.Token {
+		reject("mapping belongs to another token")
+		return
+	}
+
+	state := s.mappingState(rec.Mapping)
+	state.StreamCount.Add(1)
+	defer state.StreamCount.Add(-1)
+
+	if err := protocol.WriteMessage(stream, protocol.StreamReply{OK: true}); err != nil {
+		return
+	}
+	var result StreamResult
+	result, streamErr = s.forwarder.DialAndForwardMapping(ctx, stream, rec.Mapping, s.streamLimits(rec.Mapping))
+	state.BytesIn.Add(result.BytesIn)
+	state.BytesOut.Add(result.BytesOut)
+	switch result.Reaped {
+	case ReapIdle:
+		state.IdleReaped.Add(1)
+	case ReapLifetime:
+		state.LifetimeReaped.Add(1)
+	}
+	if result.Reaped != "" {
+		span.SetAttributes(attribute.String("portal.reaped", result.Reaped))
+	}
+}
+
+// streamLimits returns the mapping's own limits, falling back to the server
+// defaults for the ones it leaves unset
+func (s *Server) streamLimits(mapping portal.PortMapping) StreamLimits {
+	limits := StreamLimits{IdleTimeout: mapping.IdleTimeout, MaxLifetime: mapping.MaxLifetime}
+	if s.config != nil {
+		if limits.IdleTimeout <= 0 {
+			limits.IdleTimeout = s.config.StreamIdleTimeout
+		}
+		if limits.MaxLifetime <= 0 {
+			limits.MaxLifetime = s.config.StreamMaxLifetime
+		}
+	}
+	return limits
+}
+
+// MappingStats returns the counters of every mapping that carried a stream
+// on this node, ordered by ID
+func (s *Server) MappingStats() []MappingStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := make([]MappingStats, 0, len(s.mappings))
+	for id, state := range s.mappings {
+		limits := s.streamLimits(state.Mapping)
+		stats = append(stats, MappingStats{
+			ID:             id,
+			Streams:        state.StreamCount.Load(),
+			BytesIn:        state.BytesIn.Load(),
+			BytesOut:       state.BytesOut.Load(),
+			IdleTimeout:    limits.IdleTimeout,
+			MaxLifetime:    limits.MaxLifetime,
+			IdleReaped:     state.IdleReaped.Load(),
+			LifetimeReaped: state.LifetimeReaped.Load(),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+	return stats
+}
+
+// mappingState returns the runtime counters for a mapping
+func (s *Server) mappingState(mapping portal.PortMapping) *MappingState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.mappings[mapping.ID]
+	if !ok {
+		state = &MappingState{Mapping: mapping}
+		s.mappings[mapping.ID] = state
+	}
+	return state
 }
 
 // Close stops the server
 func (s *Server) Close() error {
 	s.cancel()
 
-	if s.mux != nil {
-		s.mux.Close()
+	s.mu.Lock()
+	for mux := range s.muxes {
+		mux.Close()
 	}
+	s.mu.Unlock()
 
 	if s.listener != nil {
 		s.listener.Close()
@@ -7,6 +7,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"io"
 	"math/big"
 	"net"
 	"sync"
@@ -329,6 +330,24 @@ func TestAuthenticatorIsRemoteAllowed(t *testing.T) {
 	if auth.IsRemoteAllowed(restrictedConfig, "example.com") {
 		t.Error("Expected hostname to be denied without 0.0.0.0/0")
 	}
+
+	// Unix sockets need an explicit unix: entry, even with 0.0.0.0/0
+	if auth.IsRemoteAllowed(wildcardConfig, "/var/run/docker.sock") {
+		t.Error("Expected unix socket to be denied by a CIDR wildcard")
+	}
+	if auth.IsRemoteAllowed(unrestrictedConfig, "/var/run/docker.sock") {
+		t.Error("Expected unix socket to be denied for a token without restrictions")
+	}
+	if auth.IsRemoteAllowed(unrestrictedConfig, "unix:/var/run/docker.sock") {
+		t.Error("Expected unix: address to be denied for a token without restrictions")
+	}
+	socketConfig := &portal.TokenConfig{AllowedRemotes: []string{"unix:/var/run/postgresql/*"}}
+	if !auth.IsRemoteAllowed(socketConfig, "/var/run/postgresql/.s.PGSQL.5432") {
+		t.Error("Expected socket under /var/run/postgresql to be allowed")
+	}
+	if auth.IsRemoteAllowed(socketConfig, "/var/run/docker.sock") {
+		t.Error("Expected other sockets to be denied")
+	}
 }
 
 func TestNewForwarder(t *testing.T) {
@@ -372,6 +391,71 @@ func TestForwarderDialAndForward(t *testing.T) {
 	}
 }
 
+func TestForwarderStreamLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits StreamLimits
+		chatty bool // keep sending data for the whole test
+		want   string
+	}{
+		{"idle", StreamLimits{IdleTimeout: 50 * time.Millisecond}, false, ReapIdle},
+		{"busy stream outlives idle timeout", StreamLimits{IdleTimeout: 80 * time.Millisecond, MaxLifetime: 300 * time.Millisecond}, true, ReapLifetime},
+		{"lifetime", StreamLimits{MaxLifetime: 50 * time.Millisecond}, false, ReapLifetime},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, client := net.Pipe()
+			remote, target := net.Pipe()
+			defer client.Close()
+			defer target.Close()
+			go io.Copy(io.Discard, target)
+
+			stop := make(chan struct{})
+			defer close(stop)
+			go func() {
+				for tt.chatty {
+					select {
+					case <-stop:
+						return
+					case <-time.After(20 * time.Millisecond):
+						if _, err := client.Write([]byte("ping")); err != nil {
+							return
+						}
+					}
+				}
+			}()
+
+			start := time.Now()
+			result, err := NewForwarder().forward(stream, remote, tt.limits)
+			if err != nil {
+				t.Fatalf("forward: %v", err)
+			}
+			if result.Reaped != tt.want {
+				t.Errorf("reaped = %q, want %q", result.Reaped, tt.want)
+			}
+			if tt.chatty && (time.Since(start) < 250*time.Millisecond || result.BytesIn == 0) {
+				t.Errorf("busy stream closed after %v with %d bytes in", time.Since(start), result.BytesIn)
+			}
+		})
+	}
+}
+
+func TestStreamLimitsDefaults(t *testing.T) {
+	server := NewServer(&portal.ServerConfig{StreamIdleTimeout: time.Minute, StreamMaxLifetime: time.Hour}, nil)
+	limits := server.streamLimits(portal.PortMapping{IdleTimeout: time.Second})
+	if limits.IdleTimeout != time.Second || limits.MaxLifetime != time.Hour {
+		t.Errorf("limits = %+v, want the mapping idle timeout and the server lifetime", limits)
+	}
+
+	state := server.mappingState(portal.PortMapping{ID: "m1"})
+	state.IdleReaped.Add(2)
+	state.LifetimeReaped.Add(1)
+	stats := server.MappingStats()
+	if len(stats) != 1 || stats[0].IdleReaped != 2 || stats[0].LifetimeReaped != 1 || stats[0].IdleTimeout != time.Minute {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
 func TestServerConcurrency(t *testing.T) {
 	config := &portal.ServerConfig{
 		Enabled:    true,
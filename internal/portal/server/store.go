@@ -0,0 +1,258 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/luobobo896/HSSH/pkg/portal"
+)
+
+// TokenRecord is a replicated token entry
+type TokenRecord struct {
+	Config  portal.TokenConfig `json:"config"`
+	Version uint64             `json:"version"`
+	Node    string             `json:"node"`
+	Deleted bool               `json:"deleted,omitempty"`
+}
+
+// MappingRecord is a replicated mapping registry entry
+type MappingRecord struct {
+	Mapping portal.PortMapping `json:"mapping"`
+	Token   string             `json:"token"` // token that registered the mapping
+	Version uint64             `json:"version"`
+	Node    string             `json:"node"`
+	Deleted bool               `json:"deleted,omitempty"`
+}
+
+// Snapshot is the full replicated state exchanged between nodes
+type Snapshot struct {
+	Node     string          `json:"node"`
+	Tokens   []TokenRecord   `json:"tokens"`
+	Mappings []MappingRecord `json:"mappings"`
+}
+
+// Store is a small last-writer-wins replicated registry of tokens and mappings.
+// Every local write takes the next Lamport clock value; merges keep the entry
+// with the higher (Version, Node) pair. Deletes are kept as tombstones so they
+// replicate like any other write.
+type Store struct {
+	nodeID   string
+	clock    uint64
+	tokens   map[string]*TokenRecord   // token -> record
+	mappings map[string]*MappingRecord // mapping_id -> record
+	mu       sync.RWMutex
+
+	// onChange is called (without the lock held) after a local write
+	onChange func()
+	// onMapping is called (without the lock held) for every mapping entry a
+	// local write or a merge replaced; prev is nil for a new entry
+	onMapping func(prev *MappingRecord, cur MappingRecord)
+}
+
+// NewStore creates an empty store for the given node
+func NewStore(nodeID string) *Store {
+	return &Store{
+		nodeID:   nodeID,
+		tokens:   make(map[string]*TokenRecord),
+		mappings: make(map[string]*MappingRecord),
+	}
+}
+
+// newer reports whether (v1, n1) wins over (v2, n2)
+func newer(v1 uint64, n1 string, v2 uint64, n2 string) bool {
+	if v1 != v2 {
+		return v1 > v2
+	}
+	return n1 > n2
+}
+
+// tick advances the clock for a local write; caller holds the lock
+func (s *Store) tick() uint64 {
+	s.clock++
+	return s.clock
+}
+
+// observe moves the clock past a remote version; caller holds the lock
+func (s *Store) observe(v uint64) {
+	if v > s.clock {
+		s.clock = v
+	}
+}
+
+func (s *Store) changed() {
+	if s.onChange != nil {
+		s.onChange()
+	}
+}
+
+// mappingChanged reports replaced mapping entries to onMapping
+func (s *Store) mappingChanged(prev *MappingRecord, cur MappingRecord) {
+	if s.onMapping != nil {
+		s.onMapping(prev, cur)
+	}
+}
+
+// PutToken adds or updates a token
+func (s *Store) PutToken(config portal.TokenConfig) {
+	s.mu.Lock()
+	s.tokens[config.Token] = &TokenRecord{Config: config, Version: s.tick(), Node: s.nodeID}
+	s.mu.Unlock()
+	s.changed()
+}
+
+// RemoveToken deletes a token
+func (s *Store) RemoveToken(token string) {
+	s.mu.Lock()
+	s.tokens[token] = &TokenRecord{Config: portal.TokenConfig{Token: token}, Version: s.tick(), Node: s.nodeID, Deleted: true}
+	s.mu.Unlock()
+	s.changed()
+}
+
+// Token looks up a live token
+func (s *Store) Token(token string) (*portal.TokenConfig, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.tokens[token]
+	if !ok || rec.Deleted {
+		return nil, false
+	}
+	config := rec.Config
+	return &config, true
+}
+
+// PutMapping registers or updates a mapping on behalf of a token,
+// enforcing the token's MaxMappings limit
+func (s *Store) PutMapping(token string, mapping portal.PortMapping) error {
+	s.mu.Lock()
+	tokenRec, ok := s.tokens[token]
+	if !ok || tokenRec.Deleted {
+		s.mu.Unlock()
+		return fmt.Errorf("invalid token")
+	}
+
+	existing, exists := s.mappings[mapping.ID]
+	if exists && !existing.Deleted && existing.Token != token {
+		s.mu.Unlock()
+		return fmt.Errorf("mapping %s belongs to another token", mapping.ID)
+	}
+	if (!exists || existing.Deleted) && tokenRec.Config.MaxMappings > 0 &&
+		s.countMappingsLocked(token) >= tokenRec.Config.MaxMappings {
+		s.mu.Unlock()
+		return fmt.Errorf("token mapping limit (%d) reached", tokenRec.Config.MaxMappings)
+	}
+
+	rec := &MappingRecord{Mapping: mapping, Token: token, Version: s.tick(), Node: s.nodeID}
+	s.mappings[mapping.ID] = rec
+	s.mu.Unlock()
+	s.mappingChanged(existing, *rec)
+	s.changed()
+	return nil
+}
+
+func (s *Store) countMappingsLocked(token string) int {
+	n := 0
+	for _, rec := range s.mappings {
+		if !rec.Deleted && rec.Token == token {
+			n++
+		}
+	}
+	return n
+}
+
+// RemoveMapping deletes a mapping
+func (s *Store) RemoveMapping(id string) {
+	s.mu.Lock()
+	rec, ok := s.mappings[id]
+	if !ok || rec.Deleted {
+		s.mu.Unlock()
+		return
+	}
+	tombstone := &MappingRecord{Mapping: portal.PortMapping{ID: id}, Token: rec.Token, Version: s.tick(), Node: s.nodeID, Deleted: true}
+	s.mappings[id] = tombstone
+	s.mu.Unlock()
+	s.mappingChanged(rec, *tombstone)
+	s.changed()
+}
+
+// Mapping looks up a live mapping
+func (s *Store) Mapping(id string) (MappingRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.mappings[id]
+	if !ok || rec.Deleted {
+		return MappingRecord{}, false
+	}
+	return *rec, true
+}
+
+// Mappings lists live mappings sorted by ID
+func (s *Store) Mappings() []MappingRecord {
+	s.mu.RLock()
+	result := make([]MappingRecord, 0, len(s.mappings))
+	for _, rec := range s.mappings {
+		if !rec.Deleted {
+			result = append(result, *rec)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Mapping.ID < result[j].Mapping.ID })
+	return result
+}
+
+// Snapshot returns all entries including tombstones
+func (s *Store) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap := Snapshot{
+		Node:     s.nodeID,
+		Tokens:   make([]TokenRecord, 0, len(s.tokens)),
+		Mappings: make([]MappingRecord, 0, len(s.mappings)),
+	}
+	for _, rec := range s.tokens {
+		snap.Tokens = append(snap.Tokens, *rec)
+	}
+	for _, rec := range s.mappings {
+		snap.Mappings = append(snap.Mappings, *rec)
+	}
+	return snap
+}
+
+// Merge applies a peer snapshot and returns the number of entries that changed
+func (s *Store) Merge(snap Snapshot) int {
+	type replaced struct {
+		prev *MappingRecord
+		cur  MappingRecord
+	}
+	var replacedMappings []replaced
+
+	s.mu.Lock()
+	changed := 0
+	for i := range snap.Tokens {
+		in := snap.Tokens[i]
+		s.observe(in.Version)
+		cur, ok := s.tokens[in.Config.Token]
+		if !ok || newer(in.Version, in.Node, cur.Version, cur.Node) {
+			s.tokens[in.Config.Token] = &in
+			changed++
+		}
+	}
+	for i := range snap.Mappings {
+		in := snap.Mappings[i]
+		s.observe(in.Version)
+		cur, ok := s.mappings[in.Mapping.ID]
+		if !ok || newer(in.Version, in.Node, cur.Version, cur.Node) {
+			s.mappings[in.Mapping.ID] = &in
+			replacedMappings = append(replacedMappings, replaced{prev: cur, cur: in})
+			changed++
+		}
+	}
+	s.mu.Unlock()
+
+	for _, r := range replacedMappings {
+		s.mappingChanged(r.prev, r.cur)
+	}
+	return changed
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/portal"
+)
+
+func TestStoreMappingLimit(t *testing.T) {
+	store := NewStore("a")
+	store.PutToken(portal.TokenConfig{Token: "t1", MaxMappings: 2})
+	store.PutToken(portal.TokenConfig{Token: "t2"})
+
+	tests := []struct {
+		name    string
+		token   string
+		id      string
+		wantErr bool
+	}{
+		{"first", "t1", "m1", false},
+		{"second", "t1", "m2", false},
+		{"update existing does not count", "t1", "m1", false},
+		{"over limit", "t1", "m3", true},
+		{"unknown token", "nope", "m4", true},
+		{"other token cannot take over", "t2", "m1", true},
+		{"unlimited token", "t2", "m5", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := store.PutMapping(tt.token, portal.PortMapping{ID: tt.id, RemoteHost: "10.0.0.1", RemotePort: 80})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PutMapping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 删除后名额释放
+	store.RemoveMapping("m2")
+	if err := store.PutMapping("t1", portal.PortMapping{ID: "m3"}); err != nil {
+		t.Errorf("expected slot to be freed after delete: %v", err)
+	}
+}
+
+func TestStoreMergeConverges(t *testing.T) {
+	a := NewStore("a")
+	b := NewStore("b")
+
+	a.PutToken(portal.TokenConfig{Token: "t1"})
+	b.Merge(a.Snapshot())
+	if _, ok := b.Token("t1"); !ok {
+		t.Fatal("token should replicate to b")
+	}
+
+	// 两边并发写同一映射，较大的 (version, node) 胜出
+	if err := a.PutMapping("t1", portal.PortMapping{ID: "m1", RemotePort: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.PutMapping("t1", portal.PortMapping{ID: "m1", RemotePort: 2}); err != nil {
+		t.Fatal(err)
+	}
+	a.Merge(b.Snapshot())
+	b.Merge(a.Snapshot())
+
+	ra, _ := a.Mapping("m1")
+	rb, _ := b.Mapping("m1")
+	if ra.Mapping.RemotePort != rb.Mapping.RemotePort {
+		t.Fatalf("stores diverged: a=%d b=%d", ra.Mapping.RemotePort, rb.Mapping.RemotePort)
+	}
+	if ra.Mapping.RemotePort != 2 {
+		t.Errorf("expected node b to win the tie, got port %d", ra.Mapping.RemotePort)
+	}
+
+	// 删除以墓碑形式复制
+	a.RemoveMapping("m1")
+	b.Merge(a.Snapshot())
+	if _, ok := b.Mapping("m1"); ok {
+		t.Error("delete should replicate to b")
+	}
+
+	// 旧快照不会复活已删除的条目
+	stale := NewStore("c")
+	stale.PutToken(portal.TokenConfig{Token: "t1"})
+	stale.PutMapping("t1", portal.PortMapping{ID: "m1"})
+	b.Merge(stale.Snapshot())
+	if _, ok := b.Mapping("m1"); ok {
+		t.Error("stale snapshot resurrected deleted mapping")
+	}
+}
@@ -0,0 +1,119 @@
+// Package probe 存活和就绪探针（/healthz、/readyz），供 Kubernetes 等编排系统判断实例状态
+package probe
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// 就绪状态
+const (
+	StatusStarting     = "starting"      // 尚未开始监听
+	StatusReady        = "ready"         // 可以接收流量
+	StatusNotReady     = "not_ready"     // 有检查项失败
+	StatusShuttingDown = "shutting_down" // 收到退出信号，正在排空连接
+)
+
+// Response /readyz 的响应
+type Response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"` // 检查项 -> ok 或错误信息
+}
+
+// Probes 一个服务实例的探针
+type Probes struct {
+	ready    atomic.Bool
+	draining atomic.Bool
+
+	mu     sync.Mutex
+	checks map[string]func() error
+}
+
+// New 创建探针，SetReady 之前 /readyz 返回 503
+func New() *Probes {
+	return &Probes{checks: make(map[string]func() error)}
+}
+
+// AddCheck 添加就绪检查项，fn 返回错误时 /readyz 返回 503
+func (p *Probes) AddCheck(name string, fn func() error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checks[name] = fn
+}
+
+// SetReady 标记启动完成
+func (p *Probes) SetReady() {
+	p.ready.Store(true)
+}
+
+// SetDraining 标记正在关闭，之后 /readyz 一直返回 503，/healthz 不受影响
+func (p *Probes) SetDraining() {
+	p.draining.Store(true)
+}
+
+// Register 注册 /healthz 和 /readyz，两者都不需要认证
+func (p *Probes) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", p.handleHealthz)
+	mux.HandleFunc("/readyz", p.handleReadyz)
+}
+
+// Ready 返回当前的就绪状态和各检查项结果
+func (p *Probes) Ready() Response {
+	switch {
+	case p.draining.Load():
+		return Response{Status: StatusShuttingDown}
+	case !p.ready.Load():
+		return Response{Status: StatusStarting}
+	}
+
+	// 检查项可能较慢，不在持锁时执行
+	p.mu.Lock()
+	checks := make(map[string]func() error, len(p.checks))
+	for name, fn := range p.checks {
+		checks[name] = fn
+	}
+	p.mu.Unlock()
+
+	resp := Response{Status: StatusReady, Checks: make(map[string]string, len(checks))}
+	for name, fn := range checks {
+		if err := fn(); err != nil {
+			resp.Status = StatusNotReady
+			resp.Checks[name] = err.Error()
+			continue
+		}
+		resp.Checks[name] = "ok"
+	}
+	return resp
+}
+
+// handleHealthz 存活探针：进程能处理请求即返回 200
+func (p *Probes) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz 就绪探针：启动完成、未在关闭且所有检查项通过时返回 200，否则 503
+func (p *Probes) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	resp := p.Ready()
+	status := http.StatusOK
+	if resp.Status != StatusReady {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
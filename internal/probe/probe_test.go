@@ -0,0 +1,51 @@
+package probe
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProbes(t *testing.T) {
+	p := New()
+	var storageErr error
+	p.AddCheck("storage", func() error { return storageErr })
+	mux := http.NewServeMux()
+	p.Register(mux)
+
+	get := func(path string) (int, Response) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var resp Response
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	tests := []struct {
+		name   string
+		setup  func()
+		status int
+		ready  string
+	}{
+		{"starting", func() {}, http.StatusServiceUnavailable, StatusStarting},
+		{"ready", p.SetReady, http.StatusOK, StatusReady},
+		{"check failing", func() { storageErr = errors.New("read-only file system") }, http.StatusServiceUnavailable, StatusNotReady},
+		{"recovered", func() { storageErr = nil }, http.StatusOK, StatusReady},
+		{"draining", p.SetDraining, http.StatusServiceUnavailable, StatusShuttingDown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+			status, resp := get("/readyz")
+			if status != tt.status || resp.Status != tt.ready {
+				t.Errorf("readyz = %d %+v, want %d %s", status, resp, tt.status, tt.ready)
+			}
+			// 存活探针不受就绪状态影响
+			if status, _ := get("/healthz"); status != http.StatusOK {
+				t.Errorf("healthz = %d", status)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// DefaultProbeCount 比较路径时每条路径的默认探测次数
+const DefaultProbeCount = 3
+
+// Candidate 参与比较的一条路径
+type Candidate struct {
+	Label string       // 显示名称，如 "direct" 或 "bastion -> gateway"
+	Hops  []*types.Hop // 完整跳板链，最后一个为目标
+}
+
+// CandidateResult 一条路径多次探测的汇总
+type CandidateResult struct {
+	Label     string        `json:"label"`
+	Path      types.Path    `json:"path"`
+	HopCount  int           `json:"hop_count"`
+	Sent      int           `json:"sent"`
+	Received  int           `json:"received"`
+	Loss      float64       `json:"loss"` // 失败探测的比例，0-1
+	Latency   time.Duration `json:"-"`    // 成功探测的平均延迟
+	Min       time.Duration `json:"-"`
+	Max       time.Duration `json:"-"`
+	Error     string        `json:"error,omitempty"` // 最后一次失败的原因
+	Timestamp time.Time     `json:"timestamp"`
+	// Dials 最后一次探测时第一跳各解析地址的连接尝试
+	Dials []types.DialAttempt `json:"dials,omitempty"`
+}
+
+// Reachable 是否至少有一次探测成功
+func (r *CandidateResult) Reachable() bool {
+	return r.Received > 0
+}
+
+// MarshalJSON 延迟以毫秒输出
+func (r *CandidateResult) MarshalJSON() ([]byte, error) {
+	type plain CandidateResult
+	return json.Marshal(struct {
+		*plain
+		LatencyMs float64 `json:"latency_ms"`
+		MinMs     float64 `json:"min_ms"`
+		MaxMs     float64 `json:"max_ms"`
+	}{(*plain)(r), milliseconds(r.Latency), milliseconds(r.Min), milliseconds(r.Max)})
+}
+
+// UnmarshalJSON 读取 MarshalJSON 的输出，如 gmssh web 返回的对比结果
+func (r *CandidateResult) UnmarshalJSON(data []byte) error {
+	type plain CandidateResult
+	v := struct {
+		*plain
+		LatencyMs float64 `json:"latency_ms"`
+		MinMs     float64 `json:"min_ms"`
+		MaxMs     float64 `json:"max_ms"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	r.Latency = fromMilliseconds(v.LatencyMs)
+	r.Min = fromMilliseconds(v.MinMs)
+	r.Max = fromMilliseconds(v.MaxMs)
+	return nil
+}
+
+// fromMilliseconds 把毫秒数转换为时长
+func fromMilliseconds(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// milliseconds 把时长转换为毫秒，保留小数
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// ProbeCandidates 并发探测多条路径，每条路径忽略缓存探测 count 次，结果按 SortResults 排序
+func (np *NetworkProfiler) ProbeCandidates(ctx context.Context, candidates []Candidate, count int) []*CandidateResult {
+	if count <= 0 {
+		count = DefaultProbeCount
+	}
+
+	results := make([]*CandidateResult, len(candidates))
+	var wg sync.WaitGroup
+	for i, candidate := range candidates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = np.probeCandidate(ctx, candidate, count)
+		}()
+	}
+	wg.Wait()
+
+	SortResults(results)
+	return results
+}
+
+// probeCandidate 依次探测一条路径 count 次并汇总
+func (np *NetworkProfiler) probeCandidate(ctx context.Context, candidate Candidate, count int) *CandidateResult {
+	result := &CandidateResult{
+		Label:    candidate.Label,
+		Path:     PathOf(candidate.Hops),
+		HopCount: len(candidate.Hops),
+	}
+
+	var total time.Duration
+	for i := 0; i < count && ctx.Err() == nil; i++ {
+		result.Sent++
+		report, err := np.Refresh(ctx, candidate.Hops)
+		if report != nil {
+			result.Dials = report.Dials
+		}
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+		case !report.Success:
+			result.Error = report.Error
+		default:
+			result.Received++
+			total += report.Latency
+			if result.Min == 0 || report.Latency < result.Min {
+				result.Min = report.Latency
+			}
+			if report.Latency > result.Max {
+				result.Max = report.Latency
+			}
+		}
+	}
+
+	if result.Sent > 0 {
+		result.Loss = float64(result.Sent-result.Received) / float64(result.Sent)
+	}
+	if result.Received > 0 {
+		result.Latency = total / time.Duration(result.Received)
+	}
+	if result.Error == "" && ctx.Err() != nil && result.Received == 0 {
+		result.Error = ctx.Err().Error()
+	}
+	result.Timestamp = time.Now()
+	return result
+}
+
+// SortResults 排序比较结果：可达的路径在前，依次按平均延迟、丢包率、跳数升序
+func SortResults(results []*CandidateResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Reachable() != b.Reachable() {
+			return a.Reachable()
+		}
+		if a.Latency != b.Latency {
+			return a.Latency < b.Latency
+		}
+		if a.Loss != b.Loss {
+			return a.Loss < b.Loss
+		}
+		return a.HopCount < b.HopCount
+	})
+}
@@ -0,0 +1,118 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestProbeCandidates(t *testing.T) {
+	target := &types.Hop{ID: "hop-3", Name: "db"}
+	bastion := &types.Hop{ID: "hop-1", Name: "bastion"}
+	gateway := &types.Hop{ID: "hop-2", Name: "gateway"}
+
+	// 直连不可达，经 bastion 慢但稳定，经 gateway 快但丢一半
+	np := NewNetworkProfiler(time.Minute)
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	np.probeFunc = func(_ context.Context, hops []*types.Hop, path types.Path) (*types.LatencyReport, error) {
+		report := &types.LatencyReport{Path: path, Timestamp: time.Now()}
+		switch hops[0].Name {
+		case "db":
+			report.Error = "connection refused"
+		case "bastion":
+			report.Success = true
+			report.Latency = 80 * time.Millisecond
+			report.Dials = []types.DialAttempt{
+				{Addr: "[2001:db8::1]:22", Latency: 10 * time.Second, Error: "i/o timeout"},
+				{Addr: "192.0.2.1:22", Latency: 30 * time.Millisecond, Chosen: true},
+			}
+		case "gateway":
+			mu.Lock()
+			attempts["gateway"]++
+			ok := attempts["gateway"]%2 == 1
+			mu.Unlock()
+			report.Success = ok
+			report.Latency = 20 * time.Millisecond
+			if !ok {
+				report.Error = "timeout"
+			}
+		}
+		return report, nil
+	}
+
+	results := np.ProbeCandidates(context.Background(), []Candidate{
+		{Label: "direct", Hops: []*types.Hop{target}},
+		{Label: "bastion", Hops: []*types.Hop{bastion, target}},
+		{Label: "gateway", Hops: []*types.Hop{gateway, target}},
+	}, 4)
+
+	var labels []string
+	for _, r := range results {
+		labels = append(labels, r.Label)
+	}
+	if want := []string{"gateway", "bastion", "direct"}; len(labels) != 3 || labels[0] != want[0] || labels[1] != want[1] || labels[2] != want[2] {
+		t.Fatalf("order = %v, want %v", labels, want)
+	}
+
+	gw := results[0]
+	if gw.Sent != 4 || gw.Received != 2 || gw.Loss != 0.5 || gw.Latency != 20*time.Millisecond || gw.HopCount != 2 {
+		t.Errorf("gateway result = %+v", gw)
+	}
+	if dials := results[1].Dials; len(dials) != 2 || !dials[1].Chosen {
+		t.Errorf("bastion dials = %+v, want the second address chosen", dials)
+	}
+	direct := results[2]
+	if direct.Reachable() || direct.Loss != 1 || direct.Error != "connection refused" {
+		t.Errorf("direct result = %+v", direct)
+	}
+	data, err := json.Marshal(gw)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"latency_ms":20`) || !strings.Contains(string(data), `"loss":0.5`) {
+		t.Errorf("unexpected JSON: %s", data)
+	}
+	if got := np.History(PathOf([]*types.Hop{bastion, target})); len(got) != 4 {
+		t.Errorf("expected 4 history samples, got %d", len(got))
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	results := []*CandidateResult{
+		{Label: "down", Sent: 3},
+		{Label: "long", Sent: 3, Received: 3, Latency: 50 * time.Millisecond, HopCount: 3},
+		{Label: "lossy", Sent: 3, Received: 2, Loss: 1.0 / 3, Latency: 50 * time.Millisecond, HopCount: 2},
+		{Label: "short", Sent: 3, Received: 3, Latency: 50 * time.Millisecond, HopCount: 2},
+		{Label: "fast", Sent: 3, Received: 1, Loss: 2.0 / 3, Latency: 10 * time.Millisecond, HopCount: 4},
+	}
+	SortResults(results)
+
+	want := []string{"fast", "short", "long", "lossy", "down"}
+	for i, r := range results {
+		if r.Label != want[i] {
+			t.Fatalf("position %d = %s, want %s", i, r.Label, want[i])
+		}
+	}
+}
+
+func TestCandidateResultJSONRoundTrip(t *testing.T) {
+	in := &CandidateResult{Label: "via gw", HopCount: 2, Sent: 3, Received: 2, Loss: 1.0 / 3,
+		Latency: 12500 * time.Microsecond, Min: 10 * time.Millisecond, Max: 15 * time.Millisecond, Error: "timeout"}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out CandidateResult
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Label != in.Label || out.Received != 2 || out.Latency != in.Latency || out.Min != in.Min || out.Max != in.Max || out.Error != in.Error {
+		t.Errorf("round trip = %+v", out)
+	}
+}
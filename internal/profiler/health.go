@@ -0,0 +1,100 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const (
+	// DefaultCheckParallel 批量健康检查默认同时检查的服务器数
+	DefaultCheckParallel = 8
+	// DefaultCheckTimeout 单个服务器检查（建立整条链并执行命令）的默认超时
+	DefaultCheckTimeout = 20 * time.Second
+)
+
+// StageExec 链已建立但执行命令失败
+const StageExec = "exec"
+
+// CheckResult 一个服务器的健康检查结果
+type CheckResult struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	types.HealthCheck
+}
+
+// CheckHops 检查 targets 中每个服务器能否经 chainOf 返回的跳板链（最后一个为目标）连接并通过认证，
+// 最多同时检查 parallel 个（<= 0 时为 DefaultCheckParallel），每个最多 timeout（<= 0 时为 DefaultCheckTimeout）。
+// 结果与 targets 顺序一致，并记入延迟历史
+func (np *NetworkProfiler) CheckHops(ctx context.Context, targets []*types.Hop, chainOf func(*types.Hop) []*types.Hop, parallel int, timeout time.Duration) []CheckResult {
+	if parallel <= 0 {
+		parallel = DefaultCheckParallel
+	}
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+
+	results := make([]CheckResult, len(targets))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			hops := chainOf(target)
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			check := np.checkFunc(checkCtx, hops)
+			cancel()
+
+			check.AuthMethod = target.AuthType.String()
+			results[i] = CheckResult{ID: target.ID, Name: target.Name, HealthCheck: check}
+
+			report := &types.LatencyReport{
+				Path:      PathOf(hops),
+				Latency:   time.Duration(check.LatencyMs) * time.Millisecond,
+				Timestamp: check.CheckedAt,
+				Success:   check.OK,
+				Error:     check.Error,
+			}
+			np.history.Record(report)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// doCheck 建立整条链并执行一条命令，失败时记录失败的一跳和原因
+func (np *NetworkProfiler) doCheck(ctx context.Context, hops []*types.Hop) types.HealthCheck {
+	check := types.HealthCheck{CheckedAt: time.Now()}
+	chain := ssh.NewChain(hops)
+
+	start := time.Now()
+	err := chain.ConnectContext(ctx)
+	if err == nil {
+		defer chain.Disconnect()
+		if _, _, err = chain.Execute("true"); err != nil {
+			check.Stage = StageExec
+			check.FailedHop = hops[len(hops)-1].Name
+		}
+	}
+	check.LatencyMs = time.Since(start).Milliseconds()
+
+	var hopErr *ssh.HopError
+	if errors.As(err, &hopErr) {
+		check.Stage = hopErr.Kind
+		check.FailedHop = hopErr.Hop
+	}
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.OK = true
+	return check
+}
@@ -0,0 +1,70 @@
+package profiler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestCheckHops(t *testing.T) {
+	gateway := &types.Hop{ID: "hop-1", Name: "gateway", AuthType: types.AuthKey}
+	web := &types.Hop{ID: "hop-2", Name: "web", AuthType: types.AuthPassword, GatewayID: "hop-1"}
+	db := &types.Hop{ID: "hop-3", Name: "db", AuthType: types.AuthKey}
+	targets := []*types.Hop{gateway, web, db}
+
+	np := NewNetworkProfiler(time.Minute)
+	var running, peak atomic.Int32
+	np.checkFunc = func(_ context.Context, hops []*types.Hop) types.HealthCheck {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+
+		check := types.HealthCheck{CheckedAt: time.Now(), LatencyMs: int64(10 * len(hops))}
+		if hops[len(hops)-1].Name == "db" {
+			check.Stage, check.FailedHop, check.Error = "auth", "db", "unable to authenticate"
+			return check
+		}
+		check.OK = true
+		return check
+	}
+
+	chainOf := func(hop *types.Hop) []*types.Hop {
+		if hop.GatewayID != "" {
+			return []*types.Hop{gateway, hop}
+		}
+		return []*types.Hop{hop}
+	}
+	results := np.CheckHops(context.Background(), targets, chainOf, 2, time.Second)
+
+	if p := peak.Load(); p > 2 {
+		t.Errorf("%d checks ran at once, want at most 2", p)
+	}
+	if len(results) != len(targets) {
+		t.Fatalf("got %d results, want %d", len(results), len(targets))
+	}
+	for i, r := range results {
+		if r.ID != targets[i].ID || r.AuthMethod != targets[i].AuthType.String() {
+			t.Errorf("result %d = %+v, want id %s auth %s", i, r, targets[i].ID, targets[i].AuthType)
+		}
+	}
+	if !results[1].OK || results[1].LatencyMs != 20 {
+		t.Errorf("web via gateway = %+v", results[1])
+	}
+	if results[2].OK || results[2].Stage != "auth" || results[2].FailedHop != "db" {
+		t.Errorf("db = %+v, want auth failure", results[2])
+	}
+
+	history := np.History(PathOf([]*types.Hop{gateway, web}))
+	if len(history) != 1 {
+		t.Errorf("history for gateway -> web has %d samples, want 1", len(history))
+	}
+}
@@ -0,0 +1,60 @@
+package profiler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// DefaultHistorySize 每条路径保留的延迟样本数
+const DefaultHistorySize = 120
+
+// Sample 一次延迟探测的样本
+type Sample struct {
+	Timestamp time.Time     `json:"timestamp"`
+	Latency   time.Duration `json:"latency"`
+	Success   bool          `json:"success"`
+}
+
+// History 按路径保存最近的延迟样本（环形缓冲）
+type History struct {
+	size    int
+	samples map[string][]Sample
+	mu      sync.RWMutex
+}
+
+// NewHistory 创建延迟历史，size 为每条路径保留的样本数
+func NewHistory(size int) *History {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	return &History{
+		size:    size,
+		samples: make(map[string][]Sample),
+	}
+}
+
+// Record 记录一次探测结果
+func (h *History) Record(report *types.LatencyReport) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := report.Path.Key()
+	samples := append(h.samples[key], Sample{
+		Timestamp: report.Timestamp,
+		Latency:   report.Latency,
+		Success:   report.Success,
+	})
+	if len(samples) > h.size {
+		samples = samples[len(samples)-h.size:]
+	}
+	h.samples[key] = samples
+}
+
+// Get 返回指定路径的样本副本，按时间从旧到新
+func (h *History) Get(path types.Path) []Sample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]Sample(nil), h.samples[path.Key()]...)
+}
@@ -14,7 +14,12 @@ import (
 type NetworkProfiler struct {
 	cache      map[string]*types.LatencyReport
 	cacheTTL   time.Duration
+	history    *History
 	mu         sync.RWMutex
+	// probeFunc 实际执行一次探测，测试中可替换
+	probeFunc func(ctx context.Context, hops []*types.Hop, path types.Path) (*types.LatencyReport, error)
+	// checkFunc 实际执行一次健康检查，测试中可替换
+	checkFunc func(ctx context.Context, hops []*types.Hop) types.HealthCheck
 }
 
 // NewNetworkProfiler 创建新的网络分析器
@@ -22,14 +27,18 @@ func NewNetworkProfiler(cacheTTL time.Duration) *NetworkProfiler {
 	if cacheTTL == 0 {
 		cacheTTL = 5 * time.Minute
 	}
-	return &NetworkProfiler{
+	np := &NetworkProfiler{
 		cache:    make(map[string]*types.LatencyReport),
 		cacheTTL: cacheTTL,
+		history:  NewHistory(DefaultHistorySize),
 	}
+	np.probeFunc = np.doProbe
+	np.checkFunc = np.doCheck
+	return np
 }
 
-// Probe 探测指定路径的延迟
-func (np *NetworkProfiler) Probe(ctx context.Context, hops []*types.Hop) (*types.LatencyReport, error) {
+// PathOf 返回跳板链对应的路径
+func PathOf(hops []*types.Hop) types.Path {
 	path := types.Path{
 		From: "localhost",
 		To:   hops[len(hops)-1].Name,
@@ -38,20 +47,58 @@ func (np *NetworkProfiler) Probe(ctx context.Context, hops []*types.Hop) (*types
 	for i := 0; i < len(hops)-1; i++ {
 		path.Via = append(path.Via, hops[i].Name)
 	}
+	return path
+}
+
+// Probe 探测指定路径的延迟
+func (np *NetworkProfiler) Probe(ctx context.Context, hops []*types.Hop) (*types.LatencyReport, error) {
+	path := PathOf(hops)
 
 	// 检查缓存
 	if report := np.getCached(path); report != nil {
 		return report, nil
 	}
 
-	// 执行探测
-	report, err := np.doProbe(ctx, hops, path)
+	return np.probe(ctx, hops, path)
+}
+
+// Refresh 忽略缓存立即探测，用于周期性健康检查
+func (np *NetworkProfiler) Refresh(ctx context.Context, hops []*types.Hop) (*types.LatencyReport, error) {
+	return np.probe(ctx, hops, PathOf(hops))
+}
+
+// History 返回指定路径最近的延迟样本
+func (np *NetworkProfiler) History(path types.Path) []Sample {
+	return np.history.Get(path)
+}
+
+// Observe 记录一次在已建立的链上测得的往返时间（如连接池的 keepalive）。
+// 只进入历史，不更新探测缓存：缓存中的延迟包含建立连接的耗时，两者不可直接比较
+func (np *NetworkProfiler) Observe(hops []*types.Hop, rtt time.Duration, err error) {
+	if len(hops) == 0 {
+		return
+	}
+	report := &types.LatencyReport{
+		Path:      PathOf(hops),
+		Latency:   rtt,
+		Timestamp: time.Now(),
+		Success:   err == nil,
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	np.history.Record(report)
+}
+
+// probe 执行探测并更新缓存和历史
+func (np *NetworkProfiler) probe(ctx context.Context, hops []*types.Hop, path types.Path) (*types.LatencyReport, error) {
+	report, err := np.probeFunc(ctx, hops, path)
 	if err != nil {
 		return nil, err
 	}
 
-	// 更新缓存
 	np.setCache(path, report)
+	np.history.Record(report)
 
 	return report, nil
 }
@@ -61,13 +108,14 @@ func (np *NetworkProfiler) doProbe(ctx context.Context, hops []*types.Hop, path
 	chain := ssh.NewChain(hops)
 
 	start := time.Now()
-	if err := chain.Connect(); err != nil {
+	if err := chain.ConnectContext(ctx); err != nil {
 		return &types.LatencyReport{
 			Path:      path,
 			Latency:   0,
 			Timestamp: time.Now(),
 			Success:   false,
 			Error:     err.Error(),
+			Dials:     chain.DialAttempts(),
 		}, nil
 	}
 	defer chain.Disconnect()
@@ -83,6 +131,7 @@ func (np *NetworkProfiler) doProbe(ctx context.Context, hops []*types.Hop, path
 			Timestamp: time.Now(),
 			Success:   false,
 			Error:     err.Error(),
+			Dials:     chain.DialAttempts(),
 		}, nil
 	}
 
@@ -91,6 +140,7 @@ func (np *NetworkProfiler) doProbe(ctx context.Context, hops []*types.Hop, path
 		Latency:   latency,
 		Timestamp: time.Now(),
 		Success:   true,
+		Dials:     chain.DialAttempts(),
 	}, nil
 }
 
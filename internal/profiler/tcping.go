@@ -0,0 +1,172 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const (
+	// tcpingDialTimeout 单次连接超时
+	tcpingDialTimeout = 5 * time.Second
+	// tcpingBannerWait 连接后等待服务端主动发送 banner 的时间
+	tcpingBannerWait = time.Second
+	// tcpingBannerSize 最多读取的 banner 字节数
+	tcpingBannerSize = 128
+)
+
+// TCPingResult 经跳板链对 host:port 多次 TCP 连接的汇总
+type TCPingResult struct {
+	Address   string        `json:"address"`
+	Via       []string      `json:"via"` // 执行连接的跳板链，为空表示从本机连接
+	Sent      int           `json:"sent"`
+	Received  int           `json:"received"`
+	Loss      float64       `json:"loss"` // 连接失败的比例，0-1
+	Latency   time.Duration `json:"-"`    // 成功连接的平均耗时
+	Min       time.Duration `json:"-"`
+	Max       time.Duration `json:"-"`
+	Banner    string        `json:"banner,omitempty"` // 服务端主动发送的前几个字节，不可打印字符替换为 '.'
+	Error     string        `json:"error,omitempty"`  // 跳板链连接失败或最后一次连接失败的原因
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// Reachable 是否至少有一次连接成功
+func (r *TCPingResult) Reachable() bool {
+	return r.Received > 0
+}
+
+// MarshalJSON 延迟以毫秒输出
+func (r *TCPingResult) MarshalJSON() ([]byte, error) {
+	type plain TCPingResult
+	return json.Marshal(struct {
+		*plain
+		LatencyMs float64 `json:"latency_ms"`
+		MinMs     float64 `json:"min_ms"`
+		MaxMs     float64 `json:"max_ms"`
+	}{(*plain)(r), milliseconds(r.Latency), milliseconds(r.Min), milliseconds(r.Max)})
+}
+
+// dialFunc 建立 TCP 连接，本机直连或经跳板链最后一跳转发
+type dialFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+// TCPing 经 hops 的最后一跳（hops 为空时从本机）连接 addr count 次，统计连接耗时，
+// 并读取第一次成功连接上服务端主动发送的 banner
+func TCPing(ctx context.Context, hops []*types.Hop, addr string, count int) *TCPingResult {
+	result := &TCPingResult{Address: addr, Via: []string{}, Timestamp: time.Now()}
+	for _, hop := range hops {
+		result.Via = append(result.Via, hop.Name)
+	}
+
+	if len(hops) == 0 {
+		var dialer net.Dialer
+		tcping(ctx, result, func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", addr)
+		}, count)
+		return result
+	}
+
+	chain := ssh.NewChain(hops)
+	if err := chain.ConnectContext(ctx); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer chain.Disconnect()
+
+	tcping(ctx, result, func(ctx context.Context, addr string) (net.Conn, error) {
+		return dialContext(ctx, chain, addr)
+	}, count)
+	return result
+}
+
+// tcping 依次连接 count 次并把结果写入 result
+func tcping(ctx context.Context, result *TCPingResult, dial dialFunc, count int) {
+	if count <= 0 {
+		count = DefaultProbeCount
+	}
+
+	var total time.Duration
+	for i := 0; i < count && ctx.Err() == nil; i++ {
+		result.Sent++
+
+		dialCtx, cancel := context.WithTimeout(ctx, tcpingDialTimeout)
+		start := time.Now()
+		conn, err := dial(dialCtx, result.Address)
+		elapsed := time.Since(start)
+		cancel()
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+
+		if result.Received == 0 {
+			result.Banner = readBanner(conn)
+		}
+		conn.Close()
+
+		result.Received++
+		total += elapsed
+		if result.Min == 0 || elapsed < result.Min {
+			result.Min = elapsed
+		}
+		if elapsed > result.Max {
+			result.Max = elapsed
+		}
+	}
+
+	if result.Sent > 0 {
+		result.Loss = float64(result.Sent-result.Received) / float64(result.Sent)
+	}
+	if result.Received > 0 {
+		result.Latency = total / time.Duration(result.Received)
+		result.Error = ""
+	}
+}
+
+// dialContext 经跳板链连接 addr，ctx 结束时放弃等待（SSH 转发的连接本身不支持 context）
+func dialContext(ctx context.Context, chain *ssh.Chain, addr string) (net.Conn, error) {
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan dialResult, 1)
+	go func() {
+		conn, err := chain.Dial("tcp", addr)
+		done <- dialResult{conn, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// readBanner 在短时间内读取服务端主动发送的数据（如 SSH、MySQL、SMTP 的欢迎信息）
+func readBanner(conn net.Conn) string {
+	conn.SetReadDeadline(time.Now().Add(tcpingBannerWait))
+	buf := make([]byte, tcpingBannerSize)
+	n, _ := conn.Read(buf)
+	return printableBanner(buf[:n])
+}
+
+// printableBanner 去掉首尾空白，不可打印字符替换为 '.'
+func printableBanner(data []byte) string {
+	return strings.Map(func(r rune) rune {
+		if r == unicode.ReplacementChar || !unicode.IsPrint(r) {
+			return '.'
+		}
+		return r
+	}, strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,69 @@
+package profiler
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestTCPingLocal(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+			conn.Close()
+		}
+	}()
+
+	result := TCPing(context.Background(), nil, ln.Addr().String(), 3)
+	if result.Sent != 3 || result.Received != 3 || result.Loss != 0 {
+		t.Fatalf("sent=%d received=%d loss=%v, want 3/3/0 (error %q)", result.Sent, result.Received, result.Loss, result.Error)
+	}
+	if result.Banner != "SSH-2.0-OpenSSH_9.6" {
+		t.Errorf("banner = %q", result.Banner)
+	}
+	if result.Latency <= 0 || result.Min > result.Latency || result.Max < result.Latency {
+		t.Errorf("latency=%v min=%v max=%v", result.Latency, result.Min, result.Max)
+	}
+	if len(result.Via) != 0 {
+		t.Errorf("via = %v, want empty", result.Via)
+	}
+}
+
+func TestTCPingRefused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	result := TCPing(context.Background(), nil, addr, 2)
+	if result.Reachable() || result.Loss != 1 || result.Error == "" {
+		t.Errorf("received=%d loss=%v error=%q, want unreachable", result.Received, result.Loss, result.Error)
+	}
+}
+
+func TestPrintableBanner(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want string
+	}{
+		{[]byte("220 mail.example.com ESMTP\r\n"), "220 mail.example.com ESMTP"},
+		{[]byte{0x4a, 0x00, 0x00, 0x00, 0x0a, '8', '.', '0'}, "J....8.0"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := printableBanner(tt.in); got != tt.want {
+			t.Errorf("printableBanner(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package profiler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// TraceHop 路由追踪中的一个路由器
+type TraceHop struct {
+	TTL   int     `json:"ttl"`
+	Host  string  `json:"host"`   // 无响应时为 "*"
+	Loss  float64 `json:"loss"`   // 丢包比例，0-1
+	AvgMs float64 `json:"avg_ms"` // 有响应时的平均往返时间
+}
+
+// TraceSegment 链路中的一段：在 From 上追踪到 To 的路由，并尝试经 From SSH 连接 To
+type TraceSegment struct {
+	From       string     `json:"from"` // 第一段为 localhost
+	To         string     `json:"to"`
+	ToHost     string     `json:"to_host"`
+	Tool       string     `json:"tool,omitempty"` // mtr 或 traceroute
+	Hops       []TraceHop `json:"hops"`
+	TraceError string     `json:"trace_error,omitempty"` // 路由追踪本身失败的原因
+	Reached    bool       `json:"reached"`               // SSH 连接到 To 成功
+	Error      string     `json:"error,omitempty"`       // SSH 连接失败的原因
+}
+
+// TraceReport 整条链路的逐段追踪结果
+type TraceReport struct {
+	Target        string         `json:"target"`
+	Segments      []TraceSegment `json:"segments"`
+	LastReachable string         `json:"last_reachable,omitempty"` // 最后一个 SSH 可达的服务器
+}
+
+// traceHostPattern 允许追踪的目标地址，防止拼进远端 shell 命令时被注入
+var traceHostPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+// traceScript 在执行方上优先用 mtr、其次用 traceroute 追踪 host，第一行输出所用工具
+func traceScript(host string) string {
+	return fmt.Sprintf(`if command -v mtr >/dev/null 2>&1; then echo mtr; mtr -n -r -c 3 %[1]s; `+
+		`elif command -v traceroute >/dev/null 2>&1; then echo traceroute; traceroute -n -q 3 -w 2 %[1]s; `+
+		`else echo "neither mtr nor traceroute is installed" >&2; exit 127; fi`, host)
+}
+
+// Trace 逐段诊断跳板链：第 i 段在第 i-1 跳（第一段在本机）上追踪到第 i 跳的路由，
+// 然后经第 i-1 跳 SSH 连接第 i 跳；连接失败时停止，之前的段说明问题出在哪里
+func Trace(ctx context.Context, hops []*types.Hop) *TraceReport {
+	report := &TraceReport{Segments: []TraceSegment{}}
+	if len(hops) == 0 {
+		return report
+	}
+	report.Target = hops[len(hops)-1].Name
+
+	var clients []*ssh.Client
+	defer func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Disconnect()
+		}
+	}()
+
+	from := "localhost"
+	for _, hop := range hops {
+		if ctx.Err() != nil {
+			break
+		}
+		segment := TraceSegment{From: from, To: hop.Name, ToHost: hop.Host}
+
+		var prev *ssh.Client
+		if len(clients) > 0 {
+			prev = clients[len(clients)-1]
+		}
+		segment.Tool, segment.Hops, segment.TraceError = traceFrom(ctx, prev, hop.Host)
+
+		client, err := connectThrough(hop, prev)
+		if err != nil {
+			segment.Error = err.Error()
+			report.Segments = append(report.Segments, segment)
+			break
+		}
+		segment.Reached = true
+		clients = append(clients, client)
+		report.Segments = append(report.Segments, segment)
+		report.LastReachable = hop.Name
+		from = hop.Name
+	}
+	return report
+}
+
+// connectThrough 连接 hop，prev 非空时经由 prev
+func connectThrough(hop *types.Hop, prev *ssh.Client) (*ssh.Client, error) {
+	client, err := ssh.NewClient(hop)
+	if err != nil {
+		return nil, err
+	}
+	if prev == nil {
+		err = client.Connect()
+	} else {
+		err = client.ConnectThrough(prev)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// traceFrom 在 runner 上（nil 表示本机）追踪到 host 的路由
+func traceFrom(ctx context.Context, runner *ssh.Client, host string) (tool string, hops []TraceHop, errMsg string) {
+	if !traceHostPattern.MatchString(host) {
+		return "", nil, fmt.Sprintf("invalid host %q", host)
+	}
+
+	var output []byte
+	var err error
+	if runner == nil {
+		output, err = exec.CommandContext(ctx, "sh", "-c", traceScript(host)).CombinedOutput()
+	} else {
+		output, err = runRemote(ctx, runner, traceScript(host))
+	}
+
+	tool, body, _ := strings.Cut(string(output), "\n")
+	tool = strings.TrimSpace(tool)
+	switch tool {
+	case "mtr":
+		hops = ParseMTR(body)
+	case "traceroute":
+		hops = ParseTraceroute(body)
+	default:
+		tool = ""
+	}
+	if err != nil && len(hops) == 0 {
+		msg := strings.TrimSpace(string(output))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return tool, nil, msg
+	}
+	return tool, hops, ""
+}
+
+// runRemote 在 client 上执行命令，ctx 取消时关闭会话
+func runRemote(ctx context.Context, client *ssh.Client, command string) ([]byte, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var out bytes.Buffer
+	session.Stdout = &out
+	session.Stderr = &out
+
+	done := make(chan error, 1)
+	go func() { done <- session.Run(command) }()
+	select {
+	case err := <-done:
+		return out.Bytes(), err
+	case <-ctx.Done():
+		session.Close()
+		return out.Bytes(), ctx.Err()
+	}
+}
+
+// mtrLine mtr --report 的数据行：序号、地址、丢包率、发送数、Last、Avg ...
+var mtrLine = regexp.MustCompile(`^\s*(\d+)\.\|--\s+(\S+)\s+([\d.]+)%?\s+(\d+)\s+([\d.]+)\s+([\d.]+)`)
+
+// ParseMTR 解析 mtr -n -r 的输出
+func ParseMTR(output string) []TraceHop {
+	var hops []TraceHop
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		m := mtrLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		ttl, _ := strconv.Atoi(m[1])
+		loss, _ := strconv.ParseFloat(m[3], 64)
+		avg, _ := strconv.ParseFloat(m[6], 64)
+		host := m[2]
+		if host == "???" {
+			host = "*"
+			avg = 0
+		}
+		hops = append(hops, TraceHop{TTL: ttl, Host: host, Loss: loss / 100, AvgMs: avg})
+	}
+	return hops
+}
+
+// ParseTraceroute 解析 traceroute -n 的输出；一行有多个地址时取第一个
+func ParseTraceroute(output string) []TraceHop {
+	var hops []TraceHop
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		ttl, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue // 标题行
+		}
+
+		hop := TraceHop{TTL: ttl, Host: "*"}
+		var sent, received int
+		var total float64
+		for i := 1; i < len(fields); i++ {
+			field := fields[i]
+			switch {
+			case field == "*":
+				sent++
+			case strings.HasPrefix(field, "!"):
+				// !H、!N 等不可达标记
+			case i+1 < len(fields) && fields[i+1] == "ms":
+				if rtt, err := strconv.ParseFloat(field, 64); err == nil {
+					sent++
+					received++
+					total += rtt
+				}
+				i++
+			case hop.Host == "*":
+				hop.Host = field
+			}
+		}
+		if sent > 0 {
+			hop.Loss = float64(sent-received) / float64(sent)
+		}
+		if received > 0 {
+			hop.AvgMs = total / float64(received)
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
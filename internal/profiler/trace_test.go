@@ -0,0 +1,60 @@
+package profiler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseMTR(t *testing.T) {
+	output := `Start: 2024-05-01T10:00:00+0000
+HOST: gateway                    Loss%   Snt   Last   Avg  Best  Wrst StDev
+  1.|-- 10.0.0.1                   0.0%     3    0.3   0.4   0.3   0.5   0.1
+  2.|-- ???                       100.0     3    0.0   0.0   0.0   0.0   0.0
+  3.|-- 10.0.2.5                  50.0%     3   12.1  11.8  11.5  12.1   0.3
+`
+	want := []TraceHop{
+		{TTL: 1, Host: "10.0.0.1", Loss: 0, AvgMs: 0.4},
+		{TTL: 2, Host: "*", Loss: 1, AvgMs: 0},
+		{TTL: 3, Host: "10.0.2.5", Loss: 0.5, AvgMs: 11.8},
+	}
+	if got := ParseMTR(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseMTR() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseTraceroute(t *testing.T) {
+	output := `traceroute to 10.0.2.5 (10.0.2.5), 30 hops max, 60 byte packets
+ 1  10.0.0.1  0.300 ms  0.200 ms  0.100 ms
+ 2  * * *
+ 3  10.0.2.5  2.000 ms *  4.000 ms
+ 4  10.0.3.1  1.000 ms 10.0.3.2  3.000 ms !H *
+`
+	want := []TraceHop{
+		{TTL: 1, Host: "10.0.0.1", Loss: 0, AvgMs: 0.2},
+		{TTL: 2, Host: "*", Loss: 1},
+		{TTL: 3, Host: "10.0.2.5", Loss: 1.0 / 3, AvgMs: 3},
+		{TTL: 4, Host: "10.0.3.1", Loss: 1.0 / 3, AvgMs: 2},
+	}
+	got := ParseTraceroute(output)
+	if len(got) != len(want) {
+		t.Fatalf("got %d hops, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.TTL != w.TTL || g.Host != w.Host || !almostEqual(g.Loss, w.Loss) || !almostEqual(g.AvgMs, w.AvgMs) {
+			t.Errorf("hop %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestTraceScriptRejectsShellInput(t *testing.T) {
+	if _, _, errMsg := traceFrom(context.Background(), nil, "10.0.0.1; rm -rf /"); errMsg == "" {
+		t.Error("expected invalid host to be rejected")
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// DefaultBindHost 未指定主机的监听地址（如 ":8080"）默认只监听本机
+const DefaultBindHost = "127.0.0.1"
+
+var (
+	// ErrLANBindDisabled 策略不允许监听本机以外可访问的地址
+	ErrLANBindDisabled = errors.New("listening on non-loopback addresses is not allowed")
+	// ErrLANBindUnconfirmed 监听本机以外可访问的地址需要确认
+	ErrLANBindUnconfirmed = errors.New("listening on non-loopback addresses must be confirmed")
+)
+
+// NormalizeBindAddr 补全监听地址：空地址为 127.0.0.1:0，没有主机的地址补上 127.0.0.1；
+// unix socket 路径和无法解析的地址原样返回，后者由监听时报错
+func NormalizeBindAddr(addr string) string {
+	if IsUnixSocket(addr) {
+		return addr
+	}
+	if addr == "" {
+		return net.JoinHostPort(DefaultBindHost, "0")
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort(DefaultBindHost, port)
+}
+
+// ExposesLAN 监听地址是否能从本机以外访问：监听所有地址（0.0.0.0、::）或非回环地址；
+// 没有主机的地址按 NormalizeBindAddr 视为只监听本机，unix socket 只能从本机访问
+func ExposesLAN(addr string) bool {
+	if IsUnixSocket(addr) {
+		return false
+	}
+	host, _, err := net.SplitHostPort(NormalizeBindAddr(addr))
+	if err != nil || host == "localhost" {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip == nil || !ip.IsLoopback()
+}
+
+// CheckBind 按监听策略补全并检查 addr：本机以外可访问的地址要求 allowLAN（策略允许）且 confirmed（本次已确认）
+func CheckBind(addr string, allowLAN, confirmed bool) (string, error) {
+	addr = NormalizeBindAddr(addr)
+	if !ExposesLAN(addr) {
+		return addr, nil
+	}
+	if !allowLAN {
+		return "", fmt.Errorf("%s: %w", addr, ErrLANBindDisabled)
+	}
+	if !confirmed {
+		return "", fmt.Errorf("%s: %w", addr, ErrLANBindUnconfirmed)
+	}
+	return addr, nil
+}
@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckBind(t *testing.T) {
+	tests := []struct {
+		addr      string
+		allowLAN  bool
+		confirmed bool
+		want      string
+		wantErr   error
+	}{
+		{"", false, false, "127.0.0.1:0", nil},
+		{":8080", false, false, "127.0.0.1:8080", nil},
+		{"localhost:8080", false, false, "localhost:8080", nil},
+		{"[::1]:8080", false, false, "[::1]:8080", nil},
+		{"0.0.0.0:8080", false, true, "", ErrLANBindDisabled},
+		{"192.168.1.5:8080", false, true, "", ErrLANBindDisabled},
+		{"0.0.0.0:8080", true, false, "", ErrLANBindUnconfirmed},
+		{"[::]:8080", true, true, "[::]:8080", nil},
+		{"/run/app.sock", false, false, "/run/app.sock", nil},
+		{"unix:/run/app.sock", false, false, "unix:/run/app.sock", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := CheckBind(tt.addr, tt.allowLAN, tt.confirmed)
+		if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+			t.Errorf("CheckBind(%q, %v, %v) error = %v, want %v", tt.addr, tt.allowLAN, tt.confirmed, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CheckBind(%q, %v, %v) = %q, want %q", tt.addr, tt.allowLAN, tt.confirmed, got, tt.want)
+		}
+	}
+}
@@ -2,43 +2,114 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/luobobo896/HSSH/internal/lifecycle"
+	"github.com/luobobo896/HSSH/internal/resolver"
 	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/pkg/types"
 )
 
-// PortForwarder 端口转发器
+// DefaultDrainTimeout Drain 等待已有连接结束的默认时限
+const DefaultDrainTimeout = 30 * time.Second
+
+// drainPollInterval Drain 检查已有连接是否结束的间隔
+const drainPollInterval = 50 * time.Millisecond
+
+// tunnel 转发器依赖的 SSH 链能力
+type tunnel interface {
+	Dial(network, addr string) (net.Conn, error)
+	IsConnected() bool
+	Disconnect() error
+}
+
+// PortForwarder 端口转发器，本地地址和远程主机都可以是 unix socket 路径
+// 监听器、每个转发连接及其 goroutine 都归属于 owner，Stop 时一并拆除
 type PortForwarder struct {
-	chain      *ssh.Chain
+	chain      tunnel
 	localAddr  string
 	remoteHost string
 	remotePort int
 	listener   net.Listener
 	active     atomic.Bool
-	ctx        context.Context
-	cancel     context.CancelFunc
-	wg         sync.WaitGroup
+	draining   atomic.Bool // 已停止接受新连接，等待已有连接结束
+	owner      *lifecycle.Owner
 	connCount  atomic.Int32
+	startedAt  time.Time
+	dialErr    atomic.Pointer[string] // 最近一次经链路拨号的错误，成功后清空
+	reconnecting atomic.Bool  // 链路断开，正在按 Supervise 的策略重连
+	reconnects   atomic.Int32 // 启动以来链路重连成功的次数
+	resolver   resolver.Mode          // remoteHost 的解析方式，默认由链路末端解析
+	scope      string                 // 解析缓存中区分链路的标识
+
+	connsMu     sync.Mutex
+	conns       map[uint64]*trackedConn // 转发中的连接
+	closedBytes int64                   // 已结束的连接转发的字节数，由 connsMu 保护
+	nextID      atomic.Uint64
+}
+
+// ConnInfo 一个转发中的连接
+type ConnInfo struct {
+	ID          uint64    `json:"id"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	BytesIn     int64     `json:"bytes_in"`  // 从客户端收到并发往远端的字节数
+	BytesOut    int64     `json:"bytes_out"` // 从远端收到并发回客户端的字节数
+	StartedAt   time.Time `json:"started_at"`
+}
+
+// trackedConn 登记中的连接，关闭 local 即结束转发
+type trackedConn struct {
+	local     net.Conn
+	startedAt time.Time
+	bytesIn   atomic.Int64
+	bytesOut  atomic.Int64
+}
+
+// countingConn 统计读取字节数的连接
+type countingConn struct {
+	net.Conn
+	n *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.n.Add(int64(n))
+	return n, err
 }
 
 // NewPortForwarder 创建新的端口转发器
 func NewPortForwarder(chain *ssh.Chain, localAddr, remoteHost string, remotePort int) *PortForwarder {
-	ctx, cancel := context.WithCancel(context.Background())
 	return &PortForwarder{
 		chain:      chain,
 		localAddr:  localAddr,
 		remoteHost: remoteHost,
 		remotePort: remotePort,
-		ctx:        ctx,
-		cancel:     cancel,
+		owner:      lifecycle.New(context.Background()),
+		conns:      make(map[uint64]*trackedConn),
 	}
 }
 
+// SetResolver 设置 remoteHost 的解析方式，需在 Start 之前调用。scope 标识链路，
+// 经隧道查询 DNS 服务器的结果按链路分开缓存
+func (pf *PortForwarder) SetResolver(mode resolver.Mode, scope string) {
+	pf.resolver = mode
+	pf.scope = scope
+}
+
+// OnStop 登记 Stop 时执行的清理（如断开转发器独占的 SSH 链），在所有连接关闭之前执行
+func (pf *PortForwarder) OnStop(fn func() error) {
+	pf.owner.OnClose(fn)
+}
+
 // Start 启动端口转发
 func (pf *PortForwarder) Start() error {
 	if pf.active.Load() {
@@ -49,38 +120,102 @@ func (pf *PortForwarder) Start() error {
 		return fmt.Errorf("SSH chain not connected")
 	}
 
-	listener, err := net.Listen("tcp", pf.localAddr)
+	listener, err := Listen(pf.localAddr)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", pf.localAddr, err)
 	}
 
 	pf.listener = listener
+	pf.startedAt = time.Now()
 	pf.active.Store(true)
+	pf.owner.OnClose(func() error {
+		// StopAccepting 可能已经关闭
+		if err := listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			return err
+		}
+		return nil
+	})
+
+	// 链路由 Supervise 监督时跟随重连状态，重连期间到来的连接拨号失败后直接关闭
+	if chain, ok := pf.chain.(interface {
+		Subscribe(func(ssh.ChainEvent)) func()
+	}); ok {
+		unsubscribe := chain.Subscribe(pf.onChainEvent)
+		pf.owner.OnClose(func() error {
+			unsubscribe()
+			return nil
+		})
+	}
 
 	// 启动接受连接循环
-	pf.wg.Add(1)
-	go pf.acceptLoop()
+	pf.owner.Go(pf.acceptLoop)
 
 	return nil
 }
 
-// Stop 停止端口转发
-func (pf *PortForwarder) Stop() error {
-	if !pf.active.Load() {
-		return nil
+// onChainEvent 记录链路的断开和重连，转发器本身不需要重启：监听器保持打开，重连后新的连接经新的链路拨号
+func (pf *PortForwarder) onChainEvent(event ssh.ChainEvent) {
+	switch event.Kind {
+	case ssh.ChainLost, ssh.ChainRetry:
+		pf.reconnecting.Store(true)
+		msg := fmt.Sprintf("chain lost at %s, reconnecting in %s: %v", event.Hop, event.Next.Round(time.Second), event.Err)
+		if event.Kind == ssh.ChainRetry {
+			msg = fmt.Sprintf("reconnect attempt %d failed, retrying in %s: %v", event.Attempt, event.Next.Round(time.Second), event.Err)
+		}
+		pf.dialErr.Store(&msg)
+	case ssh.ChainRestored:
+		pf.reconnecting.Store(false)
+		pf.reconnects.Add(1)
+		pf.dialErr.Store(nil)
+		log.Printf("[Proxy] %s resumed after chain reconnect", pf.localAddr)
+	case ssh.ChainGaveUp:
+		pf.reconnecting.Store(false)
+		msg := fmt.Sprintf("gave up reconnecting after %d attempt(s): %v", event.Attempt, event.Err)
+		pf.dialErr.Store(&msg)
 	}
+}
 
+// Stop 停止端口转发：关闭监听器、SSH 链（若已登记）和所有转发中的连接，并等待 goroutine 退出
+func (pf *PortForwarder) Stop() error {
 	pf.active.Store(false)
-	pf.cancel()
+	return pf.owner.Close()
+}
 
+// StopAccepting 关闭监听器，不再接受新连接，转发中的连接不受影响；本地端口随即可以被新的转发器使用
+func (pf *PortForwarder) StopAccepting() {
+	pf.draining.Store(true)
 	if pf.listener != nil {
 		pf.listener.Close()
 	}
+}
 
-	// 等待所有连接处理完成
-	pf.wg.Wait()
+// Drain 停止接受新连接，等转发中的连接全部结束或超过 timeout（<= 0 时为 DefaultDrainTimeout）后 Stop，
+// 返回超时时被断开的连接数
+func (pf *PortForwarder) Drain(timeout time.Duration) int {
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+	pf.StopAccepting()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for pf.connCount.Load() > 0 {
+		select {
+		case <-deadline.C:
+			cut := pf.GetConnectionCount()
+			pf.Stop()
+			return cut
+		case <-ticker.C:
+		}
+	}
+	pf.Stop()
+	return 0
+}
 
-	return nil
+// Draining 是否已停止接受新连接
+func (pf *PortForwarder) Draining() bool {
+	return pf.draining.Load()
 }
 
 // IsActive 检查是否处于活动状态
@@ -96,68 +231,159 @@ func (pf *PortForwarder) GetLocalAddr() string {
 	return ""
 }
 
+// Bytes 返回启动以来双向转发的总字节数（包括转发中的连接）
+func (pf *PortForwarder) Bytes() int64 {
+	pf.connsMu.Lock()
+	defer pf.connsMu.Unlock()
+	total := pf.closedBytes
+	for _, tc := range pf.conns {
+		total += tc.bytesIn.Load() + tc.bytesOut.Load()
+	}
+	return total
+}
+
+// Hops 返回转发经过的服务器，链路不是 *ssh.Chain 时返回 nil
+func (pf *PortForwarder) Hops() []*types.Hop {
+	if chain, ok := pf.chain.(interface{ Hops() []*types.Hop }); ok {
+		return chain.Hops()
+	}
+	return nil
+}
+
 // GetConnectionCount 获取当前连接数
 func (pf *PortForwarder) GetConnectionCount() int {
 	return int(pf.connCount.Load())
 }
 
 // acceptLoop 接受连接循环
-func (pf *PortForwarder) acceptLoop() {
-	defer pf.wg.Done()
-
+func (pf *PortForwarder) acceptLoop(ctx context.Context) {
 	for {
-		select {
-		case <-pf.ctx.Done():
-			return
-		default:
-		}
-
 		conn, err := pf.listener.Accept()
 		if err != nil {
-			if pf.ctx.Err() != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
 				return
 			}
 			continue
 		}
 
-		pf.wg.Add(1)
 		pf.connCount.Add(1)
-		go pf.handleConnection(conn)
+		started := pf.owner.Go(func(ctx context.Context) {
+			defer pf.connCount.Add(-1)
+			pf.handleConnection(ctx, conn)
+		})
+		if !started {
+			pf.connCount.Add(-1)
+			conn.Close()
+			return
+		}
 	}
 }
 
 // handleConnection 处理单个连接
-func (pf *PortForwarder) handleConnection(localConn net.Conn) {
-	defer pf.wg.Done()
-	defer pf.connCount.Add(-1)
+func (pf *PortForwarder) handleConnection(ctx context.Context, localConn net.Conn) {
 	defer localConn.Close()
 
-	// 通过 SSH 链建立到远程的连接
-	remoteAddr := fmt.Sprintf("%s:%d", pf.remoteHost, pf.remotePort)
-	remoteConn, err := pf.chain.Dial("tcp", remoteAddr)
+	// 通过 SSH 链建立到远程的连接：unix socket 由链路末端直接连接，
+	// 其他目标按映射的解析方式使用共用的解析缓存
+	remoteConn, unix, err := DialTarget(pf.chain.Dial, pf.remoteHost)
+	if !unix {
+		remoteConn, err = resolver.Default.DialContext(ctx, pf.scope, pf.remoteHost, pf.remotePort, pf.resolver, pf.chain.Dial)
+	}
 	if err != nil {
+		msg := err.Error()
+		pf.dialErr.Store(&msg)
 		return
 	}
-	defer remoteConn.Close()
+	pf.dialErr.Store(nil)
+
+	tc := &trackedConn{local: localConn, startedAt: time.Now()}
+	id := pf.nextID.Add(1)
+	pf.connsMu.Lock()
+	pf.conns[id] = tc
+	pf.connsMu.Unlock()
+	defer func() {
+		pf.connsMu.Lock()
+		delete(pf.conns, id)
+		pf.closedBytes += tc.bytesIn.Load() + tc.bytesOut.Load()
+		pf.connsMu.Unlock()
+	}()
+
+	Pipe(ctx, countingConn{localConn, &tc.bytesIn}, countingConn{remoteConn, &tc.bytesOut})
+}
+
+// Connections 列出转发中的连接，按编号排序
+func (pf *PortForwarder) Connections() []ConnInfo {
+	dest := TargetAddr(pf.remoteHost, pf.remotePort)
+	pf.connsMu.Lock()
+	list := make([]ConnInfo, 0, len(pf.conns))
+	for id, tc := range pf.conns {
+		list = append(list, ConnInfo{
+			ID:          id,
+			Source:      connSource(tc.local),
+			Destination: dest,
+			BytesIn:     tc.bytesIn.Load(),
+			BytesOut:    tc.bytesOut.Load(),
+			StartedAt:   tc.startedAt,
+		})
+	}
+	pf.connsMu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// connSource 连接的来源地址，unix socket 的对端通常没有地址，显示为本地 socket 路径
+func connSource(conn net.Conn) string {
+	if addr := conn.RemoteAddr(); addr != nil && addr.String() != "" {
+		return addr.String()
+	}
+	if addr := conn.LocalAddr(); addr != nil {
+		return addr.String()
+	}
+	return ""
+}
+
+// CloseConnection 断开一个转发中的连接，连接不存在时返回 false
+func (pf *PortForwarder) CloseConnection(id uint64) bool {
+	pf.connsMu.Lock()
+	tc, ok := pf.conns[id]
+	pf.connsMu.Unlock()
+	if ok {
+		tc.local.Close()
+	}
+	return ok
+}
+
+// Pipe 在两个连接之间双向转发，直到任一方向结束或 ctx 取消
+// 任一方向结束即关闭两端，避免另一方向的 io.Copy 永远阻塞；返回前两个 goroutine 都已退出
+func Pipe(ctx context.Context, a, b net.Conn) {
+	var once sync.Once
+	closeBoth := func() {
+		once.Do(func() {
+			a.Close()
+			b.Close()
+		})
+	}
+	stop := context.AfterFunc(ctx, closeBoth)
+	defer stop()
 
-	// 双向转发
 	var wg sync.WaitGroup
 	wg.Add(2)
-
 	go func() {
 		defer wg.Done()
-		io.Copy(remoteConn, localConn)
+		defer closeBoth()
+		io.Copy(b, a)
 	}()
-
 	go func() {
 		defer wg.Done()
-		io.Copy(localConn, remoteConn)
+		defer closeBoth()
+		io.Copy(a, b)
 	}()
-
-	// 等待任一方断开
 	wg.Wait()
 }
 
+// ErrNotFound 管理器中没有该转发
+var ErrNotFound = errors.New("not found")
+
 // ForwarderManager 管理多个端口转发
 type ForwarderManager struct {
 	forwarders map[string]*PortForwarder
@@ -171,39 +397,55 @@ func NewForwarderManager() *ForwarderManager {
 	}
 }
 
-// Add 添加转发
+// Add 接管转发器及其 SSH 链并启动（若尚未启动）
+// 之后由管理器负责生命周期：Remove 停止转发并断开链。失败时转发器和链都已释放
 func (fm *ForwarderManager) Add(id string, forwarder *PortForwarder) error {
+	forwarder.OnStop(forwarder.chain.Disconnect)
+
 	fm.mu.Lock()
 	defer fm.mu.Unlock()
 
 	if _, exists := fm.forwarders[id]; exists {
+		forwarder.Stop()
 		return fmt.Errorf("forwarder with id '%s' already exists", id)
 	}
 
-	if err := forwarder.Start(); err != nil {
-		return err
+	if !forwarder.IsActive() {
+		if err := forwarder.Start(); err != nil {
+			forwarder.Stop()
+			return err
+		}
 	}
 
 	fm.forwarders[id] = forwarder
 	return nil
 }
 
-// Remove 移除转发
+// Remove 移除转发：停止监听、关闭转发中的连接并断开 SSH 链
 func (fm *ForwarderManager) Remove(id string) error {
 	fm.mu.Lock()
-	defer fm.mu.Unlock()
-
 	forwarder, exists := fm.forwarders[id]
+	delete(fm.forwarders, id)
+	fm.mu.Unlock()
+
 	if !exists {
-		return fmt.Errorf("forwarder with id '%s' not found", id)
+		return fmt.Errorf("forwarder with id '%s' %w", id, ErrNotFound)
 	}
 
-	if err := forwarder.Stop(); err != nil {
-		return err
-	}
+	// 在锁外停止，等待连接退出期间不阻塞列表查询
+	return forwarder.Stop()
+}
 
-	delete(fm.forwarders, id)
-	return nil
+// StopAll 停止并移除所有转发
+func (fm *ForwarderManager) StopAll() {
+	fm.mu.Lock()
+	forwarders := fm.forwarders
+	fm.forwarders = make(map[string]*PortForwarder)
+	fm.mu.Unlock()
+
+	for _, forwarder := range forwarders {
+		forwarder.Stop()
+	}
 }
 
 // Get 获取转发器
@@ -234,16 +476,38 @@ type ForwarderInfo struct {
 	Active        bool      `json:"active"`
 	ConnectionCount int     `json:"connection_count"`
 	StartedAt     time.Time `json:"started_at"`
+	ChainConnected  bool    `json:"chain_connected"`
+	ChainHealthy    bool    `json:"chain_healthy"` // 链已连接且最近一次拨号成功
+	ChainError      string  `json:"chain_error,omitempty"`
+	Reconnecting    bool    `json:"reconnecting,omitempty"` // 链路断开，正在重连
+	Reconnects      int     `json:"reconnects,omitempty"`   // 启动以来链路重连成功的次数
+	Resolver        string  `json:"resolver,omitempty"` // remote 以外的解析方式
+	ExpiresAt       time.Time `json:"expires_at,omitzero"` // 限时转发的到期时间，由 API 层填写
 }
 
 // GetInfo 获取转发器信息
 func (pf *PortForwarder) GetInfo(id string) *ForwarderInfo {
-	return &ForwarderInfo{
+	info := &ForwarderInfo{
 		ID:              id,
 		LocalAddr:       pf.GetLocalAddr(),
 		RemoteHost:      pf.remoteHost,
 		RemotePort:      pf.remotePort,
 		Active:          pf.IsActive(),
 		ConnectionCount: pf.GetConnectionCount(),
+		StartedAt:       pf.startedAt,
+	}
+	if !pf.resolver.IsRemote() {
+		info.Resolver = pf.resolver.String()
+	}
+	if pf.active.Load() {
+		info.ChainConnected = pf.chain.IsConnected()
+		info.ChainHealthy = info.ChainConnected
+		if msg := pf.dialErr.Load(); msg != nil {
+			info.ChainHealthy = false
+			info.ChainError = *msg
+		}
+		info.Reconnecting = pf.reconnecting.Load()
+		info.Reconnects = int(pf.reconnects.Load())
 	}
+	return info
 }
@@ -0,0 +1,403 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForGoroutines 等待 goroutine 数量回落到 base 以下，超时则失败
+func waitForGoroutines(t *testing.T, base int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines leaked: have %d, want <= %d", runtime.NumGoroutine(), base)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPipeClosesBothSidesWhenOneEnds(t *testing.T) {
+	base := runtime.NumGoroutine()
+
+	local, localPeer := net.Pipe()
+	remote, remotePeer := net.Pipe()
+	defer localPeer.Close()
+	defer remotePeer.Close()
+
+	done := make(chan struct{})
+	go func() {
+		Pipe(context.Background(), local, remote)
+		close(done)
+	}()
+
+	// 数据双向可达
+	go localPeer.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(remotePeer, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("forwarded %q, %v", buf, err)
+	}
+
+	// 本地一侧断开，远端方向的 io.Copy 不能一直阻塞
+	localPeer.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Pipe did not return after one side closed")
+	}
+	if _, err := remotePeer.Read(buf); err == nil {
+		t.Error("remote side should be closed")
+	}
+	waitForGoroutines(t, base)
+}
+
+func TestPipeStopsOnCancel(t *testing.T) {
+	base := runtime.NumGoroutine()
+
+	local, localPeer := net.Pipe()
+	remote, remotePeer := net.Pipe()
+	defer localPeer.Close()
+	defer remotePeer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Pipe(ctx, local, remote)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Pipe did not return after cancel")
+	}
+	waitForGoroutines(t, base)
+}
+
+func TestStopWithoutStartRunsCleanup(t *testing.T) {
+	pf := NewPortForwarder(nil, "127.0.0.1:0", "127.0.0.1", 80)
+	disconnected := false
+	pf.OnStop(func() error {
+		disconnected = true
+		return nil
+	})
+	if err := pf.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if !disconnected {
+		t.Error("Stop should run registered cleanup")
+	}
+	if pf.IsActive() {
+		t.Error("stopped forwarder should not be active")
+	}
+}
+
+// fakeTunnel 用本地 TCP 代替 SSH 链
+type fakeTunnel struct {
+	connected    atomic.Bool
+	disconnected atomic.Int32
+	dialErr      error
+}
+
+func newFakeTunnel() *fakeTunnel {
+	ft := &fakeTunnel{}
+	ft.connected.Store(true)
+	return ft
+}
+
+func (ft *fakeTunnel) Dial(network, addr string) (net.Conn, error) {
+	if ft.dialErr != nil {
+		return nil, ft.dialErr
+	}
+	return net.Dial(network, addr)
+}
+
+func (ft *fakeTunnel) IsConnected() bool { return ft.connected.Load() }
+
+func (ft *fakeTunnel) Disconnect() error {
+	ft.connected.Store(false)
+	ft.disconnected.Add(1)
+	return nil
+}
+
+// startEchoServer 启动回显服务，返回其端口
+func startEchoServer(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func newTestForwarder(chain tunnel, remotePort int) *PortForwarder {
+	pf := NewPortForwarder(nil, "127.0.0.1:0", "127.0.0.1", remotePort)
+	pf.chain = chain
+	return pf
+}
+
+func TestManagerRemoveWhileActive(t *testing.T) {
+	echoPort := startEchoServer(t)
+	base := runtime.NumGoroutine()
+
+	chain := newFakeTunnel()
+	fm := NewForwarderManager()
+	pf := newTestForwarder(chain, echoPort)
+	if err := fm.Add("p1", pf); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", pf.GetLocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("hi"))
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hi" {
+		t.Fatalf("echo through forwarder = %q, %v", buf, err)
+	}
+
+	info := pf.GetInfo("p1")
+	if info.ConnectionCount != 1 || !info.ChainConnected || !info.ChainHealthy {
+		t.Errorf("unexpected info while active: %+v", info)
+	}
+
+	// 连接仍然打开时删除：必须及时返回、断开链路并关闭客户端连接
+	removed := make(chan error, 1)
+	go func() { removed <- fm.Remove("p1") }()
+	select {
+	case err := <-removed:
+		if err != nil {
+			t.Fatalf("Remove failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Remove blocked on an active connection")
+	}
+
+	if n := chain.disconnected.Load(); n != 1 {
+		t.Errorf("chain disconnected %d times, want 1", n)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(buf); err == nil {
+		t.Error("client connection should be closed")
+	}
+	if fm.Get("p1") != nil || pf.IsActive() {
+		t.Error("forwarder should be removed and inactive")
+	}
+	if err := fm.Remove("p1"); err == nil {
+		t.Error("second Remove should report not found")
+	}
+	conn.Close()
+	waitForGoroutines(t, base)
+}
+
+func TestManagerAddReleasesChainOnFailure(t *testing.T) {
+	fm := NewForwarderManager()
+	if err := fm.Add("p1", newTestForwarder(newFakeTunnel(), 1)); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	defer fm.StopAll()
+
+	tests := []struct {
+		name  string
+		id    string
+		chain *fakeTunnel
+	}{
+		{"duplicate id", "p1", newFakeTunnel()},
+		{"chain not connected", "p2", &fakeTunnel{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := fm.Add(tt.id, newTestForwarder(tt.chain, 1)); err == nil {
+				t.Fatal("expected Add to fail")
+			}
+			if tt.chain.disconnected.Load() != 1 {
+				t.Error("failed Add should disconnect the chain")
+			}
+		})
+	}
+}
+
+func TestChainHealthReflectsDialErrors(t *testing.T) {
+	chain := newFakeTunnel()
+	chain.dialErr = errors.New("administratively prohibited")
+	pf := newTestForwarder(chain, 1)
+	if err := pf.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pf.Stop()
+
+	conn, err := net.Dial("tcp", pf.GetLocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	conn.Read(make([]byte, 1)) // 拨号失败后转发器关闭连接
+	conn.Close()
+
+	info := pf.GetInfo("p1")
+	if !info.ChainConnected || info.ChainHealthy || info.ChainError == "" {
+		t.Errorf("dial failure should mark chain unhealthy: %+v", info)
+	}
+}
+
+func TestConnectionsAndClose(t *testing.T) {
+	echoPort := startEchoServer(t)
+	pf := newTestForwarder(newFakeTunnel(), echoPort)
+	if err := pf.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pf.Stop()
+
+	conn, err := net.Dial("tcp", pf.GetLocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	conns := pf.Connections()
+	if len(conns) != 1 {
+		t.Fatalf("Connections = %+v, want 1", conns)
+	}
+	c := conns[0]
+	if c.Source != conn.LocalAddr().String() || c.Destination != net.JoinHostPort("127.0.0.1", strconv.Itoa(echoPort)) {
+		t.Errorf("unexpected endpoints: %+v", c)
+	}
+	if c.BytesIn != 5 || c.BytesOut != 5 {
+		t.Errorf("bytes = %d/%d, want 5/5", c.BytesIn, c.BytesOut)
+	}
+
+	if pf.CloseConnection(c.ID + 1) {
+		t.Error("closing an unknown connection should fail")
+	}
+	if !pf.CloseConnection(c.ID) {
+		t.Fatal("CloseConnection failed")
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(buf); err == nil {
+		t.Error("client connection should be closed")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(pf.Connections()) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(pf.Connections()); n != 0 {
+		t.Errorf("%d connections left after close", n)
+	}
+	// 已结束的连接仍计入总流量
+	if n := pf.Bytes(); n != 10 {
+		t.Errorf("Bytes = %d after close, want 10", n)
+	}
+}
+
+func TestDrainHandsOffPort(t *testing.T) {
+	echoPort := startEchoServer(t)
+	chain := newFakeTunnel()
+	old := newTestForwarder(chain, echoPort)
+	old.OnStop(chain.Disconnect)
+	if err := old.Start(); err != nil {
+		t.Fatal(err)
+	}
+	addr := old.GetLocalAddr()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	echo := func(c net.Conn, msg string) error {
+		c.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := c.Write([]byte(msg)); err != nil {
+			return err
+		}
+		buf := make([]byte, len(msg))
+		_, err := io.ReadFull(c, buf)
+		return err
+	}
+	if err := echo(conn, "before"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 旧转发器停止接受后，新转发器立即可以监听同一地址，已有连接继续转发
+	drained := make(chan int, 1)
+	go func() { drained <- old.Drain(5 * time.Second) }()
+	waitFor := func(cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor(old.Draining)
+	next := NewPortForwarder(nil, addr, "127.0.0.1", echoPort)
+	next.chain = newFakeTunnel()
+	if err := next.Start(); err != nil {
+		t.Fatalf("new forwarder could not take over %s: %v", addr, err)
+	}
+	defer next.Stop()
+	if err := echo(conn, "during"); err != nil {
+		t.Errorf("existing connection broke during drain: %v", err)
+	}
+	fresh, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Close()
+	if err := echo(fresh, "new"); err != nil || next.GetConnectionCount() != 1 {
+		t.Errorf("new connection not served by the new forwarder: %v", err)
+	}
+
+	conn.Close()
+	select {
+	case cut := <-drained:
+		if cut != 0 {
+			t.Errorf("cut %d connections, want 0", cut)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Drain did not return after the last connection closed")
+	}
+	if old.IsActive() || chain.disconnected.Load() != 1 {
+		t.Error("drained forwarder should be stopped")
+	}
+
+	// 超时后断开剩余连接
+	stuck, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stuck.Close()
+	waitFor(func() bool { return next.GetConnectionCount() == 2 })
+	if cut := next.Drain(100 * time.Millisecond); cut != 2 {
+		t.Errorf("cut %d connections at timeout, want 2", cut)
+	}
+}
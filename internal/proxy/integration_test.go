@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/sshtest"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestForwarderOverChain(t *testing.T) {
+	// 远端服务：按行回显
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	echoPort := echo.Addr().(*net.TCPAddr).Port
+
+	bastion := sshtest.NewServer(t, sshtest.Options{})
+	target := sshtest.NewServer(t, sshtest.Options{})
+	chain := ssh.NewChain([]*types.Hop{bastion.Hop("bastion"), target.Hop("target")})
+	if err := chain.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Disconnect()
+
+	forwarder := NewPortForwarder(chain, "127.0.0.1:0", "127.0.0.1", echoPort)
+	if err := forwarder.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer forwarder.Stop()
+
+	conn, err := net.DialTimeout("tcp", forwarder.GetLocalAddr(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Fatalf("echo = %q, %v", line, err)
+	}
+	if forwards := target.Forwards(); !slices.Contains(forwards, net.JoinHostPort("127.0.0.1", strconv.Itoa(echoPort))) {
+		t.Errorf("target forwards = %v", forwards)
+	}
+	conn.Close()
+
+	// 关闭连接后计入转发字节数
+	deadline := time.Now().Add(2 * time.Second)
+	for forwarder.GetConnectionCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := forwarder.Bytes(); got != 10 {
+		t.Errorf("Bytes = %d, want 10", got)
+	}
+}
+
+func TestForwarderResumesAfterChainReconnect(t *testing.T) {
+	echoPort := startEchoServer(t)
+	bastion := sshtest.NewServer(t, sshtest.Options{})
+	target := sshtest.NewServer(t, sshtest.Options{})
+	chain := ssh.NewChain([]*types.Hop{bastion.Hop("bastion"), target.Hop("target")})
+	if err := chain.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Disconnect()
+
+	forwarder := NewPortForwarder(chain, "127.0.0.1:0", "127.0.0.1", echoPort)
+	if err := forwarder.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer forwarder.Stop()
+	restored := make(chan struct{}, 1)
+	chain.Subscribe(func(event ssh.ChainEvent) {
+		if event.Kind == ssh.ChainRestored {
+			restored <- struct{}{}
+		}
+	})
+	chain.Supervise(t.Context(), ssh.ReconnectPolicy{InitialDelay: 50 * time.Millisecond, Multiplier: 2})
+
+	// 跳板断开后监听器保持打开，重连后新的连接照常转发
+	bastion.DropConnections()
+	select {
+	case <-restored:
+	case <-time.After(10 * time.Second):
+		t.Fatal("chain not restored")
+	}
+	if info := forwarder.GetInfo("p1"); info.Reconnects != 1 || info.Reconnecting || !info.ChainHealthy {
+		t.Errorf("info after reconnect = %+v", info)
+	}
+
+	conn, err := net.DialTimeout("tcp", forwarder.GetLocalAddr(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("again\n"))
+	if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || line != "again\n" {
+		t.Errorf("echo after reconnect = %q, %v", line, err)
+	}
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unixPrefix 可选的 unix socket 地址前缀，如 unix:/var/run/app.sock
+const unixPrefix = "unix:"
+
+// staleProbeTimeout 判断已有 socket 文件是否仍有进程监听的拨号时限
+const staleProbeTimeout = 500 * time.Millisecond
+
+// ErrSocketInUse 监听的 unix socket 仍有进程在使用
+var ErrSocketInUse = errors.New("socket is in use")
+
+// UnixSocketPath 地址是否为 unix socket：绝对路径或 unix: 前缀的路径，返回 socket 路径
+func UnixSocketPath(addr string) (string, bool) {
+	path := strings.TrimPrefix(addr, unixPrefix)
+	if !strings.HasPrefix(path, "/") {
+		return "", false
+	}
+	return filepath.Clean(path), true
+}
+
+// IsUnixSocket 地址是否为 unix socket 路径
+func IsUnixSocket(addr string) bool {
+	_, ok := UnixSocketPath(addr)
+	return ok
+}
+
+// TargetAddr 转发目标的显示地址：unix socket 为路径，否则为 host:port
+func TargetAddr(host string, port int) string {
+	if path, ok := UnixSocketPath(host); ok {
+		return path
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// CheckTarget 校验转发目标：unix socket 路径忽略端口，其他主机需要 1-65535 的端口
+func CheckTarget(host string, port int) error {
+	if host == "" {
+		return fmt.Errorf("remote_host is required")
+	}
+	if IsUnixSocket(host) {
+		return nil
+	}
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("remote_port must be between 1 and 65535")
+	}
+	return nil
+}
+
+// DialTarget 经 dial 连接 unix socket 目标；host 不是 unix socket 时返回 ok=false，由调用方按 TCP 解析拨号
+func DialTarget(dial func(network, addr string) (net.Conn, error), host string) (conn net.Conn, ok bool, err error) {
+	path, ok := UnixSocketPath(host)
+	if !ok {
+		return nil, false, nil
+	}
+	conn, err = dial("unix", path)
+	return conn, true, err
+}
+
+// Listen 监听 TCP 地址或 unix socket 路径。unix socket 的父目录不存在时创建；
+// 路径上残留的 socket 文件（没有进程监听）先删除，关闭监听器时删除 socket 文件
+func Listen(addr string) (net.Listener, error) {
+	path, ok := UnixSocketPath(addr)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+// removeStaleSocket 删除没有进程监听的 socket 文件；路径不是 socket 或仍在使用时返回错误
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, staleProbeTimeout); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s: %w", path, ErrSocketInUse)
+	}
+	return os.Remove(path)
+}
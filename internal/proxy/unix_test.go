@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixSocketForward(t *testing.T) {
+	dir := t.TempDir()
+
+	// 远端 unix socket 上的回显服务
+	remotePath := filepath.Join(dir, "remote.sock")
+	remote, err := net.Listen("unix", remotePath)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer remote.Close()
+	go func() {
+		for {
+			conn, err := remote.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	// 上次异常退出留下的 socket 文件应被清理
+	localPath := filepath.Join(dir, "local.sock")
+	stale, err := net.Listen("unix", localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	pf := NewPortForwarder(nil, "unix:"+localPath, remotePath, 0)
+	pf.chain = newFakeTunnel()
+	if err := pf.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if pf.GetLocalAddr() != localPath {
+		t.Errorf("local addr = %q, want %q", pf.GetLocalAddr(), localPath)
+	}
+
+	conn, err := net.Dial("unix", localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("forwarded %q, %v", buf, err)
+	}
+	if conns := pf.Connections(); len(conns) != 1 || conns[0].Destination != remotePath || conns[0].Source == "" {
+		t.Errorf("Connections = %+v", conns)
+	}
+	conn.Close()
+
+	// 正在监听的 socket 不能被第二个转发器抢走
+	if _, err := Listen(localPath); !errors.Is(err, ErrSocketInUse) {
+		t.Errorf("Listen on a live socket: %v, want ErrSocketInUse", err)
+	}
+
+	pf.Stop()
+	if _, err := os.Stat(localPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("socket file left after Stop: %v", err)
+	}
+}
+
+func TestListenRefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(path); err == nil {
+		t.Error("Listen should not replace a regular file")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("regular file removed: %v", err)
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	tests := []struct {
+		host string
+		port int
+		ok   bool
+	}{
+		{"db", 5432, true},
+		{"db", 0, false},
+		{"db", 70000, false},
+		{"", 22, false},
+		{"/var/run/postgresql/.s.PGSQL.5432", 0, true},
+		{"unix:/run/app.sock", 0, true},
+		{"run/app.sock", 0, false},
+	}
+	for _, tt := range tests {
+		if err := CheckTarget(tt.host, tt.port); (err == nil) != tt.ok {
+			t.Errorf("CheckTarget(%q, %d) = %v, want ok=%v", tt.host, tt.port, err, tt.ok)
+		}
+	}
+}
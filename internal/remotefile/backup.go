@@ -0,0 +1,98 @@
+package remotefile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/terminal"
+)
+
+// backupSuffix 备份文件名为 <name>.bak-<backupTimeFormat>，按名称排序即按时间排序
+const (
+	backupSuffix     = ".bak-"
+	backupTimeFormat = "20060102T150405.000Z"
+)
+
+// Backup 远端文件的一个旧版本
+type Backup struct {
+	Path string    `json:"path"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+}
+
+// BackupName 返回 path 在 t 时刻的备份路径
+func BackupName(path string, t time.Time) string {
+	return path + backupSuffix + t.UTC().Format(backupTimeFormat)
+}
+
+// BackupTime 解析 path 的备份文件 backup 的时间；backup 不是 path 的备份时返回 false
+func BackupTime(path, backup string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(backup, path+backupSuffix)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(backupTimeFormat, stamp)
+	return t, err == nil
+}
+
+// backupScript 把 "$f" 复制为 "$b" 并只保留最新的 keep 个备份（keep <= 0 时不清理）；"$f" 不是普通文件时什么也不做。
+// 用 cp -p 而不是 mv，被覆盖的文件保持原来的 inode、权限和属主
+func backupScript(keep int) string {
+	script := `if [ -f "$f" ]; then cp -p "$f" "$b" || exit 1`
+	if keep > 0 {
+		script += fmt.Sprintf(`; for x in "$f"%s[0-9]*; do [ -f "$x" ] && printf '%%s\n' "$x"; done | sort -r | tail -n +%d | while IFS= read -r x; do rm -f "$x"; done`,
+			backupSuffix, keep+1)
+	}
+	return script + "; fi"
+}
+
+// BackupCommand 上传覆盖 path 前执行：文件存在时复制为 backup，然后只保留最新的 keep 个备份
+func BackupCommand(path, backup string, keep int) string {
+	return "f=" + terminal.ShellQuote(path) + "; b=" + terminal.ShellQuote(backup) + "; " + backupScript(keep)
+}
+
+// BackupCommandVar 与 BackupCommand 相同，但被覆盖的文件由 shell 变量 "$f" 给出，用于只有在远端才能确定路径的场合
+func BackupCommandVar(t time.Time, keep int) string {
+	return `b="$f"` + terminal.ShellQuote(backupSuffix+t.UTC().Format(backupTimeFormat)) + "; " + backupScript(keep)
+}
+
+// ListBackupsCommand 每行输出 path 的一个备份：<大小>\t<路径>
+func ListBackupsCommand(path string) string {
+	return "f=" + terminal.ShellQuote(path) +
+		`; for x in "$f"` + backupSuffix + `[0-9]*; do [ -f "$x" ] && printf '%s\t%s\n' "$(wc -c < "$x" | tr -d ' ')" "$x"; done; exit 0`
+}
+
+// ParseBackups 解析 ListBackupsCommand 的输出，按时间从新到旧排列
+func ParseBackups(path string, out []byte) []Backup {
+	backups := []Backup{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		sizeText, file, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		t, ok := BackupTime(path, file)
+		size, err := strconv.ParseInt(sizeText, 10, 64)
+		if !ok || err != nil {
+			continue
+		}
+		backups = append(backups, Backup{Path: file, Time: t, Size: size})
+	}
+	slices.SortFunc(backups, func(a, b Backup) int { return b.Time.Compare(a.Time) })
+	return backups
+}
+
+// RestoreCommand 用备份 from 替换 path：先复制到同目录的临时文件，再把当前文件备份为 backup
+// （保留 keep 个，keep <= 0 时不清理），最后 rename 替换。from 不存在时以 ErrNotFound 对应的退出码失败
+func RestoreCommand(path, from, backup string, keep int) string {
+	return "set -e; f=" + terminal.ShellQuote(path) + "; from=" + terminal.ShellQuote(from) + "; b=" + terminal.ShellQuote(backup) +
+		`; [ -f "$from" ] || exit ` + strconv.Itoa(notFoundStatus) +
+		`; tmp=$(mktemp "$(dirname "$f")/.hssh-restore.XXXXXX"); trap 'rm -f "$tmp"' EXIT; cp -p "$from" "$tmp"` +
+		"; " + backupScript(keep) +
+		`; mv -f "$tmp" "$f"`
+}
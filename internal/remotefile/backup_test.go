@@ -0,0 +1,98 @@
+package remotefile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app's.conf")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	list := func() []Backup {
+		t.Helper()
+		out, err := run(t, ListBackupsCommand(path), nil)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		return ParseBackups(path, out)
+	}
+
+	// 文件不存在时不备份
+	start := time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC)
+	if _, err := run(t, BackupCommand(path, BackupName(path, start), 2), nil); err != nil {
+		t.Fatalf("backup of missing file: %v", err)
+	}
+	if got := list(); len(got) != 0 {
+		t.Fatalf("backups of a missing file: %+v", got)
+	}
+
+	// 只保留最新的 2 个
+	for i, content := range []string{"v1", "v2", "v3"} {
+		write(content)
+		if _, err := run(t, BackupCommand(path, BackupName(path, start.Add(time.Duration(i)*time.Minute)), 2), nil); err != nil {
+			t.Fatalf("backup %s: %v", content, err)
+		}
+	}
+	write("v4")
+	if err := os.WriteFile(path+".bak-notes", []byte("not a backup"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	backups := list()
+	if len(backups) != 2 || read(backups[0].Path) != "v3" || read(backups[1].Path) != "v2" {
+		t.Fatalf("backups = %+v", backups)
+	}
+	if !backups[0].Time.Equal(start.Add(2*time.Minute)) || backups[0].Size != 2 {
+		t.Errorf("newest backup = %+v", backups[0])
+	}
+	if info, _ := os.Stat(backups[0].Path); info.Mode().Perm() != 0600 {
+		t.Errorf("backup mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// 恢复最旧的备份：当前内容先被备份，最旧的备份随后被清理也不影响恢复
+	if _, err := run(t, RestoreCommand(path, backups[1].Path, BackupName(path, start.Add(time.Hour)), 2), nil); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if got := read(path); got != "v2" {
+		t.Errorf("restored content = %q", got)
+	}
+	backups = list()
+	if len(backups) != 2 || read(backups[0].Path) != "v4" || read(backups[1].Path) != "v3" {
+		t.Errorf("backups after restore = %+v", backups)
+	}
+	if _, err := run(t, RestoreCommand(path, path+".bak-20000101T000000.000Z", BackupName(path, start), 2), nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("restore of a missing backup: %v", err)
+	}
+}
+
+func TestBackupTime(t *testing.T) {
+	at := time.Date(2026, 10, 17, 8, 30, 15, 250e6, time.UTC)
+	name := BackupName("/etc/app.conf", at)
+	if name != "/etc/app.conf.bak-20261017T083015.250Z" {
+		t.Errorf("BackupName = %q", name)
+	}
+	if got, ok := BackupTime("/etc/app.conf", name); !ok || !got.Equal(at) {
+		t.Errorf("BackupTime = %v, %v", got, ok)
+	}
+	for _, other := range []string{"/etc/other.conf.bak-20261017T083015.250Z", "/etc/app.conf.bak-latest", "/etc/app.conf"} {
+		if _, ok := BackupTime("/etc/app.conf", other); ok {
+			t.Errorf("BackupTime accepted %q", other)
+		}
+	}
+}
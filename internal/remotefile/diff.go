@@ -0,0 +1,215 @@
+package remotefile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext unified diff 中每处修改前后保留的行数
+const diffContext = 3
+
+// maxDiffDistance Myers 算法放弃前允许的最大编辑距离；超过时把首尾相同部分之间的内容整体视为删除再添加
+const maxDiffDistance = 1000
+
+type diffOp byte
+
+const (
+	opEqual diffOp = iota
+	opDelete
+	opInsert
+)
+
+type diffLine struct {
+	op   diffOp
+	text string // 含行尾换行符
+}
+
+// Unified 返回 old 到 new 的 unified diff（与 diff -u 格式相同），内容相同时返回空字符串
+func Unified(oldName, newName string, old, new []byte) string {
+	lines := diffLines(splitLines(old), splitLines(new))
+	var out strings.Builder
+	for i := 0; i < len(lines); {
+		if lines[i].op == opEqual {
+			i++
+			continue
+		}
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		// 相隔不超过 2*diffContext 行相同内容的修改合并为一个 hunk
+		end := i
+		for end < len(lines) {
+			if lines[end].op != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].op == opEqual {
+				run++
+			}
+			if run == len(lines) || run-end > 2*diffContext {
+				break
+			}
+			end = run
+		}
+		start := max(i-diffContext, 0)
+		stop := min(end+diffContext, len(lines))
+		writeHunk(&out, lines, start, stop)
+		i = stop
+	}
+	return out.String()
+}
+
+// writeHunk 输出 lines[start:stop] 组成的 hunk
+func writeHunk(out *strings.Builder, lines []diffLine, start, stop int) {
+	oldLine, newLine := 1, 1
+	for _, l := range lines[:start] {
+		if l.op != opInsert {
+			oldLine++
+		}
+		if l.op != opDelete {
+			newLine++
+		}
+	}
+	var oldCount, newCount int
+	for _, l := range lines[start:stop] {
+		if l.op != opInsert {
+			oldCount++
+		}
+		if l.op != opDelete {
+			newCount++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+	for _, l := range lines[start:stop] {
+		out.WriteByte(" -+"[l.op])
+		out.WriteString(l.text)
+		if !strings.HasSuffix(l.text, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange hunk 头中的行范围；空范围的起始行为其前一行
+func hunkRange(line, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", line-1)
+	case 1:
+		return fmt.Sprintf("%d", line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// splitLines 按行切分，每行保留换行符，最后一行可能没有
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines 返回把 a 变成 b 的逐行编辑序列
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b)-prefix-suffix)
+	for _, text := range a[:prefix] {
+		lines = append(lines, diffLine{opEqual, text})
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if mid, ok := myers(midA, midB, maxDiffDistance); ok {
+		lines = append(lines, mid...)
+	} else {
+		for _, text := range midA {
+			lines = append(lines, diffLine{opDelete, text})
+		}
+		for _, text := range midB {
+			lines = append(lines, diffLine{opInsert, text})
+		}
+	}
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{opEqual, text})
+	}
+	return lines
+}
+
+// myers 用 Myers 算法求最短编辑序列；编辑距离超过 maxD 时返回 false。
+// 每一步只保存 k ∈ [-d-1, d+1] 的 V，内存为 O(maxD²)
+func myers(a, b []string, maxD int) ([]diffLine, bool) {
+	n, m := len(a), len(b)
+	maxD = min(maxD, n+m)
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// backtrack 从终点沿 trace 倒推出编辑序列
+func backtrack(trace [][]int, a, b []string) []diffLine {
+	var reversed []diffLine
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d] // 第 d 步之前的 V，下标 k+d+1
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[k-1+d+1] < v[k+1+d+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+d+1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, diffLine{opEqual, a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				reversed = append(reversed, diffLine{opInsert, b[y]})
+			} else {
+				x--
+				reversed = append(reversed, diffLine{opDelete, a[x]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	lines := make([]diffLine, len(reversed))
+	for i, l := range reversed {
+		lines[len(reversed)-1-i] = l
+	}
+	return lines
+}
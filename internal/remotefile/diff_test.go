@@ -0,0 +1,107 @@
+package remotefile
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nm\nn"
+	want := `--- a/app.conf
++++ b/app.conf
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -9,5 +9,5 @@
+ i
+ j
+ k
+-l
+ m
++n
+\ No newline at end of file
+`
+	if got := Unified("a/app.conf", "b/app.conf", []byte(old), []byte(new)); got != want {
+		t.Errorf("Unified =\n%s\nwant\n%s", got, want)
+	}
+	if got := Unified("a", "b", []byte(old), []byte(old)); got != "" {
+		t.Errorf("identical files: %q", got)
+	}
+	if got := Unified("a", "b", nil, []byte("x\n")); got != "--- a\n+++ b\n@@ -0,0 +1 @@\n+x\n" {
+		t.Errorf("new file: %q", got)
+	}
+}
+
+// TestUnifiedApplies 随机修改后，按 diff 从旧内容重建出的新内容应与原文一致
+func TestUnifiedApplies(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"x\n", "y\n", "z\n", "w\n"}
+	for round := 0; round < 200; round++ {
+		var a []string
+		for i := rng.Intn(40); i > 0; i-- {
+			a = append(a, words[rng.Intn(len(words))])
+		}
+		b := append([]string(nil), a...)
+		for i := rng.Intn(6); i > 0; i-- {
+			pos := rng.Intn(len(b) + 1)
+			if rng.Intn(2) == 0 && pos < len(b) {
+				b = append(b[:pos], b[pos+1:]...)
+			} else {
+				b = append(b[:pos], append([]string{words[rng.Intn(len(words))]}, b[pos:]...)...)
+			}
+		}
+		oldText, newText := strings.Join(a, ""), strings.Join(b, "")
+		if got := applyDiff(t, oldText, Unified("a", "b", []byte(oldText), []byte(newText))); got != newText {
+			t.Fatalf("round %d: patched %q, want %q", round, got, newText)
+		}
+	}
+}
+
+// applyDiff 按 hunk 中的上下文和删除行核对旧内容，输出新内容
+func applyDiff(t *testing.T, old, diff string) string {
+	t.Helper()
+	oldLines := splitLines([]byte(old))
+	var out strings.Builder
+	pos := 0
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		switch {
+		case line == "", strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+		case strings.HasPrefix(line, "@@"):
+			var start int
+			rest := strings.TrimPrefix(line, "@@ -")
+			for _, c := range rest {
+				if c < '0' || c > '9' {
+					break
+				}
+				start = start*10 + int(c-'0')
+			}
+			if !strings.HasPrefix(rest[len(strings.TrimLeft(rest, "0123456789")):], ",0") {
+				start--
+			}
+			for pos < start {
+				out.WriteString(oldLines[pos])
+				pos++
+			}
+		case line[0] == ' ' || line[0] == '-':
+			if oldLines[pos] != line[1:] {
+				t.Fatalf("context mismatch at line %d: %q vs %q", pos+1, oldLines[pos], line[1:])
+			}
+			if line[0] == ' ' {
+				out.WriteString(line[1:])
+			}
+			pos++
+		case line[0] == '+':
+			out.WriteString(line[1:])
+		}
+	}
+	for ; pos < len(oldLines); pos++ {
+		out.WriteString(oldLines[pos])
+	}
+	return out.String()
+}
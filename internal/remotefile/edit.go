@@ -0,0 +1,90 @@
+// Package remotefile 生成读取、原子写回和备份远端文件的命令，供网页内编辑和上传覆盖前使用
+package remotefile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/luobobo896/HSSH/internal/terminal"
+)
+
+// MaxEditSize 可在线编辑的文件大小上限
+const MaxEditSize = 1 << 20
+
+var (
+	// ErrNotFound 文件不存在
+	ErrNotFound = errors.New("file does not exist")
+	// ErrNotRegular 路径存在但不是普通文件
+	ErrNotRegular = errors.New("not a regular file")
+	// ErrTooLarge 文件超过 MaxEditSize
+	ErrTooLarge = errors.New("file is too large to edit")
+	// ErrBinary 内容不是 UTF-8 文本
+	ErrBinary = errors.New("file is not UTF-8 text")
+	// ErrConflict 读取后文件已被修改（或新建时文件已存在）
+	ErrConflict = errors.New("file was changed since it was read")
+)
+
+// ReadCommand、WriteCommand 的退出码，由 Failed 识别
+const (
+	notFoundStatus   = 3
+	notRegularStatus = 4
+	tooLargeStatus   = 5
+	conflictStatus   = 6
+)
+
+// hashScript 选择可用的 sha256 命令（GNU sha256sum 或 BSD shasum）
+const hashScript = "if command -v sha256sum >/dev/null 2>&1; then h=sha256sum; else h='shasum -a 256'; fi"
+
+// Checksum 内容的 sha256，读取时返回给客户端，写回时用于乐观锁
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckText 只允许编辑不含 NUL 的 UTF-8 文本
+func CheckText(data []byte) error {
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return ErrBinary
+	}
+	return nil
+}
+
+// ReadCommand 输出文件内容；文件不存在、不是普通文件或超过 maxSize 字节时以对应的退出码失败
+func ReadCommand(path string, maxSize int64) string {
+	return fmt.Sprintf(`f=%s; [ -e "$f" ] || exit %d; [ -f "$f" ] || exit %d; [ "$(wc -c < "$f" | tr -d ' ')" -le %d ] || exit %d; cat "$f"`,
+		terminal.ShellQuote(path), notFoundStatus, notRegularStatus, maxSize, tooLargeStatus)
+}
+
+// WriteCommand 把 stdin 写入同目录的临时文件，再在文件的 sha256 仍为 checksum 时 rename 替换它。
+// checksum 为空表示新建，文件已存在时冲突。符号链接写到其指向的文件；已有文件的权限和属主用 cp -p 保留
+func WriteCommand(path, checksum string) string {
+	return "set -e; f=" + terminal.ShellQuote(path) + "; want=" + terminal.ShellQuote(checksum) +
+		`; if [ -L "$f" ]; then f=$(readlink -f "$f"); fi` +
+		`; [ ! -e "$f" ] || [ -f "$f" ] || exit ` + strconv.Itoa(notRegularStatus) +
+		`; tmp=$(mktemp "$(dirname "$f")/.hssh-edit.XXXXXX"); trap 'rm -f "$tmp"' EXIT` +
+		`; if [ -e "$f" ]; then cp -p "$f" "$tmp" 2>/dev/null || true; else chmod 644 "$tmp"; fi` +
+		`; cat > "$tmp"; ` + hashScript +
+		`; cur=; if [ -e "$f" ]; then cur=$($h < "$f" | cut -c1-64); fi` +
+		`; [ "$cur" = "$want" ] || exit ` + strconv.Itoa(conflictStatus) +
+		`; mv -f "$tmp" "$f"`
+}
+
+// Failed 返回 ReadCommand、WriteCommand 以 status 退出时的错误，未知的退出码返回 err
+func Failed(status int, err error) error {
+	switch status {
+	case notFoundStatus:
+		return ErrNotFound
+	case notRegularStatus:
+		return ErrNotRegular
+	case tooLargeStatus:
+		return ErrTooLarge
+	case conflictStatus:
+		return ErrConflict
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package remotefile
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// run 在本机 sh 中执行命令，返回输出和 Failed 识别后的错误
+func run(t *testing.T, cmd string, stdin []byte) ([]byte, error) {
+	t.Helper()
+	c := exec.Command("sh", "-c", cmd)
+	c.Stdin = bytes.NewReader(stdin)
+	out, err := c.Output()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		err = Failed(exit.ExitCode(), err)
+	}
+	return out, err
+}
+
+func TestReadWrite(t *testing.T) {
+	for _, tool := range []string{"sh", "mktemp", "readlink", "cut"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+	if _, err := exec.LookPath("sha256sum"); err != nil {
+		if _, err := exec.LookPath("shasum"); err != nil {
+			t.Skip("no sha256 tool")
+		}
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "it's nginx.conf")
+	original := []byte("worker_processes 1;\n")
+	if err := os.WriteFile(path, original, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := run(t, ReadCommand(path, MaxEditSize), nil)
+	if err != nil || !bytes.Equal(out, original) {
+		t.Fatalf("read = %q, %v", out, err)
+	}
+	if _, err := run(t, ReadCommand(path, 5), nil); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("read over limit: %v", err)
+	}
+	if _, err := run(t, ReadCommand(filepath.Join(dir, "missing"), MaxEditSize), nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("read missing: %v", err)
+	}
+	if _, err := run(t, ReadCommand(dir, MaxEditSize), nil); !errors.Is(err, ErrNotRegular) {
+		t.Errorf("read dir: %v", err)
+	}
+
+	// 校验和不符时不写入
+	updated := []byte("worker_processes 4;\n")
+	if _, err := run(t, WriteCommand(path, Checksum([]byte("stale"))), updated); !errors.Is(err, ErrConflict) {
+		t.Errorf("stale write: %v", err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, original) {
+		t.Errorf("stale write changed the file: %q", got)
+	}
+
+	// 经符号链接写入，保留权限，不留下临时文件
+	link := filepath.Join(dir, "current.conf")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(t, WriteCommand(link, Checksum(original)), updated); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, updated) {
+		t.Errorf("file = %q", got)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink replaced: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".hssh-edit.") {
+			t.Errorf("temporary file left behind: %s", e.Name())
+		}
+	}
+
+	// 空校验和只能新建
+	created := filepath.Join(dir, "new.conf")
+	if _, err := run(t, WriteCommand(created, ""), []byte("x")); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := run(t, WriteCommand(created, ""), []byte("y")); !errors.Is(err, ErrConflict) {
+		t.Errorf("create over existing file: %v", err)
+	}
+}
+
+func TestCheckText(t *testing.T) {
+	for in, want := range map[string]error{
+		"plain\n":       nil,
+		"中文配置":          nil,
+		"nul\x00inside": ErrBinary,
+		"\xff\xfe":      ErrBinary,
+	} {
+		if got := CheckText([]byte(in)); got != want {
+			t.Errorf("CheckText(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
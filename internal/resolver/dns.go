@@ -0,0 +1,152 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// queryTimeout 一次 DNS 查询（A 和 AAAA）的超时
+const queryTimeout = 5 * time.Second
+
+// queryServer 用 TCP 向 server 查询 host 的 A 和 AAAA 记录，dial 为 nil 时在本机直接连接。
+// 返回的 TTL 为所有记录中最小的一个；没有记录时按 SOA 的否定缓存时间返回错误
+func queryServer(ctx context.Context, server, host string, dial DialFunc) ([]net.IPAddr, time.Duration, error) {
+	name, err := dnsmessage.NewName(dnsName(host))
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid host name %q: %w", host, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	var conn net.Conn
+	if dial != nil {
+		conn, err = dial("tcp", server)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", server)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to connect to DNS server %s: %w", server, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var (
+		addrs   []net.IPAddr
+		ttl     time.Duration = -1
+		lastErr error
+	)
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		found, recordTTL, err := exchange(conn, name, qtype)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, 0, ctx.Err()
+			}
+			lastErr = err
+		}
+		addrs = append(addrs, found...)
+		if recordTTL >= 0 && (ttl < 0 || recordTTL < ttl) {
+			ttl = recordTTL
+		}
+	}
+	if len(addrs) == 0 {
+		if lastErr == nil {
+			lastErr = &net.DNSError{Err: "no such host", Name: host, Server: server, IsNotFound: true}
+		}
+		return nil, ttl, lastErr
+	}
+	return addrs, ttl, nil
+}
+
+// exchange 在 TCP 连接上发送一个查询并读取应答（RFC 1035 4.2.2：两字节长度前缀）。
+// 有记录时 ttl 为其中最小的 TTL；NXDOMAIN 或没有记录时为 SOA 的否定缓存时间，没有 SOA 时为 -1
+func exchange(conn net.Conn, name dnsmessage.Name, qtype dnsmessage.Type) ([]net.IPAddr, time.Duration, error) {
+	id := uint16(rand.Uint32())
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.AppendPack(make([]byte, 2, 514))
+	if err != nil {
+		return nil, -1, err
+	}
+	binary.BigEndian.PutUint16(packed, uint16(len(packed)-2))
+	if _, err := conn.Write(packed); err != nil {
+		return nil, -1, err
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, -1, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, -1, err
+	}
+	var reply dnsmessage.Message
+	if err := reply.Unpack(buf); err != nil {
+		return nil, -1, fmt.Errorf("invalid DNS reply: %w", err)
+	}
+	if reply.ID != id {
+		return nil, -1, fmt.Errorf("DNS reply id mismatch")
+	}
+
+	host := name.String()
+	switch reply.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, negativeTTL(reply), &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	default:
+		return nil, -1, &net.DNSError{Err: "server replied " + reply.RCode.String(), Name: host, IsTemporary: true}
+	}
+
+	var addrs []net.IPAddr
+	ttl := time.Duration(-1)
+	for _, answer := range reply.Answers {
+		var ip net.IP
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			ip = net.IP(body.A[:])
+		case *dnsmessage.AAAAResource:
+			ip = net.IP(body.AAAA[:])
+		default:
+			continue // CNAME 等，服务器递归查询时已给出最终地址
+		}
+		addrs = append(addrs, net.IPAddr{IP: ip})
+		if t := time.Duration(answer.Header.TTL) * time.Second; ttl < 0 || t < ttl {
+			ttl = t
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, negativeTTL(reply), nil
+	}
+	return addrs, ttl, nil
+}
+
+// negativeTTL RFC 2308：否定应答的缓存时间为 SOA 的 TTL 与 MINIMUM 中较小者，没有 SOA 时为 -1
+func negativeTTL(reply dnsmessage.Message) time.Duration {
+	for _, auth := range reply.Authorities {
+		if soa, ok := auth.Body.(*dnsmessage.SOAResource); ok {
+			return time.Duration(min(auth.Header.TTL, soa.MinTTL)) * time.Second
+		}
+	}
+	return -1
+}
+
+// dnsName 转为以点结尾的完全限定名
+func dnsName(host string) string {
+	if len(host) > 0 && host[len(host)-1] == '.' {
+		return host
+	}
+	return host + "."
+}
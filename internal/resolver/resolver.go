@@ -0,0 +1,332 @@
+// Package resolver 转发目标的域名解析缓存：代理、Portal 和 SSH 链共用一个 Cache，
+// 按记录 TTL 过期，解析失败也缓存一段时间（负缓存）。每个映射可以选择解析方式：
+// 交给隧道末端解析（remote）、本机系统解析（system），或经隧道查询指定的 DNS 服务器（dns:<addr>）
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 解析方式
+const (
+	KindRemote = "remote" // 不在本地解析，主机名原样交给隧道末端（sshd、Portal 服务端）解析
+	KindSystem = "system" // 本机系统解析器，拿不到 TTL，缓存 Options.TTL
+	KindDNS    = "dns"    // 经隧道用 TCP 查询指定的 DNS 服务器，缓存遵循记录的 TTL
+)
+
+// 默认值
+const (
+	DefaultTTL         = time.Minute      // 系统解析结果的缓存时间
+	DefaultNegativeTTL = 10 * time.Second // 解析失败的缓存时间
+	DefaultMaxTTL      = time.Hour        // DNS 记录 TTL 的上限
+	// minTTL DNS 记录 TTL 的下限，避免 TTL 为 0 的记录每个连接都重新查询
+	minTTL = time.Second
+)
+
+// ErrInvalidMode 解析方式格式不正确
+var ErrInvalidMode = errors.New("invalid resolver")
+
+// Mode 一个映射的解析方式，零值等同于 remote
+type Mode struct {
+	Kind   string
+	Server string // dns 方式的 DNS 服务器 host:port
+}
+
+// ParseMode 解析 "remote"、"system" 或 "dns:<host>[:port]"，空字符串为 remote，端口默认 53
+func ParseMode(s string) (Mode, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "", KindRemote:
+		return Mode{Kind: KindRemote}, nil
+	case KindSystem:
+		return Mode{Kind: KindSystem}, nil
+	}
+	server, ok := strings.CutPrefix(s, KindDNS+":")
+	if !ok || server == "" {
+		return Mode{}, fmt.Errorf("%w %q (use remote, system or dns:<server>)", ErrInvalidMode, s)
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+	}
+	return Mode{Kind: KindDNS, Server: server}, nil
+}
+
+// IsRemote 是否交给隧道末端解析
+func (m Mode) IsRemote() bool {
+	return m.Kind == "" || m.Kind == KindRemote
+}
+
+func (m Mode) String() string {
+	switch {
+	case m.IsRemote():
+		return KindRemote
+	case m.Kind == KindDNS:
+		return KindDNS + ":" + m.Server
+	}
+	return m.Kind
+}
+
+// DialFunc 连接 DNS 服务器用的拨号函数，一般是 SSH 链的 Dial；为 nil 时在本机直接连接
+type DialFunc func(network, addr string) (net.Conn, error)
+
+// Options 缓存时间设置，零值使用默认值
+type Options struct {
+	TTL         time.Duration // 系统解析结果的缓存时间
+	NegativeTTL time.Duration // 解析失败的缓存时间
+	MaxTTL      time.Duration // DNS 记录 TTL 的上限
+}
+
+func (o Options) withDefaults() Options {
+	if o.TTL <= 0 {
+		o.TTL = DefaultTTL
+	}
+	if o.NegativeTTL <= 0 {
+		o.NegativeTTL = DefaultNegativeTTL
+	}
+	if o.MaxTTL <= 0 {
+		o.MaxTTL = DefaultMaxTTL
+	}
+	return o
+}
+
+// Entry 一条缓存记录
+type Entry struct {
+	Scope     string    `json:"scope,omitempty"` // 经隧道查询时为链路标识
+	Host      string    `json:"host"`
+	Resolver  string    `json:"resolver"`
+	Addrs     []string  `json:"addrs,omitempty"`
+	Error     string    `json:"error,omitempty"` // 负缓存的错误
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Stats 缓存统计
+type Stats struct {
+	Entries int    `json:"entries"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+// entry 缓存的解析结果；done 关闭前为进行中的查询，同一主机的并发查询只发一次
+type entry struct {
+	addrs   []net.IPAddr
+	err     error
+	expires time.Time
+	done    chan struct{}
+}
+
+// Cache 解析结果缓存，可并发使用
+type Cache struct {
+	mu      sync.Mutex
+	opts    Options
+	entries map[string]*entry
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+
+	// lookupSystem 系统解析（测试中替换）
+	lookupSystem func(ctx context.Context, host string) ([]net.IPAddr, error)
+	now          func() time.Time
+}
+
+// Default 进程内共用的缓存
+var Default = New(Options{})
+
+// New 创建缓存
+func New(opts Options) *Cache {
+	return &Cache{
+		opts:         opts.withDefaults(),
+		entries:      make(map[string]*entry),
+		lookupSystem: net.DefaultResolver.LookupIPAddr,
+		now:          time.Now,
+	}
+}
+
+// Configure 修改缓存时间，已缓存的记录保留到原来的过期时间
+func (c *Cache) Configure(opts Options) {
+	c.mu.Lock()
+	c.opts = opts.withDefaults()
+	c.mu.Unlock()
+}
+
+// cacheKey 缓存键：scope 区分经不同链路查询的结果
+func cacheKey(scope, host string, mode Mode) string {
+	return scope + "\x00" + mode.String() + "\x00" + strings.ToLower(host)
+}
+
+// Lookup 按 mode 解析 host，结果未过期时直接返回缓存。host 是 IP 时原样返回；
+// remote 方式不解析，返回 nil。scope 标识经过的链路，同一主机经不同链路查询的结果分开缓存
+func (c *Cache) Lookup(ctx context.Context, scope, host string, mode Mode, dial DialFunc) ([]net.IPAddr, error) {
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return []net.IPAddr{{IP: ip}}, nil
+	}
+	if mode.IsRemote() {
+		return nil, nil
+	}
+
+	key := cacheKey(scope, host, mode)
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok {
+		select {
+		case <-e.done:
+			if c.now().Before(e.expires) {
+				c.mu.Unlock()
+				c.hits.Add(1)
+				return e.addrs, e.err
+			}
+			ok = false
+		default:
+		}
+	}
+	if ok {
+		// 同一主机的查询正在进行，等它的结果
+		c.mu.Unlock()
+		c.hits.Add(1)
+		select {
+		case <-e.done:
+			return e.addrs, e.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	e = &entry{done: make(chan struct{})}
+	c.entries[key] = e
+	opts := c.opts
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	addrs, ttl, err := c.resolve(ctx, host, mode, dial, opts)
+	if err != nil && ctx.Err() != nil {
+		// 调用方取消的查询不缓存
+		c.mu.Lock()
+		if c.entries[key] == e {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+		e.err = err
+		close(e.done)
+		return nil, err
+	}
+	switch {
+	case err != nil && ttl > 0:
+		// SOA 给出的否定缓存时间比设置短时按 SOA
+		ttl = min(ttl, opts.NegativeTTL)
+	case err != nil:
+		ttl = opts.NegativeTTL
+	case mode.Kind == KindDNS:
+		ttl = min(max(ttl, minTTL), opts.MaxTTL)
+	}
+	e.addrs, e.err, e.expires = addrs, err, c.now().Add(ttl)
+	close(e.done)
+	return addrs, err
+}
+
+// resolve 实际查询，返回地址和记录的 TTL（未知时为 -1）
+func (c *Cache) resolve(ctx context.Context, host string, mode Mode, dial DialFunc, opts Options) ([]net.IPAddr, time.Duration, error) {
+	switch mode.Kind {
+	case KindSystem:
+		addrs, err := c.lookupSystem(ctx, host)
+		if err == nil && len(addrs) == 0 {
+			err = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		return addrs, opts.TTL, err
+	case KindDNS:
+		return queryServer(ctx, mode.Server, host, dial)
+	}
+	return nil, 0, fmt.Errorf("%w %q", ErrInvalidMode, mode.Kind)
+}
+
+// DialContext 按 mode 解析 host 后经 dial 连接 host:port，依次尝试解析出的地址；
+// remote 方式把主机名原样交给 dial
+func (c *Cache) DialContext(ctx context.Context, scope, host string, port int, mode Mode, dial DialFunc) (net.Conn, error) {
+	portStr := fmt.Sprintf("%d", port)
+	addrs, err := c.Lookup(ctx, scope, host, mode, dial)
+	if err != nil {
+		return nil, err
+	}
+	if addrs == nil {
+		return dial("tcp", net.JoinHostPort(host, portStr))
+	}
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := dial("tcp", net.JoinHostPort(addr.IP.String(), portStr))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// Flush 清除缓存，host 为空时清除全部，返回清除的记录数
+func (c *Cache) Flush(host string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if host == "" {
+		n := len(c.entries)
+		c.entries = make(map[string]*entry)
+		return n
+	}
+	host = strings.ToLower(host)
+	n := 0
+	for key := range c.entries {
+		if key[strings.LastIndexByte(key, 0)+1:] == host {
+			delete(c.entries, key)
+			n++
+		}
+	}
+	return n
+}
+
+// Entries 列出未过期的缓存记录，按主机排序
+func (c *Cache) Entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	var list []Entry
+	for key, e := range c.entries {
+		select {
+		case <-e.done:
+		default:
+			continue
+		}
+		if !now.Before(e.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		parts := strings.SplitN(key, "\x00", 3)
+		item := Entry{Scope: parts[0], Resolver: parts[1], Host: parts[2], ExpiresAt: e.expires}
+		for _, addr := range e.addrs {
+			item.Addrs = append(item.Addrs, addr.IP.String())
+		}
+		if e.err != nil {
+			item.Error = e.err.Error()
+		}
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Host != list[j].Host {
+			return list[i].Host < list[j].Host
+		}
+		return list[i].Scope+list[i].Resolver < list[j].Scope+list[j].Resolver
+	})
+	return list
+}
+
+// Stats 返回缓存统计
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	n := len(c.entries)
+	c.mu.Unlock()
+	return Stats{Entries: n, Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
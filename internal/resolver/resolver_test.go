@@ -0,0 +1,239 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", "remote", false},
+		{"remote", "remote", false},
+		{"system", "system", false},
+		{"dns:10.0.0.2", "dns:10.0.0.2:53", false},
+		{"dns:10.0.0.2:5353", "dns:10.0.0.2:5353", false},
+		{"dns:[fd00::2]", "dns:[fd00::2]:53", false},
+		{"dns:", "", true},
+		{"local", "", true},
+	}
+	for _, tt := range tests {
+		mode, err := ParseMode(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMode(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && mode.String() != tt.want {
+			t.Errorf("ParseMode(%q) = %q, want %q", tt.in, mode.String(), tt.want)
+		}
+	}
+}
+
+func TestCacheSystem(t *testing.T) {
+	c := New(Options{TTL: time.Minute, NegativeTTL: 5 * time.Second})
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+	var lookups atomic.Int32
+	c.lookupSystem = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		lookups.Add(1)
+		if host == "missing.example" {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		return []net.IPAddr{{IP: net.IPv4(10, 0, 0, 1)}}, nil
+	}
+	system := Mode{Kind: KindSystem}
+	lookup := func(host string) error {
+		_, err := c.Lookup(context.Background(), "", host, system, nil)
+		return err
+	}
+
+	for range 3 {
+		if err := lookup("db.example"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := lookups.Load(); n != 1 {
+		t.Fatalf("lookups = %d, want 1 (cached)", n)
+	}
+	now = now.Add(time.Minute)
+	lookup("db.example")
+	if n := lookups.Load(); n != 2 {
+		t.Fatalf("lookups = %d after TTL, want 2", n)
+	}
+
+	// 负缓存：失败在 NegativeTTL 内不重复查询
+	lookup("missing.example")
+	if err := lookup("missing.example"); err == nil {
+		t.Fatal("expected cached error")
+	}
+	if n := lookups.Load(); n != 3 {
+		t.Fatalf("lookups = %d, want 3 (negative cached)", n)
+	}
+	now = now.Add(5 * time.Second)
+	lookup("missing.example")
+	if n := lookups.Load(); n != 4 {
+		t.Fatalf("lookups = %d after negative TTL, want 4", n)
+	}
+
+	// IP 和 remote 不查询
+	if addrs, _ := c.Lookup(context.Background(), "", "192.0.2.1", system, nil); len(addrs) != 1 {
+		t.Errorf("IP lookup = %v", addrs)
+	}
+	if addrs, _ := c.Lookup(context.Background(), "", "db.example", Mode{}, nil); addrs != nil {
+		t.Errorf("remote lookup = %v, want nil", addrs)
+	}
+
+	if n := c.Flush("DB.example"); n != 1 {
+		t.Errorf("Flush = %d, want 1", n)
+	}
+	if entries := c.Entries(); len(entries) != 1 || entries[0].Host != "missing.example" || entries[0].Error == "" {
+		t.Errorf("Entries = %+v", entries)
+	}
+	if stats := c.Stats(); stats.Misses != 4 || stats.Hits != 3 {
+		t.Errorf("Stats = %+v", stats)
+	}
+}
+
+// fakeDNS 一个只处理 TCP 的 DNS 服务器：records 中的主机返回 A 记录，其他主机返回带 SOA 的 NXDOMAIN
+func fakeDNS(t *testing.T, records map[string]uint32, queries *atomic.Int32) DialFunc {
+	t.Helper()
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		for {
+			var length [2]byte
+			if _, err := io.ReadFull(conn, length[:]); err != nil {
+				return
+			}
+			buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf); err != nil {
+				return
+			}
+			queries.Add(1)
+			q := query.Questions[0]
+			reply := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true},
+				Questions: query.Questions,
+			}
+			ttl, ok := records[q.Name.String()]
+			switch {
+			case !ok:
+				reply.RCode = dnsmessage.RCodeNameError
+				reply.Authorities = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("example."), Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: 3600},
+					Body:   &dnsmessage.SOAResource{NS: dnsmessage.MustNewName("ns.example."), MBox: dnsmessage.MustNewName("admin.example."), MinTTL: 2},
+				}}
+			case q.Type == dnsmessage.TypeA:
+				reply.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+					Body:   &dnsmessage.AResource{A: [4]byte{10, 1, 2, 3}},
+				}}
+			}
+			packed, _ := reply.AppendPack(make([]byte, 2, 512))
+			binary.BigEndian.PutUint16(packed, uint16(len(packed)-2))
+			conn.Write(packed)
+		}
+	}
+	return func(network, addr string) (net.Conn, error) {
+		if addr != "10.0.0.53:53" {
+			return nil, errors.New("unexpected DNS server " + addr)
+		}
+		client, server := net.Pipe()
+		go serve(server)
+		return client, nil
+	}
+}
+
+func TestCacheDNSServer(t *testing.T) {
+	var queries atomic.Int32
+	dial := fakeDNS(t, map[string]uint32{"app.internal.": 30}, &queries)
+	c := New(Options{NegativeTTL: time.Minute})
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+	mode, _ := ParseMode("dns:10.0.0.53")
+
+	addrs, err := c.Lookup(context.Background(), "chain-a", "app.internal", mode, dial)
+	if err != nil || len(addrs) != 1 || !addrs[0].IP.Equal(net.IPv4(10, 1, 2, 3)) {
+		t.Fatalf("Lookup = %v, %v", addrs, err)
+	}
+	if n := queries.Load(); n != 2 {
+		t.Fatalf("queries = %d, want 2 (A and AAAA)", n)
+	}
+	// 记录 TTL 为 30s
+	now = now.Add(29 * time.Second)
+	c.Lookup(context.Background(), "chain-a", "app.internal", mode, dial)
+	if n := queries.Load(); n != 2 {
+		t.Fatalf("queries = %d within TTL, want 2", n)
+	}
+	// 不同链路分开缓存
+	c.Lookup(context.Background(), "chain-b", "app.internal", mode, dial)
+	if n := queries.Load(); n != 4 {
+		t.Fatalf("queries = %d for another scope, want 4", n)
+	}
+	now = now.Add(time.Second)
+	c.Lookup(context.Background(), "chain-a", "app.internal", mode, dial)
+	if n := queries.Load(); n != 6 {
+		t.Fatalf("queries = %d after TTL, want 6", n)
+	}
+
+	// NXDOMAIN 按 SOA MINIMUM（2s）缓存
+	var dnsErr *net.DNSError
+	if _, err := c.Lookup(context.Background(), "chain-a", "gone.internal", mode, dial); !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Fatalf("Lookup(gone) error = %v, want not found", err)
+	}
+	c.Lookup(context.Background(), "chain-a", "gone.internal", mode, dial)
+	if n := queries.Load(); n != 8 {
+		t.Fatalf("queries = %d, want 8 (negative cached)", n)
+	}
+	now = now.Add(2 * time.Second)
+	c.Lookup(context.Background(), "chain-a", "gone.internal", mode, dial)
+	if n := queries.Load(); n != 10 {
+		t.Fatalf("queries = %d after SOA minimum, want 10", n)
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	c := New(Options{})
+	c.lookupSystem = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("fd00::1")}, {IP: net.IPv4(10, 0, 0, 1)}}, nil
+	}
+	var dialed []string
+	dial := func(network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		if addr == "10.0.0.1:80" {
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		}
+		return nil, errors.New("unreachable")
+	}
+
+	conn, err := c.DialContext(context.Background(), "", "web.example", 80, Mode{Kind: KindSystem}, dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if len(dialed) != 2 || dialed[0] != "[fd00::1]:80" {
+		t.Errorf("dialed = %v, want both addresses in order", dialed)
+	}
+
+	dialed = nil
+	c.DialContext(context.Background(), "", "web.example", 80, Mode{}, dial)
+	if len(dialed) != 1 || dialed[0] != "web.example:80" {
+		t.Errorf("remote mode dialed = %v, want the host name", dialed)
+	}
+}
@@ -0,0 +1,297 @@
+// Package search 在服务器、Portal 端口映射、传输记录和审计日志中做全文搜索，按相关度排序并给出各类型的匹配数，
+// 用于回答"上周 report.xlsx 传到哪里去了"这类问题。传输记录来自审计日志中的 upload.* 和 fetch_dir.* 事件
+package search
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// 结果类型
+const (
+	TypeServer   = "server"
+	TypeMapping  = "mapping"
+	TypeTransfer = "transfer"
+	TypeAudit    = "audit"
+)
+
+// Types 全部结果类型
+var Types = []string{TypeServer, TypeMapping, TypeTransfer, TypeAudit}
+
+const (
+	// DefaultLimit 未指定 limit 时返回的结果数
+	DefaultLimit = 50
+	// MaxLimit limit 的上限
+	MaxLimit = 500
+)
+
+// Result 一条搜索结果
+type Result struct {
+	Type   string    `json:"type"`
+	ID     string    `json:"id,omitempty"` // 服务器或映射 ID、任务 ID
+	Title  string    `json:"title"`
+	Detail string    `json:"detail,omitempty"`
+	User   string    `json:"user,omitempty"` // 传输和审计记录的操作者
+	Time   time.Time `json:"time,omitzero"`  // 传输和审计记录的时间
+	Score  int       `json:"score"`
+}
+
+// Response 搜索结果
+type Response struct {
+	Query string `json:"query"`
+	// Total 符合类型过滤的匹配数，Results 最多 Limit 条
+	Total int `json:"total"`
+	// Facets 各类型的匹配数，不受类型过滤影响，用于切换类型
+	Facets  map[string]int `json:"facets"`
+	Results []Result       `json:"results"`
+}
+
+// Options 搜索选项
+type Options struct {
+	Types []string  // 只返回这些类型，为空时返回全部类型
+	Since time.Time // 只搜索该时间之后的传输和审计记录，零值不限
+	Limit int       // 最多返回的结果数，默认 DefaultLimit
+	// User 非空时只搜索该用户的传输和审计记录（非管理员只能看到自己的记录）
+	User string
+}
+
+// Source 被搜索的数据
+type Source struct {
+	Config    *types.Config
+	AuditPath string // 审计日志路径，为空时不搜索传输和审计记录
+}
+
+// ValidType 是否为已知的结果类型
+func ValidType(t string) bool {
+	return slices.Contains(Types, t)
+}
+
+// field 参与匹配的一个字段，weight 越大命中时得分越高
+type field struct {
+	text   string
+	weight int
+}
+
+// 字段权重
+const (
+	weightName    = 10 // 名称
+	weightKey     = 6  // 地址、ID、文件名等
+	weightLabel   = 4  // 标签、环境、负责人、操作
+	weightContext = 2  // 说明、错误等其他文字
+)
+
+// Search 在 src 中搜索 q：q 中以空格分隔的每个词都须（不区分大小写）出现在某个字段中。
+// 词与字段或字段中的某一段（按空白、/、:、@、, 等切分）完全相同时得分最高，前缀其次，包含最低；
+// 结果按得分、时间（新的在前）和标题排序
+func Search(src Source, q string, opts Options) (*Response, error) {
+	words := strings.Fields(strings.ToLower(q))
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	for _, t := range opts.Types {
+		if !ValidType(t) {
+			return nil, fmt.Errorf("unknown type %q", t)
+		}
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+
+	resp := &Response{Query: q, Facets: make(map[string]int, len(Types)), Results: []Result{}}
+	for _, t := range Types {
+		resp.Facets[t] = 0
+	}
+	var matched []Result
+	add := func(r Result, fields []field) {
+		r.Score = score(words, fields)
+		if r.Score == 0 {
+			return
+		}
+		resp.Facets[r.Type]++
+		if len(opts.Types) == 0 || slices.Contains(opts.Types, r.Type) {
+			matched = append(matched, r)
+		}
+	}
+
+	cfg := src.Config
+	names := make(map[string]string, len(cfg.Hops)) // hop ID -> 名称
+	for _, hop := range cfg.Hops {
+		names[hop.ID] = hop.Name
+		add(serverResult(hop), serverFields(hop))
+	}
+	for _, m := range cfg.Portal.Client.Mappings {
+		r, fields := mappingResult(m, names)
+		add(r, fields)
+	}
+	if src.AuditPath != "" {
+		err := audit.Scan(src.AuditPath, func(event audit.Event) bool {
+			if event.Time.Before(opts.Since) || (opts.User != "" && event.User != opts.User) {
+				return true
+			}
+			r, fields := auditResult(event, names)
+			add(r, fields)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	slices.SortStableFunc(matched, func(a, b Result) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		if c := b.Time.Compare(a.Time); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Title, b.Title)
+	})
+	resp.Total = len(matched)
+	resp.Results = append(resp.Results, matched[:min(limit, len(matched))]...)
+	return resp, nil
+}
+
+func serverResult(hop *types.Hop) Result {
+	detail := fmt.Sprintf("%s@%s:%d", hop.User, hop.Host, hop.Port)
+	if hop.Environment != "" {
+		detail += " [" + hop.Environment + "]"
+	}
+	if hop.Notes != nil && hop.Notes.Description != "" {
+		detail += " " + hop.Notes.Description
+	}
+	return Result{Type: TypeServer, ID: hop.ID, Title: hop.Name, Detail: detail}
+}
+
+func serverFields(hop *types.Hop) []field {
+	fields := []field{
+		{hop.Name, weightName},
+		{hop.Host, weightKey},
+		{hop.ID, weightKey},
+		{hop.User, weightContext},
+		{hop.Environment, weightLabel},
+	}
+	for _, tag := range hop.Tags {
+		fields = append(fields, field{tag, weightLabel})
+	}
+	if n := hop.Notes; n != nil {
+		fields = append(fields,
+			field{n.Owner, weightLabel},
+			field{n.Location, weightLabel},
+			field{n.Description, weightContext},
+			field{n.Contact, weightContext},
+			field{n.Runbook, weightContext},
+		)
+		for key, value := range n.Fields {
+			fields = append(fields, field{key, weightContext}, field{value, weightLabel})
+		}
+	}
+	return fields
+}
+
+func mappingResult(m types.PortMapping, names map[string]string) (Result, []field) {
+	via := make([]string, len(m.Via))
+	for i, id := range m.Via {
+		via[i] = cmp.Or(names[id], id)
+	}
+	detail := fmt.Sprintf("%s -> %s:%d", m.LocalAddr, m.RemoteHost, m.RemotePort)
+	if len(via) > 0 {
+		detail += " via " + strings.Join(via, ", ")
+	}
+	fields := []field{
+		{m.Name, weightName},
+		{m.ID, weightKey},
+		{m.LocalAddr, weightKey},
+		{m.RemoteHost, weightKey},
+		{fmt.Sprint(m.RemotePort), weightLabel},
+	}
+	for _, name := range via {
+		fields = append(fields, field{name, weightLabel})
+	}
+	return Result{Type: TypeMapping, ID: m.ID, Title: m.Name, Detail: detail}, fields
+}
+
+// auditResult upload.* 和 fetch_dir.* 事件作为传输记录，标题为文件和目标；其他事件标题为操作
+func auditResult(event audit.Event, names map[string]string) (Result, []field) {
+	target := event.Target
+	if name, ok := names[target]; ok {
+		target = name
+	}
+	fields := []field{
+		{event.Action, weightLabel},
+		{event.Target, weightKey},
+		{target, weightKey},
+		{event.User, weightLabel},
+		{event.RequestID, weightKey},
+		{event.Detail, weightKey},
+		{event.Error, weightContext},
+	}
+	r := Result{Type: TypeAudit, Title: event.Action, User: event.User, Time: event.Time}
+	if strings.HasPrefix(event.Action, "upload.") || strings.HasPrefix(event.Action, "fetch_dir.") {
+		r.Type = TypeTransfer
+		r.Title = cmp.Or(event.Detail, target)
+		r.Detail = event.Action
+		// 上传的 target 是任务 ID，打包下载的 target 是 "服务器:路径"
+		if strings.HasPrefix(event.Action, "upload.") {
+			r.ID = event.Target
+		}
+	} else {
+		r.ID = event.Target
+		r.Detail = strings.TrimSpace(target + " " + event.Detail)
+	}
+	if event.Error != "" {
+		r.Detail += ": " + event.Error
+	}
+	return r, fields
+}
+
+// score 每个词在各字段中的最高得分之和；有词未命中任何字段时为 0
+func score(words []string, fields []field) int {
+	total := 0
+	for _, word := range words {
+		best := 0
+		for _, f := range fields {
+			if f.text == "" {
+				continue
+			}
+			best = max(best, matchScore(word, strings.ToLower(f.text))*f.weight)
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+	return total
+}
+
+// matchScore 完全相同 3，前缀 2，包含 1，不包含 0；与字段中的某一段比较同样适用
+func matchScore(word, text string) int {
+	if !strings.Contains(text, word) {
+		return 0
+	}
+	best := 1
+	for _, segment := range append(segments(text), text) {
+		switch {
+		case segment == word:
+			return 3
+		case strings.HasPrefix(segment, word):
+			best = 2
+		}
+	}
+	return best
+}
+
+// segments 按空白和常见分隔符切分，保留文件名中的 . - _
+func segments(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune("/\\:@,;=()[]<>", r)
+	})
+}
@@ -0,0 +1,95 @@
+package search
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/audit"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func testSource(t *testing.T) Source {
+	t.Helper()
+	cfg := &types.Config{
+		Hops: []*types.Hop{
+			{ID: "hop-db", Name: "db", Host: "10.0.0.5", Port: 22, User: "root", Tags: []string{"mysql"}},
+			{ID: "hop-dbbackup", Name: "db-backup", Host: "10.0.0.6", Port: 22, User: "root", Notes: &types.HopNotes{Owner: "alice"}},
+		},
+	}
+	cfg.Portal.Client.Mappings = []types.PortMapping{
+		{ID: "map-1", Name: "mysql-tunnel", LocalAddr: ":3306", RemoteHost: "10.0.0.5", RemotePort: 3306, Via: []string{"hop-db"}},
+	}
+
+	path := filepath.Join(t.TempDir(), audit.FileName)
+	logger, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	now := time.Now()
+	for _, event := range []audit.Event{
+		{Time: now.AddDate(0, 0, -30), User: "bob", Action: "upload.completed", Target: "task-old", Detail: "report.xlsx -> db:/srv/old"},
+		{Time: now.AddDate(0, 0, -2), User: "alice", Action: "upload.completed", Target: "task-new", Detail: "report.xlsx -> db-backup:/srv/reports"},
+		{Time: now.Add(-time.Hour), User: "alice", Action: "ssh.legacy_crypto", Target: "hop-db", Detail: "negotiated hmac-sha1"},
+	} {
+		if err := logger.Record(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return Source{Config: cfg, AuditPath: path}
+}
+
+func TestSearch(t *testing.T) {
+	src := testSource(t)
+
+	resp, err := Search(src, "DB", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 名称完全相同的服务器排在前缀匹配之前
+	if len(resp.Results) == 0 || resp.Results[0].Title != "db" || resp.Results[1].Title != "db-backup" {
+		t.Fatalf("ranking: got %+v", resp.Results)
+	}
+	// 审计记录中的服务器 ID 按名称匹配
+	if resp.Facets[TypeServer] != 2 || resp.Facets[TypeTransfer] != 2 || resp.Facets[TypeAudit] != 1 || resp.Facets[TypeMapping] != 1 {
+		t.Errorf("facets: got %v", resp.Facets)
+	}
+
+	// 传输记录按文件名查找，新的在前
+	resp, err = Search(src, "report.xlsx", Options{Types: []string{TypeTransfer}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 2 || resp.Results[0].ID != "task-new" || resp.Results[0].Title != "report.xlsx -> db-backup:/srv/reports" {
+		t.Errorf("transfers: got %+v", resp.Results)
+	}
+	if resp.Facets[TypeServer] != 0 {
+		t.Errorf("facets should count every type: got %v", resp.Facets)
+	}
+
+	// 时间和用户过滤只作用于传输和审计记录
+	resp, err = Search(src, "report", Options{Since: time.Now().AddDate(0, 0, -7), User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 1 || resp.Results[0].ID != "task-new" {
+		t.Errorf("since and user: got %+v", resp.Results)
+	}
+
+	// 每个词都须匹配
+	resp, err = Search(src, "db alice", Options{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 3 || len(resp.Results) != 1 || resp.Results[0].Title != "db-backup" {
+		t.Errorf("all words and limit: got total %d, %+v", resp.Total, resp.Results)
+	}
+
+	if _, err := Search(src, "  ", Options{}); err == nil {
+		t.Error("empty query should fail")
+	}
+	if _, err := Search(src, "db", Options{Types: []string{"host"}}); err == nil {
+		t.Error("unknown type should fail")
+	}
+}
@@ -0,0 +1,62 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentConn 到本机 ssh-agent 的共享连接：各跳认证时复用，出错后下次使用时重连（如 agent 重启）
+var agentConn struct {
+	mu     sync.Mutex
+	sock   string
+	conn   net.Conn
+	client agent.ExtendedAgent
+}
+
+// agentAuth 使用 SSH_AUTH_SOCK 指向的 ssh-agent 中的密钥认证，包括硬件密钥（签名由 agent 完成，私钥不离开 agent）。
+// 密钥在认证时才读取，所以 agent 中后来加入的密钥同样可用
+func agentAuth() (ssh.AuthMethod, error) {
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		return nil, fmt.Errorf("agent authentication requires a running ssh-agent (SSH_AUTH_SOCK is not set)")
+	}
+	return ssh.PublicKeysCallback(agentSigners), nil
+}
+
+// agentSigners 返回 agent 中的全部密钥，连接失效时重连一次
+func agentSigners() ([]ssh.Signer, error) {
+	agentConn.mu.Lock()
+	defer agentConn.mu.Unlock()
+
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if agentConn.client != nil && agentConn.sock == sock {
+		if signers, err := agentConn.client.Signers(); err == nil && len(signers) > 0 {
+			return signers, nil
+		}
+	}
+	if agentConn.conn != nil {
+		agentConn.conn.Close()
+		agentConn.conn, agentConn.client = nil, nil
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ssh-agent at %s: %w", sock, err)
+	}
+	client := agent.NewClient(conn)
+	signers, err := client.Signers()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+	if len(signers) == 0 {
+		conn.Close()
+		return nil, fmt.Errorf("ssh-agent at %s has no keys (add one with ssh-add)", sock)
+	}
+	agentConn.sock, agentConn.conn, agentConn.client = sock, conn, client
+	return signers, nil
+}
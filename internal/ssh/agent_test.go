@@ -0,0 +1,150 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/sshtest"
+	"github.com/luobobo896/HSSH/pkg/types"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// serveAgent 在临时 unix socket 上提供 keyring，并把 SSH_AUTH_SOCK 指向它
+func serveAgent(t *testing.T, keyring agent.Agent) {
+	t.Helper()
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+}
+
+func TestAgentAuth(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bastion := sshtest.NewServer(t, sshtest.Options{AuthorizedKey: signer.PublicKey()})
+	target := sshtest.NewServer(t, sshtest.Options{AuthorizedKey: signer.PublicKey()})
+	agentHop := func(server *sshtest.Server, name string) *types.Hop {
+		hop := server.Hop(name)
+		hop.AuthType = types.AuthAgent
+		hop.Password = ""
+		return hop
+	}
+	hops := []*types.Hop{agentHop(bastion, "bastion"), agentHop(target, "target")}
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	if _, err := NewClient(hops[0]); err == nil || !strings.Contains(err.Error(), "SSH_AUTH_SOCK") {
+		t.Errorf("expected SSH_AUTH_SOCK error, got %v", err)
+	}
+
+	keyring := agent.NewKeyring()
+	serveAgent(t, keyring)
+	if err := NewChain(hops).Connect(); err == nil || !strings.Contains(err.Error(), "no keys") {
+		t.Errorf("expected empty agent error, got %v", err)
+	}
+
+	// 每一跳都由 agent 中的密钥认证，配置中没有密钥文件或密码
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+	chain := NewChain(hops)
+	if err := chain.Connect(); err != nil {
+		t.Fatalf("Connect with agent: %v", err)
+	}
+	chain.Disconnect()
+}
+
+func TestForwardAgent(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key, Comment: "laptop"}); err != nil {
+		t.Fatal(err)
+	}
+	serveAgent(t, keyring)
+
+	uses := make(chan AgentForwardUse, 4)
+	OnAgentForward(func(use AgentForwardUse) { uses <- use })
+	defer OnAgentForward(nil)
+
+	server := sshtest.NewServer(t, sshtest.Options{})
+	chain := NewChain([]*types.Hop{server.Hop("target")})
+	if err := chain.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Disconnect()
+
+	// 没有请求转发的连接上远端打不开 agent 通道
+	if _, err := server.OpenAgentChannel(); err == nil {
+		t.Fatal("agent channel opened without a forwarding request")
+	}
+
+	session, err := chain.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	stop, err := chain.ForwardAgent(session, "alice")
+	if err != nil {
+		t.Fatalf("ForwardAgent: %v", err)
+	}
+
+	// 远端经转发的通道看到本机 agent 中的密钥
+	ch, err := server.OpenAgentChannel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ch.Close()
+	keys, err := agent.NewClient(ch).List()
+	if err != nil || len(keys) != 1 || keys[0].Comment != "laptop" {
+		t.Fatalf("forwarded agent keys = %v, %v", keys, err)
+	}
+	if use := <-uses; use.Hop.Name != "target" || use.User != "alice" || use.Err != nil {
+		t.Errorf("agent use = %+v", use)
+	}
+
+	// agent 不可用时通道被拒绝，同样通知回调
+	t.Setenv("SSH_AUTH_SOCK", filepath.Join(t.TempDir(), "missing.sock"))
+	if _, err := server.OpenAgentChannel(); err == nil {
+		t.Error("agent channel accepted without a local agent")
+	}
+	if use := <-uses; use.Err == nil {
+		t.Errorf("refused agent use = %+v, want an error", use)
+	}
+
+	// 转发的会话结束后，连接上的远端不能再使用本机 agent
+	stop()
+	if _, err := server.OpenAgentChannel(); err == nil {
+		t.Error("agent channel accepted after forwarding stopped")
+	}
+	if use := <-uses; use.Err != errAgentNotForwarded || use.User != "" {
+		t.Errorf("agent use after stop = %+v, want %v", use, errAgentNotForwarded)
+	}
+}
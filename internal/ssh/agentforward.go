@@ -0,0 +1,160 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync/atomic"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentChannelType 远端进程访问转发的 ssh-agent 时打开的通道
+const agentChannelType = "auth-agent@openssh.com"
+
+// ErrNoAgent 本机没有可转发的 ssh-agent
+var ErrNoAgent = errors.New("agent forwarding requires a running ssh-agent (SSH_AUTH_SOCK is not set)")
+
+// errAgentNotForwarded 连接上已没有正在转发 ssh-agent 的会话
+var errAgentNotForwarded = errors.New("no session on this connection is forwarding the ssh-agent")
+
+// AgentForwardUse 远端经转发通道使用了一次本机的 ssh-agent
+type AgentForwardUse struct {
+	Hop  *types.Hop
+	User string // 请求转发的用户；多个会话同时转发时为最近一个
+	Err  error  // 连接本机 agent 失败或转发已结束，通道被拒绝
+}
+
+// agentForwardHook 远端打开 ssh-agent 通道时的回调
+var agentForwardHook atomic.Pointer[func(AgentForwardUse)]
+
+// OnAgentForward 设置远端使用转发的 ssh-agent 时的回调（如写入审计日志），nil 取消
+func OnAgentForward(fn func(AgentForwardUse)) {
+	if fn == nil {
+		agentForwardHook.Store(nil)
+		return
+	}
+	agentForwardHook.Store(&fn)
+}
+
+// ForwardAgent 代表 user 在 session 上请求转发本机的 ssh-agent（SSH_AUTH_SOCK），远端进程经它用本机密钥继续登录其他机器，
+// 私钥不离开本机。须在启动 shell 或命令之前调用；会话结束时必须调用返回的 stop，
+// 连接上没有正在转发的会话后远端再打开的 agent 通道一律拒绝，连接被其他会话复用时也用不到本机 agent
+func (c *Client) ForwardAgent(session *ssh.Session, user string) (stop func(), err error) {
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		return nil, ErrNoAgent
+	}
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	c.agentMu.Lock()
+	if !c.agentServing {
+		// 已有处理器时返回 nil
+		if channels := c.sshClient.HandleChannelOpen(agentChannelType); channels != nil {
+			go c.serveAgentChannels(channels)
+		}
+		c.agentServing = true
+	}
+	c.agentNext++
+	id := c.agentNext
+	if c.agentUsers == nil {
+		c.agentUsers = make(map[uint64]string)
+	}
+	c.agentUsers[id] = user
+	c.agentMu.Unlock()
+
+	stop = func() {
+		c.agentMu.Lock()
+		delete(c.agentUsers, id)
+		c.agentMu.Unlock()
+	}
+	if err := agent.RequestAgentForwarding(session); err != nil {
+		stop()
+		return nil, fmt.Errorf("agent forwarding: %w", err)
+	}
+	return stop, nil
+}
+
+// ForwardAgent 在最后一跳的 session 上请求转发本机的 ssh-agent
+func (c *Chain) ForwardAgent(session *ssh.Session, user string) (stop func(), err error) {
+	last := c.LastHop()
+	if last == nil {
+		return nil, fmt.Errorf("chain not connected")
+	}
+	return last.ForwardAgent(session, user)
+}
+
+// agentUser 返回最近一个仍在转发 ssh-agent 的会话的用户，没有时 ok 为 false
+func (c *Client) agentUser() (user string, ok bool) {
+	c.agentMu.Lock()
+	defer c.agentMu.Unlock()
+	var latest uint64
+	for id, u := range c.agentUsers {
+		if id > latest {
+			latest, user = id, u
+		}
+	}
+	return user, latest > 0
+}
+
+// serveAgentChannels 把远端打开的每个 ssh-agent 通道接到本机 agent，连接关闭时结束
+func (c *Client) serveAgentChannels(channels <-chan ssh.NewChannel) {
+	for newChannel := range channels {
+		go c.serveAgentChannel(newChannel)
+	}
+}
+
+// serveAgentChannel 每次都重新连接 SSH_AUTH_SOCK，agent 重启后同样可用
+func (c *Client) serveAgentChannel(newChannel ssh.NewChannel) {
+	user, ok := c.agentUser()
+	use := AgentForwardUse{Hop: c.config, User: user}
+	if !ok {
+		use.Err = errAgentNotForwarded
+		newChannel.Reject(ssh.Prohibited, use.Err.Error())
+		noteAgentForward(use)
+		return
+	}
+	local, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+	if err != nil {
+		use.Err = fmt.Errorf("failed to connect to ssh-agent: %w", err)
+		newChannel.Reject(ssh.ConnectionFailed, use.Err.Error())
+		noteAgentForward(use)
+		return
+	}
+	ch, requests, err := newChannel.Accept()
+	if err != nil {
+		local.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	noteAgentForward(use)
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(ch, local)
+		ch.CloseWrite()
+		close(done)
+	}()
+	io.Copy(local, ch)
+	local.Close()
+	<-done
+	ch.Close()
+}
+
+// noteAgentForward 记录日志并调用 OnAgentForward 的回调
+func noteAgentForward(use AgentForwardUse) {
+	if use.Err != nil {
+		log.Printf("[SSH] Refused ssh-agent request from %s: %v", use.Hop.Name, use.Err)
+	} else {
+		log.Printf("[SSH] %s is using the ssh-agent forwarded by %s", use.Hop.Name, use.User)
+	}
+	if fn := agentForwardHook.Load(); fn != nil {
+		(*fn)(use)
+	}
+}
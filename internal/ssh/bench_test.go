@@ -0,0 +1,37 @@
+package ssh
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/sshtest"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// BenchmarkChainConnect 建立并断开到进程内 SSH 服务器的连接（TCP、密钥交换和认证）
+func BenchmarkChainConnect(b *testing.B) {
+	sshtest.DiscardLogs(b)
+	bastion := sshtest.NewServer(b, sshtest.Options{})
+	target := sshtest.NewServer(b, sshtest.Options{})
+	routes := []struct {
+		name string
+		hops []*types.Hop
+	}{
+		{"direct", []*types.Hop{target.Hop("target")}},
+		{"bastion", []*types.Hop{bastion.Hop("bastion"), target.Hop("target")}},
+	}
+	for _, route := range routes {
+		b.Run(route.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				chain := NewChain(route.hops)
+				chain.SetLogger(log.New(io.Discard, "", 0))
+				if err := chain.ConnectContext(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+				chain.Disconnect()
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+	"golang.org/x/crypto/ssh"
+)
+
+// 受限网关可能拒绝的会话请求
+const (
+	CapabilityPTY   = "pty"   // 分配伪终端
+	CapabilityShell = "shell" // 启动登录 shell
+)
+
+// CapabilityError 服务器拒绝了 PTY 或 shell 请求。这类服务器通常只允许 exec 和子系统（如 sftp），
+// 命令执行、探测和传输不受影响，只有交互终端不可用
+type CapabilityError struct {
+	Hop        string // 服务器名称
+	Capability string // CapabilityPTY 或 CapabilityShell
+	Err        error
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("%s does not allow %s requests (exec-only server, interactive terminals are unavailable): %v", e.Hop, e.Capability, e.Err)
+}
+
+func (e *CapabilityError) Unwrap() error {
+	return e.Err
+}
+
+// IsCapabilityError 判断 err 是否为服务器拒绝 PTY 或 shell
+func IsCapabilityError(err error) bool {
+	var capErr *CapabilityError
+	return errors.As(err, &capErr)
+}
+
+// x/crypto/ssh 在服务器回复失败时返回的错误，与连接断开等其他错误区分
+const (
+	ptyDeniedMessage   = "ssh: pty-req failed"
+	shellDeniedMessage = "ssh: could not start shell"
+)
+
+// execOnlyHops 本进程内发现拒绝 PTY 或 shell 的服务器，键同 hopKey；成功分配 PTY 后移除
+var execOnlyHops sync.Map
+
+// RequestPTY 在 session 上请求伪终端。服务器拒绝时记下该服务器为仅 exec 并返回 *CapabilityError，
+// session 仍可用于 exec
+func RequestPTY(hop *types.Hop, session *ssh.Session, term string, rows, cols int, modes ssh.TerminalModes) error {
+	err := session.RequestPty(term, rows, cols, modes)
+	if err == nil {
+		execOnlyHops.Delete(hopKey(hop))
+		return nil
+	}
+	if err.Error() == ptyDeniedMessage {
+		return denied(hop, CapabilityPTY, err)
+	}
+	return err
+}
+
+// StartShell 在 session 上启动登录 shell，command 不为空时改为执行 command。
+// 服务器拒绝 shell 时同 RequestPTY 返回 *CapabilityError
+func StartShell(hop *types.Hop, session *ssh.Session, command string) error {
+	if command != "" {
+		return session.Start(command)
+	}
+	err := session.Shell()
+	if err != nil && err.Error() == shellDeniedMessage {
+		return denied(hop, CapabilityShell, err)
+	}
+	return err
+}
+
+// ExecOnly 返回本进程内是否发现 hop 拒绝 PTY 或 shell
+func ExecOnly(hop *types.Hop) bool {
+	_, ok := execOnlyHops.Load(hopKey(hop))
+	return ok
+}
+
+// denied 记下 hop 为仅 exec 并包装错误
+func denied(hop *types.Hop, capability string, err error) error {
+	execOnlyHops.Store(hopKey(hop), capability)
+	return &CapabilityError{Hop: hop.Name, Capability: capability, Err: err}
+}
+
+// RequestPTY 在最后一跳的 session 上请求伪终端，见包函数 RequestPTY
+func (c *Chain) RequestPTY(session *ssh.Session, term string, rows, cols int, modes ssh.TerminalModes) error {
+	return RequestPTY(c.hops[len(c.hops)-1], session, term, rows, cols, modes)
+}
+
+// ExecOnly 返回链的目标服务器是否只允许 exec，此时应以不带 PTY 的 exec 代替交互会话
+func (c *Chain) ExecOnly() bool {
+	return len(c.hops) > 0 && ExecOnly(c.hops[len(c.hops)-1])
+}
@@ -2,10 +2,15 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"log"
 	"net"
+	"sync"
 
+	"github.com/luobobo896/HSSH/internal/tracing"
 	"github.com/luobobo896/HSSH/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -14,6 +19,16 @@ type Chain struct {
 	hops    []*types.Hop
 	clients []*Client
 	connected bool
+	dials     []types.DialAttempt // 第一跳各地址的连接尝试
+	logger    *log.Logger // 为 nil 时不输出逐跳日志
+
+	// mu 保护 clients、connected 和 stopWatch，Supervise 重连时整体替换 clients
+	mu        sync.RWMutex
+	stopWatch context.CancelFunc // 停止 Monitor/Supervise 启动的监督 goroutine
+
+	subsMu  sync.Mutex
+	subs    []chainSub
+	nextSub uint64
 }
 
 // NewChain 创建新的连接链
@@ -24,8 +39,30 @@ func NewChain(hops []*types.Hop) *Chain {
 	}
 }
 
+// Hops 返回链经过的服务器，最后一个为目标
+func (c *Chain) Hops() []*types.Hop {
+	return c.hops
+}
+
+// SetLogger 设置逐跳连接日志输出（例如附带请求 ID 的 logger）
+func (c *Chain) SetLogger(logger *log.Logger) {
+	c.logger = logger
+}
+
+// logf 输出连接日志
+func (c *Chain) logf(format string, args ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, args...)
+	}
+}
+
 // Connect 建立整个连接链
 func (c *Chain) Connect() error {
+	return c.ConnectContext(context.Background())
+}
+
+// ConnectContext 建立整个连接链，每一跳记录一个子 span，便于定位慢的那一段
+func (c *Chain) ConnectContext(ctx context.Context) (err error) {
 	if c.connected {
 		return nil
 	}
@@ -34,60 +71,119 @@ func (c *Chain) Connect() error {
 		return fmt.Errorf("no hops in chain")
 	}
 
-	// 建立第一跳连接
-	firstClient, err := NewClient(c.hops[0])
-	if err != nil {
-		return fmt.Errorf("failed to create first hop client: %w", err)
-	}
+	ctx, span := tracing.Start(ctx, "ssh.chain.connect", attribute.Int("ssh.hops", len(c.hops)))
+	defer func() { tracing.End(span, err) }()
 
-	if err := firstClient.Connect(); err != nil {
-		return fmt.Errorf("failed to connect to first hop: %w", err)
+	// 建立第一跳连接
+	if err := c.connectHop(ctx, 0); err != nil {
+		return err
 	}
 
-	c.clients = append(c.clients, firstClient)
-
 	// 建立后续跳（通过前一跳作为跳板）
 	for i := 1; i < len(c.hops); i++ {
-		client, err := NewClient(c.hops[i])
-		if err != nil {
+		if err := c.connectHop(ctx, i); err != nil {
 			c.Disconnect()
-			return fmt.Errorf("failed to create client for hop %d: %w", i, err)
+			return err
 		}
+	}
 
-		// 通过上一跳连接
-		if err := client.ConnectThrough(c.clients[i-1]); err != nil {
-			c.Disconnect()
-			return fmt.Errorf("failed to connect through hop %d: %w", i-1, err)
+	c.mu.Lock()
+	c.connected = true
+	c.mu.Unlock()
+	trackChain(c)
+	return nil
+}
+
+// connectHop 连接第 i 跳，i > 0 时经由上一跳
+func (c *Chain) connectHop(ctx context.Context, i int) (err error) {
+	hop := c.hops[i]
+	_, span := tracing.Start(ctx, "ssh.hop.connect",
+		attribute.Int("ssh.hop.index", i),
+		attribute.String("ssh.hop.name", hop.Name),
+		attribute.String("server.address", hop.Host),
+		attribute.Int("server.port", hop.Port),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	client, err := NewClient(hop)
+	if err != nil {
+		if i == 0 {
+			err = fmt.Errorf("failed to create first hop client: %w", err)
+		} else {
+			err = fmt.Errorf("failed to create client for hop %d: %w", i, err)
 		}
+		return &HopError{Index: i, Hop: hop.Name, Kind: classifyConfigError(err), Err: err}
+	}
 
-		c.clients = append(c.clients, client)
+	// ctx 携带的询问方式回答本跳的键盘交互认证（如跳板机的 OTP）
+	client.SetInteractivePrompt(interactivePromptFrom(ctx))
+	if i == 0 {
+		err := client.ConnectContext(ctx)
+		c.dials = client.DialAttempts()
+		if err != nil {
+			return &HopError{Index: i, Hop: hop.Name, Kind: classifyConnectError(err), Err: fmt.Errorf("failed to connect to first hop: %w", err)}
+		}
+	} else if err := client.ConnectThrough(c.clients[i-1]); err != nil {
+		// 通过上一跳连接
+		return &HopError{Index: i, Hop: hop.Name, Kind: classifyConnectError(err), Err: fmt.Errorf("failed to connect through hop %d: %w", i-1, err)}
 	}
 
-	c.connected = true
+	c.mu.Lock()
+	c.clients = append(c.clients, client)
+	c.mu.Unlock()
+	c.logf("[SSH] Connected hop %d/%d: %s (%s)", i+1, len(c.hops), hop.Name, client.LoginTiming())
 	return nil
 }
 
-// Disconnect 断开整个连接链
+// Disconnect 断开整个连接链，并停止 Monitor/Supervise 的监督
 func (c *Chain) Disconnect() error {
+	c.mu.Lock()
+	if c.stopWatch != nil {
+		// 先停止监督，之后关闭连接不会被当作断开而重连
+		c.stopWatch()
+	}
+	lastErr := c.closeClientsLocked()
+	c.mu.Unlock()
+	untrackChain(c)
+	return lastErr
+}
+
+// closeClientsLocked 反向（从内网到外网）断开各跳并清空 clients，调用方持有 mu
+func (c *Chain) closeClientsLocked() error {
 	var lastErr error
-	// 反向断开（从内网到外网）
 	for i := len(c.clients) - 1; i >= 0; i-- {
 		if err := c.clients[i].Disconnect(); err != nil {
 			lastErr = err
 		}
 	}
-	c.clients = c.clients[:0]
+	c.clients = nil
 	c.connected = false
 	return lastErr
 }
 
-// IsConnected 检查连接链是否已建立
+// IsConnected 检查连接链是否已建立；Supervise 重连期间为 false
 func (c *Chain) IsConnected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.connected && len(c.clients) == len(c.hops)
 }
 
+// Prompted 链上是否有某一跳认证时询问过用户（如跳板机的 OTP）
+func (c *Chain) Prompted() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, client := range c.clients {
+		if client.Prompted() {
+			return true
+		}
+	}
+	return false
+}
+
 // LastHop 获取最后一跳客户端
 func (c *Chain) LastHop() *Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	if len(c.clients) == 0 {
 		return nil
 	}
@@ -96,6 +192,8 @@ func (c *Chain) LastHop() *Client {
 
 // FirstHop 获取第一跳客户端
 func (c *Chain) FirstHop() *Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	if len(c.clients) == 0 {
 		return nil
 	}
@@ -104,12 +202,19 @@ func (c *Chain) FirstHop() *Client {
 
 // GetHop 获取指定索引的客户端
 func (c *Chain) GetHop(index int) *Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	if index < 0 || index >= len(c.clients) {
 		return nil
 	}
 	return c.clients[index]
 }
 
+// DialAttempts 返回最近一次连接第一跳时各个解析地址的连接尝试（连接失败时同样保留）
+func (c *Chain) DialAttempts() []types.DialAttempt {
+	return c.dials
+}
+
 // HopCount 获取跳数
 func (c *Chain) HopCount() int {
 	return len(c.hops)
@@ -117,18 +222,20 @@ func (c *Chain) HopCount() int {
 
 // Dial 通过最后一跳建立到目标的连接
 func (c *Chain) Dial(network, addr string) (net.Conn, error) {
-	if !c.connected {
+	last := c.LastHop()
+	if !c.IsConnected() || last == nil {
 		return nil, fmt.Errorf("chain not connected")
 	}
-	return c.LastHop().Dial(network, addr)
+	return last.Dial(network, addr)
 }
 
 // NewSession 在最后一跳创建会话
 func (c *Chain) NewSession() (*ssh.Session, error) {
-	if !c.connected {
+	last := c.LastHop()
+	if !c.IsConnected() || last == nil {
 		return nil, fmt.Errorf("chain not connected")
 	}
-	return c.LastHop().NewSession()
+	return last.NewSession()
 }
 
 // Execute 在最后一跳执行命令
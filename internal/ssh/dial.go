@@ -0,0 +1,160 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/resolver"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const (
+	// dialTimeout 单个地址的连接超时
+	dialTimeout = 10 * time.Second
+	// connectionAttemptDelay 上一个地址还没有结果时，开始尝试下一个地址前的等待（RFC 8305 建议 250ms）
+	connectionAttemptDelay = 250 * time.Millisecond
+)
+
+// errDialCanceled 已有其他地址连接成功，放弃的尝试
+var errDialCanceled = errors.New("canceled: another address connected first")
+
+// dialResult 一个地址的拨号结果
+type dialResult struct {
+	index int
+	conn  net.Conn
+	err   error
+	took  time.Duration
+}
+
+// dialHappyEyeballs 按 RFC 8305 连接 host:port：解析出所有地址，IPv6 与 IPv4 交替排列，
+// 每隔 connectionAttemptDelay（或上一个地址失败时立即）开始尝试下一个地址，使用最先成功的连接。
+// 返回每个地址的尝试结果，供延迟分析使用
+func dialHappyEyeballs(ctx context.Context, host string, port int) (net.Conn, []types.DialAttempt, error) {
+	portStr := strconv.Itoa(port)
+
+	var addrs []string
+	if ip := net.ParseIP(host); ip != nil {
+		addrs = []string{net.JoinHostPort(host, portStr)}
+	} else {
+		// 第一跳用本机解析，结果在进程内共用的缓存中按 TTL 复用
+		ips, err := resolver.Default.Lookup(ctx, "", host, resolver.Mode{Kind: resolver.KindSystem}, nil)
+		if err != nil {
+			return nil, nil, &net.OpError{Op: "dial", Net: "tcp", Err: err}
+		}
+		for _, ip := range interleaveFamilies(ips) {
+			addrs = append(addrs, net.JoinHostPort(ip.String(), portStr))
+		}
+	}
+
+	attempts := make([]types.DialAttempt, len(addrs))
+	for i, addr := range addrs {
+		attempts[i].Addr = addr
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, len(addrs))
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	start := func(i int) {
+		go func() {
+			begin := time.Now()
+			conn, err := dialer.DialContext(ctx, "tcp", addrs[i])
+			results <- dialResult{index: i, conn: conn, err: err, took: time.Since(begin)}
+		}()
+	}
+
+	timer := time.NewTimer(connectionAttemptDelay)
+	defer timer.Stop()
+	next, pending := 0, 0
+	launch := func() {
+		start(next)
+		next++
+		pending++
+		timer.Reset(connectionAttemptDelay)
+	}
+
+	var winner net.Conn
+	var lastErr error
+loop:
+	for winner == nil {
+		if pending == 0 {
+			// 没有进行中的尝试时立即开始下一个地址
+			if next == len(addrs) {
+				break
+			}
+			launch()
+		}
+
+		select {
+		case r := <-results:
+			pending--
+			attempts[r.index].Latency = r.took
+			if r.err != nil {
+				attempts[r.index].Error = r.err.Error()
+				lastErr = r.err
+				continue
+			}
+			attempts[r.index].Chosen = true
+			winner = r.conn
+		case <-timer.C:
+			if next < len(addrs) {
+				launch()
+			}
+		case <-ctx.Done():
+			lastErr = ctx.Err()
+			break loop
+		}
+	}
+
+	// 放弃仍在进行的尝试，晚到的成功连接直接关闭
+	cancel()
+	for ; pending > 0; pending-- {
+		r := <-results
+		attempts[r.index].Latency = r.took
+		if r.conn != nil {
+			r.conn.Close()
+		}
+		attempts[r.index].Error = errDialCanceled.Error()
+	}
+	// 从未开始的地址
+	attempts = attempts[:next]
+
+	if winner == nil {
+		if lastErr == nil {
+			lastErr = errors.New("no addresses to dial")
+		}
+		return nil, attempts, lastErr
+	}
+	return winner, attempts, nil
+}
+
+// interleaveFamilies 按 RFC 8305 排列地址：保持解析顺序，以第一个地址的协议族开始，IPv6 与 IPv4 交替
+func interleaveFamilies(ips []net.IPAddr) []net.IPAddr {
+	var v6, v4 []net.IPAddr
+	for _, ip := range ips {
+		if ip.IP.To4() == nil {
+			v6 = append(v6, ip)
+		} else {
+			v4 = append(v4, ip)
+		}
+	}
+	first, second := v6, v4
+	if len(ips) > 0 && ips[0].IP.To4() != nil {
+		first, second = v4, v6
+	}
+
+	ordered := make([]net.IPAddr, 0, len(ips))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			ordered = append(ordered, first[i])
+		}
+		if i < len(second) {
+			ordered = append(ordered, second[i])
+		}
+	}
+	return ordered
+}
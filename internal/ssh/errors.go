@@ -0,0 +1,63 @@
+package ssh
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// 某一跳连接失败的原因
+const (
+	FailureConfig        = "config"         // 无法构建 SSH 配置（密钥缺失、无法解析等）
+	FailureKeyPassphrase = "key_passphrase" // 加密私钥没有可用的口令或口令错误
+	FailureDial          = "dial"           // 网络不可达、连接被拒绝或跳板机无法打开到目标的通道
+	FailureHostKey       = "host_key"       // 主机密钥与 known_hosts 或固定的 host_key 不符、未被信任或已吊销
+	FailureAuth          = "auth"           // 所有认证方式都被拒绝，或需要验证码但无法询问
+	FailureHandshake     = "handshake"      // 其他 SSH 握手错误
+)
+
+// HopError 连接链中某一跳失败，Kind 为上面的失败原因之一
+type HopError struct {
+	Index int    // 第几跳（从 0 开始）
+	Hop   string // 服务器名称
+	Kind  string
+	Err   error
+}
+
+func (e *HopError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HopError) Unwrap() error {
+	return e.Err
+}
+
+// classifyConfigError 判断无法构建 SSH 配置的原因
+func classifyConfigError(err error) string {
+	if errors.Is(err, ErrKeyPassphraseRequired) || errors.Is(err, ErrKeyPassphraseWrong) {
+		return FailureKeyPassphrase
+	}
+	return FailureConfig
+}
+
+// classifyConnectError 判断握手或拨号错误的原因
+func classifyConnectError(err error) string {
+	var keyErr *knownhosts.KeyError
+	var hostKeyErr *HostKeyError
+	var revokedErr *knownhosts.RevokedError
+	var opErr *net.OpError
+	var channelErr *ssh.OpenChannelError
+	switch {
+	case errors.As(err, &keyErr), errors.As(err, &hostKeyErr), errors.As(err, &revokedErr):
+		return FailureHostKey
+	case strings.Contains(err.Error(), "unable to authenticate"), errors.Is(err, ErrInteractiveRequired):
+		return FailureAuth
+	case errors.As(err, &opErr), errors.As(err, &channelErr):
+		return FailureDial
+	default:
+		return FailureHandshake
+	}
+}
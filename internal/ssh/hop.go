@@ -1,76 +1,128 @@
 package ssh
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/luobobo896/HSSH/internal/netem"
 	"github.com/luobobo896/HSSH/pkg/types"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 // Client SSH 客户端封装
 type Client struct {
-	config     *types.Hop
-	sshClient  *ssh.Client
-	sshConfig  *ssh.ClientConfig
-	connected  bool
+	config       *types.Hop
+	sshClient    *ssh.Client
+	sshConfig    *ssh.ClientConfig
+	connected    bool
+	dials        []types.DialAttempt // 最近一次 Connect 的各地址连接尝试
+	timing       LoginTiming         // 最近一次连接各阶段的耗时
+	interactive  InteractivePrompt   // 本连接的键盘交互认证询问方式，nil 时使用 SetInteractivePrompt 设置的
+	prompted     atomic.Bool         // 认证时询问过用户（如 OTP），连接只属于回答的人
+	agentMu      sync.Mutex          // 保护下面的 ssh-agent 转发状态
+	agentServing bool                // 已注册 ssh-agent 通道处理器
+	agentUsers   map[uint64]string   // 正在转发 ssh-agent 的会话 -> 请求转发的用户
+	agentNext    uint64
 }
 
 // NewClient 创建新的 SSH 客户端
 func NewClient(hop *types.Hop) (*Client, error) {
-	sshConfig, err := buildSSHConfig(hop)
+	c := &Client{config: hop}
+	sshConfig, err := buildSSHConfig(hop, c.interactivePrompt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build SSH config: %w", err)
 	}
+	c.sshConfig = sshConfig
+	return c, nil
+}
 
-	return &Client{
-		config:    hop,
-		sshConfig: sshConfig,
-		connected: false,
-	}, nil
+// SetInteractivePrompt 设置本连接回答键盘交互认证（如 OTP）的方式，须在连接前调用
+func (c *Client) SetInteractivePrompt(prompt InteractivePrompt) {
+	c.interactive = prompt
+}
+
+func (c *Client) interactivePrompt() InteractivePrompt {
+	prompt := c.interactive
+	if prompt == nil {
+		prompt = defaultInteractivePrompt()
+	}
+	if prompt == nil {
+		return nil
+	}
+	return func(hop *types.Hop, challenge Challenge) ([]string, error) {
+		answers, err := prompt(hop, challenge)
+		if err == nil {
+			c.prompted.Store(true)
+		}
+		return answers, err
+	}
+}
+
+// Prompted 连接认证时是否询问过用户（如回答 OTP）。这样的连接代表回答的人完成了二次验证，不应交给其他用户复用
+func (c *Client) Prompted() bool {
+	return c.prompted.Load()
 }
 
 // Connect 建立 SSH 连接
 func (c *Client) Connect() error {
+	return c.ConnectContext(context.Background())
+}
+
+// ConnectContext 建立 SSH 连接；主机解析出多个地址时按 Happy Eyeballs 并行竞速，使用最先连上的地址
+func (c *Client) ConnectContext(ctx context.Context) error {
 	if c.connected {
 		return nil
 	}
 
 	addr := c.config.Address()
 
-	// 使用自定义 dialer 启用 TCP_NODELAY，减少延迟
-	// 对于终端输入响应特别重要
-	dialer := &net.Dialer{
-		Timeout: 10 * time.Second,
-	}
-
-	netConn, err := dialer.Dial("tcp", addr)
+	start := time.Now()
+	netConn, dials, err := dialHappyEyeballs(ctx, c.config.Host, c.config.Port)
+	c.dials = dials
 	if err != nil {
 		return fmt.Errorf("failed to dial %s: %w", addr, err)
 	}
+	c.timing = LoginTiming{TCP: time.Since(start)}
 
 	// 启用 TCP_NODELAY 禁用 Nagle 算法，减少输入延迟
 	if tcpConn, ok := netConn.(*net.TCPConn); ok {
 		tcpConn.SetNoDelay(true)
 	}
+	// 调试时注入模拟的延迟和丢包，跳板之后的各跳都经过第一跳，一并受影响
+	netConn = netem.Wrap(netConn)
 
 	// 建立 SSH 连接
-	conn, chans, reqs, err := ssh.NewClientConn(netConn, addr, c.sshConfig)
+	conn, chans, reqs, kex, auth, err := handshake(netConn, addr, c.sshConfig)
 	if err != nil {
 		netConn.Close()
 		return fmt.Errorf("failed to create SSH connection: %w", err)
 	}
+	c.timing.Kex, c.timing.Auth = kex, auth
+	recordLogin(c.config, c.timing)
+	noteLegacyCrypto(c.config, conn)
 
 	c.sshClient = ssh.NewClient(conn, chans, reqs)
 	c.connected = true
 	return nil
 }
 
+// DialAttempts 返回最近一次直连（Connect）时各个地址的连接尝试，经跳板连接时为空
+func (c *Client) DialAttempts() []types.DialAttempt {
+	return c.dials
+}
+
+// LoginTiming 返回最近一次连接各阶段的耗时
+func (c *Client) LoginTiming() LoginTiming {
+	return c.timing
+}
+
 // ConnectThrough 通过跳板机连接
 func (c *Client) ConnectThrough(bastion *Client) error {
 	if !bastion.connected {
@@ -80,10 +132,12 @@ func (c *Client) ConnectThrough(bastion *Client) error {
 	// 在跳板机上建立到目标主机的连接
 	// 使用 TCP_NODELAY 禁用 Nagle 算法，减少延迟
 	targetAddr := c.config.Address()
+	start := time.Now()
 	bastionConn, err := bastion.sshClient.Dial("tcp", targetAddr)
 	if err != nil {
 		return fmt.Errorf("failed to dial through bastion: %w", err)
 	}
+	c.timing = LoginTiming{TCP: time.Since(start)}
 
 	// 尝试设置 TCP_NODELAY（如果底层连接支持）
 	if tcpConn, ok := bastionConn.(interface{ SetNoDelay(bool) error }); ok {
@@ -91,11 +145,14 @@ func (c *Client) ConnectThrough(bastion *Client) error {
 	}
 
 	// 创建 SSH 连接
-	conn, chans, reqs, err := ssh.NewClientConn(bastionConn, targetAddr, c.sshConfig)
+	conn, chans, reqs, kex, auth, err := handshake(bastionConn, targetAddr, c.sshConfig)
 	if err != nil {
 		bastionConn.Close()
 		return fmt.Errorf("failed to create SSH connection through bastion: %w", err)
 	}
+	c.timing.Kex, c.timing.Auth = kex, auth
+	recordLogin(c.config, c.timing)
+	noteLegacyCrypto(c.config, conn)
 
 	c.sshClient = ssh.NewClient(conn, chans, reqs)
 	c.connected = true
@@ -118,6 +175,35 @@ func (c *Client) IsConnected() bool {
 	return c.connected && c.sshClient != nil
 }
 
+// KeepAlive 发送一次 keepalive@openssh.com 请求并返回往返时间；服务端拒绝该请求也算作回复，
+// ctx 结束前没有回复视为失败
+func (c *Client) KeepAlive(ctx context.Context) (time.Duration, error) {
+	if !c.IsConnected() {
+		return 0, fmt.Errorf("not connected")
+	}
+	return keepAlive(ctx, c.sshClient)
+}
+
+// keepAlive 在 client 上发送一次 keepalive@openssh.com 请求
+func keepAlive(ctx context.Context, client *ssh.Client) (time.Duration, error) {
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return 0, fmt.Errorf("keepalive: %w", err)
+		}
+		return time.Since(start), nil
+	case <-ctx.Done():
+		return 0, fmt.Errorf("keepalive: %w", ctx.Err())
+	}
+}
+
 // GetUnderlyingClient 获取底层 SSH 客户端
 func (c *Client) GetUnderlyingClient() *ssh.Client {
 	return c.sshClient
@@ -136,11 +222,16 @@ func (c *Client) NewSession() (*ssh.Session, error) {
 	if !c.connected {
 		return nil, fmt.Errorf("not connected")
 	}
-	return c.sshClient.NewSession()
+	start := time.Now()
+	session, err := c.sshClient.NewSession()
+	if err == nil {
+		RecordLoginPhase(c.config, PhaseChannel, time.Since(start))
+	}
+	return session, err
 }
 
-// buildSSHConfig 构建 SSH 客户端配置
-func buildSSHConfig(hop *types.Hop) (*ssh.ClientConfig, error) {
+// buildSSHConfig 构建 SSH 客户端配置，interactive 返回键盘交互认证的询问方式（为 nil 时使用默认方式）
+func buildSSHConfig(hop *types.Hop, interactive func() InteractivePrompt) (*ssh.ClientConfig, error) {
 	log.Printf("[SSH] Building config for %s@%s, AuthType=%d (%v), KeyPath=%s, Password=%s", 
 		hop.User, hop.Host, hop.AuthType, hop.AuthType, hop.KeyPath, 
 		func() string { if hop.Password != "" { return "***" } else { return "(empty)" } }())
@@ -152,14 +243,9 @@ func buildSSHConfig(hop *types.Hop) (*ssh.ClientConfig, error) {
 		if hop.KeyPath == "" {
 			return nil, fmt.Errorf("key path is required for key authentication")
 		}
-		key, err := os.ReadFile(expandPath(hop.KeyPath))
+		// 加密的私钥按 key_passphrase、已解锁的口令和交互式输入的顺序取口令
+		signer, err := loadKeySigner(hop)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read key file: %w", err)
-		}
-
-		signer, err := ssh.ParsePrivateKey(key)
-		if err != nil {
-			// 可能是加密的私钥，尝试交互式输入密码
 			return nil, fmt.Errorf("failed to parse private key: %w", err)
 		}
 		authMethods = append(authMethods, ssh.PublicKeys(signer))
@@ -170,20 +256,22 @@ func buildSSHConfig(hop *types.Hop) (*ssh.ClientConfig, error) {
 		}
 		authMethods = append(authMethods, ssh.Password(hop.Password))
 
+	case types.AuthAgent:
+		auth, err := agentAuth()
+		if err != nil {
+			return nil, err
+		}
+		authMethods = append(authMethods, auth)
+
 	default:
 		return nil, fmt.Errorf("unsupported auth type: %v", hop.AuthType)
 	}
 
-	// 添加键盘交互认证（用于处理某些需要二次确认的场景）
-	authMethods = append(authMethods, ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
-		answers := make([]string, len(questions))
-		for i := range questions {
-			if hop.AuthType == types.AuthPassword && hop.Password != "" {
-				answers[i] = hop.Password
-			}
-		}
-		return answers, nil
-	}))
+	// 添加键盘交互认证（密码之外的 OTP 等二次验证）
+	if interactive == nil {
+		interactive = defaultInteractivePrompt
+	}
+	authMethods = append(authMethods, ssh.KeyboardInteractive(keyboardInteractive(hop, interactive)))
 
 	// 使用更快的加密算法和启用压缩来优化性能
 	// 顺序：优先使用更高效的算法
@@ -212,10 +300,20 @@ func buildSSHConfig(hop *types.Hop) (*ssh.ClientConfig, error) {
 		"hmac-sha2-128",
 	}
 
+	clientVersion, err := types.NormalizeClientVersion(hop.ClientVersion)
+	if err != nil {
+		return nil, err
+	}
+	verifyHostKey, err := hostKeyCallback(hop)
+	if err != nil {
+		return nil, err
+	}
+
 	config := &ssh.ClientConfig{
-		User:    hop.User,
-		Auth:    authMethods,
-		Timeout: 10 * time.Second,
+		User:          hop.User,
+		Auth:          authMethods,
+		ClientVersion: clientVersion,
+		Timeout:       10 * time.Second,
 		// 启用压缩来减少数据传输量，提高响应速度
 		// 对于终端交互特别有效
 		Config: ssh.Config{
@@ -223,7 +321,11 @@ func buildSSHConfig(hop *types.Hop) (*ssh.ClientConfig, error) {
 			KeyExchanges: preferredKeyExchanges,
 			MACs:         preferredMACs,
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // 生产环境应使用 knownhosts
+		HostKeyCallback:   verifyHostKey,
+		HostKeyAlgorithms: hostKeyAlgorithms(hop),
+	}
+	if hop.LegacyCrypto {
+		withLegacyAlgorithms(&config.Config)
 	}
 
 	return config, nil
@@ -239,18 +341,3 @@ func expandPath(path string) string {
 	}
 	return path
 }
-
-// GetHostKeyCallback 获取主机密钥回调（用于验证服务器身份）
-func GetHostKeyCallback() (ssh.HostKeyCallback, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
-	}
-
-	knownHostsPath := filepath.Join(homeDir, ".ssh", "known_hosts")
-	callback, err := knownhosts.New(knownHostsPath)
-	if err != nil {
-		return ssh.InsecureIgnoreHostKey(), nil
-	}
-	return callback, nil
-}
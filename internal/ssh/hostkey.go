@@ -0,0 +1,484 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// knownHosts known_hosts 文件的位置和读写锁：TOFU 记录、接受和删除密钥都会改写文件
+var knownHosts struct {
+	mu   sync.Mutex
+	path string // 为空时为 ~/.ssh/known_hosts
+}
+
+// SetKnownHostsPath 设置 known_hosts 文件路径（测试或多实例部署），空串恢复为 ~/.ssh/known_hosts
+func SetKnownHostsPath(path string) {
+	knownHosts.mu.Lock()
+	defer knownHosts.mu.Unlock()
+	knownHosts.path = path
+}
+
+// KnownHostsPath 当前使用的 known_hosts 文件路径
+func KnownHostsPath() (string, error) {
+	knownHosts.mu.Lock()
+	defer knownHosts.mu.Unlock()
+	return knownHostsPathLocked()
+}
+
+func knownHostsPathLocked() (string, error) {
+	if knownHosts.path != "" {
+		return knownHosts.path, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate known_hosts: %w", err)
+	}
+	return filepath.Join(homeDir, ".ssh", "known_hosts"), nil
+}
+
+// HostKeyError 主机密钥未被信任：strict 策略下的新主机、与 known_hosts 不符（可能是重装，也可能是中间人）或与固定的 host_key 不符
+type HostKeyError struct {
+	Hop     string
+	Address string // known_hosts 中的主机名，如 example.com 或 [10.0.0.5]:2222
+	Key     ssh.PublicKey
+	// Known 已记录的密钥，为空表示首次见到该主机
+	Known []ssh.PublicKey
+	// Pinned 与服务器配置中固定的 host_key 不符，只能修改配置解决
+	Pinned bool
+}
+
+// Changed 主机已有记录但密钥不同
+func (e *HostKeyError) Changed() bool {
+	return len(e.Known) > 0
+}
+
+func (e *HostKeyError) Error() string {
+	fingerprint := e.Key.Type() + " " + ssh.FingerprintSHA256(e.Key)
+	switch {
+	case e.Pinned:
+		return fmt.Sprintf("host key of %s (%s) does not match the pinned host_key: server offered %s", e.Hop, e.Address, fingerprint)
+	case e.Changed():
+		return fmt.Sprintf("REMOTE HOST KEY HAS CHANGED for %s (%s): server offered %s, known_hosts has %s; "+
+			"if the server was reinstalled, run 'gmssh hostkey accept %s' after verifying the fingerprint",
+			e.Hop, e.Address, fingerprint, strings.Join(fingerprints(e.Known), ", "), e.Hop)
+	default:
+		return fmt.Sprintf("host key of %s (%s) is not trusted (host_key_policy strict): server offered %s; "+
+			"run 'gmssh hostkey accept %s' after verifying the fingerprint", e.Hop, e.Address, fingerprint, e.Hop)
+	}
+}
+
+func fingerprints(keys []ssh.PublicKey) []string {
+	out := make([]string, len(keys))
+	for i, key := range keys {
+		out[i] = key.Type() + " " + ssh.FingerprintSHA256(key)
+	}
+	return out
+}
+
+// hostKeyCallback 按服务器的 host_key 和 host_key_policy 构建主机密钥校验
+func hostKeyCallback(hop *types.Hop) (ssh.HostKeyCallback, error) {
+	if hop.HostKey != "" {
+		pinned, err := types.ParseHostKey(hop.HostKey)
+		if err != nil {
+			return nil, err
+		}
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if bytes.Equal(key.Marshal(), pinned.Marshal()) {
+				return nil
+			}
+			return &HostKeyError{Hop: hop.Name, Address: knownhosts.Normalize(hostname), Key: key, Known: []ssh.PublicKey{pinned}, Pinned: true}
+		}, nil
+	}
+
+	policy := hop.EffectiveHostKeyPolicy()
+	if policy == types.HostKeyOff {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return checkKnownHost(hop.Name, policy, hostname, remote, key)
+	}, nil
+}
+
+// hostKeyAlgorithms 握手时优先协商的主机密钥算法。固定了 host_key 时只协商它的类型；
+// 否则与 OpenSSH 一样把 known_hosts 中该主机已记录的密钥类型排在前面，
+// 避免服务器出示另一种类型的密钥而被当成密钥变更。没有记录时返回 nil，使用默认顺序
+func hostKeyAlgorithms(hop *types.Hop) []string {
+	if hop.HostKey != "" {
+		pinned, err := types.ParseHostKey(hop.HostKey)
+		if err != nil {
+			return nil
+		}
+		return keyAlgorithms(pinned.Type())
+	}
+	if hop.EffectiveHostKeyPolicy() == types.HostKeyOff {
+		return nil
+	}
+
+	knownHosts.mu.Lock()
+	path, err := knownHostsPathLocked()
+	var known []ssh.PublicKey
+	if err == nil {
+		known = recordedHostKeys(path, hop)
+	}
+	knownHosts.mu.Unlock()
+	if len(known) == 0 {
+		return nil
+	}
+
+	var algorithms []string
+	for _, key := range known {
+		for _, algo := range keyAlgorithms(key.Type()) {
+			if !slices.Contains(algorithms, algo) {
+				algorithms = append(algorithms, algo)
+			}
+		}
+	}
+	// 记录的类型之后仍接受其他类型，服务器换了密钥类型时照常提示密钥变更
+	for _, algo := range defaultHostKeyAlgorithms {
+		if !slices.Contains(algorithms, algo) {
+			algorithms = append(algorithms, algo)
+		}
+	}
+	return algorithms
+}
+
+// defaultHostKeyAlgorithms 与 x/crypto 默认相同的主机密钥算法顺序（不含 DSA）
+var defaultHostKeyAlgorithms = []string{
+	ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSAv01,
+	ssh.CertAlgoECDSA256v01, ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01, ssh.CertAlgoED25519v01,
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSA,
+	ssh.KeyAlgoED25519,
+}
+
+// keyAlgorithms 能验证 keyType 类型密钥的签名算法，RSA 密钥优先 SHA-2 签名
+func keyAlgorithms(keyType string) []string {
+	if keyType == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{keyType}
+}
+
+// recordedHostKeys known_hosts 中 hop 地址已记录的密钥；用一个不会出现的密钥查询，从 KeyError 中取出记录
+func recordedHostKeys(path string, hop *types.Hop) []ssh.PublicKey {
+	probe, err := ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+	if err != nil {
+		return nil
+	}
+	// 主机名为 IP 时同时按 IP 匹配，与握手时 knownhosts 的查找方式一致
+	remote := &net.TCPAddr{IP: net.IPv4zero, Port: hop.Port}
+	if ip := net.ParseIP(hop.Host); ip != nil {
+		remote.IP = ip
+	}
+	known, err := lookupKnownHost(path, hop.Address(), remote, probe)
+	if err != nil {
+		return nil
+	}
+	return known
+}
+
+// checkKnownHost 对照 known_hosts 校验；tofu 策略下首次见到的主机直接记录
+func checkKnownHost(hopName, policy, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	knownHosts.mu.Lock()
+	defer knownHosts.mu.Unlock()
+
+	path, err := knownHostsPathLocked()
+	if err != nil {
+		return err
+	}
+	known, err := lookupKnownHost(path, hostname, remote, key)
+	if err != nil {
+		return err
+	}
+	address := knownhosts.Normalize(hostname)
+	switch {
+	case known == nil:
+		pendingHostKeys.remove(address)
+		return nil
+	case len(known) == 0 && policy == types.HostKeyTOFU:
+		if err := appendKnownHost(path, address, key); err != nil {
+			return err
+		}
+		log.Printf("[SSH] Recorded host key of %s (%s) in %s: %s %s", hopName, address, path, key.Type(), ssh.FingerprintSHA256(key))
+		return nil
+	}
+	hostErr := &HostKeyError{Hop: hopName, Address: address, Key: key, Known: known}
+	pendingHostKeys.add(hostErr)
+	return hostErr
+}
+
+// lookupKnownHost 返回 nil 表示密钥已被信任，空切片表示主机没有记录，否则为主机已记录的（不同的）密钥；
+// 被吊销的密钥返回 *knownhosts.RevokedError
+func lookupKnownHost(path, hostname string, remote net.Addr, key ssh.PublicKey) ([]ssh.PublicKey, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return []ssh.PublicKey{}, nil
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	err = callback(hostname, remote, key)
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return nil, err
+	}
+	known := make([]ssh.PublicKey, 0, len(keyErr.Want))
+	for _, want := range keyErr.Want {
+		known = append(known, want.Key)
+	}
+	return known, nil
+}
+
+// appendKnownHost 追加一行，必要时创建 ~/.ssh（0700）和 known_hosts（0600）
+func appendKnownHost(path, address string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if _, err := fmt.Fprintln(f, knownhosts.Line([]string{address}, key)); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// TrustHostKey 信任 address（host:port 或 known_hosts 主机名）的密钥 key：删除该主机原有的记录后追加
+func TrustHostKey(address string, key ssh.PublicKey) error {
+	knownHosts.mu.Lock()
+	defer knownHosts.mu.Unlock()
+
+	path, err := knownHostsPathLocked()
+	if err != nil {
+		return err
+	}
+	address = knownhosts.Normalize(address)
+	if _, err := removeKnownHost(path, address); err != nil {
+		return err
+	}
+	if err := appendKnownHost(path, address, key); err != nil {
+		return err
+	}
+	pendingHostKeys.remove(address)
+	log.Printf("[SSH] Trusted host key of %s: %s %s", address, key.Type(), ssh.FingerprintSHA256(key))
+	return nil
+}
+
+// ForgetHostKey 从 known_hosts 删除 address 的全部记录（含哈希形式），返回删除的行数；通配符和 @ 标记的行保留
+func ForgetHostKey(address string) (int, error) {
+	knownHosts.mu.Lock()
+	defer knownHosts.mu.Unlock()
+
+	path, err := knownHostsPathLocked()
+	if err != nil {
+		return 0, err
+	}
+	return removeKnownHost(path, knownhosts.Normalize(address))
+}
+
+func removeKnownHost(path, address string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var kept bytes.Buffer
+	removed := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if knownHostLineMatches(line, address) {
+			removed++
+			continue
+		}
+		kept.WriteString(line)
+		kept.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	// 先写临时文件再改名，避免中途失败损坏 known_hosts
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, kept.Bytes(), 0600); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return removed, nil
+}
+
+// knownHostLineMatches 行的主机列表中是否有与 address 完全相同的主机名或哈希
+func knownHostLineMatches(line, address string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+		return false
+	}
+	for _, pattern := range strings.Split(fields[0], ",") {
+		if pattern == address || hashedHostMatches(pattern, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashedHostMatches 匹配 HashKnownHosts 写入的 |1|salt|hash 形式
+func hashedHostMatches(pattern, address string) bool {
+	encoded, ok := strings.CutPrefix(pattern, "|1|")
+	if !ok {
+		return false
+	}
+	saltB64, hashB64, ok := strings.Cut(encoded, "|")
+	if !ok {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(saltB64)
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(hashB64)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(address))
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// PendingHostKey 被拒绝、等待确认的主机密钥
+type PendingHostKey struct {
+	Address     string `json:"address"`
+	Hop         string `json:"hop"` // 最近一次遇到该密钥的服务器
+	KeyType     string `json:"key_type"`
+	Fingerprint string `json:"fingerprint"` // SHA256:...
+	// Changed 主机已有记录但密钥不同，KnownFingerprints 为已记录的密钥
+	Changed           bool      `json:"changed"`
+	KnownFingerprints []string  `json:"known_fingerprints,omitempty"`
+	SeenAt            time.Time `json:"seen_at"`
+
+	key ssh.PublicKey
+}
+
+// 确认主机密钥时的错误
+var (
+	ErrHostKeyNotPending      = errors.New("no pending host key for this address")
+	ErrHostKeyFingerprintDiff = errors.New("fingerprint does not match the pending host key")
+)
+
+// pendingHostKeys 最近被拒绝的主机密钥，按地址只保留最新的一个；只在内存中，重启后重新连接即可再次出现
+var pendingHostKeys = &pendingStore{keys: make(map[string]*PendingHostKey)}
+
+// maxPendingHostKeys 最多保留的待确认密钥数，超出时丢弃最早的
+const maxPendingHostKeys = 256
+
+type pendingStore struct {
+	mu   sync.Mutex
+	keys map[string]*PendingHostKey
+}
+
+func (s *pendingStore) add(e *HostKeyError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[e.Address]; !ok && len(s.keys) >= maxPendingHostKeys {
+		var oldest *PendingHostKey
+		for _, p := range s.keys {
+			if oldest == nil || p.SeenAt.Before(oldest.SeenAt) {
+				oldest = p
+			}
+		}
+		delete(s.keys, oldest.Address)
+	}
+	known := fingerprints(e.Known)
+	for i, fp := range known {
+		_, known[i], _ = strings.Cut(fp, " ")
+	}
+	s.keys[e.Address] = &PendingHostKey{
+		Address:           e.Address,
+		Hop:               e.Hop,
+		KeyType:           e.Key.Type(),
+		Fingerprint:       ssh.FingerprintSHA256(e.Key),
+		Changed:           e.Changed(),
+		KnownFingerprints: known,
+		SeenAt:            time.Now(),
+		key:               e.Key,
+	}
+}
+
+func (s *pendingStore) remove(address string) *PendingHostKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.keys[address]
+	delete(s.keys, address)
+	return p
+}
+
+func (s *pendingStore) get(address string) *PendingHostKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys[address]
+}
+
+// PendingHostKeys 等待确认的主机密钥，最新的在前
+func PendingHostKeys() []PendingHostKey {
+	pendingHostKeys.mu.Lock()
+	defer pendingHostKeys.mu.Unlock()
+	list := make([]PendingHostKey, 0, len(pendingHostKeys.keys))
+	for _, p := range pendingHostKeys.keys {
+		list = append(list, *p)
+	}
+	slices.SortFunc(list, func(a, b PendingHostKey) int {
+		return b.SeenAt.Compare(a.SeenAt)
+	})
+	return list
+}
+
+// AcceptHostKey 信任 address 的待确认密钥；fingerprint 必须与待确认的密钥一致，防止确认后密钥又被替换
+func AcceptHostKey(address, fingerprint string) (*PendingHostKey, error) {
+	address = knownhosts.Normalize(address)
+	p := pendingHostKeys.get(address)
+	if p == nil {
+		return nil, ErrHostKeyNotPending
+	}
+	if p.Fingerprint != fingerprint {
+		return nil, ErrHostKeyFingerprintDiff
+	}
+	if err := TrustHostKey(address, p.key); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// RejectHostKey 丢弃 address 的待确认密钥，known_hosts 不变，之后的连接仍会被拒绝
+func RejectHostKey(address string) (*PendingHostKey, error) {
+	p := pendingHostKeys.remove(knownhosts.Normalize(address))
+	if p == nil {
+		return nil, ErrHostKeyNotPending
+	}
+	return p, nil
+}
@@ -0,0 +1,216 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/sshtest"
+	"github.com/luobobo896/HSSH/pkg/types"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// useKnownHosts 把 known_hosts 指向临时文件
+func useKnownHosts(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ssh", "known_hosts")
+	SetKnownHostsPath(path)
+	t.Cleanup(func() { SetKnownHostsPath("") })
+	return path
+}
+
+func randomHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func connectHop(hop *types.Hop) error {
+	chain := NewChain([]*types.Hop{hop})
+	err := chain.Connect()
+	if err == nil {
+		chain.Disconnect()
+	}
+	return err
+}
+
+func TestHostKeyTOFU(t *testing.T) {
+	path := useKnownHosts(t)
+	server := sshtest.NewServer(t, sshtest.Options{})
+	hop := server.Hop("web")
+	hop.HostKey = ""
+	address := knownhosts.Normalize(hop.Address())
+
+	// 首次连接记录密钥，之后按记录校验
+	if err := connectHop(hop); err != nil {
+		t.Fatalf("first connect: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := knownhosts.Line([]string{address}, server.HostKey()); strings.TrimSpace(string(data)) != want {
+		t.Fatalf("known_hosts = %q, want %q", data, want)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("known_hosts mode = %v, %v", info.Mode(), err)
+	}
+	if err := connectHop(hop); err != nil {
+		t.Fatalf("second connect: %v", err)
+	}
+
+	// 密钥变化（重装或中间人）时拒绝，等待确认
+	if err := TrustHostKey(hop.Address(), randomHostKey(t)); err != nil {
+		t.Fatal(err)
+	}
+	err = connectHop(hop)
+	var hostErr *HostKeyError
+	var hopErr *HopError
+	if !errors.As(err, &hostErr) || !hostErr.Changed() || !errors.As(err, &hopErr) || hopErr.Kind != FailureHostKey {
+		t.Fatalf("expected changed host key error, got %v", err)
+	}
+	pending := PendingHostKeys()
+	if len(pending) != 1 || pending[0].Address != address || !pending[0].Changed || pending[0].Hop != "web" {
+		t.Fatalf("pending = %+v", pending)
+	}
+	if _, err := AcceptHostKey(hop.Address(), "SHA256:wrong"); !errors.Is(err, ErrHostKeyFingerprintDiff) {
+		t.Errorf("accept with wrong fingerprint: %v", err)
+	}
+	if _, err := AcceptHostKey(hop.Address(), ssh.FingerprintSHA256(server.HostKey())); err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	if len(PendingHostKeys()) != 0 {
+		t.Error("accepted key is still pending")
+	}
+	if err := connectHop(hop); err != nil {
+		t.Fatalf("connect after accept: %v", err)
+	}
+	if data, _ := os.ReadFile(path); strings.Count(string(data), "\n") != 1 {
+		t.Errorf("accept should replace the old line, known_hosts = %q", data)
+	}
+}
+
+func TestHostKeyStrictAndPinned(t *testing.T) {
+	path := useKnownHosts(t)
+	server := sshtest.NewServer(t, sshtest.Options{})
+
+	pinned := server.Hop("pinned")
+	if err := connectHop(pinned); err != nil {
+		t.Fatalf("pinned connect: %v", err)
+	}
+	pinned.HostKey = string(ssh.MarshalAuthorizedKey(randomHostKey(t)))
+	var hostErr *HostKeyError
+	if err := connectHop(pinned); !errors.As(err, &hostErr) || !hostErr.Pinned {
+		t.Fatalf("expected pinned host key error, got %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("pinned hops should not touch known_hosts: %v", err)
+	}
+
+	strict := server.Hop("strict")
+	strict.HostKey = ""
+	strict.HostKeyPolicy = types.HostKeyStrict
+	if err := connectHop(strict); !errors.As(err, &hostErr) || hostErr.Changed() {
+		t.Fatalf("expected untrusted host key error, got %v", err)
+	}
+	if _, err := RejectHostKey(strict.Address()); err != nil {
+		t.Fatalf("reject: %v", err)
+	}
+	if _, err := AcceptHostKey(strict.Address(), ssh.FingerprintSHA256(server.HostKey())); !errors.Is(err, ErrHostKeyNotPending) {
+		t.Errorf("accept after reject: %v", err)
+	}
+
+	off := server.Hop("off")
+	off.HostKey = ""
+	off.HostKeyPolicy = types.HostKeyOff
+	if err := connectHop(off); err != nil {
+		t.Fatalf("policy off: %v", err)
+	}
+}
+
+func TestForgetHostKey(t *testing.T) {
+	path := useKnownHosts(t)
+	key := randomHostKey(t)
+	lines := []string{
+		knownhosts.Line([]string{"[10.0.0.5]:2222"}, key),
+		knownhosts.Line([]string{knownhosts.HashHostname("[10.0.0.5]:2222")}, key),
+		knownhosts.Line([]string{"other.example.com,[10.0.0.5]:2222"}, key),
+		knownhosts.Line([]string{"10.0.0.5"}, key),
+		"@revoked [10.0.0.5]:2222 " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := ForgetHostKey("10.0.0.5:2222")
+	if err != nil || removed != 3 {
+		t.Fatalf("ForgetHostKey = %d, %v; want 3", removed, err)
+	}
+	data, _ := os.ReadFile(path)
+	if want := lines[3] + "\n" + lines[4] + "\n"; string(data) != want {
+		t.Errorf("known_hosts = %q, want %q", data, want)
+	}
+}
+
+func TestHostKeyAlgorithmsFollowKnownHosts(t *testing.T) {
+	path := useKnownHosts(t)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaSigner, err := ssh.NewSignerFromKey(ecdsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 服务器同时有 ed25519 和 ecdsa 主机密钥，像 OpenSSH 一样
+	server := sshtest.NewServer(t, sshtest.Options{HostKeys: []ssh.Signer{ecdsaSigner}})
+	hop := server.Hop("web")
+	hop.HostKey = ""
+	address := knownhosts.Normalize(hop.Address())
+
+	// known_hosts 只有 OpenSSH 记录的 ecdsa 密钥
+	os.MkdirAll(filepath.Dir(path), 0700)
+	if err := os.WriteFile(path, []byte(knownhosts.Line([]string{address}, ecdsaSigner.PublicKey())+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if algos := hostKeyAlgorithms(hop); len(algos) == 0 || algos[0] != ssh.KeyAlgoECDSA256 {
+		t.Errorf("algorithms = %v, want %s first", algos, ssh.KeyAlgoECDSA256)
+	}
+	if err := connectHop(hop); err != nil {
+		t.Fatalf("connect with ecdsa in known_hosts: %v", err)
+	}
+
+	// 只记录了 ed25519 时协商 ed25519，而不是默认顺序中靠前的 ecdsa
+	if err := os.WriteFile(path, []byte(knownhosts.Line([]string{address}, server.HostKey())+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := connectHop(hop); err != nil {
+		t.Fatalf("connect with ed25519 in known_hosts: %v", err)
+	}
+
+	// 固定的 host_key 只协商它的类型
+	hop.HostKey = string(ssh.MarshalAuthorizedKey(ecdsaSigner.PublicKey()))
+	if algos := hostKeyAlgorithms(hop); len(algos) != 1 || algos[0] != ssh.KeyAlgoECDSA256 {
+		t.Errorf("pinned algorithms = %v", algos)
+	}
+	if err := connectHop(hop); err != nil {
+		t.Fatalf("connect with pinned ecdsa key: %v", err)
+	}
+}
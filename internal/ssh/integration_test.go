@@ -0,0 +1,114 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/sshtest"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestChainThroughBastion(t *testing.T) {
+	bastion := sshtest.NewServer(t, sshtest.Options{})
+	target := sshtest.NewServer(t, sshtest.Options{})
+
+	chain := NewChain([]*types.Hop{bastion.Hop("bastion"), target.Hop("target")})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := chain.ConnectContext(ctx); err != nil {
+		t.Fatalf("ConnectContext: %v", err)
+	}
+	defer chain.Disconnect()
+
+	// 第二跳经由第一跳的 direct-tcpip 连接
+	if forwards := bastion.Forwards(); !slices.Contains(forwards, target.Addr()) {
+		t.Errorf("bastion forwards = %v, want %s", forwards, target.Addr())
+	}
+	stdout, _, err := chain.Execute("echo hello-$((1+1))")
+	if err != nil || strings.TrimSpace(stdout) != "hello-2" {
+		t.Errorf("Execute = %q, %v", stdout, err)
+	}
+	if commands := target.Commands(); len(commands) != 1 || len(bastion.Commands()) != 0 {
+		t.Errorf("commands ran on bastion %v, target %v", bastion.Commands(), commands)
+	}
+	if _, err := chain.LastHop().KeepAlive(ctx); err != nil {
+		t.Errorf("KeepAlive: %v", err)
+	}
+
+	// 失败的命令返回退出码
+	session, err := chain.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exitErr interface{ ExitStatus() int }
+	if err := session.Run("exit 3"); !errors.As(err, &exitErr) || exitErr.ExitStatus() != 3 {
+		t.Errorf("Run(exit 3) = %v", err)
+	}
+}
+
+func TestChainWrongPassword(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	hop := server.Hop("web")
+	hop.Password = "wrong"
+
+	chain := NewChain([]*types.Hop{hop})
+	err := chain.Connect()
+	if err == nil {
+		chain.Disconnect()
+		t.Fatal("connected with a wrong password")
+	}
+	var hopErr *HopError
+	if !errors.As(err, &hopErr) || hopErr.Kind != FailureAuth {
+		t.Errorf("error = %v, want an auth failure", err)
+	}
+}
+
+func TestExecOnlyServer(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{DenyPTY: true})
+	hop := server.Hop("exec-only")
+	chain := NewChain([]*types.Hop{hop})
+	if err := chain.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Disconnect()
+
+	session, err := chain.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err := chain.RequestPTY(session, "xterm", 24, 80, nil); !IsCapabilityError(err) {
+		t.Fatalf("RequestPTY = %v, want a capability error", err)
+	}
+	if !chain.ExecOnly() {
+		t.Error("server not remembered as exec-only")
+	}
+	// session 仍可用于 exec
+	if out, err := session.Output("echo ok"); err != nil || strings.TrimSpace(string(out)) != "ok" {
+		t.Errorf("exec after denied pty = %q, %v", out, err)
+	}
+}
+
+func TestChainClientVersion(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	hop := server.Hop("ips")
+	hop.ClientVersion = "OpenSSH_8.9p1"
+
+	chain := NewChain([]*types.Hop{hop})
+	if err := chain.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	chain.Disconnect()
+	if versions := server.ClientVersions(); !slices.Equal(versions, []string{"SSH-2.0-OpenSSH_8.9p1"}) {
+		t.Errorf("server saw client versions %q", versions)
+	}
+
+	hop.ClientVersion = "SSH-1.5-legacy"
+	if _, err := NewClient(hop); err == nil {
+		t.Error("NewClient accepted an SSH-1 client version")
+	}
+}
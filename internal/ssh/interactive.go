@@ -0,0 +1,123 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrInteractiveRequired 服务器要求键盘交互认证（如一次性验证码），但没有可用的询问方式
+var ErrInteractiveRequired = errors.New("server requires keyboard-interactive authentication (e.g. a one-time code), but no prompt is available")
+
+// Question 键盘交互认证中服务器提出的一个问题
+type Question struct {
+	Prompt string `json:"prompt"`
+	Echo   bool   `json:"echo"` // 输入是否可以回显，密码和验证码通常不回显
+}
+
+// Challenge 一轮键盘交互认证中需要用户回答的问题
+type Challenge struct {
+	Hop         string     `json:"hop"`
+	User        string     `json:"user"`
+	Instruction string     `json:"instruction,omitempty"`
+	Questions   []Question `json:"questions"`
+}
+
+// InteractivePrompt 把 challenge 交给用户回答，按顺序返回每个问题的答案
+type InteractivePrompt func(hop *types.Hop, challenge Challenge) ([]string, error)
+
+// interactivePrompt 没有按连接指定时使用的询问方式（CLI 在终端上询问），nil 表示不询问
+var interactivePrompt struct {
+	mu     sync.Mutex
+	prompt InteractivePrompt
+}
+
+// SetInteractivePrompt 设置键盘交互认证的默认询问方式，nil 表示不询问
+func SetInteractivePrompt(prompt InteractivePrompt) {
+	interactivePrompt.mu.Lock()
+	defer interactivePrompt.mu.Unlock()
+	interactivePrompt.prompt = prompt
+}
+
+func defaultInteractivePrompt() InteractivePrompt {
+	interactivePrompt.mu.Lock()
+	defer interactivePrompt.mu.Unlock()
+	return interactivePrompt.prompt
+}
+
+type interactivePromptKey struct{}
+
+// WithInteractivePrompt 返回携带 prompt 的 ctx：Chain.ConnectContext 用它回答本次连接各跳的键盘交互认证，
+// 优先于 SetInteractivePrompt（如 Web 终端经 WebSocket 询问打开终端的用户）
+func WithInteractivePrompt(ctx context.Context, prompt InteractivePrompt) context.Context {
+	return context.WithValue(ctx, interactivePromptKey{}, prompt)
+}
+
+func interactivePromptFrom(ctx context.Context) InteractivePrompt {
+	prompt, _ := ctx.Value(interactivePromptKey{}).(InteractivePrompt)
+	return prompt
+}
+
+// isPasswordQuestion 不回显的密码提示，可以用服务器保存的登录密码回答
+func isPasswordQuestion(question string, echo bool) bool {
+	q := strings.ToLower(question)
+	return !echo && (strings.Contains(q, "password") || strings.Contains(q, "密码"))
+}
+
+// keyboardInteractive 回答 hop 的键盘交互认证：密码提示用保存的登录密码回答，其余问题（验证码等）交给 resolve 返回的询问方式。
+// 没有询问方式时沿用以前的行为，用登录密码回答所有问题；也没有登录密码时返回 ErrInteractiveRequired
+func keyboardInteractive(hop *types.Hop, resolve func() InteractivePrompt) ssh.KeyboardInteractiveChallenge {
+	return func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+		password := ""
+		if hop.AuthType == types.AuthPassword {
+			password = hop.Password
+		}
+		answers := make([]string, len(questions))
+		var pending []int
+		for i, question := range questions {
+			if password != "" && isPasswordQuestion(question, echos[i]) {
+				answers[i] = password
+				continue
+			}
+			pending = append(pending, i)
+		}
+		if len(pending) == 0 {
+			return answers, nil
+		}
+
+		var prompt InteractivePrompt
+		if resolve != nil {
+			prompt = resolve()
+		}
+		if prompt == nil {
+			if password == "" {
+				return nil, fmt.Errorf("%s: %w", hop.Name, ErrInteractiveRequired)
+			}
+			for _, i := range pending {
+				answers[i] = password
+			}
+			return answers, nil
+		}
+
+		challenge := Challenge{Hop: hop.Name, User: user, Instruction: instruction}
+		for _, i := range pending {
+			challenge.Questions = append(challenge.Questions, Question{Prompt: questions[i], Echo: echos[i]})
+		}
+		replies, err := prompt(hop, challenge)
+		if err != nil {
+			return nil, fmt.Errorf("keyboard-interactive prompt for %s failed: %w", hop.Name, err)
+		}
+		if len(replies) != len(pending) {
+			return nil, fmt.Errorf("keyboard-interactive prompt for %s returned %d answers for %d questions", hop.Name, len(replies), len(pending))
+		}
+		for j, i := range pending {
+			answers[i] = replies[j]
+		}
+		return answers, nil
+	}
+}
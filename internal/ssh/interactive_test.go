@@ -0,0 +1,91 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/sshtest"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestChainKeyboardInteractiveOTP(t *testing.T) {
+	bastion := sshtest.NewServer(t, sshtest.Options{OTP: "123456"})
+	target := sshtest.NewServer(t, sshtest.Options{})
+	hops := []*types.Hop{bastion.Hop("bastion"), target.Hop("target")}
+
+	var challenges []Challenge
+	prompt := func(hop *types.Hop, challenge Challenge) ([]string, error) {
+		challenges = append(challenges, challenge)
+		return []string{"123456"}, nil
+	}
+	chain := NewChain(hops)
+	if err := chain.ConnectContext(WithInteractivePrompt(context.Background(), prompt)); err != nil {
+		t.Fatalf("ConnectContext: %v", err)
+	}
+	defer chain.Disconnect()
+	if stdout, _, err := chain.Execute("echo ok"); err != nil || strings.TrimSpace(stdout) != "ok" {
+		t.Errorf("Execute = %q, %v", stdout, err)
+	}
+	// 只有跳板机要求验证码，目标服务器不询问
+	if len(challenges) != 1 || challenges[0].Hop != "bastion" || len(challenges[0].Questions) != 1 ||
+		challenges[0].Questions[0] != (Question{Prompt: sshtest.OTPPrompt}) {
+		t.Errorf("challenges = %+v", challenges)
+	}
+
+	// 没有询问方式时用登录密码回答验证码，认证失败
+	err := NewChain(hops).Connect()
+	var hopErr *HopError
+	if !errors.As(err, &hopErr) || hopErr.Index != 0 || hopErr.Kind != FailureAuth {
+		t.Fatalf("without prompt: got %v", err)
+	}
+
+	// 默认询问方式（CLI 的终端）
+	SetInteractivePrompt(prompt)
+	t.Cleanup(func() { SetInteractivePrompt(nil) })
+	chain = NewChain(hops)
+	if err := chain.Connect(); err != nil {
+		t.Fatalf("Connect with default prompt: %v", err)
+	}
+	chain.Disconnect()
+}
+
+func TestKeyboardInteractiveAnswers(t *testing.T) {
+	passwordHop := &types.Hop{Name: "bastion", AuthType: types.AuthPassword, Password: "secret"}
+	keyHop := &types.Hop{Name: "jump", AuthType: types.AuthKey, KeyPath: "~/.ssh/id_ed25519"}
+	questions := []string{"Password: ", "OTP code: "}
+	echos := []bool{false, false}
+
+	// 密码提示用保存的密码回答，只把验证码交给用户
+	var asked []Question
+	prompt := func(hop *types.Hop, challenge Challenge) ([]string, error) {
+		asked = challenge.Questions
+		return []string{"654321"}, nil
+	}
+	answers, err := keyboardInteractive(passwordHop, func() InteractivePrompt { return prompt })("admin", "", questions, echos)
+	if err != nil || strings.Join(answers, ",") != "secret,654321" {
+		t.Errorf("answers = %v, %v", answers, err)
+	}
+	if len(asked) != 1 || asked[0].Prompt != "OTP code: " {
+		t.Errorf("asked = %+v", asked)
+	}
+
+	// 密钥认证的服务器没有询问方式时无法回答
+	if _, err := keyboardInteractive(keyHop, nil)("admin", "", questions, echos); !errors.Is(err, ErrInteractiveRequired) {
+		t.Errorf("key hop without prompt: got %v", err)
+	}
+	// 没有问题的一轮直接通过
+	if answers, err := keyboardInteractive(keyHop, nil)("admin", "Welcome", nil, nil); err != nil || len(answers) != 0 {
+		t.Errorf("empty round = %v, %v", answers, err)
+	}
+
+	short := func(*types.Hop, Challenge) ([]string, error) { return nil, nil }
+	if _, err := keyboardInteractive(keyHop, func() InteractivePrompt { return short })("admin", "", questions, echos); err == nil {
+		t.Error("missing answers should fail")
+	}
+	cancelled := func(*types.Hop, Challenge) ([]string, error) { return nil, context.Canceled }
+	if _, err := keyboardInteractive(keyHop, func() InteractivePrompt { return cancelled })("admin", "", questions, echos); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled prompt: got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package ssh
+
+import (
+	"log"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+	"golang.org/x/crypto/ssh"
+)
+
+// 开启 legacy_crypto 的服务器额外提供的旧算法，排在现代算法之后，只在对端不支持现代算法时才会被选中
+var (
+	legacyKeyExchanges = []string{
+		ssh.InsecureKeyExchangeDH14SHA1,
+		ssh.InsecureKeyExchangeDHGEXSHA1,
+		ssh.InsecureKeyExchangeDH1SHA1,
+	}
+	legacyCiphers = []string{ssh.InsecureCipherAES128CBC, ssh.InsecureCipherTripleDESCBC}
+	legacyMACs    = []string{ssh.HMACSHA1, ssh.InsecureHMACSHA196}
+)
+
+// LegacyCryptoUse 一次到开启了 legacy_crypto 的服务器的连接
+type LegacyCryptoUse struct {
+	Hop *types.Hop
+	// Negotiated 实际协商出的旧算法（含 ssh-rsa 主机密钥），为空时对端支持现代算法，可以关闭 legacy_crypto
+	Negotiated []string
+}
+
+// legacyCryptoHook 连接开启了 legacy_crypto 的服务器后的回调
+var legacyCryptoHook atomic.Pointer[func(LegacyCryptoUse)]
+
+// OnLegacyCrypto 设置连接开启了 legacy_crypto 的服务器后的回调（如写入审计日志），nil 取消
+func OnLegacyCrypto(fn func(LegacyCryptoUse)) {
+	if fn == nil {
+		legacyCryptoHook.Store(nil)
+		return
+	}
+	legacyCryptoHook.Store(&fn)
+}
+
+// withLegacyAlgorithms 在现代算法之后追加旧算法
+func withLegacyAlgorithms(config *ssh.Config) {
+	config.KeyExchanges = append(config.KeyExchanges, legacyKeyExchanges...)
+	config.Ciphers = append(config.Ciphers, legacyCiphers...)
+	config.MACs = append(config.MACs, legacyMACs...)
+}
+
+// legacyNegotiated 返回协商结果中的旧算法
+func legacyNegotiated(algs ssh.NegotiatedAlgorithms) []string {
+	var used []string
+	for _, alg := range []string{algs.KeyExchange, algs.HostKey, algs.Write.Cipher, algs.Read.Cipher, algs.Write.MAC, algs.Read.MAC} {
+		legacy := slices.Contains(legacyKeyExchanges, alg) || slices.Contains(legacyCiphers, alg) ||
+			slices.Contains(legacyMACs, alg) || alg == ssh.KeyAlgoRSA
+		if legacy && !slices.Contains(used, alg) {
+			used = append(used, alg)
+		}
+	}
+	return used
+}
+
+// noteLegacyCrypto 连接开启了 legacy_crypto 的服务器后输出警告并调用回调
+func noteLegacyCrypto(hop *types.Hop, conn ssh.Conn) {
+	if !hop.LegacyCrypto {
+		return
+	}
+	use := LegacyCryptoUse{Hop: hop}
+	if meta, ok := conn.(ssh.AlgorithmsConnMetadata); ok {
+		use.Negotiated = legacyNegotiated(meta.Algorithms())
+	}
+	if len(use.Negotiated) > 0 {
+		log.Printf("[SSH] WARNING: %s negotiated deprecated algorithms (%s) because legacy_crypto is enabled", hop.Name, strings.Join(use.Negotiated, ", "))
+	} else {
+		log.Printf("[SSH] WARNING: %s has legacy_crypto enabled but negotiated modern algorithms; consider turning it off", hop.Name)
+	}
+	if fn := legacyCryptoHook.Load(); fn != nil {
+		(*fn)(use)
+	}
+}
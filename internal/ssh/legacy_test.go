@@ -0,0 +1,64 @@
+package ssh
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/sshtest"
+	"github.com/luobobo896/HSSH/pkg/types"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestLegacyAlgorithms(t *testing.T) {
+	hop := &types.Hop{User: "root", AuthType: types.AuthPassword, Password: "x"}
+	modern, err := buildSSHConfig(hop, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(modern.KeyExchanges, ssh.InsecureKeyExchangeDH14SHA1) || slices.Contains(modern.Ciphers, ssh.InsecureCipherAES128CBC) {
+		t.Fatalf("deprecated algorithms offered without legacy_crypto: %v %v", modern.KeyExchanges, modern.Ciphers)
+	}
+
+	hop.LegacyCrypto = true
+	legacy, err := buildSSHConfig(hop, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 旧算法排在现代算法之后
+	if !slices.Equal(legacy.KeyExchanges[:len(modern.KeyExchanges)], modern.KeyExchanges) ||
+		!slices.Contains(legacy.KeyExchanges, ssh.InsecureKeyExchangeDH14SHA1) ||
+		!slices.Contains(legacy.Ciphers, ssh.InsecureCipherTripleDESCBC) || !slices.Contains(legacy.MACs, ssh.HMACSHA1) {
+		t.Errorf("legacy config = %v %v %v", legacy.KeyExchanges, legacy.Ciphers, legacy.MACs)
+	}
+
+	used := legacyNegotiated(ssh.NegotiatedAlgorithms{
+		KeyExchange: ssh.InsecureKeyExchangeDH14SHA1,
+		HostKey:     ssh.KeyAlgoRSA,
+		Read:        ssh.DirectionAlgorithms{Cipher: ssh.InsecureCipherAES128CBC, MAC: ssh.HMACSHA1},
+		Write:       ssh.DirectionAlgorithms{Cipher: ssh.InsecureCipherAES128CBC, MAC: ssh.HMACSHA1},
+	})
+	if !slices.Equal(used, []string{"diffie-hellman-group14-sha1", "ssh-rsa", "aes128-cbc", "hmac-sha1"}) {
+		t.Errorf("negotiated legacy = %v", used)
+	}
+}
+
+func TestLegacyCryptoHook(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	var uses []LegacyCryptoUse
+	OnLegacyCrypto(func(use LegacyCryptoUse) { uses = append(uses, use) })
+	defer OnLegacyCrypto(nil)
+
+	hop := server.Hop("switch")
+	for _, legacy := range []bool{false, true} {
+		hop.LegacyCrypto = legacy
+		chain := NewChain([]*types.Hop{hop})
+		if err := chain.Connect(); err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+		chain.Disconnect()
+	}
+	// 只有开启 legacy_crypto 的连接触发回调；对端支持现代算法，不会协商出旧算法
+	if len(uses) != 1 || uses[0].Hop != hop || len(uses[0].Negotiated) != 0 {
+		t.Errorf("uses = %+v", uses)
+	}
+}
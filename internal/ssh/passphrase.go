@@ -0,0 +1,197 @@
+package ssh
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrKeyPassphraseRequired 私钥已加密，但没有可用的口令
+var ErrKeyPassphraseRequired = errors.New("private key is encrypted, a passphrase is required")
+
+// ErrKeyPassphraseWrong 私钥口令错误
+var ErrKeyPassphraseWrong = errors.New("wrong private key passphrase")
+
+// ErrKeyNotEncrypted 私钥没有加密，不需要口令
+var ErrKeyNotEncrypted = errors.New("private key is not encrypted")
+
+// keyPassphraseEnvPrefix key_passphrase 以此开头时从后面的环境变量读取口令，配置中不保存口令本身
+const keyPassphraseEnvPrefix = "env:"
+
+// maxPassphrasePrompts 交互式输入口令的次数
+const maxPassphrasePrompts = 3
+
+// PassphrasePrompt 询问 hop 使用的加密私钥的口令，返回空字符串表示放弃
+type PassphrasePrompt func(hop *types.Hop) (string, error)
+
+// keyPassphrases 本进程中已解锁的私钥口令，按展开后的私钥路径记录，只保存在内存中。
+// prompt 为 nil 时不交互（gmssh web 等服务进程），口令须通过 UnlockKey 提供
+var keyPassphrases struct {
+	mu     sync.Mutex
+	byPath map[string]string
+	prompt PassphrasePrompt
+}
+
+// promptMu 串行化交互式输入，并发连接使用同一私钥的多跳时只询问一次
+var promptMu sync.Mutex
+
+// SetPassphrasePrompt 设置加密私钥没有可用口令时的询问方式，nil 表示不询问、直接返回 ErrKeyPassphraseRequired
+func SetPassphrasePrompt(prompt PassphrasePrompt) {
+	keyPassphrases.mu.Lock()
+	defer keyPassphrases.mu.Unlock()
+	keyPassphrases.prompt = prompt
+}
+
+// ParsePrivateKeyWithPassphrase 解析私钥：未加密的私钥忽略 passphrase；
+// 加密的私钥在 passphrase 为空时返回 ErrKeyPassphraseRequired，口令错误时返回 ErrKeyPassphraseWrong
+func ParsePrivateKeyWithPassphrase(key []byte, passphrase string) (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return signer, err
+	}
+	if passphrase == "" {
+		return nil, ErrKeyPassphraseRequired
+	}
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, ErrKeyPassphraseWrong
+	}
+	return signer, err
+}
+
+// configuredPassphrase 服务器配置的私钥口令，env:NAME 从环境变量读取
+func configuredPassphrase(hop *types.Hop) (string, error) {
+	name, fromEnv := strings.CutPrefix(hop.KeyPassphrase, keyPassphraseEnvPrefix)
+	if !fromEnv {
+		return hop.KeyPassphrase, nil
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s for the key passphrase of %s is not set", name, hop.Name)
+	}
+	return value, nil
+}
+
+// loadKeySigner 读取并解析 hop 的私钥。加密私钥的口令依次取服务器配置、本进程已解锁的口令和交互式输入
+func loadKeySigner(hop *types.Hop) (ssh.Signer, error) {
+	path := expandPath(hop.KeyPath)
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	signer, err := ParsePrivateKeyWithPassphrase(key, "")
+	if !errors.Is(err, ErrKeyPassphraseRequired) {
+		return signer, err
+	}
+
+	if hop.KeyPassphrase != "" {
+		passphrase, err := configuredPassphrase(hop)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ParsePrivateKeyWithPassphrase(key, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return signer, nil
+	}
+
+	if signer, ok := cachedSigner(path, key); ok {
+		return signer, nil
+	}
+
+	keyPassphrases.mu.Lock()
+	prompt := keyPassphrases.prompt
+	keyPassphrases.mu.Unlock()
+	if prompt == nil {
+		return nil, fmt.Errorf("%s: %w", path, ErrKeyPassphraseRequired)
+	}
+
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	// 等待期间其他连接可能已经解锁了同一私钥
+	if signer, ok := cachedSigner(path, key); ok {
+		return signer, nil
+	}
+	// 口令错误时重新询问，输入为空表示放弃
+	for i := 0; i < maxPassphrasePrompts; i++ {
+		passphrase, promptErr := prompt(hop)
+		if promptErr != nil {
+			return nil, fmt.Errorf("failed to read key passphrase: %w", promptErr)
+		}
+		if passphrase == "" {
+			err = ErrKeyPassphraseRequired
+			break
+		}
+		if signer, err = ParsePrivateKeyWithPassphrase(key, passphrase); err == nil {
+			rememberPassphrase(path, passphrase)
+			return signer, nil
+		}
+		if !errors.Is(err, ErrKeyPassphraseWrong) {
+			break
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", path, err)
+}
+
+// cachedSigner 用本进程已解锁的口令解析私钥；口令已失效（私钥被替换）时丢弃
+func cachedSigner(path string, key []byte) (ssh.Signer, bool) {
+	keyPassphrases.mu.Lock()
+	passphrase, ok := keyPassphrases.byPath[path]
+	keyPassphrases.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	signer, err := ParsePrivateKeyWithPassphrase(key, passphrase)
+	if err != nil {
+		keyPassphrases.mu.Lock()
+		delete(keyPassphrases.byPath, path)
+		keyPassphrases.mu.Unlock()
+		return nil, false
+	}
+	return signer, true
+}
+
+func rememberPassphrase(path, passphrase string) {
+	keyPassphrases.mu.Lock()
+	defer keyPassphrases.mu.Unlock()
+	if keyPassphrases.byPath == nil {
+		keyPassphrases.byPath = make(map[string]string)
+	}
+	keyPassphrases.byPath[path] = passphrase
+}
+
+// UnlockKey 校验 hop 所用加密私钥的口令，正确时在本进程内记住（不写入配置），之后使用同一私钥的服务器都不再需要口令。
+// 私钥未加密时返回 ErrKeyNotEncrypted，口令错误时返回 ErrKeyPassphraseWrong
+func UnlockKey(hop *types.Hop, passphrase string) error {
+	if hop.AuthType != types.AuthKey || hop.KeyPath == "" {
+		return ErrKeyNotEncrypted
+	}
+	path := expandPath(hop.KeyPath)
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read key file: %w", err)
+	}
+	if _, err := ssh.ParsePrivateKey(key); err == nil {
+		return ErrKeyNotEncrypted
+	}
+	if _, err := ParsePrivateKeyWithPassphrase(key, passphrase); err != nil {
+		return err
+	}
+	rememberPassphrase(path, passphrase)
+	return nil
+}
+
+// LockKeys 忘记本进程中已解锁的全部口令
+func LockKeys() {
+	keyPassphrases.mu.Lock()
+	defer keyPassphrases.mu.Unlock()
+	keyPassphrases.byPath = nil
+}
@@ -0,0 +1,148 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/sshtest"
+	"github.com/luobobo896/HSSH/pkg/types"
+	"golang.org/x/crypto/ssh"
+)
+
+// writeEncryptedKey 生成 ed25519 私钥，以 passphrase 加密写入临时文件，返回路径和公钥
+func writeEncryptedKey(t *testing.T, passphrase string) (string, ssh.PublicKey) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, signer.PublicKey()
+}
+
+// usePassphrasePrompt 在测试期间替换口令询问，并清空已解锁的口令
+func usePassphrasePrompt(t *testing.T, prompt PassphrasePrompt) {
+	t.Helper()
+	LockKeys()
+	SetPassphrasePrompt(prompt)
+	t.Cleanup(func() {
+		SetPassphrasePrompt(nil)
+		LockKeys()
+	})
+}
+
+func TestParsePrivateKeyWithPassphrase(t *testing.T) {
+	path, pub := writeEncryptedKey(t, "s3cret")
+	key, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePrivateKeyWithPassphrase(key, ""); !errors.Is(err, ErrKeyPassphraseRequired) {
+		t.Errorf("no passphrase: got %v", err)
+	}
+	if _, err := ParsePrivateKeyWithPassphrase(key, "wrong"); !errors.Is(err, ErrKeyPassphraseWrong) {
+		t.Errorf("wrong passphrase: got %v", err)
+	}
+	signer, err := ParsePrivateKeyWithPassphrase(key, "s3cret")
+	if err != nil || string(signer.PublicKey().Marshal()) != string(pub.Marshal()) {
+		t.Fatalf("right passphrase: %v", err)
+	}
+
+	// 未加密的私钥忽略口令
+	_, plain, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKey(plain, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePrivateKeyWithPassphrase(pem.EncodeToMemory(block), "ignored"); err != nil {
+		t.Errorf("plain key: %v", err)
+	}
+}
+
+func TestEncryptedKeyAuth(t *testing.T) {
+	path, pub := writeEncryptedKey(t, "s3cret")
+	server := sshtest.NewServer(t, sshtest.Options{AuthorizedKey: pub})
+	newHop := func() *types.Hop {
+		hop := server.Hop("target")
+		hop.AuthType = types.AuthKey
+		hop.KeyPath = path
+		hop.Password = ""
+		return hop
+	}
+
+	// 不交互时没有口令直接失败，失败原因可识别
+	usePassphrasePrompt(t, nil)
+	err := NewChain([]*types.Hop{newHop()}).Connect()
+	var hopErr *HopError
+	if !errors.As(err, &hopErr) || hopErr.Kind != FailureKeyPassphrase || !errors.Is(err, ErrKeyPassphraseRequired) {
+		t.Fatalf("expected key_passphrase failure, got %v", err)
+	}
+
+	// 配置的口令，env:NAME 从环境变量读取
+	hop := newHop()
+	hop.KeyPassphrase = "env:HSSH_TEST_KEY_PASSPHRASE"
+	if err := connectHop(hop); err == nil {
+		t.Error("expected an error for an unset environment variable")
+	}
+	t.Setenv("HSSH_TEST_KEY_PASSPHRASE", "s3cret")
+	if err := connectHop(hop); err != nil {
+		t.Fatalf("passphrase from env: %v", err)
+	}
+	hop.KeyPassphrase = "wrong"
+	if err := NewChain([]*types.Hop{hop}).Connect(); !errors.Is(err, ErrKeyPassphraseWrong) {
+		t.Errorf("wrong configured passphrase: got %v", err)
+	}
+
+	// 交互式输入：输错后重新询问，解锁后同一私钥不再询问
+	answers := []string{"wrong", "s3cret"}
+	prompts := 0
+	usePassphrasePrompt(t, func(*types.Hop) (string, error) {
+		prompts++
+		if len(answers) == 0 {
+			return "", nil
+		}
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, nil
+	})
+	for i := 0; i < 2; i++ {
+		if err := connectHop(newHop()); err != nil {
+			t.Fatalf("connect %d with prompt: %v", i, err)
+		}
+	}
+	if prompts != 2 {
+		t.Errorf("prompted %d times, want 2", prompts)
+	}
+
+	// 服务进程通过 UnlockKey 提供口令
+	usePassphrasePrompt(t, nil)
+	hop = newHop()
+	if err := UnlockKey(hop, "wrong"); !errors.Is(err, ErrKeyPassphraseWrong) {
+		t.Errorf("UnlockKey with wrong passphrase: got %v", err)
+	}
+	if err := UnlockKey(hop, "s3cret"); err != nil {
+		t.Fatalf("UnlockKey: %v", err)
+	}
+	if err := connectHop(hop); err != nil {
+		t.Fatalf("connect after unlock: %v", err)
+	}
+	if err := UnlockKey(server.Hop("password"), "x"); !errors.Is(err, ErrKeyNotEncrypted) {
+		t.Errorf("UnlockKey on a password server: got %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ReconnectPolicy 链路断开后重连的退避策略
+type ReconnectPolicy struct {
+	InitialDelay time.Duration // 第一次重连前的等待
+	MaxDelay     time.Duration // 等待时间的上限
+	Multiplier   float64       // 每次失败后等待时间的倍数
+	Jitter       float64       // 等待时间上下随机浮动的比例（0-1），避免多条链同时重连
+	MaxAttempts  int           // 放弃前最多重连的次数，为 0 时不限
+	// KeepAliveInterval 经整条链向最后一跳发送 keepalive 的间隔，用于发现没有 RST 的静默断开，为 0 时不发送
+	KeepAliveInterval time.Duration
+	KeepAliveTimeout  time.Duration // 单次 keepalive 等待回复的时间
+}
+
+// DefaultReconnectPolicy 默认重连策略：1s 起按 2 倍退避，最长 30s，浮动 20%，不限次数
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		InitialDelay:      time.Second,
+		MaxDelay:          30 * time.Second,
+		Multiplier:        2,
+		Jitter:            0.2,
+		KeepAliveInterval: 30 * time.Second,
+		KeepAliveTimeout:  10 * time.Second,
+	}
+}
+
+// Delay 第 attempt 次（从 1 开始）重连前的等待时间
+func (p ReconnectPolicy) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+// ChainEventKind 链路状态变化的类型
+type ChainEventKind string
+
+const (
+	ChainLost     ChainEventKind = "lost"     // 某一跳断开，链上的连接都已失效
+	ChainRetry    ChainEventKind = "retry"    // 一次重连失败，稍后再试
+	ChainRestored ChainEventKind = "restored" // 重连成功，可以经链路重新拨号和开会话
+	ChainGaveUp   ChainEventKind = "gave_up"  // 达到 MaxAttempts，链保持断开
+)
+
+// ChainEvent 链路状态变化
+type ChainEvent struct {
+	Kind    ChainEventKind
+	Hop     string        // 断开时最先发现断开的一跳
+	Attempt int           // 重连的次数，ChainLost 时为 0
+	Next    time.Duration // ChainLost/ChainRetry：下一次重连前的等待
+	Err     error
+}
+
+// chainSub 一个链路状态订阅
+type chainSub struct {
+	id uint64
+	fn func(ChainEvent)
+}
+
+// Subscribe 登记链路状态变化的回调，回调在监督 goroutine 中按登记顺序调用，不能阻塞；
+// 返回取消登记的函数。只有调用过 Monitor 或 Supervise 的链才会产生事件
+func (c *Chain) Subscribe(fn func(ChainEvent)) func() {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	c.nextSub++
+	id := c.nextSub
+	c.subs = append(c.subs, chainSub{id: id, fn: fn})
+	return func() {
+		c.subsMu.Lock()
+		defer c.subsMu.Unlock()
+		c.subs = slices.DeleteFunc(c.subs, func(sub chainSub) bool { return sub.id == id })
+	}
+}
+
+// emit 通知订阅者
+func (c *Chain) emit(event ChainEvent) {
+	c.subsMu.Lock()
+	subs := slices.Clone(c.subs)
+	c.subsMu.Unlock()
+	for _, sub := range subs {
+		sub.fn(event)
+	}
+}
+
+// Monitor 只检测断开：任一跳的连接关闭后通知 ChainLost，链保持断开，不重连。
+// 与 Supervise 一样需在连接成功后调用，重复调用无效，Disconnect 或 ctx 取消后停止
+func (c *Chain) Monitor(ctx context.Context) {
+	c.watch(ctx, nil)
+}
+
+// Supervise 启动重连监督：任一跳断开（连接关闭或 keepalive 超时）后关闭整条链，按 policy 退避并加随机抖动重新逐跳连接，
+// 成功后替换链上的连接并通知 ChainRestored，之后的 Dial、NewSession 使用新的连接；
+// 超过 MaxAttempts 时通知 ChainGaveUp。需在连接成功后调用，重复调用无效，Disconnect 或 ctx 取消后停止
+func (c *Chain) Supervise(ctx context.Context, policy ReconnectPolicy) {
+	c.watch(ctx, &policy)
+}
+
+// watch 启动监督 goroutine，policy 为 nil 时只检测断开
+func (c *Chain) watch(ctx context.Context, policy *ReconnectPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopWatch != nil || !c.connected {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c.stopWatch = cancel
+	go c.superviseLoop(ctx, policy)
+}
+
+// superviseLoop 等待断开，然后重连，直到 ctx 取消或放弃
+func (c *Chain) superviseLoop(ctx context.Context, policy *ReconnectPolicy) {
+	for {
+		hop, err := c.waitLost(ctx, policy)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// 关闭断开的链上剩余的连接，期间的 Dial 直接失败
+		c.mu.Lock()
+		c.closeClientsLocked()
+		c.mu.Unlock()
+		untrackChain(c)
+		c.logf("[SSH] Chain lost at %s: %v", hop, err)
+
+		if policy == nil {
+			c.emit(ChainEvent{Kind: ChainLost, Hop: hop, Err: err})
+			return
+		}
+		if !c.reconnect(ctx, *policy, hop, err) {
+			return
+		}
+	}
+}
+
+// reconnect 按 policy 重连，成功时返回 true
+func (c *Chain) reconnect(ctx context.Context, policy ReconnectPolicy, hop string, lostErr error) bool {
+	next := policy.Delay(1)
+	c.emit(ChainEvent{Kind: ChainLost, Hop: hop, Next: next, Err: lostErr})
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(next)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+
+		// 在新的链上逐跳连接，成功后整体替换，已经拿到的旧连接不受影响
+		fresh := &Chain{hops: c.hops, logger: c.logger}
+		err := fresh.ConnectContext(ctx)
+		if err == nil {
+			untrackChain(fresh)
+			c.mu.Lock()
+			if ctx.Err() != nil {
+				// 重连期间调用了 Disconnect
+				c.mu.Unlock()
+				fresh.Disconnect()
+				return false
+			}
+			c.clients = fresh.clients
+			c.dials = fresh.dials
+			c.connected = true
+			c.mu.Unlock()
+			trackChain(c)
+			c.logf("[SSH] Chain restored after %d attempt(s)", attempt)
+			c.emit(ChainEvent{Kind: ChainRestored, Attempt: attempt})
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			c.logf("[SSH] Giving up on chain after %d attempt(s): %v", attempt, err)
+			c.emit(ChainEvent{Kind: ChainGaveUp, Attempt: attempt, Err: err})
+			return false
+		}
+		next = policy.Delay(attempt + 1)
+		c.emit(ChainEvent{Kind: ChainRetry, Attempt: attempt, Next: next, Err: err})
+	}
+}
+
+// waitLost 等待任一跳的连接关闭或 keepalive 失败，返回最先发现断开的一跳；ctx 取消时返回空
+func (c *Chain) waitLost(ctx context.Context, policy *ReconnectPolicy) (string, error) {
+	// 各跳的连接在 mu 下读取，之后 Disconnect 关闭它们时 Wait 返回
+	c.mu.RLock()
+	underlyings := make([]*ssh.Client, len(c.clients))
+	for i, client := range c.clients {
+		underlyings[i] = client.GetUnderlyingClient()
+	}
+	c.mu.RUnlock()
+
+	type lost struct {
+		hop string
+		err error
+	}
+	// 缓冲足够所有 goroutine 写入，链关闭后它们都会退出
+	lostCh := make(chan lost, len(underlyings)+1)
+	for i, underlying := range underlyings {
+		hop := c.hops[i].Name
+		if underlying == nil {
+			lostCh <- lost{hop, fmt.Errorf("not connected")}
+			continue
+		}
+		go func() {
+			err := underlying.Wait()
+			if err == nil {
+				err = fmt.Errorf("connection closed")
+			}
+			lostCh <- lost{hop, err}
+		}()
+	}
+
+	var tick <-chan time.Time
+	last := len(underlyings) - 1
+	if policy != nil && policy.KeepAliveInterval > 0 && last >= 0 && underlyings[last] != nil {
+		ticker := time.NewTicker(policy.KeepAliveInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return "", nil
+		case l := <-lostCh:
+			return l.hop, l.err
+		case <-tick:
+			// keepalive 经过整条链，任一跳静默断开都会超时
+			timeout := policy.KeepAliveTimeout
+			if timeout <= 0 {
+				timeout = policy.KeepAliveInterval
+			}
+			kctx, cancel := context.WithTimeout(ctx, timeout)
+			_, err := keepAlive(kctx, underlyings[last])
+			cancel()
+			if err != nil && ctx.Err() == nil {
+				return c.hops[last].Name, err
+			}
+		}
+	}
+}
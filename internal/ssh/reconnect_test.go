@@ -0,0 +1,104 @@
+package ssh
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/sshtest"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	policy := ReconnectPolicy{InitialDelay: time.Second, MaxDelay: 10 * time.Second, Multiplier: 2}
+	for attempt, want := range map[int]time.Duration{0: time.Second, 1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 50: 10 * time.Second} {
+		if got := policy.Delay(attempt); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+
+	// 抖动在 ±Jitter 范围内
+	policy.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if d := policy.Delay(2); d < 1600*time.Millisecond || d > 2400*time.Millisecond {
+			t.Fatalf("Delay(2) with jitter = %v, want within 20%% of 2s", d)
+		}
+	}
+}
+
+func TestSuperviseReconnectsAfterHopDrop(t *testing.T) {
+	bastion := sshtest.NewServer(t, sshtest.Options{})
+	target := sshtest.NewServer(t, sshtest.Options{})
+
+	chain := NewChain([]*types.Hop{bastion.Hop("bastion"), target.Hop("target")})
+	if err := chain.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Disconnect()
+
+	events := make(chan ChainEvent, 16)
+	chain.Subscribe(func(event ChainEvent) { events <- event })
+	chain.Supervise(context.Background(), ReconnectPolicy{InitialDelay: 50 * time.Millisecond, Multiplier: 2, MaxAttempts: 5})
+
+	// 中间的跳板断开，整条链随之失效
+	bastion.DropConnections()
+	if event := waitChainEvent(t, events); event.Kind != ChainLost {
+		t.Fatalf("first event = %+v, want lost", event)
+	}
+	if event := waitChainEvent(t, events); event.Kind != ChainRestored || event.Attempt != 1 {
+		t.Fatalf("second event = %+v, want restored on the first attempt", event)
+	}
+
+	if !chain.IsConnected() {
+		t.Fatal("chain not connected after restore")
+	}
+	stdout, _, err := chain.Execute("echo back")
+	if err != nil || strings.TrimSpace(stdout) != "back" {
+		t.Errorf("Execute after restore = %q, %v", stdout, err)
+	}
+
+	// Disconnect 之后的断开不再重连
+	chain.Disconnect()
+	select {
+	case event := <-events:
+		t.Errorf("event after Disconnect: %+v", event)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestMonitorReportsLostChain(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	chain := NewChain([]*types.Hop{server.Hop("web")})
+	if err := chain.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Disconnect()
+
+	events := make(chan ChainEvent, 4)
+	chain.Subscribe(func(event ChainEvent) { events <- event })
+	chain.Monitor(context.Background())
+
+	server.DropConnections()
+	if event := waitChainEvent(t, events); event.Kind != ChainLost || event.Hop != "web" {
+		t.Fatalf("event = %+v, want lost at web", event)
+	}
+	if chain.IsConnected() {
+		t.Error("monitored chain still reports connected")
+	}
+	if _, err := chain.Dial("tcp", server.Addr()); err == nil {
+		t.Error("Dial succeeded on a lost chain")
+	}
+}
+
+// waitChainEvent 等待下一个链路事件
+func waitChainEvent(t *testing.T, events <-chan ChainEvent) ChainEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(10 * time.Second):
+		t.Fatal("no chain event")
+		return ChainEvent{}
+	}
+}
@@ -0,0 +1,48 @@
+package ssh
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ChainInfo 已建立连接链的诊断信息
+type ChainInfo struct {
+	Hops        []string  `json:"hops"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// activeChains 记录进程内所有已连接、尚未断开的链，用于排查泄漏或卡住的连接
+var activeChains = struct {
+	chains map[*Chain]time.Time
+	mu     sync.Mutex
+}{chains: make(map[*Chain]time.Time)}
+
+func trackChain(c *Chain) {
+	activeChains.mu.Lock()
+	defer activeChains.mu.Unlock()
+	activeChains.chains[c] = time.Now()
+}
+
+func untrackChain(c *Chain) {
+	activeChains.mu.Lock()
+	defer activeChains.mu.Unlock()
+	delete(activeChains.chains, c)
+}
+
+// ActiveChains 返回当前已连接的链，按连接时间从早到晚排序
+func ActiveChains() []ChainInfo {
+	activeChains.mu.Lock()
+	defer activeChains.mu.Unlock()
+
+	infos := make([]ChainInfo, 0, len(activeChains.chains))
+	for c, connectedAt := range activeChains.chains {
+		hops := make([]string, len(c.hops))
+		for i, hop := range c.hops {
+			hops[i] = hop.Name
+		}
+		infos = append(infos, ChainInfo{Hops: hops, ConnectedAt: connectedAt})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ConnectedAt.Before(infos[j].ConnectedAt) })
+	return infos
+}
@@ -0,0 +1,214 @@
+package ssh
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+	"golang.org/x/crypto/ssh"
+)
+
+// 登录阶段
+const (
+	PhaseTCP     = "tcp"     // 建立 TCP 连接（经跳板时为在上一跳打开 direct-tcpip 通道）
+	PhaseKex     = "kex"     // 版本交换和密钥交换，到主机密钥校验完成
+	PhaseAuth    = "auth"    // 用户认证
+	PhaseChannel = "channel" // 打开会话通道
+	PhaseShell   = "shell"   // 请求 PTY 并启动 shell 或命令
+)
+
+// LoginPhases 按发生顺序排列的登录阶段
+var LoginPhases = []string{PhaseTCP, PhaseKex, PhaseAuth, PhaseChannel, PhaseShell}
+
+// LoginTiming 一次连接中各阶段的耗时
+type LoginTiming struct {
+	TCP  time.Duration
+	Kex  time.Duration
+	Auth time.Duration
+}
+
+// String 返回用于日志的简要说明
+func (t LoginTiming) String() string {
+	return fmt.Sprintf("tcp %s, kex %s, auth %s", roundMs(t.TCP), roundMs(t.Kex), roundMs(t.Auth))
+}
+
+// PhaseStats 一个登录阶段的统计，单位毫秒
+type PhaseStats struct {
+	Count  int     `json:"count"`
+	LastMs float64 `json:"last_ms"`
+	AvgMs  float64 `json:"avg_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// LoginStats 一个服务器在本进程内的登录耗时统计
+type LoginStats struct {
+	ID        string                `json:"id"`
+	Name      string                `json:"name"`
+	Logins    int                   `json:"logins"` // 认证成功的次数
+	LastLogin time.Time             `json:"last_login,omitzero"`
+	Phases    map[string]PhaseStats `json:"phases"` // 键为 Phase*，没有记录的阶段不出现
+}
+
+// phaseTotals 一个阶段的累计值
+type phaseTotals struct {
+	count     int
+	last, max time.Duration
+	total     time.Duration
+}
+
+// loginRecord 一个服务器的累计值
+type loginRecord struct {
+	id, name  string
+	logins    int
+	lastLogin time.Time
+	phases    map[string]*phaseTotals
+}
+
+// loginTimings 进程内所有服务器的登录耗时，以服务器 ID（没有 ID 时为名称）为键
+var loginTimings = struct {
+	hops map[string]*loginRecord
+	mu   sync.Mutex
+}{hops: make(map[string]*loginRecord)}
+
+// hopKey 服务器在统计中的键
+func hopKey(hop *types.Hop) string {
+	if hop.ID != "" {
+		return hop.ID
+	}
+	return hop.Name
+}
+
+// RecordLoginPhase 记录 hop 的一个登录阶段耗时
+func RecordLoginPhase(hop *types.Hop, phase string, d time.Duration) {
+	loginTimings.mu.Lock()
+	defer loginTimings.mu.Unlock()
+
+	rec := loginTimings.hops[hopKey(hop)]
+	if rec == nil {
+		rec = &loginRecord{phases: make(map[string]*phaseTotals)}
+		loginTimings.hops[hopKey(hop)] = rec
+	}
+	rec.id, rec.name = hop.ID, hop.Name
+
+	totals := rec.phases[phase]
+	if totals == nil {
+		totals = &phaseTotals{}
+		rec.phases[phase] = totals
+	}
+	totals.count++
+	totals.last = d
+	totals.total += d
+	if d > totals.max {
+		totals.max = d
+	}
+	if phase == PhaseAuth {
+		rec.logins++
+		rec.lastLogin = time.Now()
+	}
+}
+
+// recordLogin 记录一次连接的 TCP、密钥交换和认证耗时
+func recordLogin(hop *types.Hop, t LoginTiming) {
+	RecordLoginPhase(hop, PhaseTCP, t.TCP)
+	RecordLoginPhase(hop, PhaseKex, t.Kex)
+	RecordLoginPhase(hop, PhaseAuth, t.Auth)
+}
+
+// LoginTimings 返回服务器（按 ID 或名称）的登录耗时统计，没有记录时 Phases 为空
+func LoginTimings(hop *types.Hop) LoginStats {
+	loginTimings.mu.Lock()
+	defer loginTimings.mu.Unlock()
+
+	rec := loginTimings.hops[hopKey(hop)]
+	if rec == nil {
+		return LoginStats{ID: hop.ID, Name: hop.Name, Phases: map[string]PhaseStats{}}
+	}
+	return rec.stats()
+}
+
+// AllLoginTimings 返回所有有记录的服务器的登录耗时统计，按名称排序
+func AllLoginTimings() []LoginStats {
+	loginTimings.mu.Lock()
+	defer loginTimings.mu.Unlock()
+
+	all := make([]LoginStats, 0, len(loginTimings.hops))
+	for _, rec := range loginTimings.hops {
+		all = append(all, rec.stats())
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// stats 转换为输出格式，调用方持有锁
+func (r *loginRecord) stats() LoginStats {
+	stats := LoginStats{ID: r.id, Name: r.name, Logins: r.logins, LastLogin: r.lastLogin, Phases: make(map[string]PhaseStats, len(r.phases))}
+	for phase, t := range r.phases {
+		stats.Phases[phase] = PhaseStats{
+			Count:  t.count,
+			LastMs: ms(t.last),
+			AvgMs:  ms(t.total / time.Duration(t.count)),
+			MaxMs:  ms(t.max),
+		}
+	}
+	return stats
+}
+
+// handshake 在已建立的 conn 上完成 SSH 握手和认证，返回密钥交换和认证各自的耗时
+func handshake(conn net.Conn, addr string, config *ssh.ClientConfig) (ssh.Conn, <-chan ssh.NewChannel, <-chan *ssh.Request, time.Duration, time.Duration, error) {
+	start := time.Now()
+	var kexDone time.Time
+
+	// 主机密钥在密钥交换完成时校验，以此分隔 kex 与 auth
+	cfg := *config
+	verify := cfg.HostKeyCallback
+	cfg.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if kexDone.IsZero() {
+			kexDone = time.Now()
+		}
+		return verify(hostname, remote, key)
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, &cfg)
+	end := time.Now()
+	logHandshake(addr, &cfg, c, err)
+	if kexDone.IsZero() {
+		return c, chans, reqs, end.Sub(start), 0, err
+	}
+	return c, chans, reqs, kexDone.Sub(start), end.Sub(kexDone), err
+}
+
+// logHandshake 记录握手使用的版本串和协商出的算法，便于排查与老旧设备或 IPS 的握手失败；
+// 失败时 x/crypto 的错误中已列出双方提供的算法
+func logHandshake(addr string, config *ssh.ClientConfig, conn ssh.Conn, err error) {
+	version := config.ClientVersion
+	if version == "" {
+		version = "default"
+	}
+	if err != nil {
+		log.Printf("[SSH] Handshake with %s failed (client version %s): %v", addr, version, err)
+		return
+	}
+	line := fmt.Sprintf("[SSH] Handshake with %s (%s, client version %s)", addr, conn.ServerVersion(), version)
+	if meta, ok := conn.(ssh.AlgorithmsConnMetadata); ok {
+		algs := meta.Algorithms()
+		line += fmt.Sprintf(": kex %s, host key %s, cipher %s/%s", algs.KeyExchange, algs.HostKey, algs.Write.Cipher, algs.Read.Cipher)
+		if algs.Write.MAC != "" { // AEAD 密码不单独协商 MAC
+			line += fmt.Sprintf(", mac %s/%s", algs.Write.MAC, algs.Read.MAC)
+		}
+	}
+	log.Print(line)
+}
+
+// ms 转换为毫秒，保留一位小数
+func ms(d time.Duration) float64 {
+	return float64(d.Round(100*time.Microsecond)) / float64(time.Millisecond)
+}
+
+// roundMs 用于日志的毫秒精度
+func roundMs(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
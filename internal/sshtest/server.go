@@ -0,0 +1,570 @@
+// Package sshtest 提供进程内的 SSH 服务器，供 Chain、传输、转发和终端的集成测试使用，不依赖外部主机。
+// 服务器监听 127.0.0.1 的随机端口，命令在本机 sh 中执行，"远端"文件系统就是本机文件系统。
+// 支持密码和公钥认证（可附加 OTP 键盘交互认证）、exec、shell、pty-req（只记录终端类型和尺寸，不分配真正的伪终端，
+// 输出合并 stderr）、env、signal、keepalive、direct-tcpip 端口转发（跳板链的下一跳也经由它连接）
+// 以及 ssh-agent 转发请求（OpenAgentChannel 模拟远端进程使用转发的 agent）；
+// sftp 子系统在本机有 OpenSSH 的 sftp-server 时由它提供
+package sshtest
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+	"golang.org/x/crypto/ssh"
+)
+
+// 默认的登录凭据
+const (
+	DefaultUser     = "tester"
+	DefaultPassword = "secret"
+)
+
+// sftpServerPaths 查找 OpenSSH sftp-server 的位置
+var sftpServerPaths = []string{
+	"/usr/lib/openssh/sftp-server",
+	"/usr/libexec/openssh/sftp-server",
+	"/usr/libexec/sftp-server",
+	"/usr/lib/ssh/sftp-server",
+}
+
+// Options 服务器选项，零值即可使用
+type Options struct {
+	User     string // 为空时为 DefaultUser
+	Password string // 为空时为 DefaultPassword
+	// AuthorizedKey 非空时也接受该公钥登录
+	AuthorizedKey ssh.PublicKey
+	// DenyPTY 拒绝 pty-req 和 shell，模拟只允许 exec 和子系统的服务器
+	DenyPTY bool
+	// Dir 命令的工作目录，为空时为测试进程的当前目录
+	Dir string
+	// OTP 非空时密码或公钥认证之后还要经键盘交互认证回答 OTPPrompt，答案须为 OTP（模拟启用二次验证的跳板机）
+	OTP string
+	// HostKeys 在默认的 ed25519 主机密钥之外再出示的密钥，模拟有多种类型主机密钥的服务器
+	HostKeys []ssh.Signer
+}
+
+// OTPPrompt 启用 OTP 时键盘交互认证的问题
+const OTPPrompt = "Verification code: "
+
+// WindowSize 客户端请求的终端尺寸
+type WindowSize struct {
+	Term string
+	Cols int
+	Rows int
+}
+
+// Server 进程内 SSH 服务器
+type Server struct {
+	Host string
+	Port int
+
+	opts     Options
+	hostKey  ssh.PublicKey
+	config   *ssh.ServerConfig
+	listener net.Listener
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu          sync.Mutex
+	conns       map[net.Conn]struct{}
+	connections int
+	commands    []string
+	forwards    []string
+	versions    []string
+	window      WindowSize
+	agentConn   ssh.Conn // 最近一个请求了 ssh-agent 转发的连接
+}
+
+// NewServer 启动服务器，测试结束时自动关闭
+func NewServer(t testing.TB, opts Options) *Server {
+	t.Helper()
+	if opts.User == "" {
+		opts.User = DefaultUser
+	}
+	if opts.Password == "" {
+		opts.Password = DefaultPassword
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("sshtest: failed to generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("sshtest: failed to create host key signer: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("sshtest: failed to listen: %v", err)
+	}
+
+	s := &Server{
+		Host:     "127.0.0.1",
+		Port:     listener.Addr().(*net.TCPAddr).Port,
+		opts:     opts,
+		hostKey:  signer.PublicKey(),
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.config = &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == opts.User && string(password) == opts.Password {
+				return s.secondFactor()
+			}
+			return nil, fmt.Errorf("password rejected for %s", meta.User())
+		},
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if opts.AuthorizedKey != nil && meta.User() == opts.User && string(key.Marshal()) == string(opts.AuthorizedKey.Marshal()) {
+				return s.secondFactor()
+			}
+			return nil, fmt.Errorf("public key rejected for %s", meta.User())
+		},
+	}
+	s.config.AddHostKey(signer)
+	for _, key := range opts.HostKeys {
+		s.config.AddHostKey(key)
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// secondFactor 第一步认证成功后的结果：启用 OTP 时只是部分成功，还须回答验证码
+func (s *Server) secondFactor() (*ssh.Permissions, error) {
+	if s.opts.OTP == "" {
+		return nil, nil
+	}
+	return nil, &ssh.PartialSuccessError{Next: ssh.ServerAuthCallbacks{
+		KeyboardInteractiveCallback: func(meta ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client(meta.User(), "Two-factor authentication", []string{OTPPrompt}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			if len(answers) != 1 || answers[0] != s.opts.OTP {
+				return nil, fmt.Errorf("wrong verification code for %s", meta.User())
+			}
+			return nil, nil
+		},
+	}}
+}
+
+// Addr 监听地址 host:port
+func (s *Server) Addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// HostKey 服务器的主机密钥
+func (s *Server) HostKey() ssh.PublicKey {
+	return s.hostKey
+}
+
+// Hop 返回以密码登录本服务器的外网服务器配置，主机密钥固定为本服务器的密钥，测试不会读写 known_hosts
+func (s *Server) Hop(name string) *types.Hop {
+	return &types.Hop{
+		ID:         name,
+		Name:       name,
+		Host:       s.Host,
+		Port:       s.Port,
+		User:       s.opts.User,
+		AuthType:   types.AuthPassword,
+		Password:   s.opts.Password,
+		ServerType: types.ServerExternal,
+		HostKey:    string(ssh.MarshalAuthorizedKey(s.hostKey)),
+	}
+}
+
+// Connections 已接受的 SSH 连接总数
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+// Commands 按顺序返回执行过的 exec 命令
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Forwards 按顺序返回 direct-tcpip 转发的目标地址
+func (s *Server) Forwards() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.forwards...)
+}
+
+// ClientVersions 各连接的客户端版本串，按连接顺序
+func (s *Server) ClientVersions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.versions...)
+}
+
+// Window 最近一次 pty-req 或 window-change 的终端尺寸
+func (s *Server) Window() WindowSize {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.window
+}
+
+// OpenAgentChannel 像 sshd 上的进程连接 SSH_AUTH_SOCK 那样，在最近一个请求了 ssh-agent 转发的连接上
+// 打开 auth-agent@openssh.com 通道，可用 agent.NewClient 包装后访问客户端的 agent
+func (s *Server) OpenAgentChannel() (ssh.Channel, error) {
+	s.mu.Lock()
+	conn := s.agentConn
+	s.mu.Unlock()
+	if conn == nil {
+		return nil, fmt.Errorf("no connection requested agent forwarding")
+	}
+	ch, requests, err := conn.OpenChannel("auth-agent@openssh.com", nil)
+	if err != nil {
+		return nil, err
+	}
+	go ssh.DiscardRequests(requests)
+	return ch, nil
+}
+
+// DropConnections 断开当前所有连接但继续监听，模拟跳板机重启或网络中断后恢复
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Close 停止监听，断开所有连接并结束运行中的命令
+func (s *Server) Close() {
+	s.listener.Close()
+	s.cancel()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	defer sshConn.Close()
+	s.mu.Lock()
+	s.connections++
+	s.versions = append(s.versions, string(sshConn.ClientVersion()))
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for req := range reqs {
+			// keepalive@openssh.com 等全局请求：需要回复的一律成功，远程转发不支持
+			if req.WantReply {
+				req.Reply(req.Type != "tcpip-forward", nil)
+			}
+		}
+	}()
+
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			ch, requests, err := newChannel.Accept()
+			if err != nil {
+				continue
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.handleSession(sshConn, ch, requests)
+			}()
+		case "direct-tcpip":
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.handleDirectTCPIP(newChannel)
+			}()
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+// ptyRequest RFC 4254 6.2 pty-req 的负载
+type ptyRequest struct {
+	Term   string
+	Cols   uint32
+	Rows   uint32
+	Width  uint32
+	Height uint32
+	Modes  string
+}
+
+// windowChange RFC 4254 6.7 window-change 的负载
+type windowChange struct {
+	Cols   uint32
+	Rows   uint32
+	Width  uint32
+	Height uint32
+}
+
+// session 一个 session channel 的状态
+type session struct {
+	ch      ssh.Channel
+	env     []string
+	pty     bool
+	mu      sync.Mutex
+	process *os.Process
+	started bool
+}
+
+func (s *Server) handleSession(conn ssh.Conn, ch ssh.Channel, requests <-chan *ssh.Request) {
+	sess := &session{ch: ch}
+	defer ch.Close()
+	for req := range requests {
+		ok := false
+		switch req.Type {
+		case "env":
+			var kv struct{ Name, Value string }
+			if ssh.Unmarshal(req.Payload, &kv) == nil {
+				sess.env = append(sess.env, kv.Name+"="+kv.Value)
+				ok = true
+			}
+		case "pty-req":
+			var pty ptyRequest
+			if !s.opts.DenyPTY && ssh.Unmarshal(req.Payload, &pty) == nil {
+				sess.pty = true
+				sess.env = append(sess.env, "TERM="+pty.Term)
+				s.setWindow(WindowSize{Term: pty.Term, Cols: int(pty.Cols), Rows: int(pty.Rows)})
+				ok = true
+			}
+		case "window-change":
+			var size windowChange
+			if ssh.Unmarshal(req.Payload, &size) == nil {
+				s.mu.Lock()
+				s.window.Cols, s.window.Rows = int(size.Cols), int(size.Rows)
+				s.mu.Unlock()
+				ok = true
+			}
+		case "shell":
+			if !s.opts.DenyPTY {
+				ok = s.start(sess, exec.CommandContext(s.ctx, "sh", "-i"))
+			}
+		case "exec":
+			var command struct{ Command string }
+			if ssh.Unmarshal(req.Payload, &command) == nil {
+				s.mu.Lock()
+				s.commands = append(s.commands, command.Command)
+				s.mu.Unlock()
+				ok = s.start(sess, exec.CommandContext(s.ctx, "sh", "-c", command.Command))
+			}
+		case "subsystem":
+			var subsystem struct{ Name string }
+			if ssh.Unmarshal(req.Payload, &subsystem) == nil && subsystem.Name == "sftp" {
+				if path := sftpServer(); path != "" {
+					ok = s.start(sess, exec.CommandContext(s.ctx, path))
+				}
+			}
+		case "auth-agent-req@openssh.com":
+			s.mu.Lock()
+			s.agentConn = conn
+			s.mu.Unlock()
+			ok = true
+		case "signal":
+			var signal struct{ Name string }
+			if ssh.Unmarshal(req.Payload, &signal) == nil {
+				sess.signal(signal.Name)
+				ok = true
+			}
+		}
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+	}
+	// 客户端关闭 channel 后结束仍在运行的命令
+	sess.signal("KILL")
+}
+
+func (s *Server) setWindow(size WindowSize) {
+	s.mu.Lock()
+	s.window = size
+	s.mu.Unlock()
+}
+
+// start 在 session 上运行 cmd，结束后发送 exit-status 并关闭 channel。每个 session 只能运行一次
+func (s *Server) start(sess *session, cmd *exec.Cmd) bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.started {
+		return false
+	}
+	cmd.Dir = s.opts.Dir
+	cmd.Env = append(os.Environ(), sess.env...)
+	cmd.Stdout = sess.ch
+	cmd.Stderr = sess.ch.Stderr()
+	if sess.pty {
+		// 伪终端合并 stdout 和 stderr
+		cmd.Stderr = sess.ch
+	}
+	// 客户端可能一直不发送 EOF，stdin 不交给 exec 等待
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return false
+	}
+	if err := cmd.Start(); err != nil {
+		return false
+	}
+	sess.started = true
+	sess.process = cmd.Process
+	go func() {
+		io.Copy(stdin, sess.ch)
+		stdin.Close()
+	}()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		status := 0
+		if err := cmd.Wait(); err != nil {
+			status = 255
+			if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() >= 0 {
+				status = exitErr.ExitCode()
+			}
+		}
+		payload := make([]byte, 4)
+		binary.BigEndian.PutUint32(payload, uint32(status))
+		sess.ch.SendRequest("exit-status", false, payload)
+		sess.ch.Close()
+	}()
+	return true
+}
+
+// signal 向 session 运行的命令发送信号（SSH 信号名，不带 SIG 前缀）
+func (sess *session) signal(name string) {
+	sess.mu.Lock()
+	process := sess.process
+	sess.mu.Unlock()
+	if process == nil {
+		return
+	}
+	signals := map[string]syscall.Signal{
+		"HUP": syscall.SIGHUP, "INT": syscall.SIGINT, "KILL": syscall.SIGKILL, "TERM": syscall.SIGTERM,
+	}
+	if sig, ok := signals[name]; ok {
+		process.Signal(sig)
+	}
+}
+
+// directTCPIP RFC 4254 7.2 direct-tcpip 的负载
+type directTCPIP struct {
+	DestAddr string
+	DestPort uint32
+	OrigAddr string
+	OrigPort uint32
+}
+
+func (s *Server) handleDirectTCPIP(newChannel ssh.NewChannel) {
+	var req directTCPIP
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &req); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "malformed direct-tcpip request")
+		return
+	}
+	addr := net.JoinHostPort(req.DestAddr, strconv.Itoa(int(req.DestPort)))
+	s.mu.Lock()
+	s.forwards = append(s.forwards, addr)
+	s.mu.Unlock()
+
+	var dialer net.Dialer
+	target, err := dialer.DialContext(s.ctx, "tcp", addr)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, requests, err := newChannel.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(target, ch)
+		if tcp, ok := target.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(ch, target)
+		ch.CloseWrite()
+		done <- struct{}{}
+	}()
+	for pending := 2; pending > 0; pending-- {
+		select {
+		case <-done:
+		case <-s.ctx.Done():
+			pending = 0
+		}
+	}
+	ch.Close()
+	target.Close()
+}
+
+// sftpServer 返回本机 sftp-server 的路径，没有时返回空
+func sftpServer() string {
+	for _, path := range sftpServerPaths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// DiscardLogs 在 tb 结束前丢弃标准 log 的输出，避免基准测试每次连接的日志淹没结果
+func DiscardLogs(tb testing.TB) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	tb.Cleanup(func() { log.SetOutput(out) })
+}
@@ -0,0 +1,200 @@
+package teamsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/transfer"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const (
+	// DefaultPath 仓库内默认的拓扑文件
+	DefaultPath = "config.yaml"
+
+	// maxTopologySize 共享拓扑文件大小上限
+	maxTopologySize = 10 << 20
+
+	fetchTimeout = 2 * time.Minute
+)
+
+// errNotModified 上游内容未变化
+var errNotModified = errors.New("not modified")
+
+// Fetcher 拉取共享拓扑文件
+type Fetcher interface {
+	// Fetch 返回文件内容和上游版本标识（git 提交或 HTTP ETag）
+	Fetch(ctx context.Context) ([]byte, string, error)
+}
+
+// isGitSource 判断来源是否为 git 仓库
+func isGitSource(source string) bool {
+	return strings.HasPrefix(source, "git+") ||
+		strings.HasPrefix(source, "git@") ||
+		strings.HasPrefix(source, "ssh://") ||
+		strings.HasPrefix(source, "file://") ||
+		strings.HasSuffix(source, ".git")
+}
+
+// NewFetcher 根据配置创建拉取器，git 仓库克隆到 cacheDir 下
+func NewFetcher(cfg types.SyncConfig, cacheDir string) (Fetcher, error) {
+	if cfg.Source == "" {
+		return nil, fmt.Errorf("sync source is not configured")
+	}
+
+	if isGitSource(cfg.Source) {
+		path := cfg.Path
+		if path == "" {
+			path = DefaultPath
+		}
+		return &gitFetcher{
+			source: strings.TrimPrefix(cfg.Source, "git+"),
+			branch: cfg.Branch,
+			path:   path,
+			dir:    filepath.Join(cacheDir, "repo"),
+		}, nil
+	}
+
+	u, err := url.Parse(cfg.Source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sync source: %w", err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("sync source must be a git repository or an https:// URL")
+	}
+	return &httpFetcher{url: cfg.Source, client: &http.Client{Timeout: fetchTimeout}}, nil
+}
+
+// httpFetcher 通过 HTTPS 拉取单个文件，利用 ETag 避免重复下载
+type httpFetcher struct {
+	url    string
+	client *http.Client
+	etag   string
+}
+
+// Fetch 下载拓扑文件
+func (f *httpFetcher) Fetch(ctx context.Context) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if f.etag != "" {
+		req.Header.Set("If-None-Match", f.etag)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch %s: %w", f.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, f.etag, errNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to fetch %s: %s", f.url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTopologySize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", f.url, err)
+	}
+	if len(data) > maxTopologySize {
+		return nil, "", fmt.Errorf("shared topology exceeds %d bytes", maxTopologySize)
+	}
+
+	f.etag = resp.Header.Get("ETag")
+	revision := f.etag
+	if revision == "" {
+		sum := sha256.Sum256(data)
+		revision = hex.EncodeToString(sum[:8])
+	}
+	return data, revision, nil
+}
+
+// gitFetcher 维护一个浅克隆并读取其中的拓扑文件
+type gitFetcher struct {
+	source string
+	branch string
+	path   string
+	dir    string
+}
+
+// Fetch 更新本地克隆并读取拓扑文件
+func (f *gitFetcher) Fetch(ctx context.Context) ([]byte, string, error) {
+	if _, err := os.Stat(filepath.Join(f.dir, ".git")); err != nil {
+		if err := os.MkdirAll(filepath.Dir(f.dir), 0700); err != nil {
+			return nil, "", fmt.Errorf("failed to create sync cache: %w", err)
+		}
+		os.RemoveAll(f.dir)
+		args := []string{"clone", "--depth", "1"}
+		if f.branch != "" {
+			args = append(args, "--branch", f.branch)
+		}
+		if _, err := f.git(ctx, "", append(args, f.source, f.dir)...); err != nil {
+			return nil, "", err
+		}
+	} else {
+		ref := "HEAD"
+		if f.branch != "" {
+			ref = f.branch
+		}
+		if _, err := f.git(ctx, f.dir, "fetch", "--depth", "1", "origin", ref); err != nil {
+			return nil, "", err
+		}
+		if _, err := f.git(ctx, f.dir, "reset", "--hard", "FETCH_HEAD"); err != nil {
+			return nil, "", err
+		}
+	}
+
+	revision, err := f.git(ctx, f.dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, "", err
+	}
+
+	filePath, err := transfer.SafeJoin(f.dir, f.path)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid sync path %q: %w", f.path, err)
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("shared topology %s not found in repository: %w", f.path, err)
+	}
+	if info.Size() > maxTopologySize {
+		return nil, "", fmt.Errorf("shared topology exceeds %d bytes", maxTopologySize)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read shared topology: %w", err)
+	}
+	return data, revision, nil
+}
+
+// git 执行 git 命令，禁止交互式输入凭据
+func (f *gitFetcher) git(ctx context.Context, dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
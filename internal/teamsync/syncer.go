@@ -0,0 +1,140 @@
+// Package teamsync 定期从 git 仓库或 HTTPS 地址拉取团队共享的拓扑（服务器、路由、预设），
+// 与本地配置合并：本地添加的条目保持不变，团队条目随上游更新，冲突记录在同步报告中
+package teamsync
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// DefaultInterval 默认拉取间隔
+const DefaultInterval = 5 * time.Minute
+
+// Status 同步状态
+type Status struct {
+	Source    string             `json:"source"`
+	Revision  string             `json:"revision,omitempty"`
+	LastSync  time.Time          `json:"last_sync,omitempty"` // 最近一次尝试
+	LastError string             `json:"last_error,omitempty"`
+	Report    *config.SyncReport `json:"report,omitempty"` // 最近一次成功合并的结果
+}
+
+// Syncer 团队拓扑同步器
+type Syncer struct {
+	config  types.SyncConfig
+	manager *config.Manager
+	fetcher Fetcher
+
+	status Status
+	mu     sync.Mutex // 串行化同步，保护 status
+}
+
+// New 创建同步器，cacheDir 用于存放 git 克隆
+func New(cfg types.SyncConfig, manager *config.Manager, cacheDir string) (*Syncer, error) {
+	fetcher, err := NewFetcher(cfg, cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Syncer{
+		config:  cfg,
+		manager: manager,
+		fetcher: fetcher,
+		status:  Status{Source: cfg.Source},
+	}, nil
+}
+
+// Sync 立即拉取并合并一次；上游未变化时返回空报告
+func (s *Syncer) Sync(ctx context.Context) (*config.SyncReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status.LastSync = time.Now()
+	report, revision, err := s.sync(ctx)
+	if err != nil {
+		s.status.LastError = err.Error()
+		return nil, err
+	}
+	s.status.LastError = ""
+	s.status.Revision = revision
+	if report.Changed() || len(report.Conflicts) > 0 || s.status.Report == nil {
+		s.status.Report = report
+	}
+	return report, nil
+}
+
+func (s *Syncer) sync(ctx context.Context) (*config.SyncReport, string, error) {
+	data, revision, err := s.fetcher.Fetch(ctx)
+	if errors.Is(err, errNotModified) || (err == nil && revision == s.status.Revision && s.status.Report != nil) {
+		return &config.SyncReport{}, s.status.Revision, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	shared, err := config.ParseTopology(data)
+	if err != nil {
+		return nil, "", err
+	}
+	report, err := s.manager.ApplyShared(shared)
+	if err != nil {
+		return nil, "", err
+	}
+	return report, revision, nil
+}
+
+// Status 返回当前同步状态
+func (s *Syncer) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Run 按间隔持续同步，直到 ctx 取消
+func (s *Syncer) Run(ctx context.Context) {
+	interval := s.config.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := s.Sync(ctx)
+		if err != nil {
+			log.Printf("[Sync] Failed to sync from %s: %v", s.config.Source, err)
+		} else {
+			logReport(report)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// logReport 记录合并结果
+func logReport(report *config.SyncReport) {
+	if report.Changed() {
+		log.Printf("[Sync] Applied shared topology: %d added, %d updated, %d removed",
+			len(report.Added), len(report.Updated), len(report.Removed))
+	}
+	for _, c := range report.Conflicts {
+		log.Printf("[Sync] Conflict (%s %s %s): %s", c.Type, c.Kind, firstNonEmpty(c.Name, c.ID), c.Reason)
+	}
+}
+
+func firstNonEmpty(a, b string) string {
+	if a != "" {
+		return a
+	}
+	return b
+}
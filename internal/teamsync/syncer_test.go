@@ -0,0 +1,185 @@
+package teamsync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/config"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const topologyV1 = `version: 3
+hops:
+  - id: team-gw
+    name: gateway
+    host: 1.1.1.1
+    port: 22
+    user: ops
+`
+
+const topologyV2 = `version: 3
+hops:
+  - id: team-gw
+    name: gateway
+    host: 1.1.1.2
+    port: 22
+    user: ops
+  - id: team-bastion
+    name: bastion
+    host: 2.2.2.2
+    port: 22
+    user: ops
+`
+
+// newTestManager 在临时 HOME 下创建带一台本地服务器的配置
+func newTestManager(t *testing.T) *config.Manager {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	mgr, err := config.NewManager()
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if _, err := mgr.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := mgr.AddHop(&types.Hop{ID: "mine", Name: "my-box", Host: "192.168.1.2", Port: 22, User: "me"}); err != nil {
+		t.Fatalf("AddHop failed: %v", err)
+	}
+	return mgr
+}
+
+func hostOf(mgr *config.Manager, id string) string {
+	if hop := mgr.Get().GetHopByID(id); hop != nil {
+		return hop.Host
+	}
+	return ""
+}
+
+func TestSyncFromGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	commit := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo, "team.yaml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "team.yaml")
+		git("commit", "-q", "-m", "update")
+	}
+	git("init", "-q")
+	commit(topologyV1)
+
+	mgr := newTestManager(t)
+	syncer, err := New(types.SyncConfig{Source: "file://" + repo, Path: "team.yaml"}, mgr, t.TempDir())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	report, err := syncer.Sync(context.Background())
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(report.Added) != 1 || hostOf(mgr, "team-gw") != "1.1.1.1" {
+		t.Fatalf("expected team gateway to be added, report=%+v", report)
+	}
+
+	// 未变化的提交不会重复合并
+	if report, err := syncer.Sync(context.Background()); err != nil || report.Changed() {
+		t.Fatalf("expected no-op sync, got %+v, %v", report, err)
+	}
+
+	commit(topologyV2)
+	report, err = syncer.Sync(context.Background())
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(report.Added) != 1 || len(report.Updated) != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if hostOf(mgr, "team-gw") != "1.1.1.2" || hostOf(mgr, "mine") != "192.168.1.2" {
+		t.Error("team hop not updated or local hop lost")
+	}
+
+	// 合并结果已持久化
+	reloaded, err := config.NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := reloaded.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Hops) != 3 {
+		t.Errorf("expected 3 persisted hops, got %d", len(cfg.Hops))
+	}
+}
+
+func TestSyncFromHTTPS(t *testing.T) {
+	content := topologyV1
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"` + strconv.Itoa(len(content)) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	mgr := newTestManager(t)
+	syncer, err := New(types.SyncConfig{Source: srv.URL + "/team.yaml"}, mgr, t.TempDir())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	syncer.fetcher.(*httpFetcher).client = srv.Client()
+
+	if _, err := syncer.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if hostOf(mgr, "team-gw") != "1.1.1.1" {
+		t.Fatal("team gateway not added")
+	}
+
+	if report, err := syncer.Sync(context.Background()); err != nil || report.Changed() {
+		t.Fatalf("expected not-modified sync to be a no-op, got %+v, %v", report, err)
+	}
+
+	content = topologyV2
+	if _, err := syncer.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if hostOf(mgr, "team-bastion") != "2.2.2.2" {
+		t.Error("new team hop not added")
+	}
+	if status := syncer.Status(); status.LastError != "" || status.Report == nil {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestNewFetcherRejectsPlainHTTP(t *testing.T) {
+	if _, err := NewFetcher(types.SyncConfig{Source: "http://example.com/team.yaml"}, t.TempDir()); err == nil {
+		t.Error("expected plain http source to be rejected")
+	}
+	if _, err := NewFetcher(types.SyncConfig{Source: "git@github.com:team/infra.git"}, t.TempDir()); err != nil {
+		t.Errorf("expected git source to be accepted: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package terminal
+
+import (
+	"io"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/netem"
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/sshtest"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// BenchmarkEchoLatency 终端中按一个键到回显的往返时间：经由跳板在远端 cat 中写一个字节并读回。
+// rtt=20ms 由 netem 给第一跳注入延迟
+func BenchmarkEchoLatency(b *testing.B) {
+	sshtest.DiscardLogs(b)
+	for _, bench := range []struct{ name, netem string }{
+		{"rtt=0s", ""},
+		{"rtt=20ms", "delay=10ms"},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			if err := netem.Set(bench.netem); err != nil {
+				b.Fatal(err)
+			}
+			defer netem.Set("")
+			benchmarkEcho(b)
+		})
+	}
+}
+
+func benchmarkEcho(b *testing.B) {
+	bastion := sshtest.NewServer(b, sshtest.Options{})
+	target := sshtest.NewServer(b, sshtest.Options{})
+	hops := []*types.Hop{bastion.Hop("bastion"), target.Hop("target")}
+
+	config := DefaultPoolConfig()
+	config.KeepAliveInterval = 0
+	pool := NewPool(config)
+	defer pool.Close()
+	pooled, err := pool.NewSession(hops)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer pooled.Close()
+	session := pooled.GetSession()
+	if err := ssh.RequestPTY(hops[1], session, "xterm-256color", 30, 100, nil); err != nil {
+		b.Fatal(err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		b.Fatal(err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := session.Start("cat"); err != nil {
+		b.Fatal(err)
+	}
+
+	key := []byte{'x'}
+	echo := make([]byte, 1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := stdin.Write(key); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.ReadFull(stdout, echo); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	stdin.Close()
+}
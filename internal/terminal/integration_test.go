@@ -0,0 +1,183 @@
+package terminal
+
+import (
+	"bufio"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/sshtest"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestPooledShellOverChain(t *testing.T) {
+	bastion := sshtest.NewServer(t, sshtest.Options{})
+	target := sshtest.NewServer(t, sshtest.Options{})
+	hops := []*types.Hop{bastion.Hop("bastion"), target.Hop("target")}
+
+	config := DefaultPoolConfig()
+	config.KeepAliveInterval = 0
+	pool := NewPool(config)
+	defer pool.Close()
+
+	first, err := pool.NewSession(hops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	session := first.GetSession()
+	if err := ssh.RequestPTY(hops[1], session, "xterm-256color", 30, 100, nil); err != nil {
+		t.Fatalf("RequestPTY: %v", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ssh.StartShell(hops[1], session, ""); err != nil {
+		t.Fatalf("StartShell: %v", err)
+	}
+	if err := session.WindowChange(40, 120); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(chan string, 16)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	stdin.Write([]byte("echo term=$TERM\n"))
+	timeout := time.After(5 * time.Second)
+	for found := false; !found; {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("shell exited before echoing")
+			}
+			found = strings.Contains(line, "term=xterm-256color")
+		case <-timeout:
+			t.Fatal("no output from the shell")
+		}
+	}
+
+	// 同一目标的第二个终端共用已有的连接
+	second, err := pool.NewSession(hops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	if out, err := second.GetSession().Output("echo second"); err != nil || strings.TrimSpace(string(out)) != "second" {
+		t.Errorf("second session = %q, %v", out, err)
+	}
+	if n := target.Connections(); n != 1 {
+		t.Errorf("target accepted %d connections, want 1 shared", n)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for target.Window().Cols != 120 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if window := target.Window(); window.Term != "xterm-256color" || window.Cols != 120 || window.Rows != 40 {
+		t.Errorf("window = %+v", window)
+	}
+}
+
+func TestPoolDropsLostChain(t *testing.T) {
+	bastion := sshtest.NewServer(t, sshtest.Options{})
+	target := sshtest.NewServer(t, sshtest.Options{})
+	hops := []*types.Hop{bastion.Hop("bastion"), target.Hop("target")}
+
+	config := DefaultPoolConfig()
+	config.KeepAliveInterval = 0
+	pool := NewPool(config)
+	defer pool.Close()
+
+	session, err := pool.NewSession(hops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost := session.Client()
+
+	// 跳板断开后使用方收到通知，会话结束后断开的链不回到空闲列表
+	bastion.DropConnections()
+	select {
+	case <-lost.Lost():
+	case <-time.After(10 * time.Second):
+		t.Fatal("pool did not report the lost chain")
+	}
+	session.Close()
+	session.Close()
+	pool.mu.RLock()
+	idle := len(pool.idleConns[HopKey(hops)])
+	pool.mu.RUnlock()
+	if idle != 0 {
+		t.Errorf("idle conns = %d after releasing a lost chain, want 0", idle)
+	}
+
+	next, err := pool.NewSession(hops)
+	if err != nil {
+		t.Fatalf("NewSession after the chain was lost: %v", err)
+	}
+	defer next.Close()
+	if next.Client().ID() == lost.ID() {
+		t.Error("lost connection reused")
+	}
+}
+
+func TestPoolClosesAgentForwardedChain(t *testing.T) {
+	// 只检查连接池的处理，不需要真的 agent
+	t.Setenv("SSH_AUTH_SOCK", filepath.Join(t.TempDir(), "agent.sock"))
+	target := sshtest.NewServer(t, sshtest.Options{})
+	hops := []*types.Hop{target.Hop("target")}
+
+	config := DefaultPoolConfig()
+	config.KeepAliveInterval = 0
+	pool := NewPool(config)
+	defer pool.Close()
+
+	forwarded, err := pool.NewSession(hops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop, err := forwarded.Client().ForwardAgent(forwarded.GetSession(), "alice")
+	if err != nil {
+		t.Fatalf("ForwardAgent: %v", err)
+	}
+
+	// 转发了 agent 的链不与其他终端共用
+	other, err := pool.NewSession(hops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if other.Client().ID() == forwarded.Client().ID() {
+		t.Fatal("agent-forwarded connection shared with another session")
+	}
+
+	// 会话结束后直接关闭，不放回空闲列表
+	stop()
+	forwarded.Close()
+	pool.mu.RLock()
+	idle := len(pool.idleConns[HopKey(hops)])
+	pool.mu.RUnlock()
+	if idle != 0 {
+		t.Errorf("idle conns = %d after releasing an agent-forwarded chain, want 0", idle)
+	}
+
+	next, err := pool.NewSession(hops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+	if next.Client().ID() == forwarded.Client().ID() {
+		t.Error("agent-forwarded connection reused")
+	}
+}
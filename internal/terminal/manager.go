@@ -109,6 +109,20 @@ func (m *Manager) HandleTerminal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	opts, err := m.config.ResolveTerminal(hop, r.URL.Query().Get("preset"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if persist := r.URL.Query().Get("persist"); persist != "" {
+		opts.Persist = persist
+	}
+	startCmd, err := StartCommand(opts, r.URL.Query().Get("session"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// 构建 hop 链
 	hops := m.buildHopChain(hop)
 	if len(hops) == 0 {
@@ -124,6 +138,8 @@ func (m *Manager) HandleTerminal(w http.ResponseWriter, r *http.Request) {
 		Cols:         80,
 		Rows:         24,
 		Pool:         m.pool,
+		Modes:        opts.Modes,
+		Shell:        startCmd,
 	}
 
 	// 从 URL 参数获取终端大小
@@ -164,13 +180,13 @@ func (m *Manager) buildHopChain(targetHop *types.Hop) []*types.Hop {
 	var hops []*types.Hop
 
 	// 如果配置了网关，先添加网关
-	if targetHop.Gateway != "" {
-		gatewayHop := m.config.GetHopByName(targetHop.Gateway)
+	if targetHop.GatewayID != "" {
+		gatewayHop := m.config.GetHopByID(targetHop.GatewayID)
 		if gatewayHop != nil {
-			log.Printf("[Manager] Adding gateway %s for server %s", targetHop.Gateway, targetHop.Name)
+			log.Printf("[Manager] Adding gateway %s for server %s", gatewayHop.Name, targetHop.Name)
 			hops = append(hops, gatewayHop)
 		} else {
-			log.Printf("[Manager] Warning: Gateway %s not found for server %s", targetHop.Gateway, targetHop.Name)
+			log.Printf("[Manager] Warning: Gateway %s not found for server %s", targetHop.GatewayID, targetHop.Name)
 		}
 	}
 
@@ -202,6 +218,8 @@ func (m *Manager) ListSessions() []SessionInfo {
 			Connected:   session.IsConnected(),
 			Duration:    session.GetDuration(),
 			LastActive:  session.GetLastActive(),
+			LastInput:   session.GetLastInput(),
+			LastOutput:  session.GetLastOutput(),
 			BytesIn:     stats.BytesIn.Load(),
 			BytesOut:    stats.BytesOut.Load(),
 		})
@@ -211,6 +229,18 @@ func (m *Manager) ListSessions() []SessionInfo {
 	return sessions
 }
 
+// IdleSessions 列出超过 threshold 没有键盘输入的会话
+func (m *Manager) IdleSessions(threshold time.Duration) []SessionInfo {
+	var idle []SessionInfo
+	now := time.Now()
+	for _, info := range m.ListSessions() {
+		if now.Sub(info.LastInput) >= threshold {
+			idle = append(idle, info)
+		}
+	}
+	return idle
+}
+
 // CloseSession 关闭指定会话
 func (m *Manager) CloseSession(id string) error {
 	val, ok := m.sessions.Load(id)
@@ -327,6 +357,8 @@ type SessionInfo struct {
 	Connected    bool
 	Duration     time.Duration
 	LastActive   time.Time
+	LastInput    time.Time // 最后一次键盘输入，空闲时长按它计算
+	LastOutput   time.Time // 最后一次终端输出
 	BytesIn      uint64
 	BytesOut     uint64
 }
@@ -344,11 +376,11 @@ func parseTerminalSize(r *http.Request) (cols, rows int) {
 }
 
 // GetPoolStats 获取连接池统计
-func (m *Manager) GetPoolStats() PoolStats {
+func (m *Manager) GetPoolStats() PoolSnapshot {
 	if m.pool != nil {
-		return m.pool.GetStats()
+		return m.pool.Snapshot()
 	}
-	return PoolStats{}
+	return PoolSnapshot{Keys: []PoolKeyStat{}}
 }
 
 // APIHandler HTTP API 处理器
@@ -366,6 +398,20 @@ func (m *Manager) APIHandler() http.Handler {
 		}
 	})
 
+	// 列出空闲会话，threshold 默认 30m
+	mux.HandleFunc("/api/sessions/idle", func(w http.ResponseWriter, r *http.Request) {
+		threshold := 30 * time.Minute
+		if value := r.URL.Query().Get("threshold"); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				http.Error(w, "invalid threshold", http.StatusBadRequest)
+				return
+			}
+			threshold = d
+		}
+		writeJSON(w, m.IdleSessions(threshold))
+	})
+
 	// 获取统计信息
 	mux.HandleFunc("/api/stats", func(w http.ResponseWriter, r *http.Request) {
 		stats := map[string]interface{}{
@@ -0,0 +1,39 @@
+package terminal
+
+import (
+	"github.com/luobobo896/HSSH/pkg/types"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// defaultTTYSpeed 请求 PTY 时声明的终端速率
+const defaultTTYSpeed = 14400
+
+// PTYModes 把终端设置转换为请求 PTY 时的模式，未设置的字段使用默认值：回显开启、流控关闭、退格键发送 ^?
+func PTYModes(m types.TerminalModes) gossh.TerminalModes {
+	modes := gossh.TerminalModes{
+		gossh.ECHO:          1,
+		gossh.TTY_OP_ISPEED: defaultTTYSpeed,
+		gossh.TTY_OP_OSPEED: defaultTTYSpeed,
+		gossh.IXON:          0,
+		gossh.VERASE:        uint32(types.TerminalErase["^?"]),
+	}
+	if m.Echo != nil {
+		modes[gossh.ECHO] = boolMode(*m.Echo)
+	}
+	if m.FlowControl != nil {
+		modes[gossh.IXON] = boolMode(*m.FlowControl)
+		modes[gossh.IXOFF] = boolMode(*m.FlowControl)
+	}
+	if c, ok := types.TerminalErase[m.Erase]; ok {
+		modes[gossh.VERASE] = uint32(c)
+	}
+	return modes
+}
+
+// boolMode 布尔模式的取值
+func boolMode(on bool) uint32 {
+	if on {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package terminal
+
+import (
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// TestPTYModes 测试终端设置到 PTY 模式的转换
+func TestPTYModes(t *testing.T) {
+	off, on := false, true
+	tests := []struct {
+		name  string
+		modes types.TerminalModes
+		want  map[uint8]uint32
+	}{
+		{"defaults", types.TerminalModes{}, map[uint8]uint32{gossh.ECHO: 1, gossh.IXON: 0, gossh.VERASE: 0x7f}},
+		{"no echo", types.TerminalModes{Echo: &off}, map[uint8]uint32{gossh.ECHO: 0}},
+		{"flow control", types.TerminalModes{FlowControl: &on}, map[uint8]uint32{gossh.IXON: 1, gossh.IXOFF: 1}},
+		{"backspace ^H", types.TerminalModes{Erase: "^H"}, map[uint8]uint32{gossh.VERASE: 0x08}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modes := PTYModes(tt.modes)
+			for op, want := range tt.want {
+				if got, ok := modes[op]; !ok || got != want {
+					t.Errorf("mode %d = %d (set: %v), want %d", op, got, ok, want)
+				}
+			}
+		})
+	}
+}
+
+// TestResolveTerminal 测试预设与服务器设置的合并顺序
+func TestResolveTerminal(t *testing.T) {
+	off := false
+	cfg := &types.Config{
+		TerminalPresets: []*types.TerminalPreset{
+			{Name: "log-tailing", TerminalOptions: types.TerminalOptions{BufferSize: 4096}},
+		},
+	}
+	hop := &types.Hop{
+		Name:           "web-1",
+		TerminalPreset: "vim-friendly",
+		Terminal:       &types.TerminalOptions{Shell: "bash -l", Modes: types.TerminalModes{Echo: &off}},
+	}
+
+	opts, err := cfg.ResolveTerminal(hop, "")
+	if err != nil {
+		t.Fatalf("ResolveTerminal() error = %v", err)
+	}
+	if opts.Modes.FlowControl == nil || *opts.Modes.FlowControl {
+		t.Error("server default preset vim-friendly should turn flow control off")
+	}
+	if opts.Shell != "bash -l" || opts.Modes.Echo == nil || *opts.Modes.Echo {
+		t.Errorf("server settings should override the preset: %+v", opts)
+	}
+
+	// 配置中的同名预设替代内置预设
+	opts, err = cfg.ResolveTerminal(hop, "log-tailing")
+	if err != nil {
+		t.Fatalf("ResolveTerminal() error = %v", err)
+	}
+	if opts.BufferSize != 4096 || opts.Modes.FlowControl != nil {
+		t.Errorf("configured log-tailing should replace the built-in one: %+v", opts)
+	}
+
+	if _, err := cfg.ResolveTerminal(hop, "missing"); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+}
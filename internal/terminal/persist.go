@@ -0,0 +1,131 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// 远端会话保持工具
+const (
+	PersistTmux   = "tmux"
+	PersistScreen = "screen"
+)
+
+// DefaultPersistName 未指定名称时使用的远端会话名
+const DefaultPersistName = "hssh"
+
+// ErrInvalidSessionName 远端会话名不合法
+var ErrInvalidSessionName = errors.New("session name may only contain letters, digits, '-' and '_' (at most 64)")
+
+// sessionNamePattern tmux 会把 '.' 和 ':' 视为分隔符，这里只允许安全的字符
+var sessionNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// listSeparator 远端列表输出中 tmux 与 screen 部分的分隔行
+const listSeparator = "--hssh-screen--"
+
+// RemoteSession 远端 tmux/screen 会话
+type RemoteSession struct {
+	Name     string    `json:"name"`
+	Tool     string    `json:"tool"` // tmux 或 screen
+	Attached bool      `json:"attached"`
+	Windows  int       `json:"windows,omitempty"` // 仅 tmux
+	Created  time.Time `json:"created,omitzero"`  // 仅 tmux
+}
+
+// quietLoginCommand 以命令方式启动的登录 shell；sshd 只在 shell 请求时输出 MOTD 和上次登录信息
+const quietLoginCommand = `exec "${SHELL:-/bin/sh}" -l`
+
+// StartCommand 返回打开终端时在远端执行的命令，为空表示启动登录 shell：
+// 设置了 Persist 时在名为 name（为空时为 DefaultPersistName）的 tmux/screen 会话中运行，否则为 opts.Shell；
+// 都没有设置而开启了 QuietLogin 时以命令方式启动登录 shell，不显示 MOTD
+func StartCommand(opts types.TerminalOptions, name string) (string, error) {
+	if opts.Persist == "" {
+		if opts.Shell == "" && opts.QuietLogin != nil && *opts.QuietLogin {
+			return quietLoginCommand, nil
+		}
+		return opts.Shell, nil
+	}
+	if name == "" {
+		name = DefaultPersistName
+	}
+	return PersistCommand(opts.Persist, name, opts.Shell)
+}
+
+// PersistCommand 返回连接名为 name 的 tmux/screen 会话的命令，会话不存在时创建它（其中运行 shell，为空时为默认 shell）。
+// 远端没有安装该工具时退回普通登录 shell，终端仍可使用，只是关闭后不再保留
+func PersistCommand(tool, name, shell string) (string, error) {
+	if !sessionNamePattern.MatchString(name) {
+		return "", fmt.Errorf("%q: %w", name, ErrInvalidSessionName)
+	}
+
+	var cmd string
+	switch tool {
+	case PersistTmux:
+		cmd = "tmux new-session -A -s " + name
+	case PersistScreen:
+		cmd = "screen -D -RR -S " + name
+	default:
+		return "", fmt.Errorf("unknown persist tool %q (use tmux or screen)", tool)
+	}
+	if shell != "" {
+		cmd += " " + ShellQuote(shell)
+	}
+	return fmt.Sprintf(`command -v %s >/dev/null 2>&1 && exec %s || %s`, tool, cmd, quietLoginCommand), nil
+}
+
+// ListSessionsCommand 列出远端 tmux 和 screen 会话的命令，输出由 ParseRemoteSessions 解析
+func ListSessionsCommand() string {
+	return "tmux list-sessions -F '#{session_name}\t#{session_windows}\t#{session_attached}\t#{session_created}' 2>/dev/null; " +
+		"echo " + listSeparator + "; screen -ls 2>/dev/null; true"
+}
+
+// ParseRemoteSessions 解析 ListSessionsCommand 的输出
+func ParseRemoteSessions(output string) []RemoteSession {
+	sessions := []RemoteSession{}
+	tmuxPart, screenPart, _ := strings.Cut(output, listSeparator)
+
+	for _, line := range strings.Split(tmuxPart, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) != 4 || fields[0] == "" {
+			continue
+		}
+		session := RemoteSession{Name: fields[0], Tool: PersistTmux}
+		session.Windows, _ = strconv.Atoi(fields[1])
+		attached, _ := strconv.Atoi(fields[2])
+		session.Attached = attached > 0
+		if created, err := strconv.ParseInt(fields[3], 10, 64); err == nil {
+			session.Created = time.Unix(created, 0)
+		}
+		sessions = append(sessions, session)
+	}
+
+	// screen -ls 的会话行形如 "\t12345.name\t(Detached)"，中间可能还有创建时间
+	for _, line := range strings.Split(screenPart, "\n") {
+		if !strings.HasPrefix(line, "\t") {
+			continue
+		}
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		_, name, ok := strings.Cut(fields[0], ".")
+		if !ok || name == "" {
+			continue
+		}
+		status := fields[len(fields)-1]
+		sessions = append(sessions, RemoteSession{
+			Name:     name,
+			Tool:     PersistScreen,
+			Attached: strings.Contains(status, "Attached"),
+		})
+	}
+	return sessions
+}
+
+// ShellQuote 用单引号包裹 s，作为远端 shell 的一个参数
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
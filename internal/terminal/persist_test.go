@@ -0,0 +1,90 @@
+package terminal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// TestStartCommand 测试打开终端时在远端执行的命令
+func TestStartCommand(t *testing.T) {
+	quiet, loud := true, false
+	tests := []struct {
+		name    string
+		opts    types.TerminalOptions
+		session string
+		want    []string // 命令中应包含的片段，为 nil 时命令应为空
+		err     error
+	}{
+		{"login shell", types.TerminalOptions{}, "", nil, nil},
+		{"custom shell", types.TerminalOptions{Shell: "zsh"}, "", []string{"zsh"}, nil},
+		{"quiet login", types.TerminalOptions{QuietLogin: &quiet}, "", []string{`exec "${SHELL:-/bin/sh}" -l`}, nil},
+		{"quiet login off", types.TerminalOptions{QuietLogin: &loud}, "", nil, nil},
+		{"shell wins over quiet login", types.TerminalOptions{Shell: "zsh", QuietLogin: &quiet}, "", []string{"zsh"}, nil},
+		{"tmux default name", types.TerminalOptions{Persist: PersistTmux}, "", []string{"command -v tmux", "tmux new-session -A -s hssh", `exec "${SHELL:-/bin/sh}" -l`}, nil},
+		{"screen with shell", types.TerminalOptions{Persist: PersistScreen, Shell: "bash -l"}, "build", []string{"screen -D -RR -S build 'bash -l'"}, nil},
+		{"quoted shell", types.TerminalOptions{Persist: PersistTmux, Shell: "echo 'hi'"}, "job", []string{`'echo '\''hi'\'''`}, nil},
+		{"invalid name", types.TerminalOptions{Persist: PersistTmux}, "a;rm -rf /", nil, ErrInvalidSessionName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := StartCommand(tt.opts, tt.session)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("StartCommand() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("StartCommand() error = %v", err)
+			}
+			if tt.want == nil && cmd != "" {
+				t.Errorf("StartCommand() = %q, want empty", cmd)
+			}
+			for _, part := range tt.want {
+				if !strings.Contains(cmd, part) {
+					t.Errorf("StartCommand() = %q, missing %q", cmd, part)
+				}
+			}
+		})
+	}
+}
+
+// TestParseRemoteSessions 测试解析 tmux 和 screen 的会话列表
+func TestParseRemoteSessions(t *testing.T) {
+	output := "hssh\t2\t1\t1700000000\n" +
+		"build\t1\t0\t1700000100\n" +
+		listSeparator + "\n" +
+		"There are screens on:\n" +
+		"\t12345.deploy\t(01/02/2024 10:00:00 AM)\t(Detached)\n" +
+		"\t23456.logs\t(Attached)\n" +
+		"2 Sockets in /run/screen/S-root.\n"
+
+	sessions := ParseRemoteSessions(output)
+	if len(sessions) != 4 {
+		t.Fatalf("expected 4 sessions, got %+v", sessions)
+	}
+
+	want := []RemoteSession{
+		{Name: "hssh", Tool: PersistTmux, Attached: true, Windows: 2},
+		{Name: "build", Tool: PersistTmux, Attached: false, Windows: 1},
+		{Name: "deploy", Tool: PersistScreen, Attached: false},
+		{Name: "logs", Tool: PersistScreen, Attached: true},
+	}
+	for i, w := range want {
+		got := sessions[i]
+		if got.Name != w.Name || got.Tool != w.Tool || got.Attached != w.Attached || got.Windows != w.Windows {
+			t.Errorf("session %d = %+v, want %+v", i, got, w)
+		}
+	}
+	if sessions[0].Created.Unix() != 1700000000 {
+		t.Errorf("tmux created = %v", sessions[0].Created)
+	}
+
+	if got := ParseRemoteSessions(listSeparator + "\nNo Sockets found in /run/screen/S-root.\n"); len(got) != 0 {
+		t.Errorf("expected no sessions, got %+v", got)
+	}
+}
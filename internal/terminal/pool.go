@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -22,10 +24,60 @@ type PooledClient struct {
 	createdAt  time.Time
 	lastUsedAt atomic.Value
 	inUse      atomic.Bool
+	sessions   atomic.Int32 // 正在使用这条链的会话数
+	noShare    atomic.Bool  // 服务端拒绝了更多会话，不再共用
+	private    atomic.Bool  // 认证时询问过用户（OTP 等）或转发过 ssh-agent，只属于打开它的会话：不共用，结束后关闭而不放回空闲列表
+	warm       atomic.Bool  // 预热后还没有被使用过
+	missed     atomic.Int32 // 连续没有回复的 keepalive 次数
+	rtt        atomic.Int64 // 最近一次 keepalive 的往返时间（纳秒）
+	lost       chan struct{} // 链上某一跳断开后关闭
+	lostOnce   sync.Once
+	hops       []*types.Hop
 	hopKey     string
 	id         uint64
 }
 
+// ID 连接在连接池中的编号
+func (c *PooledClient) ID() uint64 {
+	return c.id
+}
+
+// Hops 连接经过的跳板链
+func (c *PooledClient) Hops() []*types.Hop {
+	return c.hops
+}
+
+// Lost 链上某一跳断开后关闭的通道；断开的链上的会话都已结束，不会再被共用或放回空闲列表
+func (c *PooledClient) Lost() <-chan struct{} {
+	return c.lost
+}
+
+// isLost 链是否已经断开
+func (c *PooledClient) isLost() bool {
+	select {
+	case <-c.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+// ForwardAgent 代表 user 在 session 上转发本机的 ssh-agent，会话结束时调用返回的 stop。
+// 远端在这条链上拿到过本机 agent，之后不再与其他终端共用，归还时直接关闭
+func (c *PooledClient) ForwardAgent(session *gossh.Session, user string) (stop func(), err error) {
+	stop, err = c.Client.ForwardAgent(session, user)
+	if err != nil {
+		return nil, err
+	}
+	c.private.Store(true)
+	return stop, nil
+}
+
+// Prompted 链上是否有某一跳认证时询问过用户（如跳板机的 OTP）
+func (c *PooledClient) Prompted() bool {
+	return c.chain.Prompted()
+}
+
 // IsInUse 检查客户端是否正在使用
 func (c *PooledClient) IsInUse() bool {
 	return c.inUse.Load()
@@ -71,6 +123,16 @@ type PoolConfig struct {
 	MaxLifetime time.Duration
 	// 获取连接超时
 	AcquireTimeout time.Duration
+	// 一条连接上最多同时打开的会话数，同一目标的多个终端共用一条链；不大于 1 时不共用
+	MaxSessionsPerConn int
+	// 向空闲连接发送 keepalive 的间隔，为 0 时不发送
+	KeepAliveInterval time.Duration
+	// 单次 keepalive 等待回复的时间
+	KeepAliveTimeout time.Duration
+	// 连续多少次 keepalive 没有回复后关闭连接
+	KeepAliveMaxMissed int
+	// 每次 keepalive 完成后调用，用于把往返时间交给延迟分析
+	OnKeepAlive func(hops []*types.Hop, rtt time.Duration, err error)
 }
 
 // DefaultPoolConfig 返回默认连接池配置
@@ -81,6 +143,10 @@ func DefaultPoolConfig() PoolConfig {
 		MaxIdleTime:        5 * time.Minute,
 		MaxLifetime:        30 * time.Minute,
 		AcquireTimeout:     10 * time.Second,
+		MaxSessionsPerConn: 8, // OpenSSH 默认 MaxSessions 为 10
+		KeepAliveInterval:  30 * time.Second,
+		KeepAliveTimeout:   10 * time.Second,
+		KeepAliveMaxMissed: 3,
 	}
 }
 
@@ -112,6 +178,8 @@ type PoolStats struct {
 	IdleConns     atomic.Int64
 	WaitCount     atomic.Int64
 	AcquireErrors atomic.Int64
+	// 因 keepalive 连续无回复而关闭的连接数
+	KeepAliveEvictions atomic.Int64
 }
 
 // NewPool 创建新的连接池
@@ -129,15 +197,30 @@ func NewPool(config PoolConfig) *Pool {
 	p.wg.Add(1)
 	go p.cleanupLoop()
 
+	if config.KeepAliveInterval > 0 {
+		p.wg.Add(1)
+		go p.keepAliveLoop()
+	}
+
 	return p
 }
 
 // Acquire 获取一个连接
 // hops: 连接链配置
 func (p *Pool) Acquire(hops []*types.Hop) (*PooledClient, error) {
+	return p.AcquireContext(context.Background(), hops)
+}
+
+// AcquireContext 同 Acquire，需要新建连接时用 ctx 建立（如携带键盘交互认证的询问方式）
+func (p *Pool) AcquireContext(ctx context.Context, hops []*types.Hop) (*PooledClient, error) {
 	hopKey := generateHopKey(hops)
 
-	// 先尝试获取空闲连接
+	// 优先在正在使用的连接上再开会话
+	if client := p.tryShare(hopKey); client != nil {
+		return client, nil
+	}
+
+	// 再尝试获取空闲连接
 	if client := p.tryGetIdle(hopKey); client != nil {
 		p.stats.ActiveConns.Add(1)
 		p.stats.IdleConns.Add(-1)
@@ -153,11 +236,11 @@ func (p *Pool) Acquire(hops []*types.Hop) (*PooledClient, error) {
 	if len(conns) >= p.config.MaxConnsPerHop {
 		// 等待其他连接释放
 		p.stats.WaitCount.Add(1)
-		return p.waitAndAcquire(hops, hopKey)
+		return p.waitAndAcquire(ctx, hops, hopKey)
 	}
 
 	// 创建新连接
-	client, err := p.createClient(hops, hopKey)
+	client, err := p.createClient(ctx, hops, hopKey)
 	if err != nil {
 		p.stats.AcquireErrors.Add(1)
 		return nil, err
@@ -168,24 +251,66 @@ func (p *Pool) Acquire(hops []*types.Hop) (*PooledClient, error) {
 	return client, nil
 }
 
+// tryShare 找一条正在使用、会话数未满的连接共用
+func (p *Pool) tryShare(hopKey string) *PooledClient {
+	if p.config.MaxSessionsPerConn <= 1 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, client := range p.conns[hopKey] {
+		if !client.inUse.Load() || client.noShare.Load() || client.private.Load() || int(client.sessions.Load()) >= p.config.MaxSessionsPerConn {
+			continue
+		}
+		if client.Client == nil || !client.IsConnected() {
+			continue
+		}
+		client.sessions.Add(1)
+		client.lastUsedAt.Store(time.Now())
+		return client
+	}
+	return nil
+}
+
 // tryGetIdle 尝试获取空闲连接
 func (p *Pool) tryGetIdle(hopKey string) *PooledClient {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	idleList := p.idleConns[hopKey]
+	for {
+		idleList := p.idleConns[hopKey]
+		i := indexIdle(idleList)
+		if i < 0 {
+			return nil
+		}
+		client := idleList[i]
+		// 从 idle 列表移除
+		p.idleConns[hopKey] = append(idleList[:i], idleList[i+1:]...)
+		client.warm.Store(false)
+		if client.IsConnected() {
+			client.sessions.Store(1)
+			client.markUsed()
+			return client
+		}
+		// 空闲期间断开的连接直接关闭，继续找下一个
+		p.closeClientLocked(client)
+	}
+}
+
+// indexIdle 返回第一个未被使用的空闲连接的下标，没有时返回 -1
+func indexIdle(idleList []*PooledClient) int {
 	for i, client := range idleList {
 		if !client.inUse.Load() {
-			// 从 idle 列表移除
-			p.idleConns[hopKey] = append(idleList[:i], idleList[i+1:]...)
-			return client
+			return i
 		}
 	}
-	return nil
+	return -1
 }
 
 // waitAndAcquire 等待连接可用
-func (p *Pool) waitAndAcquire(hops []*types.Hop, hopKey string) (*PooledClient, error) {
+func (p *Pool) waitAndAcquire(connectCtx context.Context, hops []*types.Hop, hopKey string) (*PooledClient, error) {
 	ctx, cancel := context.WithTimeout(p.ctx, p.config.AcquireTimeout)
 	defer cancel()
 
@@ -197,7 +322,10 @@ func (p *Pool) waitAndAcquire(hops []*types.Hop, hopKey string) (*PooledClient,
 		case <-ctx.Done():
 			return nil, fmt.Errorf("acquire connection timeout: %w", ctx.Err())
 		case <-ticker.C:
-			// 再次尝试获取空闲连接
+			// 再次尝试共用或获取空闲连接
+			if client := p.tryShare(hopKey); client != nil {
+				return client, nil
+			}
 			if client := p.tryGetIdle(hopKey); client != nil {
 				p.stats.ActiveConns.Add(1)
 				p.stats.IdleConns.Add(-1)
@@ -211,7 +339,7 @@ func (p *Pool) waitAndAcquire(hops []*types.Hop, hopKey string) (*PooledClient,
 			p.mu.RUnlock()
 
 			if len(conns) < p.config.MaxConnsPerHop {
-				client, err := p.createClient(hops, hopKey)
+				client, err := p.createClient(connectCtx, hops, hopKey)
 				if err != nil {
 					continue
 				}
@@ -224,18 +352,37 @@ func (p *Pool) waitAndAcquire(hops []*types.Hop, hopKey string) (*PooledClient,
 }
 
 // createClient 创建新的池化客户端
-func (p *Pool) createClient(hops []*types.Hop, hopKey string) (*PooledClient, error) {
+func (p *Pool) createClient(ctx context.Context, hops []*types.Hop, hopKey string) (*PooledClient, error) {
+	client, err := p.connectClient(ctx, hops, hopKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// 添加到连接池
+	client.sessions.Store(1)
+	client.markUsed()
+	p.mu.Lock()
+	p.conns[hopKey] = append(p.conns[hopKey], client)
+	p.mu.Unlock()
+
+	return client, nil
+}
+
+// connectClient 建立 SSH 链并包装为池化客户端，不加入连接池
+func (p *Pool) connectClient(ctx context.Context, hops []*types.Hop, hopKey string) (*PooledClient, error) {
 	chain := ssh.NewChain(hops)
-	if err := chain.Connect(); err != nil {
+	if err := chain.ConnectContext(ctx); err != nil {
 		return nil, fmt.Errorf("failed to connect chain: %w", err)
 	}
 
 	client := &PooledClient{
 		chain:     chain,
+		hops:      hops,
 		pool:      p,
 		createdAt: time.Now(),
 		hopKey:    hopKey,
 		id:        p.idCounter.Add(1),
+		lost:      make(chan struct{}),
 	}
 
 	// 包装最后一跳为 Client
@@ -245,14 +392,83 @@ func (p *Pool) createClient(hops []*types.Hop, hopKey string) (*PooledClient, er
 		return nil, fmt.Errorf("no last hop in chain")
 	}
 	client.Client = lastHop
+	// 经用户回答 OTP 等二次验证建立的链不能让其他用户免验证复用
+	client.private.Store(chain.Prompted())
 
-	// 添加到连接池
+	// 中间某一跳断开时最后一跳的连接随之失效，通知正在使用它的终端
+	chain.Subscribe(func(event ssh.ChainEvent) {
+		if event.Kind == ssh.ChainLost {
+			client.lostOnce.Do(func() { close(client.lost) })
+		}
+	})
+	chain.Monitor(p.ctx)
+	return client, nil
+}
+
+// Warm 为 hops 预先建立最多 n 条连接并放入空闲列表，之后的 Acquire 直接取用，不必再逐跳握手。
+// 预热受 MaxConnsPerHop 和 MaxIdleConnsPerHop 限制，返回实际放入的连接数；
+// 一条都没有建立成功时返回最后一个错误
+func (p *Pool) Warm(ctx context.Context, hops []*types.Hop, n int) (int, error) {
+	hopKey := generateHopKey(hops)
+
+	p.mu.RLock()
+	room := min(n, min(p.config.MaxConnsPerHop-len(p.conns[hopKey]), p.config.MaxIdleConnsPerHop-len(p.idleConns[hopKey])))
+	p.mu.RUnlock()
+	if room <= 0 {
+		return 0, nil
+	}
+
+	// 各条链并行建立，多跳链路的握手耗时不叠加
+	type result struct {
+		client *PooledClient
+		err    error
+	}
+	results := make(chan result, room)
+	for i := 0; i < room; i++ {
+		go func() {
+			client, err := p.connectClient(ctx, hops, hopKey)
+			results <- result{client, err}
+		}()
+	}
+
+	parked := 0
+	var lastErr error
+	for i := 0; i < room; i++ {
+		r := <-results
+		if r.err != nil {
+			lastErr = r.err
+			continue
+		}
+		if p.park(r.client) {
+			parked++
+		}
+	}
+	if parked == 0 && lastErr != nil {
+		return 0, lastErr
+	}
+	return parked, nil
+}
+
+// park 把预热的连接放入空闲列表；建立期间已达到上限或连接不能复用时关闭它并返回 false
+func (p *Pool) park(client *PooledClient) bool {
 	p.mu.Lock()
-	p.conns[hopKey] = append(p.conns[hopKey], client)
-	p.mu.Unlock()
+	defer p.mu.Unlock()
 
-	client.markUsed()
-	return client, nil
+	hopKey := client.hopKey
+	if p.ctx.Err() != nil || client.private.Load() ||
+		len(p.conns[hopKey]) >= p.config.MaxConnsPerHop ||
+		len(p.idleConns[hopKey]) >= p.config.MaxIdleConnsPerHop {
+		go client.chain.Disconnect()
+		return false
+	}
+
+	client.markIdle()
+	client.warm.Store(true)
+	p.conns[hopKey] = append(p.conns[hopKey], client)
+	p.idleConns[hopKey] = append(p.idleConns[hopKey], client)
+	p.stats.TotalConns.Add(1)
+	p.stats.IdleConns.Add(1)
+	return true
 }
 
 // release 释放连接回池中
@@ -261,11 +477,23 @@ func (p *Pool) release(client *PooledClient) {
 		return
 	}
 
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 还有其他会话在共用这条链
+	if client.sessions.Add(-1) > 0 {
+		return
+	}
+	client.sessions.Store(0)
+	client.noShare.Store(false)
 	client.markIdle()
 	p.stats.ActiveConns.Add(-1)
 
-	p.mu.Lock()
-	defer p.mu.Unlock()
+	if client.isLost() || client.private.Load() {
+		// 断开的链和只属于一个会话的链不再放回空闲列表
+		p.closeClientLocked(client)
+		return
+	}
 
 	// 添加到空闲列表
 	idleList := p.idleConns[client.hopKey]
@@ -324,6 +552,82 @@ func (p *Pool) cleanupLoop() {
 	}
 }
 
+// keepAliveLoop 定期向空闲连接发送 keepalive，防止防火墙静默丢弃长时间没有流量的连接
+func (p *Pool) keepAliveLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.KeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.keepAliveIdle()
+		}
+	}
+}
+
+// keepAliveIdle 并行向所有空闲连接发送一次 keepalive
+func (p *Pool) keepAliveIdle() {
+	p.mu.RLock()
+	var idle []*PooledClient
+	for _, clients := range p.idleConns {
+		idle = append(idle, clients...)
+	}
+	p.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, client := range idle {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.keepAlive(client)
+		}()
+	}
+	wg.Wait()
+}
+
+// keepAlive 向 client 发送一次 keepalive；连续 KeepAliveMaxMissed 次没有回复且仍空闲时关闭它
+func (p *Pool) keepAlive(client *PooledClient) {
+	ctx, cancel := context.WithTimeout(p.ctx, p.config.KeepAliveTimeout)
+	rtt, err := client.KeepAlive(ctx)
+	cancel()
+
+	if p.config.OnKeepAlive != nil && len(client.hops) > 0 {
+		p.config.OnKeepAlive(client.hops, rtt, err)
+	}
+	if err == nil {
+		client.missed.Store(0)
+		client.rtt.Store(int64(rtt))
+		return
+	}
+	if int(client.missed.Add(1)) < p.config.KeepAliveMaxMissed {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 等待回复期间被取走的连接交给使用方处理
+	if client.inUse.Load() || !containsClient(p.idleConns[client.hopKey], client) {
+		return
+	}
+	log.Printf("[Pool] Closing %s after %d missed keepalives: %v", client.hopKey, client.missed.Load(), err)
+	p.stats.KeepAliveEvictions.Add(1)
+	p.closeClientLocked(client)
+}
+
+// containsClient clients 中是否有 client
+func containsClient(clients []*PooledClient, client *PooledClient) bool {
+	for _, c := range clients {
+		if c.id == client.id {
+			return true
+		}
+	}
+	return false
+}
+
 // cleanup 清理过期连接
 func (p *Pool) cleanup() {
 	now := time.Now()
@@ -384,6 +688,26 @@ func (p *Pool) Close() error {
 	return nil
 }
 
+// DisconnectAll 断开池中的所有连接（包括正在使用的），连接池继续可用，返回断开的连接数。
+// 正在使用的连接在会话结束归还后由 cleanup 回收
+func (p *Pool) DisconnectAll() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, clients := range p.conns {
+		for _, client := range slices.Clone(clients) {
+			n++
+			if client.inUse.Load() {
+				go client.chain.Disconnect()
+				continue
+			}
+			p.closeClientLocked(client)
+		}
+	}
+	return n
+}
+
 // GetStats 获取连接池统计
 func (p *Pool) GetStats() PoolStats {
 	return PoolStats{
@@ -395,6 +719,77 @@ func (p *Pool) GetStats() PoolStats {
 	}
 }
 
+// PoolSnapshot 连接池当前状态
+type PoolSnapshot struct {
+	Total              int           `json:"total"`
+	Active             int           `json:"active"`
+	Idle               int           `json:"idle"`
+	Warm               int           `json:"warm"` // 预热后还没有被使用过的空闲连接
+	WaitCount          int64         `json:"wait_count"`
+	AcquireErrors      int64         `json:"acquire_errors"`
+	KeepAliveEvictions int64         `json:"keepalive_evictions"` // 因 keepalive 连续无回复而关闭的连接数
+	Keys               []PoolKeyStat `json:"keys"`
+}
+
+// PoolKeyStat 单个 hopKey 的连接数
+type PoolKeyStat struct {
+	Key    string `json:"key"`
+	Total  int    `json:"total"`
+	Active int    `json:"active"`
+	Idle   int    `json:"idle"`
+	Warm   int    `json:"warm"`
+	// 各连接上打开的会话总数，大于 Active 时说明有终端共用连接
+	Sessions int `json:"sessions"`
+	// 各连接最近一次 keepalive 往返时间的平均值，还没有发送过时为 0
+	RTTMs float64 `json:"rtt_ms"`
+}
+
+// Snapshot 按连接列表统计当前状态（不依赖增量计数）
+func (p *Pool) Snapshot() PoolSnapshot {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	snap := PoolSnapshot{
+		WaitCount:          p.stats.WaitCount.Load(),
+		AcquireErrors:      p.stats.AcquireErrors.Load(),
+		KeepAliveEvictions: p.stats.KeepAliveEvictions.Load(),
+		Keys:               []PoolKeyStat{},
+	}
+	for hopKey, clients := range p.conns {
+		stat := PoolKeyStat{Key: hopKey, Total: len(clients), Idle: len(p.idleConns[hopKey])}
+		for _, client := range p.idleConns[hopKey] {
+			if client.warm.Load() {
+				stat.Warm++
+			}
+		}
+		var rttSum time.Duration
+		var rttCount int
+		for _, client := range clients {
+			stat.Sessions += int(client.sessions.Load())
+			if rtt := client.rtt.Load(); rtt > 0 {
+				rttSum += time.Duration(rtt)
+				rttCount++
+			}
+		}
+		if rttCount > 0 {
+			stat.RTTMs = float64(rttSum/time.Duration(rttCount)) / float64(time.Millisecond)
+		}
+		stat.Active = stat.Total - stat.Idle
+		snap.Total += stat.Total
+		snap.Active += stat.Active
+		snap.Idle += stat.Idle
+		snap.Warm += stat.Warm
+		snap.Keys = append(snap.Keys, stat)
+	}
+	sort.Slice(snap.Keys, func(i, j int) bool { return snap.Keys[i].Key < snap.Keys[j].Key })
+	return snap
+}
+
+// HopKey 返回 hops 在连接池中的标识
+func HopKey(hops []*types.Hop) string {
+	return generateHopKey(hops)
+}
+
 // generateHopKey 生成 hop 链的唯一标识
 func generateHopKey(hops []*types.Hop) string {
 	if len(hops) == 0 {
@@ -408,21 +803,35 @@ func generateHopKey(hops []*types.Hop) string {
 
 // PooledSession 池化会话封装
 type PooledSession struct {
-	client  *PooledClient
-	session *gossh.Session
-	stdin   gossh.Channel
-	stdout  gossh.Channel
-	stderr  gossh.Channel
+	client    *PooledClient
+	session   *gossh.Session
+	stdin     gossh.Channel
+	stdout    gossh.Channel
+	stderr    gossh.Channel
+	closeOnce sync.Once
 }
 
-// NewSession 从池中获取会话
+// NewSession 从池中获取会话；共用的连接上服务端拒绝再开会话时，不再共用它并改用另一条连接
 func (p *Pool) NewSession(hops []*types.Hop) (*PooledSession, error) {
-	client, err := p.Acquire(hops)
+	return p.NewSessionContext(context.Background(), hops)
+}
+
+// NewSessionContext 同 NewSession，需要新建连接时用 ctx 建立
+func (p *Pool) NewSessionContext(ctx context.Context, hops []*types.Hop) (*PooledSession, error) {
+	client, err := p.AcquireContext(ctx, hops)
 	if err != nil {
 		return nil, err
 	}
 
 	session, err := client.NewSession()
+	if err != nil && client.sessions.Load() > 1 {
+		client.noShare.Store(true)
+		client.Release()
+		if client, err = p.AcquireContext(ctx, hops); err != nil {
+			return nil, err
+		}
+		session, err = client.NewSession()
+	}
 	if err != nil {
 		client.Release()
 		return nil, fmt.Errorf("failed to create session: %w", err)
@@ -434,17 +843,24 @@ func (p *Pool) NewSession(hops []*types.Hop) (*PooledSession, error) {
 	}, nil
 }
 
-// Close 关闭会话，释放回连接池
+// Close 关闭会话，释放回连接池；重复调用无效
 func (s *PooledSession) Close() error {
-	if s.session != nil {
-		s.session.Close()
-	}
-	if s.client != nil {
-		s.client.Release()
-	}
+	s.closeOnce.Do(func() {
+		if s.session != nil {
+			s.session.Close()
+		}
+		if s.client != nil {
+			s.client.Release()
+		}
+	})
 	return nil
 }
 
+// Client 会话所在的池化连接
+func (s *PooledSession) Client() *PooledClient {
+	return s.client
+}
+
 // GetSession 获取底层 SSH 会话
 func (s *PooledSession) GetSession() *gossh.Session {
 	return s.session
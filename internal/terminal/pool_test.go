@@ -1,6 +1,7 @@
 package terminal
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
@@ -186,6 +187,164 @@ func TestPooledClient_Release(t *testing.T) {
 	}
 }
 
+// TestPoolWarmLimits 测试预热连接计数和上限
+func TestPoolWarmLimits(t *testing.T) {
+	config := DefaultPoolConfig()
+	config.MaxIdleConnsPerHop = 2
+	pool := NewPool(config)
+	defer pool.Close()
+
+	hops := []*types.Hop{{Name: "target", User: "root", Host: "127.0.0.1", Port: 1}}
+	hopKey := generateHopKey(hops)
+
+	// 无法连接时返回错误
+	if n, err := pool.Warm(context.Background(), hops, 1); err == nil || n != 0 {
+		t.Fatalf("Warm() = %d, %v; want 0 and an error", n, err)
+	}
+
+	for i := 0; i < config.MaxIdleConnsPerHop; i++ {
+		client := &PooledClient{pool: pool, hopKey: hopKey, chain: &ssh.Chain{}, id: uint64(i + 1)}
+		if !pool.park(client) {
+			t.Fatalf("park #%d rejected", i+1)
+		}
+	}
+	if pool.park(&PooledClient{pool: pool, hopKey: hopKey, chain: &ssh.Chain{}, id: 99}) {
+		t.Error("park should be rejected once the idle list is full")
+	}
+
+	// 空闲列表已满时不再建立连接
+	if n, err := pool.Warm(context.Background(), hops, 3); err != nil || n != 0 {
+		t.Errorf("Warm() on a full pool = %d, %v; want 0, nil", n, err)
+	}
+
+	snap := pool.Snapshot()
+	if snap.Total != 2 || snap.Idle != 2 || snap.Warm != 2 || snap.Active != 0 {
+		t.Errorf("unexpected snapshot: %+v", snap)
+	}
+	if len(snap.Keys) != 1 || snap.Keys[0].Key != hopKey || snap.Keys[0].Warm != 2 {
+		t.Errorf("unexpected key stats: %+v", snap.Keys)
+	}
+}
+
+// TestPoolKeepAliveEviction 测试连续 keepalive 失败后关闭空闲连接
+func TestPoolKeepAliveEviction(t *testing.T) {
+	config := DefaultPoolConfig()
+	config.KeepAliveInterval = 0 // 手动触发
+	config.KeepAliveMaxMissed = 2
+	var observed int
+	config.OnKeepAlive = func(hops []*types.Hop, rtt time.Duration, err error) {
+		if err == nil {
+			t.Error("keepalive on a disconnected client should fail")
+		}
+		observed++
+	}
+	pool := NewPool(config)
+	defer pool.Close()
+
+	hops := []*types.Hop{{Name: "target", User: "root", Host: "10.0.0.1", Port: 22}}
+	idle := &PooledClient{Client: &ssh.Client{}, pool: pool, hops: hops, hopKey: generateHopKey(hops), chain: &ssh.Chain{}, id: 1}
+	if !pool.park(idle) {
+		t.Fatal("park rejected")
+	}
+
+	pool.keepAliveIdle()
+	if snap := pool.Snapshot(); snap.Idle != 1 || snap.KeepAliveEvictions != 0 {
+		t.Fatalf("client should survive the first missed keepalive: %+v", snap)
+	}
+
+	pool.keepAliveIdle()
+	snap := pool.Snapshot()
+	if snap.Total != 0 || snap.Idle != 0 || snap.KeepAliveEvictions != 1 {
+		t.Errorf("client should be evicted after %d missed keepalives: %+v", config.KeepAliveMaxMissed, snap)
+	}
+	if observed != 2 {
+		t.Errorf("OnKeepAlive called %d times, want 2", observed)
+	}
+}
+
+// TestPooledClient_SharedRelease 测试共用连接在最后一个会话释放后才回到空闲列表
+func TestPooledClient_SharedRelease(t *testing.T) {
+	pool := NewPool(DefaultPoolConfig())
+	defer pool.Close()
+
+	client := &PooledClient{pool: pool, hopKey: "root@db:22", chain: &ssh.Chain{}, id: 1}
+	client.sessions.Store(2)
+	client.markUsed()
+	pool.mu.Lock()
+	pool.conns[client.hopKey] = []*PooledClient{client}
+	pool.mu.Unlock()
+
+	if snap := pool.Snapshot(); snap.Keys[0].Sessions != 2 || snap.Active != 1 {
+		t.Fatalf("unexpected snapshot: %+v", snap.Keys)
+	}
+
+	client.Release()
+	if !client.IsInUse() || pool.Snapshot().Idle != 0 {
+		t.Fatal("client should stay in use while another session shares it")
+	}
+
+	client.Release()
+	if client.IsInUse() {
+		t.Error("client should be idle after the last session is released")
+	}
+	if snap := pool.Snapshot(); snap.Idle != 1 || snap.Keys[0].Sessions != 0 {
+		t.Errorf("unexpected snapshot after release: %+v", snap)
+	}
+}
+
+// TestPoolTryShare 测试共用连接的条件
+func TestPoolTryShare(t *testing.T) {
+	config := DefaultPoolConfig()
+	pool := NewPool(config)
+	defer pool.Close()
+
+	// 断开的连接不共用
+	client := &PooledClient{Client: &ssh.Client{}, pool: pool, hopKey: "root@db:22", chain: &ssh.Chain{}, id: 1}
+	client.sessions.Store(1)
+	client.markUsed()
+	pool.mu.Lock()
+	pool.conns[client.hopKey] = []*PooledClient{client}
+	pool.mu.Unlock()
+	if pool.tryShare(client.hopKey) != nil {
+		t.Error("a disconnected client should not be shared")
+	}
+
+	config.MaxSessionsPerConn = 1
+	noShare := NewPool(config)
+	defer noShare.Close()
+	if noShare.tryShare(client.hopKey) != nil {
+		t.Error("sharing should be off when MaxSessionsPerConn is 1")
+	}
+}
+
+// TestPoolDisconnectAll 测试紧急断开：空闲连接立即移出，正在使用的连接归还后回收
+func TestPoolDisconnectAll(t *testing.T) {
+	pool := NewPool(DefaultPoolConfig())
+	defer pool.Close()
+
+	hops := []*types.Hop{{Name: "target", User: "root", Host: "10.0.0.1", Port: 22}}
+	idle := &PooledClient{Client: &ssh.Client{}, pool: pool, hops: hops, hopKey: generateHopKey(hops), chain: &ssh.Chain{}, id: 1}
+	if !pool.park(idle) {
+		t.Fatal("park rejected")
+	}
+	active := &PooledClient{pool: pool, hopKey: idle.hopKey, chain: &ssh.Chain{}, id: 2}
+	active.sessions.Store(1)
+	active.markUsed()
+	pool.mu.Lock()
+	pool.conns[active.hopKey] = append(pool.conns[active.hopKey], active)
+	pool.mu.Unlock()
+
+	if n := pool.DisconnectAll(); n != 2 {
+		t.Fatalf("DisconnectAll = %d, want 2", n)
+	}
+	if snap := pool.Snapshot(); snap.Idle != 0 || snap.Keys[0].Total != 1 {
+		t.Errorf("only the active client should remain: %+v", snap)
+	}
+	if pool.tryShare(active.hopKey) != nil {
+		t.Error("a disconnected client should not be shared")
+	}
+}
+
 // BenchmarkPoolStats_Concurrent 基准测试统计并发性能
 func BenchmarkPoolStats_Concurrent(b *testing.B) {
 	var stats PoolStats
@@ -61,6 +61,8 @@ type Session struct {
 	// 终端配置
 	terminalType string
 	size         TerminalSize
+	modes        types.TerminalModes
+	shell        string
 
 	// 控制
 	ctx    context.Context
@@ -71,6 +73,8 @@ type Session struct {
 	connected  atomic.Bool
 	startTime  time.Time
 	lastActive atomic.Value
+	lastInput  atomic.Value // 最后一次键盘输入的时间
+	lastOutput atomic.Value // 最后一次终端输出的时间
 
 	// 统计
 	stats SessionStats
@@ -97,6 +101,11 @@ type SessionConfig struct {
 	Cols         int
 	Rows         int
 	Pool         *Pool
+	// Modes PTY 模式，Shell 不为空时代替登录 shell 执行
+	Modes types.TerminalModes
+	Shell string
+	// CheckOrigin 校验 WebSocket 握手来源，为 nil 时只允许同源
+	CheckOrigin func(r *http.Request) bool
 }
 
 // NewSession 创建新的高性能终端会话
@@ -115,6 +124,8 @@ func NewSession(config SessionConfig) *Session {
 		hops:         config.Hops,
 		pool:         config.Pool,
 		terminalType: termType,
+		modes:        config.Modes,
+		shell:        config.Shell,
 		size: TerminalSize{
 			Cols: config.Cols,
 			Rows: config.Rows,
@@ -123,9 +134,7 @@ func NewSession(config SessionConfig) *Session {
 		cancel:    cancel,
 		startTime: time.Now(),
 		upgrader: &websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // 生产环境需要更严格的检查
-			},
+			CheckOrigin:     config.CheckOrigin,
 			ReadBufferSize:  32 * 1024,
 			WriteBufferSize: 32 * 1024,
 		},
@@ -211,20 +220,20 @@ func (s *Session) connect() error {
 	s.stderr = stderr
 
 	// 请求伪终端
-	modes := gossh.TerminalModes{
-		gossh.ECHO:          1,
-		gossh.TTY_OP_ISPEED: 14400,
-		gossh.TTY_OP_OSPEED: 14400,
-	}
+	modes := PTYModes(s.modes)
 
-	if err := s.sshSession.RequestPty(s.terminalType, s.size.Rows, s.size.Cols, modes); err != nil {
+	shellStart := time.Now()
+	// 服务器只允许 exec 时返回 *ssh.CapabilityError，调用方据此提示终端不可用
+	target := s.hops[len(s.hops)-1]
+	if err := ssh.RequestPTY(target, s.sshSession, s.terminalType, s.size.Rows, s.size.Cols, modes); err != nil {
 		return fmt.Errorf("failed to request PTY: %w", err)
 	}
 
 	// 启动 shell
-	if err := s.sshSession.Shell(); err != nil {
+	if err := ssh.StartShell(target, s.sshSession, s.shell); err != nil {
 		return fmt.Errorf("failed to start shell: %w", err)
 	}
+	ssh.RecordLoginPhase(target, ssh.PhaseShell, time.Since(shellStart))
 
 	// 创建转发器
 	s.forwarder = NewForwarder(DefaultForwarderConfig())
@@ -331,6 +340,7 @@ func (s *Session) handleWebSocketInput() error {
 				return fmt.Errorf("stdin write error: %w", err)
 			}
 			s.stats.BytesIn.Add(uint64(len(input.Data)))
+			s.lastInput.Store(time.Now())
 
 		case "resize":
 			var size TerminalSize
@@ -367,6 +377,7 @@ func (s *Session) handleSSHOutput(reader io.Reader, streamType string) error {
 
 		if n > 0 {
 			s.lastActive.Store(time.Now())
+			s.lastOutput.Store(time.Now())
 			s.stats.BytesOut.Add(uint64(n))
 
 			// 发送输出到 WebSocket
@@ -494,6 +505,22 @@ func (s *Session) GetLastActive() time.Time {
 	return v.(time.Time)
 }
 
+// GetLastInput 获取最后一次键盘输入的时间，没有输入时为开始时间
+func (s *Session) GetLastInput() time.Time {
+	if v := s.lastInput.Load(); v != nil {
+		return v.(time.Time)
+	}
+	return s.startTime
+}
+
+// GetLastOutput 获取最后一次终端输出的时间，没有输出时为开始时间
+func (s *Session) GetLastOutput() time.Time {
+	if v := s.lastOutput.Load(); v != nil {
+		return v.(time.Time)
+	}
+	return s.startTime
+}
+
 // Close 主动关闭会话
 func (s *Session) Close() error {
 	s.cancel()
@@ -0,0 +1,105 @@
+package tracing_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/tracing"
+	"github.com/luobobo896/HSSH/pkg/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// useRecorder 把全局 TracerProvider 换成内存记录器
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestSetupWithoutEndpointIsNoop(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+
+	shutdown, err := tracing.Setup(context.Background(), "test", types.TracingConfig{})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown failed: %v", err)
+	}
+	if tracing.Enabled(types.TracingConfig{}) {
+		t.Error("tracing should be disabled without an endpoint")
+	}
+}
+
+func TestInjectExtractRoundTrip(t *testing.T) {
+	useRecorder(t)
+
+	ctx, span := tracing.Start(context.Background(), "client")
+	defer span.End()
+
+	traceparent := tracing.Inject(ctx)
+	if traceparent == "" {
+		t.Fatal("expected a traceparent for a sampled span")
+	}
+	remote := trace.SpanContextFromContext(tracing.Extract(context.Background(), traceparent))
+	if remote.TraceID() != span.SpanContext().TraceID() || !remote.IsRemote() {
+		t.Errorf("extracted context %v does not continue trace %v", remote.TraceID(), span.SpanContext().TraceID())
+	}
+	if got := tracing.Extract(context.Background(), ""); trace.SpanContextFromContext(got).IsValid() {
+		t.Error("empty traceparent should not produce a span context")
+	}
+}
+
+func TestChainConnectSpanPerHop(t *testing.T) {
+	recorder := useRecorder(t)
+
+	// 一个立即关闭连接的监听端口，第一跳握手失败
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	chain := ssh.NewChain([]*types.Hop{
+		{Name: "gateway", Host: "127.0.0.1", Port: port, User: "root", Password: "x"},
+		{Name: "internal", Host: "10.0.0.1", Port: 22, User: "root", Password: "x"},
+	})
+	if err := chain.ConnectContext(context.Background()); err == nil {
+		t.Fatal("expected connect to fail")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected hop span and chain span, got %d", len(spans))
+	}
+	hop, root := spans[0], spans[1]
+	if hop.Name() != "ssh.hop.connect" || root.Name() != "ssh.chain.connect" {
+		t.Fatalf("unexpected spans: %s, %s", hop.Name(), root.Name())
+	}
+	if hop.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Error("hop span should be a child of the chain span")
+	}
+	if hop.Status().Code != codes.Error || root.Status().Code != codes.Error {
+		t.Error("failed connect should mark both spans as errors")
+	}
+}
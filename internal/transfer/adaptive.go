@@ -0,0 +1,324 @@
+package transfer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const (
+	// DefaultUploadStreams 自适应上传受窗口限制时使用的并行流数
+	DefaultUploadStreams = 4
+
+	// adaptiveProbeDuration 测量阶段的时长，这段时间内以保守参数上传文件开头
+	adaptiveProbeDuration = 2 * time.Second
+	// adaptiveProbeBuffer 测量阶段的缓冲区，与普通上传相同
+	adaptiveProbeBuffer = 32 * 1024
+	// maxAdaptiveBuffer 自适应缓冲区的上限
+	maxAdaptiveBuffer = 1 << 20
+	// minStreamBytes 每个并行流至少分到的字节数，更小的文件不值得多开会话
+	minStreamBytes = 8 << 20
+	// sshWindowSize SSH channel 的接收窗口，单个流的吞吐不超过窗口 / RTT
+	sshWindowSize = 2 << 20
+	// compressSampleSize 估算压缩率时读取的文件开头大小
+	compressSampleSize = 1 << 20
+	// compressRatio 样本压缩后不超过原大小的这一比例时才压缩
+	compressRatio = 0.7
+	// maxCompressThroughput 链路吞吐超过此值时本机 gzip 会成为瓶颈，不再压缩
+	maxCompressThroughput = 50 << 20
+)
+
+// UploadAdaptive 自适应地上传单个文件到 remoteFile：learned 为空时先以单流、32KB 缓冲区上传文件开头
+// 约 2 秒，测量吞吐和 RTT 并估算压缩率，再按 chooseTuning 选定的参数并行上传其余部分；
+// learned 非空时直接使用它。各部分先写入 <remoteFile>.gmssh-part-N，全部成功后在远端拼接。
+// 返回选用的参数
+func (t *SCPTransfer) UploadAdaptive(ctx context.Context, localFile, remoteFile string, learned *types.TransferTuning, progress chan<- *types.TransferProgress) (*types.TransferTuning, error) {
+	if t.run == nil && !t.chain.IsConnected() {
+		return nil, fmt.Errorf("SSH chain not connected")
+	}
+	file, err := os.Open(localFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local file: %w", err)
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat local file: %w", err)
+	}
+	size := stat.Size()
+
+	if err := t.runRemote(ctx, "mkdir -p "+terminal.ShellQuote(path.Dir(remoteFile)), nil, nil); err != nil {
+		return nil, fmt.Errorf("failed to create target directory: %w", err)
+	}
+	if err := t.backup(ctx, remoteFile); err != nil {
+		return nil, err
+	}
+
+	// 汇总各个流读取的字节数，定期报告整体进度
+	var sent atomic.Int64
+	name := path.Base(localFile)
+	stopProgress := make(chan struct{})
+	var progressDone sync.WaitGroup
+	if progress != nil {
+		progressDone.Add(1)
+		go func() {
+			defer progressDone.Done()
+			rate := NewRateEstimator(t.speedWindow, time.Now())
+			ticker := time.NewTicker(progressInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopProgress:
+					return
+				case <-ticker.C:
+					done := sent.Load()
+					progress <- runningProgress(name, size, done, rate.Update(done, time.Now()))
+				}
+			}
+		}()
+	}
+	stop := func() {
+		close(stopProgress)
+		progressDone.Wait()
+	}
+
+	var parts []string
+	cleanup := func() {
+		if len(parts) > 0 {
+			quoted := make([]string, len(parts))
+			for i, p := range parts {
+				quoted[i] = terminal.ShellQuote(p)
+			}
+			_ = t.runRemote(context.Background(), "rm -f "+strings.Join(quoted, " "), nil, nil)
+		}
+	}
+	partName := func() string {
+		p := fmt.Sprintf("%s.gmssh-part-%d", remoteFile, len(parts))
+		parts = append(parts, p)
+		return p
+	}
+
+	var offset int64
+	tuning := learned
+	if tuning != nil {
+		reused := *tuning
+		reused.Reused = true
+		tuning = &reused
+	} else {
+		rtt := t.measureRTT(ctx)
+		ratio := sampleCompressRatio(file, size)
+		gzipOK := ratio <= compressRatio && t.runRemote(ctx, "command -v gzip >/dev/null 2>&1", nil, nil) == nil
+
+		start := time.Now()
+		probe := &deadlineReader{r: io.NewSectionReader(file, 0, size), deadline: start.Add(adaptiveProbeDuration)}
+		if err := t.writePart(ctx, partName(), probe, adaptiveProbeBuffer, false, &sent); err != nil {
+			stop()
+			cleanup()
+			return nil, err
+		}
+		offset = probe.n
+		var throughput int64
+		if elapsed := time.Since(start); elapsed > 0 {
+			throughput = int64(float64(offset) / elapsed.Seconds())
+		}
+		tuning = chooseTuning(throughput, rtt, ratio, gzipOK, size-offset)
+		t.logger.Printf("[SCP] Adaptive upload: probed %d bytes at %d B/s, rtt=%v, compress ratio %.2f -> %d stream(s), %d byte buffer, compress=%v",
+			offset, throughput, rtt, ratio, tuning.Streams, tuning.BufferSize, tuning.Compress)
+	}
+
+	// 其余部分按流数切分，每个流不少于 minStreamBytes
+	remaining := size - offset
+	streams := max(1, min(tuning.Streams, int(remaining/minStreamBytes)))
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	chunk := remaining / int64(streams)
+	for i := 0; i < streams && (remaining > 0 || len(parts) == 0); i++ {
+		start, length := offset+int64(i)*chunk, chunk
+		if i == streams-1 {
+			length = size - start
+		}
+		part := partName()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := t.writePart(streamCtx, part, io.NewSectionReader(file, start, length), tuning.BufferSize, tuning.Compress, &sent)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	stop()
+	if firstErr != nil {
+		cleanup()
+		return tuning, firstErr
+	}
+
+	if err := t.assembleParts(ctx, parts, remoteFile); err != nil {
+		cleanup()
+		return tuning, err
+	}
+	if progress != nil {
+		progress <- &types.TransferProgress{
+			FileName:   name,
+			TotalBytes: size,
+			SentBytes:  size,
+			Status:     "completed",
+		}
+	}
+	t.logger.Printf("[SCP] Adaptive upload completed: %s (%d part(s))", remoteFile, len(parts))
+	return tuning, nil
+}
+
+// chooseTuning 按测量结果选择参数：缓冲区取带宽时延积（32KB 到 1MB）；单流吞吐接近窗口 / RTT 时
+// 说明受 SSH 窗口限制，改用多个流；样本可压缩、远端有 gzip 且链路不太快时压缩
+func chooseTuning(throughput int64, rtt time.Duration, ratio float64, gzipOK bool, remaining int64) *types.TransferTuning {
+	tuning := &types.TransferTuning{
+		Streams:    1,
+		BufferSize: adaptiveProbeBuffer,
+		RTTMillis:  rtt.Milliseconds(),
+		Throughput: throughput,
+	}
+	bdp := int64(float64(throughput) * rtt.Seconds())
+	for int64(tuning.BufferSize) < bdp && tuning.BufferSize < maxAdaptiveBuffer {
+		tuning.BufferSize *= 2
+	}
+	if rtt > 0 {
+		windowLimit := float64(sshWindowSize) / rtt.Seconds()
+		if float64(throughput) >= 0.7*windowLimit {
+			tuning.Streams = DefaultUploadStreams
+		}
+	}
+	tuning.Streams = max(1, min(tuning.Streams, int(remaining/minStreamBytes)))
+	tuning.Compress = gzipOK && ratio <= compressRatio && throughput < maxCompressThroughput
+	return tuning
+}
+
+// measureRTT 用 keepalive 测量到最后一跳的往返时间，无法测量时返回 0
+func (t *SCPTransfer) measureRTT(ctx context.Context) time.Duration {
+	if t.chain == nil || t.chain.LastHop() == nil {
+		return 0
+	}
+	rtt, err := t.chain.LastHop().KeepAlive(ctx)
+	if err != nil {
+		return 0
+	}
+	return rtt
+}
+
+// sampleCompressRatio 用 gzip 最快级别压缩文件开头，返回压缩后与原大小之比（空文件为 1）
+func sampleCompressRatio(file *os.File, size int64) float64 {
+	sample := min(size, compressSampleSize)
+	if sample <= 0 {
+		return 1
+	}
+	var counter countingWriter
+	zw, _ := gzip.NewWriterLevel(&counter, gzip.BestSpeed)
+	if _, err := io.Copy(zw, io.NewSectionReader(file, 0, sample)); err != nil {
+		return 1
+	}
+	zw.Close()
+	return float64(counter.n) / float64(sample)
+}
+
+// writePart 把 r 的内容写入远端文件 part；compress 时本机 gzip、远端解压
+func (t *SCPTransfer) writePart(ctx context.Context, part string, r io.Reader, bufferSize int, compress bool, sent *atomic.Int64) error {
+	source := bufio.NewReaderSize(&countingReader{r: r, n: sent}, bufferSize)
+	var stdin io.Reader = source
+	cmd := "cat > " + terminal.ShellQuote(part)
+	if compress {
+		pr, pw := io.Pipe()
+		go func() {
+			zw, _ := gzip.NewWriterLevel(pw, gzip.BestSpeed)
+			_, err := io.CopyBuffer(zw, source, make([]byte, bufferSize))
+			if err == nil {
+				err = zw.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+		defer pr.Close()
+		stdin = pr
+		cmd = "gzip -dc > " + terminal.ShellQuote(part)
+	}
+	if err := t.runRemote(ctx, cmd, stdin, nil); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", path.Base(part), err)
+	}
+	return nil
+}
+
+// assembleParts 在远端按顺序拼接各部分为 remoteFile 并删除它们，只有一部分时直接改名
+func (t *SCPTransfer) assembleParts(ctx context.Context, parts []string, remoteFile string) error {
+	quoted := make([]string, len(parts))
+	for i, p := range parts {
+		quoted[i] = terminal.ShellQuote(p)
+	}
+	target := terminal.ShellQuote(remoteFile)
+	cmd := "mv -f " + quoted[0] + " " + target
+	if len(parts) > 1 {
+		all := strings.Join(quoted, " ")
+		cmd = "cat " + all + " > " + target + " && rm -f " + all
+	}
+	if err := t.runRemote(ctx, cmd+" && chmod 644 "+target, nil, nil); err != nil {
+		return fmt.Errorf("failed to assemble %s: %w", remoteFile, err)
+	}
+	return nil
+}
+
+// deadlineReader 在 deadline 之后返回 EOF，用于限定测量阶段的时长
+type deadlineReader struct {
+	r        io.Reader
+	deadline time.Time
+	n        int64
+}
+
+func (d *deadlineReader) Read(p []byte) (int, error) {
+	if !time.Now().Before(d.deadline) {
+		return 0, io.EOF
+	}
+	n, err := d.r.Read(p)
+	d.n += int64(n)
+	return n, err
+}
+
+// countingReader 把读取的字节数累加到 n
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// countingWriter 只统计写入的字节数
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,106 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestChooseTuning(t *testing.T) {
+	tests := []struct {
+		name       string
+		throughput int64
+		rtt        time.Duration
+		ratio      float64
+		gzipOK     bool
+		remaining  int64
+		want       types.TransferTuning
+	}{
+		{"fast lan", 100 << 20, time.Millisecond, 0.3, true, 1 << 30,
+			types.TransferTuning{Streams: 1, BufferSize: 128 * 1024, Compress: false}},
+		{"window bound wan", 9 << 20, 200 * time.Millisecond, 1, false, 1 << 30,
+			types.TransferTuning{Streams: DefaultUploadStreams, BufferSize: 1 << 20}},
+		{"window bound but small file", 9 << 20, 200 * time.Millisecond, 1, false, 10 << 20,
+			types.TransferTuning{Streams: 1, BufferSize: 1 << 20}},
+		{"slow compressible link", 1 << 20, 20 * time.Millisecond, 0.2, true, 1 << 30,
+			types.TransferTuning{Streams: 1, BufferSize: 32 * 1024, Compress: true}},
+		{"no remote gzip", 1 << 20, 20 * time.Millisecond, 0.2, false, 1 << 30,
+			types.TransferTuning{Streams: 1, BufferSize: 32 * 1024}},
+		{"unknown rtt", 9 << 20, 0, 1, false, 1 << 30,
+			types.TransferTuning{Streams: 1, BufferSize: 32 * 1024}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chooseTuning(tt.throughput, tt.rtt, tt.ratio, tt.gzipOK, tt.remaining)
+			if got.Streams != tt.want.Streams || got.BufferSize != tt.want.BufferSize || got.Compress != tt.want.Compress {
+				t.Errorf("chooseTuning = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadAdaptive(t *testing.T) {
+	for _, tool := range []string{"sh", "cat", "gzip", "mv", "chmod"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+	scp := &SCPTransfer{logger: log.New(io.Discard, "", 0), run: localShell}
+	local := t.TempDir()
+	remote := t.TempDir()
+
+	// 可压缩的大文件按沿用的参数分 3 个流、压缩上传
+	big := bytes.Repeat([]byte("0123456789abcdef\n"), 25<<20/17)
+	bigFile := filepath.Join(local, "big.log")
+	if err := os.WriteFile(bigFile, big, 0644); err != nil {
+		t.Fatal(err)
+	}
+	learned := &types.TransferTuning{Streams: 3, BufferSize: 256 * 1024, Compress: true}
+	progress := make(chan *types.TransferProgress, 1000)
+	tuning, err := scp.UploadAdaptive(context.Background(), bigFile, filepath.Join(remote, "sub", "big.log"), learned, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tuning.Reused || tuning.Streams != 3 || learned.Reused {
+		t.Errorf("tuning = %+v (learned %+v)", tuning, learned)
+	}
+	if got, _ := os.ReadFile(filepath.Join(remote, "sub", "big.log")); !bytes.Equal(got, big) {
+		t.Errorf("uploaded content differs (%d of %d bytes)", len(got), len(big))
+	}
+	close(progress)
+	var last *types.TransferProgress
+	for p := range progress {
+		last = p
+	}
+	if last == nil || last.Status != "completed" || last.SentBytes != int64(len(big)) {
+		t.Errorf("last progress = %+v", last)
+	}
+
+	// 首次上传先测量，小文件在测量阶段就已传完
+	small := make([]byte, 300*1024)
+	rand.New(rand.NewSource(1)).Read(small)
+	smallFile := filepath.Join(local, "small.bin")
+	os.WriteFile(smallFile, small, 0644)
+	tuning, err = scp.UploadAdaptive(context.Background(), smallFile, filepath.Join(remote, "small.bin"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tuning.Reused || tuning.Streams != 1 || tuning.Compress {
+		t.Errorf("measured tuning = %+v", tuning)
+	}
+	if got, _ := os.ReadFile(filepath.Join(remote, "small.bin")); !bytes.Equal(got, small) {
+		t.Error("uploaded content differs")
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(remote, "*.gmssh-part-*")); len(leftovers) > 0 {
+		t.Errorf("parts left behind: %v", leftovers)
+	}
+}
@@ -0,0 +1,62 @@
+package transfer
+
+import (
+	"context"
+	"io"
+	"log"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/sshtest"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// benchFileSize 每次上传的文件大小，随机内容不可压缩
+const benchFileSize = 8 << 20
+
+// BenchmarkUpload 经由一个跳板上传同一个文件：scp 单流与自适应的并行分片。
+// 本模块只有 SCP 传输（SFTP 只在独立的 uploader 工具中），没有 SFTP 的对比项
+func BenchmarkUpload(b *testing.B) {
+	sshtest.DiscardLogs(b)
+	bastion := sshtest.NewServer(b, sshtest.Options{})
+	target := sshtest.NewServer(b, sshtest.Options{})
+	chain := ssh.NewChain([]*types.Hop{bastion.Hop("bastion"), target.Hop("target")})
+	chain.SetLogger(log.New(io.Discard, "", 0))
+	if err := chain.Connect(); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { chain.Disconnect() })
+	scp := NewSCPTransfer(chain)
+	scp.SetLogger(log.New(io.Discard, "", 0))
+
+	data := make([]byte, benchFileSize)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range data {
+		data[i] = byte(rng.Uint32())
+	}
+	file := filepath.Join(b.TempDir(), "bench.bin")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+	remote := filepath.Join(b.TempDir(), "bench.bin")
+
+	b.Run("scp", func(b *testing.B) {
+		b.SetBytes(benchFileSize)
+		for i := 0; i < b.N; i++ {
+			if err := scp.UploadContext(context.Background(), file, remote, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("adaptive", func(b *testing.B) {
+		b.SetBytes(benchFileSize)
+		for i := 0; i < b.N; i++ {
+			if _, err := scp.UploadAdaptive(context.Background(), file, remote, nil, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,430 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const (
+	// deltaMinBlock / deltaMaxBlock 块大小的范围，块数越多远端计算签名越慢、匹配越精细
+	deltaMinBlock = 64 * 1024
+	deltaMaxBlock = 8 * 1024 * 1024
+	// deltaTargetBlocks 按文件大小选块时的目标块数
+	deltaTargetBlocks = 2048
+	// deltaMaxOps 重组脚本的最大操作数，变化过于分散时整份上传更快
+	deltaMaxOps = 2000
+	// deltaMinSavings 差量至少节省的比例，否则整份上传
+	deltaMinSavings = 0.3
+)
+
+// deltaMinSize 小于该大小的文件直接整份上传（测试中调小）
+var deltaMinSize int64 = 16 * 1024 * 1024
+
+// DeltaResult 差量上传的结果
+type DeltaResult struct {
+	RemoteFile string `json:"remote_file"`
+	Delta      bool   `json:"delta"`                    // false 表示退回了整份上传
+	Reason     string `json:"reason,omitempty"`         // 退回整份上传的原因
+	Size       int64  `json:"size"`                     // 本地文件大小
+	Sent       int64  `json:"sent"`                     // 实际发送的字节数（差量时为变化的数据）
+	BlockSize  int    `json:"block_size,omitempty"`     // 使用的块大小
+	Matched    int    `json:"matched_blocks,omitempty"` // 复用远端旧文件的块数
+}
+
+// blockSig 远端旧文件一个整块的签名：弱校验和用于滚动匹配，sha256 用于确认
+type blockSig struct {
+	index  int
+	weak   uint32
+	strong string
+}
+
+// deltaOp 重组新文件的一段：copy 时取旧文件 [offset, offset+length)，否则取本地文件同一区间的数据
+type deltaOp struct {
+	copy   bool
+	offset int64
+	length int64
+}
+
+// UploadDelta 以类似 rsync 的方式上传修改过的大文件：远端按块计算旧文件的签名，
+// 本地用滚动校验和在新文件的任意偏移处查找相同的块，只发送变化的数据，由远端用旧文件和这些数据重组。
+// 重组结果的 sha256 与本地一致后才替换旧文件。远端没有旧文件、文件太小或节省不明显时整份上传
+func (t *SCPTransfer) UploadDelta(ctx context.Context, localPath, remotePath string, progress chan<- *types.TransferProgress) (*DeltaResult, error) {
+	if t.run == nil && !t.chain.IsConnected() {
+		return nil, fmt.Errorf("SSH chain not connected")
+	}
+	file, err := os.Open(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local file: %w", err)
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat local file: %w", err)
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("delta upload only supports single files")
+	}
+	size := stat.Size()
+	result := &DeltaResult{Size: size}
+
+	remoteFile, err := t.resolveRemoteFile(ctx, remotePath, filepath.Base(localPath))
+	if err != nil {
+		return nil, err
+	}
+	result.RemoteFile = remoteFile
+
+	full := func(reason string) (*DeltaResult, error) {
+		t.logger.Printf("[SCP] Delta upload of %s falls back to a full copy: %s", localPath, reason)
+		result.Reason = reason
+		result.Sent = size
+		if err := t.UploadContext(ctx, localPath, remoteFile, progress); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	if size < deltaMinSize {
+		return full("file is smaller than " + strconv.FormatInt(deltaMinSize>>20, 10) + " MB")
+	}
+
+	blockSize := deltaBlockSize(size)
+	sigs, oldSize, err := t.remoteSignatures(ctx, remoteFile, blockSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute remote block signatures: %w", err)
+	}
+	if oldSize < 0 {
+		return full("remote file does not exist")
+	}
+	if len(sigs) == 0 {
+		return full("remote file is smaller than one block")
+	}
+
+	ops, err := computeDelta(file, size, sigs, blockSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute delta: %w", err)
+	}
+	var literal int64
+	for _, op := range ops {
+		if op.copy {
+			result.Matched += int(op.length / int64(blockSize))
+		} else {
+			literal += op.length
+		}
+	}
+	result.BlockSize = blockSize
+	if float64(literal) > float64(size)*(1-deltaMinSavings) {
+		return full(fmt.Sprintf("only %d of %d bytes are unchanged", size-literal, size))
+	}
+	if len(ops) > deltaMaxOps {
+		return full(fmt.Sprintf("changes are spread over %d regions", len(ops)))
+	}
+
+	sum, err := fileSHA256(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash local file: %w", err)
+	}
+	t.logger.Printf("[SCP] Delta upload: %s, %d of %d bytes changed, %d block(s) of %d reused",
+		remoteFile, literal, size, result.Matched, blockSize)
+
+	// 只发送变化的数据，远端先写入临时文件再按操作顺序重组
+	var sections []io.Reader
+	for _, op := range ops {
+		if !op.copy {
+			sections = append(sections, io.NewSectionReader(file, op.offset, op.length))
+		}
+	}
+	name := filepath.Base(localPath)
+	reader := &progressReader{r: io.MultiReader(sections...), report: func(sent int64) {}}
+	if progress != nil {
+		rate := NewRateEstimator(t.speedWindow, time.Now())
+		reader.report = func(sent int64) {
+			progress <- runningProgress(name, literal, sent, rate.Update(sent, time.Now()))
+		}
+	}
+	if err := t.backup(ctx, remoteFile); err != nil {
+		return nil, err
+	}
+	if err := t.runRemote(ctx, deltaScript(remoteFile, ops, sum), reader, nil); err != nil {
+		return nil, fmt.Errorf("failed to apply delta: %w", err)
+	}
+	result.Delta = true
+	result.Sent = literal
+
+	if progress != nil {
+		progress <- &types.TransferProgress{
+			FileName:   name,
+			TotalBytes: size,
+			SentBytes:  size,
+			Status:     "completed",
+		}
+	}
+	return result, nil
+}
+
+// deltaBlockSize 按文件大小选择块大小：约 deltaTargetBlocks 块，对齐到 deltaMinBlock
+func deltaBlockSize(size int64) int {
+	block := (size/deltaTargetBlocks + deltaMinBlock - 1) / deltaMinBlock * deltaMinBlock
+	return int(min(max(block, deltaMinBlock), deltaMaxBlock))
+}
+
+// resolveRemoteFile 与 uploadFile 相同：remotePath 以 / 结尾或为已有目录时，目标为其中的 name
+func (t *SCPTransfer) resolveRemoteFile(ctx context.Context, remotePath, name string) (string, error) {
+	if strings.HasSuffix(remotePath, "/") {
+		return path.Join(remotePath, name), nil
+	}
+	var out bytes.Buffer
+	if err := t.runRemote(ctx, "if [ -d "+terminal.ShellQuote(remotePath)+" ]; then echo dir; fi", nil, &out); err != nil {
+		return "", fmt.Errorf("failed to check remote path: %w", err)
+	}
+	if strings.TrimSpace(out.String()) == "dir" {
+		return path.Join(remotePath, name), nil
+	}
+	return remotePath, nil
+}
+
+// remoteSignatures 在远端计算旧文件每个整块的签名，只用 POSIX 工具：od + awk 计算弱校验和，
+// dd 逐块计算 sha256。末尾不足一块的部分不参与匹配。旧文件不存在时 size 为 -1
+func (t *SCPTransfer) remoteSignatures(ctx context.Context, remoteFile string, blockSize int) ([]blockSig, int64, error) {
+	f := terminal.ShellQuote(remoteFile)
+	bs := strconv.Itoa(blockSize)
+	cmd := "f=" + f + "; [ -f \"$f\" ] || { echo missing; exit 0; }" +
+		"; if command -v sha256sum >/dev/null 2>&1; then h=sha256sum; else h='shasum -a 256'; fi" +
+		"; size=$(wc -c < \"$f\" | tr -d ' '); echo size $size; n=$((size / " + bs + "))" +
+		"; od -An -v -tu1 \"$f\" | awk -v B=" + bs + " '{ for (i = 1; i <= NF; i++) { a = (a + $i) % 65536; b = (b + a) % 65536; if (++c == B) { print \"weak\", k++, a, b; a = 0; b = 0; c = 0 } } }'" +
+		"; i=0; while [ $i -lt $n ]; do echo strong $i $(dd if=\"$f\" bs=" + bs + " skip=$i count=1 2>/dev/null | $h | cut -c1-64); i=$((i + 1)); done"
+
+	var out bytes.Buffer
+	if err := t.runRemote(ctx, cmd, nil, &out); err != nil {
+		return nil, 0, err
+	}
+	return parseSignatures(&out)
+}
+
+// parseSignatures 解析 remoteSignatures 的输出
+func parseSignatures(r io.Reader) ([]blockSig, int64, error) {
+	var (
+		sigs []blockSig
+		size int64 = -1
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case fields[0] == "missing":
+			return nil, -1, nil
+		case fields[0] == "size" && len(fields) == 2:
+			n, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid size line %q", scanner.Text())
+			}
+			size = n
+		case fields[0] == "weak" && len(fields) == 4:
+			index, err1 := strconv.Atoi(fields[1])
+			a, err2 := strconv.ParseUint(fields[2], 10, 16)
+			b, err3 := strconv.ParseUint(fields[3], 10, 16)
+			if err1 != nil || err2 != nil || err3 != nil || index != len(sigs) {
+				return nil, 0, fmt.Errorf("invalid checksum line %q", scanner.Text())
+			}
+			sigs = append(sigs, blockSig{index: index, weak: uint32(a) | uint32(b)<<16})
+		case fields[0] == "strong" && len(fields) == 3:
+			index, err := strconv.Atoi(fields[1])
+			if err != nil || index < 0 || index >= len(sigs) {
+				return nil, 0, fmt.Errorf("invalid checksum line %q", scanner.Text())
+			}
+			sigs[index].strong = fields[2]
+		default:
+			return nil, 0, fmt.Errorf("unexpected signature line %q", scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	if size < 0 {
+		return nil, 0, fmt.Errorf("remote did not report the file size")
+	}
+	for _, sig := range sigs {
+		if sig.strong == "" {
+			return nil, 0, fmt.Errorf("missing sha256 for block %d", sig.index)
+		}
+	}
+	return sigs, size, nil
+}
+
+// rollingSum rsync 的弱校验和：a 为字节和，b 为各前缀和之和，均模 2^16，可在窗口滑动一个字节时 O(1) 更新
+type rollingSum struct {
+	a, b uint32
+	n    uint32
+}
+
+func newRollingSum(window []byte) rollingSum {
+	s := rollingSum{n: uint32(len(window))}
+	for _, c := range window {
+		s.a += uint32(c)
+		s.b += s.a
+	}
+	s.a &= 0xffff
+	s.b &= 0xffff
+	return s
+}
+
+// roll 窗口移出 out、移入 in
+func (s *rollingSum) roll(out, in byte) {
+	s.a = (s.a - uint32(out) + uint32(in)) & 0xffff
+	s.b = (s.b - s.n*uint32(out) + s.a) & 0xffff
+}
+
+func (s rollingSum) sum() uint32 {
+	return s.a | s.b<<16
+}
+
+// computeDelta 在本地文件中滚动查找与 sigs 相同的块，返回重组新文件的操作序列，相邻的操作已合并
+func computeDelta(r io.ReaderAt, size int64, sigs []blockSig, blockSize int) ([]deltaOp, error) {
+	table := make(map[uint32][]blockSig, len(sigs))
+	for _, sig := range sigs {
+		table[sig.weak] = append(table[sig.weak], sig)
+	}
+
+	var ops []deltaOp
+	emit := func(op deltaOp) {
+		if op.length == 0 {
+			return
+		}
+		if n := len(ops); n > 0 && ops[n-1].copy == op.copy {
+			last := &ops[n-1]
+			if !op.copy || last.offset+last.length == op.offset {
+				last.length += op.length
+				return
+			}
+		}
+		ops = append(ops, op)
+	}
+
+	window := make([]byte, blockSize)
+	bs := int64(blockSize)
+	var (
+		pos, literalStart int64
+		sum               rollingSum
+		out, in           *bufio.Reader
+	)
+	// reset 从 pos 开始重新计算窗口
+	reset := func() error {
+		if _, err := r.ReadAt(window, pos); err != nil && err != io.EOF {
+			return err
+		}
+		sum = newRollingSum(window)
+		out = bufio.NewReaderSize(io.NewSectionReader(r, pos, size-pos), 64*1024)
+		in = bufio.NewReaderSize(io.NewSectionReader(r, pos+bs, size-pos-bs), 64*1024)
+		return nil
+	}
+	if size >= bs {
+		if err := reset(); err != nil {
+			return nil, err
+		}
+	}
+	for pos+bs <= size {
+		if candidates, ok := table[sum.sum()]; ok {
+			if _, err := r.ReadAt(window, pos); err != nil && err != io.EOF {
+				return nil, err
+			}
+			strong := sha256.Sum256(window)
+			hash := hex.EncodeToString(strong[:])
+			matched := false
+			for _, sig := range candidates {
+				if sig.strong == hash {
+					emit(deltaOp{offset: literalStart, length: pos - literalStart})
+					emit(deltaOp{copy: true, offset: int64(sig.index) * bs, length: bs})
+					matched = true
+					break
+				}
+			}
+			if matched {
+				pos += bs
+				literalStart = pos
+				if pos+bs <= size {
+					if err := reset(); err != nil {
+						return nil, err
+					}
+				}
+				continue
+			}
+		}
+		if pos+bs == size {
+			break
+		}
+		o, err := out.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		i, err := in.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		sum.roll(o, i)
+		pos++
+	}
+	emit(deltaOp{offset: literalStart, length: size - literalStart})
+	return ops, nil
+}
+
+// deltaScript 远端重组脚本：stdin 为按顺序拼接的变化数据，先写入补丁文件，
+// 再用 tail -c +N | head -c L 从旧文件和补丁中取出各段，sha256 与 sum 一致时替换旧文件
+func deltaScript(remoteFile string, ops []deltaOp, sum string) string {
+	var b strings.Builder
+	b.WriteString("set -e; f=" + terminal.ShellQuote(remoteFile) + "; tmp=\"$f.hssh-delta.$$\"; patch=\"$tmp.patch\"")
+	b.WriteString("; trap 'rm -f \"$tmp\" \"$patch\"' EXIT; cat > \"$patch\"; {")
+	var patchOffset int64
+	for _, op := range ops {
+		if op.copy {
+			fmt.Fprintf(&b, " tail -c +%d \"$f\" | head -c %d;", op.offset+1, op.length)
+		} else {
+			fmt.Fprintf(&b, " tail -c +%d \"$patch\" | head -c %d;", patchOffset+1, op.length)
+			patchOffset += op.length
+		}
+	}
+	b.WriteString(" } > \"$tmp\"")
+	b.WriteString("; if command -v sha256sum >/dev/null 2>&1; then h=sha256sum; else h='shasum -a 256'; fi")
+	b.WriteString("; [ \"$($h \"$tmp\" | cut -c1-64)\" = " + sum + " ] || { echo 'checksum mismatch after applying delta' >&2; exit 1; }")
+	b.WriteString("; chmod 644 \"$tmp\"; mv -f \"$tmp\" \"$f\"")
+	return b.String()
+}
+
+// fileSHA256 计算 r 全部内容的 sha256
+func fileSHA256(r io.ReaderAt) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, 1<<62)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// progressReader 读取时回报累计字节数
+type progressReader struct {
+	r      io.Reader
+	n      int64
+	report func(int64)
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	if n > 0 {
+		p.n += int64(n)
+		p.report(p.n)
+	}
+	return n, err
+}
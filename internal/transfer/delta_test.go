@@ -0,0 +1,154 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// signaturesOf 在本地计算 data 整块的签名，与 remoteSignatures 的结果相同
+func signaturesOf(data []byte, blockSize int) []blockSig {
+	var sigs []blockSig
+	for i := 0; (i+1)*blockSize <= len(data); i++ {
+		block := data[i*blockSize : (i+1)*blockSize]
+		sum := sha256.Sum256(block)
+		sigs = append(sigs, blockSig{index: i, weak: newRollingSum(block).sum(), strong: hex.EncodeToString(sum[:])})
+	}
+	return sigs
+}
+
+// applyDelta 按操作序列用旧文件和新文件重组
+func applyDelta(old, new []byte, ops []deltaOp) []byte {
+	var out []byte
+	for _, op := range ops {
+		src := new
+		if op.copy {
+			src = old
+		}
+		out = append(out, src[op.offset:op.offset+op.length]...)
+	}
+	return out
+}
+
+func TestRollingSum(t *testing.T) {
+	data := make([]byte, 300)
+	rand.New(rand.NewSource(1)).Read(data)
+	sum := newRollingSum(data[:100])
+	for i := 1; i+100 <= len(data); i++ {
+		sum.roll(data[i-1], data[i+99])
+		if want := newRollingSum(data[i : i+100]).sum(); sum.sum() != want {
+			t.Fatalf("offset %d: rolled %08x, want %08x", i, sum.sum(), want)
+		}
+	}
+}
+
+func TestComputeDelta(t *testing.T) {
+	const bs = 64
+	old := make([]byte, 64*bs+10)
+	rand.New(rand.NewSource(2)).Read(old)
+	modified := append([]byte(nil), old...)
+	copy(modified[10*bs+5:], "changed")
+
+	tests := []struct {
+		name    string
+		new     []byte
+		literal int64 // 最多需要发送的字节数
+	}{
+		{"identical", old, 10},
+		{"modified block", modified, bs + 10},
+		{"inserted bytes", append(append(append([]byte(nil), old[:20*bs+3]...), "inserted"...), old[20*bs+3:]...), bs + 8 + 10},
+		{"truncated head", old[bs/2:], bs},
+		{"appended", append(append([]byte(nil), old...), bytes.Repeat([]byte("x"), 500)...), 510},
+		{"unrelated", bytes.Repeat([]byte("y"), len(old)), int64(len(old))},
+		{"shorter than a block", old[:bs-1], bs - 1},
+	}
+	sigs := signaturesOf(old, bs)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := computeDelta(bytes.NewReader(tt.new), int64(len(tt.new)), sigs, bs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := applyDelta(old, tt.new, ops); !bytes.Equal(got, tt.new) {
+				t.Fatalf("reassembled %d bytes do not match the new file (%d bytes)", len(got), len(tt.new))
+			}
+			var literal int64
+			for i, op := range ops {
+				if !op.copy {
+					literal += op.length
+				}
+				if i > 0 && !op.copy && !ops[i-1].copy {
+					t.Errorf("adjacent literal ops were not merged: %+v", ops)
+				}
+			}
+			if literal > tt.literal {
+				t.Errorf("literal bytes = %d, want at most %d", literal, tt.literal)
+			}
+		})
+	}
+}
+
+func TestUploadDelta(t *testing.T) {
+	for _, tool := range []string{"sh", "od", "awk", "dd", "tail", "head"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+	oldMin := deltaMinSize
+	deltaMinSize = 0
+	defer func() { deltaMinSize = oldMin }()
+
+	old := make([]byte, 20*deltaMinBlock+123)
+	rand.New(rand.NewSource(3)).Read(old)
+	updated := append(append(append([]byte(nil), old[:7*deltaMinBlock+99]...), "a new line\n"...), old[7*deltaMinBlock+99:]...)
+	copy(updated[15*deltaMinBlock:], "patched")
+
+	dir := t.TempDir()
+	remoteDir := filepath.Join(dir, "remote")
+	if err := os.Mkdir(remoteDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	remote := filepath.Join(remoteDir, "data.bin")
+	local := filepath.Join(dir, "data.bin")
+	if err := os.WriteFile(remote, old, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(local, updated, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent int64
+	scp := &SCPTransfer{logger: log.New(io.Discard, "", 0)}
+	scp.run = func(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer) error {
+		if stdin != nil {
+			data, _ := io.ReadAll(stdin)
+			sent += int64(len(data))
+			stdin = bytes.NewReader(data)
+		}
+		return localShell(ctx, cmd, stdin, stdout)
+	}
+
+	// 目标为目录时写入其中的同名文件
+	result, err := scp.UploadDelta(context.Background(), local, remoteDir, nil)
+	if err != nil {
+		t.Fatalf("UploadDelta: %v", err)
+	}
+	if !result.Delta || result.RemoteFile != remote || result.Sent != sent || sent > 3*deltaMinBlock {
+		t.Errorf("result = %+v, sent %d bytes", result, sent)
+	}
+	got, err := os.ReadFile(remote)
+	if err != nil || !bytes.Equal(got, updated) {
+		t.Fatalf("remote file does not match the local file (%d bytes, err %v)", len(got), err)
+	}
+	if entries, _ := os.ReadDir(remoteDir); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
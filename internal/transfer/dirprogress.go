@@ -0,0 +1,126 @@
+package transfer
+
+import (
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// ScanDir 预扫描目录，按上传顺序返回所有文件（相对路径，状态 pending）及总字节数
+func ScanDir(root string) ([]types.FileProgress, int64, error) {
+	var files []types.FileProgress
+	var total int64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, types.FileProgress{
+			Name:   filepath.ToSlash(rel),
+			Size:   info.Size(),
+			Status: "pending",
+		})
+		total += info.Size()
+		return nil
+	})
+	return files, total, err
+}
+
+// dirProgress 目录上传的整体进度：总量来自预扫描，速度按整个目录计算
+// 发出的进度消息中 Files 只包含发生变化的文件，接收方按名称合并
+type dirProgress struct {
+	root     string
+	total    int64
+	done     int64  // 已结束文件的字节数
+	name     string // 当前文件（相对路径）
+	size     int64  // 当前文件大小
+	current  int64  // 当前文件已发送的字节数
+	failed   int
+	resumed  int64            // 之前运行中已上传、本次跳过的字节数，不计入速度
+	sizes    map[string]int64 // 预扫描得到的文件大小
+	rate     *RateEstimator
+	progress chan<- *types.TransferProgress
+}
+
+func newDirProgress(root string, window time.Duration, progress chan<- *types.TransferProgress) (*dirProgress, []types.FileProgress, error) {
+	files, total, err := ScanDir(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	sizes := make(map[string]int64, len(files))
+	for _, f := range files {
+		sizes[f.Name] = f.Size
+	}
+	return &dirProgress{
+		root:     root,
+		total:    total,
+		sizes:    sizes,
+		rate:     NewRateEstimator(window, time.Now()),
+		progress: progress,
+	}, files, nil
+}
+
+// begin 开始上传本地文件 localFile
+func (d *dirProgress) begin(localFile string) {
+	rel, err := filepath.Rel(d.root, localFile)
+	if err != nil {
+		rel = filepath.Base(localFile)
+	}
+	d.name = filepath.ToSlash(rel)
+	d.size = d.sizes[d.name]
+	d.current = 0
+}
+
+// emit 发送一条整体进度，附带发生变化的文件
+func (d *dirProgress) emit(files ...types.FileProgress) {
+	if d.progress == nil {
+		return
+	}
+	sent := d.done + d.current
+	p := runningProgress(filepath.Base(d.root), d.total, sent, d.rate.Update(sent-d.resumed, time.Now()))
+	p.Files = files
+	d.progress <- p
+}
+
+// start 发送完整的文件清单
+func (d *dirProgress) start(files []types.FileProgress) {
+	d.emit(files...)
+}
+
+// resume 当前文件的前 n 字节已在之前的运行中上传
+func (d *dirProgress) resume(n int64) {
+	d.resumed += n
+	d.current = n
+}
+
+// running 当前文件已发送 sent 字节
+func (d *dirProgress) running(sent int64) {
+	d.current = sent
+	d.emit(types.FileProgress{Name: d.name, Size: d.size, SentBytes: sent, Status: "running"})
+}
+
+// finish 当前文件结束，err 非 nil 时记为失败
+func (d *dirProgress) finish(err error) {
+	file := types.FileProgress{Name: d.name, Size: d.size, SentBytes: d.size, Status: "completed"}
+	if err != nil {
+		d.failed++
+		file.SentBytes = d.current
+		file.Status = "failed"
+		file.Error = err.Error()
+	}
+	d.done += file.SentBytes
+	d.current = 0
+	d.emit(file)
+}
@@ -0,0 +1,100 @@
+package transfer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// makeTree 在临时目录中创建文件，返回根目录
+func makeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestScanDirListsFilesInUploadOrder(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"b.txt":       "bb",
+		"a/z.txt":     "zzz",
+		"a/sub/y.txt": "y",
+		"c.txt":       "",
+	})
+
+	files, total, err := ScanDir(root)
+	if err != nil {
+		t.Fatalf("ScanDir failed: %v", err)
+	}
+	want := []string{"a/sub/y.txt", "a/z.txt", "b.txt", "c.txt"}
+	if len(files) != len(want) {
+		t.Fatalf("got %d files, want %d: %+v", len(files), len(want), files)
+	}
+	for i, name := range want {
+		if files[i].Name != name || files[i].Status != "pending" {
+			t.Errorf("files[%d] = %+v, want pending %s", i, files[i], name)
+		}
+	}
+	if total != 6 {
+		t.Errorf("total = %d, want 6", total)
+	}
+}
+
+func TestDirProgressReportsOverallAndPerFile(t *testing.T) {
+	root := makeTree(t, map[string]string{"a.txt": "aaaa", "b/c.txt": "cccccc"})
+	ch := make(chan *types.TransferProgress, 100)
+
+	dir, files, err := newDirProgress(root, 0, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir.start(files)
+
+	dir.begin(filepath.Join(root, "a.txt"))
+	dir.running(4)
+	dir.finish(nil)
+	dir.begin(filepath.Join(root, "b", "c.txt"))
+	dir.running(2)
+	dir.finish(errors.New("permission denied"))
+	close(ch)
+
+	task := &types.TransferProgress{}
+	var last *types.TransferProgress
+	for p := range ch {
+		if p.TotalBytes != 10 {
+			t.Errorf("total = %d, want 10 from pre-scan", p.TotalBytes)
+		}
+		task.MergeFiles(p.Files)
+		last = p
+	}
+
+	if last.SentBytes != 6 {
+		t.Errorf("overall sent = %d, want 6", last.SentBytes)
+	}
+	if dir.failed != 1 {
+		t.Errorf("failed = %d, want 1", dir.failed)
+	}
+	want := []types.FileProgress{
+		{Name: "a.txt", Size: 4, SentBytes: 4, Status: "completed"},
+		{Name: "b/c.txt", Size: 6, SentBytes: 2, Status: "failed", Error: "permission denied"},
+	}
+	if len(task.Files) != len(want) {
+		t.Fatalf("merged files = %+v", task.Files)
+	}
+	for i := range want {
+		if task.Files[i] != want[i] {
+			t.Errorf("files[%d] = %+v, want %+v", i, task.Files[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/internal/tracing"
+	"github.com/luobobo896/HSSH/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// fetchCleanupTimeout 删除远端临时压缩包的最长时间，下载被取消后仍会尝试
+const fetchCleanupTimeout = 30 * time.Second
+
+// FetchOptions 打包下载目录的选项
+type FetchOptions struct {
+	RemoteTemp string // 远端存放压缩包的目录，为空时为 $TMPDIR 或 /tmp
+}
+
+// FetchResult 打包下载的结果
+type FetchResult struct {
+	RemoteDir string `json:"remote_dir"`
+	Archive   string `json:"archive"`   // 本地 .tar.gz 路径
+	DirBytes  int64  `json:"dir_bytes"` // 远端目录的磁盘占用（du）
+	Bytes     int64  `json:"bytes"`     // 压缩包大小
+}
+
+// ArchiveName 目录打包后的默认文件名
+func ArchiveName(remoteDir string) string {
+	name := path.Base(strings.TrimRight(remoteDir, "/"))
+	if name == "" || name == "/" || name == "." {
+		name = "root"
+	}
+	return name + ".tar.gz"
+}
+
+// FetchDir 在远端把 remoteDir 打包压缩为临时文件，经链下载到 localFile，最后删除远端临时文件。
+// 打包前要求远端临时目录的可用空间大于目录占用，下载前检查本地可用空间
+func (t *SCPTransfer) FetchDir(ctx context.Context, remoteDir, localFile string, opts FetchOptions, progress chan<- *types.TransferProgress) (result *FetchResult, err error) {
+	ctx, span := tracing.Start(ctx, "transfer.fetch_dir",
+		attribute.String("transfer.remote_path", remoteDir),
+		attribute.String("transfer.local_path", localFile),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	if t.run == nil && !t.chain.IsConnected() {
+		return nil, fmt.Errorf("SSH chain not connected")
+	}
+	name := filepath.Base(localFile)
+	if progress != nil {
+		progress <- &types.TransferProgress{FileName: name, Status: "running"}
+	}
+
+	var out bytes.Buffer
+	if err := t.runRemote(ctx, fetchArchiveScript(remoteDir, opts.RemoteTemp), nil, &out); err != nil {
+		return nil, fmt.Errorf("failed to archive remote directory: %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		return nil, fmt.Errorf("unexpected archive output: %q", out.String())
+	}
+	archive := lines[0]
+	defer func() {
+		cleanup, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchCleanupTimeout)
+		defer cancel()
+		if err := t.runRemote(cleanup, "rm -f "+terminal.ShellQuote(archive), nil, nil); err != nil {
+			t.logger.Printf("[SCP] Failed to remove remote archive %s: %v", archive, err)
+		}
+	}()
+	dirKB, err1 := strconv.ParseInt(strings.TrimSpace(lines[1]), 10, 64)
+	size, err2 := strconv.ParseInt(strings.TrimSpace(lines[2]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("unexpected archive output: %q", out.String())
+	}
+	result = &FetchResult{RemoteDir: remoteDir, Archive: localFile, DirBytes: dirKB * 1024, Bytes: size}
+	t.logger.Printf("[SCP] Archived %s (%d KB) to %s (%d bytes)", remoteDir, dirKB, archive, size)
+
+	if free := freeBytes(filepath.Dir(localFile)); free >= 0 && free < size {
+		return nil, fmt.Errorf("not enough local space in %s: archive is %d bytes, %d free", filepath.Dir(localFile), size, free)
+	}
+	file, err := os.Create(localFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create local file: %w", err)
+	}
+	writer := &progressWriter{w: file, report: func(int64) {}}
+	if progress != nil {
+		rate := NewRateEstimator(t.speedWindow, time.Now())
+		writer.report = func(received int64) {
+			progress <- runningProgress(name, size, received, rate.Update(received, time.Now()))
+		}
+	}
+	err = t.runRemote(ctx, "cat "+terminal.ShellQuote(archive), nil, writer)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && writer.n != size {
+		err = fmt.Errorf("received %d of %d bytes", writer.n, size)
+	}
+	if err != nil {
+		os.Remove(localFile)
+		return nil, fmt.Errorf("failed to download archive: %w", err)
+	}
+
+	if progress != nil {
+		progress <- &types.TransferProgress{
+			FileName:   name,
+			TotalBytes: size,
+			SentBytes:  size,
+			Status:     "completed",
+		}
+	}
+	return result, nil
+}
+
+// fetchArchiveScript 远端打包脚本：检查临时目录空间后用 tar -czf 打包到 mktemp 文件，
+// 输出压缩包路径、目录占用（KB）和压缩包大小各一行；打包失败时删除临时文件
+func fetchArchiveScript(remoteDir, remoteTemp string) string {
+	tmp := `"${TMPDIR:-/tmp}"`
+	if remoteTemp != "" {
+		tmp = terminal.ShellQuote(remoteTemp)
+	}
+	var b strings.Builder
+	b.WriteString("set -e; d=" + terminal.ShellQuote(remoteDir) + "; tmp=" + tmp)
+	b.WriteString(`; [ -d "$d" ] || { echo "not a directory: $d" >&2; exit 2; }`)
+	b.WriteString(`; need=$(du -sk "$d" 2>/dev/null | awk '{print $1}'); free=$(df -Pk "$tmp" | awk 'NR==2 {print $4}')`)
+	b.WriteString(`; [ "$free" -gt "$need" ] || { echo "not enough space in $tmp: directory uses ${need} KB, ${free} KB free" >&2; exit 3; }`)
+	b.WriteString(`; f=$(mktemp "$tmp/hssh-fetch.XXXXXX")`)
+	b.WriteString(`; tar -czf "$f" -C "$(dirname "$d")" "$(basename "$d")" || { rm -f "$f"; exit 1; }`)
+	b.WriteString(`; printf '%s\n%s\n%s\n' "$f" "$need" "$(wc -c < "$f" | tr -d ' ')"`)
+	return b.String()
+}
+
+// progressWriter 写入时回报累计字节数
+type progressWriter struct {
+	w      io.Writer
+	n      int64
+	report func(int64)
+}
+
+func (p *progressWriter) Write(buf []byte) (int, error) {
+	n, err := p.w.Write(buf)
+	if n > 0 {
+		p.n += int64(n)
+		p.report(p.n)
+	}
+	return n, err
+}
@@ -0,0 +1,117 @@
+package transfer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestFetchDir(t *testing.T) {
+	for _, tool := range []string{"sh", "tar", "du", "df", "mktemp", "awk"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+
+	remote := filepath.Join(t.TempDir(), "app logs")
+	contents := map[string]string{
+		"app.log":     strings.Repeat("line\n", 20000),
+		"old/a.log.1": "older",
+	}
+	for name, data := range contents {
+		path := filepath.Join(remote, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	remoteTemp := t.TempDir()
+	local := filepath.Join(t.TempDir(), ArchiveName(remote+"/"))
+	scp := &SCPTransfer{logger: log.New(io.Discard, "", 0), run: localShell}
+	progress := make(chan *types.TransferProgress, 1000)
+	result, err := scp.FetchDir(context.Background(), remote, local, FetchOptions{RemoteTemp: remoteTemp}, progress)
+	if err != nil {
+		t.Fatalf("FetchDir: %v", err)
+	}
+	close(progress)
+	var last *types.TransferProgress
+	for p := range progress {
+		last = p
+	}
+	if last == nil || last.Status != "completed" || last.SentBytes != result.Bytes {
+		t.Errorf("last progress = %+v", last)
+	}
+	if filepath.Base(local) != "app logs.tar.gz" || result.Archive != local || result.DirBytes <= 0 {
+		t.Errorf("result = %+v", result)
+	}
+	if stat, err := os.Stat(local); err != nil || stat.Size() != result.Bytes {
+		t.Errorf("local archive: %v (%d bytes expected)", err, result.Bytes)
+	}
+	if entries, _ := os.ReadDir(remoteTemp); len(entries) != 0 {
+		t.Errorf("remote archive left behind: %v", entries)
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			data, _ := io.ReadAll(tr)
+			got[strings.TrimPrefix(hdr.Name, "app logs/")] = string(data)
+		}
+	}
+	for name, data := range contents {
+		if got[name] != data {
+			t.Errorf("%s: got %d bytes, want %d", name, len(got[name]), len(data))
+		}
+	}
+
+	// 不是目录时失败，不留下本地文件
+	missing := filepath.Join(t.TempDir(), "missing.tar.gz")
+	if _, err := scp.FetchDir(context.Background(), filepath.Join(remote, "app.log"), missing, FetchOptions{RemoteTemp: remoteTemp}, nil); err == nil {
+		t.Error("expected an error for a regular file")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("local file created for a failed fetch: %v", err)
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	for in, want := range map[string]string{
+		"/var/log/app":  "app.tar.gz",
+		"/var/log/app/": "app.tar.gz",
+		"/":             "root.tar.gz",
+		"data":          "data.tar.gz",
+	} {
+		if got := ArchiveName(in); got != want {
+			t.Errorf("ArchiveName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/sshtest"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// connectTestChain 经由一个跳板连接到进程内的 SSH 服务器
+func connectTestChain(t *testing.T) *SCPTransfer {
+	t.Helper()
+	bastion := sshtest.NewServer(t, sshtest.Options{})
+	target := sshtest.NewServer(t, sshtest.Options{})
+	chain := ssh.NewChain([]*types.Hop{bastion.Hop("bastion"), target.Hop("target")})
+	chain.SetLogger(log.New(io.Discard, "", 0))
+	if err := chain.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { chain.Disconnect() })
+	scp := NewSCPTransfer(chain)
+	scp.SetLogger(log.New(io.Discard, "", 0))
+	return scp
+}
+
+func TestTransferOverChain(t *testing.T) {
+	scp := connectTestChain(t)
+	local := t.TempDir()
+	remote := t.TempDir()
+
+	data := bytes.Repeat([]byte("payload\n"), 64*1024)
+	file := filepath.Join(local, "app.bin")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := scp.UploadContext(context.Background(), file, remote+"/", nil); err != nil {
+		t.Fatalf("upload file: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(remote, "app.bin")); !bytes.Equal(got, data) {
+		t.Errorf("uploaded file differs (%d of %d bytes)", len(got), len(data))
+	}
+
+	// 目录上传保留相对路径
+	dir := filepath.Join(local, "site")
+	os.MkdirAll(filepath.Join(dir, "css"), 0755)
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>"), 0644)
+	os.WriteFile(filepath.Join(dir, "css", "app.css"), []byte("body{}"), 0644)
+	if err := scp.UploadContext(context.Background(), dir, filepath.Join(remote, "site"), nil); err != nil {
+		t.Fatalf("upload dir: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(remote, "site", "css", "app.css")); string(got) != "body{}" {
+		t.Errorf("uploaded css = %q", got)
+	}
+
+	downloaded := filepath.Join(local, "back.bin")
+	if err := scp.DownloadContext(context.Background(), filepath.Join(remote, "app.bin"), downloaded, nil); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if got, _ := os.ReadFile(downloaded); !bytes.Equal(got, data) {
+		t.Errorf("downloaded file differs (%d of %d bytes)", len(got), len(data))
+	}
+
+	// 自适应上传通过 keepalive 测量 RTT
+	tuning, err := scp.UploadAdaptive(context.Background(), file, filepath.Join(remote, "adaptive", "app.bin"), nil, nil)
+	if err != nil {
+		t.Fatalf("adaptive upload: %v", err)
+	}
+	if tuning.Reused || tuning.Streams < 1 {
+		t.Errorf("tuning = %+v", tuning)
+	}
+	if got, _ := os.ReadFile(filepath.Join(remote, "adaptive", "app.bin")); !bytes.Equal(got, data) {
+		t.Error("adaptive upload differs")
+	}
+}
+
+func TestTransferQuotesRemotePaths(t *testing.T) {
+	scp := connectTestChain(t)
+	local := t.TempDir()
+	remote := t.TempDir()
+
+	file := filepath.Join(local, "app.bin")
+	if err := os.WriteFile(file, []byte("payload"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 路径中的空格和 shell 元字符按原样作为文件名，不被远端 shell 解释
+	target := filepath.Join(remote, "my dir;touch pwned", "a $(b).bin")
+	if err := scp.UploadContext(context.Background(), file, target, nil); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "payload" {
+		t.Errorf("uploaded file = %q", got)
+	}
+	if _, err := os.Stat("pwned"); err == nil {
+		os.Remove("pwned")
+		t.Error("remote path was run as a command")
+	}
+
+	downloaded := filepath.Join(local, "back.bin")
+	if err := scp.DownloadContext(context.Background(), target, downloaded, nil); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if got, _ := os.ReadFile(downloaded); string(got) != "payload" {
+		t.Errorf("downloaded file = %q", got)
+	}
+}
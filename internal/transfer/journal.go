@@ -0,0 +1,134 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// journalSaveInterval 上传过程中写入日志的最小间隔；文件完成时立即写入
+const journalSaveInterval = time.Second
+
+// JournalEntry 一个本地文件的上传进度；本地文件的大小或修改时间变化后作废
+type JournalEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Offset  int64     `json:"offset"` // 已写入远端的字节数（上限，续传时以远端文件实际大小为准）
+	Done    bool      `json:"done,omitempty"`
+}
+
+// Journal 上传任务日志：记录每个本地文件已发送的字节数和是否完成。
+// 同一任务中断后重新运行时，已完成的文件被跳过，未完成的文件从断点续传。nil Journal 不记录任何内容
+type Journal struct {
+	path  string
+	mu    sync.Mutex
+	saved time.Time
+	state journalState
+}
+
+type journalState struct {
+	Task  string                   `json:"task"`
+	Files map[string]*JournalEntry `json:"files"` // 本地文件绝对路径 -> 进度
+}
+
+// JournalPath 任务日志的路径：dir 下以任务参数的哈希命名，相同参数的任务使用同一个日志
+func JournalPath(dir string, args ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// OpenJournal 打开任务日志，不存在或内容损坏时从空日志开始；task 为便于识别的任务描述
+func OpenJournal(path, task string) (*Journal, error) {
+	j := &Journal{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err != nil || json.Unmarshal(data, &j.state) != nil {
+		j.state = journalState{}
+	}
+	j.state.Task = task
+	if j.state.Files == nil {
+		j.state.Files = make(map[string]*JournalEntry)
+	}
+	return j, nil
+}
+
+// Resuming 日志中是否记录了之前运行的进度
+func (j *Journal) Resuming() bool {
+	if j == nil {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.state.Files) > 0
+}
+
+// Lookup 返回 localFile 之前的进度；文件已变化或没有记录时返回零值
+func (j *Journal) Lookup(localFile string, info os.FileInfo) JournalEntry {
+	if j == nil {
+		return JournalEntry{}
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry := j.state.Files[journalKey(localFile)]
+	if entry == nil || entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) {
+		return JournalEntry{}
+	}
+	return *entry
+}
+
+// Record 记录 localFile 已发送 offset 字节，done 表示已完整上传
+func (j *Journal) Record(localFile string, info os.FileInfo, offset int64, done bool) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.state.Files[journalKey(localFile)] = &JournalEntry{Size: info.Size(), ModTime: info.ModTime(), Offset: offset, Done: done}
+	if !done && time.Since(j.saved) < journalSaveInterval {
+		return nil
+	}
+	j.saved = time.Now()
+	return j.save()
+}
+
+// Remove 任务完成后删除日志
+func (j *Journal) Remove() error {
+	if j == nil {
+		return nil
+	}
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// save 先写临时文件再改名，进程中途退出也不会留下半个日志
+func (j *Journal) save() error {
+	data, err := json.MarshalIndent(j.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+func journalKey(localFile string) string {
+	if abs, err := filepath.Abs(localFile); err == nil {
+		return abs
+	}
+	return localFile
+}
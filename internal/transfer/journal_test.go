@@ -0,0 +1,75 @@
+package transfer
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, "app.bin")
+	os.WriteFile(local, make([]byte, 1000), 0644)
+	info, _ := os.Stat(local)
+
+	path := JournalPath(filepath.Join(dir, "tasks"), "upload", local, "web:/srv/")
+	if path != JournalPath(filepath.Join(dir, "tasks"), "upload", local, "web:/srv/") || path == JournalPath(filepath.Join(dir, "tasks"), "upload", local, "db:/srv/") {
+		t.Fatalf("journal path should depend only on the task arguments")
+	}
+	j, err := OpenJournal(path, "upload")
+	if err != nil || j.Resuming() {
+		t.Fatalf("new journal: %v, resuming %v", err, j.Resuming())
+	}
+	j.Record(local, info, 400, false)
+	j.saved = time.Time{} // 不等保存间隔
+	j.Record(local, info, 600, false)
+
+	// 重新运行：读取到之前的进度
+	j, _ = OpenJournal(path, "upload")
+	if entry := j.Lookup(local, info); !j.Resuming() || entry.Offset != 600 || entry.Done {
+		t.Errorf("entry = %+v", entry)
+	}
+
+	// 本地文件改动后进度作废
+	later := info.ModTime().Add(time.Second)
+	os.Chtimes(local, later, later)
+	changed, _ := os.Stat(local)
+	if entry := j.Lookup(local, changed); entry.Offset != 0 {
+		t.Errorf("changed file entry = %+v", entry)
+	}
+
+	j.Record(local, changed, 1000, true)
+	if err := j.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("journal not removed: %v", err)
+	}
+
+	var none *Journal
+	if none.Resuming() || none.Lookup(local, info).Offset != 0 || none.Record(local, info, 1, true) != nil || none.Remove() != nil {
+		t.Error("nil journal should be a no-op")
+	}
+}
+
+func TestResumeOffset(t *testing.T) {
+	scp := &SCPTransfer{run: localShell, logger: log.New(io.Discard, "", 0)}
+	remote := filepath.Join(t.TempDir(), "app.bin")
+	os.WriteFile(remote, make([]byte, 300), 0644)
+
+	ctx := context.Background()
+	// 日志记录的偏移大于远端实际写入的长度时，以远端为准
+	if got := scp.resumeOffset(ctx, remote, 500); got != 300 {
+		t.Errorf("offset = %d, want 300", got)
+	}
+	if got := scp.resumeOffset(ctx, remote, 200); got != 200 {
+		t.Errorf("offset = %d, want 200", got)
+	}
+	if got := scp.resumeOffset(ctx, remote+".missing", 200); got != 0 {
+		t.Errorf("missing remote offset = %d, want 0", got)
+	}
+}
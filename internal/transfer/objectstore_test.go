@@ -0,0 +1,134 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestParseObjectTarget(t *testing.T) {
+	tests := []struct {
+		in, scheme, url, server, tool string
+		wantErr                       bool
+	}{
+		{in: "s3://backups/db/dump.sql@gw-1", scheme: "s3", url: "s3://backups/db/dump.sql", server: "gw-1", tool: "aws"},
+		{in: "oss://logs/2026/@web-1", scheme: "oss", url: "oss://logs/2026/", server: "web-1", tool: "ossutil"},
+		{in: "https://b.s3.amazonaws.com/k?X-Amz-Signature=ab@cd@gw-1", scheme: "https", url: "https://b.s3.amazonaws.com/k?X-Amz-Signature=ab@cd", server: "gw-1", tool: "curl"},
+		{in: "s3://bucket/key", wantErr: true},
+		{in: "s3://bucket/key@", wantErr: true},
+		{in: "s3:///key@gw-1", wantErr: true},
+		{in: "https://example.com/@gw-1", wantErr: true},
+		{in: "ftp://example.com/file@gw-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseObjectTarget(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseObjectTarget(%q) = %+v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseObjectTarget(%q): %v", tt.in, err)
+			continue
+		}
+		if got.Scheme != tt.scheme || got.URL != tt.url || got.Server != tt.server || got.Tool() != tt.tool {
+			t.Errorf("ParseObjectTarget(%q) = %+v (tool %s)", tt.in, got, got.Tool())
+		}
+	}
+
+	target := ObjectTarget{Scheme: "https", URL: "https://b.example.com/k?sig=secret"}
+	if got := target.Redacted(); got != "https://b.example.com/k" {
+		t.Errorf("Redacted() = %q", got)
+	}
+	if got := (ObjectTarget{Scheme: "s3", URL: "s3://b/dir/"}).objectURL("a b.tar"); got != "s3://b/dir/a b.tar" {
+		t.Errorf("objectURL = %q", got)
+	}
+	if got := (ObjectTarget{Scheme: "oss", URL: "oss://b"}).objectURL("x"); got != "oss://b/x" {
+		t.Errorf("objectURL = %q", got)
+	}
+}
+
+func TestUploadObject(t *testing.T) {
+	for _, tool := range []string{"sh", "cat", "mktemp", "cp"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+
+	// 假的 aws/ossutil/curl：把收到的数据和对象地址写到 $OUT
+	bin := t.TempDir()
+	scripts := map[string]string{
+		"aws":     "#!/bin/sh\ncat > \"$OUT\"\necho \"$4\" > \"$OUT.url\"\n",
+		"ossutil": "#!/bin/sh\ncp \"$3\" \"$OUT\"\necho \"$4\" > \"$OUT.url\"\n",
+		"curl":    "#!/bin/sh\ncp \"$5\" \"$OUT\"\necho \"$6\" > \"$OUT.url\"\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	data := bytes.Repeat([]byte("object data\n"), 10000)
+	local := filepath.Join(t.TempDir(), "it's.bin")
+	if err := os.WriteFile(local, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct{ target, url string }{
+		{"s3://bucket/dir/", "s3://bucket/dir/it's.bin"},
+		{"oss://bucket/a.bin", "oss://bucket/a.bin"},
+		{"https://host/key?sig=a&b=c", "https://host/key?sig=a&b=c"},
+	}
+	for _, tt := range tests {
+		out := filepath.Join(t.TempDir(), "received")
+		t.Setenv("OUT", out)
+		target, err := ParseObjectURL(tt.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		scp := &SCPTransfer{logger: log.New(io.Discard, "", 0), run: localShell}
+		progress := make(chan *types.TransferProgress, 1000)
+		if err := scp.UploadObject(context.Background(), local, target, progress); err != nil {
+			t.Fatalf("UploadObject(%s): %v", tt.target, err)
+		}
+		close(progress)
+
+		var last *types.TransferProgress
+		for p := range progress {
+			if p.Status == "running" && p.SentBytes >= int64(len(data)) {
+				t.Errorf("%s: running progress reached %d of %d bytes", tt.target, p.SentBytes, len(data))
+			}
+			last = p
+		}
+		if last == nil || last.Status != "completed" || last.SentBytes != int64(len(data)) {
+			t.Errorf("%s: last progress = %+v", tt.target, last)
+		}
+		if got, err := os.ReadFile(out); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: uploaded %d bytes, err %v", tt.target, len(got), err)
+		}
+		if got, _ := os.ReadFile(out + ".url"); string(bytes.TrimSpace(got)) != tt.url {
+			t.Errorf("%s: object URL = %q, want %q", tt.target, got, tt.url)
+		}
+	}
+
+	// 工具不存在时给出明确的错误
+	t.Setenv("PATH", t.TempDir())
+	scp := &SCPTransfer{logger: log.New(io.Discard, "", 0), run: func(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer) error {
+		c := exec.CommandContext(ctx, "/bin/sh", "-c", cmd)
+		c.Stdin, c.Stdout = stdin, stdout
+		return c.Run()
+	}}
+	if err := scp.UploadObject(context.Background(), local, ObjectTarget{Scheme: "s3", URL: "s3://b/k"}, nil); err == nil {
+		t.Error("expected an error when aws is missing")
+	}
+}
@@ -0,0 +1,482 @@
+package transfer
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+const (
+	// DefaultDownloadStreams 并行下载默认的 tar 流数
+	DefaultDownloadStreams = 4
+	// MaxDownloadStreams 并行下载的 tar 流数上限，过多的会话会被 sshd 的 MaxSessions 拒绝
+	MaxDownloadStreams = 16
+
+	// progressInterval 并行下载汇总进度的报告间隔
+	progressInterval = 200 * time.Millisecond
+)
+
+// ManifestEntry 清单中的一个文件
+type ManifestEntry struct {
+	Path   string `json:"path"` // 相对下载目录的路径，以 / 分隔
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest 并行下载的完整性清单：远端列出的文件及本地写入内容的 sha256
+type Manifest struct {
+	Remote   string          `json:"remote"`
+	Streams  int             `json:"streams"`
+	Bytes    int64           `json:"bytes"`
+	Verified bool            `json:"verified"`          // 已与远端计算的 sha256 比对一致
+	Changed  []string        `json:"changed,omitempty"` // 下载期间大小发生变化的文件（如正在写入的日志），内容为读取时的快照
+	Files    []ManifestEntry `json:"files"`
+}
+
+// WriteFile 以 JSON 写入清单
+func (m *Manifest) WriteFile(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ParallelOptions 并行下载选项
+type ParallelOptions struct {
+	Streams int  // 并行的 tar 流数，<= 0 时为 DefaultDownloadStreams
+	Verify  bool // 下载后在远端计算 sha256 并与本地比对，远端需要多读一遍文件
+}
+
+// remoteRunner 在目标主机执行 cmd，stdin 和 stdout 可以为 nil
+type remoteRunner func(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer) error
+
+// DownloadDirParallel 把远程目录按文件列表分成若干份，每份在链上单独的会话中打包为一个 tar 流，
+// 并行拉取后解包到 localDir。高 RTT 链路上单个流受窗口大小限制，多个流能成倍提高吞吐。
+// 所有文件写入后按远端列出的清单核对：缺少文件时失败，大小变化的文件记入 Manifest.Changed；
+// opts.Verify 时再比对其余文件的 sha256
+func (t *SCPTransfer) DownloadDirParallel(ctx context.Context, remoteDir, localDir string, opts ParallelOptions, progress chan<- *types.TransferProgress) (*Manifest, error) {
+	if t.run == nil && !t.chain.IsConnected() {
+		return nil, fmt.Errorf("SSH chain not connected")
+	}
+	streams := opts.Streams
+	if streams <= 0 {
+		streams = DefaultDownloadStreams
+	}
+	if streams > MaxDownloadStreams {
+		streams = MaxDownloadStreams
+	}
+
+	files, err := t.listRemoteFiles(ctx, remoteDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote directory: %w", err)
+	}
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create local directory: %w", err)
+	}
+
+	manifest := &Manifest{Remote: remoteDir, Files: files}
+	for _, f := range files {
+		manifest.Bytes += f.Size
+	}
+	parts := partitionFiles(files, streams)
+	manifest.Streams = len(parts)
+	t.logger.Printf("[SCP] Parallel download: %d files, %d bytes in %d stream(s)", len(files), manifest.Bytes, len(parts))
+
+	// 汇总各个流写入的字节数，定期报告整体进度
+	var received atomic.Int64
+	name := path.Base(remoteDir)
+	stopProgress := make(chan struct{})
+	var progressDone sync.WaitGroup
+	if progress != nil {
+		progressDone.Add(1)
+		go func() {
+			defer progressDone.Done()
+			rate := NewRateEstimator(t.speedWindow, time.Now())
+			ticker := time.NewTicker(progressInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopProgress:
+					return
+				case <-ticker.C:
+					done := received.Load()
+					progress <- runningProgress(name, manifest.Bytes, done, rate.Update(done, time.Now()))
+				}
+			}
+		}()
+	}
+
+	// 任一流失败时取消其余的流
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	hashes := make(map[string]ManifestEntry, len(files))
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	for i, part := range parts {
+		wg.Add(1)
+		go func(i int, part []ManifestEntry) {
+			defer wg.Done()
+			got, err := t.downloadStream(streamCtx, remoteDir, localDir, part, &received)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, entry := range got {
+				hashes[entry.Path] = entry
+			}
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("stream %d: %w", i+1, err)
+				cancel()
+			}
+		}(i, part)
+	}
+	wg.Wait()
+	close(stopProgress)
+	progressDone.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	// 核对清单：每个文件都已写入；大小变化的文件保留读取到的内容并记录下来
+	var missing []string
+	for i, f := range manifest.Files {
+		got, ok := hashes[f.Path]
+		switch {
+		case !ok:
+			missing = append(missing, f.Path)
+			continue
+		case got.Size != f.Size:
+			manifest.Changed = append(manifest.Changed, f.Path)
+			manifest.Bytes += got.Size - f.Size
+		}
+		manifest.Files[i] = got
+	}
+	if len(missing) > 0 {
+		return manifest, fmt.Errorf("%d file(s) missing from the download (first: %s)", len(missing), missing[0])
+	}
+	if len(manifest.Changed) > 0 {
+		t.logger.Printf("[SCP] WARNING: %d file(s) changed size during download (first: %s)", len(manifest.Changed), manifest.Changed[0])
+	}
+
+	if opts.Verify {
+		if err := t.verifyRemoteHashes(ctx, remoteDir, parts, hashes, manifest.Changed); err != nil {
+			return manifest, err
+		}
+		manifest.Verified = true
+	}
+
+	if progress != nil {
+		progress <- &types.TransferProgress{
+			FileName:   name,
+			TotalBytes: manifest.Bytes,
+			SentBytes:  manifest.Bytes,
+			Status:     "completed",
+		}
+	}
+	return manifest, nil
+}
+
+// listRemoteFiles 列出远程目录下的所有普通文件及大小，GNU find 不可用时（BSD/macOS）改用 stat -f
+func (t *SCPTransfer) listRemoteFiles(ctx context.Context, remoteDir string) ([]ManifestEntry, error) {
+	cmd := fmt.Sprintf("cd %s && if find . -maxdepth 0 -printf '' 2>/dev/null; then find . -type f -printf '%%s %%p\\n'; else find . -type f -exec stat -f '%%z %%N' {} +; fi",
+		terminal.ShellQuote(remoteDir))
+	var out bytes.Buffer
+	if err := t.runRemote(ctx, cmd, nil, &out); err != nil {
+		return nil, err
+	}
+	return parseFileList(&out)
+}
+
+// parseFileList 解析 "<大小> ./<路径>" 格式的文件列表，按路径排序
+func parseFileList(r io.Reader) ([]ManifestEntry, error) {
+	var files []ManifestEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		sizeStr, name, ok := strings.Cut(line, " ")
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if !ok || err != nil || !strings.HasPrefix(name, "./") {
+			return nil, fmt.Errorf("unexpected file list line: %q", line)
+		}
+		files = append(files, ManifestEntry{Path: strings.TrimPrefix(name, "./"), Size: size})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// partitionFiles 把文件分成至多 n 份（不超过文件数），使每份的总大小尽量接近
+// （从大到小放入当前最小的一份），每份内部按路径排序
+func partitionFiles(files []ManifestEntry, n int) [][]ManifestEntry {
+	if n > len(files) {
+		n = len(files)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	sorted := append([]ManifestEntry(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Size > sorted[j].Size })
+
+	parts := make([][]ManifestEntry, n)
+	sizes := make([]int64, n)
+	for _, f := range sorted {
+		smallest := 0
+		for i := 1; i < n; i++ {
+			if sizes[i] < sizes[smallest] {
+				smallest = i
+			}
+		}
+		parts[smallest] = append(parts[smallest], f)
+		sizes[smallest] += f.Size
+	}
+	for _, part := range parts {
+		sort.Slice(part, func(i, j int) bool { return part[i].Path < part[j].Path })
+	}
+	return parts
+}
+
+// fileListInput 传给远端 tar -T - 的文件列表，每行一个以 ./ 开头的路径
+func fileListInput(part []ManifestEntry) io.Reader {
+	var buf bytes.Buffer
+	for _, f := range part {
+		buf.WriteString("./" + f.Path + "\n")
+	}
+	return &buf
+}
+
+// downloadStream 在远端把 part 打包成一个 tar 流并解包到 localDir，返回已写入文件的大小和 sha256
+func (t *SCPTransfer) downloadStream(ctx context.Context, remoteDir, localDir string, part []ManifestEntry, received *atomic.Int64) ([]ManifestEntry, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	runErr := make(chan error, 1)
+	go func() {
+		err := t.runRemote(ctx, "cd "+terminal.ShellQuote(remoteDir)+" && tar -cf - -T -", fileListInput(part), pw)
+		pw.CloseWithError(err)
+		runErr <- err
+	}()
+
+	got, err := extractTar(pr, localDir, received)
+	if err != nil {
+		// 停止远端 tar，避免它在写满窗口后一直阻塞
+		cancel()
+		pr.CloseWithError(err)
+		<-runErr
+		return got, err
+	}
+	// 读完 tar 结束标记后远端可能还有填充块
+	io.Copy(io.Discard, pr)
+	err = <-runErr
+	// 退出码 1 是警告（GNU tar：文件在读取时发生变化），归档本身完整，由清单核对结果
+	if exitStatus(err) == 1 {
+		t.logger.Printf("[SCP] WARNING: remote tar reported a warning: %v", err)
+		return got, nil
+	}
+	if err != nil {
+		return got, fmt.Errorf("remote tar failed: %w", err)
+	}
+	return got, nil
+}
+
+// exitStatus 返回远端命令的退出码，err 不是退出码错误时返回 -1
+func exitStatus(err error) int {
+	var sshExit interface{ ExitStatus() int }
+	var procExit interface{ ExitCode() int }
+	switch {
+	case errors.As(err, &sshExit):
+		return sshExit.ExitStatus()
+	case errors.As(err, &procExit):
+		return procExit.ExitCode()
+	}
+	return -1
+}
+
+// extractTar 把 tar 流中的普通文件写入 localDir，计算 sha256 并累加写入的字节数
+func extractTar(r io.Reader, localDir string, received *atomic.Int64) ([]ManifestEntry, error) {
+	var got []ManifestEntry
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return got, nil
+		}
+		if err != nil {
+			return got, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(path.Clean(hdr.Name), "./")
+		target, err := SafeJoin(localDir, name)
+		if err != nil {
+			return got, err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return got, fmt.Errorf("failed to create dir for %s: %w", name, err)
+		}
+
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode)&0777|0600)
+		if err != nil {
+			return got, fmt.Errorf("failed to create file %s: %w", name, err)
+		}
+		hash := sha256.New()
+		n, err := io.Copy(io.MultiWriter(f, hash, counter{received}), tr)
+		closeErr := f.Close()
+		if err != nil {
+			return got, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		if closeErr != nil {
+			return got, fmt.Errorf("failed to write %s: %w", name, closeErr)
+		}
+		os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		got = append(got, ManifestEntry{Path: name, Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))})
+	}
+}
+
+// counter 累加写入的字节数
+type counter struct{ n *atomic.Int64 }
+
+func (c counter) Write(p []byte) (int, error) {
+	c.n.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// verifyRemoteHashes 在远端按份并行计算 sha256（sha256sum 不可用时用 shasum -a 256）并与本地结果比对
+// skip 中的文件（下载期间发生变化）不比对
+func (t *SCPTransfer) verifyRemoteHashes(ctx context.Context, remoteDir string, parts [][]ManifestEntry, local map[string]ManifestEntry, skip []string) error {
+	cmd := "cd " + terminal.ShellQuote(remoteDir) +
+		" && if command -v sha256sum >/dev/null 2>&1; then h=sha256sum; else h='shasum -a 256'; fi; tr '\\n' '\\0' | xargs -0 $h"
+
+	skipped := make(map[string]bool, len(skip))
+	for _, name := range skip {
+		skipped[name] = true
+	}
+	var (
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		mismatched []string
+		firstErr   error
+	)
+	for _, part := range parts {
+		wg.Add(1)
+		go func(part []ManifestEntry) {
+			defer wg.Done()
+			var out bytes.Buffer
+			err := t.runRemote(ctx, cmd, fileListInput(part), &out)
+			remote, parseErr := parseHashes(&out)
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				err = parseErr
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to compute remote checksums: %w", err)
+				}
+				return
+			}
+			for _, f := range part {
+				if !skipped[f.Path] && remote[f.Path] != local[f.Path].SHA256 {
+					mismatched = append(mismatched, f.Path)
+				}
+			}
+		}(part)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	if len(mismatched) > 0 {
+		sort.Strings(mismatched)
+		return fmt.Errorf("checksum mismatch for %d file(s) (first: %s)", len(mismatched), mismatched[0])
+	}
+	return nil
+}
+
+// parseHashes 解析 sha256sum 的输出，键为去掉 ./ 的路径
+func parseHashes(r io.Reader) (map[string]string, error) {
+	hashes := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok {
+			return nil, fmt.Errorf("unexpected checksum line: %q", scanner.Text())
+		}
+		hashes[strings.TrimPrefix(name, "./")] = sum
+	}
+	return hashes, scanner.Err()
+}
+
+// runRemote 在链的最后一跳执行 cmd，ctx 取消时关闭会话
+func (t *SCPTransfer) runRemote(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer) error {
+	if t.run != nil {
+		return t.run(ctx, cmd, stdin, stdout)
+	}
+	session, err := t.chain.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = &stderr
+
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	defer stop()
+	if err := session.Run(cmd); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoteIsDir 判断远程路径是否为目录
+func (t *SCPTransfer) RemoteIsDir(ctx context.Context, remotePath string) (bool, error) {
+	var out bytes.Buffer
+	p := terminal.ShellQuote(remotePath)
+	if err := t.runRemote(ctx, "if [ -d "+p+" ]; then echo dir; elif [ -e "+p+" ]; then echo file; fi", nil, &out); err != nil {
+		return false, err
+	}
+	switch strings.TrimSpace(out.String()) {
+	case "dir":
+		return true, nil
+	case "file":
+		return false, nil
+	}
+	return false, fmt.Errorf("remote path %s does not exist", remotePath)
+}
@@ -0,0 +1,119 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartitionFiles(t *testing.T) {
+	files := []ManifestEntry{
+		{Path: "a", Size: 50}, {Path: "b", Size: 40}, {Path: "c", Size: 30},
+		{Path: "d", Size: 20}, {Path: "e", Size: 10}, {Path: "f", Size: 0},
+	}
+
+	tests := []struct {
+		name  string
+		files []ManifestEntry
+		n     int
+		sizes []int64
+	}{
+		{"balanced", files, 2, []int64{80, 70}},
+		{"more streams than files", files[:2], 4, []int64{50, 40}},
+		{"single stream", files, 1, []int64{150}},
+		{"no files", nil, 4, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := partitionFiles(tt.files, tt.n)
+			if len(parts) != len(tt.sizes) {
+				t.Fatalf("got %d parts, want %d", len(parts), len(tt.sizes))
+			}
+			count := 0
+			for i, part := range parts {
+				var size int64
+				for j, f := range part {
+					size += f.Size
+					if j > 0 && part[j-1].Path > f.Path {
+						t.Errorf("part %d not sorted by path", i)
+					}
+				}
+				count += len(part)
+				if size != tt.sizes[i] {
+					t.Errorf("part %d size = %d, want %d", i, size, tt.sizes[i])
+				}
+			}
+			if count != len(tt.files) {
+				t.Errorf("partitioned %d files, want %d", count, len(tt.files))
+			}
+		})
+	}
+}
+
+// localShell 在本机 shell 中执行“远端”命令
+func localShell(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer) error {
+	c := exec.CommandContext(ctx, "sh", "-c", cmd)
+	c.Stdin, c.Stdout = stdin, stdout
+	return c.Run()
+}
+
+func TestDownloadDirParallel(t *testing.T) {
+	for _, tool := range []string{"sh", "find", "tar", "xargs"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+
+	remote := t.TempDir()
+	contents := map[string][]byte{
+		"app.log":            bytes.Repeat([]byte("line\n"), 20000),
+		"old/app.log.1":      bytes.Repeat([]byte("older\n"), 5000),
+		"old/with space.log": []byte("spaces"),
+		"empty.log":          nil,
+	}
+	for name, data := range contents {
+		path := filepath.Join(remote, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scp := &SCPTransfer{logger: log.New(io.Discard, "", 0), run: localShell}
+	if isDir, err := scp.RemoteIsDir(context.Background(), remote); err != nil || !isDir {
+		t.Fatalf("RemoteIsDir = %v, %v", isDir, err)
+	}
+
+	local := filepath.Join(t.TempDir(), "logs")
+	manifest, err := scp.DownloadDirParallel(context.Background(), remote, local, ParallelOptions{Streams: 3, Verify: true}, nil)
+	if err != nil {
+		t.Fatalf("DownloadDirParallel: %v", err)
+	}
+	if manifest.Streams != 3 || len(manifest.Files) != len(contents) || !manifest.Verified || len(manifest.Changed) != 0 {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	for name, want := range contents {
+		got, err := os.ReadFile(filepath.Join(local, name))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s: got %d bytes, want %d (err %v)", name, len(got), len(want), err)
+		}
+	}
+
+	// 列出后被删除的文件导致下载失败
+	scp.run = func(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer) error {
+		if bytes.Contains([]byte(cmd), []byte("tar -cf")) {
+			os.Remove(filepath.Join(remote, "empty.log"))
+		}
+		return localShell(ctx, cmd, stdin, stdout)
+	}
+	if _, err := scp.DownloadDirParallel(context.Background(), remote, t.TempDir(), ParallelOptions{Streams: 1}, nil); err == nil {
+		t.Error("expected an error for a file removed during download")
+	}
+}
@@ -0,0 +1,78 @@
+package transfer
+
+import (
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// ProgressPublisher 合并进度消息的发布者，CLI 和 Web 上传共用。
+// 传输一侧向 Chan() 发送进度，不会因为消费者变慢而阻塞；消费者来不及取走的消息合并为最新的一条
+// （Files 按名称合并，不会丢失文件的状态变化），所以积压的内存与消息数量无关。
+// 所有者发送完毕后调用 Close，Updates() 交付最后一条后关闭，消费者的 range 随之结束
+type ProgressPublisher struct {
+	in  chan *types.TransferProgress
+	out chan *types.TransferProgress
+}
+
+// NewProgressPublisher 创建发布者并启动合并 goroutine，Close 且 Updates() 读完后它才退出
+func NewProgressPublisher() *ProgressPublisher {
+	p := &ProgressPublisher{
+		in:  make(chan *types.TransferProgress),
+		out: make(chan *types.TransferProgress),
+	}
+	go p.run()
+	return p
+}
+
+// Chan 传给传输函数的进度通道，Close 之后不能再发送
+func (p *ProgressPublisher) Chan() chan<- *types.TransferProgress {
+	return p.in
+}
+
+// Updates 合并后的进度，Close 且最后一条被取走后关闭
+func (p *ProgressPublisher) Updates() <-chan *types.TransferProgress {
+	return p.out
+}
+
+// Close 发送方已结束。只能调用一次，须在传输函数返回后调用
+func (p *ProgressPublisher) Close() {
+	close(p.in)
+}
+
+func (p *ProgressPublisher) run() {
+	defer close(p.out)
+	in := p.in
+	var pending *types.TransferProgress
+	owned := false // pending 是合并时新建的，可以原地修改
+	for in != nil || pending != nil {
+		// 没有待交付的消息时不向 out 发送
+		var out chan<- *types.TransferProgress
+		if pending != nil {
+			out = p.out
+		}
+		select {
+		case update, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			pending, owned = coalesceProgress(pending, owned, update)
+		case out <- pending:
+			pending, owned = nil, false
+		}
+	}
+}
+
+// coalesceProgress 把 next 合并到尚未交付的 pending 上：整体字段取 next，Files 按名称合并。
+// 发送方的 Files 可能仍被它持有，不属于发布者（owned 为 false）时先复制再修改
+func coalesceProgress(pending *types.TransferProgress, owned bool, next *types.TransferProgress) (*types.TransferProgress, bool) {
+	if pending == nil || len(pending.Files) == 0 {
+		return next, false
+	}
+	merged := *next
+	merged.Files = pending.Files
+	if !owned {
+		merged.Files = append([]types.FileProgress(nil), pending.Files...)
+	}
+	merged.MergeFiles(next.Files)
+	return &merged, true
+}
@@ -0,0 +1,135 @@
+package transfer
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// drain 读完 Updates()，超时则失败
+func drain(t *testing.T, pub *ProgressPublisher) []*types.TransferProgress {
+	t.Helper()
+	var updates []*types.TransferProgress
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case p, ok := <-pub.Updates():
+			if !ok {
+				return updates
+			}
+			updates = append(updates, p)
+		case <-timeout:
+			t.Fatal("Updates() was not closed")
+		}
+	}
+}
+
+func TestProgressPublisherCoalescesWithoutBlocking(t *testing.T) {
+	pub := NewProgressPublisher()
+
+	// 没有消费者时发送方也不阻塞
+	files := []types.FileProgress{{Name: "a", Status: "pending"}, {Name: "b", Status: "pending"}}
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		pub.Chan() <- &types.TransferProgress{Status: "running", Files: files}
+		for i := int64(1); i <= 10000; i++ {
+			p := &types.TransferProgress{Status: "running", SentBytes: i}
+			if i == 5000 {
+				p.Files = []types.FileProgress{{Name: "a", Status: "completed"}}
+			}
+			pub.Chan() <- p
+		}
+		pub.Chan() <- &types.TransferProgress{Status: "completed", SentBytes: 10000,
+			Files: []types.FileProgress{{Name: "b", Status: "failed"}, {Name: "c", Status: "completed"}}}
+	}()
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sender blocked on a consumer that is not reading")
+	}
+	pub.Close()
+
+	updates := drain(t, pub)
+	if len(updates) != 1 {
+		t.Fatalf("got %d updates, want them coalesced into 1", len(updates))
+	}
+	last := updates[0]
+	if last.Status != "completed" || last.SentBytes != 10000 {
+		t.Errorf("last = %+v", last)
+	}
+	want := map[string]string{"a": "completed", "b": "failed", "c": "completed"}
+	if len(last.Files) != len(want) {
+		t.Fatalf("files = %+v", last.Files)
+	}
+	for _, f := range last.Files {
+		if want[f.Name] != f.Status {
+			t.Errorf("file %s = %s, want %s", f.Name, f.Status, want[f.Name])
+		}
+	}
+	// 发送方持有的清单不被修改
+	if files[0].Status != "pending" || len(files) != 2 {
+		t.Errorf("sender's files modified: %+v", files)
+	}
+}
+
+func TestProgressPublisherDeliversInOrder(t *testing.T) {
+	pub := NewProgressPublisher()
+	received := make(chan []*types.TransferProgress)
+	go func() {
+		var updates []*types.TransferProgress
+		for p := range pub.Updates() {
+			updates = append(updates, p)
+		}
+		received <- updates
+	}()
+	for i := int64(1); i <= 100; i++ {
+		pub.Chan() <- &types.TransferProgress{SentBytes: i}
+	}
+	pub.Close()
+
+	updates := <-received
+	for i := 1; i < len(updates); i++ {
+		if updates[i].SentBytes <= updates[i-1].SentBytes {
+			t.Fatalf("update %d went backwards: %d after %d", i, updates[i].SentBytes, updates[i-1].SentBytes)
+		}
+	}
+	if len(updates) == 0 || updates[len(updates)-1].SentBytes != 100 {
+		t.Errorf("last update missing: %d updates", len(updates))
+	}
+}
+
+func TestProgressPublisherEarlyFailure(t *testing.T) {
+	base := runtime.NumGoroutine()
+
+	// 传输在发出任何进度前失败，消费者仍随 Close 结束
+	pub := NewProgressPublisher()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range pub.Updates() {
+		}
+	}()
+	scp := NewSCPTransfer(ssh.NewChain(nil))
+	if err := scp.UploadContext(context.Background(), "/nonexistent", "/tmp/x", pub.Chan()); err == nil {
+		t.Fatal("upload over a disconnected chain succeeded")
+	}
+	pub.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("consumer still running after Close")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines leaked: have %d, want <= %d", runtime.NumGoroutine(), base)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
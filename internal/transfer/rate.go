@@ -0,0 +1,90 @@
+package transfer
+
+import (
+	"math"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// DefaultSpeedWindow 速度平滑的默认时间窗口
+const DefaultSpeedWindow = 5 * time.Second
+
+// rateSampleInterval 两次速度采样的最小间隔，避免每个 32KB 缓冲区都产生一次噪声样本
+const rateSampleInterval = 250 * time.Millisecond
+
+// RateEstimator 传输速度估计：瞬时速度、指数加权移动平均（EWMA）和全程平均速度
+// EWMA 按时间衰减：距今超过一个窗口的样本权重约降为 1/e，因此 ETA 不会随单个慢/快样本剧烈跳动
+type RateEstimator struct {
+	window     time.Duration
+	start      time.Time
+	lastSample time.Time
+	lastBytes  int64
+	instant    float64
+	smoothed   float64
+	primed     bool
+}
+
+// Rate 某一时刻的速度估计（字节/秒）
+type Rate struct {
+	Instant  int64
+	Smoothed int64
+	Average  int64
+}
+
+// NewRateEstimator 创建速度估计器，window <= 0 时使用 DefaultSpeedWindow
+func NewRateEstimator(window time.Duration, start time.Time) *RateEstimator {
+	if window <= 0 {
+		window = DefaultSpeedWindow
+	}
+	return &RateEstimator{window: window, start: start, lastSample: start}
+}
+
+// Update 记录截至 now 已传输的总字节数，返回当前估计
+func (r *RateEstimator) Update(total int64, now time.Time) Rate {
+	if dt := now.Sub(r.lastSample); dt >= rateSampleInterval {
+		r.instant = float64(total-r.lastBytes) / dt.Seconds()
+		if !r.primed {
+			r.smoothed = r.instant
+			r.primed = true
+		} else {
+			alpha := 1 - math.Exp(-dt.Seconds()/r.window.Seconds())
+			r.smoothed += alpha * (r.instant - r.smoothed)
+		}
+		r.lastSample = now
+		r.lastBytes = total
+	}
+
+	rate := Rate{Instant: int64(r.instant), Smoothed: int64(r.smoothed)}
+	if elapsed := now.Sub(r.start).Seconds(); elapsed > 0 {
+		rate.Average = int64(float64(total) / elapsed)
+	}
+	// 第一个采样周期内还没有 EWMA，用全程平均代替
+	if !r.primed {
+		rate.Instant = rate.Average
+		rate.Smoothed = rate.Average
+	}
+	return rate
+}
+
+// ETA 按平滑速度估算剩余时间
+func (rate Rate) ETA(remaining int64) time.Duration {
+	if rate.Smoothed <= 0 || remaining <= 0 {
+		return 0
+	}
+	return time.Duration(float64(remaining) / float64(rate.Smoothed) * float64(time.Second))
+}
+
+// runningProgress 构造一条进行中的进度
+func runningProgress(filename string, size, done int64, rate Rate) *types.TransferProgress {
+	return &types.TransferProgress{
+		FileName:     filename,
+		TotalBytes:   size,
+		SentBytes:    done,
+		Speed:        rate.Smoothed,
+		InstantSpeed: rate.Instant,
+		AverageSpeed: rate.Average,
+		ETA:          rate.ETA(size - done),
+		Status:       "running",
+	}
+}
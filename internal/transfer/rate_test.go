@@ -0,0 +1,86 @@
+package transfer
+
+import (
+	"testing"
+	"time"
+)
+
+// feed 以固定速度 bytesPerSec 推进 duration，每 step 调用一次 Update
+func feed(r *RateEstimator, now time.Time, total int64, bytesPerSec int64, duration, step time.Duration) (time.Time, int64, Rate) {
+	var rate Rate
+	for elapsed := time.Duration(0); elapsed < duration; elapsed += step {
+		now = now.Add(step)
+		total += bytesPerSec * int64(step) / int64(time.Second)
+		rate = r.Update(total, now)
+	}
+	return now, total, rate
+}
+
+func TestRateEstimatorSmoothing(t *testing.T) {
+	start := time.Unix(0, 0)
+	const mb = 1 << 20
+
+	tests := []struct {
+		name   string
+		window time.Duration
+		// 先以 before 速度传 10s，再以 after 速度传 afterFor
+		before, after int64
+		afterFor      time.Duration
+		// 期望平滑速度所在区间
+		minSmoothed, maxSmoothed int64
+	}{
+		{"steady rate converges", 5 * time.Second, 10 * mb, 10 * mb, 5 * time.Second, 10*mb - mb/10, 10*mb + mb/10},
+		{"drop is absorbed gradually", 5 * time.Second, 10 * mb, 1 * mb, time.Second, 6 * mb, 9 * mb},
+		{"drop is followed after a few windows", 5 * time.Second, 10 * mb, 1 * mb, 25 * time.Second, 1 * mb, 2 * mb},
+		{"short window reacts faster", time.Second, 10 * mb, 1 * mb, 3 * time.Second, 1 * mb, 2 * mb},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRateEstimator(tt.window, start)
+			now, total, _ := feed(r, start, 0, tt.before, 10*time.Second, 100*time.Millisecond)
+			_, _, rate := feed(r, now, total, tt.after, tt.afterFor, 100*time.Millisecond)
+
+			if rate.Smoothed < tt.minSmoothed || rate.Smoothed > tt.maxSmoothed {
+				t.Errorf("smoothed = %.2f MB/s, want [%.2f, %.2f]", float64(rate.Smoothed)/mb,
+					float64(tt.minSmoothed)/mb, float64(tt.maxSmoothed)/mb)
+			}
+			if rate.Instant < tt.after*9/10 || rate.Instant > tt.after*11/10 {
+				t.Errorf("instant = %d, want about %d", rate.Instant, tt.after)
+			}
+		})
+	}
+}
+
+func TestRateEstimatorSeparatesAverage(t *testing.T) {
+	start := time.Unix(0, 0)
+	r := NewRateEstimator(time.Second, start)
+
+	// 10s 的 1000 B/s 之后 10s 停顿：全程平均减半，瞬时速度归零
+	now, total, _ := feed(r, start, 0, 1000, 10*time.Second, 100*time.Millisecond)
+	_, _, rate := feed(r, now, total, 0, 10*time.Second, 100*time.Millisecond)
+
+	if rate.Average < 450 || rate.Average > 550 {
+		t.Errorf("average = %d, want about 500", rate.Average)
+	}
+	if rate.Instant != 0 {
+		t.Errorf("instant = %d, want 0", rate.Instant)
+	}
+	if got := (Rate{}).ETA(1000); got != 0 {
+		t.Errorf("ETA without speed = %v, want 0 (unknown)", got)
+	}
+}
+
+func TestRateEstimatorFirstSampleUsesAverage(t *testing.T) {
+	start := time.Unix(0, 0)
+	r := NewRateEstimator(0, start)
+
+	// 还不到一个采样间隔
+	rate := r.Update(1000, start.Add(100*time.Millisecond))
+	if rate.Average != 10000 || rate.Smoothed != rate.Average || rate.Instant != rate.Average {
+		t.Errorf("before first sample rates should equal the average, got %+v", rate)
+	}
+	if got := rate.ETA(20000); got != 2*time.Second {
+		t.Errorf("ETA = %v, want 2s", got)
+	}
+}
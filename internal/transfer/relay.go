@@ -0,0 +1,195 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/remotefile"
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// 上传模式
+const (
+	// ModeTunnel 默认：本机经嵌套的 direct-tcpip 隧道直接写到最后一跳，每一跳的加密都在本机完成
+	ModeTunnel = "tunnel"
+	// ModeRelay 只连接第一跳，由各跳上的 ssh 客户端逐跳转发（cat | ssh next 'cat > target'），
+	// 各跳并发收发，本机只加密一层。每一跳须能用自己的密钥或 agent 免交互登录下一跳
+	ModeRelay = "relay"
+	// ModeStage 先把文件完整上传到最后一个网关的暂存目录（占用 WAN），再由网关经内网推送到目标，
+	// 网关须能免交互登录目标；见 UploadStaged
+	ModeStage = "stage"
+	// ModeCompare 依次以 tunnel 和 relay 上传同一个文件并报告各自的吞吐，供选择模式
+	ModeCompare = "compare"
+)
+
+// relayConnectTimeout 中继各跳上 ssh 的连接超时（秒）
+const relayConnectTimeout = 10
+
+// ParseUploadMode 校验上传模式，为空时为 ModeTunnel
+func ParseUploadMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return ModeTunnel, nil
+	case ModeTunnel, ModeRelay, ModeStage, ModeCompare:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid upload mode %q (tunnel, relay, stage, compare)", mode)
+}
+
+// relayCommand 把 cmd 包装为经 relay 各跳依次登录后在最后一跳执行的命令：
+// 每一层由上一跳的 ssh 以 BatchMode 登录下一跳，标准输入输出逐跳接力
+func relayCommand(relay []*types.Hop, cmd string) string {
+	for i := len(relay) - 1; i >= 0; i-- {
+		hop := relay[i]
+		login := "ssh -o BatchMode=yes -o ConnectTimeout=" + strconv.Itoa(relayConnectTimeout)
+		if hop.Port != 0 && hop.Port != 22 {
+			login += " -p " + strconv.Itoa(hop.Port)
+		}
+		target := hop.Host
+		if hop.User != "" {
+			target = hop.User + "@" + hop.Host
+		}
+		cmd = login + " " + terminal.ShellQuote(target) + " " + terminal.ShellQuote(cmd)
+	}
+	return cmd
+}
+
+// relaySuffix 中继写入的临时文件后缀，完整收到后改名为目标文件
+const relaySuffix = ".gmssh-relay"
+
+// UploadRelay 以中继模式把单个文件上传到 relay 最后一跳的 remotePath。t 的链只需连到中继起点
+// （通常只有第一跳），relay 是其后的各跳；relay 为空时直接写到链的最后一跳。
+// 数据先写入 <目标>.gmssh-relay，完整收到后改名，失败时不会留下半个文件
+func (t *SCPTransfer) UploadRelay(ctx context.Context, localFile, remotePath string, relay []*types.Hop, progress chan<- *types.TransferProgress) error {
+	size, err := t.pipeUpload(ctx, localFile, remotePath, relay, true, "", progress)
+	if err != nil {
+		return err
+	}
+	if progress != nil {
+		progress <- &types.TransferProgress{
+			FileName:   path.Base(localFile),
+			TotalBytes: size,
+			SentBytes:  size,
+			Status:     "completed",
+		}
+	}
+	t.logger.Printf("[SCP] Relay upload completed: %s", remotePath)
+	return nil
+}
+
+// pipeUpload 把本地文件作为标准输入经 relay 各跳写到 remotePath，返回文件大小。
+// backup 时按 t 的备份规则保留被覆盖的旧文件；进度消息带上 phase，结束时不发送 completed
+func (t *SCPTransfer) pipeUpload(ctx context.Context, localFile, remotePath string, relay []*types.Hop, backup bool, phase string, progress chan<- *types.TransferProgress) (int64, error) {
+	if t.run == nil && !t.chain.IsConnected() {
+		return 0, fmt.Errorf("SSH chain not connected")
+	}
+	file, err := os.Open(localFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open local file: %w", err)
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat local file: %w", err)
+	}
+	if stat.IsDir() {
+		return 0, fmt.Errorf("relay mode uploads single files, %s is a directory", localFile)
+	}
+	size := stat.Size()
+	name := path.Base(localFile)
+	keep := 0
+	if backup {
+		keep = t.relayBackupKeep(remotePath, name)
+	}
+
+	var sent atomic.Int64
+	stopProgress := t.tickProgress(progress, name, size, phase, sent.Load)
+	t.logger.Printf("[SCP] Relay upload %s -> %s through %d relay hop(s)", localFile, remotePath, len(relay))
+	err = t.runRemote(ctx, relayCommand(relay, writeScript(remotePath, name, keep)), &countingReader{r: file, n: &sent}, nil)
+	stopProgress()
+	if err != nil {
+		return 0, fmt.Errorf("relay upload failed: %w", err)
+	}
+	return size, nil
+}
+
+// relayBackupKeep 覆盖 remotePath 前保留的备份数量
+func (t *SCPTransfer) relayBackupKeep(remotePath, name string) int {
+	if t.backupKeep == nil {
+		return 0
+	}
+	remoteFile := remotePath
+	if strings.HasSuffix(remotePath, "/") {
+		remoteFile = path.Join(remotePath, name)
+	}
+	return t.backupKeep(remoteFile)
+}
+
+// tickProgress 每 progressInterval 按 done() 发送一条 running 进度，返回的函数停止发送并等待退出
+func (t *SCPTransfer) tickProgress(progress chan<- *types.TransferProgress, name string, size int64, phase string, done func() int64) func() {
+	if progress == nil {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rate := NewRateEstimator(t.speedWindow, time.Now())
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				n := done()
+				p := runningProgress(name, size, n, rate.Update(n, time.Now()))
+				p.Phase = phase
+				progress <- p
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		wg.Wait()
+	}
+}
+
+// resolveScript 在目标上把 remotePath 解析为 shell 变量 f：
+// 以 / 结尾或是已存在的目录时放入该目录，与 UploadContext 相同
+func resolveScript(remotePath, name string) string {
+	return "f=" + terminal.ShellQuote(remotePath) + `; case "$f" in */) mkdir -p "$f" || exit 1;; esac; if [ -d "$f" ]; then f="${f%/}"/` + terminal.ShellQuote(name) + "; fi" +
+		`; mkdir -p "$(dirname "$f")" || exit 1`
+}
+
+// writeScript 解析目标路径、备份、从标准输入写入临时文件并改名，都在目标上的一个会话中完成
+func writeScript(remotePath, name string, keep int) string {
+	script := resolveScript(remotePath, name)
+	if keep > 0 {
+		script += "; (" + remotefile.BackupCommandVar(time.Now(), keep) + ") || exit 1"
+	}
+	return script + `; cat > "$f` + relaySuffix + `" && mv -f "$f` + relaySuffix + `" "$f" && chmod 644 "$f" || { rm -f "$f` + relaySuffix + `"; exit 1; }`
+}
+
+// MeasureMode 执行一次上传并计时，返回该模式的吞吐
+func MeasureMode(mode string, bytes int64, upload func() error) types.ModeThroughput {
+	start := time.Now()
+	err := upload()
+	elapsed := time.Since(start)
+	result := types.ModeThroughput{Mode: mode, Bytes: bytes, DurationMs: elapsed.Milliseconds()}
+	if err != nil {
+		result.Error = err.Error()
+	} else if elapsed > 0 {
+		result.Throughput = int64(float64(bytes) / elapsed.Seconds())
+	}
+	return result
+}
@@ -0,0 +1,133 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// fakeSSH 在 PATH 最前面放一个 ssh：跳过选项，把登录的目标追加到 hops.log 后在本机执行命令；
+// 目标为 down 时模拟登录失败
+func fakeSSH(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	script := `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-o|-p) shift 2 ;;
+	*) break ;;
+	esac
+done
+echo "$1" >> "` + dir + `/hops.log"
+case "$1" in *down*) echo "ssh: connect to host down: Connection refused" >&2; exit 255 ;; esac
+exec sh -c "$2"
+`
+	if err := os.WriteFile(filepath.Join(dir, "ssh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return filepath.Join(dir, "hops.log")
+}
+
+func TestRelayCommand(t *testing.T) {
+	relay := []*types.Hop{
+		{Host: "10.0.0.2", Port: 2222, User: "ops"},
+		{Host: "10.0.1.3", Port: 22, User: "deploy"},
+	}
+	cmd := relayCommand(relay, "cat > '/srv/a b'")
+	if !strings.HasPrefix(cmd, "ssh -o BatchMode=yes -o ConnectTimeout=10 -p 2222 'ops@10.0.0.2' ") {
+		t.Errorf("outer login = %q", cmd)
+	}
+	if strings.Count(cmd, "ssh -o BatchMode=yes") != 2 || strings.Contains(cmd, "-p 22 ") {
+		t.Errorf("command = %q", cmd)
+	}
+	if got := relayCommand(nil, "true"); got != "true" {
+		t.Errorf("no relay = %q", got)
+	}
+}
+
+func TestUploadRelay(t *testing.T) {
+	hopsLog := fakeSSH(t)
+	scp := &SCPTransfer{run: localShell, logger: log.New(io.Discard, "", 0)}
+	relay := []*types.Hop{{Host: "gw2", User: "ops"}, {Host: "target", User: "deploy"}}
+
+	local := filepath.Join(t.TempDir(), "app.bin")
+	data := bytes.Repeat([]byte("relay\n"), 100000)
+	if err := os.WriteFile(local, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	remote := t.TempDir()
+
+	// 已存在的目录：放入其中，依次经过各跳
+	progress := make(chan *types.TransferProgress, 100)
+	if err := scp.UploadRelay(context.Background(), local, remote, relay, progress); err != nil {
+		t.Fatalf("UploadRelay: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(remote, "app.bin")); !bytes.Equal(got, data) {
+		t.Errorf("uploaded %d of %d bytes", len(got), len(data))
+	}
+	if hops, _ := os.ReadFile(hopsLog); string(hops) != "ops@gw2\ndeploy@target\n" {
+		t.Errorf("hops = %q", hops)
+	}
+	close(progress)
+	var last *types.TransferProgress
+	for p := range progress {
+		last = p
+	}
+	if last == nil || last.Status != "completed" || last.SentBytes != int64(len(data)) {
+		t.Errorf("last progress = %+v", last)
+	}
+
+	// 以 / 结尾的新目录；指定文件名时覆盖前备份旧文件
+	if err := scp.UploadRelay(context.Background(), local, filepath.Join(remote, "new")+"/", relay, nil); err != nil {
+		t.Fatalf("UploadRelay to new dir: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(remote, "new", "app.bin")); err != nil {
+		t.Error(err)
+	}
+	scp.backupKeep = func(string) int { return 1 }
+	target := filepath.Join(remote, "renamed.bin")
+	os.WriteFile(target, []byte("old"), 0644)
+	if err := scp.UploadRelay(context.Background(), local, target, relay, nil); err != nil {
+		t.Fatalf("UploadRelay over a file: %v", err)
+	}
+	backups, _ := filepath.Glob(target + ".bak-*")
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v", backups)
+	}
+	if old, _ := os.ReadFile(backups[0]); string(old) != "old" {
+		t.Errorf("backup = %q", old)
+	}
+
+	// 中间一跳登录失败：上传失败，不留下临时文件
+	down := []*types.Hop{{Host: "down"}, {Host: "target"}}
+	err := scp.UploadRelay(context.Background(), local, filepath.Join(remote, "failed.bin"), down, nil)
+	if err == nil || !strings.Contains(err.Error(), "255") {
+		t.Errorf("UploadRelay through a down hop = %v", err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(remote, "*.gmssh-relay")); len(leftovers) != 0 {
+		t.Errorf("left %v", leftovers)
+	}
+
+	if err := scp.UploadRelay(context.Background(), remote, remote, relay, nil); err == nil {
+		t.Error("relay upload of a directory succeeded")
+	}
+}
+
+func TestParseUploadMode(t *testing.T) {
+	for input, want := range map[string]string{"": ModeTunnel, "relay": ModeRelay, "compare": ModeCompare} {
+		if got, err := ParseUploadMode(input); err != nil || got != want {
+			t.Errorf("ParseUploadMode(%q) = %q, %v", input, got, err)
+		}
+	}
+	if _, err := ParseUploadMode("pipeline"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
@@ -1,30 +1,93 @@
 package transfer
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/luobobo896/HSSH/internal/remotefile"
 	"github.com/luobobo896/HSSH/internal/ssh"
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/internal/tracing"
 	"github.com/luobobo896/HSSH/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // SCPTransfer SCP 文件传输器
 type SCPTransfer struct {
-	chain *ssh.Chain
+	chain       *ssh.Chain
+	logger      *log.Logger
+	speedWindow time.Duration
+	run         remoteRunner     // 不为 nil 时代替链执行远端命令（测试中用本机 shell）
+	backupKeep  func(string) int // 覆盖远端文件前应保留的备份数，nil 表示不备份
+	journal     *Journal         // 不为 nil 时记录进度，并跳过或续传之前运行中已发送的文件
+	sudo        *SudoOptions     // 不为 nil 时目标不可写的文件经临时文件和提权命令写入
 }
 
 // NewSCPTransfer 创建新的 SCP 传输器
 func NewSCPTransfer(chain *ssh.Chain) *SCPTransfer {
-	return &SCPTransfer{chain: chain}
+	return &SCPTransfer{chain: chain, logger: log.Default()}
+}
+
+// SetLogger 设置传输日志输出（例如附带请求 ID 的 logger）
+func (t *SCPTransfer) SetLogger(logger *log.Logger) {
+	t.logger = logger
+}
+
+// SetSpeedWindow 设置速度平滑（EWMA）的时间窗口，<= 0 时使用 DefaultSpeedWindow
+func (t *SCPTransfer) SetSpeedWindow(window time.Duration) {
+	t.speedWindow = window
+}
+
+// SetBackups 设置上传覆盖已有文件前的备份策略：keep 返回远端文件应保留的备份数，0 表示不备份
+func (t *SCPTransfer) SetBackups(keep func(remoteFile string) int) {
+	t.backupKeep = keep
+}
+
+// SetJournal 设置任务日志：上传时记录每个文件的进度，已完成的文件跳过，未完成的从远端文件的实际长度续传
+func (t *SCPTransfer) SetJournal(journal *Journal) {
+	t.journal = journal
+}
+
+// backup 按备份策略在覆盖 remoteFile 前把它复制为 <name>.bak-<时间>，并清理多余的旧备份
+func (t *SCPTransfer) backup(ctx context.Context, remoteFile string) error {
+	if t.backupKeep == nil {
+		return nil
+	}
+	keep := t.backupKeep(remoteFile)
+	if keep <= 0 {
+		return nil
+	}
+	name := remotefile.BackupName(remoteFile, time.Now())
+	if err := t.runRemote(ctx, remotefile.BackupCommand(remoteFile, name, keep), nil, nil); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", remoteFile, err)
+	}
+	t.logger.Printf("[SCP] Backed up %s (keeping %d)", remoteFile, keep)
+	return nil
 }
 
 // Upload 上传文件到最后一跳
 func (t *SCPTransfer) Upload(localPath, remotePath string, progress chan<- *types.TransferProgress) error {
+	return t.UploadContext(context.Background(), localPath, remotePath, progress)
+}
+
+// UploadContext 上传文件到最后一跳，ctx 用于关联追踪 span
+func (t *SCPTransfer) UploadContext(ctx context.Context, localPath, remotePath string, progress chan<- *types.TransferProgress) (err error) {
+	ctx, span := tracing.Start(ctx, "transfer.upload",
+		attribute.String("transfer.local_path", localPath),
+		attribute.String("transfer.remote_path", remotePath),
+		attribute.Int("ssh.hops", t.chain.HopCount()),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	if !t.chain.IsConnected() {
 		return fmt.Errorf("SSH chain not connected")
 	}
@@ -41,57 +104,98 @@ func (t *SCPTransfer) Upload(localPath, remotePath string, progress chan<- *type
 	}
 
 	if stat.IsDir() {
-		return t.uploadDir(file, localPath, remotePath, progress)
+		// 预扫描得到文件清单和总量，之后按整个目录报告进度
+		dir, files, err := newDirProgress(localPath, t.speedWindow, progress)
+		if err != nil {
+			return fmt.Errorf("failed to scan local directory: %w", err)
+		}
+		dir.start(files)
+		if err := t.uploadDir(ctx, file, localPath, remotePath, dir); err != nil {
+			return err
+		}
+		if dir.failed > 0 {
+			return fmt.Errorf("%d of %d files failed to upload", dir.failed, len(files))
+		}
+		return nil
 	}
 
-	return t.uploadFile(file, stat.Size(), filepath.Base(localPath), remotePath, progress)
+	return t.uploadFile(ctx, file, stat, remotePath, progress, nil)
 }
 
 // uploadFile 上传单个文件
-func (t *SCPTransfer) uploadFile(reader io.Reader, size int64, filename, remotePath string, progress chan<- *types.TransferProgress) error {
-	log.Printf("[SCP] Starting uploadFile: filename=%s, remotePath=%s, size=%d", filename, remotePath, size)
-	
+// dir 非 nil 时（目录上传中）进度计入整个目录，否则报告该文件自身的进度
+func (t *SCPTransfer) uploadFile(ctx context.Context, file *os.File, info os.FileInfo, remotePath string, progress chan<- *types.TransferProgress, dir *dirProgress) (err error) {
+	size, filename := info.Size(), info.Name()
+	_, span := tracing.Start(ctx, "transfer.upload_file",
+		attribute.String("transfer.file", filename),
+		attribute.Int64("transfer.bytes", size),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	t.logger.Printf("[SCP] Starting uploadFile: filename=%s, remotePath=%s, size=%d", filename, remotePath, size)
+
 	// 确定目标文件路径
 	// 如果 remotePath 以 / 结尾，或是已存在的目录，则将文件放入该目录
 	remoteFile := remotePath
 	if strings.HasSuffix(remotePath, "/") {
 		remoteFile = filepath.Join(remotePath, filename)
-		log.Printf("[SCP] Remote path ends with /, using: %s", remoteFile)
+		t.logger.Printf("[SCP] Remote path ends with /, using: %s", remoteFile)
 	} else {
 		// 检查是否是已存在的目录
 		checkSession, err := t.chain.NewSession()
 		if err == nil && checkSession != nil {
-			testCmd := fmt.Sprintf("test -d %s", remotePath)
+			testCmd := "test -d " + terminal.ShellQuote(remotePath)
 			if err := checkSession.Run(testCmd); err == nil {
 				// 是已存在的目录
 				remoteFile = filepath.Join(remotePath, filename)
-				log.Printf("[SCP] Remote path is existing dir, using: %s", remoteFile)
+				t.logger.Printf("[SCP] Remote path is existing dir, using: %s", remoteFile)
 			} else {
-				log.Printf("[SCP] Remote path is not a dir, using as file path: %s", remoteFile)
+				t.logger.Printf("[SCP] Remote path is not a dir, using as file path: %s", remoteFile)
 			}
 			checkSession.Close()
 		} else {
-			log.Printf("[SCP] Could not check if path is dir (session error: %v), using: %s", err, remoteFile)
+			t.logger.Printf("[SCP] Could not check if path is dir (session error: %v), using: %s", err, remoteFile)
 		}
 	}
 
 	// 确保目标目录存在
 	targetDir := filepath.Dir(remoteFile)
-	log.Printf("[SCP] Creating target directory: %s", targetDir)
+	t.logger.Printf("[SCP] Creating target directory: %s", targetDir)
 	mkdirSession, err := t.chain.NewSession()
 	if err != nil {
 		return fmt.Errorf("failed to create mkdir session: %w", err)
 	}
-	mkdirCmd := fmt.Sprintf("mkdir -p %s", targetDir)
+	mkdirCmd := "mkdir -p " + terminal.ShellQuote(targetDir)
 	if err := mkdirSession.Run(mkdirCmd); err != nil {
-		log.Printf("[SCP] mkdir warning (may already exist): %v", err)
+		t.logger.Printf("[SCP] mkdir warning (may already exist): %v", err)
 	} else {
-		log.Printf("[SCP] Directory created or already exists")
+		t.logger.Printf("[SCP] Directory created or already exists")
 	}
 	mkdirSession.Close()
 
+	// 目标不可写时按 upload.sudo 经临时文件和特权命令写入；未启用时明确报告，而不是让 cat 报权限错误
+	if writable, err := t.remoteWritable(ctx, remoteFile); err != nil {
+		t.logger.Printf("[SCP] Could not check whether %s is writable: %v", remoteFile, err)
+	} else if !writable {
+		if t.sudo == nil {
+			return fmt.Errorf("%s: %w (enable upload.sudo to install it with a privileged command)", remoteFile, ErrNotWritable)
+		}
+		return t.uploadFileSudo(ctx, file, info, remoteFile, progress, dir)
+	}
+
+	// 任务日志中有该文件的断点时续传，之前写入的部分不再备份
+	offset := t.resumeOffset(ctx, remoteFile, t.journal.Lookup(file.Name(), info).Offset)
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek local file: %w", err)
+		}
+		t.logger.Printf("[SCP] Resuming %s at %d/%d bytes", remoteFile, offset, size)
+	} else if err := t.backup(ctx, remoteFile); err != nil {
+		return err
+	}
+
 	// 创建文件传输 session
-	log.Printf("[SCP] Creating transfer session")
+	t.logger.Printf("[SCP] Creating transfer session")
 	session, err := t.chain.NewSession()
 	if err != nil {
 		return fmt.Errorf("failed to create session: %w", err)
@@ -104,22 +208,36 @@ func (t *SCPTransfer) uploadFile(reader io.Reader, size int64, filename, remoteP
 		return fmt.Errorf("failed to get stdin pipe: %w", err)
 	}
 
-	// 启动 cat 命令写入文件
-	catCmd := fmt.Sprintf("cat > %s", remoteFile)
-	log.Printf("[SCP] Starting cat command: %s", catCmd)
+	// 启动 cat 命令写入文件；续传时先截断到断点再追加
+	quoted := terminal.ShellQuote(remoteFile)
+	catCmd := "cat > " + quoted
+	if offset > 0 {
+		catCmd = fmt.Sprintf("truncate -s %d %s && cat >> %s", offset, quoted, quoted)
+	}
+	t.logger.Printf("[SCP] Starting cat command: %s", catCmd)
 	if err := session.Start(catCmd); err != nil {
 		stdin.Close()
 		return fmt.Errorf("failed to start cat command: %w", err)
 	}
-	log.Printf("[SCP] Cat command started, beginning file transfer")
+	t.logger.Printf("[SCP] Cat command started, beginning file transfer")
 
 	// 发送文件内容并报告进度
 	buf := make([]byte, 32*1024) // 32KB 缓冲区
-	var sent int64
-	startTime := time.Now()
+	sent := offset
+	rate := NewRateEstimator(t.speedWindow, time.Now())
+	report := func(sent int64) {
+		if progress != nil {
+			// 速度只按本次发送的字节计算
+			progress <- runningProgress(filename, size, sent, rate.Update(sent-offset, time.Now()))
+		}
+	}
+	if dir != nil {
+		dir.resume(offset)
+		report = dir.running
+	}
 
 	for {
-		n, err := reader.Read(buf)
+		n, err := file.Read(buf)
 		if n > 0 {
 			_, writeErr := stdin.Write(buf[:n])
 			if writeErr != nil {
@@ -127,30 +245,13 @@ func (t *SCPTransfer) uploadFile(reader io.Reader, size int64, filename, remoteP
 				return fmt.Errorf("failed to write to remote: %w", writeErr)
 			}
 			sent += int64(n)
-
-			if progress != nil {
-				elapsed := time.Since(startTime).Seconds()
-				speed := int64(0)
-				if elapsed > 0 {
-					speed = int64(float64(sent) / elapsed)
-				}
-				eta := time.Duration(0)
-				if speed > 0 {
-					eta = time.Duration(float64(size-sent)/float64(speed)) * time.Second
-				}
-
-				progress <- &types.TransferProgress{
-					FileName:   filename,
-					TotalBytes: size,
-					SentBytes:  sent,
-					Speed:      speed,
-					ETA:        eta,
-					Status:     "running",
-				}
+			report(sent)
+			if err := t.journal.Record(file.Name(), info, sent, false); err != nil {
+				t.logger.Printf("[SCP] WARNING: failed to write task journal: %v", err)
 			}
 		}
 		if err == io.EOF {
-			log.Printf("[SCP] Reached EOF, sent %d/%d bytes", sent, size)
+			t.logger.Printf("[SCP] Reached EOF, sent %d/%d bytes", sent, size)
 			break
 		}
 		if err != nil {
@@ -161,24 +262,27 @@ func (t *SCPTransfer) uploadFile(reader io.Reader, size int64, filename, remoteP
 	}
 
 	// 关闭 stdin 表示文件传输完成
-	log.Printf("[SCP] Closing stdin to signal EOF")
+	t.logger.Printf("[SCP] Closing stdin to signal EOF")
 	stdin.Close()
 
 	// 等待命令完成
-	log.Printf("[SCP] Waiting for cat command to complete")
+	t.logger.Printf("[SCP] Waiting for cat command to complete")
 	if err := session.Wait(); err != nil {
 		return fmt.Errorf("remote cat command failed: %w", err)
 	}
-	log.Printf("[SCP] Cat command completed successfully")
+	t.logger.Printf("[SCP] Cat command completed successfully")
+	if err := t.journal.Record(file.Name(), info, size, true); err != nil {
+		t.logger.Printf("[SCP] WARNING: failed to write task journal: %v", err)
+	}
 
 	// 设置文件权限 (0644)
-	log.Printf("[SCP] Setting file permissions: chmod 644 %s", remoteFile)
+	t.logger.Printf("[SCP] Setting file permissions: chmod 644 %s", remoteFile)
 	chmodSession, _ := t.chain.NewSession()
 	if chmodSession != nil {
-		if err := chmodSession.Run(fmt.Sprintf("chmod 644 %s", remoteFile)); err != nil {
-			log.Printf("[SCP] chmod warning: %v", err)
+		if err := chmodSession.Run("chmod 644 "+terminal.ShellQuote(remoteFile)); err != nil {
+			t.logger.Printf("[SCP] chmod warning: %v", err)
 		} else {
-			log.Printf("[SCP] File permissions set successfully")
+			t.logger.Printf("[SCP] File permissions set successfully")
 		}
 		chmodSession.Close()
 	}
@@ -186,17 +290,17 @@ func (t *SCPTransfer) uploadFile(reader io.Reader, size int64, filename, remoteP
 	// 验证文件是否存在
 	verifySession, _ := t.chain.NewSession()
 	if verifySession != nil {
-		lsCmd := fmt.Sprintf("ls -la %s", remoteFile)
+		lsCmd := "ls -la " + terminal.ShellQuote(remoteFile)
 		output, err := verifySession.Output(lsCmd)
 		if err != nil {
-			log.Printf("[SCP] WARNING: Failed to verify file: %v", err)
+			t.logger.Printf("[SCP] WARNING: Failed to verify file: %v", err)
 		} else {
-			log.Printf("[SCP] File verified on remote: %s", strings.TrimSpace(string(output)))
+			t.logger.Printf("[SCP] File verified on remote: %s", strings.TrimSpace(string(output)))
 		}
 		verifySession.Close()
 	}
 
-	if progress != nil {
+	if progress != nil && dir == nil {
 		progress <- &types.TransferProgress{
 			FileName:   filename,
 			TotalBytes: size,
@@ -205,18 +309,52 @@ func (t *SCPTransfer) uploadFile(reader io.Reader, size int64, filename, remoteP
 		}
 	}
 
-	log.Printf("[SCP] Upload completed successfully: %s", remoteFile)
+	t.logger.Printf("[SCP] Upload completed successfully: %s", remoteFile)
+	return nil
+}
+
+// uploadFileSudo 经提权命令上传单个文件，进度报告方式与 uploadFile 相同
+func (t *SCPTransfer) uploadFileSudo(ctx context.Context, file *os.File, info os.FileInfo, remoteFile string, progress chan<- *types.TransferProgress, dir *dirProgress) error {
+	size, filename := info.Size(), info.Name()
+	rate := NewRateEstimator(t.speedWindow, time.Now())
+	report := func(sent int64) {
+		if progress != nil {
+			progress <- runningProgress(filename, size, sent, rate.Update(sent, time.Now()))
+		}
+	}
+	if dir != nil {
+		report = dir.running
+	}
+	if err := t.uploadPrivileged(ctx, file, remoteFile, report); err != nil {
+		return err
+	}
+	if err := t.journal.Record(file.Name(), info, size, true); err != nil {
+		t.logger.Printf("[SCP] WARNING: failed to write task journal: %v", err)
+	}
+	if progress != nil && dir == nil {
+		progress <- &types.TransferProgress{
+			FileName:   filename,
+			TotalBytes: size,
+			SentBytes:  size,
+			Status:     "completed",
+		}
+	}
 	return nil
 }
 
 // uploadDir 上传目录
-func (t *SCPTransfer) uploadDir(dir *os.File, localPath, remotePath string, progress chan<- *types.TransferProgress) error {
+// 单个文件失败只记录在进度中并继续上传其余文件；SSH 链不可用或 ctx 取消时中止
+func (t *SCPTransfer) uploadDir(ctx context.Context, dir *os.File, localPath, remotePath string, progress *dirProgress) error {
 	entries, err := dir.ReadDir(-1)
 	if err != nil {
 		return err
 	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
 
 	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		localFile := filepath.Join(localPath, entry.Name())
 		remoteFile := filepath.Join(remotePath, entry.Name())
 
@@ -226,27 +364,96 @@ func (t *SCPTransfer) uploadDir(dir *os.File, localPath, remotePath string, prog
 			if err != nil {
 				return err
 			}
-			mkdirCmd := fmt.Sprintf("mkdir -p %s", remoteFile)
+			mkdirCmd := "mkdir -p " + terminal.ShellQuote(remoteFile)
 			session.Run(mkdirCmd)
 			session.Close()
 
 			// 递归上传子目录
-			subDir, _ := os.Open(localFile)
-			t.uploadDir(subDir, localFile, remoteFile, progress)
+			subDir, err := os.Open(localFile)
+			if err != nil {
+				return err
+			}
+			err = t.uploadDir(ctx, subDir, localFile, remoteFile, progress)
 			subDir.Close()
+			if err != nil {
+				return err
+			}
 		} else {
-			file, _ := os.Open(localFile)
-			stat, _ := file.Stat()
-			t.uploadFile(file, stat.Size(), entry.Name(), remoteFile, progress)
-			file.Close()
+			progress.begin(localFile)
+			if t.skipDone(localFile) {
+				t.logger.Printf("[SCP] Skipping %s, uploaded by an earlier run", localFile)
+				progress.resume(progress.size)
+				progress.finish(nil)
+				continue
+			}
+			if err := t.uploadLocalFile(ctx, localFile, remoteFile, progress); err != nil {
+				t.logger.Printf("[SCP] ERROR: failed to upload %s: %v", localFile, err)
+				progress.finish(err)
+			} else {
+				progress.finish(nil)
+			}
 		}
 	}
 
 	return nil
 }
 
+// uploadLocalFile 打开并上传目录中的一个文件
+func (t *SCPTransfer) uploadLocalFile(ctx context.Context, localFile, remoteFile string, progress *dirProgress) error {
+	file, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	progress.size = stat.Size()
+	return t.uploadFile(ctx, file, stat, remoteFile, nil, progress)
+}
+
+// skipDone 任务日志中 localFile 是否已完整上传且之后没有改动
+func (t *SCPTransfer) skipDone(localFile string) bool {
+	if t.journal == nil {
+		return false
+	}
+	info, err := os.Stat(localFile)
+	return err == nil && t.journal.Lookup(localFile, info).Done
+}
+
+// resumeOffset 续传的起点：日志记录的偏移与远端文件实际长度中较小的一个（已写入 stdin 的数据未必都落盘）；
+// 无法读取远端文件时从头上传
+func (t *SCPTransfer) resumeOffset(ctx context.Context, remoteFile string, journaled int64) int64 {
+	if journaled <= 0 {
+		return 0
+	}
+	var out bytes.Buffer
+	if err := t.runRemote(ctx, "wc -c < "+terminal.ShellQuote(remoteFile), nil, &out); err != nil {
+		return 0
+	}
+	remote, err := strconv.ParseInt(strings.TrimSpace(out.String()), 10, 64)
+	if err != nil || remote < 0 {
+		return 0
+	}
+	return min(remote, journaled)
+}
+
 // Download 从远程下载文件
 func (t *SCPTransfer) Download(remotePath, localPath string, progress chan<- *types.TransferProgress) error {
+	return t.DownloadContext(context.Background(), remotePath, localPath, progress)
+}
+
+// DownloadContext 从远程下载文件，ctx 用于关联追踪 span
+func (t *SCPTransfer) DownloadContext(ctx context.Context, remotePath, localPath string, progress chan<- *types.TransferProgress) (err error) {
+	_, span := tracing.Start(ctx, "transfer.download",
+		attribute.String("transfer.remote_path", remotePath),
+		attribute.String("transfer.local_path", localPath),
+		attribute.Int("ssh.hops", t.chain.HopCount()),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	if !t.chain.IsConnected() {
 		return fmt.Errorf("SSH chain not connected")
 	}
@@ -258,7 +465,7 @@ func (t *SCPTransfer) Download(remotePath, localPath string, progress chan<- *ty
 	defer session.Close()
 
 	// 获取远程文件大小
-	stdout, _, err := t.chain.Execute(fmt.Sprintf("stat -f%%z %s 2>/dev/null || stat -c%%s %s 2>/dev/null", remotePath, remotePath))
+	stdout, _, err := t.chain.Execute(fmt.Sprintf("stat -f%%z %[1]s 2>/dev/null || stat -c%%s %[1]s 2>/dev/null", terminal.ShellQuote(remotePath)))
 	if err != nil {
 		return fmt.Errorf("failed to get remote file size: %w", err)
 	}
@@ -279,7 +486,7 @@ func (t *SCPTransfer) Download(remotePath, localPath string, progress chan<- *ty
 		return err
 	}
 
-	catCmd := fmt.Sprintf("cat %s", remotePath)
+	catCmd := "cat " + terminal.ShellQuote(remotePath)
 	if err := session.Start(catCmd); err != nil {
 		return fmt.Errorf("failed to start cat command: %w", err)
 	}
@@ -287,7 +494,7 @@ func (t *SCPTransfer) Download(remotePath, localPath string, progress chan<- *ty
 	// 读取文件内容
 	buf := make([]byte, 32*1024)
 	var received int64
-	startTime := time.Now()
+	rate := NewRateEstimator(t.speedWindow, time.Now())
 
 	for received < size {
 		n, err := stdoutPipe.Read(buf)
@@ -296,24 +503,7 @@ func (t *SCPTransfer) Download(remotePath, localPath string, progress chan<- *ty
 			received += int64(n)
 
 			if progress != nil {
-				elapsed := time.Since(startTime).Seconds()
-				speed := int64(0)
-				if elapsed > 0 {
-					speed = int64(float64(received) / elapsed)
-				}
-				eta := time.Duration(0)
-				if speed > 0 {
-					eta = time.Duration(float64(size-received)/float64(speed)) * time.Second
-				}
-
-				progress <- &types.TransferProgress{
-					FileName:   filepath.Base(remotePath),
-					TotalBytes: size,
-					SentBytes:  received,
-					Speed:      speed,
-					ETA:        eta,
-					Status:     "running",
-				}
+				progress <- runningProgress(filepath.Base(remotePath), size, received, rate.Update(received, time.Now()))
 			}
 		}
 		if err == io.EOF {
@@ -0,0 +1,162 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// 中转上传的阶段，见 types.TransferProgress.Phase
+const (
+	PhaseStaging    = "staging"
+	PhaseDelivering = "delivering"
+)
+
+// DefaultStageDir 网关上的默认暂存目录，相对登录用户的主目录
+const DefaultStageDir = ".gmssh-stage"
+
+// stagePollInterval 网关推送阶段查询目标上已写入大小的间隔，每次查询都要从网关登录一次目标
+const stagePollInterval = time.Second
+
+// stageCleanupTimeout 传输结束（包括被取消）后删除网关暂存的时限
+const stageCleanupTimeout = 30 * time.Second
+
+// ErrStageQuota 网关暂存目录的已用空间加上本次文件超过配额
+var ErrStageQuota = errors.New("gateway staging quota exceeded")
+
+// StageOptions 网关暂存目录的位置、配额和残留的保留时间
+type StageOptions struct {
+	Dir    string        // 为空时为 DefaultStageDir
+	Quota  int64         // 字节，0 为不限制
+	MaxAge time.Duration // 超过时清理残留的暂存，<= 0 时为 DefaultStagingMaxAge
+}
+
+// UploadStaged 以中转模式上传单个文件：t 的链连到网关（链的最后一跳），先把文件完整上传到网关的暂存目录，
+// 再在网关上经 target 各跳（通常只有目标本身）推送到 remotePath。推送在网关上执行，
+// 进度通过链定期查询目标上已写入的大小。无论成败，暂存的文件都会被删除
+func (t *SCPTransfer) UploadStaged(ctx context.Context, localFile, remotePath string, target []*types.Hop, opts StageOptions, progress chan<- *types.TransferProgress) error {
+	if len(target) == 0 {
+		return fmt.Errorf("staged upload needs a hop behind the gateway")
+	}
+	stat, err := os.Stat(localFile)
+	if err != nil {
+		return fmt.Errorf("failed to stat local file: %w", err)
+	}
+	if stat.IsDir() {
+		return fmt.Errorf("stage mode uploads single files, %s is a directory", localFile)
+	}
+	size := stat.Size()
+	name := path.Base(localFile)
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = DefaultStageDir
+	}
+	if err := t.prepareStage(ctx, dir, size, opts); err != nil {
+		return err
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	stageDir := path.Join(dir, hex.EncodeToString(id))
+	defer func() {
+		cleanup, cancel := context.WithTimeout(context.WithoutCancel(ctx), stageCleanupTimeout)
+		defer cancel()
+		if err := t.runRemote(cleanup, "rm -rf "+terminal.ShellQuote(stageDir), nil, nil); err != nil {
+			t.logger.Printf("[SCP] WARNING: failed to remove gateway staging %s: %v", stageDir, err)
+		}
+	}()
+
+	// 第一阶段：上传到网关
+	stageFile := path.Join(stageDir, name)
+	t.logger.Printf("[SCP] Staging %s on the gateway: %s", localFile, stageFile)
+	if _, err := t.pipeUpload(ctx, localFile, stageFile, nil, false, PhaseStaging, progress); err != nil {
+		return fmt.Errorf("staging on the gateway failed: %w", err)
+	}
+
+	// 第二阶段：网关经内网推送，期间查询目标上临时文件的大小作为进度
+	var delivered atomic.Int64
+	pollCtx, stopPoll := context.WithCancel(ctx)
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		t.pollDelivered(pollCtx, remotePath, name, target, &delivered)
+	}()
+	stopProgress := t.tickProgress(progress, name, size, PhaseDelivering, delivered.Load)
+	t.logger.Printf("[SCP] Delivering %s from the gateway to %s through %d hop(s)", stageFile, remotePath, len(target))
+	cmd := relayCommand(target, writeScript(remotePath, name, t.relayBackupKeep(remotePath, name))) + " < " + terminal.ShellQuote(stageFile)
+	err = t.runRemote(ctx, cmd, nil, nil)
+	stopPoll()
+	<-polled
+	stopProgress()
+	if err != nil {
+		return fmt.Errorf("delivery from the gateway failed: %w", err)
+	}
+	if progress != nil {
+		progress <- &types.TransferProgress{
+			FileName:   name,
+			TotalBytes: size,
+			SentBytes:  size,
+			Status:     "completed",
+			Phase:      PhaseDelivering,
+		}
+	}
+	t.logger.Printf("[SCP] Staged upload completed: %s", remotePath)
+	return nil
+}
+
+// prepareStage 在网关上创建暂存目录、清理超过 MaxAge 的残留，并检查配额
+func (t *SCPTransfer) prepareStage(ctx context.Context, dir string, size int64, opts StageOptions) error {
+	maxAge := opts.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultStagingMaxAge
+	}
+	minutes := max(int(maxAge/time.Minute), 1)
+	d := terminal.ShellQuote(dir)
+	script := "mkdir -p " + d + " || exit 1; find " + d + " -mindepth 1 -maxdepth 1 -mmin +" + strconv.Itoa(minutes) +
+		" -exec rm -rf {} + 2>/dev/null; du -sk " + d + " 2>/dev/null | cut -f1"
+	var out bytes.Buffer
+	if err := t.runRemote(ctx, script, nil, &out); err != nil {
+		return fmt.Errorf("failed to prepare gateway staging %s: %w", dir, err)
+	}
+	if opts.Quota <= 0 {
+		return nil
+	}
+	usedKB, _ := strconv.ParseInt(strings.TrimSpace(out.String()), 10, 64)
+	if used := usedKB * 1024; used+size > opts.Quota {
+		return fmt.Errorf("%w: %s holds %d bytes, %d more exceed %d", ErrStageQuota, dir, used, size, opts.Quota)
+	}
+	return nil
+}
+
+// pollDelivered 每 stagePollInterval 从网关查询目标上临时文件的大小，直到 ctx 结束；查询失败时保留上一次的值
+func (t *SCPTransfer) pollDelivered(ctx context.Context, remotePath, name string, target []*types.Hop, delivered *atomic.Int64) {
+	cmd := relayCommand(target, resolveScript(remotePath, name)+`; stat -c %s "$f`+relaySuffix+`" 2>/dev/null || echo 0`)
+	ticker := time.NewTicker(stagePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var out bytes.Buffer
+			if err := t.runRemote(ctx, cmd, nil, &out); err != nil {
+				continue
+			}
+			if n, err := strconv.ParseInt(strings.TrimSpace(out.String()), 10, 64); err == nil && n > delivered.Load() {
+				delivered.Store(n)
+			}
+		}
+	}
+}
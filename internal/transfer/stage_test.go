@@ -0,0 +1,87 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestUploadStaged(t *testing.T) {
+	hopsLog := fakeSSH(t)
+	scp := &SCPTransfer{run: localShell, logger: log.New(io.Discard, "", 0)}
+	target := []*types.Hop{{Host: "target", User: "deploy"}}
+
+	local := filepath.Join(t.TempDir(), "app.bin")
+	data := bytes.Repeat([]byte("stage\n"), 100000)
+	if err := os.WriteFile(local, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	remote := t.TempDir()
+	stageDir := filepath.Join(t.TempDir(), "stage")
+
+	// 一份过期的残留暂存在中转前被清理
+	stale := filepath.Join(stageDir, "stale")
+	os.MkdirAll(stale, 0755)
+	old := time.Now().Add(-2 * DefaultStagingMaxAge)
+	os.Chtimes(stale, old, old)
+
+	progress := make(chan *types.TransferProgress, 1000)
+	opts := StageOptions{Dir: stageDir, Quota: int64(len(data)) * 2}
+	if err := scp.UploadStaged(context.Background(), local, remote, target, opts, progress); err != nil {
+		t.Fatalf("UploadStaged: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(remote, "app.bin")); !bytes.Equal(got, data) {
+		t.Errorf("uploaded %d of %d bytes", len(got), len(data))
+	}
+	// 只有推送阶段经网关登录目标，暂存目录在结束后清空
+	if hops, _ := os.ReadFile(hopsLog); len(hops) == 0 || !bytes.HasPrefix(hops, []byte("deploy@target\n")) {
+		t.Errorf("hops = %q", hops)
+	}
+	if left, _ := os.ReadDir(stageDir); len(left) != 0 {
+		t.Errorf("staging left %v", left)
+	}
+	close(progress)
+	var last *types.TransferProgress
+	for p := range progress {
+		if p.Status == "running" && p.Phase != PhaseStaging && p.Phase != PhaseDelivering {
+			t.Errorf("progress without phase: %+v", p)
+		}
+		last = p
+	}
+	if last == nil || last.Status != "completed" || last.SentBytes != int64(len(data)) {
+		t.Errorf("last progress = %+v", last)
+	}
+
+	// 已用空间加上本次文件超过配额时拒绝，不登录目标
+	os.WriteFile(hopsLog, nil, 0644)
+	os.MkdirAll(filepath.Join(stageDir, "other"), 0755)
+	os.WriteFile(filepath.Join(stageDir, "other", "big"), data, 0644)
+	err := scp.UploadStaged(context.Background(), local, remote, target, StageOptions{Dir: stageDir, Quota: int64(len(data)) + 4096}, nil)
+	if !errors.Is(err, ErrStageQuota) {
+		t.Errorf("UploadStaged over quota = %v", err)
+	}
+	if hops, _ := os.ReadFile(hopsLog); len(hops) != 0 {
+		t.Errorf("logged in to %q over quota", hops)
+	}
+
+	// 推送失败时暂存同样被删除
+	err = scp.UploadStaged(context.Background(), local, remote, []*types.Hop{{Host: "down"}}, StageOptions{Dir: stageDir}, nil)
+	if err == nil {
+		t.Error("delivery through a down hop succeeded")
+	}
+	if left, _ := os.ReadDir(stageDir); len(left) != 1 || left[0].Name() != "other" {
+		t.Errorf("staging after failure = %v", left)
+	}
+
+	if err := scp.UploadStaged(context.Background(), local, remote, nil, opts, nil); err == nil {
+		t.Error("staged upload without a hop behind the gateway succeeded")
+	}
+}
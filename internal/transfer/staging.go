@@ -0,0 +1,213 @@
+package transfer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// stagingPrefix 暂存目录名前缀，清理时只处理带此前缀的目录
+	stagingPrefix = "gmssh-upload-"
+
+	// DefaultStagingMaxAge 暂存目录默认最长保留时间
+	DefaultStagingMaxAge = 24 * time.Hour
+	// DefaultStagingCleanupInterval 默认清理间隔
+	DefaultStagingCleanupInterval = time.Hour
+)
+
+// Staging 上传暂存区管理器
+// 浏览器上传的文件先落盘到暂存目录，再经 SSH 链转发到目标主机
+type Staging struct {
+	dir    string
+	maxAge time.Duration
+
+	// 正在使用的暂存目录，清理时跳过
+	active map[string]time.Time
+	mu     sync.Mutex
+}
+
+// StagingUsage 暂存区使用情况
+type StagingUsage struct {
+	Dir         string    `json:"dir"`
+	TotalBytes  int64     `json:"total_bytes"`
+	DirCount    int       `json:"dir_count"`
+	ActiveCount int       `json:"active_count"`
+	Oldest      time.Time `json:"oldest,omitempty"`
+	FreeBytes   int64     `json:"free_bytes"` // -1 表示平台不支持
+	MaxAge      string    `json:"max_age"`
+}
+
+// NewStaging 创建暂存区管理器，dir 为空时使用系统临时目录
+func NewStaging(dir string, maxAge time.Duration) (*Staging, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	dir = expandHome(dir)
+	if maxAge <= 0 {
+		maxAge = DefaultStagingMaxAge
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create staging dir %s: %w", dir, err)
+	}
+
+	return &Staging{
+		dir:    dir,
+		maxAge: maxAge,
+		active: make(map[string]time.Time),
+	}, nil
+}
+
+// Dir 返回暂存根目录
+func (s *Staging) Dir() string {
+	return s.dir
+}
+
+// Create 创建一个新的暂存目录并标记为使用中
+func (s *Staging) Create() (string, error) {
+	dir, err := os.MkdirTemp(s.dir, stagingPrefix+"*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging dir: %w", err)
+	}
+
+	s.mu.Lock()
+	s.active[dir] = time.Now()
+	s.mu.Unlock()
+
+	return dir, nil
+}
+
+// Remove 删除暂存目录并取消使用中标记
+func (s *Staging) Remove(dir string) error {
+	s.mu.Lock()
+	delete(s.active, dir)
+	s.mu.Unlock()
+
+	if !s.owns(dir) {
+		return fmt.Errorf("refusing to remove %s: not a staging dir", dir)
+	}
+	return os.RemoveAll(dir)
+}
+
+// Release 取消使用中标记但保留目录，超过最长保留时间后由 Cleanup 删除
+func (s *Staging) Release(dir string) {
+	s.mu.Lock()
+	delete(s.active, dir)
+	s.mu.Unlock()
+}
+
+// owns 检查路径是否为本暂存区创建的目录，防止误删
+func (s *Staging) owns(dir string) bool {
+	return filepath.Dir(dir) == filepath.Clean(s.dir) &&
+		strings.HasPrefix(filepath.Base(dir), stagingPrefix)
+}
+
+// Cleanup 删除超过最长保留时间且不在使用中的暂存目录，返回删除数量
+func (s *Staging) Cleanup() (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read staging dir: %w", err)
+	}
+
+	s.mu.Lock()
+	active := make(map[string]bool, len(s.active))
+	for dir := range s.active {
+		active[dir] = true
+	}
+	s.mu.Unlock()
+
+	removed := 0
+	cutoff := time.Now().Add(-s.maxAge)
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), stagingPrefix) {
+			continue
+		}
+		path := filepath.Join(s.dir, entry.Name())
+		if active[path] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("[Staging] Failed to remove %s: %v", path, err)
+			continue
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		log.Printf("[Staging] Removed %d aged staging dir(s) from %s", removed, s.dir)
+	}
+	return removed, nil
+}
+
+// Usage 统计暂存区占用
+func (s *Staging) Usage() (*StagingUsage, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read staging dir: %w", err)
+	}
+
+	usage := &StagingUsage{
+		Dir:       s.dir,
+		FreeBytes: freeBytes(s.dir),
+		MaxAge:    s.maxAge.String(),
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), stagingPrefix) {
+			continue
+		}
+		usage.DirCount++
+
+		if info, err := entry.Info(); err == nil {
+			if usage.Oldest.IsZero() || info.ModTime().Before(usage.Oldest) {
+				usage.Oldest = info.ModTime()
+			}
+		}
+
+		filepath.WalkDir(filepath.Join(s.dir, entry.Name()), func(_ string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				usage.TotalBytes += info.Size()
+			}
+			return nil
+		})
+	}
+
+	s.mu.Lock()
+	usage.ActiveCount = len(s.active)
+	s.mu.Unlock()
+
+	return usage, nil
+}
+
+// SafeJoin 将上传文件的相对路径拼接到暂存目录下，拒绝越界路径
+func SafeJoin(dir, name string) (string, error) {
+	name = filepath.FromSlash(name)
+	cleaned := filepath.Clean(name)
+	if cleaned == "." || filepath.IsAbs(cleaned) || cleaned == ".." ||
+		strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid file name: %q", name)
+	}
+	return filepath.Join(dir, cleaned), nil
+}
+
+// expandHome 展开路径中的 ~
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package transfer
+
+// freeBytes 非 Unix 平台不统计可用空间
+func freeBytes(dir string) int64 {
+	return -1
+}
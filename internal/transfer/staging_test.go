@@ -0,0 +1,119 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStagingCreateAndRemove(t *testing.T) {
+	staging, err := NewStaging(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("NewStaging failed: %v", err)
+	}
+
+	dir, err := staging.Create()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if filepath.Dir(dir) != staging.Dir() {
+		t.Errorf("staging dir %s not under %s", dir, staging.Dir())
+	}
+
+	usage, err := staging.Usage()
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	if usage.DirCount != 1 || usage.ActiveCount != 1 {
+		t.Errorf("expected 1 dir / 1 active, got %d / %d", usage.DirCount, usage.ActiveCount)
+	}
+
+	if err := staging.Remove(dir); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed", dir)
+	}
+}
+
+func TestStagingRemoveRefusesForeignDir(t *testing.T) {
+	root := t.TempDir()
+	staging, err := NewStaging(root, time.Hour)
+	if err != nil {
+		t.Fatalf("NewStaging failed: %v", err)
+	}
+
+	if err := staging.Remove(root); err == nil {
+		t.Error("expected Remove to refuse the staging root itself")
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("staging root should still exist: %v", err)
+	}
+}
+
+func TestStagingCleanup(t *testing.T) {
+	staging, err := NewStaging(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("NewStaging failed: %v", err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+
+	// 过期且未使用：应被清理
+	aged, _ := staging.Create()
+	os.WriteFile(filepath.Join(aged, "a.bin"), make([]byte, 128), 0644)
+	staging.Release(aged)
+	os.Chtimes(aged, old, old)
+
+	// 过期但仍在使用：应保留
+	busy, _ := staging.Create()
+	os.Chtimes(busy, old, old)
+
+	// 新目录：应保留
+	fresh, _ := staging.Create()
+	staging.Release(fresh)
+
+	// 非暂存目录：不处理
+	other := filepath.Join(staging.Dir(), "unrelated")
+	os.Mkdir(other, 0755)
+	os.Chtimes(other, old, old)
+
+	removed, err := staging.Cleanup()
+	if err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 removed dir, got %d", removed)
+	}
+
+	for path, want := range map[string]bool{aged: false, busy: true, fresh: true, other: true} {
+		_, err := os.Stat(path)
+		if exists := err == nil; exists != want {
+			t.Errorf("%s exists=%v, want %v", filepath.Base(path), exists, want)
+		}
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"file.txt", false},
+		{"dir/sub/file.txt", false},
+		{"../escape.txt", true},
+		{"dir/../../escape.txt", true},
+		{"/etc/passwd", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SafeJoin("/staging", tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SafeJoin(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package transfer
+
+import "syscall"
+
+// freeBytes 返回目录所在文件系统的可用空间
+func freeBytes(dir string) int64 {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return -1
+	}
+	return int64(st.Bavail) * int64(st.Bsize)
+}
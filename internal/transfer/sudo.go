@@ -0,0 +1,120 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/luobobo896/HSSH/internal/terminal"
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// ErrNotWritable 目标路径对登录用户不可写，且没有为该服务器启用 upload.sudo
+var ErrNotWritable = errors.New("target is not writable by the login user")
+
+// SudoOptions 目标不可写时的提权写入：先上传到 TempDir 中的临时文件，再执行 Command 移动到目标
+type SudoOptions struct {
+	Command string // 命令模板，{src}、{dst} 替换为转义后的临时文件和目标文件
+	TempDir string
+	// Password 返回写入命令标准输入的 sudo 密码，nil 时不提供；只在第一次需要时调用
+	Password func() (string, error)
+}
+
+// SetSudo 设置目标不可写时的提权写入，nil 时目标不可写直接返回 ErrNotWritable
+func (t *SCPTransfer) SetSudo(opts *SudoOptions) {
+	t.sudo = opts
+}
+
+// SudoFor 按 upload.sudo 生成上传到 hop 的提权写入选项，未启用或不适用于 hop 时返回 nil。
+// prompt 用于 password: prompt，为 nil 时（gmssh web）该方式不可用
+func SudoFor(cfg *types.SudoUpload, hop *types.Hop, prompt func(hop *types.Hop) (string, error)) *SudoOptions {
+	if !cfg.Applies(hop) {
+		return nil
+	}
+	opts := &SudoOptions{Command: cfg.CommandOrDefault(), TempDir: cfg.TempDirOrDefault()}
+	switch cfg.PasswordPolicy() {
+	case types.SudoPasswordLogin:
+		opts.Password = func() (string, error) {
+			if hop.AuthType != types.AuthPassword || hop.Password == "" {
+				return "", fmt.Errorf("upload.sudo password 'login' needs a saved login password for %s", hop.Name)
+			}
+			return hop.Password, nil
+		}
+	case types.SudoPasswordPrompt:
+		// 目录上传只询问一次
+		var once sync.Once
+		var password string
+		var err error
+		opts.Password = func() (string, error) {
+			once.Do(func() {
+				if prompt == nil {
+					err = fmt.Errorf("upload.sudo password 'prompt' needs an interactive terminal")
+					return
+				}
+				password, err = prompt(hop)
+			})
+			return password, err
+		}
+	}
+	return opts
+}
+
+// writableCommand 输出 yes 或 no：文件存在时看文件本身，否则看所在目录（不存在的目录视为不可写）
+func writableCommand(remoteFile string) string {
+	return "f=" + terminal.ShellQuote(remoteFile) +
+		`; if [ -e "$f" ]; then [ -w "$f" ]; else [ -w "$(dirname "$f")" ]; fi && echo yes || echo no`
+}
+
+// remoteWritable 登录用户能否写入 remoteFile；无法判断时返回错误，调用方按可写处理
+func (t *SCPTransfer) remoteWritable(ctx context.Context, remoteFile string) (bool, error) {
+	var out bytes.Buffer
+	if err := t.runRemote(ctx, writableCommand(remoteFile), nil, &out); err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out.String()) == "yes", nil
+}
+
+// sudoCommand 展开移动命令模板
+func sudoCommand(template, src, dst string) string {
+	return strings.NewReplacer("{src}", terminal.ShellQuote(src), "{dst}", terminal.ShellQuote(dst)).Replace(template)
+}
+
+// uploadPrivileged 把 file 上传到远端临时文件，再用提权命令移动到 remoteFile；临时文件在结束时删除。
+// 不续传，也不备份被覆盖的文件（备份需要写入目标目录）
+func (t *SCPTransfer) uploadPrivileged(ctx context.Context, file *os.File, remoteFile string, report func(int64)) error {
+	var password string
+	if t.sudo.Password != nil {
+		var err error
+		if password, err = t.sudo.Password(); err != nil {
+			return err
+		}
+	}
+
+	var out bytes.Buffer
+	template := strings.TrimSuffix(t.sudo.TempDir, "/") + "/.gmssh-upload.XXXXXX"
+	if err := t.runRemote(ctx, "mktemp "+terminal.ShellQuote(template), nil, &out); err != nil {
+		return fmt.Errorf("failed to create remote temp file: %w", err)
+	}
+	tmp := strings.TrimSpace(out.String())
+	defer t.runRemote(context.WithoutCancel(ctx), "rm -f "+terminal.ShellQuote(tmp), nil, nil)
+
+	t.logger.Printf("[SCP] %s is not writable, uploading to %s for a privileged move", remoteFile, tmp)
+	if err := t.runRemote(ctx, "cat > "+terminal.ShellQuote(tmp), &progressReader{r: file, report: report}, nil); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", tmp, err)
+	}
+
+	var stdin io.Reader
+	if password != "" {
+		stdin = strings.NewReader(password + "\n")
+	}
+	if err := t.runRemote(ctx, sudoCommand(t.sudo.Command, tmp, remoteFile), stdin, nil); err != nil {
+		return fmt.Errorf("privileged move to %s failed: %w", remoteFile, err)
+	}
+	t.logger.Printf("[SCP] Installed %s with the privileged command", remoteFile)
+	return nil
+}
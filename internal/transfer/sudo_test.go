@@ -0,0 +1,107 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestUploadSudo(t *testing.T) {
+	scp := connectTestChain(t)
+	local := t.TempDir()
+	remote := t.TempDir()
+	tmpDir := t.TempDir()
+
+	data := bytes.Repeat([]byte("release\n"), 1024)
+	file := filepath.Join(local, "app.bin")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 测试以 root 运行，[ -w ] 总是成立；上级路径是普通文件时目标目录无法创建，视为不可写
+	blocker := filepath.Join(remote, "blocker")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(blocker, "sub", "app.bin")
+
+	ctx := context.Background()
+	if err := scp.UploadContext(ctx, file, target, nil); !errors.Is(err, ErrNotWritable) {
+		t.Fatalf("upload without sudo: got %v, want ErrNotWritable", err)
+	}
+
+	// 模拟 sudo：从标准输入读取密码，校验后移走阻挡的文件再安装
+	command := `sh -c 'read pw; [ "$pw" = s3cret ] || exit 1; rm -f ` + blocker + `; install -D -m 644 "$0" "$1"' {src} {dst}`
+	password := "wrong"
+	scp.SetSudo(&SudoOptions{
+		Command:  command,
+		TempDir:  tmpDir,
+		Password: func() (string, error) { return password, nil },
+	})
+	if err := scp.UploadContext(ctx, file, target, nil); err == nil || !strings.Contains(err.Error(), "privileged move") {
+		t.Fatalf("wrong password: got %v", err)
+	}
+
+	password = "s3cret"
+	if err := scp.UploadContext(ctx, file, target, nil); err != nil {
+		t.Fatalf("upload with sudo: %v", err)
+	}
+	if got, _ := os.ReadFile(target); !bytes.Equal(got, data) {
+		t.Errorf("installed file differs (%d of %d bytes)", len(got), len(data))
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+}
+
+func TestSudoFor(t *testing.T) {
+	web := &types.Hop{ID: "hop-web", Name: "web-1", Tags: []string{"prod"}, AuthType: types.AuthPassword, Password: "login-pw"}
+	db := &types.Hop{ID: "hop-db", Name: "db-1", AuthType: types.AuthKey}
+
+	if SudoFor(&types.SudoUpload{}, web, nil) != nil {
+		t.Error("disabled sudo should give nil options")
+	}
+	cfg := &types.SudoUpload{Enabled: true, Servers: []string{"prod"}}
+	if SudoFor(cfg, db, nil) != nil {
+		t.Error("sudo should only apply to the listed servers")
+	}
+	opts := SudoFor(cfg, web, nil)
+	if opts == nil || opts.Command != types.DefaultSudoCommand || opts.TempDir != types.DefaultSudoTempDir || opts.Password != nil {
+		t.Fatalf("default options = %+v", opts)
+	}
+
+	cfg = &types.SudoUpload{Enabled: true, Password: types.SudoPasswordLogin}
+	opts = SudoFor(cfg, web, nil)
+	if opts.Command != types.DefaultSudoPasswordCommand {
+		t.Errorf("command with password = %q", opts.Command)
+	}
+	if pw, err := opts.Password(); err != nil || pw != "login-pw" {
+		t.Errorf("login password = %q, %v", pw, err)
+	}
+	if _, err := SudoFor(cfg, db, nil).Password(); err == nil {
+		t.Error("login password should fail for key-authenticated servers")
+	}
+
+	cfg = &types.SudoUpload{Enabled: true, Password: types.SudoPasswordPrompt}
+	if _, err := SudoFor(cfg, web, nil).Password(); err == nil {
+		t.Error("prompt without a terminal should fail")
+	}
+	prompts := 0
+	opts = SudoFor(cfg, web, func(*types.Hop) (string, error) {
+		prompts++
+		return "typed", nil
+	})
+	for i := 0; i < 3; i++ {
+		if pw, _ := opts.Password(); pw != "typed" {
+			t.Errorf("prompted password = %q", pw)
+		}
+	}
+	if prompts != 1 {
+		t.Errorf("prompted %d times, want once per upload", prompts)
+	}
+}
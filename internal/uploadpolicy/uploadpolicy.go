@@ -0,0 +1,133 @@
+// Package uploadpolicy 在连接目标之前检查将要上传的本地文件：单文件大小、禁止的扩展名和本地扫描命令（如 clamscan），
+// 供合规要求较高的团队在文件进入生产环境之前拦截。违反策略时返回 *Violation，由调用方拒绝传输并写入审计日志
+package uploadpolicy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// 违反的检查
+const (
+	RuleMaxSize   = "max_size"
+	RuleExtension = "extension"
+	RuleCommand   = "command"
+)
+
+// AuditAction 违反策略时写入审计日志的操作
+const AuditAction = "policy.violation"
+
+// maxCommandOutput 错误信息中保留的扫描命令输出（末尾）字节数
+const maxCommandOutput = 512
+
+// Violation 违反上传策略
+type Violation struct {
+	Rule   string // RuleMaxSize、RuleExtension 或 RuleCommand
+	File   string // 违反策略的文件（目录上传时为相对路径），扫描命令失败时为被扫描的文件或目录名
+	Detail string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("upload blocked by policy (%s): %s: %s", v.Rule, v.File, v.Detail)
+}
+
+// Check 检查上传到 hop 上 remotePath 的本地文件或目录 localPath。
+// 目录中每个文件按 remotePath 加相对路径匹配规则，单个文件按 remotePath 本身匹配（可以是目标目录或文件）；
+// 大小和扩展名都通过后才运行扫描命令，localPath 作为命令的最后一个参数
+func Check(ctx context.Context, policy *types.UploadPolicy, hop *types.Hop, localPath, remotePath string) error {
+	if !policy.Enabled() {
+		return nil
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		err = filepath.WalkDir(localPath, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			fileInfo, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(localPath, file)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			return checkFile(policy, hop, rel, fileInfo.Size(), path.Join(remotePath, rel))
+		})
+	} else {
+		err = checkFile(policy, hop, info.Name(), info.Size(), remotePath)
+	}
+	if err != nil {
+		return err
+	}
+	return runCommand(ctx, policy, localPath)
+}
+
+// checkFile 检查一个文件的扩展名和大小
+func checkFile(policy *types.UploadPolicy, hop *types.Hop, name string, size int64, remotePath string) error {
+	maxSize, denied := policy.Limits(hop, remotePath)
+	lower := strings.ToLower(path.Base(name))
+	for _, ext := range denied {
+		if strings.HasSuffix(lower, ext) {
+			return &Violation{Rule: RuleExtension, File: name, Detail: fmt.Sprintf("%s files may not be uploaded to %s", ext, destination(hop, remotePath))}
+		}
+	}
+	if maxSize > 0 && size > maxSize {
+		return &Violation{Rule: RuleMaxSize, File: name, Detail: fmt.Sprintf("%d bytes exceeds the %d byte limit for %s", size, maxSize, destination(hop, remotePath))}
+	}
+	return nil
+}
+
+func destination(hop *types.Hop, remotePath string) string {
+	if hop == nil {
+		return remotePath
+	}
+	return hop.Name + ":" + remotePath
+}
+
+// runCommand 运行扫描命令，退出码非 0、无法启动或超时都视为违反策略
+func runCommand(ctx context.Context, policy *types.UploadPolicy, localPath string) error {
+	if len(policy.Command) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, policy.CommandTimeoutOrDefault())
+	defer cancel()
+	args := append(append([]string{}, policy.Command[1:]...), localPath)
+	cmd := exec.CommandContext(ctx, policy.Command[0], args...)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+
+	var detail string
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		detail = fmt.Sprintf("%s did not finish within %s", policy.Command[0], policy.CommandTimeoutOrDefault())
+	case errors.As(err, &exitErr):
+		detail = fmt.Sprintf("%s exited with status %d", policy.Command[0], exitErr.ExitCode())
+	default:
+		detail = fmt.Sprintf("failed to run %s: %v", policy.Command[0], err)
+	}
+	if out = bytes.TrimSpace(out); len(out) > 0 {
+		if len(out) > maxCommandOutput {
+			out = out[len(out)-maxCommandOutput:]
+		}
+		detail += ": " + string(out)
+	}
+	return &Violation{Rule: RuleCommand, File: filepath.Base(localPath), Detail: detail}
+}
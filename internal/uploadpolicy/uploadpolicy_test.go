@@ -0,0 +1,119 @@
+package uploadpolicy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func violationRule(err error) string {
+	var v *Violation
+	if errors.As(err, &v) {
+		return v.Rule
+	}
+	return ""
+}
+
+func TestCheckSizeAndExtension(t *testing.T) {
+	prod := &types.Hop{ID: "hop-prod", Name: "prod-1"}
+	dev := &types.Hop{ID: "hop-dev", Name: "dev-1"}
+	policy := &types.UploadPolicy{
+		DeniedExtensions: []string{"EXE"},
+		Rules: []types.UploadPolicyRule{
+			{Server: "prod-1", MaxSize: 100},
+			{Server: "hop-prod", Dir: "/srv/releases", MaxSize: 1000, DeniedExtensions: []string{".tar.gz"}},
+		},
+	}
+	dir := t.TempDir()
+	small := filepath.Join(dir, "app.jar")
+	writeFile(t, small, 50)
+	big := filepath.Join(dir, "data.bin")
+	writeFile(t, big, 500)
+	exe := filepath.Join(dir, "Setup.Exe")
+	writeFile(t, exe, 10)
+	tarball := filepath.Join(dir, "site.tar.gz")
+	writeFile(t, tarball, 10)
+
+	ctx := context.Background()
+	tests := []struct {
+		name, file, remote string
+		hop                *types.Hop
+		rule               string
+	}{
+		{"small file", small, "/srv/app", prod, ""},
+		{"smallest matching limit wins", big, "/srv/releases/v2", prod, RuleMaxSize},
+		{"limit only for prod", big, "/srv/releases", dev, ""},
+		{"global extension, case-insensitive", exe, "/tmp", dev, RuleExtension},
+		{"extension denied only under the dir", tarball, "/srv/releases", prod, RuleExtension},
+		{"extension allowed elsewhere", tarball, "/srv/other", prod, ""},
+	}
+	for _, tt := range tests {
+		if got := violationRule(Check(ctx, policy, tt.hop, tt.file, tt.remote)); got != tt.rule {
+			t.Errorf("%s: violation %q, want %q", tt.name, got, tt.rule)
+		}
+	}
+
+	// 目录上传按每个文件的相对路径检查
+	upload := filepath.Join(t.TempDir(), "site")
+	writeFile(t, filepath.Join(upload, "index.html"), 10)
+	writeFile(t, filepath.Join(upload, "bin", "tool.exe"), 10)
+	err := Check(ctx, policy, dev, upload, "/var/www")
+	var v *Violation
+	if !errors.As(err, &v) || v.File != "bin/tool.exe" || !strings.Contains(v.Error(), "dev-1:/var/www/bin/tool.exe") {
+		t.Errorf("directory upload: got %v", err)
+	}
+
+	if err := Check(ctx, &types.UploadPolicy{}, prod, big, "/srv"); err != nil {
+		t.Errorf("empty policy: %v", err)
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	file := filepath.Join(t.TempDir(), "report.xlsx")
+	writeFile(t, file, 10)
+	ctx := context.Background()
+
+	// 模拟 clamscan：文件名含 infected 时报告病毒并以 1 退出
+	scan := []string{"sh", "-c", `case "$1" in *infected*) echo "$1: Eicar-Signature FOUND"; exit 1;; esac`, "scan"}
+	policy := &types.UploadPolicy{Command: scan}
+	if err := Check(ctx, policy, nil, file, "/srv"); err != nil {
+		t.Fatalf("clean file: %v", err)
+	}
+	infected := filepath.Join(t.TempDir(), "infected.doc")
+	writeFile(t, infected, 10)
+	err := Check(ctx, policy, nil, infected, "/srv")
+	if violationRule(err) != RuleCommand || !strings.Contains(err.Error(), "exited with status 1") || !strings.Contains(err.Error(), "Eicar-Signature FOUND") {
+		t.Errorf("infected file: got %v", err)
+	}
+
+	// 大小检查先于扫描命令：大小不合规时不运行命令
+	policy.Rules = []types.UploadPolicyRule{{MaxSize: 1}}
+	if rule := violationRule(Check(ctx, policy, nil, infected, "/srv")); rule != RuleMaxSize {
+		t.Errorf("size check should run before the command, got %q", rule)
+	}
+
+	// 无法启动的命令同样拒绝
+	missing := &types.UploadPolicy{Command: []string{filepath.Join(t.TempDir(), "no-such-scanner")}}
+	if rule := violationRule(Check(ctx, missing, nil, file, "/srv")); rule != RuleCommand {
+		t.Errorf("missing scanner: got %q", rule)
+	}
+}
@@ -0,0 +1,236 @@
+// Package usage 按天汇总每台服务器的使用量：打开的终端会话、完成的上传、经过的字节数和隧道运行时长。
+// 一次使用计入链上的每一跳（包括网关），据此可以看出哪些网关承担了主要负载。
+// 数据保存在配置目录下的 usage.json，由 gmssh web 写入，gmssh status --usage 读取
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+// FileName 配置目录下的使用量文件
+const FileName = "usage.json"
+
+// RetentionDays 保留的天数，更早的数据在保存时删除
+const RetentionDays = 90
+
+// dateLayout 按本地时间的日期分桶
+const dateLayout = "2006-01-02"
+
+// Counters 一台服务器在一段时间内的使用量
+type Counters struct {
+	Sessions      int64 `json:"sessions"`       // 打开的终端会话
+	Transfers     int64 `json:"transfers"`      // 完成的上传
+	Bytes         int64 `json:"bytes"`          // 终端、上传和隧道经过的字节数
+	TunnelSeconds int64 `json:"tunnel_seconds"` // 代理和 Portal 映射的运行时长
+}
+
+// add 累加 o
+func (c *Counters) add(o Counters) {
+	c.Sessions += o.Sessions
+	c.Transfers += o.Transfers
+	c.Bytes += o.Bytes
+	c.TunnelSeconds += o.TunnelSeconds
+}
+
+// TunnelHours 隧道运行的小时数
+func (c Counters) TunnelHours() float64 {
+	return float64(c.TunnelSeconds) / 3600
+}
+
+// Day 一天的使用量
+type Day struct {
+	Date string `json:"date"` // 本地日期 YYYY-MM-DD
+	Counters
+}
+
+// Report 一台服务器 since 以来的使用量
+type Report struct {
+	ServerID    string    `json:"server_id"`
+	Since       time.Time `json:"since"`
+	Days        []Day     `json:"days"` // 按日期排序，没有使用的日期不列出
+	Total       Counters  `json:"total"`
+	TunnelHours float64   `json:"tunnel_hours"`
+}
+
+// Store 使用量，按日期和服务器 ID 汇总
+type Store struct {
+	path  string
+	mu    sync.Mutex
+	days  map[string]map[string]*Counters // 日期 -> 服务器 ID -> 使用量
+	dirty bool
+}
+
+// Open 读取使用量文件，不存在时返回空的 Store
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, days: make(map[string]map[string]*Counters)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.days); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Add 把 delta 计入 t 当天的每个服务器
+func (s *Store) Add(serverIDs []string, delta Counters, t time.Time) {
+	if len(serverIDs) == 0 || delta == (Counters{}) {
+		return
+	}
+	date := t.Format(dateLayout)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day := s.days[date]
+	if day == nil {
+		day = make(map[string]*Counters)
+		s.days[date] = day
+	}
+	for _, id := range serverIDs {
+		c := day[id]
+		if c == nil {
+			c = &Counters{}
+			day[id] = c
+		}
+		c.add(delta)
+	}
+	s.dirty = true
+}
+
+// Report 返回服务器 since 当天及以后的使用量
+func (s *Store) Report(serverID string, since time.Time) Report {
+	report := Report{ServerID: serverID, Since: since, Days: []Day{}}
+	from := since.Format(dateLayout)
+	s.mu.Lock()
+	for date, day := range s.days {
+		if c := day[serverID]; c != nil && date >= from {
+			report.Days = append(report.Days, Day{Date: date, Counters: *c})
+			report.Total.add(*c)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Date < report.Days[j].Date })
+	report.TunnelHours = report.Total.TunnelHours()
+	return report
+}
+
+// Totals 返回 since 当天及以后每台服务器的总使用量
+func (s *Store) Totals(since time.Time) map[string]Counters {
+	totals := make(map[string]Counters)
+	from := since.Format(dateLayout)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for date, day := range s.days {
+		if date < from {
+			continue
+		}
+		for id, c := range day {
+			total := totals[id]
+			total.add(*c)
+			totals[id] = total
+		}
+	}
+	return totals
+}
+
+// ServerDay 一台服务器一天的使用量
+type ServerDay struct {
+	Date     string `json:"date"`
+	ServerID string `json:"server_id"`
+	Counters
+}
+
+// Rows 返回 since 当天到 until 当天（含）每台服务器每天的使用量，按日期和服务器 ID 排序；until 为零值时不限
+func (s *Store) Rows(since, until time.Time) []ServerDay {
+	from := since.Format(dateLayout)
+	to := ""
+	if !until.IsZero() {
+		to = until.Format(dateLayout)
+	}
+	var rows []ServerDay
+	s.mu.Lock()
+	for date, day := range s.days {
+		if date < from || (to != "" && date > to) {
+			continue
+		}
+		for id, c := range day {
+			rows = append(rows, ServerDay{Date: date, ServerID: id, Counters: *c})
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Date != rows[j].Date {
+			return rows[i].Date < rows[j].Date
+		}
+		return rows[i].ServerID < rows[j].ServerID
+	})
+	return rows
+}
+
+// Flush 有新数据时删除超过 RetentionDays 的日期并写回文件
+func (s *Store) Flush(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	oldest := now.AddDate(0, 0, -RetentionDays).Format(dateLayout)
+	for date := range s.days {
+		if date < oldest {
+			delete(s.days, date)
+		}
+	}
+	data, err := json.Marshal(s.days)
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再改名，进程中途退出不会留下写了一半的文件
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// ServerUsage 一台服务器的总使用量
+type ServerUsage struct {
+	ServerID string `json:"server_id"`
+	Server   string `json:"server"`
+	Counters
+	TunnelHours float64 `json:"tunnel_hours"`
+}
+
+// ByServer 把 Totals 的结果对应到配置中的服务器，按流量从大到小排序，已删除的服务器跳过
+func ByServer(cfg *types.Config, totals map[string]Counters) []ServerUsage {
+	list := make([]ServerUsage, 0, len(totals))
+	for id, c := range totals {
+		hop := cfg.GetHopByID(id)
+		if hop == nil {
+			continue
+		}
+		list = append(list, ServerUsage{ServerID: id, Server: hop.Name, Counters: c, TunnelHours: c.TunnelHours()})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Bytes != list[j].Bytes {
+			return list[i].Bytes > list[j].Bytes
+		}
+		return list[i].Server < list[j].Server
+	})
+	return list
+}
@@ -0,0 +1,55 @@
+package usage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luobobo896/HSSH/pkg/types"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	yesterday := now.AddDate(0, 0, -1)
+	// 经网关的会话同时计入网关和目标
+	store.Add([]string{"gw", "db"}, Counters{Sessions: 1, Bytes: 100}, yesterday)
+	store.Add([]string{"gw", "db"}, Counters{Sessions: 1, Bytes: 50}, now)
+	store.Add([]string{"gw", "web"}, Counters{TunnelSeconds: 5400, Bytes: 1000}, now)
+	store.Add([]string{"gw"}, Counters{Transfers: 1, Bytes: 10}, now.AddDate(0, 0, -RetentionDays-1))
+
+	report := store.Report("gw", yesterday)
+	if len(report.Days) != 2 || report.Days[0].Date != "2026-03-09" || report.Days[1].Sessions != 1 {
+		t.Fatalf("unexpected days: %+v", report.Days)
+	}
+	if report.Total != (Counters{Sessions: 2, Bytes: 1150, TunnelSeconds: 5400}) || report.TunnelHours != 1.5 {
+		t.Errorf("unexpected total: %+v, %v hours", report.Total, report.TunnelHours)
+	}
+	if today := store.Report("db", now); today.Total.Sessions != 1 || len(today.Days) != 1 {
+		t.Errorf("report since today: %+v", today)
+	}
+
+	// 保存时删除超过保留期的数据，重新打开后其余数据不变
+	if err := store.Flush(now); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals := reopened.Totals(now.AddDate(0, 0, -RetentionDays-5))
+	if totals["gw"].Transfers != 0 || totals["gw"].Bytes != 1150 || totals["web"].Bytes != 1000 {
+		t.Errorf("unexpected totals after reopen: %+v", totals)
+	}
+
+	cfg := &types.Config{Hops: []*types.Hop{{ID: "gw", Name: "gateway"}, {ID: "web", Name: "web-1"}}}
+	list := ByServer(cfg, totals)
+	if len(list) != 2 || list[0].Server != "gateway" || list[1].Server != "web-1" {
+		t.Errorf("ByServer: %+v", list)
+	}
+}
@@ -21,6 +21,12 @@ type PortMapping struct {
 	Via        []string `json:"via" yaml:"via"`
 	Protocol   Protocol `json:"protocol" yaml:"protocol"`
 	Enabled    bool     `json:"enabled" yaml:"enabled"`
+	// Resolver 服务端解析 RemoteHost 的方式：system（默认）或 dns:<server>，结果按 TTL 缓存
+	Resolver string `json:"resolver,omitempty" yaml:"resolver,omitempty"`
+	// IdleTimeout 流在两个方向都没有数据超过该时间后由服务端关闭，为 0 时使用服务端默认值
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty" yaml:"idle_timeout,omitempty"`
+	// MaxLifetime 流的最长存活时间，到期即使仍有数据也关闭，为 0 时使用服务端默认值
+	MaxLifetime time.Duration `json:"max_lifetime,omitempty" yaml:"max_lifetime,omitempty"`
 }
 
 // PortalConfig portal 模块配置
@@ -42,6 +48,25 @@ type ServerConfig struct {
 	TLSCert    string        `json:"tls_cert" yaml:"tls_cert"`
 	TLSKey     string        `json:"tls_key" yaml:"tls_key"`
 	AuthTokens []TokenConfig `json:"auth_tokens" yaml:"auth_tokens"`
+	Cluster    ClusterConfig `json:"cluster,omitempty" yaml:"cluster,omitempty"`
+	// StreamIdleTimeout / StreamMaxLifetime 映射未设置时使用的流限制，为 0 时不限制
+	StreamIdleTimeout time.Duration `json:"stream_idle_timeout,omitempty" yaml:"stream_idle_timeout,omitempty"`
+	StreamMaxLifetime time.Duration `json:"stream_max_lifetime,omitempty" yaml:"stream_max_lifetime,omitempty"`
+}
+
+// ClusterConfig 多节点部署配置（VIP/DNS 后的两台 portal 服务端共享令牌和映射注册表）
+// 各节点需使用同一张证书，节点间同步时以证书指纹互相校验
+type ClusterConfig struct {
+	NodeID       string        `json:"node_id" yaml:"node_id"`
+	Peers        []string      `json:"peers" yaml:"peers"`   // 其他节点的 portal 地址
+	Secret       string        `json:"-" yaml:"secret"`      // 节点间同步认证
+	NextSecret   string        `json:"-" yaml:"next_secret"` // 轮换中的下一个密钥，与 Secret 同时有效
+	SyncInterval time.Duration `json:"sync_interval" yaml:"sync_interval"`
+}
+
+// Enabled 是否配置了对端节点
+func (c ClusterConfig) Enabled() bool {
+	return len(c.Peers) > 0
 }
 
 // TokenConfig Token 认证配置
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ConnString 解析后的连接串 [ssh://][user@]host[:port]
+type ConnString struct {
+	User string
+	Host string
+	Port int // 未指定时为 0
+}
+
+// ParseConnString 解析 user@host:2222 形式的连接串，IPv6 地址带端口时需写成 [addr]:port
+func ParseConnString(s string) (ConnString, error) {
+	var cs ConnString
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "ssh://")
+	rest = strings.TrimSuffix(rest, "/")
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		cs.User, rest = rest[:i], rest[i+1:]
+		if cs.User == "" {
+			return cs, fmt.Errorf("empty user in %q", s)
+		}
+	}
+
+	host, port, err := net.SplitHostPort(rest)
+	switch {
+	case err == nil:
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return cs, fmt.Errorf("invalid port in %q", s)
+		}
+		cs.Host, cs.Port = host, n
+	case strings.Count(rest, ":") > 1 && net.ParseIP(strings.Trim(rest, "[]")) != nil:
+		// 不带端口的 IPv6 地址
+		cs.Host = strings.Trim(rest, "[]")
+	case strings.Contains(rest, ":"):
+		return cs, fmt.Errorf("invalid address %q", s)
+	default:
+		cs.Host = rest
+	}
+	if cs.Host == "" || strings.ContainsAny(cs.Host, " /@") {
+		return cs, fmt.Errorf("invalid host in %q", s)
+	}
+	return cs, nil
+}
+
+// DefaultName 由主机生成服务器名称：域名取第一段，IP 地址保持原样
+func (cs ConnString) DefaultName() string {
+	if net.ParseIP(cs.Host) != nil {
+		return cs.Host
+	}
+	name, _, _ := strings.Cut(cs.Host, ".")
+	return name
+}
+
+// UniqueHopName 返回未被占用的服务器名称：base 已存在时依次尝试 base-2、base-3……
+func (c *Config) UniqueHopName(base string) string {
+	name := base
+	for i := 2; c.GetHopByName(name) != nil; i++ {
+		name = base + "-" + strconv.Itoa(i)
+	}
+	return name
+}
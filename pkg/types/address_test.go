@@ -0,0 +1,45 @@
+package types
+
+import "testing"
+
+func TestParseConnString(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ConnString
+		name    string
+		wantErr bool
+	}{
+		{"deploy@10.0.0.5:2222", ConnString{"deploy", "10.0.0.5", 2222}, "10.0.0.5", false},
+		{"root@db-1.internal.example.com", ConnString{"root", "db-1.internal.example.com", 0}, "db-1", false},
+		{"ssh://ops@gw.example.com:22", ConnString{"ops", "gw.example.com", 22}, "gw", false},
+		{"web-1", ConnString{"", "web-1", 0}, "web-1", false},
+		{"admin@[fd00::5]:2200", ConnString{"admin", "fd00::5", 2200}, "fd00::5", false},
+		{"admin@fd00::5", ConnString{"admin", "fd00::5", 0}, "fd00::5", false},
+		{"user@domain@host", ConnString{"user@domain", "host", 0}, "host", false},
+		{"root@host:0", ConnString{}, "", true},
+		{"root@host:ssh", ConnString{}, "", true},
+		{"@host", ConnString{}, "", true},
+		{"root@", ConnString{}, "", true},
+		{"host:22:33", ConnString{}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseConnString(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseConnString(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (got != tt.want || got.DefaultName() != tt.name) {
+			t.Errorf("ParseConnString(%q) = %+v (name %q), want %+v (name %q)", tt.in, got, got.DefaultName(), tt.want, tt.name)
+		}
+	}
+}
+
+func TestUniqueHopName(t *testing.T) {
+	cfg := &Config{Hops: []*Hop{{Name: "web"}, {Name: "web-2"}}}
+	if got := cfg.UniqueHopName("web"); got != "web-3" {
+		t.Errorf("UniqueHopName(web) = %q, want web-3", got)
+	}
+	if got := cfg.UniqueHopName("db"); got != "db" {
+		t.Errorf("UniqueHopName(db) = %q, want db", got)
+	}
+}
@@ -0,0 +1,24 @@
+package types
+
+import "slices"
+
+// AgentForwardingPolicy ssh-agent 转发策略：默认关闭。开启后，只有设置了 allow_agent_forwarding
+// 并且在 Servers 范围内的目标服务器上的会话才会转发本机的 ssh-agent
+type AgentForwardingPolicy struct {
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// Servers 只允许这些服务器（名称、ID 或标签），为空时允许所有设置了 allow_agent_forwarding 的服务器
+	Servers []string `json:"servers,omitempty" yaml:"servers,omitempty"`
+}
+
+// Allows 在目标服务器 hop 上打开的会话是否转发 ssh-agent
+func (p *AgentForwardingPolicy) Allows(hop *Hop) bool {
+	if !p.Enabled || hop == nil || !hop.AllowAgentForwarding {
+		return false
+	}
+	if len(p.Servers) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(p.Servers, func(name string) bool {
+		return name == hop.Name || name == hop.ID || hop.HasTag(name)
+	})
+}
@@ -0,0 +1,30 @@
+package types
+
+import "testing"
+
+func TestAgentForwardingAllows(t *testing.T) {
+	web := &Hop{ID: "h1", Name: "web", Tags: []string{"build"}, AllowAgentForwarding: true}
+	db := &Hop{ID: "h2", Name: "db", AllowAgentForwarding: true}
+	plain := &Hop{ID: "h3", Name: "plain", Tags: []string{"build"}}
+
+	tests := []struct {
+		name   string
+		policy AgentForwardingPolicy
+		hop    *Hop
+		want   bool
+	}{
+		{"disabled by default", AgentForwardingPolicy{}, web, false},
+		{"enabled for flagged servers", AgentForwardingPolicy{Enabled: true}, db, true},
+		{"server flag required", AgentForwardingPolicy{Enabled: true}, plain, false},
+		{"by tag", AgentForwardingPolicy{Enabled: true, Servers: []string{"build"}}, web, true},
+		{"by id", AgentForwardingPolicy{Enabled: true, Servers: []string{"h2"}}, db, true},
+		{"not listed", AgentForwardingPolicy{Enabled: true, Servers: []string{"build"}}, db, false},
+		{"tag without flag", AgentForwardingPolicy{Enabled: true, Servers: []string{"build"}}, plain, false},
+		{"nil hop", AgentForwardingPolicy{Enabled: true}, nil, false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Allows(tt.hop); got != tt.want {
+			t.Errorf("%s: Allows = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package types
+
+import (
+	"path"
+	"strings"
+)
+
+// BackupRule 上传覆盖 Dir 下（含子目录）的已有文件前，先把旧文件复制为 <name>.bak-<时间>，每个文件最多保留 Keep 个
+type BackupRule struct {
+	Dir  string `json:"dir" yaml:"dir"` // 远端绝对路径
+	Keep int    `json:"keep" yaml:"keep"`
+	// Server 只对该服务器（名称或 ID）生效，为空时对所有服务器生效
+	Server string `json:"server,omitempty" yaml:"server,omitempty"`
+}
+
+// BackupKeep 返回上传覆盖 hop 上的 remoteFile 前应保留的备份数：取 Dir 最长的匹配规则，没有匹配时为 0
+func (c *UploadConfig) BackupKeep(hop *Hop, remoteFile string) int {
+	remoteFile = path.Clean(remoteFile)
+	keep, matched := 0, -1
+	for _, rule := range c.Backups {
+		if rule.Server != "" && (hop == nil || (rule.Server != hop.Name && rule.Server != hop.ID)) {
+			continue
+		}
+		dir := path.Clean(rule.Dir)
+		if !path.IsAbs(dir) || len(dir) <= matched {
+			continue
+		}
+		if dir == "/" || strings.HasPrefix(remoteFile, dir+"/") {
+			keep, matched = rule.Keep, len(dir)
+		}
+	}
+	return max(keep, 0)
+}
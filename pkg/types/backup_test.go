@@ -0,0 +1,35 @@
+package types
+
+import "testing"
+
+func TestBackupKeep(t *testing.T) {
+	cfg := UploadConfig{Backups: []BackupRule{
+		{Dir: "/etc", Keep: 3},
+		{Dir: "/etc/nginx/", Keep: 10},
+		{Dir: "/srv/app", Keep: 5, Server: "web-1"},
+		{Dir: "relative", Keep: 9},
+	}}
+	web := &Hop{ID: "hop-1", Name: "web-1"}
+	db := &Hop{ID: "hop-2", Name: "db-1"}
+
+	tests := []struct {
+		hop  *Hop
+		file string
+		want int
+	}{
+		{web, "/etc/hosts", 3},
+		{web, "/etc/nginx/conf.d/site.conf", 10},
+		{web, "/etcetera/file", 0},
+		{web, "/etc", 0},
+		{web, "/srv/app/config.yml", 5},
+		{db, "/srv/app/config.yml", 0},
+		{&Hop{ID: "web-1"}, "/srv/app/config.yml", 5},
+		{web, "relative/file", 0},
+		{web, "/etc/../srv/app/x", 5},
+	}
+	for _, tt := range tests {
+		if got := cfg.BackupKeep(tt.hop, tt.file); got != tt.want {
+			t.Errorf("BackupKeep(%s, %q) = %d, want %d", tt.hop.Name, tt.file, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sshVersionPrefix SSH 2.0 版本串的固定前缀（RFC 4253 4.2）
+const sshVersionPrefix = "SSH-2.0-"
+
+// maxClientVersionLen 版本串的最大长度，RFC 4253 规定连同结尾的 CR LF 不超过 255 字节
+const maxClientVersionLen = 253
+
+// NormalizeClientVersion 校验并补全 SSH 客户端版本串：只写软件版本（如 OpenSSH_8.9p1）时补上 SSH-2.0- 前缀；
+// 空串表示使用默认版本串
+func NormalizeClientVersion(version string) (string, error) {
+	if version == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(version, "SSH-") {
+		version = sshVersionPrefix + version
+	}
+	if !strings.HasPrefix(version, sshVersionPrefix) || len(version) == len(sshVersionPrefix) {
+		return "", fmt.Errorf("invalid SSH client version %q: must be SSH-2.0-<software>", version)
+	}
+	if len(version) > maxClientVersionLen {
+		return "", fmt.Errorf("SSH client version is longer than %d bytes", maxClientVersionLen)
+	}
+	for _, r := range version {
+		if r < 0x20 || r > 0x7e {
+			return "", fmt.Errorf("invalid SSH client version %q: only printable ASCII is allowed", version)
+		}
+	}
+	return version, nil
+}
@@ -0,0 +1,21 @@
+package types
+
+import "testing"
+
+func TestNormalizeClientVersion(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                           "",
+		"OpenSSH_8.9p1":              "SSH-2.0-OpenSSH_8.9p1",
+		"SSH-2.0-PuTTY_Release_0.80": "SSH-2.0-PuTTY_Release_0.80",
+		"SSH-2.0-OpenSSH_7.4 RHEL":   "SSH-2.0-OpenSSH_7.4 RHEL",
+	} {
+		if got, err := NormalizeClientVersion(in); err != nil || got != want {
+			t.Errorf("NormalizeClientVersion(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"SSH-1.5-old", "SSH-2.0-", "OpenSSH\r\nx", "OpenSSH_é"} {
+		if _, err := NormalizeClientVersion(in); err == nil {
+			t.Errorf("NormalizeClientVersion(%q) succeeded", in)
+		}
+	}
+}
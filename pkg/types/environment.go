@@ -0,0 +1,33 @@
+package types
+
+import "slices"
+
+// 环境策略可要求确认的危险操作
+const (
+	OpUpload = "upload" // 上传或编辑文件，会覆盖远端已有文件
+	OpExec   = "exec"   // 在服务器上执行命令，如结束进程
+	OpDelete = "delete" // 删除服务器
+)
+
+// EnvironmentPolicy 一个环境标签的服务器上需要确认的操作
+type EnvironmentPolicy struct {
+	// Confirm 执行前须输入服务器名称确认的操作（OpUpload、OpExec、OpDelete），为空时都不需要确认
+	Confirm []string `json:"confirm" yaml:"confirm"`
+}
+
+// DefaultEnvironments 未在 environments 中配置的标签使用的策略：prod 上的上传、执行命令和删除都需要确认
+var DefaultEnvironments = map[string]EnvironmentPolicy{
+	"prod": {Confirm: []string{OpUpload, OpExec, OpDelete}},
+}
+
+// ConfirmRequired 按 hop 的环境标签判断 op 前是否需要确认；没有标签的服务器不需要
+func (c *Config) ConfirmRequired(hop *Hop, op string) bool {
+	if hop == nil || hop.Environment == "" {
+		return false
+	}
+	policy, ok := c.Environments[hop.Environment]
+	if !ok {
+		policy = DefaultEnvironments[hop.Environment]
+	}
+	return slices.Contains(policy.Confirm, op)
+}
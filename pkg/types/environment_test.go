@@ -0,0 +1,39 @@
+package types
+
+import "testing"
+
+func TestConfirmRequired(t *testing.T) {
+	prod := &Hop{Name: "db", Environment: "prod"}
+	staging := &Hop{Name: "web", Environment: "staging"}
+	plain := &Hop{Name: "dev"}
+
+	cfg := &Config{}
+	for _, tc := range []struct {
+		hop  *Hop
+		op   string
+		want bool
+	}{
+		{prod, OpUpload, true},
+		{prod, OpExec, true},
+		{prod, OpDelete, true},
+		{staging, OpDelete, false},
+		{plain, OpDelete, false},
+		{nil, OpDelete, false},
+	} {
+		if got := cfg.ConfirmRequired(tc.hop, tc.op); got != tc.want {
+			t.Errorf("default policy: ConfirmRequired(%v, %s) = %v", tc.hop, tc.op, got)
+		}
+	}
+
+	// 配置的策略替代默认策略，空列表关闭确认
+	cfg.Environments = map[string]EnvironmentPolicy{
+		"prod":    {},
+		"staging": {Confirm: []string{OpDelete}},
+	}
+	if cfg.ConfirmRequired(prod, OpUpload) {
+		t.Error("prod upload still needs confirmation after the policy was cleared")
+	}
+	if !cfg.ConfirmRequired(staging, OpDelete) || cfg.ConfirmRequired(staging, OpUpload) {
+		t.Error("staging policy not applied")
+	}
+}
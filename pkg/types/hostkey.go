@@ -0,0 +1,60 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 主机密钥校验策略（Hop.HostKeyPolicy）
+const (
+	// HostKeyTOFU 首次连接时把主机密钥记入 known_hosts，之后必须一致（默认）
+	HostKeyTOFU = "tofu"
+	// HostKeyStrict 只接受 known_hosts 中已有的密钥，新主机须先通过 gmssh hostkey accept 或 API 确认
+	HostKeyStrict = "strict"
+	// HostKeyOff 不校验主机密钥，只用于测试环境等频繁重装的服务器
+	HostKeyOff = "off"
+)
+
+// HostKeyPolicies 全部校验策略
+var HostKeyPolicies = []string{HostKeyTOFU, HostKeyStrict, HostKeyOff}
+
+// EffectiveHostKeyPolicy 实际使用的校验策略，未设置时为 HostKeyTOFU
+func (h *Hop) EffectiveHostKeyPolicy() string {
+	if h.HostKeyPolicy == "" {
+		return HostKeyTOFU
+	}
+	return h.HostKeyPolicy
+}
+
+// ValidateHostKeySettings 校验主机密钥策略和固定的主机密钥（authorized_keys 格式，如 ssh-ed25519 AAAA...）
+func ValidateHostKeySettings(policy, hostKey string) error {
+	switch policy {
+	case "", HostKeyTOFU, HostKeyStrict, HostKeyOff:
+	default:
+		return fmt.Errorf("unknown host key policy %q: must be one of %s", policy, strings.Join(HostKeyPolicies, ", "))
+	}
+	if hostKey == "" {
+		return nil
+	}
+	if _, err := ParseHostKey(hostKey); err != nil {
+		return err
+	}
+	if policy == HostKeyOff {
+		return fmt.Errorf("host key is pinned but host key policy is %q", HostKeyOff)
+	}
+	return nil
+}
+
+// ParseHostKey 解析 authorized_keys 格式的主机密钥
+func ParseHostKey(hostKey string) (ssh.PublicKey, error) {
+	key, _, _, rest, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host key: %v", err)
+	}
+	if strings.TrimSpace(string(rest)) != "" {
+		return nil, fmt.Errorf("invalid host key: only one key is allowed")
+	}
+	return key, nil
+}
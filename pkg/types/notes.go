@@ -0,0 +1,85 @@
+package types
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"strings"
+)
+
+// maxNoteLen 说明信息中单个字段的长度上限
+const maxNoteLen = 4096
+
+// HopNotes 服务器的说明信息，让服务器列表兼作轻量的资产清单（CMDB）
+type HopNotes struct {
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Owner       string `json:"owner,omitempty" yaml:"owner,omitempty"`       // 负责人或团队
+	Contact     string `json:"contact,omitempty" yaml:"contact,omitempty"`   // 联系方式：邮箱、电话、IM
+	Runbook     string `json:"runbook,omitempty" yaml:"runbook,omitempty"`   // 运维手册链接，http(s)
+	Location    string `json:"location,omitempty" yaml:"location,omitempty"` // 机房、机柜或虚拟机所在的宿主/集群
+	// Fields 其他自定义字段，如资产编号、合同到期日
+	Fields map[string]string `json:"fields,omitempty" yaml:"fields,omitempty"`
+}
+
+// Empty 是否没有任何内容
+func (n *HopNotes) Empty() bool {
+	return n == nil || n.Description == "" && n.Owner == "" && n.Contact == "" && n.Runbook == "" && n.Location == "" && len(n.Fields) == 0
+}
+
+// Equal 两份说明信息内容是否相同，nil 与空内容相同
+func (n *HopNotes) Equal(o *HopNotes) bool {
+	if n.Empty() || o.Empty() {
+		return n.Empty() && o.Empty()
+	}
+	return n.Description == o.Description && n.Owner == o.Owner && n.Contact == o.Contact &&
+		n.Runbook == o.Runbook && n.Location == o.Location && maps.Equal(n.Fields, o.Fields)
+}
+
+// Validate 校验字段长度和运维手册链接；nil 合法
+func (n *HopNotes) Validate() error {
+	if n == nil {
+		return nil
+	}
+	for name, value := range map[string]string{
+		"description": n.Description, "owner": n.Owner, "contact": n.Contact, "runbook": n.Runbook, "location": n.Location,
+	} {
+		if len(value) > maxNoteLen {
+			return fmt.Errorf("%s is longer than %d bytes", name, maxNoteLen)
+		}
+	}
+	if n.Runbook != "" {
+		u, err := url.Parse(n.Runbook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("runbook must be an http(s) URL, got %q", n.Runbook)
+		}
+	}
+	for key, value := range n.Fields {
+		if key == "" || len(key) > 64 {
+			return fmt.Errorf("invalid field name %q", key)
+		}
+		if len(value) > maxNoteLen {
+			return fmt.Errorf("field %s is longer than %d bytes", key, maxNoteLen)
+		}
+	}
+	return nil
+}
+
+// Matches 服务器是否匹配搜索词 q：不区分大小写地在名称、地址、用户、标签、环境和说明信息（含自定义字段的名称和值）中查找，
+// q 中以空格分隔的每个词都须匹配
+func (h *Hop) Matches(q string) bool {
+	fields := []string{h.Name, h.Host, h.User, h.Environment}
+	fields = append(fields, h.Tags...)
+	if n := h.Notes; n != nil {
+		fields = append(fields, n.Description, n.Owner, n.Contact, n.Runbook, n.Location)
+		for key, value := range n.Fields {
+			fields = append(fields, key, value)
+		}
+	}
+	text := strings.ToLower(strings.Join(fields, "\n"))
+	for _, word := range strings.Fields(strings.ToLower(q)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
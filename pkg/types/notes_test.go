@@ -0,0 +1,49 @@
+package types
+
+import "testing"
+
+func TestHopMatches(t *testing.T) {
+	hop := &Hop{
+		Name: "db-1", Host: "10.0.0.5", User: "root", Tags: []string{"mysql"}, Environment: "prod",
+		Notes: &HopNotes{Owner: "DBA Team", Location: "Rack B3", Fields: map[string]string{"asset": "A-1024"}},
+	}
+	for q, want := range map[string]bool{
+		"":           true,
+		"db-1":       true,
+		"dba":        true,
+		"rack b3":    true,
+		"mysql prod": true,
+		"a-1024":     true,
+		"asset":      true,
+		"dba web":    false,
+		"staging":    false,
+	} {
+		if got := hop.Matches(q); got != want {
+			t.Errorf("Matches(%q) = %v, want %v", q, got, want)
+		}
+	}
+}
+
+func TestHopNotesValidate(t *testing.T) {
+	for _, tc := range []struct {
+		notes *HopNotes
+		ok    bool
+	}{
+		{nil, true},
+		{&HopNotes{Runbook: "https://wiki.example.com/db"}, true},
+		{&HopNotes{Runbook: "wiki.example.com/db"}, false},
+		{&HopNotes{Runbook: "javascript:alert(1)"}, false},
+		{&HopNotes{Fields: map[string]string{"": "x"}}, false},
+	} {
+		if err := tc.notes.Validate(); (err == nil) != tc.ok {
+			t.Errorf("Validate(%+v) = %v, want ok=%v", tc.notes, err, tc.ok)
+		}
+	}
+
+	if !(*HopNotes)(nil).Equal(&HopNotes{}) {
+		t.Error("nil and empty notes should be equal")
+	}
+	if (&HopNotes{Fields: map[string]string{"a": "1"}}).Equal(&HopNotes{Fields: map[string]string{"a": "2"}}) {
+		t.Error("notes with different fields should differ")
+	}
+}
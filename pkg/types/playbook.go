@@ -0,0 +1,121 @@
+package types
+
+import (
+	"slices"
+	"time"
+)
+
+// 可单独重置的 playbook 字段
+const (
+	PlaybookVia    = "via"
+	PlaybookTuning = "tuning"
+)
+
+// Playbook 针对单个目标服务器学到的参数：多路径探测中延迟最低的跳板链，以及自适应上传选定的
+// 并行流数、缓冲区和是否压缩。后续的终端和上传在请求未指定时自动沿用
+type Playbook struct {
+	ServerID string `json:"server_id" yaml:"server_id"`
+	Server   string `json:"server" yaml:"server"` // 学习时的服务器名称，列出时按 ID 刷新
+	// Via 延迟最低的跳板链（服务器 ID），为空且 ViaLearnedAt 非零表示直连最快
+	Via          []string  `json:"via,omitempty" yaml:"via,omitempty"`
+	ViaLatencyMs float64   `json:"via_latency_ms,omitempty" yaml:"via_latency_ms,omitempty"`
+	ViaLearnedAt time.Time `json:"via_learned_at,omitzero" yaml:"via_learned_at,omitempty"`
+	// Tuning 最近一次测量得到的传输参数
+	Tuning          *TransferTuning `json:"tuning,omitempty" yaml:"tuning,omitempty"`
+	TuningLearnedAt time.Time       `json:"tuning_learned_at,omitzero" yaml:"tuning_learned_at,omitempty"`
+}
+
+// empty 是否已没有任何学到的参数
+func (p *Playbook) empty() bool {
+	return p.ViaLearnedAt.IsZero() && p.Tuning == nil
+}
+
+// clone 返回深拷贝，调用方可在锁外使用
+func (p *Playbook) clone() *Playbook {
+	c := *p
+	c.Via = slices.Clone(p.Via)
+	if p.Tuning != nil {
+		tuning := *p.Tuning
+		c.Tuning = &tuning
+	}
+	return &c
+}
+
+// playbook 返回 hop 的 playbook，create 时不存在则新建
+func (c *Config) playbook(hop *Hop, create bool) *Playbook {
+	for _, p := range c.Playbooks {
+		if p.ServerID == hop.ID {
+			p.Server = hop.Name
+			return p
+		}
+	}
+	if !create {
+		return nil
+	}
+	p := &Playbook{ServerID: hop.ID, Server: hop.Name}
+	c.Playbooks = append(c.Playbooks, p)
+	return p
+}
+
+// PlaybookFor 返回 hop 的 playbook 副本，没有学到参数时返回 nil
+func (c *Config) PlaybookFor(hop *Hop) *Playbook {
+	if p := c.playbook(hop, false); p != nil {
+		return p.clone()
+	}
+	return nil
+}
+
+// LearnVia 记录到 hop 延迟最低的跳板链（via 为空表示直连）
+func (c *Config) LearnVia(hop *Hop, via []string, latency time.Duration) {
+	p := c.playbook(hop, true)
+	p.Via = slices.Clone(via)
+	p.ViaLatencyMs = float64(latency) / float64(time.Millisecond)
+	p.ViaLearnedAt = time.Now()
+}
+
+// LearnTuning 记录到 hop 的传输参数
+func (c *Config) LearnTuning(hop *Hop, tuning *TransferTuning) {
+	learned := *tuning
+	learned.Reused = false
+	p := c.playbook(hop, true)
+	p.Tuning = &learned
+	p.TuningLearnedAt = time.Now()
+}
+
+// ResetPlaybook 清除 serverID 学到的参数：field 为 PlaybookVia 或 PlaybookTuning 时只清除该项，
+// 为空时全部清除。返回是否有记录被清除
+func (c *Config) ResetPlaybook(serverID, field string) bool {
+	index := slices.IndexFunc(c.Playbooks, func(p *Playbook) bool { return p.ServerID == serverID })
+	if index < 0 {
+		return false
+	}
+	p := c.Playbooks[index]
+	switch field {
+	case PlaybookVia:
+		p.Via, p.ViaLatencyMs, p.ViaLearnedAt = nil, 0, time.Time{}
+	case PlaybookTuning:
+		p.Tuning, p.TuningLearnedAt = nil, time.Time{}
+	default:
+		p.Via, p.ViaLatencyMs, p.ViaLearnedAt = nil, 0, time.Time{}
+		p.Tuning, p.TuningLearnedAt = nil, time.Time{}
+	}
+	if p.empty() {
+		c.Playbooks = slices.Delete(c.Playbooks, index, index+1)
+	}
+	return true
+}
+
+// PlaybookList 返回全部 playbook 的副本，服务器名称按 ID 刷新，已删除的服务器跳过
+func (c *Config) PlaybookList() []*Playbook {
+	list := make([]*Playbook, 0, len(c.Playbooks))
+	for _, p := range c.Playbooks {
+		hop := c.GetHopByID(p.ServerID)
+		if hop == nil {
+			continue
+		}
+		entry := p.clone()
+		entry.Server = hop.Name
+		list = append(list, entry)
+	}
+	return list
+}
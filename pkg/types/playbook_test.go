@@ -0,0 +1,56 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlaybook(t *testing.T) {
+	web := &Hop{ID: "h1", Name: "web-1"}
+	cfg := &Config{Hops: []*Hop{web, {ID: "h2", Name: "jump"}}}
+	if cfg.PlaybookFor(web) != nil {
+		t.Fatal("playbook before learning anything")
+	}
+
+	cfg.LearnVia(web, []string{"h2"}, 25*time.Millisecond)
+	cfg.LearnTuning(web, &TransferTuning{Streams: 4, BufferSize: 1 << 20, Reused: true})
+	got := cfg.PlaybookFor(web)
+	if got == nil || len(got.Via) != 1 || got.Via[0] != "h2" || got.ViaLatencyMs != 25 || got.Tuning.Streams != 4 || got.Tuning.Reused {
+		t.Fatalf("playbook = %+v", got)
+	}
+	// 返回的是副本
+	got.Via[0] = "x"
+	got.Tuning.Streams = 1
+	if p := cfg.PlaybookFor(web); p.Via[0] != "h2" || p.Tuning.Streams != 4 {
+		t.Errorf("PlaybookFor shares state: %+v", p)
+	}
+
+	web.Name = "web-renamed"
+	if list := cfg.PlaybookList(); len(list) != 1 || list[0].Server != "web-renamed" {
+		t.Errorf("PlaybookList = %+v", list)
+	}
+
+	if !cfg.ResetPlaybook("h1", PlaybookVia) {
+		t.Fatal("ResetPlaybook(via) found nothing")
+	}
+	if p := cfg.PlaybookFor(web); p == nil || p.Via != nil || !p.ViaLearnedAt.IsZero() || p.Tuning == nil {
+		t.Errorf("after via reset: %+v", p)
+	}
+	cfg.ResetPlaybook("h1", PlaybookTuning)
+	if len(cfg.Playbooks) != 0 {
+		t.Errorf("empty playbook kept: %+v", cfg.Playbooks)
+	}
+	if cfg.ResetPlaybook("h1", "") {
+		t.Error("ResetPlaybook reported a missing playbook")
+	}
+
+	// 直连最快也是学到的结果；已删除的服务器不列出
+	cfg.LearnVia(web, nil, time.Millisecond)
+	if p := cfg.PlaybookFor(web); p == nil || p.ViaLearnedAt.IsZero() || len(p.Via) != 0 {
+		t.Errorf("direct route = %+v", p)
+	}
+	cfg.Hops = cfg.Hops[1:]
+	if list := cfg.PlaybookList(); len(list) != 0 {
+		t.Errorf("deleted server still listed: %+v", list)
+	}
+}
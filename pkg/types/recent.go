@@ -0,0 +1,86 @@
+package types
+
+import (
+	"slices"
+	"time"
+)
+
+// MaxRecentPerUser 每个用户保留的最近使用记录数
+const MaxRecentPerUser = 20
+
+// 最近使用记录的种类
+const (
+	RecentTerminal = "terminal"
+	RecentUpload   = "upload"
+)
+
+// RecentTarget 一条最近使用记录：打开过终端的服务器，或上传过的服务器和目录
+type RecentTarget struct {
+	User     string    `json:"user" yaml:"user"`
+	Kind     string    `json:"kind" yaml:"kind"` // RecentTerminal 或 RecentUpload
+	ServerID string    `json:"server_id" yaml:"server_id"`
+	Server   string    `json:"server" yaml:"server"` // 使用时的服务器名称，列出时按 ID 刷新
+	Path     string    `json:"path,omitempty" yaml:"path,omitempty"`
+	Via      []string  `json:"via,omitempty" yaml:"via,omitempty"`
+	UsedAt   time.Time `json:"used_at" yaml:"used_at"`
+}
+
+// same 是否为同一用户对同一目标的使用（经过的链不同也视为同一目标）
+func (t *RecentTarget) same(o *RecentTarget) bool {
+	return t.User == o.User && t.Kind == o.Kind && t.ServerID == o.ServerID && t.Path == o.Path
+}
+
+// TouchRecent 记录一次使用：移到最前，去掉同一目标的旧记录，每个用户只保留 MaxRecentPerUser 条
+func (c *Config) TouchRecent(target *RecentTarget) {
+	recent := []*RecentTarget{target}
+	count := 1
+	for _, t := range c.Recent {
+		if t.same(target) {
+			continue
+		}
+		if t.User == target.User {
+			if count >= MaxRecentPerUser {
+				continue
+			}
+			count++
+		}
+		recent = append(recent, t)
+	}
+	c.Recent = recent
+}
+
+// RecentFor 返回 user 的最近使用记录（kind 为空时不限种类），最新的在前。
+// 服务器名称按 ID 刷新，已删除的服务器跳过
+func (c *Config) RecentFor(user, kind string) []RecentTarget {
+	list := make([]RecentTarget, 0)
+	for _, t := range c.Recent {
+		if t.User != user || (kind != "" && t.Kind != kind) {
+			continue
+		}
+		hop := c.GetHopByID(t.ServerID)
+		if hop == nil {
+			continue
+		}
+		entry := *t
+		entry.Server = hop.Name
+		entry.Via = slices.Clone(t.Via)
+		list = append(list, entry)
+	}
+	return list
+}
+
+// ClearRecent 删除 user 的全部最近使用记录
+func (c *Config) ClearRecent(user string) {
+	c.Recent = slices.DeleteFunc(c.Recent, func(t *RecentTarget) bool { return t.User == user })
+}
+
+// Favorites 返回收藏的服务器，按配置中的顺序
+func (c *Config) Favorites() []*Hop {
+	var hops []*Hop
+	for _, hop := range c.Hops {
+		if hop.Favorite {
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
@@ -0,0 +1,41 @@
+package types
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTouchRecent(t *testing.T) {
+	cfg := &Config{Hops: []*Hop{{ID: "h1", Name: "web-1"}, {ID: "h2", Name: "web-2"}}}
+	cfg.TouchRecent(&RecentTarget{User: "bob", Kind: RecentTerminal, ServerID: "h1"})
+	cfg.TouchRecent(&RecentTarget{User: "bob", Kind: RecentUpload, ServerID: "h1", Path: "/a"})
+	cfg.TouchRecent(&RecentTarget{User: "bob", Kind: RecentUpload, ServerID: "h1", Path: "/b"})
+	cfg.TouchRecent(&RecentTarget{User: "bob", Kind: RecentUpload, ServerID: "h1", Path: "/a"})
+
+	got := cfg.RecentFor("bob", RecentUpload)
+	if len(got) != 2 || got[0].Path != "/a" || got[1].Path != "/b" {
+		t.Fatalf("unexpected upload targets: %+v", got)
+	}
+
+	// 每个用户最多保留 MaxRecentPerUser 条，其他用户的记录不受影响
+	cfg.TouchRecent(&RecentTarget{User: "carol", Kind: RecentTerminal, ServerID: "h2"})
+	for i := 0; i < MaxRecentPerUser+5; i++ {
+		cfg.TouchRecent(&RecentTarget{User: "bob", Kind: RecentUpload, ServerID: "h2", Path: fmt.Sprintf("/p%d", i)})
+	}
+	if n := len(cfg.RecentFor("bob", "")); n != MaxRecentPerUser {
+		t.Errorf("bob has %d entries, want %d", n, MaxRecentPerUser)
+	}
+	if got := cfg.RecentFor("carol", ""); len(got) != 1 || got[0].Server != "web-2" {
+		t.Errorf("carol's entries: %+v", got)
+	}
+
+	// 已删除的服务器不列出
+	cfg.Hops = cfg.Hops[:1]
+	if n := len(cfg.RecentFor("carol", "")); n != 0 {
+		t.Errorf("deleted server still listed: %d", n)
+	}
+	cfg.ClearRecent("bob")
+	if len(cfg.Recent) != 1 {
+		t.Errorf("ClearRecent left %d entries", len(cfg.Recent))
+	}
+}
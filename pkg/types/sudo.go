@@ -0,0 +1,95 @@
+package types
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// sudo 密码的提供方式
+const (
+	SudoPasswordNone   = "none"   // 不提供密码，目标服务器须配置 NOPASSWD（默认）
+	SudoPasswordLogin  = "login"  // 使用服务器保存的登录密码（密码认证的服务器）
+	SudoPasswordPrompt = "prompt" // gmssh upload 在终端上询问，gmssh web 中不可用
+)
+
+// SudoPasswordPolicies 可用的 sudo 密码提供方式
+var SudoPasswordPolicies = []string{SudoPasswordNone, SudoPasswordLogin, SudoPasswordPrompt}
+
+// 默认的提权移动命令：-D 同时创建缺失的上级目录；需要密码时用 -S 从标准输入读取
+const (
+	DefaultSudoCommand         = "sudo -n install -D -m 644 {src} {dst}"
+	DefaultSudoPasswordCommand = "sudo -S -p '' install -D -m 644 {src} {dst}"
+)
+
+// DefaultSudoTempDir 提权上传时远端临时文件所在的目录
+const DefaultSudoTempDir = "/tmp"
+
+// SudoUpload 目标路径对登录用户不可写时，先上传到远端临时文件，再在目标服务器上用特权命令移动到目标位置
+type SudoUpload struct {
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// Servers 只对这些服务器（名称、ID 或标签）生效，为空时对所有服务器生效
+	Servers []string `json:"servers,omitempty" yaml:"servers,omitempty"`
+	// Command 移动命令，{src} 和 {dst} 替换为转义后的临时文件和目标文件路径；
+	// 默认 DefaultSudoCommand，password 不为 none 时默认 DefaultSudoPasswordCommand
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+	// Password sudo 密码的提供方式，见 SudoPasswordNone 等；提供时密码和换行写入命令的标准输入
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	// TempDir 远端临时文件所在的目录，默认 DefaultSudoTempDir
+	TempDir string `json:"temp_dir,omitempty" yaml:"temp_dir,omitempty"`
+}
+
+// Applies 上传到 hop 时是否使用提权移动
+func (s *SudoUpload) Applies(hop *Hop) bool {
+	if !s.Enabled || hop == nil {
+		return false
+	}
+	if len(s.Servers) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(s.Servers, func(name string) bool {
+		return name == hop.Name || name == hop.ID || hop.HasTag(name)
+	})
+}
+
+// PasswordPolicy 生效的 sudo 密码提供方式
+func (s *SudoUpload) PasswordPolicy() string {
+	if s.Password == "" {
+		return SudoPasswordNone
+	}
+	return s.Password
+}
+
+// CommandOrDefault 生效的移动命令模板
+func (s *SudoUpload) CommandOrDefault() string {
+	switch {
+	case s.Command != "":
+		return s.Command
+	case s.PasswordPolicy() != SudoPasswordNone:
+		return DefaultSudoPasswordCommand
+	}
+	return DefaultSudoCommand
+}
+
+// TempDirOrDefault 远端临时文件所在的目录
+func (s *SudoUpload) TempDirOrDefault() string {
+	if s.TempDir != "" {
+		return s.TempDir
+	}
+	return DefaultSudoTempDir
+}
+
+// Validate 检查密码方式、命令模板和临时目录
+func (s *SudoUpload) Validate() error {
+	if !slices.Contains(SudoPasswordPolicies, s.PasswordPolicy()) {
+		return fmt.Errorf("upload sudo password must be one of %s, got '%s'", strings.Join(SudoPasswordPolicies, ", "), s.Password)
+	}
+	if s.Command != "" && (!strings.Contains(s.Command, "{src}") || !strings.Contains(s.Command, "{dst}")) {
+		return fmt.Errorf("upload sudo command must contain {src} and {dst}")
+	}
+	if s.TempDir != "" && !path.IsAbs(s.TempDir) {
+		return fmt.Errorf("upload sudo temp_dir '%s' must be an absolute path", s.TempDir)
+	}
+	return nil
+}
@@ -2,7 +2,9 @@ package types
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 )
 
@@ -12,6 +14,7 @@ type AuthMethod int
 const (
 	AuthKey AuthMethod = iota
 	AuthPassword
+	AuthAgent // 使用 SSH_AUTH_SOCK 指向的 ssh-agent 中的密钥（含硬件密钥），配置中不保存密钥文件或密码
 )
 
 func (a AuthMethod) String() string {
@@ -20,11 +23,27 @@ func (a AuthMethod) String() string {
 		return "key"
 	case AuthPassword:
 		return "password"
+	case AuthAgent:
+		return "agent"
 	default:
 		return "unknown"
 	}
 }
 
+// ParseAuthMethod 解析 key、password 或 agent
+func ParseAuthMethod(s string) (AuthMethod, error) {
+	switch s {
+	case "key":
+		return AuthKey, nil
+	case "password":
+		return AuthPassword, nil
+	case "agent":
+		return AuthAgent, nil
+	default:
+		return 0, fmt.Errorf("invalid auth type %q: must be key, password or agent", s)
+	}
+}
+
 // ServerType 服务器类型
 type ServerType int
 
@@ -54,10 +73,94 @@ type Hop struct {
 	AuthType   AuthMethod `json:"auth_type" yaml:"auth"`
 	KeyPath    string     `json:"key_path,omitempty" yaml:"key_path,omitempty"`
 	Password   string     `json:"password,omitempty" yaml:"password,omitempty"`
+	// KeyPassphrase 加密私钥的口令，env:NAME 表示连接时从环境变量 NAME 读取；为空时命令行交互式询问，web 通过 POST /api/servers/{id}/unlock 提供
+	KeyPassphrase string `json:"key_passphrase,omitempty" yaml:"key_passphrase,omitempty"`
 	ServerType ServerType `json:"server_type" yaml:"server_type"`    // 服务器类型：0外网, 1内网
 	GatewayID  string     `json:"gateway_id,omitempty" yaml:"gateway_id,omitempty"` // 内网服务器的网关ID
 	// 兼容旧配置：用于数据迁移
 	Gateway string `json:"gateway,omitempty" yaml:"gateway,omitempty"` // Deprecated: 使用 GatewayID
+	// Origin 来源：空为本地添加，OriginTeam 为团队同步下发（会被下次同步覆盖），OriginApply 为 gmssh apply 管理
+	Origin string `json:"origin,omitempty" yaml:"origin,omitempty"`
+	// TerminalPreset 打开终端时默认使用的预设，Terminal 中的设置再覆盖预设
+	TerminalPreset string           `json:"terminal_preset,omitempty" yaml:"terminal_preset,omitempty"`
+	Terminal       *TerminalOptions `json:"terminal,omitempty" yaml:"terminal,omitempty"`
+	// LastCheck 最近一次健康检查的结果，由 POST /api/servers/healthcheck 或 server check 写入
+	LastCheck *HealthCheck `json:"last_check,omitempty" yaml:"last_check,omitempty"`
+	// Tags 标签，维护窗口等按标签选择服务器
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// Favorite 收藏，界面和 gmssh connect 中排在前面
+	Favorite bool `json:"favorite,omitempty" yaml:"favorite,omitempty"`
+	// Environment 环境标签（prod、staging、dev 等），按 environments 中的策略确认危险操作
+	Environment string `json:"environment,omitempty" yaml:"environment,omitempty"`
+	// ClientVersion 连接时发送的 SSH 版本串（如 SSH-2.0-OpenSSH_8.9p1），用于只放行特定客户端的 IPS 或网关；为空时使用默认值
+	ClientVersion string `json:"client_version,omitempty" yaml:"client_version,omitempty"`
+	// LegacyCrypto 为只支持旧算法的交换机等设备额外提供 diffie-hellman-group14/1-sha1、CBC 密码和 hmac-sha1，只对该服务器生效
+	LegacyCrypto bool `json:"legacy_crypto,omitempty" yaml:"legacy_crypto,omitempty"`
+	// AllowAgentForwarding 在该服务器上打开的终端转发本机的 ssh-agent，以便在服务器上继续用本机密钥登录其他机器；
+	// 还需 agent_forwarding 策略允许
+	AllowAgentForwarding bool `json:"allow_agent_forwarding,omitempty" yaml:"allow_agent_forwarding,omitempty"`
+	// Notes 说明、负责人、联系方式、运维手册链接和位置等信息，可通过 GET /api/servers?q= 搜索
+	Notes *HopNotes `json:"notes,omitempty" yaml:"notes,omitempty"`
+	// HostKeyPolicy 主机密钥校验策略：tofu（默认）、strict 或 off，见 HostKeyTOFU 等
+	HostKeyPolicy string `json:"host_key_policy,omitempty" yaml:"host_key_policy,omitempty"`
+	// HostKey 固定的主机密钥（authorized_keys 格式），设置后只接受该密钥，不再查 known_hosts
+	HostKey string `json:"host_key,omitempty" yaml:"host_key,omitempty"`
+}
+
+// HasTag 是否带有标签 tag
+func (h *Hop) HasTag(tag string) bool {
+	return slices.Contains(h.Tags, tag)
+}
+
+// Clone 复制服务器的连接和终端设置，用于批量登记相似的机器。
+// 副本没有 ID、来源和健康检查记录，网关、标签和终端设置与原服务器相同；换了主机时不保留固定的主机密钥
+func (h *Hop) Clone(name, host string) *Hop {
+	clone := *h
+	clone.ID = ""
+	clone.Name = name
+	clone.Origin = ""
+	clone.LastCheck = nil
+	clone.Tags = slices.Clone(h.Tags)
+	if host != "" && host != h.Host {
+		clone.Host = host
+		clone.HostKey = ""
+	}
+	if h.Terminal != nil {
+		terminal := *h.Terminal
+		clone.Terminal = &terminal
+	}
+	return &clone
+}
+
+// HopDefaults 添加服务器时未填写字段的默认值（配置中的 server_defaults）
+type HopDefaults struct {
+	User    string `json:"user,omitempty" yaml:"user,omitempty"`
+	KeyPath string `json:"key_path,omitempty" yaml:"key_path,omitempty"` // 仅用于密钥认证
+	Port    int    `json:"port,omitempty" yaml:"port,omitempty"`
+}
+
+// Apply 用默认值填充 hop 中为空的用户、端口和（密钥认证时的）密钥路径
+func (d HopDefaults) Apply(hop *Hop) {
+	if hop.User == "" {
+		hop.User = d.User
+	}
+	if hop.Port == 0 {
+		hop.Port = d.Port
+	}
+	if hop.KeyPath == "" && hop.AuthType == AuthKey {
+		hop.KeyPath = d.KeyPath
+	}
+}
+
+// HealthCheck 一次连通性和认证检查的结果
+type HealthCheck struct {
+	CheckedAt  time.Time `json:"checked_at" yaml:"checked_at"`
+	OK         bool      `json:"ok" yaml:"ok"`
+	LatencyMs  int64     `json:"latency_ms" yaml:"latency_ms"`                     // 建立整条链并执行一条命令的耗时
+	AuthMethod string    `json:"auth_method" yaml:"auth_method"`                   // 目标服务器的认证方式
+	Stage      string    `json:"stage,omitempty" yaml:"stage,omitempty"`           // 失败环节：config、dial、host_key、auth、handshake 或 exec
+	FailedHop  string    `json:"failed_hop,omitempty" yaml:"failed_hop,omitempty"` // 失败的一跳（可能是网关）
+	Error      string    `json:"error,omitempty" yaml:"error,omitempty"`
 }
 
 // Address 返回主机地址
@@ -100,6 +203,16 @@ type LatencyReport struct {
 	Timestamp time.Time     `json:"timestamp"`
 	Success   bool          `json:"success"`
 	Error     string        `json:"error,omitempty"`
+	// Dials 第一跳各个解析地址的连接尝试（多条 A/AAAA 记录时并行竞速）
+	Dials []DialAttempt `json:"dials,omitempty"`
+}
+
+// DialAttempt 连接某个解析地址的一次尝试
+type DialAttempt struct {
+	Addr    string        `json:"addr"`
+	Latency time.Duration `json:"latency"`         // 建立 TCP 连接（或失败、被放弃）所用的时间
+	Error   string        `json:"error,omitempty"` // 失败原因，其他地址先连上时为 canceled
+	Chosen  bool          `json:"chosen"`          // 最终使用的地址
 }
 
 // RoutePreference 路由偏好配置
@@ -112,6 +225,7 @@ type RoutePreference struct {
 	ToName   string `json:"to_name,omitempty" yaml:"-"`
 	ViaName  string `json:"via_name,omitempty" yaml:"-"`
 	Threshold int   `json:"threshold_ms" yaml:"threshold"` // 延迟差异阈值(ms)
+	Origin    string `json:"origin,omitempty" yaml:"origin,omitempty"` // 来源，见 Hop.Origin
 	// 兼容旧配置
 	From string `json:"from,omitempty" yaml:"from,omitempty"` // Deprecated
 	To   string `json:"to,omitempty" yaml:"to,omitempty"`     // Deprecated
@@ -129,14 +243,22 @@ type Profile struct {
 	LocalPort  int      `json:"local_port,omitempty" yaml:"local_port,omitempty"`
 	RemoteHost string   `json:"remote_host,omitempty" yaml:"remote_host,omitempty"`
 	RemotePort int      `json:"remote_port,omitempty" yaml:"remote_port,omitempty"`
+	Origin     string   `json:"origin,omitempty" yaml:"origin,omitempty"` // 来源，见 Hop.Origin
 	// 兼容旧配置
 	Path []string `json:"path,omitempty" yaml:"path,omitempty"` // Deprecated: 使用 PathIDs
 }
 
+// OriginTeam 团队同步下发的条目
+const OriginTeam = "team"
+
+// OriginApply 由 gmssh apply 按状态文件管理的条目，apply --prune 时随文件删除
+const OriginApply = "apply"
+
 // Config 版本常量
 const (
 	ConfigVersion1 = 1 // 初始版本：使用 name 关联
-	ConfigVersion2 = 2 // 当前版本：使用 id 关联
+	ConfigVersion2 = 2 // 使用 id 关联
+	ConfigVersion3 = 3 // 当前版本：凭据与拓扑分离，单独加密保存在本地
 )
 
 // Config 全局配置
@@ -146,7 +268,400 @@ type Config struct {
 	Routes    []*RoutePreference `json:"routes" yaml:"routes"`
 	Profiles  []*Profile         `json:"profiles" yaml:"profiles"`
 	Portal    PortalConfig       `json:"portal,omitempty" yaml:"portal,omitempty"`
-	ConfigDir string             `json:"-" yaml:"-"`
+	Upload    UploadConfig       `json:"upload,omitempty" yaml:"upload,omitempty"`
+	Web       WebConfig          `json:"web,omitempty" yaml:"web,omitempty"`
+	Agents    AgentHubConfig     `json:"agents,omitempty" yaml:"agents,omitempty"`
+	Sync      SyncConfig         `json:"sync,omitempty" yaml:"sync,omitempty"`
+	Tracing   TracingConfig      `json:"tracing,omitempty" yaml:"tracing,omitempty"`
+	Alerts    AlertConfig        `json:"alerts,omitempty" yaml:"alerts,omitempty"`
+	Ports     PortsConfig        `json:"ports,omitempty" yaml:"ports,omitempty"`
+	DNS       DNSConfig          `json:"dns,omitempty" yaml:"dns,omitempty"`
+	// ServerDefaults 添加服务器时未填写的用户、端口和密钥路径的默认值
+	ServerDefaults HopDefaults `json:"server_defaults,omitempty" yaml:"server_defaults,omitempty"`
+	// Maintenance 维护窗口，窗口内不允许新建到相关服务器的终端和传输
+	Maintenance []*MaintenanceWindow `json:"maintenance,omitempty" yaml:"maintenance,omitempty"`
+	// Approval 到带有指定标签的服务器打开终端或上传前须由另一名操作员批准
+	Approval ApprovalConfig `json:"approval,omitempty" yaml:"approval,omitempty"`
+	// AgentForwarding 允许哪些服务器上的会话转发本机的 ssh-agent，默认都不允许
+	AgentForwarding AgentForwardingPolicy `json:"agent_forwarding,omitempty" yaml:"agent_forwarding,omitempty"`
+	// Environments 各环境标签上需要输入服务器名称确认的操作，未配置的标签使用 DefaultEnvironments
+	Environments map[string]EnvironmentPolicy `json:"environments,omitempty" yaml:"environments,omitempty"`
+	// Notify 命令行上传、下载等长任务结束时的桌面通知
+	Notify NotifyConfig `json:"notify,omitempty" yaml:"notify,omitempty"`
+	// Plugins 订阅任务、终端会话、映射和探测事件的插件，Web 服务启动时加载
+	Plugins []*PluginConfig `json:"plugins,omitempty" yaml:"plugins,omitempty"`
+	// LogLevel 日志级别：info（默认）、warn、error、off
+	LogLevel string `json:"log_level,omitempty" yaml:"log_level,omitempty"`
+	// DebugNetem 开发调试用：在 SSH、Portal 和转发连接上注入延迟、抖动和丢包，如 "delay=100ms,jitter=20ms,loss=1%"
+	DebugNetem string `json:"debug_netem,omitempty" yaml:"debug_netem,omitempty"`
+	// TerminalPresets 自定义终端预设，与内置预设同名时替代内置预设
+	TerminalPresets []*TerminalPreset `json:"terminal_presets,omitempty" yaml:"terminal_presets,omitempty"`
+	// Recent 各用户最近使用的终端和上传目标，最新的在前
+	Recent []*RecentTarget `json:"recent,omitempty" yaml:"recent,omitempty"`
+	// Playbooks 各目标服务器学到的最佳跳板链和传输参数
+	Playbooks []*Playbook `json:"playbooks,omitempty" yaml:"playbooks,omitempty"`
+	// Trash 已删除的服务器（回收站），保留 TrashRetentionDays 天后自动清除
+	Trash              []*TrashedHop `json:"trash,omitempty" yaml:"trash,omitempty"`
+	TrashRetentionDays int           `json:"trash_retention_days,omitempty" yaml:"trash_retention_days,omitempty"` // 默认 30
+	ConfigDir          string        `json:"-" yaml:"-"`
+}
+
+// TrashedHop 回收站中的服务器
+type TrashedHop struct {
+	Hop       *Hop      `json:"hop" yaml:"hop"`
+	DeletedAt time.Time `json:"deleted_at" yaml:"deleted_at"`
+}
+
+// Secrets 从拓扑配置中分离出来的本地凭据（v3）
+// 按 ID/名称关联到拓扑，团队成员可共享 config.yaml，各自保留自己的凭据
+type Secrets struct {
+	Hops         map[string]HopSecret `yaml:"hops,omitempty"`          // hop id -> 凭据
+	WebUsers     map[string]string    `yaml:"web_users,omitempty"`     // 用户名 -> 令牌
+	AgentTokens  []string             `yaml:"agent_tokens,omitempty"`  // agent 接入令牌
+	PortalTokens []string             `yaml:"portal_tokens,omitempty"` // 按 portal.server.auth_tokens 顺序
+}
+
+// HopSecret 单个服务器的凭据
+type HopSecret struct {
+	Password      string `yaml:"password,omitempty"`
+	KeyPath       string `yaml:"key_path,omitempty"` // 私钥路径因机器而异，同样只保存在本地
+	KeyPassphrase string `yaml:"key_passphrase,omitempty"`
+}
+
+// WebRole Web 用户角色
+type WebRole string
+
+const (
+	WebRoleAdmin WebRole = "admin" // 管理员：可管理服务器清单，可查看所有用户的运行时对象
+	WebRoleUser  WebRole = "user"  // 普通用户：只能操作自己创建的转发、上传和终端会话
+)
+
+// WebUser Web 界面用户
+type WebUser struct {
+	Name  string  `json:"name" yaml:"name"`
+	Token string  `json:"-" yaml:"token"`
+	Role  WebRole `json:"role" yaml:"role"`
+}
+
+// IsAdmin 是否为管理员
+func (u *WebUser) IsAdmin() bool {
+	return u.Role == WebRoleAdmin
+}
+
+// WebConfig Web 服务配置
+type WebConfig struct {
+	// Users 为空时不启用认证，所有请求视为本地管理员（兼容单用户模式）
+	Users []*WebUser `json:"users,omitempty" yaml:"users,omitempty"`
+	// AllowedOrigins 允许跨域访问 API 的来源（如 https://ops.example.com）
+	// 同源请求总是允许；为空时额外允许本机来源（localhost / 127.0.0.1，便于前端开发）
+	AllowedOrigins []string `json:"allowed_origins,omitempty" yaml:"allowed_origins,omitempty"`
+	// DebugEndpoints 开启 /debug/pprof 和 /api/debug/runtime（仅管理员可访问）
+	DebugEndpoints bool `json:"debug_endpoints,omitempty" yaml:"debug_endpoints,omitempty"`
+	// Bind gmssh web 的监听地址，默认 0.0.0.0:18081；--bind/--local 和 GMSSH_WEB_BIND 优先
+	Bind string `json:"bind,omitempty" yaml:"bind,omitempty"`
+	// SlowRequest 超过该耗时的 API 请求带请求 ID 记录日志，默认 1s，负数为不记录
+	SlowRequest time.Duration `json:"slow_request,omitempty" yaml:"slow_request,omitempty"`
+}
+
+// AgentHubConfig 控制面接收远端 agent 注册的配置
+type AgentHubConfig struct {
+	// ListenAddr agent 接入地址，为空时不启用
+	ListenAddr string `json:"listen_addr,omitempty" yaml:"listen_addr,omitempty"`
+	// TLSCert/TLSKey 为空时使用自签名证书，agent 需通过指纹校验
+	TLSCert string `json:"tls_cert,omitempty" yaml:"tls_cert,omitempty"`
+	TLSKey  string `json:"tls_key,omitempty" yaml:"tls_key,omitempty"`
+	// Tokens 允许接入的 agent 令牌
+	Tokens []string `json:"-" yaml:"tokens,omitempty"`
+}
+
+// SyncConfig 团队拓扑同步配置
+type SyncConfig struct {
+	// Source 共享拓扑来源：git 仓库（git@host:repo、ssh://、*.git、git+https://...）或 HTTPS 文件地址，为空时不启用
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+	// Branch git 分支，为空时使用远端默认分支
+	Branch string `json:"branch,omitempty" yaml:"branch,omitempty"`
+	// Path 仓库内拓扑文件路径，默认 config.yaml
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Interval 拉取间隔，默认 5 分钟
+	Interval time.Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+}
+
+// AlertConfig 路由延迟告警：Threshold 大于 0 的路由偏好按 Interval 探测，
+// 连续 Consecutive 次超过阈值时发出告警
+type AlertConfig struct {
+	// Webhook 告警以 JSON POST 到该地址，为空时只写日志
+	Webhook string `json:"webhook,omitempty" yaml:"webhook,omitempty"`
+	// Consecutive 触发告警所需的连续超阈值次数，默认 3
+	Consecutive int `json:"consecutive,omitempty" yaml:"consecutive,omitempty"`
+	// Interval 探测间隔，默认 1 分钟
+	Interval time.Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+	// AutoSwitch 告警时若备选路径更快，把经过该路由的运行中 Portal 映射切换到备选路径（不修改配置）
+	AutoSwitch bool `json:"auto_switch,omitempty" yaml:"auto_switch,omitempty"`
+	// HealthInterval Web 服务模式下定时检查所有服务器的间隔，为 0 时不检查；网关状态变化时告警
+	HealthInterval time.Duration `json:"health_interval,omitempty" yaml:"health_interval,omitempty"`
+}
+
+// ApprovalConfig 敏感操作审批设置
+type ApprovalConfig struct {
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// Tags 需要审批的服务器标签，默认 production
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// TTL 待审批请求的有效期，默认 15 分钟，过期后操作被拒绝
+	TTL time.Duration `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+}
+
+// DefaultApprovalTags 未配置 approval.tags 时需要审批的标签
+var DefaultApprovalTags = []string{"production"}
+
+// DefaultApprovalTTL 未配置 approval.ttl 时待审批请求的有效期
+const DefaultApprovalTTL = 15 * time.Minute
+
+// Requires 审批开启时，带有任一审批标签的服务器返回 true
+func (a ApprovalConfig) Requires(hop *Hop) bool {
+	if !a.Enabled || hop == nil {
+		return false
+	}
+	tags := a.Tags
+	if len(tags) == 0 {
+		tags = DefaultApprovalTags
+	}
+	return slices.ContainsFunc(tags, hop.HasTag)
+}
+
+// PendingTTL 待审批请求的有效期
+func (a ApprovalConfig) PendingTTL() time.Duration {
+	if a.TTL > 0 {
+		return a.TTL
+	}
+	return DefaultApprovalTTL
+}
+
+// PluginConfig 事件插件：子进程钩子（Command）或 Go 插件（Path），二者选一。
+// 事件以 JSON 交给插件：子进程从 stdin 读取，非 0 退出表示失败；Go 插件导出
+// func HandleEvent(ctx context.Context, event []byte) error
+type PluginConfig struct {
+	Name string `json:"name" yaml:"name"`
+	// Events 订阅的事件类型，"task.*" 匹配一类事件，为空时订阅全部
+	Events  []string `json:"events,omitempty" yaml:"events,omitempty"`
+	Command []string `json:"command,omitempty" yaml:"command,omitempty"`
+	Path    string   `json:"path,omitempty" yaml:"path,omitempty"`
+	// Blocking 在可拒绝的事件（task.created、session.opened）上同步执行，失败或超时即拒绝该操作；
+	// 其他事件仍异步投递
+	Blocking bool `json:"blocking,omitempty" yaml:"blocking,omitempty"`
+	// Timeout 单个事件的处理时间上限，默认 10 秒
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// PortsConfig 本地端口分配：代理和 Portal 映射的 local_addr 为 "auto" 时从该范围中分配
+type PortsConfig struct {
+	// AutoMin/AutoMax 自动分配的端口范围（含两端），默认 20000-29999
+	AutoMin int `json:"auto_min,omitempty" yaml:"auto_min,omitempty"`
+	AutoMax int `json:"auto_max,omitempty" yaml:"auto_max,omitempty"`
+	// AllowLAN 允许 Web 界面创建监听 0.0.0.0 等本机以外可访问地址的转发，每次创建仍需在请求中确认（allow_lan）；
+	// 默认不允许，没有主机的地址（如 ":8080"）只监听 127.0.0.1
+	AllowLAN bool `json:"allow_lan,omitempty" yaml:"allow_lan,omitempty"`
+}
+
+// DNSConfig 转发目标域名解析缓存（internal/resolver），零值使用默认值
+type DNSConfig struct {
+	// TTL 系统解析结果的缓存时间（系统解析器不返回记录 TTL），默认 1 分钟
+	TTL time.Duration `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	// NegativeTTL 解析失败的缓存时间，默认 10 秒；DNS 服务器 SOA 给出的时间更短时按 SOA
+	NegativeTTL time.Duration `json:"negative_ttl,omitempty" yaml:"negative_ttl,omitempty"`
+	// MaxTTL 经隧道查询 DNS 服务器时记录 TTL 的上限，默认 1 小时
+	MaxTTL time.Duration `json:"max_ttl,omitempty" yaml:"max_ttl,omitempty"`
+}
+
+// MaintenanceWindow 维护窗口：Start 到 End 之间拒绝新建到所选服务器的终端和传输
+type MaintenanceWindow struct {
+	ID      string    `json:"id" yaml:"id"`
+	Servers []string  `json:"servers,omitempty" yaml:"servers,omitempty"` // 服务器 ID 或名称
+	Tags    []string  `json:"tags,omitempty" yaml:"tags,omitempty"`       // 带有任一标签的服务器
+	Start   time.Time `json:"start" yaml:"start"`
+	End     time.Time `json:"end" yaml:"end"`
+	// Message 拒绝时返回给用户的说明
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+	// Drain 窗口开始时关闭到这些服务器的已有终端会话
+	Drain     bool   `json:"drain,omitempty" yaml:"drain,omitempty"`
+	CreatedBy string `json:"created_by,omitempty" yaml:"created_by,omitempty"`
+}
+
+// ActiveAt 窗口在 t 时是否生效
+func (w *MaintenanceWindow) ActiveAt(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// Covers 窗口是否包含服务器 hop
+func (w *MaintenanceWindow) Covers(hop *Hop) bool {
+	if slices.Contains(w.Servers, hop.ID) || slices.Contains(w.Servers, hop.Name) {
+		return true
+	}
+	return slices.ContainsFunc(w.Tags, hop.HasTag)
+}
+
+// TerminalModes 终端的 PTY 模式，未设置的字段使用默认值（回显开启、流控关闭、退格键发送 ^?）
+type TerminalModes struct {
+	Erase       string `json:"erase,omitempty" yaml:"erase,omitempty"`               // 退格键发送的字符："^?"（DEL）或 "^H"
+	FlowControl *bool  `json:"flow_control,omitempty" yaml:"flow_control,omitempty"` // XON/XOFF 流控（Ctrl-S 暂停输出、Ctrl-Q 恢复）
+	Echo        *bool  `json:"echo,omitempty" yaml:"echo,omitempty"`
+}
+
+// TerminalOptions 打开终端时的设置，零值字段表示不覆盖
+type TerminalOptions struct {
+	Modes      TerminalModes `json:"modes,omitempty" yaml:"modes,omitempty"`
+	Shell      string        `json:"shell,omitempty" yaml:"shell,omitempty"`             // 代替登录 shell 执行的命令
+	BufferSize int           `json:"buffer_size,omitempty" yaml:"buffer_size,omitempty"` // 读取输出的缓冲区字节数，默认 1024
+	Persist    string        `json:"persist,omitempty" yaml:"persist,omitempty"`         // tmux 或 screen：在远端会话中运行，关闭终端后保留
+	// QuietLogin 以命令方式启动登录 shell，sshd 不输出 MOTD 和上次登录信息，登录更快
+	QuietLogin *bool `json:"quiet_login,omitempty" yaml:"quiet_login,omitempty"`
+}
+
+// TerminalPreset 命名的终端设置
+type TerminalPreset struct {
+	Name            string `json:"name" yaml:"name"`
+	TerminalOptions `yaml:",inline"`
+}
+
+// ErrUnknownTerminalPreset 指定的终端预设不存在
+var ErrUnknownTerminalPreset = errors.New("unknown terminal preset")
+
+// TerminalErase 允许的退格字符
+var TerminalErase = map[string]byte{
+	"^?": 0x7f,
+	"^H": 0x08,
+}
+
+// BuiltinTerminalPresets 内置的终端预设，配置中的同名预设会替代它们
+func BuiltinTerminalPresets() []*TerminalPreset {
+	off, on := false, true
+	return []*TerminalPreset{
+		// vim 等全屏程序需要收到 Ctrl-S/Ctrl-Q，关闭流控
+		{Name: "vim-friendly", TerminalOptions: TerminalOptions{Modes: TerminalModes{Erase: "^?", FlowControl: &off}}},
+		// 大量输出时使用更大的读取缓冲区，开启流控以便 Ctrl-S 暂停滚动
+		{Name: "log-tailing", TerminalOptions: TerminalOptions{Modes: TerminalModes{FlowControl: &on}, BufferSize: 64 * 1024}},
+	}
+}
+
+// Merge 用 o 中已设置的字段覆盖 t
+func (t TerminalOptions) Merge(o *TerminalOptions) TerminalOptions {
+	if o == nil {
+		return t
+	}
+	if o.Modes.Erase != "" {
+		t.Modes.Erase = o.Modes.Erase
+	}
+	if o.Modes.FlowControl != nil {
+		t.Modes.FlowControl = o.Modes.FlowControl
+	}
+	if o.Modes.Echo != nil {
+		t.Modes.Echo = o.Modes.Echo
+	}
+	if o.Shell != "" {
+		t.Shell = o.Shell
+	}
+	if o.BufferSize > 0 {
+		t.BufferSize = o.BufferSize
+	}
+	if o.Persist != "" {
+		t.Persist = o.Persist
+	}
+	if o.QuietLogin != nil {
+		t.QuietLogin = o.QuietLogin
+	}
+	return t
+}
+
+// Validate 检查设置是否合法
+func (t *TerminalOptions) Validate() error {
+	if t == nil {
+		return nil
+	}
+	if _, ok := TerminalErase[t.Modes.Erase]; t.Modes.Erase != "" && !ok {
+		return fmt.Errorf("invalid erase character %q (use ^? or ^H)", t.Modes.Erase)
+	}
+	if t.BufferSize < 0 {
+		return fmt.Errorf("invalid buffer size %d", t.BufferSize)
+	}
+	if t.Persist != "" && t.Persist != "tmux" && t.Persist != "screen" {
+		return fmt.Errorf("invalid persist tool %q (use tmux or screen)", t.Persist)
+	}
+	return nil
+}
+
+// TracingConfig OpenTelemetry 追踪导出配置；也可只用标准的 OTEL_EXPORTER_OTLP_* 环境变量
+type TracingConfig struct {
+	// Endpoint OTLP/HTTP 端点（host:port 或完整 URL），为空且未设置环境变量时不导出
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	// Insecure 使用明文 HTTP
+	Insecure bool `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+	// ServiceName 上报的服务名，默认按命令区分（gmssh-web、gmssh-portal 等）
+	ServiceName string `json:"service_name,omitempty" yaml:"service_name,omitempty"`
+	// SampleRatio 采样比例 (0,1)，默认全部采样
+	SampleRatio float64 `json:"sample_ratio,omitempty" yaml:"sample_ratio,omitempty"`
+}
+
+// UploadConfig Web 上传暂存配置
+type UploadConfig struct {
+	// TempDir 暂存目录，为空时使用系统临时目录（可能是较小的 tmpfs）
+	TempDir string `json:"temp_dir,omitempty" yaml:"temp_dir,omitempty"`
+	// MaxAge 暂存目录最长保留时间，超时的残留目录会被定期清理
+	MaxAge time.Duration `json:"max_age,omitempty" yaml:"max_age,omitempty"`
+	// CleanupInterval 清理间隔
+	CleanupInterval time.Duration `json:"cleanup_interval,omitempty" yaml:"cleanup_interval,omitempty"`
+	// SpeedWindow 传输速度平滑（EWMA）的时间窗口，越大 ETA 越稳定、对速度变化的反应越慢，默认 5s
+	SpeedWindow time.Duration `json:"speed_window,omitempty" yaml:"speed_window,omitempty"`
+	// Adaptive 单文件上传默认使用自适应参数（请求中的 adaptive 优先）
+	Adaptive bool `json:"adaptive,omitempty" yaml:"adaptive,omitempty"`
+	// Backups 上传覆盖已有文件前保留旧版本（<name>.bak-<时间>）的目录
+	Backups []BackupRule `json:"backups,omitempty" yaml:"backups,omitempty"`
+	// StageDir 中转上传（stage 模式）在网关上暂存文件的目录，相对路径相对登录用户的主目录，默认 .gmssh-stage
+	StageDir string `json:"stage_dir,omitempty" yaml:"stage_dir,omitempty"`
+	// StageQuota 网关暂存目录的容量上限（字节），已用空间加上本次文件超过时拒绝中转，0 为不限制。
+	// 超过 MaxAge 的残留暂存在每次中转前清理
+	StageQuota int64 `json:"stage_quota,omitempty" yaml:"stage_quota,omitempty"`
+	// Policy 传输前的大小、扩展名和扫描命令检查
+	Policy UploadPolicy `json:"policy,omitempty" yaml:"policy,omitempty"`
+	// Sudo 目标路径不可写时经临时文件和特权命令写入
+	Sudo SudoUpload `json:"sudo,omitempty" yaml:"sudo,omitempty"`
+}
+
+// NotifyConfig 命令行长任务的桌面通知（macOS 通知中心、Linux notify-send、Windows toast）
+type NotifyConfig struct {
+	// Desktop 上传、下载和 fetch-dir 成功或失败时发送桌面通知
+	Desktop bool `json:"desktop,omitempty" yaml:"desktop,omitempty"`
+	// MinDuration 只通知运行超过该时长的任务，默认 1 分钟
+	MinDuration time.Duration `json:"min_duration,omitempty" yaml:"min_duration,omitempty"`
+}
+
+// GatewayChain 返回连接到 hop 所需的完整跳板链（网关在前，hop 在最后），网关循环或缺失时截断
+func (c *Config) GatewayChain(hop *Hop) []*Hop {
+	chain := []*Hop{hop}
+	visited := map[string]bool{hop.ID: true}
+	for gatewayID := hop.GatewayID; gatewayID != "" && !visited[gatewayID]; {
+		gateway := c.GetHopByID(gatewayID)
+		if gateway == nil {
+			break
+		}
+		visited[gatewayID] = true
+		chain = append([]*Hop{gateway}, chain...)
+		gatewayID = gateway.GatewayID
+	}
+	return chain
+}
+
+// MaintenanceFor 返回 t 时覆盖 hops 中任一服务器（包括网关）的维护窗口和被覆盖的服务器，没有时返回 nil
+func (c *Config) MaintenanceFor(hops []*Hop, t time.Time) (*MaintenanceWindow, *Hop) {
+	for _, w := range c.Maintenance {
+		if !w.ActiveAt(t) {
+			continue
+		}
+		for _, hop := range hops {
+			if w.Covers(hop) {
+				return w, hop
+			}
+		}
+	}
+	return nil, nil
 }
 
 // GetHopByID 根据ID获取 Hop
@@ -169,6 +684,53 @@ func (c *Config) GetHopByName(name string) *Hop {
 	return nil
 }
 
+// GetTerminalPreset 按名称查找终端预设，配置中的预设优先于内置预设
+func (c *Config) GetTerminalPreset(name string) *TerminalPreset {
+	for _, p := range c.TerminalPresets {
+		if p.Name == name {
+			return p
+		}
+	}
+	for _, p := range BuiltinTerminalPresets() {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// AllTerminalPresets 返回配置中的预设和没有被替代的内置预设
+func (c *Config) AllTerminalPresets() []*TerminalPreset {
+	presets := append([]*TerminalPreset(nil), c.TerminalPresets...)
+	configured := make(map[string]bool, len(c.TerminalPresets))
+	for _, p := range c.TerminalPresets {
+		configured[p.Name] = true
+	}
+	for _, builtin := range BuiltinTerminalPresets() {
+		if !configured[builtin.Name] {
+			presets = append(presets, builtin)
+		}
+	}
+	return presets
+}
+
+// ResolveTerminal 计算打开 hop 终端时的设置：preset（为空时使用 hop 的默认预设），再应用 hop 自己的设置；
+// 预设不存在时返回错误
+func (c *Config) ResolveTerminal(hop *Hop, preset string) (TerminalOptions, error) {
+	var opts TerminalOptions
+	if preset == "" {
+		preset = hop.TerminalPreset
+	}
+	if preset != "" {
+		p := c.GetTerminalPreset(preset)
+		if p == nil {
+			return opts, fmt.Errorf("%w: %s", ErrUnknownTerminalPreset, preset)
+		}
+		opts = opts.Merge(&p.TerminalOptions)
+	}
+	return opts.Merge(hop.Terminal), nil
+}
+
 // GetProfileByID 根据ID获取 Profile
 func (c *Config) GetProfileByID(id string) *Profile {
 	for _, p := range c.Profiles {
@@ -189,10 +751,10 @@ func (c *Config) GetProfileByName(name string) *Profile {
 	return nil
 }
 
-// GetRoutePreference 获取路由偏好
-func (c *Config) GetRoutePreference(from, to string) *RoutePreference {
+// GetRoutePreference 根据起点和终点服务器ID获取路由偏好
+func (c *Config) GetRoutePreference(fromID, toID string) *RoutePreference {
 	for _, r := range c.Routes {
-		if r.From == from && r.To == to {
+		if r.FromID == fromID && r.ToID == toID {
 			return r
 		}
 	}
@@ -215,27 +777,100 @@ type ProxyRequest struct {
 	Via        []string `json:"via,omitempty"`
 }
 
+// TransferTuning 自适应上传的参数：先以保守参数测量吞吐和 RTT，再决定并行流数、缓冲区和是否压缩。
+// 记录在任务中，同一路径的后续上传直接沿用
+type TransferTuning struct {
+	Streams    int   `json:"streams" yaml:"streams"`
+	BufferSize int   `json:"buffer_size" yaml:"buffer_size"`
+	Compress   bool  `json:"compress" yaml:"compress"`
+	RTTMillis  int64 `json:"rtt_ms,omitempty" yaml:"rtt_ms,omitempty"`
+	// Throughput 测量阶段单个流的吞吐
+	Throughput int64 `json:"throughput_bytes_per_sec,omitempty" yaml:"throughput_bytes_per_sec,omitempty"`
+	// Reused 沿用了同一路径之前选定的参数，未重新测量
+	Reused bool `json:"reused,omitempty" yaml:"-"`
+}
+
+// ModeThroughput 以某种上传模式（tunnel、relay）传输同一个文件的实测结果
+type ModeThroughput struct {
+	Mode       string `json:"mode"`
+	Bytes      int64  `json:"bytes"`
+	DurationMs int64  `json:"duration_ms"`
+	Throughput int64  `json:"throughput_bytes_per_sec"`
+	Error      string `json:"error,omitempty"`
+}
+
 // TransferProgress 传输进度
 type TransferProgress struct {
 	TaskID       string        `json:"task_id"`
 	FileName     string        `json:"file_name"`
 	TotalBytes   int64         `json:"total_bytes"`
 	SentBytes    int64         `json:"sent_bytes"`
-	Speed        int64         `json:"speed_bytes_per_sec"`
+	Speed        int64         `json:"speed_bytes_per_sec"`         // 平滑速度（EWMA），用于估算 ETA
+	InstantSpeed int64         `json:"instant_speed_bytes_per_sec"` // 最近一个采样周期的速度
+	AverageSpeed int64         `json:"average_speed_bytes_per_sec"` // 从开始到现在的平均速度
 	ETA          time.Duration `json:"eta_seconds"`
-	Status       string        `json:"status"` // pending, running, completed, failed
+	Status       string        `json:"status"` // pending, awaiting_approval, running, completed, failed
 	Error        string        `json:"error,omitempty"`
+	ErrorCode    string        `json:"error_code,omitempty"` // 失败原因的错误代码，与 API 错误响应的 code 相同
 	Timestamp    time.Time     `json:"timestamp"`
+	RequestID    string        `json:"request_id,omitempty"` // 发起上传的 API 请求 ID
+	ApprovalID   string        `json:"approval_id,omitempty"` // 目标需要审批时的审批请求 ID
+	// Tuning 自适应上传选用的参数
+	Tuning *TransferTuning `json:"tuning,omitempty"`
+	// Mode 上传模式：tunnel（默认）、relay、stage 或 compare
+	Mode string `json:"mode,omitempty"`
+	// Modes compare 模式下各模式的实测吞吐
+	Modes []ModeThroughput `json:"modes,omitempty"`
+	// Phase 中转上传（stage 模式）所处的阶段：staging 上传到网关，delivering 由网关推送到目标；
+	// 每个阶段的 SentBytes 从 0 计到 TotalBytes
+	Phase string `json:"phase,omitempty"`
+	// Files 目录上传的逐文件进度；任务记录中是完整清单，传输过程中的进度消息只带发生变化的文件
+	Files []FileProgress `json:"files,omitempty"`
+}
+
+// FileProgress 目录上传中单个文件的进度
+type FileProgress struct {
+	Name      string `json:"name"` // 相对上传目录的路径（/ 分隔）
+	Size      int64  `json:"size"`
+	SentBytes int64  `json:"sent_bytes"`
+	Status    string `json:"status"` // pending, running, completed, failed
+	Error     string `json:"error,omitempty"`
+}
+
+// MergeFiles 按名称把变化的文件合并到清单中，未出现过的文件追加到末尾
+func (tp *TransferProgress) MergeFiles(files []FileProgress) {
+	for _, f := range files {
+		merged := false
+		for i := range tp.Files {
+			if tp.Files[i].Name == f.Name {
+				tp.Files[i] = f
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			tp.Files = append(tp.Files, f)
+		}
+	}
+}
+
+// Clone 深拷贝，便于在锁外序列化
+func (tp *TransferProgress) Clone() *TransferProgress {
+	clone := *tp
+	clone.Files = append([]FileProgress(nil), tp.Files...)
+	return &clone
 }
 
-// MarshalJSON 自定义 JSON 序列化，添加 percentage 字段
+// MarshalJSON 自定义 JSON 序列化，添加 percentage 字段，ETA 以秒输出
 func (tp TransferProgress) MarshalJSON() ([]byte, error) {
 	type Alias TransferProgress
 	return json.Marshal(&struct {
 		Alias
+		ETA        float64 `json:"eta_seconds"`
 		Percentage float64 `json:"percentage"`
 	}{
 		Alias:      (Alias)(tp),
+		ETA:        tp.ETA.Seconds(),
 		Percentage: tp.Percentage(),
 	})
 }
@@ -271,6 +906,9 @@ type PortMapping struct {
 	Enabled    bool           `json:"enabled" yaml:"enabled"`
 	// PortalServer 是 GMPortal 服务端地址，如果为空则使用 Via 中的第一个外网服务器
 	PortalServer string `json:"portal_server,omitempty" yaml:"portal_server,omitempty"`
+	// Resolver RemoteHost 的解析方式：remote（默认，由隧道末端解析）、system（本机解析）或 dns:<server>（经隧道查询该 DNS 服务器）
+	Resolver string `json:"resolver,omitempty" yaml:"resolver,omitempty"`
+	Origin   string `json:"origin,omitempty" yaml:"origin,omitempty"` // 来源，见 Hop.Origin
 }
 
 // PortalTokenConfig Token 认证配置
@@ -285,6 +923,8 @@ type PortalConnectionConfig struct {
 	RetryInterval     time.Duration `json:"retry_interval" yaml:"retry_interval"`
 	MaxRetries        int           `json:"max_retries" yaml:"max_retries"`
 	KeepaliveInterval time.Duration `json:"keepalive_interval" yaml:"keepalive_interval"`
+	// DrainTimeout 运行中的映射切换到新链路后，旧链路上的连接最多保留多久，默认 30s
+	DrainTimeout time.Duration `json:"drain_timeout,omitempty" yaml:"drain_timeout,omitempty"`
 }
 
 // DefaultPortalConnectionConfig 返回默认连接配置
@@ -0,0 +1,120 @@
+package types
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultPolicyCommandTimeout 未配置 upload.policy.command_timeout 时扫描命令的超时
+const DefaultPolicyCommandTimeout = 5 * time.Minute
+
+// UploadPolicy 传输前的合规检查：单文件大小上限、禁止的扩展名和本地扫描命令（如 clamscan）。
+// 违反时拒绝传输（错误码 ERR_UPLOAD_POLICY）并在审计日志中记录 policy.violation
+type UploadPolicy struct {
+	// DeniedExtensions 禁止上传的扩展名（不区分大小写，如 .exe、.tar.gz），对所有目标生效
+	DeniedExtensions []string `json:"denied_extensions,omitempty" yaml:"denied_extensions,omitempty"`
+	// Rules 按目标服务器和目录的附加限制，所有匹配的规则同时生效
+	Rules []UploadPolicyRule `json:"rules,omitempty" yaml:"rules,omitempty"`
+	// Command 本地扫描命令，如 [clamscan, --no-summary, -r]；被检查的文件或目录作为最后一个参数，退出码非 0 时拒绝
+	Command []string `json:"command,omitempty" yaml:"command,omitempty"`
+	// CommandTimeout 扫描命令的超时，默认 DefaultPolicyCommandTimeout，超时同样拒绝
+	CommandTimeout time.Duration `json:"command_timeout,omitempty" yaml:"command_timeout,omitempty"`
+}
+
+// UploadPolicyRule 上传到某台服务器或某个目录时的限制
+type UploadPolicyRule struct {
+	// Server 只对该服务器（名称或 ID）生效，为空时对所有服务器生效
+	Server string `json:"server,omitempty" yaml:"server,omitempty"`
+	// Dir 只对该远端目录（含子目录）生效，为空时对所有目录生效
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	// MaxSize 单个文件的最大字节数，0 为不限制
+	MaxSize int64 `json:"max_size,omitempty" yaml:"max_size,omitempty"`
+	// DeniedExtensions 在全局列表之外禁止的扩展名
+	DeniedExtensions []string `json:"denied_extensions,omitempty" yaml:"denied_extensions,omitempty"`
+}
+
+// matches 规则是否适用于上传到 hop 上的 remotePath
+func (r UploadPolicyRule) matches(hop *Hop, remotePath string) bool {
+	if r.Server != "" && (hop == nil || (r.Server != hop.Name && r.Server != hop.ID)) {
+		return false
+	}
+	if r.Dir == "" {
+		return true
+	}
+	dir, remotePath := path.Clean(r.Dir), path.Clean(remotePath)
+	return dir == "/" || remotePath == dir || strings.HasPrefix(remotePath, dir+"/")
+}
+
+// Enabled 是否配置了任何检查
+func (p *UploadPolicy) Enabled() bool {
+	return len(p.DeniedExtensions) > 0 || len(p.Rules) > 0 || len(p.Command) > 0
+}
+
+// Limits 上传到 hop 上的 remotePath 时单个文件的大小上限（匹配规则中最小的，0 为不限制）和禁止的扩展名（小写，以 . 开头）
+func (p *UploadPolicy) Limits(hop *Hop, remotePath string) (int64, []string) {
+	var maxSize int64
+	denied := normalizeExtensions(nil, p.DeniedExtensions)
+	for _, rule := range p.Rules {
+		if !rule.matches(hop, remotePath) {
+			continue
+		}
+		if rule.MaxSize > 0 && (maxSize == 0 || rule.MaxSize < maxSize) {
+			maxSize = rule.MaxSize
+		}
+		denied = normalizeExtensions(denied, rule.DeniedExtensions)
+	}
+	return maxSize, denied
+}
+
+func normalizeExtensions(dst, exts []string) []string {
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if !slices.Contains(dst, ext) {
+			dst = append(dst, ext)
+		}
+	}
+	return dst
+}
+
+// CommandTimeoutOrDefault 扫描命令的超时
+func (p *UploadPolicy) CommandTimeoutOrDefault() time.Duration {
+	if p.CommandTimeout > 0 {
+		return p.CommandTimeout
+	}
+	return DefaultPolicyCommandTimeout
+}
+
+// Validate 检查规则：目录须为绝对路径，大小不能为负，扩展名不能为空
+func (p *UploadPolicy) Validate() error {
+	for _, ext := range p.DeniedExtensions {
+		if strings.Trim(strings.TrimSpace(ext), ".") == "" {
+			return fmt.Errorf("upload policy has an empty denied extension")
+		}
+	}
+	for _, rule := range p.Rules {
+		if rule.Dir != "" && !path.IsAbs(rule.Dir) {
+			return fmt.Errorf("upload policy rule dir '%s' must be an absolute path", rule.Dir)
+		}
+		if rule.MaxSize < 0 {
+			return fmt.Errorf("upload policy rule for '%s' has a negative max_size", rule.Dir)
+		}
+		for _, ext := range rule.DeniedExtensions {
+			if strings.Trim(strings.TrimSpace(ext), ".") == "" {
+				return fmt.Errorf("upload policy rule for '%s' has an empty denied extension", rule.Dir)
+			}
+		}
+	}
+	if len(p.Command) > 0 && p.Command[0] == "" {
+		return fmt.Errorf("upload policy command has no program")
+	}
+	if p.CommandTimeout < 0 {
+		return fmt.Errorf("upload policy command_timeout must not be negative")
+	}
+	return nil
+}
@@ -20,6 +20,9 @@ type Config struct {
 		// 最终目标网关
 		GatewayHost string `json:"gateway_host"`
 		GatewayPort int    `json:"gateway_port"`
+		// 主机密钥校验：known_hosts 文件和校验方式 tofu（默认）、strict、off
+		KnownHosts            string `json:"known_hosts"`
+		StrictHostKeyChecking string `json:"strict_host_key_checking"`
 	} `json:"ssh"`
 
 	// 上传配置
@@ -54,6 +57,8 @@ func DefaultConfig() *Config {
 	c.SSH.JumpPort = 22
 	c.SSH.GatewayHost = "localhost"
 	c.SSH.GatewayPort = 22
+	c.SSH.KnownHosts = filepath.Join(os.Getenv("HOME"), ".ssh/known_hosts")
+	c.SSH.StrictHostKeyChecking = hostKeyTOFU
 
 	// 上传默认值
 	c.Upload.ChunkSize = 512 * 1024  // 512KB
@@ -121,6 +126,11 @@ func (c *Config) Validate() error {
 	if c.SSH.GatewayHost == "" {
 		return fmt.Errorf("网关地址不能为空")
 	}
+	switch c.SSH.StrictHostKeyChecking {
+	case "", hostKeyTOFU, hostKeyStrict, hostKeyOff:
+	default:
+		return fmt.Errorf("strict_host_key_checking 只能是 tofu、strict 或 off")
+	}
 	if c.Upload.ChunkSize < 64*1024 {
 		return fmt.Errorf("分片大小不能小于 64KB")
 	}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// 主机密钥校验方式（ssh.strict_host_key_checking）
+const (
+	hostKeyTOFU   = "tofu"   // 首次连接时记录到 known_hosts，之后必须一致（默认）
+	hostKeyStrict = "strict" // 只接受 known_hosts 中已有的密钥
+	hostKeyOff    = "off"    // 不校验
+)
+
+// knownHostsMu 跳板机和网关可能并发记录，串行写 known_hosts
+var knownHostsMu sync.Mutex
+
+// hostKeyCallback 按配置构建主机密钥校验
+func (c *Config) hostKeyCallback() ssh.HostKeyCallback {
+	mode := c.SSH.StrictHostKeyChecking
+	if mode == "" {
+		mode = hostKeyTOFU
+	}
+	if mode == hostKeyOff {
+		log.Printf("警告: 已关闭主机密钥校验 (strict_host_key_checking=off)")
+		return ssh.InsecureIgnoreHostKey()
+	}
+	path := expandPath(c.SSH.KnownHosts)
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		knownHostsMu.Lock()
+		defer knownHostsMu.Unlock()
+
+		var keyErr *knownhosts.KeyError
+		if _, err := os.Stat(path); err == nil {
+			callback, err := knownhosts.New(path)
+			if err != nil {
+				return fmt.Errorf("读取 %s 失败: %w", path, err)
+			}
+			err = callback(hostname, remote, key)
+			if !errors.As(err, &keyErr) {
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		fingerprint := key.Type() + " " + ssh.FingerprintSHA256(key)
+		if keyErr != nil && len(keyErr.Want) > 0 {
+			return fmt.Errorf("%s 的主机密钥已变化（收到 %s），可能是重装或中间人攻击；确认无误后从 %s 删除旧记录", hostname, fingerprint, path)
+		}
+		if mode == hostKeyStrict {
+			return fmt.Errorf("%s 的主机密钥不在 %s 中（%s），请先用 ssh 连接一次或改用 strict_host_key_checking=tofu", hostname, path, fingerprint)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)); err != nil {
+			return err
+		}
+		log.Printf("已记录 %s 的主机密钥到 %s: %s", hostname, path, fingerprint)
+		return nil
+	}
+}
@@ -72,7 +72,7 @@ func (u *Uploader) createSSHClient() (*ssh.Client, error) {
 	sshConfig := &ssh.ClientConfig{
 		User:            u.config.SSH.Username,
 		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: u.config.hostKeyCallback(),
 		Timeout:         30 * time.Second,
 	}
 
@@ -5,6 +5,9 @@ const API_BASE = import.meta.env.VITE_API_BASE || '/api';
 
 const client = axios.create({
   baseURL: API_BASE,
+  // 多用户模式下，修改请求需回传登录时下发的 CSRF 令牌
+  xsrfCookieName: 'gmssh_csrf',
+  xsrfHeaderName: 'X-CSRF-Token',
   headers: {
     'Content-Type': 'application/json',
   },
@@ -12,12 +15,14 @@ const client = axios.create({
 
 export interface CreateMappingRequest {
   name: string;
-  local_addr: string;
+  local_addr: string; // host:port，或 'auto' 由服务端分配端口
   remote_host: string;
   remote_port: number;
   via?: string[];
   protocol?: string;
   portal_server?: string;
+  resolver?: string; // remote_host 的解析方式：remote（默认，由隧道末端解析）、system 或 dns:<server>（经隧道查询）
+  allow_lan?: boolean; // 确认监听 0.0.0.0 等本机以外可访问的地址，服务端还需配置 ports.allow_lan
 }
 
 export async function getPortalStatus(): Promise<PortalStatus> {
@@ -1,10 +1,13 @@
 import axios from 'axios';
-import { Server } from '../types';
+import { AlertsResponse, DeployKeyResult, GeneratedKey, HealthCheckResponse, HealthCheckResult, ImportSSHRequest, ImportSSHResult, LoginStats, MaintenanceWindow, PathComparison, PoolSnapshot, ReferencesReport, RemoteListener, RemoteProcess, RemoteSession, RotateKeysResponse, Server, ServerDefaults, ServerUsage, SessionGroup, SetupRequest, SetupResult, SetupStatus, ConnectionInfo, PanicResult, RecentList, TailOptions, TCPingResult, TerminalPreset, TraceReport, TrashItem, UptimeReport, UsageReport, WarmChainsResult } from '../types';
 
 const API_BASE = import.meta.env.VITE_API_BASE || '/api';
 
 const client = axios.create({
   baseURL: API_BASE,
+  // 多用户模式下，修改请求需回传登录时下发的 CSRF 令牌
+  xsrfCookieName: 'gmssh_csrf',
+  xsrfHeaderName: 'X-CSRF-Token',
   headers: {
     'Content-Type': 'application/json',
   },
@@ -15,11 +18,56 @@ export async function listServers(): Promise<Server[]> {
   return response.data;
 }
 
-export async function addServer(server: Omit<Server, 'id'>): Promise<Server> {
+// address 为 user@host:port 连接串，代替 user、host、port，未填写 name 时按主机生成
+export async function addServer(server: Omit<Server, 'id'> | (Partial<Omit<Server, 'id'>> & { address: string })): Promise<Server> {
   const response = await client.post('/servers', server);
   return response.data;
 }
 
+// 以新名称复制服务器，未填写的字段沿用原服务器
+export async function cloneServer(id: string, data: { name: string; host?: string; port?: number; user?: string }): Promise<Server> {
+  const response = await client.post(`/servers/${id}/clone`, data);
+  return response.data;
+}
+
+export async function getServerDefaults(): Promise<ServerDefaults> {
+  const response = await client.get('/servers/defaults');
+  return response.data;
+}
+
+export async function updateServerDefaults(defaults: ServerDefaults): Promise<ServerDefaults> {
+  const response = await client.put('/servers/defaults', defaults);
+  return response.data;
+}
+
+// 收藏或取消收藏服务器（仅管理员）
+export async function setFavorite(id: string, favorite: boolean): Promise<Server> {
+  const response = favorite ? await client.put(`/servers/${id}/favorite`) : await client.delete(`/servers/${id}/favorite`);
+  return response.data;
+}
+
+// 服务器最近 days 天按天的使用量
+export async function getServerUsage(id: string, days = 30): Promise<UsageReport> {
+  const response = await client.get(`/servers/${id}/usage`, { params: { days } });
+  return response.data;
+}
+
+// 各服务器最近 days 天的总使用量，负载最高的在前
+export async function listUsage(days = 30): Promise<ServerUsage[]> {
+  const response = await client.get('/usage', { params: { days } });
+  return response.data;
+}
+
+// 当前用户最近使用的终端和上传目标（最新的在前）以及收藏的服务器
+export async function getRecent(kind?: 'terminal' | 'upload'): Promise<RecentList> {
+  const response = await client.get('/recent', { params: kind ? { kind } : undefined });
+  return response.data;
+}
+
+export async function clearRecent(): Promise<void> {
+  await client.delete('/recent');
+}
+
 export async function updateServer(id: string, server: Partial<Server>): Promise<Server> {
   const response = await client.put(`/servers/${id}`, server);
   return response.data;
@@ -29,7 +77,219 @@ export async function deleteServer(id: string): Promise<void> {
   await client.delete(`/servers/${id}`);
 }
 
+export async function listTrash(): Promise<TrashItem[]> {
+  const response = await client.get('/trash');
+  return response.data;
+}
+
+export async function restoreServer(id: string): Promise<Server> {
+  const response = await client.post(`/trash/${id}/restore`);
+  return response.data;
+}
+
+export async function purgeServer(id: string): Promise<void> {
+  await client.delete(`/trash/${id}`);
+}
+
+export async function getReferences(): Promise<ReferencesReport> {
+  const response = await client.get('/references');
+  return response.data;
+}
+
+export async function fixReferences(): Promise<ReferencesReport> {
+  const response = await client.post('/references');
+  return response.data;
+}
+
+export async function previewImportSSH(): Promise<ImportSSHResult> {
+  const response = await client.get('/config/import-ssh');
+  return response.data;
+}
+
+export async function importSSH(request: ImportSSHRequest): Promise<ImportSSHResult> {
+  const response = await client.post('/config/import-ssh', request);
+  return response.data;
+}
+
 export async function testConnection(id: string): Promise<{ success: boolean; latency_ms: number }> {
   const response = await client.post(`/servers/${id}/test`);
   return response.data;
 }
+
+// 并发检查服务器（ids 为空时检查全部）的连通性和认证，结果同时写入各服务器的 last_check
+export async function checkServers(ids?: string[], parallel?: number): Promise<HealthCheckResponse> {
+  const response = await client.post('/servers/healthcheck', { ids, parallel });
+  return response.data;
+}
+
+// 获取定时检查记录的服务器状态变化和可用率
+export async function getUptime(id: string): Promise<UptimeReport> {
+  const response = await client.get(`/servers/${id}/uptime`);
+  return response.data;
+}
+
+// 服务器登录各阶段（TCP、密钥交换、认证、打开通道、启动 shell）的耗时
+export async function getLoginTimings(id: string): Promise<LoginStats> {
+  const response = await client.get(`/servers/${id}/login`);
+  return response.data;
+}
+
+export async function listLoginTimings(): Promise<LoginStats[]> {
+  const response = await client.get('/metrics/login');
+  return response.data;
+}
+
+// 并发探测直连和每条候选跳板链（服务器 ID 列表），结果按延迟排序，第一项为推荐路径
+export async function comparePaths(target: string, candidates: string[][], count?: number): Promise<PathComparison[]> {
+  const response = await client.post('/metrics/latency', { target, candidates, count });
+  return response.data.candidates;
+}
+
+// 沿跳板链逐段追踪路由，via 为空时使用目标的网关链
+export async function traceRoute(target: string, via?: string[]): Promise<TraceReport> {
+  const response = await client.post('/diagnostics/trace', { target, via });
+  return response.data;
+}
+
+// 经跳板链最后一跳检查 target:port 是否可连接，via 为空时使用目标的网关链
+export async function tcping(target: string, port: number, via?: string[], count?: number): Promise<TCPingResult> {
+  const response = await client.post('/diagnostics/tcping', { target, port, via, count });
+  return response.data;
+}
+
+// 为即将打开的终端预先建立 SSH 链，via 为空时使用目标的网关链
+export async function warmChains(target: string, count?: number, via?: string[]): Promise<WarmChainsResult> {
+  const response = await client.post('/chains/warm', { target, via, count });
+  return response.data;
+}
+
+// 终端连接池状态，包括每个目标的预热连接数
+export async function getChainPool(): Promise<PoolSnapshot> {
+  const response = await client.get('/chains');
+  return response.data;
+}
+
+// 打开终端时可选的预设（配置中的和内置的）
+export async function getTerminalPresets(): Promise<TerminalPreset[]> {
+  const response = await client.get('/terminal/presets');
+  return response.data;
+}
+
+// 按所在的链分组的终端会话，如 gateway→db1 上 3 个标签共用 1 条连接
+export async function getSessionChains(): Promise<SessionGroup[]> {
+  const response = await client.get('/sessions/chains');
+  return response.data;
+}
+
+// 活动连接（代理、Portal 映射和终端）
+export async function listConnections(): Promise<ConnectionInfo[]> {
+  const response = await client.get('/connections');
+  return response.data;
+}
+
+// 断开一条活动连接，所属的代理或映射继续运行
+export async function closeConnection(id: string): Promise<void> {
+  await client.delete(`/connections/${encodeURIComponent(id)}`);
+}
+
+// 紧急停止所有隧道、终端和传输（仅管理员）
+export async function panicStop(): Promise<PanicResult> {
+  const response = await client.post('/panic');
+  return response.data;
+}
+
+// 首次配置向导
+export async function getSetupStatus(): Promise<SetupStatus> {
+  const response = await client.get('/setup');
+  return response.data;
+}
+
+export async function checkSetup(request: SetupRequest): Promise<HealthCheckResult[]> {
+  const response = await client.post('/setup/check', request);
+  return response.data;
+}
+
+export async function runSetup(request: SetupRequest): Promise<SetupResult> {
+  const response = await client.post('/setup', request);
+  return response.data;
+}
+
+// 维护窗口
+export async function listMaintenance(): Promise<MaintenanceWindow[]> {
+  const response = await client.get('/maintenance');
+  return response.data;
+}
+
+export async function createMaintenance(data: {
+  servers?: string[];
+  tags?: string[];
+  start?: string;
+  end?: string;
+  duration?: string;
+  message?: string;
+  drain?: boolean;
+}): Promise<MaintenanceWindow> {
+  const response = await client.post('/maintenance', data);
+  return response.data;
+}
+
+export async function deleteMaintenance(id: string): Promise<void> {
+  await client.delete(`/maintenance/${id}`);
+}
+
+// 服务器上可重新连接的 tmux/screen 会话
+export async function listRemoteSessions(id: string): Promise<RemoteSession[]> {
+  const response = await client.get(`/servers/${id}/sessions`);
+  return response.data;
+}
+
+// 服务器上的进程
+export async function listProcesses(id: string): Promise<RemoteProcess[]> {
+  const response = await client.get(`/servers/${id}/processes`);
+  return response.data;
+}
+
+// 结束进程（仅管理员），started 取自进程列表，PID 已被复用时返回 409
+export async function killProcess(id: string, proc: RemoteProcess, signal = 'TERM'): Promise<void> {
+  await client.post(`/servers/${id}/processes/${proc.pid}/kill`, { signal, confirm: proc.started });
+}
+
+// 生成 SSH 密钥对（仅管理员），path 为空时保存到 ~/.ssh/hssh_<type>，已存在时返回 409
+export async function generateKey(options: { type?: string; bits?: number; comment?: string; path?: string; overwrite?: boolean } = {}): Promise<GeneratedKey> {
+  const response = await client.post('/keys/generate', options);
+  return response.data;
+}
+
+// 以服务器现有认证方式把公钥追加到其 authorized_keys（仅管理员），switchAuth 时验证后改为密钥认证
+export async function deployKey(id: string, keyPath?: string, switchAuth = false): Promise<DeployKeyResult> {
+  const response = await client.post(`/servers/${id}/deploy-key`, { key_path: keyPath, switch_auth: switchAuth });
+  return response.data;
+}
+
+// 生成新密钥并把服务器轮换到新密钥（仅管理员），ids 为空时轮换全部服务器
+export async function rotateKeys(ids: string[] = [], options: { type?: string; path?: string; parallel?: number } = {}): Promise<RotateKeysResponse> {
+  const response = await client.post('/keys/rotate', { ids, all: ids.length === 0, ...options });
+  return response.data;
+}
+
+// 服务器上监听的端口
+export async function listListeners(id: string): Promise<RemoteListener[]> {
+  const response = await client.get(`/servers/${id}/ports`);
+  return response.data;
+}
+
+// tail 的 SSE 地址，配合 EventSource 使用：message 事件为一行，dropped/end 事件的数据为 JSON
+export function tailURL(opts: TailOptions): string {
+  const params = new URLSearchParams({ server: opts.server, path: opts.path });
+  if (opts.follow) params.set('follow', 'true');
+  if (opts.lines !== undefined) params.set('lines', String(opts.lines));
+  if (opts.grep) params.set('grep', opts.grep);
+  if (opts.max_rate !== undefined) params.set('max_rate', String(opts.max_rate));
+  return `${API_BASE}/tail?${params}`;
+}
+
+// 路由延迟监控状态和最近的告警
+export async function getAlerts(): Promise<AlertsResponse> {
+  const response = await client.get('/alerts');
+  return response.data;
+}
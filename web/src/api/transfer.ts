@@ -1,17 +1,25 @@
 import axios from 'axios';
-import { ProxyInfo, TransferProgress } from '../types';
+import { BackupList, ChunkedUploadInfo, EditFile, FetchDirRequest, OverwriteMode, PortsResponse, ProxyInfo, TransferProgress } from '../types';
 
 const API_BASE = import.meta.env.VITE_API_BASE || '/api';
 
 const client = axios.create({
   baseURL: API_BASE,
+  // 多用户模式下，修改请求需回传登录时下发的 CSRF 令牌
+  xsrfCookieName: 'gmssh_csrf',
+  xsrfHeaderName: 'X-CSRF-Token',
 });
 
+function overwriteParams(overwrite?: OverwriteMode) {
+  return overwrite ? { [overwrite]: 1 } : undefined;
+}
+
 export async function uploadFile(
   file: File,
   targetPath: string,
   targetHost: string,
-  via?: string[]
+  via?: string[],
+  overwrite?: OverwriteMode
 ): Promise<string> {
   const formData = new FormData();
   formData.append('file', file);
@@ -25,10 +33,80 @@ export async function uploadFile(
     headers: {
       'Content-Type': 'multipart/form-data',
     },
+    params: overwriteParams(overwrite),
   });
   return response.data.task_id;
 }
 
+// 分块上传失败后的最大重试次数和重试间隔
+const CHUNK_RETRIES = 5;
+const CHUNK_RETRY_DELAY_MS = 2000;
+
+// 可续传的单文件上传：网络中断后查询服务端偏移量并从断点继续。
+// 传入上次的 uploadId 可在页面刷新后续传（需为同一文件）；onProgress 报告浏览器到服务端的进度
+export async function uploadFileResumable(
+  file: File,
+  targetPath: string,
+  targetHost: string,
+  via?: string[],
+  onProgress?: (info: ChunkedUploadInfo) => void,
+  uploadId?: string,
+  overwrite?: OverwriteMode
+): Promise<string> {
+  let info: ChunkedUploadInfo;
+  if (uploadId) {
+    info = (await client.get(`/upload/${uploadId}`)).data;
+  } else {
+    info = (await client.post('/upload/init', {
+      file_name: file.name,
+      size: file.size,
+      target_host: targetHost,
+      target_path: targetPath,
+      via: via && via.length > 0 ? via.join(',') : undefined,
+    })).data;
+  }
+
+  let failures = 0;
+  while (info.offset < info.size) {
+    const chunk = file.slice(info.offset, info.offset + info.chunk_size);
+    try {
+      const response = await client.patch(`/upload/${info.upload_id}`, chunk, {
+        headers: {
+          'Content-Type': 'application/offset+octet-stream',
+          'Upload-Offset': String(info.offset),
+        },
+      });
+      info = { ...info, offset: Number(response.headers['upload-offset']) };
+      failures = 0;
+    } catch (err) {
+      if (++failures > CHUNK_RETRIES) {
+        throw err;
+      }
+      await new Promise(resolve => setTimeout(resolve, CHUNK_RETRY_DELAY_MS));
+      // 中断的请求可能已写入一部分，以服务端的偏移量为准；查询失败时下一轮重试
+      try {
+        info = (await client.get(`/upload/${info.upload_id}`)).data;
+      } catch {
+        continue;
+      }
+    }
+    onProgress?.(info);
+  }
+
+  return completeResumableUpload(info.upload_id, overwrite);
+}
+
+// 完成分块上传；overwrite 为 diff 且会覆盖已有文件时返回 409 ERR_OVERWRITE_CONFIRM，
+// 数据仍在服务端暂存，确认后以 force 再次调用
+export async function completeResumableUpload(uploadId: string, overwrite?: OverwriteMode): Promise<string> {
+  const response = await client.post(`/upload/${uploadId}/complete`, undefined, { params: overwriteParams(overwrite) });
+  return response.data.task_id;
+}
+
+export async function cancelResumableUpload(uploadId: string): Promise<void> {
+  await client.delete(`/upload/${uploadId}`);
+}
+
 export async function uploadDirectory(
   files: File[],
   targetPath: string,
@@ -58,17 +136,21 @@ export async function uploadDirectory(
   return response.data.task_id;
 }
 
+// localPort 为 'auto' 时由服务端从 ports.auto_min-auto_max 中分配，返回的 local_addr 为实际地址
 export async function createProxy(
-  localPort: number,
+  localPort: number | 'auto',
   remoteHost: string,
   remotePort: number,
-  via?: string[]
+  via?: string[],
+  bindHost?: string, // 默认只监听 127.0.0.1；本机以外可访问的地址需要服务端配置 ports.allow_lan
+  allowLAN?: boolean
 ): Promise<ProxyInfo> {
   const response = await client.post('/proxy', {
-    local_addr: `:${localPort}`,
+    local_addr: localPort === 'auto' ? 'auto' : `${bindHost ?? ''}:${localPort}`,
     remote_host: remoteHost,
     remote_port: remotePort,
     via,
+    allow_lan: allowLAN,
   });
   return response.data;
 }
@@ -78,15 +160,68 @@ export async function listProxies(): Promise<ProxyInfo[]> {
   return response.data;
 }
 
+// 已占用的本地端口（代理、Portal 映射、预设）和自动分配范围
+export async function getPorts(): Promise<PortsResponse> {
+  const response = await client.get('/ports');
+  return response.data;
+}
+
 export async function deleteProxy(id: string): Promise<void> {
   await client.delete(`/proxy/${id}`);
 }
 
 export async function getProgress(taskId: string): Promise<TransferProgress> {
-  const response = await client.get(`/ws/progress/${taskId}`);
+  const response = await client.get(`/uploads/${taskId}`);
+  return response.data;
+}
+
+// 在远端打包压缩目录并下载到 Web 服务的暂存区，返回任务 ID
+export async function fetchDir(req: FetchDirRequest): Promise<string> {
+  const response = await client.post('/fetch-dir', req);
+  return response.data.task_id;
+}
+
+export async function getFetchDirProgress(taskId: string): Promise<TransferProgress> {
+  const response = await client.get(`/fetch-dir/${taskId}`);
+  return response.data;
+}
+
+// 任务完成后浏览器直接访问此地址下载压缩包
+export function fetchDirArchiveUrl(taskId: string): string {
+  return `${API_BASE}/fetch-dir/${taskId}/archive`;
+}
+
+export async function deleteFetchDir(taskId: string): Promise<void> {
+  await client.delete(`/fetch-dir/${taskId}`);
+}
+
+export async function getEditFile(server: string, path: string): Promise<EditFile> {
+  const response = await client.get('/edit', { params: { server, path } });
+  return response.data;
+}
+
+// checksum 为读取时返回的值，远端文件已被他人修改时返回 409 ERR_EDIT_CONFLICT；新建文件时传空字符串
+export async function saveEditFile(
+  server: string,
+  path: string,
+  content: string,
+  checksum: string,
+  overwrite?: OverwriteMode
+): Promise<EditFile> {
+  const response = await client.put('/edit', { content, checksum }, { params: { server, path, ...overwriteParams(overwrite) } });
   return response.data;
 }
 
+export async function listBackups(server: string, path: string): Promise<BackupList> {
+  const response = await client.get('/backups', { params: { server, path } });
+  return response.data;
+}
+
+// 用备份替换远端文件，当前内容先被备份，恢复后仍可撤销
+export async function restoreBackup(server: string, path: string, backup: string): Promise<void> {
+  await client.post('/backups/restore', { server, path, backup });
+}
+
 export interface DirEntry {
   name: string;
   path: string;
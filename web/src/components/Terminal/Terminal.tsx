@@ -5,16 +5,27 @@ import { Server } from '../../types';
 
 interface TerminalProps {
   server: Server;
+  preset?: string; // 终端预设，为空时使用服务器的默认预设
+  persist?: 'tmux' | 'screen'; // 在远端会话中运行，关闭后保留
+  session?: string; // 远端会话名，存在时连接，否则创建
   isOpen: boolean;
   onClose: () => void;
   onError?: (error: string) => void;
 }
 
 interface TerminalMessage {
-  type: 'output' | 'status' | 'error';
+  type: 'output' | 'status' | 'error' | 'auth_prompt';
   data: string;
 }
 
+// 键盘交互认证（如跳板机的 OTP）的问题，对应后端的 ssh.Challenge
+interface AuthChallenge {
+  hop: string;
+  user: string;
+  instruction?: string;
+  questions: { prompt: string; echo: boolean }[];
+}
+
 interface Position {
   x: number;
   y: number;
@@ -25,13 +36,15 @@ interface Size {
   height: number;
 }
 
-export function Terminal({ server, isOpen, onClose, onError }: TerminalProps) {
+export function Terminal({ server, preset, persist, session, isOpen, onClose, onError }: TerminalProps) {
   const terminalRef = useRef<HTMLDivElement>(null);
   const xtermRef = useRef<XTerm | null>(null);
   const wsRef = useRef<WebSocket | null>(null);
   const modalRef = useRef<HTMLDivElement>(null);
   const [connectionStatus, setConnectionStatus] = useState<'connecting' | 'connected' | 'error' | 'closed'>('connecting');
   const [errorMessage, setErrorMessage] = useState<string>('');
+  // 链路重连成功后递增，重新打开 WebSocket
+  const [reconnectCount, setReconnectCount] = useState(0);
 
   // 窗口位置和大小状态
   const [position, setPosition] = useState<Position>({ x: 0, y: 0 });
@@ -61,8 +74,12 @@ export function Terminal({ server, isOpen, onClose, onError }: TerminalProps) {
   const getWebSocketUrl = useCallback(() => {
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
     const host = window.location.host;
-    return `${protocol}//${host}/api/terminal?server=${encodeURIComponent(server?.name || '')}`;
-  }, [server?.name]);
+    const params = new URLSearchParams({ server: server?.name || '' });
+    if (preset) params.set('preset', preset);
+    if (persist) params.set('persist', persist);
+    if (session) params.set('session', session);
+    return `${protocol}//${host}/api/terminal?${params.toString()}`;
+  }, [server?.name, preset, persist, session]);
 
   // 初始化窗口位置（居中）
   useEffect(() => {
@@ -159,11 +176,32 @@ export function Terminal({ server, isOpen, onClose, onError }: TerminalProps) {
               term.writeln('\r\n\x1b[32m✓ 连接成功！可以开始输入命令\x1b[0m\r\n');
               // 连接成功后聚焦终端
               term.focus();
+            } else if (message.data === 'reconnecting') {
+              setConnectionStatus('connecting');
+            } else if (message.data === 'reconnected') {
+              // 服务端已重新建立链路，用同样的参数重新打开终端，persist 会话随之恢复
+              setReconnectCount((n) => n + 1);
             } else if (message.data === 'disconnected') {
               setConnectionStatus('closed');
               term.writeln('\r\n\x1b[31m✗ 连接已断开\x1b[0m\r\n');
             }
             break;
+          case 'auth_prompt': {
+            // 逐个询问，任一问题取消时放弃认证
+            const challenge: AuthChallenge = JSON.parse(message.data);
+            term.writeln(`\r\n\x1b[33m🔐 ${challenge.user}@${challenge.hop} 需要二次验证\x1b[0m`);
+            const answers: string[] = [];
+            for (const question of challenge.questions) {
+              const answer = window.prompt(`${challenge.instruction ? challenge.instruction + '\n' : ''}${challenge.hop}: ${question.prompt}`);
+              if (answer === null) {
+                ws.send(JSON.stringify({ type: 'auth_cancel', data: '' }));
+                return;
+              }
+              answers.push(answer);
+            }
+            ws.send(JSON.stringify({ type: 'auth_response', data: JSON.stringify(answers) }));
+            break;
+          }
           case 'error':
             setConnectionStatus('error');
             setErrorMessage(message.data);
@@ -233,7 +271,7 @@ export function Terminal({ server, isOpen, onClose, onError }: TerminalProps) {
       xtermRef.current = null;
       wsRef.current = null;
     };
-  }, [isOpen, server, getWebSocketUrl, onError]);
+  }, [isOpen, server, getWebSocketUrl, onError, reconnectCount]);
 
   // 调整大小时更新终端尺寸
   useEffect(() => {
@@ -9,6 +9,9 @@ const PROTOCOL_OPTIONS: { value: PortalProtocol; label: string; icon: string }[]
   { value: 'websocket', label: 'WebSocket', icon: '🔵' },
 ];
 
+// 绝对路径或 unix: 前缀的地址是 unix socket
+const isUnixSocket = (addr?: string) => !!addr && /^(unix:)?\//.test(addr.trim());
+
 export function Portal() {
   const { servers } = useServerStore();
   const [mappings, setMappings] = useState<PortMapping[]>([]);
@@ -50,10 +53,10 @@ export function Portal() {
     if (!newMapping.local_addr?.trim()) {
       newErrors.local_addr = '请输入本地地址';
     } else {
-      // 验证地址格式，支持 :port 或 host:port
+      // 验证地址格式，支持 :port、host:port 或 unix socket 路径
       const addrPattern = /^([\w.]*:\d+|:\d+)$/;
-      if (!addrPattern.test(newMapping.local_addr)) {
-        newErrors.local_addr = '格式错误，应为 :port 或 host:port';
+      if (!addrPattern.test(newMapping.local_addr) && !isUnixSocket(newMapping.local_addr)) {
+        newErrors.local_addr = '格式错误，应为 :port、host:port 或 unix socket 路径';
       }
     }
 
@@ -61,7 +64,9 @@ export function Portal() {
       newErrors.remote_host = '请输入远程主机';
     }
 
-    if (!newMapping.remote_port || newMapping.remote_port < 1 || newMapping.remote_port > 65535) {
+    // unix socket 目标不需要端口
+    const unixTarget = isUnixSocket(newMapping.remote_host);
+    if (!unixTarget && (!newMapping.remote_port || newMapping.remote_port < 1 || newMapping.remote_port > 65535)) {
       newErrors.remote_port = '端口范围 1-65535';
     }
 
@@ -308,7 +313,7 @@ export function Portal() {
                     </div>
                     <div className="flex justify-between text-sm">
                       <span className="text-tertiary">远程目标</span>
-                      <span className="text-primary font-mono">{mapping.remote_host}:{mapping.remote_port}</span>
+                      <span className="text-primary font-mono">{isUnixSocket(mapping.remote_host) ? mapping.remote_host : `${mapping.remote_host}:${mapping.remote_port}`}</span>
                     </div>
                     {mapping.via && mapping.via.length > 0 && (
                       <div className="flex justify-between text-sm">
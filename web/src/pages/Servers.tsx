@@ -1,6 +1,7 @@
 import { useEffect, useState } from 'react';
 import { useServerStore } from '../stores/serverStore';
-import { Server } from '../types';
+import { DanglingRef, Server, TrashItem } from '../types';
+import * as serversApi from '../api/servers';
 import { Terminal } from '../components/Terminal';
 
 interface ServersProps {
@@ -8,7 +9,7 @@ interface ServersProps {
 }
 
 export function Servers({ onNavigateToTransfer }: ServersProps) {
-  const { servers, loading, fetchServers, addServer, updateServer, deleteServer, setPreselectedServer } = useServerStore();
+  const { servers, loading, error, fetchServers, addServer, updateServer, deleteServer, setPreselectedServer } = useServerStore();
   const [showAddForm, setShowAddForm] = useState(false);
   const [showEditForm, setShowEditForm] = useState(false);
   const [editingServer, setEditingServer] = useState<Server | null>(null);
@@ -20,11 +21,65 @@ export function Servers({ onNavigateToTransfer }: ServersProps) {
     server_type: 'external',
   });
   const [errors, setErrors] = useState<Record<string, string>>({});
+  const [trash, setTrash] = useState<TrashItem[]>([]);
+  const [dangling, setDangling] = useState<DanglingRef[]>([]);
+
+  const fetchReferences = async () => {
+    try {
+      setDangling((await serversApi.getReferences()).dangling);
+    } catch (err) {
+      console.error('[References] Failed to load:', err);
+    }
+  };
+
+  const handleFixReferences = async () => {
+    try {
+      setDangling((await serversApi.fixReferences()).dangling);
+      await fetchServers();
+    } catch (err) {
+      console.error('[References] Failed to fix:', err);
+    }
+  };
+
+  const fetchTrash = async () => {
+    try {
+      setTrash(await serversApi.listTrash());
+    } catch (err) {
+      console.error('[Trash] Failed to load:', err);
+    }
+  };
 
   useEffect(() => {
     fetchServers();
+    fetchTrash();
+    fetchReferences();
   }, [fetchServers]);
 
+  const handleDelete = async (id: string) => {
+    await deleteServer(id);
+    fetchTrash();
+    fetchReferences();
+  };
+
+  const handleRestore = async (id: string) => {
+    try {
+      await serversApi.restoreServer(id);
+      await fetchServers();
+    } catch (err) {
+      console.error('[Trash] Failed to restore:', err);
+    }
+    fetchTrash();
+  };
+
+  const handlePurge = async (id: string) => {
+    try {
+      await serversApi.purgeServer(id);
+    } catch (err) {
+      console.error('[Trash] Failed to purge:', err);
+    }
+    fetchTrash();
+  };
+
   const validateForm = (isEdit = false): boolean => {
     const newErrors: Record<string, string> = {};
     const serverData = isEdit ? editingServer : newServer;
@@ -382,7 +437,7 @@ export function Servers({ onNavigateToTransfer }: ServersProps) {
           {data.auth_type === 'password' && (
             <div>
               <label className="glass-label">
-                密码 {isEdit && data.password && <span className="text-tertiary">(已设置)</span>}
+                密码 {isEdit && (data.password || data.has_password) && <span className="text-tertiary">(已设置)</span>}
               </label>
               <input
                 type="password"
@@ -441,6 +496,32 @@ export function Servers({ onNavigateToTransfer }: ServersProps) {
         </button>
       </div>
 
+      {/* Error (e.g. server still referenced) */}
+      {error && (
+        <div className="glass-card p-4">
+          <p className="glass-error-text">{error}</p>
+        </div>
+      )}
+
+      {/* Dangling references */}
+      {dangling.length > 0 && (
+        <div className="glass-card p-4">
+          <div className="flex items-center justify-between mb-2">
+            <p className="glass-error-text">{dangling.length} 处引用指向不存在的服务器</p>
+            <button onClick={handleFixReferences} className="glass-button glass-button-secondary">
+              一键修复
+            </button>
+          </div>
+          <ul className="text-sm text-tertiary space-y-1">
+            {dangling.map((ref, i) => (
+              <li key={i}>
+                {ref.kind} <span className="text-primary">{ref.owner}</span> · {ref.field} = <span className="font-mono">{ref.ref}</span> → {ref.fix}
+              </li>
+            ))}
+          </ul>
+        </div>
+      )}
+
       {/* Loading State */}
       {loading && (
         <div className="glass-card p-12 text-center">
@@ -492,7 +573,7 @@ export function Servers({ onNavigateToTransfer }: ServersProps) {
                         </svg>
                       </button>
                       <button
-                        onClick={() => deleteServer(server.id)}
+                        onClick={() => handleDelete(server.id)}
                         className="glass-button-icon-sm glass-button-danger"
                         title="删除"
                       >
@@ -568,6 +649,35 @@ export function Servers({ onNavigateToTransfer }: ServersProps) {
         </>
       )}
 
+      {/* Trash */}
+      {trash.length > 0 && (
+        <div className="glass-card p-5">
+          <h2 className="font-semibold text-primary mb-1">回收站</h2>
+          <p className="text-tertiary text-sm mb-4">已删除的服务器会在到期后永久删除</p>
+          <div className="space-y-2">
+            {trash.map((item) => (
+              <div key={item.hop.id} className="flex items-center justify-between text-sm">
+                <div>
+                  <span className="text-primary">{item.hop.name}</span>
+                  <span className="text-tertiary ml-2">{item.hop.host}</span>
+                  <span className="text-quaternary ml-2">
+                    删除于 {new Date(item.deleted_at).toLocaleString()}，{new Date(item.expires_at).toLocaleDateString()} 到期
+                  </span>
+                </div>
+                <div className="flex gap-2">
+                  <button onClick={() => handleRestore(item.hop.id)} className="glass-button glass-button-secondary">
+                    恢复
+                  </button>
+                  <button onClick={() => handlePurge(item.hop.id)} className="glass-button glass-button-danger">
+                    永久删除
+                  </button>
+                </div>
+              </div>
+            ))}
+          </div>
+        </div>
+      )}
+
       {/* Add Server Modal */}
       {showAddForm && (
         <div className="glass-modal-overlay">
@@ -298,6 +298,17 @@ export function Transfer() {
     return `${(bytesPerSec / 1024).toFixed(2)} KB/s`;
   };
 
+  const formatETA = (seconds: number) => {
+    const total = Math.ceil(seconds);
+    if (total <= 0) return '--';
+    const h = Math.floor(total / 3600);
+    const m = Math.floor((total % 3600) / 60);
+    const sec = total % 60;
+    if (h > 0) return `${h}h ${m}m`;
+    if (m > 0) return `${m}m ${sec}s`;
+    return `${sec}s`;
+  };
+
   const formatSize = (bytes: number) => {
     if (bytes === 0) return '0 B';
     if (bytes > 1024 * 1024 * 1024) {
@@ -754,14 +765,20 @@ export function Transfer() {
                 </div>
 
                 {progress.status === 'running' && (
-                  <div className="grid grid-cols-2 gap-3">
+                  <div className="grid grid-cols-3 gap-3">
                     <div className="glass-card glass-card-flat p-3 text-center">
                       <p className="text-quaternary text-xs mb-0.5">速度</p>
-                      <p className="text-primary text-sm font-medium">{formatSpeed(progress.speed_bytes_per_sec)}</p>
+                      <p className="text-primary text-sm font-medium" title={`瞬时 ${formatSpeed(progress.instant_speed_bytes_per_sec ?? 0)}`}>
+                        {formatSpeed(progress.speed_bytes_per_sec)}
+                      </p>
+                    </div>
+                    <div className="glass-card glass-card-flat p-3 text-center">
+                      <p className="text-quaternary text-xs mb-0.5">平均</p>
+                      <p className="text-primary text-sm font-medium">{formatSpeed(progress.average_speed_bytes_per_sec ?? 0)}</p>
                     </div>
                     <div className="glass-card glass-card-flat p-3 text-center">
                       <p className="text-quaternary text-xs mb-0.5">剩余</p>
-                      <p className="text-primary text-sm font-medium">{Math.ceil(progress.eta_seconds)}s</p>
+                      <p className="text-primary text-sm font-medium">{formatETA(progress.eta_seconds)}</p>
                     </div>
                   </div>
                 )}
@@ -771,6 +788,25 @@ export function Transfer() {
                     <p className="text-error-text text-sm">{progress.error}</p>
                   </div>
                 )}
+
+                {progress.files && progress.files.length > 0 && (
+                  <div className="max-h-48 overflow-y-auto space-y-1">
+                    {progress.files.map((f) => (
+                      <div key={f.name} className="flex items-center justify-between text-xs gap-2">
+                        <span className="text-secondary truncate" title={f.error || f.name}>{f.name}</span>
+                        <span className={
+                          f.status === 'failed' ? 'text-error-text' :
+                          f.status === 'completed' ? 'text-success-text' :
+                          'text-quaternary'
+                        }>
+                          {f.status === 'running'
+                            ? `${f.size > 0 ? ((f.sent_bytes * 100) / f.size).toFixed(0) : 0}%`
+                            : f.status === 'failed' ? '失败' : f.status === 'completed' ? formatSize(f.size) : '等待'}
+                        </span>
+                      </div>
+                    ))}
+                  </div>
+                )}
               </div>
             </div>
           )}
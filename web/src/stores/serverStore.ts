@@ -1,5 +1,6 @@
+import axios from 'axios';
 import { create } from 'zustand';
-import { Server } from '../types';
+import { ApiError, Server } from '../types';
 import * as api from '../api/servers';
 
 interface ServerState {
@@ -63,7 +64,9 @@ export const useServerStore = create<ServerState>((set, get) => ({
       await api.deleteServer(id);
       await get().fetchServers();
     } catch (err) {
-      set({ error: String(err), loading: false });
+      // 409：服务器仍被网关、路由、预设或端口映射引用，显示服务端给出的依赖列表
+      const message = axios.isAxiosError<ApiError>(err) && err.response?.data?.error;
+      set({ error: message || String(err), loading: false });
     }
   },
 
@@ -8,10 +8,166 @@ export interface Hop {
   user: string;
   auth_type: 'key' | 'password';
   key_path?: string;
-  password?: string;
+  password?: string; // 只用于提交，服务器列表和详情不返回
+  has_password?: boolean; // 已保存登录密码
+  has_passphrase?: boolean; // 已保存私钥口令
   server_type: ServerType;
   gateway_id?: string; // 网关服务器ID
   gateway_name?: string; // 网关显示名称（后端填充）
+  terminal_preset?: string; // 打开终端时默认使用的预设
+  terminal?: TerminalOptions; // 覆盖预设的终端设置
+  last_check?: HealthCheck; // 最近一次健康检查
+  tags?: string[]; // 维护窗口按标签选择服务器
+  favorite?: boolean; // 收藏，排在前面
+}
+
+// 连通性和认证检查结果
+export interface HealthCheck {
+  checked_at: string;
+  ok: boolean;
+  latency_ms: number;
+  auth_method: string;
+  stage?: 'config' | 'dial' | 'host_key' | 'auth' | 'handshake' | 'exec'; // 失败环节
+  failed_hop?: string;
+  error?: string;
+}
+
+export interface HealthCheckResult extends HealthCheck {
+  id: string;
+  name: string;
+}
+
+export interface HealthCheckResponse {
+  ok: number;
+  failed: number;
+  results: HealthCheckResult[];
+}
+
+// 定时检查记录的一次状态变化
+export interface StatusChange {
+  time: string;
+  status: 'up' | 'down';
+  stage?: string; // 变为 down 时失败的环节
+  error?: string;
+}
+
+// 服务器的可用性历史，未开启 alerts.health_interval 时 status 为 unknown
+export interface UptimeReport {
+  id: string;
+  status: 'up' | 'down' | 'unknown';
+  since?: string; // 当前状态开始的时间
+  tracked_since?: string;
+  uptime_percent: number;
+  checks: number;
+  failures: number;
+  last_check?: string;
+  changes: StatusChange[]; // 按时间从旧到新
+}
+
+// 终端 PTY 模式，未设置的字段使用默认值
+export interface TerminalModes {
+  erase?: '^?' | '^H'; // 退格键发送的字符
+  flow_control?: boolean; // XON/XOFF 流控
+  echo?: boolean;
+}
+
+export interface TerminalOptions {
+  modes?: TerminalModes;
+  shell?: string; // 代替登录 shell 执行的命令
+  buffer_size?: number;
+  persist?: 'tmux' | 'screen'; // 在远端会话中运行，关闭终端后保留
+  quiet_login?: boolean; // 不显示 MOTD 和上次登录信息（仅在未设置 shell 和 persist 时生效）
+}
+
+// 一个登录阶段的耗时统计，单位毫秒
+export interface PhaseStats {
+  count: number;
+  last_ms: number;
+  avg_ms: number;
+  max_ms: number;
+}
+
+// 服务器在本进程内的登录耗时，phases 的键为 tcp、kex、auth、channel、shell
+export interface LoginStats {
+  id: string;
+  name: string;
+  logins: number;
+  last_login?: string;
+  phases: Record<string, PhaseStats>;
+}
+
+// 服务器上的 tmux/screen 会话
+export interface RemoteSession {
+  name: string;
+  tool: 'tmux' | 'screen';
+  attached: boolean;
+  windows?: number; // 仅 tmux
+  created?: string; // 仅 tmux
+}
+
+export interface RemoteProcess {
+  pid: number;
+  ppid: number;
+  user: string;
+  cpu: number;
+  mem: number;
+  rss_kb: number;
+  elapsed: string;
+  started: string; // 结束进程时作为 confirm
+  command: string;
+  args: string;
+}
+
+export interface RemoteListener {
+  proto: 'tcp' | 'tcp6' | 'udp' | 'udp6';
+  addr: string; // * 表示所有地址
+  port: number;
+  pid?: number;
+  process?: string;
+}
+
+// 生成的 SSH 密钥，私钥保存在运行 Web 服务的机器上
+export interface GeneratedKey {
+  path: string;
+  type: 'ed25519' | 'rsa' | 'ecdsa';
+  public_key: string; // authorized_keys 格式
+  fingerprint: string;
+}
+
+export interface DeployKeyResult {
+  fingerprint: string;
+  switched: boolean; // 已验证密钥登录并改为密钥认证
+  server: Server;
+}
+
+// 一个服务器的密钥轮换结果
+export interface RotateResult {
+  id: string;
+  name: string;
+  ok: boolean; // 新密钥已部署并验证，配置已切换
+  old_key_removed: boolean;
+  stage?: 'deploy' | 'verify' | 'save' | 'remove'; // 失败的步骤，ok 时只可能是 remove（旧公钥未删除）
+  error?: string;
+}
+
+export interface RotateKeysResponse {
+  key: GeneratedKey;
+  ok: number;
+  failed: number;
+  results: RotateResult[];
+}
+
+export interface TailOptions {
+  server: string; // 服务器 ID 或名称
+  path: string;
+  follow?: boolean;
+  lines?: number;
+  grep?: string; // 正则，只推送匹配的行
+  max_rate?: number; // 每秒最多推送的行数
+}
+
+export interface TerminalPreset extends TerminalOptions {
+  name: string;
 }
 
 export interface RoutePreference {
@@ -40,11 +196,78 @@ export interface TransferProgress {
   file_name: string;
   total_bytes: number;
   sent_bytes: number;
-  speed_bytes_per_sec: number;
+  speed_bytes_per_sec: number; // 平滑速度（EWMA）
+  instant_speed_bytes_per_sec: number;
+  average_speed_bytes_per_sec: number;
   eta_seconds: number;
   status: 'pending' | 'running' | 'completed' | 'failed';
   error?: string;
+  error_code?: string; // 与 ApiError.code 相同的错误代码
   percentage: number;
+  files?: FileProgress[]; // 目录上传的逐文件进度
+}
+
+// 分块上传的状态，offset 为服务端已接收的字节数
+// 打包下载远程目录，进度通过 getFetchDirProgress 查询
+export interface FetchDirRequest {
+  server: string; // 服务器 ID 或名称
+  path: string;
+  via?: string[]; // 为空时使用服务器的网关链
+  remote_tmp?: string; // 远端压缩包的存放目录，默认 $TMPDIR 或 /tmp
+}
+
+// 上传覆盖前保留的旧版本（<name>.bak-<时间>）
+export interface RemoteBackup {
+  path: string;
+  time: string;
+  size: number;
+}
+
+export interface BackupList {
+  server: string;
+  path: string;
+  keep: number; // upload.backups 中的保留数，0 表示该目录未开启备份
+  backups: RemoteBackup[]; // 从新到旧
+}
+
+// 覆盖远端已有文件时的处理：diff 先返回 409 ERR_OVERWRITE_CONFIRM 供确认，force 直接覆盖
+export type OverwriteMode = 'diff' | 'force';
+
+// 覆盖确认响应（409 ERR_OVERWRITE_CONFIRM）
+export interface OverwriteConfirm {
+  error: string;
+  code: 'ERR_OVERWRITE_CONFIRM';
+  path: string;
+  checksum?: string; // 远端现有内容的 sha256
+  diff?: string; // 远端现有内容到新内容的 unified diff
+  binary?: boolean; // 不是文本，无法给出 diff
+  too_large?: boolean; // 超过在线编辑的大小上限，无法给出 diff
+}
+
+// 在线编辑的远程文本文件，保存时回传 checksum 做乐观锁
+export interface EditFile {
+  server: string;
+  path: string;
+  content: string;
+  checksum: string; // 内容的 sha256
+  size: number;
+}
+
+export interface ChunkedUploadInfo {
+  upload_id: string;
+  file_name: string;
+  size: number;
+  offset: number;
+  chunk_size: number; // 建议的分块大小
+  expires_at: string; // 此后仍未完成的上传被丢弃
+}
+
+export interface FileProgress {
+  name: string;
+  size: number;
+  sent_bytes: number;
+  status: 'pending' | 'running' | 'completed' | 'failed';
+  error?: string;
 }
 
 export interface ProxyInfo {
@@ -54,6 +277,11 @@ export interface ProxyInfo {
   remote_port: number;
   active: boolean;
   connection_count: number;
+  chain_connected: boolean;
+  chain_healthy: boolean;
+  chain_error?: string;
+  reconnecting?: boolean;
+  reconnects?: number;
 }
 
 export interface LatencyReport {
@@ -67,8 +295,210 @@ export interface LatencyReport {
   error?: string;
 }
 
+// 第一跳某个解析地址的连接尝试（多条 A/AAAA 记录时并行竞速）
+export interface DialAttempt {
+  addr: string;
+  latency: number; // 纳秒
+  error?: string;
+  chosen: boolean;
+}
+
+// 多路径对比中一条路径的汇总
+export interface PathComparison {
+  label: string;
+  path: {
+    from: string;
+    to: string;
+    via: string[];
+  };
+  hop_count: number;
+  sent: number;
+  received: number;
+  loss: number; // 0-1
+  latency_ms: number; // 成功探测的平均延迟
+  min_ms: number;
+  max_ms: number;
+  error?: string;
+  timestamp: string;
+  dials?: DialAttempt[];
+}
+
+// 路由追踪中的一个路由器
+export interface TraceHop {
+  ttl: number;
+  host: string; // 无响应时为 "*"
+  loss: number; // 0-1
+  avg_ms: number;
+}
+
+// 跳板链中的一段：在 from 上追踪到 to 的路由
+export interface TraceSegment {
+  from: string;
+  to: string;
+  to_host: string;
+  tool?: 'mtr' | 'traceroute';
+  hops: TraceHop[] | null;
+  trace_error?: string;
+  reached: boolean;
+  error?: string;
+}
+
+// 整条链路的逐段追踪结果
+export interface TraceReport {
+  target: string;
+  segments: TraceSegment[];
+  last_reachable?: string;
+}
+
+// 经跳板链最后一跳对 host:port 的 TCP 连接检查
+export interface TCPingResult {
+  address: string;
+  via: string[]; // 为空表示从本机连接
+  sent: number;
+  received: number;
+  loss: number; // 0-1
+  latency_ms: number;
+  min_ms: number;
+  max_ms: number;
+  banner?: string;
+  error?: string;
+  timestamp: string;
+}
+
+// 连接池中一个目标的连接数
+export interface PoolKeyStat {
+  key: string; // user@host:port
+  total: number;
+  active: number;
+  idle: number;
+  warm: number; // 预热后还没有被使用过
+  rtt_ms: number; // 最近一次 keepalive 的平均往返时间，0 表示还没有测量
+}
+
+export interface PoolSnapshot {
+  total: number;
+  active: number;
+  idle: number;
+  warm: number;
+  wait_count: number;
+  acquire_errors: number;
+  keepalive_evictions: number; // 因 keepalive 连续无回复而关闭的连接数
+  keys: PoolKeyStat[];
+}
+
+// Web 终端会话
+export interface TerminalSessionInfo {
+  id: string;
+  server: string;
+  owner: string;
+  started_at: string;
+  connection?: number; // 池化连接编号，相同的会话共用一条链
+  chain?: string[]; // 经过的服务器名称，最后一个为目标
+  last_input_at: string; // 最后一次键盘输入，没有时为开始时间
+  last_output_at: string; // 最后一次终端输出
+  idle_seconds: number; // 距最后一次键盘输入的秒数，用于显示“idle 23m”
+}
+
+// GET/POST /api/sessions/idle 的结果
+export interface IdleSessions {
+  threshold_seconds: number;
+  sessions: TerminalSessionInfo[];
+  warned?: number; // POST 时已在终端中提示的会话数
+}
+
+// 共用一条链的终端会话
+export interface SessionGroup {
+  connection: number;
+  chain: string[];
+  sessions: TerminalSessionInfo[];
+}
+
+// 紧急停止的结果，各项为停止的数量
+export interface PanicResult {
+  proxies: number;
+  portal_mappings: number;
+  agent_forwards: number;
+  sessions: number;
+  uploads: number;
+  chains: number;
+}
+
+// 活动连接：代理或 Portal 映射转发的连接、Web 终端会话
+export interface ConnectionInfo {
+  id: string; // proxy:<代理ID>:<编号>、portal:<映射ID>:<编号> 或 terminal:<会话ID>
+  kind: 'proxy' | 'portal' | 'terminal';
+  parent: string;
+  source: string;
+  destination: string;
+  bytes_in: number;
+  bytes_out: number;
+  started_at: string;
+  age_seconds: number;
+  owner?: string;
+}
+
+export interface WarmChainsResult {
+  key: string;
+  requested: number;
+  warmed: number;
+  pool: PoolKeyStat;
+}
+
+// 一个被占用或已登记的本地地址
+export interface PortUse {
+  addr: string;
+  port: number;
+  kind: 'proxy' | 'mapping' | 'profile';
+  id: string;
+  name?: string;
+  active: boolean;
+}
+
+export interface PortsResponse {
+  auto_min: number;
+  auto_max: number;
+  uses: PortUse[];
+}
+
 export type Server = Hop;
 
+// 指向不存在服务器的引用
+export interface DanglingRef {
+  kind: 'server' | 'route' | 'profile' | 'portal_mapping';
+  owner: string;
+  owner_id?: string;
+  field: string;
+  ref: string;
+  fix: string;
+}
+
+export interface ReferencesReport {
+  dangling: DanglingRef[];
+  fixed?: DanglingRef[];
+}
+
+// GET/POST /api/config/import-ssh：content 为空时读取运行 gmssh 的用户的 ~/.ssh/config
+export interface ImportSSHRequest {
+  content?: string;
+  hosts?: string[]; // 只导入这些别名及它们的网关
+  dry_run?: boolean;
+}
+
+export interface ImportSSHResult {
+  path?: string;
+  found: number;
+  imported: (Server & { gateway?: string })[]; // dry_run 时网关仍按名称引用（gateway）
+  skipped?: string[]; // 名称已存在的主机
+  dry_run?: boolean;
+}
+
+// 回收站中的服务器，过期后自动清除
+export interface TrashItem {
+  hop: Server;
+  deleted_at: string;
+  expires_at: string;
+}
+
 export type PortalProtocol = 'tcp' | 'http' | 'websocket';
 
 export interface PortMapping {
@@ -81,9 +511,11 @@ export interface PortMapping {
   protocol: PortalProtocol;
   enabled: boolean;
   portal_server?: string;
+  resolver?: string; // remote（默认）、system 或 dns:<server>
   active?: boolean;
   connection_count?: number;
   bytes_transferred?: number;
+  exposed?: boolean; // 本地地址能从本机以外访问
 }
 
 export interface PortalStatus {
@@ -91,3 +523,140 @@ export interface PortalStatus {
   mappings: PortMapping[];
   server_addr?: string;
 }
+
+// API 错误响应：code 为稳定的错误代码（见 docs/api-errors.md），error 随语言变化
+export interface ApiError {
+  error: string;
+  code: string;
+}
+
+// 路由延迟监控状态
+export interface RouteAlertState {
+  route: string;
+  from_id: string;
+  to_id: string;
+  via_id?: string;
+  threshold_ms: number;
+  last_latency_ms: number;
+  last_error?: string;
+  last_probe: string;
+  consecutive: number;
+  alerting: boolean;
+}
+
+// 路由延迟告警或恢复事件
+export interface AlertEvent {
+  type: 'latency_exceeded' | 'latency_recovered';
+  route: string;
+  from_id: string;
+  to_id: string;
+  via_id?: string;
+  path: string[];
+  latency_ms: number;
+  threshold_ms: number;
+  consecutive: number;
+  error?: string;
+  time: string;
+  alternative?: string[];
+  alternative_latency_ms?: number;
+  switched_mappings?: string[];
+}
+
+export interface AlertsResponse {
+  routes: RouteAlertState[];
+  events: AlertEvent[];
+}
+
+// 维护窗口：期间不允许对覆盖的服务器建立新的终端会话和传输
+export interface MaintenanceWindow {
+  id: string;
+  servers?: string[];
+  tags?: string[];
+  start: string;
+  end: string;
+  message?: string;
+  drain?: boolean; // 窗口开始时关闭已有终端会话
+  created_by?: string;
+  active: boolean;
+}
+
+// 首次配置状态，needed 为 true 时显示配置向导
+export interface SetupStatus {
+  needed: boolean;
+  auth_enabled: boolean;
+  ssh_config?: string; // 可导入的 OpenSSH 配置路径
+  ssh_hosts?: (Omit<Server, 'id'> & { gateway?: string })[];
+}
+
+// 向导中的服务器，gateway 为排在前面的服务器或已有服务器的名称
+export interface SetupServer extends Partial<Omit<Server, 'id' | 'server_type'>> {
+  name: string;
+  host: string;
+  user: string;
+  gateway?: string;
+}
+
+export interface SetupRequest {
+  import_ssh_config?: boolean;
+  servers?: SetupServer[];
+  admin?: string; // 非空时生成管理员令牌
+}
+
+export interface SetupResult {
+  servers: Server[];
+  imported: number;
+  admin?: string;
+  token?: string; // 只返回这一次
+}
+
+// 添加服务器时未填写字段的默认值
+export interface ServerDefaults {
+  user?: string;
+  key_path?: string; // 仅用于密钥认证
+  port?: number;
+}
+
+// 最近使用的终端或上传目标
+export interface RecentTarget {
+  user: string;
+  kind: 'terminal' | 'upload';
+  server_id: string;
+  server: string; // 当前名称
+  path?: string; // 上传的目标路径
+  via?: string[];
+  used_at: string;
+}
+
+// 一段时间内的使用量，经过网关的使用同时计入网关
+export interface UsageCounters {
+  sessions: number; // 打开的终端会话
+  transfers: number; // 完成的上传
+  bytes: number; // 终端、上传和隧道经过的字节数
+  tunnel_seconds: number; // 代理和 Portal 映射的运行时长
+}
+
+export interface UsageDay extends UsageCounters {
+  date: string; // YYYY-MM-DD
+}
+
+// GET /api/servers/{id}/usage
+export interface UsageReport {
+  server_id: string;
+  since: string;
+  days: UsageDay[];
+  total: UsageCounters;
+  tunnel_hours: number;
+}
+
+// GET /api/usage 的一项，按流量从大到小
+export interface ServerUsage extends UsageCounters {
+  server_id: string;
+  server: string;
+  tunnel_hours: number;
+}
+
+// 当前用户最近使用的目标和收藏的服务器
+export interface RecentList {
+  recent: RecentTarget[];
+  favorites: Server[];
+}